@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,6 +14,8 @@ import (
 	"neuralmail/internal/billing"
 	"neuralmail/internal/cloudapi"
 	"neuralmail/internal/config"
+	"neuralmail/internal/observability"
+	"neuralmail/internal/queue"
 	"neuralmail/internal/store"
 )
 
@@ -21,6 +24,18 @@ func main() {
 	if err != nil {
 		log.Fatalf("config error: %v", err)
 	}
+	if err := observability.SetupLogging(cfg); err != nil {
+		log.Fatalf("config error: %v", err)
+	}
+	problems := cfg.Validate()
+	for _, p := range problems {
+		if p.Severity == config.SeverityWarning {
+			slog.Warn("config warning", "field", p.Field, "problem", p.Message)
+		}
+	}
+	if err := problems.Err(); err != nil {
+		log.Fatalf("config error: %v (run `neuralmail config check` for a full report)", err)
+	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
@@ -30,6 +45,11 @@ func main() {
 		log.Fatalf("store error: %v", err)
 	}
 	defer st.Close()
+	if cfg.Database.ReplicaDSN != "" {
+		if err := st.UseReplica(cfg.Database.ReplicaDSN, cfg.Database.ReplicaMaxLag); err != nil {
+			log.Fatalf("read replica error: %v", err)
+		}
+	}
 
 	if err := store.Migrate(ctx, st.DB()); err != nil {
 		log.Fatalf("migration error: %v", err)
@@ -38,7 +58,21 @@ func main() {
 	authSvc := auth.NewService(cfg, st)
 	billingSvc := billing.NewStripeService(cfg, st)
 	tokenSvc := cloudapi.NewTokenService(st, cfg.Security.TokenSigningKey)
+	tokenSvc.Issuer = cfg.Auth.Issuer
+	tokenSvc.Audience = cfg.Auth.Audience
 	handler := cloudapi.NewHandler(cfg, st, authSvc, billingSvc, tokenSvc)
+	q, err := queue.New(cfg)
+	if err != nil {
+		log.Fatalf("queue error: %v", err)
+	}
+	defer q.Close()
+	handler.LiveSessions = q
+	if cfg.Billing.UsageReportInterval > 0 {
+		if err := billingSvc.CheckMeteredPrices(ctx); err != nil {
+			log.Fatalf("metered billing error: %v", err)
+		}
+		go reportUsage(ctx, billingSvc, cfg.Billing.UsageReportInterval)
+	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
@@ -58,8 +92,27 @@ func main() {
 		_ = srv.Shutdown(context.Background())
 	}()
 
-	log.Printf("nerve-control-plane listening on %s", cfg.HTTP.Addr)
+	slog.Info("nerve-control-plane listening", "addr", cfg.HTTP.Addr)
 	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("server error: %v", err)
 	}
 }
+
+// reportUsage pushes metered usage to Stripe every interval until ctx ends.
+func reportUsage(ctx context.Context, svc *billing.StripeService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			res, err := svc.ReportUsage(ctx)
+			if err != nil {
+				slog.Error("usage report failed", "err", err)
+				continue
+			}
+			slog.Info("usage report complete", "reported", res.Reported, "unchanged", res.Unchanged, "failed", res.Failed)
+		}
+	}
+}
@@ -3,11 +3,18 @@ package main
 import (
 	"context"
 	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"neuralmail/internal/config"
+	"neuralmail/internal/observability"
 	"neuralmail/internal/reconcile"
+	"neuralmail/internal/residency"
 	"neuralmail/internal/store"
+	"neuralmail/internal/vector"
 )
 
 func main() {
@@ -15,6 +22,9 @@ func main() {
 	if err != nil {
 		log.Fatalf("config error: %v", err)
 	}
+	if err := observability.SetupLogging(cfg); err != nil {
+		log.Fatalf("config error: %v", err)
+	}
 
 	st, err := store.Open(cfg.Database.DSN)
 	if err != nil {
@@ -22,15 +32,57 @@ func main() {
 	}
 	defer st.Close()
 
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	if err := store.Migrate(ctx, st.DB()); err != nil {
 		log.Fatalf("migration error: %v", err)
 	}
 
 	svc := reconcile.NewService(st)
+	if cfg.Embedding.Provider != "" && cfg.Embedding.Provider != "noop" {
+		router, err := residency.Open(cfg, st, vector.NewQdrant(cfg.Qdrant.URL, cfg.Qdrant.Collection))
+		if err != nil {
+			log.Fatalf("residency error: %v", err)
+		}
+		defer router.Close()
+		for _, region := range router.Regions() {
+			backend, err := router.Backend(region)
+			if err != nil {
+				log.Fatalf("residency error: %v", err)
+			}
+			svc.Vectors = append(svc.Vectors, reconcile.VectorRegion{Region: region, Store: backend.Store, Index: backend.Vector})
+		}
+	}
+	if err := runOnce(ctx, svc); err != nil {
+		log.Fatalf("reconciliation failed: %v", err)
+	}
+
+	// A zero interval keeps the one-shot behaviour for cron-style deployments.
+	interval := cfg.Metering.ReconcileInterval
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := runOnce(ctx, svc); err != nil {
+				slog.Error("reconciliation failed", "err", err)
+			}
+		}
+	}
+}
+
+func runOnce(ctx context.Context, svc *reconcile.Service) error {
 	report, err := svc.Run(ctx)
 	if err != nil {
-		log.Fatalf("reconciliation failed: %v", err)
+		return err
 	}
-	log.Printf("reconciliation complete: counters_repaired=%d periods_rolled=%d", report.CountersRepaired, report.PeriodsRolled)
+	slog.Info("reconciliation complete", "counters_checked", report.CountersChecked, "counters_repaired", report.CountersRepaired,
+		"periods_rolled", report.PeriodsRolled, "trials_expired", report.TrialsExpired, "audit_pruned", report.AuditPruned,
+		"vector_orphans", report.VectorOrphans, "discrepancies", len(report.Discrepancies))
+	return nil
 }
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"neuralmail/internal/config"
+)
+
+// adminConsole is a menu-driven client for the neuralmaild control API.
+type adminConsole struct {
+	base   string
+	token  string
+	client *http.Client
+	in     *bufio.Reader
+	out    io.Writer
+}
+
+// runAdmin runs a tenant management command, or without one opens the
+// interactive console.
+func runAdmin(cfg config.Config, args []string) {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		runTenantCommand(cfg, args)
+		return
+	}
+	fs := flag.NewFlagSet("admin", flag.ExitOnError)
+	base := fs.String("url", envOr("NM_ADMIN_URL", localAdminBase(cfg)), "base URL of the running neuralmaild instance")
+	token := fs.String("token", cfg.Security.APIKey, "control API key (defaults to NM_API_KEY)")
+	_ = fs.Parse(args)
+
+	console := &adminConsole{
+		base:   strings.TrimRight(*base, "/"),
+		token:  *token,
+		client: &http.Client{Timeout: 10 * time.Second},
+		in:     bufio.NewReader(os.Stdin),
+		out:    os.Stdout,
+	}
+	if err := console.run(); err != nil && err != io.EOF {
+		log.Fatalf("admin: %v", err)
+	}
+}
+
+func (c *adminConsole) run() error {
+	fmt.Fprintf(c.out, "Nerve admin — connected to %s\n", c.base)
+	for {
+		c.printStatus()
+		fmt.Fprintln(c.out, "\n  1) Browse inboxes and threads")
+		fmt.Fprintln(c.out, "  2) Dead-letter queue")
+		fmt.Fprintln(c.out, "  3) Toggle maintenance mode")
+		fmt.Fprintln(c.out, "  r) Refresh")
+		fmt.Fprintln(c.out, "  q) Quit")
+		choice, err := c.prompt("> ")
+		if err != nil {
+			return err
+		}
+		switch choice {
+		case "1":
+			err = c.browseInboxes()
+		case "2":
+			err = c.deadLetters()
+		case "3":
+			err = c.toggleMaintenance()
+		case "r", "":
+		case "q", "quit", "exit":
+			return nil
+		default:
+			fmt.Fprintln(c.out, "unknown option")
+		}
+		if err == io.EOF {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintf(c.out, "error: %v\n", err)
+		}
+	}
+}
+
+func (c *adminConsole) printStatus() {
+	var status struct {
+		QueueDepth   int64 `json:"queue_depth"`
+		DLQDepth     int64 `json:"dlq_depth"`
+		Maintenance  bool  `json:"maintenance"`
+		MessageCount int   `json:"message_count"`
+		MailLoops    struct {
+			AutomatedInbound  int64 `json:"automated_inbound_24h"`
+			LoopingThreads    int64 `json:"looping_threads"`
+			SuppressedReplies int64 `json:"suppressed_auto_replies"`
+		} `json:"mail_loops"`
+		Closures struct {
+			Closed         int64   `json:"closed"`
+			ReopenRate     float64 `json:"reopen_rate"`
+			AutoClosed     int64   `json:"auto_closed"`
+			AutoReopenRate float64 `json:"auto_reopen_rate"`
+		} `json:"thread_closures_30d"`
+	}
+	if err := c.call(http.MethodGet, "/control/status", nil, &status); err != nil {
+		fmt.Fprintf(c.out, "\nstatus unavailable: %v\n", err)
+		return
+	}
+	mode := "off"
+	if status.Maintenance {
+		mode = "ON"
+	}
+	fmt.Fprintf(c.out, "\nqueue=%d  dead-lettered=%d  messages=%d  maintenance=%s\n",
+		status.QueueDepth, status.DLQDepth, status.MessageCount, mode)
+	fmt.Fprintf(c.out, "automated inbound (24h)=%d  looping threads=%d  suppressed auto-replies=%d\n",
+		status.MailLoops.AutomatedInbound, status.MailLoops.LoopingThreads, status.MailLoops.SuppressedReplies)
+	fmt.Fprintf(c.out, "closed (30d)=%d  reopened=%.0f%%  auto-closed=%d  reopened=%.0f%%\n",
+		status.Closures.Closed, 100*status.Closures.ReopenRate, status.Closures.AutoClosed, 100*status.Closures.AutoReopenRate)
+
+	var queues struct {
+		Queues []struct {
+			OldestAgeSec float64 `json:"oldest_age_seconds"`
+			Processed    int64   `json:"processed"`
+			Failed       int64   `json:"failed"`
+		} `json:"queues"`
+	}
+	if err := c.call(http.MethodGet, "/control/queue", nil, &queues); err == nil && len(queues.Queues) > 0 {
+		q := queues.Queues[0]
+		fmt.Fprintf(c.out, "oldest job=%.0fs  processed=%d  failed=%d\n", q.OldestAgeSec, q.Processed, q.Failed)
+	}
+
+	var leases struct {
+		Leases []struct {
+			Holder  string `json:"holder"`
+			Expired bool   `json:"expired"`
+		} `json:"leases"`
+	}
+	if err := c.call(http.MethodGet, "/control/poll-leases", nil, &leases); err == nil && len(leases.Leases) > 0 {
+		holders := map[string]bool{}
+		expired := 0
+		for _, l := range leases.Leases {
+			if l.Expired {
+				expired++
+				continue
+			}
+			holders[l.Holder] = true
+		}
+		fmt.Fprintf(c.out, "polled inboxes=%d  replicas polling=%d  expired leases=%d\n", len(leases.Leases)-expired, len(holders), expired)
+	}
+}
+
+func (c *adminConsole) browseInboxes() error {
+	var resp struct {
+		Inboxes []struct {
+			ID      string `json:"id"`
+			Address string `json:"address"`
+			Status  string `json:"status"`
+		} `json:"inboxes"`
+	}
+	if err := c.call(http.MethodGet, "/control/inboxes", nil, &resp); err != nil {
+		return err
+	}
+	if len(resp.Inboxes) == 0 {
+		fmt.Fprintln(c.out, "no inboxes")
+		return nil
+	}
+	for i, inbox := range resp.Inboxes {
+		fmt.Fprintf(c.out, "  %d) %s [%s] %s\n", i+1, inbox.Address, inbox.Status, inbox.ID)
+	}
+	idx, err := c.pick(len(resp.Inboxes))
+	if err != nil || idx < 0 {
+		return err
+	}
+	return c.browseThreads(resp.Inboxes[idx].ID)
+}
+
+func (c *adminConsole) browseThreads(inboxID string) error {
+	var resp struct {
+		Threads []struct {
+			ID        string    `json:"id"`
+			Subject   string    `json:"subject"`
+			Status    string    `json:"status"`
+			UpdatedAt time.Time `json:"updated_at"`
+		} `json:"threads"`
+	}
+	if err := c.call(http.MethodGet, "/control/threads?limit=20&inbox_id="+inboxID, nil, &resp); err != nil {
+		return err
+	}
+	if len(resp.Threads) == 0 {
+		fmt.Fprintln(c.out, "no threads")
+		return nil
+	}
+	for i, t := range resp.Threads {
+		fmt.Fprintf(c.out, "  %d) %s  [%s] %s\n", i+1, t.UpdatedAt.Format("2006-01-02 15:04"), t.Status, t.Subject)
+	}
+	idx, err := c.pick(len(resp.Threads))
+	if err != nil || idx < 0 {
+		return err
+	}
+
+	var thread struct {
+		Subject  string `json:"subject"`
+		Messages []struct {
+			Direction string    `json:"direction"`
+			From      string    `json:"from"`
+			Text      string    `json:"text"`
+			CreatedAt time.Time `json:"created_at"`
+		} `json:"messages"`
+	}
+	if err := c.call(http.MethodGet, "/control/threads/"+resp.Threads[idx].ID, nil, &thread); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "\n== %s ==\n", thread.Subject)
+	for _, m := range thread.Messages {
+		fmt.Fprintf(c.out, "\n[%s] %s %s\n%s\n", m.CreatedAt.Format("2006-01-02 15:04"), m.Direction, m.From, m.Text)
+	}
+	return nil
+}
+
+func (c *adminConsole) deadLetters() error {
+	var resp struct {
+		Jobs []struct {
+			MessageID string    `json:"message_id"`
+			TraceID   string    `json:"trace_id"`
+			Attempts  int       `json:"attempts"`
+			Error     string    `json:"error"`
+			FailedAt  time.Time `json:"failed_at"`
+		} `json:"jobs"`
+	}
+	if err := c.call(http.MethodGet, "/control/dlq?limit=20", nil, &resp); err != nil {
+		return err
+	}
+	if len(resp.Jobs) == 0 {
+		fmt.Fprintln(c.out, "dead-letter queue is empty")
+		return nil
+	}
+	for _, job := range resp.Jobs {
+		fmt.Fprintf(c.out, "  %s  %s  attempts=%d trace=%s  %s\n", job.FailedAt.Format("2006-01-02 15:04"), job.MessageID, job.Attempts, job.TraceID, job.Error)
+	}
+	answer, err := c.prompt("Retry all dead-lettered jobs? [y/N] ")
+	if err != nil || !strings.EqualFold(answer, "y") {
+		return err
+	}
+	var retried struct {
+		Retried int `json:"retried"`
+	}
+	if err := c.call(http.MethodPost, "/control/dlq/retry", map[string]any{}, &retried); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "requeued %d job(s)\n", retried.Retried)
+	return nil
+}
+
+func (c *adminConsole) toggleMaintenance() error {
+	var current struct {
+		Maintenance bool `json:"maintenance"`
+	}
+	if err := c.call(http.MethodGet, "/control/maintenance", nil, &current); err != nil {
+		return err
+	}
+	verb := "Enable"
+	if current.Maintenance {
+		verb = "Disable"
+	}
+	answer, err := c.prompt(verb + " maintenance mode? [y/N] ")
+	if err != nil || !strings.EqualFold(answer, "y") {
+		return err
+	}
+	if err := c.call(http.MethodPost, "/control/maintenance", map[string]any{"enabled": !current.Maintenance}, &current); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "maintenance mode is now %t\n", current.Maintenance)
+	return nil
+}
+
+// pick reads a 1-based selection and returns its index, or -1 to go back.
+func (c *adminConsole) pick(n int) (int, error) {
+	answer, err := c.prompt("select (enter to go back): ")
+	if err != nil || answer == "" {
+		return -1, err
+	}
+	idx, convErr := strconv.Atoi(answer)
+	if convErr != nil || idx < 1 || idx > n {
+		fmt.Fprintln(c.out, "invalid selection")
+		return -1, nil
+	}
+	return idx - 1, nil
+}
+
+func (c *adminConsole) prompt(label string) (string, error) {
+	fmt.Fprint(c.out, label)
+	line, err := c.in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+func (c *adminConsole) call(method, path string, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequest(method, c.base+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
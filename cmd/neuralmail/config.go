@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"neuralmail/internal/config"
+)
+
+// runConfig serves `neuralmail config check`: it reports what Validate
+// finds in the configuration at NM_CONFIG plus the environment, and the
+// effective values with secrets masked, exiting 1 if there are errors.
+func runConfig(cfg config.Config, args []string) {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Println("Usage: neuralmail config check [-json] [-values=false]")
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("config check", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	values := fs.Bool("values", true, "include the effective values")
+	_ = fs.Parse(args[1:])
+
+	problems := cfg.Validate()
+	if problems == nil {
+		problems = config.Problems{}
+	}
+	var settings []config.Setting
+	if *values {
+		settings = cfg.Settings()
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(map[string]any{
+			"config_path": os.Getenv("NM_CONFIG"),
+			"valid":       problems.Err() == nil,
+			"problems":    problems,
+			"settings":    settings,
+		})
+	} else {
+		printConfigReport(os.Stdout, os.Getenv("NM_CONFIG"), problems, settings)
+	}
+	if problems.Err() != nil {
+		os.Exit(1)
+	}
+}
+
+func printConfigReport(w io.Writer, path string, problems config.Problems, settings []config.Setting) {
+	if path == "" {
+		path = "(none, defaults and environment only)"
+	}
+	fmt.Fprintf(w, "config: %s\n\n", path)
+	if len(problems) == 0 {
+		fmt.Fprintln(w, "no problems found")
+	}
+	for _, p := range problems {
+		fmt.Fprintf(w, "%-7s %s\n", p.Severity, p)
+	}
+	if len(settings) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\neffective values:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, s := range settings {
+		fmt.Fprintf(tw, "  %s\t%s\n", s.Key, s.Value)
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/embed"
+	"neuralmail/internal/jmap"
+	"neuralmail/internal/store"
+	"neuralmail/internal/vector"
+)
+
+// errSkipped marks a check that does not apply to the configuration.
+var errSkipped = errors.New("skipped")
+
+// doctorCheck is one line of the doctor's report.
+type doctorCheck struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Hint      string `json:"hint,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+// doctorProbe runs a check and returns a detail line; hint turns its error
+// into what to do about it.
+type doctorProbe struct {
+	name string
+	deep bool
+	run  func(ctx context.Context) (string, error)
+	hint func(err error) string
+}
+
+// runDoctor implements `neuralmail doctor`: ping each dependency, then
+// exercise it the way neuralmaild will (a JMAP query, an embedding call,
+// the Qdrant collection's dimension, the schema version and an MCP
+// initialize). It exits 1 if any check fails.
+func runDoctor(cfg config.Config, args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	shallow := fs.Bool("shallow", false, "only check that each dependency answers")
+	jsonOut := fs.Bool("json", false, "print the report as JSON")
+	timeout := fs.Duration("timeout", 10*time.Second, "time allowed for each check")
+	_ = fs.Parse(args)
+
+	var report []doctorCheck
+	failed := false
+	for _, probe := range doctorProbes(cfg) {
+		if probe.deep && *shallow {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		started := time.Now()
+		detail, err := probe.run(ctx)
+		cancel()
+		check := doctorCheck{Name: probe.name, Status: "ok", Detail: detail, LatencyMS: time.Since(started).Milliseconds()}
+		switch {
+		case errors.Is(err, errSkipped):
+			check.Status = "skip"
+			check.Detail = strings.TrimPrefix(strings.TrimPrefix(err.Error(), errSkipped.Error()), ": ")
+		case err != nil:
+			check.Status = "fail"
+			check.Error = err.Error()
+			if probe.hint != nil {
+				check.Hint = probe.hint(err)
+			}
+			failed = true
+		}
+		report = append(report, check)
+		if !*jsonOut {
+			printDoctorCheck(check)
+		}
+	}
+	if *jsonOut {
+		raw, _ := json.MarshalIndent(map[string]any{"ok": !failed, "checks": report}, "", "  ")
+		fmt.Println(string(raw))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func printDoctorCheck(c doctorCheck) {
+	switch c.Status {
+	case "ok":
+		if c.Detail != "" {
+			fmt.Printf("%s: OK (%s)\n", c.Name, c.Detail)
+		} else {
+			fmt.Printf("%s: OK\n", c.Name)
+		}
+	case "skip":
+		fmt.Printf("%s: SKIP (%s)\n", c.Name, c.Detail)
+	default:
+		fmt.Printf("%s: FAIL (%s)\n", c.Name, c.Error)
+		if c.Hint != "" {
+			fmt.Printf("  hint: %s\n", c.Hint)
+		}
+	}
+}
+
+func doctorProbes(cfg config.Config) []doctorProbe {
+	mcpURL := localHTTPBase(cfg) + "/mcp"
+	return []doctorProbe{
+		{name: "smtp", run: func(context.Context) (string, error) { return "", pingSMTP(cfg) },
+			hint: reachHint("the SMTP server", "smtp.host")},
+		{name: "database", run: func(ctx context.Context) (string, error) { return "", pingDatabase(ctx, cfg.Database.DSN) },
+			hint: reachHint("Postgres", "database.dsn (NM_DB_DSN)")},
+		{name: "redis", run: func(context.Context) (string, error) { return "", pingTCP(cfg.Redis.URL) },
+			hint: reachHint("Redis", "redis.url")},
+		{name: "qdrant", run: func(context.Context) (string, error) { return "", pingHTTP(cfg.Qdrant.URL) },
+			hint: reachHint("Qdrant", "qdrant.url (NM_QDRANT_URL)")},
+		{name: "jmap", run: func(context.Context) (string, error) { return "", pingJMAP(cfg) },
+			hint: jmapHint},
+		{name: "mcp", run: func(context.Context) (string, error) { return "", pingHTTP(localHTTPBase(cfg) + "/healthz") },
+			hint: mcpHint},
+
+		{name: "jmap.query", deep: true, run: func(ctx context.Context) (string, error) { return checkJMAPQuery(ctx, cfg) },
+			hint: jmapHint},
+		{name: "embedding", deep: true, run: func(ctx context.Context) (string, error) { return checkEmbedding(ctx, cfg) },
+			hint: embeddingHint(cfg)},
+		{name: "qdrant.collection", deep: true, run: func(ctx context.Context) (string, error) { return checkQdrantCollection(ctx, cfg) },
+			hint: qdrantCollectionHint(cfg)},
+		{name: "migrations", deep: true, run: func(ctx context.Context) (string, error) { return checkMigrations(ctx, cfg) },
+			hint: migrationsHint},
+		{name: "mcp.initialize", deep: true, run: func(ctx context.Context) (string, error) { return checkMCPInitialize(ctx, cfg, mcpURL) },
+			hint: mcpHint},
+	}
+}
+
+func checkJMAPQuery(ctx context.Context, cfg config.Config) (string, error) {
+	client, err := jmap.NewJMAPClient(cfg)
+	if errors.Is(err, jmap.ErrNotConfigured) {
+		return "", fmt.Errorf("%w: jmap.url, jmap.username or jmap.password not set", errSkipped)
+	}
+	if err != nil {
+		return "", err
+	}
+	total, err := client.Probe(ctx)
+	if err != nil {
+		return "", err
+	}
+	if total < 0 {
+		return "inbox queried", nil
+	}
+	return fmt.Sprintf("inbox holds %d messages", total), nil
+}
+
+// doctorEmbedder builds the configured embedding provider, or says which
+// setting it lacks.
+func doctorEmbedder(cfg config.Config) (embed.Provider, error) {
+	switch cfg.Embedding.Provider {
+	case "openai":
+		if cfg.LLM.OpenAIKey == "" {
+			return nil, errors.New("embedding.provider is openai but no OpenAI key is set")
+		}
+		return embed.NewOpenAI(cfg.LLM.OpenAIKey, cfg.Embedding.Model, cfg.Embedding.Dim), nil
+	case "ollama":
+		if cfg.LLM.OllamaURL == "" {
+			return nil, errors.New("embedding.provider is ollama but no Ollama URL is set")
+		}
+		return embed.NewOllama(cfg.LLM.OllamaURL, cfg.Embedding.Model, cfg.Embedding.Dim), nil
+	case "noop", "":
+		return nil, fmt.Errorf("%w: embedding.provider is noop, which makes pseudo-vectors locally", errSkipped)
+	}
+	return nil, fmt.Errorf("unknown embedding.provider %q", cfg.Embedding.Provider)
+}
+
+func checkEmbedding(ctx context.Context, cfg config.Config) (string, error) {
+	embedder, err := doctorEmbedder(cfg)
+	if err != nil {
+		return "", err
+	}
+	vectors, err := embedder.Embed(ctx, []string{"neuralmail doctor"})
+	if err != nil {
+		return "", err
+	}
+	if len(vectors) != 1 {
+		return "", fmt.Errorf("asked for 1 embedding, got %d", len(vectors))
+	}
+	if got := len(vectors[0]); got != cfg.Embedding.Dim {
+		return "", &dimMismatch{got: got, want: cfg.Embedding.Dim, what: "the model returns"}
+	}
+	return fmt.Sprintf("%s returned a %d-dimension vector", embedder.Name(), cfg.Embedding.Dim), nil
+}
+
+func checkQdrantCollection(ctx context.Context, cfg config.Config) (string, error) {
+	if cfg.Qdrant.URL == "" {
+		return "", fmt.Errorf("%w: qdrant.url not set", errSkipped)
+	}
+	size, err := vector.NewQdrant(cfg.Qdrant.URL, cfg.Qdrant.Collection).VectorSize(ctx)
+	if err != nil {
+		return "", err
+	}
+	if size != cfg.Embedding.Dim {
+		return "", &dimMismatch{got: size, want: cfg.Embedding.Dim, what: "collection " + cfg.Qdrant.Collection + " holds"}
+	}
+	return fmt.Sprintf("collection %s holds %d-dimension vectors", cfg.Qdrant.Collection, size), nil
+}
+
+func checkMigrations(ctx context.Context, cfg config.Config) (string, error) {
+	db, err := sql.Open("pgx", cfg.Database.DSN)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	current, latest, err := store.MigrationVersions(ctx, db)
+	if err != nil {
+		return "", err
+	}
+	if current != latest {
+		return "", &versionMismatch{current: current, latest: latest}
+	}
+	return fmt.Sprintf("schema at version %d", current), nil
+}
+
+func checkMCPInitialize(ctx context.Context, cfg config.Config, mcpURL string) (string, error) {
+	body, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": map[string]any{}})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, mcpURL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.Security.APIKey != "" {
+		req.Header.Set("X-API-Key", cfg.Security.APIKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		buf := new(bytes.Buffer)
+		_, _ = buf.ReadFrom(resp.Body)
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(buf.String()))
+	}
+	buf := new(bytes.Buffer)
+	_, _ = buf.ReadFrom(resp.Body)
+	parsed, err := parseMCPResponse(buf.String())
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		ServerInfo      struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"serverInfo"`
+	}
+	if err := json.Unmarshal(parsed.Result, &result); err != nil || result.ProtocolVersion == "" {
+		return "", errors.New("initialize result has no protocolVersion")
+	}
+	if resp.Header.Get("MCP-Session-Id") == "" {
+		return "", errors.New("initialize returned no MCP-Session-Id")
+	}
+	return fmt.Sprintf("%s %s, protocol %s", result.ServerInfo.Name, result.ServerInfo.Version, result.ProtocolVersion), nil
+}
+
+type dimMismatch struct {
+	got, want int
+	what      string
+}
+
+func (e *dimMismatch) Error() string {
+	return fmt.Sprintf("%s %d-dimension vectors but embedding.dim is %d", e.what, e.got, e.want)
+}
+
+type versionMismatch struct {
+	current, latest int64
+}
+
+func (e *versionMismatch) Error() string {
+	return fmt.Sprintf("schema at version %d, migrations go up to %d", e.current, e.latest)
+}
+
+func refused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) || strings.Contains(err.Error(), "connection refused")
+}
+
+// dialHint explains a failure to reach what, which settings point at; ok is
+// false for any other error.
+func dialHint(err error, what string, settings string) (hint string, ok bool) {
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr) || strings.Contains(err.Error(), "no such host"):
+		return fmt.Sprintf("the host name does not resolve; outside the compose network, point %s at localhost", settings), true
+	case refused(err):
+		return fmt.Sprintf("nothing is listening; start %s (`neuralmail up` runs the dev stack) or fix %s", what, settings), true
+	}
+	return "", false
+}
+
+func reachHint(what string, settings string) func(error) string {
+	return func(err error) string {
+		if hint, ok := dialHint(err, what, settings); ok {
+			return hint
+		}
+		return fmt.Sprintf("check that %s is reachable at %s", what, settings)
+	}
+}
+
+func jmapHint(err error) string {
+	msg := err.Error()
+	if hint, ok := dialHint(err, "the mail server", "jmap.url (NM_JMAP_URL)"); ok {
+		return hint
+	}
+	switch {
+	case strings.Contains(msg, "401") || strings.Contains(msg, "403"):
+		return "the server refused the login; check jmap.username and jmap.password (NM_JMAP_USERNAME, NM_JMAP_PASSWORD)"
+	case strings.Contains(msg, "404") || strings.Contains(msg, "missing apiUrl"):
+		return "no JMAP session there; set jmap.session_url (NM_JMAP_SESSION_URL) to the server's /.well-known/jmap"
+	case strings.Contains(msg, "inbox mailbox not found"):
+		return "the account has no mailbox with the inbox role; create one or sync a different account"
+	case strings.Contains(msg, "mail account"):
+		return "the login has no mail account; check the user exists on the mail server and has JMAP mail enabled"
+	}
+	return "check jmap.url, jmap.session_url and the mail server's logs"
+}
+
+func embeddingHint(cfg config.Config) func(error) string {
+	return func(err error) string {
+		var dim *dimMismatch
+		if hint, ok := dialHint(err, "Ollama", "llm.ollama_url (NM_OLLAMA_URL)"); ok {
+			return hint
+		}
+		switch {
+		case errors.As(err, &dim):
+			return fmt.Sprintf("set embedding.dim (NM_EMBED_DIM) to %d or pick a model that returns %d dimensions, then run `neuralmaild reindex`", dim.got, dim.want)
+		case strings.Contains(err.Error(), "no OpenAI key"):
+			return "set llm.openai_key (NM_OPENAI_API_KEY), or switch embedding.provider"
+		case strings.Contains(err.Error(), "no Ollama URL"):
+			return "set llm.ollama_url (NM_OLLAMA_URL), or switch embedding.provider"
+		case strings.Contains(err.Error(), "unknown embedding.provider"):
+			return "set embedding.provider (NM_EMBED_PROVIDER) to openai, ollama or noop"
+		case strings.Contains(err.Error(), "401"):
+			return "the provider rejected the key; check NM_OPENAI_API_KEY"
+		case strings.Contains(err.Error(), "404"):
+			return fmt.Sprintf("the provider does not know model %q; check embedding.model (NM_EMBED_MODEL), or `ollama pull` it", cfg.Embedding.Model)
+		}
+		return "check embedding.provider and embedding.model and the provider's status"
+	}
+}
+
+func qdrantCollectionHint(cfg config.Config) func(error) string {
+	return func(err error) string {
+		var dim *dimMismatch
+		if hint, ok := dialHint(err, "Qdrant", "qdrant.url (NM_QDRANT_URL)"); ok {
+			return hint
+		}
+		switch {
+		case errors.Is(err, vector.ErrNoCollection):
+			return fmt.Sprintf("`neuralmaild serve` creates %s on start; create it now with `neuralmaild reindex`, or fix qdrant.collection (NM_QDRANT_COLLECTION)", cfg.Qdrant.Collection)
+		case errors.As(err, &dim):
+			return fmt.Sprintf("the collection was built for another model; run `neuralmaild reindex` to re-embed into a %d-dimension collection, or set embedding.dim back to %d", dim.want, dim.got)
+		}
+		return "check qdrant.url and qdrant.collection"
+	}
+}
+
+func migrationsHint(err error) string {
+	var version *versionMismatch
+	if hint, ok := dialHint(err, "Postgres", "database.dsn (NM_DB_DSN)"); ok {
+		return hint
+	}
+	switch {
+	case errors.As(err, &version) && version.current < version.latest:
+		return "the database is behind; any neuralmaild command (e.g. `neuralmaild serve`) migrates it on start"
+	case errors.As(err, &version):
+		return "the database was migrated by a newer release; upgrade neuralmail before serving from it"
+	case errors.Is(err, os.ErrNotExist) || strings.Contains(err.Error(), "directory"):
+		return "migrations are read from internal/store/migrations; run doctor from the repository root"
+	}
+	return "check database.dsn (NM_DB_DSN) and that the user may read schema_migrations"
+}
+
+func mcpHint(err error) string {
+	msg := err.Error()
+	switch {
+	case refused(err):
+		return "nothing is listening; start `neuralmaild serve` or fix http.addr (NM_HTTP_ADDR)"
+	case strings.Contains(msg, "status 401") || strings.Contains(msg, "status 403"):
+		return "the server refused the call; set NM_API_KEY to the server's security.api_key"
+	case strings.Contains(msg, "status 503"):
+		return "the server is draining or in maintenance mode; check `neuralmail admin` or wait for the restart"
+	}
+	return "check the neuralmaild logs for the failed initialize"
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"neuralmail/internal/config"
+)
+
+// controlPlaneClient talks to the nerve-control-plane API for the operator
+// investigation and tenant management commands.
+type controlPlaneClient struct {
+	base   string
+	apiKey string
+	token  string
+	client *http.Client
+}
+
+func newControlPlaneClient(cfg config.Config, fs *flag.FlagSet) func() *controlPlaneClient {
+	base := fs.String("url", envOr("NM_CONTROL_PLANE_URL", localHTTPBase(cfg)), "base URL of the control plane")
+	apiKey := fs.String("key", cfg.Security.APIKey, "bootstrap admin key (defaults to NM_API_KEY)")
+	token := fs.String("token", os.Getenv("NM_CONTROL_PLANE_TOKEN"), "bearer token of an org billing admin, instead of -key")
+	return func() *controlPlaneClient {
+		return &controlPlaneClient{
+			base:   strings.TrimRight(*base, "/"),
+			apiKey: *apiKey,
+			token:  *token,
+			client: &http.Client{Timeout: 15 * time.Second},
+		}
+	}
+}
+
+func (c *controlPlaneClient) get(ctx context.Context, path string, query url.Values, out any) error {
+	return c.do(ctx, http.MethodGet, path, query, nil, out)
+}
+
+// do sends body, if any, as JSON and decodes the response into out.
+func (c *controlPlaneClient) do(ctx context.Context, method string, path string, query url.Values, body any, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path+"?"+query.Encode(), reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+type auditEntry struct {
+	ID            string    `json:"id"`
+	ToolName      string    `json:"tool_name"`
+	Actor         string    `json:"actor"`
+	LatencyMS     int64     `json:"latency_ms"`
+	ReplayID      string    `json:"replay_id"`
+	PolicyRuleIDs []string  `json:"policy_rule_ids"`
+	UsageStatus   string    `json:"usage_status"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// runAudit implements `neuralmail audit tail`: print an org's recent tool
+// calls, then keep polling for new ones until interrupted (or exit with
+// -follow=false).
+func runAudit(cfg config.Config, args []string) {
+	if len(args) == 0 || args[0] != "tail" {
+		fmt.Println("Usage: neuralmail audit tail -org <org_id> [-tool <name>] [-n 20] [-follow=true] [-interval 2s]")
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("audit tail", flag.ExitOnError)
+	client := newControlPlaneClient(cfg, fs)
+	orgID := fs.String("org", "", "org to inspect (required with the bootstrap key)")
+	tool := fs.String("tool", "", "only show calls to this tool")
+	n := fs.Int("n", 20, "number of recent entries to print first")
+	follow := fs.Bool("follow", true, "keep printing new entries as they arrive")
+	interval := fs.Duration("interval", 2*time.Second, "poll interval while following")
+	jsonOut := fs.Bool("json", false, "print one JSON object per entry")
+	_ = fs.Parse(args[1:])
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	cp := client()
+	query := url.Values{"org_id": {*orgID}, "tool": {*tool}, "limit": {fmt.Sprint(*n)}}
+	if !*jsonOut {
+		fmt.Printf("%-24s  %-26s  %7s  %-8s  %s\n", "TIME", "TOOL", "LATENCY", "USAGE", "POLICY RULES")
+	}
+	for {
+		var resp struct {
+			Entries []auditEntry `json:"entries"`
+		}
+		if err := cp.get(ctx, "/v1/audit", query, &resp); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Fatalf("audit tail: %v", err)
+		}
+		for _, e := range resp.Entries {
+			printAuditEntry(e, *jsonOut)
+			query.Set("since", e.CreatedAt.Format(time.RFC3339Nano))
+		}
+		if !*follow {
+			return
+		}
+		query.Set("limit", "500")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(*interval):
+		}
+	}
+}
+
+func printAuditEntry(e auditEntry, jsonOut bool) {
+	if jsonOut {
+		raw, _ := json.Marshal(e)
+		fmt.Println(string(raw))
+		return
+	}
+	rules := strings.Join(e.PolicyRuleIDs, ",")
+	if rules == "" {
+		rules = "-"
+	}
+	status := e.UsageStatus
+	if status == "" {
+		status = "-"
+	}
+	fmt.Printf("%-24s  %-26s  %5dms  %-8s  %s\n", e.CreatedAt.Local().Format("2006-01-02 15:04:05.000"), e.ToolName, e.LatencyMS, status, rules)
+}
+
+// runUsage implements `neuralmail usage show`: an org's usage by tool for
+// a period.
+func runUsage(cfg config.Config, args []string) {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Println("Usage: neuralmail usage show -org <org_id> [-period current|YYYY-MM|7d]")
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("usage show", flag.ExitOnError)
+	client := newControlPlaneClient(cfg, fs)
+	orgID := fs.String("org", "", "org to inspect (required with the bootstrap key)")
+	period := fs.String("period", "current", "billing period (current), calendar month (YYYY-MM) or trailing days (e.g. 7d)")
+	jsonOut := fs.Bool("json", false, "print the raw JSON response")
+	_ = fs.Parse(args[1:])
+
+	var resp struct {
+		OrgID       string           `json:"org_id"`
+		PeriodStart time.Time        `json:"period_start"`
+		PeriodEnd   time.Time        `json:"period_end"`
+		Totals      map[string]int64 `json:"totals"`
+		Tools       []struct {
+			ToolName  string `json:"tool_name"`
+			MeterName string `json:"meter_name"`
+			Calls     int64  `json:"calls"`
+			Units     int64  `json:"units"`
+			Failed    int64  `json:"failed"`
+		} `json:"tools"`
+	}
+	query := url.Values{"org_id": {*orgID}, "period": {*period}}
+	if err := client().get(context.Background(), "/v1/usage", query, &resp); err != nil {
+		log.Fatalf("usage show: %v", err)
+	}
+	if *jsonOut {
+		raw, _ := json.MarshalIndent(resp, "", "  ")
+		fmt.Println(string(raw))
+		return
+	}
+
+	fmt.Printf("org %s, %s to %s\n\n", resp.OrgID, resp.PeriodStart.Format("2006-01-02"), resp.PeriodEnd.Format("2006-01-02"))
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TOOL\tMETER\tCALLS\tUNITS\tFAILED\t")
+	for _, t := range resp.Tools {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t\n", t.ToolName, t.MeterName, t.Calls, t.Units, t.Failed)
+	}
+	fmt.Fprintf(tw, "total\t\t%d\t%d\t%d\t\n", resp.Totals["calls"], resp.Totals["units"], resp.Totals["failed"])
+	_ = tw.Flush()
+}
@@ -6,20 +6,26 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/smtp"
 	"net/url"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 
 	"neuralmail/internal/config"
+	"neuralmail/internal/fixtures"
+	"neuralmail/internal/observability"
+	"neuralmail/internal/store"
 )
 
 func main() {
@@ -29,9 +35,17 @@ func main() {
 	}
 	cmd := os.Args[1]
 	cfg, err := config.Load(os.Getenv("NM_CONFIG"))
+	if cmd == "config" {
+		// The check reports what Load refused along with everything else.
+		runConfig(cfg, os.Args[2:])
+		return
+	}
 	if err != nil {
 		log.Fatalf("config error: %v", err)
 	}
+	if err := observability.SetupLogging(cfg); err != nil {
+		log.Fatalf("config error: %v", err)
+	}
 
 	switch cmd {
 	case "up":
@@ -39,13 +53,19 @@ func main() {
 	case "down":
 		runCompose("down")
 	case "seed":
-		seed(cfg)
+		seed(cfg, os.Args[2:])
 	case "doctor":
-		doctor(cfg)
+		runDoctor(cfg, os.Args[2:])
 	case "send-test":
 		sendTest(cfg)
 	case "mcp-test":
 		mcpTest(cfg)
+	case "admin":
+		runAdmin(cfg, os.Args[2:])
+	case "audit":
+		runAudit(cfg, os.Args[2:])
+	case "usage":
+		runUsage(cfg, os.Args[2:])
 	default:
 		usage()
 	}
@@ -60,52 +80,68 @@ func runCompose(args ...string) {
 	}
 }
 
-func seed(cfg config.Config) {
-	seedFlag := "/tmp/nerve-seed.done"
-	if _, err := os.Stat(seedFlag); err == nil {
-		fmt.Println("seed already applied; delete /tmp/nerve-seed.done to re-run")
-		return
+func seed(cfg config.Config, args []string) {
+	opts := fixtures.Defaults()
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	fs.IntVar(&opts.Threads, "threads", opts.Threads, "number of conversations to generate")
+	fs.IntVar(&opts.MaxTurns, "turns", opts.MaxTurns, "maximum messages per conversation")
+	fs.Int64Var(&opts.Seed, "seed", opts.Seed, "data set to generate; the same seed always yields the same mail")
+	fs.Float64Var(&opts.AttachmentRate, "attachments", opts.AttachmentRate, "share of customer messages with an attachment (0-1)")
+	languages := fs.String("languages", strings.Join(opts.Languages, ","), "comma-separated language codes")
+	force := fs.Bool("force", false, "resend messages that were already ingested")
+	_ = fs.Parse(args)
+	opts.Languages = strings.Split(*languages, ",")
+
+	threads, err := fixtures.Generate(opts)
+	if err != nil {
+		log.Fatalf("seed: %v", err)
+	}
+	ingested := seededMessages(cfg, *force)
+	sent, skipped := 0, 0
+	for _, thread := range threads {
+		for _, msg := range thread.Messages {
+			if ingested(msg.MessageID) {
+				skipped++
+				continue
+			}
+			if err := deliverSMTP(cfg, msg.Raw()); err != nil {
+				log.Fatalf("seed: send %s: %v", msg.MessageID, err)
+			}
+			sent++
+		}
 	}
-	messages := []struct {
-		Subject string
-		Body    string
-	}{
-		{"Critical server outage", "Our production system is down. Please fix ASAP."},
-		{"Angry refund request", "I want a refund now. This is unacceptable."},
-		{"Invoice request", "Please send our latest invoice for February."},
-		{"Spam offer", "You won a prize, click here."},
-		{"General question", "Can you help me change my plan?"},
-	}
-	for _, msg := range messages {
-		sendSMTP(cfg, msg.Subject, msg.Body)
-	}
-	_ = os.WriteFile(seedFlag, []byte(time.Now().Format(time.RFC3339)), 0o644)
-	fmt.Println("seeded demo emails")
+	fmt.Printf("seeded %d demo emails across %d threads (%d already ingested)\n", sent, len(threads), skipped)
 }
 
-func doctor(cfg config.Config) {
+// seededMessages returns a check for fixture messages the database already
+// holds, so re-running seed only delivers what is missing. Without a
+// reachable database every message is sent.
+func seededMessages(cfg config.Config, force bool) func(messageID string) bool {
+	none := func(string) bool { return false }
+	if force {
+		return none
+	}
+	st, err := store.Open(cfg.Database.DSN)
+	if err != nil {
+		slog.Warn("seed cannot check existing messages", "err", err)
+		return none
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-
-	checks := []struct {
-		Name string
-		Fn   func() error
-	}{
-		{"smtp", func() error { return pingSMTP(cfg) }},
-		{"database", func() error { return pingDatabase(ctx, cfg.Database.DSN) }},
-		{"redis", func() error { return pingTCP(cfg.Redis.URL) }},
-		{"qdrant", func() error { return pingHTTP(cfg.Qdrant.URL) }},
-		{"jmap", func() error { return pingJMAP(cfg) }},
-		{"mcp", func() error { return pingHTTP(fmt.Sprintf("%s/healthz", localHTTPBase(cfg))) }},
-	}
-	for _, check := range checks {
-		if err := check.Fn(); err != nil {
-			fmt.Printf("%s: FAIL (%v)\n", check.Name, err)
-			continue
+	if err := st.Ping(ctx); err != nil {
+		slog.Warn("seed cannot check existing messages", "err", err)
+		_ = st.Close()
+		return none
+	}
+	return func(messageID string) bool {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		exists, err := st.HasInternetMessageID(ctx, messageID)
+		if err != nil {
+			slog.Warn("seed check failed", "message", messageID, "err", err)
 		}
-		fmt.Printf("%s: OK\n", check.Name)
+		return exists
 	}
-	_ = ctx
 }
 
 func sendTest(cfg config.Config) {
@@ -185,71 +221,74 @@ func callMCP(url string, payload map[string]any, session string) (string, string
 }
 
 func sendSMTP(cfg config.Config, subject, body string) {
-	host := cfg.SMTP.Host
-	if host == "" {
-		host = "localhost"
-	}
-	addr := fmt.Sprintf("%s:%d", host, cfg.SMTP.Port)
-	from := cfg.SMTP.From
-	if from == "" {
-		from = "dev@local.neuralmail"
-	}
-	to := "dev@local.neuralmail"
 	msg := strings.Join([]string{
-		"From: " + from,
-		"To: " + to,
+		"From: " + smtpFrom(cfg),
+		"To: " + smtpRecipient,
 		"Subject: " + subject,
 		"",
 		body,
 	}, "\r\n")
+	if err := deliverSMTP(cfg, []byte(msg)); err != nil {
+		slog.Error("smtp send failed", "err", err)
+	}
+}
+
+const smtpRecipient = "dev@local.neuralmail"
+
+func smtpFrom(cfg config.Config) string {
+	if cfg.SMTP.From != "" {
+		return cfg.SMTP.From
+	}
+	return "dev@local.neuralmail"
+}
+
+// deliverSMTP hands a complete message to the local SMTP server for the dev
+// inbox.
+func deliverSMTP(cfg config.Config, msg []byte) error {
+	host := cfg.SMTP.Host
+	if host == "" {
+		host = "localhost"
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(cfg.SMTP.Port))
+	from := smtpFrom(cfg)
 
-	helo := smtpHeloDomain(from)
 	conn, err := net.Dial("tcp", addr)
 	if err != nil {
-		log.Printf("smtp send failed: %v", err)
-		return
+		return err
 	}
 	defer conn.Close()
 	client, err := smtp.NewClient(conn, host)
 	if err != nil {
-		log.Printf("smtp send failed: %v", err)
-		return
+		return err
 	}
 	defer client.Quit()
-	if err := client.Hello(helo); err != nil {
-		log.Printf("smtp send failed: %v", err)
-		return
+	if err := client.Hello(smtpHeloDomain(from)); err != nil {
+		return err
 	}
 	if (cfg.SMTP.Username != "" || cfg.SMTP.Password != "") && supportsAuth(client) {
 		auth := smtp.PlainAuth("", cfg.SMTP.Username, cfg.SMTP.Password, host)
 		if err := client.Auth(auth); err != nil {
-			log.Printf("smtp send failed: %v", err)
-			return
+			return err
 		}
 	}
 	if err := client.Mail(from); err != nil {
-		log.Printf("smtp send failed: %v", err)
-		return
+		return err
 	}
-	if err := client.Rcpt(to); err != nil {
-		log.Printf("smtp send failed: %v", err)
-		return
+	if err := client.Rcpt(smtpRecipient); err != nil {
+		return err
 	}
 	writer, err := client.Data()
 	if err != nil {
-		log.Printf("smtp send failed: %v", err)
-		return
+		return err
 	}
-	if _, err := writer.Write([]byte(msg)); err != nil {
+	if _, err := writer.Write(msg); err != nil {
 		_ = writer.Close()
-		log.Printf("smtp send failed: %v", err)
-		return
+		return err
 	}
 	if err := writer.Close(); err != nil {
-		log.Printf("smtp send failed: %v", err)
-		return
+		return err
 	}
-	_ = client.Quit()
+	return client.Quit()
 }
 
 func smtpHeloDomain(addr string) string {
@@ -266,9 +305,18 @@ func supportsAuth(client *smtp.Client) bool {
 }
 
 func localHTTPBase(cfg config.Config) string {
-	addr := cfg.HTTP.Addr
+	return localBase(cfg.HTTP.Addr, "8088")
+}
+
+// localAdminBase is the control API on http.admin_addr, where `neuralmail
+// admin` connects.
+func localAdminBase(cfg config.Config) string {
+	return localBase(cfg.HTTP.AdminAddr, "8089")
+}
+
+func localBase(addr, defaultPort string) string {
 	if addr == "" {
-		addr = ":8088"
+		addr = ":" + defaultPort
 	}
 	host := "127.0.0.1"
 	port := ""
@@ -286,7 +334,7 @@ func localHTTPBase(cfg config.Config) string {
 		port = addr
 	}
 	if port == "" {
-		port = "8088"
+		port = defaultPort
 	}
 	return fmt.Sprintf("http://%s:%s", host, port)
 }
@@ -296,7 +344,7 @@ func pingSMTP(cfg config.Config) error {
 	if host == "" {
 		host = "localhost"
 	}
-	addr := fmt.Sprintf("%s:%d", host, cfg.SMTP.Port)
+	addr := net.JoinHostPort(host, strconv.Itoa(cfg.SMTP.Port))
 	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
 	if err != nil {
 		return err
@@ -376,7 +424,7 @@ func pingTCP(rawURL string) error {
 }
 
 func usage() {
-	fmt.Println("Usage: neuralmail <up|down|seed|doctor|send-test|mcp-test>")
+	fmt.Println("Usage: neuralmail <up|down|seed|doctor|send-test|mcp-test|admin|audit|usage|config>")
 }
 
 type mcpResponse struct {
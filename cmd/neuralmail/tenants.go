@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"neuralmail/internal/config"
+)
+
+const tenantUsage = `Usage: neuralmail admin <command> [flags]
+
+  org create -name <name> [-region <region>]
+  org list
+  entitlement set -org <org_id> [-plan <code>] [-status <status>] [-mcp-rpm N] [-monthly-units N] [-max-inboxes N] [-max-domains N]
+  key issue -org <org_id> -scopes <scope,...> [-label <label>] [-inboxes <inbox_id,...>]
+  key revoke -org <org_id> <key_id>
+  domain verify -org <org_id> <domain_id>
+  usage show -org <org_id> [-period current|YYYY-MM|7d]
+
+Without a command, admin opens the interactive console for neuralmaild.`
+
+// tenantCommands are the `neuralmail admin` subcommands that manage orgs
+// through the control plane, keyed by "<noun> <verb>".
+var tenantCommands = map[string]func(cfg config.Config, name string, args []string){
+	"org create":      runOrgCreate,
+	"org list":        runOrgList,
+	"entitlement set": runEntitlementSet,
+	"key issue":       runKeyIssue,
+	"key revoke":      runKeyRevoke,
+	"domain verify":   runDomainVerify,
+}
+
+// runTenantCommand dispatches `neuralmail admin <noun> <verb>`.
+func runTenantCommand(cfg config.Config, args []string) {
+	if len(args) >= 2 && args[0] == "usage" {
+		runUsage(cfg, args[1:])
+		return
+	}
+	if len(args) < 2 {
+		fmt.Println(tenantUsage)
+		os.Exit(2)
+	}
+	name := args[0] + " " + args[1]
+	run, ok := tenantCommands[name]
+	if !ok {
+		fmt.Println(tenantUsage)
+		os.Exit(2)
+	}
+	run(cfg, name, args[2:])
+}
+
+func runOrgCreate(cfg config.Config, name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	client := newControlPlaneClient(cfg, fs)
+	orgName := fs.String("name", "", "display name of the org")
+	region := fs.String("region", "", "data residency region (defaults to the home deployment)")
+	jsonOut := fs.Bool("json", false, "print the raw JSON response")
+	_ = fs.Parse(args)
+
+	var resp struct {
+		OrgID       string     `json:"org_id"`
+		Region      string     `json:"region"`
+		PlanCode    string     `json:"plan_code,omitempty"`
+		TrialEndsAt *time.Time `json:"trial_ends_at,omitempty"`
+	}
+	body := map[string]string{"name": *orgName, "region": *region}
+	if err := client().do(context.Background(), http.MethodPost, "/v1/orgs", nil, body, &resp); err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+	if *jsonOut {
+		printJSON(resp)
+		return
+	}
+	fmt.Printf("created org %s in region %s\n", resp.OrgID, resp.Region)
+	if resp.TrialEndsAt != nil {
+		fmt.Printf("on plan %s until %s\n", resp.PlanCode, resp.TrialEndsAt.Format("2006-01-02"))
+	}
+}
+
+func runOrgList(cfg config.Config, name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	client := newControlPlaneClient(cfg, fs)
+	jsonOut := fs.Bool("json", false, "print the raw JSON response")
+	_ = fs.Parse(args)
+
+	var resp struct {
+		Orgs []struct {
+			OrgID              string    `json:"org_id"`
+			Name               string    `json:"name"`
+			Region             string    `json:"region"`
+			Sandbox            bool      `json:"sandbox"`
+			PlanCode           string    `json:"plan_code"`
+			SubscriptionStatus string    `json:"subscription_status"`
+			CreatedAt          time.Time `json:"created_at"`
+		} `json:"orgs"`
+	}
+	if err := client().get(context.Background(), "/v1/admin/orgs", nil, &resp); err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+	if *jsonOut {
+		printJSON(resp)
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ORG\tNAME\tREGION\tPLAN\tSTATUS\tCREATED\t")
+	for _, o := range resp.Orgs {
+		orgName := o.Name
+		if o.Sandbox {
+			orgName += " (sandbox)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t\n", o.OrgID, orgName, dash(o.Region), dash(o.PlanCode), dash(o.SubscriptionStatus), o.CreatedAt.Format("2006-01-02"))
+	}
+	_ = tw.Flush()
+}
+
+// orgEntitlement is the entitlement record the admin API returns.
+type orgEntitlement struct {
+	OrgID              string    `json:"org_id"`
+	PlanCode           string    `json:"plan_code"`
+	SubscriptionStatus string    `json:"subscription_status"`
+	MCPRPM             int       `json:"mcp_rpm"`
+	MonthlyUnits       int64     `json:"monthly_units"`
+	MaxInboxes         int       `json:"max_inboxes"`
+	MaxDomains         int       `json:"max_domains"`
+	UsagePeriodStart   time.Time `json:"usage_period_start"`
+	UsagePeriodEnd     time.Time `json:"usage_period_end"`
+}
+
+// runEntitlementSet sends only the flags given, so the others keep their
+// current values.
+func runEntitlementSet(cfg config.Config, name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	client := newControlPlaneClient(cfg, fs)
+	orgID := fs.String("org", "", "org to change (required)")
+	plan := fs.String("plan", "", "plan whose limits to apply, before the limit flags below")
+	status := fs.String("status", "", "subscription status: trialing, active, past_due, canceled or unpaid")
+	mcpRPM := fs.Int("mcp-rpm", 0, "MCP calls allowed per minute")
+	monthlyUnits := fs.Int64("monthly-units", 0, "units allowed per usage period")
+	maxInboxes := fs.Int("max-inboxes", 0, "inboxes allowed")
+	maxDomains := fs.Int("max-domains", 0, "domains allowed")
+	jsonOut := fs.Bool("json", false, "print the raw JSON response")
+	_ = fs.Parse(args)
+	if *orgID == "" {
+		log.Fatalf("%s: -org is required", name)
+	}
+
+	body := map[string]any{"org_id": *orgID}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "plan":
+			body["plan_code"] = *plan
+		case "status":
+			body["subscription_status"] = *status
+		case "mcp-rpm":
+			body["mcp_rpm"] = *mcpRPM
+		case "monthly-units":
+			body["monthly_units"] = *monthlyUnits
+		case "max-inboxes":
+			body["max_inboxes"] = *maxInboxes
+		case "max-domains":
+			body["max_domains"] = *maxDomains
+		}
+	})
+	if len(body) == 1 {
+		log.Fatalf("%s: nothing to set; pass -plan, -status or a limit flag", name)
+	}
+
+	var resp orgEntitlement
+	if err := client().do(context.Background(), http.MethodPut, "/v1/admin/entitlements", nil, body, &resp); err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+	if *jsonOut {
+		printJSON(resp)
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "org\t%s\n", resp.OrgID)
+	fmt.Fprintf(tw, "plan\t%s (%s)\n", resp.PlanCode, resp.SubscriptionStatus)
+	fmt.Fprintf(tw, "mcp rpm\t%d\n", resp.MCPRPM)
+	fmt.Fprintf(tw, "monthly units\t%d\n", resp.MonthlyUnits)
+	fmt.Fprintf(tw, "max inboxes\t%d\n", resp.MaxInboxes)
+	fmt.Fprintf(tw, "max domains\t%d\n", resp.MaxDomains)
+	fmt.Fprintf(tw, "usage period\t%s to %s\n", resp.UsagePeriodStart.Format("2006-01-02"), resp.UsagePeriodEnd.Format("2006-01-02"))
+	_ = tw.Flush()
+}
+
+func runKeyIssue(cfg config.Config, name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	client := newControlPlaneClient(cfg, fs)
+	orgID := fs.String("org", "", "org the key belongs to (required)")
+	label := fs.String("label", "", "label to tell the key apart")
+	scopes := fs.String("scopes", "", "comma-separated scopes, e.g. nerve:email.read,nerve:email.draft (required)")
+	inboxes := fs.String("inboxes", "", "comma-separated inbox ids to restrict the key to")
+	jsonOut := fs.Bool("json", false, "print the raw JSON response")
+	_ = fs.Parse(args)
+	if *orgID == "" || *scopes == "" {
+		log.Fatalf("%s: -org and -scopes are required", name)
+	}
+
+	body := map[string]any{"org_id": *orgID, "label": *label, "scopes": splitList(*scopes)}
+	if ids := splitList(*inboxes); len(ids) > 0 {
+		body["inbox_ids"] = ids
+	}
+	var resp struct {
+		ID        string   `json:"id"`
+		Key       string   `json:"key"`
+		KeyPrefix string   `json:"key_prefix"`
+		Scopes    []string `json:"scopes"`
+	}
+	if err := client().do(context.Background(), http.MethodPost, "/v1/keys", nil, body, &resp); err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+	if *jsonOut {
+		printJSON(resp)
+		return
+	}
+	fmt.Printf("issued key %s (%s) with %s\n", resp.ID, resp.KeyPrefix, strings.Join(resp.Scopes, ", "))
+	fmt.Printf("\n  %s\n\nStore it now; it is not shown again.\n", resp.Key)
+}
+
+func runKeyRevoke(cfg config.Config, name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	client := newControlPlaneClient(cfg, fs)
+	orgID := fs.String("org", "", "org the key belongs to (required)")
+	_ = fs.Parse(args)
+	if *orgID == "" || fs.NArg() != 1 {
+		log.Fatalf("usage: neuralmail admin %s -org <org_id> <key_id>", name)
+	}
+
+	var resp map[string]any
+	path := "/v1/keys/" + url.PathEscape(fs.Arg(0))
+	if err := client().do(context.Background(), http.MethodDelete, path, url.Values{"org_id": {*orgID}}, nil, &resp); err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+	fmt.Printf("revoked key %s\n", fs.Arg(0))
+}
+
+func runDomainVerify(cfg config.Config, name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	client := newControlPlaneClient(cfg, fs)
+	orgID := fs.String("org", "", "org the domain belongs to (required)")
+	jsonOut := fs.Bool("json", false, "print the raw JSON response")
+	_ = fs.Parse(args)
+	if *orgID == "" || fs.NArg() != 1 {
+		log.Fatalf("usage: neuralmail admin %s -org <org_id> <domain_id>", name)
+	}
+
+	var resp struct {
+		Domain struct {
+			ID     string `json:"id"`
+			Domain string `json:"domain"`
+			Status string `json:"status"`
+		} `json:"domain"`
+		Checks map[string]any `json:"checks"`
+	}
+	body := map[string]string{"org_id": *orgID, "domain_id": fs.Arg(0)}
+	if err := client().do(context.Background(), http.MethodPost, "/v1/domains/verify", nil, body, &resp); err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+	if *jsonOut {
+		printJSON(resp)
+		return
+	}
+	fmt.Printf("%s is %s\n\n", resp.Domain.Domain, resp.Domain.Status)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, check := range []string{"ownership", "mx", "spf", "dkim", "dmarc"} {
+		verdict := "missing"
+		if ok, _ := resp.Checks[check+"_verified"].(bool); ok {
+			verdict = "ok"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", strings.ToUpper(check), verdict)
+	}
+	_ = tw.Flush()
+}
+
+func printJSON(v any) {
+	raw, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Println(string(raw))
+}
+
+func splitList(raw string) []string {
+	var out []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
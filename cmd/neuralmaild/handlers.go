@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/config"
+	"neuralmail/internal/domains"
+	"neuralmail/internal/embed"
+	"neuralmail/internal/ingest"
+	"neuralmail/internal/jmap"
+	"neuralmail/internal/notify"
+	"neuralmail/internal/outbox"
+	"neuralmail/internal/queue"
+	"neuralmail/internal/residency"
+	"neuralmail/internal/store"
+	"neuralmail/internal/tools"
+	"neuralmail/internal/worker"
+)
+
+// jobHandlers runs the worker's job types against the region stores router
+// holds; directory is the home store.
+type jobHandlers struct {
+	cfg       config.Config
+	router    *residency.Router
+	directory *store.Store
+	queue     *queue.Queue
+	embedder  embed.Provider
+	outbox    *outbox.Deliverer
+	webhooks  *notify.Webhooks
+	tools     *tools.Service
+	domains   *domains.Rechecker
+}
+
+// register hands each job type to d, and schedules the periodic ones.
+func (h *jobHandlers) register(d *worker.Dispatcher) {
+	d.Handle(queue.TypeEmbedding, h.embed)
+	d.Handle(queue.TypeVectorCleanup, h.cleanupVectors)
+	d.Handle(queue.TypeWebhookDelivery, h.deliverWebhook)
+	d.Handle(queue.TypeScheduledSend, h.sendScheduled)
+	d.Handle(queue.TypeSummarization, h.summarize)
+	d.Handle(queue.TypeRetentionSweep, h.sweepRetention)
+	d.Handle(queue.TypeBounce, h.processBounce)
+	d.Handle(queue.TypeDomainVerify, h.verifyDomains)
+	d.Every(queue.TypeScheduledSend, h.cfg.Worker.SendInterval)
+	d.Every(queue.TypeRetentionSweep, h.cfg.Worker.RetentionInterval)
+	d.Every(queue.TypeDomainVerify, h.cfg.Domains.VerifyInterval)
+}
+
+func (h *jobHandlers) embed(ctx context.Context, job queue.Job) error {
+	err := embedMessage(ctx, h.cfg, h.router, h.embedder, job.MessageID)
+	if errors.Is(err, errEmbeddingDisabled) || errors.Is(err, errMessageOversized) {
+		return fmt.Errorf("%w: %w", worker.ErrSkip, err)
+	}
+	return err
+}
+
+// cleanupVectors removes the vector points of deleted inboxes and threads.
+// A job does not know its region, so it is applied to every region's
+// collection.
+func (h *jobHandlers) cleanupVectors(ctx context.Context, job queue.Job) error {
+	return deleteVectors(ctx, h.router, job)
+}
+
+func (h *jobHandlers) deliverWebhook(ctx context.Context, job queue.Job) error {
+	var d notify.Delivery
+	if err := job.DecodePayload(&d); err != nil {
+		return err
+	}
+	_, err := h.webhooks.Publish(ctx, h.directory, d.OrgID, d.EventType, d.Data)
+	return err
+}
+
+// sendScheduled sends the outbound mail due in every region. A region with
+// a full batch left queues the next pass straight away.
+func (h *jobHandlers) sendScheduled(ctx context.Context, job queue.Job) error {
+	var errs []error
+	busy := false
+	for _, region := range h.router.Regions() {
+		backend, err := h.router.Backend(region)
+		if err != nil {
+			continue
+		}
+		n, err := h.outbox.Deliver(ctx, backend.Store)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("region %s: %w", region, err))
+		}
+		busy = busy || n == h.outbox.BatchSize
+	}
+	if busy {
+		errs = append(errs, h.queue.Push(ctx, queue.QueueName(queue.TypeScheduledSend), queue.Job{Origin: queue.OriginSchedule}))
+	}
+	return errors.Join(errs...)
+}
+
+// summarize refreshes a thread's stored summary, as the org's own
+// summarize_thread call would.
+func (h *jobHandlers) summarize(ctx context.Context, job queue.Job) error {
+	var s ingest.SummaryJob
+	if err := job.DecodePayload(&s); err != nil {
+		return err
+	}
+	if s.OrgID != "" {
+		ctx = auth.WithPrincipal(ctx, auth.Principal{OrgID: s.OrgID, ActorID: "worker"})
+	}
+	_, err := h.tools.SummarizeThread(ctx, s.ThreadID, false)
+	return err
+}
+
+// sweepRetention deletes audit entries past their org's retention in every
+// region.
+func (h *jobHandlers) sweepRetention(ctx context.Context, job queue.Job) error {
+	var errs []error
+	for _, region := range h.router.Regions() {
+		backend, err := h.router.Backend(region)
+		if err != nil {
+			continue
+		}
+		if _, err := backend.Store.PruneAuditLog(ctx, time.Now()); err != nil {
+			errs = append(errs, fmt.Errorf("region %s: %w", region, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *jobHandlers) processBounce(ctx context.Context, job queue.Job) error {
+	var r ingest.ReportJob
+	if err := job.DecodePayload(&r); err != nil {
+		return err
+	}
+	backend, err := h.router.ForInbox(ctx, r.InboxID)
+	if err != nil {
+		return err
+	}
+	return jmap.ApplyReport(ctx, backend.Store, r.InboxID, r.MessageID, r.Report)
+}
+
+// verifyDomains re-checks the DNS of the custom domains in the directory,
+// where org domains live.
+func (h *jobHandlers) verifyDomains(ctx context.Context, job queue.Job) error {
+	res, err := h.domains.Run(ctx, h.directory)
+	if res.Activated > 0 || res.Failed > 0 || res.Rotated > 0 {
+		slog.Info("domain verification complete", "checked", res.Checked, "activated", res.Activated, "failed", res.Failed, "dkim_rotated", res.Rotated)
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"net/http"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/inbound"
+	"neuralmail/internal/ingest"
+	"neuralmail/internal/outbox"
+	"neuralmail/internal/queue"
+	"neuralmail/internal/residency"
+	"neuralmail/internal/rules"
+	"neuralmail/internal/store"
+)
+
+// runInboundWebhook implements `neuralmaild inbound-webhook`: serve the
+// providers' inbound mail webhooks on inbound.addr and ingest what they
+// deliver, and the outbound transports' delivery event webhooks. It needs the
+// database and queue but none of the MCP runtime, so it can be deployed and
+// scaled on its own.
+func runInboundWebhook(ctx context.Context, cfg config.Config) {
+	st, err := store.Open(cfg.Database.DSN)
+	if err != nil {
+		log.Fatalf("store error: %v", err)
+	}
+	defer st.Close()
+	if err := store.Migrate(ctx, st.DB()); err != nil {
+		log.Fatalf("migration error: %v", err)
+	}
+	q, err := queue.New(cfg)
+	if err != nil {
+		log.Fatalf("queue error: %v", err)
+	}
+	defer q.Close()
+	router, err := residency.Open(cfg, st, nil)
+	if err != nil {
+		log.Fatalf("residency error: %v", err)
+	}
+	defer router.Close()
+	if err := router.Migrate(ctx); err != nil {
+		log.Fatalf("regional migration error: %v", err)
+	}
+
+	pipeline, err := ingest.NewPipeline(cfg, st, router, q)
+	if err != nil {
+		log.Fatalf("ingest pipeline error: %v", err)
+	}
+	// Without the MCP runtime there is no model: rules that triage or draft
+	// record those actions as failed.
+	pipeline.Jobs = q
+	ruleEngine := rules.New(st, nil)
+	ruleEngine.Notify.Queue = q
+	pipeline.Rules = ruleEngine
+	receiver := inbound.NewReceiver(cfg, st, pipeline, q)
+	events, err := inbound.NewEventReceiver(cfg, func(ctx context.Context, ev outbox.Event) error {
+		return applyDeliveryEvent(ctx, router, ev)
+	})
+	if err != nil {
+		log.Fatalf("delivery events error: %v", err)
+	}
+	if len(receiver.Providers()) == 0 && len(events.Providers()) == 0 {
+		log.Fatal("inbound-webhook: no provider configured; set inbound.ses_topic_arns, inbound.mailgun_signing_key, inbound.postmark_username/password or an outbound provider's webhook credentials")
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := st.Ping(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if err := q.Ping(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ready"))
+	})
+	mux.Handle("/inbound/", receiver)
+	mux.Handle("/events/", events)
+
+	srv := &http.Server{
+		Addr:              cfg.Inbound.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Shutdown(context.Background())
+	}()
+	slog.Info("inbound webhooks serving", "addr", srv.Addr, "providers", receiver.Providers(), "event_providers", events.Providers())
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("server error: %v", err)
+	}
+}
+
+// applyDeliveryEvent records ev in the region whose outbox sent the message.
+// Events for mail no region sent, such as mail sent from the provider's own
+// console, are ignored.
+func applyDeliveryEvent(ctx context.Context, router *residency.Router, ev outbox.Event) error {
+	for _, region := range router.Regions() {
+		backend, err := router.Backend(region)
+		if err != nil {
+			continue
+		}
+		found, err := outbox.ApplyEvent(ctx, backend.Store, ev)
+		if err != nil {
+			return err
+		}
+		if found {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/queue"
+)
+
+// runJobs implements `neuralmaild jobs`: report the work queues, list a
+// queue's dead-lettered jobs, or put them back on the queue.
+//
+//	neuralmaild jobs stats
+//	neuralmaild jobs dead [-queue embedding_jobs] [-limit 20]
+//	neuralmaild jobs retry [-queue embedding_jobs] [-limit 0]
+func runJobs(ctx context.Context, cfg config.Config, args []string) {
+	if len(args) == 0 {
+		jobsUsage()
+	}
+	defaultLimit := 20
+	if args[0] == "retry" {
+		defaultLimit = 0
+	}
+	fs := flag.NewFlagSet("jobs "+args[0], flag.ExitOnError)
+	name := fs.String("queue", queue.EmbeddingJobs, "queue: "+strings.Join(queue.Names, " or "))
+	limit := fs.Int("limit", defaultLimit, "jobs to list or retry; retrying 0 retries them all")
+	_ = fs.Parse(args[1:])
+
+	q, err := queue.New(cfg)
+	if err != nil {
+		log.Fatalf("queue error: %v", err)
+	}
+	defer q.Close()
+
+	switch args[0] {
+	case "stats":
+		for _, n := range queue.Names {
+			stats, err := q.Stats(ctx, n)
+			if err != nil {
+				log.Fatalf("jobs: %v", err)
+			}
+			fmt.Printf("%s: depth=%d retrying=%d dead=%d oldest=%s processed=%d failed=%d\n", n, stats.Depth, stats.Retrying,
+				stats.DeadLettered, time.Duration(stats.OldestAgeSec*float64(time.Second)).Round(time.Second), stats.Processed, stats.Failed)
+		}
+	case "dead":
+		items, err := q.ListDeadLetters(ctx, *name, int64(*limit))
+		if err != nil {
+			log.Fatalf("jobs: %v", err)
+		}
+		for _, item := range items {
+			subject := item.MessageID
+			if subject == "" {
+				subject = fmt.Sprintf("inboxes=%d threads=%d", len(item.InboxIDs), len(item.ThreadIDs))
+			}
+			fmt.Printf("%s %s trace=%s origin=%s attempts=%d %s: %s\n", item.ID, item.FailedAt.Format(time.RFC3339), item.TraceID,
+				item.Origin, item.Attempts, subject, item.Error)
+		}
+		if len(items) == 0 {
+			fmt.Println("no dead-lettered jobs")
+		}
+	case "retry":
+		retried, err := q.RetryDeadLetters(ctx, *name, *limit)
+		if err != nil {
+			log.Fatalf("jobs: retried %d before: %v", retried, err)
+		}
+		fmt.Printf("retried %d jobs\n", retried)
+	default:
+		jobsUsage()
+	}
+}
+
+func jobsUsage() {
+	fmt.Println("Usage: neuralmaild jobs <stats|dead|retry> [-queue name] [-limit n]")
+	os.Exit(2)
+}
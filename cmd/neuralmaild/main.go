@@ -2,21 +2,36 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"neuralmail/internal/app"
+	"neuralmail/internal/autoclose"
 	"neuralmail/internal/config"
+	"neuralmail/internal/domains"
 	"neuralmail/internal/embed"
+	"neuralmail/internal/gmailapi"
+	"neuralmail/internal/imap"
 	"neuralmail/internal/jmap"
 	"neuralmail/internal/mcp"
+	"neuralmail/internal/notify"
+	"neuralmail/internal/objectstore"
+	"neuralmail/internal/observability"
+	"neuralmail/internal/orgpurge"
+	"neuralmail/internal/outbox"
+	"neuralmail/internal/policy"
 	"neuralmail/internal/queue"
+	"neuralmail/internal/residency"
 	"neuralmail/internal/store"
+	"neuralmail/internal/tools"
 	"neuralmail/internal/vector"
+	"neuralmail/internal/worker"
 )
 
 func main() {
@@ -30,6 +45,18 @@ func main() {
 	if err != nil {
 		log.Fatalf("config error: %v", err)
 	}
+	if err := observability.SetupLogging(cfg); err != nil {
+		log.Fatalf("config error: %v", err)
+	}
+	problems := cfg.Validate()
+	for _, p := range problems {
+		if p.Severity == config.SeverityWarning {
+			slog.Warn("config warning", "field", p.Field, "problem", p.Message)
+		}
+	}
+	if err := problems.Err(); err != nil {
+		log.Fatalf("config error: %v (run `neuralmail config check` for a full report)", err)
+	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
@@ -41,6 +68,14 @@ func main() {
 		runWorker(ctx, cfg)
 	case "mcp-stdio":
 		runStdio(ctx, cfg)
+	case "verify-tenancy":
+		runVerifyTenancy(ctx, cfg, os.Args[2:])
+	case "inbound-webhook":
+		runInboundWebhook(ctx, cfg)
+	case "reindex":
+		runReindex(ctx, cfg, os.Args[2:])
+	case "jobs":
+		runJobs(ctx, cfg, os.Args[2:])
 	default:
 		usage()
 	}
@@ -58,17 +93,56 @@ func runServe(ctx context.Context, cfg config.Config) {
 		inboxAddr = "dev@local.neuralmail"
 	}
 	inboxID, _ := appInstance.Store.EnsureDefaults(ctx, inboxAddr)
-	client, err := jmap.NewClient(cfg)
-	if err == nil {
-		go appInstance.PollLoop(ctx, client, inboxID)
+	if cfg.IMAP.DefaultInbox && inboxID != "" {
+		if _, err := imap.NewClient(cfg); err != nil {
+			slog.Warn("imap default_inbox is set but imap is not configured", "err", err)
+		} else if _, err := appInstance.Store.SetInboxProvider(ctx, "", inboxID, store.ProviderIMAP); err != nil {
+			slog.Error("imap set default inbox provider failed", "err", err)
+		}
 	}
+	appInstance.StartPolling(ctx, syncClients(cfg, appInstance.Store, inboxID))
+	go appInstance.WatchReload(ctx, os.Getenv("NM_CONFIG"))
 
-	log.Printf("neuralmaild serving on %s", cfg.HTTP.Addr)
+	slog.Info("neuralmaild serving", "addr", cfg.HTTP.Addr)
 	if err := appInstance.Serve(ctx); err != nil {
 		log.Fatalf("server error: %v", err)
 	}
 }
 
+// syncClients picks each inbox's sync client. The configured JMAP login
+// syncs the default inbox's primary account and, with jmap.poll_accounts,
+// other JMAP inboxes' accounts by address; the configured IMAP account
+// belongs to the default inbox alone. Gmail inboxes sync through their own
+// OAuth grant.
+func syncClients(cfg config.Config, st *store.Store, defaultInboxID string) app.ClientFunc {
+	jmapClient, _ := jmap.NewJMAPClient(cfg)
+	imapClient, _ := imap.NewClient(cfg)
+	oauth, _ := gmailapi.NewOAuth(cfg)
+	return func(inbox store.InboxRecord) jmap.Client {
+		switch inbox.Provider {
+		case store.ProviderJMAP:
+			if jmapClient == nil {
+				return nil
+			}
+			if inbox.ID == defaultInboxID {
+				return jmapClient
+			}
+			if cfg.JMAP.PollAccounts {
+				return jmapClient.ForAccount(inbox.Address)
+			}
+		case store.ProviderIMAP:
+			if imapClient != nil && inbox.ID == defaultInboxID {
+				return imapClient
+			}
+		case store.ProviderGmail:
+			if oauth != nil {
+				return gmailapi.NewClient(cfg, &gmailapi.StoreTokenSource{Store: st, OAuth: oauth, InboxID: inbox.ID})
+			}
+		}
+		return nil
+	}
+}
+
 func runWorker(ctx context.Context, cfg config.Config) {
 	storeInstance, err := store.Open(cfg.Database.DSN)
 	if err != nil {
@@ -78,68 +152,216 @@ func runWorker(ctx context.Context, cfg config.Config) {
 	if err := store.Migrate(ctx, storeInstance.DB()); err != nil {
 		log.Fatalf("migration error: %v", err)
 	}
-	queueInstance, err := queue.New(cfg.Redis.URL)
+	queueInstance, err := queue.New(cfg)
 	if err != nil {
 		log.Fatalf("queue error: %v", err)
 	}
 	defer queueInstance.Close()
-
-	var embedder embed.Provider
-	switch cfg.Embedding.Provider {
-	case "openai":
-		embedder = embed.NewOpenAI(cfg.LLM.OpenAIKey, cfg.Embedding.Model, cfg.Embedding.Dim)
-	case "ollama":
-		embedder = embed.NewOllama(cfg.LLM.OllamaURL, cfg.Embedding.Model, cfg.Embedding.Dim)
-	default:
-		embedder = embed.NewNoop(cfg.Embedding.Dim)
+	if moved, err := queueInstance.MigrateLegacyLists(ctx); err != nil {
+		slog.Error("moving queued jobs onto streams failed", "err", err)
+	} else if moved > 0 {
+		slog.Info("moved queued jobs onto streams", "jobs", moved)
 	}
+
+	embedder := newEmbedder(cfg)
 	vecStore := vector.NewQdrant(cfg.Qdrant.URL, cfg.Qdrant.Collection)
-	if err := vecStore.EnsureCollection(ctx, cfg.Embedding.Dim); err != nil {
-		log.Printf("qdrant ensure collection failed: %v", err)
+	router, err := residency.Open(cfg, storeInstance, vecStore)
+	if err != nil {
+		log.Fatalf("residency error: %v", err)
+	}
+	defer router.Close()
+	if err := router.Migrate(ctx); err != nil {
+		log.Fatalf("regional migration error: %v", err)
+	}
+	for _, region := range router.Regions() {
+		backend, _ := router.Backend(region)
+		if err := backend.Vector.EnsureCollection(ctx, cfg.Embedding.Dim); err != nil {
+			slog.Error("qdrant ensure collection failed", "region", region, "err", err)
+		}
 	}
 
-	log.Println("worker started")
+	go autoCloseThreads(ctx, router, autoclose.New(cfg), cfg.AutoClose.Interval)
+	purger := orgpurge.New()
+	if objects, err := objectstore.New(cfg); err != nil {
+		slog.Error("object store config invalid", "err", err)
+	} else if objects != nil {
+		purger.Objects = objects
+	}
+	go purgeOrgs(ctx, router, purger, cfg.OrgDeletion.Interval)
+
+	models, err := app.NewModels(cfg)
+	if err != nil {
+		log.Fatalf("llm error: %v", err)
+	}
+	pol, err := policy.Load(cfg.Policy.DefaultPath)
+	if err != nil {
+		log.Fatalf("policy error: %v", err)
+	}
+	toolSvc := tools.NewService(cfg, storeInstance, models, vecStore, pol, embedder)
+	toolSvc.Residency = router
+	toolSvc.Cache = queueInstance
+	toolSvc.TokenLedger = queueInstance
+
+	handlers := &jobHandlers{
+		cfg:       cfg,
+		router:    router,
+		directory: storeInstance,
+		queue:     queueInstance,
+		embedder:  embedder,
+		outbox:    newDeliverer(cfg, storeInstance),
+		webhooks:  notify.NewWebhooks(),
+		tools:     toolSvc,
+		domains:   domains.NewRechecker(cfg),
+	}
+	dispatcher := worker.New(queueInstance, cfg.Worker.Concurrency)
+	handlers.register(dispatcher)
+	dispatcher.Run(ctx)
+}
+
+// newDeliverer returns the outbox deliverer. It picks transports by the org
+// and domain settings kept in the directory and, when an encryption key is
+// configured, signs SMTP and SES mail with the org domains' DKIM keys.
+func newDeliverer(cfg config.Config, directory *store.Store) *outbox.Deliverer {
+	deliverer := outbox.NewDeliverer(cfg)
+	deliverer.Selector = directory
+	if cfg.Domains.DKIMEncryptionKey == "" {
+		return deliverer
+	}
+	key, err := domains.ParseEncryptionKey(cfg.Domains.DKIMEncryptionKey)
+	if err != nil {
+		slog.Error("dkim signing disabled", "err", err)
+		return deliverer
+	}
+	signer := &outbox.DKIMSigner{Keys: directory, EncryptionKey: key}
+	if smtp, ok := deliverer.Transports[outbox.TransportSMTP].(*outbox.SMTPSender); ok {
+		smtp.DKIM = signer
+	}
+	if ses, ok := deliverer.Transports[outbox.TransportSES].(*outbox.SESTransport); ok {
+		ses.DKIM = signer
+	}
+	return deliverer
+}
+
+// autoCloseThreads applies inbox inactivity rules in every region's store
+// each interval until ctx is done.
+func autoCloseThreads(ctx context.Context, router *residency.Router, closer *autoclose.Closer, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
 	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			job, err := queueInstance.PopEmbeddingJob(ctx, 5*time.Second)
+		for _, region := range router.Regions() {
+			backend, err := router.Backend(region)
 			if err != nil {
 				continue
 			}
-			msg, err := storeInstance.GetMessage(ctx, job)
+			res, err := closer.Run(ctx, backend.Store)
 			if err != nil {
-				log.Printf("worker message fetch failed: %v", err)
-				continue
+				slog.Error("auto-close failed", "region", region, "err", err)
+			}
+			if res.Nudged > 0 || res.Closed > 0 {
+				slog.Info("auto-close complete", "region", region, "nudged", res.Nudged, "closed", res.Closed)
 			}
-			inboxID, err := storeInstance.GetThreadInboxID(ctx, msg.ThreadID)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// purgeOrgs purges the orgs whose deletion grace period has ended, in every
+// region's store, each interval until ctx is done.
+func purgeOrgs(ctx context.Context, router *residency.Router, purger *orgpurge.Purger, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	for {
+		for _, region := range router.Regions() {
+			backend, err := router.Backend(region)
 			if err != nil {
-				log.Printf("worker thread fetch failed: %v", err)
 				continue
 			}
-			vecs, err := embedder.Embed(ctx, []string{msg.Text})
-			if err != nil || len(vecs) == 0 {
-				log.Printf("embedding failed: %v", err)
-				continue
+			var index orgpurge.Index
+			if backend.Vector != nil {
+				index = backend.Vector
 			}
-			point := vector.Point{
-				ID:     msg.ID,
-				Vector: vecs[0],
-				Payload: map[string]any{
-					"message_id": msg.ID,
-					"thread_id":  msg.ThreadID,
-					"inbox_id":   inboxID,
-					"snippet":    snippet(msg.Text),
-				},
+			if _, err := purger.Run(ctx, backend.Store, index); err != nil {
+				slog.Error("org purge failed", "region", region, "err", err)
 			}
-			if err := vecStore.Upsert(ctx, []vector.Point{point}); err != nil {
-				log.Printf("qdrant upsert failed: %v", err)
-				continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func deleteVectors(ctx context.Context, router *residency.Router, job queue.Job) error {
+	for _, region := range router.Regions() {
+		backend, err := router.Backend(region)
+		if err != nil || backend.Vector == nil {
+			continue
+		}
+		if len(job.InboxIDs) > 0 {
+			if err := backend.Vector.Delete(ctx, vector.MatchAny("inbox_id", job.InboxIDs)); err != nil {
+				return err
+			}
+		}
+		if len(job.ThreadIDs) > 0 {
+			if err := backend.Vector.Delete(ctx, vector.MatchAny("thread_id", job.ThreadIDs)); err != nil {
+				return err
 			}
-			log.Printf("processed embedding job: %s", job)
 		}
 	}
+	return nil
+}
+
+var (
+	errEmbeddingDisabled = errors.New("inbox has embedding disabled")
+	errMessageOversized  = errors.New("message is oversized")
+)
+
+// embedMessage embeds one message, a chunk at a time, into its region's
+// vector store, unless its inbox opted out of embedding or its bodies were
+// truncated on ingest.
+func embedMessage(ctx context.Context, cfg config.Config, router *residency.Router, embedder embed.Provider, messageID string) error {
+	backend, msg, err := router.LocateMessage(ctx, messageID)
+	if err != nil {
+		return fmt.Errorf("message fetch: %w", err)
+	}
+	if msg.Oversized {
+		return errMessageOversized
+	}
+	inboxID, err := backend.Store.GetThreadInboxID(ctx, msg.ThreadID)
+	if err != nil {
+		return fmt.Errorf("thread fetch: %w", err)
+	}
+	disabled, err := router.EmbeddingDisabled(ctx, inboxID)
+	if err != nil {
+		return fmt.Errorf("inbox settings fetch: %w", err)
+	}
+	if disabled {
+		return errEmbeddingDisabled
+	}
+	chunks := embed.Split(msg.Text, cfg.Embedding.ChunkSize, cfg.Embedding.ChunkOverlap)
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+	vecs, err := embedder.Embed(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("embedding: %w", err)
+	}
+	if len(vecs) != len(chunks) {
+		return fmt.Errorf("embedder returned %d vectors for %d chunks", len(vecs), len(chunks))
+	}
+	points := vector.MessagePoints(msg.ID, msg.ThreadID, inboxID, msg.Direction, chunks, vecs)
+	if err := backend.Vector.Upsert(ctx, points); err != nil {
+		return fmt.Errorf("qdrant upsert: %w", err)
+	}
+	return nil
 }
 
 func runStdio(ctx context.Context, cfg config.Config) {
@@ -148,18 +370,24 @@ func runStdio(ctx context.Context, cfg config.Config) {
 		log.Fatalf("app init error: %v", err)
 	}
 	defer appInstance.Close()
+	go appInstance.WatchReload(ctx, os.Getenv("NM_CONFIG"))
 	if err := mcp.RunStdio(ctx, appInstance.MCP); err != nil {
 		log.Fatalf("stdio error: %v", err)
 	}
 }
 
-func usage() {
-	fmt.Println("Usage: neuralmaild <serve|worker|mcp-stdio>")
+// newEmbedder returns the configured embedding provider.
+func newEmbedder(cfg config.Config) embed.Provider {
+	switch cfg.Embedding.Provider {
+	case "openai":
+		return embed.NewOpenAI(cfg.LLM.OpenAIKey, cfg.Embedding.Model, cfg.Embedding.Dim)
+	case "ollama":
+		return embed.NewOllama(cfg.LLM.OllamaURL, cfg.Embedding.Model, cfg.Embedding.Dim)
+	default:
+		return embed.NewNoop(cfg.Embedding.Dim)
+	}
 }
 
-func snippet(text string) string {
-	if len(text) <= 200 {
-		return text
-	}
-	return text[:200] + "..."
+func usage() {
+	fmt.Println("Usage: neuralmaild <serve|worker|mcp-stdio|verify-tenancy|inbound-webhook|reindex|jobs>")
 }
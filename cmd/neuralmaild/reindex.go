@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/reindex"
+	"neuralmail/internal/residency"
+	"neuralmail/internal/store"
+	"neuralmail/internal/vector"
+)
+
+// runReindex implements `neuralmaild reindex`: re-embed every message with
+// the configured embedding provider into a new Qdrant collection per region
+// and point the region's collection alias at it. Rerun after an
+// interruption to resume from the last checkpointed batch.
+func runReindex(ctx context.Context, cfg config.Config, args []string) {
+	fs := flag.NewFlagSet("reindex", flag.ExitOnError)
+	batch := fs.Int("batch", 100, "messages embedded per request")
+	only := fs.String("region", "", "only re-index this region (the home region by its configured name)")
+	_ = fs.Parse(args)
+
+	if cfg.Embedding.Provider == "" || cfg.Embedding.Provider == "noop" {
+		log.Fatal("reindex: embedding.provider must be set")
+	}
+	st, err := store.Open(cfg.Database.DSN)
+	if err != nil {
+		log.Fatalf("store error: %v", err)
+	}
+	defer st.Close()
+	if err := store.Migrate(ctx, st.DB()); err != nil {
+		log.Fatalf("migration error: %v", err)
+	}
+	home := vector.NewQdrant(cfg.Qdrant.URL, cfg.Qdrant.Collection)
+	router, err := residency.Open(cfg, st, home)
+	if err != nil {
+		log.Fatalf("residency error: %v", err)
+	}
+	defer router.Close()
+	if err := router.Migrate(ctx); err != nil {
+		log.Fatalf("regional migration error: %v", err)
+	}
+
+	reindexer := &reindex.Reindexer{
+		Directory:    st,
+		Embedder:     newEmbedder(cfg),
+		Model:        cfg.Embedding.Provider + "/" + cfg.Embedding.Model,
+		BatchSize:    *batch,
+		ChunkSize:    cfg.Embedding.ChunkSize,
+		ChunkOverlap: cfg.Embedding.ChunkOverlap,
+		Progress: func(run store.EmbeddingReindex) {
+			fmt.Printf("%s: embedded=%d skipped=%d through %s\n", regionLabel(cfg, run.Region), run.Embedded, run.Skipped, run.CursorCreatedAt.Format("2006-01-02T15:04:05Z07:00"))
+		},
+	}
+	for _, region := range router.Regions() {
+		if *only != "" && *only != regionLabel(cfg, region) {
+			continue
+		}
+		backend, err := router.Backend(region)
+		if err != nil {
+			log.Fatalf("reindex: %v", err)
+		}
+		qdrant := home
+		if region != residency.Home {
+			storage := cfg.Residency.Regions[region]
+			qdrant = vector.NewQdrant(storage.QdrantURL, storage.QdrantCollection)
+		}
+		run, resumed, err := reindexer.Run(ctx, reindex.Target{Region: region, Store: backend.Store, Qdrant: qdrant})
+		if err != nil {
+			log.Fatalf("reindex %s: %v", regionLabel(cfg, region), err)
+		}
+		verb := "started"
+		if resumed {
+			verb = "resumed"
+		}
+		fmt.Printf("%s: %s run done, alias %s now points at %s (embedded=%d skipped=%d)\n",
+			regionLabel(cfg, region), verb, run.Alias, run.Collection, run.Embedded, run.Skipped)
+	}
+}
+
+// regionLabel names a region for output, the home one by its configured
+// name.
+func regionLabel(cfg config.Config, region string) string {
+	if region != residency.Home {
+		return region
+	}
+	if cfg.Residency.HomeRegion != "" {
+		return cfg.Residency.HomeRegion
+	}
+	return "home"
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"neuralmail/internal/cloudapi"
+	"neuralmail/internal/config"
+	"neuralmail/internal/store"
+	"neuralmail/internal/tenancy"
+)
+
+// runVerifyTenancy implements `neuralmaild verify-tenancy`: against a live
+// deployment, seed two throwaway orgs in its database, exercise its MCP
+// endpoint with each org's service token, report any cross-tenant
+// visibility and delete the orgs again. It exits 1 if any check fails.
+func runVerifyTenancy(ctx context.Context, cfg config.Config, args []string) {
+	fs := flag.NewFlagSet("verify-tenancy", flag.ExitOnError)
+	mcpURL := fs.String("mcp-url", envOr("NM_MCP_URL", localMCPURL(cfg)), "MCP endpoint of the deployment to check")
+	timeout := fs.Duration("timeout", 2*time.Minute, "give up after this long")
+	_ = fs.Parse(args)
+
+	if strings.TrimSpace(cfg.Security.TokenSigningKey) == "" {
+		log.Fatal("verify-tenancy: security.token_signing_key must be set to issue the orgs' service tokens")
+	}
+	st, err := store.Open(cfg.Database.DSN)
+	if err != nil {
+		log.Fatalf("store error: %v", err)
+	}
+	defer st.Close()
+
+	tokens := cloudapi.NewTokenService(st, cfg.Security.TokenSigningKey)
+	tokens.Issuer = cfg.Auth.Issuer
+	tokens.Audience = cfg.Auth.Audience
+	issue := func(ctx context.Context, orgID string, scopes []string) (string, error) {
+		issued, err := tokens.IssueServiceToken(ctx, orgID, "verify-tenancy", scopes, nil, 10*time.Minute, false, "")
+		return issued.Token, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	report, err := tenancy.NewVerifier(st, *mcpURL, cfg.Security.APIKey, issue).Run(ctx)
+	for _, c := range report.Checks {
+		if c.Passed() {
+			fmt.Printf("ok    tenant %s: %s\n", c.Tenant, c.Name)
+		} else {
+			fmt.Printf("FAIL  tenant %s: %s: %v\n", c.Tenant, c.Name, c.Err)
+		}
+	}
+	if err != nil {
+		log.Fatalf("verify-tenancy: %v", err)
+	}
+	if failed := report.Failed(); len(failed) > 0 {
+		fmt.Printf("%d of %d checks failed\n", len(failed), len(report.Checks))
+		os.Exit(1)
+	}
+	fmt.Printf("all %d checks passed: no cross-tenant visibility\n", len(report.Checks))
+}
+
+// localMCPURL is the MCP endpoint of a server on this host listening on
+// http.addr.
+func localMCPURL(cfg config.Config) string {
+	addr := cfg.HTTP.Addr
+	if addr == "" {
+		addr = ":8088"
+	}
+	if strings.HasPrefix(addr, ":") {
+		addr = "127.0.0.1" + addr
+	}
+	return "http://" + addr + "/mcp"
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
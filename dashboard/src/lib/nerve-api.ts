@@ -90,14 +90,49 @@ export async function getCurrentSubscription(
   );
 }
 
+// ── Plans ──────────────────────────────────────────────────────
+
+export interface Plan {
+  plan_code: string;
+  display_name: string;
+  monthly_price_cents: number;
+  monthly_units: number;
+  mcp_rpm: number;
+  max_inboxes: number;
+  max_domains: number;
+  overage_cents_per_1000_units: number;
+  default: boolean;
+}
+
+export interface PlanAddOn {
+  code: string;
+  display_name: string;
+  monthly_price_cents: number;
+  extra_inboxes: number;
+  extra_domains: number;
+}
+
+export async function listPlans(): Promise<{
+  plans: Plan[];
+  add_ons: PlanAddOn[];
+}> {
+  return nerveRequest("/v1/plans");
+}
+
 // ── Checkout ───────────────────────────────────────────────────
 
 export async function createCheckout(
   orgId: string,
+  planCode?: string,
+  addOns?: Record<string, number>,
 ): Promise<{ checkout_url: string; client_reference_id: string }> {
   return nerveRequest("/v1/subscriptions/checkout", {
     method: "POST",
-    body: JSON.stringify({ org_id: orgId }),
+    body: JSON.stringify({
+      org_id: orgId,
+      plan_code: planCode,
+      add_ons: addOns,
+    }),
   });
 }
 
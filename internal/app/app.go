@@ -2,22 +2,38 @@ package app
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"html"
+	"log/slog"
 	"net/http"
+	"os"
+	"sync"
 	"time"
 
 	"neuralmail/internal/auth"
+	"neuralmail/internal/canary"
 	"neuralmail/internal/config"
 	"neuralmail/internal/embed"
 	"neuralmail/internal/entitlements"
+	"neuralmail/internal/httpx"
+	"neuralmail/internal/imap"
+	"neuralmail/internal/ingest"
+	"neuralmail/internal/integrations"
 	"neuralmail/internal/jmap"
 	"neuralmail/internal/llm"
 	"neuralmail/internal/mcp"
 	"neuralmail/internal/observability"
+	"neuralmail/internal/pii"
+	"neuralmail/internal/playground"
 	"neuralmail/internal/policy"
 	"neuralmail/internal/queue"
+	"neuralmail/internal/rerank"
+	"neuralmail/internal/residency"
+	"neuralmail/internal/rules"
 	"neuralmail/internal/store"
 	"neuralmail/internal/tools"
 	"neuralmail/internal/vector"
@@ -32,6 +48,22 @@ type App struct {
 	LLM      llm.Provider
 	Policy   policy.Policy
 	MCP      *mcp.Server
+	// Residency routes tagged orgs to their region's storage; Store remains
+	// the directory and home-region store.
+	Residency *residency.Router
+	Ingest    *ingest.Pipeline
+	// Models routes tool calls' model requests; /healthz reports its
+	// breakers.
+	Models *llm.Router
+	// ReplicaID names this process in the inbox poll leases it holds.
+	ReplicaID string
+
+	syncs  syncHealth
+	reload reloader
+	// stopPolling cancels the poll loop StartPolling began; polling counts
+	// it and the inbox pollers it runs.
+	stopPolling context.CancelFunc
+	polling     sync.WaitGroup
 }
 
 func New(ctx context.Context, cfg config.Config) (*App, error) {
@@ -39,6 +71,11 @@ func New(ctx context.Context, cfg config.Config) (*App, error) {
 	if err != nil {
 		return nil, err
 	}
+	if cfg.Database.ReplicaDSN != "" {
+		if err := st.UseReplica(cfg.Database.ReplicaDSN, cfg.Database.ReplicaMaxLag); err != nil {
+			return nil, err
+		}
+	}
 	if err := store.Migrate(ctx, st.DB()); err != nil {
 		return nil, err
 	}
@@ -48,7 +85,7 @@ func New(ctx context.Context, cfg config.Config) (*App, error) {
 	}
 	_, _ = st.EnsureDefaults(ctx, inboxAddr)
 
-	q, err := queue.New(cfg.Redis.URL)
+	q, err := queue.New(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -60,34 +97,131 @@ func New(ctx context.Context, cfg config.Config) (*App, error) {
 
 	llmProvider := selectLLM(cfg)
 	embedder := selectEmbedder(cfg)
+	reranker, err := rerank.New(cfg, llmProvider)
+	if err != nil {
+		return nil, err
+	}
 
 	var vectorStore vector.Store
 	if cfg.Embedding.Provider != "noop" {
 		vectorStore = vector.NewQdrant(cfg.Qdrant.URL, cfg.Qdrant.Collection)
 	}
 
-	toolSvc := tools.NewService(cfg, st, llmProvider, vectorStore, pol, embedder)
+	router, err := residency.Open(cfg, st, vectorStore)
+	if err != nil {
+		return nil, err
+	}
+	if err := router.Migrate(ctx); err != nil {
+		_ = router.Close()
+		return nil, err
+	}
+	if vectorStore != nil {
+		for _, region := range router.Regions() {
+			backend, _ := router.Backend(region)
+			backend.Store.SetVectorCleanups(q)
+		}
+	}
+
+	routedLLM, err := newLLMRouter(cfg, llmProvider)
+	if err != nil {
+		_ = router.Close()
+		return nil, err
+	}
+	toolSvc := tools.NewService(cfg, st, routedLLM, vectorStore, pol, embedder)
+	toolSvc.Residency = router
+	toolSvc.Embeddings = q
+	toolSvc.Reranker = reranker
+	toolSvc.Cache = q
+	toolSvc.TokenLedger = q
+	toolSvc.CRM = integrations.NewBridge(cfg)
 	authSvc := auth.NewService(cfg, st)
-	entitlementObserver := observability.NewEntitlementObserver(log.Default())
+	entitlementObserver := observability.NewEntitlementObserver(slog.Default())
 	entitlementSvc := entitlements.NewService(cfg, st, entitlementObserver)
+	entitlementSvc.CallLimiter = q
 	mcpServer := mcp.NewServer(cfg, toolSvc, authSvc, entitlementSvc)
+	mcpServer.Sessions = st
+	mcpServer.Live = q
+	if cfg.Canary.Enabled {
+		canarySvc, err := newCanaryTools(cfg, st, vectorStore, pol, embedder)
+		if err != nil {
+			return nil, err
+		}
+		canarySvc.Residency = router
+		canarySvc.Embeddings = q
+		canarySvc.Reranker = reranker
+		canarySvc.Cache = q
+		canarySvc.TokenLedger = q
+		mcpServer.Canary = canarySvc
+		mcpServer.Router = canary.NewRouter(cfg, st)
+		slog.Info("canary enabled", "percent", cfg.Canary.Percent, "tools", cfg.Canary.Tools)
+	}
+	pipeline, err := ingest.NewPipeline(cfg, st, router, q)
+	if err != nil {
+		_ = router.Close()
+		return nil, err
+	}
+	pipeline.Jobs = q
+	ruleEngine := rules.New(st, toolSvc)
+	ruleEngine.Notify.Queue = q
+	pipeline.Rules = ruleEngine
+	if cfg.Playground.Enabled {
+		orgID, inboxID, err := playground.Seed(ctx, st, q, cfg.Playground.Inbox)
+		if err != nil {
+			_ = router.Close()
+			return nil, fmt.Errorf("playground: %w", err)
+		}
+		mcpServer.Playground = mcp.NewPlayground(orgID, inboxID, cfg.Playground.RPM, cfg.Playground.AllowOrigins)
+		mcpServer.Playground.DailyTokens = cfg.Playground.DailyTokens
+		mcpServer.Playground.Ledger = q
+		slog.Info("mcp playground enabled", "inbox", cfg.Playground.Inbox, "rpm", cfg.Playground.RPM, "daily_tokens", cfg.Playground.DailyTokens)
+	}
 
 	return &App{
-		Config:   cfg,
-		Store:    st,
-		Queue:    q,
-		Vector:   vectorStore,
-		Embedder: embedder,
-		LLM:      llmProvider,
-		Policy:   pol,
-		MCP:      mcpServer,
+		Config:    cfg,
+		Store:     st,
+		Queue:     q,
+		Vector:    vectorStore,
+		Embedder:  embedder,
+		LLM:       llmProvider,
+		Models:    routedLLM,
+		Policy:    pol,
+		MCP:       mcpServer,
+		Residency: router,
+		Ingest:    pipeline,
+		ReplicaID: replicaID(),
 	}, nil
 }
 
+func replicaID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "serve"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// Close stops polling and waits, up to http.shutdown_timeout, for the
+// inbox pollers to return before releasing this replica's poll leases: a
+// poll still running could otherwise renew a lease just released.
 func (a *App) Close() error {
 	var err error
+	a.stopPollers()
+	if a.Store != nil && a.ReplicaID != "" {
+		// Hand this replica's inboxes to the others straight away rather
+		// than once the leases run out.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if _, releaseErr := a.Store.ReleasePollLeases(ctx, a.ReplicaID); releaseErr != nil {
+			slog.Warn("poll lease release failed", "replica", a.ReplicaID, "err", releaseErr)
+		}
+		cancel()
+	}
+	if a.Residency != nil {
+		err = a.Residency.Close()
+	}
 	if a.Store != nil {
-		err = a.Store.Close()
+		if closeErr := a.Store.Close(); err == nil {
+			err = closeErr
+		}
 	}
 	if a.Queue != nil {
 		_ = a.Queue.Close()
@@ -96,12 +230,52 @@ func (a *App) Close() error {
 }
 
 func (a *App) Serve(ctx context.Context) error {
+	control, controlLn, err := a.listenControl()
+	if err != nil {
+		return err
+	}
+
+	var handler http.Handler = a.publicMux(ctx)
+	if a.Config.HTTP.Compression.Enabled {
+		handler = httpx.Compress(handler, a.Config.HTTP.Compression.MinBytes, a.Config.HTTP.Compression.Level)
+	}
+	srv := newHTTPServer(a.Config, handler)
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-ctx.Done()
+		a.shutdown(srv, control)
+	}()
+	if control != nil {
+		slog.Info("control api listening", "addr", controlLn.Addr().String())
+		go func() {
+			if err := control.Serve(controlLn); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("control api stopped", "err", err)
+			}
+		}()
+	}
+
+	err = a.listen(srv)
+	if errors.Is(err, http.ErrServerClosed) {
+		<-drained
+		return nil
+	}
+	if control != nil {
+		_ = control.Close()
+	}
+	return err
+}
+
+// publicMux routes the public listener: health, MCP and push callbacks.
+// The control API is served apart; see listenControl.
+func (a *App) publicMux(ctx context.Context) *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("ok"))
-	})
+	mux.HandleFunc("/healthz", a.handleHealth)
 	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if a.MCP.Draining() {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
 		if err := a.Store.Ping(ctx); err != nil {
 			http.Error(w, err.Error(), http.StatusServiceUnavailable)
 			return
@@ -114,22 +288,90 @@ func (a *App) Serve(ctx context.Context) error {
 		_, _ = w.Write([]byte("ready"))
 	})
 	mux.HandleFunc("/debug", a.handleDebug)
-	mux.HandleFunc("/mcp", a.MCP.HandleHTTP)
-	mux.HandleFunc("/mcp/sse", a.MCP.HandleSSEStub)
+	mux.HandleFunc("/mcp", a.withMaintenance(a.MCP.HandleHTTP))
+	mux.HandleFunc("/mcp/sse", a.withMaintenance(a.MCP.HandleSSEStub))
+	mux.HandleFunc("/mcp-playground", a.withMaintenance(a.MCP.HandlePlayground))
+	mux.HandleFunc("/v1/replays/", a.withMaintenance(a.MCP.HandleReplay))
 	mux.HandleFunc("/jmap/push", a.handleJMAPPush)
+	return mux
+}
 
-	srv := &http.Server{
-		Addr:              a.Config.HTTP.Addr,
-		Handler:           mux,
-		ReadHeaderTimeout: 5 * time.Second,
+// shutdown drains srv within http.shutdown_timeout: MCP refuses new tool
+// calls and /readyz fails so load balancers move traffic away, calls
+// already running finish and settle their usage, and then the listener and
+// idle connections close. The control listener, when there is one, closes
+// after it. Close then stops the inbox pollers and releases their leases.
+func (a *App) shutdown(srv, control *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.Config.HTTP.ShutdownTimeout)
+	defer cancel()
+	slog.Info("draining", "timeout", a.Config.HTTP.ShutdownTimeout)
+	if err := a.MCP.Drain(ctx); err != nil {
+		slog.Warn("drain timed out; their reservations stay held", "err", err)
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("http shutdown timed out; closing connections", "err", err)
+		_ = srv.Close()
+	}
+	if control != nil {
+		if err := control.Shutdown(ctx); err != nil {
+			_ = control.Close()
+		}
+	}
+	slog.Info("drained")
+}
+
+func (a *App) listen(srv *http.Server) error {
+	if a.Config.HTTP.ClientCAFile != "" {
+		if a.Config.HTTP.TLSCertFile == "" || a.Config.HTTP.TLSKeyFile == "" {
+			return errors.New("http.client_ca_file requires tls_cert_file and tls_key_file")
+		}
+		pool, err := loadClientCAs(a.Config.HTTP.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		// Certificates are optional at the handshake; the verifier decides
+		// whether a token needs one.
+		srv.TLSConfig = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	}
+	if a.Config.HTTP.TLSCertFile != "" && a.Config.HTTP.TLSKeyFile != "" {
+		slog.Info("http listening", "addr", srv.Addr, "tls", true, "http2", a.Config.HTTP.HTTP2, "mtls", srv.TLSConfig != nil)
+		return srv.ListenAndServeTLS(a.Config.HTTP.TLSCertFile, a.Config.HTTP.TLSKeyFile)
+	}
+	if a.Config.HTTP.HTTP2 {
+		slog.Warn("http2 requires tls_cert_file/tls_key_file; serving HTTP/1.1", "addr", srv.Addr)
 	}
-	go func() {
-		<-ctx.Done()
-		_ = srv.Shutdown(context.Background())
-	}()
 	return srv.ListenAndServe()
 }
 
+func loadClientCAs(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read client ca file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("client ca file %s holds no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+func newHTTPServer(cfg config.Config, handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:              cfg.HTTP.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+	}
+	if !cfg.HTTP.HTTP2 {
+		// A non-nil empty map disables the automatic HTTP/2 upgrade over TLS.
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	srv.SetKeepAlivesEnabled(cfg.HTTP.KeepAlives)
+	return srv
+}
+
 func (a *App) handleJMAPPush(w http.ResponseWriter, r *http.Request) {
 	secret := r.Header.Get("X-NM-Push-Secret")
 	if a.Config.JMAP.PushSecret != "" && secret != a.Config.JMAP.PushSecret {
@@ -139,9 +381,30 @@ func (a *App) handleJMAPPush(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// handleHealth answers liveness probes with 200 and the model breakers'
+// state; status is "degraded" while any of them is open. An LLM outage does
+// not make the server unhealthy, since fallbacks and non-model tools still
+// work.
+func (a *App) handleHealth(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]any{"status": "ok"}
+	if a.Models != nil {
+		models := a.Models.Health()
+		for _, m := range models {
+			if m.State != llm.BreakerClosed {
+				resp["status"] = "degraded"
+			}
+		}
+		resp["llm"] = models
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
 func (a *App) handleDebug(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	queueDepth, _ := a.Queue.Depth(ctx)
+	dlqDepth, _ := a.Queue.DeadLetterDepth(ctx, queue.EmbeddingJobs)
+	maintenance, _ := a.Queue.Maintenance(ctx)
 	inboxes, _ := a.Store.ListInboxes(ctx)
 	lastStates := make(map[string]string)
 	for _, id := range inboxes {
@@ -149,15 +412,33 @@ func (a *App) handleDebug(w http.ResponseWriter, r *http.Request) {
 		lastStates[id] = state
 	}
 	audit, _ := a.Store.ListAudit(ctx, 20)
+	leases, _ := a.Store.ListPollLeases(ctx)
 
 	w.Header().Set("Content-Type", "text/html")
 	_, _ = fmt.Fprintf(w, "<html><body><h1>Nerve Debug</h1>")
 	_, _ = fmt.Fprintf(w, "<p>Queue depth: %d</p>", queueDepth)
+	_, _ = fmt.Fprintf(w, "<p>Dead-lettered jobs: %d</p>", dlqDepth)
+	_, _ = fmt.Fprintf(w, "<p>Maintenance mode: %t</p>", maintenance)
+	_, _ = fmt.Fprintf(w, "<p>Request protocol: %s (tls=%t)</p>", r.Proto, r.TLS != nil)
 	_, _ = fmt.Fprintf(w, "<h2>Inbox checkpoints</h2><ul>")
 	for id, state := range lastStates {
 		_, _ = fmt.Fprintf(w, "<li>%s: %s</li>", id, state)
 	}
 	_, _ = fmt.Fprintf(w, "</ul>")
+	_, _ = fmt.Fprintf(w, "<h2>Inbox sync</h2><ul>")
+	for _, s := range a.InboxSyncs() {
+		_, _ = fmt.Fprintf(w, "<li>%s (%s): %s", s.InboxID, s.Provider, s.State)
+		if s.LastError != "" {
+			_, _ = fmt.Fprintf(w, ", %d failed polls: %s", s.Failures, html.EscapeString(s.LastError))
+		}
+		_, _ = fmt.Fprintf(w, "</li>")
+	}
+	_, _ = fmt.Fprintf(w, "</ul>")
+	_, _ = fmt.Fprintf(w, "<h2>Poll leases (this replica: %s)</h2><ul>", a.ReplicaID)
+	for _, l := range leases {
+		_, _ = fmt.Fprintf(w, "<li>%s: %s until %s</li>", l.InboxID, l.Holder, l.ExpiresAt.Format(time.RFC3339))
+	}
+	_, _ = fmt.Fprintf(w, "</ul>")
 	_, _ = fmt.Fprintf(w, "<h2>Quick actions</h2>")
 	_, _ = fmt.Fprintf(w, "<ul><li><a href=\"/healthz\">Check health</a></li></ul>")
 	_, _ = fmt.Fprintf(w, "<h2>Recent tool calls</h2><ul>")
@@ -167,25 +448,104 @@ func (a *App) handleDebug(w http.ResponseWriter, r *http.Request) {
 	_, _ = fmt.Fprintf(w, "</ul></body></html>")
 }
 
-func (a *App) PollLoop(ctx context.Context, client jmap.Client, inboxID string) error {
-	if client == nil {
-		return errors.New("missing jmap client")
+// syncInbox ingests inboxID's new mail if this replica holds its poll lease,
+// records the outcome in the inbox's sync health here and in the store, and
+// then works on the inbox's queued backfills.
+func (a *App) syncInbox(ctx context.Context, client jmap.Client, inboxID string) {
+	if !a.holdPollLease(ctx, inboxID) {
+		a.syncs.update(inboxID, func(s *InboxSync) { s.State = SyncStandby })
+		return
+	}
+	state, _ := a.Store.GetCheckpoint(ctx, inboxID, client.Name())
+	newState, err := a.Ingest.Ingest(ctx, client, inboxID, state)
+	now := time.Now().UTC()
+	a.recordPoll(ctx, inboxID, err)
+	if err != nil {
+		slog.ErrorContext(ctx, "ingest failed", "inbox", inboxID, "err", err)
+		a.syncs.update(inboxID, func(s *InboxSync) {
+			s.State = SyncFailing
+			s.LastPollAt = &now
+			s.LastError = err.Error()
+			s.Failures++
+		})
+		return
+	}
+	if newState != "" {
+		a.saveCheckpoint(ctx, inboxID, client.Name(), newState)
+	}
+	a.syncs.update(inboxID, func(s *InboxSync) {
+		s.State = SyncPolling
+		s.LastPollAt = &now
+		s.LastSuccessAt = &now
+		s.LastError = ""
+		s.Failures = 0
+	})
+	a.backfill(ctx, client, inboxID)
+}
+
+func (a *App) recordPoll(ctx context.Context, inboxID string, pollErr error) {
+	msg := ""
+	if pollErr != nil {
+		msg = pollErr.Error()
 	}
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-time.After(a.Config.JMAP.PollInterval):
-			state, _ := a.Store.GetCheckpoint(ctx, inboxID, client.Name())
-			newState, messageIDs, err := jmap.Ingest(ctx, client, a.Store, inboxID, state)
-			if err == nil && newState != "" {
-				_ = a.Store.UpdateCheckpoint(ctx, inboxID, client.Name(), newState)
-			}
-			for _, id := range messageIDs {
-				_ = a.Queue.PushEmbeddingJob(ctx, id)
-			}
+	if err := a.Store.RecordInboxPoll(ctx, inboxID, a.ReplicaID, msg); err != nil {
+		slog.WarnContext(ctx, "inbox sync status update failed", "inbox", inboxID, "err", err)
+	}
+}
+
+// holdPollLease takes or renews this replica's lease on polling inboxID and
+// reports whether it may poll. Without a lease TTL every replica polls.
+func (a *App) holdPollLease(ctx context.Context, inboxID string) bool {
+	ttl := a.Config.JMAP.PollLeaseTTL
+	if ttl <= 0 {
+		return true
+	}
+	acquired, previous, err := a.Store.AcquirePollLease(ctx, inboxID, a.ReplicaID, ttl)
+	if err != nil {
+		// Skipping a tick is cheaper than ingesting the inbox twice.
+		slog.WarnContext(ctx, "poll lease unavailable", "inbox", inboxID, "err", err)
+		return false
+	}
+	if acquired && previous != "" && previous != a.ReplicaID {
+		slog.InfoContext(ctx, "took over inbox polling", "inbox", inboxID, "replica", a.ReplicaID, "previous", previous)
+	}
+	return acquired
+}
+
+func (a *App) saveCheckpoint(ctx context.Context, inboxID string, provider string, state string) {
+	if provider == store.ProviderIMAP {
+		if uidValidity, lastUID, ok := imap.ParseState(state); ok {
+			_ = a.Store.UpdateIMAPCheckpoint(ctx, inboxID, uidValidity, lastUID)
+			return
 		}
 	}
+	_ = a.Store.UpdateCheckpoint(ctx, inboxID, provider, state)
+}
+
+// newCanaryTools builds the alternate tool service from the canary overrides;
+// anything not overridden is shared with the stable build.
+func newCanaryTools(cfg config.Config, st *store.Store, vectorStore vector.Store, stablePolicy policy.Policy, embedder embed.Provider) (*tools.Service, error) {
+	canaryCfg := cfg
+	if cfg.Canary.LLMModel != "" {
+		canaryCfg.LLM.Model = cfg.Canary.LLMModel
+	}
+	if cfg.Canary.PromptPath != "" {
+		canaryCfg.LLM.PromptPath = cfg.Canary.PromptPath
+	}
+	pol := stablePolicy
+	if cfg.Canary.PolicyPath != "" {
+		loaded, err := policy.Load(cfg.Canary.PolicyPath)
+		if err != nil {
+			return nil, err
+		}
+		pol = loaded
+		canaryCfg.Policy.DefaultPath = cfg.Canary.PolicyPath
+	}
+	routedLLM, err := newLLMRouter(canaryCfg, selectLLM(canaryCfg))
+	if err != nil {
+		return nil, err
+	}
+	return tools.NewService(canaryCfg, st, routedLLM, vectorStore, pol, embedder), nil
 }
 
 func selectLLM(cfg config.Config) llm.Provider {
@@ -198,10 +558,85 @@ func selectLLM(cfg config.Config) llm.Provider {
 		if cfg.LLM.OllamaURL != "" {
 			return llm.NewOllama(cfg.LLM.OllamaURL, cfg.LLM.Model)
 		}
+	case "anthropic":
+		if cfg.LLM.Anthropic.APIKey != "" {
+			return newAnthropic(cfg, cfg.LLM.Model)
+		}
+	case "azure":
+		deployment := cfg.LLM.Model
+		if deployment == "" {
+			deployment = cfg.LLM.Azure.Deployment
+		}
+		if cfg.LLM.Azure.Endpoint != "" && deployment != "" {
+			return newAzureOpenAI(cfg, deployment)
+		}
 	}
 	return llm.NewNoop()
 }
 
+func newAnthropic(cfg config.Config, model string) *llm.Anthropic {
+	a := cfg.LLM.Anthropic
+	return llm.NewAnthropic(a.APIKey, model, a.BaseURL, a.Version, a.MaxTokens, a.Stream)
+}
+
+func newAzureOpenAI(cfg config.Config, deployment string) *llm.AzureOpenAI {
+	a := cfg.LLM.Azure
+	return llm.NewAzureOpenAI(a.Endpoint, a.APIKey, deployment, a.APIVersion, a.Stream)
+}
+
+// NewModels returns the configured model provider behind cfg.LLM's routes,
+// as the MCP tools use it, for processes that run tools outside App.
+func NewModels(cfg config.Config) (*llm.Router, error) {
+	return newLLMRouter(cfg, selectLLM(cfg))
+}
+
+// newLLMRouter puts def behind the task routes in cfg.LLM.Routes. Routes
+// can name any model of a provider configured here; others are skipped.
+func newLLMRouter(cfg config.Config, def llm.Provider) (*llm.Router, error) {
+	if err := llm.ValidateRoutes(cfg.LLM.Routes); err != nil {
+		return nil, fmt.Errorf("llm.routes: %w", err)
+	}
+	for _, ref := range cfg.LLM.Fallbacks {
+		if _, err := llm.ParseRef(ref); err != nil {
+			return nil, fmt.Errorf("llm.fallbacks: %w", err)
+		}
+	}
+	for _, class := range cfg.LLM.RedactPII {
+		if !pii.Valid(class) {
+			return nil, fmt.Errorf("llm.redact_pii: unknown class %q", class)
+		}
+	}
+	build := func(ref llm.Ref) (llm.Provider, bool) {
+		switch ref.Provider {
+		case "openai":
+			if cfg.LLM.OpenAIKey != "" {
+				return llm.NewOpenAI(cfg.LLM.OpenAIKey, ref.Model), true
+			}
+		case "ollama":
+			if cfg.LLM.OllamaURL != "" {
+				return llm.NewOllama(cfg.LLM.OllamaURL, ref.Model), true
+			}
+		case "anthropic":
+			if cfg.LLM.Anthropic.APIKey != "" {
+				return newAnthropic(cfg, ref.Model), true
+			}
+		case "azure":
+			if cfg.LLM.Azure.Endpoint != "" {
+				return newAzureOpenAI(cfg, ref.Model), true
+			}
+		case "noop":
+			return llm.NewNoop(), true
+		}
+		return nil, false
+	}
+	router := llm.NewRouter(def, cfg.LLM.Routes, cfg.LLM.Prices, build)
+	router.Fallbacks = cfg.LLM.Fallbacks
+	router.BreakerFailures = cfg.LLM.Breaker.Failures
+	router.BreakerCooldown = cfg.LLM.Breaker.Cooldown
+	router.RedactPII = cfg.LLM.RedactPII
+	return router, nil
+}
+
 func selectEmbedder(cfg config.Config) embed.Provider {
 	switch cfg.Embedding.Provider {
 	case "openai":
@@ -0,0 +1,93 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"neuralmail/internal/jmap"
+)
+
+// backfill works through inboxID's queued backfills, oldest first, for up to
+// a poll interval, so new mail keeps arriving on time while a long backfill
+// drains over several ticks. Progress is saved after every page, and the
+// poll lease is renewed with it; losing the lease leaves the backfill to the
+// replica that took the inbox over.
+func (a *App) backfill(ctx context.Context, client jmap.Client, inboxID string) {
+	deadline := time.Now().Add(a.Config.JMAP.PollInterval)
+	for time.Now().Before(deadline) {
+		b, err := a.Store.StartInboxBackfill(ctx, inboxID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "inbox backfill lookup failed", "inbox", inboxID, "err", err)
+			return
+		}
+		ranged, ok := jmap.Range(client, b.Since, b.Until)
+		if !ok {
+			if !a.finishBackfill(ctx, b.ID, inboxID, client.Name()+" inboxes cannot be backfilled") {
+				return
+			}
+			continue
+		}
+		cursor := b.Cursor
+		for {
+			counted := &countingClient{Client: ranged}
+			next, err := a.Ingest.Backfill(ctx, counted, inboxID, cursor)
+			if err != nil {
+				if ctx.Err() != nil {
+					// Shutting down: resume from the saved cursor later.
+					return
+				}
+				if !a.finishBackfill(ctx, b.ID, inboxID, err.Error()) {
+					return
+				}
+				break
+			}
+			if err := a.Store.AdvanceInboxBackfill(ctx, b.ID, next, counted.n); err != nil {
+				slog.WarnContext(ctx, "inbox backfill progress update failed", "inbox", inboxID, "backfill", b.ID, "err", err)
+				return
+			}
+			if next == "" {
+				if !a.finishBackfill(ctx, b.ID, inboxID, "") {
+					return
+				}
+				break
+			}
+			cursor = next
+			if time.Now().After(deadline) || !a.holdPollLease(ctx, inboxID) {
+				return
+			}
+		}
+	}
+}
+
+// finishBackfill marks a backfill done, or failed with failure, and
+// reports whether that was recorded.
+func (a *App) finishBackfill(ctx context.Context, id, inboxID, failure string) bool {
+	if err := a.Store.FinishInboxBackfill(ctx, id, failure); err != nil {
+		slog.WarnContext(ctx, "inbox backfill update failed", "inbox", inboxID, "backfill", id, "err", err)
+		return false
+	}
+	if failure != "" {
+		slog.ErrorContext(ctx, "inbox backfill failed", "inbox", inboxID, "backfill", id, "err", failure)
+	} else {
+		slog.InfoContext(ctx, "inbox backfill finished", "inbox", inboxID, "backfill", id)
+	}
+	return true
+}
+
+// countingClient counts the emails its client returns.
+type countingClient struct {
+	jmap.Client
+	n int
+}
+
+func (c *countingClient) FetchChanges(ctx context.Context, sinceState string) ([]jmap.Email, string, error) {
+	emails, state, err := c.Client.FetchChanges(ctx, sinceState)
+	c.n += len(emails)
+	return emails, state, err
+}
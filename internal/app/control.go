@@ -0,0 +1,386 @@
+package app
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"neuralmail/internal/queue"
+	"neuralmail/internal/store"
+)
+
+// controlHandler serves the operator control API used by `neuralmail
+// admin`. It is not mounted beside /mcp but on its own listener,
+// http.admin_addr; see listenControl. Every request must carry the
+// configured API key as a bearer token, whatever address it comes from.
+func (a *App) controlHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/control/status", a.requireControl(a.handleControlStatus))
+	mux.HandleFunc("/control/inboxes", a.requireControl(a.handleControlInboxes))
+	mux.HandleFunc("/control/threads", a.requireControl(a.handleControlThreads))
+	mux.HandleFunc("/control/threads/", a.requireControl(a.handleControlThreadByID))
+	mux.HandleFunc("/control/dlq", a.requireControl(a.handleControlDLQ))
+	mux.HandleFunc("/control/dlq/retry", a.requireControl(a.handleControlDLQRetry))
+	mux.HandleFunc("/control/queue", a.requireControl(a.handleControlQueue))
+	mux.HandleFunc("/control/maintenance", a.requireControl(a.handleControlMaintenance))
+	mux.HandleFunc("/control/poll-leases", a.requireControl(a.handleControlPollLeases))
+	return mux
+}
+
+// listenControl binds http.admin_addr for the control API. Without an API
+// key there is nothing to authenticate against, so the API stays off; in
+// cloud mode that is a startup error rather than a warning.
+func (a *App) listenControl() (*http.Server, net.Listener, error) {
+	addr := strings.TrimSpace(a.Config.HTTP.AdminAddr)
+	if addr == "" {
+		return nil, nil, nil
+	}
+	if strings.TrimSpace(a.Config.Security.APIKey) == "" {
+		if a.Config.Cloud.Mode {
+			return nil, nil, errors.New("http.admin_addr needs security.api_key in cloud mode; set NM_API_KEY or clear admin_addr")
+		}
+		slog.Warn("control api off: security.api_key is not set", "addr", addr)
+		return nil, nil, nil
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("control api: %w", err)
+	}
+	srv := newHTTPServer(a.Config, a.controlHandler())
+	srv.Addr = addr
+	return srv, ln, nil
+}
+
+func (a *App) requireControl(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimSpace(a.Config.Security.APIKey)
+		token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		if key == "" || subtle.ConstantTimeCompare([]byte(token), []byte(key)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// withMaintenance rejects MCP traffic while maintenance mode is on, and
+// while the server drains for shutdown.
+func (a *App) withMaintenance(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.MCP.Draining() {
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		if on, _ := a.Queue.Maintenance(r.Context()); on {
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "maintenance mode", http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (a *App) handleControlStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	queueDepth, err := a.Queue.Depth(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	dlqDepth, err := a.Queue.DeadLetterDepth(ctx, queue.EmbeddingJobs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	maintenance, err := a.Queue.Maintenance(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	messages, _ := a.Store.MessageCount(ctx)
+	loops, _ := a.Store.GetMailLoopStats(ctx, time.Now().Add(-24*time.Hour))
+	closures, _ := a.Store.GetThreadClosureStats(ctx, "", time.Now().AddDate(0, 0, -30))
+	writeJSON(w, http.StatusOK, map[string]any{
+		"queue_depth":   queueDepth,
+		"dlq_depth":     dlqDepth,
+		"maintenance":   maintenance,
+		"message_count": messages,
+		"mail_loops":    mailLoopsJSON(loops),
+		"thread_closures_30d": map[string]any{
+			"closed":           closures.Closed,
+			"reopen_rate":      closures.ReopenRate(),
+			"auto_closed":      closures.AutoClosed,
+			"auto_reopen_rate": closures.AutoReopenRate(),
+		},
+	})
+}
+
+func (a *App) handleControlInboxes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	records, err := a.Store.ListInboxRecords(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out := make([]map[string]any, 0, len(records))
+	for _, rec := range records {
+		item := map[string]any{
+			"id":         rec.ID,
+			"address":    rec.Address,
+			"status":     rec.Status,
+			"provider":   rec.Provider,
+			"created_at": rec.CreatedAt,
+		}
+		if sync, ok := a.syncs.get(rec.ID); ok {
+			item["sync"] = sync
+		}
+		out = append(out, item)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"inboxes": out})
+}
+
+func (a *App) handleControlThreads(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	inboxID := strings.TrimSpace(r.URL.Query().Get("inbox_id"))
+	if inboxID == "" {
+		http.Error(w, "missing inbox_id", http.StatusBadRequest)
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	backend, err := a.Residency.ForInbox(r.Context(), inboxID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "inbox not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	awaiting := r.URL.Query().Get("awaiting_reply")
+	if awaiting != "" && awaiting != store.AwaitingUs && awaiting != store.AwaitingCustomer {
+		http.Error(w, "awaiting_reply must be us or customer", http.StatusBadRequest)
+		return
+	}
+	threads, err := backend.Store.ListThreads(r.Context(), inboxID, r.URL.Query().Get("status"), awaiting, "", limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out := make([]map[string]any, 0, len(threads))
+	for _, t := range threads {
+		out = append(out, map[string]any{
+			"id":             t.ID,
+			"subject":        t.Subject,
+			"status":         t.Status,
+			"awaiting_reply": t.AwaitingReply,
+			"updated_at":     t.UpdatedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"threads": out})
+}
+
+func (a *App) handleControlThreadByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	threadID := strings.TrimPrefix(r.URL.Path, "/control/threads/")
+	if threadID == "" || strings.Contains(threadID, "/") {
+		http.Error(w, "missing thread id", http.StatusBadRequest)
+		return
+	}
+	_, thread, messages, err := a.Residency.LocateThread(r.Context(), threadID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "thread not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out := make([]map[string]any, 0, len(messages))
+	for _, m := range messages {
+		out = append(out, map[string]any{
+			"id":         m.ID,
+			"direction":  m.Direction,
+			"from":       m.From.Email,
+			"text":       m.Text,
+			"created_at": m.CreatedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":             thread.ID,
+		"subject":        thread.Subject,
+		"status":         thread.Status,
+		"awaiting_reply": thread.AwaitingReply,
+		"messages":       out,
+	})
+}
+
+func (a *App) handleControlDLQ(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	limit, _ := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+	items, err := a.Queue.ListDeadLetters(r.Context(), controlQueueName(r), limit)
+	if errors.Is(err, queue.ErrUnknownQueue) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"jobs": items})
+}
+
+func (a *App) handleControlDLQRetry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Limit int `json:"limit"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+	}
+	retried, err := a.Queue.RetryDeadLetters(r.Context(), controlQueueName(r), req.Limit)
+	if errors.Is(err, queue.ErrUnknownQueue) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"retried": retried})
+}
+
+// controlQueueName is the queue a dead-letter request names with ?queue=,
+// the embedding queue by default.
+func controlQueueName(r *http.Request) string {
+	if name := r.URL.Query().Get("queue"); name != "" {
+		return name
+	}
+	return queue.EmbeddingJobs
+}
+
+// handleControlQueue reports every job queue's stats for capacity tuning;
+// DELETE resets the processing histograms.
+func (a *App) handleControlQueue(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		if err := a.Queue.ResetStats(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	queues := make([]queue.Stats, 0, len(queue.Names))
+	for _, name := range queue.Names {
+		stats, err := a.Queue.Stats(r.Context(), name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		queues = append(queues, stats)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"queues": queues})
+}
+
+func (a *App) handleControlMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Enabled bool `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		if err := a.Queue.SetMaintenance(r.Context(), req.Enabled); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	on, err := a.Queue.Maintenance(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"maintenance": on})
+}
+
+// handleControlPollLeases reports which serve replica polls each inbox. An
+// expired lease is one whose holder stopped renewing it; the next replica to
+// tick takes it over.
+func (a *App) handleControlPollLeases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	leases, err := a.Store.ListPollLeases(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	out := make([]map[string]any, 0, len(leases))
+	for _, l := range leases {
+		out = append(out, map[string]any{
+			"inbox_id":    l.InboxID,
+			"holder":      l.Holder,
+			"acquired_at": l.AcquiredAt,
+			"renewed_at":  l.RenewedAt,
+			"expires_at":  l.ExpiresAt,
+			"expired":     now.After(l.ExpiresAt),
+			"held_by_me":  l.Holder == a.ReplicaID,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"replica": a.ReplicaID, "leases": out})
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func mailLoopsJSON(stats store.MailLoopStats) map[string]any {
+	return map[string]any{
+		"automated_inbound_24h":   stats.AutomatedInbound,
+		"looping_threads":         stats.LoopingThreads,
+		"suppressed_auto_replies": stats.SuppressedReplies,
+	}
+}
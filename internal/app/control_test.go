@@ -0,0 +1,169 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/queue"
+)
+
+func TestRequireControlNeedsTheKeyFromLoopback(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	request := func(a *App, token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/control/status", nil)
+		req.RemoteAddr = "127.0.0.1:54321"
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		a.requireControl(ok)(rec, req)
+		return rec.Code
+	}
+
+	a := &App{Config: config.Default()}
+	if code := request(a, ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected loopback without a configured key to be refused, got %d", code)
+	}
+
+	a.Config.Security.APIKey = "operator-key"
+	if code := request(a, ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected a request without a token to be refused, got %d", code)
+	}
+	if code := request(a, "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong token to be refused, got %d", code)
+	}
+	if code := request(a, "operator-key"); code != http.StatusOK {
+		t.Fatalf("expected the key to be accepted, got %d", code)
+	}
+}
+
+func TestListenControl(t *testing.T) {
+	cfg := config.Default()
+	cfg.HTTP.AdminAddr = "127.0.0.1:0"
+
+	cfg.Cloud.Mode = true
+	if _, _, err := (&App{Config: cfg}).listenControl(); err == nil {
+		t.Fatalf("expected cloud mode without a key to refuse to start")
+	}
+
+	cfg.Cloud.Mode = false
+	srv, ln, err := (&App{Config: cfg}).listenControl()
+	if err != nil || srv != nil || ln != nil {
+		t.Fatalf("expected the control api off without a key, got %v %v %v", srv, ln, err)
+	}
+
+	cfg.Cloud.Mode = true
+	cfg.Security.APIKey = "operator-key"
+	a := &App{Config: cfg}
+	srv, ln, err = a.listenControl()
+	if err != nil || srv == nil {
+		t.Fatalf("expected the control api to listen, got %v", err)
+	}
+	go func() { _ = srv.Serve(ln) }()
+	defer srv.Close()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/control/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected the control listener to require the key, got %d", resp.StatusCode)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/control/status", nil)
+	req.Header.Set("Authorization", "Bearer operator-key")
+	a.publicMux(context.Background()).ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected /control on the public listener to be gone, got %d", rec.Code)
+	}
+}
+
+func TestControlQueueReportsAndResetsStats(t *testing.T) {
+	cfg := config.Default()
+	cfg.Security.APIKey = "operator-key"
+	cfg.Redis.URL = testRedisURL(t)
+	q, err := queue.New(cfg)
+	if err != nil {
+		t.Fatalf("open queue: %v", err)
+	}
+	defer q.Close()
+	ctx := context.Background()
+	pingCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	if err := q.Ping(pingCtx); err != nil {
+		t.Skipf("redis unavailable for control tests: %v", err)
+	}
+	if err := q.ResetStats(ctx); err != nil {
+		t.Fatalf("reset stats: %v", err)
+	}
+	defer q.ResetStats(context.Background())
+	if err := q.RecordResult(ctx, queue.EmbeddingJobs, queue.Job{Attempts: 1}, 2*time.Second, false); err != nil {
+		t.Fatalf("record result: %v", err)
+	}
+
+	handler := (&App{Config: cfg, Queue: q}).controlHandler()
+	request := func(method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/control/queue", nil)
+		req.Header.Set("Authorization", "Bearer operator-key")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	embedding := func(rec *httptest.ResponseRecorder) queue.Stats {
+		t.Helper()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body.String())
+		}
+		var body struct {
+			Queues []queue.Stats `json:"queues"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("decode queues: %v", err)
+		}
+		if len(body.Queues) != len(queue.Names) {
+			t.Fatalf("expected every queue reported, got %d", len(body.Queues))
+		}
+		for _, stats := range body.Queues {
+			if stats.Queue == queue.EmbeddingJobs {
+				return stats
+			}
+		}
+		t.Fatalf("expected %s reported", queue.EmbeddingJobs)
+		return queue.Stats{}
+	}
+
+	if stats := embedding(request(http.MethodGet)); stats.Processed != 1 || stats.AgeSeconds["le_5"] != 1 || stats.AttemptsBuckets["le_1"] != 1 {
+		t.Fatalf("expected the recorded job counted, got %+v", stats)
+	}
+	if stats := embedding(request(http.MethodDelete)); stats.Processed != 0 || stats.AgeSeconds["le_5"] != 0 {
+		t.Fatalf("expected DELETE to clear the counters, got %+v", stats)
+	}
+	if rec := request(http.MethodPost); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected POST to be refused, got %d", rec.Code)
+	}
+}
+
+// testRedisURL points at database 15 of the Redis at NM_TEST_REDIS_URL, or
+// of the host-mapped dev Redis.
+func testRedisURL(t *testing.T) string {
+	t.Helper()
+	rawURL := os.Getenv("NM_TEST_REDIS_URL")
+	if rawURL == "" {
+		rawURL = "redis://127.0.0.1:63790"
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("parse redis url: %v", err)
+	}
+	parsed.Path = "/15"
+	return parsed.String()
+}
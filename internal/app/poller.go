@@ -0,0 +1,230 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"neuralmail/internal/jmap"
+	"neuralmail/internal/store"
+)
+
+// Inbox sync states, as InboxSync.State reports them.
+const (
+	// SyncStarting is an inbox whose first poll has not run yet.
+	SyncStarting = "starting"
+	// SyncPolling is an inbox this replica polled successfully last time.
+	SyncPolling = "polling"
+	// SyncFailing is an inbox whose last poll failed.
+	SyncFailing = "failing"
+	// SyncStandby is an inbox another replica holds the poll lease on.
+	SyncStandby = "standby"
+	// SyncUnsupported is an inbox no configured client can sync.
+	SyncUnsupported = "unsupported"
+)
+
+// InboxSync is how polling one inbox is going on this replica.
+type InboxSync struct {
+	InboxID       string     `json:"inbox_id"`
+	Provider      string     `json:"provider"`
+	State         string     `json:"state"`
+	LastPollAt    *time.Time `json:"last_poll_at,omitempty"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	// Failures counts the polls that failed since the last success.
+	Failures int `json:"consecutive_failures"`
+}
+
+// ClientFunc returns the client that syncs inbox, or nil when none of the
+// configured providers can.
+type ClientFunc func(inbox store.InboxRecord) jmap.Client
+
+// StartPolling runs PollInboxes in the background until ctx is done or
+// Close stops it.
+func (a *App) StartPolling(ctx context.Context, clientFor ClientFunc) {
+	ctx, a.stopPolling = context.WithCancel(ctx)
+	a.polling.Add(1)
+	go func() {
+		defer a.polling.Done()
+		_ = a.PollInboxes(ctx, clientFor)
+	}()
+}
+
+// stopPollers cancels the poll loop and waits for it and its inbox pollers
+// to return, giving up after http.shutdown_timeout.
+func (a *App) stopPollers() {
+	if a.stopPolling == nil {
+		return
+	}
+	a.stopPolling()
+	done := make(chan struct{})
+	go func() {
+		a.polling.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(a.Config.HTTP.ShutdownTimeout):
+		slog.Warn("inbox pollers still running at shutdown", "timeout", a.Config.HTTP.ShutdownTimeout)
+	}
+}
+
+// PollInboxes polls every active inbox, each from a goroutine of its own
+// using the client clientFor picks for it. The active inboxes are looked up
+// again each poll interval, so inboxes created, disabled, deleted or moved
+// to another provider are picked up or dropped without a restart.
+func (a *App) PollInboxes(ctx context.Context, clientFor ClientFunc) error {
+	running := map[string]inboxPoller{}
+	defer func() {
+		for _, p := range running {
+			p.cancel()
+		}
+	}()
+	for {
+		a.discoverInboxes(ctx, clientFor, running)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(a.Config.JMAP.PollInterval):
+		}
+	}
+}
+
+// inboxPoller is a running inbox's sync goroutine.
+type inboxPoller struct {
+	provider string
+	cancel   context.CancelFunc
+}
+
+// discoverInboxes starts a sync goroutine for each active inbox without one
+// and stops those of inboxes no longer active. An inbox whose provider
+// changed is restarted with the new provider's client.
+func (a *App) discoverInboxes(ctx context.Context, clientFor ClientFunc, running map[string]inboxPoller) {
+	inboxes, err := a.Store.ListActiveInboxRecords(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "inbox discovery failed", "err", err)
+		return
+	}
+	active := make(map[string]bool, len(inboxes))
+	for _, inbox := range inboxes {
+		active[inbox.ID] = true
+		if p, ok := running[inbox.ID]; ok {
+			if p.provider == inbox.Provider {
+				continue
+			}
+			p.cancel()
+			delete(running, inbox.ID)
+		}
+		client := clientFor(inbox)
+		if client == nil {
+			a.syncs.reset(inbox.ID, inbox.Provider, SyncUnsupported)
+			continue
+		}
+		a.syncs.reset(inbox.ID, inbox.Provider, SyncStarting)
+		pollCtx, cancel := context.WithCancel(ctx)
+		running[inbox.ID] = inboxPoller{provider: inbox.Provider, cancel: cancel}
+		slog.InfoContext(ctx, "inbox polling started", "inbox", inbox.ID, "provider", inbox.Provider)
+		a.polling.Add(1)
+		go func() {
+			defer a.polling.Done()
+			a.pollInbox(pollCtx, client, inbox.ID)
+		}()
+	}
+	for id, p := range running {
+		if !active[id] {
+			p.cancel()
+			delete(running, id)
+			slog.InfoContext(ctx, "inbox polling stopped", "inbox", id)
+		}
+	}
+	a.syncs.retain(active)
+}
+
+// pollInbox syncs inboxID every poll interval until ctx is done. The first
+// poll waits a random part of an interval so inboxes discovered together do
+// not all poll at once.
+func (a *App) pollInbox(ctx context.Context, client jmap.Client, inboxID string) {
+	interval := a.Config.JMAP.PollInterval
+	wait := interval
+	if interval > 0 {
+		wait = rand.N(interval)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = interval
+		if on, _ := a.Queue.Maintenance(ctx); on {
+			continue
+		}
+		a.syncInbox(ctx, client, inboxID)
+	}
+}
+
+// InboxSyncs reports this replica's sync health for every active inbox, by
+// inbox ID.
+func (a *App) InboxSyncs() []InboxSync {
+	return a.syncs.list()
+}
+
+// syncHealth holds the InboxSync of each inbox the serve loop knows about.
+type syncHealth struct {
+	mu      sync.Mutex
+	inboxes map[string]*InboxSync
+}
+
+// reset starts inboxID's health over in state, as when its poller starts.
+func (h *syncHealth) reset(inboxID, provider, state string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.inboxes == nil {
+		h.inboxes = map[string]*InboxSync{}
+	}
+	h.inboxes[inboxID] = &InboxSync{InboxID: inboxID, Provider: provider, State: state}
+}
+
+// update applies fn to inboxID's health, if the inbox is still tracked.
+func (h *syncHealth) update(inboxID string, fn func(*InboxSync)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.inboxes[inboxID]; ok {
+		fn(s)
+	}
+}
+
+// retain forgets the inboxes not in active.
+func (h *syncHealth) retain(active map[string]bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for id := range h.inboxes {
+		if !active[id] {
+			delete(h.inboxes, id)
+		}
+	}
+}
+
+func (h *syncHealth) get(inboxID string) (InboxSync, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.inboxes[inboxID]
+	if !ok {
+		return InboxSync{}, false
+	}
+	return *s, true
+}
+
+func (h *syncHealth) list() []InboxSync {
+	h.mu.Lock()
+	out := make([]InboxSync, 0, len(h.inboxes))
+	for _, s := range h.inboxes {
+		out = append(out, *s)
+	}
+	h.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].InboxID < out[j].InboxID })
+	return out
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"neuralmail/internal/config"
+)
+
+func TestCloseWaitsForInboxPollers(t *testing.T) {
+	a := &App{Config: config.Default()}
+	var ctx context.Context
+	ctx, a.stopPolling = context.WithCancel(context.Background())
+	var finished atomic.Bool
+	a.polling.Add(1)
+	go func() {
+		defer a.polling.Done()
+		<-ctx.Done()
+		// A poll finishing its last sync after the cancel.
+		time.Sleep(50 * time.Millisecond)
+		finished.Store(true)
+	}()
+
+	if err := a.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if !finished.Load() {
+		t.Fatalf("expected Close to wait for the poller to return")
+	}
+}
+
+func TestCloseGivesUpOnAStuckPoller(t *testing.T) {
+	cfg := config.Default()
+	cfg.HTTP.ShutdownTimeout = 20 * time.Millisecond
+	a := &App{Config: cfg, stopPolling: func() {}}
+	a.polling.Add(1)
+	defer a.polling.Done()
+
+	done := make(chan struct{})
+	go func() {
+		_ = a.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected Close to return after the shutdown timeout")
+	}
+}
@@ -0,0 +1,297 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/observability"
+	"neuralmail/internal/policy"
+	"neuralmail/internal/secrets"
+	"neuralmail/internal/store"
+	"neuralmail/internal/tools"
+)
+
+// auditConfigReloaded names the tool call a reload's audit entry hangs off.
+const auditConfigReloaded = "config_reloaded"
+
+// reloadable are the settings Reload applies to a serving App. Any other
+// change is logged as needing a restart.
+var reloadable = map[string]bool{
+	"log.level":                          true,
+	"llm.prompt_path":                    true,
+	"security.outbound_domain_allowlist": true,
+	"policy.default_path":                true,
+	"canary.prompt_path":                 true,
+	"canary.policy_path":                 true,
+}
+
+// Change is one setting a reload changed, secrets masked as `neuralmail
+// config check` shows them. Policy fields are keyed policy.<field>, or
+// canary.policy.<field> for the canary's policy.
+type Change struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// reloadState is what the last reload applied.
+type reloadState struct {
+	cfg    config.Config
+	policy policy.Policy
+	canary policy.Policy
+}
+
+type reloader struct {
+	mu   sync.Mutex
+	last *reloadState
+}
+
+// Reload re-reads the configuration from path and the policy files it
+// names, and hands the log level, prompt paths, outbound allowlist and
+// policies to the running services; sessions and connections are kept.
+// A file that fails to load or validate leaves the settings in force. The
+// changes are logged and audited with their before and after values.
+func (a *App) Reload(ctx context.Context, path string, trigger string) ([]Change, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate().Err(); err != nil {
+		return nil, err
+	}
+	next := reloadState{cfg: cfg}
+	if next.policy, err = policy.Load(cfg.Policy.DefaultPath); err != nil {
+		return nil, err
+	}
+	next.canary = next.policy
+	if cfg.Canary.PolicyPath != "" {
+		if next.canary, err = policy.Load(cfg.Canary.PolicyPath); err != nil {
+			return nil, err
+		}
+	}
+
+	a.reload.mu.Lock()
+	defer a.reload.mu.Unlock()
+	prev := a.reloadedState()
+	changes, restart := diffReload(prev, next)
+	for _, field := range restart {
+		slog.Warn("config change needs a restart", "field", field)
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	if err := observability.SetLogLevel(cfg.Log.Level); err != nil {
+		return nil, err
+	}
+	if a.MCP != nil && a.MCP.Tools != nil {
+		a.MCP.Tools.Reload(tools.Reloadable{
+			Policy:                  next.policy,
+			PromptPath:              cfg.LLM.PromptPath,
+			OutboundDomainAllowlist: cfg.Security.OutboundDomainAllowlist,
+		})
+	}
+	if a.MCP != nil && a.MCP.Canary != nil {
+		promptPath := cfg.LLM.PromptPath
+		if cfg.Canary.PromptPath != "" {
+			promptPath = cfg.Canary.PromptPath
+		}
+		a.MCP.Canary.Reload(tools.Reloadable{
+			Policy:                  next.canary,
+			PromptPath:              promptPath,
+			OutboundDomainAllowlist: cfg.Security.OutboundDomainAllowlist,
+		})
+	}
+	a.reload.last = &next
+
+	for _, c := range changes {
+		slog.Info("config reloaded", "trigger", trigger, "field", c.Field, "before", c.Before, "after", c.After)
+	}
+	a.auditReload(ctx, path, trigger, cfg, changes)
+	return changes, nil
+}
+
+// reloadedState returns the settings in force: the last reload's, or
+// those the App was built with. Callers hold reload.mu.
+func (a *App) reloadedState() reloadState {
+	if a.reload.last != nil {
+		return *a.reload.last
+	}
+	state := reloadState{cfg: a.Config, policy: a.Policy, canary: a.Policy}
+	if a.MCP != nil && a.MCP.Canary != nil {
+		state.canary = a.MCP.Canary.Current().Policy
+	}
+	return state
+}
+
+func (a *App) auditReload(ctx context.Context, path string, trigger string, cfg config.Config, changes []Change) {
+	if a.Store == nil {
+		return
+	}
+	inputs, _ := json.Marshal(map[string]string{"trigger": trigger, "path": path})
+	outputs, _ := json.Marshal(map[string]any{"changes": changes})
+	toolCallID, err := a.Store.RecordToolCall(ctx, auditConfigReloaded, "", "", cfg.LLM.PromptPath, 0)
+	if err == nil {
+		err = a.Store.RecordAudit(ctx, store.AuditRecord{
+			ToolCallID:  toolCallID,
+			Actor:       trigger,
+			InputsHash:  sha256Hex(inputs),
+			OutputsHash: sha256Hex(outputs),
+			Inputs:      inputs,
+			Outputs:     outputs,
+		})
+	}
+	if err != nil {
+		slog.Warn("config reload audit failed", "err", err)
+	}
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// diffReload returns the reloadable settings and policy fields that differ
+// between prev and next, and the other settings that do.
+func diffReload(prev reloadState, next reloadState) (changes []Change, restart []string) {
+	before := map[string]string{}
+	for _, s := range prev.cfg.Settings() {
+		before[s.Key] = s.Value
+	}
+	for _, s := range next.cfg.Settings() {
+		if before[s.Key] == s.Value {
+			continue
+		}
+		if reloadable[s.Key] {
+			changes = append(changes, Change{Field: s.Key, Before: before[s.Key], After: s.Value})
+		} else {
+			restart = append(restart, s.Key)
+		}
+	}
+	changes = append(changes, diffPolicy("policy", prev.policy, next.policy)...)
+	if next.cfg.Canary.Enabled {
+		changes = append(changes, diffPolicy("canary.policy", prev.canary, next.canary)...)
+	}
+	return changes, restart
+}
+
+// diffPolicy compares the top-level fields of two policies, rendered as
+// JSON.
+func diffPolicy(prefix string, prev policy.Policy, next policy.Policy) []Change {
+	var changes []Change
+	pv, nv := reflect.ValueOf(prev), reflect.ValueOf(next)
+	for i := 0; i < pv.NumField(); i++ {
+		name, _, _ := strings.Cut(pv.Type().Field(i).Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		before, _ := json.Marshal(pv.Field(i).Interface())
+		after, _ := json.Marshal(nv.Field(i).Interface())
+		if string(before) != string(after) {
+			changes = append(changes, Change{Field: prefix + "." + name, Before: string(before), After: string(after)})
+		}
+	}
+	return changes
+}
+
+// WatchReload reloads the configuration from path on SIGHUP and, with
+// reload.watch_interval set, whenever path or a policy file in force
+// changes, until ctx is done. It also refreshes referenced secrets every
+// secrets.refresh_interval.
+func (a *App) WatchReload(ctx context.Context, path string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	var tick <-chan time.Time
+	if a.Config.Reload.WatchInterval > 0 {
+		ticker := time.NewTicker(a.Config.Reload.WatchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var refresh <-chan time.Time
+	if a.Config.Secrets.RefreshInterval > 0 && len(a.Config.SecretRefs()) > 0 {
+		ticker := time.NewTicker(a.Config.Secrets.RefreshInterval)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+
+	stamps := a.watchedFiles(path)
+	reload := func(trigger string) {
+		if _, err := a.Reload(ctx, path, trigger); err != nil {
+			slog.Error("config reload failed; keeping the settings in force", "trigger", trigger, "err", err)
+		}
+		stamps = a.watchedFiles(path)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			reload("sighup")
+		case <-tick:
+			if !maps.Equal(stamps, a.watchedFiles(path)) {
+				reload("file_watch")
+			}
+		case <-refresh:
+			a.refreshSecrets(ctx)
+		}
+	}
+}
+
+// refreshSecrets fetches the secrets settings reference again, so reloads
+// and new connections pick up rotated ones, and logs the settings whose
+// secret rotated; the services built with the old value keep it until a
+// restart.
+func (a *App) refreshSecrets(ctx context.Context) {
+	changed, err := secrets.Default().Refresh(ctx)
+	if err != nil {
+		slog.Warn("secret refresh failed; keeping the cached secrets", "err", err)
+	}
+	if len(changed) == 0 {
+		return
+	}
+	a.reload.mu.Lock()
+	refs := a.reloadedState().cfg.SecretRefs()
+	a.reload.mu.Unlock()
+	for _, ref := range changed {
+		for field, fieldRef := range refs {
+			if fieldRef == ref {
+				slog.Warn("secret rotated; restart to apply it", "field", field, "ref", ref)
+			}
+		}
+	}
+}
+
+// watchedFiles stamps the config file at path and the policy files in
+// force with their size and modification time.
+func (a *App) watchedFiles(path string) map[string]string {
+	a.reload.mu.Lock()
+	cfg := a.reloadedState().cfg
+	a.reload.mu.Unlock()
+	stamps := map[string]string{}
+	for _, file := range []string{path, cfg.Policy.DefaultPath, cfg.Canary.PolicyPath} {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil {
+			stamps[file] = fmt.Sprintf("%d@%d", info.Size(), info.ModTime().UnixNano())
+		} else {
+			stamps[file] = "missing"
+		}
+	}
+	return stamps
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"testing"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/policy"
+)
+
+func TestDiffReloadSeparatesLiveAndRestartSettings(t *testing.T) {
+	prev := reloadState{cfg: config.Default(), policy: policy.Policy{ID: "support", ForbiddenPhrases: []string{"guarantee"}}}
+	next := prev
+	next.cfg.Log.Level = "debug"
+	next.cfg.Security.OutboundDomainAllowlist = []string{"example.com"}
+	next.cfg.HTTP.Addr = ":9090"
+	next.cfg.LLM.OpenAIKey = "sk-new"
+	next.policy.ForbiddenPhrases = []string{"guarantee", "refund"}
+
+	changes, restart := diffReload(prev, next)
+	want := []Change{
+		{Field: "security.outbound_domain_allowlist", Before: "", After: "example.com"},
+		{Field: "log.level", Before: prev.cfg.Log.Level, After: "debug"},
+		{Field: "policy.forbidden_phrases", Before: `["guarantee"]`, After: `["guarantee","refund"]`},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %d changes, got %+v", len(want), changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("change %d: expected %+v, got %+v", i, want[i], changes[i])
+		}
+	}
+	if len(restart) != 2 || restart[0] != "http.addr" || restart[1] != "llm.openai_key" {
+		t.Fatalf("expected http.addr and llm.openai_key to need a restart, got %v", restart)
+	}
+
+	next.cfg.Canary.Enabled = true
+	next.canary = policy.Policy{ID: "canary"}
+	changes, _ = diffReload(prev, next)
+	if last := changes[len(changes)-1]; last.Field != "canary.policy.id" || last.After != `"canary"` {
+		t.Fatalf("expected the canary policy change, got %+v", changes)
+	}
+}
@@ -1,6 +1,9 @@
 package auth
 
-import "context"
+import (
+	"context"
+	"slices"
+)
 
 type Principal struct {
 	OrgID      string
@@ -8,6 +11,15 @@ type Principal struct {
 	TokenID    string
 	Scopes     []string
 	AuthMethod string // jwt or cloud_api_key
+	// InboxIDs confines the principal to these inboxes of its org; empty
+	// allows every inbox.
+	InboxIDs []string
+}
+
+// CanAccessInbox reports whether the principal's inbox allowlist admits
+// inboxID.
+func (p Principal) CanAccessInbox(inboxID string) bool {
+	return len(p.InboxIDs) == 0 || slices.Contains(p.InboxIDs, inboxID)
 }
 
 type principalContextKey struct{}
@@ -3,7 +3,10 @@ package auth
 import (
 	"context"
 	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
 	"database/sql"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -49,7 +52,7 @@ func NewService(cfg config.Config, st *store.Store) *Service {
 func (s *Service) AuthenticateRequest(r *http.Request) (Principal, error) {
 	authHeader := strings.TrimSpace(r.Header.Get("Authorization"))
 	if strings.HasPrefix(strings.ToLower(authHeader), "bearer ") {
-		return s.VerifyJWT(r.Context(), authHeader)
+		return s.verifyJWT(r.Context(), authHeader, peerCertThumbprint(r))
 	}
 	if key := strings.TrimSpace(r.Header.Get("X-Nerve-Cloud-Key")); key != "" {
 		return s.VerifyCloudAPIKey(r.Context(), key)
@@ -57,7 +60,15 @@ func (s *Service) AuthenticateRequest(r *http.Request) (Principal, error) {
 	return Principal{}, ErrUnauthorized
 }
 
+// VerifyJWT checks a bearer token presented without a client certificate,
+// so certificate-bound tokens are rejected.
 func (s *Service) VerifyJWT(ctx context.Context, authHeader string) (Principal, error) {
+	return s.verifyJWT(ctx, authHeader, "")
+}
+
+// verifyJWT checks a bearer token. certThumbprint is the x5t#S256 of the
+// client certificate the request came with, if any.
+func (s *Service) verifyJWT(ctx context.Context, authHeader string, certThumbprint string) (Principal, error) {
 	headerParts := strings.Fields(authHeader)
 	if len(headerParts) != 2 || !strings.EqualFold(headerParts[0], "Bearer") {
 		return Principal{}, ErrUnauthorized
@@ -73,6 +84,9 @@ func (s *Service) VerifyJWT(ctx context.Context, authHeader string) (Principal,
 		jwt.WithValidMethods([]string{"HS256"}),
 		jwt.WithTimeFunc(s.Now),
 	}
+	if s.Config.Auth.RequireTokenClaims && (strings.TrimSpace(s.Config.Auth.Issuer) == "" || strings.TrimSpace(s.Config.Auth.Audience) == "") {
+		return Principal{}, fmt.Errorf("%w: token issuer and audience not configured", ErrUnauthorized)
+	}
 	if iss := strings.TrimSpace(s.Config.Auth.Issuer); iss != "" {
 		parserOpts = append(parserOpts, jwt.WithIssuer(iss))
 	}
@@ -99,6 +113,9 @@ func (s *Service) VerifyJWT(ctx context.Context, authHeader string) (Principal,
 	if orgID == "" {
 		return Principal{}, ErrUnauthorized
 	}
+	if !s.certBindingOK(claims, certThumbprint) {
+		return Principal{}, ErrUnauthorized
+	}
 	tokenID := claimString(claims["jti"])
 	if servicePrincipal, ok, err := s.resolveServiceTokenPrincipal(ctx, tokenID); err != nil {
 		return Principal{}, err
@@ -112,6 +129,7 @@ func (s *Service) VerifyJWT(ctx context.Context, authHeader string) (Principal,
 		TokenID:    tokenID,
 		Scopes:     extractScopes(claims["scope"]),
 		AuthMethod: "jwt",
+		InboxIDs:   extractScopes(claims["inbox_ids"]),
 	}, nil
 }
 
@@ -136,6 +154,7 @@ func (s *Service) resolveServiceTokenPrincipal(ctx context.Context, tokenID stri
 		TokenID:    token.ID,
 		Scopes:     token.Scopes,
 		AuthMethod: "jwt",
+		InboxIDs:   token.InboxIDs,
 	}, true, nil
 }
 
@@ -154,12 +173,17 @@ func (s *Service) VerifyCloudAPIKey(ctx context.Context, key string) (Principal,
 	if record.RevokedAt.Valid {
 		return Principal{}, ErrUnauthorized
 	}
+	// A rotated key works until its grace window ends.
+	if record.ExpiresAt.Valid && !s.Now().Before(record.ExpiresAt.Time) {
+		return Principal{}, ErrUnauthorized
+	}
 	return Principal{
 		OrgID:      record.OrgID,
 		ActorID:    "cloud_api_key:" + record.ID,
 		TokenID:    record.ID,
 		Scopes:     record.Scopes,
 		AuthMethod: "cloud_api_key",
+		InboxIDs:   record.InboxIDs,
 	}, nil
 }
 
@@ -181,6 +205,34 @@ func (s *Service) ValidateScopes(principal Principal, requiredScope string) erro
 	return ErrForbidden
 }
 
+// certBindingOK checks a token's cnf claim (RFC 8705): a token bound to a
+// certificate is only good on a connection presenting that certificate.
+// Unbound tokens pass unless auth.require_cert_binding is on.
+func (s *Service) certBindingOK(claims jwt.MapClaims, certThumbprint string) bool {
+	cnf, _ := claims["cnf"].(map[string]any)
+	bound := claimString(cnf["x5t#S256"])
+	if bound == "" {
+		return !s.Config.Auth.RequireCertBinding
+	}
+	return certThumbprint != "" && subtle.ConstantTimeCompare([]byte(bound), []byte(certThumbprint)) == 1
+}
+
+// CertThumbprint is the x5t#S256 of a certificate: the unpadded base64url
+// SHA-256 of its DER encoding.
+func CertThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// peerCertThumbprint returns the thumbprint of the verified client
+// certificate on r's connection, or "" without mTLS.
+func peerCertThumbprint(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return CertThumbprint(r.TLS.VerifiedChains[0][0])
+}
+
 func claimString(v any) string {
 	switch value := v.(type) {
 	case string:
@@ -190,6 +242,8 @@ func claimString(v any) string {
 	}
 }
 
+// extractScopes reads a list claim given either space-separated or as an
+// array: scope, and inbox_ids the same way.
 func extractScopes(claim any) []string {
 	var scopes []string
 	switch value := claim.(type) {
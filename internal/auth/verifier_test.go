@@ -2,6 +2,8 @@ package auth
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
 	"errors"
 	"net/http"
@@ -117,6 +119,35 @@ func TestAuthenticateRequestCloudAPIKey(t *testing.T) {
 	}
 }
 
+func TestAuthenticateRequestRotatedCloudAPIKeyExpires(t *testing.T) {
+	now := time.Unix(1000, 0)
+	svc := &Service{
+		Config: config.Default(),
+		Now:    func() time.Time { return now },
+		LookupCloudKey: func(ctx context.Context, keyHash string) (store.CloudAPIKey, error) {
+			return store.CloudAPIKey{
+				ID:        "key-1",
+				OrgID:     "org-2",
+				Scopes:    []string{"nerve:email.read"},
+				ExpiresAt: sql.NullTime{Time: time.Unix(2000, 0), Valid: true},
+			}, nil
+		},
+	}
+	req, err := http.NewRequest(http.MethodPost, "/mcp", nil)
+	if err != nil {
+		t.Fatalf("create request: %v", err)
+	}
+	req.Header.Set("X-Nerve-Cloud-Key", "nrv_live_test")
+
+	if _, err := svc.AuthenticateRequest(req); err != nil {
+		t.Fatalf("expected rotated key to work within its grace window: %v", err)
+	}
+	now = time.Unix(2000, 0)
+	if _, err := svc.AuthenticateRequest(req); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected rotated key to stop working after its grace window, got %v", err)
+	}
+}
+
 func TestAuthenticateRequestServiceJWTUsesStoreRecord(t *testing.T) {
 	cfg := config.Default()
 	cfg.Security.TokenSigningKey = testSigningKey
@@ -214,6 +245,73 @@ func TestValidateScopes(t *testing.T) {
 	}
 }
 
+func TestAuthenticateRequestJWTRejectsOtherDeployment(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.Issuer = "https://auth.nerve.email"
+	cfg.Auth.Audience = "nerve-runtime-eu"
+	cfg.Security.TokenSigningKey = testSigningKey
+	svc := &Service{Config: cfg, Now: func() time.Time { return time.Unix(1000, 0) }}
+
+	claims := jwt.MapClaims{"iss": "https://auth.nerve.email", "exp": 2000, "org_id": "org-1", "sub": "user-1"}
+	for name, aud := range map[string]any{"other deployment": "nerve-runtime-us", "no audience": nil} {
+		claims["aud"] = aud
+		if aud == nil {
+			delete(claims, "aud")
+		}
+		req, _ := http.NewRequest(http.MethodPost, "/mcp", nil)
+		req.Header.Set("Authorization", "Bearer "+signedJWT(t, claims))
+		if _, err := svc.AuthenticateRequest(req); !errors.Is(err, ErrUnauthorized) {
+			t.Fatalf("%s: expected unauthorized, got %v", name, err)
+		}
+	}
+
+	svc.Config.Auth.Audience = ""
+	svc.Config.Auth.RequireTokenClaims = true
+	claims["aud"] = "nerve-runtime-eu"
+	req, _ := http.NewRequest(http.MethodPost, "/mcp", nil)
+	req.Header.Set("Authorization", "Bearer "+signedJWT(t, claims))
+	if _, err := svc.AuthenticateRequest(req); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected unauthorized without a configured audience, got %v", err)
+	}
+}
+
+func TestAuthenticateRequestJWTCertBinding(t *testing.T) {
+	cfg := config.Default()
+	cfg.Security.TokenSigningKey = testSigningKey
+	svc := &Service{Config: cfg, Now: func() time.Time { return time.Unix(1000, 0) }}
+
+	bound := &x509.Certificate{Raw: []byte("client-cert-a")}
+	other := &x509.Certificate{Raw: []byte("client-cert-b")}
+	call := func(claims jwt.MapClaims, cert *x509.Certificate) error {
+		req, _ := http.NewRequest(http.MethodPost, "/mcp", nil)
+		req.Header.Set("Authorization", "Bearer "+signedJWT(t, claims))
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		_, err := svc.AuthenticateRequest(req)
+		return err
+	}
+	boundClaims := jwt.MapClaims{"exp": 2000, "org_id": "org-1", "cnf": map[string]any{"x5t#S256": CertThumbprint(bound)}}
+	if err := call(boundClaims, bound); err != nil {
+		t.Fatalf("expected bound token to pass with its certificate: %v", err)
+	}
+	if err := call(boundClaims, other); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected bound token to fail with another certificate, got %v", err)
+	}
+	if err := call(boundClaims, nil); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected bound token to fail without a certificate, got %v", err)
+	}
+
+	unbound := jwt.MapClaims{"exp": 2000, "org_id": "org-1"}
+	if err := call(unbound, nil); err != nil {
+		t.Fatalf("expected unbound token to pass by default: %v", err)
+	}
+	svc.Config.Auth.RequireCertBinding = true
+	if err := call(unbound, bound); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected unbound token to fail when binding is required, got %v", err)
+	}
+}
+
 func signedJWT(t *testing.T, claims jwt.MapClaims) string {
 	t.Helper()
 	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -223,3 +321,45 @@ func signedJWT(t *testing.T, claims jwt.MapClaims) string {
 	}
 	return signed
 }
+
+func TestAuthenticateRequestCarriesInboxAllowlist(t *testing.T) {
+	cfg := config.Default()
+	cfg.Security.TokenSigningKey = testSigningKey
+	svc := &Service{
+		Config: cfg,
+		Now:    func() time.Time { return time.Unix(1000, 0) },
+		LookupCloudKey: func(ctx context.Context, keyHash string) (store.CloudAPIKey, error) {
+			return store.CloudAPIKey{ID: "key-1", OrgID: "org-1", Scopes: []string{"nerve:email.read"}, InboxIDs: []string{"inbox-support"}}, nil
+		},
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/mcp", nil)
+	req.Header.Set("X-Nerve-Cloud-Key", "nrv_live_test")
+	principal, err := svc.AuthenticateRequest(req)
+	if err != nil {
+		t.Fatalf("authenticate key: %v", err)
+	}
+	if !principal.CanAccessInbox("inbox-support") || principal.CanAccessInbox("inbox-finance") {
+		t.Fatalf("expected key to be confined to its inbox, got %+v", principal)
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, "/mcp", nil)
+	req.Header.Set("Authorization", "Bearer "+signedJWT(t, jwt.MapClaims{
+		"exp":       2000,
+		"org_id":    "org-1",
+		"sub":       "agent",
+		"scope":     "nerve:email.read",
+		"inbox_ids": []string{"inbox-support"},
+	}))
+	principal, err = svc.AuthenticateRequest(req)
+	if err != nil {
+		t.Fatalf("authenticate jwt: %v", err)
+	}
+	if !principal.CanAccessInbox("inbox-support") || principal.CanAccessInbox("inbox-finance") {
+		t.Fatalf("expected token to be confined to its inbox, got %+v", principal)
+	}
+
+	if !(Principal{OrgID: "org-1"}).CanAccessInbox("inbox-finance") {
+		t.Fatalf("expected an unrestricted principal to reach every inbox")
+	}
+}
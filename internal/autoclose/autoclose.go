@@ -0,0 +1,150 @@
+// Package autoclose applies inboxes' inactivity rules. The worker runs it
+// periodically: threads that have gone quiet are closed, and where the inbox
+// asks for it, a customer we last wrote to is first asked whether they need
+// anything else. New inbound mail reopens a closed thread on ingest.
+package autoclose
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/notify"
+	"neuralmail/internal/outbox"
+	"neuralmail/internal/store"
+)
+
+// Closer works through the idle threads of a store. Nudges and closures are
+// published to the org's webhooks through Notify, if set.
+type Closer struct {
+	Config    config.Config
+	BatchSize int
+	Now       func() time.Time
+	Notify    *notify.Webhooks
+}
+
+func New(cfg config.Config) *Closer {
+	return &Closer{
+		Config:    cfg,
+		BatchSize: 100,
+		Now:       func() time.Time { return time.Now().UTC() },
+		Notify:    notify.NewWebhooks(),
+	}
+}
+
+// Result counts what a Run did.
+type Result struct {
+	Nudged int
+	Closed int
+}
+
+// Run nudges or closes every thread in st that is past its inbox's rule.
+// A nudged thread closes on a later run if the nudge goes unanswered; one
+// that cannot be nudged (no customer to write to, outbound not allowed, a
+// suppressed address or a mail loop) is closed straight away.
+func (c *Closer) Run(ctx context.Context, st *store.Store) (Result, error) {
+	var res Result
+	for {
+		idle, err := st.ListIdleThreads(ctx, c.Now(), c.BatchSize)
+		if err != nil {
+			return res, err
+		}
+		for _, t := range idle {
+			if t.Rule.Nudge && !t.Nudged() && t.LastDirection == "outbound" {
+				sent, err := c.nudge(ctx, st, t)
+				if err != nil {
+					return res, err
+				}
+				if sent {
+					res.Nudged++
+					c.publish(ctx, st, t, notify.EventThreadNudged)
+					continue
+				}
+			}
+			closed, err := st.AutoCloseThread(ctx, t.ID)
+			if err != nil {
+				return res, err
+			}
+			if closed {
+				res.Closed++
+				c.publish(ctx, st, t, notify.EventThreadAutoClosed)
+			}
+		}
+		if len(idle) < c.BatchSize {
+			return res, nil
+		}
+	}
+}
+
+// nudge queues the nudge reply on t, reporting false if it may not be sent.
+func (c *Closer) nudge(ctx context.Context, st *store.Store, t store.IdleThread) (bool, error) {
+	thread, messages, err := st.GetThread(ctx, t.ID)
+	if err != nil {
+		return false, err
+	}
+	if len(messages) == 0 || slices.Contains(thread.Labels, store.LabelLoop) {
+		return false, nil
+	}
+	var to string
+	for i := len(messages) - 1; i >= 0 && to == ""; i-- {
+		if messages[i].Direction == "inbound" {
+			to = messages[i].From.Email
+		}
+	}
+	if to == "" || outbox.CheckRecipient(c.Config, to) != nil {
+		return false, nil
+	}
+	suppressed, err := st.IsSuppressed(ctx, t.InboxID, to)
+	if err != nil || suppressed {
+		return false, err
+	}
+
+	from := outbox.FromAddress(c.Config)
+	subject := "Re: " + thread.Subject
+	if thread.Subject == "" {
+		subject = "Reply"
+	}
+	msg := store.Message{
+		InboxID:           t.InboxID,
+		ThreadID:          t.ID,
+		Direction:         "outbound",
+		Subject:           subject,
+		Text:              c.Config.AutoClose.NudgeText,
+		CreatedAt:         c.Now(),
+		InternetMessageID: outbox.NewMessageID(from),
+		From:              store.Participant{Email: from},
+		To:                []store.Participant{{Email: to}},
+	}
+	msg.InReplyTo, msg.References = outbox.ReplyHeaders(messages[len(messages)-1])
+	msgID, err := st.InsertMessage(ctx, msg)
+	if err != nil {
+		return false, err
+	}
+	if _, err := st.EnqueueOutbox(ctx, msgID, from, to, subject, msg.Text); err != nil {
+		return false, err
+	}
+	if err := st.MarkThreadNudged(ctx, t.ID, msg.CreatedAt); err != nil {
+		return false, err
+	}
+	slog.InfoContext(ctx, "autoclose nudged thread", "thread", t.ID, "idle_days", t.Rule.AfterDays)
+	return true, nil
+}
+
+// publish tells the thread's org about eventType. A failure is only logged:
+// the thread has already been nudged or closed.
+func (c *Closer) publish(ctx context.Context, st *store.Store, t store.IdleThread, eventType string) {
+	if c.Notify == nil || t.OrgID == "" {
+		return
+	}
+	_, err := c.Notify.Publish(ctx, st, t.OrgID, eventType, map[string]any{
+		"thread_id":       t.ID,
+		"inbox_id":        t.InboxID,
+		"last_message_at": t.LastMessageAt,
+		"after_days":      t.Rule.AfterDays,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "autoclose publish failed", "event_type", eventType, "thread", t.ID, "err", err)
+	}
+}
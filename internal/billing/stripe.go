@@ -8,8 +8,12 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"maps"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -18,16 +22,20 @@ import (
 	"neuralmail/internal/store"
 )
 
-// stripePriceID is the lookup_key-based price for the Pro plan.
-// Stripe resolves this via lookup_key when creating checkout sessions.
-const stripePriceID = "price_1SzW5LDPvkk7SvtZKJImtxzx"
-
 const stripeProvider = "stripe"
 
+const stripeAPIBase = "https://api.stripe.com"
+
+// stripeHTTPClient bounds every Stripe call, so a hung request cannot stall
+// the usage report loop or a checkout.
+var stripeHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
 type StripeService struct {
 	Config config.Config
 	Store  *store.Store
 	Now    func() time.Time
+	// APIBase is where usage records are sent; empty means Stripe's API.
+	APIBase string
 }
 
 func NewStripeService(cfg config.Config, st *store.Store) *StripeService {
@@ -57,10 +65,14 @@ type stripeCheckoutSession struct {
 type stripePrice struct {
 	ID        string `json:"id"`
 	LookupKey string `json:"lookup_key"`
+	Recurring struct {
+		AggregateUsage string `json:"aggregate_usage"`
+	} `json:"recurring"`
 }
 
 type stripeSubscriptionItem struct {
-	Price stripePrice `json:"price"`
+	Price    stripePrice `json:"price"`
+	Quantity int         `json:"quantity"`
 }
 
 type stripeSubscriptionItems struct {
@@ -168,11 +180,7 @@ func (s *StripeService) applySubscriptionSnapshot(ctx context.Context, sub strip
 	if err != nil {
 		return err
 	}
-	planCode := extractPlanCode(sub)
-	if planCode == "" {
-		return errors.New("subscription event missing plan code")
-	}
-	plan, err := s.Store.GetPlanEntitlement(ctx, planCode)
+	plan, addOns, err := s.subscriptionCatalog(ctx, sub)
 	if err != nil {
 		return err
 	}
@@ -201,8 +209,8 @@ func (s *StripeService) applySubscriptionSnapshot(ctx context.Context, sub strip
 		SubscriptionStatus: status,
 		MCPRPM:             plan.MCPRPM,
 		MonthlyUnits:       plan.MonthlyUnits,
-		MaxInboxes:         plan.MaxInboxes,
-		MaxDomains:         plan.MaxDomains,
+		MaxInboxes:         plan.MaxInboxes + addOns.inboxes,
+		MaxDomains:         plan.MaxDomains + addOns.domains,
 		UsagePeriodStart:   periodStart,
 		UsagePeriodEnd:     periodEnd,
 		GraceUntil:         graceUntilForStatus(status, periodEnd, s.Config.Metering.PastDueGraceDays),
@@ -210,9 +218,62 @@ func (s *StripeService) applySubscriptionSnapshot(ctx context.Context, sub strip
 	if err := s.Store.UpsertOrgEntitlement(ctx, ent); err != nil {
 		return err
 	}
+	if err := s.Store.ReplaceOrgAddOns(ctx, orgID, sub.ID, addOns.quantities); err != nil {
+		return err
+	}
 	return s.Store.EnsureOrgUsageCounter(ctx, orgID, "mcp_units", periodStart, periodEnd)
 }
 
+// subscriptionAddOns totals the add-ons on a subscription.
+type subscriptionAddOns struct {
+	quantities map[string]int
+	inboxes    int
+	domains    int
+}
+
+// subscriptionCatalog finds a subscription's plan and add-ons among its
+// items, each matched by price lookup key, or price ID when it has none. The
+// first item naming a plan's code or lookup key is the plan; items for
+// anything else, such as the metered overage price, are ignored.
+func (s *StripeService) subscriptionCatalog(ctx context.Context, sub stripeSubscription) (store.PlanEntitlement, subscriptionAddOns, error) {
+	addOns := subscriptionAddOns{quantities: map[string]int{}}
+	planCode := extractPlanCode(sub)
+	if planCode == "" {
+		return store.PlanEntitlement{}, addOns, errors.New("subscription event missing plan code")
+	}
+	plans, err := s.Store.ListPlanEntitlements(ctx)
+	if err != nil {
+		return store.PlanEntitlement{}, addOns, err
+	}
+	catalog, err := s.Store.ListPlanAddOns(ctx)
+	if err != nil {
+		return store.PlanEntitlement{}, addOns, err
+	}
+
+	var plan *store.PlanEntitlement
+	for _, item := range sub.Items.Data {
+		key := priceKey(item.Price)
+		if plan == nil {
+			if i := slices.IndexFunc(plans, func(p store.PlanEntitlement) bool { return key == p.PlanCode || key == p.LookupKey() }); i >= 0 {
+				plan = &plans[i]
+				continue
+			}
+		}
+		for _, a := range catalog {
+			if key == a.StripeLookupKey || key == a.Code {
+				quantity := max(item.Quantity, 1)
+				addOns.quantities[a.Code] += quantity
+				addOns.inboxes += a.ExtraInboxes * quantity
+				addOns.domains += a.ExtraDomains * quantity
+			}
+		}
+	}
+	if plan == nil {
+		return store.PlanEntitlement{}, addOns, fmt.Errorf("subscription plan %q is not in the catalog", planCode)
+	}
+	return *plan, addOns, nil
+}
+
 func (s *StripeService) applyInvoiceStatus(ctx context.Context, invoice stripeInvoice, mappedStatus string) error {
 	orgID, err := s.resolveOrgID(ctx, "", invoice.Customer, invoice.Subscription)
 	if err != nil {
@@ -240,7 +301,8 @@ func (s *StripeService) applyInvoiceStatus(ctx context.Context, invoice stripeIn
 
 func (s *StripeService) resolveOrgID(ctx context.Context, directOrgID, customerID, subscriptionID string) (string, error) {
 	if orgID := strings.TrimSpace(directOrgID); orgID != "" {
-		return orgID, nil
+		// Metadata set at checkout keeps naming an org after it is merged.
+		return s.Store.MergedOrgID(ctx, orgID)
 	}
 	if subscriptionID != "" {
 		orgID, err := s.Store.FindOrgByExternalSubscriptionID(ctx, subscriptionID)
@@ -316,7 +378,12 @@ func extractPlanCode(sub stripeSubscription) string {
 	if len(sub.Items.Data) == 0 {
 		return ""
 	}
-	price := sub.Items.Data[0].Price
+	return priceKey(sub.Items.Data[0].Price)
+}
+
+// priceKey is how a price is matched to the catalog: its lookup key, or its
+// ID when it has none.
+func priceKey(price stripePrice) string {
 	if strings.TrimSpace(price.LookupKey) != "" {
 		return strings.TrimSpace(price.LookupKey)
 	}
@@ -366,51 +433,53 @@ type CheckoutResult struct {
 	ClientReferenceID string `json:"client_reference_id"`
 }
 
-func (s *StripeService) CreateCheckoutSession(ctx context.Context, orgID, successURL, cancelURL string) (*CheckoutResult, error) {
-	sk := strings.TrimSpace(s.Config.Billing.StripeSecretKey)
-	if sk == "" {
-		return nil, errors.New("stripe secret key not configured")
-	}
-
-	form := "mode=subscription" +
-		"&client_reference_id=" + orgID +
-		"&line_items[0][price]=" + stripePriceID + "&line_items[0][quantity]=1" +
-		"&metadata[org_id]=" + orgID +
-		"&subscription_data[metadata][org_id]=" + orgID
+// CheckoutOrder is what a checkout session sells: a plan, and add-ons by
+// code with the quantity of each.
+type CheckoutOrder struct {
+	PlanCode string
+	AddOns   map[string]int
+}
 
-	if successURL != "" {
-		form += "&success_url=" + successURL
-	} else {
-		form += "&success_url=https://nerve.email/?checkout=success"
-	}
-	if cancelURL != "" {
-		form += "&cancel_url=" + cancelURL
-	} else {
-		form += "&cancel_url=https://nerve.email/?checkout=cancel"
+// CreateCheckoutSession starts a Stripe checkout for order. The session sells
+// the plan's price, its metered overage price if it has one, and each add-on.
+func (s *StripeService) CreateCheckoutSession(ctx context.Context, orgID string, order CheckoutOrder, successURL, cancelURL string) (*CheckoutResult, error) {
+	if strings.TrimSpace(s.Config.Billing.StripeSecretKey) == "" {
+		return nil, errors.New("stripe secret key not configured")
 	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.stripe.com/v1/checkout/sessions", strings.NewReader(form))
+	items, err := s.checkoutItems(ctx, order)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.SetBasicAuth(sk, "")
-
-	resp, err := http.DefaultClient.Do(req)
+	prices, err := s.resolvePrices(ctx, items)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != 200 {
-		return nil, errors.New("stripe checkout error: " + string(body))
+	if successURL == "" {
+		successURL = "https://nerve.email/?checkout=success"
+	}
+	if cancelURL == "" {
+		cancelURL = "https://nerve.email/?checkout=cancel"
+	}
+	form := url.Values{
+		"mode":                                {"subscription"},
+		"client_reference_id":                 {orgID},
+		"metadata[org_id]":                    {orgID},
+		"subscription_data[metadata][org_id]": {orgID},
+		"success_url":                         {successURL},
+		"cancel_url":                          {cancelURL},
+	}
+	for i, item := range items {
+		form.Set(fmt.Sprintf("line_items[%d][price]", i), prices[item.lookupKey])
+		if item.quantity > 0 {
+			form.Set(fmt.Sprintf("line_items[%d][quantity]", i), strconv.Itoa(item.quantity))
+		}
 	}
 
 	var session struct {
 		URL string `json:"url"`
 	}
-	if err := json.Unmarshal(body, &session); err != nil {
+	if err := s.stripeRequest(ctx, http.MethodPost, "/v1/checkout/sessions", form, "", &session); err != nil {
 		return nil, err
 	}
 	return &CheckoutResult{
@@ -419,6 +488,81 @@ func (s *StripeService) CreateCheckoutSession(ctx context.Context, orgID, succes
 	}, nil
 }
 
+// checkoutItem is a checkout line item by price lookup key. Metered prices
+// take no quantity.
+type checkoutItem struct {
+	lookupKey string
+	quantity  int
+}
+
+func (s *StripeService) checkoutItems(ctx context.Context, order CheckoutOrder) ([]checkoutItem, error) {
+	plan, err := s.Store.GetPlanEntitlement(ctx, order.PlanCode)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("unknown plan %q", order.PlanCode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	items := []checkoutItem{{lookupKey: plan.LookupKey(), quantity: 1}}
+	overage := plan.OverageLookupKey
+	if overage == "" {
+		overage = strings.TrimSpace(s.Config.Billing.StripeMeteredPrice)
+	}
+	if overage != "" {
+		items = append(items, checkoutItem{lookupKey: overage})
+	}
+	if len(order.AddOns) == 0 {
+		return items, nil
+	}
+
+	catalog, err := s.Store.ListPlanAddOns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range slices.Sorted(maps.Keys(order.AddOns)) {
+		i := slices.IndexFunc(catalog, func(a store.PlanAddOn) bool { return a.Code == code })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown add-on %q", code)
+		}
+		if quantity := order.AddOns[code]; quantity > 0 {
+			items = append(items, checkoutItem{lookupKey: catalog[i].StripeLookupKey, quantity: quantity})
+		}
+	}
+	return items, nil
+}
+
+// resolvePrices maps the items' lookup keys to Stripe price IDs. Keys that
+// are already price IDs map to themselves.
+func (s *StripeService) resolvePrices(ctx context.Context, items []checkoutItem) (map[string]string, error) {
+	prices := map[string]string{}
+	query := url.Values{"active": {"true"}}
+	for _, item := range items {
+		if strings.HasPrefix(item.lookupKey, "price_") {
+			prices[item.lookupKey] = item.lookupKey
+		} else {
+			query.Add("lookup_keys[]", item.lookupKey)
+		}
+	}
+	if len(query["lookup_keys[]"]) == 0 {
+		return prices, nil
+	}
+	var list struct {
+		Data []stripePrice `json:"data"`
+	}
+	if err := s.stripeRequest(ctx, http.MethodGet, "/v1/prices?"+query.Encode(), nil, "", &list); err != nil {
+		return nil, err
+	}
+	for _, price := range list.Data {
+		prices[price.LookupKey] = price.ID
+	}
+	for _, key := range query["lookup_keys[]"] {
+		if prices[key] == "" {
+			return nil, fmt.Errorf("no active stripe price with lookup key %q", key)
+		}
+	}
+	return prices, nil
+}
+
 type PortalResult struct {
 	URL string `json:"url"`
 }
@@ -445,7 +589,7 @@ func (s *StripeService) CreateBillingPortalSession(ctx context.Context, orgID st
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.SetBasicAuth(sk, "")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := stripeHTTPClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -465,6 +609,41 @@ func (s *StripeService) CreateBillingPortalSession(ctx context.Context, orgID st
 	return &PortalResult{URL: session.URL}, nil
 }
 
+// stripeRequest calls Stripe's API at APIBase, form-encoding form if set,
+// and decodes a 200 response into out.
+func (s *StripeService) stripeRequest(ctx context.Context, method string, path string, form url.Values, idempotencyKey string, out any) error {
+	base := s.APIBase
+	if base == "" {
+		base = stripeAPIBase
+	}
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(base, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	req.SetBasicAuth(strings.TrimSpace(s.Config.Billing.StripeSecretKey), "")
+
+	resp, err := stripeHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("stripe %s %s: %d %s", method, strings.SplitN(path, "?", 2)[0], resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return json.Unmarshal(data, out)
+}
+
 func sha256Hex(payload []byte) string {
 	sum := sha256.Sum256(payload)
 	return hex.EncodeToString(sum[:])
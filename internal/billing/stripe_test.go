@@ -7,11 +7,14 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -224,6 +227,283 @@ func TestFailedWebhookStoredAndCanBeReprocessed(t *testing.T) {
 	})
 }
 
+func TestReportUsagePushesOverageOnceWithRetries(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		orgID := uuid.NewString()
+		insertPlan(t, ctx, st, "pro", 120, 1000, 10)
+		insertOrg(t, ctx, st, orgID)
+		prepareInvoiceMapping(t, ctx, st, orgID)
+		periodStart := time.Unix(1_700_000_000, 0).UTC()
+		if err := st.EnsureOrgUsageCounter(ctx, orgID, "mcp_units", periodStart, time.Unix(1_702_592_000, 0).UTC()); err != nil {
+			t.Fatalf("ensure counter: %v", err)
+		}
+		if err := st.SetOrgUsageCounterUsed(ctx, orgID, "mcp_units", periodStart, 1200); err != nil {
+			t.Fatalf("set counter: %v", err)
+		}
+
+		type usageRecord struct{ quantity, action, key string }
+		var (
+			mu      sync.Mutex
+			records []usageRecord
+			fail    = true
+		)
+		stripe := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodGet && r.URL.Path == "/v1/subscription_items":
+				if r.URL.Query().Get("subscription") != "sub_1" {
+					t.Errorf("items for subscription %q", r.URL.Query().Get("subscription"))
+				}
+				_, _ = w.Write([]byte(`{"data":[
+					{"id":"si_base","price":{"id":"price_pro","lookup_key":"pro"}},
+					{"id":"si_metered","price":{"id":"price_units","lookup_key":"mcp_overage"}}
+				]}`))
+			case r.Method == http.MethodPost && r.URL.Path == "/v1/subscription_items/si_metered/usage_records":
+				_ = r.ParseForm()
+				mu.Lock()
+				defer mu.Unlock()
+				records = append(records, usageRecord{r.PostForm.Get("quantity"), r.PostForm.Get("action"), r.Header.Get("Idempotency-Key")})
+				if fail {
+					fail = false
+					http.Error(w, `{"error":{"message":"try later"}}`, http.StatusServiceUnavailable)
+					return
+				}
+				_, _ = w.Write([]byte(fmt.Sprintf(`{"id":"mbur_%d"}`, len(records))))
+			default:
+				t.Errorf("unexpected stripe call %s %s", r.Method, r.URL.Path)
+				http.NotFound(w, r)
+			}
+		}))
+		defer stripe.Close()
+
+		cfg := config.Default()
+		cfg.Billing.StripeSecretKey = "sk_test"
+		cfg.Billing.StripeMeteredPrice = "mcp_overage"
+		svc := NewStripeService(cfg, st)
+		svc.APIBase = stripe.URL
+		now := time.Unix(1_700_100_000, 0).UTC()
+		svc.Now = func() time.Time { return now }
+
+		run := func(want UsageReportResult) {
+			t.Helper()
+			res, err := svc.ReportUsage(ctx)
+			if err != nil {
+				t.Fatalf("report usage: %v", err)
+			}
+			if res != want {
+				t.Fatalf("report usage = %+v, want %+v", res, want)
+			}
+		}
+
+		run(UsageReportResult{Failed: 1})
+		run(UsageReportResult{Unchanged: 1})
+		now = now.Add(5 * time.Minute)
+		run(UsageReportResult{Reported: 1})
+		run(UsageReportResult{Unchanged: 1})
+
+		if len(records) != 2 || records[0] != records[1] {
+			t.Fatalf("expected one retried record, got %+v", records)
+		}
+		if records[0].quantity != "200" || records[0].action != "set" || records[0].key == "" {
+			t.Fatalf("unexpected record %+v", records[0])
+		}
+
+		if err := st.SetOrgUsageCounterUsed(ctx, orgID, "mcp_units", periodStart, 1300); err != nil {
+			t.Fatalf("set counter: %v", err)
+		}
+		run(UsageReportResult{Reported: 1})
+		if len(records) != 3 || records[2].quantity != "300" || records[2].key == records[0].key {
+			t.Fatalf("expected a new total under a new key, got %+v", records)
+		}
+
+		report, err := st.GetLatestBillingUsageReport(ctx, orgID, "mcp_units", periodStart)
+		if err != nil {
+			t.Fatalf("latest report: %v", err)
+		}
+		if report.Status != "reported" || report.Quantity != 300 || report.SubscriptionItemID != "si_metered" || report.UsageRecordID != "mbur_3" {
+			t.Fatalf("unexpected report %+v", report)
+		}
+	})
+}
+
+func TestCheckMeteredPricesRequiresLastDuringPeriod(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		insertPlan(t, ctx, st, "pro", 120, 1000, 10)
+		if _, err := st.DB().ExecContext(ctx, `UPDATE plan_entitlements SET overage_lookup_key = 'price_pro_units' WHERE plan_code = 'pro'`); err != nil {
+			t.Fatalf("set overage price: %v", err)
+		}
+		aggregates := map[string]string{"price_pro_units": "last_during_period", "price_units": "last_during_period"}
+		stripe := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == "/v1/prices" && r.URL.Query().Get("lookup_keys[]") == "mcp_overage":
+				_, _ = w.Write([]byte(fmt.Sprintf(`{"data":[{"id":"price_units","lookup_key":"mcp_overage","recurring":{"aggregate_usage":%q}}]}`, aggregates["price_units"])))
+			case r.URL.Path == "/v1/prices/price_pro_units":
+				_, _ = w.Write([]byte(fmt.Sprintf(`{"id":"price_pro_units","recurring":{"aggregate_usage":%q}}`, aggregates["price_pro_units"])))
+			default:
+				_, _ = w.Write([]byte(`{"data":[]}`))
+			}
+		}))
+		defer stripe.Close()
+
+		cfg := config.Default()
+		cfg.Billing.StripeSecretKey = "sk_test"
+		cfg.Billing.StripeMeteredPrice = "mcp_overage"
+		svc := NewStripeService(cfg, st)
+		svc.APIBase = stripe.URL
+
+		if err := svc.CheckMeteredPrices(ctx); err != nil {
+			t.Fatalf("expected last_during_period prices accepted, got %v", err)
+		}
+		aggregates["price_pro_units"] = "sum"
+		if err := svc.CheckMeteredPrices(ctx); err == nil || !strings.Contains(err.Error(), "price_pro_units") {
+			t.Fatalf("expected the plan's summing price refused, got %v", err)
+		}
+		aggregates["price_pro_units"] = "last_during_period"
+		svc.Config.Billing.StripeMeteredPrice = "missing"
+		if err := svc.CheckMeteredPrices(ctx); err == nil || !strings.Contains(err.Error(), `"missing"`) {
+			t.Fatalf("expected an unknown lookup key refused, got %v", err)
+		}
+	})
+}
+
+func TestSubscriptionAddOnsStackOnPlanLimits(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		orgID := uuid.NewString()
+		insertPlan(t, ctx, st, "team", 300, 10000, 5)
+		insertOrg(t, ctx, st, orgID)
+		if _, err := st.DB().ExecContext(ctx, `
+			UPDATE plan_entitlements SET stripe_lookup_key = 'team_monthly', max_domains = 2 WHERE plan_code = 'team';
+			INSERT INTO plan_addons (code, stripe_lookup_key, extra_inboxes, extra_domains)
+			VALUES ('extra_inbox', 'addon_inbox', 1, 0), ('extra_domain', 'addon_domain', 0, 1);
+		`); err != nil {
+			t.Fatalf("set up catalog: %v", err)
+		}
+
+		cfg := config.Default()
+		cfg.Billing.StripeWebhookSecret = "whsec_test"
+		svc := NewStripeService(cfg, st)
+		svc.Now = func() time.Time { return time.Unix(1_700_000_000, 0).UTC() }
+
+		send := func(eventID string, items string) {
+			t.Helper()
+			payload := []byte(fmt.Sprintf(`{
+				"id":%q,
+				"type":"customer.subscription.updated",
+				"data":{"object":{
+					"id":"sub_team",
+					"customer":"cus_team",
+					"status":"active",
+					"current_period_start":1700000000,
+					"current_period_end":1702592000,
+					"metadata":{"org_id":%q},
+					"items":{"data":[%s]}
+				}}
+			}`, eventID, orgID, items))
+			header := stripeSignatureHeader(cfg.Billing.StripeWebhookSecret, svc.Now().Unix(), payload)
+			if err := svc.ProcessWebhook(ctx, payload, header); err != nil {
+				t.Fatalf("process %s: %v", eventID, err)
+			}
+		}
+
+		send("evt_addons", `
+			{"price":{"lookup_key":"team_monthly","id":"price_team"},"quantity":1},
+			{"price":{"lookup_key":"mcp_overage","id":"price_units"}},
+			{"price":{"lookup_key":"addon_inbox","id":"price_inbox"},"quantity":3},
+			{"price":{"lookup_key":"addon_domain","id":"price_domain"},"quantity":1}`)
+		ent, err := st.GetOrgEntitlement(ctx, orgID)
+		if err != nil {
+			t.Fatalf("get entitlement: %v", err)
+		}
+		if ent.PlanCode != "team" || ent.MaxInboxes != 8 || ent.MaxDomains != 3 {
+			t.Fatalf("expected team limits plus add-ons, got %+v", ent)
+		}
+		addOns, err := st.ListOrgAddOns(ctx, orgID)
+		if err != nil {
+			t.Fatalf("list add-ons: %v", err)
+		}
+		if len(addOns) != 2 || addOns[0].Code != "extra_domain" || addOns[1].Quantity != 3 {
+			t.Fatalf("unexpected org add-ons %+v", addOns)
+		}
+
+		send("evt_addons_removed", `{"price":{"lookup_key":"team_monthly","id":"price_team"},"quantity":1}`)
+		ent, err = st.GetOrgEntitlement(ctx, orgID)
+		if err != nil {
+			t.Fatalf("get entitlement: %v", err)
+		}
+		if ent.MaxInboxes != 5 || ent.MaxDomains != 2 {
+			t.Fatalf("expected plan limits once add-ons are removed, got %+v", ent)
+		}
+		if addOns, _ := st.ListOrgAddOns(ctx, orgID); len(addOns) != 0 {
+			t.Fatalf("expected add-ons cleared, got %+v", addOns)
+		}
+	})
+}
+
+func TestCheckoutSellsPlanOverageAndAddOns(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		insertPlan(t, ctx, st, "team", 300, 10000, 5)
+		if _, err := st.DB().ExecContext(ctx, `
+			UPDATE plan_entitlements SET stripe_lookup_key = 'team_monthly', overage_lookup_key = 'team_overage' WHERE plan_code = 'team';
+			INSERT INTO plan_addons (code, stripe_lookup_key, extra_inboxes) VALUES ('extra_inbox', 'addon_inbox', 1);
+		`); err != nil {
+			t.Fatalf("set up catalog: %v", err)
+		}
+
+		var form url.Values
+		stripe := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v1/prices":
+				keys := r.URL.Query()["lookup_keys[]"]
+				if len(keys) != 3 {
+					t.Errorf("expected three lookup keys, got %v", keys)
+				}
+				_, _ = w.Write([]byte(`{"data":[
+					{"id":"price_team","lookup_key":"team_monthly"},
+					{"id":"price_overage","lookup_key":"team_overage"},
+					{"id":"price_inbox","lookup_key":"addon_inbox"}
+				]}`))
+			case "/v1/checkout/sessions":
+				_ = r.ParseForm()
+				form = r.PostForm
+				_, _ = w.Write([]byte(`{"url":"https://checkout.stripe.test/session"}`))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer stripe.Close()
+
+		cfg := config.Default()
+		cfg.Billing.StripeSecretKey = "sk_test"
+		svc := NewStripeService(cfg, st)
+		svc.APIBase = stripe.URL
+
+		orgID := uuid.NewString()
+		res, err := svc.CreateCheckoutSession(ctx, orgID, CheckoutOrder{PlanCode: "team", AddOns: map[string]int{"extra_inbox": 2}}, "", "")
+		if err != nil {
+			t.Fatalf("create checkout: %v", err)
+		}
+		if res.CheckoutURL != "https://checkout.stripe.test/session" || form.Get("client_reference_id") != orgID {
+			t.Fatalf("unexpected checkout %+v form=%v", res, form)
+		}
+		want := map[string]string{
+			"line_items[0][price]":    "price_team",
+			"line_items[0][quantity]": "1",
+			"line_items[1][price]":    "price_overage",
+			"line_items[1][quantity]": "",
+			"line_items[2][price]":    "price_inbox",
+			"line_items[2][quantity]": "2",
+		}
+		for key, value := range want {
+			if got := form.Get(key); got != value {
+				t.Fatalf("%s = %q, want %q", key, got, value)
+			}
+		}
+
+		if _, err := svc.CreateCheckoutSession(ctx, orgID, CheckoutOrder{PlanCode: "team", AddOns: map[string]int{"extra_seat": 1}}, "", ""); err == nil {
+			t.Fatal("expected an unknown add-on to fail")
+		}
+	})
+}
+
 func prepareInvoiceMapping(t *testing.T, ctx context.Context, st *store.Store, orgID string) {
 	t.Helper()
 	if err := st.UpsertSubscription(ctx, store.SubscriptionRecord{
@@ -0,0 +1,253 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"neuralmail/internal/store"
+)
+
+const (
+	// meteredMeter is the meter billed through the metered price.
+	meteredMeter = "mcp_units"
+
+	// usageReportGrace is how long after a period ends its final total is
+	// still reported: Stripe takes usage for a period until its invoice is
+	// finalized, about an hour after it closes.
+	usageReportGrace = 24 * time.Hour
+
+	// maxUsageReportAttempts stops retrying a total Stripe keeps refusing.
+	maxUsageReportAttempts = 8
+)
+
+// UsageReportResult counts what ReportUsage did.
+type UsageReportResult struct {
+	Reported  int
+	Unchanged int
+	Failed    int
+}
+
+// ReportUsage pushes each subscribed org's mcp_units overage, the units used
+// beyond its plan's monthly units, to Stripe as a usage record on the
+// subscription's metered price item: the plan's overage price, or the
+// configured default for plans without one. Records use action=set, so each
+// one carries the period's total, which only bills right on a price that
+// aggregates usage with last_during_period; CheckMeteredPrices verifies that.
+// A total is sent once, and retried with backoff under the same idempotency
+// key until Stripe accepts it. Only store errors are returned; Stripe errors
+// are recorded on the report and counted.
+func (s *StripeService) ReportUsage(ctx context.Context) (UsageReportResult, error) {
+	var res UsageReportResult
+	if s == nil || s.Store == nil {
+		return res, errors.New("stripe service not configured")
+	}
+	if strings.TrimSpace(s.Config.Billing.StripeSecretKey) == "" {
+		return res, errors.New("stripe secret key not configured")
+	}
+
+	now := s.Now()
+	usage, err := s.Store.ListBillableUsage(ctx, stripeProvider, meteredMeter, now.Add(-usageReportGrace))
+	if err != nil {
+		return res, err
+	}
+	items := map[string]string{}
+	for _, u := range usage {
+		price := u.OverageLookupKey
+		if price == "" {
+			price = strings.TrimSpace(s.Config.Billing.StripeMeteredPrice)
+		}
+		if price == "" {
+			continue
+		}
+		report, due, err := s.pendingUsageReport(ctx, u, now)
+		if err != nil {
+			return res, err
+		}
+		if !due {
+			res.Unchanged++
+			continue
+		}
+
+		itemKey := u.ExternalSubscriptionID + " " + price
+		itemID, ok := items[itemKey]
+		if !ok {
+			itemID, err = s.meteredItem(ctx, u.ExternalSubscriptionID, price)
+			if err == nil {
+				items[itemKey] = itemID
+			}
+		}
+		var recordID string
+		if err == nil {
+			recordID, err = s.createUsageRecord(ctx, itemID, report, usageTimestamp(u, now))
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "billing usage report failed", "org_id", u.OrgID, "period", u.PeriodStart.Format(time.RFC3339), "quantity", report.Quantity, "err", err)
+			next := now.Add(usageRetryBackoff(report.Attempts))
+			if err := s.Store.MarkBillingUsageFailed(ctx, report.ID, err.Error(), next); err != nil {
+				return res, err
+			}
+			res.Failed++
+			continue
+		}
+		if err := s.Store.MarkBillingUsageReported(ctx, report.ID, itemID, recordID); err != nil {
+			return res, err
+		}
+		res.Reported++
+	}
+	return res, nil
+}
+
+// CheckMeteredPrices verifies that every price ReportUsage may report to,
+// the configured default and each plan's overage price, aggregates usage
+// with last_during_period. Each record carries the period's running total at
+// a new timestamp, so Stripe's default sum would bill every intermediate
+// total.
+func (s *StripeService) CheckMeteredPrices(ctx context.Context) error {
+	if s == nil || s.Store == nil {
+		return errors.New("stripe service not configured")
+	}
+	if strings.TrimSpace(s.Config.Billing.StripeSecretKey) == "" {
+		return errors.New("stripe secret key not configured")
+	}
+	plans, err := s.Store.ListPlanEntitlements(ctx)
+	if err != nil {
+		return err
+	}
+	keys := []string{strings.TrimSpace(s.Config.Billing.StripeMeteredPrice)}
+	for _, plan := range plans {
+		keys = append(keys, plan.OverageLookupKey)
+	}
+	checked := map[string]bool{"": true}
+	for _, key := range keys {
+		if checked[key] {
+			continue
+		}
+		checked[key] = true
+		price, err := s.meteredPrice(ctx, key)
+		if err != nil {
+			return err
+		}
+		if aggregate := price.Recurring.AggregateUsage; aggregate != "last_during_period" {
+			return fmt.Errorf("metered price %s aggregates usage with %q; usage is reported as running totals and needs last_during_period", key, aggregate)
+		}
+	}
+	return nil
+}
+
+// meteredPrice fetches a price by ID or lookup key.
+func (s *StripeService) meteredPrice(ctx context.Context, key string) (stripePrice, error) {
+	var price stripePrice
+	if strings.HasPrefix(key, "price_") {
+		err := s.stripeRequest(ctx, http.MethodGet, "/v1/prices/"+url.PathEscape(key), nil, "", &price)
+		return price, err
+	}
+	var list struct {
+		Data []stripePrice `json:"data"`
+	}
+	query := url.Values{"active": {"true"}, "lookup_keys[]": {key}}
+	if err := s.stripeRequest(ctx, http.MethodGet, "/v1/prices?"+query.Encode(), nil, "", &list); err != nil {
+		return price, err
+	}
+	if len(list.Data) == 0 {
+		return price, fmt.Errorf("no active stripe price with lookup key %q", key)
+	}
+	return list.Data[0], nil
+}
+
+// pendingUsageReport returns the report to send for u's current overage,
+// recording a new one when the total changed, or false if there is nothing
+// to send yet.
+func (s *StripeService) pendingUsageReport(ctx context.Context, u store.BillableUsage, now time.Time) (store.BillingUsageReport, bool, error) {
+	quantity := u.Overage()
+	latest, err := s.Store.GetLatestBillingUsageReport(ctx, u.OrgID, u.MeterName, u.PeriodStart)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if quantity == 0 {
+			return store.BillingUsageReport{}, false, nil
+		}
+	case err != nil:
+		return store.BillingUsageReport{}, false, err
+	case latest.Quantity == quantity:
+		due := latest.Status != "reported" && latest.Attempts < maxUsageReportAttempts && !latest.NextAttemptAt.After(now)
+		return latest, due, nil
+	}
+	report, err := s.Store.InsertBillingUsageReport(ctx, store.BillingUsageReport{
+		OrgID:          u.OrgID,
+		MeterName:      u.MeterName,
+		PeriodStart:    u.PeriodStart,
+		PeriodEnd:      u.PeriodEnd,
+		Quantity:       quantity,
+		IdempotencyKey: "nerve-usage-" + uuid.NewString(),
+	})
+	return report, err == nil, err
+}
+
+// usageTimestamp places a record inside u's period, which Stripe requires.
+func usageTimestamp(u store.BillableUsage, now time.Time) time.Time {
+	if last := u.PeriodEnd.Add(-time.Second); now.After(last) {
+		return last
+	}
+	if now.Before(u.PeriodStart) {
+		return u.PeriodStart
+	}
+	return now
+}
+
+// usageRetryBackoff doubles from a minute after each failed attempt, up to
+// six hours.
+func usageRetryBackoff(attempts int) time.Duration {
+	backoff := time.Minute
+	for i := 0; i < attempts && backoff < 6*time.Hour; i++ {
+		backoff *= 2
+	}
+	return min(backoff, 6*time.Hour)
+}
+
+// meteredItem finds the subscription's item for a metered price, matched by
+// price ID or lookup key.
+func (s *StripeService) meteredItem(ctx context.Context, subscriptionID string, price string) (string, error) {
+	var list struct {
+		Data []struct {
+			ID    string      `json:"id"`
+			Price stripePrice `json:"price"`
+		} `json:"data"`
+	}
+	query := url.Values{"subscription": {subscriptionID}, "limit": {"100"}}
+	if err := s.stripeRequest(ctx, http.MethodGet, "/v1/subscription_items?"+query.Encode(), nil, "", &list); err != nil {
+		return "", err
+	}
+	for _, item := range list.Data {
+		if item.Price.ID == price || item.Price.LookupKey == price {
+			return item.ID, nil
+		}
+	}
+	return "", fmt.Errorf("subscription %s has no item for metered price %s", subscriptionID, price)
+}
+
+// createUsageRecord sets the item's usage for the period to the report's
+// quantity and returns the record's ID.
+func (s *StripeService) createUsageRecord(ctx context.Context, itemID string, report store.BillingUsageReport, at time.Time) (string, error) {
+	form := url.Values{
+		"quantity":  {strconv.FormatInt(report.Quantity, 10)},
+		"timestamp": {strconv.FormatInt(at.Unix(), 10)},
+		"action":    {"set"},
+	}
+	var record struct {
+		ID string `json:"id"`
+	}
+	path := "/v1/subscription_items/" + url.PathEscape(itemID) + "/usage_records"
+	if err := s.stripeRequest(ctx, http.MethodPost, path, form, report.IdempotencyKey, &record); err != nil {
+		return "", err
+	}
+	return record.ID, nil
+}
@@ -0,0 +1,104 @@
+// Package canary decides which tool-service build serves an org's tool calls
+// and extracts the outcome signals used to compare the two builds.
+package canary
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+
+	"neuralmail/internal/config"
+)
+
+const (
+	Stable = "stable"
+	Canary = "canary"
+
+	// FlagName is the org feature flag that pins an org to the canary (true)
+	// or to stable (false), overriding the percentage rollout.
+	FlagName = "tools_canary"
+)
+
+// FlagSource looks up per-org feature flags; *store.Store satisfies it.
+type FlagSource interface {
+	GetOrgFeatureFlag(ctx context.Context, orgID string, flag string) (enabled bool, found bool, err error)
+}
+
+type Router struct {
+	enabled bool
+	percent int
+	tools   map[string]bool
+	flags   FlagSource
+}
+
+func NewRouter(cfg config.Config, flags FlagSource) *Router {
+	tools := make(map[string]bool, len(cfg.Canary.Tools))
+	for _, name := range cfg.Canary.Tools {
+		if name = strings.TrimSpace(name); name != "" {
+			tools[name] = true
+		}
+	}
+	percent := cfg.Canary.Percent
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	return &Router{enabled: cfg.Canary.Enabled, percent: percent, tools: tools, flags: flags}
+}
+
+// Covers reports whether calls to tool take part in the rollout at all.
+func (r *Router) Covers(tool string) bool {
+	return r != nil && r.enabled && r.tools[tool]
+}
+
+// Variant picks the build for an org's call to tool. An explicit org flag
+// wins; otherwise orgs are bucketed deterministically so a given org stays on
+// the same side as the percentage grows. Flag lookup errors fall back to
+// stable.
+func (r *Router) Variant(ctx context.Context, orgID string, tool string) string {
+	if !r.Covers(tool) {
+		return Stable
+	}
+	if r.flags != nil && orgID != "" {
+		enabled, found, err := r.flags.GetOrgFeatureFlag(ctx, orgID, FlagName)
+		if err != nil {
+			return Stable
+		}
+		if found {
+			if enabled {
+				return Canary
+			}
+			return Stable
+		}
+	}
+	if Bucket(orgID) < r.percent {
+		return Canary
+	}
+	return Stable
+}
+
+// Bucket maps an org to a stable value in [0, 100).
+func Bucket(orgID string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(FlagName + ":" + orgID))
+	return int(h.Sum32() % 100)
+}
+
+// Outcome holds the policy signals compared between variants.
+type Outcome struct {
+	PolicyBlocked bool
+	NeedsApproval bool
+}
+
+// OutcomeFromResult reads the policy fields tools put in their result maps.
+func OutcomeFromResult(result any) Outcome {
+	data, ok := result.(map[string]any)
+	if !ok {
+		return Outcome{}
+	}
+	blocked, _ := data["policy_blocked"].(bool)
+	approval, _ := data["needs_human_approval"].(bool)
+	return Outcome{PolicyBlocked: blocked, NeedsApproval: approval}
+}
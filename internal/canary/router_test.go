@@ -0,0 +1,72 @@
+package canary
+
+import (
+	"context"
+	"testing"
+
+	"neuralmail/internal/config"
+)
+
+type fakeFlags map[string]bool
+
+func (f fakeFlags) GetOrgFeatureFlag(ctx context.Context, orgID string, flag string) (bool, bool, error) {
+	enabled, ok := f[orgID]
+	return enabled, ok, nil
+}
+
+func canaryConfig(percent int) config.Config {
+	cfg := config.Default()
+	cfg.Canary.Enabled = true
+	cfg.Canary.Percent = percent
+	cfg.Canary.Tools = []string{"draft_reply_with_policy"}
+	return cfg
+}
+
+func TestVariantHonoursFlagsOverPercentage(t *testing.T) {
+	router := NewRouter(canaryConfig(0), fakeFlags{"org-in": true, "org-out": false})
+	ctx := context.Background()
+
+	if got := router.Variant(ctx, "org-in", "draft_reply_with_policy"); got != Canary {
+		t.Fatalf("expected flagged org on canary, got %s", got)
+	}
+	if got := router.Variant(ctx, "org-out", "draft_reply_with_policy"); got != Stable {
+		t.Fatalf("expected opted-out org on stable, got %s", got)
+	}
+	if got := router.Variant(ctx, "org-in", "send_reply"); got != Stable {
+		t.Fatalf("expected uncovered tool on stable, got %s", got)
+	}
+}
+
+func TestVariantPercentageRollout(t *testing.T) {
+	ctx := context.Background()
+	all := NewRouter(canaryConfig(100), nil)
+	none := NewRouter(canaryConfig(0), nil)
+	for _, org := range []string{"a", "b", "c", "d"} {
+		if all.Variant(ctx, org, "draft_reply_with_policy") != Canary {
+			t.Fatalf("expected 100%% rollout to route %s to canary", org)
+		}
+		if none.Variant(ctx, org, "draft_reply_with_policy") != Stable {
+			t.Fatalf("expected 0%% rollout to keep %s on stable", org)
+		}
+	}
+
+	half := NewRouter(canaryConfig(50), nil)
+	org := "org-under-test"
+	want := Stable
+	if Bucket(org) < 50 {
+		want = Canary
+	}
+	for i := 0; i < 3; i++ {
+		if got := half.Variant(ctx, org, "draft_reply_with_policy"); got != want {
+			t.Fatalf("expected sticky assignment %s, got %s", want, got)
+		}
+	}
+}
+
+func TestVariantDisabled(t *testing.T) {
+	cfg := canaryConfig(100)
+	cfg.Canary.Enabled = false
+	if got := NewRouter(cfg, fakeFlags{"org": true}).Variant(context.Background(), "org", "draft_reply_with_policy"); got != Stable {
+		t.Fatalf("expected disabled canary to route to stable, got %s", got)
+	}
+}
@@ -0,0 +1,118 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"neuralmail/internal/auth"
+)
+
+// requirePlatformAdmin only admits the bootstrap key. Admin endpoints read
+// across every org, so org-scoped billing admins are not enough.
+func (h *Handler) requirePlatformAdmin(r *http.Request) (auth.Principal, error) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	if principal.AuthMethod != "bootstrap_key" {
+		return auth.Principal{}, auth.ErrForbidden
+	}
+	return principal, nil
+}
+
+func (h *Handler) handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if _, err := h.requirePlatformAdmin(r); err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	stats, err := h.Store.GetPlatformStats(r.Context(), time.Now().UTC())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := map[string]any{
+		"orgs":                stats.Orgs,
+		"inboxes":             stats.Inboxes,
+		"usage_events_24h":    stats.UsageEvents24h,
+		"failed_usage_24h":    stats.FailedUsage24h,
+		"webhooks_failed_24h": stats.WebhooksFailed24h,
+		"reconciliation":      nil,
+	}
+
+	loops, err := h.Store.GetMailLoopStats(r.Context(), time.Now().UTC().Add(-24*time.Hour))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp["mail_loops"] = map[string]any{
+		"automated_inbound_24h":   loops.AutomatedInbound,
+		"looping_threads":         loops.LoopingThreads,
+		"suppressed_auto_replies": loops.SuppressedReplies,
+	}
+
+	closures, err := h.Store.GetThreadClosureStats(r.Context(), "", time.Now().UTC().AddDate(0, 0, -30))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp["thread_closures_30d"] = map[string]any{
+		"closed":           closures.Closed,
+		"reopen_rate":      closures.ReopenRate(),
+		"auto_closed":      closures.AutoClosed,
+		"auto_reopen_rate": closures.AutoReopenRate(),
+	}
+
+	models, err := h.Store.ListModelStats(r.Context(), time.Now().UTC().AddDate(0, 0, -7))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	modelStats := make([]map[string]any, 0, len(models))
+	for _, m := range models {
+		modelStats = append(modelStats, map[string]any{
+			"model":             m.Model,
+			"task":              m.Task,
+			"tool_calls":        m.ToolCalls,
+			"model_calls":       m.ModelCalls,
+			"fallbacks":         m.Fallbacks,
+			"errors":            m.Errors,
+			"tokens":            m.Tokens,
+			"cost_usd":          m.CostUSD,
+			"avg_latency_ms":    m.AvgLatencyMS,
+			"citation_coverage": m.CitationCoverage,
+		})
+	}
+	resp["models_7d"] = modelStats
+
+	report, err := h.Store.GetLatestReconciliationReport(r.Context())
+	switch {
+	case err == nil:
+		resp["reconciliation"] = map[string]any{
+			"report_id":         report.ID,
+			"started_at":        report.StartedAt,
+			"finished_at":       report.FinishedAt,
+			"counters_checked":  report.CountersChecked,
+			"counters_repaired": report.CountersRepaired,
+			"periods_rolled":    report.PeriodsRolled,
+			"trials_expired":    report.TrialsExpired,
+			"audit_pruned":      report.AuditPruned,
+			"vector_orphans":    report.VectorOrphans,
+			"discrepancy_count": len(report.Discrepancies),
+			"discrepancies":     report.Discrepancies,
+		}
+	case errors.Is(err, sql.ErrNoRows):
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,217 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"neuralmail/internal/store"
+)
+
+// manualEntitlementPeriod is the usage period an org without entitlements
+// starts on when an operator sets them by hand.
+const manualEntitlementPeriod = 30 * 24 * time.Hour
+
+// handleAdminOrgs serves GET /v1/admin/orgs, every org with its plan.
+func (h *Handler) handleAdminOrgs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if _, err := h.requirePlatformAdmin(r); err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	orgs, err := h.Store.ListOrgs(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	items := make([]map[string]any, 0, len(orgs))
+	for _, o := range orgs {
+		items = append(items, map[string]any{
+			"org_id":              o.ID,
+			"name":                o.Name,
+			"region":              o.Region,
+			"sandbox":             o.Sandbox,
+			"plan_code":           o.PlanCode,
+			"subscription_status": o.SubscriptionStatus,
+			"created_at":          o.CreatedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"orgs": items})
+}
+
+// handleAdminEntitlements returns an org's entitlements (GET ?org_id=) or
+// overrides them (PUT) for orgs billed outside Stripe. A PUT naming a
+// plan_code takes that plan's limits; the other fields override single
+// limits on top. An org without entitlements starts a 30-day usage period.
+func (h *Handler) handleAdminEntitlements(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requirePlatformAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	ctx := r.Context()
+	switch r.Method {
+	case http.MethodGet:
+		orgID := strings.TrimSpace(r.URL.Query().Get("org_id"))
+		if orgID == "" {
+			http.Error(w, "missing org_id", http.StatusBadRequest)
+			return
+		}
+		ent, err := h.Store.GetOrgEntitlement(ctx, orgID)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "entitlements not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, entitlementJSON(ent))
+	case http.MethodPut:
+		var req struct {
+			OrgID              string `json:"org_id"`
+			PlanCode           string `json:"plan_code"`
+			SubscriptionStatus string `json:"subscription_status"`
+			MCPRPM             *int   `json:"mcp_rpm"`
+			MonthlyUnits       *int64 `json:"monthly_units"`
+			MaxInboxes         *int   `json:"max_inboxes"`
+			MaxDomains         *int   `json:"max_domains"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		req.OrgID = strings.TrimSpace(req.OrgID)
+		if req.OrgID == "" {
+			http.Error(w, "missing org_id", http.StatusBadRequest)
+			return
+		}
+		if _, err := h.Store.GetOrgRegion(ctx, req.OrgID); errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "org not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		switch req.SubscriptionStatus {
+		case "", "trialing", "active", "past_due", "canceled", "unpaid":
+		default:
+			http.Error(w, "subscription_status must be trialing, active, past_due, canceled or unpaid", http.StatusBadRequest)
+			return
+		}
+		for _, v := range []*int{req.MCPRPM, req.MaxInboxes, req.MaxDomains} {
+			if v != nil && *v < 0 {
+				http.Error(w, "limits must not be negative", http.StatusBadRequest)
+				return
+			}
+		}
+		if req.MonthlyUnits != nil && *req.MonthlyUnits < 0 {
+			http.Error(w, "limits must not be negative", http.StatusBadRequest)
+			return
+		}
+
+		ent, err := h.Store.GetOrgEntitlement(ctx, req.OrgID)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			if req.PlanCode == "" {
+				http.Error(w, "plan_code is required for an org without entitlements", http.StatusBadRequest)
+				return
+			}
+			start := time.Now().UTC().Truncate(time.Second)
+			ent = store.OrgEntitlement{
+				OrgID:              req.OrgID,
+				SubscriptionStatus: "active",
+				UsagePeriodStart:   start,
+				UsagePeriodEnd:     start.Add(manualEntitlementPeriod),
+			}
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if req.PlanCode != "" {
+			plan, err := h.Store.GetPlanEntitlement(ctx, req.PlanCode)
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "unknown plan_code", http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			ent.PlanCode = plan.PlanCode
+			ent.MCPRPM = plan.MCPRPM
+			ent.MonthlyUnits = plan.MonthlyUnits
+			ent.MaxInboxes = plan.MaxInboxes
+			ent.MaxDomains = plan.MaxDomains
+		}
+		if req.SubscriptionStatus != "" {
+			ent.SubscriptionStatus = req.SubscriptionStatus
+		}
+		if req.MCPRPM != nil {
+			ent.MCPRPM = *req.MCPRPM
+		}
+		if req.MonthlyUnits != nil {
+			ent.MonthlyUnits = *req.MonthlyUnits
+		}
+		if req.MaxInboxes != nil {
+			ent.MaxInboxes = *req.MaxInboxes
+		}
+		if req.MaxDomains != nil {
+			ent.MaxDomains = *req.MaxDomains
+		}
+
+		if err := h.Store.UpsertOrgEntitlement(ctx, ent); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := h.Store.EnsureOrgUsageCounter(ctx, ent.OrgID, "mcp_units", ent.UsagePeriodStart, ent.UsagePeriodEnd); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if toolCallID, err := h.Store.RecordToolCall(ctx, "set_org_entitlement", ent.OrgID, "", "control-plane", 0); err == nil {
+			_ = h.Store.RecordAudit(ctx, store.AuditRecord{
+				ToolCallID:  toolCallID,
+				OrgID:       ent.OrgID,
+				Actor:       principal.ActorID,
+				InputsHash:  hashAny(req),
+				OutputsHash: hashAny(entitlementJSON(ent)),
+			})
+		}
+		if updated, err := h.Store.GetOrgEntitlement(ctx, ent.OrgID); err == nil {
+			ent = updated
+		}
+		writeJSON(w, http.StatusOK, entitlementJSON(ent))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func entitlementJSON(ent store.OrgEntitlement) map[string]any {
+	out := map[string]any{
+		"org_id":              ent.OrgID,
+		"plan_code":           ent.PlanCode,
+		"subscription_status": ent.SubscriptionStatus,
+		"mcp_rpm":             ent.MCPRPM,
+		"monthly_units":       ent.MonthlyUnits,
+		"max_inboxes":         ent.MaxInboxes,
+		"max_domains":         ent.MaxDomains,
+		"usage_period_start":  ent.UsagePeriodStart,
+		"usage_period_end":    ent.UsagePeriodEnd,
+		"grace_until":         nil,
+		"trial_ends_at":       nil,
+		"updated_at":          ent.UpdatedAt,
+	}
+	if ent.GraceUntil.Valid {
+		out["grace_until"] = ent.GraceUntil.Time
+	}
+	if ent.TrialEndsAt.Valid {
+		out["trial_ends_at"] = ent.TrialEndsAt.Time
+	}
+	return out
+}
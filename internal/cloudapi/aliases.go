@@ -0,0 +1,130 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"neuralmail/internal/emailaddr"
+	"neuralmail/internal/store"
+)
+
+type inboxAliasResponse struct {
+	ID        string    `json:"id"`
+	InboxID   string    `json:"inbox_id"`
+	Address   string    `json:"address"`
+	Route     string    `json:"route"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func toInboxAliasResponse(alias store.InboxAlias) inboxAliasResponse {
+	return inboxAliasResponse{
+		ID:        alias.ID,
+		InboxID:   alias.InboxID,
+		Address:   alias.Address,
+		Route:     alias.Route,
+		CreatedAt: alias.CreatedAt,
+	}
+}
+
+// handleInboxAliases serves the alias routes of an inbox:
+//
+//	GET    /v1/inboxes/{id}/aliases
+//	POST   /v1/inboxes/{id}/aliases
+//	DELETE /v1/inboxes/{id}/aliases/{alias_id}
+//
+// Mail to an alias lands in the inbox and keeps the alias it was sent to, so
+// triage can route it. In cloud mode an alias must be on one of the org's
+// verified domains, like the inbox address itself.
+func (h *Handler) handleInboxAliases(w http.ResponseWriter, r *http.Request, inboxID string, aliasID string) {
+	principal, err := h.requireAnyScope(r, "nerve:admin.billing", "nerve:email.inbox.create")
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.Store.EnsureInboxBelongsToOrg(r.Context(), inboxID, orgID); err != nil {
+		if errors.Is(err, store.ErrOwnershipMismatch) {
+			http.Error(w, "inbox not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case aliasID == "" && r.Method == http.MethodGet:
+		aliases, err := h.Store.ListInboxAliases(r.Context(), inboxID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp := make([]inboxAliasResponse, 0, len(aliases))
+		for _, alias := range aliases {
+			resp = append(resp, toInboxAliasResponse(alias))
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"aliases": resp})
+	case aliasID == "" && r.Method == http.MethodPost:
+		h.createInboxAlias(w, r, orgID, inboxID)
+	case aliasID != "" && r.Method == http.MethodDelete:
+		deleted, err := h.Store.DeleteInboxAlias(r.Context(), orgID, inboxID, aliasID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			http.Error(w, "alias not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"status": "deleted"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) createInboxAlias(w http.ResponseWriter, r *http.Request, orgID string, inboxID string) {
+	var req struct {
+		Address string `json:"address"`
+		Route   string `json:"route"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	canonical, _, domainPart, err := emailaddr.Canonicalize(req.Address)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if h.Config.Cloud.Mode {
+		d, err := h.Store.GetOrgDomainForSending(r.Context(), domainPart)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err != nil || d.OrgID != orgID {
+			// Don't leak domain ownership information.
+			http.Error(w, "domain not verified", http.StatusBadRequest)
+			return
+		}
+	}
+
+	alias, err := h.Store.CreateInboxAlias(r.Context(), inboxID, canonical, strings.TrimSpace(req.Route))
+	if errors.Is(err, store.ErrAddressInUse) {
+		http.Error(w, "address already in use", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"alias": toInboxAliasResponse(alias)})
+}
@@ -0,0 +1,70 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxAutoCloseDays caps an inbox's inactivity threshold, and the window
+// closure stats can cover.
+const maxAutoCloseDays = 365
+
+// handleInboxClosures serves GET /v1/inboxes/{id}/closures: the inbox's
+// auto-close rule and, for threads closed in the last days (default 30), how
+// many were reopened by new mail, overall and for auto-closures.
+func (h *Handler) handleInboxClosures(w http.ResponseWriter, r *http.Request, inboxID string) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	principal, err := h.requireAnyScope(r, "nerve:admin.billing", "nerve:email.inbox.create")
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	days := 30
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		days, err = strconv.Atoi(raw)
+		if err != nil || days < 1 || days > maxAutoCloseDays {
+			http.Error(w, "days must be between 1 and 365", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	rule, err := h.Store.GetInboxAutoClose(ctx, orgID, inboxID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "inbox not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stats, err := h.Store.GetThreadClosureStats(ctx, inboxID, time.Now().UTC().AddDate(0, 0, -days))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"inbox_id":              inboxID,
+		"auto_close_after_days": rule.AfterDays,
+		"auto_close_nudge":      rule.Nudge,
+		"days":                  days,
+		"closed":                stats.Closed,
+		"reopened":              stats.Reopened,
+		"reopen_rate":           stats.ReopenRate(),
+		"auto_closed":           stats.AutoClosed,
+		"auto_reopened":         stats.AutoReopened,
+		"auto_reopen_rate":      stats.AutoReopenRate(),
+	})
+}
@@ -0,0 +1,263 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"neuralmail/internal/rules"
+	"neuralmail/internal/store"
+)
+
+// Limits on a rule, so evaluating an org's rules stays cheap on every
+// message.
+const (
+	maxRuleActions   = 10
+	maxRuleFilters   = 100
+	maxRuleRunsLimit = 200
+)
+
+type automationRuleRequest struct {
+	OrgID      string               `json:"org_id"`
+	InboxID    string               `json:"inbox_id"`
+	Name       string               `json:"name"`
+	Position   int                  `json:"position"`
+	Enabled    *bool                `json:"enabled"`
+	DryRun     bool                 `json:"dry_run"`
+	Filters    store.RuleFilters    `json:"filters"`
+	Conditions store.RuleConditions `json:"conditions"`
+	Actions    []store.RuleAction   `json:"actions"`
+}
+
+type automationRuleResponse struct {
+	ID         string               `json:"id"`
+	InboxID    string               `json:"inbox_id,omitempty"`
+	Name       string               `json:"name"`
+	Position   int                  `json:"position"`
+	Enabled    bool                 `json:"enabled"`
+	DryRun     bool                 `json:"dry_run"`
+	Filters    store.RuleFilters    `json:"filters"`
+	Conditions store.RuleConditions `json:"conditions"`
+	Actions    []store.RuleAction   `json:"actions"`
+	CreatedBy  string               `json:"created_by,omitempty"`
+	CreatedAt  time.Time            `json:"created_at"`
+	UpdatedAt  time.Time            `json:"updated_at"`
+}
+
+func toAutomationRuleResponse(r store.AutomationRule) automationRuleResponse {
+	return automationRuleResponse{
+		ID:         r.ID,
+		InboxID:    r.InboxID,
+		Name:       r.Name,
+		Position:   r.Position,
+		Enabled:    r.Enabled,
+		DryRun:     r.DryRun,
+		Filters:    r.Filters,
+		Conditions: r.Conditions,
+		Actions:    r.Actions,
+		CreatedBy:  r.CreatedBy,
+		CreatedAt:  r.CreatedAt,
+		UpdatedAt:  r.UpdatedAt,
+	}
+}
+
+// handleAutomationRules serves GET and POST /v1/rules: the org's automation
+// rules, in the order they run, and adding one.
+func (h *Handler) handleAutomationRules(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	ctx := r.Context()
+	switch r.Method {
+	case http.MethodGet:
+		orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		list, err := h.Store.ListAutomationRules(ctx, orgID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp := make([]automationRuleResponse, 0, len(list))
+		for _, rule := range list {
+			resp = append(resp, toAutomationRuleResponse(rule))
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"org_id": orgID, "rules": resp, "actions": store.RuleActions})
+	case http.MethodPost:
+		var req automationRuleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(req.OrgID))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rule, status, err := h.automationRuleFromRequest(r, orgID, req)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		rule.CreatedBy = principal.ActorID
+		rule, err = h.Store.CreateAutomationRule(ctx, rule)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, toAutomationRuleResponse(rule))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAutomationRuleByID serves one rule:
+//
+//	GET    /v1/rules/{id}
+//	PUT    /v1/rules/{id}       replaces the rule
+//	DELETE /v1/rules/{id}
+//	GET    /v1/rules/{id}/runs  the messages it matched and what it did, newest first
+func (h *Handler) handleAutomationRuleByID(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	ruleID, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/rules/"), "/")
+	if _, err := uuid.Parse(ruleID); err != nil || (sub != "" && sub != "runs") {
+		http.Error(w, "rule not found", http.StatusNotFound)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+
+	if sub == "runs" {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		limit := 50
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			if limit, err = strconv.Atoi(raw); err != nil || limit <= 0 || limit > maxRuleRunsLimit {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+		runs, err := h.Store.ListAutomationRuleRuns(ctx, orgID, ruleID, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp := make([]map[string]any, 0, len(runs))
+		for _, run := range runs {
+			resp = append(resp, map[string]any{
+				"id":         run.ID,
+				"message_id": run.MessageID,
+				"thread_id":  run.ThreadID,
+				"dry_run":    run.DryRun,
+				"actions":    run.Actions,
+				"error":      run.Error,
+				"created_at": run.CreatedAt,
+			})
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"rule_id": ruleID, "runs": resp})
+		return
+	}
+
+	var rule store.AutomationRule
+	switch r.Method {
+	case http.MethodGet:
+		rule, err = h.Store.GetAutomationRule(ctx, orgID, ruleID)
+	case http.MethodPut:
+		var req automationRuleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		var status int
+		if rule, status, err = h.automationRuleFromRequest(r, orgID, req); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		rule.ID = ruleID
+		rule, err = h.Store.UpdateAutomationRule(ctx, rule)
+	case http.MethodDelete:
+		deleted, err := h.Store.DeleteAutomationRule(ctx, orgID, ruleID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			http.Error(w, "rule not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"status": "deleted"})
+		return
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "rule not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, toAutomationRuleResponse(rule))
+}
+
+// automationRuleFromRequest validates req as a rule of orgID, returning the
+// status to fail with when it is not one.
+func (h *Handler) automationRuleFromRequest(r *http.Request, orgID string, req automationRuleRequest) (store.AutomationRule, int, error) {
+	rule := store.AutomationRule{
+		OrgID:      orgID,
+		InboxID:    strings.TrimSpace(req.InboxID),
+		Name:       strings.TrimSpace(req.Name),
+		Position:   req.Position,
+		Enabled:    req.Enabled == nil || *req.Enabled,
+		DryRun:     req.DryRun,
+		Filters:    req.Filters,
+		Conditions: req.Conditions,
+		Actions:    req.Actions,
+	}
+	if len(rule.Actions) > maxRuleActions {
+		return rule, http.StatusBadRequest, errors.New("too many actions")
+	}
+	if len(rule.Filters.From)+len(rule.Filters.BodyContains) > maxRuleFilters {
+		return rule, http.StatusBadRequest, errors.New("too many filters")
+	}
+	if len(rule.Filters.Subject) > maxSubjectRegex {
+		return rule, http.StatusBadRequest, errors.New("subject pattern too long")
+	}
+	if err := rules.Validate(rule); err != nil {
+		return rule, http.StatusBadRequest, err
+	}
+	if rule.InboxID != "" {
+		if _, err := uuid.Parse(rule.InboxID); err != nil {
+			return rule, http.StatusBadRequest, errors.New("inbox not found")
+		}
+		if err := h.Store.EnsureInboxBelongsToOrg(r.Context(), rule.InboxID, orgID); err != nil {
+			if errors.Is(err, store.ErrOwnershipMismatch) {
+				return rule, http.StatusBadRequest, errors.New("inbox not found")
+			}
+			return rule, http.StatusInternalServerError, err
+		}
+	}
+	return rule, 0, nil
+}
@@ -0,0 +1,116 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"neuralmail/internal/store"
+	"neuralmail/internal/sysmail"
+)
+
+type brandingResponse struct {
+	OrgID           string `json:"org_id"`
+	LogoURL         string `json:"logo_url"`
+	PrimaryColor    string `json:"primary_color"`
+	AccentColor     string `json:"accent_color"`
+	FooterText      string `json:"footer_text"`
+	PhysicalAddress string `json:"physical_address"`
+}
+
+// handleOrgBranding serves GET and PUT /v1/orgs/branding, the branding used
+// for mail the system sends on the org's behalf. PUT replaces every field;
+// empty ones fall back to the defaults.
+func (h *Handler) handleOrgBranding(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+	switch r.Method {
+	case http.MethodGet:
+		orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		branding, err := h.Store.GetOrgBranding(ctx, orgID)
+		if errors.Is(err, sql.ErrNoRows) {
+			branding, err = store.OrgBranding{OrgID: orgID}, nil
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, toBrandingResponse(branding))
+	case http.MethodPut:
+		var req brandingResponse
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(req.OrgID))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		branding := store.OrgBranding{
+			OrgID:           orgID,
+			LogoURL:         strings.TrimSpace(req.LogoURL),
+			PrimaryColor:    strings.TrimSpace(req.PrimaryColor),
+			AccentColor:     strings.TrimSpace(req.AccentColor),
+			FooterText:      strings.TrimSpace(req.FooterText),
+			PhysicalAddress: strings.TrimSpace(req.PhysicalAddress),
+		}
+		if err := validateBranding(branding); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		saved, err := h.Store.SetOrgBranding(ctx, branding)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, toBrandingResponse(saved))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func validateBranding(b store.OrgBranding) error {
+	if b.LogoURL != "" {
+		u, err := url.Parse(b.LogoURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return errors.New("logo_url must be an https URL")
+		}
+	}
+	for _, c := range []string{b.PrimaryColor, b.AccentColor} {
+		if c != "" && !sysmail.ValidColor(c) {
+			return errors.New("colors must be #rrggbb")
+		}
+	}
+	if utf8.RuneCountInString(b.FooterText) > 500 {
+		return errors.New("footer_text must be at most 500 characters")
+	}
+	if utf8.RuneCountInString(b.PhysicalAddress) > 300 {
+		return errors.New("physical_address must be at most 300 characters")
+	}
+	return nil
+}
+
+func toBrandingResponse(b store.OrgBranding) brandingResponse {
+	return brandingResponse{
+		OrgID:           b.OrgID,
+		LogoURL:         b.LogoURL,
+		PrimaryColor:    b.PrimaryColor,
+		AccentColor:     b.AccentColor,
+		FooterText:      b.FooterText,
+		PhysicalAddress: b.PhysicalAddress,
+	}
+}
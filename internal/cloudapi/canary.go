@@ -0,0 +1,137 @@
+package cloudapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"neuralmail/internal/canary"
+)
+
+const defaultCanaryWindow = 24 * time.Hour
+
+// handleAdminCanary reports rollout settings, pinned orgs and per-variant
+// metrics for the requested window (?since=72h, default 24h).
+func (h *Handler) handleAdminCanary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if _, err := h.requirePlatformAdmin(r); err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	window := defaultCanaryWindow
+	if raw := strings.TrimSpace(r.URL.Query().Get("since")); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "invalid since duration", http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+	since := time.Now().UTC().Add(-window)
+
+	stats, err := h.Store.SummarizeCanaryMetrics(r.Context(), strings.TrimSpace(r.URL.Query().Get("tool")), since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	flags, err := h.Store.ListOrgFeatureFlags(r.Context(), canary.FlagName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	variants := make([]map[string]any, 0, len(stats))
+	for _, st := range stats {
+		variants = append(variants, map[string]any{
+			"tool":              st.ToolName,
+			"variant":           st.Variant,
+			"calls":             st.Calls,
+			"orgs":              st.DistinctOrgs,
+			"avg_latency_ms":    st.AvgLatencyMS,
+			"p95_latency_ms":    st.P95LatencyMS,
+			"error_rate":        ratio(st.Errors, st.Calls),
+			"policy_block_rate": ratio(st.PolicyBlocks, st.Calls),
+			"approval_rate":     ratio(st.Approvals, st.Calls),
+			"first_recorded_at": st.FirstRecorded,
+			"last_recorded_at":  st.LastRecorded,
+		})
+	}
+	pinned := make([]map[string]any, 0, len(flags))
+	for _, f := range flags {
+		variant := canary.Stable
+		if f.Enabled {
+			variant = canary.Canary
+		}
+		pinned = append(pinned, map[string]any{"org_id": f.OrgID, "variant": variant, "updated_at": f.UpdatedAt})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"enabled":     h.Config.Canary.Enabled,
+		"percent":     h.Config.Canary.Percent,
+		"tools":       h.Config.Canary.Tools,
+		"since":       since,
+		"pinned_orgs": pinned,
+		"variants":    variants,
+	})
+}
+
+// handleAdminCanaryOrgs pins an org to a variant (PUT) or returns it to the
+// percentage rollout (DELETE).
+func (h *Handler) handleAdminCanaryOrgs(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.requirePlatformAdmin(r); err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		var req struct {
+			OrgID   string `json:"org_id"`
+			Enabled *bool  `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		orgID := strings.TrimSpace(req.OrgID)
+		if orgID == "" || req.Enabled == nil {
+			http.Error(w, "org_id and enabled are required", http.StatusBadRequest)
+			return
+		}
+		flag, err := h.Store.SetOrgFeatureFlag(r.Context(), orgID, canary.FlagName, *req.Enabled)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"org_id": flag.OrgID, "flag": flag.Flag, "enabled": flag.Enabled, "updated_at": flag.UpdatedAt})
+	case http.MethodDelete:
+		orgID := strings.TrimSpace(r.URL.Query().Get("org_id"))
+		if orgID == "" {
+			http.Error(w, "missing org_id", http.StatusBadRequest)
+			return
+		}
+		deleted, err := h.Store.DeleteOrgFeatureFlag(r.Context(), orgID, canary.FlagName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			http.Error(w, "org not pinned", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"status": "deleted"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func ratio(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
@@ -0,0 +1,156 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"neuralmail/internal/integrations"
+	"neuralmail/internal/store"
+)
+
+// maxCRMIntents caps each of a connection's case intent lists.
+const maxCRMIntents = 50
+
+// handleCRMIntegration serves the org's CRM connection:
+//
+//	GET    /v1/integrations/crm
+//	PUT    /v1/integrations/crm  connects, replacing any connection
+//	DELETE /v1/integrations/crm
+//
+// The access token is write-only and stored encrypted.
+func (h *Handler) handleCRMIntegration(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	ctx := r.Context()
+	var conn store.CRMConnection
+	switch r.Method {
+	case http.MethodGet:
+		orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		conn, err = h.Store.GetCRMConnection(ctx, orgID)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSON(w, http.StatusOK, map[string]any{"org_id": orgID, "connected": false, "providers": integrations.Providers})
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case http.MethodPut:
+		var req struct {
+			OrgID          string   `json:"org_id"`
+			Provider       string   `json:"provider"`
+			AccessToken    string   `json:"access_token"`
+			SalesIntents   []string `json:"sales_intents"`
+			SupportIntents []string `json:"support_intents"`
+			TicketPipeline string   `json:"ticket_pipeline"`
+			TicketStage    string   `json:"ticket_stage"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(req.OrgID))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		provider := strings.ToLower(strings.TrimSpace(req.Provider))
+		if !slices.Contains(integrations.Providers, provider) {
+			http.Error(w, "unsupported provider", http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(req.AccessToken) == "" {
+			http.Error(w, "access_token is required", http.StatusBadRequest)
+			return
+		}
+		if len(req.SalesIntents) > maxCRMIntents || len(req.SupportIntents) > maxCRMIntents {
+			http.Error(w, "too many intents", http.StatusBadRequest)
+			return
+		}
+		conn, err = integrations.Seal(h.Config, store.CRMConnection{
+			OrgID:          orgID,
+			Provider:       provider,
+			AccessToken:    strings.TrimSpace(req.AccessToken),
+			SalesIntents:   normalizeIntents(req.SalesIntents),
+			SupportIntents: normalizeIntents(req.SupportIntents),
+			TicketPipeline: strings.TrimSpace(req.TicketPipeline),
+			TicketStage:    strings.TrimSpace(req.TicketStage),
+			CreatedBy:      principal.ActorID,
+		})
+		if errors.Is(err, integrations.ErrNotConfigured) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		conn, err = h.Store.PutCRMConnection(ctx, conn)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case http.MethodDelete:
+		orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		deleted, err := h.Store.DeleteCRMConnection(ctx, orgID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			http.Error(w, "crm not connected", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"status": "deleted"})
+		return
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	sales, support := conn.SalesIntents, conn.SupportIntents
+	if len(sales) == 0 {
+		sales = integrations.DefaultSalesIntents
+	}
+	if len(support) == 0 {
+		support = integrations.DefaultSupportIntents
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"org_id":          conn.OrgID,
+		"connected":       true,
+		"provider":        conn.Provider,
+		"sales_intents":   sales,
+		"support_intents": support,
+		"ticket_pipeline": conn.TicketPipeline,
+		"ticket_stage":    conn.TicketStage,
+		"created_by":      conn.CreatedBy,
+		"updated_at":      conn.UpdatedAt,
+	})
+}
+
+// normalizeIntents lowercases and dedupes intents, dropping empty ones.
+func normalizeIntents(intents []string) []string {
+	out := []string{}
+	for _, intent := range intents {
+		intent = strings.ToLower(strings.TrimSpace(intent))
+		if intent != "" && !slices.Contains(out, intent) {
+			out = append(out, intent)
+		}
+	}
+	return out
+}
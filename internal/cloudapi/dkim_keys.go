@@ -0,0 +1,205 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"neuralmail/internal/domains"
+	"neuralmail/internal/store"
+)
+
+// maxDKIMRotationOverlap bounds how long a caller can keep a replaced DKIM
+// key published.
+const maxDKIMRotationOverlap = 30 * 24 * time.Hour
+
+type dkimKeyResponse struct {
+	ID        string            `json:"id"`
+	Selector  string            `json:"selector"`
+	Status    string            `json:"status"`
+	DNSRecord domains.DNSRecord `json:"dns_record"`
+	// HostedRecord is the TXT record the DKIM CNAME zone publishes for the
+	// key, set for domains using the cname method.
+	HostedRecord *domains.DNSRecord `json:"hosted_record,omitempty"`
+	CreatedAt    time.Time          `json:"created_at"`
+	ActivatedAt  *time.Time         `json:"activated_at,omitempty"`
+	RetireAt     *time.Time         `json:"retire_at,omitempty"`
+	RetiredAt    *time.Time         `json:"retired_at,omitempty"`
+}
+
+func (h *Handler) dkimKeyResponse(d store.OrgDomain, k store.DKIMKey) dkimKeyResponse {
+	record, hosted, ok := domains.DKIMRecord(d.Domain, d.DKIMMethod, k.Selector, k.PublicKey, h.Config.Domains.DKIMCNAMEZone)
+	out := dkimKeyResponse{
+		ID:          k.ID,
+		Selector:    k.Selector,
+		Status:      k.Status,
+		DNSRecord:   record,
+		CreatedAt:   k.CreatedAt,
+		ActivatedAt: nullTimePtr(k.ActivatedAt),
+		RetireAt:    nullTimePtr(k.RetireAt),
+		RetiredAt:   nullTimePtr(k.RetiredAt),
+	}
+	if ok {
+		out.HostedRecord = &hosted
+	}
+	return out
+}
+
+// handleDomainDKIM serves a domain's DKIM keys:
+//
+//	GET  /v1/domains/{id}/dkim
+//	POST /v1/domains/{id}/dkim
+//
+// POST generates the domain's first key pair, which signs the domain's mail
+// from then on; the private key is stored encrypted and never returned.
+// Both answer with the keys and the DNS record each needs published.
+func (h *Handler) handleDomainDKIM(w http.ResponseWriter, r *http.Request, domainID string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	d, ok := h.domainForDKIM(w, r, domainID)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		privateEnc, publicPEM, ok := h.generateDKIMKey(w)
+		if !ok {
+			return
+		}
+		selector := d.DKIMSelector
+		if selector == "" {
+			selector = domains.DefaultDKIMSelector
+		}
+		_, err := h.Store.CreateDKIMKey(ctx, d.ID, selector, privateEnc, publicPEM)
+		if errors.Is(err, store.ErrDKIMKeyExists) {
+			http.Error(w, "domain already has a dkim key; rotate it", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		status = http.StatusCreated
+	}
+	h.writeDKIMKeys(w, r, d, status)
+}
+
+// handleRotateDomainDKIM serves POST /v1/domains/{id}/dkim/rotate. It
+// generates a key under a new selector and answers with its DNS record. The
+// current key keeps signing until the domain verifier finds the new record
+// published; the new key then signs, and the old one stays valid for the
+// overlap window, domains.dkim_rotation_overlap unless the body sets
+// overlap_seconds, before it is retired and its record can go.
+func (h *Handler) handleRotateDomainDKIM(w http.ResponseWriter, r *http.Request, domainID string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	d, ok := h.domainForDKIM(w, r, domainID)
+	if !ok {
+		return
+	}
+	var req struct {
+		OverlapSeconds *int64 `json:"overlap_seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	overlap := h.Config.Domains.DKIMRotationOverlap
+	if req.OverlapSeconds != nil {
+		overlap = time.Duration(*req.OverlapSeconds) * time.Second
+		if *req.OverlapSeconds < 0 || overlap > maxDKIMRotationOverlap {
+			http.Error(w, "overlap_seconds must be between 0 and 2592000", http.StatusBadRequest)
+			return
+		}
+	}
+	privateEnc, publicPEM, ok := h.generateDKIMKey(w)
+	if !ok {
+		return
+	}
+	_, err := h.Store.RotateDKIMKey(r.Context(), d.ID, domains.RotationSelector(time.Now()), privateEnc, publicPEM, overlap)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "domain has no dkim key; generate one first", http.StatusConflict)
+		return
+	case errors.Is(err, store.ErrDKIMRotationPending):
+		http.Error(w, "a rotation is already waiting for its dns record", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeDKIMKeys(w, r, d, http.StatusCreated)
+}
+
+// domainForDKIM authorizes a DKIM endpoint call on domainID and loads the
+// domain; it has answered the request when ok is false.
+func (h *Handler) domainForDKIM(w http.ResponseWriter, r *http.Request, domainID string) (store.OrgDomain, bool) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return store.OrgDomain{}, false
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return store.OrgDomain{}, false
+	}
+	d, err := h.Store.GetOrgDomainByIDForOrg(r.Context(), orgID, domainID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "domain not found", http.StatusNotFound)
+		return d, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return d, false
+	}
+	return d, true
+}
+
+// generateDKIMKey returns a new key pair with the private key encrypted for
+// storage; it has answered the request when ok is false.
+func (h *Handler) generateDKIMKey(w http.ResponseWriter) (privateEnc, publicPEM string, ok bool) {
+	encKey, err := domains.ParseEncryptionKey(h.Config.Domains.DKIMEncryptionKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return "", "", false
+	}
+	privatePEM, publicPEM, err := domains.GenerateDKIMKey()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return "", "", false
+	}
+	privateEnc, err = domains.EncryptDKIMKey(privatePEM, encKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return "", "", false
+	}
+	return privateEnc, publicPEM, true
+}
+
+func (h *Handler) writeDKIMKeys(w http.ResponseWriter, r *http.Request, d store.OrgDomain, status int) {
+	keys, err := h.Store.ListDKIMKeys(r.Context(), d.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out := make([]dkimKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, h.dkimKeyResponse(d, k))
+	}
+	writeJSON(w, status, map[string]any{
+		"domain_id":   d.ID,
+		"domain":      d.Domain,
+		"dkim_method": d.DKIMMethod,
+		"keys":        out,
+	})
+}
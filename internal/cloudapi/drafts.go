@@ -0,0 +1,235 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"neuralmail/internal/store"
+)
+
+type draftRevisionResponse struct {
+	Revision           int       `json:"revision"`
+	Body               string    `json:"body"`
+	PolicyID           string    `json:"policy_id"`
+	PolicyBlocked      bool      `json:"policy_blocked"`
+	NeedsHumanApproval bool      `json:"needs_human_approval"`
+	Reason             string    `json:"reason"`
+	RiskFlags          []string  `json:"risk_flags"`
+	PolicyRuleIDs      []string  `json:"policy_rule_ids"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+type draftResponse struct {
+	ID               string                  `json:"id"`
+	ThreadID         string                  `json:"thread_id"`
+	Goal             string                  `json:"goal"`
+	Status           string                  `json:"status"`
+	ReviewedBy       string                  `json:"reviewed_by,omitempty"`
+	ReviewedAt       *time.Time              `json:"reviewed_at,omitempty"`
+	ReviewNote       string                  `json:"review_note,omitempty"`
+	ApprovedRevision int                     `json:"approved_revision,omitempty"`
+	SentMessageID    string                  `json:"sent_message_id,omitempty"`
+	CreatedAt        time.Time               `json:"created_at"`
+	UpdatedAt        time.Time               `json:"updated_at"`
+	Latest           *draftRevisionResponse  `json:"latest,omitempty"`
+	Revisions        []draftRevisionResponse `json:"revisions,omitempty"`
+}
+
+func toDraftRevisionResponse(rev store.DraftRevision) draftRevisionResponse {
+	return draftRevisionResponse{
+		Revision:           rev.Revision,
+		Body:               rev.Body,
+		PolicyID:           rev.PolicyID,
+		PolicyBlocked:      rev.PolicyBlocked,
+		NeedsHumanApproval: rev.NeedsApproval,
+		Reason:             rev.Reason,
+		RiskFlags:          rev.RiskFlags,
+		PolicyRuleIDs:      rev.PolicyRuleIDs,
+		CreatedAt:          rev.CreatedAt,
+	}
+}
+
+func toDraftResponse(d store.Draft) draftResponse {
+	resp := draftResponse{
+		ID:               d.ID,
+		ThreadID:         d.ThreadID,
+		Goal:             d.Goal,
+		Status:           d.Status,
+		ReviewedBy:       d.ReviewedBy,
+		ReviewNote:       d.ReviewNote,
+		ApprovedRevision: d.ApprovedRevision,
+		SentMessageID:    d.SentMessageID,
+		CreatedAt:        d.CreatedAt,
+		UpdatedAt:        d.UpdatedAt,
+	}
+	if d.ReviewedAt.Valid {
+		reviewedAt := d.ReviewedAt.Time
+		resp.ReviewedAt = &reviewedAt
+	}
+	return resp
+}
+
+// handleDrafts serves GET /v1/drafts, the review queue. It lists drafts
+// waiting for approval unless status names another state or all.
+func (h *Handler) handleDrafts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	principal, err := h.requireAnyScope(r, "nerve:admin.billing", "nerve:email.draft.review")
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status := strings.TrimSpace(r.URL.Query().Get("status"))
+	switch status {
+	case "":
+		status = store.DraftPendingApproval
+	case "all":
+		status = ""
+	case store.DraftPendingApproval, store.DraftApproved, store.DraftRejected, store.DraftSent:
+	default:
+		http.Error(w, "status must be pending_approval, approved, rejected, sent or all", http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 && parsed <= 200 {
+			limit = parsed
+		}
+	}
+
+	drafts, err := h.Store.ListDrafts(r.Context(), orgID, status, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := make([]draftResponse, 0, len(drafts))
+	for _, d := range drafts {
+		item := toDraftResponse(d.Draft)
+		latest := toDraftRevisionResponse(d.Latest)
+		item.Latest = &latest
+		resp = append(resp, item)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"drafts": resp})
+}
+
+// handleDraftByID serves the per-draft review routes:
+//
+//	GET  /v1/drafts/{id}
+//	POST /v1/drafts/{id}/approve
+//	POST /v1/drafts/{id}/reject
+//
+// Approve takes an optional revision, the one the reviewer read, and fails
+// with 409 if the agent has submitted a newer one since. Reject requires a
+// reason, which the agent sees in get_draft_history.
+func (h *Handler) handleDraftByID(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireAnyScope(r, "nerve:admin.billing", "nerve:email.draft.review")
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/drafts/"), "/")
+	if parts[0] == "" || len(parts) > 2 {
+		http.NotFound(w, r)
+		return
+	}
+	draft, err := h.Store.GetDraft(r.Context(), parts[0])
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && draft.OrgID != orgID) {
+		http.Error(w, "draft not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		revisions, err := h.Store.ListDraftRevisions(r.Context(), draft.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp := toDraftResponse(draft)
+		resp.Revisions = make([]draftRevisionResponse, 0, len(revisions))
+		for _, rev := range revisions {
+			resp.Revisions = append(resp.Revisions, toDraftRevisionResponse(rev))
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	var status string
+	switch parts[1] {
+	case "approve":
+		status = store.DraftApproved
+	case "reject":
+		status = store.DraftRejected
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Revision int    `json:"revision"`
+		Note     string `json:"note"`
+		Reason   string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+	}
+	note := strings.TrimSpace(req.Note)
+	if status == store.DraftRejected {
+		note = strings.TrimSpace(req.Reason)
+		if note == "" {
+			http.Error(w, "missing reason", http.StatusBadRequest)
+			return
+		}
+	}
+	if draft.Status == store.DraftSent {
+		http.Error(w, "draft already sent", http.StatusConflict)
+		return
+	}
+
+	reviewed, err := h.Store.ReviewDraft(r.Context(), orgID, draft.ID, status, principal.ActorID, note, req.Revision)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !reviewed {
+		http.Error(w, "draft changed since that revision or was already sent", http.StatusConflict)
+		return
+	}
+	updated, err := h.Store.GetDraft(r.Context(), draft.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, toDraftResponse(updated))
+}
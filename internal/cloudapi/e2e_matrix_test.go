@@ -10,7 +10,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -28,6 +28,7 @@ import (
 	"neuralmail/internal/observability"
 	"neuralmail/internal/policy"
 	"neuralmail/internal/store"
+	"neuralmail/internal/tenancy"
 	"neuralmail/internal/tools"
 )
 
@@ -77,6 +78,10 @@ func (f *fixedDraftLLM) Draft(_ context.Context, _ string, _ map[string]any, _ s
 	}, nil
 }
 
+func (f *fixedDraftLLM) Translate(_ context.Context, text string, targetLanguage string) (llm.Translation, error) {
+	return llm.Translation{Text: text, SourceLanguage: "en", TargetLanguage: targetLanguage}, nil
+}
+
 func (f *fixedDraftLLM) Name() string  { return "fixed-draft-llm" }
 func (f *fixedDraftLLM) Model() string { return "fixed-draft-llm" }
 
@@ -177,6 +182,26 @@ func TestCloudE2EMatrix(t *testing.T) {
 			}
 		})
 
+		t.Run("VerifyTenancyCommand", func(t *testing.T) {
+			issue := func(_ context.Context, orgID string, scopes []string) (string, error) {
+				return h.issueServiceToken(t, orgID, scopes, false), nil
+			}
+			report, err := tenancy.NewVerifier(h.store, h.mcp.URL+"/mcp", "", issue).Run(ctx)
+			if err != nil {
+				t.Fatalf("verify tenancy: %v", err)
+			}
+			if len(report.Checks) == 0 {
+				t.Fatal("expected checks to run")
+			}
+			for _, c := range report.Failed() {
+				t.Errorf("tenant %s: %s: %v", c.Tenant, c.Name, c.Err)
+			}
+			var left int
+			if err := st.DB().QueryRowContext(ctx, `SELECT count(*) FROM orgs WHERE name LIKE 'verify-tenancy-%'`).Scan(&left); err != nil || left != 0 {
+				t.Fatalf("expected the seeded orgs cleaned up, %d left (%v)", left, err)
+			}
+		})
+
 		t.Run("PolicySoftBlock", func(t *testing.T) {
 			orgID := h.createOrg(t, "policy-org")
 			h.upsertActiveEntitlement(t, orgID, 1000, 1000)
@@ -486,7 +511,7 @@ func newCloudE2EHarness(t *testing.T, ctx context.Context, st *store.Store) *clo
 	controlHandler.RegisterRoutes(controlMux)
 	controlPlane := httptest.NewServer(controlMux)
 
-	observer := observability.NewEntitlementObserver(log.New(io.Discard, "", 0))
+	observer := observability.NewEntitlementObserver(slog.New(slog.NewTextHandler(io.Discard, nil)))
 	entitlementSvc := entitlements.NewService(cfg, st, observer)
 	pol := policy.Policy{
 		ForbiddenPhrases: []string{"processed your refund of $500 immediately"},
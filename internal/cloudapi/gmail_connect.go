@@ -0,0 +1,281 @@
+package cloudapi
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"neuralmail/internal/gmailapi"
+	"neuralmail/internal/store"
+)
+
+const gmailConnectStateTTL = 10 * time.Minute
+
+// selectableInboxProvider reports whether a provider can be set directly.
+// Gmail needs an OAuth grant, so it is only set by the consent callback.
+func selectableInboxProvider(provider string) bool {
+	return provider == store.ProviderJMAP || provider == store.ProviderIMAP
+}
+
+// gmailConnectionInbox authorizes a Gmail connection call and loads the
+// caller's inbox, writing the error response when it cannot.
+func (h *Handler) gmailConnectionInbox(w http.ResponseWriter, r *http.Request, inboxID string) (string, store.InboxRecord, bool) {
+	principal, err := h.requireAnyScope(r, "nerve:admin.billing", "nerve:email.inbox.create")
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return "", store.InboxRecord{}, false
+	}
+	if inboxID == "" || strings.Contains(inboxID, "/") {
+		http.Error(w, "missing inbox id", http.StatusBadRequest)
+		return "", store.InboxRecord{}, false
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", store.InboxRecord{}, false
+	}
+	inbox, err := h.Store.GetInboxRecordByIDForOrg(r.Context(), orgID, inboxID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "inbox not found", http.StatusNotFound)
+			return "", store.InboxRecord{}, false
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return "", store.InboxRecord{}, false
+	}
+	return orgID, inbox, true
+}
+
+// imapSelectable reports whether the inbox at address can sync over IMAP.
+// The configured IMAP account syncs only the self-hosted default inbox, so
+// any other inbox set to imap would silently stop syncing.
+func (h *Handler) imapSelectable(address string) bool {
+	return !h.Config.Cloud.Mode && strings.EqualFold(address, h.Config.SMTP.From)
+}
+
+const imapNotConfiguredMessage = "imap is not configured for this inbox; only the self-hosted default inbox syncs over imap"
+
+// handleInboxGmailConnection serves /v1/inboxes/{id}/connect/gmail: POST
+// starts consent, GET reports the connection and DELETE disconnects the
+// inbox and returns it to JMAP.
+func (h *Handler) handleInboxGmailConnection(w http.ResponseWriter, r *http.Request, inboxID string) {
+	orgID, inbox, ok := h.gmailConnectionInbox(w, r, inboxID)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodPost:
+		oauth, err := gmailapi.NewOAuth(h.Config)
+		if err != nil {
+			http.Error(w, "gmail connector not configured", http.StatusServiceUnavailable)
+			return
+		}
+		state, err := generateOAuthState()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		expiresAt := time.Now().UTC().Add(gmailConnectStateTTL)
+		if err := h.Store.CreateOAuthConnectState(ctx, store.OAuthConnectState{
+			State:     state,
+			OrgID:     orgID,
+			InboxID:   inbox.ID,
+			Provider:  store.ProviderGmail,
+			ExpiresAt: expiresAt,
+		}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"authorization_url": oauth.AuthCodeURL(state),
+			"state":             state,
+			"expires_at":        expiresAt,
+		})
+	case http.MethodGet:
+		resp := map[string]any{"inbox_id": inbox.ID, "provider": inbox.Provider, "connected": false}
+		tok, err := h.Store.GetInboxOAuthToken(ctx, inbox.ID)
+		switch {
+		case err == nil:
+			resp["connected"] = true
+			resp["account_email"] = tok.AccountEmail
+			resp["scopes"] = tok.Scopes
+			resp["connected_at"] = tok.CreatedAt
+		case errors.Is(err, sql.ErrNoRows):
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	case http.MethodDelete:
+		deleted, err := h.Store.DeleteInboxOAuthToken(ctx, orgID, inbox.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			http.Error(w, "inbox not connected", http.StatusNotFound)
+			return
+		}
+		if inbox.Provider == store.ProviderGmail {
+			if _, err := h.Store.SetInboxProvider(ctx, orgID, inbox.ID, store.ProviderJMAP); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"status": "disconnected"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleInboxGmailConfirm serves POST /v1/inboxes/{id}/connect/gmail/confirm.
+// The consent callback only proves that someone holding the state granted
+// access, and the authorization URL can be handed to anyone. The grant
+// therefore waits until the org that started the flow names the account it
+// meant to connect; a different account discards it.
+func (h *Handler) handleInboxGmailConfirm(w http.ResponseWriter, r *http.Request, inboxID string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	orgID, inbox, ok := h.gmailConnectionInbox(w, r, inboxID)
+	if !ok {
+		return
+	}
+	var req struct {
+		State        string `json:"state"`
+		AccountEmail string `json:"account_email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	req.State = strings.TrimSpace(req.State)
+	req.AccountEmail = strings.TrimSpace(req.AccountEmail)
+	if req.State == "" || req.AccountEmail == "" {
+		http.Error(w, "state and account_email are required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	grant, err := h.Store.ConsumeOAuthPendingGrant(ctx, orgID, inbox.ID, req.State)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "no pending gmail consent for this state", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !strings.EqualFold(grant.AccountEmail, req.AccountEmail) {
+		http.Error(w, "consent was granted for a different account; start the connection again", http.StatusConflict)
+		return
+	}
+	if err := h.Store.UpsertInboxOAuthToken(ctx, grant); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// A reconnect may point at a different mailbox; its old historyId is
+	// meaningless there.
+	if err := h.Store.DeleteCheckpoint(ctx, inbox.ID, store.ProviderGmail); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.Store.SetInboxProvider(ctx, orgID, inbox.ID, store.ProviderGmail); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":        "connected",
+		"inbox_id":      inbox.ID,
+		"account_email": grant.AccountEmail,
+	})
+}
+
+// handleGmailOAuthCallback is the OAuth redirect target. It carries no API
+// credentials; the single-use state issued by the connect call identifies
+// the org and inbox, and the grant waits there until the org confirms it.
+func (h *Handler) handleGmailOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	if denied := query.Get("error"); denied != "" {
+		http.Error(w, "gmail consent failed: "+denied, http.StatusBadRequest)
+		return
+	}
+	code := strings.TrimSpace(query.Get("code"))
+	stateParam := strings.TrimSpace(query.Get("state"))
+	if code == "" || stateParam == "" {
+		http.Error(w, "missing code or state", http.StatusBadRequest)
+		return
+	}
+	oauth, err := gmailapi.NewOAuth(h.Config)
+	if err != nil {
+		http.Error(w, "gmail connector not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx := r.Context()
+	state, err := h.Store.GetOAuthConnectState(ctx, stateParam)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "invalid or expired state", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tok, err := oauth.Exchange(ctx, code)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if tok.RefreshToken == "" {
+		http.Error(w, "google did not return a refresh token; remove the app's access and reconnect", http.StatusBadRequest)
+		return
+	}
+	accountEmail, err := gmailapi.NewClient(h.Config, gmailapi.StaticToken(tok.AccessToken)).ProfileEmail(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	grant, err := oauth.Grant(state.OrgID, state.InboxID, accountEmail, tok)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.Store.RecordOAuthConsent(ctx, state.State, grant, time.Now().UTC().Add(gmailConnectStateTTL)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "invalid or expired state", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":        "pending_confirmation",
+		"account_email": accountEmail,
+		"message":       "access granted; the inbox connects once the app that started this connection confirms the account",
+	})
+}
+
+func generateOAuthState() (string, error) {
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(random), nil
+}
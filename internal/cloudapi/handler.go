@@ -22,7 +22,9 @@ import (
 	"neuralmail/internal/config"
 	"neuralmail/internal/domains"
 	"neuralmail/internal/emailaddr"
+	"neuralmail/internal/entitlements"
 	"neuralmail/internal/store"
+	"neuralmail/internal/webhooks"
 )
 
 var ErrMaxInboxesExceeded = errors.New("max inboxes exceeded")
@@ -33,10 +35,11 @@ type BillingWebhookProcessor interface {
 }
 
 type BillingCheckoutProvider interface {
-	CreateCheckoutSession(ctx context.Context, orgID, successURL, cancelURL string) (*billingCheckoutResult, error)
+	CreateCheckoutSession(ctx context.Context, orgID string, order billingCheckoutOrder, successURL, cancelURL string) (*billingCheckoutResult, error)
 	CreateBillingPortalSession(ctx context.Context, orgID string) (*billingPortalResult, error)
 }
 
+type billingCheckoutOrder = billing.CheckoutOrder
 type billingCheckoutResult = billing.CheckoutResult
 type billingPortalResult = billing.PortalResult
 
@@ -49,16 +52,21 @@ type Handler struct {
 	Checkout BillingCheckoutProvider
 	Tokens   ServiceTokenIssuer
 	Domains  *domains.Verifier
+	Webhooks *webhooks.Sender
+	// LiveSessions, when set, is the cache MCP servers resume sessions
+	// from; terminated sessions are dropped from it.
+	LiveSessions LiveSessions
 }
 
 func NewHandler(cfg config.Config, st *store.Store, authSvc *auth.Service, billingSvc BillingWebhookProcessor, tokenSvc ServiceTokenIssuer) *Handler {
 	h := &Handler{
-		Config:  cfg,
-		Store:   st,
-		Auth:    authSvc,
-		Billing: billingSvc,
-		Tokens:  tokenSvc,
-		Domains: domains.NewVerifier(nil),
+		Config:   cfg,
+		Store:    st,
+		Auth:     authSvc,
+		Billing:  billingSvc,
+		Tokens:   tokenSvc,
+		Domains:  domains.NewVerifier(nil),
+		Webhooks: webhooks.NewSender(),
 	}
 	// If the billing service also implements checkout/portal, wire it up.
 	if cp, ok := billingSvc.(BillingCheckoutProvider); ok {
@@ -69,10 +77,28 @@ func NewHandler(cfg config.Config, st *store.Store, authSvc *auth.Service, billi
 
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/v1/orgs", h.handleCreateOrg)
+	mux.HandleFunc("/v1/orgs/", h.handleOrgByID)
 	mux.HandleFunc("/v1/orgs/runtime", h.handleOrgRuntime)
+	mux.HandleFunc("/v1/orgs/region", h.handleOrgRegion)
+	mux.HandleFunc("/v1/orgs/search-language", h.handleOrgSearchLanguage)
+	mux.HandleFunc("/v1/orgs/search-language/reindex", h.handleReindexOrgSearch)
+	mux.HandleFunc("/v1/orgs/search-rerank", h.handleOrgSearchRerank)
+	mux.HandleFunc("/v1/orgs/llm-routes", h.handleOrgLLMRoutes)
+	mux.HandleFunc("/v1/orgs/outbound-transport", h.handleOrgOutboundTransport)
+	mux.HandleFunc("/v1/orgs/sending-limits", h.handleOrgSendingLimits)
+	mux.HandleFunc("/v1/prompts", h.handlePrompts)
+	mux.HandleFunc("/v1/prompts/", h.handlePromptByID)
+	mux.HandleFunc("/v1/orgs/branding", h.handleOrgBranding)
+	mux.HandleFunc("/v1/plans", h.handlePlans)
 	mux.HandleFunc("/v1/subscriptions/checkout", h.handleCheckout)
 	mux.HandleFunc("/v1/billing/webhook/stripe", h.handleStripeWebhook)
 	mux.HandleFunc("/v1/subscriptions/current", h.handleCurrentSubscription)
+	mux.HandleFunc("/v1/usage", h.handleUsage)
+	mux.HandleFunc("/v1/usage/forecast", h.handleUsageForecast)
+	mux.HandleFunc("/v1/usage/meters", h.handleUsageMeters)
+	mux.HandleFunc("/v1/usage/daily", h.handleUsageDaily)
+	mux.HandleFunc("/v1/usage/export", h.handleUsageExport)
+	mux.HandleFunc("/v1/audit", h.handleAudit)
 	mux.HandleFunc("/v1/tokens/service", h.handleIssueServiceToken)
 	mux.HandleFunc("/v1/keys", h.handleCloudAPIKeys)
 	mux.HandleFunc("/v1/keys/", h.handleCloudAPIKeyByID)
@@ -80,9 +106,34 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/v1/domains/", h.handleDomainByID)
 	mux.HandleFunc("/v1/domains/verify", h.handleVerifyDomain)
 	mux.HandleFunc("/v1/domains/dns", h.handleDomainDNS)
+	mux.HandleFunc("/v1/routing-decisions", h.handleRoutingDecisions)
 	mux.HandleFunc("/v1/inboxes", h.handleInboxes)
 	mux.HandleFunc("/v1/inboxes/", h.handleInboxByID)
+	mux.HandleFunc("/v1/oauth/gmail/callback", h.handleGmailOAuthCallback)
 	mux.HandleFunc("/v1/billing/portal", h.handleBillingPortal)
+	mux.HandleFunc("/v1/link-rules", h.handleLinkRules)
+	mux.HandleFunc("/v1/link-rules/", h.handleLinkRuleByID)
+	mux.HandleFunc("/v1/rules", h.handleAutomationRules)
+	mux.HandleFunc("/v1/rules/", h.handleAutomationRuleByID)
+	mux.HandleFunc("/v1/integrations/crm", h.handleCRMIntegration)
+	mux.HandleFunc("/v1/webhooks", h.handleWebhooks)
+	mux.HandleFunc("/v1/webhooks/", h.handleWebhookByID)
+	mux.HandleFunc("/v1/webhooks/schemas", h.handleWebhookSchemas)
+	mux.HandleFunc("/v1/notification-preferences", h.handleNotificationPreferences)
+	mux.HandleFunc("/v1/sessions", h.handleSessions)
+	mux.HandleFunc("/v1/sessions/", h.handleSessionByID)
+	mux.HandleFunc("/v1/policies/", h.handlePolicyByID)
+	mux.HandleFunc("/v1/policies/test", h.handlePolicyTest)
+	mux.HandleFunc("/v1/policy-rules", h.handlePolicyRules)
+	mux.HandleFunc("/v1/policy-rules/history", h.handlePolicyRuleHistory)
+	mux.HandleFunc("/v1/drafts", h.handleDrafts)
+	mux.HandleFunc("/v1/drafts/", h.handleDraftByID)
+	mux.HandleFunc("/v1/admin/stats", h.handleAdminStats)
+	mux.HandleFunc("/v1/admin/orgs", h.handleAdminOrgs)
+	mux.HandleFunc("/v1/admin/orgs/merge", h.handleAdminOrgMerge)
+	mux.HandleFunc("/v1/admin/entitlements", h.handleAdminEntitlements)
+	mux.HandleFunc("/v1/admin/canary", h.handleAdminCanary)
+	mux.HandleFunc("/v1/admin/canary/orgs", h.handleAdminCanaryOrgs)
 }
 
 func (h *Handler) EnforceInboxLimit(ctx context.Context, orgID string) error {
@@ -117,19 +168,41 @@ func (h *Handler) handleCreateOrg(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Name string `json:"name"`
+		Name   string `json:"name"`
+		Region string `json:"region"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
+	region, err := h.canonicalRegion(req.Region)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	orgID, err := h.Store.CreateOrg(r.Context(), strings.TrimSpace(req.Name))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"org_id": orgID})
+	if region != "" {
+		if err := h.Store.SetOrgRegion(r.Context(), orgID, region); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	resp := map[string]any{"org_id": orgID, "region": h.displayRegion(region)}
+	if h.Config.Billing.TrialDays > 0 {
+		trial, err := entitlements.StartTrial(r.Context(), h.Store, orgID, time.Now(), h.Config.Billing.TrialDays)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp["plan_code"] = trial.PlanCode
+		resp["trial_ends_at"] = trial.TrialEndsAt.Time
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
 
 func (h *Handler) handleOrgRuntime(w http.ResponseWriter, r *http.Request) {
@@ -227,7 +300,9 @@ func (h *Handler) handleCheckout(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		OrgID string `json:"org_id"`
+		OrgID    string         `json:"org_id"`
+		PlanCode string         `json:"plan_code"`
+		AddOns   map[string]int `json:"add_ons"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
@@ -238,6 +313,18 @@ func (h *Handler) handleCheckout(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "missing org_id", http.StatusBadRequest)
 		return
 	}
+	order := billingCheckoutOrder{PlanCode: strings.TrimSpace(req.PlanCode), AddOns: req.AddOns}
+	if order.PlanCode == "" {
+		order.PlanCode = h.Config.Billing.DefaultPlan
+	}
+	if err := h.validateCheckoutOrder(r.Context(), order); err != nil {
+		status := http.StatusBadRequest
+		if !errors.Is(err, errInvalidOrder) {
+			status = http.StatusInternalServerError
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
 
 	if h.Checkout == nil {
 		// Fallback mock for tests
@@ -249,7 +336,7 @@ func (h *Handler) handleCheckout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := h.Checkout.CreateCheckoutSession(r.Context(), req.OrgID, "", "")
+	result, err := h.Checkout.CreateCheckoutSession(r.Context(), req.OrgID, order, "", "")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -334,6 +421,11 @@ func (h *Handler) handleIssueServiceToken(w http.ResponseWriter, r *http.Request
 		Scopes     []string `json:"scopes"`
 		TTLSeconds int      `json:"ttl_seconds"`
 		Rotate     bool     `json:"rotate"`
+		// CertThumbprint binds the token to the client certificate the
+		// caller will present to the runtime over mTLS (x5t#S256).
+		CertThumbprint string `json:"cert_thumbprint"`
+		// InboxIDs restricts the token to these inboxes of the org.
+		InboxIDs []string `json:"inbox_ids"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
@@ -364,7 +456,19 @@ func (h *Handler) handleIssueServiceToken(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	issued, err := h.Tokens.IssueServiceToken(r.Context(), req.OrgID, principal.ActorID, req.Scopes, ttl, req.Rotate)
+	req.CertThumbprint = strings.TrimSpace(req.CertThumbprint)
+	if req.CertThumbprint != "" && !validCertThumbprint(req.CertThumbprint) {
+		http.Error(w, "cert_thumbprint must be a base64url SHA-256 (x5t#S256)", http.StatusBadRequest)
+		return
+	}
+
+	inboxIDs, err := h.inboxAllowlist(r.Context(), req.OrgID, req.InboxIDs)
+	if err != nil {
+		writeInboxAllowlistError(w, err)
+		return
+	}
+
+	issued, err := h.Tokens.IssueServiceToken(r.Context(), req.OrgID, principal.ActorID, req.Scopes, inboxIDs, ttl, req.Rotate, req.CertThumbprint)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -378,8 +482,14 @@ type cloudAPIKeyResponse struct {
 	KeyPrefix string     `json:"key_prefix"`
 	Label     string     `json:"label"`
 	Scopes    []string   `json:"scopes"`
+	// InboxIDs lists the inboxes the key is restricted to, none if it may
+	// use all of the org's.
+	InboxIDs  []string   `json:"inbox_ids,omitempty"`
 	CreatedAt time.Time  `json:"created_at"`
 	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	// ExpiresAt is when a rotated key stops working.
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	RotatedFromID string     `json:"rotated_from_id,omitempty"`
 }
 
 type orgDomainResponse struct {
@@ -408,11 +518,14 @@ type domainVerifyResponse struct {
 }
 
 type inboxResponse struct {
-	ID          string    `json:"id"`
-	Address     string    `json:"address"`
-	Status      string    `json:"status"`
-	OrgDomainID *string   `json:"org_domain_id,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID                string    `json:"id"`
+	Address           string    `json:"address"`
+	Status            string    `json:"status"`
+	Provider          string    `json:"provider"`
+	Region            string    `json:"region,omitempty"`
+	OrgDomainID       *string   `json:"org_domain_id,omitempty"`
+	EmbeddingDisabled bool      `json:"embedding_disabled"`
+	CreatedAt         time.Time `json:"created_at"`
 }
 
 func (h *Handler) handleCloudAPIKeys(w http.ResponseWriter, r *http.Request) {
@@ -427,6 +540,10 @@ func (h *Handler) handleCloudAPIKeys(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) handleCloudAPIKeyByID(w http.ResponseWriter, r *http.Request) {
+	if keyID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/v1/keys/"), "/rotate"); ok {
+		h.handleRotateCloudAPIKey(w, r, keyID)
+		return
+	}
 	if r.Method != http.MethodDelete {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
@@ -472,6 +589,8 @@ func (h *Handler) handleCreateCloudAPIKey(w http.ResponseWriter, r *http.Request
 		OrgID  string   `json:"org_id"`
 		Label  string   `json:"label"`
 		Scopes []string `json:"scopes"`
+		// InboxIDs restricts the key to these inboxes of the org.
+		InboxIDs []string `json:"inbox_ids"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
@@ -494,6 +613,12 @@ func (h *Handler) handleCreateCloudAPIKey(w http.ResponseWriter, r *http.Request
 		}
 	}
 
+	inboxIDs, err := h.inboxAllowlist(r.Context(), orgID, req.InboxIDs)
+	if err != nil {
+		writeInboxAllowlistError(w, err)
+		return
+	}
+
 	rawKey, keyPrefix, keyHash, err := generateCloudAPIKeyMaterial()
 	if err != nil {
 		http.Error(w, "failed to generate key", http.StatusInternalServerError)
@@ -507,6 +632,7 @@ func (h *Handler) handleCreateCloudAPIKey(w http.ResponseWriter, r *http.Request
 		keyHash,
 		strings.TrimSpace(req.Label),
 		req.Scopes,
+		inboxIDs,
 	)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -519,6 +645,7 @@ func (h *Handler) handleCreateCloudAPIKey(w http.ResponseWriter, r *http.Request
 		KeyPrefix: record.KeyPrefix,
 		Label:     record.Label,
 		Scopes:    record.Scopes,
+		InboxIDs:  record.InboxIDs,
 		CreatedAt: record.CreatedAt,
 	}
 	writeJSON(w, http.StatusOK, response)
@@ -546,16 +673,22 @@ func (h *Handler) handleListCloudAPIKeys(w http.ResponseWriter, r *http.Request)
 	response := make([]cloudAPIKeyResponse, 0, len(keys))
 	for _, key := range keys {
 		item := cloudAPIKeyResponse{
-			ID:        key.ID,
-			KeyPrefix: key.KeyPrefix,
-			Label:     key.Label,
-			Scopes:    key.Scopes,
-			CreatedAt: key.CreatedAt,
+			ID:            key.ID,
+			KeyPrefix:     key.KeyPrefix,
+			Label:         key.Label,
+			Scopes:        key.Scopes,
+			InboxIDs:      key.InboxIDs,
+			CreatedAt:     key.CreatedAt,
+			RotatedFromID: key.RotatedFromID,
 		}
 		if key.RevokedAt.Valid {
 			revokedAt := key.RevokedAt.Time
 			item.RevokedAt = &revokedAt
 		}
+		if key.ExpiresAt.Valid {
+			expiresAt := key.ExpiresAt.Time
+			item.ExpiresAt = &expiresAt
+		}
 		response = append(response, item)
 	}
 
@@ -595,6 +728,27 @@ func (h *Handler) handleDomains(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) handleDomainByID(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/v1/domains/")
+	if domainID, ok := strings.CutSuffix(rest, "/dkim/rotate"); ok && domainID != "" && !strings.Contains(domainID, "/") {
+		h.handleRotateDomainDKIM(w, r, domainID)
+		return
+	}
+	if domainID, ok := strings.CutSuffix(rest, "/dkim"); ok && domainID != "" && !strings.Contains(domainID, "/") {
+		h.handleDomainDKIM(w, r, domainID)
+		return
+	}
+	if domainID, ok := strings.CutSuffix(rest, "/routing"); ok && domainID != "" && !strings.Contains(domainID, "/") {
+		h.handleDomainRouting(w, r, domainID)
+		return
+	}
+	if domainID, ok := strings.CutSuffix(rest, "/transport"); ok && domainID != "" && !strings.Contains(domainID, "/") {
+		h.handleDomainTransport(w, r, domainID)
+		return
+	}
+	if domainID, ok := strings.CutSuffix(rest, "/sending-limits"); ok && domainID != "" && !strings.Contains(domainID, "/") {
+		h.handleDomainSendingLimits(w, r, domainID)
+		return
+	}
 	if r.Method != http.MethodDelete {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
@@ -878,13 +1032,14 @@ func (h *Handler) handleVerifyDomain(w http.ResponseWriter, r *http.Request) {
 		h.Domains = domains.NewVerifier(nil)
 	}
 
-	result := h.Domains.VerifyOwnership(r.Context(), d.Domain, d.VerificationToken)
+	checks := h.Domains.CheckRecords(r.Context(), d, domains.ExpectationsFrom(h.Config))
+	result := checks.Ownership
 	status := d.Status
 	if result.Verified {
 		status = "active"
 	}
 
-	if err := h.Store.UpdateOrgDomainVerification(r.Context(), d.ID, false, false, false, false, status); err != nil {
+	if err := h.Store.UpdateOrgDomainVerification(r.Context(), d.ID, checks.MX.Verified, checks.SPF.Verified, checks.DKIM.Verified, checks.DMARC.Verified, status); err != nil {
 		if isUniqueViolation(err) {
 			http.Error(w, "domain already verified by another org", http.StatusConflict)
 			return
@@ -930,7 +1085,17 @@ func (h *Handler) handleVerifyDomain(w http.ResponseWriter, r *http.Request) {
 		Domain: out,
 		Checks: map[string]any{
 			"ownership_verified": result.Verified,
+			"mx_verified":        checks.MX.Verified,
+			"spf_verified":       checks.SPF.Verified,
+			"dkim_verified":      checks.DKIM.Verified,
+			"dmarc_verified":     checks.DMARC.Verified,
 			"details":            result.Details,
+			"records": map[string]domains.RecordCheck{
+				"mx":    checks.MX,
+				"spf":   checks.SPF,
+				"dkim":  checks.DKIM,
+				"dmarc": checks.DMARC,
+			},
 		},
 	})
 }
@@ -957,6 +1122,7 @@ func (h *Handler) handleCreateInbox(w http.ResponseWriter, r *http.Request) {
 		OrgID     string `json:"org_id"`
 		Address   string `json:"address"`
 		DomainID  string `json:"domain_id,omitempty"`
+		Provider  string `json:"provider,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
@@ -974,6 +1140,15 @@ func (h *Handler) handleCreateInbox(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	provider := strings.ToLower(strings.TrimSpace(req.Provider))
+	if provider != "" && !selectableInboxProvider(provider) {
+		http.Error(w, "provider must be jmap or imap", http.StatusBadRequest)
+		return
+	}
+	if provider == store.ProviderIMAP && !h.imapSelectable(canonical) {
+		http.Error(w, imapNotConfiguredMessage, http.StatusBadRequest)
+		return
+	}
 
 	if err := h.EnforceInboxLimit(r.Context(), orgID); err != nil {
 		if errors.Is(err, ErrMaxInboxesExceeded) {
@@ -984,7 +1159,10 @@ func (h *Handler) handleCreateInbox(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if existing, err := h.Store.GetInboxByAddress(r.Context(), canonical); err == nil && existing.ID != "" {
+	if existingID, alias, err := h.Store.ResolveInboxAddress(r.Context(), canonical); err == nil && alias != "" {
+		http.Error(w, "address is already an inbox alias", http.StatusConflict)
+		return
+	} else if err == nil && existingID != "" {
 		http.Error(w, "inbox already exists", http.StatusConflict)
 		return
 	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
@@ -1033,7 +1211,7 @@ func (h *Handler) handleCreateInbox(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	created, err := h.Store.CreateInboxForOrg(r.Context(), orgID, canonical, orgDomainID)
+	created, err := h.Store.CreateInboxForOrg(r.Context(), orgID, canonical, orgDomainID, provider)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -1047,11 +1225,14 @@ func (h *Handler) handleCreateInbox(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, map[string]any{
 		"inbox": inboxResponse{
-			ID:          created.ID,
-			Address:     created.Address,
-			Status:      created.Status,
-			OrgDomainID: domainID,
-			CreatedAt:   created.CreatedAt,
+			ID:                created.ID,
+			Address:           created.Address,
+			Status:            created.Status,
+			Provider:          created.Provider,
+			Region:            h.displayRegion(created.Region),
+			OrgDomainID:       domainID,
+			EmbeddingDisabled: created.EmbeddingDisabled,
+			CreatedAt:         created.CreatedAt,
 		},
 	})
 }
@@ -1083,11 +1264,14 @@ func (h *Handler) handleListInboxes(w http.ResponseWriter, r *http.Request) {
 			domainID = &v
 		}
 		resp = append(resp, inboxResponse{
-			ID:          item.ID,
-			Address:     item.Address,
-			Status:      item.Status,
-			OrgDomainID: domainID,
-			CreatedAt:   item.CreatedAt,
+			ID:                item.ID,
+			Address:           item.Address,
+			Status:            item.Status,
+			Provider:          item.Provider,
+			Region:            h.displayRegion(item.Region),
+			OrgDomainID:       domainID,
+			EmbeddingDisabled: item.EmbeddingDisabled,
+			CreatedAt:         item.CreatedAt,
 		})
 	}
 
@@ -1095,6 +1279,38 @@ func (h *Handler) handleListInboxes(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) handleInboxByID(w http.ResponseWriter, r *http.Request) {
+	if inboxID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/v1/inboxes/"), "/connect/gmail/confirm"); ok {
+		h.handleInboxGmailConfirm(w, r, inboxID)
+		return
+	}
+	if inboxID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/v1/inboxes/"), "/connect/gmail"); ok {
+		h.handleInboxGmailConnection(w, r, inboxID)
+		return
+	}
+	if inboxID, rest, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/inboxes/"), "/aliases"); ok && inboxID != "" && (rest == "" || strings.Count(rest, "/") == 1) {
+		h.handleInboxAliases(w, r, inboxID, strings.TrimPrefix(rest, "/"))
+		return
+	}
+	if inboxID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/v1/inboxes/"), "/closures"); ok && inboxID != "" && !strings.Contains(inboxID, "/") {
+		h.handleInboxClosures(w, r, inboxID)
+		return
+	}
+	if inboxID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/v1/inboxes/"), "/filters"); ok && inboxID != "" && !strings.Contains(inboxID, "/") {
+		h.handleInboxFilters(w, r, inboxID)
+		return
+	}
+	if inboxID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/v1/inboxes/"), "/sync"); ok && inboxID != "" && !strings.Contains(inboxID, "/") {
+		h.handleInboxSync(w, r, inboxID)
+		return
+	}
+	if inboxID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/v1/inboxes/"), "/backfill"); ok && inboxID != "" && !strings.Contains(inboxID, "/") {
+		h.handleInboxBackfill(w, r, inboxID)
+		return
+	}
+	if r.Method == http.MethodPatch {
+		h.handleUpdateInbox(w, r)
+		return
+	}
 	if r.Method != http.MethodDelete {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
@@ -1131,6 +1347,132 @@ func (h *Handler) handleInboxByID(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]any{"status": "disabled"})
 }
 
+// handleUpdateInbox changes an inbox's settings: its sync provider (JMAP or
+// IMAP), picked up by the poll loop on its next tick, whether its mail is
+// embedded, and its auto-close rule. Omitted fields are left unchanged.
+func (h *Handler) handleUpdateInbox(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireAnyScope(r, "nerve:admin.billing", "nerve:email.inbox.create")
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	inboxID := strings.TrimPrefix(r.URL.Path, "/v1/inboxes/")
+	if inboxID == "" || strings.Contains(inboxID, "/") {
+		http.Error(w, "missing inbox id", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		OrgID              string `json:"org_id"`
+		Provider           string `json:"provider"`
+		EmbeddingDisabled  *bool  `json:"embedding_disabled"`
+		AutoCloseAfterDays *int   `json:"auto_close_after_days"`
+		AutoCloseNudge     *bool  `json:"auto_close_nudge"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(req.OrgID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	provider := strings.ToLower(strings.TrimSpace(req.Provider))
+	if provider == "" && req.EmbeddingDisabled == nil && req.AutoCloseAfterDays == nil && req.AutoCloseNudge == nil {
+		http.Error(w, "nothing to update: set provider, embedding_disabled or auto_close_after_days", http.StatusBadRequest)
+		return
+	}
+	if req.AutoCloseAfterDays != nil && (*req.AutoCloseAfterDays < 0 || *req.AutoCloseAfterDays > maxAutoCloseDays) {
+		http.Error(w, "auto_close_after_days must be between 0 and 365", http.StatusBadRequest)
+		return
+	}
+	if provider != "" && !selectableInboxProvider(provider) {
+		http.Error(w, "provider must be jmap or imap", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if provider == store.ProviderIMAP {
+		inbox, err := h.Store.GetInboxRecordByIDForOrg(ctx, orgID, inboxID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "inbox not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !h.imapSelectable(inbox.Address) {
+			http.Error(w, imapNotConfiguredMessage, http.StatusBadRequest)
+			return
+		}
+	}
+	if provider != "" {
+		updated, err := h.Store.SetInboxProvider(ctx, orgID, inboxID, provider)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !updated {
+			http.Error(w, "inbox not found", http.StatusNotFound)
+			return
+		}
+	}
+	if req.EmbeddingDisabled != nil {
+		updated, err := h.Store.SetInboxEmbeddingDisabled(ctx, orgID, inboxID, *req.EmbeddingDisabled)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !updated {
+			http.Error(w, "inbox not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	if req.AutoCloseAfterDays != nil || req.AutoCloseNudge != nil {
+		rule, err := h.Store.GetInboxAutoClose(ctx, orgID, inboxID)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "inbox not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if req.AutoCloseAfterDays != nil {
+			rule.AfterDays = *req.AutoCloseAfterDays
+		}
+		if req.AutoCloseNudge != nil {
+			rule.Nudge = *req.AutoCloseNudge
+		}
+		if _, err := h.Store.SetInboxAutoClose(ctx, orgID, inboxID, rule); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	rec, err := h.Store.GetInboxRecordByIDForOrg(ctx, orgID, inboxID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rule, err := h.Store.GetInboxAutoClose(ctx, orgID, inboxID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":                    inboxID,
+		"provider":              rec.Provider,
+		"embedding_disabled":    rec.EmbeddingDisabled,
+		"auto_close_after_days": rule.AfterDays,
+		"auto_close_nudge":      rule.Nudge,
+	})
+}
+
 func (h *Handler) handleBillingPortal(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -1141,7 +1483,9 @@ func (h *Handler) handleBillingPortal(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var req struct {
-		OrgID string `json:"org_id"`
+		OrgID    string         `json:"org_id"`
+		PlanCode string         `json:"plan_code"`
+		AddOns   map[string]int `json:"add_ons"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
@@ -1152,6 +1496,18 @@ func (h *Handler) handleBillingPortal(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "missing org_id", http.StatusBadRequest)
 		return
 	}
+	order := billingCheckoutOrder{PlanCode: strings.TrimSpace(req.PlanCode), AddOns: req.AddOns}
+	if order.PlanCode == "" {
+		order.PlanCode = h.Config.Billing.DefaultPlan
+	}
+	if err := h.validateCheckoutOrder(r.Context(), order); err != nil {
+		status := http.StatusBadRequest
+		if !errors.Is(err, errInvalidOrder) {
+			status = http.StatusInternalServerError
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
 	if h.Checkout == nil {
 		// Fallback mock for tests
 		portalURL := fmt.Sprintf("https://billing.stripe.com/p/session/mock?org_id=%s", req.OrgID)
@@ -1234,7 +1590,7 @@ func resolveOrgIDForPrincipal(principal auth.Principal, orgIDCandidate string) (
 
 func allowedCloudKeyScope(scope string) bool {
 	switch scope {
-	case "nerve:email.read", "nerve:email.search", "nerve:email.draft", "nerve:email.send", "nerve:email.inbox.create":
+	case "nerve:email.read", "nerve:email.search", "nerve:email.search.org", "nerve:email.draft", "nerve:email.draft.review", "nerve:email.send", "nerve:email.manage", "nerve:email.inbox.create", "nerve:audit.read":
 		return true
 	default:
 		return false
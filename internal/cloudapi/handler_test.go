@@ -7,7 +7,9 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -15,7 +17,9 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -25,9 +29,14 @@ import (
 	"github.com/pressly/goose/v3"
 
 	"neuralmail/internal/auth"
+	"neuralmail/internal/autoclose"
+	"neuralmail/internal/billing"
+	"neuralmail/internal/canary"
 	"neuralmail/internal/config"
 	"neuralmail/internal/domains"
+	"neuralmail/internal/jmap"
 	"neuralmail/internal/store"
+	"neuralmail/internal/webhooks"
 )
 
 const testSigningKey = "test-signing-key-for-handler-tests"
@@ -43,7 +52,7 @@ type stubTokenIssuer struct {
 	lastTTL    time.Duration
 }
 
-func (s *stubTokenIssuer) IssueServiceToken(_ context.Context, _ string, _ string, scopes []string, ttl time.Duration, _ bool) (IssuedToken, error) {
+func (s *stubTokenIssuer) IssueServiceToken(_ context.Context, _ string, _ string, scopes []string, _ []string, ttl time.Duration, _ bool, _ string) (IssuedToken, error) {
 	s.lastScopes = scopes
 	s.lastTTL = ttl
 	return IssuedToken{
@@ -95,18 +104,39 @@ func TestControlPlaneAuthPermissionModel(t *testing.T) {
 		if rec.Code != http.StatusOK {
 			t.Fatalf("expected bootstrap admin to create org, got %d body=%s", rec.Code, rec.Body.String())
 		}
+		var created struct {
+			OrgID       string    `json:"org_id"`
+			PlanCode    string    `json:"plan_code"`
+			TrialEndsAt time.Time `json:"trial_ends_at"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+			t.Fatalf("decode org: %v", err)
+		}
+		ent, err := st.GetOrgEntitlement(ctx, created.OrgID)
+		if err != nil {
+			t.Fatalf("new org has no entitlement: %v", err)
+		}
+		if created.PlanCode != "trial" || ent.PlanCode != "trial" || ent.SubscriptionStatus != "trialing" {
+			t.Fatalf("expected the org to start on a trial, got %+v", ent)
+		}
+		if days := created.TrialEndsAt.Sub(time.Now()).Hours() / 24; days < 13 || days > 14 || !ent.TrialEndsAt.Valid {
+			t.Fatalf("expected a 14-day trial, got trial_ends_at=%s", created.TrialEndsAt)
+		}
 	})
 }
 
 func TestCheckoutClientReferenceIDMapping(t *testing.T) {
 	withTempStore(t, func(ctx context.Context, st *store.Store) {
-		_ = ctx
 		cfg := config.Default()
 		cfg.Security.APIKey = "bootstrap-admin"
 		handler := NewHandler(cfg, st, &auth.Service{Config: cfg, Now: time.Now}, &stubBilling{}, &stubTokenIssuer{})
 		mux := http.NewServeMux()
 		handler.RegisterRoutes(mux)
 
+		if _, err := st.DB().ExecContext(ctx, `INSERT INTO plan_entitlements (plan_code, mcp_rpm, monthly_units, max_inboxes) VALUES ('pro', 120, 1000, 10)`); err != nil {
+			t.Fatalf("insert plan: %v", err)
+		}
+
 		orgID := uuid.NewString()
 		req := jsonRequest(t, http.MethodPost, "/v1/subscriptions/checkout", map[string]any{"org_id": orgID})
 		req.Header.Set("X-API-Key", "bootstrap-admin")
@@ -129,6 +159,105 @@ func TestCheckoutClientReferenceIDMapping(t *testing.T) {
 	})
 }
 
+type stubCheckout struct {
+	orders []billing.CheckoutOrder
+}
+
+func (s *stubCheckout) CreateCheckoutSession(_ context.Context, orgID string, order billing.CheckoutOrder, _, _ string) (*billing.CheckoutResult, error) {
+	s.orders = append(s.orders, order)
+	return &billing.CheckoutResult{CheckoutURL: "https://checkout.stripe.test/" + order.PlanCode, ClientReferenceID: orgID}, nil
+}
+
+func (s *stubCheckout) CreateBillingPortalSession(_ context.Context, _ string) (*billing.PortalResult, error) {
+	return &billing.PortalResult{}, nil
+}
+
+func TestPlansCatalogAndCheckoutOrders(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		if _, err := st.DB().ExecContext(ctx, `
+			INSERT INTO plan_entitlements (plan_code, mcp_rpm, monthly_units, max_inboxes, display_name, monthly_price_cents, overage_cents_per_1000_units, listed)
+			VALUES ('pro', 120, 1000, 10, 'Pro', 4900, 200, true),
+			       ('scale', 600, 50000, 50, 'Scale', 29900, 100, true),
+			       ('legacy', 60, 500, 2, 'Legacy', 900, 0, false)
+		`); err != nil {
+			t.Fatalf("insert plans: %v", err)
+		}
+		if _, err := st.DB().ExecContext(ctx, `
+			INSERT INTO plan_addons (code, display_name, stripe_lookup_key, monthly_price_cents, extra_inboxes, extra_domains)
+			VALUES ('extra_inbox', 'Extra inbox', 'addon_inbox', 500, 1, 0),
+			       ('extra_domain', 'Extra domain', 'addon_domain', 1000, 0, 1)
+		`); err != nil {
+			t.Fatalf("insert add-ons: %v", err)
+		}
+
+		cfg := config.Default()
+		cfg.Security.APIKey = "bootstrap-admin"
+		handler := NewHandler(cfg, st, &auth.Service{Config: cfg, Now: time.Now}, &stubBilling{}, &stubTokenIssuer{})
+		checkout := &stubCheckout{}
+		handler.Checkout = checkout
+		mux := http.NewServeMux()
+		handler.RegisterRoutes(mux)
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/plans", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("plans: %d %s", rec.Code, rec.Body.String())
+		}
+		var catalog struct {
+			Plans []struct {
+				PlanCode string `json:"plan_code"`
+				Price    int64  `json:"monthly_price_cents"`
+				Overage  int64  `json:"overage_cents_per_1000_units"`
+				Default  bool   `json:"default"`
+			} `json:"plans"`
+			AddOns []struct {
+				Code         string `json:"code"`
+				ExtraDomains int    `json:"extra_domains"`
+			} `json:"add_ons"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &catalog); err != nil {
+			t.Fatalf("decode plans: %v", err)
+		}
+		if len(catalog.Plans) != 2 || catalog.Plans[0].PlanCode != "pro" || !catalog.Plans[0].Default || catalog.Plans[1].Overage != 100 {
+			t.Fatalf("unexpected plans %+v", catalog.Plans)
+		}
+		if len(catalog.AddOns) != 2 || catalog.AddOns[0].Code != "extra_domain" || catalog.AddOns[0].ExtraDomains != 1 {
+			t.Fatalf("unexpected add-ons %+v", catalog.AddOns)
+		}
+
+		orgID := uuid.NewString()
+		checkoutReq := func(body map[string]any) *httptest.ResponseRecorder {
+			body["org_id"] = orgID
+			req := jsonRequest(t, http.MethodPost, "/v1/subscriptions/checkout", body)
+			req.Header.Set("X-API-Key", "bootstrap-admin")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			return rec
+		}
+		if rec := checkoutReq(map[string]any{"plan_code": "scale", "add_ons": map[string]int{"extra_inbox": 3}}); rec.Code != http.StatusOK {
+			t.Fatalf("checkout: %d %s", rec.Code, rec.Body.String())
+		}
+		if rec := checkoutReq(map[string]any{}); rec.Code != http.StatusOK {
+			t.Fatalf("default checkout: %d %s", rec.Code, rec.Body.String())
+		}
+		if len(checkout.orders) != 2 || checkout.orders[0].PlanCode != "scale" || checkout.orders[0].AddOns["extra_inbox"] != 3 || checkout.orders[1].PlanCode != "pro" {
+			t.Fatalf("unexpected orders %+v", checkout.orders)
+		}
+		for _, body := range []map[string]any{
+			{"plan_code": "enterprise"},
+			{"plan_code": "pro", "add_ons": map[string]int{"extra_seat": 1}},
+			{"plan_code": "pro", "add_ons": map[string]int{"extra_inbox": 0}},
+		} {
+			if rec := checkoutReq(body); rec.Code != http.StatusBadRequest {
+				t.Fatalf("checkout %v: expected 400, got %d", body, rec.Code)
+			}
+		}
+		if len(checkout.orders) != 2 {
+			t.Fatalf("invalid orders reached checkout: %+v", checkout.orders)
+		}
+	})
+}
+
 func TestTokenIssuanceValidatesScopeAndTTL(t *testing.T) {
 	withTempStore(t, func(ctx context.Context, st *store.Store) {
 		cfg := config.Default()
@@ -166,6 +295,18 @@ func TestTokenIssuanceValidatesScopeAndTTL(t *testing.T) {
 			t.Fatalf("expected ttl validation rejection, got %d", rec.Code)
 		}
 
+		req = jsonRequest(t, http.MethodPost, "/v1/tokens/service", map[string]any{
+			"org_id":          orgID,
+			"scopes":          []string{"nerve:email.read"},
+			"cert_thumbprint": "not-a-thumbprint",
+		})
+		req.Header.Set("X-API-Key", "bootstrap-admin")
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected cert_thumbprint validation rejection, got %d", rec.Code)
+		}
+
 		req = jsonRequest(t, http.MethodPost, "/v1/tokens/service", map[string]any{
 			"org_id":      orgID,
 			"scopes":      []string{"nerve:email.read"},
@@ -306,6 +447,85 @@ func TestCloudAPIKeysCreateListAndRevoke(t *testing.T) {
 	})
 }
 
+func TestCloudAPIKeyRotationOverlapsOldKey(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		cfg := config.Default()
+		cfg.Security.APIKey = "bootstrap-admin"
+		cfg.Security.KeyRotationGrace = time.Hour
+		handler := NewHandler(cfg, st, &auth.Service{Config: cfg, Now: time.Now}, &stubBilling{}, &stubTokenIssuer{})
+		mux := http.NewServeMux()
+		handler.RegisterRoutes(mux)
+
+		orgID, err := st.CreateOrg(ctx, "rotate-org")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+		do := func(method, target string, body any) *httptest.ResponseRecorder {
+			req := jsonRequest(t, method, target, body)
+			req.Header.Set("X-API-Key", "bootstrap-admin")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			return rec
+		}
+
+		rec := do(http.MethodPost, "/v1/keys", map[string]any{
+			"org_id": orgID,
+			"label":  "CI",
+			"scopes": []string{"nerve:email.read"},
+		})
+		var original cloudAPIKeyResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &original); err != nil || original.ID == "" {
+			t.Fatalf("create key: %d %s", rec.Code, rec.Body.String())
+		}
+
+		rotatePath := "/v1/keys/" + original.ID + "/rotate?org_id=" + url.QueryEscape(orgID)
+		rec = do(http.MethodPost, rotatePath, map[string]any{})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected rotation success, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		var rotated rotatedCloudAPIKeyResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &rotated); err != nil {
+			t.Fatalf("decode rotation: %v", err)
+		}
+		if rotated.Key == "" || rotated.ID == original.ID || rotated.RotatedFromID != original.ID || rotated.Label != "CI" {
+			t.Fatalf("unexpected replacement key %+v", rotated)
+		}
+		if d := time.Until(rotated.PreviousExpiresAt); d < 59*time.Minute || d > time.Hour {
+			t.Fatalf("expected old key to expire after the configured grace, got %s", rotated.PreviousExpiresAt)
+		}
+
+		oldSum := sha256.Sum256([]byte(original.Key))
+		old, err := st.LookupCloudAPIKey(ctx, hex.EncodeToString(oldSum[:]))
+		if err != nil {
+			t.Fatalf("lookup old key: %v", err)
+		}
+		if old.RevokedAt.Valid || !old.ExpiresAt.Valid {
+			t.Fatalf("expected old key to stay active with an expiry, got %+v", old)
+		}
+		authSvc := auth.NewService(cfg, st)
+		if _, err := authSvc.VerifyCloudAPIKey(ctx, original.Key); err != nil {
+			t.Fatalf("expected old key to work during the grace window: %v", err)
+		}
+		if _, err := authSvc.VerifyCloudAPIKey(ctx, rotated.Key); err != nil {
+			t.Fatalf("expected replacement key to work: %v", err)
+		}
+
+		if rec := do(http.MethodPost, rotatePath, map[string]any{}); rec.Code != http.StatusConflict {
+			t.Fatalf("expected second rotation of the same key to conflict, got %d", rec.Code)
+		}
+		rec = do(http.MethodPost, "/v1/keys/"+rotated.ID+"/rotate?org_id="+url.QueryEscape(orgID), map[string]any{"grace_seconds": 0})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected rotating the replacement to succeed, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		if _, err := authSvc.VerifyCloudAPIKey(ctx, rotated.Key); !errors.Is(err, auth.ErrUnauthorized) {
+			t.Fatalf("expected key rotated without grace to stop working, got %v", err)
+		}
+		if rec := do(http.MethodPost, rotatePath, map[string]any{"grace_seconds": -1}); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected negative grace to be rejected, got %d", rec.Code)
+		}
+	})
+}
+
 func TestOrgRuntimeConfigGetAndPut(t *testing.T) {
 	withTempStore(t, func(ctx context.Context, st *store.Store) {
 		cfg := config.Default()
@@ -687,6 +907,185 @@ func signedJWTForTest(t *testing.T, claims jwtlib.MapClaims) string {
 	return signed
 }
 
+func TestAdminOrgMergeDryRunThenMerge(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		cfg := config.Default()
+		cfg.Security.APIKey = "bootstrap-admin"
+		cfg.Cloud.Mode = true
+		handler := NewHandler(cfg, st, &auth.Service{Config: cfg, Now: time.Now}, &stubBilling{}, &stubTokenIssuer{})
+		mux := http.NewServeMux()
+		handler.RegisterRoutes(mux)
+
+		sourceID, err := st.CreateOrg(ctx, "acquired-org")
+		if err != nil {
+			t.Fatalf("create source org: %v", err)
+		}
+		targetID, err := st.CreateOrg(ctx, "acquiring-org")
+		if err != nil {
+			t.Fatalf("create target org: %v", err)
+		}
+		inbox, err := st.CreateInboxForOrg(ctx, sourceID, "support@acquired.test", "", store.ProviderJMAP)
+		if err != nil {
+			t.Fatalf("create inbox: %v", err)
+		}
+		if _, err := st.CreateCloudAPIKey(ctx, sourceID, "nm_live_merge", "merge-key-hash", "ci", []string{"nerve:email.read"}, nil); err != nil {
+			t.Fatalf("create key: %v", err)
+		}
+		threadID, err := st.EnsureThread(ctx, inbox.ID, "crm-thread", "Quote", nil)
+		if err != nil {
+			t.Fatalf("create thread: %v", err)
+		}
+		if _, err := st.PutCRMLink(ctx, store.CRMLink{ThreadID: threadID, Provider: "hubspot", Kind: "sales", TicketID: "ticket-1"}); err != nil {
+			t.Fatalf("link thread: %v", err)
+		}
+		for orgID, token := range map[string]string{sourceID: "source-token", targetID: "target-token"} {
+			if _, err := st.PutCRMConnection(ctx, store.CRMConnection{OrgID: orgID, Provider: "hubspot", AccessToken: token}); err != nil {
+				t.Fatalf("connect crm: %v", err)
+			}
+		}
+		rule, err := st.CreateAutomationRule(ctx, store.AutomationRule{
+			OrgID: sourceID, InboxID: inbox.ID, Name: "Tag quotes", Enabled: true,
+			Actions: []store.RuleAction{{Type: store.RuleActionLabel, Value: "quote"}},
+		})
+		if err != nil {
+			t.Fatalf("create rule: %v", err)
+		}
+		if err := st.RecordAutomationRuleRun(ctx, store.AutomationRuleRun{OrgID: sourceID, RuleID: rule.ID, MessageID: uuid.NewString(), ThreadID: threadID}); err != nil {
+			t.Fatalf("record rule run: %v", err)
+		}
+		targetInbox, err := st.CreateInboxForOrg(ctx, targetID, "sales@acquiring.test", "", store.ProviderJMAP)
+		if err != nil {
+			t.Fatalf("create target inbox: %v", err)
+		}
+		targetThreadID, err := st.EnsureThread(ctx, targetInbox.ID, "target-thread", "Renewal", nil)
+		if err != nil {
+			t.Fatalf("create target thread: %v", err)
+		}
+		seen := time.Now().UTC().Add(-time.Hour)
+		for _, c := range []struct {
+			inboxID, threadID, email string
+		}{
+			{inbox.ID, threadID, "ana+quotes@example.com"},
+			{inbox.ID, threadID, "bob@example.com"},
+			{targetInbox.ID, targetThreadID, "ana@example.com"},
+		} {
+			if err := st.RecordContact(ctx, c.inboxID, c.threadID, store.Participant{Email: c.email}, seen); err != nil {
+				t.Fatalf("record contact: %v", err)
+			}
+		}
+
+		merge := func(dryRun bool) (*httptest.ResponseRecorder, store.OrgMergeReport) {
+			req := jsonRequest(t, http.MethodPost, "/v1/admin/orgs/merge", map[string]any{
+				"source_org_id": sourceID,
+				"target_org_id": targetID,
+				"dry_run":       dryRun,
+			})
+			req.Header.Set("X-API-Key", "bootstrap-admin")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			var report store.OrgMergeReport
+			_ = json.Unmarshal(rec.Body.Bytes(), &report)
+			return rec, report
+		}
+
+		rec, report := merge(true)
+		if rec.Code != http.StatusOK || report.Moved["inboxes"] != 1 || report.Moved["cloud_api_keys"] != 1 {
+			t.Fatalf("expected a dry run moving 1 inbox and 1 key, got %d %s", rec.Code, rec.Body.String())
+		}
+		if report.Moved["crm_links"] != 1 || report.Dropped["crm_connections"] != 1 {
+			t.Fatalf("expected the crm link moved and the source's crm connection dropped, got %s", rec.Body.String())
+		}
+		if report.Moved["contacts"] != 1 || report.Dropped["contacts"] != 1 || report.Moved["contact_threads"] != 1 {
+			t.Fatalf("expected bob moved and ana folded into the target's contact, got %s", rec.Body.String())
+		}
+		if report.Moved["automation_rules"] != 1 || report.Moved["automation_rule_runs"] != 1 {
+			t.Fatalf("expected the automation rule and its run moved, got %s", rec.Body.String())
+		}
+		if ids, _ := st.ListInboxesByOrg(ctx, sourceID); len(ids) != 1 {
+			t.Fatalf("expected the dry run to change nothing, source has %v", ids)
+		}
+
+		if rec, _ := merge(false); rec.Code != http.StatusOK {
+			t.Fatalf("expected merge success, got %d %s", rec.Code, rec.Body.String())
+		}
+		if ids, _ := st.ListInboxesByOrg(ctx, targetID); len(ids) != 2 || !slices.Contains(ids, inbox.ID) {
+			t.Fatalf("expected the inbox in the target, got %v", ids)
+		}
+		if merged, err := st.MergedOrgID(ctx, sourceID); err != nil || merged != targetID {
+			t.Fatalf("expected the source to point at the target, got %q %v", merged, err)
+		}
+		if rules, err := st.ListInboxAutomationRules(ctx, inbox.ID); err != nil || len(rules) != 1 || rules[0].ID != rule.ID || rules[0].OrgID != targetID {
+			t.Fatalf("expected the moved inbox's rule to keep running in the target, got %+v %v", rules, err)
+		}
+		if runs, err := st.ListAutomationRuleRuns(ctx, targetID, rule.ID, 10); err != nil || len(runs) != 1 {
+			t.Fatalf("expected the rule's run history in the target, got %+v %v", runs, err)
+		}
+		if link, err := st.GetCRMLink(ctx, threadID); err != nil || link.OrgID != targetID {
+			t.Fatalf("expected the crm link in the target, got %+v %v", link, err)
+		}
+		if conn, err := st.GetCRMConnection(ctx, targetID); err != nil || conn.AccessToken != "target-token" {
+			t.Fatalf("expected the target to keep its crm connection, got %+v %v", conn, err)
+		}
+		ana, err := st.GetContactByEmail(ctx, targetID, "ana@example.com")
+		if err != nil || ana.ThreadCount != 2 || len(ana.Emails) != 2 {
+			t.Fatalf("expected one contact for ana with both threads and addresses, got %+v %v", ana, err)
+		}
+		if bob, err := st.GetContactByEmail(ctx, targetID, "bob@example.com"); err != nil || bob.ThreadCount != 1 {
+			t.Fatalf("expected bob's contact in the target, got %+v %v", bob, err)
+		}
+
+		rec, report = merge(false)
+		if rec.Code != http.StatusConflict || len(report.Conflicts) == 0 {
+			t.Fatalf("expected merging a merged org to conflict, got %d %s", rec.Code, rec.Body.String())
+		}
+	})
+}
+
+func TestAdminEntitlementsSetPlanThenOverride(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		cfg := config.Default()
+		cfg.Security.APIKey = "bootstrap-admin"
+		cfg.Cloud.Mode = true
+		handler := NewHandler(cfg, st, &auth.Service{Config: cfg, Now: time.Now}, &stubBilling{}, &stubTokenIssuer{})
+		mux := http.NewServeMux()
+		handler.RegisterRoutes(mux)
+
+		orgID, err := st.CreateOrg(ctx, "invoiced-org")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+		put := func(body map[string]any) (*httptest.ResponseRecorder, map[string]any) {
+			req := jsonRequest(t, http.MethodPut, "/v1/admin/entitlements", body)
+			req.Header.Set("X-API-Key", "bootstrap-admin")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			var out map[string]any
+			_ = json.Unmarshal(rec.Body.Bytes(), &out)
+			return rec, out
+		}
+
+		if rec, _ := put(map[string]any{"org_id": orgID, "max_inboxes": 5}); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected a plan to be required for a new org, got %d %s", rec.Code, rec.Body.String())
+		}
+		rec, out := put(map[string]any{"org_id": orgID, "plan_code": "trial"})
+		if rec.Code != http.StatusOK || out["plan_code"] != "trial" || out["max_inboxes"] != float64(1) {
+			t.Fatalf("expected the trial plan's limits, got %d %s", rec.Code, rec.Body.String())
+		}
+		rec, out = put(map[string]any{"org_id": orgID, "max_inboxes": 5, "subscription_status": "past_due"})
+		if rec.Code != http.StatusOK || out["plan_code"] != "trial" || out["max_inboxes"] != float64(5) || out["subscription_status"] != "past_due" {
+			t.Fatalf("expected the override on top of the plan, got %d %s", rec.Code, rec.Body.String())
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/admin/orgs", nil)
+		req.Header.Set("X-API-Key", "bootstrap-admin")
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), orgID) {
+			t.Fatalf("expected the org listed, got %d %s", rec.Code, rec.Body.String())
+		}
+	})
+}
+
 func withTempStore(t *testing.T, run func(ctx context.Context, st *store.Store)) {
 	t.Helper()
 
@@ -755,3 +1154,1365 @@ func migrationDir(t *testing.T) string {
 	}
 	return filepath.Join(filepath.Dir(currentFile), "..", "store", "migrations")
 }
+
+func TestDraftReviewQueueApproveAndReject(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		cfg := config.Default()
+		cfg.Security.APIKey = "bootstrap-admin"
+		cfg.Cloud.Mode = true
+		handler := NewHandler(cfg, st, &auth.Service{Config: cfg, Now: time.Now}, &stubBilling{}, &stubTokenIssuer{})
+		mux := http.NewServeMux()
+		handler.RegisterRoutes(mux)
+
+		orgID, err := st.CreateOrg(ctx, "drafts-org")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+		inboxID := uuid.NewString()
+		if _, err := st.DB().ExecContext(ctx, `INSERT INTO inboxes (id, org_id, address, status) VALUES ($1, $2, 'review@local.neuralmail', 'active')`, inboxID, orgID); err != nil {
+			t.Fatalf("create inbox: %v", err)
+		}
+		threadID, err := st.EnsureThread(ctx, inboxID, "provider-"+uuid.NewString(), "Refund", nil)
+		if err != nil {
+			t.Fatalf("create thread: %v", err)
+		}
+		draftID, err := st.CreateDraft(ctx, threadID, "reply", store.DraftRevision{Body: "We will refund $500.", NeedsApproval: true})
+		if err != nil {
+			t.Fatalf("create draft: %v", err)
+		}
+
+		do := func(method, target string, body any) *httptest.ResponseRecorder {
+			req := jsonRequest(t, method, target, body)
+			req.Header.Set("X-API-Key", "bootstrap-admin")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			return rec
+		}
+
+		rec := do(http.MethodGet, "/v1/drafts?org_id="+orgID, nil)
+		var queue struct {
+			Drafts []struct {
+				ID     string `json:"id"`
+				Status string `json:"status"`
+				Latest struct {
+					Revision int    `json:"revision"`
+					Body     string `json:"body"`
+				} `json:"latest"`
+			} `json:"drafts"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &queue); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("list drafts: %d %s", rec.Code, rec.Body.String())
+		}
+		if len(queue.Drafts) != 1 || queue.Drafts[0].ID != draftID || queue.Drafts[0].Latest.Revision != 1 {
+			t.Fatalf("expected the draft in the review queue, got %+v", queue.Drafts)
+		}
+
+		if rec := do(http.MethodPost, "/v1/drafts/"+draftID+"/reject?org_id="+orgID, map[string]any{}); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected reject without reason to fail, got %d", rec.Code)
+		}
+		if rec := do(http.MethodPost, "/v1/drafts/"+draftID+"/approve?org_id="+orgID, map[string]any{"revision": 2}); rec.Code != http.StatusConflict {
+			t.Fatalf("expected approval of an unseen revision to conflict, got %d", rec.Code)
+		}
+		rec = do(http.MethodPost, "/v1/drafts/"+draftID+"/approve?org_id="+orgID, map[string]any{"revision": 1, "note": "ok"})
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"approved"`) {
+			t.Fatalf("expected approval, got %d %s", rec.Code, rec.Body.String())
+		}
+
+		rec = do(http.MethodGet, "/v1/drafts?org_id="+orgID, nil)
+		if err := json.Unmarshal(rec.Body.Bytes(), &queue); err != nil || len(queue.Drafts) != 0 {
+			t.Fatalf("expected an empty review queue after approval, got %s", rec.Body.String())
+		}
+
+		if sent, err := st.MarkDraftSent(ctx, draftID, uuid.NewString()); err != nil || !sent {
+			t.Fatalf("mark sent: %v %v", sent, err)
+		}
+		if rec := do(http.MethodPost, "/v1/drafts/"+draftID+"/reject?org_id="+orgID, map[string]any{"reason": "too late"}); rec.Code != http.StatusConflict {
+			t.Fatalf("expected a sent draft to be final, got %d", rec.Code)
+		}
+		if rec := do(http.MethodGet, "/v1/drafts/"+draftID+"?org_id="+uuid.NewString(), nil); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected another org's draft to be hidden, got %d", rec.Code)
+		}
+	})
+}
+
+func TestInboxAliasesCreateListAndDelete(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		cfg := config.Default()
+		cfg.Security.APIKey = "bootstrap-admin"
+		cfg.Cloud.Mode = true
+		handler := NewHandler(cfg, st, &auth.Service{Config: cfg, Now: time.Now}, &stubBilling{}, &stubTokenIssuer{})
+		mux := http.NewServeMux()
+		handler.RegisterRoutes(mux)
+
+		orgID, err := st.CreateOrg(ctx, "aliases-org")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+		if _, err := st.DB().ExecContext(ctx, `INSERT INTO org_domains (org_id, domain, status, verification_token) VALUES ($1, 'acme.com', 'active', 'token')`, orgID); err != nil {
+			t.Fatalf("create domain: %v", err)
+		}
+		inboxID := uuid.NewString()
+		if _, err := st.DB().ExecContext(ctx, `INSERT INTO inboxes (id, org_id, address, status) VALUES ($1, $2, 'support@acme.com', 'active')`, inboxID, orgID); err != nil {
+			t.Fatalf("create inbox: %v", err)
+		}
+
+		do := func(method, target string, body any) *httptest.ResponseRecorder {
+			req := jsonRequest(t, method, target, body)
+			req.Header.Set("X-API-Key", "bootstrap-admin")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			return rec
+		}
+		aliasesURL := "/v1/inboxes/" + inboxID + "/aliases?org_id=" + orgID
+
+		rec := do(http.MethodPost, aliasesURL, map[string]any{"address": "Billing@Acme.com", "route": "billing"})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected alias create success, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		var created struct {
+			Alias struct {
+				ID      string `json:"id"`
+				Address string `json:"address"`
+				Route   string `json:"route"`
+			} `json:"alias"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+			t.Fatalf("decode alias create response: %v", err)
+		}
+		if created.Alias.Address != "billing@acme.com" || created.Alias.Route != "billing" {
+			t.Fatalf("unexpected alias payload: %+v", created.Alias)
+		}
+
+		// Addresses resolve to one inbox, so neither an alias nor an inbox can
+		// reuse one, and aliases need a verified domain of the org.
+		if rec := do(http.MethodPost, aliasesURL, map[string]any{"address": "support@acme.com"}); rec.Code != http.StatusConflict {
+			t.Fatalf("expected 409 for inbox address, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		if rec := do(http.MethodPost, aliasesURL, map[string]any{"address": "billing@acme.com"}); rec.Code != http.StatusConflict {
+			t.Fatalf("expected 409 for duplicate alias, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		if rec := do(http.MethodPost, "/v1/inboxes", map[string]any{"org_id": orgID, "address": "billing@acme.com"}); rec.Code != http.StatusConflict {
+			t.Fatalf("expected 409 creating inbox on alias address, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		if rec := do(http.MethodPost, aliasesURL, map[string]any{"address": "sales@other.com"}); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for unverified domain, got %d body=%s", rec.Code, rec.Body.String())
+		}
+
+		gotInbox, alias, err := st.ResolveInboxAddress(ctx, "BILLING@acme.com")
+		if err != nil || gotInbox != inboxID || alias != "billing@acme.com" {
+			t.Fatalf("resolve alias: inbox=%q alias=%q err=%v", gotInbox, alias, err)
+		}
+
+		otherOrgID, err := st.CreateOrg(ctx, "other-org")
+		if err != nil {
+			t.Fatalf("create other org: %v", err)
+		}
+		if rec := do(http.MethodGet, "/v1/inboxes/"+inboxID+"/aliases?org_id="+otherOrgID, nil); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for another org's inbox, got %d body=%s", rec.Code, rec.Body.String())
+		}
+
+		rec = do(http.MethodGet, aliasesURL, nil)
+		var listed struct {
+			Aliases []struct {
+				ID string `json:"id"`
+			} `json:"aliases"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil {
+			t.Fatalf("decode alias list response: %v", err)
+		}
+		if len(listed.Aliases) != 1 || listed.Aliases[0].ID != created.Alias.ID {
+			t.Fatalf("expected one listed alias, got %+v", listed.Aliases)
+		}
+
+		aliasURL := "/v1/inboxes/" + inboxID + "/aliases/" + created.Alias.ID + "?org_id=" + orgID
+		if rec := do(http.MethodDelete, aliasURL, nil); rec.Code != http.StatusOK {
+			t.Fatalf("expected alias delete success, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		if rec := do(http.MethodDelete, aliasURL, nil); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 deleting a deleted alias, got %d body=%s", rec.Code, rec.Body.String())
+		}
+	})
+}
+
+func TestAuditAndUsageForOrg(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		cfg := config.Default()
+		cfg.Security.APIKey = "bootstrap-admin"
+		cfg.Cloud.Mode = true
+		handler := NewHandler(cfg, st, &auth.Service{Config: cfg, Now: time.Now}, &stubBilling{}, &stubTokenIssuer{})
+		mux := http.NewServeMux()
+		handler.RegisterRoutes(mux)
+
+		orgID, err := st.CreateOrg(ctx, "audit-org")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+		otherOrgID, err := st.CreateOrg(ctx, "other-audit-org")
+		if err != nil {
+			t.Fatalf("create other org: %v", err)
+		}
+		record := func(org, tool, status string) {
+			callID, err := st.RecordToolCall(ctx, tool, "", "", "", 12)
+			if err != nil {
+				t.Fatalf("record tool call: %v", err)
+			}
+			if err := st.RecordAudit(ctx, store.AuditRecord{ToolCallID: callID, Actor: "mcp", InputsHash: "in", OutputsHash: "out"}); err != nil {
+				t.Fatalf("record audit: %v", err)
+			}
+			if err := st.RecordUsageEvent(ctx, org, "mcp_units", 2, 2, tool, "", callID, status, false); err != nil {
+				t.Fatalf("record usage: %v", err)
+			}
+		}
+		record(orgID, "search_inbox", "success")
+		record(orgID, "triage_message", "success")
+		record(orgID, "search_inbox", "failed")
+		record(otherOrgID, "search_inbox", "success")
+
+		get := func(target string) *httptest.ResponseRecorder {
+			req := jsonRequest(t, http.MethodGet, target, nil)
+			req.Header.Set("X-API-Key", "bootstrap-admin")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			return rec
+		}
+
+		rec := get("/v1/audit?org_id=" + orgID + "&tool=search_inbox")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected audit success, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		var audit struct {
+			Entries []struct {
+				ToolName    string    `json:"tool_name"`
+				UsageStatus string    `json:"usage_status"`
+				CreatedAt   time.Time `json:"created_at"`
+			} `json:"entries"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &audit); err != nil {
+			t.Fatalf("decode audit response: %v", err)
+		}
+		if len(audit.Entries) != 2 || audit.Entries[0].UsageStatus != "success" || audit.Entries[1].UsageStatus != "failed" {
+			t.Fatalf("expected the org's two search_inbox calls oldest first, got %+v", audit.Entries)
+		}
+
+		// Following the log from the last entry returns nothing new.
+		rec = get("/v1/audit?org_id=" + orgID + "&since=" + url.QueryEscape(audit.Entries[1].CreatedAt.Format(time.RFC3339Nano)))
+		if err := json.Unmarshal(rec.Body.Bytes(), &audit); err != nil {
+			t.Fatalf("decode audit response: %v", err)
+		}
+		if len(audit.Entries) != 0 {
+			t.Fatalf("expected no entries after the last one, got %+v", audit.Entries)
+		}
+
+		// Paging from the start of the range visits every entry once.
+		var seen int
+		next := "/v1/audit?org_id=" + orgID + "&limit=2&since=" + url.QueryEscape(time.Unix(0, 0).UTC().Format(time.RFC3339))
+		for next != "" {
+			rec = get(next)
+			var page struct {
+				Entries    []json.RawMessage `json:"entries"`
+				NextCursor string            `json:"next_cursor"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+				t.Fatalf("decode audit page: %v", err)
+			}
+			seen += len(page.Entries)
+			next = ""
+			if page.NextCursor != "" {
+				next = "/v1/audit?org_id=" + orgID + "&limit=2&cursor=" + page.NextCursor
+			}
+		}
+		if seen != 3 {
+			t.Fatalf("expected to page through the org's 3 entries, saw %d", seen)
+		}
+
+		rec = get("/v1/usage?org_id=" + orgID + "&period=7d")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected usage success, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		var usage struct {
+			Totals map[string]int64 `json:"totals"`
+			Tools  []struct {
+				ToolName string `json:"tool_name"`
+				Calls    int64  `json:"calls"`
+				Units    int64  `json:"units"`
+				Failed   int64  `json:"failed"`
+			} `json:"tools"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &usage); err != nil {
+			t.Fatalf("decode usage response: %v", err)
+		}
+		if usage.Totals["calls"] != 3 || usage.Totals["units"] != 4 || usage.Totals["failed"] != 1 {
+			t.Fatalf("unexpected usage totals: %+v", usage.Totals)
+		}
+		if len(usage.Tools) != 2 || usage.Tools[0].ToolName != "search_inbox" || usage.Tools[0].Units != 2 || usage.Tools[0].Failed != 1 {
+			t.Fatalf("unexpected usage by tool: %+v", usage.Tools)
+		}
+
+		if rec := get("/v1/usage?org_id=" + orgID + "&period=last-week"); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for an unknown period, got %d", rec.Code)
+		}
+
+		today := time.Now().UTC().Format(time.DateOnly)
+		tomorrow := time.Now().UTC().AddDate(0, 0, 1).Format(time.DateOnly)
+		rec = get("/v1/usage/meters?org_id=" + orgID + "&from=" + today + "&to=" + tomorrow)
+		var meters struct {
+			Period string `json:"period"`
+			Meters []struct {
+				MeterName string `json:"meter_name"`
+				Calls     int64  `json:"calls"`
+				Units     int64  `json:"units"`
+			} `json:"meters"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &meters); err != nil {
+			t.Fatalf("decode meters response: %d %v", rec.Code, err)
+		}
+		if meters.Period != "range" || len(meters.Meters) != 1 || meters.Meters[0].Calls != 3 || meters.Meters[0].Units != 4 {
+			t.Fatalf("unexpected usage by meter: %+v", meters)
+		}
+
+		rec = get("/v1/usage/daily?org_id=" + orgID + "&period=7d&format=csv")
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+			t.Fatalf("expected daily csv, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+		}
+		if want := "day,meter_name,calls,units,failed\n" + today + ",mcp_units,3,4,1\n"; rec.Body.String() != want {
+			t.Fatalf("unexpected daily csv:\n%s", rec.Body.String())
+		}
+
+		rec = get("/v1/usage/export?org_id=" + orgID + "&period=7d")
+		if !strings.Contains(rec.Header().Get("Content-Disposition"), "attachment") {
+			t.Fatalf("expected export as an attachment, got %q", rec.Header().Get("Content-Disposition"))
+		}
+		if want := "day,meter_name,tool_name,calls,units,failed\n" +
+			today + ",mcp_units,search_inbox,2,2,1\n" +
+			today + ",mcp_units,triage_message,1,2,0\n"; rec.Body.String() != want {
+			t.Fatalf("unexpected export csv:\n%s", rec.Body.String())
+		}
+
+		if rec := get("/v1/usage/export?org_id=" + orgID + "&from=" + today); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for from without to, got %d", rec.Code)
+		}
+		if rec := get("/v1/usage/meters?org_id=" + orgID + "&format=xml"); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for an unknown format, got %d", rec.Code)
+		}
+	})
+}
+
+func TestOrgSearchRerankGetAndPut(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		cfg := config.Default()
+		cfg.Security.APIKey = "bootstrap-admin"
+		cfg.Cloud.Mode = true
+		cfg.Rerank.Provider = "cross_encoder"
+		handler := NewHandler(cfg, st, &auth.Service{Config: cfg, Now: time.Now}, &stubBilling{}, &stubTokenIssuer{})
+		mux := http.NewServeMux()
+		handler.RegisterRoutes(mux)
+
+		orgID, err := st.CreateOrg(ctx, "rerank-org")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+		call := func(method string, body any) (*httptest.ResponseRecorder, map[string]any) {
+			target := "/v1/orgs/search-rerank"
+			if method == http.MethodGet {
+				target += "?org_id=" + orgID
+			}
+			req := jsonRequest(t, method, target, body)
+			req.Header.Set("X-API-Key", "bootstrap-admin")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			var resp map[string]any
+			_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+			return rec, resp
+		}
+
+		rec, resp := call(http.MethodGet, nil)
+		if rec.Code != http.StatusOK || resp["enabled"] != false || resp["latency_budget_ms"] != float64(300) {
+			t.Fatalf("expected rerank off with the default budget, got %d %v", rec.Code, resp)
+		}
+		rec, resp = call(http.MethodPut, map[string]any{"org_id": orgID, "enabled": true, "latency_budget_ms": 800})
+		if rec.Code != http.StatusOK || resp["enabled"] != true || resp["latency_budget_ms"] != float64(800) {
+			t.Fatalf("expected rerank on with an 800ms budget, got %d %v", rec.Code, resp)
+		}
+		if rec, _ := call(http.MethodPut, map[string]any{"org_id": orgID, "enabled": true, "latency_budget_ms": 60000}); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for an oversized budget, got %d", rec.Code)
+		}
+	})
+}
+
+func TestOrgSearchLanguageSetAndReindex(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		cfg := config.Default()
+		cfg.Security.APIKey = "bootstrap-admin"
+		cfg.Cloud.Mode = true
+		handler := NewHandler(cfg, st, &auth.Service{Config: cfg, Now: time.Now}, &stubBilling{}, &stubTokenIssuer{})
+		mux := http.NewServeMux()
+		handler.RegisterRoutes(mux)
+
+		orgID, err := st.CreateOrg(ctx, "language-org")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+		inbox, err := st.CreateInboxForOrg(ctx, orgID, "support@language.test", "", store.ProviderJMAP)
+		if err != nil {
+			t.Fatalf("create inbox: %v", err)
+		}
+		threadID, err := st.EnsureThread(ctx, inbox.ID, "thread-1", "Shoes", nil)
+		if err != nil {
+			t.Fatalf("create thread: %v", err)
+		}
+		if _, err := st.InsertMessage(ctx, store.Message{InboxID: inbox.ID, ThreadID: threadID, Direction: "inbound", ProviderMessageID: "m-1", Text: "My running shoes arrived torn"}); err != nil {
+			t.Fatalf("insert message: %v", err)
+		}
+		call := func(method, target string, body any) (*httptest.ResponseRecorder, map[string]any) {
+			if method == http.MethodGet {
+				target += "?org_id=" + orgID
+			}
+			req := jsonRequest(t, method, target, body)
+			req.Header.Set("X-API-Key", "bootstrap-admin")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			var resp map[string]any
+			_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+			return rec, resp
+		}
+		inboxConfig := func(resp map[string]any) (string, bool) {
+			items, _ := resp["inboxes"].([]any)
+			if len(items) != 1 {
+				t.Fatalf("expected the one inbox listed, got %v", resp["inboxes"])
+			}
+			item := items[0].(map[string]any)
+			return item["config"].(string), item["override"].(bool)
+		}
+		stems := func() bool {
+			results, err := st.SearchInboxFTS(ctx, inbox.ID, "run", 10, "")
+			if err != nil {
+				t.Fatalf("search: %v", err)
+			}
+			return len(results) == 1
+		}
+
+		rec, resp := call(http.MethodGet, "/v1/orgs/search-language", nil)
+		if rec.Code != http.StatusOK || resp["config"] != "simple" {
+			t.Fatalf("expected the simple config by default, got %d %v", rec.Code, resp)
+		}
+		if stems() {
+			t.Fatalf("expected the simple config not to stem running to run")
+		}
+
+		rec, resp = call(http.MethodPut, "/v1/orgs/search-language", map[string]any{"org_id": orgID, "language": "en"})
+		if rec.Code != http.StatusOK || resp["config"] != "english" || resp["reindexed_messages"] != float64(1) {
+			t.Fatalf("expected english with the message reindexed, got %d %v", rec.Code, resp)
+		}
+		if config, override := inboxConfig(resp); config != "english" || override {
+			t.Fatalf("expected the inbox to follow the org, got %s override=%v", config, override)
+		}
+		if !stems() {
+			t.Fatalf("expected english stemming after the reindex")
+		}
+
+		rec, resp = call(http.MethodPut, "/v1/orgs/search-language", map[string]any{"org_id": orgID, "inbox_id": inbox.ID, "language": "de"})
+		if config, override := inboxConfig(resp); rec.Code != http.StatusOK || resp["config"] != "english" || config != "german" || !override || resp["reindexed_messages"] != float64(1) {
+			t.Fatalf("expected a german override on the inbox, got %d %v", rec.Code, resp)
+		}
+		rec, resp = call(http.MethodPut, "/v1/orgs/search-language", map[string]any{"org_id": orgID, "inbox_id": inbox.ID, "language": ""})
+		if config, override := inboxConfig(resp); rec.Code != http.StatusOK || config != "english" || override {
+			t.Fatalf("expected the override cleared, got %d %v", rec.Code, resp)
+		}
+
+		if rec, resp := call(http.MethodPost, "/v1/orgs/search-language/reindex", map[string]any{"org_id": orgID}); rec.Code != http.StatusOK || resp["reindexed_messages"] != float64(0) {
+			t.Fatalf("expected nothing left to reindex, got %d %v", rec.Code, resp)
+		}
+		if rec, _ := call(http.MethodPut, "/v1/orgs/search-language", map[string]any{"org_id": orgID, "language": "klingon"}); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for an unsupported language, got %d", rec.Code)
+		}
+		if rec, _ := call(http.MethodPut, "/v1/orgs/search-language", map[string]any{"org_id": orgID, "inbox_id": uuid.NewString(), "language": "en"}); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for an unknown inbox, got %d", rec.Code)
+		}
+		if rec, _ := call(http.MethodGet, "/v1/orgs/search-language/reindex", nil); rec.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("expected 405 for GET on reindex, got %d", rec.Code)
+		}
+	})
+}
+
+func TestAdminCanaryPinsOrgsAndComparesVariants(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		cfg := config.Default()
+		cfg.Security.APIKey = "bootstrap-admin"
+		cfg.Security.TokenSigningKey = testSigningKey
+		cfg.Cloud.Mode = true
+		cfg.Canary.Enabled = true
+		cfg.Canary.Percent = 10
+		cfg.Canary.Tools = []string{"draft_reply_with_policy"}
+		handler := NewHandler(cfg, st, &auth.Service{Config: cfg, Now: time.Now}, &stubBilling{}, &stubTokenIssuer{})
+		mux := http.NewServeMux()
+		handler.RegisterRoutes(mux)
+
+		orgID, err := st.CreateOrg(ctx, "canary-org")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+		for _, m := range []store.CanaryMetric{
+			{OrgID: orgID, ToolName: "draft_reply_with_policy", Variant: canary.Stable, LatencyMS: 100, Success: true},
+			{OrgID: orgID, ToolName: "draft_reply_with_policy", Variant: canary.Stable, LatencyMS: 300, Success: true, PolicyBlocked: true},
+			{OrgID: orgID, ToolName: "draft_reply_with_policy", Variant: canary.Canary, LatencyMS: 200, Success: true, NeedsApproval: true},
+			{OrgID: orgID, ToolName: "draft_reply_with_policy", Variant: canary.Canary, LatencyMS: 400, NeedsApproval: true},
+		} {
+			if err := st.RecordCanaryMetric(ctx, m); err != nil {
+				t.Fatalf("record canary metric: %v", err)
+			}
+		}
+		call := func(method, target string, body any) (*httptest.ResponseRecorder, map[string]any) {
+			req := jsonRequest(t, method, target, body)
+			req.Header.Set("X-API-Key", "bootstrap-admin")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			var resp map[string]any
+			_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+			return rec, resp
+		}
+		variants := func(resp map[string]any) map[string]map[string]any {
+			out := map[string]map[string]any{}
+			items, _ := resp["variants"].([]any)
+			for _, item := range items {
+				v := item.(map[string]any)
+				out[v["variant"].(string)] = v
+			}
+			return out
+		}
+
+		rec, resp := call(http.MethodGet, "/v1/admin/canary", nil)
+		if rec.Code != http.StatusOK || resp["enabled"] != true || resp["percent"] != float64(10) {
+			t.Fatalf("expected the rollout settings, got %d %v", rec.Code, resp)
+		}
+		got := variants(resp)
+		stable, canaryStats := got[canary.Stable], got[canary.Canary]
+		if len(got) != 2 || stable["calls"] != float64(2) || stable["avg_latency_ms"] != float64(200) || stable["policy_block_rate"] != 0.5 || stable["error_rate"] != float64(0) {
+			t.Fatalf("unexpected stable stats %v", stable)
+		}
+		if canaryStats["calls"] != float64(2) || canaryStats["error_rate"] != 0.5 || canaryStats["approval_rate"] != float64(1) || canaryStats["orgs"] != float64(1) {
+			t.Fatalf("unexpected canary stats %v", canaryStats)
+		}
+		if _, resp := call(http.MethodGet, "/v1/admin/canary?tool=summarize_thread", nil); len(variants(resp)) != 0 {
+			t.Fatalf("expected no stats for another tool, got %v", resp["variants"])
+		}
+		if rec, _ := call(http.MethodGet, "/v1/admin/canary?since=yesterday", nil); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for an invalid since, got %d", rec.Code)
+		}
+
+		rec, resp = call(http.MethodPut, "/v1/admin/canary/orgs", map[string]any{"org_id": orgID, "enabled": true})
+		if rec.Code != http.StatusOK || resp["enabled"] != true || resp["flag"] != canary.FlagName {
+			t.Fatalf("expected the org pinned to the canary, got %d %v", rec.Code, resp)
+		}
+		_, resp = call(http.MethodGet, "/v1/admin/canary", nil)
+		pinned, _ := resp["pinned_orgs"].([]any)
+		if len(pinned) != 1 || pinned[0].(map[string]any)["org_id"] != orgID || pinned[0].(map[string]any)["variant"] != canary.Canary {
+			t.Fatalf("expected the pinned org listed, got %v", resp["pinned_orgs"])
+		}
+		if rec, _ := call(http.MethodPut, "/v1/admin/canary/orgs", map[string]any{"org_id": orgID}); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 without enabled, got %d", rec.Code)
+		}
+		if rec, _ := call(http.MethodDelete, "/v1/admin/canary/orgs?org_id="+orgID, nil); rec.Code != http.StatusOK {
+			t.Fatalf("expected the pin removed, got %d", rec.Code)
+		}
+		if rec, _ := call(http.MethodDelete, "/v1/admin/canary/orgs?org_id="+orgID, nil); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for an org no longer pinned, got %d", rec.Code)
+		}
+		if rec, _ := call(http.MethodPost, "/v1/admin/canary", nil); rec.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("expected 405 for POST, got %d", rec.Code)
+		}
+
+		orgAdmin := signedJWTForTest(t, jwtlib.MapClaims{
+			"org_id": orgID,
+			"sub":    "user-1",
+			"jti":    "tok-1",
+			"scope":  "nerve:admin.billing",
+			"exp":    time.Now().Add(5 * time.Minute).Unix(),
+		})
+		for target, method := range map[string]string{"/v1/admin/canary": http.MethodGet, "/v1/admin/canary/orgs": http.MethodPut} {
+			req := jsonRequest(t, method, target, map[string]any{"org_id": orgID, "enabled": true})
+			req.Header.Set("Authorization", "Bearer "+orgAdmin)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != http.StatusForbidden {
+				t.Fatalf("expected an org admin kept out of %s, got %d", target, rec.Code)
+			}
+		}
+	})
+}
+
+func TestOrgBrandingGetAndPut(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		cfg := config.Default()
+		cfg.Security.APIKey = "bootstrap-admin"
+		cfg.Cloud.Mode = true
+		handler := NewHandler(cfg, st, &auth.Service{Config: cfg, Now: time.Now}, &stubBilling{}, &stubTokenIssuer{})
+		mux := http.NewServeMux()
+		handler.RegisterRoutes(mux)
+
+		orgID, err := st.CreateOrg(ctx, "branding-org")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+		call := func(method string, body any) (*httptest.ResponseRecorder, map[string]any) {
+			target := "/v1/orgs/branding"
+			if method == http.MethodGet {
+				target += "?org_id=" + orgID
+			}
+			req := jsonRequest(t, method, target, body)
+			req.Header.Set("X-API-Key", "bootstrap-admin")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			var resp map[string]any
+			_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+			return rec, resp
+		}
+
+		rec, resp := call(http.MethodGet, nil)
+		if rec.Code != http.StatusOK || resp["logo_url"] != "" || resp["org_id"] != orgID {
+			t.Fatalf("expected empty branding, got %d %v", rec.Code, resp)
+		}
+		rec, resp = call(http.MethodPut, map[string]any{
+			"org_id":           orgID,
+			"logo_url":         "https://acme.test/logo.png",
+			"primary_color":    "#102030",
+			"footer_text":      "Acme Support",
+			"physical_address": "1 Main St, Springfield",
+		})
+		if rec.Code != http.StatusOK || resp["primary_color"] != "#102030" || resp["physical_address"] != "1 Main St, Springfield" {
+			t.Fatalf("expected branding saved, got %d %v", rec.Code, resp)
+		}
+		if rec, resp := call(http.MethodGet, nil); rec.Code != http.StatusOK || resp["logo_url"] != "https://acme.test/logo.png" {
+			t.Fatalf("expected saved branding, got %d %v", rec.Code, resp)
+		}
+		if rec, _ := call(http.MethodPut, map[string]any{"org_id": orgID, "logo_url": "javascript:alert(1)"}); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for a non-https logo, got %d", rec.Code)
+		}
+		if rec, _ := call(http.MethodPut, map[string]any{"org_id": orgID, "accent_color": "red"}); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for a named color, got %d", rec.Code)
+		}
+	})
+}
+
+func TestInboxAutoCloseRuleClosesAndReopens(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		cfg := config.Default()
+		cfg.Security.APIKey = "bootstrap-admin"
+		cfg.Cloud.Mode = true
+		handler := NewHandler(cfg, st, &auth.Service{Config: cfg, Now: time.Now}, &stubBilling{}, &stubTokenIssuer{})
+		mux := http.NewServeMux()
+		handler.RegisterRoutes(mux)
+
+		orgID, err := st.CreateOrg(ctx, "auto-close-org")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+		inboxID := uuid.NewString()
+		if _, err := st.DB().ExecContext(ctx, `INSERT INTO inboxes (id, org_id, address, status) VALUES ($1, $2, 'close@local.neuralmail', 'active')`, inboxID, orgID); err != nil {
+			t.Fatalf("create inbox: %v", err)
+		}
+		do := func(method, target string, body any) (*httptest.ResponseRecorder, map[string]any) {
+			req := jsonRequest(t, method, target, body)
+			req.Header.Set("X-API-Key", "bootstrap-admin")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			var resp map[string]any
+			_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+			return rec, resp
+		}
+
+		if rec, _ := do(http.MethodPatch, "/v1/inboxes/"+inboxID, map[string]any{"org_id": orgID, "auto_close_after_days": -1}); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for negative days, got %d", rec.Code)
+		}
+		rec, resp := do(http.MethodPatch, "/v1/inboxes/"+inboxID, map[string]any{"org_id": orgID, "auto_close_after_days": 3})
+		if rec.Code != http.StatusOK || resp["auto_close_after_days"] != float64(3) || resp["auto_close_nudge"] != false {
+			t.Fatalf("expected rule saved, got %d %v", rec.Code, resp)
+		}
+
+		old := store.Message{
+			Direction: "inbound",
+			Subject:   "Refund",
+			Text:      "Where is my refund?",
+			CreatedAt: time.Now().UTC().AddDate(0, 0, -5),
+			From:      store.Participant{Email: "customer@example.com"},
+		}
+		threadID, _, err := st.InsertMessageWithThread(ctx, inboxID, "provider-"+uuid.NewString(), old)
+		if err != nil {
+			t.Fatalf("insert message: %v", err)
+		}
+		res, err := autoclose.New(cfg).Run(ctx, st)
+		if err != nil || res.Closed != 1 {
+			t.Fatalf("expected one thread closed, got %+v %v", res, err)
+		}
+		if reopened, err := st.ReopenThread(ctx, threadID); err != nil || !reopened {
+			t.Fatalf("expected thread reopened, got %v %v", reopened, err)
+		}
+
+		rec, resp = do(http.MethodGet, "/v1/inboxes/"+inboxID+"/closures?org_id="+orgID, nil)
+		if rec.Code != http.StatusOK || resp["auto_closed"] != float64(1) || resp["auto_reopen_rate"] != float64(1) {
+			t.Fatalf("unexpected closure stats: %d %v", rec.Code, resp)
+		}
+	})
+}
+
+func TestNotificationPreferencesGovernWebhookEvents(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		cfg := config.Default()
+		cfg.Security.APIKey = "bootstrap-admin"
+		cfg.Cloud.Mode = true
+		handler := NewHandler(cfg, st, &auth.Service{Config: cfg, Now: time.Now}, &stubBilling{}, &stubTokenIssuer{})
+		mux := http.NewServeMux()
+		handler.RegisterRoutes(mux)
+
+		var received atomic.Int32
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received.Add(1)
+		}))
+		defer receiver.Close()
+		// The receiver is on loopback, which the default sender refuses.
+		closer := autoclose.New(cfg)
+		closer.Notify.Sender = &webhooks.Sender{Client: receiver.Client(), Now: time.Now}
+
+		orgID, err := st.CreateOrg(ctx, "notify-org")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+		inboxID := uuid.NewString()
+		if _, err := st.DB().ExecContext(ctx, `INSERT INTO inboxes (id, org_id, address, status, auto_close_after_days) VALUES ($1, $2, 'notify@local.neuralmail', 'active', 3)`, inboxID, orgID); err != nil {
+			t.Fatalf("create inbox: %v", err)
+		}
+		if _, err := st.CreateWebhookEndpoint(ctx, orgID, receiver.URL, "whsec_test", "", webhooks.CurrentVersion); err != nil {
+			t.Fatalf("create webhook: %v", err)
+		}
+		do := func(method, target string, body any) (*httptest.ResponseRecorder, map[string]any) {
+			req := jsonRequest(t, method, target, body)
+			req.Header.Set("X-API-Key", "bootstrap-admin")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			var resp map[string]any
+			_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+			return rec, resp
+		}
+		idleThread := func() {
+			msg := store.Message{
+				Direction: "inbound",
+				Subject:   "Order " + uuid.NewString(),
+				Text:      "Hello",
+				CreatedAt: time.Now().UTC().AddDate(0, 0, -5),
+				From:      store.Participant{Email: "customer@example.com"},
+			}
+			if _, _, err := st.InsertMessageWithThread(ctx, inboxID, "provider-"+uuid.NewString(), msg); err != nil {
+				t.Fatalf("insert message: %v", err)
+			}
+		}
+
+		digest := map[string]any{"org_id": orgID, "preferences": []map[string]any{{"event_type": "*", "channel": "webhook", "frequency": "daily"}}}
+		if rec, _ := do(http.MethodPut, "/v1/notification-preferences", digest); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for a webhook digest, got %d", rec.Code)
+		}
+		off := map[string]any{"org_id": orgID, "preferences": []map[string]any{
+			{"event_type": "thread.auto_closed", "channel": "webhook", "frequency": "off"},
+			{"event_type": "*", "channel": "email", "frequency": "hourly"},
+		}}
+		if rec, _ := do(http.MethodPut, "/v1/notification-preferences", off); rec.Code != http.StatusOK {
+			t.Fatalf("expected preferences saved, got %d", rec.Code)
+		}
+		user := map[string]any{"org_id": orgID, "user_id": "agent-1", "preferences": []map[string]any{{"event_type": "thread.nudged", "channel": "email", "frequency": "immediate"}}}
+		rec, resp := do(http.MethodPut, "/v1/notification-preferences", user)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected user preference saved, got %d", rec.Code)
+		}
+		effective := map[string]string{}
+		for _, raw := range resp["effective"].([]any) {
+			p := raw.(map[string]any)
+			effective[p["event_type"].(string)+"/"+p["channel"].(string)] = p["frequency"].(string)
+		}
+		if effective["thread.nudged/email"] != "immediate" || effective["thread.auto_closed/email"] != "hourly" || effective["thread.auto_closed/webhook"] != "off" {
+			t.Fatalf("unexpected effective preferences: %v", effective)
+		}
+
+		idleThread()
+		if res, err := closer.Run(ctx, st); err != nil || res.Closed != 1 {
+			t.Fatalf("expected one thread closed, got %+v %v", res, err)
+		}
+		if n := received.Load(); n != 0 {
+			t.Fatalf("expected no webhook while turned off, got %d", n)
+		}
+
+		rec, _ = do(http.MethodDelete, "/v1/notification-preferences?org_id="+orgID+"&event_type=thread.auto_closed&channel=webhook", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected preference deleted, got %d", rec.Code)
+		}
+		idleThread()
+		if res, err := closer.Run(ctx, st); err != nil || res.Closed != 1 {
+			t.Fatalf("expected one thread closed, got %+v %v", res, err)
+		}
+		if n := received.Load(); n != 1 {
+			t.Fatalf("expected the default to deliver one webhook, got %d", n)
+		}
+	})
+}
+
+func TestWebhookSchemasAndVersionPinning(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		cfg := config.Default()
+		cfg.Security.APIKey = "bootstrap-admin"
+		handler := NewHandler(cfg, st, &auth.Service{Config: cfg, Now: time.Now}, &stubBilling{}, &stubTokenIssuer{})
+		mux := http.NewServeMux()
+		handler.RegisterRoutes(mux)
+
+		var received atomic.Value
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			received.Store(body)
+		}))
+		defer receiver.Close()
+		handler.Webhooks = &webhooks.Sender{Client: receiver.Client(), Now: time.Now}
+
+		orgID, err := st.CreateOrg(ctx, "webhook-versions-org")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+		do := func(method, target string, body any) (*httptest.ResponseRecorder, map[string]any) {
+			req := jsonRequest(t, method, target, body)
+			req.Header.Set("X-API-Key", "bootstrap-admin")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			var resp map[string]any
+			_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+			return rec, resp
+		}
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/webhooks/schemas", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("schemas: %d %s", rec.Code, rec.Body.String())
+		}
+		var catalog struct {
+			Version string                    `json:"version"`
+			Schemas map[string]map[string]any `json:"schemas"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &catalog); err != nil {
+			t.Fatal(err)
+		}
+		if catalog.Version != webhooks.CurrentVersion || catalog.Schemas["thread.auto_closed"] == nil {
+			t.Fatalf("unexpected schemas: %s", rec.Body.String())
+		}
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/webhooks/schemas?version=1999-01-01", nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for an unknown version, got %d", rec.Code)
+		}
+
+		if rec, _ := do(http.MethodPost, "/v1/webhooks", map[string]any{"org_id": orgID, "url": receiver.URL, "api_version": "1999-01-01"}); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 pinning an unknown version, got %d", rec.Code)
+		}
+		rec, created := do(http.MethodPost, "/v1/webhooks", map[string]any{"org_id": orgID, "url": receiver.URL})
+		if rec.Code != http.StatusOK || created["api_version"] != webhooks.CurrentVersion {
+			t.Fatalf("create webhook: %d %v", rec.Code, created)
+		}
+		endpointID := created["id"].(string)
+
+		if rec, _ := do(http.MethodPatch, "/v1/webhooks/"+endpointID+"?org_id="+orgID, map[string]any{"api_version": "nope"}); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 moving the pin to an unknown version, got %d", rec.Code)
+		}
+		rec, updated := do(http.MethodPatch, "/v1/webhooks/"+endpointID+"?org_id="+orgID, map[string]any{"api_version": webhooks.Versions[0]})
+		if rec.Code != http.StatusOK || updated["api_version"] != webhooks.Versions[0] {
+			t.Fatalf("update webhook: %d %v", rec.Code, updated)
+		}
+
+		if rec, _ := do(http.MethodPost, "/v1/webhooks/"+endpointID+"/test?org_id="+orgID, nil); rec.Code != http.StatusOK {
+			t.Fatalf("test webhook: %d", rec.Code)
+		}
+		var event map[string]any
+		body, _ := received.Load().([]byte)
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Fatalf("decode delivered event: %v", err)
+		}
+		if event["api_version"] != webhooks.Versions[0] || event["type"] != "webhook.test" {
+			t.Fatalf("unexpected event: %v", event)
+		}
+	})
+}
+
+func TestWebhookTestRedeliverAndDeliveries(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		cfg := config.Default()
+		cfg.Security.APIKey = "bootstrap-admin"
+		handler := NewHandler(cfg, st, &auth.Service{Config: cfg, Now: time.Now}, &stubBilling{}, &stubTokenIssuer{})
+		mux := http.NewServeMux()
+		handler.RegisterRoutes(mux)
+
+		var attempts atomic.Int32
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if attempts.Add(1) == 1 {
+				http.Error(w, "internal detail", http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte("internal detail"))
+		}))
+		defer receiver.Close()
+
+		orgID, err := st.CreateOrg(ctx, "webhook-deliveries-org")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+		otherOrgID, err := st.CreateOrg(ctx, "webhook-deliveries-other-org")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+		do := func(method, target string, body any) (*httptest.ResponseRecorder, map[string]any) {
+			req := jsonRequest(t, method, target, body)
+			req.Header.Set("X-API-Key", "bootstrap-admin")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			var resp map[string]any
+			_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+			return rec, resp
+		}
+
+		rec, created := do(http.MethodPost, "/v1/webhooks", map[string]any{"org_id": orgID, "url": receiver.URL})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("create webhook: %d %v", rec.Code, created)
+		}
+		endpointID := created["id"].(string)
+		base := "/v1/webhooks/" + endpointID
+
+		// The default sender refuses the loopback receiver at dial time.
+		rec, refused := do(http.MethodPost, base+"/test?org_id="+orgID, nil)
+		if rec.Code != http.StatusOK || refused["delivered"] != false || !strings.Contains(fmt.Sprint(refused["error"]), "not publicly routable") {
+			t.Fatalf("expected the loopback receiver to be refused, got %d %v", rec.Code, refused)
+		}
+		if attempts.Load() != 0 {
+			t.Fatalf("expected no request to reach the receiver, got %d", attempts.Load())
+		}
+
+		handler.Webhooks = &webhooks.Sender{Client: receiver.Client(), Now: time.Now}
+		rec, first := do(http.MethodPost, base+"/test?org_id="+orgID, nil)
+		if rec.Code != http.StatusOK || first["delivered"] != false || first["response_code"] != float64(http.StatusServiceUnavailable) || first["attempt"] != float64(1) {
+			t.Fatalf("unexpected test delivery: %d %v", rec.Code, first)
+		}
+		if strings.Contains(rec.Body.String(), "internal detail") {
+			t.Fatalf("expected the receiver's reply not to be returned: %s", rec.Body.String())
+		}
+		eventID := first["event_id"].(string)
+
+		if rec, _ := do(http.MethodPost, base+"/test?org_id="+otherOrgID, nil); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 testing another org's webhook, got %d", rec.Code)
+		}
+		if rec, _ := do(http.MethodPost, base+"/redeliver/evt_missing?org_id="+orgID, nil); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 redelivering an unknown event, got %d", rec.Code)
+		}
+		if rec, _ := do(http.MethodPost, base+"/redeliver/"+eventID+"?org_id="+otherOrgID, nil); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 redelivering from another org, got %d", rec.Code)
+		}
+
+		rec, second := do(http.MethodPost, base+"/redeliver/"+eventID+"?org_id="+orgID, nil)
+		if rec.Code != http.StatusOK || second["delivered"] != true || second["attempt"] != float64(2) || second["event_id"] != eventID {
+			t.Fatalf("unexpected redelivery: %d %v", rec.Code, second)
+		}
+
+		rec, listed := do(http.MethodGet, base+"/deliveries?org_id="+orgID, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("list deliveries: %d", rec.Code)
+		}
+		if strings.Contains(rec.Body.String(), "internal detail") {
+			t.Fatalf("expected the receiver's reply not to be listed: %s", rec.Body.String())
+		}
+		deliveries, _ := listed["deliveries"].([]any)
+		if len(deliveries) != 3 {
+			t.Fatalf("expected three attempts, got %v", listed)
+		}
+		if rec, _ := do(http.MethodGet, base+"/deliveries?org_id="+otherOrgID, nil); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 listing another org's deliveries, got %d", rec.Code)
+		}
+	})
+}
+
+type fixedMailClient []jmap.Email
+
+func (c fixedMailClient) FetchChanges(_ context.Context, _ string) ([]jmap.Email, string, error) {
+	return c, "state-1", nil
+}
+
+func (c fixedMailClient) Name() string { return "fixed" }
+
+func TestInboxIngestFiltersSkipMail(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		cfg := config.Default()
+		cfg.Security.APIKey = "bootstrap-admin"
+		handler := NewHandler(cfg, st, &auth.Service{Config: cfg, Now: time.Now}, &stubBilling{}, &stubTokenIssuer{})
+		mux := http.NewServeMux()
+		handler.RegisterRoutes(mux)
+
+		orgID, err := st.CreateOrg(ctx, "filters-org")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+		inboxID := uuid.NewString()
+		if _, err := st.DB().ExecContext(ctx, `INSERT INTO inboxes (id, org_id, address, status) VALUES ($1, $2, 'support@acme.com', 'active')`, inboxID, orgID); err != nil {
+			t.Fatalf("create inbox: %v", err)
+		}
+		do := func(method, target string, body any) *httptest.ResponseRecorder {
+			req := jsonRequest(t, method, target, body)
+			req.Header.Set("X-API-Key", "bootstrap-admin")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			return rec
+		}
+		filtersURL := "/v1/inboxes/" + inboxID + "/filters?org_id=" + orgID
+
+		if rec := do(http.MethodPut, filtersURL, map[string]any{"skip_subjects": []string{"(unclosed"}}); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for an invalid pattern, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		if rec := do(http.MethodPut, filtersURL, map[string]any{"skip_senders": []string{"not an address"}}); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for an invalid sender, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		rec := do(http.MethodPut, filtersURL, map[string]any{
+			"skip_senders":            []string{"@Newsletters.example"},
+			"skip_subjects":           []string{"^automatic reply"},
+			"skip_calendar_responses": true,
+		})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected filter update success, got %d body=%s", rec.Code, rec.Body.String())
+		}
+
+		settings, err := st.GetIngestFilter(ctx, inboxID)
+		if err != nil || len(settings.SkipSenders) != 1 || settings.SkipSenders[0] != "newsletters.example" {
+			t.Fatalf("unexpected stored filter %+v err=%v", settings, err)
+		}
+		filter, err := jmap.NewFilter(settings)
+		if err != nil {
+			t.Fatalf("compile filter: %v", err)
+		}
+		now := time.Now().UTC()
+		customer := store.Participant{Email: "jane@customer.example"}
+		mail := fixedMailClient{
+			{ID: "m1", ThreadID: "t1", Subject: "Refund", From: customer, ReceivedAt: now},
+			{ID: "m2", ThreadID: "t2", Subject: "Weekly digest", From: store.Participant{Email: "news@newsletters.example"}, ReceivedAt: now},
+			{ID: "m3", ThreadID: "t1", Subject: "Automatic reply: Refund", From: customer, ReceivedAt: now},
+			{ID: "m4", ThreadID: "t3", Subject: "Accepted: Call", From: customer, CalendarMethod: "REPLY", ReceivedAt: now},
+		}
+		if _, ids, err := jmap.Ingest(ctx, mail, st, inboxID, nil, filter, ""); err != nil || len(ids) != 1 {
+			t.Fatalf("expected only the customer's message stored, got %v err=%v", ids, err)
+		}
+
+		rec = do(http.MethodGet, filtersURL, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected filter read success, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			SkipSenders  []string `json:"skip_senders"`
+			SkippedTotal int64    `json:"skipped_total"`
+			Skipped      map[string]struct {
+				Count int64 `json:"count"`
+			} `json:"skipped"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode filters: %v", err)
+		}
+		if resp.SkippedTotal != 3 || resp.Skipped["sender"].Count != 1 || resp.Skipped["subject"].Count != 1 || resp.Skipped["calendar_response"].Count != 1 {
+			t.Fatalf("unexpected skip counts: %s", rec.Body.String())
+		}
+
+		otherOrgID, err := st.CreateOrg(ctx, "other-org")
+		if err != nil {
+			t.Fatalf("create other org: %v", err)
+		}
+		if rec := do(http.MethodGet, "/v1/inboxes/"+inboxID+"/filters?org_id="+otherOrgID, nil); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for another org's inbox, got %d", rec.Code)
+		}
+	})
+}
+
+func TestInboxSyncStatusAndBackfill(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		cfg := config.Default()
+		cfg.Security.APIKey = "bootstrap-admin"
+		handler := NewHandler(cfg, st, &auth.Service{Config: cfg, Now: time.Now}, &stubBilling{}, &stubTokenIssuer{})
+		mux := http.NewServeMux()
+		handler.RegisterRoutes(mux)
+
+		orgID, err := st.CreateOrg(ctx, "sync-org")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+		inboxID := uuid.NewString()
+		if _, err := st.DB().ExecContext(ctx, `INSERT INTO inboxes (id, org_id, address, status) VALUES ($1, $2, 'support@acme.com', 'active')`, inboxID, orgID); err != nil {
+			t.Fatalf("create inbox: %v", err)
+		}
+		do := func(method, target string, body any) *httptest.ResponseRecorder {
+			req := jsonRequest(t, method, target, body)
+			req.Header.Set("X-API-Key", "bootstrap-admin")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			return rec
+		}
+		syncURL := "/v1/inboxes/" + inboxID + "/sync?org_id=" + orgID
+		var status struct {
+			State               string `json:"state"`
+			Checkpoint          string `json:"checkpoint"`
+			LastError           string `json:"last_error"`
+			ConsecutiveFailures int    `json:"consecutive_failures"`
+			LagSeconds          *int64 `json:"lag_seconds"`
+			Backfills           []struct {
+				Status string `json:"status"`
+			} `json:"backfills"`
+		}
+		read := func() {
+			t.Helper()
+			rec := do(http.MethodGet, syncURL, nil)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected sync status, got %d body=%s", rec.Code, rec.Body.String())
+			}
+			status.LagSeconds = nil
+			if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+				t.Fatalf("decode sync status: %v", err)
+			}
+		}
+
+		read()
+		if status.State != "never_polled" || status.LagSeconds != nil {
+			t.Fatalf("expected a never polled inbox, got %+v", status)
+		}
+		if err := st.UpdateCheckpoint(ctx, inboxID, store.ProviderJMAP, "state-7"); err != nil {
+			t.Fatalf("checkpoint: %v", err)
+		}
+		if err := st.RecordInboxPoll(ctx, inboxID, "replica-a", ""); err != nil {
+			t.Fatalf("record poll: %v", err)
+		}
+		read()
+		if status.State != "ok" || status.Checkpoint != "state-7" || status.LagSeconds == nil {
+			t.Fatalf("expected a synced inbox, got %+v", status)
+		}
+		for range 2 {
+			if err := st.RecordInboxPoll(ctx, inboxID, "replica-a", "jmap session error: 401"); err != nil {
+				t.Fatalf("record poll: %v", err)
+			}
+		}
+		read()
+		if status.State != "failing" || status.ConsecutiveFailures != 2 || status.LastError != "jmap session error: 401" || status.LagSeconds == nil {
+			t.Fatalf("expected a failing inbox keeping its last success, got %+v", status)
+		}
+
+		backfillURL := "/v1/inboxes/" + inboxID + "/backfill?org_id=" + orgID
+		if rec := do(http.MethodPost, backfillURL, map[string]any{"until": "2026-01-01T00:00:00Z"}); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 without since, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		if rec := do(http.MethodPost, backfillURL, map[string]any{"since": "2026-02-01T00:00:00Z", "until": "2026-01-01T00:00:00Z"}); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for an empty range, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		rec := do(http.MethodPost, backfillURL, map[string]any{"since": "2026-01-01T00:00:00Z", "until": "2026-02-01T00:00:00Z"})
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected backfill queued, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		backfill, err := st.StartInboxBackfill(ctx, inboxID)
+		if err != nil || backfill.Until.Month() != time.February {
+			t.Fatalf("expected the backfill to start, got %+v err=%v", backfill, err)
+		}
+		if err := st.AdvanceInboxBackfill(ctx, backfill.ID, "", 12); err != nil {
+			t.Fatalf("advance backfill: %v", err)
+		}
+		if err := st.FinishInboxBackfill(ctx, backfill.ID, ""); err != nil {
+			t.Fatalf("finish backfill: %v", err)
+		}
+		read()
+		if len(status.Backfills) != 1 || status.Backfills[0].Status != store.BackfillDone {
+			t.Fatalf("expected the finished backfill listed, got %+v", status.Backfills)
+		}
+
+		otherOrgID, err := st.CreateOrg(ctx, "other-org")
+		if err != nil {
+			t.Fatalf("create other org: %v", err)
+		}
+		if rec := do(http.MethodGet, "/v1/inboxes/"+inboxID+"/sync?org_id="+otherOrgID, nil); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for another org's inbox, got %d body=%s", rec.Code, rec.Body.String())
+		}
+	})
+}
+
+func TestGmailConnectWaitsForTheInitiatorToConfirm(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		// Google: each code is a grant for one mailbox.
+		mailboxes := map[string]string{"victim-code": "victim@gmail.com", "owner-code": "owner@acme.com"}
+		google := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/token":
+				_ = r.ParseForm()
+				_ = json.NewEncoder(w).Encode(map[string]any{
+					"access_token":  "access-" + r.Form.Get("code"),
+					"refresh_token": "refresh-" + r.Form.Get("code"),
+					"expires_in":    3600,
+				})
+			case "/gmail/v1/users/me/profile":
+				code := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer access-")
+				_ = json.NewEncoder(w).Encode(map[string]any{"emailAddress": mailboxes[code]})
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer google.Close()
+
+		cfg := config.Default()
+		cfg.Security.APIKey = "bootstrap-admin"
+		cfg.Security.TokenEncryptionKey = strings.Repeat("ab", 32)
+		cfg.Gmail.ClientID = "client-1"
+		cfg.Gmail.ClientSecret = "secret-1"
+		cfg.Gmail.RedirectURL = "https://cloud.example.com/v1/oauth/gmail/callback"
+		cfg.Gmail.TokenURL = google.URL + "/token"
+		cfg.Gmail.APIBaseURL = google.URL
+		handler := NewHandler(cfg, st, &auth.Service{Config: cfg, Now: time.Now}, &stubBilling{}, &stubTokenIssuer{})
+		mux := http.NewServeMux()
+		handler.RegisterRoutes(mux)
+
+		orgID, err := st.CreateOrg(ctx, "gmail-org")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+		otherOrgID, err := st.CreateOrg(ctx, "other-org")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+		inboxID := uuid.NewString()
+		if _, err := st.DB().ExecContext(ctx, `INSERT INTO inboxes (id, org_id, address, status) VALUES ($1, $2, 'support@acme.com', 'active')`, inboxID, orgID); err != nil {
+			t.Fatalf("create inbox: %v", err)
+		}
+		do := func(method, target string, body any) *httptest.ResponseRecorder {
+			req := jsonRequest(t, method, target, body)
+			req.Header.Set("X-API-Key", "bootstrap-admin")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			return rec
+		}
+		connectURL := "/v1/inboxes/" + inboxID + "/connect/gmail?org_id=" + orgID
+		confirmURL := "/v1/inboxes/" + inboxID + "/connect/gmail/confirm?org_id=" + orgID
+		start := func() string {
+			t.Helper()
+			rec := do(http.MethodPost, connectURL, nil)
+			var out struct {
+				State string `json:"state"`
+			}
+			if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &out) != nil || out.State == "" {
+				t.Fatalf("expected consent to start, got %d body=%s", rec.Code, rec.Body.String())
+			}
+			return out.State
+		}
+		callback := func(code, state string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/oauth/gmail/callback?code="+code+"&state="+state, nil))
+			return rec
+		}
+		expectProvider := func(want string) {
+			t.Helper()
+			inbox, err := st.GetInboxRecordByIDForOrg(ctx, orgID, inboxID)
+			if err != nil || inbox.Provider != want {
+				t.Fatalf("expected provider %s, got %q %v", want, inbox.Provider, err)
+			}
+		}
+
+		// The authorization URL forwarded to someone else: their consent
+		// alone connects nothing.
+		state := start()
+		if rec := callback("victim-code", state); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "pending_confirmation") {
+			t.Fatalf("expected the consent held as pending, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		if _, err := st.GetInboxOAuthToken(ctx, inboxID); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected no grant stored before confirmation, got %v", err)
+		}
+		expectProvider(store.ProviderJMAP)
+		if rec := callback("owner-code", state); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected a state to take one consent, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		if rec := do(http.MethodPost, confirmURL, map[string]any{"state": state, "account_email": "owner@acme.com"}); rec.Code != http.StatusConflict {
+			t.Fatalf("expected another account's grant refused, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		if rec := do(http.MethodPost, confirmURL, map[string]any{"state": state, "account_email": "victim@gmail.com"}); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected the refused grant discarded, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		if _, err := st.GetInboxOAuthToken(ctx, inboxID); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected no grant stored, got %v", err)
+		}
+
+		state = start()
+		if rec := callback("owner-code", state); rec.Code != http.StatusOK {
+			t.Fatalf("expected the consent held as pending, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		if rec := do(http.MethodPost, confirmURL, map[string]any{"state": state}); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 without account_email, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		otherConfirmURL := "/v1/inboxes/" + inboxID + "/connect/gmail/confirm?org_id=" + otherOrgID
+		if rec := do(http.MethodPost, otherConfirmURL, map[string]any{"state": state, "account_email": "owner@acme.com"}); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected another org's confirmation refused, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		if rec := do(http.MethodGet, confirmURL, nil); rec.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("expected 405 for GET, got %d", rec.Code)
+		}
+		rec := do(http.MethodPost, confirmURL, map[string]any{"state": state, "account_email": "Owner@Acme.com"})
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"connected"`) {
+			t.Fatalf("expected the inbox connected, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		tok, err := st.GetInboxOAuthToken(ctx, inboxID)
+		if err != nil || tok.AccountEmail != "owner@acme.com" || tok.OrgID != orgID || !tok.Sealed || tok.RefreshToken == "refresh-owner-code" {
+			t.Fatalf("expected the owner's sealed grant stored, got %+v %v", tok, err)
+		}
+		expectProvider(store.ProviderGmail)
+	})
+}
+
+func TestInboxProviderRefusesIMAPOutsideTheDefaultInbox(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		cfg := config.Default()
+		cfg.Security.APIKey = "bootstrap-admin"
+		defaultInboxID, err := st.EnsureDefaultInbox(ctx, cfg.SMTP.From)
+		if err != nil {
+			t.Fatalf("create default inbox: %v", err)
+		}
+		orgID, err := st.EnsureDefaultOrg(ctx)
+		if err != nil {
+			t.Fatalf("default org: %v", err)
+		}
+		otherInboxID := uuid.NewString()
+		if _, err := st.DB().ExecContext(ctx, `INSERT INTO inboxes (id, org_id, address, status) VALUES ($1, $2, 'support@acme.com', 'active')`, otherInboxID, orgID); err != nil {
+			t.Fatalf("create inbox: %v", err)
+		}
+		serve := func(cfg config.Config, method, target string, body any) *httptest.ResponseRecorder {
+			handler := NewHandler(cfg, st, &auth.Service{Config: cfg, Now: time.Now}, &stubBilling{}, &stubTokenIssuer{})
+			mux := http.NewServeMux()
+			handler.RegisterRoutes(mux)
+			req := jsonRequest(t, method, target, body)
+			req.Header.Set("X-API-Key", "bootstrap-admin")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			return rec
+		}
+		expect := func(rec *httptest.ResponseRecorder, code int, what string) {
+			t.Helper()
+			if rec.Code != code {
+				t.Fatalf("%s: expected %d, got %d body=%s", what, code, rec.Code, rec.Body.String())
+			}
+			if code == http.StatusBadRequest && !strings.Contains(rec.Body.String(), "not configured for this inbox") {
+				t.Fatalf("%s: expected the imap refusal, got %s", what, rec.Body.String())
+			}
+		}
+
+		expect(serve(cfg, http.MethodPost, "/v1/inboxes", map[string]any{"org_id": orgID, "address": "sales@acme.com", "provider": "imap"}),
+			http.StatusBadRequest, "create another inbox on imap")
+		expect(serve(cfg, http.MethodPatch, "/v1/inboxes/"+otherInboxID, map[string]any{"org_id": orgID, "provider": "imap"}),
+			http.StatusBadRequest, "move another inbox to imap")
+		expect(serve(cfg, http.MethodPatch, "/v1/inboxes/"+otherInboxID, map[string]any{"org_id": orgID, "provider": "jmap"}),
+			http.StatusOK, "keep another inbox on jmap")
+		expect(serve(cfg, http.MethodPatch, "/v1/inboxes/"+uuid.NewString(), map[string]any{"org_id": orgID, "provider": "imap"}),
+			http.StatusNotFound, "move an unknown inbox to imap")
+
+		cloud := cfg
+		cloud.Cloud.Mode = true
+		expect(serve(cloud, http.MethodPatch, "/v1/inboxes/"+defaultInboxID, map[string]any{"org_id": orgID, "provider": "imap"}),
+			http.StatusBadRequest, "move the default inbox to imap in cloud mode")
+		expect(serve(cfg, http.MethodPatch, "/v1/inboxes/"+defaultInboxID, map[string]any{"org_id": orgID, "provider": "imap"}),
+			http.StatusOK, "move the default inbox to imap")
+		inbox, err := st.GetInboxRecordByIDForOrg(ctx, orgID, defaultInboxID)
+		if err != nil || inbox.Provider != store.ProviderIMAP {
+			t.Fatalf("expected the default inbox on imap, got %q %v", inbox.Provider, err)
+		}
+	})
+}
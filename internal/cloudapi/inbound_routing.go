@@ -0,0 +1,163 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"neuralmail/internal/store"
+)
+
+type domainRoutingResponse struct {
+	DomainID        string  `json:"domain_id"`
+	Domain          string  `json:"domain"`
+	Status          string  `json:"status"`
+	PlusAddressing  bool    `json:"plus_addressing"`
+	CatchAllInboxID *string `json:"catch_all_inbox_id"`
+}
+
+func newDomainRoutingResponse(d store.DomainRouting) domainRoutingResponse {
+	out := domainRoutingResponse{DomainID: d.DomainID, Domain: d.Domain, Status: d.Status, PlusAddressing: d.PlusAddressing}
+	if d.CatchAllInboxID.Valid {
+		out.CatchAllInboxID = &d.CatchAllInboxID.String
+	}
+	return out
+}
+
+type routingDecisionResponse struct {
+	ID             string    `json:"id"`
+	Provider       string    `json:"provider"`
+	MessageID      string    `json:"message_id"`
+	Recipient      string    `json:"recipient"`
+	Rule           string    `json:"rule"`
+	InboxID        string    `json:"inbox_id,omitempty"`
+	MatchedAddress string    `json:"matched_address,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// handleDomainRouting serves a domain's inbound routing:
+//
+//	GET /v1/domains/{id}/routing
+//	PUT /v1/domains/{id}/routing
+//
+// PUT takes {"plus_addressing": bool, "catch_all_inbox_id": "..."}; a
+// missing field keeps its setting and an empty catch_all_inbox_id turns the
+// catch-all off. Both only take effect once the domain is active.
+func (h *Handler) handleDomainRouting(w http.ResponseWriter, r *http.Request, domainID string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	routing, err := h.Store.GetDomainRoutingForOrg(ctx, orgID, domainID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "domain not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, newDomainRoutingResponse(routing))
+		return
+	}
+
+	var req struct {
+		PlusAddressing  *bool   `json:"plus_addressing"`
+		CatchAllInboxID *string `json:"catch_all_inbox_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	plus, catchAll := routing.PlusAddressing, routing.CatchAllInboxID.String
+	if req.PlusAddressing != nil {
+		plus = *req.PlusAddressing
+	}
+	if req.CatchAllInboxID != nil {
+		catchAll = strings.TrimSpace(*req.CatchAllInboxID)
+	}
+	if catchAll != "" && catchAll != routing.CatchAllInboxID.String {
+		_, err := h.Store.GetInboxRecordByIDForOrg(ctx, orgID, catchAll)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "catch_all_inbox_id is not an inbox of this org", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	updated, err := h.Store.SetDomainRouting(ctx, orgID, domainID, plus, catchAll)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "domain not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, newDomainRoutingResponse(updated))
+}
+
+// handleRoutingDecisions serves GET /v1/routing-decisions, where inbound
+// mail for the org's inboxes and domains went and which rule sent it
+// there, newest first, for debugging mail that went missing. recipient
+// filters by address; limit defaults to 50, max 500.
+func (h *Handler) handleRoutingDecisions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	query := r.URL.Query()
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(query.Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if raw := strings.TrimSpace(query.Get("limit")); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 && parsed <= 500 {
+			limit = parsed
+		}
+	}
+	decisions, err := h.Store.ListRoutingDecisions(r.Context(), orgID, strings.TrimSpace(query.Get("recipient")), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out := make([]routingDecisionResponse, 0, len(decisions))
+	for _, d := range decisions {
+		out = append(out, routingDecisionResponse{
+			ID:             d.ID,
+			Provider:       d.Provider,
+			MessageID:      d.MessageID,
+			Recipient:      d.Recipient,
+			Rule:           d.Rule,
+			InboxID:        d.InboxID,
+			MatchedAddress: d.MatchedAddress,
+			CreatedAt:      d.CreatedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"decisions": out})
+}
@@ -0,0 +1,51 @@
+package cloudapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"neuralmail/internal/store"
+)
+
+// errInvalidInboxAllowlist wraps inbox_ids that name an inbox outside the
+// org; handlers answer it with 400.
+var errInvalidInboxAllowlist = errors.New("invalid inbox_ids")
+
+// inboxAllowlist validates the inbox_ids a key or service token is being
+// restricted to: each must be one of orgID's inboxes. Duplicates and blanks
+// are dropped; nil means no restriction.
+func (h *Handler) inboxAllowlist(ctx context.Context, orgID string, inboxIDs []string) ([]string, error) {
+	var out []string
+	for _, id := range inboxIDs {
+		id = strings.TrimSpace(id)
+		if id == "" || slices.Contains(out, id) {
+			continue
+		}
+		if _, err := uuid.Parse(id); err != nil {
+			return nil, fmt.Errorf("%w: %q is not an inbox id", errInvalidInboxAllowlist, id)
+		}
+		if err := h.Store.EnsureInboxBelongsToOrg(ctx, id, orgID); err != nil {
+			if errors.Is(err, store.ErrOwnershipMismatch) {
+				return nil, fmt.Errorf("%w: inbox %s does not belong to org", errInvalidInboxAllowlist, id)
+			}
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, nil
+}
+
+// writeInboxAllowlistError answers a failed inboxAllowlist.
+func writeInboxAllowlistError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInvalidInboxAllowlist) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
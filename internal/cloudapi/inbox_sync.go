@@ -0,0 +1,223 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"neuralmail/internal/store"
+)
+
+// Inbox sync health, as GET /v1/inboxes/{id}/sync reports it.
+const (
+	syncNeverPolled = "never_polled"
+	syncOK          = "ok"
+	syncFailing     = "failing"
+	// syncStale is an inbox whose last successful poll is staleSyncPolls
+	// poll intervals old: no replica is polling it.
+	syncStale = "stale"
+)
+
+// staleSyncPolls is how many poll intervals may pass without a successful
+// poll before an inbox counts as stale.
+const staleSyncPolls = 3
+
+// recentBackfills is how many backfills the sync endpoints list.
+const recentBackfills = 10
+
+type backfillResponse struct {
+	ID          string     `json:"id"`
+	Since       time.Time  `json:"since"`
+	Until       time.Time  `json:"until"`
+	Status      string     `json:"status"`
+	Fetched     int64      `json:"fetched"`
+	Error       string     `json:"error,omitempty"`
+	RequestedBy string     `json:"requested_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+func toBackfillResponse(b store.InboxBackfill) backfillResponse {
+	return backfillResponse{
+		ID:          b.ID,
+		Since:       b.Since,
+		Until:       b.Until,
+		Status:      b.Status,
+		Fetched:     b.Fetched,
+		Error:       b.Error,
+		RequestedBy: b.RequestedBy,
+		CreatedAt:   b.CreatedAt,
+		StartedAt:   nullTimePtr(b.StartedAt),
+		FinishedAt:  nullTimePtr(b.FinishedAt),
+	}
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	v := t.Time
+	return &v
+}
+
+// handleInboxSync serves GET /v1/inboxes/{id}/sync: the inbox's checkpoint,
+// its last poll and last successful poll, the lag since that success, the
+// last error and the recent backfills.
+func (h *Handler) handleInboxSync(w http.ResponseWriter, r *http.Request, inboxID string) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := h.inboxForSync(w, r, inboxID); !ok {
+		return
+	}
+	ctx := r.Context()
+	status, err := h.Store.GetInboxSyncStatus(ctx, inboxID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "inbox not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	backfills, err := h.Store.ListInboxBackfills(ctx, inboxID, recentBackfills)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	resp := map[string]any{
+		"inbox_id":             inboxID,
+		"provider":             status.Provider,
+		"state":                h.syncState(status, now),
+		"checkpoint":           status.Checkpoint,
+		"consecutive_failures": status.ConsecutiveFailures,
+		"backfills":            backfillsResponse(backfills),
+	}
+	if status.CheckpointUpdatedAt.Valid {
+		resp["checkpoint_updated_at"] = status.CheckpointUpdatedAt.Time
+	}
+	if status.PolledBy != "" {
+		resp["polled_by"] = status.PolledBy
+	}
+	if status.LastPollAt.Valid {
+		resp["last_poll_at"] = status.LastPollAt.Time
+	}
+	if status.LastSuccessAt.Valid {
+		resp["last_success_at"] = status.LastSuccessAt.Time
+		resp["lag_seconds"] = int64(now.Sub(status.LastSuccessAt.Time).Seconds())
+	}
+	if status.LastError != "" {
+		resp["last_error"] = status.LastError
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) syncState(status store.InboxSyncStatus, now time.Time) string {
+	switch {
+	case !status.LastPollAt.Valid:
+		return syncNeverPolled
+	case status.ConsecutiveFailures > 0:
+		return syncFailing
+	case h.Config.JMAP.PollInterval > 0 && now.Sub(status.LastSuccessAt.Time) > staleSyncPolls*h.Config.JMAP.PollInterval:
+		return syncStale
+	}
+	return syncOK
+}
+
+func backfillsResponse(backfills []store.InboxBackfill) []backfillResponse {
+	out := make([]backfillResponse, 0, len(backfills))
+	for _, b := range backfills {
+		out = append(out, toBackfillResponse(b))
+	}
+	return out
+}
+
+// handleInboxBackfill serves an inbox's backfills:
+//
+//	GET  /v1/inboxes/{id}/backfill
+//	POST /v1/inboxes/{id}/backfill
+//
+// POST queues the ingestion of the mail received between since and until
+// (RFC 3339; until defaults to now) and answers 202. The replica polling
+// the inbox runs it in the background after its regular polls; mail already
+// stored is left as it is, and automation rules do not run on backfilled
+// mail. GET lists the recent backfills and their progress.
+func (h *Handler) handleInboxBackfill(w http.ResponseWriter, r *http.Request, inboxID string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	actorID, ok := h.inboxForSync(w, r, inboxID)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	if r.Method == http.MethodGet {
+		backfills, err := h.Store.ListInboxBackfills(ctx, inboxID, recentBackfills)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"backfills": backfillsResponse(backfills)})
+		return
+	}
+
+	var req struct {
+		Since time.Time  `json:"since"`
+		Until *time.Time `json:"until"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	now := time.Now().UTC()
+	until := now
+	if req.Until != nil && req.Until.Before(now) {
+		until = *req.Until
+	}
+	if req.Since.IsZero() {
+		http.Error(w, "since is required", http.StatusBadRequest)
+		return
+	}
+	if !req.Since.Before(until) {
+		http.Error(w, "since must be before until", http.StatusBadRequest)
+		return
+	}
+	backfill, err := h.Store.CreateInboxBackfill(ctx, inboxID, req.Since, until, actorID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, toBackfillResponse(backfill))
+}
+
+// inboxForSync authorizes a sync endpoint call on inboxID and returns the
+// caller's actor ID; it has answered the request when ok is false.
+func (h *Handler) inboxForSync(w http.ResponseWriter, r *http.Request, inboxID string) (string, bool) {
+	principal, err := h.requireAnyScope(r, "nerve:admin.billing", "nerve:email.inbox.create")
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return "", false
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	if err := h.Store.EnsureInboxBelongsToOrg(r.Context(), inboxID, orgID); err != nil {
+		if errors.Is(err, store.ErrOwnershipMismatch) {
+			http.Error(w, "inbox not found", http.StatusNotFound)
+			return "", false
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return "", false
+	}
+	return principal.ActorID, true
+}
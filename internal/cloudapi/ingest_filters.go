@@ -0,0 +1,157 @@
+package cloudapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"neuralmail/internal/domains"
+	"neuralmail/internal/emailaddr"
+	"neuralmail/internal/jmap"
+	"neuralmail/internal/store"
+)
+
+// Limits on an ingestion filter, so one inbox's filter stays cheap to match
+// against every message.
+const (
+	maxSkipSenders  = 500
+	maxSkipSubjects = 50
+	maxSubjectRegex = 200
+)
+
+type ingestFilterRequest struct {
+	SkipSenders           []string `json:"skip_senders"`
+	SkipSubjects          []string `json:"skip_subjects"`
+	SkipCalendarResponses bool     `json:"skip_calendar_responses"`
+	MaxMessageBytes       int64    `json:"max_message_bytes"`
+}
+
+// handleInboxFilters serves an inbox's ingestion filter:
+//
+//	GET /v1/inboxes/{id}/filters
+//	PUT /v1/inboxes/{id}/filters
+//
+// Matching mail is dropped before it is stored or embedded. GET also returns
+// how much mail each kind of filter has skipped. PUT replaces the filter; an
+// empty one ingests everything again.
+func (h *Handler) handleInboxFilters(w http.ResponseWriter, r *http.Request, inboxID string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	principal, err := h.requireAnyScope(r, "nerve:admin.billing", "nerve:email.inbox.create")
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	if err := h.Store.EnsureInboxBelongsToOrg(ctx, inboxID, orgID); err != nil {
+		if errors.Is(err, store.ErrOwnershipMismatch) {
+			http.Error(w, "inbox not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var filter store.IngestFilter
+	if r.Method == http.MethodPut {
+		var req ingestFilterRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		if filter, err = validateIngestFilter(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter, err = h.Store.SetIngestFilter(ctx, inboxID, filter)
+	} else {
+		filter, err = h.Store.GetIngestFilter(ctx, inboxID)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	counts, err := h.Store.ListIngestSkips(ctx, inboxID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	skipped := map[string]any{}
+	var total int64
+	for _, c := range counts {
+		skipped[c.Reason] = map[string]any{"count": c.Skipped, "last_skipped_at": c.LastSkippedAt}
+		total += c.Skipped
+	}
+	resp := map[string]any{
+		"inbox_id":                inboxID,
+		"skip_senders":            nonNil(filter.SkipSenders),
+		"skip_subjects":           nonNil(filter.SkipSubjects),
+		"skip_calendar_responses": filter.SkipCalendarResponses,
+		"max_message_bytes":       filter.MaxMessageBytes,
+		"skipped":                 skipped,
+		"skipped_total":           total,
+	}
+	if !filter.UpdatedAt.IsZero() {
+		resp["updated_at"] = filter.UpdatedAt
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// validateIngestFilter canonicalizes the senders, which may be addresses or
+// domains, and checks that every subject pattern compiles.
+func validateIngestFilter(req ingestFilterRequest) (store.IngestFilter, error) {
+	if len(req.SkipSenders) > maxSkipSenders {
+		return store.IngestFilter{}, fmt.Errorf("at most %d skip_senders", maxSkipSenders)
+	}
+	if len(req.SkipSubjects) > maxSkipSubjects {
+		return store.IngestFilter{}, fmt.Errorf("at most %d skip_subjects", maxSkipSubjects)
+	}
+	if req.MaxMessageBytes < 0 {
+		return store.IngestFilter{}, errors.New("max_message_bytes must not be negative")
+	}
+	filter := store.IngestFilter{
+		SkipCalendarResponses: req.SkipCalendarResponses,
+		MaxMessageBytes:       req.MaxMessageBytes,
+	}
+	for _, sender := range req.SkipSenders {
+		sender = strings.TrimPrefix(strings.TrimSpace(sender), "@")
+		var canonical string
+		var err error
+		if strings.Contains(sender, "@") {
+			canonical, _, _, err = emailaddr.Canonicalize(sender)
+		} else {
+			canonical, err = domains.CanonicalizeDomain(sender)
+		}
+		if err != nil {
+			return store.IngestFilter{}, fmt.Errorf("skip_senders: %w", err)
+		}
+		filter.SkipSenders = append(filter.SkipSenders, canonical)
+	}
+	for _, pattern := range req.SkipSubjects {
+		if pattern == "" || len(pattern) > maxSubjectRegex {
+			return store.IngestFilter{}, fmt.Errorf("skip_subjects patterns must be 1 to %d characters", maxSubjectRegex)
+		}
+		filter.SkipSubjects = append(filter.SkipSubjects, pattern)
+	}
+	if _, err := jmap.NewFilter(filter); err != nil {
+		return store.IngestFilter{}, fmt.Errorf("skip_subjects: %w", err)
+	}
+	return filter, nil
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
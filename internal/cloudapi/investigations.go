@@ -0,0 +1,188 @@
+package cloudapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"neuralmail/internal/store"
+)
+
+type auditEntryResponse struct {
+	ID               string    `json:"id"`
+	ToolCallID       string    `json:"tool_call_id"`
+	Actor            string    `json:"actor"`
+	ToolName         string    `json:"tool_name"`
+	InboxID          string    `json:"inbox_id,omitempty"`
+	LatencyMS        int64     `json:"latency_ms"`
+	ReplayID         string    `json:"replay_id,omitempty"`
+	PolicyRuleIDs    []string  `json:"policy_rule_ids"`
+	CitationCoverage *float64  `json:"citation_coverage,omitempty"`
+	UsageStatus      string    `json:"usage_status"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// handleAudit serves GET /v1/audit, an org's audited tool calls oldest
+// first, to billing admins and credentials with nerve:audit.read. Optional
+// query params filter by inbox_id, tool, actor and replay_id and bound the
+// range with since and until (RFC 3339); limit defaults to 50, max 500.
+// Without since it returns the latest entries; with since, the first ones
+// after it, which is how `neuralmail audit tail` follows the log. A full
+// page after since carries next_cursor, which the cursor param resumes
+// from. A credential restricted to some inboxes only sees their entries.
+func (h *Handler) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	principal, err := h.requireAnyScope(r, "nerve:admin.billing", "nerve:audit.read")
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	query := r.URL.Query()
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(query.Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := store.AuditFilter{
+		OrgID:    orgID,
+		ToolName: strings.TrimSpace(query.Get("tool")),
+		Actor:    strings.TrimSpace(query.Get("actor")),
+		ReplayID: strings.TrimSpace(query.Get("replay_id")),
+		Limit:    50,
+	}
+	for name, bound := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if raw := strings.TrimSpace(query.Get(name)); raw != "" {
+			if *bound, err = time.Parse(time.RFC3339Nano, raw); err != nil {
+				http.Error(w, name+" must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if raw := strings.TrimSpace(query.Get("cursor")); raw != "" {
+		if err := filter.SetCursor(raw); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if raw := strings.TrimSpace(query.Get("limit")); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 && parsed <= 500 {
+			filter.Limit = parsed
+		}
+	}
+	filter.InboxIDs = principal.InboxIDs
+	if inboxID := strings.TrimSpace(query.Get("inbox_id")); inboxID != "" {
+		if !principal.CanAccessInbox(inboxID) {
+			http.Error(w, "inbox is not allowed for this credential", http.StatusForbidden)
+			return
+		}
+		filter.InboxIDs = []string{inboxID}
+	}
+
+	entries, err := h.Store.ListAuditEntries(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := make([]auditEntryResponse, 0, len(entries))
+	for _, e := range entries {
+		item := auditEntryResponse{
+			ID:            e.ID,
+			ToolCallID:    e.ToolCallID,
+			Actor:         e.Actor,
+			ToolName:      e.ToolName,
+			InboxID:       e.InboxID,
+			LatencyMS:     e.LatencyMS,
+			ReplayID:      e.ReplayID,
+			PolicyRuleIDs: e.PolicyRuleIDs,
+			UsageStatus:   e.UsageStatus,
+			CreatedAt:     e.CreatedAt,
+		}
+		if e.CitationCoverage.Valid {
+			coverage := e.CitationCoverage.Float64
+			item.CitationCoverage = &coverage
+		}
+		resp = append(resp, item)
+	}
+	body := map[string]any{"org_id": orgID, "entries": resp}
+	if !filter.Since.IsZero() && len(entries) == filter.Limit {
+		body["next_cursor"] = entries[len(entries)-1].Cursor()
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+type toolUsageResponse struct {
+	ToolName  string `json:"tool_name"`
+	MeterName string `json:"meter_name"`
+	Calls     int64  `json:"calls"`
+	Units     int64  `json:"units"`
+	Failed    int64  `json:"failed"`
+	Cached    int64  `json:"cached"`
+}
+
+// handleUsage serves GET /v1/usage, an org's usage by tool over a period:
+// current (the billing period, the default), a calendar month as YYYY-MM, or
+// the trailing days as Nd (e.g. 7d). See parseUsageReport for explicit
+// ranges and CSV output.
+func (h *Handler) handleUsage(w http.ResponseWriter, r *http.Request) {
+	report, ok := h.parseUsageReport(w, r, "json")
+	if !ok {
+		return
+	}
+	usage, err := h.Store.ListToolUsage(r.Context(), report.OrgID, report.From, report.To)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tools := make([]toolUsageResponse, 0, len(usage))
+	var total toolUsageResponse
+	for _, u := range usage {
+		tools = append(tools, toolUsageResponse{ToolName: u.ToolName, MeterName: u.MeterName, Calls: u.Calls, Units: u.Units, Failed: u.Failed, Cached: u.Cached})
+		total.Calls += u.Calls
+		total.Units += u.Units
+		total.Failed += u.Failed
+		total.Cached += u.Cached
+	}
+	if report.Format == "csv" {
+		rows := make([][]string, 0, len(tools))
+		for _, t := range tools {
+			rows = append(rows, []string{t.ToolName, t.MeterName, itoa(t.Calls), itoa(t.Units), itoa(t.Failed), itoa(t.Cached)})
+		}
+		writeUsageCSV(w, report, "tools", []string{"tool_name", "meter_name", "calls", "units", "failed", "cached"}, rows)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"org_id":       report.OrgID,
+		"period":       report.Period,
+		"period_start": report.From,
+		"period_end":   report.To,
+		"totals":       map[string]int64{"calls": total.Calls, "units": total.Units, "failed": total.Failed, "cached": total.Cached},
+		"tools":        tools,
+	})
+}
+
+// usagePeriod resolves a period name to [from, to). current resolves to the
+// calendar month here; the caller swaps in the org's billing period.
+func usagePeriod(period string, now time.Time) (time.Time, time.Time, error) {
+	switch {
+	case period == "" || period == "current":
+		from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return from, from.AddDate(0, 1, 0), nil
+	case strings.HasSuffix(period, "d"):
+		days, err := strconv.Atoi(strings.TrimSuffix(period, "d"))
+		if err != nil || days < 1 || days > 366 {
+			return time.Time{}, time.Time{}, fmt.Errorf("period %q: days must be between 1 and 366", period)
+		}
+		return now.AddDate(0, 0, -days), now, nil
+	default:
+		month, err := time.Parse("2006-01", period)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("period must be current, YYYY-MM or Nd, got %q", period)
+		}
+		return month, month.AddDate(0, 1, 0), nil
+	}
+}
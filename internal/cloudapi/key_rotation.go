@@ -0,0 +1,116 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"neuralmail/internal/store"
+)
+
+// maxKeyRotationGrace bounds how long a caller can keep a rotated key alive.
+const maxKeyRotationGrace = 30 * 24 * time.Hour
+
+type rotatedCloudAPIKeyResponse struct {
+	cloudAPIKeyResponse
+	PreviousExpiresAt time.Time `json:"previous_expires_at"`
+}
+
+// handleRotateCloudAPIKey serves POST /v1/keys/{id}/rotate. It issues a key
+// with the same label and scopes and keeps the old one working for the grace
+// window, security.key_rotation_grace unless the body sets grace_seconds, so
+// clients can switch over without downtime. A key is rotated at most once;
+// rotate its replacement next time.
+func (h *Handler) handleRotateCloudAPIKey(w http.ResponseWriter, r *http.Request, keyID string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if keyID == "" || strings.Contains(keyID, "/") {
+		http.Error(w, "missing key id", http.StatusBadRequest)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		GraceSeconds *int64 `json:"grace_seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	grace := h.Config.Security.KeyRotationGrace
+	if req.GraceSeconds != nil {
+		grace = time.Duration(*req.GraceSeconds) * time.Second
+		if *req.GraceSeconds < 0 || grace > maxKeyRotationGrace {
+			http.Error(w, "grace_seconds must be between 0 and 2592000", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rawKey, keyPrefix, keyHash, err := generateCloudAPIKeyMaterial()
+	if err != nil {
+		http.Error(w, "failed to generate key", http.StatusInternalServerError)
+		return
+	}
+	previousExpiresAt := time.Now().UTC().Add(grace)
+	record, err := h.Store.RotateCloudAPIKey(r.Context(), orgID, keyID, keyPrefix, keyHash, previousExpiresAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "key not found", http.StatusNotFound)
+		return
+	case errors.Is(err, store.ErrKeyRotated):
+		http.Error(w, "key already rotated; rotate its replacement", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	inputHash := hashAny(map[string]any{
+		"org_id":        orgID,
+		"key_id":        keyID,
+		"grace_seconds": grace.Seconds(),
+	})
+	outputHash := hashAny(map[string]any{
+		"key_id":              record.ID,
+		"rotated_from_id":     record.RotatedFromID,
+		"previous_expires_at": previousExpiresAt.Unix(),
+	})
+	if toolCallID, err := h.Store.RecordToolCall(r.Context(), "rotate_cloud_api_key", record.ID, "", "control-plane", 0); err == nil {
+		_ = h.Store.RecordAudit(r.Context(), store.AuditRecord{
+			ToolCallID:  toolCallID,
+			OrgID:       orgID,
+			Actor:       principal.ActorID,
+			InputsHash:  inputHash,
+			OutputsHash: outputHash,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, rotatedCloudAPIKeyResponse{
+		cloudAPIKeyResponse: cloudAPIKeyResponse{
+			ID:            record.ID,
+			Key:           rawKey,
+			KeyPrefix:     record.KeyPrefix,
+			Label:         record.Label,
+			Scopes:        record.Scopes,
+			InboxIDs:      record.InboxIDs,
+			CreatedAt:     record.CreatedAt,
+			RotatedFromID: record.RotatedFromID,
+		},
+		PreviousExpiresAt: previousExpiresAt,
+	})
+}
@@ -0,0 +1,126 @@
+package cloudapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"neuralmail/internal/domains"
+)
+
+type linkRuleResponse struct {
+	ID        string    `json:"id"`
+	Domain    string    `json:"domain"`
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (h *Handler) handleLinkRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.handleListLinkRules(w, r)
+	case http.MethodPost:
+		h.handleCreateLinkRule(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) handleListLinkRules(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rules, err := h.Store.ListOrgLinkRules(r.Context(), orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := make([]linkRuleResponse, 0, len(rules))
+	for _, rule := range rules {
+		resp = append(resp, linkRuleResponse{ID: rule.ID, Domain: rule.Domain, Action: rule.Action, CreatedAt: rule.CreatedAt})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"rules": resp})
+}
+
+func (h *Handler) handleCreateLinkRule(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		OrgID  string `json:"org_id"`
+		Domain string `json:"domain"`
+		Action string `json:"action"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(req.OrgID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	action := strings.ToLower(strings.TrimSpace(req.Action))
+	if action != "allow" && action != "deny" {
+		http.Error(w, "action must be allow or deny", http.StatusBadRequest)
+		return
+	}
+	domain, err := domains.CanonicalizeDomain(req.Domain)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rule, err := h.Store.UpsertOrgLinkRule(r.Context(), orgID, domain, action)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, linkRuleResponse{ID: rule.ID, Domain: rule.Domain, Action: rule.Action, CreatedAt: rule.CreatedAt})
+}
+
+func (h *Handler) handleLinkRuleByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	ruleID := strings.TrimPrefix(r.URL.Path, "/v1/link-rules/")
+	if ruleID == "" || strings.Contains(ruleID, "/") {
+		http.Error(w, "missing rule id", http.StatusBadRequest)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := h.Store.DeleteOrgLinkRule(r.Context(), orgID, ruleID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "rule not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": "deleted"})
+}
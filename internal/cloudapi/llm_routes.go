@@ -0,0 +1,87 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"neuralmail/internal/llm"
+)
+
+// handleOrgLLMRoutes serves GET and PUT /v1/orgs/llm-routes, the models the
+// org's tasks go to. PUT replaces the org's routes, task to "provider:model"
+// refs in fallback order; tasks it leaves out follow the plan's routes, then
+// the deployment's.
+func (h *Handler) handleOrgLLMRoutes(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+	var orgID string
+	switch r.Method {
+	case http.MethodGet:
+		orgID, err = resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodPut:
+		var req struct {
+			OrgID  string              `json:"org_id"`
+			Routes map[string][]string `json:"routes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		orgID, err = resolveOrgIDForPrincipal(principal, strings.TrimSpace(req.OrgID))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := llm.ValidateRoutes(req.Routes); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := h.Store.SetOrgLLMRoutes(ctx, orgID, req.Routes); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "org not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	routes, err := h.Store.GetOrgLLMRoutes(ctx, orgID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "org not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	effective := map[string][]string{}
+	for task, refs := range h.Config.LLM.Routes {
+		effective[task] = refs
+	}
+	for task, refs := range routes.Merged() {
+		effective[task] = refs
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"org_id":    orgID,
+		"routes":    routes.Org,
+		"plan":      routes.Plan,
+		"effective": effective,
+		"default":   h.Config.LLM.Provider + ":" + h.Config.LLM.Model,
+	})
+}
@@ -0,0 +1,150 @@
+package cloudapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"neuralmail/internal/notify"
+	"neuralmail/internal/store"
+)
+
+type notificationPreferenceJSON struct {
+	UserID    string     `json:"user_id,omitempty"`
+	EventType string     `json:"event_type"`
+	Channel   string     `json:"channel"`
+	Frequency string     `json:"frequency"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// handleNotificationPreferences serves the notification preferences center:
+//
+//	GET    /v1/notification-preferences?user_id=
+//	PUT    /v1/notification-preferences
+//	DELETE /v1/notification-preferences?user_id=&event_type=&channel=
+//
+// An empty user_id addresses the org's defaults. GET returns the stored
+// preferences and, for every event type and channel, the frequency that
+// applies; PUT sets the listed preferences and leaves the others alone.
+func (h *Handler) handleNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireAnyScope(r, "nerve:admin.billing", "nerve:email.inbox.create")
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+		orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(query.Get("org_id")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.writeNotificationPreferences(w, r, orgID, strings.TrimSpace(query.Get("user_id")))
+	case http.MethodPut:
+		var req struct {
+			OrgID       string                       `json:"org_id"`
+			UserID      string                       `json:"user_id"`
+			Preferences []notificationPreferenceJSON `json:"preferences"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(req.OrgID))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		userID := strings.TrimSpace(req.UserID)
+		if len(req.Preferences) == 0 {
+			http.Error(w, "missing preferences", http.StatusBadRequest)
+			return
+		}
+		prefs := make([]store.NotificationPreference, 0, len(req.Preferences))
+		for _, p := range req.Preferences {
+			pref := store.NotificationPreference{
+				OrgID:     orgID,
+				UserID:    userID,
+				EventType: strings.TrimSpace(p.EventType),
+				Channel:   strings.ToLower(strings.TrimSpace(p.Channel)),
+				Frequency: strings.ToLower(strings.TrimSpace(p.Frequency)),
+			}
+			if err := notify.Validate(pref); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			prefs = append(prefs, pref)
+		}
+		err = h.Store.RunAsOrg(ctx, orgID, func(scoped *store.Store) error {
+			for _, pref := range prefs {
+				if _, err := scoped.SetNotificationPreference(ctx, pref); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.writeNotificationPreferences(w, r, orgID, userID)
+	case http.MethodDelete:
+		orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(query.Get("org_id")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		deleted, err := h.Store.DeleteNotificationPreference(ctx, orgID, strings.TrimSpace(query.Get("user_id")),
+			strings.TrimSpace(query.Get("event_type")), strings.ToLower(strings.TrimSpace(query.Get("channel"))))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			http.Error(w, "preference not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"status": "deleted"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) writeNotificationPreferences(w http.ResponseWriter, r *http.Request, orgID string, userID string) {
+	prefs, err := h.Store.ListNotificationPreferences(r.Context(), orgID, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stored := make([]notificationPreferenceJSON, 0, len(prefs))
+	for _, p := range prefs {
+		updatedAt := p.UpdatedAt
+		stored = append(stored, notificationPreferenceJSON{
+			UserID:    p.UserID,
+			EventType: p.EventType,
+			Channel:   p.Channel,
+			Frequency: p.Frequency,
+			UpdatedAt: &updatedAt,
+		})
+	}
+	effective := make([]notificationPreferenceJSON, 0, len(notify.Events)*len(notify.Channels))
+	for _, event := range notify.Events {
+		for _, channel := range notify.Channels {
+			effective = append(effective, notificationPreferenceJSON{
+				EventType: event,
+				Channel:   channel,
+				Frequency: notify.Resolve(prefs, userID, event, channel),
+			})
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"org_id":      orgID,
+		"user_id":     userID,
+		"preferences": stored,
+		"effective":   effective,
+	})
+}
@@ -0,0 +1,264 @@
+package cloudapi
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"neuralmail/internal/store"
+)
+
+// handleOrgByID serves an org's data rights requests:
+//
+//	GET    /v1/orgs/{id}/export  the org's data as a zip of JSONL files
+//	GET    /v1/orgs/{id}/delete  the org's deletion request
+//	POST   /v1/orgs/{id}/delete  schedules the org's deletion
+//	DELETE /v1/orgs/{id}/delete  cancels it within the grace period
+func (h *Handler) handleOrgByID(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/orgs/"), "/")
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := uuid.Parse(orgID); err != nil {
+		http.Error(w, "invalid org id", http.StatusBadRequest)
+		return
+	}
+	switch action {
+	case "export":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.exportOrg(w, r, orgID, principal.ActorID)
+	case "delete":
+		h.handleOrgDeletion(w, r, orgID, principal.ActorID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// exportOrg streams the org's threads, messages, audit log and usage, one
+// JSON object per row. The default zip holds a JSONL file per section and a
+// manifest counting their rows; format=jsonl sends the sections as a single
+// JSONL stream of {"section", "row"} objects instead. An error once rows
+// have been sent can only cut the download short, so it is logged.
+func (h *Handler) exportOrg(w http.ResponseWriter, r *http.Request, orgID string, actor string) {
+	ctx := r.Context()
+	format := strings.TrimSpace(r.URL.Query().Get("format"))
+	if format == "" {
+		format = "zip"
+	}
+	if format != "zip" && format != "jsonl" {
+		http.Error(w, "format must be zip or jsonl", http.StatusBadRequest)
+		return
+	}
+	exists, err := h.Store.OrgExists(ctx, orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "org not found", http.StatusNotFound)
+		return
+	}
+
+	exportedAt := time.Now().UTC()
+	filename := "org-" + orgID + "-" + exportedAt.Format("20060102T150405Z") + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	counts := map[string]int{}
+	if format == "jsonl" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(w)
+		for _, section := range store.OrgExportSections {
+			err = h.Store.ExportOrgRows(ctx, orgID, section, func(row json.RawMessage) error {
+				counts[section]++
+				return enc.Encode(map[string]any{"section": section, "row": row})
+			})
+			if err != nil {
+				break
+			}
+		}
+	} else {
+		w.Header().Set("Content-Type", "application/zip")
+		w.WriteHeader(http.StatusOK)
+		archive := zip.NewWriter(w)
+		err = writeOrgArchive(ctx, h.Store, archive, orgID, exportedAt, counts)
+		if closeErr := archive.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "org export failed", "org", orgID, "format", format, "err", err)
+		return
+	}
+	h.recordOrgAudit(r, "export_org", orgID, actor, map[string]any{"format": format}, map[string]any{"rows": counts})
+}
+
+func writeOrgArchive(ctx context.Context, st *store.Store, archive *zip.Writer, orgID string, exportedAt time.Time, counts map[string]int) error {
+	for _, section := range store.OrgExportSections {
+		f, err := archive.Create(section + ".jsonl")
+		if err != nil {
+			return err
+		}
+		err = st.ExportOrgRows(ctx, orgID, section, func(row json.RawMessage) error {
+			counts[section]++
+			if _, err := f.Write(row); err != nil {
+				return err
+			}
+			_, err := io.WriteString(f, "\n")
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	f, err := archive.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(f).Encode(map[string]any{
+		"org_id":      orgID,
+		"exported_at": exportedAt,
+		"rows":        counts,
+	})
+}
+
+// handleOrgDeletion schedules, reports on or cancels the org's deletion.
+// Scheduling needs {"confirm": "<org id>"}; the org is purged from
+// Postgres, the vector index and the object store once the configured
+// grace period has passed, and each step leaves a receipt in audit_log.
+func (h *Handler) handleOrgDeletion(w http.ResponseWriter, r *http.Request, orgID string, actor string) {
+	ctx := r.Context()
+	switch r.Method {
+	case http.MethodGet:
+		d, err := h.Store.GetOrgDeletion(ctx, orgID)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "no deletion requested", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, orgDeletionResponse(d))
+	case http.MethodPost:
+		var req struct {
+			Confirm string `json:"confirm"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(req.Confirm) != orgID {
+			http.Error(w, "confirm must be the org id", http.StatusBadRequest)
+			return
+		}
+		exists, err := h.Store.OrgExists(ctx, orgID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, "org not found", http.StatusNotFound)
+			return
+		}
+		purgeAfter := time.Now().UTC().Add(h.Config.OrgDeletion.GracePeriod)
+		d, created, err := h.Store.RequestOrgDeletion(ctx, orgID, actor, purgeAfter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp := orgDeletionResponse(d)
+		if !created {
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+		h.recordOrgAudit(r, store.AuditOrgDeletionRequested, orgID, actor, map[string]any{"org_id": orgID}, resp)
+		writeJSON(w, http.StatusAccepted, resp)
+	case http.MethodDelete:
+		canceled, err := h.Store.CancelOrgDeletion(ctx, orgID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !canceled {
+			http.Error(w, "no pending deletion", http.StatusNotFound)
+			return
+		}
+		d, err := h.Store.GetOrgDeletion(ctx, orgID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp := orgDeletionResponse(d)
+		h.recordOrgAudit(r, store.AuditOrgDeletionCanceled, orgID, actor, map[string]any{"org_id": orgID}, resp)
+		writeJSON(w, http.StatusOK, resp)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// recordOrgAudit leaves an audit_log receipt for a control-plane action on
+// the org. It is best effort: the action has already happened.
+func (h *Handler) recordOrgAudit(r *http.Request, toolName string, orgID string, actor string, inputs any, outputs any) {
+	ctx := r.Context()
+	toolCallID, err := h.Store.RecordToolCall(ctx, toolName, orgID, "", "control-plane", 0)
+	if err != nil {
+		slog.WarnContext(ctx, "org audit not recorded", "tool", toolName, "org", orgID, "err", err)
+		return
+	}
+	outputsJSON, _ := json.Marshal(outputs)
+	err = h.Store.RecordAudit(ctx, store.AuditRecord{
+		ToolCallID:  toolCallID,
+		OrgID:       orgID,
+		Actor:       actor,
+		InputsHash:  hashAny(inputs),
+		OutputsHash: hashAny(outputs),
+		Outputs:     outputsJSON,
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "org audit not recorded", "tool", toolName, "org", orgID, "err", err)
+	}
+}
+
+func orgDeletionResponse(d store.OrgDeletion) map[string]any {
+	status := "pending"
+	switch {
+	case d.PurgedAt.Valid:
+		status = "purged"
+	case d.CanceledAt.Valid:
+		status = "canceled"
+	}
+	resp := map[string]any{
+		"org_id":       d.OrgID,
+		"status":       status,
+		"requested_by": d.RequestedBy,
+		"requested_at": d.RequestedAt,
+		"purge_after":  d.PurgeAfter,
+	}
+	if d.CanceledAt.Valid {
+		resp["canceled_at"] = d.CanceledAt.Time
+	}
+	if d.PurgedAt.Valid {
+		resp["purged_at"] = d.PurgedAt.Time
+		resp["receipt"] = d.Receipt
+	}
+	return resp
+}
@@ -0,0 +1,72 @@
+package cloudapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"neuralmail/internal/store"
+)
+
+// handleAdminOrgMerge serves POST /v1/admin/orgs/merge, which folds
+// source_org_id into target_org_id for companies consolidating accounts:
+// inboxes, domains, mail, cloud API keys, usage and the subscription move
+// over in one transaction and the source is left empty. With dry_run the
+// merge runs and is rolled back, returning the same report. A merge the
+// report lists conflicts for answers 409 and changes nothing.
+func (h *Handler) handleAdminOrgMerge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	principal, err := h.requirePlatformAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	var req struct {
+		SourceOrgID string `json:"source_org_id"`
+		TargetOrgID string `json:"target_org_id"`
+		DryRun      bool   `json:"dry_run"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	req.SourceOrgID, req.TargetOrgID = strings.TrimSpace(req.SourceOrgID), strings.TrimSpace(req.TargetOrgID)
+	for _, id := range []string{req.SourceOrgID, req.TargetOrgID} {
+		if _, err := uuid.Parse(id); err != nil {
+			http.Error(w, "source_org_id and target_org_id must be org ids", http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := h.Store.MergeOrgs(r.Context(), req.SourceOrgID, req.TargetOrgID, principal.ActorID, req.DryRun)
+	switch {
+	case errors.Is(err, store.ErrOrgMergeConflict):
+		writeJSON(w, http.StatusConflict, report)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !req.DryRun {
+		inputHash := hashAny(map[string]any{
+			"source_org_id": req.SourceOrgID,
+			"target_org_id": req.TargetOrgID,
+		})
+		if toolCallID, err := h.Store.RecordToolCall(r.Context(), "merge_orgs", req.SourceOrgID, "", "control-plane", 0); err == nil {
+			_ = h.Store.RecordAudit(r.Context(), store.AuditRecord{
+				ToolCallID:  toolCallID,
+				OrgID:       req.TargetOrgID,
+				Actor:       principal.ActorID,
+				InputsHash:  inputHash,
+				OutputsHash: hashAny(report),
+			})
+		}
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,169 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"neuralmail/internal/outbox"
+)
+
+// transportRequest is the body of a PUT that picks a transport; "" falls
+// back to the next level.
+type transportRequest struct {
+	OrgID     string `json:"org_id"`
+	Transport string `json:"transport"`
+}
+
+// decodeTransport reads and checks a transportRequest; it has answered the
+// request when ok is false.
+func decodeTransport(w http.ResponseWriter, r *http.Request) (transportRequest, bool) {
+	var req transportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return req, false
+	}
+	req.Transport = strings.ToLower(strings.TrimSpace(req.Transport))
+	if req.Transport != "" && !slices.Contains(outbox.TransportNames, req.Transport) {
+		http.Error(w, "transport must be one of "+strings.Join(outbox.TransportNames, ", ")+", or empty", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// transportResponse describes a transport setting. Configured says whether
+// this deployment has credentials for the transport the mail ends up on;
+// mail picked onto one without them waits in the outbox until they are set.
+func (h *Handler) transportResponse(transport, fallback string) map[string]any {
+	effective := transport
+	if effective == "" {
+		effective = fallback
+	}
+	_, configured := outbox.NewTransports(h.Config)[effective]
+	return map[string]any{
+		"transport":  transport,
+		"effective":  effective,
+		"configured": configured,
+	}
+}
+
+// handleOrgOutboundTransport serves GET and PUT /v1/orgs/outbound-transport,
+// the transport the org's mail leaves through: smtp, ses, sendgrid or
+// postmark, or "" for outbound.transport. A domain's own setting wins.
+func (h *Handler) handleOrgOutboundTransport(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	ctx := r.Context()
+	var orgID string
+	switch r.Method {
+	case http.MethodGet:
+		orgID, err = resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodPut:
+		req, ok := decodeTransport(w, r)
+		if !ok {
+			return
+		}
+		orgID, err = resolveOrgIDForPrincipal(principal, strings.TrimSpace(req.OrgID))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := h.Store.SetOrgOutboundTransport(ctx, orgID, req.Transport); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "org not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	transport, err := h.Store.GetOrgOutboundTransport(ctx, orgID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "org not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := h.transportResponse(transport, h.defaultTransport())
+	resp["org_id"] = orgID
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleDomainTransport serves GET and PUT /v1/domains/{id}/transport, the
+// transport mail from the domain leaves through once it is active; "" uses
+// the org's.
+func (h *Handler) handleDomainTransport(w http.ResponseWriter, r *http.Request, domainID string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	if r.Method == http.MethodPut {
+		req, ok := decodeTransport(w, r)
+		if !ok {
+			return
+		}
+		if err := h.Store.SetDomainOutboundTransport(ctx, orgID, domainID, req.Transport); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "domain not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	transport, err := h.Store.GetDomainOutboundTransport(ctx, orgID, domainID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "domain not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	orgTransport, err := h.Store.GetOrgOutboundTransport(ctx, orgID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fallback := orgTransport
+	if fallback == "" {
+		fallback = h.defaultTransport()
+	}
+	resp := h.transportResponse(transport, fallback)
+	resp["domain_id"] = domainID
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) defaultTransport() string {
+	if h.Config.Outbound.Transport == "" {
+		return outbox.TransportSMTP
+	}
+	return h.Config.Outbound.Transport
+}
@@ -0,0 +1,101 @@
+package cloudapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"neuralmail/internal/store"
+)
+
+// maxAddOnQuantity caps how many of one add-on a checkout may buy.
+const maxAddOnQuantity = 100
+
+var errInvalidOrder = errors.New("invalid order")
+
+// handlePlans serves GET /v1/plans, the catalog checkout sells from: the
+// listed plans with their limits, prices and overage pricing, and the
+// add-ons that stack on any of them. The catalog is public, like a pricing
+// page.
+func (h *Handler) handlePlans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	plans, err := h.Store.ListPlanEntitlements(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	addOns, err := h.Store.ListPlanAddOns(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	planItems := make([]map[string]any, 0, len(plans))
+	for _, plan := range plans {
+		if !plan.Listed {
+			continue
+		}
+		planItems = append(planItems, map[string]any{
+			"plan_code":                    plan.PlanCode,
+			"display_name":                 plan.DisplayName,
+			"monthly_price_cents":          plan.MonthlyPriceCents,
+			"monthly_units":                plan.MonthlyUnits,
+			"mcp_rpm":                      plan.MCPRPM,
+			"token_rpm":                    plan.TokenRPM,
+			"ip_rpm":                       plan.IPRPM,
+			"max_inboxes":                  plan.MaxInboxes,
+			"max_domains":                  plan.MaxDomains,
+			"overage_cents_per_1000_units": plan.OverageCentsPer1000Units,
+			"audit_retention_days":         plan.AuditRetentionDays,
+			"default":                      plan.PlanCode == h.Config.Billing.DefaultPlan,
+		})
+	}
+	addOnItems := make([]map[string]any, 0, len(addOns))
+	for _, a := range addOns {
+		addOnItems = append(addOnItems, map[string]any{
+			"code":                a.Code,
+			"display_name":        a.DisplayName,
+			"monthly_price_cents": a.MonthlyPriceCents,
+			"extra_inboxes":       a.ExtraInboxes,
+			"extra_domains":       a.ExtraDomains,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"plans":   planItems,
+		"add_ons": addOnItems,
+	})
+}
+
+// validateCheckoutOrder checks an order against the catalog; errors wrapping
+// errInvalidOrder are the caller's.
+func (h *Handler) validateCheckoutOrder(ctx context.Context, order billingCheckoutOrder) error {
+	if _, err := h.Store.GetPlanEntitlement(ctx, order.PlanCode); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: unknown plan %q", errInvalidOrder, order.PlanCode)
+		}
+		return err
+	}
+	if len(order.AddOns) == 0 {
+		return nil
+	}
+	catalog, err := h.Store.ListPlanAddOns(ctx)
+	if err != nil {
+		return err
+	}
+	for code, quantity := range order.AddOns {
+		if !slices.ContainsFunc(catalog, func(a store.PlanAddOn) bool { return a.Code == code }) {
+			return fmt.Errorf("%w: unknown add-on %q", errInvalidOrder, code)
+		}
+		if quantity < 1 || quantity > maxAddOnQuantity {
+			return fmt.Errorf("%w: add-on %q quantity must be between 1 and %d", errInvalidOrder, code, maxAddOnQuantity)
+		}
+	}
+	return nil
+}
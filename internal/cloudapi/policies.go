@@ -0,0 +1,64 @@
+package cloudapi
+
+import (
+	"net/http"
+	"strings"
+
+	"neuralmail/internal/policy"
+)
+
+// findPolicy loads the deployment policies (the default and, if set, the
+// canary one) and returns the one with the given ID.
+func (h *Handler) findPolicy(id string) (policy.Policy, bool, error) {
+	for _, path := range []string{h.Config.Policy.DefaultPath, h.Config.Canary.PolicyPath} {
+		if strings.TrimSpace(path) == "" {
+			continue
+		}
+		p, err := policy.Load(path)
+		if err != nil {
+			return policy.Policy{}, false, err
+		}
+		if p.ID == id {
+			return p, true, nil
+		}
+	}
+	return policy.Policy{}, false, nil
+}
+
+// handlePolicyByID serves GET /v1/policies/{id}/rules, so dashboards can map
+// the rule IDs in draft results and audit entries back to the rule text.
+func (h *Handler) handlePolicyByID(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.requireAnyScope(r, "nerve:admin.billing", "nerve:email.read", "nerve:email.draft"); err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/policies/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "rules" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	p, ok, err := h.findPolicy(parts[0])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "policy not found", http.StatusNotFound)
+		return
+	}
+	rules := p.Rules()
+	if rules == nil {
+		rules = []policy.Rule{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"policy_id": p.ID,
+		"name":      p.Name,
+		"version":   p.Version,
+		"rules":     rules,
+	})
+}
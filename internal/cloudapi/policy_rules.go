@@ -0,0 +1,284 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"neuralmail/internal/policy"
+	"neuralmail/internal/store"
+	"neuralmail/internal/tools"
+)
+
+const (
+	defaultPolicyHistoryLimit = 20
+	maxPolicyHistoryLimit     = 100
+	maxPolicyNoteLength       = 500
+	maxPolicyTestTextLength   = 64 << 10
+)
+
+// handlePolicyRules serves the org's own policy rules:
+//
+//	GET /v1/policy-rules  the version in force
+//	PUT /v1/policy-rules  saves the rules as the next version
+//
+// Each save is a new version; drafts record the version they were checked
+// against.
+func (h *Handler) handlePolicyRules(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	ctx := r.Context()
+	switch r.Method {
+	case http.MethodGet:
+		orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		current, err := h.Store.GetOrgPolicy(ctx, orgID)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSON(w, http.StatusOK, map[string]any{"org_id": orgID, "version": 0, "rules": []policy.CustomRule{}, "checks": []policy.Rule{}})
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp, err := orgPolicyResponse(current)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	case http.MethodPut:
+		var req struct {
+			OrgID string              `json:"org_id"`
+			Rules []policy.CustomRule `json:"rules"`
+			Note  string              `json:"note"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(req.OrgID))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rules, err := policy.ValidateCustomRules(req.Rules)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		note := strings.TrimSpace(req.Note)
+		if len(note) > maxPolicyNoteLength {
+			http.Error(w, "note too long", http.StatusBadRequest)
+			return
+		}
+		raw, err := json.Marshal(rules)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		saved, err := h.Store.AddOrgPolicyVersion(ctx, orgID, raw, note, principal.ActorID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp, err := orgPolicyResponse(saved)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePolicyRuleHistory serves GET /v1/policy-rules/history, the org's
+// policy versions newest first, or one of them with ?version=.
+func (h *Handler) handlePolicyRuleHistory(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(query.Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if raw := strings.TrimSpace(query.Get("version")); raw != "" {
+		version, err := strconv.Atoi(raw)
+		if err != nil || version <= 0 {
+			http.Error(w, "invalid version", http.StatusBadRequest)
+			return
+		}
+		v, err := h.Store.GetOrgPolicyVersion(r.Context(), orgID, version)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "policy version not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp, err := orgPolicyResponse(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	limit := defaultPolicyHistoryLimit
+	if raw := strings.TrimSpace(query.Get("limit")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxPolicyHistoryLimit)
+	}
+	versions, err := h.Store.ListOrgPolicyVersions(r.Context(), orgID, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	items := make([]map[string]any, 0, len(versions))
+	for _, v := range versions {
+		item, err := orgPolicyResponse(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		items = append(items, item)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"org_id": orgID, "versions": items})
+}
+
+// handlePolicyTest serves POST /v1/policies/test: it runs a text through
+// the org's policy, or through rules given with the request in place of
+// the org's own, without drafting or storing anything.
+func (h *Handler) handlePolicyTest(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireAnyScope(r, "nerve:admin.billing", "nerve:email.draft")
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		OrgID      string               `json:"org_id"`
+		PolicyID   string               `json:"policy_id"`
+		Text       string               `json:"text"`
+		Recipients []string             `json:"recipients"`
+		Rules      *[]policy.CustomRule `json:"rules"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		http.Error(w, "text is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Text) > maxPolicyTestTextLength {
+		http.Error(w, "text too long", http.StatusBadRequest)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(req.OrgID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	base, err := policy.Load(h.Config.Policy.DefaultPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if id := strings.TrimSpace(req.PolicyID); id != "" {
+		p, ok, err := h.findPolicy(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "policy not found", http.StatusNotFound)
+			return
+		}
+		base = p
+	}
+	active, err := tools.OrgPolicy(r.Context(), h.Store, base, orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if req.Rules != nil {
+		rules, err := policy.ValidateCustomRules(*req.Rules)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		active.Custom = base.Custom
+		active = active.WithOrgRules(0, rules)
+	}
+	body, _ := policy.ParseCitations(req.Text)
+	adjusted, res := policy.EvaluateFor(body, active, req.Recipients)
+	matched := res.MatchedRules
+	if matched == nil {
+		matched = []policy.Match{}
+	}
+	flags := res.RiskFlags
+	if flags == nil {
+		flags = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"policy_id":            active.ID,
+		"org_policy_version":   active.OrgVersion,
+		"allowed":              res.Allowed,
+		"violation_level":      res.ViolationLevel,
+		"reason":               res.Reason,
+		"needs_human_approval": res.NeedsApproval,
+		"risk_flags":           flags,
+		"link_findings":        res.LinkFindings,
+		"policy_rules":         matched,
+		"text":                 adjusted,
+	})
+}
+
+// orgPolicyResponse renders a saved policy version with the checks its
+// rules become.
+func orgPolicyResponse(v store.OrgPolicyVersion) (map[string]any, error) {
+	rules := []policy.CustomRule{}
+	if err := json.Unmarshal(v.Rules, &rules); err != nil {
+		return nil, err
+	}
+	checks := policy.Policy{Custom: rules}.Rules()
+	if checks == nil {
+		checks = []policy.Rule{}
+	}
+	return map[string]any{
+		"org_id":     v.OrgID,
+		"version":    v.Version,
+		"rules":      rules,
+		"checks":     checks,
+		"note":       v.Note,
+		"created_by": v.CreatedBy,
+		"created_at": v.CreatedAt,
+	}, nil
+}
@@ -0,0 +1,177 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"neuralmail/internal/store"
+	"neuralmail/internal/tools"
+)
+
+const maxPromptTemplateBytes = 32 << 10
+
+type promptTemplateResponse struct {
+	ID          string     `json:"id"`
+	Tool        string     `json:"tool"`
+	Version     int        `json:"version"`
+	Ref         string     `json:"ref"`
+	Body        string     `json:"body"`
+	Note        string     `json:"note,omitempty"`
+	CreatedBy   string     `json:"created_by,omitempty"`
+	Active      bool       `json:"active"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ActivatedAt *time.Time `json:"activated_at,omitempty"`
+}
+
+func toPromptTemplateResponse(p store.PromptTemplate) promptTemplateResponse {
+	return promptTemplateResponse{
+		ID:          p.ID,
+		Tool:        p.ToolName,
+		Version:     p.Version,
+		Ref:         p.Ref(),
+		Body:        p.Body,
+		Note:        p.Note,
+		CreatedBy:   p.CreatedBy,
+		Active:      p.Active,
+		CreatedAt:   p.CreatedAt,
+		ActivatedAt: p.ActivatedAt,
+	}
+}
+
+// handlePrompts serves GET and POST /v1/prompts, the org's prompt template
+// versions. GET lists them (?tool= narrows to one tool); POST adds the next
+// version of a tool's prompt, in use at once if it asks to be activated.
+func (h *Handler) handlePrompts(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+	switch r.Method {
+	case http.MethodGet:
+		orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		templates, err := h.Store.ListPromptTemplates(ctx, orgID, strings.TrimSpace(r.URL.Query().Get("tool")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp := make([]promptTemplateResponse, 0, len(templates))
+		for _, p := range templates {
+			resp = append(resp, toPromptTemplateResponse(p))
+		}
+		toolNames := make([]string, 0, len(tools.PromptTasks))
+		for tool := range tools.PromptTasks {
+			toolNames = append(toolNames, tool)
+		}
+		sort.Strings(toolNames)
+		writeJSON(w, http.StatusOK, map[string]any{"org_id": orgID, "templates": resp, "tools": toolNames})
+	case http.MethodPost:
+		var req struct {
+			OrgID    string `json:"org_id"`
+			Tool     string `json:"tool"`
+			Body     string `json:"body"`
+			Note     string `json:"note"`
+			Activate bool   `json:"activate"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(req.OrgID))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tool := strings.TrimSpace(req.Tool)
+		if _, ok := tools.PromptTasks[tool]; !ok {
+			http.Error(w, "tool has no replaceable prompt", http.StatusBadRequest)
+			return
+		}
+		body := strings.TrimSpace(req.Body)
+		if body == "" {
+			http.Error(w, "missing body", http.StatusBadRequest)
+			return
+		}
+		if len(body) > maxPromptTemplateBytes {
+			http.Error(w, "body too long", http.StatusBadRequest)
+			return
+		}
+		tmpl, err := h.Store.CreatePromptTemplate(ctx, orgID, tool, body, strings.TrimSpace(req.Note), principal.ActorID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if req.Activate {
+			tmpl, err = h.Store.ActivatePromptTemplate(ctx, orgID, tmpl.ID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, toPromptTemplateResponse(tmpl))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePromptByID serves POST /v1/prompts/{id}/activate, which puts a
+// version in use for its tool in place of the previous one, and
+// /v1/prompts/{id}/deactivate, which returns the tool to its built-in prompt.
+func (h *Handler) handlePromptByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/prompts/"), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	if _, err := uuid.Parse(parts[0]); err != nil {
+		http.Error(w, "prompt template not found", http.StatusNotFound)
+		return
+	}
+
+	var tmpl store.PromptTemplate
+	switch parts[1] {
+	case "activate":
+		tmpl, err = h.Store.ActivatePromptTemplate(r.Context(), orgID, parts[0])
+	case "deactivate":
+		tmpl, err = h.Store.DeactivatePromptTemplate(r.Context(), orgID, parts[0])
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "prompt template not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, toPromptTemplateResponse(tmpl))
+}
@@ -0,0 +1,115 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"neuralmail/internal/store"
+)
+
+// canonicalRegion validates a requested residency region against the
+// configured regions. The home region, by name or empty, is stored as "".
+func (h *Handler) canonicalRegion(region string) (string, error) {
+	region = strings.ToLower(strings.TrimSpace(region))
+	if region == "" || region == h.Config.Residency.HomeRegion {
+		return "", nil
+	}
+	if _, ok := h.Config.Residency.Regions[region]; !ok {
+		return "", fmt.Errorf("unknown region %q", region)
+	}
+	return region, nil
+}
+
+// displayRegion names a stored region tag for API responses.
+func (h *Handler) displayRegion(region string) string {
+	if region == "" {
+		return h.Config.Residency.HomeRegion
+	}
+	return region
+}
+
+func (h *Handler) availableRegions() []string {
+	var regions []string
+	if h.Config.Residency.HomeRegion != "" {
+		regions = append(regions, h.Config.Residency.HomeRegion)
+	}
+	for name := range h.Config.Residency.Regions {
+		regions = append(regions, name)
+	}
+	slices.Sort(regions)
+	return regions
+}
+
+// handleOrgRegion serves /v1/orgs/region. The region can only change before
+// the org creates its first inbox; afterwards its mail already lives there.
+func (h *Handler) handleOrgRegion(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+	var orgID string
+	switch r.Method {
+	case http.MethodGet:
+		orgID, err = resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodPut:
+		var req struct {
+			OrgID  string `json:"org_id"`
+			Region string `json:"region"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		orgID, err = resolveOrgIDForPrincipal(principal, strings.TrimSpace(req.OrgID))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		region, err := h.canonicalRegion(req.Region)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := h.Store.SetOrgRegion(ctx, orgID, region); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				http.Error(w, "org not found", http.StatusNotFound)
+			case errors.Is(err, store.ErrRegionHasData):
+				http.Error(w, err.Error(), http.StatusConflict)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	region, err := h.Store.GetOrgRegion(ctx, orgID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "org not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"org_id":            orgID,
+		"region":            h.displayRegion(region),
+		"available_regions": h.availableRegions(),
+	})
+}
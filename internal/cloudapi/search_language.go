@@ -0,0 +1,184 @@
+package cloudapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"neuralmail/internal/store"
+)
+
+// reindexBatchSize bounds each UPDATE issued while reindexing an inbox.
+const reindexBatchSize = 1000
+
+func (h *Handler) handleOrgSearchLanguage(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.handleGetOrgSearchLanguage(w, r)
+	case http.MethodPut:
+		h.handleSetOrgSearchLanguage(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) handleGetOrgSearchLanguage(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.writeSearchLanguage(r.Context(), w, orgID, nil)
+}
+
+// handleSetOrgSearchLanguage updates the org default, or a single inbox when
+// inbox_id is given, and reindexes the affected messages before responding.
+func (h *Handler) handleSetOrgSearchLanguage(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		OrgID    string `json:"org_id"`
+		InboxID  string `json:"inbox_id"`
+		Language string `json:"language"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(req.OrgID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	inboxID := strings.TrimSpace(req.InboxID)
+
+	config := ""
+	if inboxID == "" || strings.TrimSpace(req.Language) != "" {
+		config, err = store.FTSConfigForLanguage(req.Language)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	if inboxID == "" {
+		err = h.Store.SetOrgFTSConfig(ctx, orgID, config)
+	} else {
+		err = h.Store.SetInboxFTSConfig(ctx, orgID, inboxID, config)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	reindexed, err := h.reindexOrgInboxes(ctx, orgID, inboxID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeSearchLanguage(ctx, w, orgID, &reindexed)
+}
+
+// handleReindexOrgSearch resumes a reindex that was interrupted, e.g. by a
+// client timeout during a language change.
+func (h *Handler) handleReindexOrgSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	var req struct {
+		OrgID   string `json:"org_id"`
+		InboxID string `json:"inbox_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(req.OrgID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reindexed, err := h.reindexOrgInboxes(r.Context(), orgID, strings.TrimSpace(req.InboxID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeSearchLanguage(r.Context(), w, orgID, &reindexed)
+}
+
+func (h *Handler) reindexOrgInboxes(ctx context.Context, orgID string, inboxID string) (int64, error) {
+	inboxIDs := []string{inboxID}
+	if inboxID == "" {
+		ids, err := h.Store.ListInboxesByOrg(ctx, orgID)
+		if err != nil {
+			return 0, err
+		}
+		inboxIDs = ids
+	}
+	var total int64
+	for _, id := range inboxIDs {
+		n, err := h.Store.ReindexInboxFTS(ctx, id, reindexBatchSize)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (h *Handler) writeSearchLanguage(ctx context.Context, w http.ResponseWriter, orgID string, reindexed *int64) {
+	orgConfig, err := h.Store.GetOrgFTSConfig(ctx, orgID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "org not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	inboxes, err := h.Store.ListInboxFTSConfigs(ctx, orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	items := make([]map[string]any, 0, len(inboxes))
+	for _, inbox := range inboxes {
+		items = append(items, map[string]any{
+			"inbox_id": inbox.InboxID,
+			"config":   inbox.Config,
+			"override": inbox.Override,
+		})
+	}
+	resp := map[string]any{
+		"org_id":  orgID,
+		"config":  orgConfig,
+		"inboxes": items,
+	}
+	if reindexed != nil {
+		resp["reindexed_messages"] = *reindexed
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,89 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"neuralmail/internal/store"
+)
+
+// maxRerankBudget caps the latency an org may allow re-ranking to add.
+const maxRerankBudget = 5 * time.Second
+
+// handleOrgSearchRerank serves GET and PUT /v1/orgs/search-rerank, the org's
+// opt-in to re-ranking search_inbox hits. PUT takes enabled and an optional
+// latency_budget_ms; 0 uses the server default.
+func (h *Handler) handleOrgSearchRerank(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+	var orgID string
+	switch r.Method {
+	case http.MethodGet:
+		orgID, err = resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodPut:
+		var req struct {
+			OrgID           string `json:"org_id"`
+			Enabled         bool   `json:"enabled"`
+			LatencyBudgetMS int64  `json:"latency_budget_ms"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		orgID, err = resolveOrgIDForPrincipal(principal, strings.TrimSpace(req.OrgID))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		budget := time.Duration(req.LatencyBudgetMS) * time.Millisecond
+		if budget < 0 || budget > maxRerankBudget {
+			http.Error(w, "latency_budget_ms must be between 0 and 5000", http.StatusBadRequest)
+			return
+		}
+		if err := h.Store.SetOrgSearchRerank(ctx, orgID, store.SearchRerank{Enabled: req.Enabled, LatencyBudget: budget}); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "org not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	setting, err := h.Store.GetOrgSearchRerank(ctx, orgID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "org not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	budget := setting.LatencyBudget
+	if budget == 0 {
+		budget = h.Config.Rerank.LatencyBudget
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"org_id":            orgID,
+		"enabled":           setting.Enabled,
+		"provider":          h.Config.Rerank.Provider,
+		"candidates":        h.Config.Rerank.Candidates,
+		"latency_budget_ms": budget.Milliseconds(),
+	})
+}
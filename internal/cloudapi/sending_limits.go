@@ -0,0 +1,179 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"neuralmail/internal/outbox"
+	"neuralmail/internal/store"
+)
+
+// sendingLimitsRequest is the body of a PUT that sets sending limits. Both
+// are replaced: null unsets a limit, 0 lifts it.
+type sendingLimitsRequest struct {
+	OrgID           string `json:"org_id"`
+	HourlyMessages  *int   `json:"hourly_messages"`
+	DailyRecipients *int   `json:"daily_recipients"`
+}
+
+// decodeSendingLimits reads and checks a sendingLimitsRequest; it has
+// answered the request when ok is false.
+func decodeSendingLimits(w http.ResponseWriter, r *http.Request) (sendingLimitsRequest, store.SendLimits, bool) {
+	var req sendingLimitsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return req, store.SendLimits{}, false
+	}
+	var limits store.SendLimits
+	for _, f := range []struct {
+		value *int
+		into  *sql.NullInt64
+	}{{req.HourlyMessages, &limits.HourlyMessages}, {req.DailyRecipients, &limits.DailyRecipients}} {
+		if f.value == nil {
+			continue
+		}
+		if *f.value < 0 {
+			http.Error(w, "limits must be null or at least 0", http.StatusBadRequest)
+			return req, limits, false
+		}
+		*f.into = sql.NullInt64{Int64: int64(*f.value), Valid: true}
+	}
+	return req, limits, true
+}
+
+// limitValue renders a limit as JSON, null when it is unset.
+func limitValue(v sql.NullInt64) any {
+	if !v.Valid {
+		return nil
+	}
+	return v.Int64
+}
+
+// handleOrgSendingLimits serves GET and PUT /v1/orgs/sending-limits, the
+// messages per hour and recipients per day an org may send. Effective gives
+// the limits in force, with outbound defaults filled in; 0 is unlimited.
+func (h *Handler) handleOrgSendingLimits(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	ctx := r.Context()
+	var orgID string
+	switch r.Method {
+	case http.MethodGet:
+		orgID, err = resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodPut:
+		req, limits, ok := decodeSendingLimits(w, r)
+		if !ok {
+			return
+		}
+		orgID, err = resolveOrgIDForPrincipal(principal, strings.TrimSpace(req.OrgID))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := h.Store.SetOrgSendLimits(ctx, orgID, limits); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "org not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	limits, err := h.Store.GetOrgSendLimits(ctx, orgID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "org not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	effective := outbox.SendLimits{HourlyMessages: h.Config.Outbound.HourlyMessages, DailyRecipients: h.Config.Outbound.DailyRecipients}.Override(limits)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"org_id":           orgID,
+		"hourly_messages":  limitValue(limits.HourlyMessages),
+		"daily_recipients": limitValue(limits.DailyRecipients),
+		"effective": map[string]any{
+			"hourly_messages":  effective.HourlyMessages,
+			"daily_recipients": effective.DailyRecipients,
+		},
+	})
+}
+
+// handleDomainSendingLimits serves GET and PUT
+// /v1/domains/{id}/sending-limits, limits on the mail sent from the domain
+// on top of the org's. Warmup describes the domain's warm-up while it runs.
+func (h *Handler) handleDomainSendingLimits(w http.ResponseWriter, r *http.Request, domainID string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	if r.Method == http.MethodPut {
+		_, limits, ok := decodeSendingLimits(w, r)
+		if !ok {
+			return
+		}
+		if err := h.Store.SetDomainSendLimits(ctx, orgID, domainID, limits); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "domain not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	d, err := h.Store.GetDomainSendLimits(ctx, orgID, domainID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "domain not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := map[string]any{
+		"domain_id":        d.DomainID,
+		"domain":           d.Domain,
+		"hourly_messages":  limitValue(d.HourlyMessages),
+		"daily_recipients": limitValue(d.DailyRecipients),
+		"warmup":           nil,
+	}
+	if d.WarmupStartedAt.Valid {
+		started := d.WarmupStartedAt.Time
+		if limit, next, ok := outbox.WarmupCap(h.Config.Outbound.Warmup, started, time.Now()); ok {
+			resp["warmup"] = map[string]any{
+				"started_at":       started,
+				"daily_recipients": limit,
+				"next_step_at":     next,
+				"ends_at":          started.Add(time.Duration(len(h.Config.Outbound.Warmup)) * 24 * time.Hour),
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
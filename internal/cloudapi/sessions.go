@@ -0,0 +1,166 @@
+package cloudapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"neuralmail/internal/store"
+)
+
+// LiveSessions ends MCP sessions on every MCP server at once; *queue.Queue
+// implements it.
+type LiveSessions interface {
+	DeleteSession(ctx context.Context, id string) error
+}
+
+type sessionClientResponse struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type sessionResponse struct {
+	ID                string                `json:"id"`
+	ActorID           string                `json:"actor_id"`
+	TokenID           string                `json:"token_id,omitempty"`
+	AuthMethod        string                `json:"auth_method"`
+	Client            sessionClientResponse `json:"client"`
+	ProtocolVersion   string                `json:"protocol_version,omitempty"`
+	RemoteAddr        string                `json:"remote_addr,omitempty"`
+	CreatedAt         time.Time             `json:"created_at"`
+	LastActivityAt    time.Time             `json:"last_activity_at"`
+	ExpiresAt         time.Time             `json:"expires_at"`
+	TerminatedAt      *time.Time            `json:"terminated_at,omitempty"`
+	TerminationReason string                `json:"termination_reason,omitempty"`
+	TerminatedBy      string                `json:"terminated_by,omitempty"`
+}
+
+func toSessionResponse(sess store.MCPSession) sessionResponse {
+	resp := sessionResponse{
+		ID:                sess.ID,
+		ActorID:           sess.ActorID,
+		TokenID:           sess.TokenID,
+		AuthMethod:        sess.AuthMethod,
+		Client:            sessionClientResponse{Name: sess.ClientName, Version: sess.ClientVersion},
+		ProtocolVersion:   sess.ProtocolVersion,
+		RemoteAddr:        sess.RemoteAddr,
+		CreatedAt:         sess.CreatedAt,
+		LastActivityAt:    sess.LastActivityAt,
+		ExpiresAt:         sess.ExpiresAt,
+		TerminationReason: sess.TerminationReason,
+		TerminatedBy:      sess.TerminatedBy,
+	}
+	if sess.TerminatedAt.Valid {
+		terminatedAt := sess.TerminatedAt.Time
+		resp.TerminatedAt = &terminatedAt
+	}
+	return resp
+}
+
+// handleSessions serves GET /v1/sessions, the org's MCP connection audit.
+// Only live sessions are listed unless status=all.
+func (h *Handler) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var includeEnded bool
+	switch status := strings.TrimSpace(r.URL.Query().Get("status")); status {
+	case "", "active":
+	case "all":
+		includeEnded = true
+	default:
+		http.Error(w, "status must be active or all", http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 && parsed <= 200 {
+			limit = parsed
+		}
+	}
+
+	sessions, err := h.Store.ListMCPSessionsByOrg(r.Context(), orgID, includeEnded, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := make([]sessionResponse, 0, len(sessions))
+	for _, sess := range sessions {
+		resp = append(resp, toSessionResponse(sess))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"sessions": resp})
+}
+
+// handleSessionByID serves the per-session routes:
+//
+//	GET    /v1/sessions/{id}
+//	DELETE /v1/sessions/{id}
+//
+// DELETE force-terminates the session; the MCP server rejects its next
+// request with the termination reason.
+func (h *Handler) handleSessionByID(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	sessionID := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/v1/sessions/"))
+	if sessionID == "" || strings.Contains(sessionID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		sess, err := h.Store.GetMCPSessionForOrg(r.Context(), orgID, sessionID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "session not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, toSessionResponse(sess))
+	case http.MethodDelete:
+		ended, err := h.Store.EndMCPSession(r.Context(), orgID, sessionID, store.SessionEndAdmin, principal.ActorID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ended {
+			http.Error(w, "session not found or already ended", http.StatusNotFound)
+			return
+		}
+		if h.LiveSessions != nil {
+			if err := h.LiveSessions.DeleteSession(r.Context(), sessionID); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"status": "terminated"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -3,6 +3,7 @@ package cloudapi
 import (
 	"context"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -19,15 +20,24 @@ type IssuedToken struct {
 	TokenID   string    `json:"token_id"`
 	ExpiresAt time.Time `json:"expires_at"`
 	Scopes    []string  `json:"scopes"`
+	// InboxIDs lists the inboxes the token is restricted to, if any.
+	InboxIDs []string `json:"inbox_ids,omitempty"`
+	// CertThumbprint is the x5t#S256 the token is bound to, if any.
+	CertThumbprint string `json:"cert_thumbprint,omitempty"`
 }
 
 type ServiceTokenIssuer interface {
-	IssueServiceToken(ctx context.Context, orgID string, actor string, scopes []string, ttl time.Duration, rotate bool) (IssuedToken, error)
+	IssueServiceToken(ctx context.Context, orgID string, actor string, scopes []string, inboxIDs []string, ttl time.Duration, rotate bool, certThumbprint string) (IssuedToken, error)
 }
 
+// TokenService mints service JWTs. Issuer and Audience, when set, go into
+// iss and aud so the tokens only verify on the deployment they were minted
+// for.
 type TokenService struct {
 	Store      *store.Store
 	SigningKey []byte
+	Issuer     string
+	Audience   string
 	Now        func() time.Time
 }
 
@@ -39,7 +49,9 @@ func NewTokenService(st *store.Store, signingKey string) *TokenService {
 	}
 }
 
-func (s *TokenService) IssueServiceToken(ctx context.Context, orgID string, actor string, scopes []string, ttl time.Duration, rotate bool) (IssuedToken, error) {
+// IssueServiceToken mints a token for orgID. A non-empty inboxIDs restricts
+// it to those inboxes, both in its inbox_ids claim and its stored record.
+func (s *TokenService) IssueServiceToken(ctx context.Context, orgID string, actor string, scopes []string, inboxIDs []string, ttl time.Duration, rotate bool, certThumbprint string) (IssuedToken, error) {
 	var issued IssuedToken
 	if s == nil || s.Store == nil {
 		return issued, errors.New("token service not configured")
@@ -76,6 +88,18 @@ func (s *TokenService) IssueServiceToken(ctx context.Context, orgID string, acto
 		"exp":       expiresAt.Unix(),
 		"token_use": "service",
 	}
+	if s.Issuer != "" {
+		jwtClaims["iss"] = s.Issuer
+	}
+	if s.Audience != "" {
+		jwtClaims["aud"] = s.Audience
+	}
+	if len(inboxIDs) > 0 {
+		jwtClaims["inbox_ids"] = inboxIDs
+	}
+	if certThumbprint != "" {
+		jwtClaims["cnf"] = map[string]any{"x5t#S256": certThumbprint}
+	}
 	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwtClaims)
 	token, err := tok.SignedString(s.SigningKey)
 	if err != nil {
@@ -87,16 +111,17 @@ func (s *TokenService) IssueServiceToken(ctx context.Context, orgID string, acto
 			return issued, err
 		}
 	}
-	if err := s.Store.CreateServiceToken(ctx, tokenID, orgID, actor, scopes, expiresAt); err != nil {
+	if err := s.Store.CreateServiceToken(ctx, tokenID, orgID, actor, scopes, inboxIDs, expiresAt); err != nil {
 		return issued, err
 	}
 
 	inputHash := hashAny(map[string]any{
-		"org_id": orgID,
-		"actor":  actor,
-		"scopes": scopes,
-		"ttl":    ttl.Seconds(),
-		"rotate": rotate,
+		"org_id":    orgID,
+		"actor":     actor,
+		"scopes":    scopes,
+		"inbox_ids": inboxIDs,
+		"ttl":       ttl.Seconds(),
+		"rotate":    rotate,
 	})
 	outputHash := hashAny(map[string]any{
 		"token_id":   tokenID,
@@ -105,18 +130,33 @@ func (s *TokenService) IssueServiceToken(ctx context.Context, orgID string, acto
 	})
 	toolCallID, err := s.Store.RecordToolCall(ctx, "issue_service_token", tokenID, "", "control-plane", 0)
 	if err == nil {
-		_ = s.Store.RecordAudit(ctx, toolCallID, actor, inputHash, outputHash, "")
+		_ = s.Store.RecordAudit(ctx, store.AuditRecord{
+			ToolCallID:  toolCallID,
+			OrgID:       orgID,
+			Actor:       actor,
+			InputsHash:  inputHash,
+			OutputsHash: outputHash,
+		})
 	}
 
 	issued = IssuedToken{
-		Token:     token,
-		TokenID:   tokenID,
-		ExpiresAt: expiresAt,
-		Scopes:    scopes,
+		Token:          token,
+		TokenID:        tokenID,
+		ExpiresAt:      expiresAt,
+		Scopes:         scopes,
+		InboxIDs:       inboxIDs,
+		CertThumbprint: certThumbprint,
 	}
 	return issued, nil
 }
 
+// validCertThumbprint reports whether v looks like an x5t#S256: a SHA-256
+// digest in unpadded base64url.
+func validCertThumbprint(v string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(v)
+	return err == nil && len(b) == sha256.Size
+}
+
 func hashAny(value any) string {
 	data, err := json.Marshal(value)
 	if err != nil {
@@ -0,0 +1,103 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"neuralmail/internal/entitlements"
+)
+
+const (
+	defaultForecastLookbackDays = 7
+	maxForecastLookbackDays     = 90
+)
+
+// handleUsageForecast estimates when the org exhausts its monthly units.
+// Optional query params: lookback_days (trailing window, default 7) and
+// daily_tool_calls (adds a what-if projection at that call volume).
+func (h *Handler) handleUsageForecast(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	query := r.URL.Query()
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(query.Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lookback := defaultForecastLookbackDays
+	if raw := strings.TrimSpace(query.Get("lookback_days")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxForecastLookbackDays {
+			http.Error(w, "lookback_days must be between 1 and 90", http.StatusBadRequest)
+			return
+		}
+		lookback = parsed
+	}
+	var dailyCalls float64
+	if raw := strings.TrimSpace(query.Get("daily_tool_calls")); raw != "" {
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "daily_tool_calls must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+		dailyCalls = parsed
+	}
+
+	ctx := r.Context()
+	ent, err := h.Store.GetOrgEntitlement(ctx, orgID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "entitlement not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	used, err := h.Store.GetOrgUsageCounterUsed(ctx, orgID, "mcp_units", ent.UsagePeriodStart)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now().UTC()
+	since := now.AddDate(0, 0, -lookback).Truncate(24 * time.Hour)
+	history, err := h.Store.ListDailyUsage(ctx, orgID, "mcp_units", since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	plans, err := h.Store.ListPlanEntitlements(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	forecast := entitlements.ForecastUsage(entitlements.ForecastInput{
+		Now:                now,
+		PeriodStart:        ent.UsagePeriodStart,
+		PeriodEnd:          ent.UsagePeriodEnd,
+		MonthlyUnits:       ent.MonthlyUnits,
+		Used:               used,
+		History:            history,
+		LookbackDays:       lookback,
+		ScenarioDailyCalls: dailyCalls,
+		Plans:              plans,
+		CurrentPlan:        ent.PlanCode,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{
+		"org_id":    orgID,
+		"plan_code": ent.PlanCode,
+		"forecast":  forecast,
+	})
+}
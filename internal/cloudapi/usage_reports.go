@@ -0,0 +1,234 @@
+package cloudapi
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxUsageReportDays bounds an explicit from/to range.
+const maxUsageReportDays = 366
+
+// usageReport is a resolved usage report request: whose usage, over
+// [From, To), and as json or csv.
+type usageReport struct {
+	OrgID  string
+	Period string
+	From   time.Time
+	To     time.Time
+	Format string
+}
+
+type meterUsageResponse struct {
+	MeterName string `json:"meter_name"`
+	Calls     int64  `json:"calls"`
+	Units     int64  `json:"units"`
+	Failed    int64  `json:"failed"`
+}
+
+type dailyUsageResponse struct {
+	Day       string `json:"day"`
+	MeterName string `json:"meter_name"`
+	ToolName  string `json:"tool_name,omitempty"`
+	Calls     int64  `json:"calls"`
+	Units     int64  `json:"units"`
+	Failed    int64  `json:"failed"`
+}
+
+// parseUsageReport authorizes a GET usage report and resolves its org,
+// period and format, writing the error response itself when it cannot. The
+// period is either from and to (YYYY-MM-DD, to exclusive), which is how an
+// invoice's service period is reconciled, or period as for /v1/usage, where
+// current is the org's billing period. format is json or csv, defaultFormat
+// when not given.
+func (h *Handler) parseUsageReport(w http.ResponseWriter, r *http.Request, defaultFormat string) (usageReport, bool) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return usageReport{}, false
+	}
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return usageReport{}, false
+	}
+	query := r.URL.Query()
+	report := usageReport{Format: strings.ToLower(strings.TrimSpace(query.Get("format")))}
+	report.OrgID, err = resolveOrgIDForPrincipal(principal, strings.TrimSpace(query.Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return usageReport{}, false
+	}
+	switch report.Format {
+	case "":
+		report.Format = defaultFormat
+	case "json", "csv":
+	default:
+		http.Error(w, "format must be json or csv", http.StatusBadRequest)
+		return usageReport{}, false
+	}
+
+	rawFrom, rawTo := strings.TrimSpace(query.Get("from")), strings.TrimSpace(query.Get("to"))
+	if rawFrom != "" || rawTo != "" {
+		report.From, report.To, err = usageRange(rawFrom, rawTo)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return usageReport{}, false
+		}
+		report.Period = "range"
+		return report, true
+	}
+
+	report.Period = strings.TrimSpace(query.Get("period"))
+	report.From, report.To, err = usagePeriod(report.Period, time.Now().UTC())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return usageReport{}, false
+	}
+	if report.Period == "" || report.Period == "current" {
+		report.Period = "current"
+		ent, err := h.Store.GetOrgEntitlement(r.Context(), report.OrgID)
+		switch {
+		case err == nil:
+			report.From, report.To = ent.UsagePeriodStart, ent.UsagePeriodEnd
+		case errors.Is(err, sql.ErrNoRows):
+			// No entitlement yet: fall back to the calendar month.
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return usageReport{}, false
+		}
+	}
+	return report, true
+}
+
+// usageRange parses an explicit [from, to) range of UTC dates.
+func usageRange(rawFrom, rawTo string) (time.Time, time.Time, error) {
+	if rawFrom == "" || rawTo == "" {
+		return time.Time{}, time.Time{}, errors.New("from and to must be given together")
+	}
+	from, err := time.Parse(time.DateOnly, rawFrom)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("from must be YYYY-MM-DD")
+	}
+	to, err := time.Parse(time.DateOnly, rawTo)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("to must be YYYY-MM-DD")
+	}
+	if !to.After(from) {
+		return time.Time{}, time.Time{}, errors.New("to must be after from")
+	}
+	if to.Sub(from) > maxUsageReportDays*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("range must be at most %d days", maxUsageReportDays)
+	}
+	return from, to, nil
+}
+
+// handleUsageMeters serves GET /v1/usage/meters, an org's usage by meter.
+func (h *Handler) handleUsageMeters(w http.ResponseWriter, r *http.Request) {
+	report, ok := h.parseUsageReport(w, r, "json")
+	if !ok {
+		return
+	}
+	usage, err := h.Store.ListMeterUsage(r.Context(), report.OrgID, report.From, report.To)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	meters := make([]meterUsageResponse, 0, len(usage))
+	for _, u := range usage {
+		meters = append(meters, meterUsageResponse{MeterName: u.MeterName, Calls: u.Calls, Units: u.Units, Failed: u.Failed})
+	}
+	if report.Format == "csv" {
+		rows := make([][]string, 0, len(meters))
+		for _, m := range meters {
+			rows = append(rows, []string{m.MeterName, itoa(m.Calls), itoa(m.Units), itoa(m.Failed)})
+		}
+		writeUsageCSV(w, report, "meters", []string{"meter_name", "calls", "units", "failed"}, rows)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"org_id":       report.OrgID,
+		"period":       report.Period,
+		"period_start": report.From,
+		"period_end":   report.To,
+		"meters":       meters,
+	})
+}
+
+// handleUsageDaily serves GET /v1/usage/daily, an org's usage by UTC day and
+// meter.
+func (h *Handler) handleUsageDaily(w http.ResponseWriter, r *http.Request) {
+	h.writeUsageByDay(w, r, "daily", false, "json")
+}
+
+// handleUsageExport serves GET /v1/usage/export, the most detailed report:
+// usage by UTC day, meter and tool, as CSV unless format=json asks otherwise.
+func (h *Handler) handleUsageExport(w http.ResponseWriter, r *http.Request) {
+	h.writeUsageByDay(w, r, "export", true, "csv")
+}
+
+func (h *Handler) writeUsageByDay(w http.ResponseWriter, r *http.Request, name string, byTool bool, defaultFormat string) {
+	report, ok := h.parseUsageReport(w, r, defaultFormat)
+	if !ok {
+		return
+	}
+	usage, err := h.Store.ListUsageByDay(r.Context(), report.OrgID, report.From, report.To, byTool)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	days := make([]dailyUsageResponse, 0, len(usage))
+	for _, u := range usage {
+		days = append(days, dailyUsageResponse{
+			Day:       u.Day.Format(time.DateOnly),
+			MeterName: u.MeterName,
+			ToolName:  u.ToolName,
+			Calls:     u.Calls,
+			Units:     u.Units,
+			Failed:    u.Failed,
+		})
+	}
+	if report.Format == "csv" {
+		header := []string{"day", "meter_name", "calls", "units", "failed"}
+		if byTool {
+			header = []string{"day", "meter_name", "tool_name", "calls", "units", "failed"}
+		}
+		rows := make([][]string, 0, len(days))
+		for _, d := range days {
+			row := []string{d.Day, d.MeterName}
+			if byTool {
+				row = append(row, d.ToolName)
+			}
+			rows = append(rows, append(row, itoa(d.Calls), itoa(d.Units), itoa(d.Failed)))
+		}
+		writeUsageCSV(w, report, name, header, rows)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"org_id":       report.OrgID,
+		"period":       report.Period,
+		"period_start": report.From,
+		"period_end":   report.To,
+		"days":         days,
+	})
+}
+
+// writeUsageCSV sends rows as a CSV attachment named after the report and
+// its period.
+func writeUsageCSV(w http.ResponseWriter, report usageReport, name string, header []string, rows [][]string) {
+	filename := fmt.Sprintf("usage-%s-%s-%s.csv", name, report.From.Format(time.DateOnly), report.To.Format(time.DateOnly))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+	out := csv.NewWriter(w)
+	_ = out.Write(header)
+	_ = out.WriteAll(rows)
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
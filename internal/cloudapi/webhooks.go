@@ -0,0 +1,396 @@
+package cloudapi
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"neuralmail/internal/store"
+	"neuralmail/internal/webhooks"
+)
+
+type webhookEndpointResponse struct {
+	ID            string    `json:"id"`
+	URL           string    `json:"url"`
+	Description   string    `json:"description"`
+	Status        string    `json:"status"`
+	APIVersion    string    `json:"api_version"`
+	SigningSecret string    `json:"signing_secret,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type webhookDeliveryResponse struct {
+	ID           string    `json:"id"`
+	EventID      string    `json:"event_id"`
+	EventType    string    `json:"event_type"`
+	Attempt      int       `json:"attempt"`
+	ResponseCode *int64    `json:"response_code"`
+	Error        string    `json:"error,omitempty"`
+	DurationMS   int       `json:"duration_ms"`
+	Delivered    bool      `json:"delivered"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (h *Handler) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.handleCreateWebhook(w, r)
+	case http.MethodGet:
+		h.handleListWebhooks(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleWebhookByID serves the per-endpoint routes:
+//
+//	PATCH  /v1/webhooks/{id}
+//	DELETE /v1/webhooks/{id}
+//	GET    /v1/webhooks/{id}/deliveries
+//	POST   /v1/webhooks/{id}/test
+//	POST   /v1/webhooks/{id}/redeliver/{event_id}
+func (h *Handler) handleWebhookByID(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/webhooks/"), "/")
+	if len(parts) == 0 || parts[0] == "" {
+		http.Error(w, "missing webhook id", http.StatusBadRequest)
+		return
+	}
+
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	endpointID := parts[0]
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPatch:
+		h.handleUpdateWebhook(w, r, orgID, endpointID)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		deleted, err := h.Store.DeleteWebhookEndpointForOrg(r.Context(), orgID, endpointID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			http.Error(w, "webhook not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"status": "deleted"})
+	case len(parts) == 2 && parts[1] == "deliveries" && r.Method == http.MethodGet:
+		h.handleListWebhookDeliveries(w, r, orgID, endpointID)
+	case len(parts) == 2 && parts[1] == "test" && r.Method == http.MethodPost:
+		h.handleTestWebhook(w, r, orgID, endpointID)
+	case len(parts) == 3 && parts[1] == "redeliver" && parts[2] != "" && r.Method == http.MethodPost:
+		h.handleRedeliverWebhook(w, r, orgID, endpointID, parts[2])
+	case len(parts) <= 3:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		OrgID       string `json:"org_id"`
+		URL         string `json:"url"`
+		Description string `json:"description"`
+		APIVersion  string `json:"api_version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(req.OrgID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	endpointURL, err := normalizeWebhookURL(req.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	apiVersion := strings.TrimSpace(req.APIVersion)
+	if apiVersion == "" {
+		apiVersion = webhooks.CurrentVersion
+	} else if !webhooks.ValidVersion(apiVersion) {
+		http.Error(w, "unknown api_version", http.StatusBadRequest)
+		return
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		http.Error(w, "failed to generate signing secret", http.StatusInternalServerError)
+		return
+	}
+
+	ep, err := h.Store.CreateWebhookEndpoint(r.Context(), orgID, endpointURL, secret, strings.TrimSpace(req.Description), apiVersion)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := toWebhookEndpointResponse(ep)
+	resp.SigningSecret = ep.SigningSecret
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.requireBillingAdmin(r)
+	if err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	orgID, err := resolveOrgIDForPrincipal(principal, strings.TrimSpace(r.URL.Query().Get("org_id")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	endpoints, err := h.Store.ListWebhookEndpoints(r.Context(), orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := make([]webhookEndpointResponse, 0, len(endpoints))
+	for _, ep := range endpoints {
+		resp = append(resp, toWebhookEndpointResponse(ep))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"webhooks": resp})
+}
+
+// handleUpdateWebhook moves an endpoint's version pin, the way an
+// integration upgrades once it reads the newer payloads.
+func (h *Handler) handleUpdateWebhook(w http.ResponseWriter, r *http.Request, orgID, endpointID string) {
+	var req struct {
+		APIVersion string `json:"api_version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	apiVersion := strings.TrimSpace(req.APIVersion)
+	if !webhooks.ValidVersion(apiVersion) {
+		http.Error(w, "unknown api_version", http.StatusBadRequest)
+		return
+	}
+	ep, err := h.Store.SetWebhookEndpointVersion(r.Context(), orgID, endpointID, apiVersion)
+	if err != nil {
+		writeWebhookLookupError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toWebhookEndpointResponse(ep))
+}
+
+// handleWebhookSchemas serves GET /v1/webhooks/schemas: the JSON Schema of
+// every event as sent to endpoints pinned to ?version= (default the current
+// one), and the versions an endpoint can be pinned to. Like the plan
+// catalog it is public, so integrations can validate payloads in CI.
+func (h *Handler) handleWebhookSchemas(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	version := strings.TrimSpace(r.URL.Query().Get("version"))
+	if version == "" {
+		version = webhooks.CurrentVersion
+	}
+	if !webhooks.ValidVersion(version) {
+		http.Error(w, "unknown version", http.StatusBadRequest)
+		return
+	}
+	schemas := map[string]any{}
+	for _, eventType := range webhooks.EventTypes() {
+		schema, err := webhooks.Schema(eventType, version)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		schemas[eventType] = schema
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"version":         version,
+		"current_version": webhooks.CurrentVersion,
+		"versions":        webhooks.Versions,
+		"schemas":         schemas,
+	})
+}
+
+func (h *Handler) handleListWebhookDeliveries(w http.ResponseWriter, r *http.Request, orgID, endpointID string) {
+	if _, err := h.Store.GetWebhookEndpointForOrg(r.Context(), orgID, endpointID); err != nil {
+		writeWebhookLookupError(w, err)
+		return
+	}
+	limit := 50
+	if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 && parsed <= 200 {
+			limit = parsed
+		}
+	}
+	deliveries, err := h.Store.ListWebhookDeliveries(r.Context(), orgID, endpointID, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := make([]webhookDeliveryResponse, 0, len(deliveries))
+	for _, d := range deliveries {
+		resp = append(resp, toWebhookDeliveryResponse(d))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"deliveries": resp})
+}
+
+func (h *Handler) handleTestWebhook(w http.ResponseWriter, r *http.Request, orgID, endpointID string) {
+	ep, err := h.Store.GetWebhookEndpointForOrg(r.Context(), orgID, endpointID)
+	if err != nil {
+		writeWebhookLookupError(w, err)
+		return
+	}
+	event, err := webhooks.NewTestEvent(time.Now().UTC(), ep.ID, ep.APIVersion)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.deliverWebhook(w, r, ep, event.ID, event.Type, payload, 1)
+}
+
+func (h *Handler) handleRedeliverWebhook(w http.ResponseWriter, r *http.Request, orgID, endpointID, eventID string) {
+	ep, err := h.Store.GetWebhookEndpointForOrg(r.Context(), orgID, endpointID)
+	if err != nil {
+		writeWebhookLookupError(w, err)
+		return
+	}
+	previous, err := h.Store.GetLatestWebhookDelivery(r.Context(), orgID, endpointID, eventID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "event not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.deliverWebhook(w, r, ep, previous.EventID, previous.EventType, previous.Payload, previous.Attempt+1)
+}
+
+// deliverWebhook sends synchronously and records the attempt so the caller
+// sees the receiver's status immediately, as in a developer console. The
+// reply body is kept in history but never returned, or registering an
+// endpoint would let a caller read back whatever its URL serves.
+func (h *Handler) deliverWebhook(w http.ResponseWriter, r *http.Request, ep store.WebhookEndpoint, eventID, eventType string, payload []byte, attempt int) {
+	sender := h.Webhooks
+	if sender == nil {
+		sender = webhooks.NewSender()
+	}
+	result := sender.Send(r.Context(), ep.URL, ep.SigningSecret, eventID, eventType, payload)
+
+	record := store.WebhookDelivery{
+		EndpointID:   ep.ID,
+		OrgID:        ep.OrgID,
+		EventID:      eventID,
+		EventType:    eventType,
+		Payload:      payload,
+		Attempt:      attempt,
+		ResponseBody: result.ResponseBody,
+		DurationMS:   int(result.Duration.Milliseconds()),
+	}
+	if result.StatusCode > 0 {
+		record.ResponseCode = sql.NullInt64{Int64: int64(result.StatusCode), Valid: true}
+	}
+	if result.Err != nil {
+		record.ErrorMessage = result.Err.Error()
+	}
+	saved, err := h.Store.RecordWebhookDelivery(r.Context(), record)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, toWebhookDeliveryResponse(saved))
+}
+
+func writeWebhookLookupError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "webhook not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func toWebhookEndpointResponse(ep store.WebhookEndpoint) webhookEndpointResponse {
+	return webhookEndpointResponse{
+		ID:          ep.ID,
+		URL:         ep.URL,
+		Description: ep.Description,
+		Status:      ep.Status,
+		APIVersion:  ep.APIVersion,
+		CreatedAt:   ep.CreatedAt,
+	}
+}
+
+func toWebhookDeliveryResponse(d store.WebhookDelivery) webhookDeliveryResponse {
+	resp := webhookDeliveryResponse{
+		ID:         d.ID,
+		EventID:    d.EventID,
+		EventType:  d.EventType,
+		Attempt:    d.Attempt,
+		Error:      d.ErrorMessage,
+		DurationMS: d.DurationMS,
+		CreatedAt:  d.CreatedAt,
+	}
+	if d.ResponseCode.Valid {
+		code := d.ResponseCode.Int64
+		resp.ResponseCode = &code
+		resp.Delivered = d.ErrorMessage == "" && code >= 200 && code < 300
+	}
+	return resp
+}
+
+func normalizeWebhookURL(raw string) (string, error) {
+	endpoint := strings.TrimSpace(raw)
+	if endpoint == "" {
+		return "", errors.New("missing url")
+	}
+	parsed, err := url.ParseRequestURI(endpoint)
+	if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+		return "", errors.New("invalid url")
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", errors.New("invalid url scheme")
+	}
+	if parsed.Fragment != "" {
+		return "", errors.New("url must not include a fragment")
+	}
+	return parsed.String(), nil
+}
+
+func generateWebhookSecret() (string, error) {
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(random), nil
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	"errors"
 	"os"
 	"strconv"
@@ -8,11 +9,37 @@ import (
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"neuralmail/internal/secrets"
 )
 
 type Config struct {
 	HTTP struct {
-		Addr string `yaml:"addr"`
+		Addr              string        `yaml:"addr"`
+		ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+		ReadTimeout       time.Duration `yaml:"read_timeout"`
+		WriteTimeout      time.Duration `yaml:"write_timeout"`
+		IdleTimeout       time.Duration `yaml:"idle_timeout"`
+		// ShutdownTimeout is how long serve drains on SIGTERM: tool calls
+		// already running get that long to finish before it exits.
+		ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+		KeepAlives      bool          `yaml:"keep_alives"`
+		// HTTP/2 is negotiated via ALPN, so it only applies when TLS is on.
+		HTTP2       bool   `yaml:"http2"`
+		TLSCertFile string `yaml:"tls_cert_file"`
+		TLSKeyFile  string `yaml:"tls_key_file"`
+		// ClientCAFile turns on mTLS: clients may present a certificate
+		// signed by one of these CAs, which certificate-bound tokens need.
+		ClientCAFile string `yaml:"client_ca_file"`
+		// AdminAddr is where the operator control API (/control/*)
+		// listens, apart from Addr. It needs security.api_key; empty turns
+		// it off.
+		AdminAddr   string `yaml:"admin_addr"`
+		Compression struct {
+			Enabled  bool `yaml:"enabled"`
+			MinBytes int  `yaml:"min_bytes"`
+			Level    int  `yaml:"level"`
+		} `yaml:"compression"`
 	} `yaml:"http"`
 	Dev struct {
 		Mode bool `yaml:"mode"`
@@ -25,16 +52,41 @@ type Config struct {
 		Issuer   string `yaml:"issuer"`
 		Audience string `yaml:"audience"`
 		JWKSURL  string `yaml:"jwks_url"`
+		// RequireTokenClaims refuses to start without issuer and audience,
+		// so every JWT must name this deployment in iss and aud.
+		RequireTokenClaims bool `yaml:"require_token_claims"`
+		// RequireCertBinding rejects JWTs without a cnf claim bound to the
+		// caller's client certificate. Needs http.client_ca_file.
+		RequireCertBinding bool `yaml:"require_cert_binding"`
 	} `yaml:"auth"`
 	Billing struct {
 		Provider            string `yaml:"provider"`
 		StripeSecretKey     string `yaml:"stripe_secret_key"`
 		StripeWebhookSecret string `yaml:"stripe_webhook_secret"`
+		// DefaultPlan is the plan checkout sells when none is asked for.
+		DefaultPlan string `yaml:"default_plan"`
+		// StripeMeteredPrice is the metered price, by ID or lookup key,
+		// that mcp_units beyond a plan's monthly units are billed at when
+		// the plan has no overage price of its own. Usage is reported every
+		// UsageReportInterval; unset, it is not reported.
+		StripeMeteredPrice  string        `yaml:"stripe_metered_price"`
+		UsageReportInterval time.Duration `yaml:"usage_report_interval"`
+		// TrialDays is how long the trial plan new orgs start on lasts.
+		// 0 creates orgs without an entitlement, as before trials.
+		TrialDays int `yaml:"trial_days"`
 	} `yaml:"billing"`
 	Metering struct {
-		ToolCostPath     string `yaml:"tool_cost_path"`
-		PastDueGraceDays int    `yaml:"past_due_grace_days"`
+		ToolCostPath      string        `yaml:"tool_cost_path"`
+		PastDueGraceDays  int           `yaml:"past_due_grace_days"`
+		ReconcileInterval time.Duration `yaml:"reconcile_interval"`
 	} `yaml:"metering"`
+	// Entitlements configures self-hosted guardrails. In local mode the
+	// entitlement gate reads limits from here instead of org_entitlements.
+	Entitlements struct {
+		LocalMode    bool  `yaml:"local_mode"`
+		MonthlyUnits int64 `yaml:"monthly_units"`
+		MCPRPM       int   `yaml:"mcp_rpm"`
+	} `yaml:"entitlements"`
 	JMAP struct {
 		URL          string        `yaml:"url"`
 		SessionURL   string        `yaml:"session_url"`
@@ -43,49 +95,347 @@ type Config struct {
 		Password     string        `yaml:"password"`
 		PushSecret   string        `yaml:"push_secret"`
 		PollInterval time.Duration `yaml:"poll_interval"`
+		// PollLeaseTTL is how long a serve replica's claim on polling an
+		// inbox lasts without renewal; another replica takes the inbox over
+		// once it lapses.
+		PollLeaseTTL time.Duration `yaml:"poll_lease_ttl"`
+		// PollAccounts polls JMAP inboxes other than the default one through
+		// the mail account named by the inbox address, which the login must
+		// have been given access to. Off, only the default inbox is polled.
+		PollAccounts bool `yaml:"poll_accounts"`
 	} `yaml:"jmap"`
+	// IMAP backs inboxes whose provider column is "imap". Implicit TLS
+	// (port 993) is used unless tls is false.
+	IMAP struct {
+		Host             string `yaml:"host"`
+		Port             int    `yaml:"port"`
+		Username         string `yaml:"username"`
+		Password         string `yaml:"password"`
+		Mailbox          string `yaml:"mailbox"`
+		TLS              bool   `yaml:"tls"`
+		InitialSyncLimit int    `yaml:"initial_sync_limit"`
+		// DefaultInbox switches the default inbox to the imap provider at
+		// startup.
+		DefaultInbox bool `yaml:"default_inbox"`
+	} `yaml:"imap"`
+	// Gmail backs inboxes connected through the OAuth consent flow. The
+	// redirect URL must point at /v1/oauth/gmail/callback on the cloud API.
+	Gmail struct {
+		ClientID         string `yaml:"client_id"`
+		ClientSecret     string `yaml:"client_secret"`
+		RedirectURL      string `yaml:"redirect_url"`
+		AuthURL          string `yaml:"auth_url"`
+		TokenURL         string `yaml:"token_url"`
+		APIBaseURL       string `yaml:"api_base_url"`
+		InitialSyncLimit int    `yaml:"initial_sync_limit"`
+	} `yaml:"gmail"`
+	// CRM is where orgs' CRM connections send requests. Each org connects
+	// its own account through /v1/integrations/crm; Timeout bounds every
+	// call so a slow CRM cannot hold up triage.
+	CRM struct {
+		HubSpotAPIBaseURL string        `yaml:"hubspot_api_base_url"`
+		Timeout           time.Duration `yaml:"timeout"`
+	} `yaml:"crm"`
+	// Inbound configures `neuralmaild inbound-webhook`, which receives mail
+	// that SES (through SNS), Mailgun routes and Postmark push to us. Each
+	// provider's endpoint is only served once its credentials are set.
+	Inbound struct {
+		Addr            string `yaml:"addr"`
+		MaxMessageBytes int64  `yaml:"max_message_bytes"`
+		// SESTopicARNs are the SNS topics SES receipt rules publish to;
+		// notifications from any other topic are refused.
+		SESTopicARNs      []string `yaml:"ses_topic_arns"`
+		MailgunSigningKey string   `yaml:"mailgun_signing_key"`
+		// Postmark does not sign inbound webhooks, so the webhook URL
+		// carries these as basic auth credentials instead.
+		PostmarkUsername string `yaml:"postmark_username"`
+		PostmarkPassword string `yaml:"postmark_password"`
+	} `yaml:"inbound"`
+	// Ingest limits the message bodies stored in Postgres. Longer ones are
+	// truncated and the message flagged oversized, with the full copy kept
+	// in the object store; 0 disables a limit.
+	Ingest struct {
+		MaxTextBytes int `yaml:"max_text_bytes"`
+		MaxHTMLBytes int `yaml:"max_html_bytes"`
+		// BatchSize is how many polled messages are stored per statement.
+		BatchSize int `yaml:"batch_size"`
+	} `yaml:"ingest"`
+	// Playground serves /mcp-playground: anonymous, rate-limited MCP access
+	// to a sandbox org seeded with demo conversations at Inbox.
+	Playground struct {
+		Enabled bool   `yaml:"enabled"`
+		Inbox   string `yaml:"inbox"`
+		// RPM is the request budget per client IP.
+		RPM int `yaml:"rpm"`
+		// DailyTokens caps the model tokens all playground callers spend
+		// together in a UTC day; zero leaves it unlimited.
+		DailyTokens  int64    `yaml:"daily_tokens"`
+		AllowOrigins []string `yaml:"allow_origins"`
+	} `yaml:"playground"`
+	// SMTP is the relay the worker delivers the outbox through. Failed
+	// deliveries are retried with exponential backoff from RetryBackoff up
+	// to MaxRetryBackoff, MaxAttempts times in all.
 	SMTP struct {
-		Host     string `yaml:"host"`
-		Port     int    `yaml:"port"`
-		Username string `yaml:"username"`
-		Password string `yaml:"password"`
-		From     string `yaml:"from"`
+		Host            string        `yaml:"host"`
+		Port            int           `yaml:"port"`
+		Username        string        `yaml:"username"`
+		Password        string        `yaml:"password"`
+		From            string        `yaml:"from"`
+		MaxAttempts     int           `yaml:"max_attempts"`
+		RetryBackoff    time.Duration `yaml:"retry_backoff"`
+		MaxRetryBackoff time.Duration `yaml:"max_retry_backoff"`
 	} `yaml:"smtp"`
+	// Outbound picks the transport outbound mail leaves through: smtp (the
+	// relay above), ses, sendgrid or postmark. Transport is the default; an
+	// org or domain can pick another whose credentials are set here. The
+	// providers' delivery events are received by `neuralmaild
+	// inbound-webhook` under /events/{provider}.
+	Outbound struct {
+		Transport          string `yaml:"transport"`
+		SESRegion          string `yaml:"ses_region"`
+		SESAccessKeyID     string `yaml:"ses_access_key_id"`
+		SESSecretAccessKey string `yaml:"ses_secret_access_key"`
+		// SESConfigurationSet is sent with every message; its event
+		// destination publishes delivery events to SESEventTopicARNs.
+		SESConfigurationSet string   `yaml:"ses_configuration_set"`
+		SESEventTopicARNs   []string `yaml:"ses_event_topic_arns"`
+		SendGridAPIKey      string   `yaml:"sendgrid_api_key"`
+		// SendGridWebhookPublicKey verifies the signed event webhook
+		// (base64 DER, as SendGrid shows it).
+		SendGridWebhookPublicKey string `yaml:"sendgrid_webhook_public_key"`
+		PostmarkServerToken      string `yaml:"postmark_server_token"`
+		PostmarkMessageStream    string `yaml:"postmark_message_stream"`
+		// Postmark does not sign webhooks; its delivery webhook URL carries
+		// these as basic auth credentials.
+		PostmarkWebhookUsername string        `yaml:"postmark_webhook_username"`
+		PostmarkWebhookPassword string        `yaml:"postmark_webhook_password"`
+		Timeout                 time.Duration `yaml:"timeout"`
+		// HourlyMessages and DailyRecipients cap what each org sends in
+		// the trailing hour and day; 0 is unlimited. Orgs can set their
+		// own, and domains tighter ones for mail from them.
+		HourlyMessages  int `yaml:"hourly_messages"`
+		DailyRecipients int `yaml:"daily_recipients"`
+		// Warmup caps a newly active domain's recipients per day, one
+		// entry per day since it went active; after the last, only the
+		// limits above apply. Empty turns warm-up off.
+		Warmup []int `yaml:"warmup"`
+	} `yaml:"outbound"`
+	// Database is the primary Postgres. ReplicaDSN, if set, names a
+	// streaming replica that serves thread listings, thread reads, full-text
+	// search and the audit log while it trails the primary by no more than
+	// ReplicaMaxLag.
 	Database struct {
-		DSN string `yaml:"dsn"`
+		DSN           string        `yaml:"dsn"`
+		ReplicaDSN    string        `yaml:"replica_dsn"`
+		ReplicaMaxLag time.Duration `yaml:"replica_max_lag"`
 	} `yaml:"database"`
 	Qdrant struct {
 		URL        string `yaml:"url"`
 		Collection string `yaml:"collection"`
 		EmbedDim   int    `yaml:"embed_dim"`
 	} `yaml:"qdrant"`
+	// Residency keeps org data in a named region. Orgs tagged with a region
+	// listed here have their threads, messages and vectors stored on that
+	// region's endpoints; untagged orgs (and ones tagged home_region) use
+	// database and qdrant above.
+	Residency struct {
+		HomeRegion string                   `yaml:"home_region"`
+		Regions    map[string]RegionStorage `yaml:"regions"`
+	} `yaml:"residency"`
+	// Redis is a single server at url unless mode says otherwise: sentinel
+	// asks the sentinels in addrs for the primary named master_name, and
+	// cluster uses addrs as seed nodes. Queue pushes and pops keep retrying
+	// through a primary failover for up to failover_timeout.
 	Redis struct {
-		URL string `yaml:"url"`
+		URL              string        `yaml:"url"`
+		Mode             string        `yaml:"mode"`
+		Addrs            []string      `yaml:"addrs"`
+		MasterName       string        `yaml:"master_name"`
+		Username         string        `yaml:"username"`
+		Password         string        `yaml:"password"`
+		SentinelPassword string        `yaml:"sentinel_password"`
+		MaxRetries       int           `yaml:"max_retries"`
+		MinRetryBackoff  time.Duration `yaml:"min_retry_backoff"`
+		MaxRetryBackoff  time.Duration `yaml:"max_retry_backoff"`
+		FailoverTimeout  time.Duration `yaml:"failover_timeout"`
 	} `yaml:"redis"`
+	// Jobs sets how workers retry queued jobs. A failed job is retried after
+	// retry_backoff, doubling per attempt up to max_retry_backoff, and is
+	// dead-lettered after max_attempts. A job its worker holds for
+	// claim_after without finishing counts as a failed attempt.
+	Jobs struct {
+		MaxAttempts     int           `yaml:"max_attempts"`
+		RetryBackoff    time.Duration `yaml:"retry_backoff"`
+		MaxRetryBackoff time.Duration `yaml:"max_retry_backoff"`
+		ClaimAfter      time.Duration `yaml:"claim_after"`
+	} `yaml:"jobs"`
+	// Worker sets how many jobs of each type (embedding, vector_cleanup,
+	// webhook_delivery, scheduled_send, summarization, retention_sweep,
+	// bounce_processing, domain_verification) one worker process runs at
+	// once; a type left out
+	// runs one at a time and 0 leaves the type to other workers. Queued
+	// mail is sent every SendInterval and audit retention swept every
+	// RetentionInterval. With RefreshSummaries, new mail on a thread that
+	// has a summary queues the summary's refresh.
+	Worker struct {
+		Concurrency       map[string]int `yaml:"concurrency"`
+		SendInterval      time.Duration  `yaml:"send_interval"`
+		RetentionInterval time.Duration  `yaml:"retention_interval"`
+		RefreshSummaries  bool           `yaml:"refresh_summaries"`
+	} `yaml:"worker"`
 	ObjectStore struct {
 		URL       string `yaml:"url"`
 		Bucket    string `yaml:"bucket"`
 		AccessKey string `yaml:"access_key"`
 		SecretKey string `yaml:"secret_key"`
+		Region    string `yaml:"region"`
 	} `yaml:"object_store"`
+	// Embedding.ChunkSize and ChunkOverlap, in bytes, cut long messages into
+	// pieces embedded on their own, so the end of a long email is as
+	// searchable as its start.
 	Embedding struct {
-		Provider string `yaml:"provider"`
-		Model    string `yaml:"model"`
-		Dim      int    `yaml:"dim"`
+		Provider     string `yaml:"provider"`
+		Model        string `yaml:"model"`
+		Dim          int    `yaml:"dim"`
+		ChunkSize    int    `yaml:"chunk_size"`
+		ChunkOverlap int    `yaml:"chunk_overlap"`
 	} `yaml:"embedding"`
+	// Rerank re-scores the top Candidates vector hits of search_inbox with a
+	// cross-encoder service or the LLM before returning top_k. Provider
+	// cross_encoder posts to URL (a TEI-style /rerank endpoint); llm uses the
+	// configured LLM provider. Orgs opt in through the control plane;
+	// DefaultEnabled applies to self-hosted calls without an org. Re-ranking
+	// that exceeds LatencyBudget is abandoned and vector order is kept.
+	Rerank struct {
+		Provider       string        `yaml:"provider"`
+		URL            string        `yaml:"url"`
+		Candidates     int           `yaml:"candidates"`
+		LatencyBudget  time.Duration `yaml:"latency_budget"`
+		UnitCost       int64         `yaml:"unit_cost"`
+		DefaultEnabled bool          `yaml:"default_enabled"`
+	} `yaml:"rerank"`
+	// AutoClose is how the worker applies inboxes' inactivity rules: it
+	// checks for idle threads every Interval and nudges with NudgeText.
+	AutoClose struct {
+		Interval  time.Duration `yaml:"interval"`
+		NudgeText string        `yaml:"nudge_text"`
+	} `yaml:"auto_close"`
+	// OrgDeletion is how org deletion requests are carried out: an org is
+	// purged GracePeriod after the request, by the worker, which looks for
+	// due deletions every Interval.
+	OrgDeletion struct {
+		GracePeriod time.Duration `yaml:"grace_period"`
+		Interval    time.Duration `yaml:"interval"`
+	} `yaml:"org_deletion"`
+	// Domains is what domain verification expects of custom domains' DNS:
+	// MX records pointing at MXHost, an SPF record that includes
+	// SPFInclude and, for the cname DKIM method, a selector CNAME into
+	// DKIMCNAMEZone (left empty, any such record passes). The worker
+	// re-checks pending, active and failed domains every VerifyInterval; an
+	// active domain whose ownership record has been missing for FailAfter
+	// fails. DKIMEncryptionKey (32 bytes, base64 or hex) encrypts the DKIM
+	// private keys the control plane generates, and the worker decrypts
+	// them to sign; a rotated key keeps verifying for
+	// DKIMRotationOverlap after its replacement takes over.
+	Domains struct {
+		MXHost              string        `yaml:"mx_host"`
+		SPFInclude          string        `yaml:"spf_include"`
+		DKIMCNAMEZone       string        `yaml:"dkim_cname_zone"`
+		VerifyInterval      time.Duration `yaml:"verify_interval"`
+		FailAfter           time.Duration `yaml:"fail_after"`
+		DKIMEncryptionKey   string        `yaml:"dkim_encryption_key"`
+		DKIMRotationOverlap time.Duration `yaml:"dkim_rotation_overlap"`
+	} `yaml:"domains"`
+	// LLM selects the model provider. Drafting packs a thread into the
+	// model's context: the last RecentMessages messages verbatim, older ones
+	// summarized. ContextTokens overrides the window known for Model.
+	// Routes sends tasks (classify, extract, draft, translate, summarize) to
+	// other "provider:model" refs, in fallback order, before Model; Prices
+	// is USD per million tokens by ref, for cost metrics.
 	LLM struct {
-		Provider   string `yaml:"provider"`
-		Model      string `yaml:"model"`
-		OpenAIKey  string `yaml:"openai_key"`
-		OllamaURL  string `yaml:"ollama_url"`
-		PromptPath string `yaml:"prompt_path"`
+		Provider       string              `yaml:"provider"`
+		Model          string              `yaml:"model"`
+		OpenAIKey      string              `yaml:"openai_key"`
+		OllamaURL      string              `yaml:"ollama_url"`
+		PromptPath     string              `yaml:"prompt_path"`
+		ContextTokens  int                 `yaml:"context_tokens"`
+		RecentMessages int                 `yaml:"recent_messages"`
+		Routes         map[string][]string `yaml:"routes"`
+		Prices         map[string]float64  `yaml:"prices"`
+		// Fallbacks are refs tried after Model for every task. Breaker
+		// skips a model for Cooldown after Failures outages in a row.
+		Fallbacks []string `yaml:"fallbacks"`
+		Breaker   struct {
+			Failures int           `yaml:"failures"`
+			Cooldown time.Duration `yaml:"cooldown"`
+		} `yaml:"breaker"`
+		// Anthropic and Azure configure those providers. Stream has the
+		// provider stream replies instead of waiting for the whole one.
+		Anthropic struct {
+			APIKey    string `yaml:"api_key"`
+			BaseURL   string `yaml:"base_url"`
+			Version   string `yaml:"version"`
+			MaxTokens int    `yaml:"max_tokens"`
+			Stream    bool   `yaml:"stream"`
+		} `yaml:"anthropic"`
+		// Azure models are named by deployment; Deployment is used when
+		// llm.model is empty.
+		Azure struct {
+			Endpoint   string `yaml:"endpoint"`
+			APIKey     string `yaml:"api_key"`
+			Deployment string `yaml:"deployment"`
+			APIVersion string `yaml:"api_version"`
+			Stream     bool   `yaml:"stream"`
+		} `yaml:"azure"`
+		// Cache keeps triage and extraction results in Redis for TTL; 0
+		// turns it off.
+		Cache struct {
+			TTL time.Duration `yaml:"ttl"`
+		} `yaml:"cache"`
+		// Budget refuses model calls whose prompt is over PerCallTokens,
+		// or that an org makes once it has spent DailyTokens in a UTC day.
+		// 0 leaves a limit off.
+		Budget struct {
+			PerCallTokens int64 `yaml:"per_call_tokens"`
+			DailyTokens   int64 `yaml:"daily_tokens"`
+		} `yaml:"budget"`
+		// RedactPII lists the pii classes masked in text sent to hosted
+		// models; local ones (ollama) get the text as is.
+		RedactPII []string `yaml:"redact_pii"`
 	} `yaml:"llm"`
 	Policy struct {
 		DefaultPath string `yaml:"default_path"`
 	} `yaml:"policy"`
+	// Canary routes a share of orgs to an alternate tool-service build (for
+	// example a new drafting model or prompt) so it can be compared against
+	// the stable one before full rollout. Per-org feature flags override the
+	// percentage.
+	Canary struct {
+		Enabled    bool     `yaml:"enabled"`
+		Percent    int      `yaml:"percent"`
+		Tools      []string `yaml:"tools"`
+		LLMModel   string   `yaml:"llm_model"`
+		PromptPath string   `yaml:"prompt_path"`
+		PolicyPath string   `yaml:"policy_path"`
+	} `yaml:"canary"`
 	MCP struct {
-		ProtocolVersion string   `yaml:"protocol_version"`
-		AllowOrigins    []string `yaml:"allow_origins"`
+		// ProtocolVersion is the preferred version, offered to clients that
+		// do not request one. SupportedVersions lists every version a client
+		// may negotiate.
+		ProtocolVersion   string   `yaml:"protocol_version"`
+		SupportedVersions []string `yaml:"supported_versions"`
+		AllowOrigins      []string `yaml:"allow_origins"`
+		// SessionTTL is how long a session may sit idle; every request
+		// extends it.
+		SessionTTL time.Duration `yaml:"session_ttl"`
+		// SessionRecordInterval is how often a busy session's audit row
+		// has its last activity and expiry brought up to date.
+		SessionRecordInterval time.Duration `yaml:"session_record_interval"`
+		// StoreToolPayloads keeps each tool call's arguments and result on
+		// its audit entry so it can be replayed. Values of RedactFields keys,
+		// at any depth, are stored as "[redacted]".
+		StoreToolPayloads bool     `yaml:"store_tool_payloads"`
+		RedactFields      []string `yaml:"redact_fields"`
 	} `yaml:"mcp"`
 	Security struct {
 		APIKey                  string   `yaml:"api_key"`
@@ -93,32 +443,137 @@ type Config struct {
 		AllowOutbound           bool     `yaml:"allow_outbound"`
 		AllowSendWithWarnings   bool     `yaml:"allow_send_with_warnings"`
 		OutboundDomainAllowlist []string `yaml:"outbound_domain_allowlist"`
+		// KeyRotationGrace is how long a rotated cloud API key keeps
+		// working beside its replacement.
+		KeyRotationGrace time.Duration `yaml:"key_rotation_grace"`
+		// TokenEncryptionKey (32 bytes, base64 or hex) encrypts the
+		// third-party credentials orgs connect, such as Gmail grants and
+		// CRM access tokens, before they are stored.
+		TokenEncryptionKey string `yaml:"token_encryption_key"`
 	} `yaml:"security"`
 	Log struct {
+		// Level is debug, info, warn or error.
 		Level string `yaml:"level"`
+		// Format is text (key=value lines) or json.
+		Format string `yaml:"format"`
 	} `yaml:"log"`
+	// Reload has serve and mcp-stdio re-read the config file and the
+	// policy files when they change, checking every WatchInterval, as
+	// they do on SIGHUP. 0 leaves reloads to SIGHUP.
+	Reload struct {
+		WatchInterval time.Duration `yaml:"watch_interval"`
+	} `yaml:"reload"`
+	// Secrets: any string setting may be a reference to a secret in Vault,
+	// AWS Secrets Manager or GCP Secret Manager (see package secrets),
+	// resolved by Load. serve and mcp-stdio fetch the secrets again every
+	// RefreshInterval; 0 turns that off.
+	Secrets struct {
+		RefreshInterval time.Duration `yaml:"refresh_interval"`
+	} `yaml:"secrets"`
+
+	secretRefs map[string]string
+}
+
+type RegionStorage struct {
+	DatabaseDSN      string `yaml:"database_dsn"`
+	QdrantURL        string `yaml:"qdrant_url"`
+	QdrantCollection string `yaml:"qdrant_collection"`
 }
 
 func Default() Config {
 	var cfg Config
 	cfg.HTTP.Addr = ":8088"
+	cfg.HTTP.AdminAddr = "127.0.0.1:8089"
+	cfg.HTTP.ReadHeaderTimeout = 5 * time.Second
+	cfg.HTTP.ReadTimeout = 30 * time.Second
+	cfg.HTTP.WriteTimeout = 60 * time.Second
+	cfg.HTTP.IdleTimeout = 120 * time.Second
+	cfg.HTTP.ShutdownTimeout = 30 * time.Second
+	cfg.HTTP.KeepAlives = true
+	cfg.HTTP.HTTP2 = true
+	cfg.HTTP.Compression.Enabled = true
+	cfg.HTTP.Compression.MinBytes = 1024
+	cfg.HTTP.Compression.Level = -1
 	cfg.Dev.Mode = true
 	cfg.Billing.Provider = "stripe"
+	cfg.Billing.DefaultPlan = "pro"
+	cfg.Billing.TrialDays = 14
 	cfg.JMAP.PollInterval = 30 * time.Second
+	cfg.JMAP.PollLeaseTTL = 2 * time.Minute
+	cfg.IMAP.Port = 993
+	cfg.IMAP.Mailbox = "INBOX"
+	cfg.IMAP.TLS = true
+	cfg.IMAP.InitialSyncLimit = 50
+	cfg.Gmail.AuthURL = "https://accounts.google.com/o/oauth2/v2/auth"
+	cfg.Gmail.TokenURL = "https://oauth2.googleapis.com/token"
+	cfg.Gmail.APIBaseURL = "https://gmail.googleapis.com"
+	cfg.Gmail.InitialSyncLimit = 50
+	cfg.CRM.HubSpotAPIBaseURL = "https://api.hubapi.com"
+	cfg.CRM.Timeout = 10 * time.Second
+	cfg.Inbound.Addr = ":8090"
+	cfg.Inbound.MaxMessageBytes = 40 << 20
+	cfg.Ingest.MaxTextBytes = 512 << 10
+	cfg.Ingest.MaxHTMLBytes = 1 << 20
+	cfg.Ingest.BatchSize = 200
+	cfg.Playground.Inbox = "playground@demo.nerve.email"
+	cfg.Playground.RPM = 10
+	cfg.Playground.DailyTokens = 200000
 	cfg.SMTP.Host = "localhost"
 	cfg.SMTP.Port = 2525
 	cfg.SMTP.From = "dev@local.neuralmail"
+	cfg.SMTP.MaxAttempts = 8
+	cfg.SMTP.RetryBackoff = 30 * time.Second
+	cfg.SMTP.MaxRetryBackoff = time.Hour
+	cfg.Outbound.Transport = "smtp"
+	cfg.Outbound.PostmarkMessageStream = "outbound"
+	cfg.Outbound.Timeout = 30 * time.Second
+	cfg.Outbound.Warmup = []int{50, 100, 250, 500, 1000, 2000, 4000, 8000, 15000, 30000}
+	cfg.Database.ReplicaMaxLag = 2 * time.Second
+	cfg.Redis.MaxRetries = 3
+	cfg.Redis.MinRetryBackoff = 100 * time.Millisecond
+	cfg.Redis.MaxRetryBackoff = 2 * time.Second
+	cfg.Redis.FailoverTimeout = 30 * time.Second
+	cfg.Jobs.MaxAttempts = 5
+	cfg.Jobs.RetryBackoff = 10 * time.Second
+	cfg.Jobs.MaxRetryBackoff = 10 * time.Minute
+	cfg.Jobs.ClaimAfter = 5 * time.Minute
+	cfg.Worker.SendInterval = 5 * time.Second
+	cfg.Worker.RetentionInterval = time.Hour
 	cfg.Qdrant.Collection = "messages_v1536"
 	cfg.Qdrant.EmbedDim = 1536
 	cfg.Embedding.Provider = "noop"
 	cfg.Embedding.Dim = 1536
+	cfg.Embedding.ChunkSize = 2000
+	cfg.Embedding.ChunkOverlap = 200
+	cfg.Rerank.Candidates = 50
+	cfg.Rerank.LatencyBudget = 300 * time.Millisecond
+	cfg.Rerank.UnitCost = 1
+	cfg.AutoClose.Interval = 10 * time.Minute
+	cfg.AutoClose.NudgeText = "Is there anything else we can help you with? If we don't hear back, we'll close this conversation."
+	cfg.OrgDeletion.GracePeriod = 30 * 24 * time.Hour
+	cfg.OrgDeletion.Interval = time.Hour
+	cfg.Domains.VerifyInterval = 15 * time.Minute
+	cfg.Domains.FailAfter = 72 * time.Hour
+	cfg.Domains.DKIMRotationOverlap = 7 * 24 * time.Hour
 	cfg.LLM.Provider = "noop"
 	cfg.LLM.PromptPath = "configs/prompts/v1"
+	cfg.LLM.RecentMessages = 6
+	cfg.LLM.Breaker.Failures = 5
+	cfg.LLM.Breaker.Cooldown = 30 * time.Second
+	cfg.LLM.Cache.TTL = 24 * time.Hour
 	cfg.Policy.DefaultPath = "configs/policy/support-default-v1.yaml"
+	cfg.Secrets.RefreshInterval = 5 * time.Minute
 	cfg.Metering.ToolCostPath = "configs/meters/tool_costs.yaml"
 	cfg.Metering.PastDueGraceDays = 7
+	cfg.Canary.Tools = []string{"draft_reply_with_policy"}
 	cfg.MCP.ProtocolVersion = "2025-11-25"
+	cfg.MCP.SupportedVersions = []string{"2025-11-25", "2025-06-18", "2025-03-26", "2024-11-05"}
+	cfg.MCP.SessionTTL = 24 * time.Hour
+	cfg.MCP.SessionRecordInterval = time.Minute
+	cfg.MCP.StoreToolPayloads = true
+	cfg.Security.KeyRotationGrace = 24 * time.Hour
 	cfg.Log.Level = "info"
+	cfg.Log.Format = "text"
 	return cfg
 }
 
@@ -139,9 +594,21 @@ func Load(path string) (Config, error) {
 
 	applyEnv(&cfg)
 
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := resolveSecrets(ctx, &cfg, secrets.Default()); err != nil {
+		return cfg, err
+	}
+
 	if cfg.JMAP.URL == "" {
 		return cfg, errors.New("missing jmap.url (or NM_JMAP_URL)")
 	}
+	if cfg.Auth.RequireTokenClaims && (cfg.Auth.Issuer == "" || cfg.Auth.Audience == "") {
+		return cfg, errors.New("auth.require_token_claims needs auth.issuer and auth.audience")
+	}
+	if cfg.Auth.RequireCertBinding && cfg.HTTP.ClientCAFile == "" {
+		return cfg, errors.New("auth.require_cert_binding needs http.client_ca_file")
+	}
 
 	return cfg, nil
 }
@@ -150,6 +617,58 @@ func applyEnv(cfg *Config) {
 	if v := os.Getenv("NM_HTTP_ADDR"); v != "" {
 		cfg.HTTP.Addr = v
 	}
+	// Set but empty turns the control API off, as an empty admin_addr does.
+	if v, ok := os.LookupEnv("NM_HTTP_ADMIN_ADDR"); ok {
+		cfg.HTTP.AdminAddr = strings.TrimSpace(v)
+	}
+	if v := os.Getenv("NM_HTTP_READ_HEADER_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.HTTP.ReadHeaderTimeout = d
+		}
+	}
+	if v := os.Getenv("NM_HTTP_READ_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.HTTP.ReadTimeout = d
+		}
+	}
+	if v := os.Getenv("NM_HTTP_WRITE_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.HTTP.WriteTimeout = d
+		}
+	}
+	if v := os.Getenv("NM_HTTP_IDLE_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.HTTP.IdleTimeout = d
+		}
+	}
+	if v := os.Getenv("NM_HTTP_SHUTDOWN_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.HTTP.ShutdownTimeout = d
+		}
+	}
+	if v := os.Getenv("NM_HTTP_KEEP_ALIVES"); v != "" {
+		cfg.HTTP.KeepAlives = parseBool(v, cfg.HTTP.KeepAlives)
+	}
+	if v := os.Getenv("NM_HTTP_HTTP2"); v != "" {
+		cfg.HTTP.HTTP2 = parseBool(v, cfg.HTTP.HTTP2)
+	}
+	if v := os.Getenv("NM_HTTP_TLS_CERT_FILE"); v != "" {
+		cfg.HTTP.TLSCertFile = v
+	}
+	if v := os.Getenv("NM_HTTP_TLS_KEY_FILE"); v != "" {
+		cfg.HTTP.TLSKeyFile = v
+	}
+	if v := os.Getenv("NM_HTTP_CLIENT_CA_FILE"); v != "" {
+		cfg.HTTP.ClientCAFile = v
+	}
+	if v := os.Getenv("NM_HTTP_COMPRESSION"); v != "" {
+		cfg.HTTP.Compression.Enabled = parseBool(v, cfg.HTTP.Compression.Enabled)
+	}
+	if v := os.Getenv("NM_HTTP_COMPRESSION_MIN_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.HTTP.Compression.MinBytes = n
+		}
+	}
 	if v := os.Getenv("NM_DEV_MODE"); v != "" {
 		cfg.Dev.Mode = parseBool(v, cfg.Dev.Mode)
 	}
@@ -168,6 +687,12 @@ func applyEnv(cfg *Config) {
 	if v := os.Getenv("NM_AUTH_JWKS_URL"); v != "" {
 		cfg.Auth.JWKSURL = v
 	}
+	if v := os.Getenv("NM_AUTH_REQUIRE_TOKEN_CLAIMS"); v != "" {
+		cfg.Auth.RequireTokenClaims = parseBool(v, cfg.Auth.RequireTokenClaims)
+	}
+	if v := os.Getenv("NM_AUTH_REQUIRE_CERT_BINDING"); v != "" {
+		cfg.Auth.RequireCertBinding = parseBool(v, cfg.Auth.RequireCertBinding)
+	}
 	if v := os.Getenv("NM_BILLING_PROVIDER"); v != "" {
 		cfg.Billing.Provider = v
 	}
@@ -177,6 +702,22 @@ func applyEnv(cfg *Config) {
 	if v := os.Getenv("NM_STRIPE_WEBHOOK_SECRET"); v != "" {
 		cfg.Billing.StripeWebhookSecret = v
 	}
+	if v := os.Getenv("NM_BILLING_DEFAULT_PLAN"); v != "" {
+		cfg.Billing.DefaultPlan = v
+	}
+	if v := os.Getenv("NM_BILLING_TRIAL_DAYS"); v != "" {
+		if days, err := strconv.Atoi(v); err == nil {
+			cfg.Billing.TrialDays = days
+		}
+	}
+	if v := os.Getenv("NM_STRIPE_METERED_PRICE"); v != "" {
+		cfg.Billing.StripeMeteredPrice = v
+	}
+	if v := os.Getenv("NM_BILLING_USAGE_REPORT_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Billing.UsageReportInterval = d
+		}
+	}
 	if v := os.Getenv("NM_METER_TOOL_COST_PATH"); v != "" {
 		cfg.Metering.ToolCostPath = v
 	}
@@ -185,6 +726,110 @@ func applyEnv(cfg *Config) {
 			cfg.Metering.PastDueGraceDays = days
 		}
 	}
+	if v := os.Getenv("NM_METER_RECONCILE_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Metering.ReconcileInterval = d
+		}
+	}
+	if v := os.Getenv("NM_ENTITLEMENTS_LOCAL_MODE"); v != "" {
+		cfg.Entitlements.LocalMode = parseBool(v, cfg.Entitlements.LocalMode)
+	}
+	if v := os.Getenv("NM_ENTITLEMENTS_MONTHLY_UNITS"); v != "" {
+		if units, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.Entitlements.MonthlyUnits = units
+		}
+	}
+	if v := os.Getenv("NM_ENTITLEMENTS_MCP_RPM"); v != "" {
+		if rpm, err := strconv.Atoi(v); err == nil {
+			cfg.Entitlements.MCPRPM = rpm
+		}
+	}
+	if v := os.Getenv("NM_IMAP_HOST"); v != "" {
+		cfg.IMAP.Host = v
+	}
+	if v := os.Getenv("NM_IMAP_PORT"); v != "" {
+		if port, err := strconv.Atoi(v); err == nil {
+			cfg.IMAP.Port = port
+		}
+	}
+	if v := os.Getenv("NM_IMAP_USERNAME"); v != "" {
+		cfg.IMAP.Username = v
+	}
+	if v := os.Getenv("NM_IMAP_PASSWORD"); v != "" {
+		cfg.IMAP.Password = v
+	}
+	if v := os.Getenv("NM_IMAP_MAILBOX"); v != "" {
+		cfg.IMAP.Mailbox = v
+	}
+	if v := os.Getenv("NM_IMAP_TLS"); v != "" {
+		cfg.IMAP.TLS = parseBool(v, cfg.IMAP.TLS)
+	}
+	if v := os.Getenv("NM_IMAP_DEFAULT_INBOX"); v != "" {
+		cfg.IMAP.DefaultInbox = parseBool(v, cfg.IMAP.DefaultInbox)
+	}
+	if v := os.Getenv("NM_GMAIL_CLIENT_ID"); v != "" {
+		cfg.Gmail.ClientID = v
+	}
+	if v := os.Getenv("NM_GMAIL_CLIENT_SECRET"); v != "" {
+		cfg.Gmail.ClientSecret = v
+	}
+	if v := os.Getenv("NM_GMAIL_REDIRECT_URL"); v != "" {
+		cfg.Gmail.RedirectURL = v
+	}
+	if v := os.Getenv("NM_CRM_HUBSPOT_API_BASE_URL"); v != "" {
+		cfg.CRM.HubSpotAPIBaseURL = v
+	}
+	if v := os.Getenv("NM_CRM_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.CRM.Timeout = d
+		}
+	}
+	if v := os.Getenv("NM_INBOUND_ADDR"); v != "" {
+		cfg.Inbound.Addr = v
+	}
+	if v := os.Getenv("NM_INBOUND_SES_TOPIC_ARNS"); v != "" {
+		cfg.Inbound.SESTopicARNs = splitCSV(v)
+	}
+	if v := os.Getenv("NM_INBOUND_MAILGUN_SIGNING_KEY"); v != "" {
+		cfg.Inbound.MailgunSigningKey = v
+	}
+	if v := os.Getenv("NM_INBOUND_POSTMARK_USERNAME"); v != "" {
+		cfg.Inbound.PostmarkUsername = v
+	}
+	if v := os.Getenv("NM_INBOUND_POSTMARK_PASSWORD"); v != "" {
+		cfg.Inbound.PostmarkPassword = v
+	}
+	if v := os.Getenv("NM_INGEST_MAX_TEXT_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Ingest.MaxTextBytes = n
+		}
+	}
+	if v := os.Getenv("NM_INGEST_MAX_HTML_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Ingest.MaxHTMLBytes = n
+		}
+	}
+	if v := os.Getenv("NM_INGEST_BATCH_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Ingest.BatchSize = n
+		}
+	}
+	if v := os.Getenv("NM_PLAYGROUND_ENABLED"); v != "" {
+		cfg.Playground.Enabled = parseBool(v, cfg.Playground.Enabled)
+	}
+	if v := os.Getenv("NM_PLAYGROUND_RPM"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Playground.RPM = n
+		}
+	}
+	if v := os.Getenv("NM_PLAYGROUND_DAILY_TOKENS"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.Playground.DailyTokens = n
+		}
+	}
+	if v := os.Getenv("NM_PLAYGROUND_ALLOW_ORIGINS"); v != "" {
+		cfg.Playground.AllowOrigins = splitCSV(v)
+	}
 	if v := os.Getenv("NM_JMAP_URL"); v != "" {
 		cfg.JMAP.URL = v
 	}
@@ -208,6 +853,14 @@ func applyEnv(cfg *Config) {
 			cfg.JMAP.PollInterval = d
 		}
 	}
+	if v := os.Getenv("NM_JMAP_POLL_LEASE_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.JMAP.PollLeaseTTL = d
+		}
+	}
+	if v := os.Getenv("NM_JMAP_POLL_ACCOUNTS"); v != "" {
+		cfg.JMAP.PollAccounts = parseBool(v, cfg.JMAP.PollAccounts)
+	}
 	if v := os.Getenv("NM_SMTP_HOST"); v != "" {
 		cfg.SMTP.Host = v
 	}
@@ -225,9 +878,82 @@ func applyEnv(cfg *Config) {
 	if v := os.Getenv("NM_SMTP_FROM"); v != "" {
 		cfg.SMTP.From = v
 	}
+	if v := os.Getenv("NM_SMTP_MAX_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.SMTP.MaxAttempts = n
+		}
+	}
+	if v := os.Getenv("NM_OUTBOUND_TRANSPORT"); v != "" {
+		cfg.Outbound.Transport = v
+	}
+	if v := os.Getenv("NM_OUTBOUND_SES_REGION"); v != "" {
+		cfg.Outbound.SESRegion = v
+	}
+	if v := os.Getenv("NM_OUTBOUND_SES_ACCESS_KEY_ID"); v != "" {
+		cfg.Outbound.SESAccessKeyID = v
+	}
+	if v := os.Getenv("NM_OUTBOUND_SES_SECRET_ACCESS_KEY"); v != "" {
+		cfg.Outbound.SESSecretAccessKey = v
+	}
+	if v := os.Getenv("NM_OUTBOUND_SES_CONFIGURATION_SET"); v != "" {
+		cfg.Outbound.SESConfigurationSet = v
+	}
+	if v := os.Getenv("NM_OUTBOUND_SES_EVENT_TOPIC_ARNS"); v != "" {
+		cfg.Outbound.SESEventTopicARNs = splitCSV(v)
+	}
+	if v := os.Getenv("NM_OUTBOUND_SENDGRID_API_KEY"); v != "" {
+		cfg.Outbound.SendGridAPIKey = v
+	}
+	if v := os.Getenv("NM_OUTBOUND_SENDGRID_WEBHOOK_PUBLIC_KEY"); v != "" {
+		cfg.Outbound.SendGridWebhookPublicKey = v
+	}
+	if v := os.Getenv("NM_OUTBOUND_POSTMARK_SERVER_TOKEN"); v != "" {
+		cfg.Outbound.PostmarkServerToken = v
+	}
+	if v := os.Getenv("NM_OUTBOUND_POSTMARK_MESSAGE_STREAM"); v != "" {
+		cfg.Outbound.PostmarkMessageStream = v
+	}
+	if v := os.Getenv("NM_OUTBOUND_POSTMARK_WEBHOOK_USERNAME"); v != "" {
+		cfg.Outbound.PostmarkWebhookUsername = v
+	}
+	if v := os.Getenv("NM_OUTBOUND_POSTMARK_WEBHOOK_PASSWORD"); v != "" {
+		cfg.Outbound.PostmarkWebhookPassword = v
+	}
+	if v := os.Getenv("NM_OUTBOUND_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Outbound.Timeout = d
+		}
+	}
+	if v := os.Getenv("NM_OUTBOUND_HOURLY_MESSAGES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Outbound.HourlyMessages = n
+		}
+	}
+	if v := os.Getenv("NM_OUTBOUND_DAILY_RECIPIENTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Outbound.DailyRecipients = n
+		}
+	}
+	if v := os.Getenv("NM_OUTBOUND_WARMUP"); v != "" {
+		// "0" turns warm-up off.
+		cfg.Outbound.Warmup = nil
+		for _, part := range splitCSV(v) {
+			if n, err := strconv.Atoi(part); err == nil && n > 0 {
+				cfg.Outbound.Warmup = append(cfg.Outbound.Warmup, n)
+			}
+		}
+	}
 	if v := os.Getenv("NM_DB_DSN"); v != "" {
 		cfg.Database.DSN = v
 	}
+	if v := os.Getenv("NM_DB_REPLICA_DSN"); v != "" {
+		cfg.Database.ReplicaDSN = v
+	}
+	if v := os.Getenv("NM_DB_REPLICA_MAX_LAG"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Database.ReplicaMaxLag = d
+		}
+	}
 	if v := os.Getenv("NM_QDRANT_URL"); v != "" {
 		cfg.Qdrant.URL = v
 	}
@@ -240,9 +966,93 @@ func applyEnv(cfg *Config) {
 			cfg.Embedding.Dim = dim
 		}
 	}
+	if v := os.Getenv("NM_RESIDENCY_HOME_REGION"); v != "" {
+		cfg.Residency.HomeRegion = v
+	}
+	// Per-region secrets, e.g. NM_REGION_EU_WEST_DB_DSN for region eu-west.
+	for name, region := range cfg.Residency.Regions {
+		prefix := "NM_REGION_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		if v := os.Getenv(prefix + "_DB_DSN"); v != "" {
+			region.DatabaseDSN = v
+		}
+		if v := os.Getenv(prefix + "_QDRANT_URL"); v != "" {
+			region.QdrantURL = v
+		}
+		cfg.Residency.Regions[name] = region
+	}
 	if v := os.Getenv("NM_REDIS_URL"); v != "" {
 		cfg.Redis.URL = v
 	}
+	if v := os.Getenv("NM_REDIS_MODE"); v != "" {
+		cfg.Redis.Mode = strings.ToLower(strings.TrimSpace(v))
+	}
+	if v := os.Getenv("NM_REDIS_ADDRS"); v != "" {
+		cfg.Redis.Addrs = splitCSV(v)
+	}
+	if v := os.Getenv("NM_REDIS_MASTER_NAME"); v != "" {
+		cfg.Redis.MasterName = v
+	}
+	if v := os.Getenv("NM_REDIS_USERNAME"); v != "" {
+		cfg.Redis.Username = v
+	}
+	if v := os.Getenv("NM_REDIS_PASSWORD"); v != "" {
+		cfg.Redis.Password = v
+	}
+	if v := os.Getenv("NM_REDIS_SENTINEL_PASSWORD"); v != "" {
+		cfg.Redis.SentinelPassword = v
+	}
+	if v := os.Getenv("NM_REDIS_FAILOVER_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Redis.FailoverTimeout = d
+		}
+	}
+	if v := os.Getenv("NM_JOBS_MAX_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Jobs.MaxAttempts = n
+		}
+	}
+	if v := os.Getenv("NM_JOBS_RETRY_BACKOFF"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Jobs.RetryBackoff = d
+		}
+	}
+	if v := os.Getenv("NM_JOBS_MAX_RETRY_BACKOFF"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Jobs.MaxRetryBackoff = d
+		}
+	}
+	if v := os.Getenv("NM_JOBS_CLAIM_AFTER"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Jobs.ClaimAfter = d
+		}
+	}
+	if v := os.Getenv("NM_WORKER_CONCURRENCY"); v != "" {
+		// e.g. "embedding=4,webhook_delivery=2"
+		for _, pair := range splitCSV(v) {
+			jobType, n, ok := strings.Cut(pair, "=")
+			limit, err := strconv.Atoi(strings.TrimSpace(n))
+			if !ok || err != nil {
+				continue
+			}
+			if cfg.Worker.Concurrency == nil {
+				cfg.Worker.Concurrency = map[string]int{}
+			}
+			cfg.Worker.Concurrency[strings.TrimSpace(jobType)] = limit
+		}
+	}
+	if v := os.Getenv("NM_WORKER_SEND_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Worker.SendInterval = d
+		}
+	}
+	if v := os.Getenv("NM_WORKER_RETENTION_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Worker.RetentionInterval = d
+		}
+	}
+	if v := os.Getenv("NM_WORKER_REFRESH_SUMMARIES"); v != "" {
+		cfg.Worker.RefreshSummaries = parseBool(v, cfg.Worker.RefreshSummaries)
+	}
 	if v := os.Getenv("NM_OBJECT_STORE_URL"); v != "" {
 		cfg.ObjectStore.URL = v
 	}
@@ -255,12 +1065,78 @@ func applyEnv(cfg *Config) {
 	if v := os.Getenv("NM_OBJECT_STORE_SECRET_KEY"); v != "" {
 		cfg.ObjectStore.SecretKey = v
 	}
+	if v := os.Getenv("NM_OBJECT_STORE_REGION"); v != "" {
+		cfg.ObjectStore.Region = v
+	}
 	if v := os.Getenv("NM_EMBED_PROVIDER"); v != "" {
 		cfg.Embedding.Provider = v
 	}
 	if v := os.Getenv("NM_EMBED_MODEL"); v != "" {
 		cfg.Embedding.Model = v
 	}
+	if v := os.Getenv("NM_EMBED_CHUNK_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Embedding.ChunkSize = n
+		}
+	}
+	if v := os.Getenv("NM_EMBED_CHUNK_OVERLAP"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Embedding.ChunkOverlap = n
+		}
+	}
+	if v := os.Getenv("NM_RERANK_PROVIDER"); v != "" {
+		cfg.Rerank.Provider = v
+	}
+	if v := os.Getenv("NM_RERANK_URL"); v != "" {
+		cfg.Rerank.URL = v
+	}
+	if v := os.Getenv("NM_RERANK_LATENCY_BUDGET"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Rerank.LatencyBudget = d
+		}
+	}
+	if v := os.Getenv("NM_AUTO_CLOSE_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.AutoClose.Interval = d
+		}
+	}
+	if v := os.Getenv("NM_ORG_DELETION_GRACE_PERIOD"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.OrgDeletion.GracePeriod = d
+		}
+	}
+	if v := os.Getenv("NM_ORG_DELETION_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.OrgDeletion.Interval = d
+		}
+	}
+	if v := os.Getenv("NM_DOMAINS_MX_HOST"); v != "" {
+		cfg.Domains.MXHost = v
+	}
+	if v := os.Getenv("NM_DOMAINS_SPF_INCLUDE"); v != "" {
+		cfg.Domains.SPFInclude = v
+	}
+	if v := os.Getenv("NM_DOMAINS_DKIM_CNAME_ZONE"); v != "" {
+		cfg.Domains.DKIMCNAMEZone = v
+	}
+	if v := os.Getenv("NM_DOMAINS_VERIFY_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Domains.VerifyInterval = d
+		}
+	}
+	if v := os.Getenv("NM_DOMAINS_FAIL_AFTER"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Domains.FailAfter = d
+		}
+	}
+	if v := os.Getenv("NM_DOMAINS_DKIM_ENCRYPTION_KEY"); v != "" {
+		cfg.Domains.DKIMEncryptionKey = v
+	}
+	if v := os.Getenv("NM_DOMAINS_DKIM_ROTATION_OVERLAP"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Domains.DKIMRotationOverlap = d
+		}
+	}
 	if v := os.Getenv("NM_LLM_PROVIDER"); v != "" {
 		cfg.LLM.Provider = v
 	}
@@ -273,24 +1149,122 @@ func applyEnv(cfg *Config) {
 	if v := os.Getenv("NM_OLLAMA_URL"); v != "" {
 		cfg.LLM.OllamaURL = v
 	}
+	if v := os.Getenv("NM_LLM_FALLBACKS"); v != "" {
+		cfg.LLM.Fallbacks = splitCSV(v)
+	}
+	if v := os.Getenv("NM_LLM_REDACT_PII"); v != "" {
+		cfg.LLM.RedactPII = splitCSV(v)
+	}
+	if v := os.Getenv("NM_LLM_CACHE_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.LLM.Cache.TTL = d
+		}
+	}
+	if v := os.Getenv("NM_LLM_PER_CALL_TOKENS"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.LLM.Budget.PerCallTokens = n
+		}
+	}
+	if v := os.Getenv("NM_LLM_DAILY_TOKENS"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.LLM.Budget.DailyTokens = n
+		}
+	}
+	if v := os.Getenv("NM_ANTHROPIC_API_KEY"); v != "" {
+		cfg.LLM.Anthropic.APIKey = v
+	}
+	if v := os.Getenv("NM_AZURE_OPENAI_ENDPOINT"); v != "" {
+		cfg.LLM.Azure.Endpoint = v
+	}
+	if v := os.Getenv("NM_AZURE_OPENAI_API_KEY"); v != "" {
+		cfg.LLM.Azure.APIKey = v
+	}
+	if v := os.Getenv("NM_AZURE_OPENAI_DEPLOYMENT"); v != "" {
+		cfg.LLM.Azure.Deployment = v
+	}
+	if v := os.Getenv("NM_AZURE_OPENAI_API_VERSION"); v != "" {
+		cfg.LLM.Azure.APIVersion = v
+	}
 	if v := os.Getenv("NM_LLM_PROMPT_PATH"); v != "" {
 		cfg.LLM.PromptPath = v
 	}
+	if v := os.Getenv("NM_LLM_CONTEXT_TOKENS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.LLM.ContextTokens = n
+		}
+	}
+	if v := os.Getenv("NM_LLM_RECENT_MESSAGES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.LLM.RecentMessages = n
+		}
+	}
 	if v := os.Getenv("NM_POLICY_PATH"); v != "" {
 		cfg.Policy.DefaultPath = v
 	}
+	if v := os.Getenv("NM_RELOAD_WATCH_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Reload.WatchInterval = d
+		}
+	}
+	if v := os.Getenv("NM_SECRETS_REFRESH_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Secrets.RefreshInterval = d
+		}
+	}
+	if v := os.Getenv("NM_CANARY_ENABLED"); v != "" {
+		cfg.Canary.Enabled = parseBool(v, cfg.Canary.Enabled)
+	}
+	if v := os.Getenv("NM_CANARY_PERCENT"); v != "" {
+		if pct, err := strconv.Atoi(v); err == nil {
+			cfg.Canary.Percent = pct
+		}
+	}
+	if v := os.Getenv("NM_CANARY_TOOLS"); v != "" {
+		cfg.Canary.Tools = splitCSV(v)
+	}
+	if v := os.Getenv("NM_CANARY_LLM_MODEL"); v != "" {
+		cfg.Canary.LLMModel = v
+	}
+	if v := os.Getenv("NM_CANARY_PROMPT_PATH"); v != "" {
+		cfg.Canary.PromptPath = v
+	}
+	if v := os.Getenv("NM_CANARY_POLICY_PATH"); v != "" {
+		cfg.Canary.PolicyPath = v
+	}
 	if v := os.Getenv("NM_MCP_PROTOCOL_VERSION"); v != "" {
 		cfg.MCP.ProtocolVersion = v
 	}
+	if v := os.Getenv("NM_MCP_SUPPORTED_VERSIONS"); v != "" {
+		cfg.MCP.SupportedVersions = splitCSV(v)
+	}
 	if v := os.Getenv("NM_MCP_ALLOW_ORIGINS"); v != "" {
 		cfg.MCP.AllowOrigins = splitCSV(v)
 	}
+	if v := os.Getenv("NM_MCP_SESSION_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.MCP.SessionTTL = d
+		}
+	}
+	if v := os.Getenv("NM_MCP_SESSION_RECORD_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.MCP.SessionRecordInterval = d
+		}
+	}
+	if v := os.Getenv("NM_MCP_STORE_TOOL_PAYLOADS"); v != "" {
+		cfg.MCP.StoreToolPayloads = parseBool(v, cfg.MCP.StoreToolPayloads)
+	}
+	if v := os.Getenv("NM_MCP_REDACT_FIELDS"); v != "" {
+		cfg.MCP.RedactFields = splitCSV(v)
+	}
 	if v := os.Getenv("NM_API_KEY"); v != "" {
 		cfg.Security.APIKey = v
 	}
 	if v := os.Getenv("NERVE_TOKEN_SIGNING_KEY"); v != "" {
 		cfg.Security.TokenSigningKey = v
 	}
+	if v := os.Getenv("NM_TOKEN_ENCRYPTION_KEY"); v != "" {
+		cfg.Security.TokenEncryptionKey = v
+	}
 	if v := os.Getenv("NM_ALLOW_OUTBOUND"); v != "" {
 		cfg.Security.AllowOutbound = parseBool(v, cfg.Security.AllowOutbound)
 	}
@@ -300,9 +1274,17 @@ func applyEnv(cfg *Config) {
 	if v := os.Getenv("NM_OUTBOUND_DOMAIN_ALLOWLIST"); v != "" {
 		cfg.Security.OutboundDomainAllowlist = splitCSV(v)
 	}
+	if v := os.Getenv("NM_KEY_ROTATION_GRACE"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Security.KeyRotationGrace = d
+		}
+	}
 	if v := os.Getenv("NM_LOG_LEVEL"); v != "" {
 		cfg.Log.Level = v
 	}
+	if v := os.Getenv("NM_LOG_FORMAT"); v != "" {
+		cfg.Log.Format = v
+	}
 }
 
 func parseBool(input string, fallback bool) bool {
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"strings"
+
+	"neuralmail/internal/secrets"
+)
+
+// SecretRefs maps the settings whose value was resolved from a secret
+// store, by YAML path, to the reference they were given.
+func (c Config) SecretRefs() map[string]string {
+	return maps.Clone(c.secretRefs)
+}
+
+// resolveSecrets replaces every string setting holding a secret reference,
+// such as vault:kv/data/nerve#stripe_key, with the secret it names.
+func resolveSecrets(ctx context.Context, cfg *Config, r *secrets.Resolver) error {
+	refs := map[string]string{}
+	var errs []error
+	walkStrings(reflect.ValueOf(cfg).Elem(), "", func(key string, v reflect.Value) {
+		ref := v.String()
+		if !secrets.IsRef(ref) {
+			return
+		}
+		value, err := r.Resolve(ctx, ref)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			return
+		}
+		refs[key] = ref
+		v.SetString(value)
+	})
+	if len(refs) > 0 {
+		cfg.secretRefs = refs
+	}
+	return errors.Join(errs...)
+}
+
+// walkStrings calls fn with each settable string setting under v and its
+// YAML path. Structs held in maps are copied, walked and stored back.
+func walkStrings(v reflect.Value, prefix string, fn func(key string, v reflect.Value)) {
+	join := func(name string) string {
+		if prefix == "" {
+			return name
+		}
+		return prefix + "." + name
+	}
+	switch v.Kind() {
+	case reflect.String:
+		fn(prefix, v)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			walkStrings(v.Field(i), join(name), fn)
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			return
+		}
+		for _, k := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(k))
+			walkStrings(elem, join(k.String()), fn)
+			v.SetMapIndex(k, elem)
+		}
+	}
+}
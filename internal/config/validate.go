@@ -0,0 +1,276 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Problem severities. Errors keep the services from starting; warnings are
+// settings that work but likely not as intended.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Problem is one finding of Validate, about the setting at Field (its YAML
+// path, such as security.token_signing_key).
+type Problem struct {
+	Severity string `json:"severity"`
+	Field    string `json:"field"`
+	Message  string `json:"message"`
+}
+
+func (p Problem) String() string { return p.Field + ": " + p.Message }
+
+type Problems []Problem
+
+// Err joins the error-severity problems into one error, or returns nil if
+// there are none.
+func (ps Problems) Err() error {
+	var errs []error
+	for _, p := range ps {
+		if p.Severity == SeverityError {
+			errs = append(errs, errors.New(p.String()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks the configuration as a whole, settings that only make
+// sense together included, so mistakes are reported at startup or by
+// `neuralmail config check` rather than when serve or worker first trips
+// over them.
+func (c Config) Validate() Problems {
+	var ps Problems
+	fail := func(field, format string, args ...any) {
+		ps = append(ps, Problem{Severity: SeverityError, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	warn := func(field, format string, args ...any) {
+		ps = append(ps, Problem{Severity: SeverityWarning, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.JMAP.URL == "" {
+		fail("jmap.url", "required (NM_JMAP_URL)")
+	}
+	if c.Database.DSN == "" {
+		fail("database.dsn", "required (NM_DB_DSN)")
+	}
+	if (c.HTTP.TLSCertFile == "") != (c.HTTP.TLSKeyFile == "") {
+		fail("http.tls_cert_file", "set together with http.tls_key_file, or neither")
+	}
+	if c.Auth.RequireTokenClaims && (c.Auth.Issuer == "" || c.Auth.Audience == "") {
+		fail("auth.require_token_claims", "needs auth.issuer and auth.audience")
+	}
+	if c.Auth.RequireCertBinding && c.HTTP.ClientCAFile == "" {
+		fail("auth.require_cert_binding", "needs http.client_ca_file")
+	}
+	if c.Cloud.Mode {
+		if c.Security.TokenSigningKey == "" {
+			fail("security.token_signing_key", "required in cloud mode, which signs and verifies org tokens with it (NERVE_TOKEN_SIGNING_KEY)")
+		}
+		if c.Billing.Provider == "stripe" && c.Billing.StripeSecretKey == "" {
+			warn("billing.stripe_secret_key", "unset, so checkout and the billing portal will fail in cloud mode")
+		}
+	}
+
+	switch c.Embedding.Provider {
+	case "noop":
+	case "openai":
+		if c.LLM.OpenAIKey == "" {
+			fail("llm.openai_key", "embedding.provider openai needs it (NM_OPENAI_API_KEY)")
+		}
+	case "ollama":
+		if c.LLM.OllamaURL == "" {
+			fail("llm.ollama_url", "embedding.provider ollama needs it (NM_OLLAMA_URL)")
+		}
+	default:
+		fail("embedding.provider", "%q is not one of noop, openai or ollama", c.Embedding.Provider)
+	}
+	if c.Embedding.Provider != "noop" {
+		if c.Qdrant.URL == "" {
+			fail("qdrant.url", "required when embedding.provider is %s (NM_QDRANT_URL)", c.Embedding.Provider)
+		}
+		if c.Embedding.Dim <= 0 {
+			fail("embedding.dim", "must be positive")
+		} else if c.Embedding.Dim != c.Qdrant.EmbedDim {
+			fail("embedding.dim", "%d does not match qdrant.embed_dim %d, so vectors would not fit the collection (NM_EMBED_DIM sets both)", c.Embedding.Dim, c.Qdrant.EmbedDim)
+		}
+	}
+	if c.Embedding.ChunkSize > 0 && c.Embedding.ChunkOverlap >= c.Embedding.ChunkSize {
+		fail("embedding.chunk_overlap", "%d must be less than embedding.chunk_size %d", c.Embedding.ChunkOverlap, c.Embedding.ChunkSize)
+	}
+
+	switch c.LLM.Provider {
+	case "noop":
+	case "openai":
+		if c.LLM.OpenAIKey == "" {
+			warn("llm.openai_key", "unset, so llm.provider openai falls back to noop (NM_OPENAI_API_KEY)")
+		}
+	case "ollama":
+		if c.LLM.OllamaURL == "" {
+			warn("llm.ollama_url", "unset, so llm.provider ollama falls back to noop (NM_OLLAMA_URL)")
+		}
+	case "anthropic":
+		if c.LLM.Anthropic.APIKey == "" {
+			warn("llm.anthropic.api_key", "unset, so llm.provider anthropic falls back to noop (NM_ANTHROPIC_API_KEY)")
+		}
+	case "azure":
+		if c.LLM.Azure.Endpoint == "" || (c.LLM.Model == "" && c.LLM.Azure.Deployment == "") {
+			warn("llm.azure.endpoint", "llm.provider azure needs an endpoint and llm.model or llm.azure.deployment, and falls back to noop without them")
+		}
+	default:
+		fail("llm.provider", "%q is not one of noop, openai, ollama, anthropic or azure", c.LLM.Provider)
+	}
+
+	switch c.Outbound.Transport {
+	case "", "smtp":
+	case "ses":
+		if c.Outbound.SESRegion == "" || c.Outbound.SESAccessKeyID == "" || c.Outbound.SESSecretAccessKey == "" {
+			fail("outbound.transport", "ses needs outbound.ses_region, ses_access_key_id and ses_secret_access_key; mail would wait in the outbox")
+		}
+	case "sendgrid":
+		if c.Outbound.SendGridAPIKey == "" {
+			fail("outbound.transport", "sendgrid needs outbound.sendgrid_api_key; mail would wait in the outbox")
+		}
+	case "postmark":
+		if c.Outbound.PostmarkServerToken == "" {
+			fail("outbound.transport", "postmark needs outbound.postmark_server_token; mail would wait in the outbox")
+		}
+	default:
+		fail("outbound.transport", "%q is not one of smtp, ses, sendgrid or postmark", c.Outbound.Transport)
+	}
+
+	switch c.Redis.Mode {
+	case "", "standalone":
+	case "sentinel":
+		if c.Redis.MasterName == "" || len(c.Redis.Addrs) == 0 {
+			fail("redis.mode", "sentinel needs redis.master_name and redis.addrs")
+		}
+	case "cluster":
+		if len(c.Redis.Addrs) == 0 {
+			fail("redis.mode", "cluster needs seed redis.addrs")
+		}
+	default:
+		fail("redis.mode", "%q is not one of standalone, sentinel or cluster", c.Redis.Mode)
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		fail("log.level", "%q is not one of debug, info, warn or error", c.Log.Level)
+	}
+	if f := strings.ToLower(c.Log.Format); f != "" && f != "text" && f != "json" {
+		fail("log.format", "%q is not text or json", c.Log.Format)
+	}
+	if c.Canary.Percent < 0 || c.Canary.Percent > 100 {
+		fail("canary.percent", "%d is not between 0 and 100", c.Canary.Percent)
+	}
+	if c.Reload.WatchInterval < 0 {
+		fail("reload.watch_interval", "must not be negative")
+	}
+	if c.Secrets.RefreshInterval < 0 {
+		fail("secrets.refresh_interval", "must not be negative")
+	}
+	return ps
+}
+
+// Setting is one effective configuration value, rendered as text.
+type Setting struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+const masked = "********"
+
+// Settings lists every setting of c by YAML path, secrets masked: keys,
+// passwords, secrets and tokens show only whether they are set, and
+// credentials inside DSNs and URLs are hidden. Settings resolved from a
+// secret store show their reference.
+func (c Config) Settings() []Setting {
+	var out []Setting
+	walkSettings(reflect.ValueOf(c), "", &out)
+	for i, s := range out {
+		if ref, ok := c.secretRefs[s.Key]; ok {
+			out[i].Value = ref
+		}
+	}
+	return out
+}
+
+func walkSettings(v reflect.Value, prefix string, out *[]Setting) {
+	join := func(name string) string {
+		if prefix == "" {
+			return name
+		}
+		return prefix + "." + name
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			walkSettings(v.Field(i), join(name), out)
+		}
+		return
+	case reflect.Map:
+		if v.Type().Elem().Kind() == reflect.Struct {
+			keys := v.MapKeys()
+			sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+			for _, k := range keys {
+				walkSettings(v.MapIndex(k), join(k.String()), out)
+			}
+			return
+		}
+	}
+	*out = append(*out, Setting{Key: prefix, Value: settingValue(prefix, v)})
+}
+
+var dsnPassword = regexp.MustCompile(`(password=)\S+`)
+
+func settingValue(key string, v reflect.Value) string {
+	switch x := v.Interface().(type) {
+	case string:
+		if x != "" && secretKey(key) {
+			return masked
+		}
+		if u, err := url.Parse(x); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				// url escapes the asterisks of the mask, so it goes in
+				// after.
+				u.User = url.UserPassword(u.User.Username(), "x")
+				return strings.Replace(u.String(), ":x@", ":"+masked+"@", 1)
+			}
+		}
+		return dsnPassword.ReplaceAllString(x, "${1}"+masked)
+	case time.Duration:
+		return x.String()
+	case []string:
+		return strings.Join(x, ",")
+	}
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Map {
+		data, _ := json.Marshal(v.Interface())
+		return string(data)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// secretKey reports whether the setting at key holds a credential.
+func secretKey(key string) bool {
+	name := key[strings.LastIndex(key, ".")+1:]
+	switch {
+	case strings.HasSuffix(name, "_url"), strings.HasSuffix(name, "public_key"):
+		return false
+	case strings.Contains(name, "password"), strings.Contains(name, "secret"), strings.Contains(name, "token"):
+		return true
+	}
+	return name == "api_key" || strings.HasSuffix(name, "_key")
+}
@@ -0,0 +1,88 @@
+package domains
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dkimKeyBits is the size of generated DKIM keys. 2048-bit keys fit a
+// single DNS TXT record split into strings, which every provider accepts.
+const dkimKeyBits = 2048
+
+// DefaultDKIMSelector is the selector of a domain's first key.
+const DefaultDKIMSelector = "nerve"
+
+// GenerateDKIMKey returns a new RSA signing key as PEM: the private key in
+// PKCS #1 and the public key in PKIX, whose body is a DKIM record's p= tag.
+func GenerateDKIMKey() (privatePEM, publicPEM string, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, dkimKeyBits)
+	if err != nil {
+		return "", "", fmt.Errorf("generate dkim key: %w", err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", "", fmt.Errorf("marshal dkim public key: %w", err)
+	}
+	privatePEM = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	publicPEM = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))
+	return privatePEM, publicPEM, nil
+}
+
+// RotationSelector names the key a rotation at now creates, so selectors
+// sort by age and never repeat one still published.
+func RotationSelector(now time.Time) string {
+	return DefaultDKIMSelector + now.UTC().Format("20060102150405")
+}
+
+// ParseEncryptionKey decodes the key DKIM private keys are encrypted with,
+// given as base64 or hex of 32 bytes.
+func ParseEncryptionKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("dkim encryption key is not configured")
+	}
+	if key, err := hex.DecodeString(s); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("dkim encryption key must be 32 bytes, base64 or hex encoded")
+	}
+	return key, nil
+}
+
+// DKIMRecord is the record a domain publishes for its key under selector.
+// With the cname method and a hosting zone the domain points a CNAME at
+// the key's name in that zone, hosted is the TXT record the zone's operator
+// publishes there, and ok is true; otherwise the domain publishes the TXT
+// record itself.
+func DKIMRecord(domain, method, selector, publicPEM, zone string) (record DNSRecord, hosted DNSRecord, ok bool) {
+	txt := DNSRecord{
+		Type:     "TXT",
+		Host:     selector + "._domainkey",
+		Value:    "v=DKIM1; k=rsa; p=" + pemBody(publicPEM),
+		Purpose:  "DKIM signing key (selector " + selector + ")",
+		Required: true,
+	}
+	zone = trimDot(zone)
+	if method != "cname" || zone == "" {
+		return txt, DNSRecord{}, false
+	}
+	target := selector + "." + strings.ReplaceAll(domain, ".", "-") + "." + zone
+	record = DNSRecord{
+		Type:     "CNAME",
+		Host:     txt.Host,
+		Value:    target,
+		Purpose:  txt.Purpose,
+		Required: true,
+	}
+	txt.Host = target
+	return record, txt, true
+}
@@ -0,0 +1,63 @@
+package domains
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"neuralmail/internal/store"
+)
+
+func TestGeneratedDKIMKeyVerifiesOncePublished(t *testing.T) {
+	privatePEM, publicPEM, err := GenerateDKIMKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(privatePEM, "RSA PRIVATE KEY") {
+		t.Fatalf("unexpected private key PEM: %.40s", privatePEM)
+	}
+
+	selector := RotationSelector(time.Date(2026, 10, 15, 9, 30, 0, 0, time.UTC))
+	if selector != "nerve20261015093000" {
+		t.Fatalf("unexpected rotation selector %q", selector)
+	}
+	record, _, hosted := DKIMRecord("acme.test", "txt", selector, publicPEM, "dkim.nerve.test")
+	if hosted || record.Type != "TXT" || record.Host != selector+"._domainkey" {
+		t.Fatalf("unexpected txt record %+v", record)
+	}
+
+	d := store.OrgDomain{Domain: "acme.test", DKIMMethod: "txt"}
+	key := store.DKIMKey{Selector: selector, PublicKey: publicPEM}
+	v := NewVerifier(fakeResolver{txt: map[string][]string{}})
+	if v.CheckDKIMKey(context.Background(), d, key, "").Verified {
+		t.Fatal("expected an unpublished key to fail")
+	}
+	v = NewVerifier(fakeResolver{txt: map[string][]string{selector + "._domainkey.acme.test": {record.Value}}})
+	if c := v.CheckDKIMKey(context.Background(), d, key, ""); !c.Verified {
+		t.Fatalf("expected the published key to pass, got %+v", c)
+	}
+
+	// With the cname method the zone's operator publishes the key.
+	record, txt, hosted := DKIMRecord("acme.test", "cname", selector, publicPEM, "dkim.nerve.test.")
+	want := selector + ".acme-test.dkim.nerve.test"
+	if !hosted || record.Type != "CNAME" || record.Value != want || txt.Host != want || !strings.HasPrefix(txt.Value, "v=DKIM1; k=rsa; p=") {
+		t.Fatalf("unexpected cname records %+v %+v", record, txt)
+	}
+}
+
+func TestParseEncryptionKey(t *testing.T) {
+	raw := strings.Repeat("k", 32)
+	for _, enc := range []string{hex.EncodeToString([]byte(raw)), "a2tra2tra2tra2tra2tra2tra2tra2tra2tra2tra2s="} {
+		key, err := ParseEncryptionKey(enc)
+		if err != nil || string(key) != raw {
+			t.Fatalf("%s: got %q %v", enc, key, err)
+		}
+	}
+	for _, enc := range []string{"", "c2hvcnQ=", "not base64!"} {
+		if _, err := ParseEncryptionKey(enc); err == nil {
+			t.Fatalf("expected %q to be rejected", enc)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package domains
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/notify"
+	"neuralmail/internal/store"
+)
+
+// Rechecker re-runs domain verification in the background, so a domain
+// goes active once its DNS is in place without anyone calling
+// POST /v1/domains/verify, and an active domain whose ownership record
+// disappears fails. Status changes are published to the org's webhooks
+// through Notify, if set.
+type Rechecker struct {
+	Verifier *Verifier
+	Expect   Expectations
+	// FailAfter is how long an active domain's ownership record may be
+	// missing before the domain fails; a brief DNS outage does not fail it.
+	FailAfter time.Duration
+	Now       func() time.Time
+	Notify    *notify.Webhooks
+}
+
+func NewRechecker(cfg config.Config) *Rechecker {
+	return &Rechecker{
+		Verifier:  NewVerifier(nil),
+		Expect:    ExpectationsFrom(cfg),
+		FailAfter: cfg.Domains.FailAfter,
+		Now:       func() time.Time { return time.Now().UTC() },
+		Notify:    notify.NewWebhooks(),
+	}
+}
+
+// ExpectationsFrom reads the records domains must hold from cfg.
+func ExpectationsFrom(cfg config.Config) Expectations {
+	return Expectations{
+		MXHost:        cfg.Domains.MXHost,
+		SPFInclude:    cfg.Domains.SPFInclude,
+		DKIMCNAMEZone: cfg.Domains.DKIMCNAMEZone,
+	}
+}
+
+// RecheckResult counts what a Run did. Rotated counts the DKIM keys that
+// took over from their domain's previous key.
+type RecheckResult struct {
+	Checked   int
+	Activated int
+	Failed    int
+	Rotated   int
+}
+
+// Run re-checks every pending, active and failed domain in st and records
+// the outcome. A domain whose check cannot be stored, e.g. because another
+// org verified the same domain first, is logged and skipped. It then
+// activates the rotated DKIM keys whose records are published and retires
+// the replaced keys whose overlap has ended.
+func (r *Rechecker) Run(ctx context.Context, st *store.Store) (RecheckResult, error) {
+	var res RecheckResult
+	list, err := st.ListOrgDomainsToRecheck(ctx)
+	if err != nil {
+		return res, err
+	}
+	for _, d := range list {
+		if ctx.Err() != nil {
+			return res, ctx.Err()
+		}
+		checks := r.Verifier.CheckRecords(ctx, d, r.Expect)
+		status := r.nextStatus(d, checks.Ownership.Verified)
+		if err := st.RecordOrgDomainCheck(ctx, d.ID, checks.MX.Verified, checks.SPF.Verified, checks.DKIM.Verified, checks.DMARC.Verified, checks.Ownership.Verified, status); err != nil {
+			slog.ErrorContext(ctx, "domain recheck failed", "domain", d.Domain, "org_id", d.OrgID, "err", err)
+			continue
+		}
+		res.Checked++
+		if status == d.Status {
+			continue
+		}
+		switch status {
+		case "active":
+			res.Activated++
+			r.publish(ctx, st, d, status, checks, notify.EventDomainVerified)
+		case "failed":
+			res.Failed++
+			r.publish(ctx, st, d, status, checks, notify.EventDomainFailed)
+		}
+		slog.InfoContext(ctx, "domain status changed", "domain", d.Domain, "org_id", d.OrgID, "from", d.Status, "to", status)
+	}
+	rotated, err := r.rotateKeys(ctx, st, list)
+	res.Rotated = rotated
+	return res, err
+}
+
+// rotateKeys activates the pending DKIM keys of the active domains in list
+// whose records are published, then retires the keys past their overlap.
+func (r *Rechecker) rotateKeys(ctx context.Context, st *store.Store, list []store.OrgDomain) (int, error) {
+	pending, err := st.ListPendingDKIMKeys(ctx)
+	if err != nil {
+		return 0, err
+	}
+	byID := make(map[string]store.OrgDomain, len(list))
+	for _, d := range list {
+		byID[d.ID] = d
+	}
+	rotated := 0
+	for _, key := range pending {
+		d, ok := byID[key.DomainID]
+		if !ok || d.Status != "active" {
+			continue
+		}
+		if !r.Verifier.CheckDKIMKey(ctx, d, key, r.Expect.DKIMCNAMEZone).Verified {
+			continue
+		}
+		activated, err := st.ActivateDKIMKey(ctx, key.ID)
+		if err != nil {
+			slog.ErrorContext(ctx, "dkim key activation failed", "domain", d.Domain, "selector", key.Selector, "err", err)
+			continue
+		}
+		if activated {
+			rotated++
+			slog.InfoContext(ctx, "dkim key rotated", "domain", d.Domain, "org_id", d.OrgID, "selector", key.Selector)
+		}
+	}
+	_, err = st.RetireDKIMKeys(ctx)
+	return rotated, err
+}
+
+// nextStatus is d's status after a check: any domain whose ownership record
+// is found is active, and an active one fails once the record has been
+// missing for FailAfter. Pending claims that never verify are left to
+// expire.
+func (r *Rechecker) nextStatus(d store.OrgDomain, verified bool) string {
+	if verified {
+		return "active"
+	}
+	if d.Status != "active" {
+		return d.Status
+	}
+	if d.VerifiedAt.Valid && r.Now().Sub(d.VerifiedAt.Time) < r.FailAfter {
+		return d.Status
+	}
+	return "failed"
+}
+
+// publish tells d's org that d moved to status. A failure is only logged:
+// the new status is already stored.
+func (r *Rechecker) publish(ctx context.Context, st *store.Store, d store.OrgDomain, status string, checks RecordChecks, eventType string) {
+	if r.Notify == nil || d.OrgID == "" {
+		return
+	}
+	_, err := r.Notify.Publish(ctx, st, d.OrgID, eventType, map[string]any{
+		"domain_id":       d.ID,
+		"domain":          d.Domain,
+		"status":          status,
+		"previous_status": d.Status,
+		"mx_verified":     checks.MX.Verified,
+		"spf_verified":    checks.SPF.Verified,
+		"dkim_verified":   checks.DKIM.Verified,
+		"dmarc_verified":  checks.DMARC.Verified,
+		"details":         checks.Ownership.Details,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "domain publish failed", "event_type", eventType, "domain", d.Domain, "err", err)
+	}
+}
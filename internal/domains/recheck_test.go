@@ -0,0 +1,37 @@
+package domains
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"neuralmail/internal/store"
+)
+
+func TestRecheckStatusTransitions(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	r := &Rechecker{FailAfter: 72 * time.Hour, Now: func() time.Time { return now }}
+	seen := func(ago time.Duration) sql.NullTime { return sql.NullTime{Time: now.Add(-ago), Valid: true} }
+
+	cases := []struct {
+		status   string
+		verified bool
+		seen     sql.NullTime
+		want     string
+	}{
+		{"pending", true, sql.NullTime{}, "active"},
+		{"pending", false, sql.NullTime{}, "pending"},
+		{"failed", true, seen(240 * time.Hour), "active"},
+		{"failed", false, seen(240 * time.Hour), "failed"},
+		{"active", true, seen(time.Hour), "active"},
+		{"active", false, seen(time.Hour), "active"},
+		{"active", false, seen(73 * time.Hour), "failed"},
+		{"active", false, sql.NullTime{}, "failed"},
+	}
+	for _, tc := range cases {
+		d := store.OrgDomain{Status: tc.status, VerifiedAt: tc.seen}
+		if got := r.nextStatus(d, tc.verified); got != tc.want {
+			t.Errorf("%s verified=%v seen=%v: got %s, want %s", tc.status, tc.verified, tc.seen.Time, got, tc.want)
+		}
+	}
+}
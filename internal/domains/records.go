@@ -0,0 +1,318 @@
+package domains
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"neuralmail/internal/store"
+)
+
+// MXResolver looks up a domain's mail exchangers. The default resolver
+// implements it; with a resolver that does not, MX records count as
+// missing.
+type MXResolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+// CNAMEResolver looks up the canonical name of a host, which is the host
+// itself when it has no CNAME record. The default resolver implements it;
+// with a resolver that does not, DKIM CNAMEs count as missing.
+type CNAMEResolver interface {
+	LookupCNAME(ctx context.Context, host string) (string, error)
+}
+
+func (n netTXTResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	return n.r.LookupMX(ctx, name)
+}
+
+func (n netTXTResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	return n.r.LookupCNAME(ctx, host)
+}
+
+// Expectations are what a domain's mail records must point at. An empty
+// MXHost accepts any MX record, an empty SPFInclude any SPF record and an
+// empty DKIMCNAMEZone a DKIM CNAME to any host that publishes the key.
+type Expectations struct {
+	MXHost        string
+	SPFInclude    string
+	DKIMCNAMEZone string
+}
+
+// RecordCheck is the outcome of checking one record: the name looked up,
+// what was expected and found there, and why it passed or failed.
+type RecordCheck struct {
+	Verified bool     `json:"verified"`
+	Name     string   `json:"name"`
+	Expected string   `json:"expected,omitempty"`
+	Found    []string `json:"found,omitempty"`
+	Details  string   `json:"details"`
+}
+
+// RecordChecks is the outcome of checking every record a domain needs.
+type RecordChecks struct {
+	Ownership OwnershipVerification
+	MX        RecordCheck
+	SPF       RecordCheck
+	DKIM      RecordCheck
+	DMARC     RecordCheck
+}
+
+// CheckRecords checks d's ownership token and its MX, SPF, DKIM and DMARC
+// records against want.
+func (v *Verifier) CheckRecords(ctx context.Context, d store.OrgDomain, want Expectations) RecordChecks {
+	return RecordChecks{
+		Ownership: v.VerifyOwnership(ctx, d.Domain, d.VerificationToken),
+		MX:        v.checkMX(ctx, d.Domain, want.MXHost),
+		SPF:       v.checkSPF(ctx, d.Domain, want.SPFInclude),
+		DKIM:      v.checkDKIM(ctx, d, want.DKIMCNAMEZone),
+		DMARC:     v.checkDMARC(ctx, d.Domain),
+	}
+}
+
+func (v *Verifier) checkMX(ctx context.Context, domain, host string) RecordCheck {
+	c := RecordCheck{Name: domain, Expected: trimDot(host)}
+	resolver, ok := v.Resolver.(MXResolver)
+	if !ok {
+		c.Details = "MX lookups are not supported by the resolver"
+		return c
+	}
+	records, err := resolver.LookupMX(ctx, domain)
+	if err != nil {
+		c.Details = lookupFailure("MX", domain, err)
+		return c
+	}
+	for _, mx := range records {
+		c.Found = append(c.Found, fmt.Sprintf("%d %s", mx.Pref, trimDot(mx.Host)))
+		if host == "" || strings.EqualFold(trimDot(mx.Host), trimDot(host)) {
+			c.Verified = true
+		}
+	}
+	switch {
+	case c.Verified && host == "":
+		c.Details = "MX records found"
+	case c.Verified:
+		c.Details = "MX points at " + c.Expected
+	case len(records) == 0:
+		c.Details = "no MX records at " + domain
+	default:
+		c.Details = "MX does not point at " + c.Expected
+	}
+	return c
+}
+
+// checkSPF wants exactly one SPF record, since receivers treat several as
+// a permanent error, that includes include when set.
+func (v *Verifier) checkSPF(ctx context.Context, domain, include string) RecordCheck {
+	c := RecordCheck{Name: domain}
+	if include != "" {
+		c.Expected = "include:" + include
+	}
+	records, err := v.Resolver.LookupTXT(ctx, domain)
+	if err != nil {
+		c.Details = lookupFailure("TXT", domain, err)
+		return c
+	}
+	for _, rec := range records {
+		if fields := strings.Fields(rec); len(fields) > 0 && strings.EqualFold(fields[0], "v=spf1") {
+			c.Found = append(c.Found, rec)
+		}
+	}
+	switch len(c.Found) {
+	case 0:
+		c.Details = "no SPF record at " + domain
+		return c
+	case 1:
+	default:
+		c.Details = "several SPF records at " + domain + "; receivers reject all of them"
+		return c
+	}
+	if include == "" {
+		c.Verified, c.Details = true, "SPF record found"
+		return c
+	}
+	for _, f := range strings.Fields(c.Found[0])[1:] {
+		if strings.EqualFold(strings.TrimLeft(f, "+"), c.Expected) {
+			c.Verified, c.Details = true, "SPF record includes "+include
+			return c
+		}
+	}
+	c.Details = "SPF record does not include " + include
+	return c
+}
+
+// checkDKIM looks for the key record under d's selector. With the cname
+// method the selector must be a CNAME, into DKIMCNAMEZone when one is set,
+// and the record it leads to must publish the key; with txt the key is
+// published at the selector itself. When the domain's public key is known,
+// the record must carry that key.
+func (v *Verifier) checkDKIM(ctx context.Context, d store.OrgDomain, zone string) RecordCheck {
+	name := d.DKIMSelector + "._domainkey." + d.Domain
+	c := RecordCheck{Name: name}
+	if d.DKIMSelector == "" {
+		c.Details = "domain has no DKIM selector"
+		return c
+	}
+	if d.DKIMMethod == "cname" {
+		resolver, ok := v.Resolver.(CNAMEResolver)
+		if !ok {
+			c.Details = "CNAME lookups are not supported by the resolver"
+			return c
+		}
+		if zone != "" {
+			c.Expected = "CNAME into " + trimDot(zone)
+		}
+		target, err := resolver.LookupCNAME(ctx, name)
+		if err != nil {
+			c.Details = lookupFailure("CNAME", name, err)
+			return c
+		}
+		target = trimDot(target)
+		if strings.EqualFold(target, name) {
+			c.Details = "no CNAME record at " + name
+			return c
+		}
+		c.Found = append(c.Found, "CNAME "+target)
+		if zone != "" && !inZone(target, trimDot(zone)) {
+			c.Details = "CNAME points at " + target + ", outside " + trimDot(zone)
+			return c
+		}
+	}
+
+	records, err := v.Resolver.LookupTXT(ctx, name)
+	if err != nil {
+		c.Details = lookupFailure("TXT", name, err)
+		return c
+	}
+	key := pemBody(d.DKIMPublicKey.String)
+	if key != "" && c.Expected == "" {
+		c.Expected = "p=" + key
+	}
+	published := false
+	for _, rec := range records {
+		tags := parseTags(rec)
+		p, ok := tags["p"]
+		if !ok {
+			continue
+		}
+		c.Found = append(c.Found, rec)
+		if version, ok := tags["v"]; ok && version != "DKIM1" {
+			continue
+		}
+		published = true
+		if p == "" {
+			c.Details = "DKIM key at " + name + " is revoked (empty p=)"
+			return c
+		}
+		if key == "" || strings.ReplaceAll(p, " ", "") == key {
+			c.Verified, c.Details = true, "DKIM key published at "+name
+			return c
+		}
+	}
+	if published {
+		c.Details = "DKIM record at " + name + " publishes a different key"
+	} else {
+		c.Details = "no DKIM key record at " + name
+	}
+	return c
+}
+
+// CheckDKIMKey checks that key is published under its own selector, which a
+// rotation waits for before the key starts signing.
+func (v *Verifier) CheckDKIMKey(ctx context.Context, d store.OrgDomain, key store.DKIMKey, zone string) RecordCheck {
+	d.DKIMSelector = key.Selector
+	d.DKIMPublicKey = sql.NullString{String: key.PublicKey, Valid: key.PublicKey != ""}
+	return v.checkDKIM(ctx, d, zone)
+}
+
+// dmarcPolicies are the p= values a DMARC record may carry.
+var dmarcPolicies = []string{"none", "quarantine", "reject"}
+
+// checkDMARC wants one DMARC record with a valid policy. p=none passes but
+// is called out, since it only monitors.
+func (v *Verifier) checkDMARC(ctx context.Context, domain string) RecordCheck {
+	name := "_dmarc." + domain
+	c := RecordCheck{Name: name, Expected: "v=DMARC1; p=none|quarantine|reject"}
+	records, err := v.Resolver.LookupTXT(ctx, name)
+	if err != nil {
+		c.Details = lookupFailure("TXT", name, err)
+		return c
+	}
+	for _, rec := range records {
+		if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(rec)), "V=DMARC1") {
+			c.Found = append(c.Found, rec)
+		}
+	}
+	switch len(c.Found) {
+	case 0:
+		c.Details = "no DMARC record at " + name
+		return c
+	case 1:
+	default:
+		c.Details = "several DMARC records at " + name + "; receivers ignore all of them"
+		return c
+	}
+	policy, ok := parseTags(c.Found[0])["p"]
+	policy = strings.ToLower(policy)
+	switch {
+	case !ok:
+		c.Details = "DMARC record has no p= policy"
+	case !slices.Contains(dmarcPolicies, policy):
+		c.Details = "DMARC policy p=" + policy + " is not one of none, quarantine, reject"
+	case policy == "none":
+		c.Verified, c.Details = true, "DMARC policy is p=none: failures are reported, not enforced"
+	default:
+		c.Verified, c.Details = true, "DMARC policy is p="+policy
+	}
+	return c
+}
+
+// parseTags splits a DKIM or DMARC tag list ("v=DKIM1; k=rsa; p=...") into
+// its tags.
+func parseTags(rec string) map[string]string {
+	tags := map[string]string{}
+	for _, part := range strings.Split(rec, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		tags[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+	return tags
+}
+
+// lookupFailure describes a failed lookup of a record type at name.
+func lookupFailure(recordType, name string, err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return recordType + " record not found at " + name
+	}
+	return recordType + " lookup failed for " + name
+}
+
+func inZone(host, zone string) bool {
+	host, zone = strings.ToLower(host), strings.ToLower(zone)
+	return host == zone || strings.HasSuffix(host, "."+zone)
+}
+
+func trimDot(host string) string {
+	return strings.TrimSuffix(host, ".")
+}
+
+// pemBody is the base64 body of a PEM block, as a DKIM record's p= tag
+// carries it.
+func pemBody(pem string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(pem, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "-----") {
+			continue
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
@@ -0,0 +1,166 @@
+package domains
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"strings"
+	"testing"
+
+	"neuralmail/internal/store"
+)
+
+type fakeResolver struct {
+	txt   map[string][]string
+	mx    map[string][]*net.MX
+	cname map[string]string
+}
+
+func notFound(name string) error {
+	return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (f fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if target, ok := f.cname[name]; ok {
+		name = target
+	}
+	if recs, ok := f.txt[name]; ok {
+		return recs, nil
+	}
+	return nil, notFound(name)
+}
+
+func (f fakeResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if recs, ok := f.mx[name]; ok {
+		return recs, nil
+	}
+	return nil, notFound(name)
+}
+
+func (f fakeResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	if target, ok := f.cname[host]; ok {
+		return target + ".", nil
+	}
+	return host + ".", nil
+}
+
+func TestCheckRecords(t *testing.T) {
+	resolver := fakeResolver{
+		txt: map[string][]string{
+			"_nerve-verify.acme.test":    {"tok-123"},
+			"acme.test":                  {"google-site-verification=x", "v=spf1 include:_spf.nerve.test ~all"},
+			"nerve._domainkey.acme.test": {"v=DKIM1; k=rsa; p=MIIBIjAN BgkqhkiG"},
+			"_dmarc.acme.test":           {"v=DMARC1; p=quarantine; rua=mailto:d@acme.test"},
+		},
+		mx: map[string][]*net.MX{"acme.test": {{Host: "MX.nerve.test.", Pref: 10}}},
+	}
+	d := store.OrgDomain{
+		Domain:            "acme.test",
+		VerificationToken: "tok-123",
+		DKIMSelector:      "nerve",
+		DKIMMethod:        "txt",
+		DKIMPublicKey:     sql.NullString{String: "-----BEGIN PUBLIC KEY-----\nMIIBIjAN\nBgkqhkiG\n-----END PUBLIC KEY-----\n", Valid: true},
+	}
+	v := NewVerifier(resolver)
+	ctx := context.Background()
+
+	got := v.CheckRecords(ctx, d, Expectations{MXHost: "mx.nerve.test", SPFInclude: "_spf.nerve.test"})
+	if !got.Ownership.Verified || !got.MX.Verified || !got.SPF.Verified || !got.DKIM.Verified || !got.DMARC.Verified {
+		t.Fatalf("expected every record to pass, got %+v", got)
+	}
+	if got.DMARC.Details != "DMARC policy is p=quarantine" || len(got.MX.Found) != 1 || got.MX.Found[0] != "10 MX.nerve.test" {
+		t.Fatalf("unexpected diagnostics: %+v", got)
+	}
+
+	got = v.CheckRecords(ctx, d, Expectations{MXHost: "mx.other.test", SPFInclude: "_spf.other.test"})
+	if got.MX.Verified || got.SPF.Verified || got.MX.Details != "MX does not point at mx.other.test" {
+		t.Fatalf("expected MX and SPF pointing elsewhere to fail, got %+v", got)
+	}
+
+	d.DKIMPublicKey.String = "-----BEGIN PUBLIC KEY-----\nOTHERKEY\n-----END PUBLIC KEY-----\n"
+	if dkim := v.CheckRecords(ctx, d, Expectations{}).DKIM; dkim.Verified || !strings.Contains(dkim.Details, "different key") {
+		t.Fatalf("expected a DKIM record publishing another key to fail, got %+v", dkim)
+	}
+}
+
+func TestCheckDKIMCNAME(t *testing.T) {
+	resolver := fakeResolver{
+		txt:   map[string][]string{"acme-test.dkim.nerve.test": {"v=DKIM1; p=KEY"}},
+		cname: map[string]string{"nerve._domainkey.acme.test": "acme-test.dkim.nerve.test"},
+	}
+	v := NewVerifier(resolver)
+	d := store.OrgDomain{Domain: "acme.test", DKIMSelector: "nerve", DKIMMethod: "cname"}
+	ctx := context.Background()
+
+	if c := v.checkDKIM(ctx, d, "dkim.nerve.test"); !c.Verified {
+		t.Fatalf("expected the CNAME into the zone to pass, got %+v", c)
+	}
+	if c := v.checkDKIM(ctx, d, "dkim.other.test"); c.Verified || !strings.Contains(c.Details, "outside dkim.other.test") {
+		t.Fatalf("expected a CNAME outside the zone to fail, got %+v", c)
+	}
+	// A key published as TXT does not satisfy the cname method.
+	resolver.txt["nerve._domainkey.acme.test"] = []string{"v=DKIM1; p=KEY"}
+	delete(resolver.cname, "nerve._domainkey.acme.test")
+	if c := v.checkDKIM(ctx, d, ""); c.Verified || c.Details != "no CNAME record at nerve._domainkey.acme.test" {
+		t.Fatalf("expected a missing CNAME to fail, got %+v", c)
+	}
+}
+
+func TestCheckSPFAndDMARCDiagnostics(t *testing.T) {
+	cases := []struct {
+		name    string
+		txt     map[string][]string
+		spf     string
+		dmarc   string
+		spfOK   bool
+		dmarcOK bool
+	}{
+		{
+			name:  "nothing published",
+			txt:   map[string][]string{},
+			spf:   "TXT record not found at acme.test",
+			dmarc: "TXT record not found at _dmarc.acme.test",
+		},
+		{
+			name: "duplicates",
+			txt: map[string][]string{
+				"acme.test":        {"v=spf1 -all", "v=spf1 include:_spf.nerve.test -all"},
+				"_dmarc.acme.test": {"v=DMARC1; p=reject", "v=DMARC1; p=none"},
+			},
+			spf:   "several SPF records at acme.test; receivers reject all of them",
+			dmarc: "several DMARC records at _dmarc.acme.test; receivers ignore all of them",
+		},
+		{
+			name: "monitoring only",
+			txt: map[string][]string{
+				"acme.test":        {"v=spf1 +include:_spf.nerve.test ~all"},
+				"_dmarc.acme.test": {"v=DMARC1; p=none"},
+			},
+			spf:     "SPF record includes _spf.nerve.test",
+			dmarc:   "DMARC policy is p=none: failures are reported, not enforced",
+			spfOK:   true,
+			dmarcOK: true,
+		},
+		{
+			name: "bad policy",
+			txt: map[string][]string{
+				"acme.test":        {"v=spf1 mx -all"},
+				"_dmarc.acme.test": {"v=DMARC1; p=block"},
+			},
+			spf:   "SPF record does not include _spf.nerve.test",
+			dmarc: "DMARC policy p=block is not one of none, quarantine, reject",
+		},
+	}
+	ctx := context.Background()
+	for _, tc := range cases {
+		v := NewVerifier(fakeResolver{txt: tc.txt})
+		spf := v.checkSPF(ctx, "acme.test", "_spf.nerve.test")
+		dmarc := v.checkDMARC(ctx, "acme.test")
+		if spf.Verified != tc.spfOK || spf.Details != tc.spf {
+			t.Errorf("%s: spf %+v", tc.name, spf)
+		}
+		if dmarc.Verified != tc.dmarcOK || dmarc.Details != tc.dmarc {
+			t.Errorf("%s: dmarc %+v", tc.name, dmarc)
+		}
+	}
+}
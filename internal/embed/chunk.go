@@ -0,0 +1,67 @@
+package embed
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Chunking defaults, in bytes of message text.
+const (
+	DefaultChunkSize    = 2000
+	DefaultChunkOverlap = 200
+)
+
+// Chunk is one piece of a text embedded on its own. Start and End are byte
+// offsets into the text.
+type Chunk struct {
+	Text  string
+	Start int
+	End   int
+}
+
+// Split cuts text into chunks of at most size bytes, each starting overlap
+// bytes (at most half a chunk) before the previous one ended, so a sentence
+// across a cut is whole in one of them. Cuts fall on whitespace in the
+// second half of a chunk where there is any, and never inside a UTF-8
+// sequence. A size of zero or less uses DefaultChunkSize; text that fits
+// yields one chunk.
+func Split(text string, size, overlap int) []Chunk {
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	overlap = min(max(overlap, 0), size/2)
+	var chunks []Chunk
+	start := 0
+	for {
+		end := start + size
+		if end >= len(text) {
+			return append(chunks, Chunk{Text: text[start:], Start: start, End: len(text)})
+		}
+		if end = runeBoundary(text, end); end <= start {
+			_, n := utf8.DecodeRuneInString(text[start:])
+			end = start + n
+		}
+		if half := start + size/2; half < end {
+			if cut := strings.LastIndexAny(text[half:end], " \t\r\n"); cut >= 0 {
+				end = half + cut + 1
+			}
+		}
+		chunks = append(chunks, Chunk{Text: text[start:end], Start: start, End: end})
+		if end == len(text) {
+			return chunks
+		}
+		next := runeBoundary(text, end-overlap)
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+}
+
+// runeBoundary moves i back to the start of the UTF-8 sequence it falls in.
+func runeBoundary(text string, i int) int {
+	for i > 0 && !utf8.RuneStart(text[i]) {
+		i--
+	}
+	return i
+}
@@ -0,0 +1,53 @@
+package embed
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitKeepsShortTextWhole(t *testing.T) {
+	chunks := Split("hello there", 100, 10)
+	if len(chunks) != 1 || chunks[0].Text != "hello there" || chunks[0].Start != 0 || chunks[0].End != 11 {
+		t.Fatalf("expected one chunk covering the text, got %+v", chunks)
+	}
+}
+
+func TestSplitOverlapsAndCutsAtWhitespace(t *testing.T) {
+	text := strings.Repeat("word ", 100)
+	chunks := Split(text, 60, 10)
+	if len(chunks) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(chunks))
+	}
+	for i, c := range chunks {
+		if c.Text != text[c.Start:c.End] || len(c.Text) > 60 {
+			t.Fatalf("chunk %d: offsets or size wrong: %+v", i, c)
+		}
+		if i < len(chunks)-1 && !strings.HasSuffix(c.Text, " ") {
+			t.Fatalf("chunk %d does not end at whitespace: %q", i, c.Text)
+		}
+		if i > 0 && c.Start >= chunks[i-1].End {
+			t.Fatalf("chunk %d does not overlap the previous one", i)
+		}
+	}
+	if chunks[len(chunks)-1].End != len(text) {
+		t.Fatalf("last chunk stops at %d of %d", chunks[len(chunks)-1].End, len(text))
+	}
+}
+
+func TestSplitDoesNotCutRunes(t *testing.T) {
+	text := strings.Repeat("ж", 50)
+	for _, c := range Split(text, 15, 3) {
+		if !strings.HasPrefix(text[c.Start:], "ж") || (c.End < len(text) && !strings.HasPrefix(text[c.End:], "ж")) {
+			t.Fatalf("chunk cut inside a rune: %+v", c)
+		}
+	}
+}
+
+func TestSplitTinySizesStillAdvance(t *testing.T) {
+	for size := 1; size < 8; size++ {
+		chunks := Split("жж a bc ж", size, size)
+		if chunks[len(chunks)-1].End != len("жж a bc ж") {
+			t.Fatalf("size %d: chunks stop short: %+v", size, chunks)
+		}
+	}
+}
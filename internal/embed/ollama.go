@@ -62,7 +62,7 @@ func (o *Ollama) Embed(ctx context.Context, texts []string) ([][]float32, error)
 			defer resp.Body.Close()
 		}
 		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			return nil, errors.New("ollama embedding request failed")
+			return nil, fmt.Errorf("ollama embedding request failed: %s", resp.Status)
 		}
 		var decoded struct {
 			Embedding []float32 `json:"embedding"`
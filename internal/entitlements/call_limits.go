@@ -0,0 +1,76 @@
+package entitlements
+
+import (
+	"context"
+	"log/slog"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/store"
+)
+
+// Rate limit dimensions, reported in RateLimitError.Dimension.
+const (
+	LimitOrg   = "org"
+	LimitToken = "token"
+	LimitIP    = "ip"
+)
+
+// CallLimiter counts calls per key over a sliding minute. *queue.Queue
+// implements it in Redis so every MCP replica shares the counts.
+type CallLimiter interface {
+	AllowCall(ctx context.Context, key string, rpm int) (bool, int, error)
+}
+
+// localCallLimiter counts in this process only; it stands in when Redis is
+// not wired up.
+type localCallLimiter struct {
+	limiter *RateLimiter
+}
+
+func (l localCallLimiter) AllowCall(_ context.Context, key string, rpm int) (bool, int, error) {
+	allowed, retryAfter := l.limiter.Allow(key, rpm)
+	return allowed, retryAfter, nil
+}
+
+type clientIPContextKey struct{}
+
+// WithClientIP records the IP a request came from for the per-IP limit.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPContextKey{}, ip)
+}
+
+func clientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPContextKey{}).(string)
+	return ip
+}
+
+// checkCallLimits holds a single credential or client IP to the plan's
+// token_rpm and ip_rpm, so one runaway agent cannot spend the whole org's
+// mcp_rpm. A limiter that cannot be reached lets the call through; the org
+// limit still applies.
+func (s *Service) checkCallLimits(ctx context.Context, principal auth.Principal, plan store.PlanEntitlement) error {
+	checks := []struct {
+		dimension string
+		id        string
+		rpm       int
+	}{
+		{LimitToken, principal.TokenID, plan.TokenRPM},
+		{LimitIP, clientIPFromContext(ctx), plan.IPRPM},
+	}
+	for _, check := range checks {
+		if check.rpm <= 0 || check.id == "" {
+			continue
+		}
+		key := principal.OrgID + ":" + check.dimension + ":" + check.id
+		allowed, retryAfter, err := s.CallLimiter.AllowCall(ctx, key, check.rpm)
+		if err != nil {
+			slog.WarnContext(ctx, "call limiter unavailable", "dimension", check.dimension, "err", err)
+			continue
+		}
+		if !allowed {
+			s.Observer.RecordDeny(principal.OrgID, "rate_limited_"+check.dimension)
+			return &RateLimitError{RetryAfterSeconds: retryAfter, Dimension: check.dimension}
+		}
+	}
+	return nil
+}
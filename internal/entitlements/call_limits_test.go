@@ -0,0 +1,49 @@
+package entitlements
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/config"
+	"neuralmail/internal/store"
+)
+
+type countingCallLimiter struct {
+	keys []string
+	deny string
+}
+
+func (c *countingCallLimiter) AllowCall(_ context.Context, key string, _ int) (bool, int, error) {
+	c.keys = append(c.keys, key)
+	if key == c.deny {
+		return false, 7, nil
+	}
+	return true, 0, nil
+}
+
+func TestCheckCallLimitsReportsTheLimitedDimension(t *testing.T) {
+	limiter := &countingCallLimiter{deny: "org-1:ip:203.0.113.9"}
+	svc := NewService(config.Default(), nil, nil)
+	svc.CallLimiter = limiter
+	ctx := WithClientIP(context.Background(), "203.0.113.9")
+	principal := auth.Principal{OrgID: "org-1", TokenID: "tok-1"}
+
+	err := svc.checkCallLimits(ctx, principal, store.PlanEntitlement{TokenRPM: 10, IPRPM: 10})
+	var rateErr *RateLimitError
+	if !errors.As(err, &rateErr) || rateErr.Dimension != LimitIP || rateErr.RetryAfterSeconds != 7 {
+		t.Fatalf("expected ip rate limit, got %v", err)
+	}
+	if len(limiter.keys) != 2 || limiter.keys[0] != "org-1:token:tok-1" {
+		t.Fatalf("expected token then ip to be counted, got %v", limiter.keys)
+	}
+
+	limiter.keys = nil
+	if err := svc.checkCallLimits(ctx, principal, store.PlanEntitlement{}); err != nil {
+		t.Fatalf("expected unlimited plan to pass, got %v", err)
+	}
+	if len(limiter.keys) != 0 {
+		t.Fatalf("expected no counting without limits, got %v", limiter.keys)
+	}
+}
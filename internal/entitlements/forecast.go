@@ -0,0 +1,151 @@
+package entitlements
+
+import (
+	"math"
+	"time"
+
+	"neuralmail/internal/store"
+)
+
+const oneDay = 24 * time.Hour
+
+// ForecastInput is everything ForecastUsage needs; callers load it from the
+// org's entitlement, usage counter and recent usage events.
+type ForecastInput struct {
+	Now          time.Time
+	PeriodStart  time.Time
+	PeriodEnd    time.Time
+	MonthlyUnits int64
+	// Used is the counter for PeriodStart. If the period has already ended it
+	// is treated as zero, matching the rollover PreAuthorizeTool performs.
+	Used         int64
+	History      []store.DailyUsage
+	LookbackDays int
+	// ScenarioDailyCalls, when positive, adds a projection at that many tool
+	// calls per day priced at the trailing average units per call.
+	ScenarioDailyCalls float64
+	Plans              []store.PlanEntitlement
+	CurrentPlan        string
+}
+
+// Projection is the outcome of consuming units at a constant daily rate for
+// the rest of the period.
+type Projection struct {
+	DailyCalls          float64    `json:"daily_calls,omitempty"`
+	DailyUnits          float64    `json:"daily_units"`
+	ProjectedUnits      int64      `json:"projected_period_units"`
+	WillExhaust         bool       `json:"will_exhaust"`
+	ExhaustsAt          *time.Time `json:"exhausts_at,omitempty"`
+	DaysUntilExhaustion *float64   `json:"days_until_exhaustion,omitempty"`
+}
+
+type Forecast struct {
+	PeriodStart     time.Time   `json:"period_start"`
+	PeriodEnd       time.Time   `json:"period_end"`
+	MonthlyUnits    int64       `json:"monthly_units"`
+	Used            int64       `json:"used"`
+	Remaining       int64       `json:"remaining"`
+	TrailingDays    float64     `json:"trailing_days"`
+	TrailingUnits   int64       `json:"trailing_units"`
+	TrailingCalls   int64       `json:"trailing_calls"`
+	UnitsPerCall    float64     `json:"units_per_call"`
+	Trailing        Projection  `json:"trailing"`
+	Scenario        *Projection `json:"scenario,omitempty"`
+	RecommendedPlan string      `json:"recommended_plan,omitempty"`
+}
+
+// ForecastUsage projects when the org's monthly units run out, first at the
+// trailing daily rate and optionally at a caller-supplied call volume. The
+// trailing rate is averaged over the lookback window, shortened to the first
+// day with usage so a new org is not diluted by days before it existed. A
+// window that starts mid-day counts only the share of that day inside it.
+func ForecastUsage(in ForecastInput) Forecast {
+	now := in.Now.UTC()
+	start, end, used := in.PeriodStart, in.PeriodEnd, in.Used
+	if now.After(end) {
+		start, end = rolloverWindow(start, end, now)
+		used = 0
+	}
+
+	out := Forecast{
+		PeriodStart:  start,
+		PeriodEnd:    end,
+		MonthlyUnits: in.MonthlyUnits,
+		Used:         used,
+		Remaining:    max(in.MonthlyUnits-used, 0),
+		UnitsPerCall: 1,
+	}
+
+	lookback := time.Duration(max(in.LookbackDays, 1)) * oneDay
+	windowStart := now.Add(-lookback)
+	counted := false
+	var units, calls float64
+	for _, sample := range in.History {
+		if sample.Day.Before(windowStart.Truncate(oneDay)) {
+			continue
+		}
+		if !counted && sample.Day.After(windowStart) {
+			windowStart = sample.Day
+		}
+		counted = true
+		// A window starting partway through a day holds only that part of
+		// the day's usage, assumed spread evenly over it.
+		share := 1.0
+		if sample.Day.Before(windowStart) {
+			share = sample.Day.Add(oneDay).Sub(windowStart).Hours() / 24
+		}
+		units += share * float64(sample.Units)
+		calls += share * float64(sample.Calls)
+	}
+	out.TrailingDays = math.Max(now.Sub(windowStart).Hours()/24, 1)
+	out.TrailingUnits = int64(math.Round(units))
+	out.TrailingCalls = int64(math.Round(calls))
+	if calls > 0 {
+		out.UnitsPerCall = units / calls
+	}
+
+	out.Trailing = project(now, end, in.MonthlyUnits, used, units/out.TrailingDays)
+	peak := out.Trailing.ProjectedUnits
+	if in.ScenarioDailyCalls > 0 {
+		scenario := project(now, end, in.MonthlyUnits, used, in.ScenarioDailyCalls*out.UnitsPerCall)
+		scenario.DailyCalls = in.ScenarioDailyCalls
+		out.Scenario = &scenario
+		peak = max(peak, scenario.ProjectedUnits)
+	}
+	if peak > in.MonthlyUnits {
+		out.RecommendedPlan = recommendPlan(in.Plans, in.CurrentPlan, peak)
+	}
+	return out
+}
+
+func project(now, periodEnd time.Time, monthlyUnits, used int64, dailyUnits float64) Projection {
+	p := Projection{DailyUnits: dailyUnits}
+	remainingDays := math.Max(periodEnd.Sub(now).Hours()/24, 0)
+	p.ProjectedUnits = used + int64(math.Ceil(dailyUnits*remainingDays))
+
+	remaining := monthlyUnits - used
+	switch {
+	case remaining <= 0:
+		zero := 0.0
+		at := now
+		p.WillExhaust, p.ExhaustsAt, p.DaysUntilExhaustion = true, &at, &zero
+	case dailyUnits > 0:
+		days := float64(remaining) / dailyUnits
+		if days < remainingDays {
+			at := now.Add(time.Duration(days * float64(oneDay)))
+			p.WillExhaust, p.ExhaustsAt, p.DaysUntilExhaustion = true, &at, &days
+		}
+	}
+	return p
+}
+
+// recommendPlan picks the smallest plan other than the current one that
+// covers the projected units. plans must be sorted by monthly units.
+func recommendPlan(plans []store.PlanEntitlement, current string, units int64) string {
+	for _, plan := range plans {
+		if plan.PlanCode != current && plan.MonthlyUnits >= units {
+			return plan.PlanCode
+		}
+	}
+	return ""
+}
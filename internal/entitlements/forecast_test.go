@@ -0,0 +1,128 @@
+package entitlements
+
+import (
+	"testing"
+	"time"
+
+	"neuralmail/internal/store"
+)
+
+func TestForecastUsageTrailingRate(t *testing.T) {
+	now := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	var history []store.DailyUsage
+	for d := 7; d >= 1; d-- {
+		history = append(history, store.DailyUsage{Day: now.AddDate(0, 0, -d), Units: 200, Calls: 100})
+	}
+
+	forecast := ForecastUsage(ForecastInput{
+		Now:          now,
+		PeriodStart:  time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		PeriodEnd:    time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC),
+		MonthlyUnits: 5000,
+		Used:         1800,
+		History:      history,
+		LookbackDays: 7,
+		Plans: []store.PlanEntitlement{
+			{PlanCode: "starter", MonthlyUnits: 5000},
+			{PlanCode: "growth", MonthlyUnits: 50000},
+		},
+		CurrentPlan: "starter",
+	})
+
+	if forecast.Trailing.DailyUnits != 200 || forecast.UnitsPerCall != 2 {
+		t.Fatalf("unexpected rate: daily=%v per_call=%v", forecast.Trailing.DailyUnits, forecast.UnitsPerCall)
+	}
+	if !forecast.Trailing.WillExhaust || forecast.Trailing.ExhaustsAt == nil {
+		t.Fatalf("expected exhaustion before period end")
+	}
+	if want := now.AddDate(0, 0, 16); !forecast.Trailing.ExhaustsAt.Equal(want) {
+		t.Fatalf("expected exhaustion at %s, got %s", want, forecast.Trailing.ExhaustsAt)
+	}
+	if forecast.Trailing.ProjectedUnits != 1800+21*200 {
+		t.Fatalf("unexpected projected units %d", forecast.Trailing.ProjectedUnits)
+	}
+	if forecast.RecommendedPlan != "growth" {
+		t.Fatalf("expected growth recommendation, got %q", forecast.RecommendedPlan)
+	}
+}
+
+func TestForecastUsageScenarioAndShortHistory(t *testing.T) {
+	now := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	forecast := ForecastUsage(ForecastInput{
+		Now:          now,
+		PeriodStart:  time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		PeriodEnd:    time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC),
+		MonthlyUnits: 100000,
+		Used:         20,
+		// Only two days of history: the rate must not be diluted to 7 days.
+		History: []store.DailyUsage{
+			{Day: now.AddDate(0, 0, -2), Units: 10, Calls: 10},
+			{Day: now.AddDate(0, 0, -1), Units: 10, Calls: 10},
+		},
+		LookbackDays:       7,
+		ScenarioDailyCalls: 10000,
+	})
+
+	if forecast.TrailingDays != 2 || forecast.Trailing.DailyUnits != 10 {
+		t.Fatalf("expected 10 units/day over 2 days, got %v over %v", forecast.Trailing.DailyUnits, forecast.TrailingDays)
+	}
+	if forecast.Trailing.WillExhaust {
+		t.Fatalf("trailing rate should not exhaust")
+	}
+	if forecast.Scenario == nil || !forecast.Scenario.WillExhaust || forecast.Scenario.DailyCalls != 10000 {
+		t.Fatalf("expected scenario to exhaust, got %+v", forecast.Scenario)
+	}
+	if forecast.RecommendedPlan != "" {
+		t.Fatalf("expected no recommendation without plans, got %q", forecast.RecommendedPlan)
+	}
+}
+
+func TestForecastUsageRollsOverEndedPeriod(t *testing.T) {
+	now := time.Date(2026, 4, 2, 0, 0, 0, 0, time.UTC)
+	forecast := ForecastUsage(ForecastInput{
+		Now:          now,
+		PeriodStart:  time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		PeriodEnd:    time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC),
+		MonthlyUnits: 100,
+		Used:         100,
+		LookbackDays: 7,
+	})
+	if forecast.Used != 0 || forecast.Remaining != 100 || !forecast.PeriodEnd.After(now) {
+		t.Fatalf("expected fresh period, got %+v", forecast)
+	}
+	if forecast.Trailing.WillExhaust {
+		t.Fatalf("no usage should not exhaust")
+	}
+}
+
+func TestForecastUsageCountsAPartialFirstDayByItsShare(t *testing.T) {
+	// Mid-day: the 7-day window opens at 18:00 on March 3rd, so only a
+	// quarter of that day's usage falls inside it.
+	now := time.Date(2026, 3, 10, 18, 0, 0, 0, time.UTC)
+	var history []store.DailyUsage
+	for d := 3; d <= 10; d++ {
+		history = append(history, store.DailyUsage{Day: time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC), Units: 240, Calls: 120})
+	}
+	// The last day is three quarters over.
+	history[len(history)-1].Units, history[len(history)-1].Calls = 180, 90
+
+	forecast := ForecastUsage(ForecastInput{
+		Now:          now,
+		PeriodStart:  time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		PeriodEnd:    time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC),
+		MonthlyUnits: 100000,
+		Used:         2000,
+		History:      history,
+		LookbackDays: 7,
+	})
+
+	if forecast.TrailingDays != 7 || forecast.TrailingUnits != 60+6*240+180 || forecast.TrailingCalls != 30+6*120+90 {
+		t.Fatalf("expected 1680 units over 7 days, got %d over %v", forecast.TrailingUnits, forecast.TrailingDays)
+	}
+	if forecast.Trailing.DailyUnits != 240 || forecast.UnitsPerCall != 2 {
+		t.Fatalf("expected 240 units a day at 2 per call, got %v at %v", forecast.Trailing.DailyUnits, forecast.UnitsPerCall)
+	}
+	if want := int64(2000 + 240*20.25); forecast.Trailing.ProjectedUnits != want {
+		t.Fatalf("expected %d projected units, got %d", want, forecast.Trailing.ProjectedUnits)
+	}
+}
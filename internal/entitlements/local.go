@@ -0,0 +1,103 @@
+package entitlements
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/store"
+)
+
+var ErrLocalLimitExceeded = errors.New("local limit exceeded")
+
+// unlimitedLocalUnits stands in for a zero monthly_units setting so the
+// counter still records usage without ever rejecting a reservation.
+const unlimitedLocalUnits = int64(1) << 62
+
+// LocalLimitError reports which configured self-hosted limit was hit.
+type LocalLimitError struct {
+	Limit             string
+	Configured        int64
+	RetryAfterSeconds int
+}
+
+func (e *LocalLimitError) Error() string {
+	return "local limit exceeded: " + e.Limit
+}
+
+func (e *LocalLimitError) Unwrap() error {
+	return ErrLocalLimitExceeded
+}
+
+// LocalModeEnabled reports whether limits come from config rather than the
+// billing-backed org_entitlements table. Cloud mode always wins.
+func (s *Service) LocalModeEnabled() bool {
+	return s != nil && !s.Config.Cloud.Mode && s.Config.Entitlements.LocalMode
+}
+
+func (s *Service) preAuthorizeLocal(ctx context.Context, principal auth.Principal, toolName string) (*Reservation, error) {
+	orgID := principal.OrgID
+	if orgID == "" {
+		defaultOrgID, err := s.Store.EnsureDefaultOrg(ctx)
+		if err != nil {
+			return nil, err
+		}
+		orgID = defaultOrgID
+	}
+
+	limits := s.Config.Entitlements
+	if limits.MCPRPM > 0 {
+		allowed, retryAfter := s.RateLimiter.Allow(orgID, limits.MCPRPM)
+		if !allowed {
+			s.Observer.RecordDeny(orgID, "local_limit_exceeded")
+			return nil, &LocalLimitError{Limit: "mcp_rpm", Configured: int64(limits.MCPRPM), RetryAfterSeconds: retryAfter}
+		}
+	}
+
+	cost := s.toolCost(toolName)
+	start, end := calendarMonth(s.Now())
+	capUnits := limits.MonthlyUnits
+	if capUnits <= 0 {
+		capUnits = unlimitedLocalUnits
+	}
+
+	var reservation *Reservation
+	err := s.Store.RunAsOrg(ctx, orgID, func(scoped *store.Store) error {
+		if err := scoped.EnsureOrgUsageCounter(ctx, orgID, meterMCPUnits, start, end); err != nil {
+			return err
+		}
+		reserved, usedAfter, err := scoped.ReserveOrgUsageUnits(ctx, orgID, meterMCPUnits, start, cost, capUnits)
+		if err != nil {
+			return err
+		}
+		if !reserved {
+			s.Observer.RecordDeny(orgID, "local_limit_exceeded")
+			return &LocalLimitError{Limit: "monthly_units", Configured: limits.MonthlyUnits}
+		}
+		s.Observer.RecordAllow(orgID, "authorized_local", usedAfter, limits.MonthlyUnits)
+		reservation = &Reservation{
+			OrgID:        orgID,
+			MeterName:    meterMCPUnits,
+			PeriodStart:  start,
+			PeriodEnd:    end,
+			Quantity:     cost,
+			MonthlyUnits: limits.MonthlyUnits,
+			UsedAfter:    usedAfter,
+			Subscription: "local",
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reservation, nil
+}
+
+// calendarMonth returns the UTC month containing now. Local mode has no
+// subscription period to anchor on, so usage resets on the first of the month.
+func calendarMonth(now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
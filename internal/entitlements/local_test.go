@@ -0,0 +1,38 @@
+package entitlements
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"neuralmail/internal/config"
+)
+
+func TestCalendarMonth(t *testing.T) {
+	start, end := calendarMonth(time.Date(2026, 12, 31, 23, 59, 0, 0, time.UTC))
+	if !start.Equal(time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected period start: %s", start)
+	}
+	if !end.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected period end: %s", end)
+	}
+}
+
+func TestLocalModeEnabledIgnoredInCloudMode(t *testing.T) {
+	cfg := config.Default()
+	cfg.Entitlements.LocalMode = true
+	if !(&Service{Config: cfg}).LocalModeEnabled() {
+		t.Fatalf("expected local mode enabled for self-hosted config")
+	}
+	cfg.Cloud.Mode = true
+	if (&Service{Config: cfg}).LocalModeEnabled() {
+		t.Fatalf("expected cloud mode to disable local entitlements")
+	}
+}
+
+func TestLocalLimitErrorUnwraps(t *testing.T) {
+	var err error = &LocalLimitError{Limit: "mcp_rpm", Configured: 60, RetryAfterSeconds: 2}
+	if !errors.Is(err, ErrLocalLimitExceeded) {
+		t.Fatalf("expected LocalLimitError to match ErrLocalLimitExceeded")
+	}
+}
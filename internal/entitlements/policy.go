@@ -10,10 +10,24 @@ import (
 
 var ErrSubscriptionInactive = errors.New("subscription inactive")
 
+// ErrTrialExpired is returned for an org whose trial has ended without a
+// subscription, so clients can ask the user to upgrade rather than report a
+// billing problem.
+var ErrTrialExpired = errors.New("trial expired")
+
 func ValidateSubscriptionAccess(now time.Time, ent store.OrgEntitlement) error {
 	switch strings.ToLower(strings.TrimSpace(ent.SubscriptionStatus)) {
-	case "trialing", "active":
+	case "trialing":
+		// Reconciliation expires trials in batches; until it runs, the end
+		// date still applies.
+		if ent.TrialEndsAt.Valid && now.After(ent.TrialEndsAt.Time) {
+			return ErrTrialExpired
+		}
+		return nil
+	case "active":
 		return nil
+	case "trial_expired":
+		return ErrTrialExpired
 	case "past_due":
 		if ent.GraceUntil.Valid && !now.After(ent.GraceUntil.Time) {
 			return nil
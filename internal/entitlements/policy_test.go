@@ -2,6 +2,7 @@ package entitlements
 
 import (
 	"database/sql"
+	"errors"
 	"testing"
 	"time"
 
@@ -16,16 +17,20 @@ func TestValidateSubscriptionAccess(t *testing.T) {
 		status    string
 		grace     sql.NullTime
 		periodEnd time.Time
-		wantErr   bool
+		trialEnds sql.NullTime
+		wantErr   error
 	}{
-		{name: "trialing allowed", status: "trialing", wantErr: false},
-		{name: "active allowed", status: "active", wantErr: false},
-		{name: "past_due in grace allowed", status: "past_due", grace: sql.NullTime{Time: now.Add(24 * time.Hour), Valid: true}, wantErr: false},
-		{name: "past_due out of grace denied", status: "past_due", grace: sql.NullTime{Time: now.Add(-24 * time.Hour), Valid: true}, wantErr: true},
-		{name: "canceled before period end allowed", status: "canceled", periodEnd: now.Add(24 * time.Hour), wantErr: false},
-		{name: "canceled after period end denied", status: "canceled", periodEnd: now.Add(-24 * time.Hour), wantErr: true},
-		{name: "unpaid denied", status: "unpaid", wantErr: true},
-		{name: "unknown denied", status: "unknown", wantErr: true},
+		{name: "trialing allowed", status: "trialing", wantErr: nil},
+		{name: "trialing before trial end allowed", status: "trialing", trialEnds: sql.NullTime{Time: now.Add(24 * time.Hour), Valid: true}, wantErr: nil},
+		{name: "trialing after trial end denied", status: "trialing", trialEnds: sql.NullTime{Time: now.Add(-time.Minute), Valid: true}, wantErr: ErrTrialExpired},
+		{name: "trial_expired denied", status: "trial_expired", wantErr: ErrTrialExpired},
+		{name: "active allowed", status: "active", wantErr: nil},
+		{name: "past_due in grace allowed", status: "past_due", grace: sql.NullTime{Time: now.Add(24 * time.Hour), Valid: true}, wantErr: nil},
+		{name: "past_due out of grace denied", status: "past_due", grace: sql.NullTime{Time: now.Add(-24 * time.Hour), Valid: true}, wantErr: ErrSubscriptionInactive},
+		{name: "canceled before period end allowed", status: "canceled", periodEnd: now.Add(24 * time.Hour), wantErr: nil},
+		{name: "canceled after period end denied", status: "canceled", periodEnd: now.Add(-24 * time.Hour), wantErr: ErrSubscriptionInactive},
+		{name: "unpaid denied", status: "unpaid", wantErr: ErrSubscriptionInactive},
+		{name: "unknown denied", status: "unknown", wantErr: ErrSubscriptionInactive},
 	}
 
 	for _, tc := range tests {
@@ -35,13 +40,10 @@ func TestValidateSubscriptionAccess(t *testing.T) {
 				SubscriptionStatus: tc.status,
 				GraceUntil:         tc.grace,
 				UsagePeriodEnd:     tc.periodEnd,
+				TrialEndsAt:        tc.trialEnds,
 			}
-			err := ValidateSubscriptionAccess(now, ent)
-			if tc.wantErr && err == nil {
-				t.Fatalf("expected error for status %s", tc.status)
-			}
-			if !tc.wantErr && err != nil {
-				t.Fatalf("did not expect error for status %s: %v", tc.status, err)
+			if err := ValidateSubscriptionAccess(now, ent); !errors.Is(err, tc.wantErr) {
+				t.Fatalf("status %s: got %v, want %v", tc.status, err, tc.wantErr)
 			}
 		})
 	}
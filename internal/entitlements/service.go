@@ -21,6 +21,8 @@ var ErrQuotaExceeded = errors.New("quota exceeded")
 
 type RateLimitError struct {
 	RetryAfterSeconds int
+	// Dimension is what was limited: LimitOrg, LimitToken or LimitIP.
+	Dimension string
 }
 
 func (e *RateLimitError) Error() string {
@@ -36,6 +38,13 @@ type Reservation struct {
 	MonthlyUnits int64
 	UsedAfter    int64
 	Subscription string
+	// Extra is work the tool reported beyond its base cost, such as search
+	// re-ranking. It is only known after the call, so it is charged on
+	// success without checking the quota, which the next call enforces.
+	Extra int64
+	// Cached marks a call the tool answered from the model response cache;
+	// it is charged the cached unit cost instead of Quantity.
+	Cached bool
 }
 
 type Service struct {
@@ -43,23 +52,28 @@ type Service struct {
 	Store  *store.Store
 
 	RateLimiter *RateLimiter
+	// CallLimiter enforces the plan's per-token and per-IP limits.
+	CallLimiter CallLimiter
 	Observer    *observability.EntitlementObserver
 	Now         func() time.Time
 
 	defaultCost int64
 	toolCosts   map[string]int64
+	cachedCost  int64
 }
 
 func NewService(cfg config.Config, st *store.Store, observer *observability.EntitlementObserver) *Service {
-	defaultCost, toolCosts := loadToolCosts(cfg.Metering.ToolCostPath)
+	costs := loadToolCosts(cfg.Metering.ToolCostPath)
 	return &Service{
 		Config:      cfg,
 		Store:       st,
 		RateLimiter: NewRateLimiter(),
+		CallLimiter: localCallLimiter{NewRateLimiter()},
 		Observer:    observer,
 		Now:         func() time.Time { return time.Now().UTC() },
-		defaultCost: defaultCost,
-		toolCosts:   toolCosts,
+		defaultCost: costs.DefaultUnitCost,
+		toolCosts:   costs.Tools,
+		cachedCost:  costs.CachedUnitCost,
 	}
 }
 
@@ -67,11 +81,13 @@ func (s *Service) PreAuthorizeTool(ctx context.Context, principal auth.Principal
 	if s == nil || s.Store == nil {
 		return nil, ErrSubscriptionInactive
 	}
+	if s.LocalModeEnabled() {
+		return s.preAuthorizeLocal(ctx, principal, toolName)
+	}
 	if principal.OrgID == "" {
 		return nil, ErrSubscriptionInactive
 	}
 
-	cost := s.toolCost(toolName)
 	now := s.Now()
 	var reservation *Reservation
 
@@ -99,12 +115,25 @@ func (s *Service) PreAuthorizeTool(ctx context.Context, principal auth.Principal
 			return err
 		}
 
+		plan, err := scoped.GetPlanEntitlement(ctx, ent.PlanCode)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if err := s.checkCallLimits(ctx, principal, plan); err != nil {
+			return err
+		}
 		allowed, retryAfter := s.RateLimiter.Allow(principal.OrgID, ent.MCPRPM)
 		if !allowed {
 			s.Observer.RecordDeny(principal.OrgID, "rate_limited")
-			return &RateLimitError{RetryAfterSeconds: retryAfter}
+			return &RateLimitError{RetryAfterSeconds: retryAfter, Dimension: LimitOrg}
 		}
 
+		planWeights, err := scoped.GetPlanToolWeights(ctx, ent.PlanCode)
+		if err != nil {
+			return err
+		}
+		cost := s.toolWeight(toolName, planWeights)
+
 		if err := scoped.EnsureOrgUsageCounter(ctx, principal.OrgID, meterMCPUnits, ent.UsagePeriodStart, ent.UsagePeriodEnd); err != nil {
 			return err
 		}
@@ -156,10 +185,44 @@ func (s *Service) FinalizeToolExecution(ctx context.Context, reservation Reserva
 			}
 			s.Observer.RecordDeny(reservation.OrgID, "tool_execution_failed")
 		}
-		return scoped.RecordUsageEvent(ctx, reservation.OrgID, reservation.MeterName, reservation.Quantity, toolName, replayID, auditID, normalizedStatus)
+		quantity := reservation.Quantity
+		cached := normalizedStatus == "success" && reservation.Cached
+		if cached {
+			if refund := reservation.Quantity - s.cachedUnits(reservation.Quantity); refund > 0 {
+				if err := scoped.ReleaseOrgUsageUnits(ctx, reservation.OrgID, reservation.MeterName, reservation.PeriodStart, refund); err != nil {
+					return err
+				}
+				quantity -= refund
+			}
+		}
+		if normalizedStatus == "success" && reservation.Extra > 0 {
+			if err := scoped.AddOrgUsageUnits(ctx, reservation.OrgID, reservation.MeterName, reservation.PeriodStart, reservation.Extra); err != nil {
+				return err
+			}
+			quantity += reservation.Extra
+		}
+		return scoped.RecordUsageEvent(ctx, reservation.OrgID, reservation.MeterName, quantity, reservation.Quantity, toolName, replayID, auditID, normalizedStatus, cached)
 	})
 }
 
+// cachedUnits is what a call answered from the response cache costs: the
+// configured cached_unit_cost, never more than the tool's own weight.
+func (s *Service) cachedUnits(weight int64) int64 {
+	if s.cachedCost < weight {
+		return s.cachedCost
+	}
+	return weight
+}
+
+// toolWeight is how many mcp_units a call to toolName reserves: the plan's
+// override if it has one, else the configured weight, else the default.
+func (s *Service) toolWeight(toolName string, planWeights map[string]int64) int64 {
+	if weight, ok := planWeights[toolName]; ok && weight > 0 {
+		return weight
+	}
+	return s.toolCost(toolName)
+}
+
 func (s *Service) toolCost(toolName string) int64 {
 	if cost, ok := s.toolCosts[toolName]; ok && cost > 0 {
 		return cost
@@ -187,30 +250,35 @@ func rolloverWindow(periodStart, periodEnd, now time.Time) (time.Time, time.Time
 type toolCostConfig struct {
 	DefaultUnitCost int64            `yaml:"default_unit_cost"`
 	Tools           map[string]int64 `yaml:"tools"`
+	// CachedUnitCost is charged instead of a tool's weight when the tool
+	// answers from the model response cache.
+	CachedUnitCost int64 `yaml:"cached_unit_cost"`
 }
 
-func loadToolCosts(path string) (int64, map[string]int64) {
-	defaultCost := int64(1)
-	costs := map[string]int64{}
+func loadToolCosts(path string) toolCostConfig {
+	costs := toolCostConfig{DefaultUnitCost: 1, Tools: map[string]int64{}, CachedUnitCost: 1}
 
 	if path == "" {
-		return defaultCost, costs
+		return costs
 	}
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return defaultCost, costs
+		return costs
 	}
 	var cfg toolCostConfig
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return defaultCost, costs
+		return costs
 	}
 	if cfg.DefaultUnitCost > 0 {
-		defaultCost = cfg.DefaultUnitCost
+		costs.DefaultUnitCost = cfg.DefaultUnitCost
+	}
+	if cfg.CachedUnitCost > 0 {
+		costs.CachedUnitCost = cfg.CachedUnitCost
 	}
 	for tool, value := range cfg.Tools {
 		if value > 0 {
-			costs[tool] = value
+			costs.Tools[tool] = value
 		}
 	}
-	return defaultCost, costs
+	return costs
 }
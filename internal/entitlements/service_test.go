@@ -130,6 +130,47 @@ func TestPreAuthorizeToolRollsUsagePeriodForward(t *testing.T) {
 	})
 }
 
+func TestPreAuthorizeToolUsesPlanToolWeights(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		orgID := uuid.NewString()
+		now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+		periodStart := now.Add(-24 * time.Hour)
+		insertEntitlementFixture(t, ctx, st, orgID, periodStart, periodStart.Add(30*24*time.Hour), 100, 100000)
+		if _, err := st.DB().ExecContext(ctx, `
+			INSERT INTO plan_entitlements (plan_code, mcp_rpm, monthly_units, max_inboxes, tool_weights)
+			VALUES ('pro', 100000, 100, 10, '{"send_reply": 10}')
+		`); err != nil {
+			t.Fatalf("insert plan: %v", err)
+		}
+
+		svc := NewService(config.Default(), st, nil)
+		svc.Now = func() time.Time { return now }
+
+		reservation, err := svc.PreAuthorizeTool(ctx, auth.Principal{OrgID: orgID}, "send_reply", "")
+		if err != nil {
+			t.Fatalf("pre-authorize send_reply: %v", err)
+		}
+		if reservation.Quantity != 10 {
+			t.Fatalf("expected plan weight 10, got %d", reservation.Quantity)
+		}
+		reservation.Extra = 2
+		if err := svc.FinalizeToolExecution(ctx, *reservation, "send_reply", "", "", "success"); err != nil {
+			t.Fatalf("finalize: %v", err)
+		}
+		var quantity, weight int64
+		if err := st.DB().QueryRowContext(ctx, `SELECT quantity, weight FROM usage_events WHERE org_id = $1`, orgID).Scan(&quantity, &weight); err != nil {
+			t.Fatalf("query usage event: %v", err)
+		}
+		if quantity != 12 || weight != 10 {
+			t.Fatalf("expected quantity 12 weight 10, got %d %d", quantity, weight)
+		}
+
+		if reservation, err := svc.PreAuthorizeTool(ctx, auth.Principal{OrgID: orgID}, "list_threads", ""); err != nil || reservation.Quantity != 1 {
+			t.Fatalf("expected default weight for unlisted tool, got %+v %v", reservation, err)
+		}
+	})
+}
+
 func insertEntitlementFixture(t *testing.T, ctx context.Context, st *store.Store, orgID string, periodStart, periodEnd time.Time, monthlyUnits int64, mcpRPM int) {
 	t.Helper()
 	if _, err := st.DB().ExecContext(ctx, `INSERT INTO orgs (id, name) VALUES ($1, $2)`, orgID, "entitlements-test"); err != nil {
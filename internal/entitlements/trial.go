@@ -0,0 +1,43 @@
+package entitlements
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"neuralmail/internal/store"
+)
+
+// TrialPlan is the plan_code new orgs start on when trials are enabled.
+const TrialPlan = "trial"
+
+// StartTrial puts orgID on the trial plan's limits until days from now.
+// Reconciliation moves it to trial_expired after that unless a subscription
+// has replaced it.
+func StartTrial(ctx context.Context, st *store.Store, orgID string, now time.Time, days int) (store.OrgEntitlement, error) {
+	plan, err := st.GetPlanEntitlement(ctx, TrialPlan)
+	if err != nil {
+		return store.OrgEntitlement{}, err
+	}
+	periodStart := now.UTC().Truncate(time.Second)
+	periodEnd := periodStart.Add(30 * 24 * time.Hour)
+	ent := store.OrgEntitlement{
+		OrgID:              orgID,
+		PlanCode:           plan.PlanCode,
+		SubscriptionStatus: "trialing",
+		MCPRPM:             plan.MCPRPM,
+		MonthlyUnits:       plan.MonthlyUnits,
+		MaxInboxes:         plan.MaxInboxes,
+		MaxDomains:         plan.MaxDomains,
+		UsagePeriodStart:   periodStart,
+		UsagePeriodEnd:     periodEnd,
+		TrialEndsAt:        sql.NullTime{Time: periodStart.AddDate(0, 0, days), Valid: true},
+	}
+	if err := st.UpsertOrgEntitlement(ctx, ent); err != nil {
+		return store.OrgEntitlement{}, err
+	}
+	if err := st.EnsureOrgUsageCounter(ctx, orgID, meterMCPUnits, periodStart, periodEnd); err != nil {
+		return store.OrgEntitlement{}, err
+	}
+	return ent, nil
+}
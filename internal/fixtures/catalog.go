@@ -0,0 +1,101 @@
+package fixtures
+
+import (
+	"fmt"
+	"sort"
+)
+
+type person struct {
+	name  string
+	local string
+}
+
+type intentText struct {
+	subject  string
+	opening  string
+	reply    string
+	followUp string
+}
+
+type language struct {
+	people  []person
+	intents map[string]intentText
+}
+
+var customerDomains = []string{"example.com", "example.org", "example.net"}
+
+// catalog holds the demo copy per language. English comes first in Languages
+// so the default seed keeps the original outage, refund, invoice, spam and
+// plan-change scenarios.
+var catalog = map[string]language{
+	"en": {
+		people: []person{{"Alice Walker", "alice.walker"}, {"Ben Carter", "ben.carter"}, {"Priya Shah", "priya.shah"}, {"Tom O'Neill", "tom.oneill"}},
+		intents: map[string]intentText{
+			IntentOutage:     {"Critical server outage", "Our production system is down. Please fix ASAP.", "We are investigating the outage and will update you within the hour.", "Still down on our side, every request returns 502. Any news?"},
+			IntentRefund:     {"Angry refund request", "I want a refund now. This is unacceptable.", "Sorry for the trouble. Could you share your order number so we can process the refund?", "The order number is in the attached receipt. I expect the money back this week."},
+			IntentInvoice:    {"Invoice request", "Please send our latest invoice for February.", "The February invoice is attached. Let us know if you need a different billing address.", "Thanks. Could you also resend January? Finance cannot find it."},
+			IntentSpam:       {"Spam offer", "You won a prize, click here.", "", ""},
+			IntentPlanChange: {"General question", "Can you help me change my plan?", "Of course. Which plan would you like to move to, and from which date?", "The Team plan, starting next month please."},
+		},
+	},
+	"es": {
+		people: []person{{"José García", "jose.garcia"}, {"Lucía Fernández", "lucia.fernandez"}, {"Diego Torres", "diego.torres"}},
+		intents: map[string]intentText{
+			IntentOutage:     {"Caída crítica del servidor", "Nuestro sistema de producción está caído. Por favor, arréglenlo cuanto antes.", "Estamos investigando la incidencia y les informaremos en menos de una hora.", "Sigue caído, todas las peticiones devuelven 502. ¿Alguna novedad?"},
+			IntentRefund:     {"Solicitud de reembolso", "Quiero un reembolso ya. Esto es inaceptable.", "Lamentamos las molestias. ¿Nos puede indicar el número de pedido para tramitar el reembolso?", "El número de pedido está en el recibo adjunto. Espero el dinero esta semana."},
+			IntentInvoice:    {"Solicitud de factura", "Por favor, envíennos la última factura de febrero.", "Adjuntamos la factura de febrero. Avísenos si necesita otra dirección de facturación.", "Gracias. ¿Podrían reenviar también la de enero? Contabilidad no la encuentra."},
+			IntentSpam:       {"¡Has ganado un premio!", "Has ganado un premio, haz clic aquí.", "", ""},
+			IntentPlanChange: {"Consulta general", "¿Me pueden ayudar a cambiar de plan?", "Por supuesto. ¿A qué plan quiere cambiar y desde qué fecha?", "Al plan Team, a partir del mes que viene."},
+		},
+	},
+	"de": {
+		people: []person{{"Jürgen Müller", "juergen.mueller"}, {"Anna Schröder", "anna.schroeder"}, {"Lukas Becker", "lukas.becker"}},
+		intents: map[string]intentText{
+			IntentOutage:     {"Kritischer Serverausfall", "Unser Produktivsystem ist ausgefallen. Bitte beheben Sie das umgehend.", "Wir untersuchen den Ausfall und melden uns innerhalb einer Stunde.", "Bei uns ist es immer noch down, jede Anfrage liefert 502. Gibt es Neuigkeiten?"},
+			IntentRefund:     {"Rückerstattung verlangt", "Ich möchte sofort eine Rückerstattung. Das ist inakzeptabel.", "Das tut uns leid. Können Sie uns die Bestellnummer nennen, damit wir die Erstattung bearbeiten?", "Die Bestellnummer steht auf dem angehängten Beleg. Ich erwarte das Geld diese Woche."},
+			IntentInvoice:    {"Rechnungsanfrage", "Bitte senden Sie uns die aktuelle Rechnung für Februar.", "Die Februar-Rechnung ist angehängt. Geben Sie Bescheid, falls Sie eine andere Rechnungsadresse brauchen.", "Danke. Könnten Sie auch die Januar-Rechnung erneut schicken? Die Buchhaltung findet sie nicht."},
+			IntentSpam:       {"Sie haben gewonnen!", "Sie haben einen Preis gewonnen, klicken Sie hier.", "", ""},
+			IntentPlanChange: {"Allgemeine Frage", "Können Sie mir helfen, meinen Tarif zu wechseln?", "Gern. In welchen Tarif möchten Sie wechseln und ab wann?", "In den Team-Tarif, ab nächstem Monat bitte."},
+		},
+	},
+	"fr": {
+		people: []person{{"Élodie Martin", "elodie.martin"}, {"François Dubois", "francois.dubois"}, {"Camille Laurent", "camille.laurent"}},
+		intents: map[string]intentText{
+			IntentOutage:     {"Panne critique du serveur", "Notre système de production est en panne. Merci de corriger au plus vite.", "Nous analysons la panne et reviendrons vers vous d'ici une heure.", "C'est toujours en panne, chaque requête renvoie 502. Des nouvelles ?"},
+			IntentRefund:     {"Demande de remboursement", "Je veux un remboursement immédiatement. C'est inacceptable.", "Désolés pour ce désagrément. Pouvez-vous nous donner le numéro de commande pour le remboursement ?", "Le numéro de commande figure sur le reçu joint. J'attends le virement cette semaine."},
+			IntentInvoice:    {"Demande de facture", "Merci de nous envoyer la dernière facture de février.", "Vous trouverez la facture de février en pièce jointe. Dites-nous s'il faut une autre adresse de facturation.", "Merci. Pourriez-vous aussi renvoyer celle de janvier ? La comptabilité ne la trouve pas."},
+			IntentSpam:       {"Vous avez gagné !", "Vous avez gagné un prix, cliquez ici.", "", ""},
+			IntentPlanChange: {"Question générale", "Pouvez-vous m'aider à changer de formule ?", "Bien sûr. Vers quelle formule souhaitez-vous passer, et à partir de quand ?", "La formule Team, à partir du mois prochain s'il vous plaît."},
+		},
+	},
+}
+
+// Languages lists the supported language codes, English first.
+func Languages() []string {
+	codes := make([]string, 0, len(catalog))
+	for code := range catalog {
+		if code != "en" {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	return append([]string{"en"}, codes...)
+}
+
+// attachmentFor returns a small text attachment that fits the intent, such as
+// an error log for an outage or a receipt for a refund.
+func attachmentFor(intent string, thread int, turn int) Attachment {
+	switch intent {
+	case IntentOutage:
+		return Attachment{"errors.log", "text/plain", []byte(fmt.Sprintf(
+			"2025-01-06T09:00:%02dZ ERROR upstream timeout\n2025-01-06T09:00:%02dZ ERROR 502 Bad Gateway\n", turn, turn+1))}
+	case IntentRefund:
+		return Attachment{"receipt.txt", "text/plain", []byte(fmt.Sprintf("Order ORD-%05d\nAmount: 49.00 EUR\n", 10000+thread*7+turn))}
+	case IntentInvoice:
+		return Attachment{"invoices.csv", "text/csv", []byte(fmt.Sprintf("invoice,month,amount\nINV-%04d,2025-01,120.00\n", 1000+thread))}
+	case IntentSpam:
+		return Attachment{"prize.html", "text/html", []byte("<a href=\"http://prize.example.invalid\">Claim now</a>\n")}
+	default:
+		return Attachment{"usage.csv", "text/csv", []byte(fmt.Sprintf("seats,storage_gb\n%d,%d\n", 5+thread, 20+turn*5))}
+	}
+}
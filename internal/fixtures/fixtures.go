@@ -0,0 +1,190 @@
+// Package fixtures generates deterministic demo mail: conversations across a
+// handful of support intents and languages, with follow-ups and attachments.
+// The same Options always produce the same messages, down to Message-IDs and
+// MIME boundaries, so `neuralmail seed` can tell what it already delivered and
+// tests can assert on exact output.
+package fixtures
+
+import (
+	"fmt"
+	"math/rand"
+	"net/mail"
+	"time"
+)
+
+// Support intents, in the order Generate cycles through them.
+const (
+	IntentOutage     = "outage"
+	IntentRefund     = "refund"
+	IntentInvoice    = "invoice"
+	IntentSpam       = "spam"
+	IntentPlanChange = "plan_change"
+)
+
+var intents = []string{IntentOutage, IntentRefund, IntentInvoice, IntentSpam, IntentPlanChange}
+
+// Message directions, matching store.Message.Direction.
+const (
+	DirectionInbound  = "inbound"
+	DirectionOutbound = "outbound"
+)
+
+const messageIDDomain = "fixtures.neuralmail"
+
+// Options controls how much data Generate produces.
+type Options struct {
+	// Seed selects the data set. Different seeds give different names,
+	// turn counts and timestamps, and never share Message-IDs.
+	Seed int64
+	// Threads is the number of conversations.
+	Threads int
+	// MaxTurns caps the messages per conversation; each gets between one and
+	// MaxTurns, alternating customer and support.
+	MaxTurns int
+	// AttachmentRate is the share of customer messages that carry an
+	// attachment, from 0 (none) to 1 (all).
+	AttachmentRate float64
+	// Languages are cycled through once every intent has been used in the
+	// previous language. See Languages for the supported codes.
+	Languages []string
+	// Inbox is the support address customers write to.
+	Inbox string
+	// Start is the date of the first message.
+	Start time.Time
+}
+
+// Attachment is a file attached to a fixture message.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Message is one email in a fixture conversation. MessageID, InReplyTo and
+// References use the bracketed header form.
+type Message struct {
+	MessageID   string
+	InReplyTo   string
+	References  []string
+	Direction   string
+	From        mail.Address
+	To          mail.Address
+	Subject     string
+	Text        string
+	Date        time.Time
+	Attachments []Attachment
+}
+
+// Thread is one generated conversation.
+type Thread struct {
+	Key      string
+	Intent   string
+	Language string
+	Subject  string
+	Messages []Message
+}
+
+// Defaults returns the options `neuralmail seed` uses without flags: the five
+// classic demo scenarios in English, some with a follow-up or attachment.
+func Defaults() Options {
+	return Options{
+		Seed:           1,
+		Threads:        len(intents),
+		MaxTurns:       3,
+		AttachmentRate: 0.3,
+		Languages:      Languages(),
+		Inbox:          "dev@local.neuralmail",
+		Start:          time.Date(2025, time.January, 6, 9, 0, 0, 0, time.UTC),
+	}
+}
+
+// Generate builds opts.Threads conversations. Zero-valued fields other than
+// Seed and AttachmentRate fall back to Defaults.
+func Generate(opts Options) ([]Thread, error) {
+	opts = withDefaults(opts)
+	for _, lang := range opts.Languages {
+		if _, ok := catalog[lang]; !ok {
+			return nil, fmt.Errorf("fixtures: unsupported language %q", lang)
+		}
+	}
+	if opts.AttachmentRate < 0 || opts.AttachmentRate > 1 {
+		return nil, fmt.Errorf("fixtures: attachment rate %v is outside [0, 1]", opts.AttachmentRate)
+	}
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	inbox := mail.Address{Name: "Support", Address: opts.Inbox}
+	threads := make([]Thread, 0, opts.Threads)
+	for i := 0; i < opts.Threads; i++ {
+		intent := intents[i%len(intents)]
+		lang := opts.Languages[(i/len(intents))%len(opts.Languages)]
+		threads = append(threads, buildThread(rng, opts, i, intent, lang, inbox))
+	}
+	return threads, nil
+}
+
+func withDefaults(opts Options) Options {
+	def := Defaults()
+	if opts.Threads <= 0 {
+		opts.Threads = def.Threads
+	}
+	if opts.MaxTurns <= 0 {
+		opts.MaxTurns = def.MaxTurns
+	}
+	if len(opts.Languages) == 0 {
+		opts.Languages = def.Languages
+	}
+	if opts.Inbox == "" {
+		opts.Inbox = def.Inbox
+	}
+	if opts.Start.IsZero() {
+		opts.Start = def.Start
+	}
+	return opts
+}
+
+func buildThread(rng *rand.Rand, opts Options, index int, intent string, lang string, inbox mail.Address) Thread {
+	text := catalog[lang].intents[intent]
+	person := catalog[lang].people[rng.Intn(len(catalog[lang].people))]
+	customer := mail.Address{Name: person.name, Address: fmt.Sprintf("%s@%s", person.local, customerDomains[rng.Intn(len(customerDomains))])}
+
+	turns := 1 + rng.Intn(opts.MaxTurns)
+	if intent == IntentSpam {
+		// Nobody answers spam, and spammers rarely follow up.
+		turns = 1
+	}
+	thread := Thread{
+		Key:      fmt.Sprintf("t%03d", index+1),
+		Intent:   intent,
+		Language: lang,
+		Subject:  text.subject,
+	}
+	date := opts.Start.Add(time.Duration(index)*37*time.Minute + time.Duration(rng.Intn(30))*time.Minute)
+	var references []string
+	for turn := 0; turn < turns; turn++ {
+		msg := Message{
+			MessageID: fmt.Sprintf("<seed%d.%s.m%d@%s>", opts.Seed, thread.Key, turn+1, messageIDDomain),
+			Subject:   text.subject,
+			Date:      date,
+		}
+		if turn > 0 {
+			msg.Subject = "Re: " + text.subject
+			msg.InReplyTo = references[len(references)-1]
+			msg.References = append([]string(nil), references...)
+		}
+		switch {
+		case turn == 0:
+			msg.Direction, msg.From, msg.To, msg.Text = DirectionInbound, customer, inbox, text.opening
+		case turn%2 == 1:
+			msg.Direction, msg.From, msg.To, msg.Text = DirectionOutbound, inbox, customer, text.reply
+		default:
+			msg.Direction, msg.From, msg.To, msg.Text = DirectionInbound, customer, inbox, text.followUp
+		}
+		if msg.Direction == DirectionInbound && rng.Float64() < opts.AttachmentRate {
+			msg.Attachments = []Attachment{attachmentFor(intent, index, turn)}
+		}
+		thread.Messages = append(thread.Messages, msg)
+		references = append(references, msg.MessageID)
+		date = date.Add(time.Duration(1+rng.Intn(6)) * time.Hour)
+	}
+	return thread
+}
@@ -0,0 +1,108 @@
+package fixtures
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"neuralmail/internal/mailparse"
+)
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	opts := Options{Seed: 7, Threads: 12, MaxTurns: 4, AttachmentRate: 0.5}
+	first, err := Generate(opts)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	second, _ := Generate(opts)
+	if !reflect.DeepEqual(first, second) {
+		t.Fatal("expected identical fixtures for identical options")
+	}
+	for i := range first {
+		for j := range first[i].Messages {
+			if !bytes.Equal(first[i].Messages[j].Raw(), second[i].Messages[j].Raw()) {
+				t.Fatalf("raw message %s differs between runs", first[i].Messages[j].MessageID)
+			}
+		}
+	}
+
+	other, _ := Generate(Options{Seed: 8, Threads: 12, MaxTurns: 4, AttachmentRate: 0.5})
+	if other[0].Messages[0].MessageID == first[0].Messages[0].MessageID {
+		t.Fatal("expected different seeds to use different Message-IDs")
+	}
+}
+
+func TestDefaultsKeepClassicScenarios(t *testing.T) {
+	threads, err := Generate(Defaults())
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	want := []string{"Critical server outage", "Angry refund request", "Invoice request", "Spam offer", "General question"}
+	if len(threads) != len(want) {
+		t.Fatalf("expected %d threads, got %d", len(want), len(threads))
+	}
+	for i, thread := range threads {
+		if thread.Subject != want[i] || thread.Language != "en" {
+			t.Fatalf("thread %d: got %q (%s)", i, thread.Subject, thread.Language)
+		}
+	}
+}
+
+func TestGenerateVolumeAndLanguages(t *testing.T) {
+	threads, err := Generate(Options{Seed: 3, Threads: 40, MaxTurns: 5, AttachmentRate: 1, Languages: []string{"de", "fr"}})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if len(threads) != 40 {
+		t.Fatalf("expected 40 threads, got %d", len(threads))
+	}
+	langs := map[string]int{}
+	multiTurn := false
+	for _, thread := range threads {
+		langs[thread.Language]++
+		if len(thread.Messages) < 1 || len(thread.Messages) > 5 {
+			t.Fatalf("thread %s has %d messages", thread.Key, len(thread.Messages))
+		}
+		multiTurn = multiTurn || len(thread.Messages) > 1
+		for _, msg := range thread.Messages {
+			if msg.Direction == DirectionInbound && len(msg.Attachments) != 1 {
+				t.Fatalf("expected every customer message to carry an attachment at rate 1")
+			}
+		}
+	}
+	if langs["de"] != 20 || langs["fr"] != 20 {
+		t.Fatalf("expected languages to alternate evenly, got %v", langs)
+	}
+	if !multiTurn {
+		t.Fatal("expected at least one multi-turn conversation")
+	}
+
+	if _, err := Generate(Options{Languages: []string{"xx"}}); err == nil {
+		t.Fatal("expected an unsupported language to be rejected")
+	}
+}
+
+func TestRawMessagesParseIntoThreads(t *testing.T) {
+	threads, err := Generate(Options{Seed: 11, Threads: 10, MaxTurns: 4, AttachmentRate: 1, Languages: []string{"en", "es"}})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	for _, thread := range threads {
+		root := thread.Messages[0].MessageID
+		for _, msg := range thread.Messages {
+			email, err := mailparse.Parse(msg.Raw())
+			if err != nil {
+				t.Fatalf("parse %s: %v", msg.MessageID, err)
+			}
+			if email.InternetMsg != msg.MessageID || email.ThreadID != root {
+				t.Fatalf("expected %s in thread %s, got id=%s thread=%s", msg.MessageID, root, email.InternetMsg, email.ThreadID)
+			}
+			if email.Subject != msg.Subject || email.Text != msg.Text || email.From.Email != msg.From.Address {
+				t.Fatalf("round trip mismatch for %s: %+v", msg.MessageID, email)
+			}
+			if !email.ReceivedAt.Equal(msg.Date) {
+				t.Fatalf("expected date %v, got %v", msg.Date, email.ReceivedAt)
+			}
+		}
+	}
+}
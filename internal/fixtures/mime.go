@@ -0,0 +1,76 @@
+package fixtures
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Raw renders the message as RFC 5322 text ready for SMTP DATA. Messages with
+// attachments become multipart/mixed with a boundary derived from the
+// Message-ID, so the output is byte-for-byte stable.
+func (m Message) Raw() []byte {
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+		}
+	}
+	header("From", m.From.String())
+	header("To", m.To.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", m.Date.Format(time.RFC1123Z))
+	header("Message-ID", m.MessageID)
+	header("In-Reply-To", m.InReplyTo)
+	header("References", strings.Join(m.References, " "))
+	header("MIME-Version", "1.0")
+
+	if len(m.Attachments) == 0 {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		writeQuotedPrintable(&buf, m.Text)
+		return buf.Bytes()
+	}
+
+	mw := multipart.NewWriter(&buf)
+	_ = mw.SetBoundary("fixture-" + strings.Trim(strings.NewReplacer("@", "-", ".", "-").Replace(m.MessageID), "<>"))
+	header("Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mw.Boundary()}))
+	buf.WriteString("\r\n")
+
+	part, _ := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	var text bytes.Buffer
+	writeQuotedPrintable(&text, m.Text)
+	_, _ = part.Write(text.Bytes())
+
+	for _, att := range m.Attachments {
+		part, _ := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(att.ContentType, map[string]string{"name": att.Filename})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": att.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		encoded := base64.StdEncoding.EncodeToString(att.Data)
+		for len(encoded) > 76 {
+			_, _ = part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		_, _ = part.Write([]byte(encoded + "\r\n"))
+	}
+	_ = mw.Close()
+	return buf.Bytes()
+}
+
+func writeQuotedPrintable(buf *bytes.Buffer, text string) {
+	qp := quotedprintable.NewWriter(buf)
+	_, _ = qp.Write([]byte(text))
+	_ = qp.Close()
+}
@@ -0,0 +1,45 @@
+package gmailapi
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"neuralmail/internal/jmap"
+)
+
+// rangePageSize is how many messages one FetchRange call lists.
+const rangePageSize = 100
+
+// FetchRange reads the INBOX messages received in [since, until). The
+// cursor is messages.list's page token.
+func (c *Client) FetchRange(ctx context.Context, since, until time.Time, cursor string) ([]jmap.Email, string, error) {
+	var list struct {
+		Messages []struct {
+			ID string `json:"id"`
+		} `json:"messages"`
+		NextPageToken string `json:"nextPageToken"`
+	}
+	query := url.Values{}
+	query.Set("labelIds", "INBOX")
+	// after: and before: take seconds since the epoch; before: is exclusive.
+	query.Set("q", fmt.Sprintf("after:%d before:%d", since.Unix()-1, until.Unix()))
+	query.Set("maxResults", strconv.Itoa(rangePageSize))
+	if cursor != "" {
+		query.Set("pageToken", cursor)
+	}
+	if err := c.get(ctx, "/gmail/v1/users/me/messages", query, &list); err != nil {
+		return nil, cursor, err
+	}
+	ids := make([]string, 0, len(list.Messages))
+	for i := len(list.Messages) - 1; i >= 0; i-- {
+		ids = append(ids, list.Messages[i].ID)
+	}
+	emails, err := c.getMessages(ctx, ids)
+	if err != nil {
+		return nil, cursor, err
+	}
+	return emails, list.NextPageToken, nil
+}
@@ -0,0 +1,249 @@
+// Package gmailapi syncs inboxes through the Gmail REST API. Incremental sync
+// follows users.history.list from the last seen historyId, so each poll costs
+// one request when nothing changed. The client implements jmap.Client so the
+// shared ingestor and checkpoints apply unchanged.
+package gmailapi
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/jmap"
+	"neuralmail/internal/mailparse"
+)
+
+// APIError is a non-2xx response from the Gmail API.
+type APIError struct {
+	Status int
+	Body   string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("gmail api: status %d: %s", e.Status, e.Body)
+}
+
+func isNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound
+}
+
+// Client reads one Gmail mailbox on behalf of a connected inbox.
+type Client struct {
+	baseURL          string
+	tokens           TokenSource
+	httpClient       *http.Client
+	initialSyncLimit int
+}
+
+func NewClient(cfg config.Config, tokens TokenSource) *Client {
+	limit := cfg.Gmail.InitialSyncLimit
+	if limit <= 0 {
+		limit = 50
+	}
+	return &Client{
+		baseURL:          strings.TrimRight(cfg.Gmail.APIBaseURL, "/"),
+		tokens:           tokens,
+		httpClient:       &http.Client{Timeout: 30 * time.Second},
+		initialSyncLimit: limit,
+	}
+}
+
+func (c *Client) Name() string { return "gmail" }
+
+// FetchChanges returns INBOX messages added after sinceState (a historyId).
+// An empty state, or one Gmail no longer retains history for, falls back to
+// fetching the most recent messages.
+func (c *Client) FetchChanges(ctx context.Context, sinceState string) ([]jmap.Email, string, error) {
+	if sinceState == "" {
+		return c.initialSync(ctx)
+	}
+	ids, newState, err := c.historySince(ctx, sinceState)
+	if isNotFound(err) {
+		return c.initialSync(ctx)
+	}
+	if err != nil {
+		return nil, sinceState, err
+	}
+	emails, err := c.getMessages(ctx, ids)
+	if err != nil {
+		return nil, sinceState, err
+	}
+	return emails, newState, nil
+}
+
+// ProfileEmail returns the mailbox address the token belongs to.
+func (c *Client) ProfileEmail(ctx context.Context) (string, error) {
+	var profile struct {
+		EmailAddress string `json:"emailAddress"`
+	}
+	if err := c.get(ctx, "/gmail/v1/users/me/profile", nil, &profile); err != nil {
+		return "", err
+	}
+	return profile.EmailAddress, nil
+}
+
+func (c *Client) initialSync(ctx context.Context) ([]jmap.Email, string, error) {
+	// Read the historyId first so anything arriving during the listing is
+	// picked up by the next incremental poll.
+	var profile struct {
+		HistoryID string `json:"historyId"`
+	}
+	if err := c.get(ctx, "/gmail/v1/users/me/profile", nil, &profile); err != nil {
+		return nil, "", err
+	}
+	var list struct {
+		Messages []struct {
+			ID string `json:"id"`
+		} `json:"messages"`
+	}
+	query := url.Values{}
+	query.Set("labelIds", "INBOX")
+	query.Set("maxResults", strconv.Itoa(c.initialSyncLimit))
+	if err := c.get(ctx, "/gmail/v1/users/me/messages", query, &list); err != nil {
+		return nil, "", err
+	}
+	// messages.list is newest first; ingest oldest first like JMAP.
+	ids := make([]string, 0, len(list.Messages))
+	for i := len(list.Messages) - 1; i >= 0; i-- {
+		ids = append(ids, list.Messages[i].ID)
+	}
+	emails, err := c.getMessages(ctx, ids)
+	if err != nil {
+		return nil, "", err
+	}
+	return emails, profile.HistoryID, nil
+}
+
+func (c *Client) historySince(ctx context.Context, startHistoryID string) ([]string, string, error) {
+	var ids []string
+	seen := map[string]bool{}
+	newState := startHistoryID
+	pageToken := ""
+	for {
+		query := url.Values{}
+		query.Set("startHistoryId", startHistoryID)
+		query.Set("historyTypes", "messageAdded")
+		query.Set("labelId", "INBOX")
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		var page struct {
+			History []struct {
+				MessagesAdded []struct {
+					Message struct {
+						ID string `json:"id"`
+					} `json:"message"`
+				} `json:"messagesAdded"`
+			} `json:"history"`
+			NextPageToken string `json:"nextPageToken"`
+			HistoryID     string `json:"historyId"`
+		}
+		if err := c.get(ctx, "/gmail/v1/users/me/history", query, &page); err != nil {
+			return nil, startHistoryID, err
+		}
+		for _, h := range page.History {
+			for _, added := range h.MessagesAdded {
+				if id := added.Message.ID; id != "" && !seen[id] {
+					seen[id] = true
+					ids = append(ids, id)
+				}
+			}
+		}
+		if page.HistoryID != "" {
+			newState = page.HistoryID
+		}
+		if page.NextPageToken == "" {
+			return ids, newState, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// getMessages fetches raw messages; ones deleted since they were listed are
+// skipped.
+func (c *Client) getMessages(ctx context.Context, ids []string) ([]jmap.Email, error) {
+	var emails []jmap.Email
+	for _, id := range ids {
+		email, err := c.getMessage(ctx, id)
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+	return emails, nil
+}
+
+func (c *Client) getMessage(ctx context.Context, id string) (jmap.Email, error) {
+	var msg struct {
+		ID           string `json:"id"`
+		ThreadID     string `json:"threadId"`
+		InternalDate string `json:"internalDate"`
+		Raw          string `json:"raw"`
+	}
+	query := url.Values{}
+	query.Set("format", "raw")
+	if err := c.get(ctx, "/gmail/v1/users/me/messages/"+url.PathEscape(id), query, &msg); err != nil {
+		return jmap.Email{}, err
+	}
+	raw, err := base64.URLEncoding.DecodeString(msg.Raw)
+	if err != nil {
+		raw, err = base64.RawURLEncoding.DecodeString(msg.Raw)
+		if err != nil {
+			return jmap.Email{}, fmt.Errorf("gmail api: decode message %s: %w", id, err)
+		}
+	}
+	email, err := mailparse.Parse(raw)
+	if err != nil {
+		return jmap.Email{}, fmt.Errorf("gmail api: parse message %s: %w", id, err)
+	}
+	email.ID = msg.ID
+	email.ThreadID = msg.ThreadID
+	if ms, err := strconv.ParseInt(msg.InternalDate, 10, 64); err == nil && ms > 0 {
+		email.ReceivedAt = time.UnixMilli(ms).UTC()
+	}
+	if email.ReceivedAt.IsZero() {
+		email.ReceivedAt = time.Now().UTC()
+	}
+	return email, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, out any) error {
+	token, err := c.tokens.AccessToken(ctx)
+	if err != nil {
+		return err
+	}
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &APIError{Status: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,255 @@
+package gmailapi
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/store"
+)
+
+type fakeGmail struct {
+	historyID     string
+	expiredCursor bool
+	added         []string
+	messages      map[string]string
+	requests      []string
+}
+
+func (f *fakeGmail) handler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer access-1" {
+			t.Errorf("unexpected authorization header %q", got)
+		}
+		f.requests = append(f.requests, r.URL.Path)
+		switch {
+		case r.URL.Path == "/gmail/v1/users/me/profile":
+			writeTestJSON(w, map[string]any{"emailAddress": "support@example.com", "historyId": f.historyID})
+		case r.URL.Path == "/gmail/v1/users/me/messages":
+			if r.URL.Query().Get("labelIds") != "INBOX" {
+				t.Errorf("expected INBOX label filter")
+			}
+			// Newest first, like Gmail.
+			writeTestJSON(w, map[string]any{"messages": []map[string]string{{"id": "m2"}, {"id": "m1"}}})
+		case r.URL.Path == "/gmail/v1/users/me/history":
+			if f.expiredCursor {
+				http.Error(w, `{"error":{"code":404}}`, http.StatusNotFound)
+				return
+			}
+			var added []map[string]any
+			for _, id := range f.added {
+				added = append(added, map[string]any{"message": map[string]string{"id": id}})
+			}
+			writeTestJSON(w, map[string]any{
+				"history":   []map[string]any{{"messagesAdded": added}},
+				"historyId": f.historyID,
+			})
+		case strings.HasPrefix(r.URL.Path, "/gmail/v1/users/me/messages/"):
+			id := strings.TrimPrefix(r.URL.Path, "/gmail/v1/users/me/messages/")
+			raw, ok := f.messages[id]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			writeTestJSON(w, map[string]any{
+				"id":           id,
+				"threadId":     "t-" + id,
+				"internalDate": "1772704800000",
+				"raw":          base64.URLEncoding.EncodeToString([]byte(raw)),
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func writeTestJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func testConfig(baseURL string) config.Config {
+	cfg := config.Default()
+	cfg.Gmail.APIBaseURL = baseURL
+	cfg.Gmail.TokenURL = baseURL + "/token"
+	cfg.Gmail.ClientID = "client-1"
+	cfg.Gmail.ClientSecret = "secret-1"
+	cfg.Gmail.RedirectURL = "https://cloud.example.com/v1/oauth/gmail/callback"
+	cfg.Security.TokenEncryptionKey = strings.Repeat("ab", 32)
+	return cfg
+}
+
+func testMessage(subject string) string {
+	return "From: Ada <ada@example.com>\r\nTo: support@example.com\r\nSubject: " + subject + "\r\n\r\nHello\r\n"
+}
+
+func TestFetchChangesInitialSync(t *testing.T) {
+	fake := &fakeGmail{historyID: "900", messages: map[string]string{"m1": testMessage("first"), "m2": testMessage("second")}}
+	srv := httptest.NewServer(fake.handler(t))
+	defer srv.Close()
+
+	client := NewClient(testConfig(srv.URL), StaticToken("access-1"))
+	emails, state, err := client.FetchChanges(context.Background(), "")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if state != "900" {
+		t.Fatalf("expected historyId 900, got %q", state)
+	}
+	if len(emails) != 2 || emails[0].Subject != "first" || emails[1].ID != "m2" || emails[1].ThreadID != "t-m2" {
+		t.Fatalf("unexpected emails: %+v", emails)
+	}
+	if emails[0].ReceivedAt.Unix() != 1772704800 {
+		t.Fatalf("expected internalDate to set ReceivedAt, got %s", emails[0].ReceivedAt)
+	}
+}
+
+func TestFetchChangesIncrementalSkipsDeleted(t *testing.T) {
+	fake := &fakeGmail{historyID: "950", added: []string{"m3", "gone", "m3"}, messages: map[string]string{"m3": testMessage("third")}}
+	srv := httptest.NewServer(fake.handler(t))
+	defer srv.Close()
+
+	emails, state, err := NewClient(testConfig(srv.URL), StaticToken("access-1")).FetchChanges(context.Background(), "900")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if state != "950" || len(emails) != 1 || emails[0].ID != "m3" {
+		t.Fatalf("unexpected result state=%q emails=%+v", state, emails)
+	}
+}
+
+func TestFetchChangesExpiredHistoryResyncs(t *testing.T) {
+	fake := &fakeGmail{historyID: "1200", expiredCursor: true, messages: map[string]string{"m1": testMessage("first"), "m2": testMessage("second")}}
+	srv := httptest.NewServer(fake.handler(t))
+	defer srv.Close()
+
+	emails, state, err := NewClient(testConfig(srv.URL), StaticToken("access-1")).FetchChanges(context.Background(), "5")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if state != "1200" || len(emails) != 2 {
+		t.Fatalf("expected full resync, got state=%q emails=%d", state, len(emails))
+	}
+}
+
+func TestOAuthExchangeAndErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.Form.Get("client_secret") != "secret-1" {
+			t.Errorf("expected client secret in form")
+		}
+		switch r.Form.Get("grant_type") {
+		case "authorization_code":
+			writeTestJSON(w, map[string]any{"access_token": "access-1", "refresh_token": "refresh-1", "expires_in": 3600, "scope": ReadonlyScope})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			writeTestJSON(w, map[string]any{"error": "invalid_grant", "error_description": "Token has been revoked."})
+		}
+	}))
+	defer srv.Close()
+
+	oauth, err := NewOAuth(testConfig(srv.URL))
+	if err != nil {
+		t.Fatalf("new oauth: %v", err)
+	}
+	consent, err := url.Parse(oauth.AuthCodeURL("state-1"))
+	if err != nil {
+		t.Fatalf("parse consent url: %v", err)
+	}
+	q := consent.Query()
+	if q.Get("state") != "state-1" || q.Get("access_type") != "offline" || q.Get("scope") != ReadonlyScope {
+		t.Fatalf("unexpected consent params: %v", q)
+	}
+
+	tok, err := oauth.Exchange(context.Background(), "code-1")
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if tok.AccessToken != "access-1" || tok.RefreshToken != "refresh-1" || tok.Expiry.IsZero() || len(tok.Scopes) != 1 {
+		t.Fatalf("unexpected token: %+v", tok)
+	}
+
+	_, err = oauth.Refresh(context.Background(), "refresh-1")
+	var oauthErr *OAuthError
+	if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+		t.Fatalf("expected invalid_grant, got %v", err)
+	}
+}
+
+func TestNewOAuthRequiresCredentials(t *testing.T) {
+	if _, err := NewOAuth(config.Default()); !errors.Is(err, ErrNotConfigured) {
+		t.Fatalf("expected ErrNotConfigured, got %v", err)
+	}
+	cfg := testConfig("http://gmail.test")
+	cfg.Security.TokenEncryptionKey = ""
+	if _, err := NewOAuth(cfg); !errors.Is(err, ErrNotConfigured) {
+		t.Fatalf("expected ErrNotConfigured without an encryption key, got %v", err)
+	}
+}
+
+type fakeGrants struct {
+	grant store.InboxOAuthToken
+}
+
+func (f *fakeGrants) GetInboxOAuthToken(_ context.Context, _ string) (store.InboxOAuthToken, error) {
+	return f.grant, nil
+}
+
+func (f *fakeGrants) UpdateInboxAccessToken(_ context.Context, _ string, accessToken string, expiresAt time.Time, refreshToken string) error {
+	f.grant.AccessToken, f.grant.AccessExpiresAt, f.grant.Sealed = accessToken, expiresAt, true
+	if refreshToken != "" {
+		f.grant.RefreshToken = refreshToken
+	}
+	return nil
+}
+
+func TestStoreTokenSourceSealsGrants(t *testing.T) {
+	var refreshedWith []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		refreshedWith = append(refreshedWith, r.Form.Get("refresh_token"))
+		writeTestJSON(w, map[string]any{"access_token": "access-2", "expires_in": 3600})
+	}))
+	defer srv.Close()
+	oauth, err := NewOAuth(testConfig(srv.URL))
+	if err != nil {
+		t.Fatalf("new oauth: %v", err)
+	}
+
+	grant, err := oauth.Grant("org-1", "inbox-1", "ada@example.com", Token{AccessToken: "access-1", RefreshToken: "refresh-1", Expiry: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("grant: %v", err)
+	}
+	if !grant.Sealed || strings.Contains(grant.RefreshToken, "refresh-1") || strings.Contains(grant.AccessToken, "access-1") {
+		t.Fatalf("expected the grant's tokens sealed, got %+v", grant)
+	}
+	grants := &fakeGrants{grant: grant}
+	source := &StoreTokenSource{Store: grants, OAuth: oauth, InboxID: "inbox-1"}
+	if tok, err := source.AccessToken(context.Background()); err != nil || tok != "access-1" {
+		t.Fatalf("expected the cached access token opened, got %q %v", tok, err)
+	}
+
+	// A grant stored in plaintext before grants were sealed is sealed on
+	// its next refresh, the refresh token included.
+	grants.grant = store.InboxOAuthToken{InboxID: "inbox-1", RefreshToken: "refresh-legacy"}
+	if tok, err := source.AccessToken(context.Background()); err != nil || tok != "access-2" {
+		t.Fatalf("refresh: %q %v", tok, err)
+	}
+	if len(refreshedWith) != 1 || refreshedWith[0] != "refresh-legacy" {
+		t.Fatalf("expected a refresh with the plaintext token, got %v", refreshedWith)
+	}
+	if !grants.grant.Sealed || strings.Contains(grants.grant.RefreshToken, "refresh-legacy") || strings.Contains(grants.grant.AccessToken, "access-2") {
+		t.Fatalf("expected the legacy grant sealed, got %+v", grants.grant)
+	}
+	if tok, err := source.AccessToken(context.Background()); err != nil || tok != "access-2" || len(refreshedWith) != 1 {
+		t.Fatalf("expected the sealed access token reused, got %q %v", tok, err)
+	}
+}
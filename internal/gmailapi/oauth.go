@@ -0,0 +1,158 @@
+package gmailapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/secrets"
+)
+
+// ReadonlyScope is the only scope requested: ingest never modifies mail.
+const ReadonlyScope = "https://www.googleapis.com/auth/gmail.readonly"
+
+var ErrNotConfigured = errors.New("gmail oauth client not configured")
+
+// OAuthError is an error response from the token endpoint. Code
+// "invalid_grant" means the user revoked access and must reconnect.
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return "gmail oauth: " + e.Code
+	}
+	return "gmail oauth: " + e.Code + ": " + e.Description
+}
+
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	Expiry       time.Time
+	Scopes       []string
+}
+
+// OAuth runs the authorization-code flow against Google's endpoints.
+type OAuth struct {
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	authURL      string
+	tokenURL     string
+	key          []byte
+	httpClient   *http.Client
+	now          func() time.Time
+}
+
+func NewOAuth(cfg config.Config) (*OAuth, error) {
+	if cfg.Gmail.ClientID == "" || cfg.Gmail.ClientSecret == "" || cfg.Gmail.RedirectURL == "" {
+		return nil, ErrNotConfigured
+	}
+	key, err := secrets.ParseKey(cfg.Security.TokenEncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: security.token_encryption_key: %v", ErrNotConfigured, err)
+	}
+	return &OAuth{
+		clientID:     cfg.Gmail.ClientID,
+		clientSecret: cfg.Gmail.ClientSecret,
+		redirectURL:  cfg.Gmail.RedirectURL,
+		authURL:      cfg.Gmail.AuthURL,
+		tokenURL:     cfg.Gmail.TokenURL,
+		key:          key,
+		httpClient:   &http.Client{Timeout: 15 * time.Second},
+		now:          func() time.Time { return time.Now().UTC() },
+	}, nil
+}
+
+// AuthCodeURL returns the consent page URL. Offline access with a forced
+// consent prompt guarantees a refresh token even on reconnect.
+func (o *OAuth) AuthCodeURL(state string) string {
+	v := url.Values{}
+	v.Set("client_id", o.clientID)
+	v.Set("redirect_uri", o.redirectURL)
+	v.Set("response_type", "code")
+	v.Set("scope", ReadonlyScope)
+	v.Set("access_type", "offline")
+	v.Set("prompt", "consent")
+	v.Set("include_granted_scopes", "true")
+	v.Set("state", state)
+	sep := "?"
+	if strings.Contains(o.authURL, "?") {
+		sep = "&"
+	}
+	return o.authURL + sep + v.Encode()
+}
+
+func (o *OAuth) Exchange(ctx context.Context, code string) (Token, error) {
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", o.redirectURL)
+	return o.token(ctx, v)
+}
+
+func (o *OAuth) Refresh(ctx context.Context, refreshToken string) (Token, error) {
+	v := url.Values{}
+	v.Set("grant_type", "refresh_token")
+	v.Set("refresh_token", refreshToken)
+	return o.token(ctx, v)
+}
+
+func (o *OAuth) token(ctx context.Context, form url.Values) (Token, error) {
+	form.Set("client_id", o.clientID)
+	form.Set("client_secret", o.clientSecret)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return Token{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return Token{}, err
+	}
+	if resp.StatusCode >= 300 {
+		var oauthErr OAuthError
+		if json.Unmarshal(body, &oauthErr) == nil && oauthErr.Code != "" {
+			return Token{}, &oauthErr
+		}
+		return Token{}, fmt.Errorf("gmail oauth: token endpoint returned %s", resp.Status)
+	}
+
+	var payload struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+		Scope        string `json:"scope"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return Token{}, err
+	}
+	if payload.AccessToken == "" {
+		return Token{}, errors.New("gmail oauth: token response without access_token")
+	}
+	tok := Token{
+		AccessToken:  payload.AccessToken,
+		RefreshToken: payload.RefreshToken,
+		Scopes:       strings.Fields(payload.Scope),
+	}
+	if payload.ExpiresIn > 0 {
+		tok.Expiry = o.now().Add(time.Duration(payload.ExpiresIn) * time.Second)
+	}
+	return tok, nil
+}
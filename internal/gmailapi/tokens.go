@@ -0,0 +1,114 @@
+package gmailapi
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"neuralmail/internal/secrets"
+	"neuralmail/internal/store"
+)
+
+// refreshSkew refreshes access tokens slightly before Google expires them so
+// a request never races the expiry.
+const refreshSkew = time.Minute
+
+// TokenSource supplies a bearer token for Gmail API calls.
+type TokenSource interface {
+	AccessToken(ctx context.Context) (string, error)
+}
+
+// StaticToken is a TokenSource for a token that was just issued, e.g. during
+// the consent callback before anything is stored.
+type StaticToken string
+
+func (t StaticToken) AccessToken(context.Context) (string, error) { return string(t), nil }
+
+// GrantStore keeps inboxes' grants; *store.Store implements it.
+type GrantStore interface {
+	GetInboxOAuthToken(ctx context.Context, inboxID string) (store.InboxOAuthToken, error)
+	UpdateInboxAccessToken(ctx context.Context, inboxID string, accessToken string, expiresAt time.Time, refreshToken string) error
+}
+
+// Grant is the grant stored for an inbox that consented with tok, its
+// tokens sealed with security.token_encryption_key. Stored grants are only
+// opened by StoreTokenSource.
+func (o *OAuth) Grant(orgID, inboxID, accountEmail string, tok Token) (store.InboxOAuthToken, error) {
+	refresh, err := secrets.Seal(tok.RefreshToken, o.key)
+	if err != nil {
+		return store.InboxOAuthToken{}, err
+	}
+	access, err := secrets.Seal(tok.AccessToken, o.key)
+	if err != nil {
+		return store.InboxOAuthToken{}, err
+	}
+	return store.InboxOAuthToken{
+		InboxID:         inboxID,
+		OrgID:           orgID,
+		Provider:        store.ProviderGmail,
+		AccountEmail:    accountEmail,
+		RefreshToken:    refresh,
+		AccessToken:     access,
+		AccessExpiresAt: tok.Expiry,
+		Scopes:          tok.Scopes,
+		Sealed:          true,
+	}, nil
+}
+
+// StoreTokenSource reads an inbox's grant from inbox_oauth_tokens and
+// refreshes the cached access token when it is about to expire. A grant
+// stored in plaintext before grants were sealed is sealed on that refresh.
+type StoreTokenSource struct {
+	Store   GrantStore
+	OAuth   *OAuth
+	InboxID string
+	Now     func() time.Time
+}
+
+func (s *StoreTokenSource) AccessToken(ctx context.Context) (string, error) {
+	tok, err := s.Store.GetInboxOAuthToken(ctx, s.InboxID)
+	if err != nil {
+		return "", err
+	}
+	refreshToken, accessToken := tok.RefreshToken, tok.AccessToken
+	if tok.Sealed {
+		if refreshToken, err = secrets.Open(tok.RefreshToken, s.OAuth.key); err != nil {
+			return "", fmt.Errorf("gmail grant for inbox %s: %w", s.InboxID, err)
+		}
+		if accessToken != "" {
+			if accessToken, err = secrets.Open(tok.AccessToken, s.OAuth.key); err != nil {
+				return "", fmt.Errorf("gmail grant for inbox %s: %w", s.InboxID, err)
+			}
+		}
+	}
+	now := time.Now().UTC()
+	if s.Now != nil {
+		now = s.Now()
+	}
+	if accessToken != "" && !tok.AccessExpiresAt.IsZero() && now.Add(refreshSkew).Before(tok.AccessExpiresAt) {
+		return accessToken, nil
+	}
+
+	refreshed, err := s.OAuth.Refresh(ctx, refreshToken)
+	if err != nil {
+		return "", err
+	}
+	rotated := refreshed.RefreshToken
+	if rotated == "" && !tok.Sealed {
+		rotated = refreshToken
+	}
+	sealedRefresh := ""
+	if rotated != "" {
+		if sealedRefresh, err = secrets.Seal(rotated, s.OAuth.key); err != nil {
+			return "", err
+		}
+	}
+	sealedAccess, err := secrets.Seal(refreshed.AccessToken, s.OAuth.key)
+	if err != nil {
+		return "", err
+	}
+	if err := s.Store.UpdateInboxAccessToken(ctx, s.InboxID, sealedAccess, refreshed.Expiry, sealedRefresh); err != nil {
+		return "", err
+	}
+	return refreshed.AccessToken, nil
+}
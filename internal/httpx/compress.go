@@ -0,0 +1,177 @@
+package httpx
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Compress wraps next with gzip/deflate response compression. Responses are
+// buffered until minBytes have been written; anything smaller is sent as-is
+// because the framing overhead outweighs the savings on short JSON-RPC
+// replies. Streams (text/event-stream) and pre-encoded bodies are untouched.
+func Compress(next http.Handler, minBytes int, level int) http.Handler {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		level = flate.DefaultCompression
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			minBytes:       minBytes,
+			level:          level,
+		}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding picks gzip over deflate and honours q=0 exclusions.
+func negotiateEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+		allowed := true
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil && q <= 0 {
+					allowed = false
+				}
+			}
+		}
+		accepted[name] = allowed
+	}
+	switch {
+	case accepted["gzip"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	default:
+		return ""
+	}
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minBytes int
+	level    int
+
+	status      int
+	buf         bytes.Buffer
+	decided     bool
+	passthrough bool
+	encoder     io.WriteCloser
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if !c.decided {
+		if c.skipCompression() {
+			c.start(false)
+		} else {
+			c.buf.Write(p)
+			if c.buf.Len() < c.minBytes {
+				return len(p), nil
+			}
+			c.start(true)
+			if _, err := c.encoder.Write(c.buf.Bytes()); err != nil {
+				return 0, err
+			}
+			c.buf.Reset()
+			return len(p), nil
+		}
+	}
+	if c.passthrough {
+		return c.ResponseWriter.Write(p)
+	}
+	return c.encoder.Write(p)
+}
+
+// Flush commits whatever is buffered so streaming handlers keep working.
+func (c *compressWriter) Flush() {
+	if !c.decided {
+		if c.status == 0 {
+			c.status = http.StatusOK
+		}
+		c.start(false)
+	}
+	if flusher, ok := c.encoder.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (c *compressWriter) Close() error {
+	if !c.decided {
+		if c.status == 0 {
+			c.status = http.StatusOK
+		}
+		c.start(false)
+	}
+	if c.encoder != nil {
+		return c.encoder.Close()
+	}
+	return nil
+}
+
+func (c *compressWriter) skipCompression() bool {
+	h := c.Header()
+	if h.Get("Content-Encoding") != "" {
+		return true
+	}
+	if strings.HasPrefix(h.Get("Content-Type"), "text/event-stream") {
+		return true
+	}
+	return c.status < 200 || c.status == http.StatusNoContent || c.status == http.StatusNotModified
+}
+
+func (c *compressWriter) start(compress bool) {
+	c.decided = true
+	if !compress {
+		c.passthrough = true
+		c.ResponseWriter.WriteHeader(c.status)
+		if c.buf.Len() > 0 {
+			_, _ = c.ResponseWriter.Write(c.buf.Bytes())
+			c.buf.Reset()
+		}
+		return
+	}
+	h := c.Header()
+	h.Set("Content-Encoding", c.encoding)
+	h.Del("Content-Length")
+	c.ResponseWriter.WriteHeader(c.status)
+	switch c.encoding {
+	case "gzip":
+		gz, _ := gzip.NewWriterLevel(c.ResponseWriter, c.level)
+		c.encoder = gz
+	default:
+		fl, _ := flate.NewWriter(c.ResponseWriter, c.level)
+		c.encoder = fl
+	}
+}
@@ -0,0 +1,102 @@
+package httpx
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressGzipAboveThreshold(t *testing.T) {
+	body := strings.Repeat(`{"thread_id":"t-1","snippet":"hello"}`, 100)
+	handler := Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, body)
+	}), 1024, -1)
+
+	req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	req.Header.Set("Accept-Encoding", "deflate, gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip encoding, got %q", rec.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	decoded, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("read gzip body: %v", err)
+	}
+	if string(decoded) != body {
+		t.Fatalf("decoded body mismatch")
+	}
+}
+
+func TestCompressDeflateWhenGzipRefused(t *testing.T) {
+	body := strings.Repeat("x", 2048)
+	handler := Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, body)
+	}), 512, -1)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0, deflate")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "deflate" {
+		t.Fatalf("expected deflate encoding, got %q", rec.Header().Get("Content-Encoding"))
+	}
+	decoded, err := io.ReadAll(flate.NewReader(rec.Body))
+	if err != nil {
+		t.Fatalf("read deflate body: %v", err)
+	}
+	if string(decoded) != body {
+		t.Fatalf("decoded body mismatch")
+	}
+}
+
+func TestCompressSkipsSmallResponses(t *testing.T) {
+	handler := Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = io.WriteString(w, `{"ok":true}`)
+	}), 1024, -1)
+
+	req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("expected no encoding for small body")
+	}
+	if rec.Code != http.StatusAccepted || rec.Body.String() != `{"ok":true}` {
+		t.Fatalf("unexpected passthrough response: %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCompressFlushBeforeWriteStreams(t *testing.T) {
+	srv := httptest.NewServer(Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		_, _ = io.WriteString(w, "data: ready\n\n")
+	}), 16, -1))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "" || string(body) != "data: ready\n\n" {
+		t.Fatalf("expected an uncompressed 200 stream, got %d %q %q", resp.StatusCode, resp.Header.Get("Content-Encoding"), body)
+	}
+}
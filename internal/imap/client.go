@@ -0,0 +1,317 @@
+// Package imap syncs inboxes from plain IMAP servers. It implements the same
+// jmap.Client interface so the poll loop and ingestor are shared; the sync
+// position is the mailbox UIDVALIDITY and the highest UID seen.
+package imap
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/jmap"
+	"neuralmail/internal/mailparse"
+)
+
+const (
+	// fetchChunk bounds the UID set sent in a single UID FETCH.
+	fetchChunk = 50
+	// maxPerPoll caps how many messages one poll ingests; the checkpoint only
+	// advances past what was fetched, so a large backlog drains over several
+	// polls.
+	maxPerPoll = 500
+	ioTimeout  = 60 * time.Second
+)
+
+var ErrNotConfigured = errors.New("imap client not configured")
+
+// Client fetches new messages from a single IMAP mailbox.
+type Client struct {
+	addr             string
+	username         string
+	password         string
+	mailbox          string
+	useTLS           bool
+	initialSyncLimit int
+	dial             func(ctx context.Context) (net.Conn, error)
+}
+
+func NewClient(cfg config.Config) (*Client, error) {
+	if cfg.IMAP.Host == "" || cfg.IMAP.Username == "" || cfg.IMAP.Password == "" {
+		return nil, ErrNotConfigured
+	}
+	port := cfg.IMAP.Port
+	if port == 0 {
+		port = 993
+	}
+	mailbox := cfg.IMAP.Mailbox
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	limit := cfg.IMAP.InitialSyncLimit
+	if limit <= 0 {
+		limit = 50
+	}
+	c := &Client{
+		addr:             net.JoinHostPort(cfg.IMAP.Host, strconv.Itoa(port)),
+		username:         cfg.IMAP.Username,
+		password:         cfg.IMAP.Password,
+		mailbox:          mailbox,
+		useTLS:           cfg.IMAP.TLS,
+		initialSyncLimit: limit,
+	}
+	c.dial = c.dialServer
+	return c, nil
+}
+
+func (c *Client) Name() string { return "imap" }
+
+func (c *Client) dialServer(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+	if !c.useTLS {
+		return dialer.DialContext(ctx, "tcp", c.addr)
+	}
+	host, _, _ := net.SplitHostPort(c.addr)
+	tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}}
+	return tlsDialer.DialContext(ctx, "tcp", c.addr)
+}
+
+// FetchChanges returns messages that arrived after sinceState. An empty or
+// stale state (UIDVALIDITY changed) triggers an initial sync of the most
+// recent messages, mirroring the JMAP client.
+func (c *Client) FetchChanges(ctx context.Context, sinceState string) ([]jmap.Email, string, error) {
+	var emails []jmap.Email
+	newState := sinceState
+	err := c.withMailbox(ctx, func(conn *conn, uidValidity uint32) error {
+		prevValidity, lastUID, ok := ParseState(sinceState)
+		var uids []uint32
+		if ok && prevValidity == uidValidity {
+			found, err := conn.searchUIDs(fmt.Sprintf("UID %d:*", lastUID+1))
+			if err != nil {
+				return err
+			}
+			// "n:*" always matches the highest UID, even when it is below n.
+			for _, uid := range found {
+				if uid > lastUID {
+					uids = append(uids, uid)
+				}
+			}
+		} else {
+			lastUID = 0
+			found, err := conn.searchUIDs("ALL")
+			if err != nil {
+				return err
+			}
+			if len(found) > c.initialSyncLimit {
+				found = found[len(found)-c.initialSyncLimit:]
+			}
+			uids = found
+		}
+		if len(uids) > maxPerPoll {
+			uids = uids[:maxPerPoll]
+		}
+
+		var err error
+		if emails, err = fetchEmails(conn, uidValidity, uids); err != nil {
+			return err
+		}
+		if len(uids) > 0 {
+			lastUID = uids[len(uids)-1]
+		}
+		newState = FormatState(uidValidity, lastUID)
+		return nil
+	})
+	if err != nil {
+		return nil, sinceState, err
+	}
+	return emails, newState, nil
+}
+
+// withMailbox logs in, opens the mailbox read-only and runs fn on the
+// connection.
+func (c *Client) withMailbox(ctx context.Context, fn func(conn *conn, uidValidity uint32) error) error {
+	nc, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { _ = nc.Close() })
+	defer stop()
+	defer nc.Close()
+
+	conn, err := newConn(nc, ioTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.logout()
+	if err := conn.login(c.username, c.password); err != nil {
+		return err
+	}
+	uidValidity, err := conn.examine(c.mailbox)
+	if err != nil {
+		return err
+	}
+	return fn(conn, uidValidity)
+}
+
+// fetchEmails fetches and parses uids, fetchChunk at a time. A message that
+// cannot be parsed, or is too large to fetch, does not fail the batch: it
+// is kept as a damagedEmail, so the checkpoint still moves past it.
+func fetchEmails(conn *conn, uidValidity uint32, uids []uint32) ([]jmap.Email, error) {
+	var emails []jmap.Email
+	for start := 0; start < len(uids); start += fetchChunk {
+		end := min(start+fetchChunk, len(uids))
+		items, err := conn.fetchMessages(uids[start:end], "")
+		if err != nil {
+			return nil, err
+		}
+		tooLarge := map[uint32]int{}
+		for _, item := range items {
+			if item.raw == nil {
+				tooLarge[item.uid] = len(emails)
+				emails = append(emails, damagedEmail(nil, uidValidity, item.uid, item.internalDate))
+				continue
+			}
+			email, err := toEmail(item.raw, uidValidity, item.uid, item.internalDate)
+			if err != nil {
+				slog.Warn("imap: message could not be parsed; storing it without bodies", "uid", item.uid, "err", err)
+				email = damagedEmail(item.raw, uidValidity, item.uid, item.internalDate)
+			}
+			emails = append(emails, email)
+		}
+		if len(tooLarge) == 0 {
+			continue
+		}
+		// Without its bodies, a message too large to fetch still gets its
+		// sender and subject from the header.
+		headers, err := conn.fetchMessages(slices.Sorted(maps.Keys(tooLarge)), "HEADER")
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range headers {
+			if i, ok := tooLarge[item.uid]; ok && item.raw != nil {
+				email := damagedEmail(item.raw, uidValidity, item.uid, item.internalDate)
+				email.Raw = nil
+				emails[i] = email
+			}
+		}
+	}
+	return emails, nil
+}
+
+// FetchRange reads the mailbox's messages received in [since, until),
+// maxPerPoll at a time. The cursor is a sync state holding the last UID
+// read; if UIDVALIDITY changed since, the range is read from the start.
+func (c *Client) FetchRange(ctx context.Context, since, until time.Time, cursor string) ([]jmap.Email, string, error) {
+	var emails []jmap.Email
+	next := ""
+	err := c.withMailbox(ctx, func(conn *conn, uidValidity uint32) error {
+		prevValidity, lastUID, ok := ParseState(cursor)
+		if !ok || prevValidity != uidValidity {
+			lastUID = 0
+		}
+		// SINCE and BEFORE compare dates only; the exact bounds are applied
+		// to INTERNALDATE below.
+		found, err := conn.searchUIDs(fmt.Sprintf("SINCE %s BEFORE %s",
+			since.UTC().Format("2-Jan-2006"), until.UTC().AddDate(0, 0, 1).Format("2-Jan-2006")))
+		if err != nil {
+			return err
+		}
+		var uids []uint32
+		for _, uid := range found {
+			if uid > lastUID {
+				uids = append(uids, uid)
+			}
+		}
+		if len(uids) > maxPerPoll {
+			uids = uids[:maxPerPoll]
+			next = FormatState(uidValidity, uids[len(uids)-1])
+		}
+		fetched, err := fetchEmails(conn, uidValidity, uids)
+		if err != nil {
+			return err
+		}
+		for _, email := range fetched {
+			if !email.ReceivedAt.Before(since) && email.ReceivedAt.Before(until) {
+				emails = append(emails, email)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, cursor, err
+	}
+	return emails, next, nil
+}
+
+// FormatState encodes a sync position as "uidvalidity:uid".
+func FormatState(uidValidity uint32, lastUID uint32) string {
+	return strconv.FormatUint(uint64(uidValidity), 10) + ":" + strconv.FormatUint(uint64(lastUID), 10)
+}
+
+// ParseState decodes a FormatState string. ok is false for empty or foreign
+// state, e.g. a JMAP state left behind after switching providers.
+func ParseState(state string) (uidValidity uint32, lastUID uint32, ok bool) {
+	validityPart, uidPart, found := strings.Cut(state, ":")
+	if !found {
+		return 0, 0, false
+	}
+	v, err := strconv.ParseUint(validityPart, 10, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	u, err := strconv.ParseUint(uidPart, 10, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	return uint32(v), uint32(u), true
+}
+
+// toEmail parses a fetched message. A missing Message-ID falls back to a
+// UID-based ID, and the server's INTERNALDATE wins over the Date header.
+func toEmail(raw []byte, uidValidity uint32, uid uint32, internalDate time.Time) (jmap.Email, error) {
+	email, err := mailparse.Parse(raw)
+	if err != nil {
+		return jmap.Email{}, err
+	}
+	return identify(email, uidValidity, uid, internalDate), nil
+}
+
+// damagedEmail stands in for a message that could not be parsed or fetched
+// whole: whatever its header gives, no bodies, and flagged oversized like a
+// message whose bodies were truncated on ingest. raw is kept so the ingest
+// pipeline can copy the message as received to the raw store.
+func damagedEmail(raw []byte, uidValidity uint32, uid uint32, internalDate time.Time) jmap.Email {
+	var email jmap.Email
+	if msg, err := mail.ReadMessage(bytes.NewReader(raw)); err == nil {
+		email = mailparse.ParseHeader(msg.Header)
+	}
+	email.Raw = raw
+	email.Oversized = true
+	return identify(email, uidValidity, uid, internalDate)
+}
+
+func identify(email jmap.Email, uidValidity uint32, uid uint32, internalDate time.Time) jmap.Email {
+	if email.ID == "" {
+		email.ID = fmt.Sprintf("uid:%d:%d", uidValidity, uid)
+	}
+	if email.ThreadID == "" {
+		email.ThreadID = email.ID
+	}
+	if !internalDate.IsZero() {
+		email.ReceivedAt = internalDate
+	}
+	if email.ReceivedAt.IsZero() {
+		email.ReceivedAt = time.Now().UTC()
+	}
+	return email
+}
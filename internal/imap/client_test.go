@@ -0,0 +1,228 @@
+package imap
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeMessage struct {
+	uid uint32
+	raw string
+}
+
+// fakeServer answers the command sequence FetchChanges issues.
+type fakeServer struct {
+	uidValidity uint32
+	messages    []fakeMessage
+	commands    []string
+}
+
+func (f *fakeServer) serve(nc net.Conn) {
+	defer nc.Close()
+	r := bufio.NewReader(nc)
+	w := bufio.NewWriter(nc)
+	reply := func(format string, args ...any) {
+		fmt.Fprintf(w, format+"\r\n", args...)
+	}
+	reply("* OK fake IMAP ready")
+	_ = w.Flush()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		tag, cmd, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		f.commands = append(f.commands, cmd)
+		switch {
+		case strings.HasPrefix(cmd, "LOGIN"):
+			reply("%s OK logged in", tag)
+		case strings.HasPrefix(cmd, "EXAMINE"):
+			reply("* %d EXISTS", len(f.messages))
+			reply("* OK [UIDVALIDITY %d] UIDs valid", f.uidValidity)
+			reply("%s OK [READ-ONLY] done", tag)
+		case strings.HasPrefix(cmd, "UID SEARCH"):
+			var from uint32
+			if rest, ok := strings.CutPrefix(cmd, "UID SEARCH UID "); ok {
+				fmt.Sscanf(rest, "%d:*", &from)
+			}
+			var found []string
+			for i, m := range f.messages {
+				// Emulate "n:*" matching the highest UID even when below n.
+				if m.uid >= from || i == len(f.messages)-1 {
+					found = append(found, fmt.Sprint(m.uid))
+				}
+			}
+			reply("* SEARCH %s", strings.Join(found, " "))
+			reply("%s OK search done", tag)
+		case strings.HasPrefix(cmd, "UID FETCH"):
+			set := strings.Fields(cmd)[2]
+			section := ""
+			if strings.Contains(cmd, "BODY.PEEK[HEADER]") {
+				section = "HEADER"
+			}
+			for i, m := range f.messages {
+				for _, want := range strings.Split(set, ",") {
+					if want != fmt.Sprint(m.uid) {
+						continue
+					}
+					body := m.raw
+					if section == "HEADER" {
+						head, _, _ := strings.Cut(m.raw, "\r\n\r\n")
+						body = head + "\r\n\r\n"
+					}
+					fmt.Fprintf(w, "* %d FETCH (UID %d INTERNALDATE \"05-Mar-2026 10:00:00 +0000\" BODY[%s] {%d}\r\n%s)\r\n", i+1, m.uid, section, len(body), body)
+				}
+			}
+			reply("* %d FETCH (FLAGS (\\Seen))", len(f.messages))
+			reply("%s OK fetch done", tag)
+		case strings.HasPrefix(cmd, "LOGOUT"):
+			reply("* BYE")
+			reply("%s OK bye", tag)
+			_ = w.Flush()
+			return
+		default:
+			reply("%s BAD unknown command", tag)
+		}
+		_ = w.Flush()
+	}
+}
+
+func newTestClient(f *fakeServer, limit int) *Client {
+	return &Client{
+		mailbox:          "INBOX",
+		username:         "user@example.com",
+		password:         `p"ss`,
+		initialSyncLimit: limit,
+		dial: func(context.Context) (net.Conn, error) {
+			client, server := net.Pipe()
+			go f.serve(server)
+			return client, nil
+		},
+	}
+}
+
+func rawMessage(id string, refs string, subject string) string {
+	headers := "From: Ada <ada@example.com>\r\nTo: support@example.com\r\nSubject: " + subject + "\r\nMessage-ID: " + id + "\r\n"
+	if refs != "" {
+		headers += "References: " + refs + "\r\n"
+	}
+	return headers + "\r\nHello\r\n"
+}
+
+func TestFetchChangesInitialSyncTakesMostRecent(t *testing.T) {
+	f := &fakeServer{uidValidity: 7, messages: []fakeMessage{
+		{uid: 3, raw: rawMessage("<a@x>", "", "one")},
+		{uid: 5, raw: rawMessage("<b@x>", "", "two")},
+		{uid: 9, raw: rawMessage("<c@x>", "<b@x>", "Re: two")},
+	}}
+	emails, state, err := newTestClient(f, 2).FetchChanges(context.Background(), "")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if state != "7:9" {
+		t.Fatalf("expected state 7:9, got %q", state)
+	}
+	if len(emails) != 2 || emails[0].ID != "<b@x>" || emails[1].ID != "<c@x>" {
+		t.Fatalf("unexpected emails: %+v", emails)
+	}
+	if emails[1].ThreadID != "<b@x>" {
+		t.Fatalf("expected reply threaded under <b@x>, got %q", emails[1].ThreadID)
+	}
+	if f.commands[0] != `LOGIN "user@example.com" "p\"ss"` {
+		t.Fatalf("unexpected login command %q", f.commands[0])
+	}
+}
+
+func TestFetchChangesIncremental(t *testing.T) {
+	f := &fakeServer{uidValidity: 7, messages: []fakeMessage{
+		{uid: 9, raw: rawMessage("<c@x>", "", "three")},
+		{uid: 12, raw: rawMessage("<d@x>", "", "four")},
+	}}
+	emails, state, err := newTestClient(f, 50).FetchChanges(context.Background(), "7:9")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if state != "7:12" || len(emails) != 1 || emails[0].Subject != "four" {
+		t.Fatalf("unexpected result state=%q emails=%+v", state, emails)
+	}
+
+	emails, state, err = newTestClient(f, 50).FetchChanges(context.Background(), state)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if state != "7:12" || len(emails) != 0 {
+		t.Fatalf("expected no new mail, got state=%q emails=%+v", state, emails)
+	}
+}
+
+func TestFetchChangesResyncsOnUIDValidityChange(t *testing.T) {
+	f := &fakeServer{uidValidity: 8, messages: []fakeMessage{
+		{uid: 1, raw: rawMessage("<a@x>", "", "one")},
+	}}
+	emails, state, err := newTestClient(f, 50).FetchChanges(context.Background(), "7:40")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if state != "8:1" || len(emails) != 1 {
+		t.Fatalf("expected resync, got state=%q emails=%+v", state, emails)
+	}
+}
+
+func TestFetchChangesSkipsPastDamagedMessages(t *testing.T) {
+	defer func(limit int) { maxLiteralSize = limit }(maxLiteralSize)
+	maxLiteralSize = 1024
+
+	huge := rawMessage("<huge@x>", "", "attachment") + strings.Repeat("x", 2048)
+	f := &fakeServer{uidValidity: 7, messages: []fakeMessage{
+		{uid: 10, raw: rawMessage("<a@x>", "", "one")},
+		{uid: 11, raw: "not a header line\r\n\r\nbody\r\n"},
+		{uid: 12, raw: huge},
+		{uid: 13, raw: rawMessage("<d@x>", "", "four")},
+	}}
+	emails, state, err := newTestClient(f, 50).FetchChanges(context.Background(), "7:9")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if state != "7:13" {
+		t.Fatalf("expected the checkpoint past every message, got %q", state)
+	}
+	if len(emails) != 4 || emails[0].ID != "<a@x>" || emails[3].ID != "<d@x>" || emails[0].Oversized || emails[3].Oversized {
+		t.Fatalf("expected the good messages ingested as usual, got %+v", emails)
+	}
+	malformed := emails[1]
+	if malformed.ID != "uid:7:11" || !malformed.Oversized || malformed.Text != "" || string(malformed.Raw) != f.messages[1].raw {
+		t.Fatalf("expected the malformed message kept raw and flagged, got %+v", malformed)
+	}
+	large := emails[2]
+	if large.ID != "<huge@x>" || large.Subject != "attachment" || !large.Oversized || large.Text != "" || large.Raw != nil {
+		t.Fatalf("expected the oversized message stored from its header, got %+v", large)
+	}
+}
+
+func TestParseState(t *testing.T) {
+	if v, u, ok := ParseState(FormatState(4294967295, 12)); !ok || v != 4294967295 || u != 12 {
+		t.Fatalf("round trip failed: %d %d %t", v, u, ok)
+	}
+	for _, state := range []string{"", "jmap-state", "1:x", "x:1"} {
+		if _, _, ok := ParseState(state); ok {
+			t.Fatalf("expected %q to be rejected", state)
+		}
+	}
+}
+
+func TestToEmailFallsBackToUID(t *testing.T) {
+	raw := "From: a@example.com\r\nIn-Reply-To: <root@x>\r\nSubject: hi\r\n\r\nbody\r\n"
+	received := time.Date(2026, 3, 5, 10, 0, 0, 0, time.UTC)
+	email, err := toEmail([]byte(raw), 7, 42, received)
+	if err != nil {
+		t.Fatalf("toEmail: %v", err)
+	}
+	if email.ID != "uid:7:42" || email.ThreadID != "<root@x>" || !email.ReceivedAt.Equal(received) {
+		t.Fatalf("unexpected email: %+v", email)
+	}
+}
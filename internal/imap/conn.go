@@ -0,0 +1,261 @@
+package imap
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLiteralSize bounds a single literal so a misbehaving server cannot make
+// us buffer arbitrarily large payloads. Larger literals are read past and
+// left out; see readResponse.
+var maxLiteralSize = 50 << 20
+
+var literalSuffix = regexp.MustCompile(`\{(\d+)\+?\}$`)
+
+// response is one server response with literals pulled out of the line; the
+// text keeps the {n} markers so callers can tell where each literal sat.
+type response struct {
+	text     string
+	literals [][]byte
+}
+
+// conn speaks the small subset of IMAP4rev1 needed for read-only sync.
+type conn struct {
+	nc      net.Conn
+	r       *bufio.Reader
+	tag     int
+	timeout time.Duration
+}
+
+func newConn(nc net.Conn, timeout time.Duration) (*conn, error) {
+	c := &conn{nc: nc, r: bufio.NewReader(nc), timeout: timeout}
+	greeting, err := c.readResponse()
+	if err != nil {
+		return nil, fmt.Errorf("imap greeting: %w", err)
+	}
+	if !strings.HasPrefix(greeting.text, "* OK") && !strings.HasPrefix(greeting.text, "* PREAUTH") {
+		return nil, fmt.Errorf("imap greeting: %s", greeting.text)
+	}
+	return c, nil
+}
+
+func (c *conn) Close() error {
+	return c.nc.Close()
+}
+
+// command sends a tagged command and collects untagged responses until the
+// matching tagged completion. A NO or BAD completion is returned as an error.
+func (c *conn) command(format string, args ...any) ([]response, error) {
+	c.tag++
+	tag := "a" + strconv.Itoa(c.tag)
+	line := fmt.Sprintf(format, args...)
+	if c.timeout > 0 {
+		_ = c.nc.SetDeadline(time.Now().Add(c.timeout))
+	}
+	if _, err := io.WriteString(c.nc, tag+" "+line+"\r\n"); err != nil {
+		return nil, err
+	}
+
+	var untagged []response
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return untagged, err
+		}
+		if strings.HasPrefix(resp.text, tag+" ") {
+			status := strings.TrimPrefix(resp.text, tag+" ")
+			if !strings.HasPrefix(status, "OK") {
+				verb, _, _ := strings.Cut(line, " ")
+				return untagged, fmt.Errorf("imap %s: %s", verb, status)
+			}
+			return untagged, nil
+		}
+		if strings.HasPrefix(resp.text, "+") {
+			return untagged, errors.New("imap: unexpected continuation request")
+		}
+		untagged = append(untagged, resp)
+	}
+}
+
+func (c *conn) readResponse() (response, error) {
+	var resp response
+	var text strings.Builder
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return resp, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		text.WriteString(line)
+
+		m := literalSuffix.FindStringSubmatch(line)
+		if m == nil {
+			resp.text = text.String()
+			return resp, nil
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return resp, fmt.Errorf("imap: invalid literal size %q", m[1])
+		}
+		if n > maxLiteralSize {
+			// Discarding it keeps the connection usable; the caller finds
+			// a nil literal in its place.
+			if _, err := io.CopyN(io.Discard, c.r, int64(n)); err != nil {
+				return resp, err
+			}
+			resp.literals = append(resp.literals, nil)
+			continue
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return resp, err
+		}
+		resp.literals = append(resp.literals, buf)
+	}
+}
+
+// quote renders s as an IMAP quoted string. CR and LF cannot be quoted.
+func quote(s string) (string, error) {
+	if strings.ContainsAny(s, "\r\n") {
+		return "", errors.New("imap: value contains line break")
+	}
+	var b bytes.Buffer
+	b.WriteByte('"')
+	for _, r := range s {
+		if r == '"' || r == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String(), nil
+}
+
+func (c *conn) login(username, password string) error {
+	user, err := quote(username)
+	if err != nil {
+		return err
+	}
+	pass, err := quote(password)
+	if err != nil {
+		return err
+	}
+	_, err = c.command("LOGIN %s %s", user, pass)
+	return err
+}
+
+var uidValidityCode = regexp.MustCompile(`\[UIDVALIDITY (\d+)\]`)
+
+// examine opens the mailbox read-only and returns its UIDVALIDITY.
+func (c *conn) examine(mailbox string) (uint32, error) {
+	name, err := quote(mailbox)
+	if err != nil {
+		return 0, err
+	}
+	resps, err := c.command("EXAMINE %s", name)
+	if err != nil {
+		return 0, err
+	}
+	for _, resp := range resps {
+		if m := uidValidityCode.FindStringSubmatch(resp.text); m != nil {
+			v, err := strconv.ParseUint(m[1], 10, 32)
+			if err != nil {
+				return 0, fmt.Errorf("imap: invalid UIDVALIDITY %q", m[1])
+			}
+			return uint32(v), nil
+		}
+	}
+	return 0, errors.New("imap: server did not report UIDVALIDITY")
+}
+
+// searchUIDs runs UID SEARCH with the given criteria and returns the UIDs in
+// ascending order.
+func (c *conn) searchUIDs(criteria string) ([]uint32, error) {
+	resps, err := c.command("UID SEARCH %s", criteria)
+	if err != nil {
+		return nil, err
+	}
+	var uids []uint32
+	for _, resp := range resps {
+		rest, ok := strings.CutPrefix(resp.text, "* SEARCH")
+		if !ok {
+			continue
+		}
+		for _, field := range strings.Fields(rest) {
+			v, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("imap: invalid search result %q", field)
+			}
+			uids = append(uids, uint32(v))
+		}
+	}
+	slices.Sort(uids)
+	return uids, nil
+}
+
+// fetched is one message returned by fetchMessages. raw is nil for a
+// message over maxLiteralSize.
+type fetched struct {
+	uid          uint32
+	internalDate time.Time
+	raw          []byte
+}
+
+var (
+	fetchUID          = regexp.MustCompile(`\bUID (\d+)`)
+	fetchInternalDate = regexp.MustCompile(`INTERNALDATE "([^"]+)"`)
+)
+
+const internalDateLayout = "_2-Jan-2006 15:04:05 -0700"
+
+// fetchMessages downloads section of each message without setting \Seen:
+// "" for the full RFC 5322 message, "HEADER" for its header. Unsolicited
+// FETCH responses (flag updates) carry no body and are skipped.
+func (c *conn) fetchMessages(uids []uint32, section string) ([]fetched, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	set := make([]string, len(uids))
+	for i, uid := range uids {
+		set[i] = strconv.FormatUint(uint64(uid), 10)
+	}
+	resps, err := c.command("UID FETCH %s (UID INTERNALDATE BODY.PEEK[%s])", strings.Join(set, ","), section)
+	if err != nil {
+		return nil, err
+	}
+	var out []fetched
+	for _, resp := range resps {
+		if !strings.Contains(resp.text, " FETCH ") || len(resp.literals) == 0 || !strings.Contains(resp.text, "BODY["+section+"]") {
+			continue
+		}
+		m := fetchUID.FindStringSubmatch(resp.text)
+		if m == nil {
+			continue
+		}
+		uid, err := strconv.ParseUint(m[1], 10, 32)
+		if err != nil {
+			continue
+		}
+		item := fetched{uid: uint32(uid), raw: resp.literals[len(resp.literals)-1]}
+		if d := fetchInternalDate.FindStringSubmatch(resp.text); d != nil {
+			if t, err := time.Parse(internalDateLayout, d[1]); err == nil {
+				item.internalDate = t.UTC()
+			}
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+func (c *conn) logout() {
+	_, _ = c.command("LOGOUT")
+}
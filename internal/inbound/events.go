@@ -0,0 +1,332 @@
+package inbound
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/outbox"
+)
+
+// EventProvider authenticates one outbound transport's delivery event
+// webhook requests and normalizes their payload.
+type EventProvider interface {
+	Name() string
+	// ParseEvents returns the events req reports, none for a request that
+	// carries no delivery events.
+	ParseEvents(req *http.Request) ([]outbox.Event, error)
+}
+
+// EventReceiver serves POST /events/{provider}, the delivery events of the
+// outbound transports, for each configured provider. Apply records one
+// event wherever its message was sent from.
+type EventReceiver struct {
+	Apply     func(ctx context.Context, ev outbox.Event) error
+	providers map[string]EventProvider
+}
+
+// NewEventReceiver enables the providers whose webhook credentials
+// cfg.Outbound sets.
+func NewEventReceiver(cfg config.Config, apply func(ctx context.Context, ev outbox.Event) error) (*EventReceiver, error) {
+	r := &EventReceiver{Apply: apply}
+	if len(cfg.Outbound.SESEventTopicARNs) > 0 {
+		r.Register(&SESEvents{SNS: NewSES(cfg.Outbound.SESEventTopicARNs)})
+	}
+	if cfg.Outbound.SendGridWebhookPublicKey != "" {
+		sg, err := NewSendGridEvents(cfg.Outbound.SendGridWebhookPublicKey)
+		if err != nil {
+			return nil, err
+		}
+		r.Register(sg)
+	}
+	if cfg.Outbound.PostmarkWebhookUsername != "" && cfg.Outbound.PostmarkWebhookPassword != "" {
+		r.Register(&PostmarkEvents{Username: cfg.Outbound.PostmarkWebhookUsername, Password: cfg.Outbound.PostmarkWebhookPassword})
+	}
+	return r, nil
+}
+
+// Register serves p at /events/{p.Name()}.
+func (r *EventReceiver) Register(p EventProvider) {
+	if r.providers == nil {
+		r.providers = map[string]EventProvider{}
+	}
+	r.providers[p.Name()] = p
+}
+
+// Providers returns the names of the enabled providers, sorted.
+func (r *EventReceiver) Providers() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (r *EventReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	name, _, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/events/"), "/")
+	provider, ok := r.providers[name]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	req.Body = http.MaxBytesReader(w, req.Body, maxEventBytes)
+	events, err := provider.ParseEvents(req)
+	if err != nil {
+		if errors.Is(err, ErrUnauthorized) {
+			slog.WarnContext(req.Context(), "delivery event request rejected", "provider", provider.Name(), "err", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		slog.WarnContext(req.Context(), "delivery event invalid payload", "provider", provider.Name(), "err", err)
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	for _, ev := range events {
+		if err := r.Apply(req.Context(), ev); err != nil {
+			// Applying an event twice is harmless, so the provider's retry
+			// of the whole batch is safe.
+			slog.ErrorContext(req.Context(), "delivery event failed", "provider", provider.Name(), "message", ev.ProviderMessageID, "err", err)
+			http.Error(w, "event failed", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+// maxEventBytes bounds an event webhook request; SendGrid batches events,
+// but a batch stays well under this.
+const maxEventBytes = 4 << 20
+
+// SESEvents receives SES delivery, bounce, complaint and delay events,
+// published to SNS by a configuration set's event destination or by the
+// identity's notification topics.
+type SESEvents struct {
+	SNS *SES
+}
+
+func (s *SESEvents) Name() string { return outbox.TransportSES }
+
+type sesRecipient struct {
+	EmailAddress   string `json:"emailAddress"`
+	DiagnosticCode string `json:"diagnosticCode"`
+}
+
+type sesEvent struct {
+	NotificationType string `json:"notificationType"`
+	EventType        string `json:"eventType"`
+	Mail             struct {
+		MessageID string `json:"messageId"`
+	} `json:"mail"`
+	Delivery struct {
+		Recipients []string `json:"recipients"`
+	} `json:"delivery"`
+	Bounce struct {
+		BounceType        string         `json:"bounceType"`
+		BounceSubType     string         `json:"bounceSubType"`
+		BouncedRecipients []sesRecipient `json:"bouncedRecipients"`
+	} `json:"bounce"`
+	Complaint struct {
+		ComplaintFeedbackType string         `json:"complaintFeedbackType"`
+		ComplainedRecipients  []sesRecipient `json:"complainedRecipients"`
+	} `json:"complaint"`
+	DeliveryDelay struct {
+		DelayType         string         `json:"delayType"`
+		DelayedRecipients []sesRecipient `json:"delayedRecipients"`
+	} `json:"deliveryDelay"`
+}
+
+func (s *SESEvents) ParseEvents(req *http.Request) ([]outbox.Event, error) {
+	message, ok, err := s.SNS.notification(req)
+	if !ok {
+		return nil, err
+	}
+	var n sesEvent
+	if err := json.Unmarshal([]byte(message), &n); err != nil {
+		return nil, fmt.Errorf("ses event: %w", err)
+	}
+	kind := n.EventType
+	if kind == "" {
+		kind = n.NotificationType
+	}
+	base := outbox.Event{Transport: outbox.TransportSES, ProviderMessageID: n.Mail.MessageID}
+	var events []outbox.Event
+	add := func(kind, recipient, detail string, permanent bool) {
+		ev := base
+		ev.Kind, ev.Recipient, ev.Detail, ev.Permanent = kind, recipient, detail, permanent
+		events = append(events, ev)
+	}
+	switch kind {
+	case "Delivery":
+		for _, rcpt := range n.Delivery.Recipients {
+			add(outbox.EventDelivered, rcpt, "", false)
+		}
+	case "Bounce":
+		permanent := n.Bounce.BounceType == "Permanent"
+		for _, rcpt := range n.Bounce.BouncedRecipients {
+			detail := strings.TrimSpace(n.Bounce.BounceType + " " + n.Bounce.BounceSubType + " " + rcpt.DiagnosticCode)
+			add(outbox.EventBounced, rcpt.EmailAddress, detail, permanent)
+		}
+	case "Complaint":
+		for _, rcpt := range n.Complaint.ComplainedRecipients {
+			add(outbox.EventComplained, rcpt.EmailAddress, n.Complaint.ComplaintFeedbackType, false)
+		}
+	case "DeliveryDelay":
+		for _, rcpt := range n.DeliveryDelay.DelayedRecipients {
+			add(outbox.EventDeferred, rcpt.EmailAddress, strings.TrimSpace(n.DeliveryDelay.DelayType+" "+rcpt.DiagnosticCode), false)
+		}
+	}
+	return events, nil
+}
+
+// SendGridEvents receives SendGrid's signed event webhook. Every request is
+// checked against PublicKey, the webhook's ECDSA verification key.
+type SendGridEvents struct {
+	PublicKey *ecdsa.PublicKey
+}
+
+// NewSendGridEvents parses the verification key as SendGrid shows it:
+// base64 of the DER public key.
+func NewSendGridEvents(publicKey string) (*SendGridEvents, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil {
+		return nil, fmt.Errorf("sendgrid webhook public key: %w", err)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("sendgrid webhook public key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("sendgrid webhook public key is not an ECDSA key")
+	}
+	return &SendGridEvents{PublicKey: key}, nil
+}
+
+func (s *SendGridEvents) Name() string { return outbox.TransportSendGrid }
+
+type sendGridEvent struct {
+	Email       string `json:"email"`
+	Event       string `json:"event"`
+	SGMessageID string `json:"sg_message_id"`
+	Type        string `json:"type"`
+	Reason      string `json:"reason"`
+	Response    string `json:"response"`
+	Status      string `json:"status"`
+}
+
+func (s *SendGridEvents) ParseEvents(req *http.Request) ([]outbox.Event, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(req.Header.Get("X-Twilio-Email-Event-Webhook-Signature"))
+	if err != nil || len(sig) == 0 {
+		return nil, fmt.Errorf("%w: missing signature", ErrUnauthorized)
+	}
+	digest := sha256.Sum256(append([]byte(req.Header.Get("X-Twilio-Email-Event-Webhook-Timestamp")), body...))
+	if !ecdsa.VerifyASN1(s.PublicKey, digest[:], sig) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrUnauthorized)
+	}
+	var in []sendGridEvent
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	var events []outbox.Event
+	for _, e := range in {
+		// sg_message_id is the X-Message-Id of the send, then a dot and
+		// the ID of the message to this recipient.
+		id, _, _ := strings.Cut(e.SGMessageID, ".")
+		ev := outbox.Event{Transport: outbox.TransportSendGrid, ProviderMessageID: id, Recipient: e.Email}
+		detail := strings.TrimSpace(e.Status + " " + firstNonEmpty(e.Reason, e.Response))
+		switch e.Event {
+		case "delivered":
+			ev.Kind = outbox.EventDelivered
+		case "deferred":
+			ev.Kind, ev.Detail = outbox.EventDeferred, detail
+		case "bounce":
+			// A block is a refusal that may clear up; a bounce is for good.
+			ev.Kind, ev.Detail, ev.Permanent = outbox.EventBounced, detail, e.Type != "blocked"
+		case "dropped":
+			// SendGrid drops mail to addresses it has seen bounce or
+			// complain before, without trying.
+			ev.Kind, ev.Detail, ev.Permanent = outbox.EventBounced, "dropped: "+e.Reason, true
+		case "spamreport":
+			ev.Kind = outbox.EventComplained
+		default:
+			continue
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// PostmarkEvents receives Postmark delivery, bounce and spam complaint
+// webhooks, authenticated by the basic auth credentials in their URL.
+type PostmarkEvents struct {
+	Username string
+	Password string
+}
+
+func (p *PostmarkEvents) Name() string { return outbox.TransportPostmark }
+
+type postmarkEvent struct {
+	RecordType  string `json:"RecordType"`
+	MessageID   string `json:"MessageID"`
+	Recipient   string `json:"Recipient"`
+	Email       string `json:"Email"`
+	Type        string `json:"Type"`
+	Inactive    bool   `json:"Inactive"`
+	Description string `json:"Description"`
+	Details     string `json:"Details"`
+}
+
+func (p *PostmarkEvents) ParseEvents(req *http.Request) ([]outbox.Event, error) {
+	if !basicAuthMatches(req, p.Username, p.Password) {
+		return nil, ErrUnauthorized
+	}
+	var e postmarkEvent
+	if err := json.NewDecoder(req.Body).Decode(&e); err != nil {
+		return nil, err
+	}
+	ev := outbox.Event{Transport: outbox.TransportPostmark, ProviderMessageID: e.MessageID, Recipient: firstNonEmpty(e.Recipient, e.Email)}
+	switch e.RecordType {
+	case "Delivery":
+		ev.Kind = outbox.EventDelivered
+	case "Bounce":
+		// Postmark deactivates the recipient after a hard bounce; any
+		// bounce that did so will not be retried.
+		ev.Kind, ev.Permanent = outbox.EventBounced, e.Type == "HardBounce" || e.Inactive
+		ev.Detail = strings.TrimSpace(e.Type + " " + firstNonEmpty(e.Details, e.Description))
+	case "SpamComplaint":
+		ev.Kind = outbox.EventComplained
+	default:
+		return nil, nil
+	}
+	return []outbox.Event{ev}, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
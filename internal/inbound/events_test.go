@@ -0,0 +1,108 @@
+package inbound
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"neuralmail/internal/outbox"
+)
+
+func TestSendGridEventsVerifySignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	sg, err := NewSendGridEvents(base64.StdEncoding.EncodeToString(der))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const body = `[
+		{"email": "ann@example.com", "event": "delivered", "sg_message_id": "abc123.filter0001.1.0"},
+		{"email": "bob@example.com", "event": "bounce", "type": "bounce", "status": "5.1.1", "reason": "no such user", "sg_message_id": "abc123.filter0001.2.0"},
+		{"email": "cy@example.com", "event": "bounce", "type": "blocked", "status": "4.7.0", "reason": "try later", "sg_message_id": "abc123.filter0001.3.0"},
+		{"email": "di@example.com", "event": "spamreport", "sg_message_id": "abc123.filter0001.4.0"},
+		{"email": "ed@example.com", "event": "open", "sg_message_id": "abc123.filter0001.5.0"}
+	]`
+	const timestamp = "1700000000"
+	post := func(sign string) ([]outbox.Event, error) {
+		req := httptest.NewRequest(http.MethodPost, "/events/sendgrid", strings.NewReader(body))
+		req.Header.Set("X-Twilio-Email-Event-Webhook-Timestamp", timestamp)
+		digest := sha256.Sum256([]byte(sign))
+		sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Twilio-Email-Event-Webhook-Signature", base64.StdEncoding.EncodeToString(sig))
+		return sg.ParseEvents(req)
+	}
+
+	if _, err := post(timestamp + body + " "); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected a tampered payload to be refused, got %v", err)
+	}
+	events, err := post(timestamp + body)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := []outbox.Event{
+		{Transport: "sendgrid", ProviderMessageID: "abc123", Kind: outbox.EventDelivered, Recipient: "ann@example.com"},
+		{Transport: "sendgrid", ProviderMessageID: "abc123", Kind: outbox.EventBounced, Recipient: "bob@example.com", Permanent: true, Detail: "5.1.1 no such user"},
+		{Transport: "sendgrid", ProviderMessageID: "abc123", Kind: outbox.EventBounced, Recipient: "cy@example.com", Detail: "4.7.0 try later"},
+		{Transport: "sendgrid", ProviderMessageID: "abc123", Kind: outbox.EventComplained, Recipient: "di@example.com"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("event %d: expected %+v, got %+v", i, want[i], events[i])
+		}
+	}
+}
+
+func TestEventReceiverAppliesPostmarkEvents(t *testing.T) {
+	var applied []outbox.Event
+	r := &EventReceiver{Apply: func(_ context.Context, ev outbox.Event) error {
+		applied = append(applied, ev)
+		return nil
+	}}
+	r.Register(&PostmarkEvents{Username: "nerve", Password: "s3cret"})
+
+	serve := func(path, body string, auth bool) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if auth {
+			req.SetBasicAuth("nerve", "s3cret")
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	const bounce = `{"RecordType": "Bounce", "MessageID": "pm-1", "Email": "bob@example.com", "Type": "HardBounce", "Inactive": true, "Details": "smtp;550 5.1.1 unknown"}`
+	if code := serve("/events/sendgrid", bounce, true); code != http.StatusNotFound {
+		t.Fatalf("expected unconfigured provider to 404, got %d", code)
+	}
+	if code := serve("/events/postmark", bounce, false); code != http.StatusUnauthorized {
+		t.Fatalf("expected missing credentials to 401, got %d", code)
+	}
+	if code := serve("/events/postmark", bounce, true); code != http.StatusOK {
+		t.Fatalf("expected bounce to be accepted, got %d", code)
+	}
+	if code := serve("/events/postmark", `{"RecordType": "Open", "MessageID": "pm-1"}`, true); code != http.StatusOK {
+		t.Fatalf("expected an unused record type to be acknowledged, got %d", code)
+	}
+	want := outbox.Event{Transport: "postmark", ProviderMessageID: "pm-1", Kind: outbox.EventBounced, Recipient: "bob@example.com", Permanent: true, Detail: "HardBounce smtp;550 5.1.1 unknown"}
+	if len(applied) != 1 || applied[0] != want {
+		t.Fatalf("expected the hard bounce to be applied, got %+v", applied)
+	}
+}
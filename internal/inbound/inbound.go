@@ -0,0 +1,228 @@
+// Package inbound receives mail that providers push to us by webhook, Amazon
+// SES through SNS, Mailgun routes and Postmark inbound, and stores it through
+// the same ingest pipeline polled inboxes use. It runs as its own
+// `neuralmaild inbound-webhook` process so it can be scaled apart from the
+// MCP runtime.
+package inbound
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/ingest"
+	"neuralmail/internal/jmap"
+	"neuralmail/internal/store"
+)
+
+// ErrUnauthorized is returned by Provider.Parse for a request whose
+// signature or credentials do not check out.
+var ErrUnauthorized = errors.New("inbound webhook authentication failed")
+
+// Delivery is one message a provider pushed, with the envelope recipients it
+// was delivered to.
+type Delivery struct {
+	Recipients []string
+	Email      jmap.Email
+}
+
+// Provider authenticates one provider's webhook requests and normalizes
+// their payload.
+type Provider interface {
+	Name() string
+	// Parse returns the mail req delivers, none for a notification that
+	// carries no mail.
+	Parse(req *http.Request) ([]Delivery, error)
+}
+
+// Directory resolves a recipient address to the inbox that receives it and
+// keeps a record of each routing decision; the home *store.Store satisfies
+// it.
+type Directory interface {
+	ResolveInboxAddress(ctx context.Context, address string) (inboxID string, alias string, err error)
+	GetDomainRouting(ctx context.Context, domain string) (store.DomainRouting, error)
+	RecordRoutingDecision(ctx context.Context, d store.RoutingDecision) error
+}
+
+// Nonces remembers the one-time values signed requests carry, so each is
+// accepted once; *queue.Queue satisfies it.
+type Nonces interface {
+	ClaimNonce(ctx context.Context, scope string, nonce string, ttl time.Duration) (bool, error)
+	ReleaseNonce(ctx context.Context, scope string, nonce string) error
+}
+
+// retryable is implemented by providers that accept each signed request
+// once; Forget lets the provider retry a request whose mail was not stored.
+type retryable interface {
+	Forget(req *http.Request)
+}
+
+// Receiver serves POST /inbound/{provider} for each configured provider.
+// Anything after the provider name is ignored, so a Mailgun route can post
+// to /inbound/mailgun/mime.
+type Receiver struct {
+	Directory       Directory
+	Pipeline        *ingest.Pipeline
+	MaxMessageBytes int64
+	providers       map[string]Provider
+}
+
+// NewReceiver enables the providers whose credentials cfg.Inbound sets.
+// nonces keeps Mailgun's request tokens, whose signature does not cover the
+// mail, from being replayed.
+func NewReceiver(cfg config.Config, directory Directory, pipeline *ingest.Pipeline, nonces Nonces) *Receiver {
+	r := &Receiver{Directory: directory, Pipeline: pipeline, MaxMessageBytes: cfg.Inbound.MaxMessageBytes}
+	if len(cfg.Inbound.SESTopicARNs) > 0 {
+		r.Register(NewSES(cfg.Inbound.SESTopicARNs))
+	}
+	if cfg.Inbound.MailgunSigningKey != "" {
+		mailgun := NewMailgun(cfg.Inbound.MailgunSigningKey)
+		mailgun.Nonces = nonces
+		r.Register(mailgun)
+	}
+	if cfg.Inbound.PostmarkUsername != "" && cfg.Inbound.PostmarkPassword != "" {
+		r.Register(NewPostmark(cfg.Inbound.PostmarkUsername, cfg.Inbound.PostmarkPassword))
+	}
+	return r
+}
+
+// Register serves p at /inbound/{p.Name()}.
+func (r *Receiver) Register(p Provider) {
+	if r.providers == nil {
+		r.providers = map[string]Provider{}
+	}
+	r.providers[p.Name()] = p
+}
+
+// Providers returns the names of the enabled providers, sorted.
+func (r *Receiver) Providers() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	name, _, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/inbound/"), "/")
+	provider, ok := r.providers[name]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if r.MaxMessageBytes > 0 {
+		req.Body = http.MaxBytesReader(w, req.Body, r.MaxMessageBytes)
+	}
+	deliveries, err := provider.Parse(req)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.Is(err, ErrUnauthorized):
+			slog.WarnContext(req.Context(), "inbound request rejected", "provider", provider.Name(), "err", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		case errors.As(err, &tooLarge):
+			http.Error(w, "message too large", http.StatusRequestEntityTooLarge)
+		default:
+			slog.WarnContext(req.Context(), "inbound invalid payload", "provider", provider.Name(), "err", err)
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+		}
+		return
+	}
+	for _, d := range deliveries {
+		if err := r.deliver(req.Context(), provider.Name(), d); err != nil {
+			// A non-2xx answer makes the provider retry; ingest is
+			// idempotent per message, so a partial delivery is safe to redo.
+			slog.ErrorContext(req.Context(), "inbound ingest failed", "provider", provider.Name(), "message", d.Email.ID, "err", err)
+			if p, ok := provider.(retryable); ok {
+				p.Forget(req)
+			}
+			http.Error(w, "ingest failed", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+// deliver ingests d into every inbox one of its recipients routes to, and
+// records each recipient's routing decision. Mail no recipient routes is
+// dropped, so the provider does not retry it.
+func (r *Receiver) deliver(ctx context.Context, provider string, d Delivery) error {
+	email := d.Email
+	if email.ID == "" {
+		email.ID = provider + ":" + contentID(email)
+	}
+	if email.ThreadID == "" {
+		email.ThreadID = email.ID
+	}
+	if email.ReceivedAt.IsZero() {
+		email.ReceivedAt = time.Now().UTC()
+	}
+
+	var inboxIDs []string
+	for _, rcpt := range d.Recipients {
+		decision, err := route(ctx, r.Directory, rcpt)
+		if err != nil {
+			return err
+		}
+		decision.Provider, decision.MessageID = provider, email.ID
+		// The record is for debugging; losing one must not make the provider
+		// redeliver the message.
+		if err := r.Directory.RecordRoutingDecision(ctx, decision); err != nil {
+			slog.WarnContext(ctx, "inbound routing decision not recorded", "provider", provider, "recipient", decision.Recipient, "err", err)
+		}
+		if decision.InboxID != "" && !slices.Contains(inboxIDs, decision.InboxID) {
+			inboxIDs = append(inboxIDs, decision.InboxID)
+		}
+	}
+	if len(inboxIDs) == 0 {
+		slog.WarnContext(ctx, "inbound no inbox for recipients", "provider", provider, "recipients", d.Recipients, "message", email.ID)
+		return nil
+	}
+	for _, inboxID := range inboxIDs {
+		if _, err := r.Pipeline.Ingest(ctx, deliveredClient{name: provider, email: email}, inboxID, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contentID identifies mail that has neither a Message-ID nor a provider
+// message ID by its content, so a provider's retry of it is stored once:
+// the raw message when the provider sent it, its parsed fields otherwise.
+func contentID(email jmap.Email) string {
+	h := sha256.New()
+	if len(email.Raw) > 0 {
+		h.Write(email.Raw)
+	} else {
+		fields, _ := json.Marshal([]any{email.From, email.To, email.Subject, email.ReceivedAt, email.InReplyTo, email.Text, email.HTML})
+		h.Write(fields)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// deliveredClient hands the ingest pipeline a message that was pushed to
+// us, as if a sync client had fetched it.
+type deliveredClient struct {
+	name  string
+	email jmap.Email
+}
+
+func (c deliveredClient) FetchChanges(_ context.Context, _ string) ([]jmap.Email, string, error) {
+	return []jmap.Email{c.email}, "", nil
+}
+
+func (c deliveredClient) Name() string { return c.name }
@@ -0,0 +1,374 @@
+package inbound
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"neuralmail/internal/jmap"
+	"neuralmail/internal/store"
+)
+
+const rawMessage = "From: Ann <ann@example.com>\r\n" +
+	"To: support@acme.test\r\n" +
+	"Subject: Order 42\r\n" +
+	"Message-ID: <m42@example.com>\r\n" +
+	"Date: Mon, 02 Jan 2006 15:04:05 +0000\r\n" +
+	"\r\n" +
+	"Where is my order?\r\n"
+
+func TestSESVerifiesSignature(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "sns.amazonaws.com"}, NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	const topic = "arn:aws:sns:us-east-1:123456789012:inbound"
+	const certURL = "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-1.pem"
+	ses := NewSES([]string{topic})
+	ses.certs[certURL] = cert
+	now := time.Date(2006, 1, 2, 15, 5, 0, 0, time.UTC)
+	ses.Now = func() time.Time { return now }
+
+	notification, _ := json.Marshal(map[string]any{
+		"notificationType": "Received",
+		"mail":             map[string]any{"messageId": "ses-1", "timestamp": "2006-01-02T15:04:06Z"},
+		"receipt":          map[string]any{"recipients": []string{"support@acme.test"}, "action": map[string]any{"type": "SNS", "encoding": "BASE64"}},
+		"content":          base64.StdEncoding.EncodeToString([]byte(rawMessage)),
+	})
+	sign := func(msg snsMessage) snsMessage {
+		digest := sha256.Sum256([]byte(msg.stringToSign()))
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg.Signature = base64.StdEncoding.EncodeToString(sig)
+		return msg
+	}
+	post := func(msg snsMessage) ([]Delivery, error) {
+		body, _ := json.Marshal(msg)
+		return ses.Parse(httptest.NewRequest(http.MethodPost, "/inbound/ses", strings.NewReader(string(body))))
+	}
+	msg := sign(snsMessage{
+		Type: "Notification", MessageID: "sns-1", TopicArn: topic, Message: string(notification),
+		Timestamp: "2006-01-02T15:04:07.000Z", SignatureVersion: "2", SigningCertURL: certURL,
+	})
+
+	deliveries, err := post(msg)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Recipients[0] != "support@acme.test" {
+		t.Fatalf("expected one delivery to support@acme.test, got %+v", deliveries)
+	}
+	if email := deliveries[0].Email; email.Subject != "Order 42" || email.ID != "<m42@example.com>" || email.From.Email != "ann@example.com" {
+		t.Fatalf("unexpected email %+v", email)
+	}
+
+	tampered := msg
+	tampered.Message = strings.Replace(msg.Message, "support@acme.test", "billing@acme.test", 1)
+	if _, err := post(tampered); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected tampered message to be refused, got %v", err)
+	}
+	other := sign(snsMessage{
+		Type: "Notification", MessageID: "sns-2", TopicArn: "arn:aws:sns:us-east-1:999999999999:other", Message: string(notification),
+		Timestamp: "2006-01-02T15:04:07.000Z", SignatureVersion: "2", SigningCertURL: certURL,
+	})
+	if _, err := post(other); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected unconfigured topic to be refused, got %v", err)
+	}
+	forged := msg
+	forged.SigningCertURL = "https://attacker.example/cert.pem"
+	if _, err := post(forged); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected certificate outside SNS to be refused, got %v", err)
+	}
+	now = now.Add(2 * time.Hour)
+	if _, err := post(msg); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected a replayed stale message to be refused, got %v", err)
+	}
+}
+
+func TestContentIDIsStableAcrossRetries(t *testing.T) {
+	raw := jmap.Email{Raw: []byte(rawMessage)}
+	if contentID(raw) != contentID(jmap.Email{Raw: []byte(rawMessage)}) {
+		t.Fatal("expected the same raw message to get the same id")
+	}
+	parsed := jmap.Email{From: store.Participant{Email: "ann@example.com"}, Subject: "Order 42", Text: "Where is my order?"}
+	again := parsed
+	if contentID(parsed) != contentID(again) {
+		t.Fatal("expected the same parsed fields to get the same id")
+	}
+	again.Text = "Where is my other order?"
+	if contentID(parsed) == contentID(again) || contentID(parsed) == contentID(raw) {
+		t.Fatal("expected different mail to get different ids")
+	}
+}
+
+func TestMailgunVerifiesSignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	mg := NewMailgun("mg-key")
+	mg.Now = func() time.Time { return now }
+
+	form := func(ts time.Time, key string) url.Values {
+		timestamp := strconv.FormatInt(ts.Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(timestamp + "tok"))
+		headers, _ := json.Marshal([][]string{
+			{"From", "Ann <ann@example.com>"},
+			{"To", "support@acme.test"},
+			{"Subject", "Order 42"},
+			{"Message-Id", "<m42@example.com>"},
+			{"In-Reply-To", "<m41@acme.test>"},
+		})
+		return url.Values{
+			"timestamp":       {timestamp},
+			"token":           {"tok"},
+			"signature":       {hex.EncodeToString(mac.Sum(nil))},
+			"recipient":       {"support@acme.test"},
+			"message-headers": {string(headers)},
+			"body-plain":      {"Where is my order?"},
+		}
+	}
+	post := func(values url.Values) ([]Delivery, error) {
+		req := httptest.NewRequest(http.MethodPost, "/inbound/mailgun", strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return mg.Parse(req)
+	}
+
+	deliveries, err := post(form(now, "mg-key"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	email := deliveries[0].Email
+	if email.Subject != "Order 42" || email.ID != "<m42@example.com>" || email.ThreadID != "<m41@acme.test>" || email.Text != "Where is my order?" {
+		t.Fatalf("unexpected email %+v", email)
+	}
+	if _, err := post(form(now, "wrong-key")); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected bad signature to be refused, got %v", err)
+	}
+	if _, err := post(form(now.Add(-time.Hour), "mg-key")); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected stale timestamp to be refused, got %v", err)
+	}
+
+	mime := form(now, "mg-key")
+	mime.Set("body-mime", rawMessage)
+	deliveries, err = post(mime)
+	if err != nil || deliveries[0].Email.Text != "Where is my order?\r\n" {
+		t.Fatalf("expected body-mime to be parsed, got %+v err=%v", deliveries, err)
+	}
+}
+
+// fakeNonces remembers claimed nonces and the ttl each was claimed for.
+type fakeNonces map[string]time.Duration
+
+func (f fakeNonces) ClaimNonce(_ context.Context, scope string, nonce string, ttl time.Duration) (bool, error) {
+	if _, ok := f[scope+":"+nonce]; ok {
+		return false, nil
+	}
+	f[scope+":"+nonce] = ttl
+	return true, nil
+}
+
+func (f fakeNonces) ReleaseNonce(_ context.Context, scope string, nonce string) error {
+	delete(f, scope+":"+nonce)
+	return nil
+}
+
+func TestMailgunRejectsReusedTokens(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	nonces := fakeNonces{}
+	mg := NewMailgun("mg-key")
+	mg.Now = func() time.Time { return now }
+	mg.Nonces = nonces
+
+	post := func(token, body string) (*http.Request, error) {
+		timestamp := strconv.FormatInt(now.Unix(), 10)
+		mac := hmac.New(sha256.New, []byte("mg-key"))
+		mac.Write([]byte(timestamp + token))
+		values := url.Values{
+			"timestamp":       {timestamp},
+			"token":           {token},
+			"signature":       {hex.EncodeToString(mac.Sum(nil))},
+			"recipient":       {"support@acme.test"},
+			"message-headers": {`[["Subject", "Order 42"]]`},
+			"body-plain":      {body},
+		}
+		req := httptest.NewRequest(http.MethodPost, "/inbound/mailgun", strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		_, err := mg.Parse(req)
+		return req, err
+	}
+
+	req, err := post("tok-1", "Where is my order?")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if ttl := nonces["mailgun:tok-1"]; ttl != 2*mg.MaxAge {
+		t.Fatalf("expected the token kept for %s, got %s", 2*mg.MaxAge, ttl)
+	}
+	// The signature does not cover the mail, so a replay may carry any.
+	if _, err := post("tok-1", "Please wire the refund elsewhere."); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected a reused token to be refused, got %v", err)
+	}
+	if _, err := post("tok-2", "Where is my order?"); err != nil {
+		t.Fatalf("expected a fresh token accepted, got %v", err)
+	}
+
+	// Mail that could not be stored is accepted again on Mailgun's retry.
+	mg.Forget(req)
+	if _, err := post("tok-1", "Where is my order?"); err != nil {
+		t.Fatalf("expected the retry accepted after Forget, got %v", err)
+	}
+}
+
+func TestPostmarkRequiresBasicAuth(t *testing.T) {
+	pm := NewPostmark("nerve", "s3cret")
+	payload := `{
+		"MessageID": "pm-1",
+		"OriginalRecipient": "support@acme.test",
+		"FromFull": {"Email": "ann@example.com", "Name": "Ann"},
+		"ToFull": [{"Email": "support@acme.test", "Name": ""}],
+		"Subject": "Order 42",
+		"Date": "Mon, 02 Jan 2006 15:04:05 +0000",
+		"TextBody": "Where is my order?",
+		"Headers": [{"Name": "Message-ID", "Value": "<m42@example.com>"}]
+	}`
+	post := func(user, pass string) ([]Delivery, error) {
+		req := httptest.NewRequest(http.MethodPost, "/inbound/postmark", strings.NewReader(payload))
+		req.SetBasicAuth(user, pass)
+		return pm.Parse(req)
+	}
+
+	deliveries, err := post("nerve", "s3cret")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	email := deliveries[0].Email
+	if email.ID != "<m42@example.com>" || email.From.Email != "ann@example.com" || email.Subject != "Order 42" || email.ReceivedAt.IsZero() {
+		t.Fatalf("unexpected email %+v", email)
+	}
+	if _, err := post("nerve", "guess"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected wrong password to be refused, got %v", err)
+	}
+}
+
+// fakeDirectory hosts inboxes by address and aliases by address, each
+// mapped to its inbox ID, and records the routing decisions it is given.
+type fakeDirectory struct {
+	inboxes   map[string]string
+	aliases   map[string]string
+	domains   map[string]store.DomainRouting
+	decisions []store.RoutingDecision
+}
+
+func (f *fakeDirectory) ResolveInboxAddress(_ context.Context, address string) (string, string, error) {
+	if id, ok := f.inboxes[address]; ok {
+		return id, "", nil
+	}
+	if id, ok := f.aliases[address]; ok {
+		return id, address, nil
+	}
+	return "", "", sql.ErrNoRows
+}
+
+func (f *fakeDirectory) GetDomainRouting(_ context.Context, domain string) (store.DomainRouting, error) {
+	if d, ok := f.domains[domain]; ok {
+		return d, nil
+	}
+	return store.DomainRouting{}, sql.ErrNoRows
+}
+
+func (f *fakeDirectory) RecordRoutingDecision(_ context.Context, d store.RoutingDecision) error {
+	f.decisions = append(f.decisions, d)
+	return nil
+}
+
+func TestRouteRecipients(t *testing.T) {
+	dir := &fakeDirectory{
+		inboxes: map[string]string{"support@acme.test": "inbox-support", "ops@plain.test": "inbox-ops", "a+b@acme.test": "inbox-literal"},
+		aliases: map[string]string{"sales@acme.test": "inbox-sales"},
+		domains: map[string]store.DomainRouting{
+			"acme.test":  {OrgID: "org-1", PlusAddressing: true, CatchAllInboxID: sql.NullString{String: "inbox-catch", Valid: true}},
+			"plain.test": {OrgID: "org-2", PlusAddressing: false},
+		},
+	}
+	cases := []struct {
+		rcpt, rule, inboxID, matched, orgID string
+	}{
+		{" Support@Acme.test ", store.RouteExact, "inbox-support", "support@acme.test", ""},
+		{"sales@acme.test", store.RouteAlias, "inbox-sales", "sales@acme.test", ""},
+		{"support+orders@acme.test", store.RoutePlus, "inbox-support", "support@acme.test", ""},
+		{"sales+q3@acme.test", store.RoutePlus, "inbox-sales", "sales@acme.test", ""},
+		// An inbox whose own address has a + is an exact match, not a tag.
+		{"a+b@acme.test", store.RouteExact, "inbox-literal", "a+b@acme.test", ""},
+		{"nobody@acme.test", store.RouteCatchAll, "inbox-catch", "", "org-1"},
+		// plain.test turned plus-addressing off and has no catch-all.
+		{"ops+x@plain.test", store.RouteDropped, "", "", "org-2"},
+		{"ops@plain.test", store.RouteExact, "inbox-ops", "ops@plain.test", ""},
+		{"someone@elsewhere.test", store.RouteDropped, "", "", ""},
+	}
+	for _, c := range cases {
+		got, err := route(context.Background(), dir, c.rcpt)
+		if err != nil {
+			t.Fatalf("%s: %v", c.rcpt, err)
+		}
+		if got.Rule != c.rule || got.InboxID != c.inboxID || got.MatchedAddress != c.matched || got.OrgID != c.orgID {
+			t.Fatalf("%s: got %+v", c.rcpt, got)
+		}
+	}
+}
+
+func TestReceiverStatusCodes(t *testing.T) {
+	r := &Receiver{Directory: &fakeDirectory{}, MaxMessageBytes: 1 << 20}
+	r.Register(NewPostmark("nerve", "s3cret"))
+
+	serve := func(method, path string, auth bool) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"OriginalRecipient": "nobody@acme.test", "Subject": "hi"}`))
+		if auth {
+			req.SetBasicAuth("nerve", "s3cret")
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := serve(http.MethodPost, "/inbound/mailgun", true); code != http.StatusNotFound {
+		t.Fatalf("expected unconfigured provider to 404, got %d", code)
+	}
+	if code := serve(http.MethodGet, "/inbound/postmark", true); code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected GET to 405, got %d", code)
+	}
+	if code := serve(http.MethodPost, "/inbound/postmark", false); code != http.StatusUnauthorized {
+		t.Fatalf("expected missing credentials to 401, got %d", code)
+	}
+	// Mail for an address we do not host is acknowledged and dropped.
+	if code := serve(http.MethodPost, "/inbound/postmark", true); code != http.StatusOK {
+		t.Fatalf("expected unknown recipient to be acknowledged, got %d", code)
+	}
+	if dir := r.Directory.(*fakeDirectory); len(dir.decisions) != 1 || dir.decisions[0].Rule != store.RouteDropped || dir.decisions[0].Provider != "postmark" {
+		t.Fatalf("expected the drop to be recorded, got %+v", dir.decisions)
+	}
+}
@@ -0,0 +1,118 @@
+package inbound
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"neuralmail/internal/jmap"
+	"neuralmail/internal/mailparse"
+)
+
+// Mailgun receives mail from Mailgun routes that forward() to us. A route
+// whose URL ends in "mime" posts the whole message in body-mime; otherwise
+// the message comes parsed into headers and bodies.
+type Mailgun struct {
+	SigningKey string
+	// MaxAge is how far a request's signed timestamp may be from now, so a
+	// captured request cannot be replayed indefinitely.
+	MaxAge time.Duration
+	Now    func() time.Time
+	// Nonces records each request's token. The signature covers only the
+	// timestamp and token, not the mail, so without it a captured request
+	// could carry any mail while its timestamp is accepted.
+	Nonces Nonces
+}
+
+func NewMailgun(signingKey string) *Mailgun {
+	return &Mailgun{SigningKey: signingKey, MaxAge: 15 * time.Minute, Now: time.Now}
+}
+
+func (m *Mailgun) Name() string { return "mailgun" }
+
+func (m *Mailgun) Parse(req *http.Request) ([]Delivery, error) {
+	if err := req.ParseMultipartForm(32 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return nil, err
+	}
+	if err := m.verify(req.FormValue("timestamp"), req.FormValue("token"), req.FormValue("signature")); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthorized, err)
+	}
+	if m.Nonces != nil {
+		// A token is remembered for as long as a timestamp on either side
+		// of now is accepted.
+		first, err := m.Nonces.ClaimNonce(req.Context(), m.Name(), req.FormValue("token"), 2*m.MaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("mailgun token: %w", err)
+		}
+		if !first {
+			return nil, fmt.Errorf("%w: token already used", ErrUnauthorized)
+		}
+	}
+
+	var email jmap.Email
+	if raw := req.FormValue("body-mime"); raw != "" {
+		parsed, err := mailparse.Parse([]byte(raw))
+		if err != nil {
+			return nil, err
+		}
+		email = parsed
+	} else {
+		var pairs [][]string
+		if err := json.Unmarshal([]byte(req.FormValue("message-headers")), &pairs); err != nil {
+			return nil, fmt.Errorf("message-headers: %w", err)
+		}
+		header := mail.Header{}
+		for _, pair := range pairs {
+			if len(pair) == 2 {
+				key := textproto.CanonicalMIMEHeaderKey(pair[0])
+				header[key] = append(header[key], pair[1])
+			}
+		}
+		email = mailparse.ParseHeader(header)
+		email.Text = req.FormValue("body-plain")
+		email.HTML = req.FormValue("body-html")
+	}
+	return []Delivery{{Recipients: strings.Split(req.FormValue("recipient"), ","), Email: email}}, nil
+}
+
+// Forget releases the request's token so Mailgun's retry of mail that was
+// not stored is accepted.
+func (m *Mailgun) Forget(req *http.Request) {
+	if m.Nonces == nil {
+		return
+	}
+	if err := m.Nonces.ReleaseNonce(req.Context(), m.Name(), req.FormValue("token")); err != nil {
+		slog.WarnContext(req.Context(), "mailgun token not released", "err", err)
+	}
+}
+
+// verify checks the HMAC-SHA256 of timestamp and token under the signing key.
+func (m *Mailgun) verify(timestamp, token, signature string) error {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("missing timestamp")
+	}
+	if age := m.Now().Sub(time.Unix(sec, 0)); age > m.MaxAge || age < -m.MaxAge {
+		return fmt.Errorf("timestamp is %s off", age.Round(time.Second))
+	}
+	want, err := hex.DecodeString(signature)
+	if err != nil {
+		return errors.New("malformed signature")
+	}
+	mac := hmac.New(sha256.New, []byte(m.SigningKey))
+	mac.Write([]byte(timestamp + token))
+	if !hmac.Equal(mac.Sum(nil), want) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
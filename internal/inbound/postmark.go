@@ -0,0 +1,116 @@
+package inbound
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+
+	"neuralmail/internal/jmap"
+	"neuralmail/internal/mailparse"
+	"neuralmail/internal/store"
+)
+
+// Postmark receives mail from a Postmark inbound webhook. Postmark does not
+// sign its webhooks, so the webhook URL must carry Username and Password as
+// basic auth credentials. With "include raw email content" on, RawEmail is
+// parsed in full.
+type Postmark struct {
+	Username string
+	Password string
+}
+
+func NewPostmark(username, password string) *Postmark {
+	return &Postmark{Username: username, Password: password}
+}
+
+func (p *Postmark) Name() string { return "postmark" }
+
+type postmarkAddress struct {
+	Email string `json:"Email"`
+	Name  string `json:"Name"`
+}
+
+type postmarkInbound struct {
+	MessageID         string            `json:"MessageID"`
+	OriginalRecipient string            `json:"OriginalRecipient"`
+	FromFull          postmarkAddress   `json:"FromFull"`
+	ToFull            []postmarkAddress `json:"ToFull"`
+	CcFull            []postmarkAddress `json:"CcFull"`
+	BccFull           []postmarkAddress `json:"BccFull"`
+	Subject           string            `json:"Subject"`
+	Date              string            `json:"Date"`
+	TextBody          string            `json:"TextBody"`
+	HTMLBody          string            `json:"HtmlBody"`
+	Headers           []struct {
+		Name  string `json:"Name"`
+		Value string `json:"Value"`
+	} `json:"Headers"`
+	RawEmail string `json:"RawEmail"`
+}
+
+func (p *Postmark) Parse(req *http.Request) ([]Delivery, error) {
+	if !basicAuthMatches(req, p.Username, p.Password) {
+		return nil, ErrUnauthorized
+	}
+	var in postmarkInbound
+	if err := json.NewDecoder(req.Body).Decode(&in); err != nil {
+		return nil, err
+	}
+
+	var email jmap.Email
+	if in.RawEmail != "" {
+		parsed, err := mailparse.Parse([]byte(in.RawEmail))
+		if err != nil {
+			return nil, err
+		}
+		email = parsed
+	} else {
+		header := mail.Header{}
+		for _, h := range in.Headers {
+			key := textproto.CanonicalMIMEHeaderKey(h.Name)
+			header[key] = append(header[key], h.Value)
+		}
+		// Headers leaves out the ones Postmark parses into fields of
+		// their own.
+		if header.Get("Date") == "" {
+			header["Date"] = []string{in.Date}
+		}
+		email = mailparse.ParseHeader(header)
+		if email.Subject == "" {
+			email.Subject = in.Subject
+		}
+		if email.From.Email == "" {
+			email.From = store.Participant{Name: in.FromFull.Name, Email: in.FromFull.Email}
+		}
+		if len(email.To) == 0 {
+			for _, addr := range in.ToFull {
+				email.To = append(email.To, store.Participant{Name: addr.Name, Email: addr.Email})
+			}
+		}
+		email.Text = in.TextBody
+		email.HTML = in.HTMLBody
+	}
+	if email.ID == "" {
+		email.ID = in.MessageID
+	}
+
+	var recipients []string
+	if in.OriginalRecipient != "" {
+		recipients = append(recipients, in.OriginalRecipient)
+	}
+	for _, list := range [][]postmarkAddress{in.ToFull, in.CcFull, in.BccFull} {
+		for _, addr := range list {
+			recipients = append(recipients, addr.Email)
+		}
+	}
+	return []Delivery{{Recipients: recipients, Email: email}}, nil
+}
+
+// basicAuthMatches reports whether req carries username and password as
+// basic auth, compared in constant time.
+func basicAuthMatches(req *http.Request, username, password string) bool {
+	user, pass, ok := req.BasicAuth()
+	return ok && subtle.ConstantTimeCompare([]byte(user), []byte(username)) == 1 && subtle.ConstantTimeCompare([]byte(pass), []byte(password)) == 1
+}
@@ -0,0 +1,79 @@
+package inbound
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"neuralmail/internal/store"
+)
+
+// route decides which inbox receives mail for rcpt. It tries, in order, an
+// inbox's own address or an alias, the same with a +tag folded away (unless
+// the recipient's domain turned plus-addressing off), and the catch-all
+// inbox of the recipient's active org domain. Mail none of them take gets a
+// RouteDropped decision, with the domain's org when there is one.
+func route(ctx context.Context, dir Directory, rcpt string) (store.RoutingDecision, error) {
+	address := strings.ToLower(strings.TrimSpace(rcpt))
+	decision := store.RoutingDecision{Recipient: address, Rule: store.RouteDropped}
+	if inboxID, alias, err := resolve(ctx, dir, address); err != nil || inboxID != "" {
+		return routed(decision, inboxID, alias, address, false), err
+	}
+
+	domain := address[strings.LastIndex(address, "@")+1:]
+	routing, err := dir.GetDomainRouting(ctx, domain)
+	hasDomain := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return decision, err
+	}
+	if !hasDomain || routing.PlusAddressing {
+		if folded := store.FoldPlusAddress(address); folded != address {
+			inboxID, alias, err := resolve(ctx, dir, folded)
+			if err != nil || inboxID != "" {
+				return routed(decision, inboxID, alias, folded, true), err
+			}
+		}
+	}
+	if !hasDomain {
+		return decision, nil
+	}
+	decision.OrgID = routing.OrgID
+	if routing.CatchAllInboxID.Valid {
+		decision.Rule = store.RouteCatchAll
+		decision.InboxID = routing.CatchAllInboxID.String
+	}
+	return decision, nil
+}
+
+// resolve looks address up as an inbox or alias address; inboxID is empty
+// when it is neither.
+func resolve(ctx context.Context, dir Directory, address string) (inboxID, alias string, err error) {
+	inboxID, alias, err = dir.ResolveInboxAddress(ctx, address)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", nil
+	}
+	return inboxID, alias, err
+}
+
+// routed fills in a decision for mail that matched address, through alias
+// when it is set.
+func routed(d store.RoutingDecision, inboxID, alias, address string, folded bool) store.RoutingDecision {
+	if inboxID == "" {
+		return d
+	}
+	d.InboxID = inboxID
+	switch {
+	case folded:
+		d.Rule = store.RoutePlus
+	case alias != "":
+		d.Rule = store.RouteAlias
+	default:
+		d.Rule = store.RouteExact
+	}
+	d.MatchedAddress = address
+	if alias != "" {
+		d.MatchedAddress = strings.ToLower(alias)
+	}
+	return d
+}
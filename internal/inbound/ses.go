@@ -0,0 +1,260 @@
+package inbound
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	_ "crypto/sha1" // SNS SignatureVersion 1
+	_ "crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"neuralmail/internal/mailparse"
+)
+
+// snsHost matches the SNS endpoints signing certificates and subscription
+// confirmations are fetched from, so a forged message cannot point us at a
+// certificate of its own.
+var snsHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// SES receives mail from SES receipt rules with an SNS action, published to
+// one of TopicARNs. Every SNS message is checked against the topic's signing
+// certificate; subscription confirmations are answered automatically.
+type SES struct {
+	TopicARNs []string
+	Client    *http.Client
+	// MaxAge is how far a message's signed Timestamp may be from now, so a
+	// captured message cannot be replayed later. SNS keeps a message's
+	// Timestamp across its delivery retries, so it covers them too.
+	MaxAge time.Duration
+	Now    func() time.Time
+
+	mu    sync.Mutex
+	certs map[string]*x509.Certificate
+}
+
+func NewSES(topicARNs []string) *SES {
+	return &SES{
+		TopicARNs: topicARNs,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+		MaxAge:    time.Hour,
+		Now:       time.Now,
+		certs:     map[string]*x509.Certificate{},
+	}
+}
+
+func (s *SES) Name() string { return "ses" }
+
+type snsMessage struct {
+	Type             string `json:"Type"`
+	MessageID        string `json:"MessageId"`
+	Token            string `json:"Token"`
+	TopicArn         string `json:"TopicArn"`
+	Subject          string `json:"Subject"`
+	Message          string `json:"Message"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+	SubscribeURL     string `json:"SubscribeURL"`
+}
+
+type sesNotification struct {
+	NotificationType string `json:"notificationType"`
+	Mail             struct {
+		MessageID string    `json:"messageId"`
+		Timestamp time.Time `json:"timestamp"`
+	} `json:"mail"`
+	Receipt struct {
+		Recipients []string `json:"recipients"`
+		Action     struct {
+			Type     string `json:"type"`
+			Encoding string `json:"encoding"`
+		} `json:"action"`
+	} `json:"receipt"`
+	Content string `json:"content"`
+}
+
+func (s *SES) Parse(req *http.Request) ([]Delivery, error) {
+	message, ok, err := s.notification(req)
+	if !ok {
+		return nil, err
+	}
+	var n sesNotification
+	if err := json.Unmarshal([]byte(message), &n); err != nil {
+		return nil, fmt.Errorf("ses notification: %w", err)
+	}
+	if n.NotificationType != "Received" {
+		return nil, nil
+	}
+	if n.Content == "" {
+		return nil, errors.New("ses notification carries no content; the receipt rule needs an SNS action, not S3")
+	}
+	raw := []byte(n.Content)
+	if strings.EqualFold(n.Receipt.Action.Encoding, "BASE64") {
+		decoded, err := base64.StdEncoding.DecodeString(n.Content)
+		if err != nil {
+			return nil, fmt.Errorf("ses content: %w", err)
+		}
+		raw = decoded
+	}
+	email, err := mailparse.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if email.ID == "" {
+		email.ID = n.Mail.MessageID
+	}
+	if email.ReceivedAt.IsZero() {
+		email.ReceivedAt = n.Mail.Timestamp.UTC()
+	}
+	return []Delivery{{Recipients: n.Receipt.Recipients, Email: email}}, nil
+}
+
+// notification authenticates the SNS message posted in req and returns the
+// notification it carries. ok is false for a subscription confirmation,
+// which it answers, an unsubscribe confirmation, or an error.
+func (s *SES) notification(req *http.Request) (message string, ok bool, err error) {
+	var msg snsMessage
+	if err := json.NewDecoder(req.Body).Decode(&msg); err != nil {
+		return "", false, err
+	}
+	if !slices.Contains(s.TopicARNs, msg.TopicArn) {
+		return "", false, fmt.Errorf("%w: topic %q is not configured", ErrUnauthorized, msg.TopicArn)
+	}
+	if err := s.verify(req.Context(), msg); err != nil {
+		return "", false, fmt.Errorf("%w: %v", ErrUnauthorized, err)
+	}
+	sent, err := time.Parse(time.RFC3339, msg.Timestamp)
+	if err != nil {
+		return "", false, fmt.Errorf("%w: timestamp: %v", ErrUnauthorized, err)
+	}
+	if age := s.Now().Sub(sent); age > s.MaxAge || age < -s.MaxAge {
+		return "", false, fmt.Errorf("%w: timestamp is %s off", ErrUnauthorized, age.Round(time.Second))
+	}
+	switch msg.Type {
+	case "SubscriptionConfirmation":
+		return "", false, s.confirm(req.Context(), msg.SubscribeURL)
+	case "UnsubscribeConfirmation":
+		return "", false, nil
+	case "Notification":
+		return msg.Message, true, nil
+	default:
+		return "", false, fmt.Errorf("unknown sns message type %q", msg.Type)
+	}
+}
+
+// verify checks msg's signature against the certificate it names.
+func (s *SES) verify(ctx context.Context, msg snsMessage) error {
+	var hash crypto.Hash
+	switch msg.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+	case "2":
+		hash = crypto.SHA256
+	default:
+		return fmt.Errorf("unsupported signature version %q", msg.SignatureVersion)
+	}
+	sig, err := base64.StdEncoding.DecodeString(msg.Signature)
+	if err != nil {
+		return fmt.Errorf("signature: %w", err)
+	}
+	cert, err := s.cert(ctx, msg.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("signing certificate does not hold an RSA key")
+	}
+	h := hash.New()
+	h.Write([]byte(msg.stringToSign()))
+	return rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), sig)
+}
+
+// stringToSign is the canonical form SNS signs: selected fields as
+// name/value lines in a fixed order.
+func (m snsMessage) stringToSign() string {
+	fields := [][2]string{{"Message", m.Message}, {"MessageId", m.MessageID}}
+	if m.Type == "Notification" {
+		if m.Subject != "" {
+			fields = append(fields, [2]string{"Subject", m.Subject})
+		}
+		fields = append(fields, [2]string{"Timestamp", m.Timestamp})
+	} else {
+		fields = append(fields, [2]string{"SubscribeURL", m.SubscribeURL}, [2]string{"Timestamp", m.Timestamp}, [2]string{"Token", m.Token})
+	}
+	fields = append(fields, [2]string{"TopicArn", m.TopicArn}, [2]string{"Type", m.Type})
+
+	var b strings.Builder
+	for _, f := range fields {
+		b.WriteString(f[0] + "\n" + f[1] + "\n")
+	}
+	return b.String()
+}
+
+// cert fetches and caches the signing certificate at rawURL.
+func (s *SES) cert(ctx context.Context, rawURL string) (*x509.Certificate, error) {
+	s.mu.Lock()
+	cert, ok := s.certs[rawURL]
+	s.mu.Unlock()
+	if ok {
+		return cert, nil
+	}
+	body, err := s.get(ctx, rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("signing certificate: %w", err)
+	}
+	block, _ := pem.Decode(body)
+	if block == nil {
+		return nil, errors.New("signing certificate is not PEM")
+	}
+	cert, err = x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("signing certificate: %w", err)
+	}
+	s.mu.Lock()
+	s.certs[rawURL] = cert
+	s.mu.Unlock()
+	return cert, nil
+}
+
+// confirm subscribes us to the topic by visiting the confirmation URL.
+func (s *SES) confirm(ctx context.Context, rawURL string) error {
+	if _, err := s.get(ctx, rawURL); err != nil {
+		return fmt.Errorf("subscription confirmation: %w", err)
+	}
+	return nil
+}
+
+func (s *SES) get(ctx context.Context, rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || !snsHost.MatchString(u.Hostname()) {
+		return nil, fmt.Errorf("%q is not an SNS URL", rawURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: status %d", u.Host, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+}
@@ -0,0 +1,116 @@
+package ingest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"neuralmail/internal/jmap"
+)
+
+// RawStore keeps the full copy of an oversized message;
+// *objectstore.Client satisfies it.
+type RawStore interface {
+	Put(ctx context.Context, key string, contentType string, body []byte) error
+}
+
+// Limits caps the body sizes stored in Postgres. A zero limit is no limit.
+type Limits struct {
+	MaxTextBytes int
+	MaxHTMLBytes int
+}
+
+// oversizeClient applies the pipeline's limits to what the wrapped client
+// fetches.
+type oversizeClient struct {
+	jmap.Client
+	pipeline *Pipeline
+	inboxID  string
+}
+
+func (c oversizeClient) FetchChanges(ctx context.Context, sinceState string) ([]jmap.Email, string, error) {
+	emails, newState, err := c.Client.FetchChanges(ctx, sinceState)
+	if err != nil {
+		return nil, newState, err
+	}
+	for i := range emails {
+		if err := c.pipeline.limitSize(ctx, c.inboxID, &emails[i]); err != nil {
+			return nil, "", err
+		}
+	}
+	return emails, newState, nil
+}
+
+// limitSize truncates the bodies of an email over the limits and flags it
+// oversized, after copying it in full to the raw store when there is one. A
+// failed copy fails the fetch, so the message is retried rather than
+// stored without it. An email the client already flagged, one it could not
+// parse, is copied the same way when it came with the raw message.
+func (p *Pipeline) limitSize(ctx context.Context, inboxID string, email *jmap.Email) error {
+	text, html := p.Limits.MaxTextBytes, p.Limits.MaxHTMLBytes
+	flagged := email.Oversized && len(email.Raw) > 0
+	if !flagged && !over(email.Text, text) && !over(email.RawText, text) && !over(email.HTML, html) && !over(email.RawHTML, html) {
+		return nil
+	}
+	if p.Objects != nil {
+		key, contentType, body, err := rawObject(inboxID, *email)
+		if err != nil {
+			return err
+		}
+		if err := p.Objects.Put(ctx, key, contentType, body); err != nil {
+			return fmt.Errorf("store oversized message %s: %w", email.ID, err)
+		}
+		email.RawObjectKey = key
+	}
+	email.Oversized = true
+	email.Text = truncateUTF8(email.Text, text)
+	email.RawText = truncateUTF8(email.RawText, text)
+	email.HTML = truncateUTF8(email.HTML, html)
+	email.RawHTML = truncateUTF8(email.RawHTML, html)
+	return nil
+}
+
+// rawObject is the object an oversized email is kept as: the message as
+// received when the client fetched it whole, otherwise its untruncated
+// fields as JSON. Keys are stable per inbox and message, so a retried ingest
+// overwrites the same object.
+func rawObject(inboxID string, email jmap.Email) (key string, contentType string, body []byte, err error) {
+	sum := sha256.Sum256([]byte(email.ID))
+	key = "messages/" + inboxID + "/" + hex.EncodeToString(sum[:])
+	if len(email.Raw) > 0 {
+		return key + ".eml", "message/rfc822", email.Raw, nil
+	}
+	body, err = json.Marshal(map[string]any{
+		"id":          email.ID,
+		"thread_id":   email.ThreadID,
+		"subject":     email.Subject,
+		"from":        email.From,
+		"to":          email.To,
+		"received_at": email.ReceivedAt,
+		"message_id":  email.InternetMsg,
+		"text":        email.Text,
+		"html":        email.HTML,
+		"raw_text":    email.RawText,
+		"raw_html":    email.RawHTML,
+	})
+	return key + ".json", "application/json", body, err
+}
+
+func over(s string, limit int) bool {
+	return limit > 0 && len(s) > limit
+}
+
+// truncateUTF8 cuts s to at most limit bytes without splitting a rune.
+func truncateUTF8(s string, limit int) string {
+	if !over(s, limit) {
+		return s
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut]
+}
@@ -0,0 +1,77 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"neuralmail/internal/jmap"
+)
+
+type fakeRawStore struct {
+	objects map[string][]byte
+	err     error
+}
+
+func (f *fakeRawStore) Put(_ context.Context, key string, _ string, body []byte) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.objects[key] = body
+	return nil
+}
+
+func TestLimitSizeTruncatesAndKeepsRaw(t *testing.T) {
+	objects := &fakeRawStore{objects: map[string][]byte{}}
+	p := &Pipeline{Objects: objects, Limits: Limits{MaxTextBytes: 10, MaxHTMLBytes: 100}}
+	raw := []byte("Subject: big\r\n\r\n" + strings.Repeat("é", 20))
+	email := jmap.Email{ID: "<big@example.com>", Text: strings.Repeat("é", 20), Raw: raw}
+
+	if err := p.limitSize(context.Background(), "inbox-1", &email); err != nil {
+		t.Fatalf("limitSize: %v", err)
+	}
+	if !email.Oversized || len(email.Text) > 10 || !utf8.ValidString(email.Text) {
+		t.Fatalf("expected truncated valid text, got oversized=%v %q", email.Oversized, email.Text)
+	}
+	if !strings.HasPrefix(email.RawObjectKey, "messages/inbox-1/") || !strings.HasSuffix(email.RawObjectKey, ".eml") {
+		t.Fatalf("unexpected object key %q", email.RawObjectKey)
+	}
+	if string(objects.objects[email.RawObjectKey]) != string(raw) {
+		t.Fatalf("expected the raw message to be kept in full")
+	}
+}
+
+func TestLimitSizeKeepsRawOfFlaggedMail(t *testing.T) {
+	objects := &fakeRawStore{objects: map[string][]byte{}}
+	p := &Pipeline{Objects: objects, Limits: Limits{MaxTextBytes: 10, MaxHTMLBytes: 100}}
+	raw := []byte("not a header\r\n\r\nbody")
+	email := jmap.Email{ID: "uid:7:4", Oversized: true, Raw: raw}
+	if err := p.limitSize(context.Background(), "inbox-1", &email); err != nil {
+		t.Fatalf("limitSize: %v", err)
+	}
+	if email.RawObjectKey == "" || string(objects.objects[email.RawObjectKey]) != string(raw) {
+		t.Fatalf("expected the unparsed message kept as received, got key %q", email.RawObjectKey)
+	}
+}
+
+func TestLimitSizeLeavesSmallMail(t *testing.T) {
+	objects := &fakeRawStore{objects: map[string][]byte{}}
+	p := &Pipeline{Objects: objects, Limits: Limits{MaxTextBytes: 10, MaxHTMLBytes: 100}}
+	email := jmap.Email{ID: "<small@example.com>", Text: "hi", HTML: "<p>hi</p>"}
+	if err := p.limitSize(context.Background(), "inbox-1", &email); err != nil || email.Oversized || len(objects.objects) != 0 {
+		t.Fatalf("expected small mail untouched, got %+v err=%v", email, err)
+	}
+}
+
+func TestLimitSizeFailsWhenRawCopyFails(t *testing.T) {
+	p := &Pipeline{Objects: &fakeRawStore{err: errors.New("bucket down")}, Limits: Limits{MaxHTMLBytes: 4}}
+	email := jmap.Email{ID: "<big@example.com>", HTML: "<p>too long</p>"}
+	if err := p.limitSize(context.Background(), "inbox-1", &email); err == nil {
+		t.Fatalf("expected the failed copy to fail ingest")
+	}
+	if email.Oversized || email.HTML != "<p>too long</p>" {
+		t.Fatalf("expected email untouched on failure, got %+v", email)
+	}
+}
@@ -0,0 +1,169 @@
+// Package ingest stores incoming mail for an inbox, whichever way it reached
+// us: polled from a sync client or pushed by a provider's inbound webhook.
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/jmap"
+	"neuralmail/internal/mailparse"
+	"neuralmail/internal/objectstore"
+	"neuralmail/internal/queue"
+	"neuralmail/internal/residency"
+	"neuralmail/internal/store"
+)
+
+// EmbeddingQueue accepts the embedding jobs for newly stored messages.
+type EmbeddingQueue interface {
+	PushEmbeddingJob(ctx context.Context, job queue.Job) error
+}
+
+// JobQueue accepts the other jobs ingest leaves to the worker;
+// *queue.Queue implements it.
+type JobQueue interface {
+	Push(ctx context.Context, name string, job queue.Job) error
+}
+
+// ReportJob is the payload of a bounce processing job.
+type ReportJob struct {
+	InboxID   string              `json:"inbox_id"`
+	MessageID string              `json:"message_id"`
+	Report    jmap.DeliveryReport `json:"report"`
+}
+
+// SummaryJob is the payload of a summarization job.
+type SummaryJob struct {
+	OrgID    string `json:"org_id,omitempty"`
+	ThreadID string `json:"thread_id"`
+}
+
+// RuleRunner applies an inbox's automation rules to its new messages, stored
+// in st; *rules.Engine implements it.
+type RuleRunner interface {
+	Run(ctx context.Context, st *store.Store, inboxID string, messageIDs []string) error
+}
+
+// Pipeline ingests mail into the region an inbox lives in. Directory is the
+// home store, which holds inbox aliases and ingestion filters. Messages over
+// Limits are stored truncated, with the full copy in Objects when set.
+// Polled messages are stored BatchSize at a time.
+type Pipeline struct {
+	Directory  *store.Store
+	Residency  *residency.Router
+	Embeddings EmbeddingQueue
+	Objects    RawStore
+	Limits     Limits
+	BatchSize  int
+	// Rules, when set, runs the inbox's automation rules on new messages.
+	Rules RuleRunner
+	// Jobs, when set, takes delivery reports off the ingest path: they are
+	// queued for the worker instead of applied as they are stored. With
+	// RefreshSummaries, threads whose summary new mail made stale are
+	// queued for summarization too.
+	Jobs             JobQueue
+	RefreshSummaries bool
+}
+
+// NewPipeline returns the pipeline cfg describes, keeping oversized
+// messages in cfg.ObjectStore when one is configured.
+func NewPipeline(cfg config.Config, directory *store.Store, router *residency.Router, embeddings EmbeddingQueue) (*Pipeline, error) {
+	p := &Pipeline{
+		Directory:        directory,
+		Residency:        router,
+		Embeddings:       embeddings,
+		Limits:           Limits{MaxTextBytes: cfg.Ingest.MaxTextBytes, MaxHTMLBytes: cfg.Ingest.MaxHTMLBytes},
+		BatchSize:        cfg.Ingest.BatchSize,
+		RefreshSummaries: cfg.Worker.RefreshSummaries,
+	}
+	objects, err := objectstore.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if objects != nil {
+		p.Objects = objects
+	}
+	return p, nil
+}
+
+// Ingest stores what client returns since sinceState in inboxID, with bodies
+// normalized, the inbox's aliases and filter and the size limits applied,
+// queues the new messages for embedding and runs the inbox's automation rules
+// on them. It returns the state to resume from, sinceState when nothing could
+// be stored. Messages stored before an error are still queued and run.
+func (p *Pipeline) Ingest(ctx context.Context, client jmap.Client, inboxID string, sinceState string) (string, error) {
+	return p.ingest(ctx, client, inboxID, sinceState, true)
+}
+
+// Backfill is Ingest for historical mail read through a jmap.Range client:
+// the cursor takes the place of the sync state, and automation rules are
+// not run, so old mail gets no auto-replies or forwards.
+func (p *Pipeline) Backfill(ctx context.Context, client jmap.Client, inboxID string, cursor string) (string, error) {
+	return p.ingest(ctx, client, inboxID, cursor, false)
+}
+
+func (p *Pipeline) ingest(ctx context.Context, client jmap.Client, inboxID string, sinceState string, runRules bool) (string, error) {
+	backend, err := p.Residency.ForInbox(ctx, inboxID)
+	if err != nil {
+		return sinceState, fmt.Errorf("residency routing: %w", err)
+	}
+	aliases, err := p.Directory.ListInboxAliases(ctx, inboxID)
+	if err != nil {
+		return sinceState, fmt.Errorf("alias lookup: %w", err)
+	}
+	settings, err := p.Directory.GetIngestFilter(ctx, inboxID)
+	if err != nil {
+		return sinceState, fmt.Errorf("ingest filter lookup: %w", err)
+	}
+	filter, err := jmap.NewFilter(settings)
+	if err != nil {
+		return sinceState, fmt.Errorf("ingest filter invalid: %w", err)
+	}
+	opts := jmap.Options{BatchSize: p.BatchSize}
+	if p.Jobs != nil {
+		opts.Reports = p.queueReport
+	}
+	newState, messageIDs, err := jmap.IngestBatched(ctx, oversizeClient{Client: mailparse.NormalizingClient{Client: client}, pipeline: p, inboxID: inboxID}, backend.Store, inboxID, aliases, filter, sinceState, opts)
+	for _, id := range messageIDs {
+		if err := p.Embeddings.PushEmbeddingJob(ctx, queue.NewJob(id, queue.OriginIngest)); err != nil {
+			slog.ErrorContext(ctx, "embedding enqueue failed", "inbox", inboxID, "message", id, "err", err)
+		}
+	}
+	if p.Rules != nil && runRules {
+		if err := p.Rules.Run(ctx, backend.Store, inboxID, messageIDs); err != nil {
+			slog.ErrorContext(ctx, "automation rules failed", "inbox", inboxID, "err", err)
+		}
+	}
+	if p.Jobs != nil && p.RefreshSummaries {
+		p.queueSummaries(ctx, backend.Store, inboxID, messageIDs)
+	}
+	return newState, err
+}
+
+func (p *Pipeline) queueReport(ctx context.Context, inboxID string, reportMsgID string, report jmap.DeliveryReport) error {
+	job, err := queue.NewPayloadJob(queue.OriginIngest, ReportJob{InboxID: inboxID, MessageID: reportMsgID, Report: report})
+	if err != nil {
+		return err
+	}
+	return p.Jobs.Push(ctx, queue.QueueName(queue.TypeBounce), job)
+}
+
+// queueSummaries queues the refresh of the summaries messageIDs made stale.
+func (p *Pipeline) queueSummaries(ctx context.Context, st *store.Store, inboxID string, messageIDs []string) {
+	threads, err := st.SummarizedThreads(ctx, messageIDs)
+	if err != nil {
+		slog.ErrorContext(ctx, "summarized threads lookup failed", "inbox", inboxID, "err", err)
+		return
+	}
+	for _, t := range threads {
+		job, err := queue.NewPayloadJob(queue.OriginIngest, SummaryJob{OrgID: t.OrgID, ThreadID: t.ThreadID})
+		if err == nil {
+			err = p.Jobs.Push(ctx, queue.QueueName(queue.TypeSummarization), job)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "summary refresh enqueue failed", "inbox", inboxID, "thread", t.ThreadID, "err", err)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package integrations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"neuralmail/internal/config"
+)
+
+// hubspotTicketToContact is HubSpot's association type ID for a ticket's
+// contact.
+const hubspotTicketToContact = 16
+
+// hubspotAssociationLimit bounds the tickets and deals Lookup returns.
+const hubspotAssociationLimit = 10
+
+var (
+	hubspotContactProperties = []string{"email", "firstname", "lastname", "company", "jobtitle", "phone", "lifecyclestage", "hs_lead_status"}
+	hubspotTicketProperties  = []string{"subject", "content", "hs_pipeline", "hs_pipeline_stage", "hs_ticket_priority", "createdate", "hs_lastmodifieddate"}
+	hubspotDealProperties    = []string{"dealname", "dealstage", "pipeline", "amount", "closedate"}
+)
+
+// APIError is a non-2xx response from a CRM's API.
+type APIError struct {
+	Status int
+	Body   string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("crm api: status %d: %s", e.Status, e.Body)
+}
+
+// Is makes a 404 match ErrNotFound.
+func (e *APIError) Is(target error) bool {
+	return target == ErrNotFound && e.Status == http.StatusNotFound
+}
+
+// HubSpot is a Connector for a HubSpot account, authenticated with a
+// private app token.
+type HubSpot struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+func NewHubSpot(cfg config.Config, token string) *HubSpot {
+	timeout := cfg.CRM.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &HubSpot{
+		baseURL:    strings.TrimRight(cfg.CRM.HubSpotAPIBaseURL, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+func (h *HubSpot) Provider() string { return ProviderHubSpot }
+
+type hubspotObject struct {
+	ID         string             `json:"id"`
+	Properties map[string]*string `json:"properties"`
+}
+
+func (o hubspotObject) record(objectType string) Record {
+	r := Record{Type: objectType, ID: o.ID, Properties: map[string]string{}}
+	for k, v := range o.Properties {
+		if v != nil && *v != "" {
+			r.Properties[k] = *v
+		}
+	}
+	return r
+}
+
+func (h *HubSpot) UpsertContact(ctx context.Context, p Person) (string, error) {
+	found, err := h.findContact(ctx, p.Email)
+	if err != nil {
+		return "", err
+	}
+	if found != nil {
+		return found.ID, nil
+	}
+	props := map[string]string{"email": p.Email}
+	if first, last, _ := strings.Cut(strings.TrimSpace(p.Name), " "); first != "" {
+		props["firstname"] = first
+		if last = strings.TrimSpace(last); last != "" {
+			props["lastname"] = last
+		}
+	}
+	var created hubspotObject
+	if err := h.do(ctx, http.MethodPost, "/crm/v3/objects/contacts", map[string]any{"properties": props}, &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+func (h *HubSpot) CreateTicket(ctx context.Context, t Ticket) (string, error) {
+	if t.Pipeline == "" {
+		t.Pipeline = "0"
+	}
+	if t.Stage == "" {
+		t.Stage = "1"
+	}
+	body := map[string]any{"properties": ticketProperties(t)}
+	if t.ContactID != "" {
+		body["associations"] = []map[string]any{{
+			"to":    map[string]string{"id": t.ContactID},
+			"types": []map[string]any{{"associationCategory": "HUBSPOT_DEFINED", "associationTypeId": hubspotTicketToContact}},
+		}}
+	}
+	var created hubspotObject
+	if err := h.do(ctx, http.MethodPost, "/crm/v3/objects/tickets", body, &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+func (h *HubSpot) UpdateTicket(ctx context.Context, id string, t Ticket) error {
+	props := ticketProperties(t)
+	if len(props) == 0 {
+		return nil
+	}
+	return h.do(ctx, http.MethodPatch, "/crm/v3/objects/tickets/"+url.PathEscape(id), map[string]any{"properties": props}, nil)
+}
+
+func (h *HubSpot) GetTicket(ctx context.Context, id string) (Record, error) {
+	var obj hubspotObject
+	path := "/crm/v3/objects/tickets/" + url.PathEscape(id) + "?properties=" + url.QueryEscape(strings.Join(hubspotTicketProperties, ","))
+	if err := h.do(ctx, http.MethodGet, path, nil, &obj); err != nil {
+		return Record{}, err
+	}
+	return obj.record("ticket"), nil
+}
+
+func (h *HubSpot) Lookup(ctx context.Context, email string) (Context, error) {
+	out := Context{Tickets: []Record{}, Deals: []Record{}}
+	contact, err := h.findContact(ctx, email)
+	if err != nil || contact == nil {
+		return out, err
+	}
+	rec := contact.record("contact")
+	out.Contact = &rec
+	if out.Tickets, err = h.associated(ctx, contact.ID, "tickets", "ticket", hubspotTicketProperties); err != nil {
+		return out, err
+	}
+	if out.Deals, err = h.associated(ctx, contact.ID, "deals", "deal", hubspotDealProperties); err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+func (h *HubSpot) findContact(ctx context.Context, email string) (*hubspotObject, error) {
+	var res struct {
+		Results []hubspotObject `json:"results"`
+	}
+	err := h.do(ctx, http.MethodPost, "/crm/v3/objects/contacts/search", map[string]any{
+		"filterGroups": []map[string]any{{
+			"filters": []map[string]string{{"propertyName": "email", "operator": "EQ", "value": email}},
+		}},
+		"properties": hubspotContactProperties,
+		"limit":      1,
+	}, &res)
+	if err != nil || len(res.Results) == 0 {
+		return nil, err
+	}
+	return &res.Results[0], nil
+}
+
+// associated reads up to hubspotAssociationLimit objects of objectPath
+// associated with a contact.
+func (h *HubSpot) associated(ctx context.Context, contactID string, objectPath string, objectType string, properties []string) ([]Record, error) {
+	var assoc struct {
+		Results []struct {
+			ToObjectID json.Number `json:"toObjectId"`
+		} `json:"results"`
+	}
+	path := fmt.Sprintf("/crm/v4/objects/contacts/%s/associations/%s?limit=%d", url.PathEscape(contactID), objectPath, hubspotAssociationLimit)
+	if err := h.do(ctx, http.MethodGet, path, nil, &assoc); err != nil {
+		return nil, err
+	}
+	records := []Record{}
+	if len(assoc.Results) == 0 {
+		return records, nil
+	}
+	inputs := make([]map[string]string, 0, len(assoc.Results))
+	for _, a := range assoc.Results {
+		inputs = append(inputs, map[string]string{"id": a.ToObjectID.String()})
+	}
+	var batch struct {
+		Results []hubspotObject `json:"results"`
+	}
+	if err := h.do(ctx, http.MethodPost, "/crm/v3/objects/"+objectPath+"/batch/read", map[string]any{"properties": properties, "inputs": inputs}, &batch); err != nil {
+		return nil, err
+	}
+	for _, obj := range batch.Results {
+		records = append(records, obj.record(objectType))
+	}
+	return records, nil
+}
+
+func ticketProperties(t Ticket) map[string]string {
+	props := map[string]string{}
+	set := func(key, value string) {
+		if value != "" {
+			props[key] = value
+		}
+	}
+	set("subject", t.Subject)
+	set("content", t.Description)
+	set("hs_pipeline", t.Pipeline)
+	set("hs_pipeline_stage", t.Stage)
+	set("hs_ticket_priority", t.Priority)
+	return props
+}
+
+func (h *HubSpot) do(ctx context.Context, method string, path string, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, h.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+h.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return &APIError{Status: resp.StatusCode, Body: strings.TrimSpace(string(raw))}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package integrations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/store"
+)
+
+type fakeHubSpot struct {
+	contacts map[string]string // email to contact ID
+	created  []map[string]any
+	patched  map[string]any
+}
+
+func (f *fakeHubSpot) handler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer pat-1" {
+			t.Errorf("unexpected authorization header %q", got)
+		}
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		switch r.Method + " " + r.URL.Path {
+		case "POST /crm/v3/objects/contacts/search":
+			filter := body["filterGroups"].([]any)[0].(map[string]any)["filters"].([]any)[0].(map[string]any)
+			results := []map[string]any{}
+			if id, ok := f.contacts[filter["value"].(string)]; ok {
+				results = append(results, map[string]any{"id": id, "properties": map[string]any{"email": filter["value"], "company": "Acme", "phone": nil}})
+			}
+			writeTestJSON(w, map[string]any{"results": results})
+		case "POST /crm/v3/objects/contacts", "POST /crm/v3/objects/tickets":
+			f.created = append(f.created, body)
+			writeTestJSON(w, map[string]any{"id": "new-" + r.URL.Path[len("/crm/v3/objects/"):]})
+		case "PATCH /crm/v3/objects/tickets/7":
+			f.patched = body
+			writeTestJSON(w, map[string]any{"id": "7"})
+		case "GET /crm/v3/objects/tickets/7":
+			writeTestJSON(w, map[string]any{"id": "7", "properties": map[string]any{"subject": "Broken parcel"}})
+		case "GET /crm/v4/objects/contacts/c1/associations/tickets":
+			writeTestJSON(w, map[string]any{"results": []map[string]any{{"toObjectId": 7}}})
+		case "GET /crm/v4/objects/contacts/c1/associations/deals":
+			writeTestJSON(w, map[string]any{"results": []map[string]any{}})
+		case "POST /crm/v3/objects/tickets/batch/read":
+			writeTestJSON(w, map[string]any{"results": []map[string]any{{"id": "7", "properties": map[string]any{"subject": "Broken parcel"}}}})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func writeTestJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func newTestHubSpot(t *testing.T, f *fakeHubSpot) *HubSpot {
+	srv := httptest.NewServer(f.handler(t))
+	t.Cleanup(srv.Close)
+	var cfg config.Config
+	cfg.CRM.HubSpotAPIBaseURL = srv.URL
+	return NewHubSpot(cfg, "pat-1")
+}
+
+func TestHubSpotUpsertContact(t *testing.T) {
+	f := &fakeHubSpot{contacts: map[string]string{"ana@example.com": "c1"}}
+	h := newTestHubSpot(t, f)
+	ctx := context.Background()
+
+	id, err := h.UpsertContact(ctx, Person{Email: "ana@example.com", Name: "Ana Lima"})
+	if err != nil || id != "c1" {
+		t.Fatalf("existing contact = %q, %v", id, err)
+	}
+	if len(f.created) != 0 {
+		t.Fatalf("existing contact should not be created again")
+	}
+	id, err = h.UpsertContact(ctx, Person{Email: "bo@example.com", Name: "Bo van Dijk"})
+	if err != nil || id != "new-contacts" {
+		t.Fatalf("new contact = %q, %v", id, err)
+	}
+	props := f.created[0]["properties"].(map[string]any)
+	if props["firstname"] != "Bo" || props["lastname"] != "van Dijk" || props["email"] != "bo@example.com" {
+		t.Fatalf("unexpected contact properties %v", props)
+	}
+}
+
+func TestHubSpotTickets(t *testing.T) {
+	f := &fakeHubSpot{}
+	h := newTestHubSpot(t, f)
+	ctx := context.Background()
+
+	id, err := h.CreateTicket(ctx, Ticket{Subject: "Refund", Priority: "HIGH", ContactID: "c1"})
+	if err != nil || id != "new-tickets" {
+		t.Fatalf("CreateTicket = %q, %v", id, err)
+	}
+	props := f.created[0]["properties"].(map[string]any)
+	if props["hs_pipeline"] != "0" || props["hs_pipeline_stage"] != "1" || props["hs_ticket_priority"] != "HIGH" {
+		t.Fatalf("unexpected ticket properties %v", props)
+	}
+	if _, ok := f.created[0]["associations"]; !ok {
+		t.Fatal("ticket should be associated with its contact")
+	}
+
+	if err := h.UpdateTicket(ctx, "7", Ticket{Priority: "LOW"}); err != nil {
+		t.Fatal(err)
+	}
+	if props := f.patched["properties"].(map[string]any); len(props) != 1 || props["hs_ticket_priority"] != "LOW" {
+		t.Fatalf("update should only send the priority, got %v", props)
+	}
+
+	if _, err := h.GetTicket(ctx, "8"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown ticket: %v, want ErrNotFound", err)
+	}
+}
+
+func TestHubSpotLookup(t *testing.T) {
+	h := newTestHubSpot(t, &fakeHubSpot{contacts: map[string]string{"ana@example.com": "c1"}})
+	ctx := context.Background()
+
+	got, err := h.Lookup(ctx, "ana@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Contact == nil || got.Contact.Properties["company"] != "Acme" {
+		t.Fatalf("unexpected contact %+v", got.Contact)
+	}
+	if _, ok := got.Contact.Properties["phone"]; ok {
+		t.Fatal("unset properties should be dropped")
+	}
+	if len(got.Tickets) != 1 || got.Tickets[0].ID != "7" || got.Tickets[0].Type != "ticket" || len(got.Deals) != 0 {
+		t.Fatalf("unexpected associations %+v", got)
+	}
+
+	got, err = h.Lookup(ctx, "nobody@example.com")
+	if err != nil || got.Contact != nil || got.Tickets == nil {
+		t.Fatalf("unknown address = %+v, %v", got, err)
+	}
+}
+
+func TestCaseKind(t *testing.T) {
+	var defaults store.CRMConnection
+	custom := store.CRMConnection{SalesIntents: []string{"Upgrade"}, SupportIntents: []string{"outage"}}
+	cases := []struct {
+		conn   store.CRMConnection
+		intent string
+		want   string
+	}{
+		{defaults, "pricing", KindSales},
+		{defaults, " Refund_Request ", KindSupport},
+		{defaults, "general", ""},
+		{defaults, "", ""},
+		{custom, "upgrade", KindSales},
+		{custom, "outage", KindSupport},
+		{custom, "incident", ""},
+	}
+	for _, tc := range cases {
+		if got := CaseKind(tc.conn, tc.intent); got != tc.want {
+			t.Errorf("CaseKind(%q) = %q, want %q", tc.intent, got, tc.want)
+		}
+	}
+	if Priority("High") != "HIGH" || Priority("whenever") != "" {
+		t.Fatal("unexpected priority mapping")
+	}
+}
+
+func TestSealedConnectionOpensOnlyInTheBridge(t *testing.T) {
+	var cfg config.Config
+	if _, err := Seal(cfg, store.CRMConnection{AccessToken: "pat-1"}); !errors.Is(err, ErrNotConfigured) {
+		t.Fatalf("expected sealing without a key to fail, got %v", err)
+	}
+
+	cfg.Security.TokenEncryptionKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	conn, err := Seal(cfg, store.CRMConnection{OrgID: "org-1", Provider: ProviderHubSpot, AccessToken: "pat-1"})
+	if err != nil || !conn.Sealed || conn.AccessToken == "pat-1" {
+		t.Fatalf("expected a sealed token, got %+v %v", conn, err)
+	}
+
+	var got string
+	bridge := &Bridge{Config: cfg, Connect: func(c store.CRMConnection) (Connector, error) {
+		got = c.AccessToken
+		return nil, nil
+	}}
+	if _, err := bridge.connector(context.Background(), nil, conn); err != nil || got != "pat-1" {
+		t.Fatalf("expected the connector to get the plaintext token, got %q %v", got, err)
+	}
+
+	bridge.Config.Security.TokenEncryptionKey = ""
+	if _, err := bridge.connector(context.Background(), nil, conn); !errors.Is(err, ErrNotConfigured) {
+		t.Fatalf("expected a sealed token to need the key, got %v", err)
+	}
+}
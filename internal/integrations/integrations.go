@@ -0,0 +1,345 @@
+// Package integrations files email cases in an org's CRM. A Connector speaks
+// to one CRM; the Bridge picks an org's connector from its crm_connections
+// row and keeps crm_links, which ticket each thread is tracked as.
+package integrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/secrets"
+	"neuralmail/internal/store"
+)
+
+// ProviderHubSpot is the only CRM connectors exist for so far.
+const ProviderHubSpot = "hubspot"
+
+// Providers lists the values of store.CRMConnection.Provider.
+var Providers = []string{ProviderHubSpot}
+
+// Case kinds, the values of store.CRMLink.Kind.
+const (
+	KindSales   = "sales"
+	KindSupport = "support"
+)
+
+// Triage intents filed as cases when a connection lists none of its own.
+var (
+	DefaultSalesIntents   = []string{"sales", "sales_inquiry", "pricing", "quote_request", "demo_request"}
+	DefaultSupportIntents = []string{"incident", "billing", "refund_request", "support", "bug_report"}
+)
+
+var (
+	ErrNotConnected  = errors.New("no crm connected")
+	ErrNotFound      = errors.New("crm record not found")
+	ErrNotConfigured = errors.New("crm token encryption not configured")
+)
+
+// maxDescriptionBytes bounds the message text copied into a ticket.
+const maxDescriptionBytes = 4000
+
+// Person is who a contact is created for.
+type Person struct {
+	Email string
+	Name  string
+}
+
+// Ticket is a case to file, or on update the fields to change; empty fields
+// are left alone. Priority is HIGH, MEDIUM or LOW.
+type Ticket struct {
+	Subject     string
+	Description string
+	Kind        string
+	Priority    string
+	Pipeline    string
+	Stage       string
+	ContactID   string
+}
+
+// Record is a CRM object as agents see it: its type, ID and the properties
+// that were set.
+type Record struct {
+	Type       string            `json:"type"`
+	ID         string            `json:"id"`
+	Properties map[string]string `json:"properties"`
+}
+
+// Context is what a CRM knows about an address: the contact, nil when there
+// is none, and the tickets and deals associated with it.
+type Context struct {
+	Contact *Record  `json:"contact"`
+	Tickets []Record `json:"tickets"`
+	Deals   []Record `json:"deals"`
+}
+
+// Connector speaks to one CRM account.
+type Connector interface {
+	Provider() string
+	// UpsertContact returns the ID of the contact with p's email, creating
+	// it when there is none.
+	UpsertContact(ctx context.Context, p Person) (string, error)
+	CreateTicket(ctx context.Context, t Ticket) (string, error)
+	UpdateTicket(ctx context.Context, id string, t Ticket) error
+	// GetTicket returns ErrNotFound for an unknown ID.
+	GetTicket(ctx context.Context, id string) (Record, error)
+	Lookup(ctx context.Context, email string) (Context, error)
+}
+
+// CaseKind is the kind of case conn files a thread triaged as intent under,
+// empty when the intent is neither a sales nor a support one.
+func CaseKind(conn store.CRMConnection, intent string) string {
+	intent = strings.ToLower(strings.TrimSpace(intent))
+	if intent == "" {
+		return ""
+	}
+	sales, support := conn.SalesIntents, conn.SupportIntents
+	if len(sales) == 0 {
+		sales = DefaultSalesIntents
+	}
+	if len(support) == 0 {
+		support = DefaultSupportIntents
+	}
+	match := func(intents []string) bool {
+		return slices.ContainsFunc(intents, func(i string) bool { return strings.EqualFold(i, intent) })
+	}
+	switch {
+	case match(sales):
+		return KindSales
+	case match(support):
+		return KindSupport
+	}
+	return ""
+}
+
+// Priority maps a triage urgency to a ticket priority, empty for urgencies
+// it does not know.
+func Priority(urgency string) string {
+	switch strings.ToLower(strings.TrimSpace(urgency)) {
+	case "critical", "urgent", "high":
+		return "HIGH"
+	case "medium", "normal":
+		return "MEDIUM"
+	case "low":
+		return "LOW"
+	}
+	return ""
+}
+
+// Bridge files threads in their org's CRM.
+type Bridge struct {
+	Config config.Config
+	// Connect, when set, replaces the built-in connectors. It is given the
+	// connection with its access token decrypted.
+	Connect func(conn store.CRMConnection) (Connector, error)
+}
+
+func NewBridge(cfg config.Config) *Bridge {
+	return &Bridge{Config: cfg}
+}
+
+// Seal returns conn with its access token encrypted with
+// security.token_encryption_key, as connections are stored. Stored tokens
+// are only decrypted by the Bridge, to build a connector.
+func Seal(cfg config.Config, conn store.CRMConnection) (store.CRMConnection, error) {
+	key, err := secrets.ParseKey(cfg.Security.TokenEncryptionKey)
+	if err != nil {
+		return conn, fmt.Errorf("%w: security.token_encryption_key: %v", ErrNotConfigured, err)
+	}
+	if conn.AccessToken, err = secrets.Seal(conn.AccessToken, key); err != nil {
+		return conn, err
+	}
+	conn.Sealed = true
+	return conn, nil
+}
+
+// open returns conn with its access token decrypted. A token stored in
+// plaintext before tokens were sealed is sealed in place.
+func (b *Bridge) open(ctx context.Context, st *store.Store, conn store.CRMConnection) (store.CRMConnection, error) {
+	key, err := secrets.ParseKey(b.Config.Security.TokenEncryptionKey)
+	if err != nil {
+		return conn, fmt.Errorf("%w: security.token_encryption_key: %v", ErrNotConfigured, err)
+	}
+	if !conn.Sealed {
+		sealed, err := secrets.Seal(conn.AccessToken, key)
+		if err != nil {
+			return conn, err
+		}
+		return conn, st.SealCRMConnection(ctx, conn.OrgID, sealed)
+	}
+	if conn.AccessToken, err = secrets.Open(conn.AccessToken, key); err != nil {
+		return conn, fmt.Errorf("crm token for org %s: %w", conn.OrgID, err)
+	}
+	return conn, nil
+}
+
+func (b *Bridge) connector(ctx context.Context, st *store.Store, conn store.CRMConnection) (Connector, error) {
+	conn, err := b.open(ctx, st, conn)
+	if err != nil {
+		return nil, err
+	}
+	if b.Connect != nil {
+		return b.Connect(conn)
+	}
+	switch conn.Provider {
+	case ProviderHubSpot:
+		return NewHubSpot(b.Config, conn.AccessToken), nil
+	}
+	return nil, fmt.Errorf("unsupported crm provider %q", conn.Provider)
+}
+
+// SyncCase files msg's thread, triaged as intent and urgency, in its org's
+// CRM: the sender becomes a contact and the thread a ticket. A thread that
+// is already linked only has its ticket's priority updated when it changed.
+// It returns the zero link when the org has no CRM or the intent is not a
+// case.
+func (b *Bridge) SyncCase(ctx context.Context, st *store.Store, msg store.Message, intent string, urgency string) (store.CRMLink, error) {
+	conn, err := st.GetThreadCRMConnection(ctx, msg.ThreadID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.CRMLink{}, nil
+	}
+	if err != nil {
+		return store.CRMLink{}, err
+	}
+	kind := CaseKind(conn, intent)
+	if kind == "" {
+		return store.CRMLink{}, nil
+	}
+	c, err := b.connector(ctx, st, conn)
+	if err != nil {
+		return store.CRMLink{}, err
+	}
+	priority := Priority(urgency)
+	link, err := st.GetCRMLink(ctx, msg.ThreadID)
+	switch {
+	case err == nil && link.Provider == conn.Provider:
+		if priority == "" || priority == link.Priority {
+			return link, nil
+		}
+		if err := c.UpdateTicket(ctx, link.TicketID, Ticket{Priority: priority}); err != nil {
+			return link, err
+		}
+		link.Priority = priority
+		return st.PutCRMLink(ctx, link)
+	case err != nil && !errors.Is(err, sql.ErrNoRows):
+		return store.CRMLink{}, err
+	}
+	// Not linked yet, or linked in a CRM the org has since replaced.
+	return b.file(ctx, st, c, conn, msg, kind, priority, "triage")
+}
+
+// LinkThread links msg's thread to ticketID in its org's CRM or, with no
+// ticketID, files it as a new case of kind from msg, as SyncCase would.
+// actor is recorded as who linked it.
+func (b *Bridge) LinkThread(ctx context.Context, st *store.Store, msg store.Message, ticketID string, kind string, actor string) (store.CRMLink, error) {
+	conn, err := st.GetThreadCRMConnection(ctx, msg.ThreadID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.CRMLink{}, ErrNotConnected
+	}
+	if err != nil {
+		return store.CRMLink{}, err
+	}
+	c, err := b.connector(ctx, st, conn)
+	if err != nil {
+		return store.CRMLink{}, err
+	}
+	if kind == "" {
+		kind = KindSupport
+	}
+	if ticketID == "" {
+		return b.file(ctx, st, c, conn, msg, kind, "", actor)
+	}
+	if _, err := c.GetTicket(ctx, ticketID); err != nil {
+		return store.CRMLink{}, err
+	}
+	return st.PutCRMLink(ctx, store.CRMLink{
+		ThreadID: msg.ThreadID,
+		Provider: conn.Provider,
+		Kind:     kind,
+		TicketID: ticketID,
+		LinkedBy: actor,
+	})
+}
+
+// Context returns what orgID's CRM knows about email and, when ticketID is
+// set, that ticket too, first among the tickets. orgID may be empty on a
+// self-hosted install.
+func (b *Bridge) Context(ctx context.Context, st *store.Store, orgID string, email string, ticketID string) (string, Context, error) {
+	conn, err := st.GetCRMConnection(ctx, orgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", Context{}, ErrNotConnected
+	}
+	if err != nil {
+		return "", Context{}, err
+	}
+	c, err := b.connector(ctx, st, conn)
+	if err != nil {
+		return conn.Provider, Context{}, err
+	}
+	out := Context{Tickets: []Record{}, Deals: []Record{}}
+	if email != "" {
+		if out, err = c.Lookup(ctx, email); err != nil {
+			return conn.Provider, Context{}, err
+		}
+	}
+	if ticketID != "" && !slices.ContainsFunc(out.Tickets, func(r Record) bool { return r.ID == ticketID }) {
+		ticket, err := c.GetTicket(ctx, ticketID)
+		switch {
+		case err == nil:
+			out.Tickets = append([]Record{ticket}, out.Tickets...)
+		case !errors.Is(err, ErrNotFound):
+			return conn.Provider, Context{}, err
+		}
+	}
+	return conn.Provider, out, nil
+}
+
+func (b *Bridge) file(ctx context.Context, st *store.Store, c Connector, conn store.CRMConnection, msg store.Message, kind string, priority string, linkedBy string) (store.CRMLink, error) {
+	var contactID string
+	if email := strings.TrimSpace(msg.From.Email); email != "" {
+		var err error
+		if contactID, err = c.UpsertContact(ctx, Person{Email: email, Name: msg.From.Name}); err != nil {
+			return store.CRMLink{}, err
+		}
+	}
+	subject := strings.TrimSpace(msg.Subject)
+	if subject == "" {
+		subject = "(no subject)"
+	}
+	ticketID, err := c.CreateTicket(ctx, Ticket{
+		Subject:     subject,
+		Description: truncate(msg.Text, maxDescriptionBytes),
+		Kind:        kind,
+		Priority:    priority,
+		Pipeline:    conn.TicketPipeline,
+		Stage:       conn.TicketStage,
+		ContactID:   contactID,
+	})
+	if err != nil {
+		return store.CRMLink{}, err
+	}
+	return st.PutCRMLink(ctx, store.CRMLink{
+		ThreadID:  msg.ThreadID,
+		Provider:  conn.Provider,
+		Kind:      kind,
+		ContactID: contactID,
+		TicketID:  ticketID,
+		Priority:  priority,
+		LinkedBy:  linkedBy,
+	})
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,94 @@
+package jmap
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// RangeFetcher is a client that can read the mail received in a date
+// range, which backfills need.
+type RangeFetcher interface {
+	// FetchRange returns the next page of mail received in [since, until)
+	// after cursor, and the cursor to continue from, empty once the range
+	// is exhausted.
+	FetchRange(ctx context.Context, since, until time.Time, cursor string) ([]Email, string, error)
+}
+
+// Range returns a client reading the mail client's FetchRange finds in
+// [since, until), with the range cursor as its sync state, so a backfill
+// ingests like a poll. ok is false when client cannot read ranges.
+func Range(client Client, since, until time.Time) (Client, bool) {
+	fetcher, ok := client.(RangeFetcher)
+	if !ok {
+		return nil, false
+	}
+	return rangeClient{name: client.Name(), fetcher: fetcher, since: since, until: until}, true
+}
+
+type rangeClient struct {
+	name    string
+	fetcher RangeFetcher
+	since   time.Time
+	until   time.Time
+}
+
+func (r rangeClient) Name() string { return r.name }
+
+func (r rangeClient) FetchChanges(ctx context.Context, cursor string) ([]Email, string, error) {
+	return r.fetcher.FetchRange(ctx, r.since, r.until, cursor)
+}
+
+// rangePageSize is how many emails one FetchRange call reads.
+const rangePageSize = 100
+
+// FetchRange reads the inbox mailbox's mail received in [since, until),
+// oldest first. The cursor is the position in that query.
+func (c *JMAPClient) FetchRange(ctx context.Context, since, until time.Time, cursor string) ([]Email, string, error) {
+	position := 0
+	if cursor != "" {
+		var err error
+		if position, err = strconv.Atoi(cursor); err != nil || position < 0 {
+			return nil, cursor, fmt.Errorf("invalid jmap backfill cursor %q", cursor)
+		}
+	}
+	if err := c.ensureSession(ctx); err != nil {
+		return nil, cursor, err
+	}
+	if err := c.ensureInboxMailbox(ctx); err != nil {
+		return nil, cursor, err
+	}
+	resp, err := c.call(ctx, "Email/query", map[string]any{
+		"accountId": c.accountID,
+		"filter": map[string]any{
+			"inMailbox": c.inboxMailboxID,
+			"after":     utcDate(since),
+			"before":    utcDate(until),
+		},
+		"sort":     []map[string]any{{"property": "receivedAt", "isAscending": true}},
+		"position": position,
+		"limit":    rangePageSize,
+	})
+	if err != nil {
+		return nil, cursor, err
+	}
+	ids := toStringSlice(resp["ids"])
+	if len(ids) == 0 {
+		return nil, "", nil
+	}
+	emails, err := c.emailGet(ctx, ids)
+	if err != nil {
+		return nil, cursor, err
+	}
+	next := ""
+	if len(ids) == rangePageSize {
+		next = strconv.Itoa(position + len(ids))
+	}
+	return emails, next, nil
+}
+
+// utcDate formats t as a JMAP UTCDate.
+func utcDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
@@ -0,0 +1,69 @@
+package jmap
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"neuralmail/internal/store"
+)
+
+// Filter is an inbox's store.IngestFilter ready to match mail.
+type Filter struct {
+	senders  []string
+	subjects []*regexp.Regexp
+	calendar bool
+	maxBytes int64
+}
+
+// NewFilter compiles f. It fails on a subject pattern that is not valid RE2.
+func NewFilter(f store.IngestFilter) (*Filter, error) {
+	out := &Filter{calendar: f.SkipCalendarResponses, maxBytes: f.MaxMessageBytes}
+	for _, sender := range f.SkipSenders {
+		if sender = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(sender), "@")); sender != "" {
+			out.senders = append(out.senders, sender)
+		}
+	}
+	for _, pattern := range f.SkipSubjects {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("subject pattern %q: %w", pattern, err)
+		}
+		out.subjects = append(out.subjects, re)
+	}
+	return out, nil
+}
+
+// SkipReason returns the store.SkipReason* of the first filter that matches
+// email, or "" to ingest it. A nil Filter matches nothing.
+func (f *Filter) SkipReason(email Email) string {
+	if f == nil {
+		return ""
+	}
+	if from := strings.ToLower(strings.TrimSpace(email.From.Email)); from != "" {
+		_, domain, _ := strings.Cut(from, "@")
+		for _, sender := range f.senders {
+			if from == sender || domain == sender || strings.HasSuffix(domain, "."+sender) {
+				return store.SkipReasonSender
+			}
+		}
+	}
+	for _, re := range f.subjects {
+		if re.MatchString(email.Subject) {
+			return store.SkipReasonSubject
+		}
+	}
+	if f.calendar && email.CalendarMethod == "REPLY" {
+		return store.SkipReasonCalendarResponse
+	}
+	if f.maxBytes > 0 {
+		size := email.Size
+		if size == 0 {
+			size = int64(len(email.Text) + len(email.HTML))
+		}
+		if size > f.maxBytes {
+			return store.SkipReasonSize
+		}
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package jmap
+
+import (
+	"strings"
+	"testing"
+
+	"neuralmail/internal/store"
+)
+
+func TestFilterSkipReason(t *testing.T) {
+	filter, err := NewFilter(store.IngestFilter{
+		SkipSenders:           []string{"noreply@shop.example", "@newsletters.example"},
+		SkipSubjects:          []string{`^\[jira\]`, "out of office"},
+		SkipCalendarResponses: true,
+		MaxMessageBytes:       1000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := func(addr string) store.Participant { return store.Participant{Email: addr} }
+	cases := []struct {
+		name  string
+		email Email
+		want  string
+	}{
+		{"customer", Email{From: from("jane@customer.example"), Subject: "Refund", Size: 500}, ""},
+		{"address", Email{From: from("NoReply@shop.example")}, store.SkipReasonSender},
+		{"other address on the domain", Email{From: from("orders@shop.example")}, ""},
+		{"domain", Email{From: from("weekly@newsletters.example")}, store.SkipReasonSender},
+		{"subdomain", Email{From: from("weekly@mail.newsletters.example")}, store.SkipReasonSender},
+		{"lookalike domain", Email{From: from("weekly@fakenewsletters.example")}, ""},
+		{"subject", Email{Subject: "[JIRA] NM-12 updated"}, store.SkipReasonSubject},
+		{"subject anywhere", Email{Subject: "Re: Out of Office until Monday"}, store.SkipReasonSubject},
+		{"calendar reply", Email{CalendarMethod: "REPLY"}, store.SkipReasonCalendarResponse},
+		{"calendar invite", Email{CalendarMethod: "REQUEST"}, ""},
+		{"size", Email{Size: 1001}, store.SkipReasonSize},
+		{"size from body", Email{Text: strings.Repeat("x", 1001)}, store.SkipReasonSize},
+	}
+	for _, tc := range cases {
+		if got := filter.SkipReason(tc.email); got != tc.want {
+			t.Fatalf("%s: expected %q, got %q", tc.name, tc.want, got)
+		}
+	}
+
+	var none *Filter
+	if got := none.SkipReason(Email{CalendarMethod: "REPLY"}); got != "" {
+		t.Fatalf("nil filter skipped mail: %s", got)
+	}
+	if _, err := NewFilter(store.IngestFilter{SkipSubjects: []string{"(unclosed"}}); err == nil {
+		t.Fatal("expected an invalid pattern to fail")
+	}
+}
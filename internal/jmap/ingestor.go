@@ -2,7 +2,10 @@ package jmap
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"log/slog"
+	"strings"
 	"time"
 
 	"neuralmail/internal/store"
@@ -18,6 +21,56 @@ type Email struct {
 	To          []store.Participant
 	ReceivedAt  time.Time
 	InternetMsg string
+	// InReplyTo and References are the threading headers, as bracketed
+	// Message-IDs, used to find the thread when ThreadID is new to us.
+	InReplyTo  string
+	References []string
+	// AutoSubmitted is AutomatedReason for the message's headers.
+	AutoSubmitted string
+	// RawText and RawHTML hold the body as received when Text and HTML have
+	// been cleaned; empty otherwise.
+	RawText string
+	RawHTML string
+	// Report is set when the message is a delivery status notification or
+	// an abuse report about mail we sent.
+	Report *DeliveryReport
+	// Size is the size of the message as received in bytes, 0 if the
+	// provider does not say.
+	Size int64
+	// CalendarMethod is the iTIP method (RFC 5546) of the message's
+	// text/calendar part, such as REQUEST or REPLY; empty without one.
+	CalendarMethod string
+	// Raw is the RFC 5322 message as received, when the client fetched it
+	// whole.
+	Raw []byte
+	// Oversized and RawObjectKey mirror store.Message.
+	Oversized    bool
+	RawObjectKey string
+}
+
+// Kinds of DeliveryReport.
+const (
+	ReportBounce    = "bounce"
+	ReportComplaint = "complaint"
+)
+
+// DeliveryReport is the machine-readable part of a bounce (RFC 3464 DSN) or
+// complaint (RFC 5965 ARF). OriginalMessageID is the Message-ID of the
+// outbound message the report is about. For complaints Action holds the
+// feedback type, such as abuse.
+type DeliveryReport struct {
+	Kind              string
+	Recipient         string
+	Action            string
+	Status            string
+	Diagnostic        string
+	OriginalMessageID string
+}
+
+// Permanent reports whether a bounce is a hard one: delivery failed with a
+// 5.x.x status, so resending to the recipient will not help.
+func (r DeliveryReport) Permanent() bool {
+	return r.Kind == ReportBounce && strings.EqualFold(r.Action, "failed") && strings.HasPrefix(r.Status, "5.")
 }
 
 type Client interface {
@@ -35,14 +88,61 @@ func (n NoopClient) Name() string { return "noop" }
 
 var ErrNotConfigured = errors.New("jmap client not configured")
 
-func Ingest(ctx context.Context, client Client, st *store.Store, inboxID string, sinceState string) (string, []string, error) {
+// DefaultBatchSize is how many messages Ingest stores per statement.
+const DefaultBatchSize = 200
+
+// Ingest stores the emails that arrived since sinceState in inboxID. Mail
+// addressed to one of aliases is recorded with the alias it was sent to, and
+// mail arriving on a closed thread reopens it. Senders of mail from people
+// are added to the org's contacts. Mail filter matches is only counted;
+// bounces and complaints about our own mail are always stored.
+func Ingest(ctx context.Context, client Client, st *store.Store, inboxID string, aliases []store.InboxAlias, filter *Filter, sinceState string) (string, []string, error) {
+	return IngestBatched(ctx, client, st, inboxID, aliases, filter, sinceState, Options{})
+}
+
+// ReportFunc applies a delivery report stored as message reportMsgID.
+type ReportFunc func(ctx context.Context, inboxID string, reportMsgID string, report DeliveryReport) error
+
+// Options tunes IngestBatched. BatchSize 0 means DefaultBatchSize; Reports
+// nil applies delivery reports in place with ApplyReport.
+type Options struct {
+	BatchSize int
+	Reports   ReportFunc
+}
+
+// IngestBatched is Ingest storing up to opts.BatchSize messages at a time:
+// a batch has its threads resolved with store.ThreadsForMessages, is stored
+// with store.InsertMessages and then updates its threads and contacts in a
+// statement each.
+func IngestBatched(ctx context.Context, client Client, st *store.Store, inboxID string, aliases []store.InboxAlias, filter *Filter, sinceState string, opts Options) (string, []string, error) {
 	emails, newState, err := client.FetchChanges(ctx, sinceState)
 	if err != nil {
 		return sinceState, nil, err
 	}
-	var ids []string
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.Reports == nil {
+		opts.Reports = func(ctx context.Context, inboxID string, reportMsgID string, report DeliveryReport) error {
+			return ApplyReport(ctx, st, inboxID, reportMsgID, report)
+		}
+	}
+	b := &batch{st: st, inboxID: inboxID, size: opts.BatchSize, reports: opts.Reports}
+	skipped := map[string]int{}
+	defer func() {
+		if err := st.RecordIngestSkips(ctx, inboxID, skipped); err != nil {
+			slog.ErrorContext(ctx, "ingest record skipped mail failed", "inbox", inboxID, "err", err)
+		}
+	}()
 	for _, email := range emails {
+		if email.Report == nil {
+			if reason := filter.SkipReason(email); reason != "" {
+				skipped[reason]++
+				continue
+			}
+		}
 		msg := store.Message{
+			InboxID:           inboxID,
 			Direction:         "inbound",
 			Subject:           email.Subject,
 			Text:              email.Text,
@@ -51,14 +151,142 @@ func Ingest(ctx context.Context, client Client, st *store.Store, inboxID string,
 			ProviderMessageID: email.ID,
 			ProviderThreadID:  email.ThreadID,
 			InternetMessageID: email.InternetMsg,
+			InReplyTo:         email.InReplyTo,
+			References:        email.References,
 			From:              email.From,
 			To:                email.To,
+			AliasAddress:      store.MatchAlias(email.To, aliases),
+			AutoSubmitted:     email.AutoSubmitted,
+			RawText:           email.RawText,
+			RawHTML:           email.RawHTML,
+			Oversized:         email.Oversized,
+			RawObjectKey:      email.RawObjectKey,
+		}
+		if b.add(email, msg) {
+			if err := b.flush(ctx); err != nil {
+				return sinceState, b.ids, err
+			}
+		}
+	}
+	if err := b.flush(ctx); err != nil {
+		return sinceState, b.ids, err
+	}
+	return newState, b.ids, nil
+}
+
+// batch holds emails until they are stored together. ids are the messages
+// stored so far.
+type batch struct {
+	st      *store.Store
+	inboxID string
+	size    int
+	reports ReportFunc
+
+	emails []Email
+	msgs   []store.Message
+	ids    []string
+}
+
+// add queues msg, reporting whether the batch is now full.
+func (b *batch) add(email Email, msg store.Message) bool {
+	b.emails = append(b.emails, email)
+	b.msgs = append(b.msgs, msg)
+	return len(b.msgs) >= b.size
+}
+
+// flush resolves the batch's threads and stores it, then applies what its
+// messages do to the mail they report on, their threads and their senders'
+// contacts.
+func (b *batch) flush(ctx context.Context) error {
+	if len(b.msgs) == 0 {
+		return nil
+	}
+	emails, msgs := b.emails, b.msgs
+	b.emails, b.msgs = nil, nil
+	threadIDs, err := b.st.ThreadsForMessages(ctx, b.inboxID, msgs)
+	if err != nil {
+		return err
+	}
+	for i := range msgs {
+		msgs[i].ThreadID = threadIDs[i]
+	}
+	ids, err := b.st.InsertMessages(ctx, msgs)
+	if err != nil {
+		return err
+	}
+	b.ids = append(b.ids, ids...)
+	return b.afterInsert(ctx, emails, msgs, ids)
+}
+
+// afterInsert applies stored messages: reports go to b.reports; other mail
+// reopens its thread, is checked for a mail loop and, when a person sent
+// it, updates their contact.
+func (b *batch) afterInsert(ctx context.Context, emails []Email, msgs []store.Message, msgIDs []string) error {
+	st, inboxID := b.st, b.inboxID
+	var mail []store.Message
+	var threadIDs []string
+	var sightings []store.ContactSighting
+	reopen := map[string]bool{}
+	for i, msg := range msgs {
+		if emails[i].Report != nil {
+			if err := b.reports(ctx, inboxID, msgIDs[i], *emails[i].Report); err != nil {
+				return err
+			}
+			continue
+		}
+		mail = append(mail, msg)
+		if !reopen[msg.ThreadID] {
+			reopen[msg.ThreadID] = true
+			threadIDs = append(threadIDs, msg.ThreadID)
 		}
-		_, msgID, err := st.InsertMessageWithThread(ctx, inboxID, email.ThreadID, msg)
-		if err != nil {
-			return sinceState, ids, err
+		if msg.AutoSubmitted == "" {
+			sightings = append(sightings, store.ContactSighting{ThreadID: msg.ThreadID, From: msg.From, SeenAt: msg.CreatedAt})
 		}
-		ids = append(ids, msgID)
 	}
-	return newState, ids, nil
+	if _, err := st.ReopenThreads(ctx, threadIDs); err != nil {
+		return err
+	}
+	if err := detectLoops(ctx, st, mail); err != nil {
+		return err
+	}
+	if err := st.RecordContacts(ctx, inboxID, sightings); err != nil {
+		slog.ErrorContext(ctx, "ingest record contacts failed", "inbox", inboxID, "messages", len(sightings), "err", err)
+	}
+	return nil
+}
+
+// ApplyReport records a bounce or complaint against the outbound message it
+// is about and suppresses the recipient when a hard bounce or complaint means
+// further mail would hurt. Reports that match none of the org's outbound mail
+// are ignored, so a forged report cannot suppress arbitrary addresses.
+func ApplyReport(ctx context.Context, st *store.Store, inboxID string, reportMsgID string, report DeliveryReport) error {
+	if report.OriginalMessageID == "" {
+		return nil
+	}
+	delivery, err := st.GetOutboxByInternetMessageID(ctx, inboxID, report.OriginalMessageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var status, reason string
+	switch {
+	case report.Kind == ReportComplaint:
+		status, reason = store.DeliveryComplained, store.SuppressComplaint
+	case report.Permanent():
+		status, reason = store.DeliveryBounced, store.SuppressHardBounce
+	default:
+		return nil
+	}
+	detail := strings.TrimSpace(strings.Join([]string{report.Status, report.Diagnostic}, " "))
+	if detail == "" {
+		detail = report.Kind
+	}
+	slog.WarnContext(ctx, "ingest delivery report", "kind", report.Kind, "message", delivery.MessageID, "recipient", delivery.To, "detail", detail)
+	if err := st.FailOutbox(ctx, delivery.ID, status, detail); err != nil {
+		return err
+	}
+	return st.AddSuppression(ctx, inboxID, delivery.To, reason, reportMsgID)
 }
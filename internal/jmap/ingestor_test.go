@@ -0,0 +1,25 @@
+package jmap
+
+import (
+	"testing"
+
+	"neuralmail/internal/store"
+)
+
+func TestBatchFillsToItsSize(t *testing.T) {
+	b := &batch{size: 3}
+	if full := b.add(Email{ID: "1"}, store.Message{InternetMessageID: "<a@customer.example>"}); full {
+		t.Fatal("expected room in the batch after one message")
+	}
+	// A reply to a message waiting in the batch joins it: threads are
+	// resolved for the whole batch when it is stored.
+	if full := b.add(Email{ID: "2"}, store.Message{InReplyTo: "<a@customer.example>"}); full {
+		t.Fatal("expected a reply to stay in the batch")
+	}
+	if full := b.add(Email{ID: "3"}, store.Message{}); !full {
+		t.Fatal("expected the batch to be full at its size")
+	}
+	if len(b.msgs) != 3 || len(b.emails) != 3 {
+		t.Fatalf("expected 3 queued messages, got %d", len(b.msgs))
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
 	"net/url"
 	"strings"
@@ -20,6 +21,9 @@ const mailCapability = "urn:ietf:params:jmap:mail"
 type JMAPClient struct {
 	cfg           config.Config
 	httpClient    *http.Client
+	// account names the mail account to sync; empty is the login's
+	// primary account.
+	account       string
 	apiURL        string
 	accountID     string
 	inboxMailboxID string
@@ -35,6 +39,13 @@ func NewJMAPClient(cfg config.Config) (*JMAPClient, error) {
 	}, nil
 }
 
+// ForAccount returns a client syncing the mail account named name, such as
+// another inbox's address, through the same login. The login must have been
+// given access to that account.
+func (c *JMAPClient) ForAccount(name string) *JMAPClient {
+	return &JMAPClient{cfg: c.cfg, httpClient: c.httpClient, account: name}
+}
+
 func (c *JMAPClient) Name() string { return "jmap" }
 
 func (c *JMAPClient) FetchChanges(ctx context.Context, sinceState string) ([]Email, string, error) {
@@ -100,6 +111,10 @@ func (c *JMAPClient) ensureSession(ctx context.Context) error {
 	var session struct {
 		APIURL          string            `json:"apiUrl"`
 		PrimaryAccounts map[string]string `json:"primaryAccounts"`
+		Accounts        map[string]struct {
+			Name                string                     `json:"name"`
+			AccountCapabilities map[string]json.RawMessage `json:"accountCapabilities"`
+		} `json:"accounts"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
 		return err
@@ -108,6 +123,18 @@ func (c *JMAPClient) ensureSession(ctx context.Context) error {
 		return errors.New("missing apiUrl in session")
 	}
 	accountID := session.PrimaryAccounts[mailCapability]
+	if c.account != "" {
+		accountID = ""
+		for id, account := range session.Accounts {
+			if _, ok := account.AccountCapabilities[mailCapability]; ok && strings.EqualFold(account.Name, c.account) {
+				accountID = id
+				break
+			}
+		}
+		if accountID == "" {
+			return fmt.Errorf("no jmap mail account named %s", c.account)
+		}
+	}
 	if accountID == "" {
 		return errors.New("missing mail account id")
 	}
@@ -191,6 +218,14 @@ func (c *JMAPClient) emailGet(ctx context.Context, ids []string) ([]Email, error
 		"ids":       ids,
 		"properties": []string{
 			"id", "threadId", "subject", "from", "to", "cc", "receivedAt", "bodyValues", "textBody", "htmlBody", "messageId",
+			"inReplyTo", "references", "size", "bodyStructure",
+			"header:Auto-Submitted:asText", "header:Precedence:asText",
+		},
+		// The defaults plus each part's Content-Type header, which carries
+		// a calendar part's iTIP method.
+		"bodyProperties": []string{
+			"partId", "blobId", "size", "name", "type", "charset", "disposition", "cid", "subParts",
+			"header:Content-Type:asText",
 		},
 	}
 	resp, err := c.call(ctx, "Email/get", args)
@@ -214,6 +249,7 @@ func (c *JMAPClient) emailGet(ctx context.Context, ids []string) ([]Email, error
 			}
 		}
 		text, html := extractBodies(emailMap)
+		size, _ := emailMap["size"].(float64)
 		emails = append(emails, Email{
 			ID:          getString(emailMap, "id"),
 			ThreadID:    getString(emailMap, "threadId"),
@@ -223,7 +259,15 @@ func (c *JMAPClient) emailGet(ctx context.Context, ids []string) ([]Email, error
 			From:        firstParticipant(emailMap["from"]),
 			To:          parseParticipants(emailMap["to"]),
 			ReceivedAt:  received,
-			InternetMsg: getString(emailMap, "messageId"),
+			InternetMsg: firstMessageID(emailMap["messageId"]),
+			InReplyTo:   firstMessageID(emailMap["inReplyTo"]),
+			References:  bracketMessageIDs(emailMap["references"]),
+			AutoSubmitted: AutomatedReason(
+				getString(emailMap, "header:Auto-Submitted:asText"),
+				getString(emailMap, "header:Precedence:asText"),
+			),
+			Size:           int64(size),
+			CalendarMethod: calendarMethod(emailMap["bodyStructure"]),
 		})
 	}
 	return emails, nil
@@ -305,6 +349,28 @@ func getString(m map[string]any, key string) string {
 	return ""
 }
 
+// firstMessageID returns the first JMAP messageId in the bracketed form the
+// Message-ID header uses, so messages ingested over JMAP and from raw MIME
+// carry the same internet_message_id.
+func firstMessageID(raw any) string {
+	ids := toStringSlice(raw)
+	if len(ids) == 0 || ids[0] == "" {
+		return ""
+	}
+	return "<" + ids[0] + ">"
+}
+
+// bracketMessageIDs returns every JMAP message id in raw in bracketed form.
+func bracketMessageIDs(raw any) []string {
+	var out []string
+	for _, id := range toStringSlice(raw) {
+		if id != "" {
+			out = append(out, "<"+id+">")
+		}
+	}
+	return out
+}
+
 func toStringSlice(raw any) []string {
 	arr, ok := raw.([]any)
 	if !ok {
@@ -346,6 +412,26 @@ func firstParticipant(raw any) store.Participant {
 	return participants[0]
 }
 
+// calendarMethod returns the iTIP method from the Content-Type of the first
+// text/calendar part in a bodyStructure.
+func calendarMethod(raw any) string {
+	part, ok := raw.(map[string]any)
+	if !ok {
+		return ""
+	}
+	if strings.EqualFold(getString(part, "type"), "text/calendar") {
+		_, params, _ := mime.ParseMediaType(getString(part, "header:Content-Type:asText"))
+		return strings.ToUpper(strings.TrimSpace(params["method"]))
+	}
+	subParts, _ := part["subParts"].([]any)
+	for _, sub := range subParts {
+		if method := calendarMethod(sub); method != "" {
+			return method
+		}
+	}
+	return ""
+}
+
 func extractBodies(email map[string]any) (string, string) {
 	bodyValues, _ := email["bodyValues"].(map[string]any)
 	textBody := extractBodyValue(bodyValues, email["textBody"])
@@ -0,0 +1,92 @@
+package jmap
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"neuralmail/internal/config"
+)
+
+func TestForAccountPicksAccountByName(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{
+			"apiUrl": "/jmap",
+			"primaryAccounts": {"urn:ietf:params:jmap:mail": "a1"},
+			"accounts": {
+				"a1": {"name": "dev@local.neuralmail", "accountCapabilities": {"urn:ietf:params:jmap:mail": {}}},
+				"a2": {"name": "Support@Acme.test", "accountCapabilities": {"urn:ietf:params:jmap:mail": {}}},
+				"a3": {"name": "calendar@acme.test", "accountCapabilities": {}}
+			}
+		}`))
+	}))
+	defer srv.Close()
+
+	var cfg config.Config
+	cfg.JMAP.URL = srv.URL + "/jmap"
+	cfg.JMAP.SessionURL = srv.URL + "/.well-known/jmap"
+	cfg.JMAP.Username = "dev"
+	cfg.JMAP.Password = "devpass"
+	primary, err := NewJMAPClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := primary.ensureSession(ctx); err != nil || primary.accountID != "a1" {
+		t.Fatalf("expected the primary account, got %q %v", primary.accountID, err)
+	}
+	support := primary.ForAccount("support@acme.test")
+	if err := support.ensureSession(ctx); err != nil || support.accountID != "a2" {
+		t.Fatalf("expected support's account, got %q %v", support.accountID, err)
+	}
+	// An account without mail, or none at all, is not synced.
+	for _, name := range []string{"calendar@acme.test", "sales@acme.test"} {
+		if err := primary.ForAccount(name).ensureSession(ctx); err == nil || !strings.Contains(err.Error(), name) {
+			t.Fatalf("expected no mail account for %s, got %v", name, err)
+		}
+	}
+}
+
+func TestProbeQueriesTheInbox(t *testing.T) {
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/.well-known/jmap" {
+			_, _ = w.Write([]byte(`{"apiUrl": "/jmap", "primaryAccounts": {"urn:ietf:params:jmap:mail": "a1"}}`))
+			return
+		}
+		var req struct {
+			MethodCalls [][]any `json:"methodCalls"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		method, _ := req.MethodCalls[0][0].(string)
+		methods = append(methods, method)
+		switch method {
+		case "Mailbox/get":
+			_, _ = w.Write([]byte(`{"methodResponses": [["Mailbox/get", {"list": [{"id": "m1", "name": "Inbox", "role": "inbox"}]}, "c1"]]}`))
+		case "Email/query":
+			_, _ = w.Write([]byte(`{"methodResponses": [["Email/query", {"ids": ["e1"], "total": 42}, "c1"]]}`))
+		}
+	}))
+	defer srv.Close()
+
+	var cfg config.Config
+	cfg.JMAP.URL = srv.URL + "/jmap"
+	cfg.JMAP.SessionURL = srv.URL + "/.well-known/jmap"
+	cfg.JMAP.Username = "dev"
+	cfg.JMAP.Password = "devpass"
+	client, err := NewJMAPClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total, err := client.Probe(context.Background())
+	if err != nil || total != 42 {
+		t.Fatalf("expected the inbox's 42 messages, got %d %v", total, err)
+	}
+	if strings.Join(methods, ",") != "Mailbox/get,Email/query" {
+		t.Fatalf("expected a mailbox lookup then a query, got %v", methods)
+	}
+}
@@ -0,0 +1,56 @@
+package jmap
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"neuralmail/internal/store"
+)
+
+// A thread is flagged as looping once loopThreshold automated messages, or
+// loopThreshold identical messages from one sender, arrive within loopWindow.
+const (
+	loopThreshold = 3
+	loopWindow    = time.Hour
+)
+
+// AutomatedReason reports why a message with the given Auto-Submitted
+// (RFC 3834) and Precedence headers looks machine-sent, or "" if it does not.
+func AutomatedReason(autoSubmitted string, precedence string) string {
+	if v := strings.ToLower(strings.TrimSpace(autoSubmitted)); v != "" && v != "no" {
+		if kind, _, _ := strings.Cut(v, ";"); kind != "" {
+			return strings.TrimSpace(kind)
+		}
+	}
+	switch v := strings.ToLower(strings.TrimSpace(precedence)); v {
+	case "bulk", "junk", "list", "auto_reply":
+		return v
+	}
+	return ""
+}
+
+// detectLoops flags the threads of msgs, just stored, for human attention
+// when they have turned into a loop with an auto-responder.
+func detectLoops(ctx context.Context, st *store.Store, msgs []store.Message) error {
+	repeats, err := st.CountInboundRepeats(ctx, msgs, loopWindow)
+	if err != nil {
+		return err
+	}
+	var looping []string
+	for i, r := range repeats {
+		if (r.Automated >= loopThreshold || r.Identical >= loopThreshold) && !slices.Contains(looping, msgs[i].ThreadID) {
+			looping = append(looping, msgs[i].ThreadID)
+		}
+	}
+	if len(looping) == 0 {
+		return nil
+	}
+	flagged, err := st.LabelThreads(ctx, looping, store.LabelLoop)
+	if err == nil && flagged > 0 {
+		slog.WarnContext(ctx, "ingest flagged mail loop", "threads", looping, "flagged", flagged, "window", loopWindow)
+	}
+	return err
+}
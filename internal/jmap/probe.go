@@ -0,0 +1,29 @@
+package jmap
+
+import "context"
+
+// Probe runs what a first sync does, short of fetching mail: the session
+// lookup, the inbox mailbox lookup and an Email/query for one message. It
+// returns the number of messages the inbox holds when the server counts
+// them, or -1.
+func (c *JMAPClient) Probe(ctx context.Context) (int, error) {
+	if err := c.ensureSession(ctx); err != nil {
+		return 0, err
+	}
+	if err := c.ensureInboxMailbox(ctx); err != nil {
+		return 0, err
+	}
+	resp, err := c.call(ctx, "Email/query", map[string]any{
+		"accountId":      c.accountID,
+		"filter":         map[string]any{"inMailbox": c.inboxMailboxID},
+		"limit":          1,
+		"calculateTotal": true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if total, ok := resp["total"].(float64); ok {
+		return int(total), nil
+	}
+	return -1, nil
+}
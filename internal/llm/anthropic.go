@@ -0,0 +1,161 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAnthropicURL       = "https://api.anthropic.com"
+	defaultAnthropicVersion   = "2023-06-01"
+	defaultAnthropicMaxTokens = 1024
+)
+
+// Anthropic calls Claude models through the Messages API. With Stream set,
+// replies are streamed and assembled, so a proxy's idle timeout does not
+// cut a long draft off.
+type Anthropic struct {
+	chatTasks
+	APIKey    string
+	ModelName string
+	BaseURL   string
+	// Version is sent as the anthropic-version header.
+	Version   string
+	MaxTokens int
+	Stream    bool
+	Client    *http.Client
+}
+
+func NewAnthropic(apiKey, model, baseURL, version string, maxTokens int, stream bool) *Anthropic {
+	if model == "" {
+		model = "claude-3-5-haiku-latest"
+	}
+	if baseURL == "" {
+		baseURL = defaultAnthropicURL
+	}
+	if version == "" {
+		version = defaultAnthropicVersion
+	}
+	if maxTokens <= 0 {
+		maxTokens = defaultAnthropicMaxTokens
+	}
+	a := &Anthropic{
+		APIKey:    apiKey,
+		ModelName: model,
+		BaseURL:   strings.TrimRight(baseURL, "/"),
+		Version:   version,
+		MaxTokens: maxTokens,
+		Stream:    stream,
+		Client:    &http.Client{Timeout: 60 * time.Second},
+	}
+	a.chatTasks = chatTasks{complete: a.complete}
+	return a
+}
+
+func (a *Anthropic) Name() string  { return "anthropic" }
+func (a *Anthropic) Model() string { return a.ModelName }
+
+func (a *Anthropic) complete(ctx context.Context, system, user string) (string, error) {
+	body := map[string]any{
+		"model":      a.ModelName,
+		"max_tokens": a.MaxTokens,
+		"system":     system,
+		"messages":   []map[string]string{{"role": "user", "content": user}},
+	}
+	if a.Stream {
+		body["stream"] = true
+	}
+	payload, _ := json.Marshal(body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.BaseURL+"/v1/messages", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", a.APIKey)
+	req.Header.Set("anthropic-version", a.Version)
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", &StatusError{Provider: "anthropic", StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(msg))}
+	}
+	if a.Stream {
+		return a.readStream(ctx, resp.Body)
+	}
+	var decoded struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		Usage anthropicUsage `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return "", err
+	}
+	reportUsage(ctx, decoded.Usage.InputTokens, decoded.Usage.OutputTokens)
+	var text strings.Builder
+	for _, block := range decoded.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	return text.String(), nil
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// readStream assembles a streamed reply from its text deltas. Input tokens
+// arrive with message_start, output tokens with the closing message_delta.
+func (a *Anthropic) readStream(ctx context.Context, r io.Reader) (string, error) {
+	var text strings.Builder
+	var billed anthropicUsage
+	err := readSSE(r, func(event, data string) error {
+		var decoded struct {
+			Message struct {
+				Usage anthropicUsage `json:"usage"`
+			} `json:"message"`
+			Delta struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"delta"`
+			Usage *anthropicUsage `json:"usage"`
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+			return err
+		}
+		switch event {
+		case "message_start":
+			billed.InputTokens = decoded.Message.Usage.InputTokens
+		case "content_block_delta":
+			if decoded.Delta.Type == "text_delta" {
+				text.WriteString(decoded.Delta.Text)
+			}
+		case "message_delta":
+			if decoded.Usage != nil {
+				billed.OutputTokens = decoded.Usage.OutputTokens
+			}
+		case "message_stop":
+			return errStopSSE
+		case "error":
+			return fmt.Errorf("anthropic stream failed: %s", decoded.Error.Message)
+		}
+		return nil
+	})
+	reportUsage(ctx, billed.InputTokens, billed.OutputTokens)
+	return text.String(), err
+}
@@ -0,0 +1,66 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAnthropicClassifyReportsBilledTokens(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" || r.Header.Get("x-api-key") != "key" || r.Header.Get("anthropic-version") == "" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"content":[{"type":"text","text":"{\"intent\":\"billing\",\"urgency\":\"high\",\"sentiment\":\"negative\",\"confidence\":0.9}"}],` +
+			`"usage":{"input_tokens":120,"output_tokens":30}}`))
+	}))
+	defer srv.Close()
+
+	claude := NewAnthropic("key", "claude-3-5-haiku-latest", srv.URL, "", 0, false)
+	router := NewRouter(claude, nil, nil, nil)
+	ctx, log := WithCallLog(context.Background())
+	got, err := router.Classify(ctx, "I was double charged", nil)
+	if err != nil {
+		t.Fatalf("classify: %v", err)
+	}
+	if got.Intent != "billing" || got.Urgency != "high" || got.Confidence != 0.9 {
+		t.Fatalf("unexpected classification %+v", got)
+	}
+	calls := log.Calls()
+	if len(calls) != 1 || calls[0].Model != "anthropic:claude-3-5-haiku-latest" || calls[0].Tokens != 150 {
+		t.Fatalf("expected the billed 150 tokens under the anthropic ref, got %+v", calls)
+	}
+}
+
+func TestAnthropicStreamedDraft(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: message_start\ndata: {\"message\":{\"usage\":{\"input_tokens\":40}}}\n\n" +
+			"event: content_block_delta\ndata: {\"delta\":{\"type\":\"text_delta\",\"text\":\"{\\\"text\\\":\\\"Hi, \"}}\n\n" +
+			"event: content_block_delta\ndata: {\"delta\":{\"type\":\"text_delta\",\"text\":\"refunded.\\\",\\\"needs_approval\\\":false}\"}}\n\n" +
+			"event: message_delta\ndata: {\"usage\":{\"output_tokens\":12}}\n\n" +
+			"event: message_stop\ndata: {}\n\n"))
+	}))
+	defer srv.Close()
+
+	claude := NewAnthropic("key", "claude-3-5-sonnet-latest", srv.URL, "", 0, true)
+	ctx, billed := withUsage(context.Background())
+	draft, err := claude.Draft(ctx, "thread", nil, "confirm the refund")
+	if err != nil {
+		t.Fatalf("draft: %v", err)
+	}
+	if body["stream"] != true {
+		t.Fatalf("expected a streamed request, got %v", body)
+	}
+	if draft.Text != "Hi, refunded." || draft.NeedsApproval {
+		t.Fatalf("unexpected draft %+v", draft)
+	}
+	if in, out := billed.counts(); in != 40 || out != 12 {
+		t.Fatalf("expected 40 prompt and 12 completion tokens billed, got %d and %d", in, out)
+	}
+}
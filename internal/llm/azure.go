@@ -0,0 +1,135 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultAzureAPIVersion = "2024-10-21"
+
+// AzureOpenAI calls a chat-completions deployment of an Azure OpenAI
+// resource. Models are named by deployment, so a route's model is the
+// deployment name. With Stream set, replies are streamed and assembled.
+type AzureOpenAI struct {
+	chatTasks
+	Endpoint   string
+	APIKey     string
+	Deployment string
+	APIVersion string
+	Stream     bool
+	Client     *http.Client
+}
+
+func NewAzureOpenAI(endpoint, apiKey, deployment, apiVersion string, stream bool) *AzureOpenAI {
+	if apiVersion == "" {
+		apiVersion = defaultAzureAPIVersion
+	}
+	a := &AzureOpenAI{
+		Endpoint:   strings.TrimRight(endpoint, "/"),
+		APIKey:     apiKey,
+		Deployment: deployment,
+		APIVersion: apiVersion,
+		Stream:     stream,
+		Client:     &http.Client{Timeout: 60 * time.Second},
+	}
+	a.chatTasks = chatTasks{complete: a.complete}
+	return a
+}
+
+func (a *AzureOpenAI) Name() string  { return "azure" }
+func (a *AzureOpenAI) Model() string { return a.Deployment }
+
+func (a *AzureOpenAI) complete(ctx context.Context, system, user string) (string, error) {
+	body := map[string]any{
+		"messages": []map[string]string{
+			{"role": "system", "content": system},
+			{"role": "user", "content": user},
+		},
+	}
+	if a.Stream {
+		body["stream"] = true
+		body["stream_options"] = map[string]any{"include_usage": true}
+	} else {
+		body["response_format"] = map[string]string{"type": "json_object"}
+	}
+	payload, _ := json.Marshal(body)
+	endpoint := fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+		a.Endpoint, url.PathEscape(a.Deployment), url.QueryEscape(a.APIVersion))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("api-key", a.APIKey)
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", &StatusError{Provider: "azure openai", StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(msg))}
+	}
+	if a.Stream {
+		return a.readStream(ctx, resp.Body)
+	}
+	var decoded struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage azureUsage `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return "", err
+	}
+	reportUsage(ctx, decoded.Usage.PromptTokens, decoded.Usage.CompletionTokens)
+	if len(decoded.Choices) == 0 {
+		return "", errors.New("azure openai returned no choices")
+	}
+	return decoded.Choices[0].Message.Content, nil
+}
+
+type azureUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// readStream assembles a streamed reply from its content deltas. The usage
+// comes in a last chunk without choices, before [DONE].
+func (a *AzureOpenAI) readStream(ctx context.Context, r io.Reader) (string, error) {
+	var text strings.Builder
+	err := readSSE(r, func(_, data string) error {
+		if data == "[DONE]" {
+			return errStopSSE
+		}
+		var decoded struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Usage *azureUsage `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+			return err
+		}
+		for _, choice := range decoded.Choices {
+			text.WriteString(choice.Delta.Content)
+		}
+		if decoded.Usage != nil {
+			reportUsage(ctx, decoded.Usage.PromptTokens, decoded.Usage.CompletionTokens)
+		}
+		return nil
+	})
+	return text.String(), err
+}
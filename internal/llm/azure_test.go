@@ -0,0 +1,59 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAzureOpenAIExtractUsesDeployment(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/support-gpt4o/chat/completions" || r.URL.Query().Get("api-version") != "2024-10-21" ||
+			r.Header.Get("api-key") != "key" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"{\"data\":{\"order_id\":\"A-1\"},\"confidence\":0.8}"}}],` +
+			`"usage":{"prompt_tokens":50,"completion_tokens":10}}`))
+	}))
+	defer srv.Close()
+
+	azure := NewAzureOpenAI(srv.URL+"/", "key", "support-gpt4o", "", false)
+	ctx, billed := withUsage(context.Background())
+	schema := map[string]any{"required": []any{"order_id", "email"}}
+	got, err := azure.Extract(ctx, "Order A-1 is late", schema, nil)
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if got.Data["order_id"] != "A-1" || len(got.MissingFields) != 1 || got.MissingFields[0] != "email" {
+		t.Fatalf("unexpected extraction %+v", got)
+	}
+	if in, out := billed.counts(); in != 50 || out != 10 {
+		t.Fatalf("expected 50 prompt and 10 completion tokens billed, got %d and %d", in, out)
+	}
+}
+
+func TestAzureOpenAIStreamedTranslate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"{\\\"text\\\":\\\"Hallo\"}}]}\n\n" +
+			"data: {\"choices\":[{\"delta\":{\"content\":\"\\\",\\\"source_language\\\":\\\"en\\\"}\"}}]}\n\n" +
+			"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":20,\"completion_tokens\":5}}\n\n" +
+			"data: [DONE]\n\n"))
+	}))
+	defer srv.Close()
+
+	azure := NewAzureOpenAI(srv.URL, "key", "support-gpt4o", "", true)
+	ctx, billed := withUsage(context.Background())
+	got, err := azure.Translate(ctx, "Hello", "de")
+	if err != nil {
+		t.Fatalf("translate: %v", err)
+	}
+	if got.Text != "Hallo" || got.SourceLanguage != "en" || got.TargetLanguage != "de" {
+		t.Fatalf("unexpected translation %+v", got)
+	}
+	if in, out := billed.counts(); in != 20 || out != 5 {
+		t.Fatalf("expected 20 prompt and 5 completion tokens billed, got %d and %d", in, out)
+	}
+}
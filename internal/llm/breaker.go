@@ -0,0 +1,165 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Circuit breaker states, as reported by Router.Health.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// Breaker defaults: a model is skipped after this many outages in a row, for
+// this long, before one call is let through to probe it.
+const (
+	DefaultBreakerFailures = 5
+	DefaultBreakerCooldown = 30 * time.Second
+)
+
+// StatusError is a provider API's refusal of a request.
+type StatusError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s request failed: %d %s: %s", e.Provider, e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
+// IsOutage reports whether err means the model is unavailable rather than
+// that it mishandled the request: a timeout, a failed connection, a rate
+// limit or a server error. Only outages count toward a breaker.
+func IsOutage(err error) bool {
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.StatusCode == http.StatusTooManyRequests || status.StatusCode >= 500
+	}
+	var netErr net.Error
+	var urlErr *url.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) || errors.As(err, &urlErr)
+}
+
+// ModelHealth is a model's breaker state. RetryAt is when an open breaker
+// lets its probe through.
+type ModelHealth struct {
+	Model     string     `json:"model"`
+	State     string     `json:"state"`
+	Failures  int        `json:"consecutive_failures"`
+	LastError string     `json:"last_error,omitempty"`
+	RetryAt   *time.Time `json:"retry_at,omitempty"`
+}
+
+type breaker struct {
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	lastError string
+}
+
+// allow reports whether a call may go to ref. A breaker whose cooldown has
+// passed lets one probe call through at a time.
+func (r *Router) allow(ref string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b := r.breakers[ref]
+	if b == nil || b.failures < r.breakerFailures() {
+		return true
+	}
+	if b.probing || r.now().Before(b.openedAt.Add(r.breakerCooldown())) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record updates ref's breaker with a call's outcome. Any answer, even an
+// error that is not an outage, shows the model is up; a call the caller
+// abandoned shows nothing.
+func (r *Router) record(ref string, err error, abandoned bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.breakers == nil {
+		r.breakers = map[string]*breaker{}
+	}
+	b := r.breakers[ref]
+	if b == nil {
+		b = &breaker{}
+		r.breakers[ref] = b
+	}
+	b.probing = false
+	if abandoned {
+		return
+	}
+	if err == nil || !IsOutage(err) {
+		b.failures, b.lastError = 0, ""
+		return
+	}
+	b.failures++
+	b.lastError = err.Error()
+	if b.failures >= r.breakerFailures() {
+		b.openedAt = r.now()
+	}
+}
+
+// Health reports the breaker of every model called so far and of the
+// default and fallback models, by ref.
+func (r *Router) Health() []ModelHealth {
+	refs := []string{Ref{Provider: r.Default.Name(), Model: r.Default.Model()}.String()}
+	refs = append(refs, r.Fallbacks...)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for ref := range r.breakers {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	var out []ModelHealth
+	for i, ref := range refs {
+		if i > 0 && refs[i-1] == ref {
+			continue
+		}
+		h := ModelHealth{Model: ref, State: BreakerClosed}
+		if b := r.breakers[ref]; b != nil {
+			h.Failures, h.LastError = b.failures, b.lastError
+			if b.failures >= r.breakerFailures() {
+				retryAt := b.openedAt.Add(r.breakerCooldown())
+				h.State, h.RetryAt = BreakerOpen, &retryAt
+				if b.probing || !r.now().Before(retryAt) {
+					h.State = BreakerHalfOpen
+				}
+			}
+		}
+		out = append(out, h)
+	}
+	return out
+}
+
+func (r *Router) breakerFailures() int {
+	if r.BreakerFailures > 0 {
+		return r.BreakerFailures
+	}
+	return DefaultBreakerFailures
+}
+
+func (r *Router) breakerCooldown() time.Duration {
+	if r.BreakerCooldown > 0 {
+		return r.BreakerCooldown
+	}
+	return DefaultBreakerCooldown
+}
+
+func (r *Router) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Token budget limits, as reported in BudgetError.Limit.
+const (
+	BudgetPerCall = "per_call"
+	BudgetDaily   = "daily"
+)
+
+// ErrTokenBudgetExceeded is matched by every BudgetError.
+var ErrTokenBudgetExceeded = errors.New("token budget exceeded")
+
+// BudgetError refuses a model call that would go over a token budget.
+// Used is what the day's budget had spent, Requested the call's estimated
+// prompt tokens.
+type BudgetError struct {
+	Limit     string
+	Budget    int64
+	Used      int64
+	Requested int64
+}
+
+func (e *BudgetError) Error() string {
+	if e.Limit == BudgetPerCall {
+		return fmt.Sprintf("token budget exceeded: the prompt needs %d tokens, over the %d allowed per call", e.Requested, e.Budget)
+	}
+	return fmt.Sprintf("token budget exceeded: %d of the %d tokens allowed today are spent", e.Used, e.Budget)
+}
+
+func (e *BudgetError) Is(target error) bool { return target == ErrTokenBudgetExceeded }
+
+// TokenLedger counts the tokens spent under a key per UTC day; *queue.Queue
+// implements it in Redis so every replica shares the counts.
+type TokenLedger interface {
+	DailyTokens(ctx context.Context, key string, day time.Time) (int64, error)
+	AddDailyTokens(ctx context.Context, key string, day time.Time, tokens int64) error
+}
+
+// Budget limits the tokens a Router spends under a context. PerCall caps
+// a single request's prompt; Daily caps what Key, such as an org, spends in
+// a UTC day, as counted by Ledger. Zero limits are not enforced, nor is
+// Daily without a Ledger.
+type Budget struct {
+	PerCall int64
+	Daily   int64
+	Key     string
+	Ledger  TokenLedger
+	Now     func() time.Time
+}
+
+type budgetKey struct{}
+
+// WithBudget returns a context whose Router calls are held to b.
+func WithBudget(ctx context.Context, b Budget) context.Context {
+	return context.WithValue(ctx, budgetKey{}, b)
+}
+
+// BudgetFrom returns the Budget WithBudget put on ctx, if any.
+func BudgetFrom(ctx context.Context) (Budget, bool) {
+	b, ok := ctx.Value(budgetKey{}).(Budget)
+	return b, ok
+}
+
+func (b Budget) day() time.Time {
+	if b.Now != nil {
+		return b.Now().UTC()
+	}
+	return time.Now().UTC()
+}
+
+// check refuses a request whose prompt is estimated at prompt tokens. A
+// ledger that cannot be read lets the call through.
+func (b Budget) check(ctx context.Context, prompt int64) error {
+	if b.PerCall > 0 && prompt > b.PerCall {
+		return &BudgetError{Limit: BudgetPerCall, Budget: b.PerCall, Requested: prompt}
+	}
+	if b.Daily <= 0 || b.Ledger == nil {
+		return nil
+	}
+	used, err := b.Ledger.DailyTokens(ctx, b.Key, b.day())
+	if err != nil {
+		slog.WarnContext(ctx, "token ledger unavailable", "err", err)
+		return nil
+	}
+	if used+prompt > b.Daily {
+		return &BudgetError{Limit: BudgetDaily, Budget: b.Daily, Used: used, Requested: prompt}
+	}
+	return nil
+}
+
+// charge adds a request's tokens to the day's count.
+func (b Budget) charge(ctx context.Context, tokens int64) {
+	if b.Daily <= 0 || b.Ledger == nil || tokens <= 0 {
+		return
+	}
+	if err := b.Ledger.AddDailyTokens(ctx, b.Key, b.day(), tokens); err != nil {
+		slog.WarnContext(ctx, "token ledger unavailable", "err", err)
+	}
+}
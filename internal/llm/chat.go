@@ -0,0 +1,167 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// System prompts of the chat-completion providers, after configs/prompts/v1.
+// An org's prompt template replaces them through WithPrompt.
+const (
+	triagePrompt = "You are a support triage agent. Output JSON with keys: intent, urgency, sentiment, confidence.\n" +
+		"Use urgency in {low, medium, high}.\nUse sentiment in {negative, neutral, positive}.\nUse confidence in [0, 1]."
+	extractPrompt = "You extract structured data. Output JSON with keys: data, an object that matches the provided schema, " +
+		"and confidence in [0, 1]. If unsure, leave fields empty."
+	draftPrompt = "You draft a support reply following the given policy. Be concise and professional. " +
+		"Follow each sentence that states a fact with the sources it rests on, as [msg:<id>] for a source message " +
+		"or [kb:<id>] for a knowledge base chunk, and state nothing the sources do not support. " +
+		"Output JSON with keys: text, citations (IDs of the source messages the reply relies on), " +
+		"risk_flags and needs_approval."
+	translatePrompt = "You translate email text. Output JSON with keys: text, the translation, " +
+		"and source_language, the BCP 47 tag of the original language."
+)
+
+// completeFunc sends one system and user prompt to a chat model and returns
+// its reply.
+type completeFunc func(ctx context.Context, system, user string) (string, error)
+
+// chatTasks implements the Provider tasks on top of a chat model by
+// prompting it for JSON.
+type chatTasks struct {
+	complete completeFunc
+}
+
+func (c chatTasks) Classify(ctx context.Context, text string, taxonomy map[string]any) (Classification, error) {
+	user := "Email:\n" + text
+	if len(taxonomy) > 0 {
+		raw, _ := json.Marshal(taxonomy)
+		user = "Taxonomy:\n" + string(raw) + "\n\n" + user
+	}
+	var out struct {
+		Intent     string  `json:"intent"`
+		Urgency    string  `json:"urgency"`
+		Sentiment  string  `json:"sentiment"`
+		Confidence float64 `json:"confidence"`
+	}
+	if err := c.completeJSON(ctx, systemPrompt(ctx, TaskClassify, triagePrompt), user, &out); err != nil {
+		return Classification{}, err
+	}
+	return Classification{Intent: out.Intent, Urgency: out.Urgency, Sentiment: out.Sentiment, Confidence: out.Confidence}, nil
+}
+
+func (c chatTasks) Extract(ctx context.Context, text string, schema map[string]any, examples []map[string]any) (Extraction, error) {
+	rawSchema, _ := json.Marshal(schema)
+	user := "Schema:\n" + string(rawSchema) + "\n\n"
+	if len(examples) > 0 {
+		rawExamples, _ := json.Marshal(examples)
+		user += "Examples:\n" + string(rawExamples) + "\n\n"
+	}
+	user += "Email:\n" + text
+	var out struct {
+		Data       map[string]any `json:"data"`
+		Confidence float64        `json:"confidence"`
+	}
+	if err := c.completeJSON(ctx, systemPrompt(ctx, TaskExtract, extractPrompt), user, &out); err != nil {
+		return Extraction{}, err
+	}
+	if out.Data == nil {
+		out.Data = map[string]any{}
+	}
+	var missing []string
+	for _, field := range requiredFields(schema) {
+		if v, ok := out.Data[field]; !ok || v == nil || v == "" {
+			missing = append(missing, field)
+		}
+	}
+	return Extraction{Data: out.Data, Confidence: out.Confidence, MissingFields: missing}, nil
+}
+
+func (c chatTasks) Draft(ctx context.Context, contextText string, policy map[string]any, goal string) (Draft, error) {
+	rawPolicy, _ := json.Marshal(policy)
+	user := "Policy:\n" + string(rawPolicy) + "\n\nGoal:\n" + goal + "\n\nThread:\n" + contextText
+	var out struct {
+		Text          string   `json:"text"`
+		Citations     []string `json:"citations"`
+		RiskFlags     []string `json:"risk_flags"`
+		NeedsApproval *bool    `json:"needs_approval"`
+	}
+	if err := c.completeJSON(ctx, systemPrompt(ctx, TaskDraft, draftPrompt), user, &out); err != nil {
+		return Draft{}, err
+	}
+	// Without an answer either way, a person looks at the draft.
+	needsApproval := out.NeedsApproval == nil || *out.NeedsApproval
+	return Draft{Text: out.Text, Citations: out.Citations, RiskFlags: out.RiskFlags, NeedsApproval: needsApproval}, nil
+}
+
+func (c chatTasks) Translate(ctx context.Context, text string, targetLanguage string) (Translation, error) {
+	user := "Target language: " + targetLanguage + "\n\nText:\n" + text
+	var out struct {
+		Text           string `json:"text"`
+		SourceLanguage string `json:"source_language"`
+	}
+	if err := c.completeJSON(ctx, systemPrompt(ctx, TaskTranslate, translatePrompt), user, &out); err != nil {
+		return Translation{}, err
+	}
+	return Translation{Text: out.Text, SourceLanguage: out.SourceLanguage, TargetLanguage: targetLanguage}, nil
+}
+
+// completeJSON prompts the model and decodes the JSON object in its reply,
+// tolerating a Markdown code fence around it.
+func (c chatTasks) completeJSON(ctx context.Context, system, user string, out any) error {
+	reply, err := c.complete(ctx, system, user)
+	if err != nil {
+		return err
+	}
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return fmt.Errorf("model reply is not JSON: %q", truncate(reply, 120))
+	}
+	if err := json.Unmarshal([]byte(reply[start:end+1]), out); err != nil {
+		return fmt.Errorf("model reply is not JSON: %w", err)
+	}
+	return nil
+}
+
+// readSSE calls fn with the event name and data of each server-sent event
+// in r until r ends or fn returns errStopSSE.
+func readSSE(r io.Reader, fn func(event, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if err := fn(event, strings.Join(data, "\n")); err != nil {
+					if errors.Is(err, errStopSSE) {
+						return nil
+					}
+					return err
+				}
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		if err := fn(event, strings.Join(data, "\n")); err != nil && !errors.Is(err, errStopSSE) {
+			return err
+		}
+	}
+	return nil
+}
+
+var errStopSSE = errors.New("end of stream")
@@ -18,6 +18,19 @@ type Extraction struct {
 	ValidationErrors []string
 }
 
+// Keys of the policy hints passed to Provider.Draft. With citations
+// required, Citations must name messages from source_message_ids;
+// citation_feedback explains what a previous attempt got wrong.
+// source_chunk_ids lists the knowledge base chunks given with the thread.
+// Draft text cites the sources of each sentence inline, as [msg:<id>] or
+// [kb:<id>] after it.
+const (
+	PolicyRequireCitations = "require_citations"
+	PolicySourceMessageIDs = "source_message_ids"
+	PolicySourceChunkIDs   = "source_chunk_ids"
+	PolicyCitationFeedback = "citation_feedback"
+)
+
 type Draft struct {
 	Text          string
 	Citations     []string
@@ -25,10 +38,29 @@ type Draft struct {
 	NeedsApproval bool
 }
 
+type Translation struct {
+	Text           string
+	SourceLanguage string
+	TargetLanguage string
+}
+
 type Provider interface {
 	Classify(ctx context.Context, text string, taxonomy map[string]any) (Classification, error)
 	Extract(ctx context.Context, text string, schema map[string]any, examples []map[string]any) (Extraction, error)
 	Draft(ctx context.Context, contextText string, policy map[string]any, goal string) (Draft, error)
+	Translate(ctx context.Context, text string, targetLanguage string) (Translation, error)
 	Name() string
 	Model() string
 }
+
+// Scorer is implemented by providers that can grade how relevant each of
+// docs is to query, for search re-ranking. Scores are in [0, 1], one per doc.
+type Scorer interface {
+	Score(ctx context.Context, query string, docs []string) ([]float64, error)
+}
+
+// Summarizer is implemented by providers that can condense a message to
+// about maxTokens tokens, for packing long threads into a draft's context.
+type Summarizer interface {
+	Summarize(ctx context.Context, text string, maxTokens int) (string, error)
+}
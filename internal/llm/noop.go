@@ -56,22 +56,97 @@ func (n *Noop) Extract(_ context.Context, _ string, schema map[string]any, _ []m
 	}, nil
 }
 
-func (n *Noop) Draft(_ context.Context, contextText string, _ map[string]any, goal string) (Draft, error) {
+// Draft returns a canned reply. When the policy hints ask for citations it
+// cites the newest source message, the one being answered, after the
+// sentence acknowledging it.
+func (n *Noop) Draft(_ context.Context, contextText string, policy map[string]any, goal string) (Draft, error) {
+	var citations []string
+	if required, _ := policy[PolicyRequireCitations].(bool); required {
+		if sources, _ := policy[PolicySourceMessageIDs].([]string); len(sources) > 0 {
+			citations = sources[len(sources)-1:]
+		}
+	}
 	text := "Hello,\n\n"
 	if goal != "" {
 		text += goal + "\n\n"
 	}
-	text += "We received your message and will follow up shortly.\n\n"
-	text += "Context:\n" + truncate(contextText, 240)
+	text += "We received your message and will follow up shortly."
+	for _, id := range citations {
+		text += " [msg:" + id + "]"
+	}
+	text += "\n\nContext:\n" + truncate(contextText, 240)
 	text += "\n\nBest,\nNerve"
 	return Draft{
 		Text:          text,
-		Citations:     nil,
+		Citations:     citations,
 		RiskFlags:     nil,
 		NeedsApproval: true,
 	}, nil
 }
 
+// Translate has no model to call, so it returns the text unchanged and reports
+// the source language as undetermined.
+func (n *Noop) Translate(_ context.Context, text string, targetLanguage string) (Translation, error) {
+	return Translation{
+		Text:           text,
+		SourceLanguage: "und",
+		TargetLanguage: targetLanguage,
+	}, nil
+}
+
+// Score grades each doc by the share of query terms it contains, a lexical
+// stand-in for model scoring.
+func (n *Noop) Score(_ context.Context, query string, docs []string) ([]float64, error) {
+	terms := strings.Fields(strings.ToLower(query))
+	scores := make([]float64, len(docs))
+	if len(terms) == 0 {
+		return scores, nil
+	}
+	for i, doc := range docs {
+		lower := strings.ToLower(doc)
+		hits := 0
+		for _, term := range terms {
+			if strings.Contains(lower, term) {
+				hits++
+			}
+		}
+		scores[i] = float64(hits) / float64(len(terms))
+	}
+	return scores, nil
+}
+
+// Summarize keeps the leading sentences of text that fit maxTokens.
+func (n *Noop) Summarize(_ context.Context, text string, maxTokens int) (string, error) {
+	return ExtractiveSummary(text, maxTokens), nil
+}
+
+// ExtractiveSummary returns the leading sentences of text, whitespace
+// collapsed, that fit in maxTokens, cutting the first one short if it alone
+// is too long. Providers without a Summarizer are summarized this way.
+func ExtractiveSummary(text string, maxTokens int) string {
+	words := strings.Fields(text)
+	var out []string
+	tokens := 0
+	for _, word := range words {
+		cost := CountTokens(" " + word)
+		if tokens+cost > maxTokens {
+			break
+		}
+		out = append(out, word)
+		tokens += cost
+	}
+	if len(out) == len(words) {
+		return strings.Join(out, " ")
+	}
+	// Prefer ending on a sentence boundary once one is in reach.
+	for i := len(out) - 1; i >= len(out)/2 && i > 0; i-- {
+		if strings.HasSuffix(out[i], ".") || strings.HasSuffix(out[i], "?") || strings.HasSuffix(out[i], "!") {
+			return strings.Join(out[:i+1], " ")
+		}
+	}
+	return strings.Join(out, " ") + "..."
+}
+
 func requiredFields(schema map[string]any) []string {
 	requiredRaw, ok := schema["required"]
 	if !ok {
@@ -18,3 +18,66 @@ func TestNoopTriageUrgentNegative(t *testing.T) {
 		t.Fatalf("expected negative sentiment, got %s", res.Sentiment)
 	}
 }
+
+func TestNoopTranslateReturnsOriginalText(t *testing.T) {
+	provider := NewNoop()
+	res, err := provider.Translate(context.Background(), "Hola, necesito ayuda", "en")
+	if err != nil {
+		t.Fatalf("translate error: %v", err)
+	}
+	if res.Text != "Hola, necesito ayuda" {
+		t.Fatalf("expected untranslated text, got %q", res.Text)
+	}
+	if res.TargetLanguage != "en" || res.SourceLanguage != "und" {
+		t.Fatalf("unexpected languages: %+v", res)
+	}
+}
+
+func TestNoopDraftCitesWhenRequired(t *testing.T) {
+	provider := NewNoop()
+	res, err := provider.Draft(context.Background(), "Where is my order?", nil, "")
+	if err != nil {
+		t.Fatalf("draft error: %v", err)
+	}
+	if len(res.Citations) != 0 {
+		t.Fatalf("expected no citations without hints, got %v", res.Citations)
+	}
+
+	hints := map[string]any{
+		PolicyRequireCitations: true,
+		PolicySourceMessageIDs: []string{"m1", "m2"},
+	}
+	res, err = provider.Draft(context.Background(), "Where is my order?", hints, "")
+	if err != nil {
+		t.Fatalf("draft error: %v", err)
+	}
+	if len(res.Citations) != 1 || res.Citations[0] != "m2" {
+		t.Fatalf("expected newest source cited, got %v", res.Citations)
+	}
+}
+
+func TestNoopSummarizeThread(t *testing.T) {
+	text := "Thread: Refund for order 42\n" +
+		"[inbound m1 from ana@example.com at 2026-01-02 10:00] Hi. Can I get a refund for order 42? It arrived broken.\n" +
+		"[outbound m2 from support@acme.test at 2026-01-02 11:00] Sorry about that. We will refund it once the courier confirms.\n" +
+		"[inbound m3 from ana@example.com at 2026-01-03 09:00] Thanks. How long does the courier take?\n"
+	res, err := NewNoop().SummarizeThread(context.Background(), text)
+	if err != nil {
+		t.Fatalf("summarize error: %v", err)
+	}
+	if len(res.Participants) != 2 || res.Participants[0] != "ana@example.com" || res.Participants[1] != "support@acme.test" {
+		t.Fatalf("unexpected participants: %v", res.Participants)
+	}
+	if res.Ask != "Can I get a refund for order 42?" {
+		t.Fatalf("unexpected ask: %q", res.Ask)
+	}
+	if len(res.Commitments) != 1 || res.Commitments[0] != "We will refund it once the courier confirms." {
+		t.Fatalf("unexpected commitments: %v", res.Commitments)
+	}
+	if len(res.OpenQuestions) != 1 || res.OpenQuestions[0] != "How long does the courier take?" {
+		t.Fatalf("unexpected open questions: %v", res.OpenQuestions)
+	}
+	if res.NextAction != "Reply to the customer" {
+		t.Fatalf("unexpected next action: %q", res.NextAction)
+	}
+}
@@ -31,3 +31,11 @@ func (o *Ollama) Extract(_ context.Context, _ string, _ map[string]any, _ []map[
 func (o *Ollama) Draft(_ context.Context, _ string, _ map[string]any, _ string) (Draft, error) {
 	return Draft{}, errors.New("ollama provider not implemented")
 }
+
+func (o *Ollama) Translate(_ context.Context, _ string, _ string) (Translation, error) {
+	return Translation{}, errors.New("ollama provider not implemented")
+}
+
+func (o *Ollama) Score(_ context.Context, _ string, _ []string) ([]float64, error) {
+	return nil, errors.New("ollama provider not implemented")
+}
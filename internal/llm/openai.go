@@ -31,3 +31,11 @@ func (o *OpenAI) Extract(_ context.Context, _ string, _ map[string]any, _ []map[
 func (o *OpenAI) Draft(_ context.Context, _ string, _ map[string]any, _ string) (Draft, error) {
 	return Draft{}, errors.New("openai provider not implemented")
 }
+
+func (o *OpenAI) Translate(_ context.Context, _ string, _ string) (Translation, error) {
+	return Translation{}, errors.New("openai provider not implemented")
+}
+
+func (o *OpenAI) Score(_ context.Context, _ string, _ []string) ([]float64, error) {
+	return nil, errors.New("openai provider not implemented")
+}
@@ -0,0 +1,29 @@
+package llm
+
+import "context"
+
+type promptsKey struct{}
+
+// WithPrompt returns a context whose chat-model calls for task use system as
+// their system prompt in place of the built-in one.
+func WithPrompt(ctx context.Context, task, system string) context.Context {
+	prompts := map[string]string{task: system}
+	if prev, ok := ctx.Value(promptsKey{}).(map[string]string); ok {
+		for t, p := range prev {
+			if t != task {
+				prompts[t] = p
+			}
+		}
+	}
+	return context.WithValue(ctx, promptsKey{}, prompts)
+}
+
+// systemPrompt returns the system prompt ctx sets for task, or def.
+func systemPrompt(ctx context.Context, task, def string) string {
+	if prompts, ok := ctx.Value(promptsKey{}).(map[string]string); ok {
+		if p := prompts[task]; p != "" {
+			return p
+		}
+	}
+	return def
+}
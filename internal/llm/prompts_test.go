@@ -0,0 +1,28 @@
+package llm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWithPromptReplacesTaskSystemPrompt(t *testing.T) {
+	var systems []string
+	tasks := chatTasks{complete: func(_ context.Context, system, _ string) (string, error) {
+		systems = append(systems, system)
+		return `{"text":"ok"}`, nil
+	}}
+
+	ctx := WithPrompt(context.Background(), TaskDraft, "Reply in the voice of Acme support.")
+	if _, err := tasks.Draft(ctx, "thread", nil, "answer"); err != nil {
+		t.Fatalf("draft: %v", err)
+	}
+	if _, err := tasks.Translate(ctx, "hola", "en"); err != nil {
+		t.Fatalf("translate: %v", err)
+	}
+	if systems[0] != "Reply in the voice of Acme support." {
+		t.Fatalf("expected the draft to use the template, got %q", systems[0])
+	}
+	if systems[1] != translatePrompt {
+		t.Fatalf("expected other tasks to keep the built-in prompt, got %q", systems[1])
+	}
+}
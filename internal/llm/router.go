@@ -0,0 +1,371 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"neuralmail/internal/pii"
+)
+
+// Tasks a Router routes separately, so cheap models can classify while
+// stronger ones draft.
+const (
+	TaskClassify  = "classify"
+	TaskExtract   = "extract"
+	TaskDraft     = "draft"
+	TaskTranslate = "translate"
+	TaskSummarize = "summarize"
+)
+
+// Tasks lists every routable task.
+var Tasks = []string{TaskClassify, TaskExtract, TaskDraft, TaskTranslate, TaskSummarize}
+
+// Ref names a model as "provider:model", e.g. "openai:gpt-4o-mini".
+type Ref struct {
+	Provider string
+	Model    string
+}
+
+func ParseRef(s string) (Ref, error) {
+	provider, model, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok || provider == "" || model == "" {
+		return Ref{}, fmt.Errorf("model %q must be written provider:model", s)
+	}
+	return Ref{Provider: provider, Model: model}, nil
+}
+
+func (r Ref) String() string {
+	return r.Provider + ":" + r.Model
+}
+
+// ValidateRoutes checks that routes name known tasks and well-formed refs.
+func ValidateRoutes(routes map[string][]string) error {
+	for task, refs := range routes {
+		if !slices.Contains(Tasks, task) {
+			return fmt.Errorf("unknown task %q", task)
+		}
+		for _, ref := range refs {
+			if _, err := ParseRef(ref); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Router is a Provider that sends each task down its own chain of models,
+// falling back to the next when one errors. A task's chain is the routes
+// set on the context with WithRoutes (an org's or plan's), then Routes, then
+// Default, which also answers Name and Model, then Fallbacks. Every request
+// it makes is noted in the context's CallLog, if there is one.
+//
+// Each model has a circuit breaker: after BreakerFailures outages in a row
+// (see IsOutage) it is skipped for BreakerCooldown, then probed with one
+// call. When every model of a chain is open, the last is tried anyway.
+type Router struct {
+	Default Provider
+	Routes  map[string][]string
+	// Fallbacks are "provider:model" refs tried after Default for every
+	// task, e.g. a local model for when the hosted one is down.
+	Fallbacks       []string
+	BreakerFailures int
+	BreakerCooldown time.Duration
+	Now             func() time.Time
+	// Prices is the estimated USD per million tokens by model ref.
+	Prices map[string]float64
+	// Build makes the provider for a ref, or reports false if the ref's
+	// provider is not configured here; such refs are skipped.
+	Build func(Ref) (Provider, bool)
+	// RedactPII lists the pii classes masked in text sent to hosted
+	// models; see redact.
+	RedactPII []string
+
+	mu       sync.Mutex
+	built    map[Ref]Provider
+	breakers map[string]*breaker
+}
+
+func NewRouter(def Provider, routes map[string][]string, prices map[string]float64, build func(Ref) (Provider, bool)) *Router {
+	return &Router{Default: def, Routes: routes, Prices: prices, Build: build}
+}
+
+func (r *Router) Name() string  { return r.Default.Name() }
+func (r *Router) Model() string { return r.Default.Model() }
+
+// Primary returns the first model task is routed to.
+func (r *Router) Primary(ctx context.Context, task string) Provider {
+	return r.chain(ctx, task)[0]
+}
+
+func (r *Router) chain(ctx context.Context, task string) []Provider {
+	var refs []string
+	if lookup, ok := ctx.Value(routesKey{}).(func() map[string][]string); ok {
+		refs = append(refs, lookup()[task]...)
+	}
+	refs = append(refs, r.Routes[task]...)
+
+	var chain []Provider
+	seen := map[Ref]bool{}
+	add := func(refs []string) {
+		for _, raw := range refs {
+			ref, err := ParseRef(raw)
+			if err != nil || seen[ref] {
+				continue
+			}
+			seen[ref] = true
+			if p, ok := r.provider(ref); ok {
+				chain = append(chain, p)
+			}
+		}
+	}
+	add(refs)
+	def := Ref{Provider: r.Default.Name(), Model: r.Default.Model()}
+	if len(chain) == 0 || !seen[def] {
+		seen[def] = true
+		chain = append(chain, r.Default)
+	}
+	add(r.Fallbacks)
+	return chain
+}
+
+func (r *Router) provider(ref Ref) (Provider, bool) {
+	if r.Build == nil {
+		return nil, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p, ok := r.built[ref]; ok {
+		return p, true
+	}
+	p, ok := r.Build(ref)
+	if !ok {
+		return nil, false
+	}
+	if r.built == nil {
+		r.built = map[Ref]Provider{}
+	}
+	r.built[ref] = p
+	return p, true
+}
+
+// run calls each model in task's chain until one succeeds, returning the
+// last error if none does. call returns the output text, for token counts
+// where the provider does not report its own. A call the context's Budget
+// refuses is not made, nor passed on to a fallback.
+func (r *Router) run(ctx context.Context, task string, input string, call func(context.Context, Provider) (string, error)) error {
+	log, _ := ctx.Value(callLogKey{}).(*CallLog)
+	budget, _ := ctx.Value(budgetKey{}).(Budget)
+	var err error
+	chain := r.chain(ctx, task)
+	tried := 0
+	for i, p := range chain {
+		ref := Ref{Provider: p.Name(), Model: p.Model()}.String()
+		if !r.allow(ref) && (tried > 0 || i < len(chain)-1) {
+			continue
+		}
+		if err := budget.check(ctx, int64(CountTokens(input))); err != nil {
+			return err
+		}
+		tried++
+		start := time.Now()
+		callCtx, billed := withUsage(ctx)
+		var output string
+		output, err = call(callCtx, p)
+		r.record(ref, err, ctx.Err() != nil)
+		prompt, completion := billed.counts()
+		if prompt+completion == 0 {
+			prompt, completion = CountTokens(input), CountTokens(output)
+		}
+		budget.charge(ctx, int64(prompt+completion))
+		if log != nil {
+			tokens := prompt + completion
+			log.add(Call{
+				Task:             task,
+				Model:            ref,
+				Fallback:         i > 0,
+				Err:              err,
+				Latency:          time.Since(start),
+				Tokens:           tokens,
+				PromptTokens:     prompt,
+				CompletionTokens: completion,
+				CostUSD:          float64(tokens) * r.Prices[ref] / 1e6,
+			})
+		}
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+func (r *Router) Classify(ctx context.Context, text string, taxonomy map[string]any) (Classification, error) {
+	var out Classification
+	err := r.run(ctx, TaskClassify, text, func(ctx context.Context, p Provider) (string, error) {
+		res, err := p.Classify(ctx, r.redact(p, text), taxonomy)
+		out = res
+		return res.Intent + " " + res.Urgency + " " + res.Sentiment, err
+	})
+	return out, err
+}
+
+func (r *Router) Extract(ctx context.Context, text string, schema map[string]any, examples []map[string]any) (Extraction, error) {
+	var out Extraction
+	err := r.run(ctx, TaskExtract, text, func(ctx context.Context, p Provider) (string, error) {
+		res, err := p.Extract(ctx, r.redact(p, text), schema, examples)
+		out = res
+		data, _ := json.Marshal(res.Data)
+		return string(data), err
+	})
+	return out, err
+}
+
+func (r *Router) Draft(ctx context.Context, contextText string, policy map[string]any, goal string) (Draft, error) {
+	var out Draft
+	err := r.run(ctx, TaskDraft, contextText+"\n"+goal, func(ctx context.Context, p Provider) (string, error) {
+		res, err := p.Draft(ctx, r.redact(p, contextText), policy, r.redact(p, goal))
+		out = res
+		return res.Text, err
+	})
+	return out, err
+}
+
+func (r *Router) Translate(ctx context.Context, text string, targetLanguage string) (Translation, error) {
+	var out Translation
+	err := r.run(ctx, TaskTranslate, text, func(ctx context.Context, p Provider) (string, error) {
+		res, err := p.Translate(ctx, r.redact(p, text), targetLanguage)
+		out = res
+		return res.Text, err
+	})
+	return out, err
+}
+
+// Summarize uses a model's Summarizer where it has one and an extractive
+// summary where it does not, so it only fails if every Summarizer does.
+func (r *Router) Summarize(ctx context.Context, text string, maxTokens int) (string, error) {
+	var out string
+	err := r.run(ctx, TaskSummarize, text, func(ctx context.Context, p Provider) (string, error) {
+		summarizer, ok := p.(Summarizer)
+		if !ok {
+			out = ExtractiveSummary(text, maxTokens)
+			return out, nil
+		}
+		var err error
+		out, err = summarizer.Summarize(ctx, r.redact(p, text), maxTokens)
+		return out, err
+	})
+	return out, err
+}
+
+// redact masks the RedactPII classes in text bound for p, unless p runs
+// locally.
+func (r *Router) redact(p Provider, text string) string {
+	if len(r.RedactPII) == 0 {
+		return text
+	}
+	switch p.Name() {
+	case "ollama", "noop":
+		return text
+	}
+	return pii.Redact(text, r.RedactPII)
+}
+
+// TaskModel names the model task goes to first with p: its route's primary
+// if p is a Router, p itself otherwise.
+func TaskModel(ctx context.Context, p Provider, task string) (string, string) {
+	if r, ok := p.(*Router); ok {
+		p = r.Primary(ctx, task)
+	}
+	return p.Name(), p.Model()
+}
+
+type routesKey struct{}
+
+// WithRoutes returns a context whose Router calls prefer the task routes
+// lookup returns, such as an org's. lookup runs at most once, on the first
+// call that needs it.
+func WithRoutes(ctx context.Context, lookup func() map[string][]string) context.Context {
+	return context.WithValue(ctx, routesKey{}, sync.OnceValue(lookup))
+}
+
+// Call is one model request made by a Router. Tokens is the sum of its
+// prompt and completion tokens.
+type Call struct {
+	Task     string
+	Model    string
+	Fallback bool
+	Err      error
+	Latency  time.Duration
+	Tokens   int
+	CostUSD  float64
+
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// usage is the token count a provider reports for one request.
+type usage struct {
+	mu     sync.Mutex
+	input  int
+	output int
+}
+
+func (u *usage) counts() (int, int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.input, u.output
+}
+
+type usageKey struct{}
+
+func withUsage(ctx context.Context) (context.Context, *usage) {
+	u := &usage{}
+	return context.WithValue(ctx, usageKey{}, u), u
+}
+
+// reportUsage adds the tokens a provider's API billed for a request to the
+// Router call it serves, which then counts them instead of its estimate.
+func reportUsage(ctx context.Context, input, output int) {
+	u, ok := ctx.Value(usageKey{}).(*usage)
+	if !ok {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.input += input
+	u.output += output
+}
+
+// CallLog collects the model requests made under a context.
+type CallLog struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+type callLogKey struct{}
+
+// WithCallLog returns a context whose Router calls are noted in the log.
+func WithCallLog(ctx context.Context) (context.Context, *CallLog) {
+	log := &CallLog{}
+	return context.WithValue(ctx, callLogKey{}, log), log
+}
+
+func (l *CallLog) add(c Call) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls = append(l.calls, c)
+}
+
+// Calls returns the requests noted so far, in order.
+func (l *CallLog) Calls() []Call {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Call(nil), l.calls...)
+}
@@ -0,0 +1,264 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubModel answers like Noop under its own name, or fails when down.
+type stubModel struct {
+	Noop
+	provider, model string
+	down            bool
+	drafts          int
+	lastContext     string
+}
+
+func (s *stubModel) Name() string  { return s.provider }
+func (s *stubModel) Model() string { return s.model }
+
+func (s *stubModel) Draft(ctx context.Context, contextText string, policy map[string]any, goal string) (Draft, error) {
+	s.drafts++
+	s.lastContext = contextText
+	if s.down {
+		return Draft{}, errors.New(s.model + " unavailable")
+	}
+	return Draft{Text: "drafted by " + s.model}, nil
+}
+
+func stubRouter(def *stubModel, routes map[string][]string, models ...*stubModel) *Router {
+	byRef := map[Ref]Provider{}
+	for _, m := range models {
+		byRef[Ref{Provider: m.provider, Model: m.model}] = m
+	}
+	build := func(ref Ref) (Provider, bool) {
+		p, ok := byRef[ref]
+		return p, ok
+	}
+	return NewRouter(def, routes, map[string]float64{"openai:gpt-4o": 5}, build)
+}
+
+func TestRouterRoutesTasksAndFallsBack(t *testing.T) {
+	def := &stubModel{provider: "openai", model: "gpt-4o-mini"}
+	strong := &stubModel{provider: "openai", model: "gpt-4o"}
+	router := stubRouter(def, map[string][]string{
+		TaskDraft:    {"openai:gpt-4o", "ollama:not-configured"},
+		TaskClassify: {"openai:gpt-4o-mini"},
+	}, strong)
+
+	if name, model := TaskModel(context.Background(), router, TaskDraft); name != "openai" || model != "gpt-4o" {
+		t.Fatalf("draft routed to %s:%s", name, model)
+	}
+	if _, model := TaskModel(context.Background(), router, TaskTranslate); model != "gpt-4o-mini" {
+		t.Fatalf("unrouted task went to %s, want the default", model)
+	}
+
+	ctx, log := WithCallLog(context.Background())
+	draft, err := router.Draft(ctx, "thread", nil, "reply")
+	if err != nil || draft.Text != "drafted by gpt-4o" {
+		t.Fatalf("draft = %+v, %v", draft, err)
+	}
+
+	strong.down = true
+	draft, err = router.Draft(ctx, "thread", nil, "reply")
+	if err != nil || draft.Text != "drafted by gpt-4o-mini" {
+		t.Fatalf("fallback draft = %+v, %v", draft, err)
+	}
+
+	calls := log.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("calls = %+v", calls)
+	}
+	if calls[0].Model != "openai:gpt-4o" || calls[0].Fallback || calls[0].CostUSD <= 0 {
+		t.Fatalf("first call = %+v", calls[0])
+	}
+	if calls[1].Err == nil || calls[2].Model != "openai:gpt-4o-mini" || !calls[2].Fallback || calls[2].CostUSD != 0 {
+		t.Fatalf("fallback calls = %+v", calls[1:])
+	}
+	for _, c := range calls {
+		if c.Task != TaskDraft || c.Tokens == 0 {
+			t.Fatalf("call = %+v", c)
+		}
+	}
+
+	def.down = true
+	if _, err := router.Draft(ctx, "thread", nil, "reply"); err == nil {
+		t.Fatal("expected an error with every model down")
+	}
+}
+
+func TestRouterPrefersContextRoutes(t *testing.T) {
+	def := &stubModel{provider: "openai", model: "gpt-4o-mini"}
+	strong := &stubModel{provider: "openai", model: "gpt-4o"}
+	router := stubRouter(def, nil, strong)
+
+	lookups := 0
+	ctx := WithRoutes(context.Background(), func() map[string][]string {
+		lookups++
+		return map[string][]string{TaskDraft: {"openai:gpt-4o"}}
+	})
+	for range 2 {
+		if _, err := router.Draft(ctx, "thread", nil, "reply"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if strong.drafts != 2 || def.drafts != 0 {
+		t.Fatalf("drafts: routed=%d default=%d", strong.drafts, def.drafts)
+	}
+	if lookups != 1 {
+		t.Fatalf("routes looked up %d times", lookups)
+	}
+	if _, err := router.Classify(ctx, "where is my invoice", nil); err != nil {
+		t.Fatal(err)
+	}
+	if lookups != 1 {
+		t.Fatalf("routes looked up %d times", lookups)
+	}
+}
+
+func TestValidateRoutes(t *testing.T) {
+	if err := ValidateRoutes(map[string][]string{TaskDraft: {"openai:gpt-4o"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateRoutes(map[string][]string{"poetry": {"openai:gpt-4o"}}); err == nil {
+		t.Fatal("expected unknown task to fail")
+	}
+	if err := ValidateRoutes(map[string][]string{TaskDraft: {"gpt-4o"}}); err == nil {
+		t.Fatal("expected a ref without a provider to fail")
+	}
+}
+
+// rateLimited fails every call with a 429 while down.
+type rateLimited struct {
+	stubModel
+}
+
+func (s *rateLimited) Draft(ctx context.Context, contextText string, policy map[string]any, goal string) (Draft, error) {
+	s.drafts++
+	if s.down {
+		return Draft{}, &StatusError{Provider: s.provider, StatusCode: 429, Body: "slow down"}
+	}
+	return Draft{Text: "drafted by " + s.model}, nil
+}
+
+func TestRouterBreakerSkipsFailingModelUntilCooldown(t *testing.T) {
+	primary := &rateLimited{stubModel{provider: "openai", model: "gpt-4o-mini", down: true}}
+	local := &stubModel{provider: "ollama", model: "llama3.1"}
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	router := NewRouter(primary, nil, nil, func(ref Ref) (Provider, bool) {
+		return local, ref == Ref{Provider: "ollama", Model: "llama3.1"}
+	})
+	router.Fallbacks = []string{"ollama:llama3.1"}
+	router.BreakerFailures = 2
+	router.BreakerCooldown = time.Minute
+	router.Now = func() time.Time { return now }
+
+	for range 4 {
+		draft, err := router.Draft(context.Background(), "thread", nil, "reply")
+		if err != nil || draft.Text != "drafted by llama3.1" {
+			t.Fatalf("expected the fallback to answer, got %+v, %v", draft, err)
+		}
+	}
+	if primary.drafts != 2 {
+		t.Fatalf("expected the open breaker to skip the primary after 2 failures, got %d calls", primary.drafts)
+	}
+	health := router.Health()
+	if len(health) != 2 || health[1].Model != "openai:gpt-4o-mini" || health[1].State != BreakerOpen || health[1].RetryAt == nil {
+		t.Fatalf("unexpected health %+v", health)
+	}
+
+	now = now.Add(time.Minute)
+	primary.down = false
+	draft, err := router.Draft(context.Background(), "thread", nil, "reply")
+	if err != nil || draft.Text != "drafted by gpt-4o-mini" {
+		t.Fatalf("expected the probe to reach the primary, got %+v, %v", draft, err)
+	}
+	if health := router.Health(); health[1].State != BreakerClosed {
+		t.Fatalf("expected the breaker to close after a good probe, got %+v", health[1])
+	}
+}
+
+func TestIsOutage(t *testing.T) {
+	if !IsOutage(&StatusError{StatusCode: 429}) || !IsOutage(&StatusError{StatusCode: 503}) || !IsOutage(context.DeadlineExceeded) {
+		t.Fatal("expected rate limits, server errors and timeouts to be outages")
+	}
+	if IsOutage(&StatusError{StatusCode: 400}) || IsOutage(errors.New("model reply is not JSON")) {
+		t.Fatal("expected bad requests and bad replies not to be outages")
+	}
+}
+
+type memLedger map[string]int64
+
+func (l memLedger) DailyTokens(_ context.Context, key string, day time.Time) (int64, error) {
+	return l[key+day.Format("2006-01-02")], nil
+}
+
+func (l memLedger) AddDailyTokens(_ context.Context, key string, day time.Time, tokens int64) error {
+	l[key+day.Format("2006-01-02")] += tokens
+	return nil
+}
+
+func TestRouterEnforcesTokenBudgets(t *testing.T) {
+	def := &stubModel{provider: "openai", model: "gpt-4o-mini"}
+	router := stubRouter(def, nil)
+	ledger := memLedger{}
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	budget := Budget{PerCall: 50, Daily: 40, Key: "org-1", Ledger: ledger, Now: func() time.Time { return now }}
+
+	ctx, log := WithCallLog(WithBudget(context.Background(), budget))
+	if _, err := router.Draft(ctx, "short thread", nil, "reply"); err != nil {
+		t.Fatalf("draft within budget: %v", err)
+	}
+	calls := log.Calls()
+	if len(calls) != 1 || calls[0].PromptTokens == 0 || calls[0].CompletionTokens == 0 {
+		t.Fatalf("expected prompt and completion tokens counted, got %+v", calls)
+	}
+	if spent := ledger["org-12026-03-02"]; spent != int64(calls[0].Tokens) {
+		t.Fatalf("expected the call's %d tokens charged to the day, got %d", calls[0].Tokens, spent)
+	}
+
+	long := strings.Repeat("refund ", 60)
+	_, err := router.Draft(ctx, long, nil, "reply")
+	var budgetErr *BudgetError
+	if !errors.As(err, &budgetErr) || budgetErr.Limit != BudgetPerCall || !errors.Is(err, ErrTokenBudgetExceeded) {
+		t.Fatalf("expected the per-call budget to refuse a long prompt, got %v", err)
+	}
+
+	ledger["org-12026-03-02"] = 39
+	if _, err := router.Draft(ctx, "short thread", nil, "reply"); !errors.As(err, &budgetErr) || budgetErr.Limit != BudgetDaily || budgetErr.Used != 39 {
+		t.Fatalf("expected the daily budget to refuse, got %v", err)
+	}
+	if def.drafts != 1 {
+		t.Fatalf("expected refused calls not to reach the model, got %d drafts", def.drafts)
+	}
+
+	now = now.Add(24 * time.Hour)
+	if _, err := router.Draft(ctx, "short thread", nil, "reply"); err != nil {
+		t.Fatalf("expected a new day's budget, got %v", err)
+	}
+}
+
+func TestRouterRedactsPIIForHostedModels(t *testing.T) {
+	hosted := &stubModel{provider: "openai", model: "gpt-4o-mini"}
+	local := &stubModel{provider: "ollama", model: "llama3"}
+	router := stubRouter(hosted, nil, local)
+	router.RedactPII = []string{"email"}
+
+	if _, err := router.Draft(context.Background(), "From ana@example.com: where is my order?", nil, "reply"); err != nil {
+		t.Fatal(err)
+	}
+	if hosted.lastContext != "From [EMAIL]: where is my order?" {
+		t.Fatalf("expected the address masked for a hosted model, got %q", hosted.lastContext)
+	}
+
+	router.Routes = map[string][]string{TaskDraft: {"ollama:llama3"}}
+	if _, err := router.Draft(context.Background(), "From ana@example.com", nil, "reply"); err != nil {
+		t.Fatal(err)
+	}
+	if local.lastContext != "From ana@example.com" {
+		t.Fatalf("expected a local model to get the text as is, got %q", local.lastContext)
+	}
+}
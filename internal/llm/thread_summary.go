@@ -0,0 +1,115 @@
+package llm
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// ThreadSummary is a structured digest of a conversation: who is in it,
+// what they want, what was promised, what is unanswered and what to do
+// next.
+type ThreadSummary struct {
+	Participants  []string `json:"participants"`
+	Ask           string   `json:"ask"`
+	Commitments   []string `json:"commitments"`
+	OpenQuestions []string `json:"open_questions"`
+	NextAction    string   `json:"next_action"`
+}
+
+// ThreadSummarizer is implemented by providers that can digest a thread,
+// given as packed context, into a ThreadSummary.
+type ThreadSummarizer interface {
+	SummarizeThread(ctx context.Context, contextText string) (ThreadSummary, error)
+}
+
+const threadSummaryPrompt = "You summarize a support email thread. Output JSON with keys: participants " +
+	"(email addresses, with a role if clear), ask (what the customer wants, one sentence), commitments " +
+	"(promises either side made), open_questions (questions not yet answered) and next_action " +
+	"(the one thing the support team should do next)."
+
+func (c chatTasks) SummarizeThread(ctx context.Context, contextText string) (ThreadSummary, error) {
+	var out ThreadSummary
+	if err := c.completeJSON(ctx, systemPrompt(ctx, TaskSummarize, threadSummaryPrompt), "Thread:\n"+contextText, &out); err != nil {
+		return ThreadSummary{}, err
+	}
+	return out, nil
+}
+
+// SummarizeThread digests the thread with a model's ThreadSummarizer, or
+// with HeuristicThreadSummary where the model has none.
+func (r *Router) SummarizeThread(ctx context.Context, contextText string) (ThreadSummary, error) {
+	var out ThreadSummary
+	err := r.run(ctx, TaskSummarize, contextText, func(ctx context.Context, p Provider) (string, error) {
+		summarizer, ok := p.(ThreadSummarizer)
+		if !ok {
+			out = HeuristicThreadSummary(contextText)
+			return "", nil
+		}
+		var err error
+		out, err = summarizer.SummarizeThread(ctx, r.redact(p, contextText))
+		return out.Ask + " " + out.NextAction, err
+	})
+	return out, err
+}
+
+// SummarizeThread digests the thread without a model.
+func (n *Noop) SummarizeThread(_ context.Context, contextText string) (ThreadSummary, error) {
+	return HeuristicThreadSummary(contextText), nil
+}
+
+// messageLabelRE matches the label threadctx puts before each message:
+// "[inbound <id> from <address> at <time>]".
+var messageLabelRE = regexp.MustCompile(`(?m)^\[(inbound|outbound) \S+(?: from (\S+))?[^\]]*\] ?(.*)$`)
+
+var sentenceRE = regexp.MustCompile(`[^.!?\n]+[.!?]?`)
+
+// HeuristicThreadSummary digests packed thread context by rule: senders
+// become participants, the first customer question (or sentence) the ask,
+// our sentences that say we will do something the commitments, and the
+// questions in the customer's last message the open ones.
+func HeuristicThreadSummary(contextText string) ThreadSummary {
+	var out ThreadSummary
+	seen := map[string]bool{}
+	lastDirection := ""
+	var lastInbound string
+	for _, m := range messageLabelRE.FindAllStringSubmatch(contextText, -1) {
+		direction, from, text := m[1], m[2], m[3]
+		if from != "" && !seen[from] {
+			seen[from] = true
+			out.Participants = append(out.Participants, from)
+		}
+		lastDirection = direction
+		for _, sentence := range sentenceRE.FindAllString(text, -1) {
+			sentence = strings.TrimSpace(sentence)
+			if sentence == "" {
+				continue
+			}
+			lower := strings.ToLower(sentence)
+			switch {
+			case direction == "inbound" && out.Ask == "" && strings.HasSuffix(sentence, "?"):
+				out.Ask = sentence
+			case direction == "outbound" && (strings.Contains(lower, "we will ") || strings.Contains(lower, "i will ") ||
+				strings.Contains(lower, "we'll ") || strings.Contains(lower, "i'll ")):
+				out.Commitments = append(out.Commitments, sentence)
+			}
+		}
+		if direction == "inbound" {
+			lastInbound = text
+		}
+	}
+	if out.Ask == "" && lastInbound != "" {
+		out.Ask = strings.TrimSpace(sentenceRE.FindString(lastInbound))
+	}
+	if lastDirection == "inbound" {
+		for _, sentence := range sentenceRE.FindAllString(lastInbound, -1) {
+			if sentence = strings.TrimSpace(sentence); strings.HasSuffix(sentence, "?") {
+				out.OpenQuestions = append(out.OpenQuestions, sentence)
+			}
+		}
+		out.NextAction = "Reply to the customer"
+	} else if lastDirection == "outbound" {
+		out.NextAction = "Wait for the customer to reply"
+	}
+	return out
+}
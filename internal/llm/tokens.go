@@ -0,0 +1,97 @@
+package llm
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// pieceRE splits text the way BPE tokenizers pre-tokenize it before merging:
+// English contractions, runs of letters with their leading space, numbers in
+// groups of up to three digits, punctuation runs and whitespace.
+var pieceRE = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)| ?\p{L}+| ?\p{N}{1,3}| ?[^\s\p{L}\p{N}]+|\s+`)
+
+// CountTokens estimates how many tokens text takes in a BPE vocabulary such
+// as the GPT and Llama ones. Common English words are one token and longer
+// ones about four characters each; scripts without spaces, like Chinese and
+// Japanese, cost about a token per character. Where it is off it errs high,
+// so a budget filled by it fits.
+func CountTokens(text string) int {
+	n := 0
+	for _, piece := range pieceRE.FindAllString(text, -1) {
+		word := strings.TrimPrefix(piece, " ")
+		first, _ := utf8.DecodeRuneInString(word)
+		switch {
+		case word == "" || unicode.IsSpace(first):
+			n++
+		case unicode.IsLetter(first):
+			n += letterTokens(word)
+		case unicode.IsDigit(first):
+			n++
+		default:
+			n += (utf8.RuneCountInString(word) + 1) / 2
+		}
+	}
+	return n
+}
+
+func letterTokens(word string) int {
+	runes := utf8.RuneCountInString(word)
+	if len(word) == runes {
+		if runes <= 6 {
+			return 1
+		}
+		return (runes + 3) / 4
+	}
+	wide := 0
+	for _, r := range word {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul, unicode.Thai) {
+			wide++
+		}
+	}
+	return wide + (runes-wide+1)/2
+}
+
+// DefaultContextWindow is assumed for models not in contextWindows.
+const DefaultContextWindow = 8192
+
+// contextWindows holds the context length, in tokens, of models by name
+// prefix. The longest matching prefix wins.
+var contextWindows = map[string]int{
+	"gpt-4o":        128000,
+	"gpt-4-turbo":   128000,
+	"gpt-4.1":       1047576,
+	"gpt-4":         8192,
+	"gpt-3.5-turbo": 16385,
+	"o1":            200000,
+	"o3":            200000,
+	"claude-":       200000,
+	"llama3":        8192,
+	"llama3.1":      131072,
+	"llama3.2":      131072,
+	"llama3.3":      131072,
+	"mistral":       32768,
+	"mixtral":       32768,
+	"qwen2.5":       32768,
+	"gemma2":        8192,
+	"noop":          DefaultContextWindow,
+}
+
+// ContextWindow returns how many tokens model accepts, prompt and reply
+// together.
+func ContextWindow(model string) int {
+	model = strings.ToLower(model)
+	prefixes := make([]string, 0, len(contextWindows))
+	for prefix := range contextWindows {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(model, prefix) {
+			return contextWindows[prefix]
+		}
+	}
+	return DefaultContextWindow
+}
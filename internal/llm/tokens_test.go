@@ -0,0 +1,54 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCountTokensEstimates(t *testing.T) {
+	cases := []struct {
+		text     string
+		min, max int
+	}{
+		{"", 0, 0},
+		{"Hello, world!", 3, 5},
+		{"The quick brown fox jumps over the lazy dog.", 9, 12},
+		{"internationalization", 4, 6},
+		{"Order 1234567 shipped", 4, 6},
+		{"你好世界", 4, 4},
+	}
+	for _, tc := range cases {
+		if got := CountTokens(tc.text); got < tc.min || got > tc.max {
+			t.Errorf("CountTokens(%q) = %d, want %d..%d", tc.text, got, tc.min, tc.max)
+		}
+	}
+}
+
+func TestContextWindowMatchesLongestPrefix(t *testing.T) {
+	if got := ContextWindow("gpt-4o-mini"); got != 128000 {
+		t.Fatalf("gpt-4o-mini window = %d", got)
+	}
+	if got := ContextWindow("gpt-4-0613"); got != 8192 {
+		t.Fatalf("gpt-4 window = %d", got)
+	}
+	if got := ContextWindow("llama3.1:70b"); got != 131072 {
+		t.Fatalf("llama3.1 window = %d", got)
+	}
+	if got := ContextWindow("custom-model"); got != DefaultContextWindow {
+		t.Fatalf("unknown model window = %d", got)
+	}
+}
+
+func TestExtractiveSummaryFitsBudget(t *testing.T) {
+	text := strings.Repeat("The invoice was charged twice. ", 40)
+	summary := ExtractiveSummary(text, 30)
+	if n := CountTokens(summary); n > 30 {
+		t.Fatalf("summary has %d tokens: %q", n, summary)
+	}
+	if !strings.HasSuffix(summary, ".") {
+		t.Fatalf("expected summary to end on a sentence, got %q", summary)
+	}
+	if short := ExtractiveSummary("Thanks!", 30); short != "Thanks!" {
+		t.Fatalf("expected short text kept, got %q", short)
+	}
+}
@@ -0,0 +1,48 @@
+package mailparse
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+)
+
+// calendarMethod returns the iTIP method (RFC 5546) of the first
+// text/calendar part, upper-cased: from its Content-Type method parameter,
+// else from the METHOD property of the calendar itself. It is empty for
+// messages without a calendar and for calendars that are not iTIP messages.
+func calendarMethod(contentType string, encoding string, body io.Reader) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if params["boundary"] == "" {
+			return ""
+		}
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err != nil {
+				return ""
+			}
+			if method := calendarMethod(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part); method != "" {
+				return method
+			}
+		}
+	}
+	if mediaType != "text/calendar" {
+		return ""
+	}
+	if method := strings.TrimSpace(params["method"]); method != "" {
+		return strings.ToUpper(method)
+	}
+	scanner := bufio.NewScanner(decodeTransfer(encoding, body))
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(strings.ToUpper(strings.TrimSpace(scanner.Text())), "METHOD:"); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
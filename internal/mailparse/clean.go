@@ -0,0 +1,90 @@
+package mailparse
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"neuralmail/internal/jmap"
+)
+
+var (
+	// attributionRE matches the line mail clients put above a quoted reply,
+	// e.g. "On Tue, 3 Mar 2026 at 10:00, Ann <ann@example.com> wrote:".
+	attributionRE = regexp.MustCompile(`(?i)^(on\s.+\s)?wrote:$|^le\s.+\sa écrit\s?:$|^am\s.+\sschrieb\s.+:$`)
+	// forwardedRE matches separators above forwarded or Outlook-quoted mail.
+	forwardedRE = regexp.MustCompile(`(?i)^-{2,}\s*(original message|forwarded message)\s*-{2,}$|^_{20,}$`)
+	// mobileSignatureRE matches the one-line signatures mail apps append.
+	mobileSignatureRE = regexp.MustCompile(`(?i)^(sent from my \S+|sent from (outlook|mail) for \S+|get outlook for \S+)`)
+)
+
+// StripQuoted removes the quoted history and signature from a plain-text
+// reply, leaving what the sender wrote. If nothing would be left the text is
+// returned trimmed but otherwise untouched.
+func StripQuoted(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	out := make([]string, 0, len(lines))
+scan:
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case line == "-- " || trimmed == "--":
+			break scan
+		case forwardedRE.MatchString(trimmed), mobileSignatureRE.MatchString(trimmed):
+			break scan
+		case attributionRE.MatchString(trimmed):
+			break scan
+		case i+1 < len(lines) && strings.HasPrefix(trimmed, "On ") && attributionRE.MatchString(trimmed+" "+strings.TrimSpace(lines[i+1])):
+			// Attribution wrapped onto a second line.
+			break scan
+		case strings.HasPrefix(trimmed, ">"):
+			continue
+		}
+		out = append(out, line)
+	}
+	stripped := strings.TrimSpace(strings.Join(out, "\n"))
+	if stripped == "" {
+		return strings.TrimSpace(text)
+	}
+	return stripped
+}
+
+// Body is a message body before and after normalization.
+type Body struct {
+	Text    string
+	HTML    string
+	RawText string
+	RawHTML string
+}
+
+// Normalize cleans a message body for the tools: HTML is sanitized, plain
+// text falls back to the flattened HTML when the message has none, and the
+// quoted history and signature are stripped from it. The original parts are
+// kept in RawText and RawHTML.
+func Normalize(text string, htmlBody string) Body {
+	body := Body{RawText: text, RawHTML: htmlBody}
+	if htmlBody != "" {
+		body.HTML = SanitizeHTML(htmlBody)
+	}
+	if strings.TrimSpace(text) == "" && htmlBody != "" {
+		text = HTMLToText(htmlBody)
+	}
+	body.Text = StripQuoted(text)
+	return body
+}
+
+// NormalizingClient wraps a sync client so every email it returns has a
+// normalized body, whichever provider it came from.
+type NormalizingClient struct {
+	jmap.Client
+}
+
+func (c NormalizingClient) FetchChanges(ctx context.Context, sinceState string) ([]jmap.Email, string, error) {
+	emails, state, err := c.Client.FetchChanges(ctx, sinceState)
+	for i := range emails {
+		body := Normalize(emails[i].Text, emails[i].HTML)
+		emails[i].Text, emails[i].HTML = body.Text, body.HTML
+		emails[i].RawText, emails[i].RawHTML = body.RawText, body.RawHTML
+	}
+	return emails, state, err
+}
@@ -0,0 +1,47 @@
+package mailparse
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripQuoted(t *testing.T) {
+	cases := map[string]string{
+		"Thanks, that works.\n\nOn Tue, 3 Mar 2026 at 10:00, Ann <ann@example.com> wrote:\n> Try restarting.\n": "Thanks, that works.",
+		"Sounds good\n> earlier text\nSee you then\n":                                                           "Sounds good\nSee you then",
+		"Please refund.\n\n-- \nBob Smith\nAcme Inc\n":                                                          "Please refund.",
+		"Yes\n\nSent from my iPhone\n":                                                                          "Yes",
+		"FYI\n\n-----Original Message-----\nFrom: x@example.com\n":                                              "FYI",
+		"Ok.\nOn Tue, 3 Mar 2026 at 10:00, Ann <ann@example.com>\nwrote:\n> hi\n":                               "Ok.",
+		"> only a quote\n": "> only a quote",
+	}
+	for in, want := range cases {
+		if got := StripQuoted(in); got != want {
+			t.Errorf("StripQuoted(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSanitizeHTML(t *testing.T) {
+	in := `<html><head><title>x</title><style>p{}</style></head><body onload="evil()">` +
+		`<p class="x" onclick="evil()">Hi <b>there</b></p><script>alert(1)</script>` +
+		`<a href="javascript:alert(1)">bad</a><a href="https://example.com/?a=1&amp;b=2">good</a>` +
+		`<img src="cid:logo" onerror="evil()"><iframe src="https://x"></iframe><!-- note --></body></html>`
+	got := SanitizeHTML(in)
+	want := `<p>Hi <b>there</b></p><a rel="noopener noreferrer">bad</a>` +
+		`<a href="https://example.com/?a=1&amp;b=2" rel="noopener noreferrer">good</a><img src="cid:logo">`
+	if got != want {
+		t.Fatalf("SanitizeHTML:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestNormalizeFallsBackToHTML(t *testing.T) {
+	body := Normalize("", `<div>Hello&nbsp;team,</div><div>see&nbsp;below</div><blockquote>`+
+		`<div>On Mon, 2 Mar 2026, Ann wrote:</div></blockquote><style>.a{}</style>`)
+	if body.Text != "Hello team,\nsee below" {
+		t.Fatalf("unexpected text %q", body.Text)
+	}
+	if body.RawHTML == "" || strings.Contains(body.HTML, "<style") {
+		t.Fatalf("unexpected bodies %+v", body)
+	}
+}
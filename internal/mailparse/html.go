@@ -0,0 +1,223 @@
+package mailparse
+
+import (
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// allowedTags are kept by SanitizeHTML, with the attributes each may carry.
+// Anything else is dropped but its text kept, except the elements in
+// droppedElements, which go with their content.
+var allowedTags = map[string][]string{
+	"a": {"href", "title"}, "b": nil, "blockquote": nil, "br": nil, "code": nil,
+	"div": nil, "em": nil, "h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil,
+	"h6": nil, "hr": nil, "i": nil, "img": {"src", "alt", "title", "width", "height"},
+	"li": nil, "ol": nil, "p": nil, "pre": nil, "span": nil, "strong": nil,
+	"table": nil, "tbody": nil, "td": {"colspan", "rowspan"}, "tfoot": nil,
+	"th": {"colspan", "rowspan"}, "thead": nil, "tr": nil, "u": nil, "ul": nil,
+}
+
+var droppedElements = map[string]bool{
+	"script": true, "style": true, "head": true, "title": true, "iframe": true,
+	"object": true, "embed": true, "form": true, "noscript": true, "svg": true,
+	"template": true,
+}
+
+// blockTags end a line when HTML is flattened to text.
+var blockTags = map[string]bool{
+	"blockquote": true, "br": true, "div": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "hr": true, "li": true,
+	"p": true, "pre": true, "table": true, "tr": true,
+}
+
+var attrRE = regexp.MustCompile(`([a-zA-Z_:][-a-zA-Z0-9_:.]*)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'=<>` + "`" + `]+)))?`)
+
+// htmlToken is a tag or a run of text. Text is still entity-encoded.
+type htmlToken struct {
+	text    string
+	tag     string
+	closing bool
+	attrs   [][2]string
+}
+
+// tokenizeHTML splits markup into tags and text. Comments, doctypes and
+// processing instructions are dropped, as is everything inside
+// droppedElements. It is lenient rather than exact: mail HTML is rarely
+// well-formed and the output is only ever re-emitted from an allowlist.
+func tokenizeHTML(src string) []htmlToken {
+	var tokens []htmlToken
+	for len(src) > 0 {
+		lt := strings.IndexByte(src, '<')
+		if lt < 0 {
+			tokens = append(tokens, htmlToken{text: src})
+			break
+		}
+		if lt > 0 {
+			tokens = append(tokens, htmlToken{text: src[:lt]})
+			src = src[lt:]
+		}
+		if strings.HasPrefix(src, "<!--") {
+			end := strings.Index(src, "-->")
+			if end < 0 {
+				break
+			}
+			src = src[end+3:]
+			continue
+		}
+		end := tagEnd(src)
+		if end < 0 {
+			tokens = append(tokens, htmlToken{text: src})
+			break
+		}
+		raw := src[1:end]
+		src = src[end+1:]
+		if raw == "" || raw[0] == '!' || raw[0] == '?' {
+			continue
+		}
+		tok := htmlToken{}
+		if raw[0] == '/' {
+			tok.closing = true
+			raw = raw[1:]
+		}
+		name := raw
+		if i := strings.IndexAny(raw, " \t\r\n/"); i >= 0 {
+			name = raw[:i]
+			for _, m := range attrRE.FindAllStringSubmatch(raw[i:], -1) {
+				tok.attrs = append(tok.attrs, [2]string{strings.ToLower(m[1]), m[2] + m[3] + m[4]})
+			}
+		}
+		tok.tag = strings.ToLower(name)
+		if tok.tag == "" {
+			tokens = append(tokens, htmlToken{text: "<" + raw + ">"})
+			continue
+		}
+		if droppedElements[tok.tag] && !tok.closing {
+			close := strings.Index(strings.ToLower(src), "</"+tok.tag)
+			if close < 0 {
+				break
+			}
+			src = src[close:]
+			continue
+		}
+		tokens = append(tokens, tok)
+	}
+	return tokens
+}
+
+// tagEnd finds the '>' closing the tag at the start of src, skipping quoted
+// attribute values.
+func tagEnd(src string) int {
+	var quote byte
+	for i := 1; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i
+		}
+	}
+	return -1
+}
+
+// SanitizeHTML rewrites untrusted mail HTML so it is safe to show: only
+// allowlisted tags and attributes survive, links must be http, https or
+// mailto, images http, https or cid, and scripts, styles and embedded
+// content are removed.
+func SanitizeHTML(src string) string {
+	var b strings.Builder
+	for _, tok := range tokenizeHTML(src) {
+		if tok.tag == "" {
+			b.WriteString(html.EscapeString(html.UnescapeString(tok.text)))
+			continue
+		}
+		allowed, ok := allowedTags[tok.tag]
+		if !ok {
+			continue
+		}
+		if tok.closing {
+			b.WriteString("</" + tok.tag + ">")
+			continue
+		}
+		b.WriteString("<" + tok.tag)
+		for _, attr := range tok.attrs {
+			name, value := attr[0], html.UnescapeString(attr[1])
+			if !slices.Contains(allowed, name) || !safeURL(tok.tag, name, value) {
+				continue
+			}
+			b.WriteString(" " + name + `="` + html.EscapeString(value) + `"`)
+		}
+		if tok.tag == "a" {
+			b.WriteString(` rel="noopener noreferrer"`)
+		}
+		b.WriteString(">")
+	}
+	return b.String()
+}
+
+func safeURL(tag, attr, value string) bool {
+	if attr != "href" && attr != "src" {
+		return true
+	}
+	scheme, _, ok := strings.Cut(strings.ToLower(strings.TrimSpace(value)), ":")
+	if !ok {
+		return false
+	}
+	switch scheme {
+	case "http", "https":
+		return true
+	case "mailto":
+		return tag == "a"
+	case "cid":
+		return tag == "img"
+	}
+	return false
+}
+
+// HTMLToText flattens HTML to plain text, one line per block element, with
+// blank lines dropped.
+func HTMLToText(src string) string {
+	var b strings.Builder
+	for _, tok := range tokenizeHTML(src) {
+		switch {
+		case tok.tag == "":
+			b.WriteString(collapseSpace(html.UnescapeString(tok.text)))
+		case blockTags[tok.tag]:
+			b.WriteString("\n")
+		}
+	}
+	lines := strings.Split(b.String(), "\n")
+	out := lines[:0]
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+func collapseSpace(s string) string {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		if s != "" {
+			return " "
+		}
+		return ""
+	}
+	joined := strings.Join(fields, " ")
+	if strings.IndexAny(s[:1], " \t\r\n") == 0 {
+		joined = " " + joined
+	}
+	if strings.IndexAny(s[len(s)-1:], " \t\r\n") == 0 {
+		joined += " "
+	}
+	return joined
+}
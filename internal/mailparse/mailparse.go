@@ -0,0 +1,233 @@
+// Package mailparse turns raw RFC 5322 messages into the shape the ingestor
+// consumes, for providers that hand us whole messages rather than parsed JSON.
+package mailparse
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+
+	"neuralmail/internal/jmap"
+	"neuralmail/internal/store"
+)
+
+var (
+	wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+	addrParser  = &mail.AddressParser{WordDecoder: wordDecoder}
+)
+
+// Parse maps a raw message onto jmap.Email. ID and InternetMsg are the
+// Message-ID, ThreadID is the root of the References chain (InReplyTo and
+// References keep the whole chain for threading) and ReceivedAt is
+// the Date header; any of them may be empty when the headers are missing, so
+// callers fill in provider-specific values. Bounces and complaints also get
+// a Report, and messages carrying a calendar invitation or reply a
+// CalendarMethod.
+func Parse(raw []byte) (jmap.Email, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return jmap.Email{}, err
+	}
+	header := msg.Header
+	email := ParseHeader(header)
+
+	body, err := io.ReadAll(msg.Body)
+	if err != nil {
+		return jmap.Email{}, err
+	}
+	text, html, err := extractBodies(header.Get("Content-Type"), header.Get("Content-Transfer-Encoding"), bytes.NewReader(body))
+	if err != nil {
+		return jmap.Email{}, err
+	}
+	email.Text = text
+	email.HTML = html
+	email.Size = int64(len(raw))
+	email.Raw = raw
+	email.CalendarMethod = calendarMethod(header.Get("Content-Type"), header.Get("Content-Transfer-Encoding"), bytes.NewReader(body))
+	report, err := parseReport(header.Get("Content-Type"), body)
+	if err != nil {
+		return jmap.Email{}, err
+	}
+	email.Report = report
+	return email, nil
+}
+
+// ParseHeader maps the headers alone onto jmap.Email, the way Parse does, for
+// providers that hand us a message's headers and bodies separately.
+func ParseHeader(header mail.Header) jmap.Email {
+	messageID := firstMessageID(header.Get("Message-Id"))
+	email := jmap.Email{
+		ID:            messageID,
+		ThreadID:      threadRoot(header, messageID),
+		Subject:       decodeHeader(header.Get("Subject")),
+		InternetMsg:   messageID,
+		InReplyTo:     firstMessageID(header.Get("In-Reply-To")),
+		References:    messageIDs(header.Get("References")),
+		AutoSubmitted: jmap.AutomatedReason(header.Get("Auto-Submitted"), header.Get("Precedence")),
+	}
+	if date, err := header.Date(); err == nil {
+		email.ReceivedAt = date.UTC()
+	}
+	if from, err := addrParser.ParseList(header.Get("From")); err == nil && len(from) > 0 {
+		email.From = store.Participant{Name: from[0].Name, Email: from[0].Address}
+	}
+	if to, err := addrParser.ParseList(header.Get("To")); err == nil {
+		for _, addr := range to {
+			email.To = append(email.To, store.Participant{Name: addr.Name, Email: addr.Address})
+		}
+	}
+	return email
+}
+
+// extractBodies walks the MIME tree and returns the first text/plain and
+// text/html parts that are not attachments.
+func extractBodies(contentType string, encoding string, body io.Reader) (string, string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		boundary := params["boundary"]
+		if boundary == "" {
+			return "", "", errors.New("mailparse: multipart message without boundary")
+		}
+		var text, html string
+		mr := multipart.NewReader(body, boundary)
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return text, html, err
+			}
+			if disposition, _, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition")); disposition == "attachment" {
+				continue
+			}
+			partText, partHTML, err := extractBodies(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err != nil {
+				return text, html, err
+			}
+			if text == "" {
+				text = partText
+			}
+			if html == "" {
+				html = partHTML
+			}
+		}
+		return text, html, nil
+	}
+
+	if mediaType != "text/plain" && mediaType != "text/html" {
+		return "", "", nil
+	}
+	decoded, err := io.ReadAll(decodeTransfer(encoding, body))
+	if err != nil {
+		return "", "", err
+	}
+	content := decodeCharset(params["charset"], decoded)
+	if mediaType == "text/html" {
+		return "", content, nil
+	}
+	return content, "", nil
+}
+
+func decodeTransfer(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	default:
+		return body
+	}
+}
+
+// decodeCharset converts Latin-1 to UTF-8; everything else is passed through,
+// which is correct for UTF-8 and ASCII and lossy but readable for the rest.
+func decodeCharset(charset string, b []byte) string {
+	if isLatin1(charset) {
+		return latin1ToUTF8(b)
+	}
+	return string(b)
+}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	if !isLatin1(charset) {
+		return nil, fmt.Errorf("mailparse: unsupported charset %q", charset)
+	}
+	b, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(latin1ToUTF8(b)), nil
+}
+
+func isLatin1(charset string) bool {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "iso-8859-1", "latin1":
+		return true
+	}
+	return false
+}
+
+func latin1ToUTF8(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return strings.TrimSpace(value)
+	}
+	return strings.TrimSpace(decoded)
+}
+
+// threadRoot returns the first Message-ID in References, then In-Reply-To,
+// then the message's own ID.
+func threadRoot(header mail.Header, messageID string) string {
+	if root := firstMessageID(header.Get("References")); root != "" {
+		return root
+	}
+	if parent := firstMessageID(header.Get("In-Reply-To")); parent != "" {
+		return parent
+	}
+	return messageID
+}
+
+// messageIDs returns every bracketed Message-ID in a header value, in order.
+func messageIDs(value string) []string {
+	var ids []string
+	for {
+		id := firstMessageID(value)
+		if !strings.HasPrefix(id, "<") {
+			return ids
+		}
+		ids = append(ids, id)
+		value = value[strings.Index(value, id)+len(id):]
+	}
+}
+
+func firstMessageID(value string) string {
+	start := strings.IndexByte(value, '<')
+	if start < 0 {
+		return strings.TrimSpace(value)
+	}
+	end := strings.IndexByte(value[start:], '>')
+	if end < 0 {
+		return ""
+	}
+	return value[start : start+end+1]
+}
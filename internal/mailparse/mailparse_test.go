@@ -0,0 +1,218 @@
+package mailparse
+
+import "testing"
+
+func TestParseMultipart(t *testing.T) {
+	raw := "From: =?UTF-8?Q?Jos=C3=A9?= <jose@example.com>\r\n" +
+		"To: a@example.com, B <b@example.com>\r\n" +
+		"Subject: =?ISO-8859-1?Q?Caf=E9?=\r\n" +
+		"In-Reply-To: <root@x>\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: multipart/alternative; boundary=inner\r\n" +
+		"\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"caf=C3=A9 au lait\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/html\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"PHA+aGk8L3A+\r\n" +
+		"--inner--\r\n" +
+		"--outer\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Disposition: attachment; filename=notes.txt\r\n" +
+		"\r\n" +
+		"ignored\r\n" +
+		"--outer--\r\n"
+
+	email, err := Parse([]byte(raw))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if email.ID != "" || !email.ReceivedAt.IsZero() {
+		t.Fatalf("expected empty id and date without headers, got %+v", email)
+	}
+	if email.ThreadID != "<root@x>" {
+		t.Fatalf("expected thread from In-Reply-To, got %q", email.ThreadID)
+	}
+	if email.InReplyTo != "<root@x>" || len(email.References) != 0 {
+		t.Fatalf("unexpected threading headers: %q %v", email.InReplyTo, email.References)
+	}
+	if email.Subject != "Café" || email.From.Name != "José" || len(email.To) != 2 {
+		t.Fatalf("unexpected headers: %+v", email)
+	}
+	if email.Text != "café au lait" || email.HTML != "<p>hi</p>" {
+		t.Fatalf("unexpected bodies text=%q html=%q", email.Text, email.HTML)
+	}
+}
+
+func TestParseDeliveryStatusNotification(t *testing.T) {
+	raw := "From: MAILER-DAEMON@mx.example.com\r\n" +
+		"To: support@acme.test\r\n" +
+		"Subject: Undelivered Mail Returned to Sender\r\n" +
+		"Message-ID: <dsn-1@mx.example.com>\r\n" +
+		"Content-Type: multipart/report; report-type=delivery-status; boundary=b1\r\n" +
+		"\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Your message could not be delivered.\r\n" +
+		"--b1\r\n" +
+		"Content-Type: message/delivery-status\r\n" +
+		"\r\n" +
+		"Reporting-MTA: dns; mx.example.com\r\n" +
+		"\r\n" +
+		"Final-Recipient: rfc822; gone@example.com\r\n" +
+		"Action: failed\r\n" +
+		"Status: 5.1.1\r\n" +
+		"Diagnostic-Code: smtp; 550 5.1.1 User unknown\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/rfc822-headers\r\n" +
+		"\r\n" +
+		"From: support@acme.test\r\n" +
+		"To: gone@example.com\r\n" +
+		"Message-ID: <orig-1@acme.test>\r\n" +
+		"--b1--\r\n"
+
+	email, err := Parse([]byte(raw))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if email.Text != "Your message could not be delivered." {
+		t.Fatalf("unexpected text %q", email.Text)
+	}
+	r := email.Report
+	if r == nil || r.Kind != "bounce" || r.Recipient != "gone@example.com" || r.Status != "5.1.1" || r.OriginalMessageID != "<orig-1@acme.test>" {
+		t.Fatalf("unexpected report: %+v", r)
+	}
+	if r.Diagnostic != "550 5.1.1 User unknown" || !r.Permanent() {
+		t.Fatalf("expected hard bounce, got %+v", r)
+	}
+}
+
+func TestParseFeedbackReport(t *testing.T) {
+	raw := "From: fbl@isp.example\r\n" +
+		"To: support@acme.test\r\n" +
+		"Subject: Abuse report\r\n" +
+		"Content-Type: multipart/report; report-type=feedback-report; boundary=b2\r\n" +
+		"\r\n" +
+		"--b2\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"This is an email abuse report.\r\n" +
+		"--b2\r\n" +
+		"Content-Type: message/feedback-report\r\n" +
+		"\r\n" +
+		"Feedback-Type: abuse\r\n" +
+		"User-Agent: isp-fbl/1.0\r\n" +
+		"Version: 1\r\n" +
+		"--b2\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"\r\n" +
+		"From: support@acme.test\r\n" +
+		"To: Annoyed <annoyed@isp.example>\r\n" +
+		"Message-ID: <orig-2@acme.test>\r\n" +
+		"\r\n" +
+		"Hello again\r\n" +
+		"--b2--\r\n"
+
+	email, err := Parse([]byte(raw))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	r := email.Report
+	if r == nil || r.Kind != "complaint" || r.Action != "abuse" || r.Recipient != "annoyed@isp.example" || r.OriginalMessageID != "<orig-2@acme.test>" {
+		t.Fatalf("unexpected report: %+v", r)
+	}
+	if r.Permanent() {
+		t.Fatalf("complaint is not a bounce")
+	}
+}
+
+func TestParsePlainMessageHasNoReport(t *testing.T) {
+	email, err := Parse([]byte("From: a@example.com\r\nSubject: hi\r\n\r\nhello\r\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if email.Report != nil {
+		t.Fatalf("unexpected report: %+v", email.Report)
+	}
+}
+
+func TestParseAutoSubmitted(t *testing.T) {
+	cases := map[string]string{
+		"Auto-Submitted: auto-replied\r\n":            "auto-replied",
+		"Auto-Submitted: auto-generated; owner=x\r\n": "auto-generated",
+		"Auto-Submitted: no\r\nPrecedence: bulk\r\n":  "bulk",
+		"Precedence: first-class\r\n":                 "",
+		"X-Mailer: test\r\n":                          "",
+	}
+	for headers, want := range cases {
+		email, err := Parse([]byte("From: a@example.com\r\n" + headers + "\r\nhello\r\n"))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		if email.AutoSubmitted != want {
+			t.Fatalf("headers %q: expected %q, got %q", headers, want, email.AutoSubmitted)
+		}
+	}
+}
+
+func TestParseReferencesChain(t *testing.T) {
+	raw := "From: a@example.com\r\n" +
+		"Message-ID: <c@x>\r\n" +
+		"In-Reply-To: <b@x>\r\n" +
+		"References: <root@x>\r\n <a@x> <b@x>\r\n" +
+		"Subject: Re: hi\r\n" +
+		"\r\n" +
+		"ok\r\n"
+	email, err := Parse([]byte(raw))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if email.ThreadID != "<root@x>" || email.InReplyTo != "<b@x>" {
+		t.Fatalf("unexpected thread %q in-reply-to %q", email.ThreadID, email.InReplyTo)
+	}
+	if len(email.References) != 3 || email.References[0] != "<root@x>" || email.References[2] != "<b@x>" {
+		t.Fatalf("unexpected references: %v", email.References)
+	}
+}
+
+func TestParseCalendarMethod(t *testing.T) {
+	reply := "From: a@example.com\r\n" +
+		"Subject: Accepted: Onboarding call\r\n" +
+		"Content-Type: multipart/alternative; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"a@example.com has accepted this invitation.\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/calendar; charset=utf-8; method=REPLY\r\n" +
+		"\r\n" +
+		"BEGIN:VCALENDAR\r\nMETHOD:REPLY\r\nEND:VCALENDAR\r\n" +
+		"--b--\r\n"
+	invite := "From: a@example.com\r\n" +
+		"Content-Type: text/calendar\r\n" +
+		"\r\n" +
+		"BEGIN:VCALENDAR\r\nmethod:request\r\nEND:VCALENDAR\r\n"
+	plain := "From: a@example.com\r\nSubject: hi\r\n\r\nhello\r\n"
+
+	for raw, want := range map[string]string{reply: "REPLY", invite: "REQUEST", plain: ""} {
+		email, err := Parse([]byte(raw))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		if email.CalendarMethod != want {
+			t.Fatalf("expected calendar method %q, got %q", want, email.CalendarMethod)
+		}
+		if email.Size != int64(len(raw)) {
+			t.Fatalf("expected size %d, got %d", len(raw), email.Size)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package mailparse
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+
+	"neuralmail/internal/jmap"
+)
+
+// parseReport reads a multipart/report message: a delivery status
+// notification (RFC 3464) or an abuse feedback report (RFC 5965). It returns
+// nil for any other message.
+func parseReport(contentType string, body []byte) (*jmap.DeliveryReport, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/report" {
+		return nil, nil
+	}
+	var report jmap.DeliveryReport
+	switch strings.ToLower(params["report-type"]) {
+	case "delivery-status":
+		report.Kind = jmap.ReportBounce
+	case "feedback-report":
+		report.Kind = jmap.ReportComplaint
+	default:
+		return nil, nil
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, errors.New("mailparse: multipart report without boundary")
+	}
+
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := mr.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		content := decodeTransfer(part.Header.Get("Content-Transfer-Encoding"), part)
+		switch partType {
+		case "message/delivery-status", "message/global-delivery-status":
+			readDeliveryStatus(content, &report)
+		case "message/feedback-report":
+			fields := readFields(bufio.NewReader(content))
+			report.Action = fields.Get("Feedback-Type")
+			report.Recipient = stripAddressType(fields.Get("Original-Rcpt-To"))
+		case "message/rfc822", "message/global", "text/rfc822-headers", "message/rfc822-headers":
+			original := readFields(bufio.NewReader(content))
+			report.OriginalMessageID = firstMessageID(original.Get("Message-Id"))
+			if report.Recipient == "" && report.Kind == jmap.ReportComplaint {
+				if to, err := addrParser.ParseList(original.Get("To")); err == nil && len(to) > 0 {
+					report.Recipient = to[0].Address
+				}
+			}
+		}
+	}
+	return &report, nil
+}
+
+// readDeliveryStatus takes the first per-recipient block of a DSN, or the
+// first whose action is failed when there are several.
+func readDeliveryStatus(r io.Reader, report *jmap.DeliveryReport) {
+	br := bufio.NewReader(r)
+	readFields(br) // per-message fields
+	for {
+		fields := readFields(br)
+		if len(fields) == 0 {
+			return
+		}
+		if report.Recipient != "" && strings.EqualFold(report.Action, "failed") {
+			continue
+		}
+		report.Recipient = stripAddressType(fields.Get("Final-Recipient"))
+		if report.Recipient == "" {
+			report.Recipient = stripAddressType(fields.Get("Original-Recipient"))
+		}
+		report.Action = strings.ToLower(strings.TrimSpace(fields.Get("Action")))
+		report.Status = firstField(fields.Get("Status"))
+		report.Diagnostic = stripAddressType(fields.Get("Diagnostic-Code"))
+	}
+}
+
+// readFields reads one block of header-style fields up to a blank line. A
+// truncated block still returns the fields read so far.
+func readFields(br *bufio.Reader) textproto.MIMEHeader {
+	for {
+		// Skip blank lines between blocks.
+		b, err := br.Peek(1)
+		if err != nil || (b[0] != '\r' && b[0] != '\n') {
+			break
+		}
+		_, _ = br.ReadByte()
+	}
+	fields, _ := textproto.NewReader(br).ReadMIMEHeader()
+	return fields
+}
+
+// stripAddressType drops the "rfc822;" or "smtp;" type prefix from DSN
+// fields such as Final-Recipient and Diagnostic-Code.
+func stripAddressType(value string) string {
+	if _, rest, ok := strings.Cut(value, ";"); ok {
+		value = rest
+	}
+	return strings.TrimSpace(value)
+}
+
+func firstField(value string) string {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
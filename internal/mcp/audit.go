@@ -0,0 +1,85 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/store"
+)
+
+// auditResourceURI is the audit log resource. Its query takes the filters
+// of GET /v1/audit; reading it needs nerve:audit.read.
+const auditResourceURI = "email://audit"
+
+// readAuditResource lists the caller's org's audit entries. Without a
+// principal, as in self-hosted mode without auth, it lists every org's.
+func (s *Server) readAuditResource(ctx context.Context, uri string) (any, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	query := parsed.Query()
+	principal, _ := auth.PrincipalFromContext(ctx)
+	filter := store.AuditFilter{
+		OrgID:    principal.OrgID,
+		InboxIDs: principal.InboxIDs,
+		ToolName: query.Get("tool"),
+		Actor:    query.Get("actor"),
+		ReplayID: query.Get("replay_id"),
+		Limit:    50,
+	}
+	if inboxID := query.Get("inbox_id"); inboxID != "" {
+		if !principal.CanAccessInbox(inboxID) {
+			return nil, errors.New("inbox is not allowed for this credential")
+		}
+		filter.InboxIDs = []string{inboxID}
+	}
+	for name, bound := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if raw := query.Get(name); raw != "" {
+			if *bound, err = time.Parse(time.RFC3339Nano, raw); err != nil {
+				return nil, errors.New(name + " must be an RFC 3339 timestamp")
+			}
+		}
+	}
+	if raw := query.Get("cursor"); raw != "" {
+		if err := filter.SetCursor(raw); err != nil {
+			return nil, err
+		}
+	}
+	if parsed, err := strconv.Atoi(query.Get("limit")); err == nil && parsed > 0 && parsed <= 500 {
+		filter.Limit = parsed
+	}
+
+	entries, err := s.Tools.Store.ListAuditEntries(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]map[string]any, 0, len(entries))
+	for _, e := range entries {
+		item := map[string]any{
+			"id":              e.ID,
+			"tool_call_id":    e.ToolCallID,
+			"actor":           e.Actor,
+			"tool_name":       e.ToolName,
+			"inbox_id":        e.InboxID,
+			"latency_ms":      e.LatencyMS,
+			"replay_id":       e.ReplayID,
+			"policy_rule_ids": e.PolicyRuleIDs,
+			"usage_status":    e.UsageStatus,
+			"created_at":      e.CreatedAt,
+		}
+		if e.CitationCoverage.Valid {
+			item["citation_coverage"] = e.CitationCoverage.Float64
+		}
+		items = append(items, item)
+	}
+	result := map[string]any{"entries": items}
+	if !filter.Since.IsZero() && len(entries) == filter.Limit {
+		result["next_cursor"] = entries[len(entries)-1].Cursor()
+	}
+	return result, nil
+}
@@ -0,0 +1,93 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"neuralmail/internal/auth"
+)
+
+const maxBatchSize = 50
+
+func isBatch(raw json.RawMessage) bool {
+	trimmed := bytes.TrimLeft(raw, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// handleBatch serves a JSON-RPC batch on an existing session. Each request is
+// authorized, dispatched and metered on its own, so one failing call does not
+// fail the others. Notifications get no response; a batch of only
+// notifications is answered with 202.
+func (s *Server) handleBatch(ctx context.Context, w http.ResponseWriter, r *http.Request, principal auth.Principal, raw json.RawMessage) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if len(items) == 0 {
+		writeError(w, nil, -32600, "Invalid Request: empty batch")
+		return
+	}
+	if len(items) > maxBatchSize {
+		writeErrorWithData(w, nil, -32600, "Invalid Request: batch too large", map[string]any{"max_batch_size": maxBatchSize})
+		return
+	}
+	sess, err := s.resumeSession(ctx, r.Header.Get("MCP-Session-Id"), principal)
+	if err != nil {
+		s.writeDispatchError(w, nil, err)
+		return
+	}
+	if err := s.checkVersionHeader(r, sess.Version); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx = withProtocolVersion(ctx, sess.Version)
+
+	responses := make([]Response, 0, len(items))
+	for _, item := range items {
+		var req Request
+		if err := json.Unmarshal(item, &req); err != nil || req.Method == "" {
+			responses = append(responses, Response{JSONRPC: "2.0", Error: &ResponseError{Code: -32600, Message: "Invalid Request"}})
+			continue
+		}
+		resp := s.batchResponse(ctx, principal, req)
+		if req.ID != nil {
+			responses = append(responses, resp)
+		}
+	}
+
+	w.Header().Set("MCP-Protocol-Version", s.advertisedVersion(sess.Version))
+	if len(responses) == 0 {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(responses)
+}
+
+// batchResponse handles one request of a batch. initialize is refused: the
+// session a batch runs on has to exist before it is sent.
+func (s *Server) batchResponse(ctx context.Context, principal auth.Principal, req Request) Response {
+	resp := Response{JSONRPC: "2.0", ID: req.ID}
+	if req.Method == "initialize" {
+		resp.Error = &ResponseError{Code: -32600, Message: "initialize cannot be batched"}
+		return resp
+	}
+	if s.scopesEnforced(principal) {
+		if scope := s.requiredScope(req); scope != "" {
+			if err := s.Auth.ValidateScopes(principal, scope); err != nil {
+				resp.Error = &ResponseError{Code: -32000, Message: "forbidden", Data: map[string]any{"required_scope": scope}}
+				return resp
+			}
+		}
+	}
+	result, err := s.dispatch(ctx, req)
+	if err != nil {
+		resp.Error = dispatchError(err)
+		return resp
+	}
+	resp.Result = result
+	return resp
+}
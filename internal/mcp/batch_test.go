@@ -0,0 +1,122 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/entitlements"
+)
+
+// countingGate fails every reservation with the next error in errs.
+type countingGate struct {
+	errs  []error
+	calls int
+}
+
+func (g *countingGate) PreAuthorizeTool(_ context.Context, _ auth.Principal, _ string, _ string) (*entitlements.Reservation, error) {
+	err := g.errs[g.calls%len(g.errs)]
+	g.calls++
+	return nil, err
+}
+
+func (g *countingGate) FinalizeToolExecution(_ context.Context, _ entitlements.Reservation, _ string, _ string, _ string, _ string) error {
+	return nil
+}
+
+func postBatch(t *testing.T, server *Server, body string, sessionID string) (*httptest.ResponseRecorder, []Response) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/mcp", bytes.NewReader([]byte(body)))
+	if sessionID != "" {
+		req.Header.Set("MCP-Session-Id", sessionID)
+	}
+	rec := httptest.NewRecorder()
+	server.HandleHTTP(rec, req)
+	var responses []Response
+	if rec.Code == http.StatusOK && bytes.HasPrefix(bytes.TrimSpace(rec.Body.Bytes()), []byte("[")) {
+		if err := json.Unmarshal(rec.Body.Bytes(), &responses); err != nil {
+			t.Fatalf("decode batch response: %v", err)
+		}
+	}
+	return rec, responses
+}
+
+func TestBatchReturnsResponsesInOrder(t *testing.T) {
+	server := newVersionTestServer()
+	sessionID := initializeSession(t, server)
+
+	rec, responses := postBatch(t, server, `[
+		{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{}},
+		{"jsonrpc":"2.0","method":"notifications/initialized"},
+		{"jsonrpc":"2.0","id":"two","method":"resources/list","params":{}},
+		{"jsonrpc":"2.0","id":3,"method":"initialize","params":{}},
+		42
+	]`, sessionID)
+	if rec.Code != http.StatusOK || len(responses) != 4 {
+		t.Fatalf("expected 4 responses, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if responses[0].ID != float64(1) || responses[0].Error != nil || responses[0].Result == nil {
+		t.Fatalf("unexpected tools/list response %+v", responses[0])
+	}
+	if responses[1].ID != "two" || responses[1].Error != nil {
+		t.Fatalf("unexpected resources/list response %+v", responses[1])
+	}
+	if responses[2].Error == nil || responses[2].Error.Message != "initialize cannot be batched" {
+		t.Fatalf("expected initialize to be refused, got %+v", responses[2])
+	}
+	if responses[3].ID != nil || responses[3].Error == nil || responses[3].Error.Code != -32600 {
+		t.Fatalf("expected invalid request error, got %+v", responses[3])
+	}
+}
+
+func TestBatchReservesEachToolCall(t *testing.T) {
+	server := newVersionTestServer()
+	server.Config.Entitlements.LocalMode = true
+	gate := &countingGate{errs: []error{&entitlements.RateLimitError{RetryAfterSeconds: 3}, entitlements.ErrQuotaExceeded}}
+	server.Entitlements = gate
+	sessionID := initializeSession(t, server)
+
+	_, responses := postBatch(t, server, `[
+		{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"list_threads","arguments":{"inbox_id":"i-1"}}},
+		{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"get_thread","arguments":{"thread_id":"t-1"}}}
+	]`, sessionID)
+	if gate.calls != 2 {
+		t.Fatalf("expected one reservation per call, got %d", gate.calls)
+	}
+	if len(responses) != 2 || responses[0].Error.Code != -32042 || responses[1].Error.Code != -32040 {
+		t.Fatalf("expected per-call entitlement errors, got %+v", responses)
+	}
+}
+
+func TestBatchRejectsEmptyAndSessionless(t *testing.T) {
+	server := newVersionTestServer()
+
+	_, resp := postRPCRaw(t, server, `[]`, "")
+	if resp.Error == nil || resp.Error.Code != -32600 {
+		t.Fatalf("expected invalid request for an empty batch, got %+v", resp)
+	}
+	_, resp = postRPCRaw(t, server, `[{"jsonrpc":"2.0","id":1,"method":"tools/list"}]`, "")
+	if resp.Error == nil || resp.Error.Message != errInvalidSession.Error() {
+		t.Fatalf("expected a batch without a session to be rejected, got %+v", resp)
+	}
+
+	sessionID := initializeSession(t, server)
+	rec, _ := postBatch(t, server, `[{"jsonrpc":"2.0","method":"notifications/initialized"}]`, sessionID)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202 for a batch of notifications, got %d", rec.Code)
+	}
+}
+
+func postRPCRaw(t *testing.T, server *Server, body string, sessionID string) (*httptest.ResponseRecorder, Response) {
+	t.Helper()
+	rec, _ := postBatch(t, server, body, sessionID)
+	var resp Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v (%s)", err, rec.Body.String())
+	}
+	return rec, resp
+}
@@ -0,0 +1,75 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrShuttingDown refuses tool calls that arrive while the server drains.
+var ErrShuttingDown = errors.New("server shutting down")
+
+// drain counts the tool calls running so Drain can wait for them.
+type drain struct {
+	mu       sync.Mutex
+	draining bool
+	running  int
+	idle     chan struct{}
+}
+
+// beginCall registers a tool call, or reports false once the server is
+// draining.
+func (s *Server) beginCall() bool {
+	s.drain.mu.Lock()
+	defer s.drain.mu.Unlock()
+	if s.drain.draining {
+		return false
+	}
+	s.drain.running++
+	return true
+}
+
+func (s *Server) endCall() {
+	s.drain.mu.Lock()
+	defer s.drain.mu.Unlock()
+	s.drain.running--
+	if s.drain.running == 0 && s.drain.idle != nil {
+		close(s.drain.idle)
+		s.drain.idle = nil
+	}
+}
+
+// Draining reports whether Drain has been called.
+func (s *Server) Draining() bool {
+	s.drain.mu.Lock()
+	defer s.drain.mu.Unlock()
+	return s.drain.draining
+}
+
+// Drain stops the server taking tool calls and waits until those already
+// running have finished, their usage finalized and audited, or until ctx is
+// done.
+func (s *Server) Drain(ctx context.Context) error {
+	s.drain.mu.Lock()
+	s.drain.draining = true
+	if s.drain.running == 0 {
+		s.drain.mu.Unlock()
+		return nil
+	}
+	if s.drain.idle == nil {
+		s.drain.idle = make(chan struct{})
+	}
+	idle := s.drain.idle
+	s.drain.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		s.drain.mu.Lock()
+		running := s.drain.running
+		s.drain.mu.Unlock()
+		return fmt.Errorf("%d tool calls still running: %w", running, ctx.Err())
+	}
+}
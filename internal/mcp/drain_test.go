@@ -0,0 +1,46 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"neuralmail/internal/config"
+)
+
+func TestDrainWaitsForRunningCalls(t *testing.T) {
+	server := NewServer(config.Default(), nil, nil, nil)
+	if !server.beginCall() {
+		t.Fatalf("expected a call to start before draining")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := server.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected drain to time out on the running call, got %v", err)
+	}
+	if !server.Draining() || server.beginCall() {
+		t.Fatalf("expected new calls to be refused while draining")
+	}
+	_, err := server.callTool(context.Background(), Request{Params: json.RawMessage(`{"name": "list_threads"}`)})
+	if !errors.Is(err, ErrShuttingDown) {
+		t.Fatalf("expected tool calls to be refused, got %v", err)
+	}
+	if rpcErr := dispatchError(err); rpcErr.Code != -32047 || rpcErr.Message != "shutting_down" {
+		t.Fatalf("unexpected shutdown error: %#v", rpcErr)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- server.Drain(context.Background()) }()
+	server.endCall()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected drain to finish once the call ended, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("drain did not finish after the last call ended")
+	}
+}
@@ -0,0 +1,140 @@
+package mcp
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/entitlements"
+	"neuralmail/internal/llm"
+)
+
+const (
+	// playgroundAuthMethod marks the principal of an anonymous playground
+	// request.
+	playgroundAuthMethod = "playground"
+	// maxPlaygroundBodyBytes caps a playground request body.
+	maxPlaygroundBodyBytes = 64 << 10
+)
+
+// playgroundScopes are granted to every playground caller: enough to list,
+// read and search the demo inbox. Drafting and sending are left out, so
+// anonymous callers reach the model only through read tools such as
+// summarize_thread, and those draw on DailyTokens.
+var playgroundScopes = []string{"nerve:email.read", "nerve:email.search"}
+
+// Playground is the sandbox org anonymous callers reach through
+// /mcp-playground.
+type Playground struct {
+	OrgID   string
+	InboxID string
+	// RPM is the per-client-IP request budget.
+	RPM int
+	// DailyTokens caps the model tokens every playground caller together
+	// spends in a UTC day, as counted by Ledger. Zero, or no Ledger, leaves
+	// it unlimited.
+	DailyTokens int64
+	Ledger      llm.TokenLedger
+	// AllowOrigins lists the browser origins the endpoint answers; empty
+	// allows any.
+	AllowOrigins []string
+	limiter      *entitlements.RateLimiter
+}
+
+func NewPlayground(orgID, inboxID string, rpm int, allowOrigins []string) *Playground {
+	return &Playground{OrgID: orgID, InboxID: inboxID, RPM: rpm, AllowOrigins: allowOrigins, limiter: entitlements.NewRateLimiter()}
+}
+
+// HandlePlayground serves the MCP endpoint without credentials, confined to
+// the playground's sandbox org with read and search scopes. Each client IP
+// is rate limited, model calls share the playground's daily token budget,
+// batches are refused, and GET describes the sandbox so a docs page can
+// render it.
+func (s *Server) HandlePlayground(w http.ResponseWriter, r *http.Request) {
+	p := s.Playground
+	if p == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if !p.allowsOrigin(origin) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Expose-Headers", "MCP-Session-Id, MCP-Protocol-Version")
+		w.Header().Add("Vary", "Origin")
+	}
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, MCP-Session-Id, MCP-Protocol-Version")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case http.MethodGet:
+		writePlaygroundDescriptor(w, p)
+		return
+	case http.MethodPost, http.MethodDelete:
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := clientIP(r)
+	if ok, retryAfter := p.limiter.Allow("playground:"+ip, p.RPM); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		s.writeDispatchError(w, nil, &entitlements.RateLimitError{RetryAfterSeconds: retryAfter, Dimension: entitlements.LimitIP})
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxPlaygroundBodyBytes)
+
+	principal := auth.Principal{
+		OrgID:      p.OrgID,
+		ActorID:    "playground:" + ip,
+		Scopes:     playgroundScopes,
+		AuthMethod: playgroundAuthMethod,
+		InboxIDs:   []string{p.InboxID},
+	}
+	ctx := llm.WithBudget(auth.WithPrincipal(r.Context(), principal), llm.Budget{
+		PerCall: s.Config.LLM.Budget.PerCallTokens,
+		Daily:   p.DailyTokens,
+		Key:     "playground:" + p.OrgID,
+		Ledger:  p.Ledger,
+	})
+	s.serve(ctx, w, r, principal)
+}
+
+func (p *Playground) allowsOrigin(origin string) bool {
+	if len(p.AllowOrigins) == 0 {
+		return true
+	}
+	for _, allowed := range p.AllowOrigins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func writePlaygroundDescriptor(w http.ResponseWriter, p *Playground) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"inbox_id":       p.InboxID,
+		"scopes":         playgroundScopes,
+		"rate_limit_rpm": p.RPM,
+		"daily_tokens":   p.DailyTokens,
+	})
+}
+
+// clientIP is the host part of r.RemoteAddr. Deployments behind a proxy are
+// expected to rewrite RemoteAddr from the forwarding header they trust.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return strings.TrimSpace(r.RemoteAddr)
+	}
+	return host
+}
@@ -0,0 +1,65 @@
+package mcp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postPlayground(t *testing.T, server *Server, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/mcp-playground", strings.NewReader(body))
+	req.RemoteAddr = "203.0.113.7:51000"
+	rec := httptest.NewRecorder()
+	server.HandlePlayground(rec, req)
+	return rec
+}
+
+func TestPlaygroundDisabledIsNotFound(t *testing.T) {
+	server := newVersionTestServer()
+	rec := postPlayground(t, server, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without a playground, got %d", rec.Code)
+	}
+}
+
+func TestPlaygroundEnforcesScopesAndRefusesBatches(t *testing.T) {
+	server := newVersionTestServer()
+	server.Playground = NewPlayground("org-sandbox", "inbox-demo", 100, nil)
+
+	rec := postPlayground(t, server, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`)
+	if rec.Code != http.StatusOK || rec.Header().Get("MCP-Session-Id") == "" {
+		t.Fatalf("expected initialize to open a session, got %d %s", rec.Code, rec.Body.String())
+	}
+	for _, tool := range []string{"send_reply", "draft_reply_with_policy", "triage_message"} {
+		rec = postPlayground(t, server, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"`+tool+`","arguments":{}}}`)
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("expected %s to be forbidden, got %d", tool, rec.Code)
+		}
+	}
+	rec = postPlayground(t, server, `[{"jsonrpc":"2.0","id":3,"method":"tools/list"}]`)
+	var resp Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Error == nil || resp.Error.Code != -32600 {
+		t.Fatalf("expected batch to be refused, got %s", rec.Body.String())
+	}
+}
+
+func TestPlaygroundRateLimitsPerIP(t *testing.T) {
+	server := newVersionTestServer()
+	server.Playground = NewPlayground("org-sandbox", "inbox-demo", 1, nil)
+
+	body := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`
+	if rec := postPlayground(t, server, body); rec.Code != http.StatusOK {
+		t.Fatalf("expected first request to pass, got %d", rec.Code)
+	}
+	rec := postPlayground(t, server, body)
+	var resp Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Error == nil || resp.Error.Code != -32042 {
+		t.Fatalf("expected rate_limited, got %s", rec.Body.String())
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected a Retry-After header")
+	}
+}
@@ -0,0 +1,286 @@
+package mcp
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/store"
+)
+
+// redactedValue replaces the values of redacted fields in stored payloads.
+const redactedValue = "[redacted]"
+
+// replayChange is one difference between a tool call's stored result and
+// its replay. Path is dotted, with [i] for array elements.
+type replayChange struct {
+	Path   string `json:"path"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// HandleReplay serves /v1/replays/{replay_id}. POST re-runs the audited
+// tool call with its stored arguments against current data as a dry run,
+// rolling back anything it writes, and returns the diff against the stored
+// result. DELETE wipes the stored arguments and result. Replays are not
+// metered or audited themselves.
+func (s *Server) HandleReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := s.validateOrigin(r); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	replayID := strings.TrimPrefix(r.URL.Path, "/v1/replays/")
+	if replayID == "" || strings.Contains(replayID, "/") {
+		http.Error(w, "missing replay id", http.StatusBadRequest)
+		return
+	}
+	if s.Tools == nil || s.Tools.Store == nil {
+		http.Error(w, "store not configured", http.StatusServiceUnavailable)
+		return
+	}
+	ctx := r.Context()
+	var principal auth.Principal
+	if s.Config.Cloud.Mode {
+		if s.Auth == nil {
+			http.Error(w, "cloud auth not configured", http.StatusInternalServerError)
+			return
+		}
+		authenticated, err := s.Auth.AuthenticateRequest(r)
+		if err != nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		principal = authenticated
+		scope := "nerve:audit.read"
+		if r.Method == http.MethodDelete {
+			scope = "nerve:admin.billing"
+		}
+		if err := s.Auth.ValidateScopes(principal, scope); err != nil {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+	}
+
+	call, err := s.Tools.Store.GetToolCallReplay(ctx, replayID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && s.Config.Cloud.Mode && call.OrgID != principal.OrgID) {
+		http.Error(w, "replay not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if call.InboxID != "" && !principal.CanAccessInbox(call.InboxID) {
+		http.Error(w, "inbox is not allowed for this credential", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := s.Tools.Store.RedactToolCallReplay(ctx, principal.OrgID, replayID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	switch {
+	case call.RedactedAt.Valid:
+		http.Error(w, "the call's payloads were redacted", http.StatusGone)
+		return
+	case call.Inputs == nil:
+		http.Error(w, "the call's arguments were not stored", http.StatusConflict)
+		return
+	case hasRedactedValue(decodePayload(call.Inputs)):
+		http.Error(w, "the call's arguments have redacted fields", http.StatusConflict)
+		return
+	}
+	params := ToolCallParams{Name: call.ToolName, Arguments: call.Inputs}
+	if s.scopesEnforced(principal) {
+		raw, _ := json.Marshal(params)
+		if err := s.Auth.ValidateScopes(principal, s.requiredScope(Request{Method: "tools/call", Params: raw})); err != nil {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+	}
+	if !s.Config.Cloud.Mode {
+		// Self-hosted calls carry no principal; replay them as the org that
+		// owns their inbox, the default one.
+		orgID := call.OrgID
+		if orgID == "" {
+			if orgID, err = s.Tools.Store.EnsureDefaultOrg(ctx); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		principal = auth.Principal{OrgID: orgID, ActorID: "replay", AuthMethod: "replay"}
+	}
+
+	exec, err := s.toolExecutor(s.Tools, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, callErr := exec(store.WithDryRun(auth.WithPrincipal(ctx, principal)))
+	replayed := decodePayload(s.redactPayload(result))
+	original := decodePayload(call.Outputs)
+	var changes []replayChange
+	diffPayloads("", withoutCallIDs(original), withoutCallIDs(replayed), &changes)
+
+	resp := map[string]any{
+		"replay_id": replayID,
+		"tool_name": call.ToolName,
+		"dry_run":   true,
+		"original":  original,
+		"replayed":  replayed,
+		"changed":   len(changes) > 0,
+		"diff":      changes,
+	}
+	if callErr != nil {
+		resp["error"] = callErr.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// redactPayload encodes a tool call's arguments or result for its audit
+// entry, with the values of mcp.redact_fields replaced.
+func (s *Server) redactPayload(value any) json.RawMessage {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	if len(s.Config.MCP.RedactFields) == 0 {
+		return raw
+	}
+	decoded := decodePayload(raw)
+	redactFields(decoded, s.Config.MCP.RedactFields)
+	raw, err = json.Marshal(decoded)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
+
+func redactFields(value any, fields []string) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if slices.Contains(fields, key) {
+				v[key] = redactedValue
+				continue
+			}
+			redactFields(item, fields)
+		}
+	case []any:
+		for _, item := range v {
+			redactFields(item, fields)
+		}
+	}
+}
+
+func hasRedactedValue(value any) bool {
+	switch v := value.(type) {
+	case map[string]any:
+		for _, item := range v {
+			if hasRedactedValue(item) {
+				return true
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if hasRedactedValue(item) {
+				return true
+			}
+		}
+	case string:
+		return v == redactedValue
+	}
+	return false
+}
+
+// decodePayload decodes stored JSON generically so results compare field
+// by field; invalid JSON decodes to nil.
+func decodePayload(raw json.RawMessage) any {
+	var value any
+	if len(raw) == 0 || json.Unmarshal(raw, &value) != nil {
+		return nil
+	}
+	return value
+}
+
+// withoutCallIDs drops the ids every call's result carries and no replay
+// can reproduce.
+func withoutCallIDs(value any) any {
+	m, ok := value.(map[string]any)
+	if !ok {
+		return value
+	}
+	out := make(map[string]any, len(m))
+	for key, item := range m {
+		if key != "replay_id" && key != "audit_id" {
+			out[key] = item
+		}
+	}
+	return out
+}
+
+// diffPayloads appends to out every leaf where before and after differ.
+func diffPayloads(path string, before, after any, out *[]replayChange) {
+	switch b := before.(type) {
+	case map[string]any:
+		a, ok := after.(map[string]any)
+		if !ok {
+			*out = append(*out, replayChange{Path: path, Before: before, After: after})
+			return
+		}
+		keys := make([]string, 0, len(b)+len(a))
+		for key := range b {
+			keys = append(keys, key)
+		}
+		for key := range a {
+			if _, seen := b[key]; !seen {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := key
+			if path != "" {
+				child = path + "." + key
+			}
+			diffPayloads(child, b[key], a[key], out)
+		}
+	case []any:
+		a, ok := after.([]any)
+		if !ok {
+			*out = append(*out, replayChange{Path: path, Before: before, After: after})
+			return
+		}
+		for i := 0; i < max(len(a), len(b)); i++ {
+			var bi, ai any
+			if i < len(b) {
+				bi = b[i]
+			}
+			if i < len(a) {
+				ai = a[i]
+			}
+			diffPayloads(fmt.Sprintf("%s[%d]", path, i), bi, ai, out)
+		}
+	default:
+		if !reflect.DeepEqual(before, after) {
+			*out = append(*out, replayChange{Path: path, Before: before, After: after})
+		}
+	}
+}
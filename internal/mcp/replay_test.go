@@ -0,0 +1,65 @@
+package mcp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedactPayloadReplacesConfiguredFieldsAtAnyDepth(t *testing.T) {
+	server := newVersionTestServer()
+	server.Config.MCP.RedactFields = []string{"body", "to"}
+
+	raw := server.redactPayload(map[string]any{
+		"inbox_id": "inbox-1",
+		"body":     "secret",
+		"drafts":   []any{map[string]any{"to": "a@example.com", "subject": "hi"}},
+	})
+	var got map[string]any
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got["body"] != redactedValue || got["inbox_id"] != "inbox-1" {
+		t.Fatalf("unexpected top level: %v", got)
+	}
+	draft := got["drafts"].([]any)[0].(map[string]any)
+	if draft["to"] != redactedValue || draft["subject"] != "hi" {
+		t.Fatalf("unexpected nested draft: %v", draft)
+	}
+	if !hasRedactedValue(decodePayload(raw)) {
+		t.Fatalf("expected redacted payload to be detected")
+	}
+}
+
+func TestDiffPayloadsIgnoresCallIDs(t *testing.T) {
+	before := decodePayload(json.RawMessage(`{"replay_id":"r1","audit_id":"a1","labels":["billing"],"score":0.4}`))
+	after := decodePayload(json.RawMessage(`{"replay_id":"r2","labels":["billing","urgent"],"score":0.9}`))
+
+	var changes []replayChange
+	diffPayloads("", withoutCallIDs(before), withoutCallIDs(after), &changes)
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %+v", changes)
+	}
+	if changes[0].Path != "labels[1]" || changes[0].Before != nil || changes[0].After != "urgent" {
+		t.Fatalf("unexpected labels change: %+v", changes[0])
+	}
+	if changes[1].Path != "score" {
+		t.Fatalf("unexpected score change: %+v", changes[1])
+	}
+}
+
+func TestReplayRejectsOtherMethodsAndMissingID(t *testing.T) {
+	server := newVersionTestServer()
+
+	rec := httptest.NewRecorder()
+	server.HandleReplay(rec, httptest.NewRequest(http.MethodGet, "/v1/replays/abc", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for GET, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	server.HandleReplay(rec, httptest.NewRequest(http.MethodPost, "/v1/replays/", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a replay id, got %d", rec.Code)
+	}
+}
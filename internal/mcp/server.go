@@ -3,21 +3,24 @@ package mcp
 import (
 	"context"
 	"crypto/sha256"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/google/uuid"
-
 	"neuralmail/internal/auth"
+	"neuralmail/internal/canary"
 	"neuralmail/internal/config"
 	"neuralmail/internal/entitlements"
+	"neuralmail/internal/llm"
 	"neuralmail/internal/observability"
+	"neuralmail/internal/outbox"
+	"neuralmail/internal/policy"
+	"neuralmail/internal/store"
 	"neuralmail/internal/tools"
 )
 
@@ -31,16 +34,22 @@ type Server struct {
 	Auth         *auth.Service
 	Entitlements EntitlementGate
 	Tools        *tools.Service
-	mu           sync.Mutex
-	sessions     map[string]time.Time
+	Canary       *tools.Service
+	Router       *canary.Router
+	Sessions     SessionStore
+	Live         SessionCache
+	// Playground, when set, serves HandlePlayground.
+	Playground *Playground
+
+	drain drain
 }
 
 func NewServer(cfg config.Config, toolsSvc *tools.Service, authSvc *auth.Service, entitlementSvc EntitlementGate) *Server {
-	return &Server{Config: cfg, Auth: authSvc, Entitlements: entitlementSvc, Tools: toolsSvc, sessions: make(map[string]time.Time)}
+	return &Server{Config: cfg, Auth: authSvc, Entitlements: entitlementSvc, Tools: toolsSvc, Live: newMemorySessions()}
 }
 
 func (s *Server) HandleHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
@@ -48,7 +57,7 @@ func (s *Server) HandleHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
-	log.Printf("mcp request protocol_version=%q", strings.TrimSpace(r.Header.Get("MCP-Protocol-Version")))
+	slog.DebugContext(r.Context(), "mcp request", "protocol_version", strings.TrimSpace(r.Header.Get("MCP-Protocol-Version")))
 
 	ctx := r.Context()
 	var principal auth.Principal
@@ -65,13 +74,40 @@ func (s *Server) HandleHTTP(w http.ResponseWriter, r *http.Request) {
 		principal = authenticated
 		ctx = auth.WithPrincipal(ctx, authenticated)
 	}
+	s.serve(ctx, w, r, principal)
+}
+
+// serve handles an MCP request from an authenticated principal, empty
+// outside cloud mode.
+func (s *Server) serve(ctx context.Context, w http.ResponseWriter, r *http.Request, principal auth.Principal) {
+	if sessionID := r.Header.Get("MCP-Session-Id"); sessionID != "" {
+		ctx = observability.WithLogAttrs(ctx, "session_id", sessionID)
+	}
+	ctx = entitlements.WithClientIP(ctx, clientIP(r))
+	if r.Method == http.MethodDelete {
+		s.handleCloseSession(ctx, w, r, principal)
+		return
+	}
 
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if isBatch(raw) {
+		if principal.AuthMethod == playgroundAuthMethod {
+			writeError(w, nil, -32600, "Invalid Request: batches are not supported in the playground")
+			return
+		}
+		s.handleBatch(ctx, w, r, principal, raw)
+		return
+	}
 	var req Request
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.Unmarshal(raw, &req); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
-	if s.Config.Cloud.Mode {
+	if s.scopesEnforced(principal) {
 		requiredScope := s.requiredScope(req)
 		if requiredScope != "" {
 			if err := s.Auth.ValidateScopes(principal, requiredScope); err != nil {
@@ -81,29 +117,62 @@ func (s *Server) HandleHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	sessionID := r.Header.Get("MCP-Session-Id")
-	if req.Method != "initialize" {
-		if !s.isSessionValid(sessionID) {
-			writeError(w, req.ID, -32000, "missing or invalid MCP-Session-Id")
+	var version string
+	if req.Method == "initialize" {
+		negotiated, err := s.negotiateVersion(req.Params)
+		if err != nil {
+			s.writeDispatchError(w, req.ID, err)
+			return
+		}
+		version = negotiated
+	} else {
+		sess, err := s.resumeSession(ctx, sessionID, principal)
+		if err != nil {
+			s.writeDispatchError(w, req.ID, err)
+			return
+		}
+		version = sess.Version
+		if err := s.checkVersionHeader(r, version); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 	}
+	ctx = withProtocolVersion(ctx, version)
 	result, err := s.dispatch(ctx, req)
 	if err != nil {
 		s.writeDispatchError(w, req.ID, err)
 		return
 	}
 	if req.Method == "initialize" {
-		if sessionID == "" {
-			sessionID = s.newSession()
+		sessionID, err = s.startSession(ctx, sessionID, version, principal, req.Params, r.RemoteAddr)
+		if err != nil {
+			s.writeDispatchError(w, req.ID, err)
+			return
 		}
 		w.Header().Set("MCP-Session-Id", sessionID)
 	}
-	w.Header().Set("MCP-Protocol-Version", s.Config.MCP.ProtocolVersion)
+	w.Header().Set("MCP-Protocol-Version", s.advertisedVersion(version))
 	w.Header().Set("Content-Type", "application/json")
 	resp := Response{JSONRPC: "2.0", ID: req.ID, Result: result}
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
+// checkVersionHeader validates the MCP-Protocol-Version header of a request
+// on a session negotiated at version.
+func (s *Server) checkVersionHeader(r *http.Request, version string) error {
+	header := strings.TrimSpace(r.Header.Get("MCP-Protocol-Version"))
+	if header == "" {
+		return nil
+	}
+	if !s.supportsVersion(header) {
+		return errors.New("unsupported MCP-Protocol-Version " + header)
+	}
+	if version != "" && header != version {
+		return errors.New("MCP-Protocol-Version does not match the negotiated version " + version)
+	}
+	return nil
+}
+
 func (s *Server) HandleSSEStub(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain")
 	w.WriteHeader(http.StatusNotImplemented)
@@ -113,21 +182,15 @@ func (s *Server) HandleSSEStub(w http.ResponseWriter, r *http.Request) {
 func (s *Server) dispatch(ctx context.Context, req Request) (any, error) {
 	switch req.Method {
 	case "initialize":
-		return map[string]any{
-			"protocolVersion": s.Config.MCP.ProtocolVersion,
-			"serverInfo": map[string]any{
-				"name":    "neuralmaild",
-				"version": "0.1.0",
-			},
-			"capabilities": map[string]any{
-				"tools":     true,
-				"resources": true,
-			},
-		}, nil
+		return s.initializeResult(protocolVersionFrom(ctx)), nil
 	case "tools/list":
-		return ListTools(), nil
+		return ListTools(protocolVersionFrom(ctx)), nil
 	case "tools/call":
-		return s.callTool(ctx, req)
+		result, err := s.callTool(ctx, req)
+		if err != nil {
+			return result, err
+		}
+		return toolResultFor(protocolVersionFrom(ctx), result), nil
 	case "resources/list":
 		return ListResources(), nil
 	case "resources/read":
@@ -142,14 +205,20 @@ func (s *Server) callTool(ctx context.Context, req Request) (any, error) {
 	if err := decodeParams(req.Params, &params); err != nil {
 		return nil, err
 	}
+	if !s.beginCall() {
+		return nil, ErrShuttingDown
+	}
+	defer s.endCall()
 	start := time.Now()
 	inputsHash := hashJSON(params.Arguments)
 	replayID := observability.NewReplayID()
+	ctx = observability.WithLogAttrs(ctx, "tool", params.Name, "replay_id", replayID)
 
 	var reservation *entitlements.Reservation
-	if s.Config.Cloud.Mode && s.Entitlements != nil {
-		principal, ok := auth.PrincipalFromContext(ctx)
-		if !ok {
+	principal, ok := auth.PrincipalFromContext(ctx)
+	// Playground calls are held to the playground's own rate limit instead.
+	if s.entitlementsEnforced() && principal.AuthMethod != playgroundAuthMethod {
+		if !ok && s.Config.Cloud.Mode {
 			return nil, errors.New("missing cloud principal")
 		}
 		reserved, err := s.Entitlements.PreAuthorizeTool(ctx, principal, params.Name, replayID)
@@ -159,14 +228,24 @@ func (s *Server) callTool(ctx context.Context, req Request) (any, error) {
 		reservation = reserved
 	}
 
-	exec, err := s.toolExecutor(params)
+	svc, variant := s.toolsFor(ctx, params.Name)
+	exec, err := s.toolExecutor(svc, params)
 	if err != nil {
 		return nil, err
 	}
 
+	ctx, promptRef := svc.WithPromptTemplate(ctx, params.Name)
+	ctx, models := llm.WithCallLog(ctx)
 	result, callErr := exec(ctx)
+	if s.Router.Covers(params.Name) {
+		s.recordCanaryMetric(ctx, params.Name, variant, result, callErr, start)
+	}
 	result = attachReplayID(result, replayID)
-	auditID := s.recordToolCall(ctx, params.Name, inputsHash, result, start, replayID)
+	// The call has run and its reservation is held, so its audit entry and
+	// usage are settled even if the client hangs up or the server is
+	// shutting down.
+	ctx = context.WithoutCancel(ctx)
+	auditID := s.recordToolCall(ctx, svc, params, inputsHash, result, start, replayID, promptRef, models)
 	result = attachAuditID(result, auditID)
 
 	if reservation != nil && s.Entitlements != nil {
@@ -174,6 +253,8 @@ func (s *Server) callTool(ctx context.Context, req Request) (any, error) {
 		if callErr != nil {
 			status = "failed"
 		}
+		reservation.Extra = extraUnits(result)
+		reservation.Cached = cacheHit(result)
 		if err := s.Entitlements.FinalizeToolExecution(ctx, *reservation, params.Name, replayID, auditID, status); err != nil {
 			return result, err
 		}
@@ -182,123 +263,365 @@ func (s *Server) callTool(ctx context.Context, req Request) (any, error) {
 	return result, callErr
 }
 
-func (s *Server) toolExecutor(params ToolCallParams) (func(context.Context) (any, error), error) {
+// entitlementsEnforced reports whether tool calls go through the entitlement
+// gate: always in cloud mode, and in self-hosted mode when local limits are on.
+func (s *Server) entitlementsEnforced() bool {
+	if s.Entitlements == nil {
+		return false
+	}
+	return s.Config.Cloud.Mode || s.Config.Entitlements.LocalMode
+}
+
+// scopesEnforced reports whether principal's scopes gate its requests:
+// always in cloud mode, and for playground sessions everywhere.
+func (s *Server) scopesEnforced(principal auth.Principal) bool {
+	return s.Config.Cloud.Mode || principal.AuthMethod == playgroundAuthMethod
+}
+
+// toolsFor returns the tool build that should serve this call and the name of
+// its variant. Canary and Router stay nil unless a canary is configured.
+func (s *Server) toolsFor(ctx context.Context, toolName string) (*tools.Service, string) {
+	if s.Canary == nil || !s.Router.Covers(toolName) {
+		return s.Tools, canary.Stable
+	}
+	principal, _ := auth.PrincipalFromContext(ctx)
+	if s.Router.Variant(ctx, principal.OrgID, toolName) == canary.Canary {
+		return s.Canary, canary.Canary
+	}
+	return s.Tools, canary.Stable
+}
+
+func (s *Server) recordCanaryMetric(ctx context.Context, toolName string, variant string, result any, callErr error, start time.Time) {
+	if s.Tools == nil || s.Tools.Store == nil {
+		return
+	}
+	principal, _ := auth.PrincipalFromContext(ctx)
+	outcome := canary.OutcomeFromResult(result)
+	_ = s.Tools.Store.RecordCanaryMetric(ctx, store.CanaryMetric{
+		OrgID:         principal.OrgID,
+		ToolName:      toolName,
+		Variant:       variant,
+		LatencyMS:     int(time.Since(start).Milliseconds()),
+		Success:       callErr == nil,
+		PolicyBlocked: outcome.PolicyBlocked,
+		NeedsApproval: outcome.NeedsApproval,
+	})
+}
+
+func (s *Server) toolExecutor(svc *tools.Service, params ToolCallParams) (func(context.Context) (any, error), error) {
 	switch params.Name {
 	case "list_threads":
-		var input struct {
-			InboxID string `json:"inbox_id"`
-			Status  string `json:"status"`
-			Limit   int    `json:"limit"`
-		}
+		var input listThreadsInput
 		if err := json.Unmarshal(params.Arguments, &input); err != nil {
 			return nil, err
 		}
 		return func(ctx context.Context) (any, error) {
-			return s.Tools.ListThreads(ctx, input.InboxID, input.Status, input.Limit)
+			return svc.ListThreads(ctx, input.InboxID, input.Status, input.AwaitingReply, input.Cursor, input.Limit)
 		}, nil
 	case "get_thread":
-		var input struct {
-			ThreadID string `json:"thread_id"`
-		}
+		var input getThreadInput
 		if err := json.Unmarshal(params.Arguments, &input); err != nil {
 			return nil, err
 		}
 		return func(ctx context.Context) (any, error) {
-			return s.Tools.GetThread(ctx, input.ThreadID)
+			return svc.GetThread(ctx, input.ThreadID, input.Cursor, input.Limit)
 		}, nil
 	case "search_inbox":
-		var input struct {
-			InboxID string `json:"inbox_id"`
-			Query   string `json:"query"`
-			TopK    int    `json:"top_k"`
+		var input searchInboxInput
+		if err := json.Unmarshal(params.Arguments, &input); err != nil {
+			return nil, err
 		}
+		return func(ctx context.Context) (any, error) {
+			return svc.SearchInbox(ctx, input.InboxID, input.Query, input.TopK, input.Direction, input.Mode)
+		}, nil
+	case "search_org":
+		var input searchOrgInput
 		if err := json.Unmarshal(params.Arguments, &input); err != nil {
 			return nil, err
 		}
 		return func(ctx context.Context) (any, error) {
-			return s.Tools.SearchInbox(ctx, input.InboxID, input.Query, input.TopK)
+			return svc.SearchOrg(ctx, input.Query, input.TopK, input.Direction, input.InboxIDs)
 		}, nil
 	case "triage_message":
-		var input struct {
-			MessageID string `json:"message_id"`
+		var input triageMessageInput
+		if err := json.Unmarshal(params.Arguments, &input); err != nil {
+			return nil, err
 		}
+		return func(ctx context.Context) (any, error) {
+			return svc.TriageMessage(ctx, input.MessageID, input.BypassCache)
+		}, nil
+	case "translate_message":
+		var input translateMessageInput
 		if err := json.Unmarshal(params.Arguments, &input); err != nil {
 			return nil, err
 		}
 		return func(ctx context.Context) (any, error) {
-			return s.Tools.TriageMessage(ctx, input.MessageID)
+			return svc.TranslateMessage(ctx, input.MessageID, input.TargetLanguage)
 		}, nil
-	case "extract_to_schema":
-		var input struct {
-			MessageID string `json:"message_id"`
-			SchemaID  string `json:"schema_id"`
+	case "translate_thread":
+		var input translateThreadInput
+		if err := json.Unmarshal(params.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) (any, error) {
+			return svc.TranslateThread(ctx, input.ThreadID, input.TargetLanguage)
+		}, nil
+	case "summarize_thread":
+		var input summarizeThreadInput
+		if err := json.Unmarshal(params.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) (any, error) {
+			return svc.SummarizeThread(ctx, input.ThreadID, input.Refresh)
+		}, nil
+	case "get_contact_profile":
+		var input getContactProfileInput
+		if err := json.Unmarshal(params.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) (any, error) {
+			return svc.GetContactProfile(ctx, input.Email, input.ContactID)
+		}, nil
+	case "link_thread_to_crm":
+		var input linkThreadToCRMInput
+		if err := json.Unmarshal(params.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) (any, error) {
+			return svc.LinkThreadToCRM(ctx, input.ThreadID, input.TicketID, input.Kind)
+		}, nil
+	case "get_crm_context":
+		var input getCRMContextInput
+		if err := json.Unmarshal(params.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) (any, error) {
+			return svc.GetCRMContext(ctx, input.ThreadID, input.Email)
+		}, nil
+	case "bulk_update_threads":
+		var input tools.BulkThreadRequest
+		if err := json.Unmarshal(params.Arguments, &input); err != nil {
+			return nil, err
 		}
+		return func(ctx context.Context) (any, error) {
+			return svc.BulkUpdateThreads(ctx, input)
+		}, nil
+	case "extract_to_schema":
+		var input extractToSchemaInput
 		if err := json.Unmarshal(params.Arguments, &input); err != nil {
 			return nil, err
 		}
 		return func(ctx context.Context) (any, error) {
-			return s.Tools.ExtractToSchema(ctx, input.MessageID, input.SchemaID)
+			return svc.ExtractToSchema(ctx, input.MessageID, input.SchemaID, input.BypassCache)
 		}, nil
 	case "draft_reply_with_policy":
-		var input struct {
-			ThreadID string `json:"thread_id"`
-			Goal     string `json:"goal"`
+		var input draftReplyInput
+		if err := json.Unmarshal(params.Arguments, &input); err != nil {
+			return nil, err
+		}
+		knowledge := make([]tools.KnowledgeChunk, 0, len(input.Knowledge))
+		for _, chunk := range input.Knowledge {
+			knowledge = append(knowledge, tools.KnowledgeChunk{ID: chunk.ID, Text: chunk.Text})
 		}
+		return func(ctx context.Context) (any, error) {
+			return svc.DraftReplyWithKnowledge(ctx, input.ThreadID, input.Goal, knowledge)
+		}, nil
+	case "update_draft":
+		var input updateDraftInput
 		if err := json.Unmarshal(params.Arguments, &input); err != nil {
 			return nil, err
 		}
 		return func(ctx context.Context) (any, error) {
-			return s.Tools.DraftReply(ctx, input.ThreadID, input.Goal)
+			return svc.UpdateDraft(ctx, input.DraftID, input.Body)
 		}, nil
-	case "send_reply":
-		var input struct {
-			ThreadID      string `json:"thread_id"`
-			Body          string `json:"body_or_draft_id"`
-			NeedsApproval bool   `json:"needs_human_approval"`
+	case "get_draft_history":
+		var input getDraftHistoryInput
+		if err := json.Unmarshal(params.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) (any, error) {
+			return svc.GetDraftHistory(ctx, input.DraftID)
+		}, nil
+	case "list_pending_drafts":
+		var input listPendingDraftsInput
+		if err := json.Unmarshal(params.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) (any, error) {
+			return svc.ListPendingDrafts(ctx, input.Limit)
+		}, nil
+	case "approve_draft":
+		var input approveDraftInput
+		if err := json.Unmarshal(params.Arguments, &input); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) (any, error) {
+			return svc.ApproveDraft(ctx, input.DraftID, input.Revision, input.Note)
+		}, nil
+	case "reject_draft":
+		var input rejectDraftInput
+		if err := json.Unmarshal(params.Arguments, &input); err != nil {
+			return nil, err
 		}
+		return func(ctx context.Context) (any, error) {
+			return svc.RejectDraft(ctx, input.DraftID, input.Reason)
+		}, nil
+	case "send_reply":
+		var input sendReplyInput
 		if err := json.Unmarshal(params.Arguments, &input); err != nil {
 			return nil, err
 		}
 		return func(ctx context.Context) (any, error) {
-			return s.Tools.SendReply(ctx, input.ThreadID, input.Body, input.NeedsApproval)
+			return svc.SendReply(ctx, input.ThreadID, input.Body, input.NeedsApproval)
 		}, nil
 	case "compose_email":
-		var input struct {
-			InboxID string `json:"inbox_id"`
-			To      string `json:"to"`
-			Subject string `json:"subject"`
-			Body    string `json:"body"`
+		var input composeEmailInput
+		if err := json.Unmarshal(params.Arguments, &input); err != nil {
+			return nil, err
 		}
+		return func(ctx context.Context) (any, error) {
+			return svc.ComposeEmail(ctx, input.InboxID, input.To, input.Subject, input.Body)
+		}, nil
+	case "get_delivery_status":
+		var input getDeliveryStatusInput
 		if err := json.Unmarshal(params.Arguments, &input); err != nil {
 			return nil, err
 		}
 		return func(ctx context.Context) (any, error) {
-			return s.Tools.ComposeEmail(ctx, input.InboxID, input.To, input.Subject, input.Body)
+			return svc.GetDeliveryStatus(ctx, input.MessageID)
 		}, nil
 	default:
 		return nil, fmt.Errorf("unknown tool: %s", params.Name)
 	}
 }
 
-func (s *Server) recordToolCall(ctx context.Context, toolName string, inputsHash string, result any, start time.Time, replayID string) string {
-	if s.Tools == nil || s.Tools.Store == nil {
+// recordToolCall notes the call in tool_calls and the audit log. promptRef
+// names the org's prompt template the call ran with; calls on the built-in
+// prompts record the deployment's prompt path instead.
+func (s *Server) recordToolCall(ctx context.Context, svc *tools.Service, params ToolCallParams, inputsHash string, result any, start time.Time, replayID, promptRef string, models *llm.CallLog) string {
+	if svc == nil || svc.Store == nil {
 		return ""
 	}
 	outputsHash := hashJSON(result)
 	latency := int(time.Since(start).Milliseconds())
 	modelName := ""
-	promptVersion := s.Tools.Config.LLM.PromptPath
-	if s.Tools.LLM != nil {
-		modelName = s.Tools.LLM.Name()
+	promptVersion := promptRef
+	if promptVersion == "" {
+		promptVersion = svc.Current().PromptPath
+	}
+	if svc.LLM != nil {
+		modelName = svc.LLM.Name()
 	}
-	toolCallID, err := s.Tools.Store.RecordToolCall(ctx, toolName, "", modelName, promptVersion, latency)
+	toolCallID, err := svc.Store.RecordToolCall(ctx, params.Name, "", modelName, promptVersion, latency)
 	if err != nil {
 		return ""
 	}
-	_ = s.Tools.Store.RecordAudit(ctx, toolCallID, "mcp", inputsHash, outputsHash, replayID)
+	rec := store.AuditRecord{
+		ToolCallID:       toolCallID,
+		InboxID:          argumentInboxID(params.Arguments),
+		Actor:            "mcp",
+		InputsHash:       inputsHash,
+		OutputsHash:      outputsHash,
+		ReplayID:         replayID,
+		PolicyRuleIDs:    policyRuleIDs(result),
+		CitationCoverage: citationCoverage(result),
+	}
+	if principal, ok := auth.PrincipalFromContext(ctx); ok {
+		rec.OrgID = principal.OrgID
+		if principal.ActorID != "" {
+			rec.Actor = principal.ActorID
+		}
+	}
+	if s.Config.MCP.StoreToolPayloads {
+		rec.Inputs = s.redactPayload(params.Arguments)
+		rec.Outputs = s.redactPayload(result)
+	}
+	_ = svc.Store.RecordAudit(ctx, rec)
+	if calls := models.Calls(); len(calls) > 0 {
+		_ = svc.Store.RecordToolCallModels(ctx, toolCallID, summarizeModelCalls(calls))
+	}
 	return toolCallID
 }
 
+// argumentInboxID is the inbox_id a tool call names, if any, which its audit
+// entry is filed under.
+func argumentInboxID(arguments json.RawMessage) string {
+	var args struct {
+		InboxID string `json:"inbox_id"`
+	}
+	_ = json.Unmarshal(arguments, &args)
+	return args.InboxID
+}
+
+// summarizeModelCalls folds the model calls behind a tool call into its
+// metrics. The model credited is the last one that answered, or the last one
+// tried if none did.
+func summarizeModelCalls(calls []llm.Call) store.ToolCallModels {
+	var m store.ToolCallModels
+	credited := false
+	for _, call := range calls {
+		m.Calls++
+		m.Tokens += call.Tokens
+		m.PromptTokens += call.PromptTokens
+		m.CompletionTokens += call.CompletionTokens
+		m.CostUSD += call.CostUSD
+		if call.Fallback {
+			m.Fallbacks++
+		}
+		if call.Err != nil {
+			m.Errors++
+		}
+		if call.Err == nil || !credited {
+			m.Model, m.Task = call.Model, call.Task
+			credited = call.Err == nil
+		}
+	}
+	return m
+}
+
+// policyRuleIDs lists the policy rules a tool result reports as fired.
+func policyRuleIDs(result any) []string {
+	data, ok := result.(map[string]any)
+	if !ok {
+		return nil
+	}
+	matches, _ := data["policy_rules"].([]policy.Match)
+	ids := make([]string, 0, len(matches))
+	for _, match := range matches {
+		ids = append(ids, match.RuleID)
+	}
+	return ids
+}
+
+// citationCoverage reads the citation coverage a draft result reports.
+func citationCoverage(result any) sql.NullFloat64 {
+	data, ok := result.(map[string]any)
+	if !ok {
+		return sql.NullFloat64{}
+	}
+	coverage, ok := data["citation_coverage"].(float64)
+	return sql.NullFloat64{Float64: coverage, Valid: ok}
+}
+
+// extraUnits reads the units a tool result reports beyond the tool's base
+// cost; today only search_inbox re-ranking adds any.
+func extraUnits(result any) int64 {
+	data, ok := result.(map[string]any)
+	if !ok {
+		return 0
+	}
+	summary, _ := data["rerank"].(map[string]any)
+	units, _ := summary["units"].(int64)
+	return units
+}
+
+// cacheHit reports whether the tool answered from the model response cache.
+func cacheHit(result any) bool {
+	data, _ := result.(map[string]any)
+	cached, _ := data["cached"].(bool)
+	return cached
+}
+
 func hashJSON(value any) string {
 	data, err := json.Marshal(value)
 	if err != nil {
@@ -335,37 +658,18 @@ func (s *Server) readResource(ctx context.Context, req Request) (any, error) {
 	if err := decodeParams(req.Params, &params); err != nil {
 		return nil, err
 	}
-	principal, hasPrincipal := auth.PrincipalFromContext(ctx)
 	switch {
 	case params.URI == "email://inboxes":
-		var (
-			ids []string
-			err error
-		)
-		if hasPrincipal {
-			ids, err = s.Tools.Store.ListInboxesByOrg(ctx, principal.OrgID)
-		} else {
-			ids, err = s.Tools.Store.ListInboxes(ctx)
-		}
-		if err != nil {
-			return nil, err
-		}
-		return map[string]any{"inbox_ids": ids}, nil
+		return s.Tools.ListInboxIDs(ctx)
+	case strings.HasPrefix(params.URI, "email://inboxes/"):
+		return s.readInboxThreadsResource(ctx, params.URI)
 	case strings.HasPrefix(params.URI, "email://threads/"):
-		threadID := strings.TrimPrefix(params.URI, "email://threads/")
-		return s.Tools.GetThread(ctx, threadID)
+		return s.readThreadResource(ctx, params.URI)
 	case strings.HasPrefix(params.URI, "email://messages/"):
 		messageID := strings.TrimPrefix(params.URI, "email://messages/")
-		if hasPrincipal {
-			if err := s.Tools.Store.EnsureMessageBelongsToOrg(ctx, messageID, principal.OrgID); err != nil {
-				return nil, err
-			}
-		}
-		msg, err := s.Tools.Store.GetMessage(ctx, messageID)
-		if err != nil {
-			return nil, err
-		}
-		return map[string]any{"message": msg}, nil
+		return s.Tools.GetMessage(ctx, messageID)
+	case params.URI == auditResourceURI || strings.HasPrefix(params.URI, auditResourceURI+"?"):
+		return s.readAuditResource(ctx, params.URI)
 	default:
 		return nil, fmt.Errorf("resource not found: %s", params.URI)
 	}
@@ -398,7 +702,13 @@ func (s *Server) validateOrigin(r *http.Request) error {
 
 func (s *Server) requiredScope(req Request) string {
 	switch req.Method {
-	case "initialize", "tools/list", "resources/list", "resources/read":
+	case "resources/read":
+		var params ResourceReadParams
+		if err := decodeParams(req.Params, &params); err == nil && strings.HasPrefix(params.URI, auditResourceURI) {
+			return "nerve:audit.read"
+		}
+		return "nerve:email.read"
+	case "initialize", "tools/list", "resources/list":
 		return "nerve:email.read"
 	case "tools/call":
 		var params ToolCallParams
@@ -406,14 +716,20 @@ func (s *Server) requiredScope(req Request) string {
 			return "nerve:email.read"
 		}
 		switch params.Name {
-		case "list_threads", "get_thread":
+		case "list_threads", "get_thread", "translate_message", "translate_thread", "summarize_thread", "get_contact_profile", "get_crm_context", "get_draft_history", "list_pending_drafts", "get_delivery_status":
 			return "nerve:email.read"
 		case "search_inbox":
 			return "nerve:email.search"
-		case "triage_message", "extract_to_schema", "draft_reply_with_policy":
+		case "search_org":
+			return "nerve:email.search.org"
+		case "triage_message", "extract_to_schema", "draft_reply_with_policy", "update_draft":
 			return "nerve:email.draft"
+		case "approve_draft", "reject_draft":
+			return "nerve:email.draft.review"
 		case "send_reply", "compose_email":
 			return "nerve:email.send"
+		case "bulk_update_threads", "link_thread_to_crm":
+			return "nerve:email.manage"
 		default:
 			return "nerve:email.read"
 		}
@@ -423,41 +739,76 @@ func (s *Server) requiredScope(req Request) string {
 }
 
 func (s *Server) writeDispatchError(w http.ResponseWriter, id any, err error) {
+	rpcErr := dispatchError(err)
+	writeErrorWithData(w, id, rpcErr.Code, rpcErr.Message, rpcErr.Data)
+}
+
+// dispatchError maps a handling error to its JSON-RPC error object.
+func dispatchError(err error) *ResponseError {
 	var rateErr *entitlements.RateLimitError
+	var localErr *entitlements.LocalLimitError
+	var versionErr *UnsupportedVersionError
+	var endedErr *SessionEndedError
+	var budgetErr *llm.BudgetError
+	var sendErr *outbox.SendLimitError
 	switch {
 	case errors.Is(err, entitlements.ErrQuotaExceeded):
-		writeErrorWithData(w, id, -32040, "quota_exceeded", map[string]any{"retryable": false})
+		return &ResponseError{Code: -32040, Message: "quota_exceeded", Data: map[string]any{"retryable": false}}
+	case errors.Is(err, entitlements.ErrTrialExpired):
+		return &ResponseError{Code: -32045, Message: "trial_expired", Data: map[string]any{"retryable": false, "upgrade": true}}
 	case errors.Is(err, entitlements.ErrSubscriptionInactive):
-		writeErrorWithData(w, id, -32041, "subscription_inactive", map[string]any{"retryable": false})
+		return &ResponseError{Code: -32041, Message: "subscription_inactive", Data: map[string]any{"retryable": false}}
+	case errors.As(err, &localErr):
+		return &ResponseError{Code: -32044, Message: "local_limit_exceeded", Data: map[string]any{
+			"retryable":           localErr.RetryAfterSeconds > 0,
+			"retry_after_seconds": localErr.RetryAfterSeconds,
+			"limit":               localErr.Limit,
+			"configured_limit":    localErr.Configured,
+		}}
 	case errors.As(err, &rateErr):
-		writeErrorWithData(w, id, -32042, "rate_limited", map[string]any{
+		data := map[string]any{
 			"retryable":           true,
 			"retry_after_seconds": rateErr.RetryAfterSeconds,
-		})
+		}
+		if rateErr.Dimension != "" {
+			data["limited_by"] = rateErr.Dimension
+		}
+		return &ResponseError{Code: -32042, Message: "rate_limited", Data: data}
+	case errors.As(err, &budgetErr):
+		data := map[string]any{
+			"retryable":        budgetErr.Limit == llm.BudgetDaily,
+			"limit":            budgetErr.Limit,
+			"budget_tokens":    budgetErr.Budget,
+			"requested_tokens": budgetErr.Requested,
+		}
+		if budgetErr.Limit == llm.BudgetDaily {
+			data["used_tokens"] = budgetErr.Used
+		}
+		return &ResponseError{Code: -32043, Message: "token_budget_exceeded", Data: data}
+	case errors.As(err, &sendErr):
+		data := map[string]any{
+			"retryable":           true,
+			"retry_after_seconds": sendErr.RetryAfterSeconds,
+			"limit":               sendErr.Limit,
+			"allowed":             sendErr.Allowed,
+			"used":                sendErr.Used,
+		}
+		if sendErr.Domain != "" {
+			data["domain"] = sendErr.Domain
+		}
+		return &ResponseError{Code: -32046, Message: "sending_limit_exceeded", Data: data}
+	case errors.Is(err, ErrShuttingDown):
+		return &ResponseError{Code: -32047, Message: "shutting_down", Data: map[string]any{"retryable": true}}
+	case errors.As(err, &endedErr):
+		return &ResponseError{Code: -32000, Message: "MCP session terminated", Data: map[string]any{"reason": endedErr.Reason}}
+	case errors.As(err, &versionErr):
+		return &ResponseError{Code: -32602, Message: "Unsupported protocol version", Data: map[string]any{
+			"requested": versionErr.Requested,
+			"supported": versionErr.Supported,
+		}}
 	default:
-		writeError(w, id, -32000, err.Error())
-	}
-}
-
-func (s *Server) newSession() string {
-	sessionID := uuid.NewString()
-	s.mu.Lock()
-	s.sessions[sessionID] = time.Now().Add(24 * time.Hour)
-	s.mu.Unlock()
-	return sessionID
-}
-
-func (s *Server) isSessionValid(id string) bool {
-	if id == "" {
-		return false
-	}
-	s.mu.Lock()
-	expiry, ok := s.sessions[id]
-	s.mu.Unlock()
-	if !ok {
-		return false
+		return &ResponseError{Code: -32000, Message: err.Error()}
 	}
-	return time.Now().Before(expiry)
 }
 
 func decodeParams(raw json.RawMessage, out any) error {
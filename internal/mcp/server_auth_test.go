@@ -112,3 +112,45 @@ func signedJWT(t *testing.T, claims jwtlib.MapClaims) string {
 	}
 	return signed
 }
+
+func TestSearchOrgRequiresOrgSearchScope(t *testing.T) {
+	server := NewServer(config.Default(), nil, nil, nil)
+	params, _ := json.Marshal(ToolCallParams{Name: "search_org"})
+	if scope := server.requiredScope(Request{Method: "tools/call", Params: params}); scope != "nerve:email.search.org" {
+		t.Fatalf("expected nerve:email.search.org, got %q", scope)
+	}
+	params, _ = json.Marshal(ToolCallParams{Name: "search_inbox"})
+	if scope := server.requiredScope(Request{Method: "tools/call", Params: params}); scope != "nerve:email.search" {
+		t.Fatalf("expected search_inbox to keep nerve:email.search, got %q", scope)
+	}
+}
+
+func TestAuditResourceRequiresAuditScope(t *testing.T) {
+	server := NewServer(config.Default(), nil, nil, nil)
+	for uri, want := range map[string]string{
+		"email://audit":                    "nerve:audit.read",
+		"email://audit?tool=send_reply":    "nerve:audit.read",
+		"email://inboxes":                  "nerve:email.read",
+		"email://messages/some-message-id": "nerve:email.read",
+	} {
+		params, _ := json.Marshal(ResourceReadParams{URI: uri})
+		if scope := server.requiredScope(Request{Method: "resources/read", Params: params}); scope != want {
+			t.Fatalf("expected %s to require %s, got %q", uri, want, scope)
+		}
+	}
+}
+
+func TestDraftReviewToolsRequireReviewScope(t *testing.T) {
+	server := NewServer(config.Default(), nil, nil, nil)
+	for tool, want := range map[string]string{
+		"approve_draft":       "nerve:email.draft.review",
+		"reject_draft":        "nerve:email.draft.review",
+		"list_pending_drafts": "nerve:email.read",
+		"update_draft":        "nerve:email.draft",
+	} {
+		params, _ := json.Marshal(ToolCallParams{Name: tool})
+		if scope := server.requiredScope(Request{Method: "tools/call", Params: params}); scope != want {
+			t.Fatalf("expected %s to require %s, got %q", tool, want, scope)
+		}
+	}
+}
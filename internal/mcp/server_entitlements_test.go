@@ -14,6 +14,8 @@ import (
 	"neuralmail/internal/auth"
 	"neuralmail/internal/config"
 	"neuralmail/internal/entitlements"
+	"neuralmail/internal/llm"
+	"neuralmail/internal/outbox"
 )
 
 type fakeEntitlementGate struct {
@@ -48,6 +50,20 @@ func TestSubscriptionErrorContract(t *testing.T) {
 	}
 }
 
+func TestTrialExpiredErrorContract(t *testing.T) {
+	resp := callToolWithEntitlementError(t, entitlements.ErrTrialExpired)
+	if resp.Error == nil {
+		t.Fatalf("expected trial-expired error response")
+	}
+	if resp.Error.Code != -32045 || resp.Error.Message != "trial_expired" {
+		t.Fatalf("unexpected trial-expired error: %#v", resp.Error)
+	}
+	data, ok := resp.Error.Data.(map[string]any)
+	if !ok || data["upgrade"] != true {
+		t.Fatalf("expected upgrade=true, got %#v", resp.Error.Data)
+	}
+}
+
 func TestRateLimitErrorContract(t *testing.T) {
 	resp := callToolWithEntitlementError(t, &entitlements.RateLimitError{RetryAfterSeconds: 12})
 	if resp.Error == nil {
@@ -65,6 +81,62 @@ func TestRateLimitErrorContract(t *testing.T) {
 	}
 }
 
+func TestRateLimitErrorReportsDimension(t *testing.T) {
+	resp := callToolWithEntitlementError(t, &entitlements.RateLimitError{RetryAfterSeconds: 3, Dimension: entitlements.LimitToken})
+	if resp.Error == nil || resp.Error.Code != -32042 {
+		t.Fatalf("expected rate-limit error, got %#v", resp.Error)
+	}
+	data, ok := resp.Error.Data.(map[string]any)
+	if !ok || data["limited_by"] != "token" {
+		t.Fatalf("expected limited_by=token, got %#v", resp.Error.Data)
+	}
+}
+
+func TestLocalLimitErrorContract(t *testing.T) {
+	resp := callToolWithEntitlementError(t, &entitlements.LocalLimitError{Limit: "monthly_units", Configured: 100})
+	if resp.Error == nil {
+		t.Fatalf("expected local-limit error response")
+	}
+	if resp.Error.Code != -32044 || resp.Error.Message != "local_limit_exceeded" {
+		t.Fatalf("unexpected local-limit error: %#v", resp.Error)
+	}
+	data, ok := resp.Error.Data.(map[string]any)
+	if !ok {
+		t.Fatalf("expected structured error data")
+	}
+	if data["limit"] != "monthly_units" || data["retryable"] != false {
+		t.Fatalf("unexpected local-limit data: %#v", data)
+	}
+}
+
+func TestTokenBudgetErrorContract(t *testing.T) {
+	resp := callToolWithEntitlementError(t, &llm.BudgetError{Limit: llm.BudgetDaily, Budget: 1000, Used: 990, Requested: 40})
+	if resp.Error == nil {
+		t.Fatalf("expected token-budget error response")
+	}
+	if resp.Error.Code != -32043 || resp.Error.Message != "token_budget_exceeded" {
+		t.Fatalf("unexpected token-budget error: %#v", resp.Error)
+	}
+	data, ok := resp.Error.Data.(map[string]any)
+	if !ok || data["limit"] != "daily" || data["used_tokens"] != float64(990) || data["retryable"] != true {
+		t.Fatalf("unexpected token-budget data: %#v", resp.Error.Data)
+	}
+}
+
+func TestSendingLimitErrorContract(t *testing.T) {
+	resp := callToolWithEntitlementError(t, &outbox.SendLimitError{Limit: outbox.LimitWarmup, Domain: "acme.test", Allowed: 50, Used: 50, RetryAfterSeconds: 3600})
+	if resp.Error == nil {
+		t.Fatalf("expected sending-limit error response")
+	}
+	if resp.Error.Code != -32046 || resp.Error.Message != "sending_limit_exceeded" {
+		t.Fatalf("unexpected sending-limit error: %#v", resp.Error)
+	}
+	data, ok := resp.Error.Data.(map[string]any)
+	if !ok || data["limit"] != "warmup" || data["domain"] != "acme.test" || data["retry_after_seconds"] != float64(3600) || data["retryable"] != true {
+		t.Fatalf("unexpected sending-limit data: %#v", resp.Error.Data)
+	}
+}
+
 func callToolWithEntitlementError(t *testing.T, entitlementErr error) Response {
 	t.Helper()
 	cfg := config.Default()
@@ -143,3 +215,17 @@ func rpcRequest(t *testing.T, payload map[string]any, sessionID, token string) *
 	}
 	return req
 }
+
+func TestExtraUnitsReadsRerankSummary(t *testing.T) {
+	result := map[string]any{"results": []any{}, "rerank": map[string]any{"applied": true, "units": int64(2)}}
+	if got := extraUnits(result); got != 2 {
+		t.Fatalf("expected 2 extra units, got %d", got)
+	}
+	skipped := map[string]any{"rerank": map[string]any{"applied": false, "skipped_reason": "latency_budget_exceeded"}}
+	if got := extraUnits(skipped); got != 0 {
+		t.Fatalf("expected no extra units when rerank was skipped, got %d", got)
+	}
+	if got := extraUnits(map[string]any{"results": []any{}}); got != 0 {
+		t.Fatalf("expected no extra units without rerank, got %d", got)
+	}
+}
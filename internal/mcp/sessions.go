@@ -0,0 +1,250 @@
+package mcp
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/queue"
+	"neuralmail/internal/store"
+)
+
+var errInvalidSession = errors.New("missing or invalid MCP-Session-Id")
+
+// SessionEndedError is returned for requests on a session that was closed by
+// the client, expired, or was terminated by an admin.
+type SessionEndedError struct {
+	Reason string
+}
+
+func (e *SessionEndedError) Error() string {
+	return "MCP session terminated: " + e.Reason
+}
+
+// SessionStore records session lifecycle and carries terminations made
+// through the cloud API; *store.Store satisfies it. Without one, sessions
+// live only in the SessionCache.
+type SessionStore interface {
+	UpsertMCPSession(ctx context.Context, sess store.MCPSession) error
+	TouchMCPSession(ctx context.Context, id string, expiresAt time.Time) (store.MCPSession, error)
+	EndMCPSession(ctx context.Context, orgID string, id string, reason string, by string) (bool, error)
+}
+
+// SessionCache holds live sessions with a sliding idle TTL. *queue.Queue
+// keeps them in Redis so every replica can serve them and they outlive a
+// restart; the default keeps them in process memory.
+type SessionCache interface {
+	PutSession(ctx context.Context, id string, sess queue.Session, ttl time.Duration) error
+	TouchSession(ctx context.Context, id string, ttl time.Duration) (queue.Session, bool, error)
+	DeleteSession(ctx context.Context, id string) error
+}
+
+type memorySession struct {
+	sess    queue.Session
+	expires time.Time
+}
+
+type memorySessions struct {
+	mu       sync.Mutex
+	sessions map[string]memorySession
+}
+
+func newMemorySessions() *memorySessions {
+	return &memorySessions{sessions: map[string]memorySession{}}
+}
+
+func (m *memorySessions) PutSession(ctx context.Context, id string, sess queue.Session, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[id] = memorySession{sess: sess, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (m *memorySessions) TouchSession(ctx context.Context, id string, ttl time.Duration) (queue.Session, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.sessions[id]
+	if !ok {
+		return queue.Session{}, false, nil
+	}
+	if !time.Now().Before(entry.expires) {
+		delete(m.sessions, id)
+		return queue.Session{}, false, nil
+	}
+	entry.expires = time.Now().Add(ttl)
+	m.sessions[id] = entry
+	return entry.sess, true, nil
+}
+
+func (m *memorySessions) DeleteSession(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+type clientInfoParams struct {
+	ClientInfo struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"clientInfo"`
+}
+
+func (s *Server) sessionTTL() time.Duration {
+	if s.Config.MCP.SessionTTL > 0 {
+		return s.Config.MCP.SessionTTL
+	}
+	return 24 * time.Hour
+}
+
+// startSession opens a session for a successful initialize, or re-initializes
+// the caller's existing one. Unknown IDs are never adopted.
+func (s *Server) startSession(ctx context.Context, sessionID string, version string, principal auth.Principal, params json.RawMessage, remoteAddr string) (string, error) {
+	if _, err := s.resumeSession(ctx, sessionID, principal); err != nil {
+		sessionID = uuid.NewString()
+	}
+	ttl := s.sessionTTL()
+	if s.Sessions != nil {
+		var client clientInfoParams
+		_ = json.Unmarshal(params, &client)
+		if err := s.Sessions.UpsertMCPSession(ctx, store.MCPSession{
+			ID:              sessionID,
+			OrgID:           principal.OrgID,
+			ActorID:         principal.ActorID,
+			TokenID:         principal.TokenID,
+			AuthMethod:      principal.AuthMethod,
+			ClientName:      client.ClientInfo.Name,
+			ClientVersion:   client.ClientInfo.Version,
+			ProtocolVersion: version,
+			RemoteAddr:      remoteAddr,
+			ExpiresAt:       time.Now().Add(ttl),
+		}); err != nil {
+			return "", err
+		}
+	}
+	if err := s.Live.PutSession(ctx, sessionID, queue.Session{OrgID: principal.OrgID, Version: version, RecordedAt: time.Now()}, ttl); err != nil {
+		return "", err
+	}
+	return sessionID, nil
+}
+
+// resumeSession validates the session for a request and slides its expiry.
+// Live sessions are resumed from the SessionCache; the SessionStore is
+// consulted only for a session the cache no longer holds. A session's row
+// is brought up to date, and a termination missed by the cache noticed, at
+// most once every mcp.session_record_interval, off the request path.
+func (s *Server) resumeSession(ctx context.Context, id string, principal auth.Principal) (queue.Session, error) {
+	if id == "" {
+		return queue.Session{}, errInvalidSession
+	}
+	ttl := s.sessionTTL()
+	sess, ok, err := s.Live.TouchSession(ctx, id, ttl)
+	if err != nil {
+		return queue.Session{}, err
+	}
+	if ok {
+		if sess.OrgID != principal.OrgID {
+			return queue.Session{}, errInvalidSession
+		}
+		if s.Sessions != nil && time.Since(sess.RecordedAt) >= s.Config.MCP.SessionRecordInterval {
+			sess.RecordedAt = time.Now()
+			if err := s.Live.PutSession(ctx, id, sess, ttl); err != nil {
+				return queue.Session{}, err
+			}
+			go s.recordSession(context.WithoutCancel(ctx), id, ttl)
+		}
+		return sess, nil
+	}
+	if s.Sessions == nil {
+		return queue.Session{}, errInvalidSession
+	}
+	rec, err := s.touchRecord(ctx, id, ttl)
+	if err != nil {
+		return queue.Session{}, err
+	}
+	if rec.OrgID != principal.OrgID {
+		return queue.Session{}, errInvalidSession
+	}
+	sess = queue.Session{OrgID: rec.OrgID, Version: rec.ProtocolVersion, RecordedAt: time.Now()}
+	if err := s.Live.PutSession(ctx, id, sess, ttl); err != nil {
+		return queue.Session{}, err
+	}
+	return sess, nil
+}
+
+// touchRecord slides the expiry of a session's row and returns it, or the
+// error a request on it fails with when it has ended. An ended session is
+// dropped from the SessionCache.
+func (s *Server) touchRecord(ctx context.Context, id string, ttl time.Duration) (store.MCPSession, error) {
+	rec, err := s.Sessions.TouchMCPSession(ctx, id, time.Now().Add(ttl))
+	if errors.Is(err, sql.ErrNoRows) {
+		s.forgetSession(ctx, id)
+		return rec, errInvalidSession
+	}
+	if err != nil {
+		return rec, err
+	}
+	if rec.TerminatedAt.Valid {
+		s.forgetSession(ctx, id)
+		return rec, &SessionEndedError{Reason: rec.TerminationReason}
+	}
+	if !time.Now().Before(rec.ExpiresAt) {
+		_ = s.TerminateSession(ctx, id, store.SessionEndExpired, "")
+		return rec, &SessionEndedError{Reason: store.SessionEndExpired}
+	}
+	return rec, nil
+}
+
+// recordSession is touchRecord for a session resumed from the cache.
+func (s *Server) recordSession(ctx context.Context, id string, ttl time.Duration) {
+	_, err := s.touchRecord(ctx, id, ttl)
+	var ended *SessionEndedError
+	if err != nil && !errors.Is(err, errInvalidSession) && !errors.As(err, &ended) {
+		slog.ErrorContext(ctx, "mcp session record failed", "session_id", id, "err", err)
+	}
+}
+
+// handleCloseSession serves DELETE /mcp, the client's explicit end of session.
+func (s *Server) handleCloseSession(ctx context.Context, w http.ResponseWriter, r *http.Request, principal auth.Principal) {
+	id := r.Header.Get("MCP-Session-Id")
+	if _, err := s.resumeSession(ctx, id, principal); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := s.TerminateSession(ctx, id, store.SessionEndClientClosed, principal.ActorID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TerminateSession ends a session on every replica sharing the cache and
+// records why in the SessionStore, if any. Ending an unknown or already
+// ended session is not an error.
+func (s *Server) TerminateSession(ctx context.Context, id string, reason string, by string) error {
+	if err := s.Live.DeleteSession(ctx, id); err != nil {
+		return err
+	}
+	if s.Sessions == nil {
+		return nil
+	}
+	if _, err := s.Sessions.EndMCPSession(ctx, "", id, reason, by); err != nil {
+		slog.ErrorContext(ctx, "mcp session end failed", "session_id", id, "reason", reason, "err", err)
+		return err
+	}
+	return nil
+}
+
+func (s *Server) forgetSession(ctx context.Context, id string) {
+	if err := s.Live.DeleteSession(ctx, id); err != nil {
+		slog.ErrorContext(ctx, "mcp session cache delete failed", "session_id", id, "err", err)
+	}
+}
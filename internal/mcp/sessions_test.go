@@ -0,0 +1,257 @@
+package mcp
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/store"
+)
+
+type fakeSessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]store.MCPSession
+	touches  int
+}
+
+func (f *fakeSessionStore) UpsertMCPSession(ctx context.Context, sess store.MCPSession) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if existing, ok := f.sessions[sess.ID]; ok {
+		sess.CreatedAt = existing.CreatedAt
+	} else {
+		sess.CreatedAt = time.Now()
+	}
+	sess.LastActivityAt = time.Now()
+	f.sessions[sess.ID] = sess
+	return nil
+}
+
+func (f *fakeSessionStore) TouchMCPSession(ctx context.Context, id string, expiresAt time.Time) (store.MCPSession, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.touches++
+	sess, ok := f.sessions[id]
+	if !ok {
+		return store.MCPSession{}, sql.ErrNoRows
+	}
+	if !sess.TerminatedAt.Valid {
+		sess.LastActivityAt = time.Now()
+		if sess.ExpiresAt.After(time.Now()) {
+			sess.ExpiresAt = expiresAt
+		}
+		f.sessions[id] = sess
+	}
+	return sess, nil
+}
+
+func (f *fakeSessionStore) EndMCPSession(ctx context.Context, orgID string, id string, reason string, by string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sess, ok := f.sessions[id]
+	if !ok || sess.TerminatedAt.Valid || (orgID != "" && sess.OrgID != orgID) {
+		return false, nil
+	}
+	sess.TerminatedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	sess.TerminationReason = reason
+	sess.TerminatedBy = by
+	f.sessions[id] = sess
+	return true, nil
+}
+
+func (f *fakeSessionStore) get(id string) store.MCPSession {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sessions[id]
+}
+
+func newSessionTestServer() (*Server, *fakeSessionStore) {
+	server := newVersionTestServer()
+	sessions := &fakeSessionStore{sessions: map[string]store.MCPSession{}}
+	server.Sessions = sessions
+	return server, sessions
+}
+
+func initializeSession(t *testing.T, server *Server) string {
+	t.Helper()
+	rec, resp := postRPC(t, server, "initialize", map[string]any{
+		"protocolVersion": "2025-06-18",
+		"clientInfo":      map[string]any{"name": "inspector", "version": "1.2.0"},
+	}, nil)
+	if resp.Error != nil {
+		t.Fatalf("initialize: %+v", resp.Error)
+	}
+	sessionID := rec.Header().Get("MCP-Session-Id")
+	if sessionID == "" {
+		t.Fatalf("expected a session id")
+	}
+	return sessionID
+}
+
+func TestInitializeRecordsSessionClientInfo(t *testing.T) {
+	server, sessions := newSessionTestServer()
+	sessionID := initializeSession(t, server)
+
+	sess := sessions.get(sessionID)
+	if sess.ClientName != "inspector" || sess.ClientVersion != "1.2.0" || sess.ProtocolVersion != "2025-06-18" {
+		t.Fatalf("unexpected recorded session %+v", sess)
+	}
+	if !sess.ExpiresAt.After(time.Now()) {
+		t.Fatalf("expected a future expiry, got %+v", sess)
+	}
+}
+
+func TestAdminTerminatedSessionRejectedOnNextRequest(t *testing.T) {
+	server, sessions := newSessionTestServer()
+	sessionID := initializeSession(t, server)
+	headers := map[string]string{"MCP-Session-Id": sessionID}
+
+	if _, resp := postRPC(t, server, "tools/list", map[string]any{}, headers); resp.Error != nil {
+		t.Fatalf("tools/list before termination: %+v", resp.Error)
+	}
+	if ended, _ := sessions.EndMCPSession(context.Background(), "", sessionID, store.SessionEndAdmin, "admin-1"); !ended {
+		t.Fatalf("expected session to end")
+	}
+	// As the cloud API's DELETE /v1/sessions/{id} does.
+	if err := server.Live.DeleteSession(context.Background(), sessionID); err != nil {
+		t.Fatalf("drop live session: %v", err)
+	}
+
+	_, resp := postRPC(t, server, "tools/list", map[string]any{}, headers)
+	if resp.Error == nil || resp.Error.Code != -32000 || resp.Error.Message != "MCP session terminated" {
+		t.Fatalf("expected terminated session error, got %+v", resp.Error)
+	}
+	if data := resp.Error.Data.(map[string]any); data["reason"] != store.SessionEndAdmin {
+		t.Fatalf("expected admin_terminated reason, got %v", data)
+	}
+}
+
+func TestResumeSessionRecordsAtMostOncePerInterval(t *testing.T) {
+	server, sessions := newSessionTestServer()
+	server.Config.MCP.SessionRecordInterval = time.Hour
+	sessionID := initializeSession(t, server)
+	headers := map[string]string{"MCP-Session-Id": sessionID}
+
+	for i := 0; i < 5; i++ {
+		if _, resp := postRPC(t, server, "tools/list", map[string]any{}, headers); resp.Error != nil {
+			t.Fatalf("request %d: %+v", i, resp.Error)
+		}
+	}
+	sessions.mu.Lock()
+	touches := sessions.touches
+	sessions.mu.Unlock()
+	if touches != 0 {
+		t.Fatalf("expected live sessions to be resumed from the cache alone, got %d row touches", touches)
+	}
+
+	// A termination the cache never heard of is noticed when the row is
+	// next brought up to date.
+	server.Config.MCP.SessionRecordInterval = 0
+	if ended, _ := sessions.EndMCPSession(context.Background(), "", sessionID, store.SessionEndAdmin, "admin-1"); !ended {
+		t.Fatalf("expected session to end")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, resp := postRPC(t, server, "tools/list", map[string]any{}, headers)
+		if resp.Error != nil {
+			if resp.Error.Message != "MCP session terminated" {
+				t.Fatalf("expected terminated session error, got %+v", resp.Error)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the terminated session to be rejected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDeleteEndsSession(t *testing.T) {
+	server, sessions := newSessionTestServer()
+	sessionID := initializeSession(t, server)
+
+	req := httptest.NewRequest(http.MethodDelete, "/mcp", nil)
+	req.Header.Set("MCP-Session-Id", sessionID)
+	rec := httptest.NewRecorder()
+	server.HandleHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	if sess := sessions.get(sessionID); sess.TerminationReason != store.SessionEndClientClosed {
+		t.Fatalf("expected client_closed, got %+v", sess)
+	}
+
+	rec = httptest.NewRecorder()
+	server.HandleHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an ended session, got %d", rec.Code)
+	}
+	_, resp := postRPC(t, server, "tools/list", map[string]any{}, map[string]string{"MCP-Session-Id": sessionID})
+	if resp.Error == nil || resp.Error.Message != "MCP session terminated" {
+		t.Fatalf("expected terminated session error, got %+v", resp.Error)
+	}
+}
+
+func TestResumeSessionRejectsOtherOrg(t *testing.T) {
+	server, sessions := newSessionTestServer()
+	ctx := context.Background()
+	owner := auth.Principal{OrgID: "org-a", ActorID: "actor-a", AuthMethod: "api_key"}
+
+	sessionID, err := server.startSession(ctx, "", "", owner, nil, "127.0.0.1:1234")
+	if err != nil {
+		t.Fatalf("start session: %v", err)
+	}
+	if sess := sessions.get(sessionID); sess.OrgID != "org-a" || sess.RemoteAddr != "127.0.0.1:1234" {
+		t.Fatalf("unexpected recorded session %+v", sess)
+	}
+	if _, err := server.resumeSession(ctx, sessionID, auth.Principal{OrgID: "org-b"}); err != errInvalidSession {
+		t.Fatalf("expected errInvalidSession for another org, got %v", err)
+	}
+	if _, err := server.resumeSession(ctx, sessionID, owner); err != nil {
+		t.Fatalf("expected owner to resume, got %v", err)
+	}
+	if again, _ := server.startSession(ctx, "unknown-id", "", owner, nil, ""); again == "unknown-id" {
+		t.Fatalf("expected an unknown session id not to be adopted")
+	}
+}
+
+func TestSessionSharedAcrossReplicas(t *testing.T) {
+	first := newVersionTestServer()
+	second := newVersionTestServer()
+	second.Live = first.Live
+	sessionID := initializeSession(t, first)
+	headers := map[string]string{"MCP-Session-Id": sessionID}
+
+	if _, resp := postRPC(t, second, "tools/list", map[string]any{}, headers); resp.Error != nil {
+		t.Fatalf("expected the other replica to accept the session, got %+v", resp.Error)
+	}
+	if err := second.TerminateSession(context.Background(), sessionID, store.SessionEndAdmin, "admin-1"); err != nil {
+		t.Fatalf("terminate: %v", err)
+	}
+	if _, resp := postRPC(t, first, "tools/list", map[string]any{}, headers); resp.Error == nil {
+		t.Fatalf("expected a session terminated on one replica to be rejected by the other")
+	}
+}
+
+func TestSessionExpirySlidesWithActivity(t *testing.T) {
+	server := newVersionTestServer()
+	server.Config.MCP.SessionTTL = 200 * time.Millisecond
+	sessionID := initializeSession(t, server)
+	headers := map[string]string{"MCP-Session-Id": sessionID}
+
+	for i := 0; i < 3; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if _, resp := postRPC(t, server, "tools/list", map[string]any{}, headers); resp.Error != nil {
+			t.Fatalf("request %d: expected an active session to stay alive, got %+v", i, resp.Error)
+		}
+	}
+	time.Sleep(300 * time.Millisecond)
+	if _, resp := postRPC(t, server, "tools/list", map[string]any{}, headers); resp.Error == nil {
+		t.Fatalf("expected an idle session to expire")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -14,6 +15,9 @@ func RunStdio(ctx context.Context, srv *Server) error {
 	writer := bufio.NewWriter(os.Stdout)
 	defer writer.Flush()
 
+	// The stdio transport is a single session, so the version negotiated by
+	// the last successful initialize applies to every later request.
+	var version string
 	for scanner.Scan() {
 		line := scanner.Bytes()
 		if len(line) == 0 {
@@ -23,11 +27,31 @@ func RunStdio(ctx context.Context, srv *Server) error {
 		if err := json.Unmarshal(line, &req); err != nil {
 			return err
 		}
-		result, err := srv.dispatch(ctx, req)
 		resp := Response{JSONRPC: "2.0", ID: req.ID}
-		if err != nil {
+		var (
+			result any
+			err    error
+		)
+		if req.Method == "initialize" {
+			var negotiated string
+			negotiated, err = srv.negotiateVersion(req.Params)
+			if err == nil {
+				version = negotiated
+			}
+		}
+		if err == nil {
+			result, err = srv.dispatch(withProtocolVersion(ctx, version), req)
+		}
+		var versionErr *UnsupportedVersionError
+		switch {
+		case errors.As(err, &versionErr):
+			resp.Error = &ResponseError{Code: -32602, Message: "Unsupported protocol version", Data: map[string]any{
+				"requested": versionErr.Requested,
+				"supported": versionErr.Supported,
+			}}
+		case err != nil:
 			resp.Error = &ResponseError{Code: -32000, Message: err.Error()}
-		} else {
+		default:
 			resp.Result = result
 		}
 		data, _ := json.Marshal(resp)
@@ -0,0 +1,49 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// readInboxThreadsResource lists a page of an inbox's threads, read from
+// email://inboxes/{inbox_id}/threads with list_threads' filters as query
+// parameters.
+func (s *Server) readInboxThreadsResource(ctx context.Context, uri string) (any, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	inboxID, rest, _ := strings.Cut(strings.TrimPrefix(parsed.Path, "/"), "/")
+	if parsed.Host != "inboxes" || inboxID == "" || rest != "threads" {
+		return nil, fmt.Errorf("resource not found: %s", uri)
+	}
+	query := parsed.Query()
+	return s.Tools.ListThreads(ctx, inboxID, query.Get("status"), query.Get("awaiting_reply"), query.Get("cursor"), pageLimit(query))
+}
+
+// readThreadResource reads email://threads/{thread_id}: the thread and a
+// page of its messages, which cursor= and limit= select as in get_thread.
+func (s *Server) readThreadResource(ctx context.Context, uri string) (any, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	threadID := strings.TrimPrefix(parsed.Path, "/")
+	if parsed.Host != "threads" || threadID == "" || strings.Contains(threadID, "/") {
+		return nil, fmt.Errorf("resource not found: %s", uri)
+	}
+	query := parsed.Query()
+	return s.Tools.GetThread(ctx, threadID, query.Get("cursor"), pageLimit(query))
+}
+
+// pageLimit is a resource's limit= parameter, or 0 for the default page.
+func pageLimit(query url.Values) int {
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit < 0 {
+		return 0
+	}
+	return limit
+}
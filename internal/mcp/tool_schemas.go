@@ -0,0 +1,539 @@
+package mcp
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"neuralmail/internal/policy"
+	"neuralmail/internal/store"
+	"neuralmail/internal/textdiff"
+	"neuralmail/internal/tools"
+)
+
+// Tool arguments. Besides the json tag, fields carry the schema hints read by
+// schemaFor: required:"true", enum:"a|b" and description:"...".
+
+type listThreadsInput struct {
+	InboxID string `json:"inbox_id" required:"true"`
+	Status  string `json:"status" description:"Only threads with this status, e.g. open or closed"`
+	Limit   int    `json:"limit" description:"Maximum threads to return (default 50)"`
+	Cursor  string `json:"cursor" description:"next_cursor of the previous page, to continue after it"`
+	// AwaitingReply is us for threads where the customer wrote last and is
+	// waiting on us, customer for threads where we wrote last.
+	AwaitingReply string `json:"awaiting_reply" enum:"us|customer" description:"Only threads waiting on a reply from us or from the customer"`
+}
+
+type getThreadInput struct {
+	ThreadID string `json:"thread_id" required:"true"`
+	Limit    int    `json:"limit" description:"Maximum messages to return, oldest first (default 100, at most 500)"`
+	Cursor   string `json:"cursor" description:"next_cursor of the previous page, to continue after it"`
+}
+
+type searchInboxInput struct {
+	InboxID   string `json:"inbox_id" required:"true"`
+	Query     string `json:"query" required:"true"`
+	TopK      int    `json:"top_k" description:"Maximum results to return"`
+	Direction string `json:"direction" enum:"inbound|outbound" description:"Search only received or only sent mail"`
+	Mode      string `json:"mode" enum:"auto|vector|fts|hybrid" description:"Retrieval mode; auto (default) uses vector search where available, hybrid fuses vector and full-text results"`
+}
+
+type searchOrgInput struct {
+	Query     string   `json:"query" required:"true"`
+	TopK      int      `json:"top_k" description:"Maximum results across all inboxes (default 10, max 100)"`
+	Direction string   `json:"direction" enum:"inbound|outbound" description:"Search only received or only sent mail"`
+	InboxIDs  []string `json:"inbox_ids" description:"Only search these inboxes; all active inboxes of the org by default"`
+}
+
+type triageMessageInput struct {
+	MessageID   string `json:"message_id" required:"true"`
+	BypassCache bool   `json:"bypass_cache" description:"Ask the model again instead of returning a cached classification"`
+}
+
+type translateMessageInput struct {
+	MessageID      string `json:"message_id" required:"true"`
+	TargetLanguage string `json:"target_language" required:"true" description:"BCP 47 language tag, e.g. en or pt-br"`
+}
+
+type translateThreadInput struct {
+	ThreadID       string `json:"thread_id" required:"true"`
+	TargetLanguage string `json:"target_language" required:"true" description:"BCP 47 language tag, e.g. en or pt-br"`
+}
+
+type summarizeThreadInput struct {
+	ThreadID string `json:"thread_id" required:"true"`
+	Refresh  bool   `json:"refresh" description:"Summarize again even if no message has arrived since the stored summary"`
+}
+
+type getContactProfileInput struct {
+	Email     string `json:"email" description:"Any address of the contact; a +tag is ignored"`
+	ContactID string `json:"contact_id" description:"Used instead of email when set"`
+}
+
+type linkThreadToCRMInput struct {
+	ThreadID string `json:"thread_id" required:"true"`
+	TicketID string `json:"ticket_id" description:"Existing CRM ticket to link; a new ticket is filed when empty"`
+	Kind     string `json:"kind" description:"sales or support (default) for a new ticket"`
+}
+
+type getCRMContextInput struct {
+	ThreadID string `json:"thread_id" description:"Look up the thread's latest sender and linked ticket"`
+	Email    string `json:"email" description:"Look up this address instead of the thread's sender"`
+}
+
+type extractToSchemaInput struct {
+	MessageID   string `json:"message_id" required:"true"`
+	SchemaID    string `json:"schema_id" required:"true"`
+	BypassCache bool   `json:"bypass_cache" description:"Ask the model again instead of returning a cached extraction"`
+}
+
+type draftReplyInput struct {
+	ThreadID  string           `json:"thread_id" required:"true"`
+	Goal      string           `json:"goal" description:"What the reply should achieve"`
+	Knowledge []knowledgeChunk `json:"knowledge" description:"Knowledge base chunks retrieved for the reply, which the draft may cite as [kb:<id>] (at most 20)"`
+}
+
+type knowledgeChunk struct {
+	ID   string `json:"id" required:"true"`
+	Text string `json:"text" required:"true" description:"The chunk's text, at most 4000 bytes"`
+}
+
+type updateDraftInput struct {
+	DraftID string `json:"draft_id" required:"true"`
+	Body    string `json:"body" required:"true" description:"Full revised draft text"`
+}
+
+type getDraftHistoryInput struct {
+	DraftID string `json:"draft_id" required:"true"`
+}
+
+type listPendingDraftsInput struct {
+	Limit int `json:"limit" description:"Maximum drafts to return (default 50, max 200)"`
+}
+
+type approveDraftInput struct {
+	DraftID  string `json:"draft_id" required:"true"`
+	Revision int    `json:"revision" description:"Revision the reviewer read; approval fails if a newer one exists"`
+	Note     string `json:"note"`
+}
+
+type rejectDraftInput struct {
+	DraftID string `json:"draft_id" required:"true"`
+	Reason  string `json:"reason" required:"true"`
+}
+
+type sendReplyInput struct {
+	ThreadID      string `json:"thread_id" required:"true"`
+	Body          string `json:"body_or_draft_id" required:"true" description:"Reply text, or the ID of an approved draft to send"`
+	NeedsApproval bool   `json:"needs_human_approval"`
+}
+
+type getDeliveryStatusInput struct {
+	MessageID string `json:"message_id" required:"true" description:"ID of a message sent with send_reply or compose_email"`
+}
+
+type composeEmailInput struct {
+	InboxID string `json:"inbox_id" required:"true"`
+	To      string `json:"to" required:"true" description:"Recipient email address"`
+	Subject string `json:"subject" required:"true"`
+	Body    string `json:"body" required:"true"`
+}
+
+// Tool results. These only describe the maps built by tools.Service; fields
+// tagged omitempty are not always present.
+
+type listThreadsOutput struct {
+	Threads []store.Thread `json:"threads"`
+	// NextCursor is set when the page is full and more threads may follow.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type getThreadOutput struct {
+	Thread   store.Thread    `json:"thread"`
+	Messages []store.Message `json:"messages"`
+	// NextCursor is set when the page is full and more messages may follow.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type searchHit struct {
+	MessageID    string             `json:"message_id"`
+	ThreadID     string             `json:"thread_id"`
+	Score        float64            `json:"score"`
+	Snippet      string             `json:"snippet"`
+	SourceScores map[string]float64 `json:"source_scores,omitempty"`
+}
+
+type searchInboxOutput struct {
+	Results       []searchHit   `json:"results"`
+	RetrievalMode string        `json:"retrieval_mode" enum:"vector|fts|hybrid"`
+	Rerank        *searchRerank `json:"rerank,omitempty"`
+}
+
+type searchRerank struct {
+	Applied       bool   `json:"applied"`
+	Provider      string `json:"provider"`
+	Candidates    int    `json:"candidates"`
+	LatencyMS     int64  `json:"latency_ms,omitempty"`
+	SkippedReason string `json:"skipped_reason,omitempty" enum:"latency_budget_exceeded|rerank_error"`
+	Units         int64  `json:"units,omitempty"`
+}
+
+type searchOrgOutput struct {
+	Results         []tools.OrgSearchHit `json:"results"`
+	Ranking         string               `json:"ranking" enum:"score|rank"`
+	InboxesSearched int                  `json:"inboxes_searched"`
+}
+
+type triageMessageOutput struct {
+	Intent         string  `json:"intent"`
+	Urgency        string  `json:"urgency"`
+	Sentiment      string  `json:"sentiment"`
+	Confidence     float64 `json:"confidence"`
+	SuggestedRoute string  `json:"suggested_route"`
+	AliasAddress   string  `json:"alias_address"`
+	Cached         bool    `json:"cached,omitempty"`
+	CRMTicketID    string  `json:"crm_ticket_id,omitempty"`
+}
+
+type translatedMessage struct {
+	MessageID      string `json:"message_id"`
+	ThreadID       string `json:"thread_id"`
+	Direction      string `json:"direction" enum:"inbound|outbound"`
+	SourceLanguage string `json:"source_language"`
+	TargetLanguage string `json:"target_language"`
+	TranslatedText string `json:"translated_text"`
+	Cached         bool   `json:"cached"`
+}
+
+type translateThreadOutput struct {
+	ThreadID       string              `json:"thread_id"`
+	Subject        string              `json:"subject"`
+	TargetLanguage string              `json:"target_language"`
+	Messages       []translatedMessage `json:"messages"`
+	CacheHits      int                 `json:"cache_hits"`
+}
+
+type summarizeThreadOutput struct {
+	ThreadID      string    `json:"thread_id"`
+	Participants  []string  `json:"participants"`
+	Ask           string    `json:"ask"`
+	Commitments   []string  `json:"commitments"`
+	OpenQuestions []string  `json:"open_questions"`
+	NextAction    string    `json:"next_action"`
+	Model         string    `json:"model"`
+	MessageCount  int       `json:"message_count"`
+	SummarizedAt  time.Time `json:"summarized_at"`
+	Cached        bool      `json:"cached"`
+}
+
+type contactSentimentPoint struct {
+	ThreadID string    `json:"thread_id"`
+	Score    float64   `json:"score"`
+	At       time.Time `json:"at"`
+}
+
+type contactSentiment struct {
+	Trend   string                  `json:"trend" description:"improving, declining, stable or unknown"`
+	Average *float64                `json:"average"`
+	Points  []contactSentimentPoint `json:"points"`
+}
+
+type contactThread struct {
+	ThreadID       string    `json:"thread_id"`
+	Subject        string    `json:"subject"`
+	Status         string    `json:"status"`
+	SentimentScore *float64  `json:"sentiment_score"`
+	LastSeenAt     time.Time `json:"last_seen_at"`
+}
+
+type getContactProfileOutput struct {
+	ContactID     string           `json:"contact_id"`
+	Name          string           `json:"name"`
+	Emails        []string         `json:"emails"`
+	FirstSeenAt   time.Time        `json:"first_seen_at"`
+	LastSeenAt    time.Time        `json:"last_seen_at"`
+	MessageCount  int              `json:"message_count"`
+	ThreadCount   int              `json:"thread_count"`
+	Sentiment     contactSentiment `json:"sentiment"`
+	RecentThreads []contactThread  `json:"recent_threads"`
+}
+
+type crmLinkOutput struct {
+	ThreadID  string    `json:"thread_id"`
+	Provider  string    `json:"provider"`
+	Kind      string    `json:"kind"`
+	ContactID string    `json:"contact_id"`
+	TicketID  string    `json:"ticket_id"`
+	Priority  string    `json:"priority"`
+	LinkedBy  string    `json:"linked_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type crmRecord struct {
+	Type       string            `json:"type"`
+	ID         string            `json:"id"`
+	Properties map[string]string `json:"properties"`
+}
+
+type getCRMContextOutput struct {
+	Provider string         `json:"provider"`
+	Email    string         `json:"email"`
+	Contact  *crmRecord     `json:"contact"`
+	Tickets  []crmRecord    `json:"tickets"`
+	Deals    []crmRecord    `json:"deals"`
+	Link     *crmLinkOutput `json:"link"`
+}
+
+type bulkUpdateOutput struct {
+	InboxID         string   `json:"inbox_id"`
+	Action          string   `json:"action" enum:"close|label|assign|delete"`
+	DryRun          bool     `json:"dry_run"`
+	Matched         int64    `json:"matched"`
+	WouldProcess    int64    `json:"would_process,omitempty"`
+	SampleThreadIDs []string `json:"sample_thread_ids,omitempty"`
+	Processed       int64    `json:"processed,omitempty"`
+	Updated         int64    `json:"updated,omitempty"`
+	Batches         int      `json:"batches,omitempty"`
+	Remaining       int64    `json:"remaining,omitempty"`
+}
+
+type extractToSchemaOutput struct {
+	Data             map[string]any `json:"data"`
+	Confidence       float64        `json:"confidence"`
+	MissingFields    []string       `json:"missing_fields"`
+	ValidationErrors []string       `json:"validation_errors"`
+	Cached           bool           `json:"cached,omitempty"`
+}
+
+type draftReplyOutput struct {
+	Draft              string               `json:"draft"`
+	RiskFlags          []string             `json:"risk_flags"`
+	LinkFindings       []policy.LinkFinding `json:"link_findings"`
+	CitedMessageIDs    []string             `json:"cited_message_ids"`
+	CitedChunkIDs      []string             `json:"cited_chunk_ids"`
+	Sentences          []policy.Sentence    `json:"sentences" description:"The draft sentence by sentence, with the sources each cites"`
+	CitationCoverage   float64              `json:"citation_coverage,omitempty"`
+	CitationRetried    bool                 `json:"citation_retried,omitempty"`
+	Context            *draftContext        `json:"context,omitempty"`
+	NeedsHumanApproval bool                 `json:"needs_human_approval"`
+	PolicyBlocked      bool                 `json:"policy_blocked,omitempty"`
+	Reason             string               `json:"reason,omitempty"`
+	PolicyID           string               `json:"policy_id"`
+	OrgPolicyVersion   int                  `json:"org_policy_version" description:"Version of the org's policy rules applied, 0 for none"`
+	PolicyRules        []policy.Match       `json:"policy_rules"`
+	DraftID            string               `json:"draft_id"`
+	Revision           int                  `json:"revision"`
+	Status             string               `json:"status" enum:"pending_approval|approved"`
+}
+
+// draftContext reports how the thread was packed into the model's context.
+type draftContext struct {
+	Tokens     int `json:"tokens"`
+	Budget     int `json:"budget"`
+	Verbatim   int `json:"verbatim"`
+	Summarized int `json:"summarized"`
+	Omitted    int `json:"omitted"`
+}
+
+type draftRevision struct {
+	Revision           int       `json:"revision"`
+	CreatedAt          time.Time `json:"created_at"`
+	Body               string    `json:"body"`
+	PolicyID           string    `json:"policy_id"`
+	OrgPolicyVersion   int       `json:"org_policy_version" description:"Version of the org's policy rules the revision was checked against, 0 for none"`
+	PolicyBlocked      bool      `json:"policy_blocked"`
+	NeedsHumanApproval bool      `json:"needs_human_approval"`
+	Reason             string    `json:"reason"`
+	RiskFlags          []string  `json:"risk_flags"`
+	PolicyRuleIDs      []string  `json:"policy_rule_ids"`
+}
+
+type draftRevisionDiff struct {
+	FromRevision int           `json:"from_revision"`
+	ToRevision   int           `json:"to_revision"`
+	Ops          []textdiff.Op `json:"ops"`
+	LinesAdded   int           `json:"lines_added"`
+	LinesRemoved int           `json:"lines_removed"`
+}
+
+type draftReview struct {
+	ReviewedBy       string    `json:"reviewed_by"`
+	ReviewedAt       time.Time `json:"reviewed_at"`
+	Note             string    `json:"note"`
+	ApprovedRevision int       `json:"approved_revision"`
+}
+
+type draftHistoryOutput struct {
+	DraftID   string              `json:"draft_id"`
+	ThreadID  string              `json:"thread_id"`
+	Goal      string              `json:"goal"`
+	Status    string              `json:"status" enum:"pending_approval|approved|rejected|sent"`
+	Review    *draftReview        `json:"review"`
+	CreatedAt time.Time           `json:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at"`
+	Revisions []draftRevision     `json:"revisions"`
+	Diffs     []draftRevisionDiff `json:"diffs"`
+}
+
+type listPendingDraftsOutput struct {
+	Drafts []tools.PendingDraft `json:"drafts"`
+}
+
+type draftReviewOutput struct {
+	DraftID          string `json:"draft_id"`
+	Status           string `json:"status" enum:"approved|rejected"`
+	ApprovedRevision int    `json:"approved_revision"`
+	ReviewedBy       string `json:"reviewed_by"`
+}
+
+type sendReplyOutput struct {
+	MessageID string `json:"message_id"`
+	Status    string `json:"status"`
+	DraftID   string `json:"draft_id,omitempty"`
+}
+
+type composeEmailOutput struct {
+	ThreadID  string `json:"thread_id"`
+	MessageID string `json:"message_id"`
+	Status    string `json:"status" enum:"queued"`
+}
+
+type deliveryStatusOutput struct {
+	MessageID     string     `json:"message_id"`
+	Status        string     `json:"status" enum:"queued|sent|delivered|bounced|failed|complained"`
+	To            string     `json:"to"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error"`
+	QueuedAt      time.Time  `json:"queued_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	// Transport is the transport the message went out through, once sent,
+	// and ProviderMessageID the ID its provider gave it.
+	Transport         string     `json:"transport,omitempty"`
+	ProviderMessageID string     `json:"provider_message_id,omitempty"`
+	DeliveredAt       *time.Time `json:"delivered_at,omitempty"`
+}
+
+type toolDefinition struct {
+	Name        string
+	Description string
+	Input       any
+	Output      any
+}
+
+var toolDefinitions = []toolDefinition{
+	{"list_threads", "List threads in an inbox", listThreadsInput{}, listThreadsOutput{}},
+	{"get_thread", "Fetch a thread with a page of its messages, oldest first; Oversized messages have truncated bodies", getThreadInput{}, getThreadOutput{}},
+	{"search_inbox", "Semantic search over an inbox", searchInboxInput{}, searchInboxOutput{}},
+	{"search_org", "Search every inbox of the org at once and merge the ranked results", searchOrgInput{}, searchOrgOutput{}},
+	{"triage_message", "Classify intent, urgency, sentiment", triageMessageInput{}, triageMessageOutput{}},
+	{"translate_message", "Translate a message into a target language", translateMessageInput{}, translatedMessage{}},
+	{"translate_thread", "Translate every message in a thread into a target language", translateThreadInput{}, translateThreadOutput{}},
+	{"summarize_thread", "Summarize a thread: participants, ask, commitments, open questions and next action; cached until a new message arrives", summarizeThreadInput{}, summarizeThreadOutput{}},
+	{"get_contact_profile", "Describe a sender before replying: names, addresses, message and thread counts, recent threads and sentiment trend", getContactProfileInput{}, getContactProfileOutput{}},
+	{"link_thread_to_crm", "File a thread as a ticket in the org's CRM, or link it to an existing ticket", linkThreadToCRMInput{}, crmLinkOutput{}},
+	{"get_crm_context", "What the org's CRM knows about a thread's sender: contact properties, tickets and deals", getCRMContextInput{}, getCRMContextOutput{}},
+	{"bulk_update_threads", "Close, label, assign or delete threads matching a filter in batches", tools.BulkThreadRequest{}, bulkUpdateOutput{}},
+	{"extract_to_schema", "Extract structured data", extractToSchemaInput{}, extractToSchemaOutput{}},
+	{"draft_reply_with_policy", "Draft a reply constrained by policy", draftReplyInput{}, draftReplyOutput{}},
+	{"update_draft", "Resubmit a revised draft body for policy checks as a new revision", updateDraftInput{}, draftReplyOutput{}},
+	{"get_draft_history", "List a draft's revisions with policy outcomes and diffs between them", getDraftHistoryInput{}, draftHistoryOutput{}},
+	{"list_pending_drafts", "List drafts waiting for human approval, oldest first", listPendingDraftsInput{}, listPendingDraftsOutput{}},
+	{"approve_draft", "Approve a draft's latest revision so send_reply can send it", approveDraftInput{}, draftReviewOutput{}},
+	{"reject_draft", "Reject a draft; update_draft resubmits it for review", rejectDraftInput{}, draftReviewOutput{}},
+	{"send_reply", "Send a reply, or an approved draft", sendReplyInput{}, sendReplyOutput{}},
+	{"compose_email", "Compose and send a new email (not a reply)", composeEmailInput{}, composeEmailOutput{}},
+	{"get_delivery_status", "Check delivery of a sent message: queued, sent, delivered, bounced, failed or complained", getDeliveryStatusInput{}, deliveryStatusOutput{}},
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor builds a JSON Schema for the value encoding/json would produce
+// for t. Input schemas reject unknown properties so misspelled arguments
+// fail client-side; output schemas stay open because replay_id and audit_id
+// are added to every result.
+func schemaFor(t reflect.Type, strict bool) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(schemaFor(t.Elem(), strict))
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return nullable(map[string]any{"type": "array", "items": schemaFor(t.Elem(), strict)})
+	case reflect.Map:
+		return nullable(map[string]any{"type": "object"})
+	case reflect.Struct:
+		if t == timeType {
+			return map[string]any{"type": "string", "format": "date-time"}
+		}
+		return structSchema(t, strict)
+	default:
+		return map[string]any{}
+	}
+}
+
+func structSchema(t reflect.Type, strict bool) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		prop := schemaFor(field.Type, strict)
+		if enum := field.Tag.Get("enum"); enum != "" {
+			values := []any{}
+			for _, v := range strings.Split(enum, "|") {
+				values = append(values, v)
+			}
+			prop["enum"] = values
+		}
+		if desc := field.Tag.Get("description"); desc != "" {
+			prop["description"] = desc
+		}
+		properties[name] = prop
+		// Inputs list only what the tool cannot run without; outputs list
+		// every field that is always present.
+		if strict && field.Tag.Get("required") == "true" {
+			required = append(required, name)
+		}
+		if !strict && !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	schema := map[string]any{"type": "object", "properties": properties, "required": required}
+	if strict {
+		schema["additionalProperties"] = false
+	}
+	return schema
+}
+
+// nullable widens a schema to accept null, which encoding/json writes for
+// nil slices, maps and pointers.
+func nullable(schema map[string]any) map[string]any {
+	schema["type"] = []any{schema["type"], "null"}
+	return schema
+}
+
+func inputSchema(v any) map[string]any {
+	return schemaFor(reflect.TypeOf(v), true)
+}
+
+func outputSchema(v any) map[string]any {
+	return schemaFor(reflect.TypeOf(v), false)
+}
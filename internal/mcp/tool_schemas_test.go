@@ -0,0 +1,107 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+func compileSchema(t *testing.T, schema map[string]any) *jsonschema.Schema {
+	t.Helper()
+	data, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatalf("marshal schema: %v", err)
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("schema.json", bytes.NewReader(data)); err != nil {
+		t.Fatalf("add schema: %v", err)
+	}
+	compiled, err := compiler.Compile("schema.json")
+	if err != nil {
+		t.Fatalf("compile schema: %v", err)
+	}
+	return compiled
+}
+
+func toolByName(t *testing.T, list map[string]any, name string) map[string]any {
+	t.Helper()
+	for _, tool := range list["tools"].([]map[string]any) {
+		if tool["name"] == name {
+			return tool
+		}
+	}
+	t.Fatalf("tool %s not listed", name)
+	return nil
+}
+
+func TestListToolsSchemasCompile(t *testing.T) {
+	list := ListTools(Version20250618)
+	for _, tool := range list["tools"].([]map[string]any) {
+		compileSchema(t, tool["inputSchema"].(map[string]any))
+		compileSchema(t, tool["outputSchema"].(map[string]any))
+	}
+	if len(list["tools"].([]map[string]any)) != len(toolDefinitions) {
+		t.Fatalf("expected every tool to be listed")
+	}
+}
+
+func TestSearchInboxInputSchema(t *testing.T) {
+	schema := toolByName(t, ListTools(Version20250618), "search_inbox")["inputSchema"].(map[string]any)
+	required := schema["required"].([]string)
+	if !slices.Contains(required, "inbox_id") || !slices.Contains(required, "query") || slices.Contains(required, "direction") {
+		t.Fatalf("unexpected required fields %v", required)
+	}
+	compiled := compileSchema(t, schema)
+	valid := map[string]any{"inbox_id": "inbox-1", "query": "refund", "direction": "outbound", "mode": "hybrid"}
+	if err := compiled.Validate(valid); err != nil {
+		t.Fatalf("expected valid arguments, got %v", err)
+	}
+	for _, args := range []map[string]any{
+		{"inbox_id": "inbox-1", "query": "refund", "direction": "sideways"},
+		{"inbox_id": "inbox-1", "query": "refund", "mode": "semantic"},
+		{"inbox_id": "inbox-1"},
+		{"inbox_id": "inbox-1", "query": "refund", "topK": 5},
+	} {
+		if err := compiled.Validate(args); err == nil {
+			t.Fatalf("expected %v to be rejected", args)
+		}
+	}
+}
+
+func TestBulkUpdateInputSchemaEnumsAction(t *testing.T) {
+	schema := toolByName(t, ListTools(Version20250618), "bulk_update_threads")["inputSchema"].(map[string]any)
+	compiled := compileSchema(t, schema)
+	if err := compiled.Validate(map[string]any{"inbox_id": "inbox-1", "action": "close", "filter": map[string]any{"older_than": "30d"}}); err != nil {
+		t.Fatalf("expected valid arguments, got %v", err)
+	}
+	if err := compiled.Validate(map[string]any{"inbox_id": "inbox-1", "action": "archive"}); err == nil {
+		t.Fatalf("expected unknown action to be rejected")
+	}
+}
+
+func TestOutputSchemaMatchesToolResult(t *testing.T) {
+	schema := toolByName(t, ListTools(Version20250618), "compose_email")["outputSchema"].(map[string]any)
+	compiled := compileSchema(t, schema)
+	result := map[string]any{"thread_id": "t-1", "message_id": "m-1", "status": "queued", "smtp_error": "dial tcp: refused", "replay_id": "r-1"}
+	if err := compiled.Validate(result); err != nil {
+		t.Fatalf("expected result to validate, got %v", err)
+	}
+	if err := compiled.Validate(map[string]any{"thread_id": "t-1", "status": "queued"}); err == nil {
+		t.Fatalf("expected missing message_id to be rejected")
+	}
+}
+
+func TestListToolsOmitsOutputSchemaForOlderVersions(t *testing.T) {
+	for _, version := range []string{"", "2025-03-26"} {
+		tool := toolByName(t, ListTools(version), "get_thread")
+		if _, ok := tool["outputSchema"]; ok {
+			t.Fatalf("expected no outputSchema for version %q", version)
+		}
+		if _, ok := tool["inputSchema"]; !ok {
+			t.Fatalf("expected inputSchema for version %q", version)
+		}
+	}
+}
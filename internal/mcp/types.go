@@ -31,25 +31,30 @@ type ResourceReadParams struct {
 	URI string `json:"uri"`
 }
 
-func ListTools() map[string]any {
-	return map[string]any{
-		"tools": []map[string]any{
-			{"name": "list_threads", "description": "List threads in an inbox"},
-			{"name": "get_thread", "description": "Fetch a thread with messages"},
-			{"name": "search_inbox", "description": "Semantic search over an inbox"},
-			{"name": "triage_message", "description": "Classify intent, urgency, sentiment"},
-			{"name": "extract_to_schema", "description": "Extract structured data"},
-			{"name": "draft_reply_with_policy", "description": "Draft a reply constrained by policy"},
-			{"name": "send_reply", "description": "Send a reply"},
-			{"name": "compose_email", "description": "Compose and send a new email (not a reply)"},
-		},
+// ListTools describes every tool with an inputSchema generated from its
+// argument struct. outputSchema is only sent to clients on 2025-06-18 or
+// later, the versions that receive structuredContent it can describe.
+func ListTools(version string) map[string]any {
+	list := make([]map[string]any, 0, len(toolDefinitions))
+	for _, def := range toolDefinitions {
+		tool := map[string]any{
+			"name":        def.Name,
+			"description": def.Description,
+			"inputSchema": inputSchema(def.Input),
+		}
+		if version >= Version20250618 {
+			tool["outputSchema"] = outputSchema(def.Output)
+		}
+		list = append(list, tool)
 	}
+	return map[string]any{"tools": list}
 }
 
 func ListResources() map[string]any {
 	return map[string]any{
 		"resources": []map[string]any{
 			{"uri": "email://inboxes", "description": "List inbox IDs"},
+			{"uri": auditResourceURI, "description": "Audited tool calls, oldest first; filter with ?inbox_id=, tool=, actor=, replay_id=, since=, until=, cursor= and limit="},
 		},
 	}
 }
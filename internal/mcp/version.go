@@ -0,0 +1,132 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Version20250618 introduced structuredContent in tool results. Versions are
+// dates, so they order lexically.
+const Version20250618 = "2025-06-18"
+
+// UnsupportedVersionError is returned when a client asks for a protocol
+// version the server does not speak.
+type UnsupportedVersionError struct {
+	Requested string
+	Supported []string
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("unsupported protocol version %q (supported: %s)", e.Requested, strings.Join(e.Supported, ", "))
+}
+
+type initializeParams struct {
+	ProtocolVersion string `json:"protocolVersion"`
+}
+
+type protocolVersionKey struct{}
+
+// withProtocolVersion records the session's negotiated version. An empty
+// version marks a client that never negotiated and gets the legacy shapes.
+func withProtocolVersion(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, protocolVersionKey{}, version)
+}
+
+func protocolVersionFrom(ctx context.Context) string {
+	version, _ := ctx.Value(protocolVersionKey{}).(string)
+	return version
+}
+
+// supportedVersions returns the configured versions, newest first, always
+// including the preferred one.
+func (s *Server) supportedVersions() []string {
+	versions := make([]string, 0, len(s.Config.MCP.SupportedVersions)+1)
+	for _, v := range s.Config.MCP.SupportedVersions {
+		if v = strings.TrimSpace(v); v != "" && !slices.Contains(versions, v) {
+			versions = append(versions, v)
+		}
+	}
+	if preferred := s.Config.MCP.ProtocolVersion; preferred != "" && !slices.Contains(versions, preferred) {
+		versions = append(versions, preferred)
+	}
+	slices.Sort(versions)
+	slices.Reverse(versions)
+	return versions
+}
+
+func (s *Server) supportsVersion(version string) bool {
+	return slices.Contains(s.supportedVersions(), version)
+}
+
+// negotiateVersion picks the version for an initialize request. Clients that
+// omit protocolVersion get the legacy shapes ("" negotiated) while the
+// preferred version is still advertised.
+func (s *Server) negotiateVersion(raw json.RawMessage) (string, error) {
+	var params initializeParams
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return "", err
+		}
+	}
+	requested := strings.TrimSpace(params.ProtocolVersion)
+	if requested == "" {
+		return "", nil
+	}
+	if !s.supportsVersion(requested) {
+		return "", &UnsupportedVersionError{Requested: requested, Supported: s.supportedVersions()}
+	}
+	return requested, nil
+}
+
+// advertisedVersion is the version named in responses to a session.
+func (s *Server) advertisedVersion(negotiated string) string {
+	if negotiated != "" {
+		return negotiated
+	}
+	return s.Config.MCP.ProtocolVersion
+}
+
+func (s *Server) initializeResult(version string) map[string]any {
+	capabilities := map[string]any{
+		"tools":     true,
+		"resources": true,
+	}
+	if version != "" {
+		capabilities = map[string]any{
+			"tools":     map[string]any{"listChanged": false},
+			"resources": map[string]any{"subscribe": false, "listChanged": false},
+		}
+	}
+	return map[string]any{
+		"protocolVersion": s.advertisedVersion(version),
+		"serverInfo": map[string]any{
+			"name":    "neuralmaild",
+			"version": "0.1.0",
+		},
+		"capabilities": capabilities,
+	}
+}
+
+// toolResultFor shapes a tool result for the negotiated version. Negotiated
+// sessions get MCP content blocks, plus structuredContent from 2025-06-18;
+// sessions that never negotiated keep the bare result object.
+func toolResultFor(version string, result any) any {
+	if version == "" {
+		return result
+	}
+	text, err := json.Marshal(result)
+	if err != nil {
+		text = []byte(`{}`)
+	}
+	out := map[string]any{
+		"content": []map[string]any{{"type": "text", "text": string(text)}},
+		"isError": false,
+	}
+	if version >= Version20250618 {
+		out["structuredContent"] = result
+	}
+	return out
+}
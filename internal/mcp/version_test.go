@@ -0,0 +1,134 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"neuralmail/internal/config"
+)
+
+func newVersionTestServer() *Server {
+	cfg := config.Default()
+	cfg.Dev.Mode = true
+	return NewServer(cfg, nil, nil, nil)
+}
+
+func postRPC(t *testing.T, server *Server, method string, params any, headers map[string]string) (*httptest.ResponseRecorder, Response) {
+	t.Helper()
+	body, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/mcp", bytes.NewReader(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	server.HandleHTTP(rec, req)
+	var resp Response
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+	}
+	return rec, resp
+}
+
+func TestInitializeNegotiatesRequestedVersion(t *testing.T) {
+	server := newVersionTestServer()
+	rec, resp := postRPC(t, server, "initialize", map[string]any{"protocolVersion": "2025-03-26"}, nil)
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %+v", resp.Error)
+	}
+	if got := rec.Header().Get("MCP-Protocol-Version"); got != "2025-03-26" {
+		t.Fatalf("expected negotiated header 2025-03-26, got %q", got)
+	}
+	result := resp.Result.(map[string]any)
+	if result["protocolVersion"] != "2025-03-26" {
+		t.Fatalf("expected negotiated protocolVersion, got %v", result["protocolVersion"])
+	}
+	if _, ok := result["capabilities"].(map[string]any)["tools"].(map[string]any); !ok {
+		t.Fatalf("expected object-valued capabilities for a negotiated session, got %v", result["capabilities"])
+	}
+
+	sessionID := rec.Header().Get("MCP-Session-Id")
+	rec, _ = postRPC(t, server, "tools/list", map[string]any{}, map[string]string{
+		"MCP-Session-Id":       sessionID,
+		"MCP-Protocol-Version": "2025-06-18",
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a header that differs from the negotiated version, got %d", rec.Code)
+	}
+	rec, _ = postRPC(t, server, "tools/list", map[string]any{}, map[string]string{
+		"MCP-Session-Id":       sessionID,
+		"MCP-Protocol-Version": "2025-03-26",
+	})
+	if rec.Code != http.StatusOK || rec.Header().Get("MCP-Protocol-Version") != "2025-03-26" {
+		t.Fatalf("expected 200 with negotiated header, got %d %q", rec.Code, rec.Header().Get("MCP-Protocol-Version"))
+	}
+}
+
+func TestInitializeRejectsUnsupportedVersion(t *testing.T) {
+	server := newVersionTestServer()
+	rec, resp := postRPC(t, server, "initialize", map[string]any{"protocolVersion": "2023-01-01"}, nil)
+	if resp.Error == nil || resp.Error.Code != -32602 {
+		t.Fatalf("expected -32602 error, got %+v", resp.Error)
+	}
+	data := resp.Error.Data.(map[string]any)
+	supported := data["supported"].([]any)
+	if data["requested"] != "2023-01-01" || len(supported) != 4 || supported[0] != "2025-11-25" {
+		t.Fatalf("unexpected error data: %v", data)
+	}
+	if rec.Header().Get("MCP-Session-Id") != "" {
+		t.Fatalf("expected no session for a rejected initialize")
+	}
+}
+
+func TestInitializeWithoutVersionKeepsLegacyShapes(t *testing.T) {
+	server := newVersionTestServer()
+	rec, resp := postRPC(t, server, "initialize", map[string]any{}, nil)
+	if got := rec.Header().Get("MCP-Protocol-Version"); got != "2025-11-25" {
+		t.Fatalf("expected preferred version header, got %q", got)
+	}
+	result := resp.Result.(map[string]any)
+	if result["capabilities"].(map[string]any)["tools"] != true {
+		t.Fatalf("expected legacy boolean capabilities, got %v", result["capabilities"])
+	}
+
+	rec, _ = postRPC(t, server, "tools/list", map[string]any{}, map[string]string{
+		"MCP-Session-Id":       rec.Header().Get("MCP-Session-Id"),
+		"MCP-Protocol-Version": "2099-01-01",
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unsupported header, got %d", rec.Code)
+	}
+}
+
+func TestToolResultForVersion(t *testing.T) {
+	raw := map[string]any{"threads": []any{}, "replay_id": "r-1"}
+
+	if got := toolResultFor("", raw); got.(map[string]any)["replay_id"] != "r-1" {
+		t.Fatalf("expected bare result for legacy sessions, got %v", got)
+	}
+
+	older := toolResultFor("2025-03-26", raw).(map[string]any)
+	content := older["content"].([]map[string]any)
+	if content[0]["type"] != "text" || older["isError"] != false {
+		t.Fatalf("unexpected content block: %v", older)
+	}
+	if _, ok := older["structuredContent"]; ok {
+		t.Fatalf("expected no structuredContent before 2025-06-18")
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal([]byte(content[0]["text"].(string)), &decoded); err != nil || decoded["replay_id"] != "r-1" {
+		t.Fatalf("expected JSON text content, got %v err=%v", content[0]["text"], err)
+	}
+
+	newer := toolResultFor("2025-11-25", raw).(map[string]any)
+	if newer["structuredContent"] == nil {
+		t.Fatalf("expected structuredContent from 2025-06-18 on")
+	}
+}
@@ -0,0 +1,111 @@
+// Package notify decides which channels an event reaches and how often. Orgs
+// set defaults and users override them per event type and channel; every
+// notifier resolves the preference here before sending instead of keeping a
+// toggle of its own.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"neuralmail/internal/store"
+)
+
+// Channels an event can be sent on.
+const (
+	ChannelEmail   = "email"
+	ChannelSlack   = "slack"
+	ChannelWebhook = "webhook"
+	ChannelSSE     = "sse"
+)
+
+// Frequencies: send each event as it happens, batch them into a digest, or
+// not at all.
+const (
+	Immediate = "immediate"
+	Hourly    = "hourly"
+	Daily     = "daily"
+	Off       = "off"
+)
+
+// AllEvents as an event type makes a preference cover every event.
+const AllEvents = "*"
+
+// Event types notifiers send.
+const (
+	EventThreadNudged     = "thread.nudged"
+	EventThreadAutoClosed = "thread.auto_closed"
+	EventRuleMatched      = "rule.matched"
+	EventDomainVerified   = "domain.verified"
+	EventDomainFailed     = "domain.failed"
+)
+
+// Events lists every event type, in the order the preferences center shows
+// them.
+var Events = []string{EventThreadNudged, EventThreadAutoClosed, EventRuleMatched, EventDomainVerified, EventDomainFailed}
+
+// Channels lists every channel.
+var Channels = []string{ChannelEmail, ChannelSlack, ChannelWebhook, ChannelSSE}
+
+// Webhooks and streams deliver as events happen; only the channels a person
+// reads can be batched into digests.
+var channelFrequencies = map[string][]string{
+	ChannelEmail:   {Immediate, Hourly, Daily, Off},
+	ChannelSlack:   {Immediate, Hourly, Daily, Off},
+	ChannelWebhook: {Immediate, Off},
+	ChannelSSE:     {Immediate, Off},
+}
+
+// defaultFrequencies apply where neither the org nor the user said otherwise.
+var defaultFrequencies = map[string]string{
+	ChannelEmail:   Daily,
+	ChannelSlack:   Off,
+	ChannelWebhook: Immediate,
+	ChannelSSE:     Immediate,
+}
+
+// Validate checks that p names a known event type (or AllEvents), channel and
+// a frequency the channel supports.
+func Validate(p store.NotificationPreference) error {
+	if p.EventType != AllEvents && !slices.Contains(Events, p.EventType) {
+		return fmt.Errorf("unknown event type %q", p.EventType)
+	}
+	frequencies, ok := channelFrequencies[p.Channel]
+	if !ok {
+		return fmt.Errorf("unknown channel %q", p.Channel)
+	}
+	if !slices.Contains(frequencies, p.Frequency) {
+		return fmt.Errorf("channel %s supports frequencies %v", p.Channel, frequencies)
+	}
+	return nil
+}
+
+// Resolve returns how often eventType reaches channel for userID ("" for the
+// org as a whole). The most specific preference wins: the user's for the
+// event, the user's for all events, the org's for the event, the org's for
+// all events, then the channel's default.
+func Resolve(prefs []store.NotificationPreference, userID string, eventType string, channel string) string {
+	var scopes [][2]string
+	if userID != "" {
+		scopes = append(scopes, [2]string{userID, eventType}, [2]string{userID, AllEvents})
+	}
+	scopes = append(scopes, [2]string{"", eventType}, [2]string{"", AllEvents})
+	for _, scope := range scopes {
+		for _, p := range prefs {
+			if p.UserID == scope[0] && p.EventType == scope[1] && p.Channel == channel {
+				return p.Frequency
+			}
+		}
+	}
+	return defaultFrequencies[channel]
+}
+
+// Lookup resolves the preference from the org's stored ones.
+func Lookup(ctx context.Context, st *store.Store, orgID string, userID string, eventType string, channel string) (string, error) {
+	prefs, err := st.ListNotificationPreferences(ctx, orgID, userID)
+	if err != nil {
+		return "", err
+	}
+	return Resolve(prefs, userID, eventType, channel), nil
+}
@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"slices"
+	"testing"
+
+	"neuralmail/internal/store"
+	"neuralmail/internal/webhooks"
+)
+
+func TestResolvePrefersMostSpecific(t *testing.T) {
+	prefs := []store.NotificationPreference{
+		{UserID: "", EventType: AllEvents, Channel: ChannelEmail, Frequency: Hourly},
+		{UserID: "", EventType: EventThreadAutoClosed, Channel: ChannelEmail, Frequency: Off},
+		{UserID: "u1", EventType: AllEvents, Channel: ChannelEmail, Frequency: Immediate},
+		{UserID: "u2", EventType: EventThreadNudged, Channel: ChannelEmail, Frequency: Daily},
+	}
+	cases := []struct {
+		user, event, channel, want string
+	}{
+		{"", EventThreadNudged, ChannelEmail, Hourly},
+		{"", EventThreadAutoClosed, ChannelEmail, Off},
+		{"u1", EventThreadAutoClosed, ChannelEmail, Immediate},
+		{"u2", EventThreadNudged, ChannelEmail, Daily},
+		{"u2", EventThreadAutoClosed, ChannelEmail, Off},
+		{"u3", EventThreadNudged, ChannelEmail, Hourly},
+		{"u1", EventThreadNudged, ChannelWebhook, Immediate},
+		{"u1", EventThreadNudged, ChannelSlack, Off},
+	}
+	for _, tc := range cases {
+		if got := Resolve(prefs, tc.user, tc.event, tc.channel); got != tc.want {
+			t.Errorf("Resolve(%q, %q, %q) = %q, want %q", tc.user, tc.event, tc.channel, got, tc.want)
+		}
+	}
+}
+
+func TestValidateRejectsDigestForWebhooks(t *testing.T) {
+	ok := store.NotificationPreference{EventType: AllEvents, Channel: ChannelEmail, Frequency: Daily}
+	if err := Validate(ok); err != nil {
+		t.Fatalf("expected valid preference, got %v", err)
+	}
+	for _, p := range []store.NotificationPreference{
+		{EventType: EventThreadNudged, Channel: ChannelWebhook, Frequency: Daily},
+		{EventType: "thread.unknown", Channel: ChannelEmail, Frequency: Daily},
+		{EventType: AllEvents, Channel: "pager", Frequency: Immediate},
+	} {
+		if err := Validate(p); err == nil {
+			t.Errorf("expected %+v to be rejected", p)
+		}
+	}
+}
+
+func TestEventsHaveWebhookSchemas(t *testing.T) {
+	for _, event := range Events {
+		if !slices.Contains(webhooks.EventTypes(), event) {
+			t.Errorf("%s has no webhook schema", event)
+		}
+	}
+}
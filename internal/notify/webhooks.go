@@ -0,0 +1,120 @@
+package notify
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/google/uuid"
+
+	"neuralmail/internal/queue"
+	"neuralmail/internal/store"
+	"neuralmail/internal/webhooks"
+)
+
+// Webhooks delivers events to an org's webhook endpoints, as long as the
+// org's webhook preference for the event is Immediate. With Queue set,
+// PublishLater leaves the delivery to a worker.
+type Webhooks struct {
+	Sender *webhooks.Sender
+	Queue  JobQueue
+}
+
+// JobQueue accepts webhook delivery jobs; *queue.Queue implements it.
+type JobQueue interface {
+	Push(ctx context.Context, name string, job queue.Job) error
+}
+
+// Delivery is the payload of a webhook delivery job: Publish's arguments
+// other than the store, which is the worker's home store.
+type Delivery struct {
+	OrgID     string          `json:"org_id"`
+	EventType string          `json:"event_type"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func NewWebhooks() *Webhooks {
+	return &Webhooks{Sender: webhooks.NewSender()}
+}
+
+// PublishLater queues the event for a worker to Publish, and publishes it
+// straight away when no Queue is set.
+func (n *Webhooks) PublishLater(ctx context.Context, st *store.Store, orgID string, eventType string, data any) error {
+	if n.Queue == nil {
+		_, err := n.Publish(ctx, st, orgID, eventType, data)
+		return err
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	job, err := queue.NewPayloadJob(queue.OriginIngest, Delivery{OrgID: orgID, EventType: eventType, Data: raw})
+	if err != nil {
+		return err
+	}
+	return n.Queue.Push(ctx, queue.QueueName(queue.TypeWebhookDelivery), job)
+}
+
+// Publish sends one event with data to every active endpoint of the org and
+// records each attempt, returning how many endpoints acknowledged it. data is
+// given in eventType's newest schema and rendered in each endpoint's pinned
+// version. A receiver that fails is left to redelivery rather than failing
+// the caller.
+func (n *Webhooks) Publish(ctx context.Context, st *store.Store, orgID string, eventType string, data any) (int, error) {
+	frequency, err := Lookup(ctx, st, orgID, "", eventType, ChannelWebhook)
+	if err != nil || frequency != Immediate {
+		return 0, err
+	}
+	endpoints, err := st.ListWebhookEndpoints(ctx, orgID)
+	if err != nil || len(endpoints) == 0 {
+		return 0, err
+	}
+
+	// One event, rendered once for each version the org's endpoints are
+	// pinned to.
+	eventID := "evt_" + uuid.NewString()
+	created := n.Sender.Now()
+	payloads := map[string][]byte{}
+
+	delivered := 0
+	for _, ep := range endpoints {
+		if ep.Status != "active" {
+			continue
+		}
+		payload, ok := payloads[ep.APIVersion]
+		if !ok {
+			event, err := webhooks.NewEvent(eventID, eventType, ep.APIVersion, created, data)
+			if err != nil {
+				return delivered, err
+			}
+			if payload, err = json.Marshal(event); err != nil {
+				return delivered, err
+			}
+			payloads[ep.APIVersion] = payload
+		}
+		result := n.Sender.Send(ctx, ep.URL, ep.SigningSecret, eventID, eventType, payload)
+		record := store.WebhookDelivery{
+			EndpointID:   ep.ID,
+			OrgID:        orgID,
+			EventID:      eventID,
+			EventType:    eventType,
+			Payload:      payload,
+			Attempt:      1,
+			ResponseBody: result.ResponseBody,
+			DurationMS:   int(result.Duration.Milliseconds()),
+		}
+		if result.StatusCode > 0 {
+			record.ResponseCode = sql.NullInt64{Int64: int64(result.StatusCode), Valid: true}
+		}
+		if result.Err != nil {
+			record.ErrorMessage = result.Err.Error()
+		}
+		if _, err := st.RecordWebhookDelivery(ctx, record); err != nil {
+			return delivered, err
+		}
+		if result.Delivered() {
+			delivered++
+		}
+	}
+	return delivered, nil
+}
@@ -1,21 +1,21 @@
 package observability
 
 import (
-	"log"
+	"log/slog"
 	"sync"
 )
 
 type EntitlementObserver struct {
-	logger *log.Logger
+	logger *slog.Logger
 
 	mu         sync.Mutex
 	denyCounts map[string]int64
 	warned80   map[string]bool
 }
 
-func NewEntitlementObserver(logger *log.Logger) *EntitlementObserver {
+func NewEntitlementObserver(logger *slog.Logger) *EntitlementObserver {
 	if logger == nil {
-		logger = log.Default()
+		logger = slog.Default()
 	}
 	return &EntitlementObserver{
 		logger:     logger,
@@ -32,7 +32,7 @@ func (o *EntitlementObserver) RecordAllow(orgID string, reason string, used int6
 	if limit > 0 {
 		utilization = float64(used) / float64(limit)
 	}
-	o.logger.Printf("entitlements allow org_id=%s reason=%s used=%d limit=%d utilization=%.4f", orgID, reason, used, limit, utilization)
+	o.logger.Info("entitlements allow", "org_id", orgID, "reason", reason, "used", used, "limit", limit, "utilization", utilization)
 
 	if utilization >= 0.8 {
 		o.mu.Lock()
@@ -42,7 +42,7 @@ func (o *EntitlementObserver) RecordAllow(orgID string, reason string, used int6
 		}
 		o.mu.Unlock()
 		if !alreadyWarned {
-			o.logger.Printf("entitlements warning org_id=%s threshold=0.80 used=%d limit=%d", orgID, used, limit)
+			o.logger.Warn("entitlements near limit", "org_id", orgID, "threshold", 0.8, "used", used, "limit", limit)
 		}
 	}
 }
@@ -56,10 +56,10 @@ func (o *EntitlementObserver) RecordDeny(orgID string, reason string) {
 	count := o.denyCounts[orgID]
 	o.mu.Unlock()
 
-	o.logger.Printf("entitlements deny org_id=%s reason=%s count=%d", orgID, reason, count)
+	o.logger.Info("entitlements deny", "org_id", orgID, "reason", reason, "count", count)
 
 	// Basic alert hook for repeated spikes in deny events.
 	if count%10 == 0 {
-		o.logger.Printf("entitlements alert org_id=%s reason=%s repeated_deny_count=%d", orgID, reason, count)
+		o.logger.Warn("entitlements repeated denies", "org_id", orgID, "reason", reason, "repeated_deny_count", count)
 	}
 }
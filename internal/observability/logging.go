@@ -0,0 +1,125 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/config"
+)
+
+type logAttrsContextKey struct{}
+
+// SetupLogging makes a logger built from cfg.Log the default for both slog
+// and the log package, so every module logs through it. Its level can be
+// changed later with SetLogLevel.
+func SetupLogging(cfg config.Config) error {
+	if err := SetLogLevel(cfg.Log.Level); err != nil {
+		return err
+	}
+	logger, err := newLogger(os.Stderr, &logLevel, cfg.Log.Format)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	log.SetFlags(0)
+	return nil
+}
+
+// logLevel is the level of the default logger.
+var logLevel slog.LevelVar
+
+// SetLogLevel changes the level of the logger SetupLogging installed, for
+// a config reload.
+func SetLogLevel(level string) error {
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	logLevel.Set(lvl)
+	return nil
+}
+
+// NewLogger returns a logger writing level and above to w as text or json.
+// Records logged with a context carry the org_id and actor of its principal
+// and the attributes added by WithLogAttrs.
+func NewLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	return newLogger(w, lvl, format)
+}
+
+func parseLevel(level string) (slog.Level, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return lvl, fmt.Errorf("log.level %q: %w", level, err)
+	}
+	return lvl, nil
+}
+
+func newLogger(w io.Writer, level slog.Leveler, format string) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("log.format %q: want text or json", format)
+	}
+	return slog.New(contextHandler{handler}), nil
+}
+
+// WithLogAttrs returns a copy of ctx whose log records also carry args,
+// given as for slog.Logger.With, e.g. "tool", name.
+func WithLogAttrs(ctx context.Context, args ...any) context.Context {
+	attrs, _ := ctx.Value(logAttrsContextKey{}).([]slog.Attr)
+	record := slog.NewRecord(time.Time{}, 0, "", 0)
+	record.Add(args...)
+	merged := make([]slog.Attr, 0, len(attrs)+record.NumAttrs())
+	merged = append(merged, attrs...)
+	record.Attrs(func(a slog.Attr) bool {
+		merged = append(merged, a)
+		return true
+	})
+	return context.WithValue(ctx, logAttrsContextKey{}, merged)
+}
+
+// contextHandler adds what the record's context knows about the request.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx != nil {
+		if principal, ok := auth.PrincipalFromContext(ctx); ok {
+			if principal.OrgID != "" {
+				r.AddAttrs(slog.String("org_id", principal.OrgID))
+			}
+			if principal.ActorID != "" {
+				r.AddAttrs(slog.String("actor", principal.ActorID))
+			}
+		}
+		if attrs, ok := ctx.Value(logAttrsContextKey{}).([]slog.Attr); ok {
+			r.AddAttrs(attrs...)
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,71 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"neuralmail/internal/auth"
+)
+
+func TestLoggerAddsContextFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, "info", "json")
+	if err != nil {
+		t.Fatalf("new logger: %v", err)
+	}
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{OrgID: "org-1", ActorID: "agent-7"})
+	ctx = WithLogAttrs(ctx, "session_id", "sess-1")
+	ctx = WithLogAttrs(ctx, "tool", "send_reply", "replay_id", "r-1")
+	logger.DebugContext(ctx, "dropped below level")
+	logger.InfoContext(ctx, "tool call failed", "err", "boom")
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected one json record, got %q: %v", buf.String(), err)
+	}
+	want := map[string]string{
+		"msg": "tool call failed", "err": "boom", "org_id": "org-1", "actor": "agent-7",
+		"session_id": "sess-1", "tool": "send_reply", "replay_id": "r-1",
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Fatalf("expected %s=%q, got %v", key, value, record[key])
+		}
+	}
+}
+
+func TestNewLoggerRejectsUnknownSettings(t *testing.T) {
+	if _, err := NewLogger(&bytes.Buffer{}, "loud", "text"); err == nil {
+		t.Fatalf("expected unknown level to be rejected")
+	}
+	if _, err := NewLogger(&bytes.Buffer{}, "info", "xml"); err == nil {
+		t.Fatalf("expected unknown format to be rejected")
+	}
+}
+
+func TestSetLogLevelChangesTheDefaultLogger(t *testing.T) {
+	defer logLevel.Set(logLevel.Level())
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, &logLevel, "text")
+	if err != nil {
+		t.Fatalf("new logger: %v", err)
+	}
+	if err := SetLogLevel("warn"); err != nil {
+		t.Fatalf("set level: %v", err)
+	}
+	logger.Info("quiet")
+	if err := SetLogLevel("debug"); err != nil {
+		t.Fatalf("set level: %v", err)
+	}
+	logger.Debug("loud")
+	if got := buf.String(); strings.Contains(got, "quiet") || !strings.Contains(got, "loud") {
+		t.Fatalf("expected only the record after lowering the level, got %q", got)
+	}
+	if err := SetLogLevel("verbose"); err == nil || logLevel.Level() != slog.LevelDebug {
+		t.Fatalf("expected an unknown level to be refused and the level kept, got %v at %v", err, logLevel.Level())
+	}
+}
@@ -0,0 +1,90 @@
+// Package orgpurge carries out requested org deletions once their grace
+// period is over. The worker runs it periodically: a due org first loses
+// the raw message copies it keeps in the object store and its vector
+// points, then its Postgres rows in the transaction that writes the
+// deletion receipt. A purge that fails partway is retried on the next run.
+package orgpurge
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"neuralmail/internal/store"
+	"neuralmail/internal/vector"
+)
+
+// Objects removes object-store keys; *objectstore.Client satisfies it.
+type Objects interface {
+	Delete(ctx context.Context, key string) error
+}
+
+// Index removes vector points; vector.Store satisfies it.
+type Index interface {
+	Delete(ctx context.Context, filter map[string]any) error
+}
+
+// Purger works through the due org deletions of a store. Objects is nil
+// where no object store is configured.
+type Purger struct {
+	Objects   Objects
+	BatchSize int
+	Now       func() time.Time
+}
+
+func New() *Purger {
+	return &Purger{
+		BatchSize: 10,
+		Now:       func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Run purges every org in st whose deletion is due, removing its points
+// from index, which may be nil.
+func (p *Purger) Run(ctx context.Context, st *store.Store, index Index) (int, error) {
+	purged := 0
+	for {
+		due, err := st.ListDueOrgDeletions(ctx, p.Now(), p.BatchSize)
+		if err != nil {
+			return purged, err
+		}
+		for _, d := range due {
+			receipt, err := p.purge(ctx, st, index, d)
+			if err != nil {
+				return purged, err
+			}
+			purged++
+			slog.InfoContext(ctx, "org purged", "org", d.OrgID, "rows", receipt.Rows,
+				"objects", receipt.Objects, "vector_inboxes", receipt.VectorInboxes)
+		}
+		if len(due) < p.BatchSize {
+			return purged, nil
+		}
+	}
+}
+
+func (p *Purger) purge(ctx context.Context, st *store.Store, index Index, d store.OrgDeletion) (store.OrgPurgeReceipt, error) {
+	receipt := store.OrgPurgeReceipt{OrgID: d.OrgID, RequestedBy: d.RequestedBy, RequestedAt: d.RequestedAt}
+	inboxIDs, keys, err := st.OrgPurgeTargets(ctx, d.OrgID)
+	if err != nil {
+		return receipt, err
+	}
+	if len(keys) > 0 && p.Objects == nil {
+		slog.WarnContext(ctx, "org purge left raw objects: no object store configured", "org", d.OrgID, "objects", len(keys))
+	} else if len(keys) > 0 {
+		for _, key := range keys {
+			if err := p.Objects.Delete(ctx, key); err != nil {
+				return receipt, err
+			}
+		}
+		receipt.Objects = len(keys)
+	}
+	if len(inboxIDs) > 0 && index != nil {
+		if err := index.Delete(ctx, vector.MatchAny("inbox_id", inboxIDs)); err != nil {
+			return receipt, err
+		}
+		receipt.VectorInboxes = len(inboxIDs)
+	}
+	receipt.PurgedAt = p.Now()
+	return st.PurgeOrg(ctx, receipt)
+}
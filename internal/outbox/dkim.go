@@ -0,0 +1,134 @@
+package outbox
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"neuralmail/internal/domains"
+	"neuralmail/internal/store"
+)
+
+// DKIMKeys finds the active key of a sending domain; *store.Store
+// implements it.
+type DKIMKeys interface {
+	GetOrgDomainForSending(ctx context.Context, domain string) (store.OrgDomain, error)
+}
+
+// DKIMSigner signs outbound mail with the active DKIM key of its From
+// domain, so a rotated key takes over without a restart. Mail from a
+// domain without a key goes out unsigned.
+type DKIMSigner struct {
+	Keys          DKIMKeys
+	EncryptionKey []byte
+	Now           func() time.Time
+}
+
+// signedHeaders are the headers a signature covers, when present.
+var signedHeaders = []string{"From", "To", "Subject", "Message-ID", "In-Reply-To", "References"}
+
+// Sign returns the DKIM-Signature header line for a message with headers
+// ("Name: value" lines) and body, or "" when from's domain has no key.
+func (s *DKIMSigner) Sign(ctx context.Context, from string, headers []string, body string) (string, error) {
+	domain := strings.ToLower(heloDomain(from))
+	d, err := s.Keys.GetOrgDomainForSending(ctx, domain)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (!d.DKIMPrivateKeyEnc.Valid || d.DKIMSelector == "")) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	key, err := s.privateKey(d.DKIMPrivateKeyEnc.String)
+	if err != nil {
+		return "", fmt.Errorf("dkim key of %s: %w", domain, err)
+	}
+
+	var names, canonical []string
+	for _, name := range signedHeaders {
+		for _, h := range headers {
+			if n, _, ok := strings.Cut(h, ":"); ok && strings.EqualFold(strings.TrimSpace(n), name) {
+				names = append(names, strings.ToLower(name))
+				canonical = append(canonical, relaxedHeader(h))
+				break
+			}
+		}
+	}
+	bodyHash := sha256.Sum256([]byte(relaxedBody(body)))
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	value := "v=1; a=rsa-sha256; c=relaxed/relaxed; d=" + domain + "; s=" + d.DKIMSelector +
+		"; t=" + strconv.FormatInt(now().Unix(), 10) + "; h=" + strings.Join(names, ":") +
+		"; bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]) + "; b="
+	signed := strings.Join(canonical, "\r\n") + "\r\n" + relaxedHeader("DKIM-Signature: "+value)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return "DKIM-Signature: " + value + base64.StdEncoding.EncodeToString(sig), nil
+}
+
+func (s *DKIMSigner) privateKey(enc string) (*rsa.PrivateKey, error) {
+	plain, err := domains.DecryptDKIMKey(enc, s.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(plain))
+	if block == nil {
+		return nil, errors.New("no PEM block")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA key")
+	}
+	return key, nil
+}
+
+// relaxedHeader canonicalizes a header line per RFC 6376 3.4.2: lowercase
+// name, unfolded value with whitespace runs collapsed and trimmed.
+func relaxedHeader(h string) string {
+	name, value, _ := strings.Cut(h, ":")
+	value = strings.NewReplacer("\r\n", "", "\n", "").Replace(value)
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.Join(strings.Fields(value), " ")
+}
+
+// relaxedBody canonicalizes a body per RFC 6376 3.4.4: whitespace runs
+// collapsed, trailing whitespace and trailing empty lines dropped, lines
+// ending in CRLF.
+func relaxedBody(body string) string {
+	lines := strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		collapsed := strings.Join(strings.Fields(line), " ")
+		if line != "" && (line[0] == ' ' || line[0] == '\t') && collapsed != "" {
+			collapsed = " " + collapsed
+		}
+		lines[i] = collapsed
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
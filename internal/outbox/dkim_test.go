@@ -0,0 +1,106 @@
+package outbox
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"neuralmail/internal/domains"
+	"neuralmail/internal/store"
+)
+
+// The example of RFC 6376 section 3.4.5.
+func TestRelaxedCanonicalization(t *testing.T) {
+	if got := relaxedHeader("A: X"); got != "a:X" {
+		t.Fatalf("got %q", got)
+	}
+	if got := relaxedHeader("B : Y\t\r\n\tZ  "); got != "b:Y Z" {
+		t.Fatalf("got %q", got)
+	}
+	if got := relaxedBody(" C \r\nD \t E\r\n\r\n\r\n"); got != " C\r\nD E\r\n" {
+		t.Fatalf("got %q", got)
+	}
+	if got := relaxedBody("\n\n"); got != "" {
+		t.Fatalf("expected an empty body to stay empty, got %q", got)
+	}
+}
+
+type domainKeys map[string]store.OrgDomain
+
+func (k domainKeys) GetOrgDomainForSending(ctx context.Context, domain string) (store.OrgDomain, error) {
+	d, ok := k[domain]
+	if !ok {
+		return d, sql.ErrNoRows
+	}
+	return d, nil
+}
+
+func TestDKIMSignerSignsWithTheActiveKey(t *testing.T) {
+	privatePEM, publicPEM, err := domains.GenerateDKIMKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encKey := []byte(strings.Repeat("k", 32))
+	enc, err := domains.EncryptDKIMKey(privatePEM, encKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &DKIMSigner{
+		Keys: domainKeys{"acme.test": {
+			Domain:            "acme.test",
+			DKIMSelector:      "nerve20261015",
+			DKIMPrivateKeyEnc: sql.NullString{String: enc, Valid: true},
+		}},
+		EncryptionKey: encKey,
+		Now:           func() time.Time { return time.Unix(1760000000, 0) },
+	}
+	headers := []string{"From: support@acme.test", "To: jane@example.com", "Subject: Your  order", "Message-ID: <1@acme.test>"}
+	body := "Hello Jane,\n\nIt shipped.  \n\n"
+	ctx := context.Background()
+
+	sig, err := signer.Sign(ctx, "support@acme.test", headers, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, ok := strings.CutPrefix(sig, "DKIM-Signature: ")
+	if !ok || !strings.Contains(value, "d=acme.test; s=nerve20261015; t=1760000000; h=from:to:subject:message-id;") {
+		t.Fatalf("unexpected signature %q", sig)
+	}
+
+	// Verify as a receiver would, from the published key.
+	unsigned, b64, _ := strings.Cut(value, "; b=")
+	sigBytes, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode([]byte(publicPEM))
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var canonical []string
+	for _, h := range headers {
+		canonical = append(canonical, relaxedHeader(h))
+	}
+	signed := strings.Join(canonical, "\r\n") + "\r\n" + relaxedHeader("DKIM-Signature: "+unsigned+"; b=")
+	digest := sha256.Sum256([]byte(signed))
+	if err := rsa.VerifyPKCS1v15(pub.(*rsa.PublicKey), crypto.SHA256, digest[:], sigBytes); err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+	bodyHash := sha256.Sum256([]byte("Hello Jane,\r\n\r\nIt shipped.\r\n"))
+	if !strings.Contains(unsigned, "bh="+base64.StdEncoding.EncodeToString(bodyHash[:])) {
+		t.Fatalf("unexpected body hash in %q", unsigned)
+	}
+
+	if sig, err := signer.Sign(ctx, "dev@local.neuralmail", headers, body); err != nil || sig != "" {
+		t.Fatalf("expected mail from a domain without a key to go unsigned, got %q %v", sig, err)
+	}
+}
@@ -0,0 +1,73 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"neuralmail/internal/store"
+)
+
+// Kinds of Event.
+const (
+	EventDelivered  = "delivered"
+	EventDeferred   = "deferred"
+	EventBounced    = "bounced"
+	EventComplained = "complained"
+)
+
+// Event is a provider's report on a message it sent: delivered to the
+// recipient's server, deferred, bounced or complained about. Permanent marks
+// a hard bounce.
+type Event struct {
+	Transport         string
+	ProviderMessageID string
+	Kind              string
+	Recipient         string
+	Permanent         bool
+	Detail            string
+}
+
+// ApplyEvent records ev against the delivery it reports on, in st. A hard
+// bounce or complaint suppresses the recipient, as the same report by mail
+// would; a soft bounce or deferral only notes the detail, since the
+// provider keeps retrying. It reports false when st sent no such message,
+// which is how the caller tells which region's store the event belongs to.
+func ApplyEvent(ctx context.Context, st *store.Store, ev Event) (bool, error) {
+	if ev.ProviderMessageID == "" {
+		return false, nil
+	}
+	delivery, err := st.GetOutboxByProviderMessageID(ctx, ev.Transport, ev.ProviderMessageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	detail := ev.Detail
+	if detail == "" {
+		detail = ev.Kind
+	}
+
+	var status, reason string
+	switch {
+	case ev.Kind == EventDelivered:
+		return true, st.MarkOutboxDelivered(ctx, delivery.ID)
+	case ev.Kind == EventComplained:
+		status, reason = store.DeliveryComplained, store.SuppressComplaint
+	case ev.Kind == EventBounced && ev.Permanent:
+		status, reason = store.DeliveryBounced, store.SuppressHardBounce
+	default:
+		return true, st.NoteOutboxError(ctx, delivery.ID, detail)
+	}
+	recipient := ev.Recipient
+	if recipient == "" {
+		recipient = delivery.To
+	}
+	slog.WarnContext(ctx, "outbox delivery event", "transport", ev.Transport, "kind", ev.Kind, "message", delivery.MessageID, "recipient", recipient, "detail", detail)
+	if err := st.FailOutbox(ctx, delivery.ID, status, detail); err != nil {
+		return true, err
+	}
+	return true, st.AddOrgSuppression(ctx, delivery.OrgID, recipient, reason)
+}
@@ -0,0 +1,151 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/store"
+)
+
+// Sending limits a SendLimitError reports.
+const (
+	LimitHourlyMessages  = "hourly_messages"
+	LimitDailyRecipients = "daily_recipients"
+	LimitWarmup          = "warmup"
+)
+
+var ErrSendLimitExceeded = errors.New("sending limit exceeded")
+
+// SendLimitError refuses a send that would take an org, or Domain when it
+// is set, over one of its sending limits. Used is what the limit's window
+// already holds; RetryAfterSeconds is when enough of it ages out.
+type SendLimitError struct {
+	Limit             string
+	Domain            string
+	Allowed           int
+	Used              int
+	RetryAfterSeconds int
+}
+
+func (e *SendLimitError) Error() string {
+	scope := "the org"
+	if e.Domain != "" {
+		scope = e.Domain
+	}
+	switch e.Limit {
+	case LimitHourlyMessages:
+		return fmt.Sprintf("sending limit exceeded: %s sent %d of its %d messages this hour", scope, e.Used, e.Allowed)
+	case LimitWarmup:
+		return fmt.Sprintf("sending limit exceeded: %s is warming up and mailed %d of its %d recipients today", scope, e.Used, e.Allowed)
+	default:
+		return fmt.Sprintf("sending limit exceeded: %s mailed %d of its %d recipients today", scope, e.Used, e.Allowed)
+	}
+}
+
+func (e *SendLimitError) Is(target error) bool { return target == ErrSendLimitExceeded }
+
+// SendLimits are the caps a send is held to; 0 is unlimited. Warmup is a
+// new domain's recipients-per-day cap for today.
+type SendLimits struct {
+	HourlyMessages  int
+	DailyRecipients int
+	Warmup          int
+}
+
+// Override returns l with the limits own sets replacing it.
+func (l SendLimits) Override(own store.SendLimits) SendLimits {
+	if own.HourlyMessages.Valid {
+		l.HourlyMessages = int(own.HourlyMessages.Int64)
+	}
+	if own.DailyRecipients.Valid {
+		l.DailyRecipients = int(own.DailyRecipients.Int64)
+	}
+	return l
+}
+
+// Check returns a *SendLimitError if one more message to recipients
+// recipients would take v over l.
+func (l SendLimits) Check(domain string, v store.OutboundVolume, recipients int) error {
+	if l.HourlyMessages > 0 && v.HourlyMessages+1 > l.HourlyMessages {
+		return &SendLimitError{Limit: LimitHourlyMessages, Domain: domain, Allowed: l.HourlyMessages, Used: v.HourlyMessages, RetryAfterSeconds: v.HourlyResetSeconds}
+	}
+	if l.DailyRecipients > 0 && v.DailyRecipients+recipients > l.DailyRecipients {
+		return &SendLimitError{Limit: LimitDailyRecipients, Domain: domain, Allowed: l.DailyRecipients, Used: v.DailyRecipients, RetryAfterSeconds: v.DailyResetSeconds}
+	}
+	if l.Warmup > 0 && v.DailyRecipients+recipients > l.Warmup {
+		return &SendLimitError{Limit: LimitWarmup, Domain: domain, Allowed: l.Warmup, Used: v.DailyRecipients, RetryAfterSeconds: v.DailyResetSeconds}
+	}
+	return nil
+}
+
+// WarmupCap returns the recipients per day schedule allows a domain whose
+// warm-up started at started, and when that cap next rises. ok is false
+// once the schedule has run out, or if it is empty.
+func WarmupCap(schedule []int, started time.Time, now time.Time) (limit int, next time.Time, ok bool) {
+	if started.IsZero() {
+		return 0, time.Time{}, false
+	}
+	day := int(now.Sub(started) / (24 * time.Hour))
+	if day < 0 {
+		day = 0
+	}
+	if day >= len(schedule) {
+		return 0, time.Time{}, false
+	}
+	return schedule[day], started.Add(time.Duration(day+1) * 24 * time.Hour), true
+}
+
+// CheckSendLimits refuses a message to recipients recipients from from
+// once orgID is at its sending limits, or from's domain, if it is one of
+// the org's, at its own or its warm-up cap. Limits are read from dir, the
+// org's settings store, and volume from st, where its outbox lives.
+func CheckSendLimits(ctx context.Context, cfg config.Config, dir *store.Store, st *store.Store, orgID string, from string, recipients int) error {
+	limits := SendLimits{HourlyMessages: cfg.Outbound.HourlyMessages, DailyRecipients: cfg.Outbound.DailyRecipients}
+	if orgID != "" {
+		own, err := dir.GetOrgSendLimits(ctx, orgID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		limits = limits.Override(own)
+	}
+	if limits.HourlyMessages > 0 || limits.DailyRecipients > 0 {
+		v, err := st.OutboundVolume(ctx, orgID, "")
+		if err != nil {
+			return err
+		}
+		if err := limits.Check("", v, recipients); err != nil {
+			return err
+		}
+	}
+
+	domain := strings.ToLower(from[strings.LastIndex(from, "@")+1:])
+	own, err := dir.ActiveDomainSendLimits(ctx, orgID, domain)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	limits = SendLimits{}.Override(own.SendLimits)
+	var rises time.Time
+	limits.Warmup, rises, _ = WarmupCap(cfg.Outbound.Warmup, own.WarmupStartedAt.Time, time.Now())
+	if limits == (SendLimits{}) {
+		return nil
+	}
+	v, err := st.OutboundVolume(ctx, orgID, domain)
+	if err != nil {
+		return err
+	}
+	err = limits.Check(domain, v, recipients)
+	// The warm-up cap may rise before the day's mail ages out.
+	var limitErr *SendLimitError
+	if errors.As(err, &limitErr) && limitErr.Limit == LimitWarmup {
+		limitErr.RetryAfterSeconds = min(limitErr.RetryAfterSeconds, int(time.Until(rises).Seconds())+1)
+	}
+	return err
+}
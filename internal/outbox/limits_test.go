@@ -0,0 +1,64 @@
+package outbox
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"neuralmail/internal/store"
+)
+
+func TestWarmupCap(t *testing.T) {
+	schedule := []int{50, 100, 250}
+	started := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		now  time.Time
+		want int
+		next time.Time
+		ok   bool
+	}{
+		{started.Add(time.Hour), 50, started.Add(24 * time.Hour), true},
+		{started.Add(47 * time.Hour), 100, started.Add(48 * time.Hour), true},
+		{started.Add(50 * time.Hour), 250, started.Add(72 * time.Hour), true},
+		{started.Add(72 * time.Hour), 0, time.Time{}, false},
+	} {
+		got, next, ok := WarmupCap(schedule, started, c.now)
+		if got != c.want || !next.Equal(c.next) || ok != c.ok {
+			t.Fatalf("at %v: expected %d until %v (%v), got %d until %v (%v)", c.now, c.want, c.next, c.ok, got, next, ok)
+		}
+	}
+	if _, _, ok := WarmupCap(schedule, time.Time{}, started); ok {
+		t.Fatal("expected no warm-up for a domain that never went active")
+	}
+	if _, _, ok := WarmupCap(nil, started, started); ok {
+		t.Fatal("expected an empty schedule to turn warm-up off")
+	}
+}
+
+func TestSendLimitsCheck(t *testing.T) {
+	limits := SendLimits{HourlyMessages: 10, DailyRecipients: 100}.Override(store.SendLimits{
+		DailyRecipients: sql.NullInt64{Int64: 0, Valid: true},
+	})
+	if limits.HourlyMessages != 10 || limits.DailyRecipients != 0 {
+		t.Fatalf("expected the org's 0 to lift the daily default, got %+v", limits)
+	}
+	volume := store.OutboundVolume{HourlyMessages: 9, DailyRecipients: 500, HourlyResetSeconds: 120, DailyResetSeconds: 7200}
+	if err := limits.Check("", volume, 1); err != nil {
+		t.Fatalf("expected the tenth message of the hour to pass, got %v", err)
+	}
+	volume.HourlyMessages = 10
+	var limitErr *SendLimitError
+	if err := limits.Check("", volume, 1); !errors.As(err, &limitErr) || limitErr.Limit != LimitHourlyMessages || limitErr.RetryAfterSeconds != 120 {
+		t.Fatalf("expected the hourly limit, got %v", err)
+	}
+
+	warming := SendLimits{Warmup: 50}
+	if err := warming.Check("acme.test", store.OutboundVolume{DailyRecipients: 49, DailyResetSeconds: 60}, 1); err != nil {
+		t.Fatalf("expected the fiftieth recipient to pass, got %v", err)
+	}
+	err := warming.Check("acme.test", store.OutboundVolume{DailyRecipients: 50, DailyResetSeconds: 60}, 1)
+	if !errors.Is(err, ErrSendLimitExceeded) || !errors.As(err, &limitErr) || limitErr.Limit != LimitWarmup || limitErr.Domain != "acme.test" {
+		t.Fatalf("expected the warm-up cap, got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package outbox
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/store"
+)
+
+const localDomain = "local.neuralmail"
+
+// FromAddress is the address outbound mail is sent from.
+func FromAddress(cfg config.Config) string {
+	if cfg.SMTP.From != "" {
+		return cfg.SMTP.From
+	}
+	return "dev@" + localDomain
+}
+
+// CheckRecipient applies the outbound policy in cfg.Security to to: mail
+// outside the local domain needs allow_outbound, and a non-empty
+// outbound_domain_allowlist must list the recipient's domain.
+func CheckRecipient(cfg config.Config, to string) error {
+	if !cfg.Security.AllowOutbound && !strings.HasSuffix(to, "@"+localDomain) {
+		return errors.New("outbound disabled for non-local domains")
+	}
+	if len(cfg.Security.OutboundDomainAllowlist) > 0 && !domainAllowed(to, cfg.Security.OutboundDomainAllowlist) {
+		return errors.New("recipient domain not allowlisted")
+	}
+	return nil
+}
+
+func domainAllowed(addr string, allowlist []string) bool {
+	parts := strings.Split(addr, "@")
+	if len(parts) != 2 {
+		return false
+	}
+	domain := strings.ToLower(parts[1])
+	for _, allowed := range allowlist {
+		if strings.ToLower(strings.TrimSpace(allowed)) == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// NewMessageID returns a Message-ID for an outbound message in the sender's
+// domain. Bounces and complaints quote it back to us.
+func NewMessageID(from string) string {
+	domain := localDomain
+	if at := strings.LastIndexByte(from, '@'); at >= 0 && at < len(from)-1 {
+		domain = from[at+1:]
+	}
+	return fmt.Sprintf("<%s@%s>", uuid.NewString(), domain)
+}
+
+// ReplyHeaders returns the In-Reply-To and References for a reply to parent,
+// per RFC 5322: the parent's References (or In-Reply-To) plus its own ID.
+func ReplyHeaders(parent store.Message) (string, []string) {
+	if parent.InternetMessageID == "" {
+		return "", nil
+	}
+	refs := parent.References
+	if len(refs) == 0 && parent.InReplyTo != "" {
+		refs = []string{parent.InReplyTo}
+	}
+	return parent.InternetMessageID, append(slices.Clone(refs), parent.InternetMessageID)
+}
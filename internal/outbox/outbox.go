@@ -0,0 +1,253 @@
+// Package outbox delivers queued outbound mail through the SMTP relay or a
+// provider API. Tools store a message and queue it; the worker calls Deliver
+// for each store, and failed attempts are retried with exponential backoff.
+// The providers' delivery events move sent mail on to delivered, bounced or
+// complained.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/store"
+)
+
+// claimLease is how long a claimed entry stays hidden from other workers
+// before it counts as abandoned and is retried.
+const claimLease = 5 * time.Minute
+
+// Deliverer works through the due entries of an outbox, sending each
+// through the transport its org or domain picked, Default otherwise.
+type Deliverer struct {
+	Transports      map[string]Transport
+	Default         string
+	Selector        TransportSelector
+	MaxAttempts     int
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	BatchSize       int
+	Now             func() time.Time
+}
+
+func NewDeliverer(cfg config.Config) *Deliverer {
+	return &Deliverer{
+		Transports:      NewTransports(cfg),
+		Default:         cfg.Outbound.Transport,
+		MaxAttempts:     cfg.SMTP.MaxAttempts,
+		RetryBackoff:    cfg.SMTP.RetryBackoff,
+		MaxRetryBackoff: cfg.SMTP.MaxRetryBackoff,
+		BatchSize:       20,
+		Now:             func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Deliver sends the entries of st that are due and records each outcome. It
+// returns how many entries it attempted.
+func (d *Deliverer) Deliver(ctx context.Context, st *store.Store) (int, error) {
+	due, err := st.ClaimDueOutbox(ctx, d.BatchSize, claimLease)
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range due {
+		var providerMessageID string
+		transport, sendErr := d.transport(ctx, m)
+		if sendErr == nil {
+			providerMessageID, sendErr = transport.Send(ctx, m)
+		}
+		status, next := d.outcome(m.Attempts, sendErr)
+		switch status {
+		case store.DeliverySent:
+			err = st.MarkOutboxSent(ctx, m.ID, transport.Name(), providerMessageID)
+		case store.DeliveryQueued:
+			slog.WarnContext(ctx, "outbox delivery failed, retrying", "message", m.MessageID, "attempt", m.Attempts, "retry_at", next.Format(time.RFC3339), "err", sendErr)
+			err = st.RetryOutbox(ctx, m.ID, next, sendErr.Error())
+		default:
+			slog.ErrorContext(ctx, "outbox delivery gave up", "message", m.MessageID, "status", status, "attempts", m.Attempts, "err", sendErr)
+			err = st.FailOutbox(ctx, m.ID, status, sendErr.Error())
+		}
+		if err != nil {
+			return len(due), err
+		}
+	}
+	return len(due), nil
+}
+
+// transport returns the transport m goes out through. A transport picked
+// without credentials configured fails the attempt, which is retried, so
+// fixing the configuration lets the mail through.
+func (d *Deliverer) transport(ctx context.Context, m store.OutboxMessage) (Transport, error) {
+	name := d.Default
+	if name == "" {
+		name = TransportSMTP
+	}
+	if d.Selector != nil {
+		picked, err := d.Selector.OutboundTransport(ctx, m.OrgID, heloDomain(m.From))
+		if err != nil {
+			return nil, fmt.Errorf("outbound transport lookup: %w", err)
+		}
+		if picked != "" {
+			name = picked
+		}
+	}
+	t, ok := d.Transports[name]
+	if !ok {
+		return nil, fmt.Errorf("outbound transport %q is not configured", name)
+	}
+	return t, nil
+}
+
+// outcome maps the result of an entry's attempt-th attempt to its next
+// status and, while it stays queued, when to try again.
+func (d *Deliverer) outcome(attempt int, sendErr error) (string, time.Time) {
+	switch {
+	case sendErr == nil:
+		return store.DeliverySent, time.Time{}
+	case Permanent(sendErr):
+		return store.DeliveryBounced, time.Time{}
+	case d.MaxAttempts > 0 && attempt >= d.MaxAttempts:
+		return store.DeliveryFailed, time.Time{}
+	default:
+		return store.DeliveryQueued, d.Now().Add(Backoff(attempt, d.RetryBackoff, d.MaxRetryBackoff))
+	}
+}
+
+// Backoff is the wait after the attempt-th failed attempt: base, doubling
+// with each attempt, capped at max.
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	if base <= 0 {
+		base = time.Second
+	}
+	wait := base
+	for i := 1; i < attempt; i++ {
+		wait *= 2
+		if max > 0 && wait >= max {
+			return max
+		}
+	}
+	if max > 0 && wait > max {
+		return max
+	}
+	return wait
+}
+
+// Permanent reports whether the relay rejected the message for good (a 5xx
+// reply) or a provider API refused it, so retrying cannot help.
+func Permanent(err error) bool {
+	var protoErr *textproto.Error
+	var providerErr *ProviderError
+	return (errors.As(err, &protoErr) && protoErr.Code >= 500) || (errors.As(err, &providerErr) && providerErr.Rejected)
+}
+
+// SMTPSender delivers through the configured SMTP relay, DKIM-signing
+// through DKIM when it is set.
+type SMTPSender struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	DKIM     *DKIMSigner
+}
+
+func NewSMTPSender(cfg config.Config) *SMTPSender {
+	return &SMTPSender{
+		Host:     cfg.SMTP.Host,
+		Port:     cfg.SMTP.Port,
+		Username: cfg.SMTP.Username,
+		Password: cfg.SMTP.Password,
+	}
+}
+
+func (s *SMTPSender) Name() string { return TransportSMTP }
+
+// Send relays m. The relay's queue ID is not exposed by net/smtp, so no
+// provider message ID comes back; bounces are matched by Message-ID instead.
+func (s *SMTPSender) Send(ctx context.Context, m store.OutboxMessage) (string, error) {
+	return "", s.send(ctx, m)
+}
+
+func (s *SMTPSender) send(ctx context.Context, m store.OutboxMessage) error {
+	host := s.Host
+	if host == "" {
+		host = "localhost"
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(s.Port))
+	from, to := m.From, m.To
+	msg := rawMessage(ctx, s.DKIM, m)
+	helo := heloDomain(from)
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Quit()
+	if err := client.Hello(helo); err != nil {
+		return err
+	}
+	if (s.Username != "" || s.Password != "") && supportsAuth(client) {
+		auth := smtp.PlainAuth("", s.Username, s.Password, host)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write([]byte(msg)); err != nil {
+		_ = writer.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// rawMessage is m as an RFC 5322 message, DKIM-signed through signer when
+// it is set. A key that cannot be used is not worth holding the mail back
+// for: it goes out unsigned, as it would without a key.
+func rawMessage(ctx context.Context, signer *DKIMSigner, m store.OutboxMessage) string {
+	headers := messageHeaders(m)
+	if signer != nil {
+		sig, err := signer.Sign(ctx, m.From, headers, m.Body)
+		if err != nil {
+			slog.WarnContext(ctx, "dkim signing failed", "message", m.MessageID, "err", err)
+		} else if sig != "" {
+			headers = append([]string{sig}, headers...)
+		}
+	}
+	return strings.Join(append(headers, "", m.Body), "\r\n")
+}
+
+func heloDomain(addr string) string {
+	parts := strings.Split(addr, "@")
+	if len(parts) == 2 && parts[1] != "" {
+		return parts[1]
+	}
+	return "local.neuralmail"
+}
+
+func supportsAuth(client *smtp.Client) bool {
+	ok, _ := client.Extension("AUTH")
+	return ok
+}
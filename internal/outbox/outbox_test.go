@@ -0,0 +1,45 @@
+package outbox
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"neuralmail/internal/store"
+)
+
+func TestBackoffDoublesUpToMax(t *testing.T) {
+	base, max := 30*time.Second, 5*time.Minute
+	want := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i, expected := range want {
+		if got := Backoff(i+1, base, max); got != expected {
+			t.Fatalf("attempt %d: expected %s, got %s", i+1, expected, got)
+		}
+	}
+}
+
+func TestOutcomeClassifiesFailures(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	d := &Deliverer{MaxAttempts: 3, RetryBackoff: time.Minute, MaxRetryBackoff: time.Hour, Now: func() time.Time { return now }}
+
+	if status, _ := d.outcome(1, nil); status != store.DeliverySent {
+		t.Fatalf("expected sent, got %s", status)
+	}
+	status, next := d.outcome(2, errors.New("dial tcp: connection refused"))
+	if status != store.DeliveryQueued || !next.Equal(now.Add(2*time.Minute)) {
+		t.Fatalf("expected retry in 2m, got %s at %s", status, next)
+	}
+	if status, _ := d.outcome(3, errors.New("i/o timeout")); status != store.DeliveryFailed {
+		t.Fatalf("expected failed after max attempts, got %s", status)
+	}
+	rejected := fmt.Errorf("rcpt: %w", &textproto.Error{Code: 550, Msg: "no such user"})
+	if status, _ := d.outcome(1, rejected); status != store.DeliveryBounced {
+		t.Fatalf("expected bounced for 5xx, got %s", status)
+	}
+	deferred := &textproto.Error{Code: 451, Msg: "try again later"}
+	if status, _ := d.outcome(1, deferred); status != store.DeliveryQueued {
+		t.Fatalf("expected 4xx to be retried, got %s", status)
+	}
+}
@@ -0,0 +1,89 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"neuralmail/internal/store"
+)
+
+// Postmark API error codes that refuse a message for good.
+const (
+	postmarkInvalidRequest    = 300
+	postmarkInactiveRecipient = 406
+)
+
+// PostmarkTransport sends through the Postmark email API on MessageStream,
+// which signs with the DKIM keys set up in Postmark.
+type PostmarkTransport struct {
+	ServerToken   string
+	MessageStream string
+	// BaseURL overrides https://api.postmarkapp.com.
+	BaseURL string
+	Client  *http.Client
+}
+
+func (t *PostmarkTransport) Name() string { return TransportPostmark }
+
+type postmarkHeader struct {
+	Name  string `json:"Name"`
+	Value string `json:"Value"`
+}
+
+func (t *PostmarkTransport) Send(ctx context.Context, m store.OutboxMessage) (string, error) {
+	var headers []postmarkHeader
+	for _, h := range messageHeaders(m) {
+		name, value, _ := strings.Cut(h, ": ")
+		switch name {
+		case "Message-ID", "In-Reply-To", "References":
+			headers = append(headers, postmarkHeader{Name: name, Value: value})
+		}
+	}
+	body, err := json.Marshal(map[string]any{
+		"From":          m.From,
+		"To":            m.To,
+		"Subject":       m.Subject,
+		"TextBody":      m.Body,
+		"Headers":       headers,
+		"MessageStream": t.MessageStream,
+	})
+	if err != nil {
+		return "", err
+	}
+	base := t.BaseURL
+	if base == "" {
+		base = "https://api.postmarkapp.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(base, "/")+"/email", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Postmark-Server-Token", t.ServerToken)
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		MessageID string `json:"MessageID"`
+		ErrorCode int    `json:"ErrorCode"`
+		Message   string `json:"Message"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	_ = json.Unmarshal(raw, &out)
+	if resp.StatusCode != http.StatusOK || out.ErrorCode != 0 {
+		msg := out.Message
+		if msg == "" {
+			msg = strings.TrimSpace(string(raw))
+		}
+		rejected := out.ErrorCode == postmarkInvalidRequest || out.ErrorCode == postmarkInactiveRecipient
+		return "", &ProviderError{Provider: TransportPostmark, StatusCode: resp.StatusCode, Message: msg, Rejected: rejected}
+	}
+	return out.MessageID, nil
+}
@@ -0,0 +1,85 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"neuralmail/internal/store"
+)
+
+// SendGridTransport sends through the SendGrid v3 mail send API, which
+// signs with the DKIM keys set up in SendGrid.
+type SendGridTransport struct {
+	APIKey string
+	// BaseURL overrides https://api.sendgrid.com.
+	BaseURL string
+	Client  *http.Client
+}
+
+func (t *SendGridTransport) Name() string { return TransportSendGrid }
+
+// Send posts m and returns the X-Message-Id SendGrid answers with; its
+// events carry it as the prefix of sg_message_id.
+func (t *SendGridTransport) Send(ctx context.Context, m store.OutboxMessage) (string, error) {
+	headers := map[string]string{}
+	for _, h := range messageHeaders(m) {
+		name, value, _ := strings.Cut(h, ": ")
+		switch name {
+		case "Message-ID", "In-Reply-To", "References":
+			headers[name] = value
+		}
+	}
+	payload := map[string]any{
+		"personalizations": []any{map[string]any{"to": []any{map[string]string{"email": m.To}}}},
+		"from":             map[string]string{"email": m.From},
+		"subject":          m.Subject,
+		"content":          []any{map[string]string{"type": "text/plain", "value": m.Body}},
+	}
+	if len(headers) > 0 {
+		payload["headers"] = headers
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	base := t.BaseURL
+	if base == "" {
+		base = "https://api.sendgrid.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(base, "/")+"/v3/mail/send", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+t.APIKey)
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		var out struct {
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		msg := strings.TrimSpace(string(raw))
+		if json.Unmarshal(raw, &out) == nil && len(out.Errors) > 0 {
+			msgs := make([]string, 0, len(out.Errors))
+			for _, e := range out.Errors {
+				msgs = append(msgs, e.Message)
+			}
+			msg = strings.Join(msgs, "; ")
+		}
+		// 400 and 413 refuse the message itself; 401, 403 and 429 are
+		// about the account and may clear up.
+		rejected := resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusRequestEntityTooLarge
+		return "", &ProviderError{Provider: TransportSendGrid, StatusCode: resp.StatusCode, Message: msg, Rejected: rejected}
+	}
+	return resp.Header.Get("X-Message-Id"), nil
+}
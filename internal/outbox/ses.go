@@ -0,0 +1,163 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"neuralmail/internal/store"
+)
+
+// SESTransport sends raw messages through the Amazon SES v2 API, signed
+// with AWS Signature Version 4. Mail is DKIM-signed through DKIM first when
+// it is set, as over SMTP; SES adds its own signature for domains it
+// verified.
+type SESTransport struct {
+	Region           string
+	AccessKeyID      string
+	SecretAccessKey  string
+	ConfigurationSet string
+	// Endpoint overrides https://email.{Region}.amazonaws.com.
+	Endpoint string
+	Client   *http.Client
+	DKIM     *DKIMSigner
+	Now      func() time.Time
+}
+
+func (t *SESTransport) Name() string { return TransportSES }
+
+func (t *SESTransport) Send(ctx context.Context, m store.OutboxMessage) (string, error) {
+	payload := map[string]any{
+		"Content": map[string]any{
+			"Raw": map[string]any{"Data": base64.StdEncoding.EncodeToString([]byte(rawMessage(ctx, t.DKIM, m)))},
+		},
+	}
+	if t.ConfigurationSet != "" {
+		payload["ConfigurationSetName"] = t.ConfigurationSet
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	endpoint := t.Endpoint
+	if endpoint == "" {
+		endpoint = "https://email." + t.Region + ".amazonaws.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/v2/email/outbound-emails", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	now := time.Now
+	if t.Now != nil {
+		now = t.Now
+	}
+	signV4(req, body, t.Region, "ses", t.AccessKeyID, t.SecretAccessKey, now())
+
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		MessageID string `json:"MessageId"`
+		Message   string `json:"message"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	_ = json.Unmarshal(raw, &out)
+	if resp.StatusCode != http.StatusOK {
+		// MessageRejected covers content SES refuses and recipients or
+		// senders it will not accept; anything else may clear up.
+		errorType, _, _ := strings.Cut(resp.Header.Get("X-Amzn-Errortype"), ":")
+		msg := out.Message
+		if msg == "" {
+			msg = strings.TrimSpace(string(raw))
+		}
+		if errorType != "" {
+			msg = errorType + ": " + msg
+		}
+		return "", &ProviderError{Provider: TransportSES, StatusCode: resp.StatusCode, Message: msg, Rejected: errorType == "MessageRejected"}
+	}
+	return out.MessageID, nil
+}
+
+// signV4 signs req, whose payload is body, with AWS Signature Version 4 for
+// service in region, over its Content-Type, Host and X-Amz-Date headers.
+func signV4(req *http.Request, body []byte, region, service, accessKeyID, secretAccessKey string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	payloadHash := sha256.Sum256(body)
+	headers := map[string]string{
+		"content-type": strings.TrimSpace(req.Header.Get("Content-Type")),
+		"host":         req.URL.Host,
+		"x-amz-date":   amzDate,
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// canonicalQuery sorts and encodes query parameters the way SigV4 wants
+// them: spaces as %20, not +.
+func canonicalQuery(values url.Values) string {
+	var pairs []string
+	for name, vals := range values {
+		for _, v := range vals {
+			pairs = append(pairs, awsEscape(name)+"="+awsEscape(v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,101 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/store"
+)
+
+// Transport names, as outbound.transport and the org and domain settings
+// take them.
+const (
+	TransportSMTP     = "smtp"
+	TransportSES      = "ses"
+	TransportSendGrid = "sendgrid"
+	TransportPostmark = "postmark"
+)
+
+// TransportNames lists every transport.
+var TransportNames = []string{TransportSMTP, TransportSES, TransportSendGrid, TransportPostmark}
+
+// Transport hands one message to a mail provider. It returns the ID the
+// provider gave the message, which its delivery events quote, or "" when
+// the provider gives none.
+type Transport interface {
+	Name() string
+	Send(ctx context.Context, m store.OutboxMessage) (string, error)
+}
+
+// TransportSelector returns the transport an org picked for its mail from
+// domain, "" for the default; *store.Store implements it.
+type TransportSelector interface {
+	OutboundTransport(ctx context.Context, orgID string, domain string) (string, error)
+}
+
+// ProviderError is a provider API's refusal of a message. Rejected is set
+// when the provider refused this message for good, such as for an invalid
+// or inactive recipient, so resending cannot help; other refusals, bad
+// credentials and rate limits among them, are retried.
+type ProviderError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+	Rejected   bool
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s: status %d: %s", e.Provider, e.StatusCode, e.Message)
+}
+
+// NewTransports returns the transports cfg has credentials for. SMTP is
+// always among them.
+func NewTransports(cfg config.Config) map[string]Transport {
+	client := &http.Client{Timeout: cfg.Outbound.Timeout}
+	if client.Timeout <= 0 {
+		client.Timeout = 30 * time.Second
+	}
+	transports := map[string]Transport{TransportSMTP: NewSMTPSender(cfg)}
+	if cfg.Outbound.SESRegion != "" && cfg.Outbound.SESAccessKeyID != "" && cfg.Outbound.SESSecretAccessKey != "" {
+		transports[TransportSES] = &SESTransport{
+			Region:           cfg.Outbound.SESRegion,
+			AccessKeyID:      cfg.Outbound.SESAccessKeyID,
+			SecretAccessKey:  cfg.Outbound.SESSecretAccessKey,
+			ConfigurationSet: cfg.Outbound.SESConfigurationSet,
+			Client:           client,
+		}
+	}
+	if cfg.Outbound.SendGridAPIKey != "" {
+		transports[TransportSendGrid] = &SendGridTransport{APIKey: cfg.Outbound.SendGridAPIKey, Client: client}
+	}
+	if cfg.Outbound.PostmarkServerToken != "" {
+		transports[TransportPostmark] = &PostmarkTransport{
+			ServerToken:   cfg.Outbound.PostmarkServerToken,
+			MessageStream: cfg.Outbound.PostmarkMessageStream,
+			Client:        client,
+		}
+	}
+	return transports
+}
+
+// messageHeaders are the headers every transport sends with m.
+func messageHeaders(m store.OutboxMessage) []string {
+	headers := []string{
+		"From: " + m.From,
+		"To: " + m.To,
+		"Subject: " + m.Subject,
+	}
+	if m.InternetMessageID != "" {
+		headers = append(headers, "Message-ID: "+m.InternetMessageID)
+	}
+	if m.InReplyTo != "" {
+		headers = append(headers, "In-Reply-To: "+m.InReplyTo)
+	}
+	if m.References != "" {
+		headers = append(headers, "References: "+m.References)
+	}
+	return headers
+}
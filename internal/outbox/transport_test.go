@@ -0,0 +1,171 @@
+package outbox
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"neuralmail/internal/store"
+)
+
+func TestSignV4MatchesAWSExample(t *testing.T) {
+	// The GET ListUsers example from the AWS Signature Version 4 docs.
+	req := httptest.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signV4(req, nil, "us-east-1", "iam", "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, " +
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Fatalf("unexpected authorization:\n got %s\nwant %s", got, want)
+	}
+}
+
+var testOutboxMessage = store.OutboxMessage{
+	MessageID:         "m1",
+	InternetMessageID: "<m1@acme.test>",
+	InReplyTo:         "<p@example.com>",
+	From:              "support@acme.test",
+	To:                "ann@example.com",
+	Subject:           "Order 42",
+	Body:              "It shipped.",
+}
+
+func TestTransportsCaptureProviderMessageID(t *testing.T) {
+	var got map[string]any
+	var gotHeader http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		body, _ := io.ReadAll(r.Body)
+		got = nil
+		_ = json.Unmarshal(body, &got)
+		switch r.URL.Path {
+		case "/v2/email/outbound-emails":
+			_, _ = w.Write([]byte(`{"MessageId": "ses-1"}`))
+		case "/v3/mail/send":
+			w.Header().Set("X-Message-Id", "sg-1")
+			w.WriteHeader(http.StatusAccepted)
+		case "/email":
+			_, _ = w.Write([]byte(`{"ErrorCode": 0, "Message": "OK", "MessageID": "pm-1"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	ses := &SESTransport{Region: "us-east-1", AccessKeyID: "AK", SecretAccessKey: "secret", ConfigurationSet: "events", Endpoint: srv.URL, Client: srv.Client()}
+	if id, err := ses.Send(ctx, testOutboxMessage); err != nil || id != "ses-1" {
+		t.Fatalf("ses: %q %v", id, err)
+	}
+	if !strings.HasPrefix(gotHeader.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AK/") || got["ConfigurationSetName"] != "events" {
+		t.Fatalf("ses: unsigned or without configuration set: %v %v", gotHeader, got)
+	}
+	raw, _ := base64.StdEncoding.DecodeString(got["Content"].(map[string]any)["Raw"].(map[string]any)["Data"].(string))
+	if !strings.Contains(string(raw), "Message-ID: <m1@acme.test>\r\n") || !strings.HasSuffix(string(raw), "\r\n\r\nIt shipped.") {
+		t.Fatalf("ses: unexpected raw message %q", raw)
+	}
+
+	sg := &SendGridTransport{APIKey: "key", BaseURL: srv.URL, Client: srv.Client()}
+	if id, err := sg.Send(ctx, testOutboxMessage); err != nil || id != "sg-1" {
+		t.Fatalf("sendgrid: %q %v", id, err)
+	}
+	if gotHeader.Get("Authorization") != "Bearer key" || got["headers"].(map[string]any)["In-Reply-To"] != "<p@example.com>" {
+		t.Fatalf("sendgrid: unexpected request %v %v", gotHeader, got)
+	}
+
+	pm := &PostmarkTransport{ServerToken: "token", MessageStream: "outbound", BaseURL: srv.URL, Client: srv.Client()}
+	if id, err := pm.Send(ctx, testOutboxMessage); err != nil || id != "pm-1" {
+		t.Fatalf("postmark: %q %v", id, err)
+	}
+	if gotHeader.Get("X-Postmark-Server-Token") != "token" || got["MessageStream"] != "outbound" || got["To"] != "ann@example.com" {
+		t.Fatalf("postmark: unexpected request %v %v", gotHeader, got)
+	}
+}
+
+func TestProviderRefusalsClassified(t *testing.T) {
+	status, body := 0, ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/email/outbound-emails" {
+			w.Header().Set("X-Amzn-Errortype", body)
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"message": "refused"}`))
+			return
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	ses := &SESTransport{Region: "us-east-1", Endpoint: srv.URL, Client: srv.Client()}
+	sg := &SendGridTransport{BaseURL: srv.URL, Client: srv.Client()}
+	pm := &PostmarkTransport{BaseURL: srv.URL, Client: srv.Client()}
+
+	cases := []struct {
+		name      string
+		transport Transport
+		status    int
+		body      string
+		permanent bool
+	}{
+		{"ses rejected", ses, http.StatusBadRequest, "MessageRejected", true},
+		{"ses throttled", ses, http.StatusTooManyRequests, "TooManyRequestsException", false},
+		{"sendgrid bad request", sg, http.StatusBadRequest, `{"errors": [{"message": "invalid email"}]}`, true},
+		{"sendgrid unauthorized", sg, http.StatusUnauthorized, `{"errors": [{"message": "bad key"}]}`, false},
+		{"postmark inactive recipient", pm, http.StatusUnprocessableEntity, `{"ErrorCode": 406, "Message": "inactive"}`, true},
+		{"postmark bad token", pm, http.StatusUnauthorized, `{"ErrorCode": 10, "Message": "bad token"}`, false},
+	}
+	for _, c := range cases {
+		status, body = c.status, c.body
+		_, err := c.transport.Send(ctx, testOutboxMessage)
+		var providerErr *ProviderError
+		if !errors.As(err, &providerErr) || providerErr.StatusCode != c.status {
+			t.Fatalf("%s: expected a provider error, got %v", c.name, err)
+		}
+		if Permanent(err) != c.permanent {
+			t.Fatalf("%s: expected permanent=%v for %v", c.name, c.permanent, err)
+		}
+	}
+}
+
+type fakeTransport struct{ name string }
+
+func (f fakeTransport) Name() string { return f.name }
+
+func (f fakeTransport) Send(context.Context, store.OutboxMessage) (string, error) { return "", nil }
+
+type fakeSelector map[string]string
+
+func (f fakeSelector) OutboundTransport(_ context.Context, orgID string, domain string) (string, error) {
+	return f[orgID+"/"+domain], nil
+}
+
+func TestDelivererPicksTransport(t *testing.T) {
+	d := &Deliverer{
+		Transports: map[string]Transport{TransportSMTP: fakeTransport{TransportSMTP}, TransportPostmark: fakeTransport{TransportPostmark}},
+		Default:    TransportSMTP,
+		Selector:   fakeSelector{"org-1/acme.test": TransportPostmark, "org-2/beta.test": TransportSES},
+	}
+	ctx := context.Background()
+	for _, c := range []struct{ org, from, want string }{
+		{"org-1", "support@acme.test", TransportPostmark},
+		{"org-1", "support@other.test", TransportSMTP},
+		{"", "dev@local.neuralmail", TransportSMTP},
+	} {
+		got, err := d.transport(ctx, store.OutboxMessage{OrgID: c.org, From: c.from})
+		if err != nil || got.Name() != c.want {
+			t.Fatalf("%s %s: expected %s, got %v %v", c.org, c.from, c.want, got, err)
+		}
+	}
+	// A transport picked without credentials fails the attempt, to be
+	// retried once it is configured.
+	if _, err := d.transport(ctx, store.OutboxMessage{OrgID: "org-2", From: "a@beta.test"}); err == nil || Permanent(err) {
+		t.Fatalf("expected a retryable error for an unconfigured transport, got %v", err)
+	}
+}
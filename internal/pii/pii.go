@@ -0,0 +1,220 @@
+// Package pii finds personal data in message text: email addresses, phone
+// numbers, payment card numbers, IBANs and government IDs.
+package pii
+
+import (
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Classes of personal data.
+const (
+	Email        = "email"
+	Phone        = "phone"
+	CreditCard   = "credit_card"
+	IBAN         = "iban"
+	GovernmentID = "government_id"
+)
+
+// Classes lists every class, in the order overlapping matches are resolved:
+// a card number is not also reported as a phone number.
+var Classes = []string{Email, CreditCard, IBAN, GovernmentID, Phone}
+
+var patterns = map[string]*regexp.Regexp{
+	Email:      regexp.MustCompile(`(?i)[a-z0-9._%+-]+@[a-z0-9-]+(?:\.[a-z0-9-]+)*\.[a-z]{2,}`),
+	CreditCard: regexp.MustCompile(`\d(?:[ -]?\d){12,18}`),
+	IBAN:       regexp.MustCompile(`[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?`),
+	// US social security numbers and UK national insurance numbers.
+	GovernmentID: regexp.MustCompile(`\d{3}-\d{2}-\d{4}|[A-CEGHJ-PR-TW-Z][A-CEGHJ-NPR-TW-Z] ?\d{2} ?\d{2} ?\d{2} ?[A-D]`),
+	Phone:        regexp.MustCompile(`\+?\(?\d[\d ().-]{6,}\d`),
+}
+
+// Finding is one piece of personal data, at text[Start:End].
+type Finding struct {
+	Class string `json:"class"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// Valid reports whether class is one of Classes.
+func Valid(class string) bool {
+	return slices.Contains(Classes, class)
+}
+
+// Detect returns the personal data in text, in order.
+func Detect(text string) []Finding {
+	var findings []Finding
+	for _, class := range Classes {
+		for _, loc := range patterns[class].FindAllStringIndex(text, -1) {
+			start, end, ok := check(class, text, loc[0], loc[1])
+			if !ok || overlaps(findings, start, end) {
+				continue
+			}
+			findings = append(findings, Finding{Class: class, Start: start, End: end})
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Start < findings[j].Start })
+	return findings
+}
+
+// Kinds returns the classes of personal data in text, in Classes order.
+func Kinds(text string) []string {
+	found := map[string]bool{}
+	for _, f := range Detect(text) {
+		found[f.Class] = true
+	}
+	var out []string
+	for _, class := range Classes {
+		if found[class] {
+			out = append(out, class)
+		}
+	}
+	return out
+}
+
+// Contains reports whether text holds personal data of class.
+func Contains(text string, class string) bool {
+	for _, f := range Detect(text) {
+		if f.Class == class {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact replaces the personal data of classes in text with a placeholder
+// naming the class, such as [EMAIL].
+func Redact(text string, classes []string) string {
+	if len(classes) == 0 {
+		return text
+	}
+	findings := Detect(text)
+	for i := len(findings) - 1; i >= 0; i-- {
+		f := findings[i]
+		if slices.Contains(classes, f.Class) {
+			text = text[:f.Start] + "[" + strings.ToUpper(f.Class) + "]" + text[f.End:]
+		}
+	}
+	return text
+}
+
+// check confirms a pattern match: it must stand apart from the words
+// around it, and numbers must pass their checksum or length rules. The
+// match may be narrowed, as for an IBAN followed by a capitalized word.
+func check(class string, text string, start int, end int) (int, int, bool) {
+	if class == IBAN {
+		for end > start && !(isolated(text, start, end) && ibanChecksum(text[start:end])) {
+			cut := strings.LastIndexByte(text[start:end], ' ')
+			if cut <= 0 {
+				return 0, 0, false
+			}
+			end = start + cut
+		}
+		return start, end, end > start
+	}
+	if class == Email {
+		return start, end, true
+	}
+	if !isolated(text, start, end) {
+		return 0, 0, false
+	}
+	match := text[start:end]
+	switch class {
+	case CreditCard:
+		return start, end, luhn(match)
+	case GovernmentID:
+		if strings.Contains(match, "-") {
+			area := match[:3]
+			return start, end, area != "000" && area != "666" && area[0] != '9' && match[4:6] != "00" && match[7:] != "0000"
+		}
+		return start, end, true
+	case Phone:
+		digits := countDigits(match)
+		return start, end, digits >= 10 && digits <= 15
+	}
+	return start, end, true
+}
+
+// isolated reports whether text[start:end] is not part of a longer word,
+// number or identifier such as a UUID.
+func isolated(text string, start int, end int) bool {
+	if start > 0 {
+		r, _ := utf8.DecodeLastRuneInString(text[:start])
+		if joins(r) {
+			return false
+		}
+	}
+	if end < len(text) {
+		r, _ := utf8.DecodeRuneInString(text[end:])
+		if joins(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func joins(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '/' || r == '@'
+}
+
+func overlaps(findings []Finding, start int, end int) bool {
+	for _, f := range findings {
+		if start < f.End && f.Start < end {
+			return true
+		}
+	}
+	return false
+}
+
+func countDigits(s string) int {
+	n := 0
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+func luhn(number string) bool {
+	sum, digits := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if digits%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits >= 13 && sum%10 == 0
+}
+
+// ibanChecksum applies the ISO 13616 mod-97 check.
+func ibanChecksum(s string) bool {
+	s = strings.ReplaceAll(s, " ", "")
+	if len(s) < 15 || len(s) > 34 {
+		return false
+	}
+	rem := 0
+	for _, c := range s[4:] + s[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			rem = (rem*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			rem = (rem*100 + int(c-'A'+10)) % 97
+		default:
+			return false
+		}
+	}
+	return rem == 1
+}
@@ -0,0 +1,44 @@
+package pii
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	text := "Reach me at ana@example.com or +1 (415) 555-0132. Card 4111 1111 1111 1111, IBAN DE89 3704 0044 0532 0130 00 Thanks, SSN 123-45-6789, NI AB 12 34 56 C."
+	got := Kinds(text)
+	want := []string{Email, CreditCard, IBAN, GovernmentID, Phone}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v in %+v", want, got, Detect(text))
+	}
+	for _, f := range Detect(text) {
+		if f.Class == IBAN && text[f.Start:f.End] != "DE89 3704 0044 0532 0130 00" {
+			t.Fatalf("expected the IBAN without the next word, got %q", text[f.Start:f.End])
+		}
+	}
+}
+
+func TestDetectIgnoresLookalikes(t *testing.T) {
+	for _, text := range []string{
+		"Order 1234 5678 9012 3456 is on its way.",              // fails the Luhn check
+		"See message 123e4567-e89b-12d3-a456-426614174000.",     // a UUID, not a phone
+		"Delivered on 2024-01-15 at 10:30.",                     // a date
+		"Reference DE00 1234 5678 9012 3456 78 is not an IBAN.", // bad checksum
+		"Invoice 000-12-3456 is paid.",                          // not a valid SSN
+	} {
+		if found := Detect(text); len(found) != 0 {
+			t.Fatalf("expected nothing in %q, got %+v", text, found)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	got := Redact("Mail ana@example.com or call 415-555-0132.", []string{Email})
+	if got != "Mail [EMAIL] or call 415-555-0132." {
+		t.Fatalf("unexpected redaction %q", got)
+	}
+	if got := Redact("Call 415-555-0132.", []string{Email, Phone}); got != "Call [PHONE]." {
+		t.Fatalf("unexpected redaction %q", got)
+	}
+}
@@ -0,0 +1,76 @@
+// Package playground backs the MCP playground: a sandbox org seeded with the
+// fixture conversations, which anyone may query through /mcp-playground
+// without credentials.
+package playground
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"neuralmail/internal/fixtures"
+	"neuralmail/internal/ingest"
+	"neuralmail/internal/mailparse"
+	"neuralmail/internal/queue"
+	"neuralmail/internal/store"
+)
+
+// OrgName names the sandbox org the playground creates.
+const OrgName = "MCP playground"
+
+// Seed makes sure the sandbox org and its inbox at address exist and returns
+// them. An empty inbox is filled with the default fixture conversations,
+// queued for embedding when embeddings is not nil; one that already holds
+// mail is left alone.
+func Seed(ctx context.Context, st *store.Store, embeddings ingest.EmbeddingQueue, address string) (orgID string, inboxID string, err error) {
+	orgID, inboxID, err = st.EnsureSandboxInbox(ctx, OrgName, address)
+	if err != nil {
+		return "", "", err
+	}
+	existing, err := st.ListThreads(ctx, inboxID, "", "", "", 1)
+	if err != nil || len(existing) > 0 {
+		return orgID, inboxID, err
+	}
+
+	opts := fixtures.Defaults()
+	opts.Inbox = address
+	threads, err := fixtures.Generate(opts)
+	if err != nil {
+		return "", "", err
+	}
+	for _, thread := range threads {
+		for _, fixture := range thread.Messages {
+			email, err := mailparse.Parse(fixture.Raw())
+			if err != nil {
+				return "", "", fmt.Errorf("fixture %s: %w", fixture.MessageID, err)
+			}
+			body := mailparse.Normalize(email.Text, email.HTML)
+			_, msgID, err := st.InsertMessageWithThread(ctx, inboxID, email.ThreadID, store.Message{
+				Direction:         fixture.Direction,
+				Subject:           email.Subject,
+				Text:              body.Text,
+				HTML:              body.HTML,
+				RawText:           body.RawText,
+				RawHTML:           body.RawHTML,
+				CreatedAt:         email.ReceivedAt,
+				ProviderMessageID: email.ID,
+				ProviderThreadID:  email.ThreadID,
+				InternetMessageID: email.InternetMsg,
+				InReplyTo:         email.InReplyTo,
+				References:        email.References,
+				From:              email.From,
+				To:                email.To,
+			})
+			if err != nil {
+				return "", "", err
+			}
+			if embeddings == nil {
+				continue
+			}
+			if err := embeddings.PushEmbeddingJob(ctx, queue.NewJob(msgID, queue.OriginIngest)); err != nil {
+				slog.ErrorContext(ctx, "playground embedding enqueue failed", "message", msgID, "err", err)
+			}
+		}
+	}
+	return orgID, inboxID, nil
+}
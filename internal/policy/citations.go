@@ -0,0 +1,237 @@
+package policy
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Values of Policy.Citations.Claims: what happens to a draft with a factual
+// sentence that cites nothing, or cites a source the draft was not given.
+// Flag only marks the draft; downgrade also holds it for approval.
+const (
+	ClaimsFlag      = "flag"
+	ClaimsDowngrade = "downgrade"
+)
+
+// Kinds of inline citation marker. A draft cites the sources of a sentence
+// by following it with [msg:<message id>] or [kb:<chunk id>].
+const (
+	CiteMessage = "msg"
+	CiteChunk   = "kb"
+)
+
+var citationMarkerRE = regexp.MustCompile(`\s*\[(msg|kb):([^\]\s]+)\]`)
+
+// Sentence is one sentence of a draft and the sources it cites. Citations
+// that name nothing the draft was given are Unresolved. Claim is set for
+// sentences that state something a source should back.
+type Sentence struct {
+	Text            string   `json:"text"`
+	Claim           bool     `json:"claim"`
+	CitedMessageIDs []string `json:"cited_message_ids"`
+	CitedChunkIDs   []string `json:"cited_chunk_ids,omitempty"`
+	Unresolved      []string `json:"unresolved_citations,omitempty"`
+}
+
+// ParseCitations splits a draft into sentences, each with the citation
+// markers that follow it, and returns the body with the markers removed.
+// Line breaks end sentences too, so a greeting on its own line is one.
+func ParseCitations(text string) (string, []Sentence) {
+	body := citationMarkerRE.ReplaceAllString(text, "")
+	var sentences []Sentence
+	var current strings.Builder
+	var cites [][2]string
+	closed := -1 // the sentence markers right after a full stop belong to
+	flush := func() {
+		if s := strings.TrimSpace(current.String()); s != "" {
+			sentences = append(sentences, Sentence{Text: s, Claim: IsClaim(s)})
+			closed = len(sentences) - 1
+			for _, c := range cites {
+				sentences[closed].cite(c[0], c[1])
+			}
+		}
+		current.Reset()
+		cites = nil
+	}
+	for _, line := range strings.Split(text, "\n") {
+		pos := 0
+		for _, m := range citationMarkerRE.FindAllStringSubmatchIndex(line, -1) {
+			writeSentences(line[pos:m[0]], &current, flush)
+			kind, id := line[m[2]:m[3]], line[m[4]:m[5]]
+			if strings.TrimSpace(current.String()) == "" && closed >= 0 {
+				sentences[closed].cite(kind, id)
+			} else {
+				cites = append(cites, [2]string{kind, id})
+			}
+			pos = m[1]
+		}
+		writeSentences(line[pos:], &current, flush)
+		flush()
+	}
+	return body, sentences
+}
+
+// writeSentences adds text to current, calling flush at the end of each
+// sentence in it.
+func writeSentences(text string, current *strings.Builder, flush func()) {
+	runes := []rune(text)
+	for i, r := range runes {
+		current.WriteRune(r)
+		if r == '.' || r == '!' || r == '?' {
+			if i+1 == len(runes) || unicode.IsSpace(runes[i+1]) {
+				flush()
+			}
+		}
+	}
+}
+
+func (s *Sentence) cite(kind, id string) {
+	ids := &s.CitedMessageIDs
+	if kind == CiteChunk {
+		ids = &s.CitedChunkIDs
+	}
+	if !slices.Contains(*ids, id) {
+		*ids = append(*ids, id)
+	}
+}
+
+// ResolveCitations moves the citations of sentences that are not among
+// messageIDs or chunkIDs, the sources the draft was given, to Unresolved.
+func ResolveCitations(sentences []Sentence, messageIDs []string, chunkIDs []string) []Sentence {
+	out := make([]Sentence, 0, len(sentences))
+	for _, s := range sentences {
+		resolved := Sentence{Text: s.Text, Claim: s.Claim, CitedMessageIDs: []string{}}
+		for _, id := range s.CitedMessageIDs {
+			if slices.Contains(messageIDs, id) {
+				resolved.CitedMessageIDs = append(resolved.CitedMessageIDs, id)
+			} else {
+				resolved.Unresolved = append(resolved.Unresolved, CiteMessage+":"+id)
+			}
+		}
+		for _, id := range s.CitedChunkIDs {
+			if slices.Contains(chunkIDs, id) {
+				resolved.CitedChunkIDs = append(resolved.CitedChunkIDs, id)
+			} else {
+				resolved.Unresolved = append(resolved.Unresolved, CiteChunk+":"+id)
+			}
+		}
+		out = append(out, resolved)
+	}
+	return out
+}
+
+var courtesyRE = regexp.MustCompile(`(?i)^(hi|hello|hey|dear|good (morning|afternoon|evening)|thanks|thank you|many thanks|best|regards|kind regards|best regards|sincerely|cheers|warmly)\b`)
+
+// IsClaim reports whether a sentence states something that needs a source:
+// anything but a greeting, a sign-off, a question or a few words.
+func IsClaim(sentence string) bool {
+	s := strings.TrimSpace(sentence)
+	if strings.HasSuffix(s, "?") || len(strings.Fields(s)) < 4 {
+		return false
+	}
+	return !courtesyRE.MatchString(s)
+}
+
+// ClaimGaps counts the claims among sentences that cite nothing that
+// resolved, and the sentences with citations that did not resolve.
+func ClaimGaps(sentences []Sentence) (uncited int, unresolved int) {
+	for _, s := range sentences {
+		if s.Claim && len(s.CitedMessageIDs)+len(s.CitedChunkIDs) == 0 {
+			uncited++
+		}
+		if len(s.Unresolved) > 0 {
+			unresolved++
+		}
+	}
+	return uncited, unresolved
+}
+
+// CheckClaims applies Citations.Claims to an evaluated draft's sentences,
+// after ResolveCitations. Blocked drafts are left alone.
+func CheckClaims(res *Result, policy Policy, sentences []Sentence) {
+	mode := policy.claimsMode()
+	if mode == "" || res.ViolationLevel == "critical" {
+		return
+	}
+	uncited, unresolved := ClaimGaps(sentences)
+	if uncited > 0 {
+		res.RiskFlags = appendUnique(res.RiskFlags, "uncited_claim")
+		res.MatchedRules = append(res.MatchedRules, uncitedClaimRule(mode).match())
+	}
+	if unresolved > 0 {
+		res.RiskFlags = appendUnique(res.RiskFlags, "unresolved_citation")
+		res.MatchedRules = append(res.MatchedRules, unresolvedCitationRule(mode).match())
+	}
+	if uncited+unresolved == 0 {
+		return
+	}
+	if mode == ClaimsDowngrade {
+		res.NeedsApproval = true
+	}
+	if res.ViolationLevel == "" {
+		res.ViolationLevel = "warning"
+	}
+}
+
+// RedactSentences applies the policy's redactions to sentences, as
+// Evaluate does to the body they came from.
+func RedactSentences(sentences []Sentence, policy Policy) []Sentence {
+	replacement := policy.Redactions.Replacement
+	if replacement == "" {
+		replacement = "[REDACTED]"
+	}
+	for _, pattern := range policy.Redactions.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			continue
+		}
+		for i := range sentences {
+			sentences[i].Text = re.ReplaceAllString(sentences[i].Text, replacement)
+		}
+	}
+	return sentences
+}
+
+// claimsMode is Citations.Claims when it is a known mode, empty otherwise.
+func (p Policy) claimsMode() string {
+	switch mode := strings.ToLower(strings.TrimSpace(p.Citations.Claims)); mode {
+	case ClaimsFlag, ClaimsDowngrade:
+		return mode
+	}
+	return ""
+}
+
+// ChecksClaims reports whether drafts under p are checked sentence by
+// sentence.
+func (p Policy) ChecksClaims() bool {
+	return p.claimsMode() != ""
+}
+
+func claimsAction(mode string) string {
+	if mode == ClaimsDowngrade {
+		return ActionApproval
+	}
+	return ActionFlag
+}
+
+func uncitedClaimRule(mode string) Rule {
+	return Rule{
+		ID:          "citations.claims",
+		Category:    CategoryCitations,
+		Action:      claimsAction(mode),
+		Description: "Every factual sentence must cite a source message or knowledge base chunk",
+		Remediation: "Cite the message or knowledge base chunk behind each statement, or remove statements nothing backs.",
+	}
+}
+
+func unresolvedCitationRule(mode string) Rule {
+	return Rule{
+		ID:          "citations.resolve",
+		Category:    CategoryCitations,
+		Action:      claimsAction(mode),
+		Description: "Citations must name messages or knowledge base chunks the draft was given",
+		Remediation: "Cite only sources from the thread context or the knowledge provided with the draft.",
+	}
+}
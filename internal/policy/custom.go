@@ -0,0 +1,252 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"neuralmail/internal/pii"
+)
+
+// Types of custom rule.
+const (
+	RuleRegex           = "regex"
+	RulePhrase          = "phrase"
+	RuleAmount          = "amount"
+	RuleRecipientDomain = "recipient_domain"
+	RulePII             = "pii"
+)
+
+// Severities of custom rule: a block stops the draft, needs_approval holds
+// it for a reviewer and warn only flags it.
+const (
+	SeverityBlock    = "block"
+	SeverityApproval = "needs_approval"
+	SeverityWarn     = "warn"
+)
+
+// MaxCustomRules caps the custom rules one policy can carry.
+const MaxCustomRules = 100
+
+const maxRulePatternLength = 512
+
+// amountRE finds money amounts written with a currency sign or code.
+var amountRE = regexp.MustCompile(`(?i)(?:[$€£]\s?(\d[\d,]*(?:\.\d+)?)|(\d[\d,]*(?:\.\d+)?)\s?(?:usd|eur|gbp|dollars?|euros?|pounds?)\b)`)
+
+// CustomRule is an org-defined check. Pattern is the regex, phrase, domain
+// or PII class the rule looks for; amount rules match amounts in the draft
+// above Threshold. Recipient domain rules match when the draft goes to the
+// domain or one of its subdomains.
+type CustomRule struct {
+	Type        string  `json:"type" yaml:"type"`
+	Pattern     string  `json:"pattern,omitempty" yaml:"pattern"`
+	Threshold   float64 `json:"threshold,omitempty" yaml:"threshold"`
+	Severity    string  `json:"severity" yaml:"severity"`
+	Description string  `json:"description,omitempty" yaml:"description"`
+}
+
+// ValidateCustomRules checks rules before they are stored, and normalizes
+// their type, severity and pattern.
+func ValidateCustomRules(rules []CustomRule) ([]CustomRule, error) {
+	if len(rules) > MaxCustomRules {
+		return nil, fmt.Errorf("at most %d rules", MaxCustomRules)
+	}
+	out := make([]CustomRule, 0, len(rules))
+	for i, rule := range rules {
+		rule.Type = strings.ToLower(strings.TrimSpace(rule.Type))
+		rule.Severity = strings.ToLower(strings.TrimSpace(rule.Severity))
+		rule.Description = strings.TrimSpace(rule.Description)
+		if rule.Type != RuleRegex {
+			rule.Pattern = strings.TrimSpace(rule.Pattern)
+		}
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		out = append(out, rule)
+	}
+	return out, nil
+}
+
+func (r CustomRule) validate() error {
+	switch r.Severity {
+	case SeverityBlock, SeverityApproval, SeverityWarn:
+	default:
+		return errors.New("severity must be block, needs_approval or warn")
+	}
+	if len(r.Pattern) > maxRulePatternLength {
+		return fmt.Errorf("pattern longer than %d characters", maxRulePatternLength)
+	}
+	switch r.Type {
+	case RuleRegex:
+		if r.Pattern == "" {
+			return errors.New("regex rule needs a pattern")
+		}
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+	case RulePhrase:
+		if r.Pattern == "" {
+			return errors.New("phrase rule needs a pattern")
+		}
+	case RuleAmount:
+		if r.Threshold <= 0 {
+			return errors.New("amount rule needs a positive threshold")
+		}
+	case RuleRecipientDomain:
+		if r.Pattern == "" || strings.ContainsAny(r.Pattern, "@/ ") || !strings.Contains(r.Pattern, ".") {
+			return errors.New("recipient_domain rule needs a domain")
+		}
+	case RulePII:
+		if !pii.Valid(strings.ToLower(r.Pattern)) {
+			return errors.New("pii rule pattern must be email, phone, credit_card, iban or government_id")
+		}
+	default:
+		return errors.New("type must be regex, phrase, amount, recipient_domain or pii")
+	}
+	return nil
+}
+
+// WithOrgRules returns a copy of the policy with an org's custom rules
+// appended to its own, recording the version of the org policy they came
+// from.
+func (p Policy) WithOrgRules(version int, rules []CustomRule) Policy {
+	out := p
+	out.Custom = append(append([]CustomRule(nil), p.Custom...), rules...)
+	out.OrgVersion = version
+	return out
+}
+
+// checkCustomRules applies the policy's custom rules to text sent to
+// recipients. It reports whether a blocking rule matched.
+func checkCustomRules(res *Result, policy Policy, text string, recipients []string) bool {
+	for _, rule := range policy.Custom {
+		if !rule.matches(text, recipients) {
+			continue
+		}
+		res.RiskFlags = appendUnique(res.RiskFlags, rule.flag())
+		res.MatchedRules = append(res.MatchedRules, rule.rule().match())
+		switch rule.Severity {
+		case SeverityBlock:
+			res.Allowed = false
+			res.ViolationLevel = "critical"
+			res.Reason = "Draft matches policy rule: " + rule.describe()
+			return true
+		case SeverityApproval:
+			res.NeedsApproval = true
+		}
+	}
+	return false
+}
+
+func (r CustomRule) matches(text string, recipients []string) bool {
+	switch r.Type {
+	case RuleRegex:
+		re, err := regexp.Compile(r.Pattern)
+		return err == nil && re.MatchString(text)
+	case RulePhrase:
+		return r.Pattern != "" && strings.Contains(strings.ToLower(text), strings.ToLower(r.Pattern))
+	case RuleAmount:
+		return r.Threshold > 0 && MaxAmount(text) > r.Threshold
+	case RuleRecipientDomain:
+		domain := strings.ToLower(strings.TrimPrefix(r.Pattern, "."))
+		for _, recipient := range recipients {
+			host := recipientDomain(recipient)
+			if host != "" && (host == domain || strings.HasSuffix(host, "."+domain)) {
+				return true
+			}
+		}
+	case RulePII:
+		return pii.Contains(text, strings.ToLower(r.Pattern))
+	}
+	return false
+}
+
+// MaxAmount is the largest money amount written in text, or 0.
+func MaxAmount(text string) float64 {
+	var largest float64
+	for _, m := range amountRE.FindAllStringSubmatch(text, -1) {
+		raw := m[1]
+		if raw == "" {
+			raw = m[2]
+		}
+		amount, err := strconv.ParseFloat(strings.ReplaceAll(raw, ",", ""), 64)
+		if err == nil && amount > largest {
+			largest = amount
+		}
+	}
+	return largest
+}
+
+func recipientDomain(recipient string) string {
+	if addr, err := mail.ParseAddress(recipient); err == nil {
+		recipient = addr.Address
+	}
+	_, domain, ok := strings.Cut(strings.TrimSpace(recipient), "@")
+	if !ok {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSuffix(domain, "."))
+}
+
+func (r CustomRule) flag() string {
+	switch r.Type {
+	case RuleAmount:
+		return "amount_over_threshold"
+	case RuleRecipientDomain:
+		return "restricted_recipient"
+	case RulePII:
+		return "contains_pii"
+	}
+	return "custom_rule"
+}
+
+func (r CustomRule) describe() string {
+	if r.Description != "" {
+		return r.Description
+	}
+	switch r.Type {
+	case RuleRegex:
+		return "Text matching " + r.Pattern
+	case RulePhrase:
+		return fmt.Sprintf("The phrase %q", r.Pattern)
+	case RuleAmount:
+		return "Amounts over " + strconv.FormatFloat(r.Threshold, 'f', -1, 64)
+	case RuleRecipientDomain:
+		return "Replies to " + r.Pattern
+	}
+	return "Personal data (" + strings.ToLower(r.Pattern) + ")"
+}
+
+func (r CustomRule) rule() Rule {
+	var id string
+	switch r.Type {
+	case RuleRegex:
+		id = "custom.regex." + shortHash(r.Pattern)
+	case RuleAmount:
+		id = "custom.amount." + strconv.FormatFloat(r.Threshold, 'f', -1, 64)
+	case RulePII:
+		id = "custom.pii." + strings.ToLower(r.Pattern)
+	default:
+		id = ruleID("custom."+r.Type, r.Pattern)
+	}
+	action := ActionFlag
+	remediation := "Review the flagged content before sending."
+	switch r.Severity {
+	case SeverityBlock:
+		action = ActionBlock
+		remediation = "Remove the content the rule matches; drafts matching it cannot be sent."
+	case SeverityApproval:
+		action = ActionApproval
+		remediation = "A reviewer must approve drafts matching this rule."
+	}
+	return Rule{
+		ID:          id,
+		Category:    CategoryCustom,
+		Action:      action,
+		Description: r.describe(),
+		Remediation: remediation,
+	}
+}
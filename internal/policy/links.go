@@ -0,0 +1,188 @@
+package policy
+
+import (
+	"bufio"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Link policy modes. "flag" routes the draft to human approval, "block"
+// refuses it outright; "off" (or empty) skips URL checks.
+const (
+	LinkModeOff   = "off"
+	LinkModeFlag  = "flag"
+	LinkModeBlock = "block"
+)
+
+var urlPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"'` + "`" + `]+`)
+
+type LinkRules struct {
+	Mode          string   `yaml:"mode"`
+	Allowlist     []string `yaml:"allowlist"`
+	Denylist      []string `yaml:"denylist"`
+	PhishingFeeds []string `yaml:"phishing_feeds"`
+
+	phishing map[string]struct{}
+}
+
+type LinkFinding struct {
+	URL  string `json:"url"`
+	Host string `json:"host"`
+	Flag string `json:"flag"`
+}
+
+// WithOrgLinkRules returns a copy of the policy with org-specific allow and
+// deny entries appended to the file-based lists.
+func (p Policy) WithOrgLinkRules(allow, deny []string) Policy {
+	out := p
+	out.Links.Allowlist = append(append([]string(nil), p.Links.Allowlist...), allow...)
+	out.Links.Denylist = append(append([]string(nil), p.Links.Denylist...), deny...)
+	return out
+}
+
+// LoadPhishingFeeds reads each feed file (one domain or URL per line, '#'
+// comments allowed) into the rule set. Missing files are reported so a
+// misconfigured feed does not silently disable protection.
+func (r *LinkRules) LoadPhishingFeeds() error {
+	for _, path := range r.PhishingFeeds {
+		if strings.TrimSpace(path) == "" {
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if host := hostOf(line); host != "" {
+				if r.phishing == nil {
+					r.phishing = make(map[string]struct{})
+				}
+				r.phishing[host] = struct{}{}
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckLinks returns one finding per URL that fails the rules. A URL is
+// reported once, with the most severe reason.
+func CheckLinks(text string, rules LinkRules) []LinkFinding {
+	mode := strings.ToLower(strings.TrimSpace(rules.Mode))
+	if mode == "" || mode == LinkModeOff {
+		return nil
+	}
+	var findings []LinkFinding
+	seen := map[string]bool{}
+	for _, raw := range urlPattern.FindAllString(text, -1) {
+		raw = strings.TrimRight(raw, ".,;:!?)]}")
+		if seen[raw] {
+			continue
+		}
+		seen[raw] = true
+		host := hostOf(raw)
+		flag := classifyLink(raw, host, rules)
+		if flag == "" {
+			continue
+		}
+		findings = append(findings, LinkFinding{URL: raw, Host: host, Flag: flag})
+	}
+	return findings
+}
+
+func classifyLink(raw, host string, rules LinkRules) string {
+	if host == "" {
+		return "link_unparseable"
+	}
+	if inDomainSet(host, rules.phishing) {
+		return "link_phishing"
+	}
+	if matchesAnyDomain(host, rules.Denylist) {
+		return "link_denylisted"
+	}
+	if len(rules.Allowlist) > 0 && matchesAnyDomain(host, rules.Allowlist) {
+		return ""
+	}
+	if suspiciousHost(raw, host) {
+		return "link_suspicious"
+	}
+	if len(rules.Allowlist) > 0 {
+		return "link_not_allowlisted"
+	}
+	return ""
+}
+
+// suspiciousHost catches common obfuscation: raw IPs, punycode look-alikes and
+// credentials smuggled before the host.
+func suspiciousHost(raw, host string) bool {
+	if net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return true
+	}
+	if strings.HasPrefix(host, "xn--") || strings.Contains(host, ".xn--") {
+		return true
+	}
+	if parsed, err := url.Parse(withScheme(raw)); err == nil && parsed.User != nil {
+		return true
+	}
+	return false
+}
+
+func matchesAnyDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "*."))
+		if domain == "" {
+			continue
+		}
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func hostOf(raw string) string {
+	parsed, err := url.Parse(withScheme(strings.TrimSpace(raw)))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+}
+
+func withScheme(raw string) string {
+	lower := strings.ToLower(raw)
+	if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		return raw
+	}
+	return "http://" + raw
+}
+
+// inDomainSet checks host and each parent domain against set, so a feed entry
+// for evil.example also covers login.evil.example.
+func inDomainSet(host string, set map[string]struct{}) bool {
+	if len(set) == 0 {
+		return false
+	}
+	for candidate := host; candidate != ""; {
+		if _, ok := set[candidate]; ok {
+			return true
+		}
+		idx := strings.Index(candidate, ".")
+		if idx < 0 {
+			break
+		}
+		candidate = candidate[idx+1:]
+	}
+	return false
+}
@@ -2,11 +2,15 @@ package policy
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"regexp"
+	"slices"
 	"strings"
 
 	"gopkg.in/yaml.v3"
+
+	"neuralmail/internal/pii"
 )
 
 type Policy struct {
@@ -26,6 +30,25 @@ type Policy struct {
 		RequiredWhen       []string `yaml:"required_when"`
 		ConfidenceThreshold float64  `yaml:"confidence_threshold"`
 	} `yaml:"approval"`
+	Links LinkRules `yaml:"links"`
+	// Citations, when required, makes generated drafts cite at least one
+	// source message from the thread; drafts that don't need approval.
+	// Claims (flag or downgrade) checks every factual sentence for a
+	// citation of content the draft was given; see CheckClaims.
+	Citations struct {
+		Required bool   `yaml:"required"`
+		Claims   string `yaml:"claims"`
+	} `yaml:"citations"`
+	// Custom are rules with their own severity, from the policy file and
+	// the org's policy; OrgVersion is the version of the org policy they
+	// include, 0 without one.
+	Custom     []CustomRule `yaml:"rules"`
+	OrgVersion int          `yaml:"-"`
+	// PII blocks drafts holding personal data of the listed pii classes,
+	// such as a card number copied from the customer's message.
+	PII struct {
+		Block []string `yaml:"block"`
+	} `yaml:"pii"`
 }
 
 type Result struct {
@@ -36,6 +59,8 @@ type Result struct {
 	RiskFlags           []string
 	NeedsApproval       bool
 	RedactionsApplied   []string
+	LinkFindings        []LinkFinding
+	MatchedRules        []Match
 }
 
 func Load(path string) (Policy, error) {
@@ -50,10 +75,27 @@ func Load(path string) (Policy, error) {
 	if err := yaml.Unmarshal(data, &p); err != nil {
 		return p, err
 	}
+	if p.Custom, err = ValidateCustomRules(p.Custom); err != nil {
+		return p, err
+	}
+	for _, class := range p.PII.Block {
+		if !pii.Valid(class) {
+			return p, fmt.Errorf("pii.block: unknown class %q", class)
+		}
+	}
+	if err := p.Links.LoadPhishingFeeds(); err != nil {
+		return p, err
+	}
 	return p, nil
 }
 
 func Evaluate(draft string, policy Policy) (string, Result) {
+	return EvaluateFor(draft, policy, nil)
+}
+
+// EvaluateFor is Evaluate for a draft addressed to recipients, which
+// recipient domain rules check.
+func EvaluateFor(draft string, policy Policy, recipients []string) (string, Result) {
 	res := Result{Allowed: true}
 	text := draft
 
@@ -66,6 +108,7 @@ func Evaluate(draft string, policy Policy) (string, Result) {
 			res.ViolationLevel = "critical"
 			res.Reason = "Draft contains forbidden phrase: " + phrase
 			res.RiskFlags = append(res.RiskFlags, "forbidden_phrase")
+			res.MatchedRules = append(res.MatchedRules, forbiddenPhraseRule(phrase).match())
 			return text, res
 		}
 	}
@@ -78,6 +121,7 @@ func Evaluate(draft string, policy Policy) (string, Result) {
 		if re.MatchString(text) {
 			res.RiskFlags = append(res.RiskFlags, "contains_sensitive_data")
 			res.RedactionsApplied = append(res.RedactionsApplied, pattern)
+			res.MatchedRules = append(res.MatchedRules, redactionRule(pattern).match())
 			replacement := policy.Redactions.Replacement
 			if replacement == "" {
 				replacement = "[REDACTED]"
@@ -91,15 +135,49 @@ func Evaluate(draft string, policy Policy) (string, Result) {
 		res.ViolationLevel = "critical"
 		res.Reason = "Draft exceeds max reply length"
 		res.RiskFlags = append(res.RiskFlags, "too_long")
+		res.MatchedRules = append(res.MatchedRules, maxLengthRule(policy.MaxReplyLength).match())
+		return text, res
+	}
+
+	for _, class := range policy.PII.Block {
+		if pii.Contains(text, class) {
+			res.Allowed = false
+			res.ViolationLevel = "critical"
+			res.Reason = "Draft contains personal data: " + class
+			res.RiskFlags = append(res.RiskFlags, "pii_leak")
+			res.MatchedRules = append(res.MatchedRules, piiRule(class).match())
+			return text, res
+		}
+	}
+
+	if checkCustomRules(&res, policy, text, recipients) {
 		return text, res
 	}
 
+	if findings := CheckLinks(text, policy.Links); len(findings) > 0 {
+		res.LinkFindings = findings
+		for _, finding := range findings {
+			if !slices.Contains(res.RiskFlags, finding.Flag) {
+				res.MatchedRules = append(res.MatchedRules, linkRule(finding.Flag, policy.Links.Mode).match())
+			}
+			res.RiskFlags = appendUnique(res.RiskFlags, finding.Flag)
+		}
+		if strings.EqualFold(policy.Links.Mode, LinkModeBlock) {
+			res.Allowed = false
+			res.ViolationLevel = "critical"
+			res.Reason = "Draft contains disallowed link: " + findings[0].URL
+			return text, res
+		}
+		res.NeedsApproval = true
+	}
+
 	for _, disclosure := range policy.RequiredDiscl {
 		if disclosure == "" {
 			continue
 		}
 		if !strings.Contains(text, disclosure) {
 			res.RiskFlags = append(res.RiskFlags, "missing_disclosure")
+			res.MatchedRules = append(res.MatchedRules, disclosureRule(disclosure).match())
 			res.NeedsApproval = true
 		}
 	}
@@ -111,3 +189,26 @@ func Evaluate(draft string, policy Policy) (string, Result) {
 	res.SuggestedRedaction = text
 	return text, res
 }
+
+// CheckCitations applies the citation rule to an evaluated draft that cites
+// cited source messages. Blocked drafts are left alone.
+func CheckCitations(res *Result, policy Policy, cited int) {
+	if !policy.Citations.Required || cited > 0 || res.ViolationLevel == "critical" {
+		return
+	}
+	res.RiskFlags = append(res.RiskFlags, "missing_citation")
+	res.MatchedRules = append(res.MatchedRules, citationRule().match())
+	res.NeedsApproval = true
+	if res.ViolationLevel == "" {
+		res.ViolationLevel = "warning"
+	}
+}
+
+func appendUnique(items []string, value string) []string {
+	for _, item := range items {
+		if item == value {
+			return items
+		}
+	}
+	return append(items, value)
+}
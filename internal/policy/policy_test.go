@@ -1,6 +1,10 @@
 package policy
 
-import "testing"
+import (
+	"testing"
+
+	"neuralmail/internal/pii"
+)
 
 func TestPolicyForbiddenPhrase(t *testing.T) {
 	p := Policy{ForbiddenPhrases: []string{"guarantee"}}
@@ -12,3 +16,235 @@ func TestPolicyForbiddenPhrase(t *testing.T) {
 		t.Fatalf("expected critical violation")
 	}
 }
+
+func TestPolicyBlocksDenylistedLink(t *testing.T) {
+	p := Policy{Links: LinkRules{Mode: LinkModeBlock, Denylist: []string{"evil.example"}}}
+	_, res := Evaluate("Reset here: https://login.evil.example/reset.", p)
+	if res.Allowed {
+		t.Fatalf("expected denylisted link to block")
+	}
+	if len(res.LinkFindings) != 1 || res.LinkFindings[0].Flag != "link_denylisted" {
+		t.Fatalf("unexpected findings: %+v", res.LinkFindings)
+	}
+}
+
+func TestPolicyFlagsLinksOutsideAllowlist(t *testing.T) {
+	p := Policy{Links: LinkRules{Mode: LinkModeFlag, Allowlist: []string{"example.com"}}}
+	_, res := Evaluate("Docs at https://docs.example.com and http://192.168.0.1/pay and www.other.test", p)
+	if !res.Allowed || !res.NeedsApproval {
+		t.Fatalf("expected flagged draft to need approval, got %+v", res)
+	}
+	flags := map[string]bool{}
+	for _, f := range res.LinkFindings {
+		flags[f.Flag] = true
+	}
+	if len(res.LinkFindings) != 2 || !flags["link_suspicious"] || !flags["link_not_allowlisted"] {
+		t.Fatalf("unexpected findings: %+v", res.LinkFindings)
+	}
+}
+
+func TestCheckLinksOff(t *testing.T) {
+	if findings := CheckLinks("http://xn--pple-43d.com", LinkRules{}); len(findings) != 0 {
+		t.Fatalf("expected no findings when mode is off")
+	}
+}
+
+func TestEvaluateReportsMatchedRules(t *testing.T) {
+	p := Policy{
+		ForbiddenPhrases: []string{"100% refund"},
+		RequiredDiscl:    []string{"Sent with AI."},
+		Links:            LinkRules{Mode: LinkModeFlag, Denylist: []string{"evil.example"}},
+	}
+	_, res := Evaluate("See https://evil.example/a and https://evil.example/b", p)
+	ids := make([]string, 0, len(res.MatchedRules))
+	for _, m := range res.MatchedRules {
+		ids = append(ids, m.RuleID)
+		if m.Remediation == "" {
+			t.Fatalf("expected remediation for %s", m.RuleID)
+		}
+	}
+	want := []string{"links.denylisted", "required_disclosure.sent-with-ai"}
+	if len(ids) != len(want) || ids[0] != want[0] || ids[1] != want[1] {
+		t.Fatalf("expected %v, got %v", want, ids)
+	}
+
+	_, res = Evaluate("We offer a 100% REFUND", p)
+	if res.Allowed || len(res.MatchedRules) != 1 || res.MatchedRules[0].RuleID != "forbidden_phrase.100-refund" {
+		t.Fatalf("expected forbidden phrase rule, got %+v", res.MatchedRules)
+	}
+}
+
+func TestRulesListsEveryMatchableRule(t *testing.T) {
+	p := Policy{
+		ForbiddenPhrases: []string{"guarantee"},
+		MaxReplyLength:   10,
+		Links:            LinkRules{Mode: LinkModeBlock},
+	}
+	p.Redactions.Patterns = []string{`\b\d{3}-\d{2}-\d{4}\b`}
+
+	byID := map[string]Rule{}
+	for _, rule := range p.Rules() {
+		byID[rule.ID] = rule
+	}
+	if byID["links.suspicious"].Action != ActionBlock || byID["max_reply_length"].Category != CategoryLength {
+		t.Fatalf("unexpected rules %+v", byID)
+	}
+
+	_, res := Evaluate("ssn 123-45-6789 is too long", p)
+	for _, m := range res.MatchedRules {
+		if _, ok := byID[m.RuleID]; !ok {
+			t.Fatalf("matched rule %s not listed by Rules", m.RuleID)
+		}
+	}
+	if len(res.MatchedRules) != 2 || res.MatchedRules[0].Category != CategoryPrivacy {
+		t.Fatalf("expected redaction and length matches, got %+v", res.MatchedRules)
+	}
+	if again := p.Rules(); again[1].ID != res.MatchedRules[0].RuleID {
+		t.Fatalf("expected stable redaction ID, got %s vs %s", again[1].ID, res.MatchedRules[0].RuleID)
+	}
+}
+
+func TestCheckCitationsRequiresApproval(t *testing.T) {
+	var p Policy
+	_, res := Evaluate("Thanks, we are on it.", p)
+	CheckCitations(&res, p, 0)
+	if res.NeedsApproval || len(res.MatchedRules) != 0 {
+		t.Fatalf("expected no citation check when not required, got %+v", res)
+	}
+
+	p.Citations.Required = true
+	_, res = Evaluate("Thanks, we are on it.", p)
+	CheckCitations(&res, p, 1)
+	if res.NeedsApproval {
+		t.Fatalf("expected a cited draft to pass, got %+v", res)
+	}
+	CheckCitations(&res, p, 0)
+	if !res.NeedsApproval || len(res.MatchedRules) != 1 || res.MatchedRules[0].RuleID != "citations.required" {
+		t.Fatalf("expected citation rule to require approval, got %+v", res)
+	}
+	if rules := p.Rules(); len(rules) != 1 || rules[0].ID != "citations.required" {
+		t.Fatalf("expected Rules to list the citation rule, got %+v", rules)
+	}
+}
+
+func TestParseCitations(t *testing.T) {
+	body, sentences := ParseCitations("Hi Ana,\nYour order shipped on Monday. [msg:m1] The refund window is 30 days [kb:refunds-1][msg:m2]. Anything else?")
+	if body != "Hi Ana,\nYour order shipped on Monday. The refund window is 30 days. Anything else?" {
+		t.Fatalf("expected markers stripped, got %q", body)
+	}
+	if len(sentences) != 4 {
+		t.Fatalf("expected 4 sentences, got %+v", sentences)
+	}
+	if sentences[0].Claim || sentences[3].Claim {
+		t.Fatalf("expected greeting and question not to be claims, got %+v", sentences)
+	}
+	if got := sentences[1].CitedMessageIDs; len(got) != 1 || got[0] != "m1" {
+		t.Fatalf("expected marker after the full stop to cite the sentence before it, got %+v", sentences[1])
+	}
+	if got := sentences[2]; len(got.CitedChunkIDs) != 1 || got.CitedChunkIDs[0] != "refunds-1" || len(got.CitedMessageIDs) != 1 {
+		t.Fatalf("expected chunk and message cites, got %+v", got)
+	}
+
+	resolved := ResolveCitations(sentences, []string{"m1"}, []string{"refunds-1"})
+	if got := resolved[2]; len(got.CitedMessageIDs) != 0 || len(got.Unresolved) != 1 || got.Unresolved[0] != "msg:m2" {
+		t.Fatalf("expected m2 unresolved, got %+v", got)
+	}
+}
+
+func TestCheckClaims(t *testing.T) {
+	_, sentences := ParseCitations("Your order shipped on Monday. [msg:m1] It will arrive by Friday at the latest.")
+	sentences = ResolveCitations(sentences, []string{"m1"}, nil)
+
+	var p Policy
+	_, res := Evaluate("", p)
+	CheckClaims(&res, p, sentences)
+	if len(res.RiskFlags) != 0 || len(p.Rules()) != 0 {
+		t.Fatalf("expected no claim check without a mode, got %+v", res)
+	}
+
+	p.Citations.Claims = ClaimsFlag
+	_, res = Evaluate("", p)
+	CheckClaims(&res, p, sentences)
+	if res.NeedsApproval || len(res.RiskFlags) != 1 || res.RiskFlags[0] != "uncited_claim" {
+		t.Fatalf("expected flag mode to only flag the uncited claim, got %+v", res)
+	}
+
+	p.Citations.Claims = ClaimsDowngrade
+	_, res = Evaluate("", p)
+	CheckClaims(&res, p, sentences)
+	if !res.NeedsApproval || len(res.MatchedRules) != 1 || res.MatchedRules[0].RuleID != "citations.claims" {
+		t.Fatalf("expected downgrade to hold the draft for approval, got %+v", res)
+	}
+	if rules := p.Rules(); len(rules) != 2 {
+		t.Fatalf("expected Rules to list the claim rules, got %+v", rules)
+	}
+}
+
+func TestCustomRuleSeverities(t *testing.T) {
+	p := Policy{Custom: []CustomRule{
+		{Type: RuleAmount, Threshold: 100, Severity: SeverityApproval},
+		{Type: RulePII, Pattern: pii.CreditCard, Severity: SeverityBlock},
+		{Type: RuleRecipientDomain, Pattern: "bigcorp.com", Severity: SeverityWarn},
+	}}
+
+	_, res := EvaluateFor("We will refund $250.00 today.", p, []string{"ana@shop.example"})
+	if !res.Allowed || !res.NeedsApproval || len(res.RiskFlags) != 1 || res.RiskFlags[0] != "amount_over_threshold" {
+		t.Fatalf("expected the amount rule to require approval, got %+v", res)
+	}
+	if res.MatchedRules[0].RuleID != "custom.amount.100" || res.MatchedRules[0].Category != CategoryCustom {
+		t.Fatalf("unexpected match %+v", res.MatchedRules)
+	}
+
+	_, res = EvaluateFor("Thanks for the update.", p, []string{"Bob <bob@eu.bigcorp.com>"})
+	if !res.Allowed || res.NeedsApproval || res.ViolationLevel != "warning" || res.RiskFlags[0] != "restricted_recipient" {
+		t.Fatalf("expected the recipient rule only to warn, got %+v", res)
+	}
+	if _, res = Evaluate("Thanks for the update.", p); len(res.RiskFlags) != 0 {
+		t.Fatalf("expected recipient rules to need recipients, got %+v", res)
+	}
+
+	_, res = Evaluate("Your card 4111 1111 1111 1111 was charged.", p)
+	if res.Allowed || res.ViolationLevel != "critical" || res.RiskFlags[0] != "contains_pii" {
+		t.Fatalf("expected the card number to block the draft, got %+v", res)
+	}
+	if _, res = Evaluate("Your tracking number is 1234 5678 9012 3456.", p); !res.Allowed {
+		t.Fatalf("expected a number failing the Luhn check to pass, got %+v", res)
+	}
+}
+
+func TestValidateCustomRules(t *testing.T) {
+	rules, err := ValidateCustomRules([]CustomRule{{Type: " Phrase ", Pattern: " act now ", Severity: "WARN"}})
+	if err != nil || rules[0].Type != RulePhrase || rules[0].Severity != SeverityWarn || rules[0].Pattern != "act now" {
+		t.Fatalf("expected a normalized rule, got %+v %v", rules, err)
+	}
+	for _, bad := range []CustomRule{
+		{Type: RuleRegex, Pattern: "(", Severity: SeverityBlock},
+		{Type: RuleAmount, Severity: SeverityBlock},
+		{Type: RulePII, Pattern: "passport", Severity: SeverityBlock},
+		{Type: RuleRecipientDomain, Pattern: "ana@bigcorp.com", Severity: SeverityBlock},
+		{Type: RulePhrase, Pattern: "x", Severity: "critical"},
+		{Type: "keyword", Pattern: "x", Severity: SeverityWarn},
+	} {
+		if _, err := ValidateCustomRules([]CustomRule{bad}); err == nil {
+			t.Fatalf("expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestMaxAmount(t *testing.T) {
+	if got := MaxAmount("A $1,250.50 credit, or 300 EUR, but not order 98765."); got != 1250.5 {
+		t.Fatalf("expected 1250.5, got %v", got)
+	}
+}
+
+func TestPIIBlock(t *testing.T) {
+	var p Policy
+	p.PII.Block = []string{pii.CreditCard}
+	_, res := Evaluate("Your card 4111-1111-1111-1111 is on file.", p)
+	if res.Allowed || res.MatchedRules[0].RuleID != "pii.credit_card" || res.RiskFlags[0] != "pii_leak" {
+		t.Fatalf("expected the card number to block the draft, got %+v", res)
+	}
+	if _, res = Evaluate("Your card ending 1111 is on file.", p); !res.Allowed {
+		t.Fatalf("expected a partial number to pass, got %+v", res)
+	}
+}
@@ -0,0 +1,206 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Rule categories.
+const (
+	CategoryContent    = "content"
+	CategoryPrivacy    = "privacy"
+	CategoryLength     = "length"
+	CategoryLinks      = "links"
+	CategoryDisclosure = "disclosure"
+	CategoryCitations  = "citations"
+	CategoryCustom     = "custom"
+)
+
+// Rule actions: what happens to a draft when the rule matches.
+const (
+	ActionBlock    = "block"
+	ActionRedact   = "redact"
+	ActionApproval = "approval"
+	ActionFlag     = "flag"
+)
+
+// Rule is one check derived from a policy. IDs are derived from the rule's
+// content, so they stay stable across reloads and reordering and change only
+// when the rule itself does.
+type Rule struct {
+	ID          string `json:"id"`
+	Category    string `json:"category"`
+	Action      string `json:"action"`
+	Description string `json:"description"`
+	Remediation string `json:"remediation"`
+}
+
+// Match records a rule that fired during Evaluate.
+type Match struct {
+	RuleID      string `json:"rule_id"`
+	Category    string `json:"category"`
+	Remediation string `json:"remediation"`
+}
+
+var linkFlags = []string{"link_phishing", "link_denylisted", "link_suspicious", "link_not_allowlisted", "link_unparseable"}
+
+// Rules lists every rule the policy enforces, in evaluation order.
+func (p Policy) Rules() []Rule {
+	var rules []Rule
+	for _, phrase := range p.ForbiddenPhrases {
+		if phrase != "" {
+			rules = append(rules, forbiddenPhraseRule(phrase))
+		}
+	}
+	for _, pattern := range p.Redactions.Patterns {
+		rules = append(rules, redactionRule(pattern))
+	}
+	if p.MaxReplyLength > 0 {
+		rules = append(rules, maxLengthRule(p.MaxReplyLength))
+	}
+	for _, class := range p.PII.Block {
+		rules = append(rules, piiRule(class))
+	}
+	for _, rule := range p.Custom {
+		rules = append(rules, rule.rule())
+	}
+	if mode := strings.ToLower(strings.TrimSpace(p.Links.Mode)); mode != "" && mode != LinkModeOff {
+		for _, flag := range linkFlags {
+			rules = append(rules, linkRule(flag, p.Links.Mode))
+		}
+	}
+	for _, disclosure := range p.RequiredDiscl {
+		if disclosure != "" {
+			rules = append(rules, disclosureRule(disclosure))
+		}
+	}
+	if p.Citations.Required {
+		rules = append(rules, citationRule())
+	}
+	if mode := p.claimsMode(); mode != "" {
+		rules = append(rules, uncitedClaimRule(mode), unresolvedCitationRule(mode))
+	}
+	return rules
+}
+
+func (r Rule) match() Match {
+	return Match{RuleID: r.ID, Category: r.Category, Remediation: r.Remediation}
+}
+
+func forbiddenPhraseRule(phrase string) Rule {
+	return Rule{
+		ID:          ruleID("forbidden_phrase", phrase),
+		Category:    CategoryContent,
+		Action:      ActionBlock,
+		Description: fmt.Sprintf("Draft must not contain %q", phrase),
+		Remediation: fmt.Sprintf("Remove or rephrase %q.", phrase),
+	}
+}
+
+func redactionRule(pattern string) Rule {
+	return Rule{
+		ID:          "redaction." + shortHash(pattern),
+		Category:    CategoryPrivacy,
+		Action:      ActionRedact,
+		Description: "Text matching " + pattern + " is redacted",
+		Remediation: "Check that the redacted draft still reads correctly, or drop the sensitive detail.",
+	}
+}
+
+func maxLengthRule(limit int) Rule {
+	return Rule{
+		ID:          "max_reply_length",
+		Category:    CategoryLength,
+		Action:      ActionBlock,
+		Description: fmt.Sprintf("Draft must be at most %d characters", limit),
+		Remediation: fmt.Sprintf("Shorten the reply to %d characters or fewer.", limit),
+	}
+}
+
+func linkRule(flag string, mode string) Rule {
+	action := ActionApproval
+	if strings.EqualFold(mode, LinkModeBlock) {
+		action = ActionBlock
+	}
+	rule := Rule{
+		ID:       "links." + strings.TrimPrefix(flag, "link_"),
+		Category: CategoryLinks,
+		Action:   action,
+	}
+	switch flag {
+	case "link_phishing":
+		rule.Description = "Links to domains on a phishing feed"
+		rule.Remediation = "Remove the link; the domain is a known phishing host."
+	case "link_denylisted":
+		rule.Description = "Links to denylisted domains"
+		rule.Remediation = "Remove the link or point to an allowed domain."
+	case "link_suspicious":
+		rule.Description = "Links to raw IPs, punycode hosts or URLs with embedded credentials"
+		rule.Remediation = "Replace the link with a plain URL on a recognizable domain."
+	case "link_not_allowlisted":
+		rule.Description = "Links to domains outside the allowlist"
+		rule.Remediation = "Link to an allowlisted domain, or add the domain to the org's link rules."
+	default:
+		rule.Description = "Links whose host cannot be parsed"
+		rule.Remediation = "Fix or remove the malformed link."
+	}
+	return rule
+}
+
+func piiRule(class string) Rule {
+	return Rule{
+		ID:          "pii." + class,
+		Category:    CategoryPrivacy,
+		Action:      ActionBlock,
+		Description: "Draft must not contain personal data of class " + class,
+		Remediation: "Remove the " + strings.ReplaceAll(class, "_", " ") + " from the reply; refer to it without repeating it.",
+	}
+}
+
+func disclosureRule(disclosure string) Rule {
+	return Rule{
+		ID:          ruleID("required_disclosure", disclosure),
+		Category:    CategoryDisclosure,
+		Action:      ActionApproval,
+		Description: fmt.Sprintf("Draft must include %q", disclosure),
+		Remediation: fmt.Sprintf("Add the disclosure %q to the reply.", disclosure),
+	}
+}
+
+func citationRule() Rule {
+	return Rule{
+		ID:          "citations.required",
+		Category:    CategoryCitations,
+		Action:      ActionApproval,
+		Description: "Generated drafts must cite at least one source message",
+		Remediation: "Ground the reply in the customer's messages and cite the ones it relies on.",
+	}
+}
+
+// ruleID names a rule after its text when that makes a short slug, and falls
+// back to a hash otherwise.
+func ruleID(prefix string, text string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(text) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if b.Len() > 0 && !dash {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	slug := strings.TrimSuffix(b.String(), "-")
+	if slug == "" || len(slug) > 40 {
+		slug = shortHash(text)
+	}
+	return prefix + "." + slug
+}
+
+func shortHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,20 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"neuralmail/internal/store"
+)
+
+// PushVectorCleanup queues the removal of the vector points of deleted
+// inboxes and threads.
+func (q *Queue) PushVectorCleanup(ctx context.Context, cleanup store.VectorCleanup) error {
+	return q.push(ctx, newStream(VectorCleanupJobs), Job{
+		TraceID:   uuid.NewString(),
+		Origin:    OriginDelete,
+		InboxIDs:  cleanup.InboxIDs,
+		ThreadIDs: cleanup.ThreadIDs,
+	})
+}
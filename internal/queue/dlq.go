@@ -0,0 +1,175 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const maintenanceKey = "nerve:maintenance"
+
+// DeadLetter is a job that used up its attempts and was parked for operator
+// review. ID is its entry on the dead-letter stream.
+type DeadLetter struct {
+	ID        string    `json:"id,omitempty"`
+	MessageID string    `json:"message_id,omitempty"`
+	TraceID   string    `json:"trace_id,omitempty"`
+	Origin    string    `json:"origin,omitempty"`
+	Attempts  int       `json:"attempts,omitempty"`
+	InboxIDs  []string  `json:"inbox_ids,omitempty"`
+	ThreadIDs []string  `json:"thread_ids,omitempty"`
+	Error     string    `json:"error"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+func (d DeadLetter) job() Job {
+	return Job{TraceID: d.TraceID, MessageID: d.MessageID, Origin: OriginDLQRetry, Attempts: d.Attempts, InboxIDs: d.InboxIDs, ThreadIDs: d.ThreadIDs}
+}
+
+func deadLetterEntry(msg redis.XMessage) (DeadLetter, bool) {
+	raw, _ := msg.Values["job"].(string)
+	var item DeadLetter
+	if err := json.Unmarshal([]byte(raw), &item); err != nil {
+		return item, false
+	}
+	item.ID = msg.ID
+	return item, true
+}
+
+// ListDeadLetters returns up to limit of the named queue's parked jobs,
+// newest first.
+func (q *Queue) ListDeadLetters(ctx context.Context, name string, limit int64) ([]DeadLetter, error) {
+	s, err := streamFor(name)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = 50
+	}
+	entries, err := q.client.XRevRangeN(ctx, s.dead, "+", "-", limit).Result()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]DeadLetter, 0, len(entries))
+	for _, entry := range entries {
+		if item, ok := deadLetterEntry(entry); ok {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (q *Queue) DeadLetterDepth(ctx context.Context, name string) (int64, error) {
+	s, err := streamFor(name)
+	if err != nil {
+		return 0, err
+	}
+	return q.client.XLen(ctx, s.dead).Result()
+}
+
+// RetryDeadLetters moves up to limit of the named queue's oldest parked
+// jobs back onto it and returns how many were requeued. Retried jobs keep
+// their trace ID and attempt count, so each gets one more attempt before it
+// is parked again.
+func (q *Queue) RetryDeadLetters(ctx context.Context, name string, limit int) (int, error) {
+	s, err := streamFor(name)
+	if err != nil {
+		return 0, err
+	}
+	retried := 0
+	for limit <= 0 || retried < limit {
+		count := int64(100)
+		if limit > 0 {
+			count = int64(min(limit-retried, 100))
+		}
+		entries, err := q.client.XRangeN(ctx, s.dead, "-", "+", count).Result()
+		if err != nil {
+			return retried, err
+		}
+		if len(entries) == 0 {
+			break
+		}
+		for _, entry := range entries {
+			if item, ok := deadLetterEntry(entry); ok {
+				if err := q.push(ctx, s, item.job()); err != nil {
+					return retried, err
+				}
+				retried++
+			}
+			if err := q.client.XDel(ctx, s.dead, entry.ID).Err(); err != nil {
+				return retried, err
+			}
+		}
+	}
+	return retried, nil
+}
+
+// MigrateLegacyLists moves jobs left in the Redis lists the queues used
+// before streams, and the old embedding dead-letter list, onto their
+// streams, returning how many moved. Workers run it at startup.
+func (q *Queue) MigrateLegacyLists(ctx context.Context) (int, error) {
+	moved := 0
+	for _, name := range Names {
+		s := newStream(name)
+		for {
+			// Lists were pushed on the left and popped on the right, so
+			// the right end holds the oldest job.
+			raw, err := q.client.RPop(ctx, name).Result()
+			if err == redis.Nil {
+				break
+			}
+			if err != nil {
+				return moved, err
+			}
+			// Re-encoding upgrades bare message IDs to job envelopes.
+			job, err := json.Marshal(decodeJob(raw))
+			if err != nil {
+				continue
+			}
+			if err := q.client.XAdd(ctx, &redis.XAddArgs{Stream: s.jobs, Values: map[string]any{"job": job}}).Err(); err != nil {
+				_ = q.client.RPush(ctx, name, raw).Err()
+				return moved, err
+			}
+			moved++
+		}
+	}
+	dead := newStream(EmbeddingJobs).dead
+	for {
+		raw, err := q.client.RPop(ctx, legacyDeadLetterKey).Result()
+		if err == redis.Nil {
+			break
+		}
+		if err != nil {
+			return moved, err
+		}
+		if err := q.client.XAdd(ctx, &redis.XAddArgs{Stream: dead, Values: map[string]any{"job": raw}}).Err(); err != nil {
+			_ = q.client.RPush(ctx, legacyDeadLetterKey, raw).Err()
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// legacyDeadLetterKey is the list failed embedding jobs were parked in
+// before the queues moved to streams.
+const legacyDeadLetterKey = "embedding_jobs_dead"
+
+// SetMaintenance toggles the instance-wide maintenance flag shared by the
+// server and workers.
+func (q *Queue) SetMaintenance(ctx context.Context, enabled bool) error {
+	if enabled {
+		return q.client.Set(ctx, maintenanceKey, time.Now().UTC().Format(time.RFC3339), 0).Err()
+	}
+	return q.client.Del(ctx, maintenanceKey).Err()
+}
+
+func (q *Queue) Maintenance(ctx context.Context) (bool, error) {
+	n, err := q.client.Exists(ctx, maintenanceKey).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,66 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrNoJob is returned by a pop that timed out with the queue empty.
+var ErrNoJob = errors.New("no job available")
+
+// withFailover runs op until it succeeds, fails with a non-transient error,
+// or failoverTimeout passes. go-redis retries a command a few times on its
+// own; this covers the longer gap while sentinels promote a replica or a
+// cluster slot moves, so ingestion waits for the new primary instead of
+// dropping jobs.
+func (q *Queue) withFailover(ctx context.Context, op func() error) error {
+	deadline := time.Now().Add(q.failoverTimeout)
+	backoff := q.minBackoff
+	if backoff <= 0 {
+		backoff = 100 * time.Millisecond
+	}
+	for {
+		err := op()
+		if err == nil || !transient(err) || time.Now().Add(backoff).After(deadline) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if q.maxBackoff > 0 && backoff > q.maxBackoff {
+			backoff = q.maxBackoff
+		}
+	}
+}
+
+// transient reports whether err is one Redis returns while a primary is
+// down, being replaced or still loading, as opposed to a bad command or an
+// empty queue.
+func transient(err error) bool {
+	if errors.Is(err, redis.Nil) || errors.Is(err, redis.ErrClosed) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	for _, prefix := range []string{"READONLY", "LOADING", "MASTERDOWN", "CLUSTERDOWN", "TRYAGAIN"} {
+		if strings.HasPrefix(err.Error(), prefix) {
+			return true
+		}
+	}
+	return false
+}
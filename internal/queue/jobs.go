@@ -0,0 +1,205 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Job origins.
+const (
+	OriginIngest   = "ingest"
+	OriginSend     = "send"
+	OriginDLQRetry = "dlq_retry"
+	OriginDelete   = "delete"
+	OriginSchedule = "schedule"
+)
+
+// Job is the envelope shared by the work queues. TraceID follows the job
+// through worker logs, dead-lettering and retries.
+type Job struct {
+	// ID is the job's stream entry while a worker holds it.
+	ID         string    `json:"-"`
+	TraceID    string    `json:"trace_id"`
+	MessageID  string    `json:"message_id"`
+	Origin     string    `json:"origin"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	Attempts   int       `json:"attempts"`
+	// InboxIDs and ThreadIDs are set on vector cleanup jobs instead of
+	// MessageID.
+	InboxIDs  []string `json:"inbox_ids,omitempty"`
+	ThreadIDs []string `json:"thread_ids,omitempty"`
+	// Payload carries the arguments of the other job types, as JSON.
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+func NewJob(messageID string, origin string) Job {
+	return Job{TraceID: uuid.NewString(), MessageID: messageID, Origin: origin}
+}
+
+// NewPayloadJob returns a job whose payload is v encoded as JSON.
+func NewPayloadJob(origin string, v any) (Job, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return Job{}, err
+	}
+	return Job{TraceID: uuid.NewString(), Origin: origin, Payload: raw}, nil
+}
+
+// DecodePayload reads the job's payload into v.
+func (j Job) DecodePayload(v any) error {
+	if len(j.Payload) == 0 {
+		return errors.New("job has no payload")
+	}
+	return json.Unmarshal(j.Payload, v)
+}
+
+// Age is how long the job has waited since it was last enqueued.
+func (j Job) Age(now time.Time) time.Duration {
+	if j.EnqueuedAt.IsZero() {
+		return 0
+	}
+	return now.Sub(j.EnqueuedAt)
+}
+
+// decodeJob reads a queue entry. Entries queued before jobs carried metadata
+// are bare message IDs.
+func decodeJob(raw string) Job {
+	if strings.HasPrefix(raw, "{") {
+		var job Job
+		if err := json.Unmarshal([]byte(raw), &job); err == nil {
+			return job
+		}
+	}
+	return Job{MessageID: raw}
+}
+
+// Histogram bucket upper bounds for job age at processing (seconds) and
+// attempts. The last bucket of each is open-ended.
+var (
+	ageBuckets      = []float64{1, 5, 30, 60, 300, 1800}
+	attemptsBuckets = []int{1, 2, 3, 5}
+)
+
+const statsKeyPrefix = "nerve:queue_stats:"
+
+// Stats is a queue's current depth plus processing counters accumulated by
+// the workers since the counters were last reset.
+type Stats struct {
+	Queue           string           `json:"queue"`
+	Depth           int64            `json:"depth"`
+	Retrying        int64            `json:"retrying"`
+	DeadLettered    int64            `json:"dead_lettered"`
+	OldestAgeSec    float64          `json:"oldest_age_seconds"`
+	Processed       int64            `json:"processed"`
+	Failed          int64            `json:"failed"`
+	AgeSeconds      map[string]int64 `json:"age_seconds"`
+	AttemptsBuckets map[string]int64 `json:"attempts"`
+}
+
+// RecordResult counts a job processed from the named queue in the shared
+// stats so any instance's admin API can report them.
+func (q *Queue) RecordResult(ctx context.Context, name string, job Job, age time.Duration, failed bool) error {
+	key := statsKeyPrefix + name
+	pipe := q.client.TxPipeline()
+	if failed {
+		pipe.HIncrBy(ctx, key, "failed", 1)
+	} else {
+		pipe.HIncrBy(ctx, key, "processed", 1)
+	}
+	pipe.HIncrBy(ctx, key, "age:"+ageBucket(age.Seconds()), 1)
+	pipe.HIncrBy(ctx, key, "attempts:"+attemptsBucket(job.Attempts), 1)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Stats reports the named queue's depth, retries, dead letters, oldest
+// waiting job and any processing histograms its workers record.
+func (q *Queue) Stats(ctx context.Context, name string) (Stats, error) {
+	stats := Stats{Queue: name, AgeSeconds: map[string]int64{}, AttemptsBuckets: map[string]int64{}}
+	s, err := streamFor(name)
+	if err != nil {
+		return stats, err
+	}
+	if stats.Depth, err = q.client.XLen(ctx, s.jobs).Result(); err != nil {
+		return stats, err
+	}
+	if stats.Retrying, err = q.client.ZCard(ctx, s.retry).Result(); err != nil {
+		return stats, err
+	}
+	if stats.DeadLettered, err = q.client.XLen(ctx, s.dead).Result(); err != nil {
+		return stats, err
+	}
+	oldest, err := q.client.XRangeN(ctx, s.jobs, "-", "+", 1).Result()
+	if err != nil {
+		return stats, err
+	}
+	if len(oldest) > 0 {
+		stats.OldestAgeSec = entryJob(oldest[0]).Age(time.Now()).Seconds()
+	}
+	counters, err := q.client.HGetAll(ctx, statsKeyPrefix+name).Result()
+	if err != nil {
+		return stats, err
+	}
+	for _, bound := range ageBuckets {
+		stats.AgeSeconds[ageBucket(bound)] = 0
+	}
+	stats.AgeSeconds[ageBucket(ageBuckets[len(ageBuckets)-1]+1)] = 0
+	for _, bound := range attemptsBuckets {
+		stats.AttemptsBuckets[attemptsBucket(bound)] = 0
+	}
+	stats.AttemptsBuckets[attemptsBucket(attemptsBuckets[len(attemptsBuckets)-1]+1)] = 0
+	for field, raw := range counters {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			continue
+		}
+		switch {
+		case field == "processed":
+			stats.Processed = n
+		case field == "failed":
+			stats.Failed = n
+		case strings.HasPrefix(field, "age:"):
+			stats.AgeSeconds[strings.TrimPrefix(field, "age:")] = n
+		case strings.HasPrefix(field, "attempts:"):
+			stats.AttemptsBuckets[strings.TrimPrefix(field, "attempts:")] = n
+		}
+	}
+	return stats, nil
+}
+
+// ResetStats clears every queue's processing counters, e.g. after a
+// capacity change, so the histograms reflect the new configuration only.
+func (q *Queue) ResetStats(ctx context.Context) error {
+	// One key at a time: in cluster mode the keys live on different slots.
+	for _, name := range Names {
+		if err := q.client.Del(ctx, statsKeyPrefix+name).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ageBucket(seconds float64) string {
+	for _, bound := range ageBuckets {
+		if seconds <= bound {
+			return fmt.Sprintf("le_%g", bound)
+		}
+	}
+	return fmt.Sprintf("gt_%g", ageBuckets[len(ageBuckets)-1])
+}
+
+func attemptsBucket(attempts int) string {
+	for _, bound := range attemptsBuckets {
+		if attempts <= bound {
+			return fmt.Sprintf("le_%d", bound)
+		}
+	}
+	return fmt.Sprintf("gt_%d", attemptsBuckets[len(attemptsBuckets)-1])
+}
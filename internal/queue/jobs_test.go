@@ -0,0 +1,166 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"neuralmail/internal/config"
+)
+
+func TestJobEncodingRoundTrips(t *testing.T) {
+	job, err := NewPayloadJob(OriginSchedule, map[string]string{"inbox_id": "inbox-1"})
+	if err != nil {
+		t.Fatalf("new payload job: %v", err)
+	}
+	job.ID = "1700000000000-0"
+	job.MessageID = "msg-1"
+	job.EnqueuedAt = time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	job.Attempts = 2
+	job.ThreadIDs = []string{"thread-1"}
+
+	raw, err := json.Marshal(job)
+	if err != nil {
+		t.Fatalf("marshal job: %v", err)
+	}
+	if strings.Contains(string(raw), job.ID) || strings.Contains(string(raw), "inbox_ids") {
+		t.Fatalf("expected the entry id and empty fields left out, got %s", raw)
+	}
+	got := decodeJob(string(raw))
+	if got.ID != "" || got.TraceID != job.TraceID || got.MessageID != "msg-1" || got.Origin != OriginSchedule ||
+		!got.EnqueuedAt.Equal(job.EnqueuedAt) || got.Attempts != 2 || len(got.ThreadIDs) != 1 {
+		t.Fatalf("expected the job back, got %+v", got)
+	}
+	var payload map[string]string
+	if err := got.DecodePayload(&payload); err != nil || payload["inbox_id"] != "inbox-1" {
+		t.Fatalf("expected the payload back, got %v %v", payload, err)
+	}
+	if err := NewJob("msg-1", OriginIngest).DecodePayload(&payload); err == nil {
+		t.Fatalf("expected a job without a payload to refuse decoding")
+	}
+}
+
+func TestDecodeJobReadsBareMessageIDs(t *testing.T) {
+	for _, raw := range []string{"msg-1", "{not json"} {
+		job := decodeJob(raw)
+		if job.MessageID != raw || job.TraceID != "" || job.Origin != "" || job.Age(time.Now()) != 0 {
+			t.Fatalf("expected %q read as a bare message id, got %+v", raw, job)
+		}
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	ages := map[float64]string{0: "le_1", 1: "le_1", 1.5: "le_5", 300: "le_300", 1800: "le_1800", 1801: "gt_1800"}
+	for seconds, want := range ages {
+		if got := ageBucket(seconds); got != want {
+			t.Errorf("ageBucket(%g) = %s, want %s", seconds, got, want)
+		}
+	}
+	attempts := map[int]string{0: "le_1", 1: "le_1", 3: "le_3", 4: "le_5", 6: "gt_5"}
+	for n, want := range attempts {
+		if got := attemptsBucket(n); got != want {
+			t.Errorf("attemptsBucket(%d) = %s, want %s", n, got, want)
+		}
+	}
+}
+
+func TestRecordResultFillsStats(t *testing.T) {
+	withTestQueue(t, func(ctx context.Context, q *Queue) {
+		record := func(age time.Duration, attempts int, failed bool) {
+			t.Helper()
+			if err := q.RecordResult(ctx, EmbeddingJobs, Job{Attempts: attempts}, age, failed); err != nil {
+				t.Fatalf("record result: %v", err)
+			}
+		}
+		record(500*time.Millisecond, 1, false)
+		record(3*time.Second, 1, false)
+		record(time.Hour, 7, true)
+
+		stats, err := q.Stats(ctx, EmbeddingJobs)
+		if err != nil {
+			t.Fatalf("stats: %v", err)
+		}
+		if stats.Processed != 2 || stats.Failed != 1 {
+			t.Fatalf("expected 2 processed and 1 failed, got %d and %d", stats.Processed, stats.Failed)
+		}
+		if len(stats.AgeSeconds) != len(ageBuckets)+1 || stats.AgeSeconds["le_1"] != 1 || stats.AgeSeconds["le_5"] != 1 || stats.AgeSeconds["gt_1800"] != 1 || stats.AgeSeconds["le_30"] != 0 {
+			t.Fatalf("unexpected age histogram %v", stats.AgeSeconds)
+		}
+		if len(stats.AttemptsBuckets) != len(attemptsBuckets)+1 || stats.AttemptsBuckets["le_1"] != 2 || stats.AttemptsBuckets["gt_5"] != 1 {
+			t.Fatalf("unexpected attempts histogram %v", stats.AttemptsBuckets)
+		}
+		if other, err := q.Stats(ctx, Names[len(Names)-1]); err != nil || other.Processed != 0 {
+			t.Fatalf("expected counters kept per queue, got %+v %v", other, err)
+		}
+
+		if err := q.ResetStats(ctx); err != nil {
+			t.Fatalf("reset stats: %v", err)
+		}
+		stats, err = q.Stats(ctx, EmbeddingJobs)
+		if err != nil || stats.Processed != 0 || stats.Failed != 0 || stats.AgeSeconds["le_1"] != 0 {
+			t.Fatalf("expected the counters cleared, got %+v %v", stats, err)
+		}
+	})
+}
+
+func TestClaimNonceOnce(t *testing.T) {
+	withTestQueue(t, func(ctx context.Context, q *Queue) {
+		claim := func(scope, nonce string, want bool) {
+			t.Helper()
+			first, err := q.ClaimNonce(ctx, scope, nonce, time.Minute)
+			if err != nil || first != want {
+				t.Fatalf("claim %s %s = %v %v, want %v", scope, nonce, first, err, want)
+			}
+		}
+		claim("mailgun", "tok-1", true)
+		claim("mailgun", "tok-1", false)
+		claim("other", "tok-1", true)
+		if ttl := q.client.TTL(ctx, nonceKeyPrefix+"mailgun:tok-1").Val(); ttl <= 0 || ttl > time.Minute {
+			t.Fatalf("expected the nonce to expire within a minute, got %s", ttl)
+		}
+		if err := q.ReleaseNonce(ctx, "mailgun", "tok-1"); err != nil {
+			t.Fatalf("release nonce: %v", err)
+		}
+		claim("mailgun", "tok-1", true)
+	})
+}
+
+// withTestQueue runs against database 15 of the Redis at NM_TEST_REDIS_URL,
+// or of the host-mapped dev Redis, flushing it before and after.
+func withTestQueue(t *testing.T, run func(ctx context.Context, q *Queue)) {
+	t.Helper()
+
+	rawURL := os.Getenv("NM_TEST_REDIS_URL")
+	if rawURL == "" {
+		rawURL = "redis://127.0.0.1:63790"
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("parse redis url: %v", err)
+	}
+	parsed.Path = "/15"
+	cfg := config.Default()
+	cfg.Redis.URL = parsed.String()
+	q, err := New(cfg)
+	if err != nil {
+		t.Fatalf("open queue: %v", err)
+	}
+	defer q.Close()
+
+	ctx := context.Background()
+	pingCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	if err := q.Ping(pingCtx); err != nil {
+		t.Skipf("redis unavailable for queue tests: %v", err)
+	}
+	if err := q.client.FlushDB(ctx).Err(); err != nil {
+		t.Fatalf("flush redis: %v", err)
+	}
+	defer q.client.FlushDB(context.Background())
+
+	run(ctx, q)
+}
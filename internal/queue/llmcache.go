@@ -0,0 +1,29 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const llmCacheKeyPrefix = "nerve:llm_cache:"
+
+// GetCachedResponse returns a model response stored under key; ok is false
+// when there is none or it expired.
+func (q *Queue) GetCachedResponse(ctx context.Context, key string) ([]byte, bool, error) {
+	raw, err := q.client.Get(ctx, llmCacheKeyPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return raw, true, nil
+}
+
+// PutCachedResponse stores a model response under key for ttl.
+func (q *Queue) PutCachedResponse(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return q.client.Set(ctx, llmCacheKeyPrefix+key, value, ttl).Err()
+}
@@ -0,0 +1,21 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+const nonceKeyPrefix = "nerve:nonce:"
+
+// ClaimNonce records a signed request's one-time value under scope for ttl
+// and reports whether this is its first use, so a captured request cannot be
+// replayed while its signature is still accepted.
+func (q *Queue) ClaimNonce(ctx context.Context, scope string, nonce string, ttl time.Duration) (bool, error) {
+	return q.client.SetNX(ctx, nonceKeyPrefix+scope+":"+nonce, time.Now().UTC().Format(time.RFC3339), ttl).Result()
+}
+
+// ReleaseNonce forgets a claimed value, so the sender can retry a request
+// whose processing failed.
+func (q *Queue) ReleaseNonce(ctx context.Context, scope string, nonce string) error {
+	return q.client.Del(ctx, nonceKeyPrefix+scope+":"+nonce).Err()
+}
@@ -2,45 +2,113 @@ package queue
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+
+	"neuralmail/internal/config"
 )
 
 type Queue struct {
-	client *redis.Client
+	client redis.UniversalClient
+	// failoverTimeout bounds how long a queue push or pop retries while
+	// Redis is unreachable or has no writable primary.
+	failoverTimeout time.Duration
+	minBackoff      time.Duration
+	maxBackoff      time.Duration
+
+	// consumer names this process in the workers' consumer group.
+	consumer        string
+	maxAttempts     int
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+	claimAfter      time.Duration
+
+	mu         sync.Mutex
+	groups     map[string]bool
+	maintained map[string]time.Time
 }
 
-func New(url string) (*Queue, error) {
-	opt, err := redis.ParseURL(url)
+// New connects to Redis in the topology cfg.Redis.Mode selects: standalone
+// (the default, from url), sentinel or cluster.
+func New(cfg config.Config) (*Queue, error) {
+	client, err := newClient(cfg)
 	if err != nil {
 		return nil, err
 	}
-	client := redis.NewClient(opt)
-	return &Queue{client: client}, nil
+	return &Queue{
+		client:          client,
+		failoverTimeout: cfg.Redis.FailoverTimeout,
+		minBackoff:      cfg.Redis.MinRetryBackoff,
+		maxBackoff:      cfg.Redis.MaxRetryBackoff,
+		consumer:        consumerName(),
+		maxAttempts:     cfg.Jobs.MaxAttempts,
+		retryBackoff:    cfg.Jobs.RetryBackoff,
+		maxRetryBackoff: cfg.Jobs.MaxRetryBackoff,
+		claimAfter:      cfg.Jobs.ClaimAfter,
+		groups:          map[string]bool{},
+		maintained:      map[string]time.Time{},
+	}, nil
 }
 
-func (q *Queue) Ping(ctx context.Context) error {
-	return q.client.Ping(ctx).Err()
+func newClient(cfg config.Config) (redis.UniversalClient, error) {
+	rc := cfg.Redis
+	switch rc.Mode {
+	case "", "standalone":
+		opt, err := redis.ParseURL(rc.URL)
+		if err != nil {
+			return nil, err
+		}
+		opt.MaxRetries = rc.MaxRetries
+		opt.MinRetryBackoff = rc.MinRetryBackoff
+		opt.MaxRetryBackoff = rc.MaxRetryBackoff
+		return redis.NewClient(opt), nil
+	case "sentinel":
+		if rc.MasterName == "" || len(rc.Addrs) == 0 {
+			return nil, errors.New("redis sentinel mode needs master_name and sentinel addrs")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       rc.MasterName,
+			SentinelAddrs:    rc.Addrs,
+			SentinelPassword: rc.SentinelPassword,
+			Username:         rc.Username,
+			Password:         rc.Password,
+			MaxRetries:       rc.MaxRetries,
+			MinRetryBackoff:  rc.MinRetryBackoff,
+			MaxRetryBackoff:  rc.MaxRetryBackoff,
+		}), nil
+	case "cluster":
+		if len(rc.Addrs) == 0 {
+			return nil, errors.New("redis cluster mode needs seed addrs")
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:           rc.Addrs,
+			Username:        rc.Username,
+			Password:        rc.Password,
+			MaxRetries:      rc.MaxRetries,
+			MinRetryBackoff: rc.MinRetryBackoff,
+			MaxRetryBackoff: rc.MaxRetryBackoff,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown redis mode %q: use standalone, sentinel or cluster", rc.Mode)
+	}
 }
 
-func (q *Queue) PushEmbeddingJob(ctx context.Context, messageID string) error {
-	return q.client.LPush(ctx, "embedding_jobs", messageID).Err()
+func (q *Queue) Ping(ctx context.Context) error {
+	return q.client.Ping(ctx).Err()
 }
 
-func (q *Queue) PopEmbeddingJob(ctx context.Context, timeout time.Duration) (string, error) {
-	res, err := q.client.BRPop(ctx, timeout, "embedding_jobs").Result()
-	if err != nil {
-		return "", err
-	}
-	if len(res) < 2 {
-		return "", redis.Nil
-	}
-	return res[1], nil
+func (q *Queue) PushEmbeddingJob(ctx context.Context, job Job) error {
+	return q.push(ctx, newStream(EmbeddingJobs), job)
 }
 
+// Depth counts the embedding jobs waiting or in progress; jobs waiting for
+// a retry are counted in Stats.Retrying.
 func (q *Queue) Depth(ctx context.Context) (int64, error) {
-	return q.client.LLen(ctx, "embedding_jobs").Result()
+	return q.client.XLen(ctx, newStream(EmbeddingJobs).jobs).Result()
 }
 
 func (q *Queue) Close() error {
@@ -0,0 +1,46 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const callLimitKeyPrefix = "nerve:call_limit:"
+
+// slidingWindowScript keeps the call times of one key in a sorted set.
+// It drops those older than the window and, if fewer than the limit remain,
+// adds this call and returns 0. Otherwise it returns the milliseconds until
+// the oldest one ages out.
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+if redis.call('ZCARD', KEYS[1]) < tonumber(ARGV[3]) then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], window)
+	return 0
+end
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return tonumber(oldest[2]) + window - now
+`)
+
+// AllowCall counts a call against key's budget of rpm calls in any sliding
+// minute, shared by every replica. When the budget is spent it reports the
+// seconds until a call ages out of the window.
+func (q *Queue) AllowCall(ctx context.Context, key string, rpm int) (bool, int, error) {
+	now := time.Now().UnixMilli()
+	member := fmt.Sprintf("%d-%d", now, rand.Uint64())
+	wait, err := slidingWindowScript.Run(ctx, q.client, []string{callLimitKeyPrefix + key},
+		now, time.Minute.Milliseconds(), rpm, member).Int64()
+	if err != nil {
+		return false, 0, err
+	}
+	if wait <= 0 {
+		return true, 0, nil
+	}
+	return false, int((wait + 999) / 1000), nil
+}
@@ -0,0 +1,53 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const sessionKeyPrefix = "nerve:mcp_session:"
+
+// Session is the live state of an MCP session, shared by every MCP replica.
+// Redis expires the key once the session has been idle for its TTL. Version
+// is the negotiated protocol version, empty for clients that never asked for
+// one. RecordedAt is when the session's audit row was last brought up to
+// date.
+type Session struct {
+	OrgID      string    `json:"org_id"`
+	Version    string    `json:"version"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+func (q *Queue) PutSession(ctx context.Context, id string, sess Session, ttl time.Duration) error {
+	raw, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	return q.client.Set(ctx, sessionKeyPrefix+id, raw, ttl).Err()
+}
+
+// TouchSession returns a live session and pushes its expiry out to ttl from
+// now. ok is false for unknown or expired sessions.
+func (q *Queue) TouchSession(ctx context.Context, id string, ttl time.Duration) (Session, bool, error) {
+	raw, err := q.client.GetEx(ctx, sessionKeyPrefix+id, ttl).Result()
+	if errors.Is(err, redis.Nil) {
+		return Session{}, false, nil
+	}
+	if err != nil {
+		return Session{}, false, err
+	}
+	var sess Session
+	if err := json.Unmarshal([]byte(raw), &sess); err != nil {
+		return Session{}, false, err
+	}
+	return sess, true, nil
+}
+
+// DeleteSession terminates a session on every replica at once.
+func (q *Queue) DeleteSession(ctx context.Context, id string) error {
+	return q.client.Del(ctx, sessionKeyPrefix+id).Err()
+}
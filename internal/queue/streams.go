@@ -0,0 +1,369 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Job types. Each type has a queue of its own, named by QueueName.
+const (
+	TypeEmbedding       = "embedding"
+	TypeVectorCleanup   = "vector_cleanup"
+	TypeWebhookDelivery = "webhook_delivery"
+	TypeScheduledSend   = "scheduled_send"
+	TypeSummarization   = "summarization"
+	TypeRetentionSweep  = "retention_sweep"
+	TypeBounce          = "bounce_processing"
+	TypeDomainVerify    = "domain_verification"
+)
+
+// Types lists the job types workers run.
+var Types = []string{TypeEmbedding, TypeVectorCleanup, TypeWebhookDelivery, TypeScheduledSend, TypeSummarization, TypeRetentionSweep, TypeBounce, TypeDomainVerify}
+
+// QueueName is the queue holding jobType's jobs.
+func QueueName(jobType string) string {
+	return jobType + "_jobs"
+}
+
+// Queue names of the types the server queues by name.
+const (
+	EmbeddingJobs     = "embedding_jobs"
+	VectorCleanupJobs = "vector_cleanup_jobs"
+)
+
+// Names lists the work queues, as the jobs subcommand and control API take
+// them.
+var Names = queueNames()
+
+func queueNames() []string {
+	names := make([]string, len(Types))
+	for i, t := range Types {
+		names[i] = QueueName(t)
+	}
+	return names
+}
+
+// ErrUnknownQueue is returned for a queue name not in Names.
+var ErrUnknownQueue = errors.New("unknown queue")
+
+// consumerGroup is the one consumer group every worker reads through, so
+// each job goes to a single worker and stays pending until acknowledged.
+const consumerGroup = "workers"
+
+// maintainEvery throttles how often a claim promotes due retries and
+// recovers abandoned jobs.
+const maintainEvery = time.Second
+
+// errAbandoned is the cause recorded for a job whose worker held it for
+// claimAfter without acknowledging it, typically because it crashed.
+var errAbandoned = errors.New("job abandoned by its worker")
+
+// stream holds the Redis keys of one work queue: the stream workers read,
+// a sorted set of failed jobs waiting for their retry, scored by when it is
+// due, and the dead-letter stream. The keys share a hash tag so the
+// multi-key commands below stay on one cluster slot.
+type stream struct {
+	name  string
+	jobs  string
+	retry string
+	dead  string
+}
+
+func newStream(name string) stream {
+	tag := "{" + name + "}"
+	return stream{name: name, jobs: tag + ":stream", retry: tag + ":retry", dead: tag + ":dead"}
+}
+
+func streamFor(name string) (stream, error) {
+	for _, n := range Names {
+		if n == name {
+			return newStream(name), nil
+		}
+	}
+	return stream{}, fmt.Errorf("%w %q", ErrUnknownQueue, name)
+}
+
+// promoteRetries moves the failed jobs whose retry is due back onto the
+// stream.
+var promoteRetries = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, raw in ipairs(due) do
+	redis.call('ZREM', KEYS[1], raw)
+	redis.call('XADD', KEYS[2], '*', 'job', raw)
+end
+return #due
+`)
+
+func consumerName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "worker"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// Push queues job on the named queue.
+func (q *Queue) Push(ctx context.Context, name string, job Job) error {
+	s, err := streamFor(name)
+	if err != nil {
+		return err
+	}
+	return q.push(ctx, s, job)
+}
+
+// Pop blocks up to timeout for the named queue's next job and counts the
+// attempt it is about to make. The caller must Ack or Fail it; a job
+// neither acked nor failed within jobs.claim_after counts as failed.
+func (q *Queue) Pop(ctx context.Context, name string, timeout time.Duration) (Job, error) {
+	s, err := streamFor(name)
+	if err != nil {
+		return Job{}, err
+	}
+	return q.claim(ctx, s, timeout)
+}
+
+// Ack removes a job the worker is done with from the named queue.
+func (q *Queue) Ack(ctx context.Context, name string, job Job) error {
+	s, err := streamFor(name)
+	if err != nil {
+		return err
+	}
+	return q.ack(ctx, s, job)
+}
+
+// Fail schedules a failed job for retry with backoff, or parks it in the
+// named queue's dead-letter stream once it has used up jobs.max_attempts,
+// and reports whether it was dead-lettered.
+func (q *Queue) Fail(ctx context.Context, name string, job Job, cause error) (bool, error) {
+	s, err := streamFor(name)
+	if err != nil {
+		return false, err
+	}
+	return q.fail(ctx, s, job, cause)
+}
+
+// Schedule queues a job on the named queue unless any worker has done so
+// in the last interval, so a periodic job runs once per interval however
+// many workers keep time. It reports whether it queued one.
+func (q *Queue) Schedule(ctx context.Context, name string, interval time.Duration) (bool, error) {
+	s, err := streamFor(name)
+	if err != nil {
+		return false, err
+	}
+	due, err := q.client.SetNX(ctx, scheduleKeyPrefix+name, time.Now().UTC().Format(time.RFC3339), interval).Result()
+	if err != nil || !due {
+		return false, err
+	}
+	return true, q.push(ctx, s, Job{Origin: OriginSchedule})
+}
+
+const scheduleKeyPrefix = "nerve:schedule:"
+
+func (q *Queue) push(ctx context.Context, s stream, job Job) error {
+	if job.TraceID == "" {
+		job.TraceID = uuid.NewString()
+	}
+	job.EnqueuedAt = time.Now().UTC()
+	raw, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return q.withFailover(ctx, func() error {
+		return q.client.XAdd(ctx, &redis.XAddArgs{Stream: s.jobs, Values: map[string]any{"job": raw}}).Err()
+	})
+}
+
+// claim blocks up to timeout for the next job on s and counts the attempt
+// it is about to make. The job stays pending on the stream until it is
+// acked or failed.
+func (q *Queue) claim(ctx context.Context, s stream, timeout time.Duration) (Job, error) {
+	if err := q.ensureGroup(ctx, s); err != nil {
+		return Job{}, err
+	}
+	q.maintain(ctx, s)
+	var res []redis.XStream
+	err := q.withFailover(ctx, func() error {
+		var err error
+		res, err = q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    consumerGroup,
+			Consumer: q.consumer,
+			Streams:  []string{s.jobs, ">"},
+			Count:    1,
+			Block:    timeout,
+		}).Result()
+		return err
+	})
+	if err != nil && strings.HasPrefix(err.Error(), "NOGROUP") {
+		// The stream was deleted under us; recreate the group next time.
+		q.forgetGroup(s)
+		return Job{}, ErrNoJob
+	}
+	if errors.Is(err, redis.Nil) || (err == nil && (len(res) == 0 || len(res[0].Messages) == 0)) {
+		return Job{}, ErrNoJob
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	job := entryJob(res[0].Messages[0])
+	job.Attempts++
+	return job, nil
+}
+
+func entryJob(msg redis.XMessage) Job {
+	raw, _ := msg.Values["job"].(string)
+	job := decodeJob(raw)
+	job.ID = msg.ID
+	return job
+}
+
+// ack removes a finished job from s.
+func (q *Queue) ack(ctx context.Context, s stream, job Job) error {
+	if job.ID == "" {
+		return nil
+	}
+	return q.withFailover(ctx, func() error {
+		pipe := q.client.TxPipeline()
+		pipe.XAck(ctx, s.jobs, consumerGroup, job.ID)
+		pipe.XDel(ctx, s.jobs, job.ID)
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+}
+
+// fail schedules a failed job's retry after its backoff or, once it has
+// made maxAttempts, moves it to the dead-letter stream, reporting which.
+func (q *Queue) fail(ctx context.Context, s stream, job Job, cause error) (bool, error) {
+	if job.Attempts >= q.maxAttempts {
+		return true, q.deadLetter(ctx, s, job, cause)
+	}
+	due := time.Now().Add(retryDelay(job.Attempts, q.retryBackoff, q.maxRetryBackoff)).UTC()
+	// The retry counts as enqueued when it becomes due, so its age at
+	// processing leaves out the backoff.
+	job.EnqueuedAt = due
+	raw, err := json.Marshal(job)
+	if err != nil {
+		return false, err
+	}
+	return false, q.withFailover(ctx, func() error {
+		pipe := q.client.TxPipeline()
+		pipe.ZAdd(ctx, s.retry, redis.Z{Score: float64(due.UnixMilli()), Member: string(raw)})
+		if job.ID != "" {
+			pipe.XAck(ctx, s.jobs, consumerGroup, job.ID)
+			pipe.XDel(ctx, s.jobs, job.ID)
+		}
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+}
+
+func (q *Queue) deadLetter(ctx context.Context, s stream, job Job, cause error) error {
+	item := DeadLetter{
+		MessageID: job.MessageID,
+		TraceID:   job.TraceID,
+		Origin:    job.Origin,
+		Attempts:  job.Attempts,
+		InboxIDs:  job.InboxIDs,
+		ThreadIDs: job.ThreadIDs,
+		FailedAt:  time.Now().UTC(),
+	}
+	if cause != nil {
+		item.Error = cause.Error()
+	}
+	raw, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return q.withFailover(ctx, func() error {
+		pipe := q.client.TxPipeline()
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: s.dead, Values: map[string]any{"job": raw}})
+		if job.ID != "" {
+			pipe.XAck(ctx, s.jobs, consumerGroup, job.ID)
+			pipe.XDel(ctx, s.jobs, job.ID)
+		}
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+}
+
+// retryDelay is the wait before the retry that follows a job's attempts-th
+// failed attempt: base, doubling per attempt, capped at max.
+func retryDelay(attempts int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts && (max <= 0 || delay < max); i++ {
+		delay *= 2
+	}
+	if max > 0 && delay > max {
+		delay = max
+	}
+	return delay
+}
+
+func (q *Queue) ensureGroup(ctx context.Context, s stream) error {
+	q.mu.Lock()
+	ready := q.groups[s.name]
+	q.mu.Unlock()
+	if ready {
+		return nil
+	}
+	// Starting at 0 rather than $ hands out jobs pushed before the group
+	// existed.
+	err := q.withFailover(ctx, func() error {
+		return q.client.XGroupCreateMkStream(ctx, s.jobs, consumerGroup, "0").Err()
+	})
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	q.mu.Lock()
+	q.groups[s.name] = true
+	q.mu.Unlock()
+	return nil
+}
+
+func (q *Queue) forgetGroup(s stream) {
+	q.mu.Lock()
+	delete(q.groups, s.name)
+	q.mu.Unlock()
+}
+
+// maintain promotes s's due retries and fails jobs left pending longer
+// than claimAfter, at most once per maintainEvery. Errors are left for the
+// next claim; the read that follows reports an unreachable Redis.
+func (q *Queue) maintain(ctx context.Context, s stream) {
+	q.mu.Lock()
+	if time.Since(q.maintained[s.name]) < maintainEvery {
+		q.mu.Unlock()
+		return
+	}
+	q.maintained[s.name] = time.Now()
+	q.mu.Unlock()
+
+	_ = promoteRetries.Run(ctx, q.client, []string{s.retry, s.jobs}, time.Now().UnixMilli(), 100).Err()
+	if q.claimAfter <= 0 {
+		return
+	}
+	abandoned, _, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   s.jobs,
+		Group:    consumerGroup,
+		Consumer: q.consumer,
+		MinIdle:  q.claimAfter,
+		Start:    "0-0",
+		Count:    100,
+	}).Result()
+	if err != nil {
+		return
+	}
+	for _, msg := range abandoned {
+		job := entryJob(msg)
+		// The abandoned delivery was an attempt of its own.
+		job.Attempts++
+		_, _ = q.fail(ctx, s, job, errAbandoned)
+	}
+}
@@ -0,0 +1,41 @@
+package queue
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	cases := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{4, 80 * time.Second},
+		{8, 10 * time.Minute},
+		{40, 10 * time.Minute},
+	}
+	for _, tc := range cases {
+		if got := retryDelay(tc.attempts, 10*time.Second, 10*time.Minute); got != tc.want {
+			t.Fatalf("retryDelay(%d) = %s, want %s", tc.attempts, got, tc.want)
+		}
+	}
+}
+
+func TestStreamKeysShareASlot(t *testing.T) {
+	s, err := streamFor(EmbeddingJobs)
+	if err != nil {
+		t.Fatalf("stream for %s: %v", EmbeddingJobs, err)
+	}
+	for _, key := range []string{s.jobs, s.retry, s.dead} {
+		if !strings.HasPrefix(key, "{embedding_jobs}:") {
+			t.Fatalf("expected %q to carry the queue's hash tag", key)
+		}
+	}
+	if _, err := streamFor("nope"); !errors.Is(err, ErrUnknownQueue) {
+		t.Fatalf("expected ErrUnknownQueue, got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const tokenLedgerKeyPrefix = "nerve:llm_tokens:"
+
+// tokenLedgerTTL keeps a day's count past its end, for clocks that disagree
+// about when the day turned.
+const tokenLedgerTTL = 48 * time.Hour
+
+func tokenLedgerKey(key string, day time.Time) string {
+	return tokenLedgerKeyPrefix + key + ":" + day.UTC().Format("2006-01-02")
+}
+
+// DailyTokens returns the model tokens counted under key on day's UTC date.
+func (q *Queue) DailyTokens(ctx context.Context, key string, day time.Time) (int64, error) {
+	n, err := q.client.Get(ctx, tokenLedgerKey(key, day)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return n, err
+}
+
+// AddDailyTokens counts tokens under key on day's UTC date.
+func (q *Queue) AddDailyTokens(ctx context.Context, key string, day time.Time, tokens int64) error {
+	k := tokenLedgerKey(key, day)
+	pipe := q.client.TxPipeline()
+	pipe.IncrBy(ctx, k, tokens)
+	pipe.Expire(ctx, k, tokenLedgerTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
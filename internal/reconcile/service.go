@@ -7,14 +7,25 @@ import (
 	"neuralmail/internal/store"
 )
 
+// missingAuditLimit caps how many unaudited usage events a single report lists.
+const missingAuditLimit = 500
+
 type Service struct {
 	Store *store.Store
-	Now   func() time.Time
+	// Vectors are swept for points of deleted threads; empty skips the
+	// sweep.
+	Vectors []VectorRegion
+	Now     func() time.Time
 }
 
 type Report struct {
+	CountersChecked  int
 	CountersRepaired int
 	PeriodsRolled    int
+	TrialsExpired    int
+	AuditPruned      int64
+	VectorOrphans    int64
+	Discrepancies    []store.UsageDiscrepancy
 }
 
 func NewService(st *store.Store) *Service {
@@ -30,16 +41,27 @@ func (s *Service) Run(ctx context.Context) (Report, error) {
 		return report, nil
 	}
 
+	startedAt := s.Now()
 	counters, err := s.Store.ListOrgUsageCounters(ctx)
 	if err != nil {
 		return report, err
 	}
 	for _, counter := range counters {
+		report.CountersChecked++
 		expected, err := s.Store.SumUsageEvents(ctx, counter.OrgID, counter.MeterName, counter.PeriodStart, counter.PeriodEnd)
 		if err != nil {
 			return report, err
 		}
 		if expected != counter.Used {
+			periodStart := counter.PeriodStart
+			report.Discrepancies = append(report.Discrepancies, store.UsageDiscrepancy{
+				Kind:        "counter_drift",
+				OrgID:       counter.OrgID,
+				MeterName:   counter.MeterName,
+				PeriodStart: &periodStart,
+				Expected:    expected,
+				Actual:      counter.Used,
+			})
 			if err := s.Store.SetOrgUsageCounterUsed(ctx, counter.OrgID, counter.MeterName, counter.PeriodStart, expected); err != nil {
 				return report, err
 			}
@@ -63,9 +85,64 @@ func (s *Service) Run(ctx context.Context) (Report, error) {
 		report.PeriodsRolled++
 	}
 
+	// Trials past their end lose access; the org keeps its data and gets
+	// it back by subscribing.
+	trials, err := s.Store.ExpireTrials(ctx, now)
+	if err != nil {
+		return report, err
+	}
+	report.TrialsExpired = len(trials)
+
+	pruned, err := s.Store.PruneAuditLog(ctx, now)
+	if err != nil {
+		return report, err
+	}
+	report.AuditPruned = pruned
+
+	orphans, err := s.sweepVectorOrphans(ctx)
+	if err != nil {
+		return report, err
+	}
+	report.VectorOrphans = orphans
+
+	if err := s.checkIntegrity(ctx, &report); err != nil {
+		return report, err
+	}
+
+	if _, err := s.Store.InsertReconciliationReport(ctx, store.ReconciliationReport{
+		StartedAt:        startedAt,
+		FinishedAt:       s.Now(),
+		CountersChecked:  report.CountersChecked,
+		CountersRepaired: report.CountersRepaired,
+		PeriodsRolled:    report.PeriodsRolled,
+		TrialsExpired:    report.TrialsExpired,
+		AuditPruned:      report.AuditPruned,
+		VectorOrphans:    report.VectorOrphans,
+		Discrepancies:    report.Discrepancies,
+	}); err != nil {
+		return report, err
+	}
+
 	return report, nil
 }
 
+// checkIntegrity records findings that cannot be repaired automatically:
+// duplicated replay ids and billed tool calls without an audit trail.
+func (s *Service) checkIntegrity(ctx context.Context, report *Report) error {
+	duplicates, err := s.Store.ListDuplicateUsageReplayIDs(ctx)
+	if err != nil {
+		return err
+	}
+	report.Discrepancies = append(report.Discrepancies, duplicates...)
+
+	missing, err := s.Store.ListUsageEventsMissingAudit(ctx, missingAuditLimit)
+	if err != nil {
+		return err
+	}
+	report.Discrepancies = append(report.Discrepancies, missing...)
+	return nil
+}
+
 func rolloverWindow(periodStart, periodEnd, now time.Time) (time.Time, time.Time) {
 	window := periodEnd.Sub(periodStart)
 	if window <= 0 {
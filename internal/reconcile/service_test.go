@@ -3,6 +3,7 @@ package reconcile
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"os"
@@ -17,6 +18,7 @@ import (
 	"github.com/pressly/goose/v3"
 
 	"neuralmail/internal/store"
+	"neuralmail/internal/vector"
 )
 
 func TestRunRepairsUsageDrift(t *testing.T) {
@@ -101,6 +103,174 @@ func TestRunBackstopRolloverCreatesNewPeriodCounter(t *testing.T) {
 	})
 }
 
+func TestRunReportsUnauditedUsageAndPersistsReport(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		orgID := uuid.NewString()
+		now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+		start := now.Add(-24 * time.Hour)
+		end := now.Add(24 * time.Hour)
+
+		insertOrgAndEntitlement(t, ctx, st, orgID, start, end)
+		if _, err := st.DB().ExecContext(ctx, `
+			INSERT INTO org_usage_counters (org_id, meter_name, period_start, period_end, used)
+			VALUES ($1, 'mcp_units', $2, $3, 2)
+		`, orgID, start, end); err != nil {
+			t.Fatalf("insert usage counter: %v", err)
+		}
+		if _, err := st.DB().ExecContext(ctx, `
+			INSERT INTO usage_events (org_id, meter_name, quantity, tool_name, replay_id, audit_id, status, created_at)
+			VALUES ($1, 'mcp_units', 2, 'list_threads', 'replay-unaudited', $2, 'success', $3)
+		`, orgID, uuid.NewString(), now); err != nil {
+			t.Fatalf("insert usage event: %v", err)
+		}
+
+		svc := NewService(st)
+		svc.Now = func() time.Time { return now }
+		report, err := svc.Run(ctx)
+		if err != nil {
+			t.Fatalf("run reconciliation: %v", err)
+		}
+		if report.CountersRepaired != 0 {
+			t.Fatalf("expected no counter repair, got %d", report.CountersRepaired)
+		}
+		if len(report.Discrepancies) != 1 || report.Discrepancies[0].Kind != "missing_audit" {
+			t.Fatalf("expected one missing_audit discrepancy, got %+v", report.Discrepancies)
+		}
+		if report.Discrepancies[0].ReplayID != "replay-unaudited" {
+			t.Fatalf("expected replay id on discrepancy, got %q", report.Discrepancies[0].ReplayID)
+		}
+
+		stored, err := st.GetLatestReconciliationReport(ctx)
+		if err != nil {
+			t.Fatalf("load reconciliation report: %v", err)
+		}
+		if len(stored.Discrepancies) != 1 || stored.CountersChecked != 1 {
+			t.Fatalf("unexpected stored report: %+v", stored)
+		}
+	})
+}
+
+func TestRunExpiresEndedTrials(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+		ended, running := uuid.NewString(), uuid.NewString()
+		for orgID, trialEnds := range map[string]time.Time{ended: now.Add(-time.Hour), running: now.Add(time.Hour)} {
+			insertOrgAndEntitlement(t, ctx, st, orgID, now.Add(-24*time.Hour), now.Add(24*time.Hour))
+			if _, err := st.DB().ExecContext(ctx, `
+				UPDATE org_entitlements SET plan_code = 'trial', subscription_status = 'trialing', trial_ends_at = $2
+				WHERE org_id = $1
+			`, orgID, trialEnds); err != nil {
+				t.Fatalf("start trial: %v", err)
+			}
+		}
+
+		svc := NewService(st)
+		svc.Now = func() time.Time { return now }
+		report, err := svc.Run(ctx)
+		if err != nil {
+			t.Fatalf("run reconciliation: %v", err)
+		}
+		if report.TrialsExpired != 1 {
+			t.Fatalf("expected 1 expired trial, got %d", report.TrialsExpired)
+		}
+		for orgID, want := range map[string]string{ended: "trial_expired", running: "trialing"} {
+			ent, err := st.GetOrgEntitlement(ctx, orgID)
+			if err != nil {
+				t.Fatalf("query entitlement: %v", err)
+			}
+			if ent.SubscriptionStatus != want {
+				t.Fatalf("expected status %s, got %s", want, ent.SubscriptionStatus)
+			}
+		}
+	})
+}
+
+func TestRunPrunesAuditPastPlanRetention(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+		orgID := uuid.NewString()
+		insertOrgAndEntitlement(t, ctx, st, orgID, now.Add(-24*time.Hour), now.Add(24*time.Hour))
+		if _, err := st.DB().ExecContext(ctx, `UPDATE plan_entitlements SET audit_retention_days = 30 WHERE plan_code = 'pro'`); err != nil {
+			t.Fatalf("set retention: %v", err)
+		}
+		for _, age := range []time.Duration{40 * 24 * time.Hour, 24 * time.Hour} {
+			if _, err := st.DB().ExecContext(ctx, `
+				INSERT INTO audit_log (org_id, actor, created_at) VALUES ($1, 'mcp', $2)
+			`, orgID, now.Add(-age)); err != nil {
+				t.Fatalf("insert audit entry: %v", err)
+			}
+		}
+
+		svc := NewService(st)
+		svc.Now = func() time.Time { return now }
+		report, err := svc.Run(ctx)
+		if err != nil {
+			t.Fatalf("run reconciliation: %v", err)
+		}
+		if report.AuditPruned != 1 {
+			t.Fatalf("expected the entry past retention to be pruned, got %d", report.AuditPruned)
+		}
+		entries, err := st.ListAuditEntries(ctx, store.AuditFilter{OrgID: orgID})
+		if err != nil {
+			t.Fatalf("list audit: %v", err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("expected the recent entry to be kept, got %+v", entries)
+		}
+	})
+}
+
+func TestRunSweepsVectorPointsOfDeletedThreads(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+		orgID, inboxID, threadID := uuid.NewString(), uuid.NewString(), uuid.NewString()
+		insertOrgAndEntitlement(t, ctx, st, orgID, now.Add(-24*time.Hour), now.Add(24*time.Hour))
+		if _, err := st.DB().ExecContext(ctx, `INSERT INTO inboxes (id, org_id, address) VALUES ($1, $2, 'sweep@example.com')`, inboxID, orgID); err != nil {
+			t.Fatalf("insert inbox: %v", err)
+		}
+		if _, err := st.DB().ExecContext(ctx, `INSERT INTO threads (id, inbox_id, org_id, subject) VALUES ($1, $2, $3, 'kept')`, threadID, inboxID, orgID); err != nil {
+			t.Fatalf("insert thread: %v", err)
+		}
+		gone := uuid.NewString()
+		index := &fakeIndex{points: []vector.SearchHit{
+			{ID: "m1", Payload: map[string]any{"thread_id": threadID}},
+			{ID: "m2", Payload: map[string]any{"thread_id": gone}},
+			{ID: "m3", Payload: map[string]any{"thread_id": gone}},
+		}}
+
+		svc := NewService(st)
+		svc.Now = func() time.Time { return now }
+		svc.Vectors = []VectorRegion{{Store: st, Index: index}}
+		report, err := svc.Run(ctx)
+		if err != nil {
+			t.Fatalf("run reconciliation: %v", err)
+		}
+		if report.VectorOrphans != 2 {
+			t.Fatalf("expected both points of the deleted thread to be swept, got %d", report.VectorOrphans)
+		}
+		raw, _ := json.Marshal(index.deleted)
+		if len(index.deleted) != 1 || !strings.Contains(string(raw), gone) || strings.Contains(string(raw), threadID) {
+			t.Fatalf("expected one delete for the missing thread only, got %s", raw)
+		}
+	})
+}
+
+// fakeIndex serves its points as a single scroll page and records deletes.
+type fakeIndex struct {
+	vector.Store
+	points  []vector.SearchHit
+	deleted []map[string]any
+}
+
+func (f *fakeIndex) Scroll(ctx context.Context, offset string, limit int) ([]vector.SearchHit, string, error) {
+	return f.points, "", nil
+}
+
+func (f *fakeIndex) Delete(ctx context.Context, filter map[string]any) error {
+	f.deleted = append(f.deleted, filter)
+	return nil
+}
+
 func insertOrgAndEntitlement(t *testing.T, ctx context.Context, st *store.Store, orgID string, periodStart, periodEnd time.Time) {
 	t.Helper()
 	if _, err := st.DB().ExecContext(ctx, `INSERT INTO orgs (id, name) VALUES ($1, 'reconcile-org')`, orgID); err != nil {
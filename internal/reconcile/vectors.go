@@ -0,0 +1,69 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+
+	"neuralmail/internal/store"
+	"neuralmail/internal/vector"
+)
+
+// vectorScrollPage is how many points the orphan sweep reads per request.
+const vectorScrollPage = 256
+
+// VectorRegion is one region's vector index and the store holding the
+// threads its points belong to.
+type VectorRegion struct {
+	Region string
+	Store  *store.Store
+	Index  vector.Store
+}
+
+// sweepVectorOrphans deletes the points whose thread no longer exists, the
+// ones a lost or failed cleanup job left behind, and returns how many there
+// were.
+func (s *Service) sweepVectorOrphans(ctx context.Context) (int64, error) {
+	var deleted int64
+	for _, r := range s.Vectors {
+		offset := ""
+		for {
+			points, next, err := r.Index.Scroll(ctx, offset, vectorScrollPage)
+			if err != nil {
+				return deleted, fmt.Errorf("region %q: %w", r.Region, err)
+			}
+			perThread := map[string]int64{}
+			var threadIDs []string
+			for _, p := range points {
+				threadID, _ := p.Payload["thread_id"].(string)
+				if threadID == "" {
+					continue
+				}
+				if perThread[threadID] == 0 {
+					threadIDs = append(threadIDs, threadID)
+				}
+				perThread[threadID]++
+			}
+			existing, err := r.Store.ExistingThreadIDs(ctx, threadIDs)
+			if err != nil {
+				return deleted, err
+			}
+			var orphans []string
+			for _, id := range threadIDs {
+				if !existing[id] {
+					orphans = append(orphans, id)
+					deleted += perThread[id]
+				}
+			}
+			if len(orphans) > 0 {
+				if err := r.Index.Delete(ctx, vector.MatchAny("thread_id", orphans)); err != nil {
+					return deleted, fmt.Errorf("region %q: %w", r.Region, err)
+				}
+			}
+			if next == "" {
+				break
+			}
+			offset = next
+		}
+	}
+	return deleted, nil
+}
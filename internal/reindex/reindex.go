@@ -0,0 +1,184 @@
+// Package reindex re-embeds stored messages into a fresh vector collection
+// and moves search over to it, for changing embedding models or dimensions.
+package reindex
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"neuralmail/internal/embed"
+	"neuralmail/internal/store"
+	"neuralmail/internal/vector"
+)
+
+const defaultBatchSize = 100
+
+// Target is one region to re-index: the store holding its messages and the
+// Qdrant alias its searches and the embedding worker go through.
+type Target struct {
+	Region string
+	Store  *store.Store
+	Qdrant *vector.Qdrant
+}
+
+// Reindexer embeds every message of a target into a new collection named
+// after the alias and the start time, then points the alias at it. Progress
+// is checkpointed in Directory after each batch, so a run that stops
+// resumes from its last batch as long as the model and dimension are
+// unchanged.
+type Reindexer struct {
+	// Directory holds the checkpoints and inbox settings.
+	Directory *store.Store
+	Embedder  embed.Provider
+	// Model identifies the embedding model; a checkpoint for another model
+	// is abandoned rather than resumed.
+	Model     string
+	BatchSize int
+	// ChunkSize and ChunkOverlap cut messages as the embedding worker
+	// does.
+	ChunkSize    int
+	ChunkOverlap int
+	// Progress, when set, is called after every batch.
+	Progress func(store.EmbeddingReindex)
+	Now      func() time.Time
+}
+
+// Run re-indexes t and reports the finished checkpoint and whether it
+// resumed an earlier run. The collection the alias pointed at before is
+// left in place for rollback.
+func (r *Reindexer) Run(ctx context.Context, t Target) (store.EmbeddingReindex, bool, error) {
+	dim := r.Embedder.Dim()
+	run, resumed, err := r.Directory.OpenEmbeddingReindex(ctx, store.EmbeddingReindex{
+		Region:     t.Region,
+		Alias:      t.Qdrant.Collection,
+		Collection: fmt.Sprintf("%s_%s", t.Qdrant.Collection, r.now().UTC().Format("20060102150405")),
+		Model:      r.Model,
+		Dim:        dim,
+	})
+	if err != nil {
+		return run, false, err
+	}
+	target := t.Qdrant.WithCollection(run.Collection)
+	exists, err := target.CollectionExists(ctx)
+	if err != nil {
+		return run, resumed, err
+	}
+	if !exists {
+		if err := target.EnsureCollection(ctx, dim); err != nil {
+			return run, resumed, fmt.Errorf("create %s: %w", run.Collection, err)
+		}
+	}
+
+	if err := r.walk(ctx, t.Store, target, &run); err != nil {
+		return run, resumed, err
+	}
+	if err := t.Qdrant.PointAlias(ctx, run.Collection); err != nil {
+		return run, resumed, err
+	}
+	// Until the alias moved, the worker embedded new mail into the old
+	// collection; pick up what arrived during the walk.
+	if err := r.walk(ctx, t.Store, target, &run); err != nil {
+		return run, resumed, err
+	}
+	return run, resumed, r.Directory.FinishEmbeddingReindex(ctx, run.ID)
+}
+
+// walk embeds the messages after run's cursor into target a batch at a
+// time, skipping those the worker would skip, and checkpoints each batch.
+func (r *Reindexer) walk(ctx context.Context, st *store.Store, target *vector.Qdrant, run *store.EmbeddingReindex) error {
+	disabled := map[string]bool{}
+	for {
+		batch, err := st.ListMessagesAfter(ctx, run.CursorCreatedAt, run.CursorID, r.batchSize())
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		var keep []store.ReindexMessage
+		var chunks [][]embed.Chunk
+		var texts []string
+		for _, m := range batch {
+			skip, err := r.skip(ctx, m, disabled)
+			if err != nil {
+				return err
+			}
+			if skip {
+				run.Skipped++
+				continue
+			}
+			keep = append(keep, m)
+			split := embed.Split(m.Text, r.ChunkSize, r.ChunkOverlap)
+			chunks = append(chunks, split)
+			for _, c := range split {
+				texts = append(texts, c.Text)
+			}
+		}
+		if len(keep) > 0 {
+			vecs, err := r.Embedder.Embed(ctx, texts)
+			if err != nil {
+				return fmt.Errorf("embedding: %w", err)
+			}
+			if len(vecs) != len(texts) {
+				return fmt.Errorf("embedder returned %d vectors for %d chunks", len(vecs), len(texts))
+			}
+			var points []vector.Point
+			for i, m := range keep {
+				n := len(chunks[i])
+				points = append(points, vector.MessagePoints(m.ID, m.ThreadID, m.InboxID, m.Direction, chunks[i], vecs[:n])...)
+				vecs = vecs[n:]
+			}
+			if err := target.Upsert(ctx, points); err != nil {
+				return fmt.Errorf("qdrant upsert: %w", err)
+			}
+			run.Embedded += int64(len(keep))
+		}
+		last := batch[len(batch)-1]
+		run.CursorCreatedAt, run.CursorID = last.CreatedAt, last.ID
+		if err := r.Directory.AdvanceEmbeddingReindex(ctx, *run); err != nil {
+			return err
+		}
+		if r.Progress != nil {
+			r.Progress(*run)
+		}
+	}
+}
+
+// skip reports whether m stays out of the index: oversized messages and
+// those of inboxes with embedding disabled or since deleted. Search filters
+// by inbox, so messages without one are never found and are skipped too.
+func (r *Reindexer) skip(ctx context.Context, m store.ReindexMessage, disabled map[string]bool) (bool, error) {
+	if m.Oversized || m.InboxID == "" {
+		return true, nil
+	}
+	off, ok := disabled[m.InboxID]
+	if !ok {
+		var err error
+		off, err = r.Directory.InboxEmbeddingDisabled(ctx, m.InboxID)
+		if errors.Is(err, sql.ErrNoRows) {
+			off, err = true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		disabled[m.InboxID] = off
+	}
+	return off, nil
+}
+
+func (r *Reindexer) batchSize() int {
+	if r.BatchSize > 0 {
+		return r.BatchSize
+	}
+	return defaultBatchSize
+}
+
+func (r *Reindexer) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,126 @@
+// Package rerank re-scores search candidates against the query with a model
+// that reads query and text together, which ranks marginal vector hits better
+// than embedding distance alone.
+package rerank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/llm"
+)
+
+// Reranker scores docs against query, one score per doc, higher is better.
+type Reranker interface {
+	Score(ctx context.Context, query string, docs []string) ([]float64, error)
+	Name() string
+}
+
+// New returns the reranker configured in cfg.Rerank, or nil when re-ranking
+// is off.
+func New(cfg config.Config, provider llm.Provider) (Reranker, error) {
+	switch cfg.Rerank.Provider {
+	case "", "none":
+		return nil, nil
+	case "cross_encoder":
+		if cfg.Rerank.URL == "" {
+			return nil, errors.New("rerank: cross_encoder requires rerank.url")
+		}
+		return NewCrossEncoder(cfg.Rerank.URL), nil
+	case "llm":
+		scorer, ok := provider.(llm.Scorer)
+		if !ok {
+			return nil, fmt.Errorf("rerank: llm provider %q cannot score", provider.Name())
+		}
+		return &LLM{Scorer: scorer, Provider: provider.Name()}, nil
+	default:
+		return nil, fmt.Errorf("rerank: unknown provider %q", cfg.Rerank.Provider)
+	}
+}
+
+// Order returns the indexes of scores from best to worst. Ties keep their
+// original order, so equal scores leave the vector ranking in place.
+func Order(scores []float64) []int {
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	return order
+}
+
+// CrossEncoder calls a cross-encoder served over HTTP with the text
+// embeddings inference /rerank API.
+type CrossEncoder struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewCrossEncoder(url string) *CrossEncoder {
+	return &CrossEncoder{URL: strings.TrimRight(url, "/"), Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (c *CrossEncoder) Name() string {
+	return "cross_encoder"
+}
+
+func (c *CrossEncoder) Score(ctx context.Context, query string, docs []string) ([]float64, error) {
+	body, _ := json.Marshal(map[string]any{"query": query, "texts": docs})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL+"/rerank", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("cross encoder rerank request failed: %s", resp.Status)
+	}
+	var ranked []struct {
+		Index int     `json:"index"`
+		Score float64 `json:"score"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ranked); err != nil {
+		return nil, err
+	}
+	scores := make([]float64, len(docs))
+	for _, r := range ranked {
+		if r.Index < 0 || r.Index >= len(docs) {
+			return nil, fmt.Errorf("cross encoder returned index %d for %d texts", r.Index, len(docs))
+		}
+		scores[r.Index] = r.Score
+	}
+	return scores, nil
+}
+
+// LLM scores with the configured LLM provider.
+type LLM struct {
+	Scorer   llm.Scorer
+	Provider string
+}
+
+func (l *LLM) Name() string {
+	return "llm:" + l.Provider
+}
+
+func (l *LLM) Score(ctx context.Context, query string, docs []string) ([]float64, error) {
+	scores, err := l.Scorer.Score(ctx, query, docs)
+	if err != nil {
+		return nil, err
+	}
+	if len(scores) != len(docs) {
+		return nil, fmt.Errorf("llm returned %d scores for %d docs", len(scores), len(docs))
+	}
+	return scores, nil
+}
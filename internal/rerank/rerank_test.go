@@ -0,0 +1,65 @@
+package rerank
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/llm"
+)
+
+func TestCrossEncoderMapsScoresByIndex(t *testing.T) {
+	var got struct {
+		Query string   `json:"query"`
+		Texts []string `json:"texts"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rerank" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`[{"index":1,"score":0.9},{"index":0,"score":0.2}]`))
+	}))
+	defer srv.Close()
+
+	scores, err := NewCrossEncoder(srv.URL+"/").Score(context.Background(), "refund", []string{"hello", "refund please"})
+	if err != nil {
+		t.Fatalf("score: %v", err)
+	}
+	if got.Query != "refund" || len(got.Texts) != 2 {
+		t.Fatalf("unexpected request: %+v", got)
+	}
+	if !slices.Equal(scores, []float64{0.2, 0.9}) {
+		t.Fatalf("unexpected scores: %v", scores)
+	}
+	if order := Order(scores); !slices.Equal(order, []int{1, 0}) {
+		t.Fatalf("unexpected order: %v", order)
+	}
+}
+
+func TestOrderKeepsTiesInPlace(t *testing.T) {
+	if order := Order([]float64{0.5, 0.5, 1, 0.5}); !slices.Equal(order, []int{2, 0, 1, 3}) {
+		t.Fatalf("unexpected order: %v", order)
+	}
+}
+
+func TestNewSelectsProvider(t *testing.T) {
+	cfg := config.Config{}
+	if r, err := New(cfg, llm.NewNoop()); err != nil || r != nil {
+		t.Fatalf("expected no reranker by default, got %v %v", r, err)
+	}
+	cfg.Rerank.Provider = "llm"
+	r, err := New(cfg, llm.NewNoop())
+	if err != nil || r.Name() != "llm:noop" {
+		t.Fatalf("expected llm reranker, got %v %v", r, err)
+	}
+	cfg.Rerank.Provider = "cross_encoder"
+	if _, err := New(cfg, llm.NewNoop()); err == nil {
+		t.Fatalf("expected cross_encoder without url to fail")
+	}
+}
@@ -0,0 +1,305 @@
+// Package residency keeps an org's mail in the region it is tagged with. The
+// home database remains the directory of orgs and inboxes; threads, messages
+// and vectors for a tagged org are read and written on that region's
+// Postgres and Qdrant, and writes that would land in another region are
+// refused.
+package residency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sync"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/store"
+	"neuralmail/internal/vector"
+)
+
+var (
+	ErrUnknownRegion = errors.New("unknown residency region")
+	ErrCrossRegion   = errors.New("cross-region data movement is not allowed")
+)
+
+// Home is the region name used for the home deployment.
+const Home = ""
+
+var regionName = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// Directory resolves region tags; the home *store.Store satisfies it.
+type Directory interface {
+	GetOrgRegion(ctx context.Context, orgID string) (string, error)
+	GetInboxRegion(ctx context.Context, inboxID string) (string, error)
+	GetInboxReplica(ctx context.Context, inboxID string) (store.InboxReplica, error)
+	InboxEmbeddingDisabled(ctx context.Context, inboxID string) (bool, error)
+}
+
+// Backend is the storage serving one region. Vector is nil when embeddings
+// are disabled.
+type Backend struct {
+	Region string
+	Store  *store.Store
+	Vector vector.Store
+}
+
+type Router struct {
+	homeName  string
+	directory Directory
+	backends  map[string]Backend
+
+	mu         sync.Mutex
+	replicated map[string]bool
+}
+
+// NewRouter builds a router over already-open backends. backends must hold
+// the home deployment under Home.
+func NewRouter(homeName string, directory Directory, backends map[string]Backend) *Router {
+	r := &Router{
+		homeName:   homeName,
+		directory:  directory,
+		backends:   make(map[string]Backend, len(backends)),
+		replicated: make(map[string]bool),
+	}
+	for name, backend := range backends {
+		backend.Region = name
+		if backend.Vector != nil {
+			backend.Vector = &guardedVector{Store: backend.Vector, region: name, router: r}
+		}
+		r.backends[name] = backend
+	}
+	return r
+}
+
+// Open connects to every region in cfg.Residency. home and homeVector serve
+// untagged orgs; a nil homeVector leaves every region without vectors.
+func Open(cfg config.Config, home *store.Store, homeVector vector.Store) (*Router, error) {
+	backends := map[string]Backend{Home: {Store: home, Vector: homeVector}}
+	for name, storage := range cfg.Residency.Regions {
+		if err := validateRegion(cfg, name, storage); err != nil {
+			closeBackends(backends)
+			return nil, err
+		}
+		st, err := store.Open(storage.DatabaseDSN)
+		if err != nil {
+			closeBackends(backends)
+			return nil, fmt.Errorf("region %s: %w", name, err)
+		}
+		backend := Backend{Store: st}
+		if homeVector != nil {
+			backend.Vector = vector.NewQdrant(storage.QdrantURL, storage.QdrantCollection)
+		}
+		backends[name] = backend
+	}
+	return NewRouter(cfg.Residency.HomeRegion, home, backends), nil
+}
+
+func validateRegion(cfg config.Config, name string, storage config.RegionStorage) error {
+	switch {
+	case !regionName.MatchString(name):
+		return fmt.Errorf("region %q: name must be lowercase letters, digits and dashes", name)
+	case name == cfg.Residency.HomeRegion:
+		return fmt.Errorf("region %q: home region uses database.dsn and qdrant.url", name)
+	case storage.DatabaseDSN == "":
+		return fmt.Errorf("region %q: missing database_dsn", name)
+	case storage.DatabaseDSN == cfg.Database.DSN:
+		return fmt.Errorf("region %q: database_dsn must differ from the home database", name)
+	case cfg.Embedding.Provider != "noop" && storage.QdrantURL == "":
+		return fmt.Errorf("region %q: missing qdrant_url", name)
+	}
+	return nil
+}
+
+func closeBackends(backends map[string]Backend) {
+	for name, backend := range backends {
+		if name != Home && backend.Store != nil {
+			_ = backend.Store.Close()
+		}
+	}
+}
+
+// Migrate applies the schema to every regional database. The home database
+// is migrated by its owner.
+func (r *Router) Migrate(ctx context.Context) error {
+	for _, name := range r.Regions() {
+		if name == Home {
+			continue
+		}
+		if err := store.Migrate(ctx, r.backends[name].Store.DB()); err != nil {
+			return fmt.Errorf("region %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the regional databases, leaving the home store to its owner.
+func (r *Router) Close() error {
+	var first error
+	for name, backend := range r.backends {
+		if name == Home {
+			continue
+		}
+		if err := backend.Store.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Regions lists the configured regions, with Home first.
+func (r *Router) Regions() []string {
+	names := make([]string, 0, len(r.backends))
+	for name := range r.backends {
+		if name != Home {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return append([]string{Home}, names...)
+}
+
+// Canonical maps a requested region to the stored tag: the home region's name
+// becomes Home. ok is false for regions that are not configured.
+func (r *Router) Canonical(region string) (string, bool) {
+	if region == r.homeName {
+		region = Home
+	}
+	_, ok := r.backends[region]
+	return region, ok
+}
+
+// Backend returns the storage for a region tag.
+func (r *Router) Backend(region string) (Backend, error) {
+	region, _ = r.Canonical(region)
+	backend, ok := r.backends[region]
+	if !ok {
+		return Backend{}, fmt.Errorf("%w: %s", ErrUnknownRegion, region)
+	}
+	return backend, nil
+}
+
+// ForOrg returns the storage holding an org's mail. An empty orgID is the
+// self-hosted default and stays home.
+func (r *Router) ForOrg(ctx context.Context, orgID string) (Backend, error) {
+	if orgID == "" {
+		return r.backends[Home], nil
+	}
+	region, err := r.directory.GetOrgRegion(ctx, orgID)
+	if err != nil {
+		return Backend{}, err
+	}
+	return r.Backend(region)
+}
+
+// ForInbox returns the storage an inbox's mail is ingested into. The first
+// call for a regional inbox copies its org and inbox rows into the regional
+// database so the foreign keys there hold.
+func (r *Router) ForInbox(ctx context.Context, inboxID string) (Backend, error) {
+	region, err := r.directory.GetInboxRegion(ctx, inboxID)
+	if err != nil {
+		return Backend{}, err
+	}
+	backend, err := r.Backend(region)
+	if err != nil || backend.Region == Home {
+		return backend, err
+	}
+	if err := r.replicate(ctx, backend, inboxID); err != nil {
+		return Backend{}, err
+	}
+	return backend, nil
+}
+
+func (r *Router) replicate(ctx context.Context, backend Backend, inboxID string) error {
+	r.mu.Lock()
+	done := r.replicated[inboxID]
+	r.mu.Unlock()
+	if done {
+		return nil
+	}
+	replica, err := r.directory.GetInboxReplica(ctx, inboxID)
+	if err != nil {
+		return err
+	}
+	if replica.Region != backend.Region {
+		return fmt.Errorf("%w: inbox %s is tagged %q, not %q", ErrCrossRegion, inboxID, replica.Region, backend.Region)
+	}
+	if err := backend.Store.UpsertInboxReplica(ctx, replica); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.replicated[inboxID] = true
+	r.mu.Unlock()
+	return nil
+}
+
+// EmbeddingDisabled reports the inbox's embedding switch from the directory,
+// which stays authoritative for inbox settings after replication.
+func (r *Router) EmbeddingDisabled(ctx context.Context, inboxID string) (bool, error) {
+	return r.directory.InboxEmbeddingDisabled(ctx, inboxID)
+}
+
+// LocateMessage finds the region holding a message, for consumers such as
+// the embedding worker whose jobs carry only a message ID.
+func (r *Router) LocateMessage(ctx context.Context, messageID string) (Backend, store.Message, error) {
+	var msg store.Message
+	backend, err := r.locate(func(st *store.Store) (err error) {
+		msg, err = st.GetMessage(ctx, messageID)
+		return err
+	})
+	return backend, msg, err
+}
+
+// LocateThread finds the region holding a thread and returns it with its
+// messages.
+func (r *Router) LocateThread(ctx context.Context, threadID string) (Backend, store.Thread, []store.Message, error) {
+	var thread store.Thread
+	var messages []store.Message
+	backend, err := r.locate(func(st *store.Store) (err error) {
+		thread, messages, err = st.GetThread(ctx, threadID)
+		return err
+	})
+	return backend, thread, messages, err
+}
+
+// locate runs lookup against each region in turn until one finds the row.
+func (r *Router) locate(lookup func(st *store.Store) error) (Backend, error) {
+	for _, name := range r.Regions() {
+		backend := r.backends[name]
+		err := lookup(backend.Store)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return Backend{}, err
+		}
+		return backend, nil
+	}
+	return Backend{}, sql.ErrNoRows
+}
+
+// guardedVector refuses to upsert points whose inbox belongs to a different
+// region than the collection it is writing to.
+type guardedVector struct {
+	vector.Store
+	region string
+	router *Router
+}
+
+func (g *guardedVector) Upsert(ctx context.Context, points []vector.Point) error {
+	for _, point := range points {
+		inboxID, _ := point.Payload["inbox_id"].(string)
+		if inboxID == "" {
+			return fmt.Errorf("%w: point %s has no inbox_id", ErrCrossRegion, point.ID)
+		}
+		region, err := g.router.directory.GetInboxRegion(ctx, inboxID)
+		if err != nil {
+			return err
+		}
+		if region, _ = g.router.Canonical(region); region != g.region {
+			return fmt.Errorf("%w: point %s belongs to %q, not %q", ErrCrossRegion, point.ID, region, g.region)
+		}
+	}
+	return g.Store.Upsert(ctx, points)
+}
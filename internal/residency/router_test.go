@@ -0,0 +1,177 @@
+package residency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/store"
+	"neuralmail/internal/vector"
+)
+
+type fakeDirectory struct {
+	orgs    map[string]string
+	inboxes map[string]string
+}
+
+func (f fakeDirectory) GetOrgRegion(ctx context.Context, orgID string) (string, error) {
+	region, ok := f.orgs[orgID]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return region, nil
+}
+
+func (f fakeDirectory) GetInboxRegion(ctx context.Context, inboxID string) (string, error) {
+	region, ok := f.inboxes[inboxID]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return region, nil
+}
+
+func (f fakeDirectory) GetInboxReplica(ctx context.Context, inboxID string) (store.InboxReplica, error) {
+	return store.InboxReplica{}, errors.New("not used")
+}
+
+func (f fakeDirectory) InboxEmbeddingDisabled(ctx context.Context, inboxID string) (bool, error) {
+	return false, nil
+}
+
+type fakeVector struct {
+	name     string
+	upserted []vector.Point
+}
+
+func (f *fakeVector) Upsert(ctx context.Context, points []vector.Point) error {
+	f.upserted = append(f.upserted, points...)
+	return nil
+}
+
+func (f *fakeVector) Search(ctx context.Context, v []float32, limit int, filter map[string]any) ([]vector.SearchHit, error) {
+	return nil, nil
+}
+
+func (f *fakeVector) EnsureCollection(ctx context.Context, dim int) error { return nil }
+
+func (f *fakeVector) Delete(ctx context.Context, filter map[string]any) error { return nil }
+
+func (f *fakeVector) Scroll(ctx context.Context, offset string, limit int) ([]vector.SearchHit, string, error) {
+	return nil, "", nil
+}
+
+func (f *fakeVector) Name() string { return f.name }
+
+func testRouter(homeVec, euVec *fakeVector) *Router {
+	dir := fakeDirectory{
+		orgs:    map[string]string{"org-us": "", "org-eu": "eu", "org-gone": "apac"},
+		inboxes: map[string]string{"inbox-us": "", "inbox-eu": "eu"},
+	}
+	return NewRouter("us", dir, map[string]Backend{
+		Home: {Vector: homeVec},
+		"eu": {Vector: euVec},
+	})
+}
+
+func TestForOrgRoutesByRegionTag(t *testing.T) {
+	router := testRouter(&fakeVector{name: "home"}, &fakeVector{name: "eu"})
+	ctx := context.Background()
+
+	backend, err := router.ForOrg(ctx, "org-eu")
+	if err != nil || backend.Region != "eu" || backend.Vector.Name() != "eu" {
+		t.Fatalf("expected eu backend, got %+v err=%v", backend, err)
+	}
+	backend, err = router.ForOrg(ctx, "org-us")
+	if err != nil || backend.Region != Home {
+		t.Fatalf("expected home backend, got %+v err=%v", backend, err)
+	}
+	backend, err = router.ForOrg(ctx, "")
+	if err != nil || backend.Region != Home {
+		t.Fatalf("expected self-hosted default to stay home, got %+v err=%v", backend, err)
+	}
+	if _, err := router.ForOrg(ctx, "org-gone"); !errors.Is(err, ErrUnknownRegion) {
+		t.Fatalf("expected ErrUnknownRegion for unconfigured region, got %v", err)
+	}
+	if _, err := router.ForOrg(ctx, "missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows for unknown org, got %v", err)
+	}
+}
+
+func TestCanonicalTreatsHomeNameAsHome(t *testing.T) {
+	router := testRouter(nil, nil)
+	if region, ok := router.Canonical("us"); !ok || region != Home {
+		t.Fatalf("expected home name to map to Home, got %q ok=%v", region, ok)
+	}
+	if region, ok := router.Canonical("eu"); !ok || region != "eu" {
+		t.Fatalf("expected eu, got %q ok=%v", region, ok)
+	}
+	if _, ok := router.Canonical("apac"); ok {
+		t.Fatalf("expected apac to be unknown")
+	}
+	if got := router.Regions(); len(got) != 2 || got[0] != Home || got[1] != "eu" {
+		t.Fatalf("unexpected regions %v", got)
+	}
+}
+
+func TestVectorUpsertRejectsOtherRegionsPoints(t *testing.T) {
+	homeVec, euVec := &fakeVector{name: "home"}, &fakeVector{name: "eu"}
+	router := testRouter(homeVec, euVec)
+	ctx := context.Background()
+	eu, _ := router.Backend("eu")
+
+	err := eu.Vector.Upsert(ctx, []vector.Point{{ID: "m1", Payload: map[string]any{"inbox_id": "inbox-us"}}})
+	if !errors.Is(err, ErrCrossRegion) {
+		t.Fatalf("expected ErrCrossRegion, got %v", err)
+	}
+	err = eu.Vector.Upsert(ctx, []vector.Point{{ID: "m2", Payload: map[string]any{}}})
+	if !errors.Is(err, ErrCrossRegion) {
+		t.Fatalf("expected ErrCrossRegion for point without inbox, got %v", err)
+	}
+	if len(euVec.upserted) != 0 {
+		t.Fatalf("expected nothing written, got %+v", euVec.upserted)
+	}
+
+	if err := eu.Vector.Upsert(ctx, []vector.Point{{ID: "m3", Payload: map[string]any{"inbox_id": "inbox-eu"}}}); err != nil {
+		t.Fatalf("upsert eu point: %v", err)
+	}
+	home, _ := router.Backend("us")
+	if err := home.Vector.Upsert(ctx, []vector.Point{{ID: "m4", Payload: map[string]any{"inbox_id": "inbox-us"}}}); err != nil {
+		t.Fatalf("upsert home point: %v", err)
+	}
+	if len(euVec.upserted) != 1 || len(homeVec.upserted) != 1 {
+		t.Fatalf("expected one point per region, eu=%d home=%d", len(euVec.upserted), len(homeVec.upserted))
+	}
+}
+
+func TestOpenValidatesRegions(t *testing.T) {
+	base := config.Default()
+	base.Database.DSN = "postgres://home/neuralmail"
+	base.Residency.HomeRegion = "us"
+
+	cases := map[string]config.RegionStorage{
+		"EU":         {DatabaseDSN: "postgres://eu/neuralmail"},
+		"us":         {DatabaseDSN: "postgres://us-2/neuralmail"},
+		"eu-missing": {},
+		"eu-shared":  {DatabaseDSN: "postgres://home/neuralmail"},
+	}
+	for name, storage := range cases {
+		cfg := base
+		cfg.Residency.Regions = map[string]config.RegionStorage{name: storage}
+		if _, err := Open(cfg, nil, nil); err == nil {
+			t.Fatalf("expected region %q to be rejected", name)
+		}
+	}
+
+	cfg := base
+	cfg.Residency.Regions = map[string]config.RegionStorage{"eu": {DatabaseDSN: "postgres://eu/neuralmail"}}
+	router, err := Open(cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer router.Close()
+	if eu, err := router.Backend("eu"); err != nil || eu.Store == nil || eu.Vector != nil {
+		t.Fatalf("expected eu store without vectors, got %+v err=%v", eu, err)
+	}
+}
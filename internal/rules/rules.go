@@ -0,0 +1,270 @@
+// Package rules runs orgs' automation rules on new inbound mail. A rule
+// matches a message by its filters, then, if it has conditions, by how the
+// message triages, and applies its actions to the message's thread: label,
+// set priority, draft a reply, notify the org's webhooks or assign. Rules in
+// dry run record what they would have done instead.
+package rules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/notify"
+	"neuralmail/internal/store"
+)
+
+// Tools triages messages and drafts replies for rules; *tools.Service
+// implements it. Both are called as the rule's org.
+type Tools interface {
+	TriageMessage(ctx context.Context, messageID string, bypassCache bool) (any, error)
+	DraftReply(ctx context.Context, threadID string, goal string) (any, error)
+}
+
+// Priorities a set_priority action can set, the urgencies triage reports.
+var Priorities = []string{"low", "medium", "high"}
+
+// Engine runs rules stored in Directory, the home store. Webhook actions
+// publish through Notify.
+type Engine struct {
+	Directory *store.Store
+	Tools     Tools
+	Notify    *notify.Webhooks
+}
+
+func New(directory *store.Store, tools Tools) *Engine {
+	return &Engine{Directory: directory, Tools: tools, Notify: notify.NewWebhooks()}
+}
+
+// Validate checks that a rule can run: it has a name and at least one
+// action, its subject pattern compiles and each action is known and has
+// the value it needs.
+func Validate(r store.AutomationRule) error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("missing name")
+	}
+	if _, err := compileSubject(r.Filters.Subject); err != nil {
+		return err
+	}
+	if r.Conditions.MinConfidence < 0 || r.Conditions.MinConfidence > 1 {
+		return errors.New("min_confidence must be between 0 and 1")
+	}
+	if len(r.Actions) == 0 {
+		return errors.New("missing actions")
+	}
+	for _, a := range r.Actions {
+		switch a.Type {
+		case store.RuleActionLabel, store.RuleActionAssign:
+			if strings.TrimSpace(a.Value) == "" {
+				return fmt.Errorf("%s action needs a value", a.Type)
+			}
+		case store.RuleActionSetPriority:
+			if !slices.Contains(Priorities, a.Value) {
+				return fmt.Errorf("set_priority value must be one of %s", strings.Join(Priorities, ", "))
+			}
+		case store.RuleActionDraft, store.RuleActionWebhook:
+		default:
+			return fmt.Errorf("unknown action %q", a.Type)
+		}
+	}
+	return nil
+}
+
+func compileSubject(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, fmt.Errorf("subject pattern %q: %w", pattern, err)
+	}
+	return re, nil
+}
+
+// Matches reports whether msg passes the rule's filters.
+func Matches(f store.RuleFilters, msg store.Message) bool {
+	if len(f.From) > 0 && !matchesSender(f.From, msg.From.Email) {
+		return false
+	}
+	if re, err := compileSubject(f.Subject); err != nil || (re != nil && !re.MatchString(msg.Subject)) {
+		return false
+	}
+	if len(f.BodyContains) > 0 {
+		body := strings.ToLower(msg.Text)
+		if !slices.ContainsFunc(f.BodyContains, func(phrase string) bool {
+			return phrase != "" && strings.Contains(body, strings.ToLower(phrase))
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesSender(senders []string, from string) bool {
+	from = strings.ToLower(strings.TrimSpace(from))
+	if from == "" {
+		return false
+	}
+	_, domain, _ := strings.Cut(from, "@")
+	for _, sender := range senders {
+		sender = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(sender), "@"))
+		if sender != "" && (from == sender || domain == sender || strings.HasSuffix(domain, "."+sender)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Triage is the part of a triage_message result conditions test.
+type Triage struct {
+	Intent     string
+	Urgency    string
+	Sentiment  string
+	Confidence float64
+}
+
+// Holds reports whether t meets every condition set in c.
+func Holds(c store.RuleConditions, t Triage) bool {
+	in := func(values []string, v string) bool {
+		return len(values) == 0 || slices.ContainsFunc(values, func(want string) bool { return strings.EqualFold(want, v) })
+	}
+	return in(c.Intents, t.Intent) && in(c.Urgency, t.Urgency) && in(c.Sentiment, t.Sentiment) && t.Confidence >= c.MinConfidence
+}
+
+// Run applies inboxID's enabled rules to each of messageIDs, new inbound
+// messages stored in st. Every rule that matches a message is recorded with
+// what its actions did; a failed action is recorded and does not stop the
+// others. It only fails if the rules cannot be loaded.
+func (e *Engine) Run(ctx context.Context, st *store.Store, inboxID string, messageIDs []string) error {
+	if len(messageIDs) == 0 {
+		return nil
+	}
+	rules, err := e.Directory.ListInboxAutomationRules(ctx, inboxID)
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+	for _, id := range messageIDs {
+		msg, err := st.GetMessage(ctx, id)
+		if err != nil {
+			slog.ErrorContext(ctx, "rules message lookup failed", "message", id, "err", err)
+			continue
+		}
+		if msg.Direction != "inbound" {
+			continue
+		}
+		e.runMessage(ctx, st, rules, msg)
+	}
+	return nil
+}
+
+func (e *Engine) runMessage(ctx context.Context, st *store.Store, rules []store.AutomationRule, msg store.Message) {
+	var triage *Triage
+	var triageErr error
+	for _, rule := range rules {
+		if !Matches(rule.Filters, msg) {
+			continue
+		}
+		run := store.AutomationRuleRun{OrgID: rule.OrgID, RuleID: rule.ID, MessageID: msg.ID, ThreadID: msg.ThreadID, DryRun: rule.DryRun}
+		ruleCtx := auth.WithPrincipal(ctx, auth.Principal{OrgID: rule.OrgID, ActorID: "rule:" + rule.ID, AuthMethod: "automation_rule"})
+		if !rule.Conditions.Empty() {
+			// One triage serves every rule with conditions.
+			if triage == nil && triageErr == nil {
+				triage, triageErr = e.triage(ruleCtx, msg.ID)
+			}
+			if triageErr != nil {
+				run.Error = "triage: " + triageErr.Error()
+				e.record(ctx, run)
+				continue
+			}
+			if !Holds(rule.Conditions, *triage) {
+				continue
+			}
+		}
+		for _, action := range rule.Actions {
+			result := store.RuleActionResult{Type: action.Type, Value: action.Value, Status: store.RuleActionPlanned}
+			if !rule.DryRun {
+				detail, err := e.apply(ruleCtx, st, rule, msg, action)
+				result.Status, result.Detail = store.RuleActionApplied, detail
+				if err != nil {
+					result.Status, result.Detail = store.RuleActionFailed, err.Error()
+				}
+			}
+			run.Actions = append(run.Actions, result)
+		}
+		e.record(ctx, run)
+	}
+}
+
+func (e *Engine) record(ctx context.Context, run store.AutomationRuleRun) {
+	if err := e.Directory.RecordAutomationRuleRun(ctx, run); err != nil {
+		slog.ErrorContext(ctx, "rule run not recorded", "rule", run.RuleID, "message", run.MessageID, "err", err)
+	}
+}
+
+func (e *Engine) triage(ctx context.Context, messageID string) (*Triage, error) {
+	if e.Tools == nil {
+		return nil, errors.New("triage not configured")
+	}
+	out, err := e.Tools.TriageMessage(ctx, messageID, false)
+	if err != nil {
+		return nil, err
+	}
+	result, _ := out.(map[string]any)
+	t := &Triage{}
+	t.Intent, _ = result["intent"].(string)
+	t.Urgency, _ = result["urgency"].(string)
+	t.Sentiment, _ = result["sentiment"].(string)
+	t.Confidence, _ = result["confidence"].(float64)
+	return t, nil
+}
+
+// apply runs one action on msg's thread and returns a detail worth
+// recording, such as the draft's ID.
+func (e *Engine) apply(ctx context.Context, st *store.Store, rule store.AutomationRule, msg store.Message, action store.RuleAction) (string, error) {
+	threadIDs := []string{msg.ThreadID}
+	switch action.Type {
+	case store.RuleActionLabel:
+		_, err := st.LabelThreads(ctx, threadIDs, action.Value)
+		return "", err
+	case store.RuleActionAssign:
+		_, err := st.AssignThreads(ctx, threadIDs, action.Value)
+		return "", err
+	case store.RuleActionSetPriority:
+		return "", st.SetThreadPriority(ctx, msg.ThreadID, action.Value)
+	case store.RuleActionDraft:
+		if e.Tools == nil {
+			return "", errors.New("drafting not configured")
+		}
+		out, err := e.Tools.DraftReply(ctx, msg.ThreadID, action.Value)
+		if err != nil {
+			return "", err
+		}
+		result, _ := out.(map[string]any)
+		draftID, _ := result["draft_id"].(string)
+		return draftID, nil
+	case store.RuleActionWebhook:
+		if e.Notify == nil {
+			return "", errors.New("webhooks not configured")
+		}
+		data := map[string]any{
+			"rule_id":    rule.ID,
+			"rule_name":  rule.Name,
+			"message_id": msg.ID,
+			"thread_id":  msg.ThreadID,
+			"inbox_id":   msg.InboxID,
+			"subject":    msg.Subject,
+			"from":       msg.From.Email,
+		}
+		if e.Notify.Queue != nil {
+			return "queued for delivery", e.Notify.PublishLater(ctx, e.Directory, rule.OrgID, notify.EventRuleMatched, data)
+		}
+		n, err := e.Notify.Publish(ctx, e.Directory, rule.OrgID, notify.EventRuleMatched, data)
+		return fmt.Sprintf("delivered to %d endpoints", n), err
+	}
+	return "", fmt.Errorf("unknown action %q", action.Type)
+}
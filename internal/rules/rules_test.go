@@ -0,0 +1,76 @@
+package rules
+
+import (
+	"testing"
+
+	"neuralmail/internal/store"
+)
+
+func TestMatches(t *testing.T) {
+	msg := store.Message{
+		Subject: "Refund for order 42",
+		Text:    "The parcel arrived BROKEN, please help.",
+		From:    store.Participant{Email: "Ana@Mail.Example.com"},
+	}
+	cases := []struct {
+		name    string
+		filters store.RuleFilters
+		want    bool
+	}{
+		{"empty", store.RuleFilters{}, true},
+		{"sender domain", store.RuleFilters{From: []string{"example.com"}}, true},
+		{"other sender", store.RuleFilters{From: []string{"other.com"}}, false},
+		{"subject", store.RuleFilters{Subject: `^refund\b`}, true},
+		{"subject miss", store.RuleFilters{Subject: "invoice"}, false},
+		{"body", store.RuleFilters{BodyContains: []string{"cancel", "broken"}}, true},
+		{"body miss", store.RuleFilters{BodyContains: []string{"cancel"}}, false},
+		{"all", store.RuleFilters{From: []string{"@mail.example.com"}, Subject: "order", BodyContains: []string{"help"}}, true},
+	}
+	for _, tc := range cases {
+		if got := Matches(tc.filters, msg); got != tc.want {
+			t.Errorf("%s: Matches = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestHolds(t *testing.T) {
+	triage := Triage{Intent: "refund_request", Urgency: "high", Sentiment: "negative", Confidence: 0.8}
+	if !Holds(store.RuleConditions{}, triage) {
+		t.Fatal("empty conditions should hold")
+	}
+	if !Holds(store.RuleConditions{Intents: []string{"billing", "refund_request"}, Urgency: []string{"HIGH"}, MinConfidence: 0.5}, triage) {
+		t.Fatal("matching conditions should hold")
+	}
+	if Holds(store.RuleConditions{Sentiment: []string{"positive"}}, triage) {
+		t.Fatal("sentiment mismatch should not hold")
+	}
+	if Holds(store.RuleConditions{MinConfidence: 0.9}, triage) {
+		t.Fatal("low confidence should not hold")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := store.AutomationRule{Name: "refunds", Actions: []store.RuleAction{{Type: store.RuleActionLabel, Value: "refund"}}}
+	if err := Validate(valid); err != nil {
+		t.Fatalf("valid rule: %v", err)
+	}
+	invalid := map[string]func(r *store.AutomationRule){
+		"no name":     func(r *store.AutomationRule) { r.Name = " " },
+		"no actions":  func(r *store.AutomationRule) { r.Actions = nil },
+		"bad subject": func(r *store.AutomationRule) { r.Filters.Subject = "(" },
+		"bad priority": func(r *store.AutomationRule) {
+			r.Actions[0] = store.RuleAction{Type: store.RuleActionSetPriority, Value: "urgent"}
+		},
+		"empty assignee": func(r *store.AutomationRule) { r.Actions[0] = store.RuleAction{Type: store.RuleActionAssign} },
+		"unknown action": func(r *store.AutomationRule) { r.Actions[0] = store.RuleAction{Type: "forward"} },
+		"confidence":     func(r *store.AutomationRule) { r.Conditions.MinConfidence = 2 },
+	}
+	for name, mutate := range invalid {
+		rule := valid
+		rule.Actions = append([]store.RuleAction(nil), valid.Actions...)
+		mutate(&rule)
+		if err := Validate(rule); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
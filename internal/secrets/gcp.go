@@ -0,0 +1,91 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// GCPSecretManager reads secrets from GCP Secret Manager. Paths are
+// resource names, projects/{project}/secrets/{secret}, optionally with
+// /versions/{version}; the latest version is read by default.
+type GCPSecretManager struct {
+	// Token returns an OAuth access token; without it one is requested from
+	// the metadata server of the instance the process runs on.
+	Token func(ctx context.Context) (string, error)
+	// Endpoint overrides https://secretmanager.googleapis.com.
+	Endpoint string
+	Client   *http.Client
+}
+
+func (g *GCPSecretManager) Fetch(ctx context.Context, path string) (string, error) {
+	name := strings.Trim(path, "/")
+	if !strings.HasPrefix(name, "projects/") {
+		return "", fmt.Errorf("gcp secret manager: %q is not a projects/{project}/secrets/{secret} name", path)
+	}
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	tokenFn := g.Token
+	if tokenFn == nil {
+		tokenFn = g.metadataToken
+	}
+	token, err := tokenFn(ctx)
+	if err != nil {
+		return "", fmt.Errorf("gcp secret manager: token: %w", err)
+	}
+	endpoint := g.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretmanager.googleapis.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(endpoint, "/")+"/v1/"+name+":access", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	body, err := doRequest(g.Client, req)
+	if err != nil {
+		return "", fmt.Errorf("gcp secret manager: %w", err)
+	}
+	var out struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", fmt.Errorf("gcp secret manager: %w", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(out.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("gcp secret manager: %w", err)
+	}
+	return string(data), nil
+}
+
+func (g *GCPSecretManager) metadataToken(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpMetadataTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	body, err := doRequest(g.Client, req)
+	if err != nil {
+		return "", err
+	}
+	var out struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", err
+	}
+	if out.AccessToken == "" {
+		return "", errors.New("metadata server returned no access token")
+	}
+	return out.AccessToken, nil
+}
@@ -0,0 +1,176 @@
+// Package secrets resolves references to secrets held outside the
+// configuration, so a setting can name where its value lives instead of
+// carrying it:
+//
+//	vault:kv/data/nerve#stripe_key                HashiCorp Vault (KV v1 or v2)
+//	awssm:prod/nerve#stripe_key                   AWS Secrets Manager
+//	gcpsm:projects/acme/secrets/nerve#stripe_key  GCP Secret Manager
+//
+// The part after # picks a field of a secret holding a JSON object; without
+// it the whole secret is the value. Resolved secrets are cached until
+// Refresh fetches them again.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Provider fetches the secret at path from one secret store. Secrets made
+// of several fields come back as a JSON object.
+type Provider interface {
+	Fetch(ctx context.Context, path string) (string, error)
+}
+
+// Resolver resolves references through the Provider registered for their
+// scheme.
+type Resolver struct {
+	Providers map[string]Provider
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+// IsRef reports whether value is a reference to a secret rather than a
+// value.
+func IsRef(value string) bool {
+	scheme, path, ok := strings.Cut(value, ":")
+	if !ok || path == "" {
+		return false
+	}
+	switch scheme {
+	case "vault", "awssm", "gcpsm":
+		return true
+	}
+	return false
+}
+
+// Resolve returns the secret ref names, from the cache once it has been
+// fetched.
+func (r *Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	r.mu.Lock()
+	value, ok := r.cache[ref]
+	r.mu.Unlock()
+	if ok {
+		return value, nil
+	}
+	value, err := r.fetch(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	if r.cache == nil {
+		r.cache = map[string]string{}
+	}
+	r.cache[ref] = value
+	r.mu.Unlock()
+	return value, nil
+}
+
+// Refresh fetches every secret resolved so far again and returns the
+// references whose value changed. A secret that fails to fetch keeps its
+// cached value.
+func (r *Resolver) Refresh(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	refs := make([]string, 0, len(r.cache))
+	for ref := range r.cache {
+		refs = append(refs, ref)
+	}
+	r.mu.Unlock()
+	sort.Strings(refs)
+
+	var changed []string
+	var errs []error
+	for _, ref := range refs {
+		value, err := r.fetch(ctx, ref)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		r.mu.Lock()
+		if r.cache[ref] != value {
+			r.cache[ref] = value
+			changed = append(changed, ref)
+		}
+		r.mu.Unlock()
+	}
+	return changed, errors.Join(errs...)
+}
+
+func (r *Resolver) fetch(ctx context.Context, ref string) (string, error) {
+	scheme, rest, _ := strings.Cut(ref, ":")
+	path, field, _ := strings.Cut(rest, "#")
+	provider := r.Providers[scheme]
+	if provider == nil {
+		return "", fmt.Errorf("%s: no %s provider configured", ref, scheme)
+	}
+	raw, err := provider.Fetch(ctx, path)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", ref, err)
+	}
+	if field == "" {
+		return raw, nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(raw), &fields); err != nil {
+		return "", fmt.Errorf("%s: secret is not a JSON object, so it has no field %q", ref, field)
+	}
+	switch v := fields[field].(type) {
+	case nil:
+		return "", fmt.Errorf("%s: secret has no field %q", ref, field)
+	case string:
+		return v, nil
+	default:
+		data, _ := json.Marshal(v)
+		return string(data), nil
+	}
+}
+
+var (
+	defaultOnce     sync.Once
+	defaultResolver *Resolver
+)
+
+// Default returns the process's resolver, built by FromEnv on first use,
+// so configuration loads and refreshes share its cache.
+func Default() *Resolver {
+	defaultOnce.Do(func() { defaultResolver = FromEnv() })
+	return defaultResolver
+}
+
+// FromEnv returns a resolver whose providers take their address and
+// credentials from the environment variables each store's own tools read:
+// VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE; AWS_REGION (or
+// AWS_DEFAULT_REGION), AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN; and GOOGLE_OAUTH_ACCESS_TOKEN, without which GCP
+// tokens come from the metadata server.
+func FromEnv() *Resolver {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	gcp := &GCPSecretManager{}
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		gcp.Token = func(context.Context) (string, error) { return token, nil }
+	}
+	return &Resolver{Providers: map[string]Provider{
+		"vault": &Vault{
+			Addr:      os.Getenv("VAULT_ADDR"),
+			Token:     os.Getenv("VAULT_TOKEN"),
+			Namespace: os.Getenv("VAULT_NAMESPACE"),
+		},
+		"awssm": &AWSSecretsManager{
+			Region:          region,
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		},
+		"gcpsm": gcp,
+	}}
+}
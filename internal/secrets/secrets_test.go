@@ -0,0 +1,142 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeProvider map[string]string
+
+func (f fakeProvider) Fetch(_ context.Context, path string) (string, error) {
+	return f[path], nil
+}
+
+func TestResolverPicksFieldsAndRefreshes(t *testing.T) {
+	store := fakeProvider{"kv/data/nerve": `{"stripe_key": "sk_1", "port": 25}`}
+	r := &Resolver{Providers: map[string]Provider{"vault": store}}
+	ctx := context.Background()
+
+	if got, err := r.Resolve(ctx, "vault:kv/data/nerve#stripe_key"); err != nil || got != "sk_1" {
+		t.Fatalf("expected sk_1, got %q, %v", got, err)
+	}
+	if got, _ := r.Resolve(ctx, "vault:kv/data/nerve#port"); got != "25" {
+		t.Fatalf("expected a non-string field as JSON, got %q", got)
+	}
+	if _, err := r.Resolve(ctx, "vault:kv/data/nerve#missing"); err == nil {
+		t.Fatalf("expected a missing field to fail")
+	}
+	if _, err := r.Resolve(ctx, "awssm:prod/nerve"); err == nil {
+		t.Fatalf("expected a scheme without a provider to fail")
+	}
+
+	store["kv/data/nerve"] = `{"stripe_key": "sk_2", "port": 25}`
+	if got, _ := r.Resolve(ctx, "vault:kv/data/nerve#stripe_key"); got != "sk_1" {
+		t.Fatalf("expected the cached value before a refresh, got %q", got)
+	}
+	changed, err := r.Refresh(ctx)
+	if err != nil || len(changed) != 1 || changed[0] != "vault:kv/data/nerve#stripe_key" {
+		t.Fatalf("expected the rotated key to be reported, got %v, %v", changed, err)
+	}
+	if got, _ := r.Resolve(ctx, "vault:kv/data/nerve#stripe_key"); got != "sk_2" {
+		t.Fatalf("expected the refreshed value, got %q", got)
+	}
+}
+
+func TestIsRef(t *testing.T) {
+	for value, want := range map[string]bool{
+		"vault:kv/data/nerve#stripe_key":                        true,
+		"awssm:arn:aws:secretsmanager:eu-west-1:1:secret:nerve": true,
+		"gcpsm:projects/acme/secrets/nerve":                     true,
+		"postgres://nerve@db/nerve":                             false,
+		"sk_live_123":                                           false,
+		"vault:":                                                false,
+	} {
+		if IsRef(value) != want {
+			t.Fatalf("IsRef(%q): expected %v", value, want)
+		}
+	}
+}
+
+func TestProvidersFetchOverHTTP(t *testing.T) {
+	var awsAuth, awsTarget string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/kv/data/nerve":
+			if r.Header.Get("X-Vault-Token") != "vt" {
+				http.Error(w, "permission denied", http.StatusForbidden)
+				return
+			}
+			_, _ = io.WriteString(w, `{"data": {"data": {"stripe_key": "sk_vault"}, "metadata": {"version": 3}}}`)
+		case r.URL.Path == "/v1/projects/acme/secrets/nerve/versions/latest:access":
+			if r.Header.Get("Authorization") != "Bearer gt" {
+				http.Error(w, "unauthenticated", http.StatusUnauthorized)
+				return
+			}
+			_, _ = io.WriteString(w, `{"payload": {"data": "c2tfZ2Nw"}}`)
+		case r.URL.Path == "/":
+			awsAuth, awsTarget = r.Header.Get("Authorization"), r.Header.Get("X-Amz-Target")
+			var in struct{ SecretId string }
+			_ = json.NewDecoder(r.Body).Decode(&in)
+			_ = json.NewEncoder(w).Encode(map[string]string{"SecretString": `{"stripe_key": "sk_` + in.SecretId + `"}`})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	r := &Resolver{Providers: map[string]Provider{
+		"vault": &Vault{Addr: srv.URL, Token: "vt"},
+		"gcpsm": &GCPSecretManager{Endpoint: srv.URL, Token: func(context.Context) (string, error) { return "gt", nil }},
+		"awssm": &AWSSecretsManager{Endpoint: srv.URL, Region: "eu-west-1", AccessKeyID: "AKID", SecretAccessKey: "secret",
+			SessionToken: "session", Now: func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }},
+	}}
+	ctx := context.Background()
+	for ref, want := range map[string]string{
+		"vault:kv/data/nerve#stripe_key":    "sk_vault",
+		"gcpsm:projects/acme/secrets/nerve": "sk_gcp",
+		"awssm:aws#stripe_key":              "sk_aws",
+	} {
+		if got, err := r.Resolve(ctx, ref); err != nil || got != want {
+			t.Fatalf("%s: expected %q, got %q, %v", ref, want, got, err)
+		}
+	}
+	if awsTarget != "secretsmanager.GetSecretValue" ||
+		!strings.HasPrefix(awsAuth, "AWS4-HMAC-SHA256 Credential=AKID/20260102/eu-west-1/secretsmanager/aws4_request, SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-amz-target, Signature=") {
+		t.Fatalf("expected a signed GetSecretValue call, got %q %q", awsTarget, awsAuth)
+	}
+	if _, err := (&Vault{Addr: srv.URL, Token: "wrong"}).Fetch(ctx, "kv/data/nerve"); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("expected vault's refusal to surface, got %v", err)
+	}
+}
+
+func TestSealRoundTrip(t *testing.T) {
+	key, err := ParseKey(strings.Repeat("ab", 32))
+	if err != nil {
+		t.Fatalf("parse key: %v", err)
+	}
+	sealed, err := Seal("1//refresh-token", key)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if strings.Contains(sealed, "refresh-token") {
+		t.Fatalf("expected the value encrypted, got %q", sealed)
+	}
+	if plain, err := Open(sealed, key); err != nil || plain != "1//refresh-token" {
+		t.Fatalf("open: %q %v", plain, err)
+	}
+	other, _ := ParseKey(strings.Repeat("cd", 32))
+	if _, err := Open(sealed, other); err == nil {
+		t.Fatalf("expected another key to fail")
+	}
+	for _, bad := range []string{"", "short", strings.Repeat("ab", 16)} {
+		if _, err := ParseKey(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Vault reads secrets from a HashiCorp Vault KV engine over its HTTP API.
+// Paths are API paths under /v1, so KV v2 secrets include data/, as in
+// kv/data/nerve.
+type Vault struct {
+	Addr      string
+	Token     string
+	Namespace string
+	Client    *http.Client
+}
+
+func (v *Vault) Fetch(ctx context.Context, path string) (string, error) {
+	if v.Addr == "" || v.Token == "" {
+		return "", errors.New("vault needs VAULT_ADDR and VAULT_TOKEN")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(v.Addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+	body, err := doRequest(v.Client, req)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	var out struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	// KV v2 nests the secret under data beside its metadata.
+	data := out.Data
+	if nested, ok := data["data"]; ok {
+		if _, hasMetadata := data["metadata"]; hasMetadata {
+			data = nil
+			if err := json.Unmarshal(nested, &data); err != nil {
+				return "", fmt.Errorf("vault: %w", err)
+			}
+		}
+	}
+	if data == nil {
+		return "", errors.New("vault: secret has no data")
+	}
+	raw, err := json.Marshal(data)
+	return string(raw), err
+}
+
+// doRequest sends req and returns the body of a 2xx response.
+func doRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// InboxAlias is an extra address that delivers into a primary inbox. Route is
+// an optional label, such as billing, that triage reports as the suggested
+// route for mail sent to the alias.
+type InboxAlias struct {
+	ID        string
+	OrgID     string
+	InboxID   string
+	Address   string
+	Route     string
+	CreatedAt time.Time
+}
+
+// ErrAddressInUse is returned when an alias address is already an inbox or
+// another alias.
+var ErrAddressInUse = errors.New("address already in use")
+
+// CreateInboxAlias adds address as an alias of inboxID. Addresses are unique
+// across inboxes and aliases, so an address always resolves to one inbox.
+func (s *Store) CreateInboxAlias(ctx context.Context, inboxID string, address string, route string) (InboxAlias, error) {
+	if _, _, err := s.ResolveInboxAddress(ctx, address); err == nil {
+		return InboxAlias{}, ErrAddressInUse
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return InboxAlias{}, err
+	}
+	var alias InboxAlias
+	err := s.q.QueryRowContext(ctx, `
+		INSERT INTO inbox_aliases (org_id, inbox_id, address, route)
+		VALUES ((SELECT org_id FROM inboxes WHERE id = $1), $1, $2, $3)
+		ON CONFLICT DO NOTHING
+		RETURNING id, coalesce(org_id::text, ''), inbox_id, address, route, created_at
+	`, inboxID, address, route).Scan(&alias.ID, &alias.OrgID, &alias.InboxID, &alias.Address, &alias.Route, &alias.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return InboxAlias{}, ErrAddressInUse
+	}
+	return alias, err
+}
+
+// ListInboxAliases returns an inbox's aliases in creation order.
+func (s *Store) ListInboxAliases(ctx context.Context, inboxID string) ([]InboxAlias, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT id, coalesce(org_id::text, ''), inbox_id, address, route, created_at
+		FROM inbox_aliases
+		WHERE inbox_id = $1
+		ORDER BY created_at, address
+	`, inboxID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var aliases []InboxAlias
+	for rows.Next() {
+		var alias InboxAlias
+		if err := rows.Scan(&alias.ID, &alias.OrgID, &alias.InboxID, &alias.Address, &alias.Route, &alias.CreatedAt); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, alias)
+	}
+	return aliases, rows.Err()
+}
+
+// DeleteInboxAlias removes one of the org's aliases. Messages already
+// received keep the alias they were sent to.
+func (s *Store) DeleteInboxAlias(ctx context.Context, orgID string, inboxID string, aliasID string) (bool, error) {
+	res, err := s.q.ExecContext(ctx, `
+		DELETE FROM inbox_aliases
+		WHERE id = $1 AND inbox_id = $2 AND org_id = $3
+	`, aliasID, inboxID, orgID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// ResolveInboxAddress finds the inbox that receives mail for address, either
+// as its own address or through an alias. alias is the matched alias address,
+// empty when address is the inbox's own. Unknown addresses return
+// sql.ErrNoRows.
+func (s *Store) ResolveInboxAddress(ctx context.Context, address string) (inboxID string, alias string, err error) {
+	err = s.q.QueryRowContext(ctx, `
+		SELECT id, '' FROM inboxes WHERE lower(address) = lower($1)
+		UNION ALL
+		SELECT inbox_id, address FROM inbox_aliases WHERE lower(address) = lower($1)
+		LIMIT 1
+	`, address).Scan(&inboxID, &alias)
+	return inboxID, alias, err
+}
+
+// MatchAlias returns the first alias one of recipients was sent to, plus
+// tags folded, or "" when the message was sent to none of them.
+func MatchAlias(recipients []Participant, aliases []InboxAlias) string {
+	for _, rcpt := range recipients {
+		address := strings.TrimSpace(rcpt.Email)
+		for _, alias := range aliases {
+			if strings.EqualFold(address, alias.Address) || strings.EqualFold(FoldPlusAddress(address), alias.Address) {
+				return alias.Address
+			}
+		}
+	}
+	return ""
+}
+
+// InboxAliasRoute returns the route configured for an inbox's alias address,
+// or "" when the alias has no route or no longer exists.
+func (s *Store) InboxAliasRoute(ctx context.Context, inboxID string, address string) (string, error) {
+	var route string
+	err := s.q.QueryRowContext(ctx, `
+		SELECT route FROM inbox_aliases WHERE inbox_id = $1 AND lower(address) = lower($2)
+	`, inboxID, address).Scan(&route)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return route, err
+}
@@ -0,0 +1,194 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AuditRecord is one audit_log row to write. OrgID and InboxID are what the
+// call concerned, when known. PolicyRuleIDs lists the policy rules that
+// fired for it, if any; CitationCoverage is set for drafts only. Inputs and
+// Outputs are the call's arguments and result, kept for replays.
+type AuditRecord struct {
+	ToolCallID       string
+	OrgID            string
+	InboxID          string
+	Actor            string
+	InputsHash       string
+	OutputsHash      string
+	ReplayID         string
+	PolicyRuleIDs    []string
+	CitationCoverage sql.NullFloat64
+	Inputs           json.RawMessage
+	Outputs          json.RawMessage
+}
+
+// RecordAudit logs a tool call.
+func (s *Store) RecordAudit(ctx context.Context, rec AuditRecord) error {
+	policyRuleIDs := rec.PolicyRuleIDs
+	if policyRuleIDs == nil {
+		policyRuleIDs = []string{}
+	}
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO audit_log (tool_call_id, org_id, inbox_id, actor, inputs_hash, outputs_hash, replay_id, policy_rule_ids, citation_coverage, inputs, outputs)
+		VALUES ($1, nullif($2::text, '')::uuid, $3, $4, $5, $6, $7, $8, $9, $10::jsonb, $11::jsonb)
+	`, rec.ToolCallID, rec.OrgID, rec.InboxID, rec.Actor, rec.InputsHash, rec.OutputsHash, rec.ReplayID, policyRuleIDs, rec.CitationCoverage,
+		nullJSON(rec.Inputs), nullJSON(rec.Outputs))
+	if err == nil {
+		s.replica.noteWrite(auditReadKey(""), auditReadKey(rec.OrgID))
+	}
+	return err
+}
+
+// AuditEntry is one audited tool call with the org and billing status of
+// its usage event, when it was metered.
+type AuditEntry struct {
+	ID            string
+	ToolCallID    string
+	Actor         string
+	ToolName      string
+	LatencyMS     int64
+	ReplayID      string
+	PolicyRuleIDs []string
+	// CitationCoverage is the share of its thread a draft cited.
+	CitationCoverage sql.NullFloat64
+	OrgID            string
+	InboxID          string
+	UsageStatus      string
+	CreatedAt        time.Time
+}
+
+// Cursor is the AuditFilter cursor that resumes a listing after e.
+func (e AuditEntry) Cursor() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(e.CreatedAt.UTC().Format(time.RFC3339Nano) + "," + e.ID))
+}
+
+// AuditFilter selects audit entries. Empty fields match everything; an
+// entry matches InboxIDs when it concerned any of them.
+type AuditFilter struct {
+	OrgID    string
+	InboxIDs []string
+	ToolName string
+	Actor    string
+	ReplayID string
+	// Since and Until bound created_at, exclusive at both ends.
+	Since time.Time
+	Until time.Time
+	// AfterID, set by SetCursor, resumes after the entry created at Since
+	// with that id, so pages sharing a timestamp are not skipped.
+	AfterID string
+	Limit   int
+}
+
+// ErrInvalidAuditCursor is returned by SetCursor for a cursor that
+// AuditEntry.Cursor did not produce.
+var ErrInvalidAuditCursor = errors.New("invalid audit cursor")
+
+// SetCursor resumes the filter after the entry cursor came from.
+func (f *AuditFilter) SetCursor(cursor string) error {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return ErrInvalidAuditCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), ",")
+	if !ok || id == "" {
+		return ErrInvalidAuditCursor
+	}
+	since, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return ErrInvalidAuditCursor
+	}
+	f.Since, f.AfterID = since, id
+	return nil
+}
+
+// ListAuditEntries returns the audit entries matching filter, oldest first.
+// With a zero Since it returns the latest Limit entries; otherwise the first
+// Limit entries after Since, so callers can follow the log or page through
+// a range by passing the Cursor of the last entry they saw.
+func (s *Store) ListAuditEntries(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	order := "ASC"
+	if filter.Since.IsZero() {
+		order = "DESC"
+	}
+	until := sql.NullTime{Time: filter.Until, Valid: !filter.Until.IsZero()}
+	// Entries written before audit_log carried org_id get it from their
+	// usage event.
+	rows, err := s.readQuery(ctx, []string{auditReadKey(filter.OrgID)}, `
+		SELECT a.id, coalesce(a.tool_call_id::text, ''), coalesce(a.actor, ''), coalesce(t.tool_name, ''),
+		       coalesce(t.latency_ms, 0), coalesce(a.replay_id, ''), to_jsonb(a.policy_rule_ids),
+		       a.citation_coverage,
+		       coalesce(a.org_id::text, ue.org_id::text, ''), a.inbox_id, coalesce(ue.status, ''), a.created_at
+		FROM audit_log a
+		LEFT JOIN tool_calls t ON t.id = a.tool_call_id
+		LEFT JOIN LATERAL (
+			SELECT org_id, status FROM usage_events WHERE audit_id = a.tool_call_id LIMIT 1
+		) ue ON true
+		WHERE ($1::text = '' OR a.org_id = nullif($1::text, '')::uuid
+		       OR (a.org_id IS NULL AND ue.org_id = nullif($1::text, '')::uuid))
+		  AND (cardinality(coalesce($2::text[], '{}')) = 0 OR a.inbox_id = ANY($2::text[]))
+		  AND ($3::text = '' OR t.tool_name = $3::text)
+		  AND ($4::text = '' OR a.actor = $4::text)
+		  AND ($5::text = '' OR a.replay_id = $5::text)
+		  AND (a.created_at > $6
+		       OR ($7::text <> '' AND a.created_at = $6 AND a.id > nullif($7::text, '')::uuid))
+		  AND ($8::timestamptz IS NULL OR a.created_at < $8::timestamptz)
+		ORDER BY a.created_at `+order+`, a.id `+order+`
+		LIMIT $9
+	`, filter.OrgID, filter.InboxIDs, filter.ToolName, filter.Actor, filter.ReplayID, filter.Since, filter.AfterID, until, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var ruleIDsJSON []byte
+		if err := rows.Scan(&e.ID, &e.ToolCallID, &e.Actor, &e.ToolName, &e.LatencyMS, &e.ReplayID, &ruleIDsJSON, &e.CitationCoverage,
+			&e.OrgID, &e.InboxID, &e.UsageStatus, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if len(ruleIDsJSON) > 0 {
+			if err := json.Unmarshal(ruleIDsJSON, &e.PolicyRuleIDs); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if filter.Since.IsZero() {
+		slices.Reverse(entries)
+	}
+	return entries, nil
+}
+
+// PruneAuditLog deletes the audit entries of orgs whose plan sets
+// audit_retention_days that are older than that many days before now, and
+// returns how many it deleted. Entries with no org are kept.
+func (s *Store) PruneAuditLog(ctx context.Context, now time.Time) (int64, error) {
+	res, err := s.q.ExecContext(ctx, `
+		DELETE FROM audit_log a
+		USING org_entitlements e
+		JOIN plan_entitlements p ON p.plan_code = e.plan_code
+		WHERE a.org_id = e.org_id
+		  AND p.audit_retention_days > 0
+		  AND a.created_at < $1::timestamptz - make_interval(days => p.audit_retention_days)
+	`, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,23 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAuditCursorRoundTrip(t *testing.T) {
+	entry := AuditEntry{ID: "3f0c6a4e-8a51-4f0e-9d55-1a2b3c4d5e6f", CreatedAt: time.Date(2026, 3, 1, 9, 30, 0, 123456000, time.UTC)}
+	var filter AuditFilter
+	if err := filter.SetCursor(entry.Cursor()); err != nil {
+		t.Fatalf("set cursor: %v", err)
+	}
+	if !filter.Since.Equal(entry.CreatedAt) || filter.AfterID != entry.ID {
+		t.Fatalf("expected to resume after %s at %s, got %s at %s", entry.ID, entry.CreatedAt, filter.AfterID, filter.Since)
+	}
+	for _, bad := range []string{"not base64!", "bm8tY29tbWE", "eCx5"} {
+		if err := filter.SetCursor(bad); !errors.Is(err, ErrInvalidAuditCursor) {
+			t.Fatalf("expected %q to be rejected, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// AutoCloseRule is an inbox's inactivity rule: threads with no message for
+// AfterDays are closed, 0 turns it off. With Nudge, a thread whose last
+// message was ours first gets an "anything else?" reply and closes only if
+// another AfterDays pass without an answer.
+type AutoCloseRule struct {
+	AfterDays int
+	Nudge     bool
+}
+
+func (s *Store) GetInboxAutoClose(ctx context.Context, orgID string, inboxID string) (AutoCloseRule, error) {
+	var rule AutoCloseRule
+	err := s.q.QueryRowContext(ctx, `
+		SELECT auto_close_after_days, auto_close_nudge FROM inboxes WHERE id = $1 AND org_id = $2
+	`, inboxID, orgID).Scan(&rule.AfterDays, &rule.Nudge)
+	return rule, err
+}
+
+// SetInboxAutoClose replaces an inbox's rule. It reports false if the inbox
+// is not the org's.
+func (s *Store) SetInboxAutoClose(ctx context.Context, orgID string, inboxID string, rule AutoCloseRule) (bool, error) {
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE inboxes SET auto_close_after_days = $3, auto_close_nudge = $4 WHERE id = $1 AND org_id = $2
+	`, inboxID, orgID, rule.AfterDays, rule.Nudge)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// IdleThread is an open thread past its inbox's auto-close threshold.
+// NudgedAt is when it was last nudged; if that is not before LastMessageAt
+// the nudge is the last message and went unanswered.
+type IdleThread struct {
+	ID            string
+	OrgID         string
+	InboxID       string
+	Rule          AutoCloseRule
+	LastMessageAt time.Time
+	LastDirection string
+	NudgedAt      sql.NullTime
+}
+
+// Nudged reports whether the thread's last message is an unanswered nudge.
+func (t IdleThread) Nudged() bool {
+	return t.NudgedAt.Valid && !t.NudgedAt.Time.Before(t.LastMessageAt)
+}
+
+// ListIdleThreads returns up to limit open threads, longest idle first, in
+// inboxes with an auto-close rule whose last message is older than the rule
+// allows as of now.
+func (s *Store) ListIdleThreads(ctx context.Context, now time.Time, limit int) ([]IdleThread, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT t.id, coalesce(i.org_id::text, ''), t.inbox_id, i.auto_close_after_days, i.auto_close_nudge, m.created_at, m.direction, t.nudged_at
+		FROM threads t
+		JOIN inboxes i ON i.id = t.inbox_id
+		JOIN LATERAL (
+			SELECT created_at, direction FROM messages WHERE thread_id = t.id ORDER BY created_at DESC LIMIT 1
+		) m ON true
+		WHERE i.auto_close_after_days > 0
+		  AND t.status <> 'closed'
+		  AND m.created_at < $1::timestamptz - make_interval(days => i.auto_close_after_days)
+		ORDER BY m.created_at
+		LIMIT $2
+	`, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []IdleThread
+	for rows.Next() {
+		var t IdleThread
+		if err := rows.Scan(&t.ID, &t.OrgID, &t.InboxID, &t.Rule.AfterDays, &t.Rule.Nudge, &t.LastMessageAt, &t.LastDirection, &t.NudgedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// AutoCloseThread closes a thread under its inbox's inactivity rule. It
+// reports false if the thread was already closed.
+func (s *Store) AutoCloseThread(ctx context.Context, threadID string) (bool, error) {
+	n, err := s.closeThreads(ctx, []string{threadID}, true)
+	return n > 0, err
+}
+
+// MarkThreadNudged records that a nudge, stored as a message created at at,
+// went out on the thread.
+func (s *Store) MarkThreadNudged(ctx context.Context, threadID string, at time.Time) error {
+	_, err := s.q.ExecContext(ctx, `UPDATE threads SET nudged_at = $2 WHERE id = $1`, threadID, at)
+	return err
+}
+
+// ReopenThread opens a closed thread again, as when new mail arrives on it,
+// and marks its last closure reopened. It reports false if it was not closed.
+func (s *Store) ReopenThread(ctx context.Context, threadID string) (bool, error) {
+	n, err := s.ReopenThreads(ctx, []string{threadID})
+	return n > 0, err
+}
+
+// ReopenThreads is ReopenThread for several threads at once. It returns how
+// many were closed.
+func (s *Store) ReopenThreads(ctx context.Context, threadIDs []string) (int64, error) {
+	if len(threadIDs) == 0 {
+		return 0, nil
+	}
+	var n int64
+	err := s.q.QueryRowContext(ctx, `
+		WITH reopened AS (
+			UPDATE threads SET status = 'open', updated_at = now()
+			WHERE id = ANY($1::uuid[]) AND status = 'closed'
+			RETURNING id
+		), marked AS (
+			UPDATE thread_closures SET reopened_at = now()
+			WHERE thread_id IN (SELECT id FROM reopened) AND reopened_at IS NULL
+		)
+		SELECT count(*) FROM reopened
+	`, uuidArrayLiteral(threadIDs)).Scan(&n)
+	return n, err
+}
+
+// ThreadClosureStats counts closures since a cutoff and how many of them new
+// mail reopened, overall and for those made by the inactivity rule.
+type ThreadClosureStats struct {
+	Closed       int64
+	Reopened     int64
+	AutoClosed   int64
+	AutoReopened int64
+}
+
+// GetThreadClosureStats counts closures made at or after since; an empty
+// inboxID counts every inbox.
+func (s *Store) GetThreadClosureStats(ctx context.Context, inboxID string, since time.Time) (ThreadClosureStats, error) {
+	var stats ThreadClosureStats
+	err := s.q.QueryRowContext(ctx, `
+		SELECT
+		  count(*),
+		  count(*) FILTER (WHERE reopened_at IS NOT NULL),
+		  count(*) FILTER (WHERE auto),
+		  count(*) FILTER (WHERE auto AND reopened_at IS NOT NULL)
+		FROM thread_closures
+		WHERE closed_at >= $1 AND ($2 = '' OR inbox_id::text = $2)
+	`, since, inboxID).Scan(&stats.Closed, &stats.Reopened, &stats.AutoClosed, &stats.AutoReopened)
+	return stats, err
+}
+
+// ReopenRate is the share of closures that were reopened, 0 with none.
+func (s ThreadClosureStats) ReopenRate() float64 {
+	if s.Closed == 0 {
+		return 0
+	}
+	return float64(s.Reopened) / float64(s.Closed)
+}
+
+// AutoReopenRate is ReopenRate for auto-closures only.
+func (s ThreadClosureStats) AutoReopenRate() float64 {
+	if s.AutoClosed == 0 {
+		return 0
+	}
+	return float64(s.AutoReopened) / float64(s.AutoClosed)
+}
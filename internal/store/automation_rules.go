@@ -0,0 +1,262 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Automation rule actions.
+const (
+	RuleActionLabel       = "label"
+	RuleActionSetPriority = "set_priority"
+	RuleActionDraft       = "draft"
+	RuleActionWebhook     = "webhook"
+	RuleActionAssign      = "assign"
+)
+
+// RuleActions lists every action type.
+var RuleActions = []string{RuleActionLabel, RuleActionSetPriority, RuleActionDraft, RuleActionWebhook, RuleActionAssign}
+
+// RuleFilters pick the new messages a rule looks at; each filter set must
+// match. The zero value matches every message.
+type RuleFilters struct {
+	// From are sender addresses, or domains that also match their
+	// subdomains.
+	From []string `json:"from,omitempty"`
+	// Subject is an RE2 pattern matched case-insensitively.
+	Subject string `json:"subject,omitempty"`
+	// BodyContains matches a body containing any of the phrases, ignoring
+	// case.
+	BodyContains []string `json:"body_contains,omitempty"`
+}
+
+// RuleConditions test the message's triage. The message is only triaged for
+// a rule that sets one; each one set must hold.
+type RuleConditions struct {
+	Intents       []string `json:"intent,omitempty"`
+	Urgency       []string `json:"urgency,omitempty"`
+	Sentiment     []string `json:"sentiment,omitempty"`
+	MinConfidence float64  `json:"min_confidence,omitempty"`
+}
+
+// Empty reports whether no condition is set.
+func (c RuleConditions) Empty() bool {
+	return len(c.Intents) == 0 && len(c.Urgency) == 0 && len(c.Sentiment) == 0 && c.MinConfidence == 0
+}
+
+// RuleAction is one thing a rule does to a matching message's thread. Value
+// is the label, the priority, the assignee or the draft's goal; webhook
+// actions take none.
+type RuleAction struct {
+	Type  string `json:"type"`
+	Value string `json:"value,omitempty"`
+}
+
+// AutomationRule is an org's rule. InboxID confines it to one inbox; empty
+// runs it on all of them. Rules run in Position order.
+type AutomationRule struct {
+	ID         string
+	OrgID      string
+	InboxID    string
+	Name       string
+	Position   int
+	Enabled    bool
+	DryRun     bool
+	Filters    RuleFilters
+	Conditions RuleConditions
+	Actions    []RuleAction
+	CreatedBy  string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+const automationRuleColumns = `id, org_id, coalesce(inbox_id::text, ''), name, position, enabled, dry_run, filters, conditions, actions, created_by, created_at, updated_at`
+
+func scanAutomationRule(row interface{ Scan(...any) error }) (AutomationRule, error) {
+	var r AutomationRule
+	var filters, conditions, actions []byte
+	err := row.Scan(&r.ID, &r.OrgID, &r.InboxID, &r.Name, &r.Position, &r.Enabled, &r.DryRun, &filters, &conditions, &actions, &r.CreatedBy, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return r, err
+	}
+	_ = json.Unmarshal(filters, &r.Filters)
+	_ = json.Unmarshal(conditions, &r.Conditions)
+	_ = json.Unmarshal(actions, &r.Actions)
+	return r, nil
+}
+
+func (s *Store) queryAutomationRules(ctx context.Context, query string, args ...any) ([]AutomationRule, error) {
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []AutomationRule
+	for rows.Next() {
+		r, err := scanAutomationRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// ListAutomationRules returns an org's rules in the order they run.
+func (s *Store) ListAutomationRules(ctx context.Context, orgID string) ([]AutomationRule, error) {
+	return s.queryAutomationRules(ctx, `
+		SELECT `+automationRuleColumns+`
+		FROM automation_rules
+		WHERE org_id = $1
+		ORDER BY position, created_at
+	`, orgID)
+}
+
+// ListInboxAutomationRules returns the enabled rules that run on inboxID's
+// mail, in order.
+func (s *Store) ListInboxAutomationRules(ctx context.Context, inboxID string) ([]AutomationRule, error) {
+	return s.queryAutomationRules(ctx, `
+		SELECT `+automationRuleColumns+`
+		FROM automation_rules
+		WHERE org_id = (SELECT org_id FROM inboxes WHERE id = $1)
+		  AND enabled AND (inbox_id IS NULL OR inbox_id = $1)
+		ORDER BY position, created_at
+	`, inboxID)
+}
+
+// GetAutomationRule returns one of an org's rules, or sql.ErrNoRows.
+func (s *Store) GetAutomationRule(ctx context.Context, orgID, ruleID string) (AutomationRule, error) {
+	return scanAutomationRule(s.q.QueryRowContext(ctx, `
+		SELECT `+automationRuleColumns+`
+		FROM automation_rules
+		WHERE id = $1 AND org_id = $2
+	`, ruleID, orgID))
+}
+
+func ruleJSON(r AutomationRule) (filters, conditions, actions string, err error) {
+	if r.Actions == nil {
+		r.Actions = []RuleAction{}
+	}
+	raw := make([][]byte, 3)
+	for i, v := range []any{r.Filters, r.Conditions, r.Actions} {
+		if raw[i], err = json.Marshal(v); err != nil {
+			return "", "", "", err
+		}
+	}
+	return string(raw[0]), string(raw[1]), string(raw[2]), nil
+}
+
+// CreateAutomationRule stores a new rule for r.OrgID.
+func (s *Store) CreateAutomationRule(ctx context.Context, r AutomationRule) (AutomationRule, error) {
+	filters, conditions, actions, err := ruleJSON(r)
+	if err != nil {
+		return AutomationRule{}, err
+	}
+	return scanAutomationRule(s.q.QueryRowContext(ctx, `
+		INSERT INTO automation_rules (id, org_id, inbox_id, name, position, enabled, dry_run, filters, conditions, actions, created_by)
+		VALUES ($1, $2, nullif($3::text, '')::uuid, $4, $5, $6, $7, $8::jsonb, $9::jsonb, $10::jsonb, $11)
+		RETURNING `+automationRuleColumns,
+		uuid.NewString(), r.OrgID, r.InboxID, r.Name, r.Position, r.Enabled, r.DryRun, filters, conditions, actions, r.CreatedBy))
+}
+
+// UpdateAutomationRule replaces everything but the rule's ID, org and
+// creator, or returns sql.ErrNoRows if the org has no such rule.
+func (s *Store) UpdateAutomationRule(ctx context.Context, r AutomationRule) (AutomationRule, error) {
+	filters, conditions, actions, err := ruleJSON(r)
+	if err != nil {
+		return AutomationRule{}, err
+	}
+	return scanAutomationRule(s.q.QueryRowContext(ctx, `
+		UPDATE automation_rules
+		SET inbox_id = nullif($3::text, '')::uuid, name = $4, position = $5, enabled = $6, dry_run = $7,
+		    filters = $8::jsonb, conditions = $9::jsonb, actions = $10::jsonb, updated_at = now()
+		WHERE id = $1 AND org_id = $2
+		RETURNING `+automationRuleColumns,
+		r.ID, r.OrgID, r.InboxID, r.Name, r.Position, r.Enabled, r.DryRun, filters, conditions, actions))
+}
+
+func (s *Store) DeleteAutomationRule(ctx context.Context, orgID, ruleID string) (bool, error) {
+	res, err := s.q.ExecContext(ctx, `DELETE FROM automation_rules WHERE id = $1 AND org_id = $2`, ruleID, orgID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// Rule action outcomes.
+const (
+	RuleActionApplied = "applied"
+	RuleActionPlanned = "planned"
+	RuleActionFailed  = "failed"
+)
+
+// RuleActionResult is what one action did: applied, failed with Detail, or
+// for a dry run, planned.
+type RuleActionResult struct {
+	Type   string `json:"type"`
+	Value  string `json:"value,omitempty"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// AutomationRuleRun records a rule matching a message. Error is set when the
+// rule could not be evaluated at all, such as a failed triage.
+type AutomationRuleRun struct {
+	ID        string
+	OrgID     string
+	RuleID    string
+	MessageID string
+	ThreadID  string
+	DryRun    bool
+	Actions   []RuleActionResult
+	Error     string
+	CreatedAt time.Time
+}
+
+func (s *Store) RecordAutomationRuleRun(ctx context.Context, run AutomationRuleRun) error {
+	if run.Actions == nil {
+		run.Actions = []RuleActionResult{}
+	}
+	actions, err := json.Marshal(run.Actions)
+	if err != nil {
+		return err
+	}
+	_, err = s.q.ExecContext(ctx, `
+		INSERT INTO automation_rule_runs (id, org_id, rule_id, message_id, thread_id, dry_run, actions, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7::jsonb, $8)
+	`, uuid.NewString(), run.OrgID, run.RuleID, run.MessageID, run.ThreadID, run.DryRun, string(actions), run.Error)
+	return err
+}
+
+// ListAutomationRuleRuns returns a rule's latest runs, newest first.
+func (s *Store) ListAutomationRuleRuns(ctx context.Context, orgID, ruleID string, limit int) ([]AutomationRuleRun, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT id, org_id, rule_id, message_id, thread_id, dry_run, actions, error, created_at
+		FROM automation_rule_runs
+		WHERE org_id = $1 AND rule_id = $2
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, orgID, ruleID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []AutomationRuleRun
+	for rows.Next() {
+		var run AutomationRuleRun
+		var actions []byte
+		if err := rows.Scan(&run.ID, &run.OrgID, &run.RuleID, &run.MessageID, &run.ThreadID, &run.DryRun, &actions, &run.Error, &run.CreatedAt); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal(actions, &run.Actions)
+		out = append(out, run)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// BillableUsage is an org's usage counter for a period billed through its
+// subscription, with the units its plan includes.
+type BillableUsage struct {
+	OrgID                  string
+	MeterName              string
+	PeriodStart            time.Time
+	PeriodEnd              time.Time
+	Used                   int64
+	IncludedUnits          int64
+	ExternalSubscriptionID string
+	// OverageLookupKey is the plan's metered price, if it has its own.
+	OverageLookupKey string
+}
+
+// Overage is the usage beyond what the plan includes.
+func (u BillableUsage) Overage() int64 {
+	return max(u.Used-u.IncludedUnits, 0)
+}
+
+// ListBillableUsage returns the meterName counters, for periods ending after
+// since, of orgs with a live subscription from provider.
+func (s *Store) ListBillableUsage(ctx context.Context, provider string, meterName string, since time.Time) ([]BillableUsage, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT c.org_id, c.meter_name, c.period_start, c.period_end, c.used, e.monthly_units,
+		       sub.external_subscription_id, coalesce(p.overage_lookup_key, '')
+		FROM org_usage_counters c
+		JOIN org_entitlements e ON e.org_id = c.org_id
+		JOIN subscriptions sub ON sub.org_id = c.org_id
+		LEFT JOIN plan_entitlements p ON p.plan_code = e.plan_code
+		WHERE sub.provider = $1
+		  AND sub.status IN ('trialing', 'active', 'past_due')
+		  AND c.meter_name = $2
+		  AND c.period_end > $3
+		ORDER BY c.org_id, c.period_start
+	`, provider, meterName, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []BillableUsage
+	for rows.Next() {
+		var u BillableUsage
+		if err := rows.Scan(&u.OrgID, &u.MeterName, &u.PeriodStart, &u.PeriodEnd, &u.Used, &u.IncludedUnits, &u.ExternalSubscriptionID, &u.OverageLookupKey); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+// BillingUsageReport is one period total pushed, or to be pushed, to the
+// billing provider.
+type BillingUsageReport struct {
+	ID                 string
+	OrgID              string
+	MeterName          string
+	PeriodStart        time.Time
+	PeriodEnd          time.Time
+	Quantity           int64
+	IdempotencyKey     string
+	SubscriptionItemID string
+	UsageRecordID      string
+	Status             string
+	Attempts           int
+	LastError          string
+	NextAttemptAt      time.Time
+	ReportedAt         sql.NullTime
+	CreatedAt          time.Time
+}
+
+const billingUsageReportColumns = `
+	id, org_id, meter_name, period_start, period_end, quantity, idempotency_key,
+	subscription_item_id, usage_record_id, status, attempts, last_error,
+	next_attempt_at, reported_at, created_at`
+
+func scanBillingUsageReport(row interface{ Scan(...any) error }) (BillingUsageReport, error) {
+	var r BillingUsageReport
+	err := row.Scan(&r.ID, &r.OrgID, &r.MeterName, &r.PeriodStart, &r.PeriodEnd, &r.Quantity, &r.IdempotencyKey,
+		&r.SubscriptionItemID, &r.UsageRecordID, &r.Status, &r.Attempts, &r.LastError,
+		&r.NextAttemptAt, &r.ReportedAt, &r.CreatedAt)
+	return r, err
+}
+
+// GetLatestBillingUsageReport returns the last report made for an org's
+// meter and period, or sql.ErrNoRows if there is none.
+func (s *Store) GetLatestBillingUsageReport(ctx context.Context, orgID string, meterName string, periodStart time.Time) (BillingUsageReport, error) {
+	return scanBillingUsageReport(s.q.QueryRowContext(ctx, `
+		SELECT `+billingUsageReportColumns+`
+		FROM billing_usage_reports
+		WHERE org_id = $1 AND meter_name = $2 AND period_start = $3
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, orgID, meterName, periodStart))
+}
+
+// InsertBillingUsageReport records a pending report of r's quantity.
+func (s *Store) InsertBillingUsageReport(ctx context.Context, r BillingUsageReport) (BillingUsageReport, error) {
+	return scanBillingUsageReport(s.q.QueryRowContext(ctx, `
+		INSERT INTO billing_usage_reports (org_id, meter_name, period_start, period_end, quantity, idempotency_key)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+billingUsageReportColumns,
+		r.OrgID, r.MeterName, r.PeriodStart, r.PeriodEnd, r.Quantity, r.IdempotencyKey))
+}
+
+// MarkBillingUsageReported records that the provider accepted a report.
+func (s *Store) MarkBillingUsageReported(ctx context.Context, id string, subscriptionItemID string, usageRecordID string) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE billing_usage_reports
+		SET status = 'reported', attempts = attempts + 1, last_error = '',
+		    subscription_item_id = $2, usage_record_id = $3, reported_at = now()
+		WHERE id = $1
+	`, id, subscriptionItemID, usageRecordID)
+	return err
+}
+
+// MarkBillingUsageFailed records a failed attempt and when to try again.
+func (s *Store) MarkBillingUsageFailed(ctx context.Context, id string, lastError string, nextAttemptAt time.Time) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE billing_usage_reports
+		SET status = 'failed', attempts = attempts + 1, last_error = $2, next_attempt_at = $3
+		WHERE id = $1
+	`, id, lastError, nextAttemptAt)
+	return err
+}
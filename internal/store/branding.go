@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// OrgBranding is how system-generated mail for an org is dressed. Empty
+// fields fall back to the product defaults.
+type OrgBranding struct {
+	OrgID           string
+	LogoURL         string
+	PrimaryColor    string
+	AccentColor     string
+	FooterText      string
+	PhysicalAddress string
+	UpdatedAt       time.Time
+}
+
+// GetOrgBranding returns an org's branding, or sql.ErrNoRows if it never set
+// any.
+func (s *Store) GetOrgBranding(ctx context.Context, orgID string) (OrgBranding, error) {
+	var b OrgBranding
+	err := s.q.QueryRowContext(ctx, `
+		SELECT org_id, logo_url, primary_color, accent_color, footer_text, physical_address, updated_at
+		FROM org_branding WHERE org_id = $1
+	`, orgID).Scan(&b.OrgID, &b.LogoURL, &b.PrimaryColor, &b.AccentColor, &b.FooterText, &b.PhysicalAddress, &b.UpdatedAt)
+	return b, err
+}
+
+// SetOrgBranding replaces an org's branding.
+func (s *Store) SetOrgBranding(ctx context.Context, b OrgBranding) (OrgBranding, error) {
+	err := s.q.QueryRowContext(ctx, `
+		INSERT INTO org_branding (org_id, logo_url, primary_color, accent_color, footer_text, physical_address)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (org_id) DO UPDATE SET
+			logo_url = EXCLUDED.logo_url,
+			primary_color = EXCLUDED.primary_color,
+			accent_color = EXCLUDED.accent_color,
+			footer_text = EXCLUDED.footer_text,
+			physical_address = EXCLUDED.physical_address,
+			updated_at = now()
+		RETURNING updated_at
+	`, b.OrgID, b.LogoURL, b.PrimaryColor, b.AccentColor, b.FooterText, b.PhysicalAddress).Scan(&b.UpdatedAt)
+	return b, err
+}
@@ -0,0 +1,255 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/stdlib"
+
+	"neuralmail/internal/pii"
+)
+
+const (
+	// insertMessagesChunk bounds the rows of one multi-row INSERT, keeping
+	// its parameters well under Postgres' limit of 65535.
+	insertMessagesChunk = 1000
+	// copyMessagesThreshold is the batch size from which InsertMessages
+	// stages the rows with COPY instead of binding them as parameters. It
+	// is jmap.DefaultBatchSize, so full ingest batches are copied.
+	copyMessagesThreshold = 200
+)
+
+// bulkMessageColumns are the messages columns InsertMessages takes from
+// each Message, with the types their parameters are cast to. org_id and
+// fts_config come from the inbox.
+var bulkMessageColumns = [][2]string{
+	{"id", "uuid"},
+	{"inbox_id", "uuid"},
+	{"thread_id", "uuid"},
+	{"direction", "text"},
+	{"subject", "text"},
+	{"text", "text"},
+	{"html", "text"},
+	{"created_at", "timestamptz"},
+	{"provider_message_id", "text"},
+	{"internet_message_id", "text"},
+	{"from_json", "jsonb"},
+	{"to_json", "jsonb"},
+	{"cc_json", "jsonb"},
+	{"alias_address", "text"},
+	{"auto_submitted", "text"},
+	{"raw_text", "text"},
+	{"raw_html", "text"},
+	{"in_reply_to", "text"},
+	{"reference_ids", "text"},
+	{"oversized", "boolean"},
+	{"raw_object_key", "text"},
+	{"pii_classes", "text[]"},
+}
+
+// InsertMessages stores msgs, whose threads are already resolved, and
+// returns their ids in order. It does what InsertMessage does for each,
+// including moving their threads' awaiting_reply, in a statement per
+// thousand messages rather than one per message; batches of a couple of
+// hundred or more are copied into a staging table first, unless the store
+// is inside a transaction. A message repeated in msgs, or already stored, gets
+// the id of the stored one.
+func (s *Store) InsertMessages(ctx context.Context, msgs []Message) ([]string, error) {
+	rows := make([][]any, 0, len(msgs))
+	keys := make([]string, len(msgs))
+	seen := map[string]bool{}
+	for i, msg := range msgs {
+		if msg.ID == "" {
+			msg.ID = uuid.NewString()
+		}
+		if msg.ProviderMessageID == "" {
+			msg.ProviderMessageID = msg.ID
+		}
+		keys[i] = msg.InboxID + "/" + msg.ProviderMessageID
+		// One statement cannot insert and update the same row, so only
+		// the first copy of a message goes in.
+		if seen[keys[i]] {
+			continue
+		}
+		seen[keys[i]] = true
+		rows = append(rows, bulkMessageRow(msg))
+	}
+
+	ids := map[string]string{}
+	var err error
+	if _, direct := s.q.(*sql.DB); direct && len(rows) >= copyMessagesThreshold {
+		err = s.copyMessages(ctx, rows, ids)
+	} else {
+		for start := 0; start < len(rows) && err == nil; start += insertMessagesChunk {
+			err = s.insertMessageRows(ctx, rows[start:min(start+insertMessagesChunk, len(rows))], ids)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]string, len(msgs))
+	for i, msg := range msgs {
+		out[i] = ids[keys[i]]
+		s.replica.noteWrite(inboxReadKey(msg.InboxID), threadReadKey(msg.ThreadID))
+	}
+	return out, nil
+}
+
+func bulkMessageRow(msg Message) []any {
+	if msg.PIIClasses == nil {
+		msg.PIIClasses = pii.Kinds(msg.Subject + "\n" + msg.Text)
+	}
+	fromJSON, _ := json.Marshal(msg.From)
+	toJSON, _ := json.Marshal(msg.To)
+	ccJSON, _ := json.Marshal(msg.CC)
+	return []any{
+		msg.ID, msg.InboxID, msg.ThreadID, msg.Direction, msg.Subject, msg.Text, msg.HTML, msg.CreatedAt,
+		msg.ProviderMessageID, msg.InternetMessageID, string(fromJSON), string(toJSON), string(ccJSON),
+		msg.AliasAddress, msg.AutoSubmitted, msg.RawText, msg.RawHTML, msg.InReplyTo, strings.Join(msg.References, " "),
+		msg.Oversized, msg.RawObjectKey, msg.PIIClasses,
+	}
+}
+
+// insertBulkMessagesSQL inserts the messages in source, a relation with
+// bulkMessageColumns aliased b, and moves their threads' awaiting_reply to
+// follow the newest of them as InsertMessage does. It returns each stored
+// message's id, inbox and provider id.
+func insertBulkMessagesSQL(source string) string {
+	cols := make([]string, len(bulkMessageColumns))
+	for i, c := range bulkMessageColumns {
+		cols[i] = "b." + c[0]
+		if c[0] == "pii_classes" {
+			cols[i] = "coalesce(b.pii_classes, '{}')"
+		}
+	}
+	return `WITH m AS (
+			INSERT INTO messages (` + bulkColumnNames() + `, org_id, fts_config)
+			SELECT ` + strings.Join(cols, ", ") + `, i.org_id, coalesce(i.fts_config, o.fts_config, 'simple'::regconfig)
+			FROM ` + source + `
+			JOIN inboxes i ON i.id = b.inbox_id
+			LEFT JOIN orgs o ON o.id = i.org_id
+			ORDER BY b.created_at
+			ON CONFLICT (inbox_id, provider_message_id) DO UPDATE SET thread_id = EXCLUDED.thread_id
+			RETURNING id, inbox_id, provider_message_id, thread_id, direction, created_at, auto_submitted
+		), latest AS (
+			SELECT DISTINCT ON (thread_id) thread_id, direction, created_at
+			FROM m
+			WHERE direction = 'outbound' OR (direction = 'inbound' AND auto_submitted = '')
+			ORDER BY thread_id, created_at DESC
+		), awaiting AS (
+			UPDATE threads t
+			SET awaiting_reply = CASE l.direction WHEN 'inbound' THEN 'us' ELSE 'customer' END,
+			    awaiting_reply_since = l.created_at
+			FROM latest l
+			WHERE t.id = l.thread_id
+			  AND (t.awaiting_reply_since IS NULL OR t.awaiting_reply_since <= l.created_at)
+		)
+		SELECT id::text, inbox_id::text, provider_message_id FROM m`
+}
+
+func bulkColumnNames() string {
+	names := make([]string, len(bulkMessageColumns))
+	for i, c := range bulkMessageColumns {
+		names[i] = c[0]
+	}
+	return strings.Join(names, ", ")
+}
+
+// insertMessageRows stores rows with one multi-row INSERT, recording the
+// stored ids in ids by inbox and provider id.
+func (s *Store) insertMessageRows(ctx context.Context, rows [][]any, ids map[string]string) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	var values strings.Builder
+	args := make([]any, 0, len(rows)*len(bulkMessageColumns))
+	for r, row := range rows {
+		if r > 0 {
+			values.WriteString(", ")
+		}
+		values.WriteString("(")
+		for c, col := range bulkMessageColumns {
+			if c > 0 {
+				values.WriteString(", ")
+			}
+			args = append(args, row[c])
+			fmt.Fprintf(&values, "$%d::%s", len(args), col[1])
+		}
+		values.WriteString(")")
+	}
+	source := `(VALUES ` + values.String() + `) AS b(` + bulkColumnNames() + `)`
+	result, err := s.q.QueryContext(ctx, insertBulkMessagesSQL(source), args...)
+	if err != nil {
+		return err
+	}
+	defer result.Close()
+	for result.Next() {
+		var id, inboxID, providerID string
+		if err := result.Scan(&id, &inboxID, &providerID); err != nil {
+			return err
+		}
+		ids[inboxID+"/"+providerID] = id
+	}
+	return result.Err()
+}
+
+// copyMessages stores rows by COPY into a staging table and a single
+// INSERT from it, in a transaction of its own.
+func (s *Store) copyMessages(ctx context.Context, rows [][]any, ids map[string]string) error {
+	for _, row := range rows {
+		for c := 0; c < 3; c++ {
+			id, err := uuid.Parse(row[c].(string))
+			if err != nil {
+				return fmt.Errorf("copy messages: %s: %w", bulkMessageColumns[c][0], err)
+			}
+			row[c] = pgtype.UUID{Bytes: id, Valid: true}
+		}
+	}
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn any) error {
+		sc, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("copy messages: unsupported driver connection %T", driverConn)
+		}
+		tx, err := sc.Conn().Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+		if _, err := tx.Exec(ctx, `CREATE TEMP TABLE message_batch ON COMMIT DROP AS SELECT `+bulkColumnNames()+` FROM messages WITH NO DATA`); err != nil {
+			return err
+		}
+		names := strings.Split(bulkColumnNames(), ", ")
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{"message_batch"}, names, pgx.CopyFromRows(rows)); err != nil {
+			return err
+		}
+		result, err := tx.Query(ctx, insertBulkMessagesSQL("message_batch b"))
+		if err != nil {
+			return err
+		}
+		for result.Next() {
+			var id, inboxID, providerID string
+			if err := result.Scan(&id, &inboxID, &providerID); err != nil {
+				result.Close()
+				return err
+			}
+			ids[inboxID+"/"+providerID] = id
+		}
+		result.Close()
+		if err := result.Err(); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	})
+}
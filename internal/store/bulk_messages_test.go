@@ -0,0 +1,206 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestInsertMessagesMatchesInsertMessage(t *testing.T) {
+	withTempDatabase(t, func(ctx context.Context, db *sql.DB) {
+		migrateToLatest(t, ctx, db)
+		st, inboxID, threadID := seedBulkInbox(t, ctx, db)
+		start := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+		customer := Participant{Email: "customer@example.com"}
+
+		existing, err := st.InsertMessage(ctx, Message{InboxID: inboxID, ThreadID: threadID, Direction: "inbound", ProviderMessageID: "m-1", CreatedAt: start, From: customer})
+		if err != nil {
+			t.Fatalf("insert message: %v", err)
+		}
+		ids, err := st.InsertMessages(ctx, []Message{
+			{InboxID: inboxID, ThreadID: threadID, Direction: "inbound", ProviderMessageID: "m-1", CreatedAt: start, From: customer},
+			{InboxID: inboxID, ThreadID: threadID, Direction: "outbound", ProviderMessageID: "m-2", CreatedAt: start.Add(time.Hour)},
+			{InboxID: inboxID, ThreadID: threadID, Direction: "inbound", ProviderMessageID: "m-3", CreatedAt: start.Add(2 * time.Hour), From: customer, Text: "call me on +1 415 555 0100"},
+			{InboxID: inboxID, ThreadID: threadID, Direction: "inbound", ProviderMessageID: "m-3", CreatedAt: start.Add(2 * time.Hour), From: customer},
+			// An out-of-office reply leaves awaiting_reply alone.
+			{InboxID: inboxID, ThreadID: threadID, Direction: "inbound", ProviderMessageID: "m-4", CreatedAt: start.Add(3 * time.Hour), AutoSubmitted: "auto-replied", From: customer},
+		})
+		if err != nil {
+			t.Fatalf("insert messages: %v", err)
+		}
+		if len(ids) != 5 || ids[0] != existing || ids[2] != ids[3] || ids[1] == "" || ids[4] == "" {
+			t.Fatalf("expected stored ids in order, repeats sharing one, got %v (existing %s)", ids, existing)
+		}
+		thread, messages, err := st.GetThread(ctx, threadID)
+		if err != nil {
+			t.Fatalf("get thread: %v", err)
+		}
+		if len(messages) != 4 {
+			t.Fatalf("expected 4 messages, got %d", len(messages))
+		}
+		if thread.AwaitingReply != AwaitingUs || thread.AwaitingReplySince == nil || !thread.AwaitingReplySince.Equal(start.Add(2*time.Hour)) {
+			t.Fatalf("expected the thread to await us since m-3, got %q since %v", thread.AwaitingReply, thread.AwaitingReplySince)
+		}
+		if got := messages[2].PIIClasses; len(got) != 1 || got[0] != "phone" {
+			t.Fatalf("expected m-3 to be scanned for personal data, got %v", got)
+		}
+	})
+}
+
+func TestInsertMessagesCopiesLargeBatches(t *testing.T) {
+	withTempDatabase(t, func(ctx context.Context, db *sql.DB) {
+		migrateToLatest(t, ctx, db)
+		st, inboxID, threadID := seedBulkInbox(t, ctx, db)
+		msgs := bulkMessages(inboxID, threadID, copyMessagesThreshold)
+		ids, err := st.InsertMessages(ctx, msgs)
+		if err != nil {
+			t.Fatalf("insert messages: %v", err)
+		}
+		var stored int
+		if err := db.QueryRowContext(ctx, `SELECT count(*) FROM messages WHERE thread_id = $1 AND org_id IS NOT NULL`, threadID).Scan(&stored); err != nil {
+			t.Fatalf("count messages: %v", err)
+		}
+		if stored != len(msgs) || len(ids) != len(msgs) || ids[len(ids)-1] == "" {
+			t.Fatalf("expected %d messages stored with their org, got %d (%d ids)", len(msgs), stored, len(ids))
+		}
+	})
+}
+
+func TestThreadsForMessagesResolvesABatch(t *testing.T) {
+	withTempDatabase(t, func(ctx context.Context, db *sql.DB) {
+		migrateToLatest(t, ctx, db)
+		st, inboxID, threadID := seedBulkInbox(t, ctx, db)
+		customer := Participant{Email: "customer@example.com", Name: "Casey"}
+		if _, err := st.InsertMessage(ctx, Message{InboxID: inboxID, ThreadID: threadID, Direction: "inbound", ProviderMessageID: "root", InternetMessageID: "<root@example.com>", From: customer}); err != nil {
+			t.Fatalf("insert message: %v", err)
+		}
+		if _, err := db.ExecContext(ctx, `UPDATE threads SET status = 'closed' WHERE id = $1`, threadID); err != nil {
+			t.Fatalf("close thread: %v", err)
+		}
+
+		// The default ingest batch, so it is stored with COPY.
+		msgs := bulkMessages(inboxID, "", copyMessagesThreshold)
+		msgs[0] = Message{InboxID: inboxID, Direction: "inbound", Subject: "Re: Refund", ProviderMessageID: "provider", ProviderThreadID: "thread-1", From: customer}
+		msgs[1] = Message{InboxID: inboxID, Direction: "inbound", Subject: "Re: Refund", ProviderMessageID: "reply", InternetMessageID: "<reply@example.com>", InReplyTo: "<root@example.com>", From: customer}
+		msgs[2] = Message{InboxID: inboxID, Direction: "inbound", Subject: "Invoice", ProviderMessageID: "new", ProviderThreadID: "thread-2", InternetMessageID: "<new@example.com>", From: customer}
+		msgs[3] = Message{InboxID: inboxID, Direction: "inbound", Subject: "Re: Invoice", ProviderMessageID: "in-batch", InReplyTo: "<new@example.com>", From: customer}
+		msgs[4] = Message{InboxID: inboxID, Direction: "inbound", Subject: "Invoice", ProviderMessageID: "same-provider", ProviderThreadID: "thread-2", From: customer}
+		for i := range msgs[5:] {
+			msgs[5+i].ProviderThreadID = "thread-1"
+		}
+		threadIDs, err := st.ThreadsForMessages(ctx, inboxID, msgs)
+		if err != nil {
+			t.Fatalf("resolve threads: %v", err)
+		}
+		if threadIDs[0] != threadID || threadIDs[1] != threadID || threadIDs[len(msgs)-1] != threadID {
+			t.Fatalf("expected the provider thread and the reply to join the stored thread, got %v", threadIDs[:2])
+		}
+		if threadIDs[2] == threadID || threadIDs[3] != threadIDs[2] || threadIDs[4] != threadIDs[2] {
+			t.Fatalf("expected the batch to start one thread for thread-2 and its reply, got %v", threadIDs[2:5])
+		}
+		var threads int
+		if err := db.QueryRowContext(ctx, `SELECT count(*) FROM threads WHERE inbox_id = $1`, inboxID).Scan(&threads); err != nil || threads != 2 {
+			t.Fatalf("expected one new thread, got %d threads (%v)", threads, err)
+		}
+
+		for i := range msgs {
+			msgs[i].ThreadID = threadIDs[i]
+		}
+		ids, err := st.InsertMessages(ctx, msgs)
+		if err != nil || len(ids) != len(msgs) || ids[len(ids)-1] == "" {
+			t.Fatalf("insert messages: %d ids, %v", len(ids), err)
+		}
+		if n, err := st.ReopenThreads(ctx, []string{threadID, threadIDs[2]}); err != nil || n != 1 {
+			t.Fatalf("expected the closed thread reopened, got %d %v", n, err)
+		}
+		repeats, err := st.CountInboundRepeats(ctx, msgs[len(msgs)-2:], time.Hour)
+		if err != nil || len(repeats) != 2 || repeats[1].Identical < 3 {
+			t.Fatalf("expected the repeated messages counted, got %+v %v", repeats, err)
+		}
+		sightings := make([]ContactSighting, len(msgs))
+		for i, msg := range msgs {
+			sightings[i] = ContactSighting{ThreadID: msg.ThreadID, From: msg.From, SeenAt: msg.CreatedAt}
+		}
+		sightings[1].From = Participant{Email: "Customer+refunds@example.com"}
+		if err := st.RecordContacts(ctx, inboxID, sightings); err != nil {
+			t.Fatalf("record contacts: %v", err)
+		}
+		contact, err := st.GetContactByEmail(ctx, "", "customer@example.com")
+		if err != nil || contact.ThreadCount != 2 || len(contact.Emails) != 2 || contact.Name != "Casey" {
+			t.Fatalf("expected one contact on both threads with both addresses, got %+v %v", contact, err)
+		}
+	})
+}
+
+// BenchmarkInsertMessage and BenchmarkInsertMessages compare storing polled
+// mail one message at a time with storing it in ingest-sized batches.
+func BenchmarkInsertMessage(b *testing.B) {
+	withTempDatabase(b, func(ctx context.Context, db *sql.DB) {
+		migrateToLatest(b, ctx, db)
+		st, inboxID, threadID := seedBulkInbox(b, ctx, db)
+		msgs := bulkMessages(inboxID, threadID, b.N)
+		b.ResetTimer()
+		for _, msg := range msgs {
+			if _, err := st.InsertMessage(ctx, msg); err != nil {
+				b.Fatalf("insert message: %v", err)
+			}
+		}
+		b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "msgs/s")
+	})
+}
+
+func BenchmarkInsertMessages(b *testing.B) {
+	const batchSize = 200
+	withTempDatabase(b, func(ctx context.Context, db *sql.DB) {
+		migrateToLatest(b, ctx, db)
+		st, inboxID, threadID := seedBulkInbox(b, ctx, db)
+		msgs := bulkMessages(inboxID, threadID, b.N)
+		b.ResetTimer()
+		for start := 0; start < len(msgs); start += batchSize {
+			if _, err := st.InsertMessages(ctx, msgs[start:min(start+batchSize, len(msgs))]); err != nil {
+				b.Fatalf("insert messages: %v", err)
+			}
+		}
+		b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "msgs/s")
+	})
+}
+
+func seedBulkInbox(t testing.TB, ctx context.Context, db *sql.DB) (*Store, string, string) {
+	t.Helper()
+	orgID := uuid.NewString()
+	if _, err := db.ExecContext(ctx, `INSERT INTO orgs (id, name) VALUES ($1, 'acme')`, orgID); err != nil {
+		t.Fatalf("insert org: %v", err)
+	}
+	st := &Store{db: db, q: db}
+	inbox, err := st.CreateInboxForOrg(ctx, orgID, "support@acme.test", "", ProviderJMAP)
+	if err != nil {
+		t.Fatalf("create inbox: %v", err)
+	}
+	threadID, err := st.EnsureThread(ctx, inbox.ID, "thread-1", "Refund", []Participant{{Email: "customer@example.com"}})
+	if err != nil {
+		t.Fatalf("create thread: %v", err)
+	}
+	return st, inbox.ID, threadID
+}
+
+func bulkMessages(inboxID, threadID string, n int) []Message {
+	start := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	msgs := make([]Message, n)
+	for i := range msgs {
+		msgs[i] = Message{
+			InboxID:           inboxID,
+			ThreadID:          threadID,
+			Direction:         "inbound",
+			Subject:           "Re: Refund",
+			Text:              "Any news on my refund?",
+			ProviderMessageID: fmt.Sprintf("bulk-%d", i),
+			CreatedAt:         start.Add(time.Duration(i) * time.Second),
+			From:              Participant{Email: "customer@example.com"},
+		}
+	}
+	return msgs
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ThreadFilter selects threads in one inbox for bulk operations. Empty fields
+// do not constrain the match.
+type ThreadFilter struct {
+	InboxID   string
+	Status    string
+	Label     string
+	OlderThan time.Time
+}
+
+func (f ThreadFilter) where(args []any) (string, []any) {
+	clauses := []string{fmt.Sprintf("inbox_id = $%d", len(args)+1)}
+	args = append(args, f.InboxID)
+	if f.Status != "" {
+		clauses = append(clauses, fmt.Sprintf("status = $%d", len(args)+1))
+		args = append(args, f.Status)
+	}
+	if f.Label != "" {
+		clauses = append(clauses, fmt.Sprintf("labels @> ARRAY[$%d]::text[]", len(args)+1))
+		args = append(args, f.Label)
+	}
+	if !f.OlderThan.IsZero() {
+		clauses = append(clauses, fmt.Sprintf("updated_at < $%d", len(args)+1))
+		args = append(args, f.OlderThan)
+	}
+	return strings.Join(clauses, " AND "), args
+}
+
+func (s *Store) CountThreadsMatching(ctx context.Context, filter ThreadFilter) (int64, error) {
+	where, args := filter.where(nil)
+	var n int64
+	err := s.q.QueryRowContext(ctx, `SELECT count(*) FROM threads WHERE `+where, args...).Scan(&n)
+	return n, err
+}
+
+// ListThreadIDsMatching pages through matching thread ids in id order; pass
+// the last id of the previous page as afterID.
+func (s *Store) ListThreadIDsMatching(ctx context.Context, filter ThreadFilter, afterID string, limit int) ([]string, error) {
+	args := []any{}
+	cursor := ""
+	if afterID != "" {
+		cursor = " AND id > $1"
+		args = append(args, afterID)
+	}
+	where, args := filter.where(args)
+	args = append(args, limit)
+	rows, err := s.q.QueryContext(ctx, fmt.Sprintf(`SELECT id FROM threads WHERE %s%s ORDER BY id LIMIT $%d`, where, cursor, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// CloseThreads, LabelThreads, AssignThreads and DeleteThreads apply a bulk
+// action to the given ids and return the number of rows changed.
+func (s *Store) CloseThreads(ctx context.Context, ids []string) (int64, error) {
+	return s.closeThreads(ctx, ids, false)
+}
+
+// closeThreads closes the open threads among ids and records each closure,
+// marked auto when the inactivity rule closed it.
+func (s *Store) closeThreads(ctx context.Context, ids []string, auto bool) (int64, error) {
+	return s.execAffected(ctx, `
+		WITH closed AS (
+			UPDATE threads SET status = 'closed', updated_at = now()
+			WHERE id = ANY($1::uuid[]) AND status <> 'closed'
+			RETURNING id, org_id, inbox_id
+		)
+		INSERT INTO thread_closures (org_id, inbox_id, thread_id, auto)
+		SELECT org_id, inbox_id, id, $2 FROM closed
+	`, ids, auto)
+}
+
+func (s *Store) LabelThreads(ctx context.Context, ids []string, label string) (int64, error) {
+	return s.execAffected(ctx, `UPDATE threads SET labels = array_append(labels, $2), updated_at = now() WHERE id = ANY($1::uuid[]) AND NOT labels @> ARRAY[$2]::text[]`, ids, label)
+}
+
+func (s *Store) AssignThreads(ctx context.Context, ids []string, assignee string) (int64, error) {
+	return s.execAffected(ctx, `UPDATE threads SET assignee = nullif($2, ''), updated_at = now() WHERE id = ANY($1::uuid[]) AND coalesce(assignee, '') <> $2`, ids, assignee)
+}
+
+// DeleteThreads also queues the removal of the deleted threads' vector
+// points.
+func (s *Store) DeleteThreads(ctx context.Context, ids []string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	rows, err := s.q.QueryContext(ctx, `DELETE FROM threads WHERE id = ANY($1::uuid[]) RETURNING id::text`, uuidArrayLiteral(ids))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var deleted []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		deleted = append(deleted, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	s.queueVectorCleanup(ctx, VectorCleanup{ThreadIDs: deleted})
+	return int64(len(deleted)), nil
+}
+
+func (s *Store) execAffected(ctx context.Context, query string, ids []string, args ...any) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	res, err := s.q.ExecContext(ctx, query, append([]any{uuidArrayLiteral(ids)}, args...)...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// uuidArrayLiteral renders ids as a Postgres array literal; database/sql has
+// no native slice binding.
+func uuidArrayLiteral(ids []string) string {
+	return "{" + strings.Join(ids, ",") + "}"
+}
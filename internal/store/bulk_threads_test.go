@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestBulkThreadActionsCountOnlyThreadsTheyChange(t *testing.T) {
+	withTempDatabase(t, func(ctx context.Context, db *sql.DB) {
+		migrateToLatest(t, ctx, db)
+		st, inboxID, first := seedBulkInbox(t, ctx, db)
+		ids := []string{first}
+		for i := 2; i <= 3; i++ {
+			id, err := st.EnsureThread(ctx, inboxID, fmt.Sprintf("thread-%d", i), "Refund", nil)
+			if err != nil {
+				t.Fatalf("create thread: %v", err)
+			}
+			ids = append(ids, id)
+		}
+		if _, err := st.CloseThreads(ctx, ids[:1]); err != nil {
+			t.Fatalf("close thread: %v", err)
+		}
+
+		open := ThreadFilter{InboxID: inboxID, Status: "open"}
+		if n, err := st.CountThreadsMatching(ctx, open); err != nil || n != 2 {
+			t.Fatalf("expected 2 open threads, got %d %v", n, err)
+		}
+		page, err := st.ListThreadIDsMatching(ctx, ThreadFilter{InboxID: inboxID}, "", 2)
+		if err != nil {
+			t.Fatalf("list threads: %v", err)
+		}
+		rest, err := st.ListThreadIDsMatching(ctx, ThreadFilter{InboxID: inboxID}, page[len(page)-1], 2)
+		if err != nil {
+			t.Fatalf("list threads: %v", err)
+		}
+		all := slices.Concat(page, rest)
+		if len(page) != 2 || len(rest) != 1 || !slices.IsSorted(all) {
+			t.Fatalf("expected pages of 2 and 1 in id order, got %v then %v", page, rest)
+		}
+
+		// The thread closed above is already closed: it is neither counted
+		// nor given a second closure record.
+		if n, err := st.CloseThreads(ctx, ids); err != nil || n != 2 {
+			t.Fatalf("expected 2 threads closed, got %d %v", n, err)
+		}
+		var closures int
+		if err := db.QueryRowContext(ctx, `SELECT count(*) FROM thread_closures WHERE thread_id = ANY($1::uuid[])`, uuidArrayLiteral(ids)).Scan(&closures); err != nil {
+			t.Fatalf("count closures: %v", err)
+		}
+		if closures != 3 {
+			t.Fatalf("expected one closure per thread, got %d", closures)
+		}
+
+		if n, err := st.LabelThreads(ctx, ids[:2], "stale"); err != nil || n != 2 {
+			t.Fatalf("expected 2 threads labelled, got %d %v", n, err)
+		}
+		if n, err := st.LabelThreads(ctx, ids, "stale"); err != nil || n != 1 {
+			t.Fatalf("expected only the unlabelled thread relabelled, got %d %v", n, err)
+		}
+		if n, err := st.AssignThreads(ctx, ids, "ana"); err != nil || n != 3 {
+			t.Fatalf("expected 3 threads assigned, got %d %v", n, err)
+		}
+		if n, err := st.AssignThreads(ctx, ids[1:], "ana"); err != nil || n != 0 {
+			t.Fatalf("expected reassigning to the same assignee to change nothing, got %d %v", n, err)
+		}
+		thread, _, err := st.GetThread(ctx, ids[2])
+		if err != nil {
+			t.Fatalf("get thread: %v", err)
+		}
+		if thread.Status != "closed" || !slices.Equal(thread.Labels, []string{"stale"}) || thread.Assignee != "ana" {
+			t.Fatalf("expected the thread closed, labelled and assigned, got %+v", thread)
+		}
+
+		if n, err := st.DeleteThreads(ctx, ids[1:]); err != nil || n != 2 {
+			t.Fatalf("expected 2 threads deleted, got %d %v", n, err)
+		}
+		if n, err := st.DeleteThreads(ctx, ids); err != nil || n != 1 {
+			t.Fatalf("expected only the remaining thread deleted, got %d %v", n, err)
+		}
+		if n, err := st.CountThreadsMatching(ctx, ThreadFilter{InboxID: inboxID}); err != nil || n != 0 {
+			t.Fatalf("expected no threads left, got %d %v", n, err)
+		}
+	})
+}
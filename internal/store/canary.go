@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+type CanaryMetric struct {
+	OrgID         string
+	ToolName      string
+	Variant       string
+	LatencyMS     int
+	Success       bool
+	PolicyBlocked bool
+	NeedsApproval bool
+}
+
+// CanaryVariantStats aggregates canary_tool_metrics for one tool and variant.
+type CanaryVariantStats struct {
+	ToolName      string
+	Variant       string
+	Calls         int64
+	Errors        int64
+	PolicyBlocks  int64
+	Approvals     int64
+	AvgLatencyMS  float64
+	P95LatencyMS  float64
+	DistinctOrgs  int64
+	FirstRecorded time.Time
+	LastRecorded  time.Time
+}
+
+func (s *Store) RecordCanaryMetric(ctx context.Context, m CanaryMetric) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO canary_tool_metrics (org_id, tool_name, variant, latency_ms, success, policy_blocked, needs_approval)
+		VALUES (nullif($1, '')::uuid, $2, $3, $4, $5, $6, $7)
+	`, m.OrgID, m.ToolName, m.Variant, m.LatencyMS, m.Success, m.PolicyBlocked, m.NeedsApproval)
+	return err
+}
+
+// SummarizeCanaryMetrics compares variants for calls recorded since the given
+// time. An empty toolName covers every tool.
+func (s *Store) SummarizeCanaryMetrics(ctx context.Context, toolName string, since time.Time) ([]CanaryVariantStats, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT tool_name, variant,
+			count(*),
+			count(*) FILTER (WHERE NOT success),
+			count(*) FILTER (WHERE policy_blocked),
+			count(*) FILTER (WHERE needs_approval),
+			coalesce(avg(latency_ms), 0)::float8,
+			coalesce(percentile_cont(0.95) WITHIN GROUP (ORDER BY latency_ms), 0)::float8,
+			count(DISTINCT org_id),
+			min(created_at),
+			max(created_at)
+		FROM canary_tool_metrics
+		WHERE created_at >= $1 AND ($2 = '' OR tool_name = $2)
+		GROUP BY tool_name, variant
+		ORDER BY tool_name, variant
+	`, since, toolName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []CanaryVariantStats
+	for rows.Next() {
+		var st CanaryVariantStats
+		if err := rows.Scan(&st.ToolName, &st.Variant, &st.Calls, &st.Errors, &st.PolicyBlocks, &st.Approvals,
+			&st.AvgLatencyMS, &st.P95LatencyMS, &st.DistinctOrgs, &st.FirstRecorded, &st.LastRecorded); err != nil {
+			return nil, err
+		}
+		out = append(out, st)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,176 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Contact is someone who has written to the org, across all of its inboxes.
+type Contact struct {
+	ID           string
+	OrgID        string
+	Name         string
+	Emails       []string
+	FirstSeenAt  time.Time
+	LastSeenAt   time.Time
+	MessageCount int
+	ThreadCount  int
+}
+
+// ContactThread is a thread a contact has written on.
+type ContactThread struct {
+	ThreadID       string
+	InboxID        string
+	Subject        string
+	Status         string
+	SentimentScore *float64
+	FirstSeenAt    time.Time
+	LastSeenAt     time.Time
+}
+
+var plusTagRE = regexp.MustCompile(`\+[^@]*@`)
+
+// ContactKey is the address contacts are matched by: lowercased, without a
+// +tag.
+func ContactKey(email string) string {
+	return plusTagRE.ReplaceAllString(strings.ToLower(strings.TrimSpace(email)), "@")
+}
+
+// RecordContact adds a message from p, seen at seenAt on threadID in inboxID,
+// to p's contact in the inbox's org, creating the contact on its first
+// message. A non-empty name replaces the one on record. Recording a message
+// twice changes nothing.
+func (s *Store) RecordContact(ctx context.Context, inboxID, threadID string, p Participant, seenAt time.Time) error {
+	return s.RecordContacts(ctx, inboxID, []ContactSighting{{ThreadID: threadID, From: p, SeenAt: seenAt}})
+}
+
+// ContactSighting is a message from From, seen at SeenAt on ThreadID.
+type ContactSighting struct {
+	ThreadID string
+	From     Participant
+	SeenAt   time.Time
+}
+
+// RecordContacts is RecordContact for several messages of inboxID at once,
+// in one statement. Of the names a contact is seen with, the latest
+// non-empty one is kept.
+func (s *Store) RecordContacts(ctx context.Context, inboxID string, sightings []ContactSighting) error {
+	var keys, emails, names, threadIDs []string
+	var seen []time.Time
+	for _, sg := range sightings {
+		email := strings.ToLower(strings.TrimSpace(sg.From.Email))
+		if email == "" {
+			continue
+		}
+		if sg.SeenAt.IsZero() {
+			sg.SeenAt = time.Now().UTC()
+		}
+		keys = append(keys, ContactKey(email))
+		emails = append(emails, email)
+		names = append(names, strings.TrimSpace(sg.From.Name))
+		threadIDs = append(threadIDs, sg.ThreadID)
+		seen = append(seen, sg.SeenAt)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := s.q.ExecContext(ctx, `
+		WITH sighting AS (
+			SELECT * FROM unnest($2::text[], $3::text[], $4::text[], $5::text[], $6::timestamptz[]) AS s(contact_key, email, name, thread_id, seen_at)
+		), seen AS (
+			SELECT contact_key,
+			       coalesce((array_agg(name ORDER BY seen_at DESC) FILTER (WHERE name <> ''))[1], '') AS name,
+			       array_agg(DISTINCT email) AS emails, min(seen_at) AS first_seen_at, max(seen_at) AS last_seen_at
+			FROM sighting
+			GROUP BY contact_key
+		), contact AS (
+			INSERT INTO contacts (org_id, contact_key, name, emails, first_seen_at, last_seen_at)
+			SELECT (SELECT org_id FROM inboxes WHERE id = $1), contact_key, name, emails, first_seen_at, last_seen_at FROM seen
+			ON CONFLICT (org_id, contact_key) DO UPDATE SET
+				name = CASE WHEN EXCLUDED.name <> '' THEN EXCLUDED.name ELSE contacts.name END,
+				emails = contacts.emails || ARRAY(SELECT e FROM unnest(EXCLUDED.emails) e WHERE e <> ALL(contacts.emails)),
+				first_seen_at = least(contacts.first_seen_at, EXCLUDED.first_seen_at),
+				last_seen_at = greatest(contacts.last_seen_at, EXCLUDED.last_seen_at),
+				updated_at = now()
+			RETURNING id, org_id, contact_key
+		)
+		INSERT INTO contact_threads (contact_id, thread_id, org_id, first_seen_at, last_seen_at)
+		SELECT c.id, s.thread_id::uuid, c.org_id, min(s.seen_at), max(s.seen_at)
+		FROM sighting s
+		JOIN contact c ON c.contact_key = s.contact_key
+		GROUP BY c.id, s.thread_id, c.org_id
+		ON CONFLICT (contact_id, thread_id) DO UPDATE SET
+			first_seen_at = least(contact_threads.first_seen_at, EXCLUDED.first_seen_at),
+			last_seen_at = greatest(contact_threads.last_seen_at, EXCLUDED.last_seen_at)
+	`, inboxID, keys, emails, names, threadIDs, seen)
+	return err
+}
+
+// Message and thread counts are taken from the messages themselves, so a
+// message ingested twice is not counted twice.
+const contactColumns = `c.id, c.org_id, c.name, to_jsonb(c.emails), c.first_seen_at, c.last_seen_at,
+	(SELECT count(*) FROM contact_threads ct JOIN messages m ON m.thread_id = ct.thread_id
+	 WHERE ct.contact_id = c.id AND m.direction = 'inbound' AND lower(m.from_json->>'email') = ANY(c.emails)),
+	(SELECT count(*) FROM contact_threads ct WHERE ct.contact_id = c.id)`
+
+func scanContact(row *sql.Row) (Contact, error) {
+	var c Contact
+	var emails []byte
+	err := row.Scan(&c.ID, &c.OrgID, &c.Name, &emails, &c.FirstSeenAt, &c.LastSeenAt, &c.MessageCount, &c.ThreadCount)
+	if err != nil {
+		return c, err
+	}
+	_ = json.Unmarshal(emails, &c.Emails)
+	return c, nil
+}
+
+// GetContactByEmail finds the contact for email in orgID (any org when
+// orgID is empty), or returns sql.ErrNoRows.
+func (s *Store) GetContactByEmail(ctx context.Context, orgID, email string) (Contact, error) {
+	return scanContact(s.q.QueryRowContext(ctx, `
+		SELECT `+contactColumns+`
+		FROM contacts c
+		WHERE c.contact_key = $1 AND ($2 = '' OR c.org_id = nullif($2, '')::uuid)
+		ORDER BY c.last_seen_at DESC
+		LIMIT 1
+	`, ContactKey(email), orgID))
+}
+
+// GetContact returns one of orgID's contacts (any org's when orgID is
+// empty), or sql.ErrNoRows.
+func (s *Store) GetContact(ctx context.Context, orgID, contactID string) (Contact, error) {
+	return scanContact(s.q.QueryRowContext(ctx, `
+		SELECT `+contactColumns+`
+		FROM contacts c
+		WHERE c.id = $1 AND ($2 = '' OR c.org_id = nullif($2, '')::uuid)
+	`, contactID, orgID))
+}
+
+// ListContactThreads returns the threads a contact wrote on, latest first.
+func (s *Store) ListContactThreads(ctx context.Context, contactID string, limit int) ([]ContactThread, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT t.id, t.inbox_id, t.subject, t.status, t.sentiment_score, ct.first_seen_at, ct.last_seen_at
+		FROM contact_threads ct
+		JOIN threads t ON t.id = ct.thread_id
+		WHERE ct.contact_id = $1
+		ORDER BY ct.last_seen_at DESC
+		LIMIT $2
+	`, contactID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []ContactThread
+	for rows.Next() {
+		var t ContactThread
+		if err := rows.Scan(&t.ThreadID, &t.InboxID, &t.Subject, &t.Status, &t.SentimentScore, &t.FirstSeenAt, &t.LastSeenAt); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
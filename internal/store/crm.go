@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// CRMConnection is an org's CRM account. AccessToken is the provider's
+// private app token and is never returned by the API. It is encrypted when
+// Sealed; connections stored before tokens were sealed hold plaintext.
+type CRMConnection struct {
+	OrgID          string
+	Provider       string
+	AccessToken    string
+	Sealed         bool
+	SalesIntents   []string
+	SupportIntents []string
+	TicketPipeline string
+	TicketStage    string
+	CreatedBy      string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// CRMLink is the CRM ticket, and the contact it is filed under, a thread is
+// tracked as. Kind is the case kind, sales or support.
+type CRMLink struct {
+	ThreadID  string
+	OrgID     string
+	Provider  string
+	Kind      string
+	ContactID string
+	TicketID  string
+	Priority  string
+	LinkedBy  string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+const crmConnectionColumns = `org_id, provider, access_token, sealed, to_jsonb(sales_intents), to_jsonb(support_intents), ticket_pipeline, ticket_stage, created_by, created_at, updated_at`
+
+func scanCRMConnection(row interface{ Scan(...any) error }) (CRMConnection, error) {
+	var c CRMConnection
+	var sales, support []byte
+	err := row.Scan(&c.OrgID, &c.Provider, &c.AccessToken, &c.Sealed, &sales, &support, &c.TicketPipeline, &c.TicketStage, &c.CreatedBy, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return c, err
+	}
+	_ = json.Unmarshal(sales, &c.SalesIntents)
+	_ = json.Unmarshal(support, &c.SupportIntents)
+	return c, nil
+}
+
+// GetCRMConnection returns orgID's CRM connection (the only one when orgID
+// is empty, as on a self-hosted install), or sql.ErrNoRows.
+func (s *Store) GetCRMConnection(ctx context.Context, orgID string) (CRMConnection, error) {
+	return scanCRMConnection(s.q.QueryRowContext(ctx, `
+		SELECT `+crmConnectionColumns+`
+		FROM crm_connections
+		WHERE ($1 = '' OR org_id = nullif($1, '')::uuid)
+		ORDER BY created_at
+		LIMIT 1
+	`, orgID))
+}
+
+// GetThreadCRMConnection returns the CRM connection of threadID's org, or
+// sql.ErrNoRows when it has none.
+func (s *Store) GetThreadCRMConnection(ctx context.Context, threadID string) (CRMConnection, error) {
+	return scanCRMConnection(s.q.QueryRowContext(ctx, `
+		SELECT `+crmConnectionColumns+`
+		FROM crm_connections
+		WHERE org_id = (SELECT org_id FROM threads WHERE id = $1)
+	`, threadID))
+}
+
+// PutCRMConnection connects c.OrgID to a CRM, replacing any connection it
+// had. Links made through the old connection are kept.
+func (s *Store) PutCRMConnection(ctx context.Context, c CRMConnection) (CRMConnection, error) {
+	return scanCRMConnection(s.q.QueryRowContext(ctx, `
+		INSERT INTO crm_connections (org_id, provider, access_token, sealed, sales_intents, support_intents, ticket_pipeline, ticket_stage, created_by)
+		VALUES ($1, $2, $3, $4, coalesce($5::text[], '{}'), coalesce($6::text[], '{}'), $7, $8, $9)
+		ON CONFLICT (org_id) DO UPDATE SET
+			provider = EXCLUDED.provider,
+			access_token = EXCLUDED.access_token,
+			sealed = EXCLUDED.sealed,
+			sales_intents = EXCLUDED.sales_intents,
+			support_intents = EXCLUDED.support_intents,
+			ticket_pipeline = EXCLUDED.ticket_pipeline,
+			ticket_stage = EXCLUDED.ticket_stage,
+			updated_at = now()
+		RETURNING `+crmConnectionColumns,
+		c.OrgID, c.Provider, c.AccessToken, c.Sealed, c.SalesIntents, c.SupportIntents, c.TicketPipeline, c.TicketStage, c.CreatedBy))
+}
+
+// SealCRMConnection replaces orgID's plaintext access token with
+// sealedToken, its encryption. A connection already sealed is left alone.
+func (s *Store) SealCRMConnection(ctx context.Context, orgID string, sealedToken string) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE crm_connections SET access_token = $2, sealed = true
+		WHERE org_id = $1 AND NOT sealed
+	`, orgID, sealedToken)
+	return err
+}
+
+func (s *Store) DeleteCRMConnection(ctx context.Context, orgID string) (bool, error) {
+	res, err := s.q.ExecContext(ctx, `DELETE FROM crm_connections WHERE org_id = $1`, orgID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+const crmLinkColumns = `thread_id, org_id, provider, kind, contact_id, ticket_id, priority, linked_by, created_at, updated_at`
+
+func scanCRMLink(row interface{ Scan(...any) error }) (CRMLink, error) {
+	var l CRMLink
+	err := row.Scan(&l.ThreadID, &l.OrgID, &l.Provider, &l.Kind, &l.ContactID, &l.TicketID, &l.Priority, &l.LinkedBy, &l.CreatedAt, &l.UpdatedAt)
+	return l, err
+}
+
+// GetCRMLink returns the CRM ticket threadID is linked to, or sql.ErrNoRows.
+func (s *Store) GetCRMLink(ctx context.Context, threadID string) (CRMLink, error) {
+	return scanCRMLink(s.q.QueryRowContext(ctx, `SELECT `+crmLinkColumns+` FROM crm_links WHERE thread_id = $1`, threadID))
+}
+
+// PutCRMLink links l.ThreadID to l.TicketID in its org's CRM, replacing any
+// ticket it was linked to.
+func (s *Store) PutCRMLink(ctx context.Context, l CRMLink) (CRMLink, error) {
+	return scanCRMLink(s.q.QueryRowContext(ctx, `
+		INSERT INTO crm_links (thread_id, org_id, provider, kind, contact_id, ticket_id, priority, linked_by)
+		VALUES ($1, (SELECT org_id FROM threads WHERE id = $1), $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (thread_id) DO UPDATE SET
+			provider = EXCLUDED.provider,
+			kind = EXCLUDED.kind,
+			contact_id = EXCLUDED.contact_id,
+			ticket_id = EXCLUDED.ticket_id,
+			priority = EXCLUDED.priority,
+			linked_by = EXCLUDED.linked_by,
+			updated_at = now()
+		RETURNING `+crmLinkColumns,
+		l.ThreadID, l.Provider, l.Kind, l.ContactID, l.TicketID, l.Priority, l.LinkedBy))
+}
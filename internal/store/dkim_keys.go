@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// DKIM key statuses.
+const (
+	DKIMKeyPending  = "pending"
+	DKIMKeyActive   = "active"
+	DKIMKeyRetiring = "retiring"
+	DKIMKeyRetired  = "retired"
+)
+
+// DKIMKey is a signing key of an org domain. PrivateKeyEnc is the
+// AES-GCM encrypted PEM and PublicKey the PEM published in DNS. Overlap is
+// how long the key it replaces keeps retiring once it is active.
+type DKIMKey struct {
+	ID            string
+	DomainID      string
+	Selector      string
+	PrivateKeyEnc string
+	PublicKey     string
+	Status        string
+	Overlap       time.Duration
+	CreatedAt     time.Time
+	ActivatedAt   sql.NullTime
+	RetireAt      sql.NullTime
+	RetiredAt     sql.NullTime
+}
+
+var (
+	// ErrDKIMKeyExists is returned when generating a first key for a domain
+	// that already has one; rotate it instead.
+	ErrDKIMKeyExists = errors.New("domain already has a dkim key")
+	// ErrDKIMRotationPending is returned when rotating a domain whose
+	// previous rotation still waits for its DNS record.
+	ErrDKIMRotationPending = errors.New("dkim rotation already pending")
+)
+
+const dkimKeyColumns = `id, domain_id, selector, private_key_enc, public_key, status, overlap_seconds, created_at, activated_at, retire_at, retired_at`
+
+func scanDKIMKey(row interface{ Scan(...any) error }) (DKIMKey, error) {
+	var k DKIMKey
+	var overlapSeconds int64
+	err := row.Scan(&k.ID, &k.DomainID, &k.Selector, &k.PrivateKeyEnc, &k.PublicKey, &k.Status, &overlapSeconds,
+		&k.CreatedAt, &k.ActivatedAt, &k.RetireAt, &k.RetiredAt)
+	k.Overlap = time.Duration(overlapSeconds) * time.Second
+	return k, err
+}
+
+// CreateDKIMKey stores domainID's first signing key and makes it the active
+// one straight away. Returns ErrDKIMKeyExists if the domain has an active or
+// pending key.
+func (s *Store) CreateDKIMKey(ctx context.Context, domainID, selector, privateKeyEnc, publicKey string) (DKIMKey, error) {
+	key, err := scanDKIMKey(s.q.QueryRowContext(ctx, `
+		WITH d AS (
+			UPDATE org_domains
+			SET dkim_selector = $2, dkim_private_key_enc = $3, dkim_public_key = $4,
+			    dkim_verified = false, updated_at = now()
+			WHERE id = $1
+			  AND NOT EXISTS (
+				SELECT 1 FROM org_domain_dkim_keys
+				WHERE domain_id = $1 AND status IN ('pending', 'active')
+			  )
+			RETURNING id, org_id
+		)
+		INSERT INTO org_domain_dkim_keys (domain_id, org_id, selector, private_key_enc, public_key, status, activated_at)
+		SELECT id, org_id, $2, $3, $4, 'active', now() FROM d
+		RETURNING `+dkimKeyColumns, domainID, selector, privateKeyEnc, publicKey))
+	if errors.Is(err, sql.ErrNoRows) {
+		return key, ErrDKIMKeyExists
+	}
+	return key, err
+}
+
+// RotateDKIMKey stores a pending key that replaces domainID's active key
+// once ActivateDKIMKey is called, which the domain verifier does when the
+// key's DNS record is published. The replaced key keeps retiring for
+// overlap after that. Returns ErrDKIMRotationPending if a rotation already
+// waits, and sql.ErrNoRows if the domain has no active key.
+func (s *Store) RotateDKIMKey(ctx context.Context, domainID, selector, privateKeyEnc, publicKey string, overlap time.Duration) (DKIMKey, error) {
+	key, err := scanDKIMKey(s.q.QueryRowContext(ctx, `
+		INSERT INTO org_domain_dkim_keys (domain_id, org_id, selector, private_key_enc, public_key, status, overlap_seconds)
+		SELECT domain_id, org_id, $2, $3, $4, 'pending', $5
+		FROM org_domain_dkim_keys
+		WHERE domain_id = $1 AND status = 'active'
+		  AND NOT EXISTS (SELECT 1 FROM org_domain_dkim_keys WHERE domain_id = $1 AND status = 'pending')
+		LIMIT 1
+		RETURNING `+dkimKeyColumns, domainID, selector, privateKeyEnc, publicKey, int64(overlap.Seconds())))
+	if !errors.Is(err, sql.ErrNoRows) {
+		return key, err
+	}
+	var pending bool
+	if err := s.q.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM org_domain_dkim_keys WHERE domain_id = $1 AND status = 'pending')
+	`, domainID).Scan(&pending); err != nil {
+		return DKIMKey{}, err
+	}
+	if pending {
+		return DKIMKey{}, ErrDKIMRotationPending
+	}
+	return DKIMKey{}, sql.ErrNoRows
+}
+
+// ActivateDKIMKey makes a pending key its domain's active key, which the
+// send path picks up from org_domains, and starts retiring the key it
+// replaces. Reports false if the key was not pending.
+func (s *Store) ActivateDKIMKey(ctx context.Context, keyID string) (bool, error) {
+	var activated bool
+	err := s.q.QueryRowContext(ctx, `
+		WITH k AS (
+			UPDATE org_domain_dkim_keys
+			SET status = 'active', activated_at = now()
+			WHERE id = $1 AND status = 'pending'
+			RETURNING domain_id, selector, private_key_enc, public_key, overlap_seconds
+		), old AS (
+			UPDATE org_domain_dkim_keys o
+			SET status = 'retiring', retire_at = now() + make_interval(secs => k.overlap_seconds)
+			FROM k
+			WHERE o.domain_id = k.domain_id AND o.status = 'active' AND o.id <> $1
+			RETURNING o.id
+		), d AS (
+			UPDATE org_domains d
+			SET dkim_selector = k.selector, dkim_private_key_enc = k.private_key_enc,
+			    dkim_public_key = k.public_key, updated_at = now()
+			FROM k
+			WHERE d.id = k.domain_id
+			RETURNING d.id
+		)
+		SELECT EXISTS(SELECT 1 FROM k)
+	`, keyID).Scan(&activated)
+	return activated, err
+}
+
+// RetireDKIMKeys retires the keys whose overlap has ended; their DNS
+// records can be removed. Returns how many it retired.
+func (s *Store) RetireDKIMKeys(ctx context.Context) (int64, error) {
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE org_domain_dkim_keys
+		SET status = 'retired', retired_at = now()
+		WHERE status = 'retiring' AND retire_at <= now()
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ListDKIMKeys returns domainID's keys, newest first.
+func (s *Store) ListDKIMKeys(ctx context.Context, domainID string) ([]DKIMKey, error) {
+	return s.listDKIMKeys(ctx, `WHERE domain_id = $1 ORDER BY created_at DESC`, domainID)
+}
+
+// ListPendingDKIMKeys returns every key waiting to take over its domain.
+func (s *Store) ListPendingDKIMKeys(ctx context.Context) ([]DKIMKey, error) {
+	return s.listDKIMKeys(ctx, `WHERE status = 'pending' ORDER BY created_at`)
+}
+
+func (s *Store) listDKIMKeys(ctx context.Context, where string, args ...any) ([]DKIMKey, error) {
+	rows, err := s.q.QueryContext(ctx, `SELECT `+dkimKeyColumns+` FROM org_domain_dkim_keys `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []DKIMKey
+	for rows.Next() {
+		k, err := scanDKIMKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
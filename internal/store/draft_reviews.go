@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// Draft review statuses. A draft whose latest revision needs approval waits
+// in pending_approval; send_reply only accepts approved drafts and moves them
+// to sent.
+const (
+	DraftPendingApproval = "pending_approval"
+	DraftApproved        = "approved"
+	DraftRejected        = "rejected"
+	DraftSent            = "sent"
+)
+
+// DraftWithRevision is a draft together with its latest revision, the text a
+// reviewer decides on.
+type DraftWithRevision struct {
+	Draft
+	Latest DraftRevision
+}
+
+// ListDrafts returns an org's drafts with the given status, oldest first so
+// the review queue is worked in order. An empty status lists every draft and
+// an empty orgID every org.
+func (s *Store) ListDrafts(ctx context.Context, orgID string, status string, limit int) ([]DraftWithRevision, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+draftColumns+`,
+			r.revision, r.body, r.policy_id, r.policy_blocked, r.needs_human_approval, r.reason,
+			to_jsonb(r.risk_flags), to_jsonb(r.policy_rule_ids), r.created_at
+		FROM drafts d
+		JOIN draft_revisions r ON r.draft_id = d.id
+			AND r.revision = (SELECT max(revision) FROM draft_revisions WHERE draft_id = d.id)
+		WHERE ($1 = '' OR d.org_id = nullif($1, '')::uuid)
+			AND ($2 = '' OR d.status = $2)
+		ORDER BY d.updated_at ASC
+		LIMIT $3
+	`, orgID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drafts []DraftWithRevision
+	for rows.Next() {
+		var item DraftWithRevision
+		var riskFlagsJSON, ruleIDsJSON []byte
+		rev := &item.Latest
+		targets := append(draftScanTargets(&item.Draft),
+			&rev.Revision, &rev.Body, &rev.PolicyID, &rev.PolicyBlocked, &rev.NeedsApproval, &rev.Reason,
+			&riskFlagsJSON, &ruleIDsJSON, &rev.CreatedAt)
+		if err := rows.Scan(targets...); err != nil {
+			return nil, err
+		}
+		rev.DraftID = item.ID
+		if err := json.Unmarshal(riskFlagsJSON, &rev.RiskFlags); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(ruleIDsJSON, &rev.PolicyRuleIDs); err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, item)
+	}
+	return drafts, rows.Err()
+}
+
+// ReviewDraft records a reviewer's decision, approved or rejected, on a
+// draft's latest revision. A non-zero revision must still be the latest, so
+// a decision never lands on text the reviewer has not seen. It reports false
+// when the draft is not in the org, has been sent, or has moved past
+// revision.
+func (s *Store) ReviewDraft(ctx context.Context, orgID string, draftID string, status string, reviewer string, note string, revision int) (bool, error) {
+	if status != DraftApproved && status != DraftRejected {
+		return false, errors.New("review status must be approved or rejected")
+	}
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE drafts d
+		SET status = $3, reviewed_by = $4, reviewed_at = now(), review_note = $5, updated_at = now(),
+			approved_revision = CASE WHEN $3 = 'approved' THEN latest.revision END
+		FROM (SELECT max(revision) AS revision FROM draft_revisions WHERE draft_id = $1) latest
+		WHERE d.id = $1
+			AND ($2 = '' OR d.org_id = nullif($2, '')::uuid)
+			AND d.status <> 'sent'
+			AND ($6 = 0 OR latest.revision = $6)
+	`, draftID, orgID, status, reviewer, note, revision)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// MarkDraftSent moves an approved draft to sent. It reports false if the
+// draft was not approved, for example because a reviewer rejected it or a new
+// revision arrived in the meantime.
+func (s *Store) MarkDraftSent(ctx context.Context, draftID string, messageID string) (bool, error) {
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE drafts SET status = 'sent', sent_message_id = $2, updated_at = now()
+		WHERE id = $1 AND status = 'approved'
+	`, draftID, messageID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
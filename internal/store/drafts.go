@@ -0,0 +1,188 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+type Draft struct {
+	ID               string
+	OrgID            string
+	ThreadID         string
+	Goal             string
+	Status           string
+	ReviewedBy       string
+	ReviewedAt       sql.NullTime
+	ReviewNote       string
+	ApprovedRevision int
+	SentMessageID    string
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// DraftRevision is one version of a draft body together with the policy
+// outcome it got. OrgPolicyVersion is the version of the org's own policy
+// rules it was checked against, 0 when the org had none.
+type DraftRevision struct {
+	DraftID          string
+	Revision         int
+	Body             string
+	PolicyID         string
+	OrgPolicyVersion int
+	PolicyBlocked    bool
+	NeedsApproval    bool
+	Reason           string
+	RiskFlags        []string
+	PolicyRuleIDs    []string
+	CreatedAt        time.Time
+}
+
+// CreateDraft starts a draft for a thread with rev as revision 1. The draft
+// waits for review if rev needs approval and is approved otherwise.
+func (s *Store) CreateDraft(ctx context.Context, threadID string, goal string, rev DraftRevision) (string, error) {
+	var id string
+	status := DraftStatusFor(rev)
+	err := s.q.QueryRowContext(ctx, `
+		INSERT INTO drafts (org_id, thread_id, goal, status, approved_revision)
+		VALUES ((SELECT org_id FROM threads WHERE id = $1), $1, $2, $3, CASE WHEN $3 = 'approved' THEN 1 END)
+		RETURNING id
+	`, threadID, goal, status).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+	rev.DraftID = id
+	rev.Revision = 1
+	if err := s.insertDraftRevision(ctx, rev); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// AddDraftRevision appends rev to a draft and returns its revision number.
+// The drafts row is locked first so concurrent updates number in sequence.
+// Any earlier review is cleared, since it was about different text. Sent
+// drafts cannot be revised and return sql.ErrNoRows.
+func (s *Store) AddDraftRevision(ctx context.Context, draftID string, rev DraftRevision) (int, error) {
+	var next int
+	err := s.q.QueryRowContext(ctx, `
+		WITH locked AS (
+			UPDATE drafts SET updated_at = now() WHERE id = $1 AND status <> 'sent' RETURNING id
+		)
+		SELECT coalesce(max(r.revision), 0) + 1
+		FROM locked l
+		LEFT JOIN draft_revisions r ON r.draft_id = l.id
+		GROUP BY l.id
+	`, draftID).Scan(&next)
+	if err != nil {
+		return 0, err
+	}
+	rev.DraftID = draftID
+	rev.Revision = next
+	if err := s.insertDraftRevision(ctx, rev); err != nil {
+		return 0, err
+	}
+	_, err = s.q.ExecContext(ctx, `
+		UPDATE drafts
+		SET status = $2, approved_revision = CASE WHEN $2 = 'approved' THEN $3::integer END,
+			reviewed_by = '', reviewed_at = NULL, review_note = ''
+		WHERE id = $1
+	`, draftID, DraftStatusFor(rev), next)
+	return next, err
+}
+
+// DraftStatusFor is the status a draft gets when rev becomes its latest
+// revision.
+func DraftStatusFor(rev DraftRevision) string {
+	if rev.NeedsApproval || rev.PolicyBlocked {
+		return DraftPendingApproval
+	}
+	return DraftApproved
+}
+
+func (s *Store) insertDraftRevision(ctx context.Context, rev DraftRevision) error {
+	riskFlags, ruleIDs := rev.RiskFlags, rev.PolicyRuleIDs
+	if riskFlags == nil {
+		riskFlags = []string{}
+	}
+	if ruleIDs == nil {
+		ruleIDs = []string{}
+	}
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO draft_revisions (draft_id, revision, org_id, body, policy_id, org_policy_version, policy_blocked, needs_human_approval, reason, risk_flags, policy_rule_ids)
+		VALUES ($1, $2, (SELECT org_id FROM drafts WHERE id = $1), $3, $4, $5, $6, $7, $8, $9, $10)
+	`, rev.DraftID, rev.Revision, rev.Body, rev.PolicyID, rev.OrgPolicyVersion, rev.PolicyBlocked, rev.NeedsApproval, rev.Reason, riskFlags, ruleIDs)
+	return err
+}
+
+const draftColumns = `d.id, coalesce(d.org_id::text, ''), d.thread_id, d.goal, d.status, d.reviewed_by, d.reviewed_at,
+	d.review_note, coalesce(d.approved_revision, 0), coalesce(d.sent_message_id::text, ''), d.created_at, d.updated_at`
+
+func draftScanTargets(d *Draft) []any {
+	return []any{&d.ID, &d.OrgID, &d.ThreadID, &d.Goal, &d.Status, &d.ReviewedBy, &d.ReviewedAt,
+		&d.ReviewNote, &d.ApprovedRevision, &d.SentMessageID, &d.CreatedAt, &d.UpdatedAt}
+}
+
+// GetDraft returns sql.ErrNoRows for unknown drafts.
+func (s *Store) GetDraft(ctx context.Context, id string) (Draft, error) {
+	var d Draft
+	err := s.q.QueryRowContext(ctx, `SELECT `+draftColumns+` FROM drafts d WHERE d.id = $1`, id).Scan(draftScanTargets(&d)...)
+	return d, err
+}
+
+// SetDraftSourceChunkIDs records the knowledge base chunks a draft was
+// written from.
+func (s *Store) SetDraftSourceChunkIDs(ctx context.Context, draftID string, chunkIDs []string) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE drafts SET source_chunk_ids = coalesce($2::text[], '{}') WHERE id = $1
+	`, draftID, chunkIDs)
+	return err
+}
+
+// GetDraftSourceChunkIDs returns the knowledge base chunks a draft was
+// written from.
+func (s *Store) GetDraftSourceChunkIDs(ctx context.Context, draftID string) ([]string, error) {
+	var raw []byte
+	if err := s.q.QueryRowContext(ctx, `SELECT to_jsonb(source_chunk_ids) FROM drafts WHERE id = $1`, draftID).Scan(&raw); err != nil {
+		return nil, err
+	}
+	var ids []string
+	if err := json.Unmarshal(raw, &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// ListDraftRevisions returns a draft's revisions, oldest first.
+func (s *Store) ListDraftRevisions(ctx context.Context, draftID string) ([]DraftRevision, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT draft_id, revision, body, policy_id, org_policy_version, policy_blocked, needs_human_approval, reason,
+			to_jsonb(risk_flags), to_jsonb(policy_rule_ids), created_at
+		FROM draft_revisions
+		WHERE draft_id = $1
+		ORDER BY revision
+	`, draftID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []DraftRevision
+	for rows.Next() {
+		var rev DraftRevision
+		var riskFlagsJSON, ruleIDsJSON []byte
+		if err := rows.Scan(&rev.DraftID, &rev.Revision, &rev.Body, &rev.PolicyID, &rev.OrgPolicyVersion, &rev.PolicyBlocked, &rev.NeedsApproval, &rev.Reason,
+			&riskFlagsJSON, &ruleIDsJSON, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(riskFlagsJSON, &rev.RiskFlags); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(ruleIDsJSON, &rev.PolicyRuleIDs); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
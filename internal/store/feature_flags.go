@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type OrgFeatureFlag struct {
+	OrgID     string
+	Flag      string
+	Enabled   bool
+	UpdatedAt time.Time
+}
+
+// GetOrgFeatureFlag reports the stored value of flag for an org. found is
+// false when the org has no explicit setting.
+func (s *Store) GetOrgFeatureFlag(ctx context.Context, orgID string, flag string) (enabled bool, found bool, err error) {
+	row := s.q.QueryRowContext(ctx, `SELECT enabled FROM org_feature_flags WHERE org_id = $1 AND flag = $2`, orgID, flag)
+	if err := row.Scan(&enabled); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+	return enabled, true, nil
+}
+
+func (s *Store) SetOrgFeatureFlag(ctx context.Context, orgID string, flag string, enabled bool) (OrgFeatureFlag, error) {
+	var out OrgFeatureFlag
+	row := s.q.QueryRowContext(ctx, `
+		INSERT INTO org_feature_flags (org_id, flag, enabled)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (org_id, flag) DO UPDATE SET enabled = EXCLUDED.enabled, updated_at = now()
+		RETURNING org_id, flag, enabled, updated_at
+	`, orgID, flag, enabled)
+	err := row.Scan(&out.OrgID, &out.Flag, &out.Enabled, &out.UpdatedAt)
+	return out, err
+}
+
+func (s *Store) DeleteOrgFeatureFlag(ctx context.Context, orgID string, flag string) (bool, error) {
+	res, err := s.q.ExecContext(ctx, `DELETE FROM org_feature_flags WHERE org_id = $1 AND flag = $2`, orgID, flag)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *Store) ListOrgFeatureFlags(ctx context.Context, flag string) ([]OrgFeatureFlag, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT org_id, flag, enabled, updated_at
+		FROM org_feature_flags
+		WHERE flag = $1
+		ORDER BY updated_at DESC
+	`, flag)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []OrgFeatureFlag
+	for rows.Next() {
+		var f OrgFeatureFlag
+		if err := rows.Scan(&f.OrgID, &f.Flag, &f.Enabled, &f.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ftsConfigs maps ISO 639-1 codes to the text search configurations that
+// ship with Postgres. Configuration names themselves are accepted too.
+var ftsConfigs = map[string]string{
+	"ar": "arabic",
+	"ca": "catalan",
+	"da": "danish",
+	"de": "german",
+	"el": "greek",
+	"en": "english",
+	"es": "spanish",
+	"eu": "basque",
+	"fi": "finnish",
+	"fr": "french",
+	"ga": "irish",
+	"hi": "hindi",
+	"hu": "hungarian",
+	"hy": "armenian",
+	"id": "indonesian",
+	"it": "italian",
+	"lt": "lithuanian",
+	"nb": "norwegian",
+	"ne": "nepali",
+	"nl": "dutch",
+	"no": "norwegian",
+	"pt": "portuguese",
+	"ro": "romanian",
+	"ru": "russian",
+	"sr": "serbian",
+	"sv": "swedish",
+	"ta": "tamil",
+	"tr": "turkish",
+	"yi": "yiddish",
+}
+
+// FTSConfigForLanguage resolves a language name, ISO code or BCP 47 tag
+// ("pt-BR") to a Postgres text search configuration.
+func FTSConfigForLanguage(language string) (string, error) {
+	key := strings.ToLower(strings.TrimSpace(language))
+	if key == "" || key == "simple" {
+		return "simple", nil
+	}
+	if cfg, ok := ftsConfigs[key]; ok {
+		return cfg, nil
+	}
+	for _, cfg := range ftsConfigs {
+		if cfg == key {
+			return cfg, nil
+		}
+	}
+	if idx := strings.IndexAny(key, "-_"); idx > 0 {
+		if cfg, ok := ftsConfigs[key[:idx]]; ok {
+			return cfg, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported search language %q", language)
+}
+
+// inboxFTSConfigExpr is the SQL expression for an inbox's effective text
+// search configuration: the inbox override, else the org default.
+func inboxFTSConfigExpr(inboxParam string) string {
+	return `coalesce((SELECT coalesce(i.fts_config, o.fts_config)
+		FROM inboxes i LEFT JOIN orgs o ON o.id = i.org_id
+		WHERE i.id = ` + inboxParam + `), 'simple'::regconfig)`
+}
+
+type InboxSearchLanguage struct {
+	InboxID  string
+	Config   string
+	Override bool
+}
+
+func (s *Store) GetOrgFTSConfig(ctx context.Context, orgID string) (string, error) {
+	var cfg string
+	err := s.q.QueryRowContext(ctx, `SELECT fts_config::text FROM orgs WHERE id = $1`, orgID).Scan(&cfg)
+	return cfg, err
+}
+
+func (s *Store) SetOrgFTSConfig(ctx context.Context, orgID string, config string) error {
+	row := s.q.QueryRowContext(ctx, `
+		UPDATE orgs SET fts_config = $2::regconfig, updated_at = now()
+		WHERE id = $1
+		RETURNING id
+	`, orgID, config)
+	var id string
+	return row.Scan(&id)
+}
+
+// SetInboxFTSConfig sets an inbox override; an empty config clears it so the
+// inbox follows the org default again.
+func (s *Store) SetInboxFTSConfig(ctx context.Context, orgID string, inboxID string, config string) error {
+	row := s.q.QueryRowContext(ctx, `
+		UPDATE inboxes SET fts_config = nullif($3, '')::regconfig
+		WHERE id = $1 AND org_id = $2
+		RETURNING id
+	`, inboxID, orgID, config)
+	var id string
+	return row.Scan(&id)
+}
+
+func (s *Store) ListInboxFTSConfigs(ctx context.Context, orgID string) ([]InboxSearchLanguage, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT i.id, coalesce(i.fts_config, o.fts_config)::text, i.fts_config IS NOT NULL
+		FROM inboxes i
+		JOIN orgs o ON o.id = i.org_id
+		WHERE i.org_id = $1
+		ORDER BY i.created_at ASC
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []InboxSearchLanguage
+	for rows.Next() {
+		var item InboxSearchLanguage
+		if err := rows.Scan(&item.InboxID, &item.Config, &item.Override); err != nil {
+			return nil, err
+		}
+		out = append(out, item)
+	}
+	return out, rows.Err()
+}
+
+// ReindexInboxFTS brings messages whose stored configuration no longer matches
+// the inbox's effective one up to date, batchSize rows per statement so large
+// inboxes do not hold long row locks. Rewriting fts_config regenerates
+// search_tsv. It returns the number of messages reindexed.
+func (s *Store) ReindexInboxFTS(ctx context.Context, inboxID string, batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	var total int64
+	for {
+		res, err := s.q.ExecContext(ctx, `
+			WITH target AS (SELECT `+inboxFTSConfigExpr("$1")+` AS cfg)
+			UPDATE messages m SET fts_config = target.cfg
+			FROM target
+			WHERE m.id IN (
+				SELECT id FROM messages
+				WHERE inbox_id = $1 AND fts_config <> (SELECT cfg FROM target)
+				LIMIT $2
+			)
+		`, inboxID, batchSize)
+		if err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < int64(batchSize) {
+			return total, nil
+		}
+	}
+}
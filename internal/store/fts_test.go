@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFTSConfigForLanguage(t *testing.T) {
+	cases := map[string]string{
+		"":        "simple",
+		"en":      "english",
+		"German":  "german",
+		"pt-BR":   "portuguese",
+		"ru_RU":   "russian",
+		"simple":  "simple",
+		"swedish": "swedish",
+	}
+	for input, want := range cases {
+		got, err := FTSConfigForLanguage(input)
+		if err != nil {
+			t.Fatalf("FTSConfigForLanguage(%q): %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("FTSConfigForLanguage(%q) = %q, want %q", input, got, want)
+		}
+	}
+	if _, err := FTSConfigForLanguage("klingon"); err == nil {
+		t.Fatalf("expected unsupported language error")
+	}
+}
+
+func TestSearchInboxFTSFiltersByDirection(t *testing.T) {
+	withTempDatabase(t, func(ctx context.Context, db *sql.DB) {
+		migrateToLatest(t, ctx, db)
+		st, inboxID, threadID := seedBulkInbox(t, ctx, db)
+		start := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+		ids, err := st.InsertMessages(ctx, []Message{
+			{InboxID: inboxID, ThreadID: threadID, Direction: "inbound", ProviderMessageID: "m-1", CreatedAt: start, Text: "Where is my refund?"},
+			{InboxID: inboxID, ThreadID: threadID, Direction: "outbound", ProviderMessageID: "m-2", CreatedAt: start.Add(time.Hour), Text: "Your refund was issued today."},
+			{InboxID: inboxID, ThreadID: threadID, Direction: "inbound", ProviderMessageID: "m-3", CreatedAt: start.Add(2 * time.Hour), Text: "Thanks, got the refund."},
+			{InboxID: inboxID, ThreadID: threadID, Direction: "outbound", ProviderMessageID: "m-4", CreatedAt: start.Add(3 * time.Hour), Text: "Glad to help."},
+		})
+		if err != nil {
+			t.Fatalf("insert messages: %v", err)
+		}
+		cases := map[string][]string{
+			"":         {ids[0], ids[1], ids[2]},
+			"inbound":  {ids[0], ids[2]},
+			"outbound": {ids[1]},
+		}
+		for direction, want := range cases {
+			results, err := st.SearchInboxFTS(ctx, inboxID, "refund", 10, direction)
+			if err != nil {
+				t.Fatalf("search %q: %v", direction, err)
+			}
+			var got []string
+			for _, r := range results {
+				got = append(got, r.MessageID)
+			}
+			slices.Sort(got)
+			slices.Sort(want)
+			if !slices.Equal(got, want) {
+				t.Errorf("direction %q: got %v, want %v", direction, got, want)
+			}
+		}
+	})
+}
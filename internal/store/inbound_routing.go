@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Inbound routing rules, in the order they are tried, and the rule recorded
+// for mail no rule routes.
+const (
+	RouteExact    = "exact"
+	RouteAlias    = "alias"
+	RoutePlus     = "plus"
+	RouteCatchAll = "catch_all"
+	RouteDropped  = "dropped"
+)
+
+// DomainRouting is how an org domain routes mail for addresses that are no
+// inbox's or alias's: whether user+tag@ folds to user@, and the inbox that
+// catches everything else, if any.
+type DomainRouting struct {
+	DomainID        string
+	OrgID           string
+	Domain          string
+	Status          string
+	PlusAddressing  bool
+	CatchAllInboxID sql.NullString
+}
+
+// RoutingDecision records where inbound mail for one recipient went and the
+// rule that sent it there. MatchedAddress is the inbox or alias address the
+// recipient matched; InboxID is empty for dropped mail.
+type RoutingDecision struct {
+	ID             string
+	OrgID          string
+	Provider       string
+	MessageID      string
+	Recipient      string
+	Rule           string
+	InboxID        string
+	MatchedAddress string
+	CreatedAt      time.Time
+}
+
+const domainRoutingColumns = `id, org_id, domain, status, plus_addressing, catch_all_inbox_id`
+
+func scanDomainRouting(row interface{ Scan(...any) error }) (DomainRouting, error) {
+	var d DomainRouting
+	err := row.Scan(&d.DomainID, &d.OrgID, &d.Domain, &d.Status, &d.PlusAddressing, &d.CatchAllInboxID)
+	return d, err
+}
+
+// GetDomainRouting returns the routing of the active org domain domain.
+// Returns sql.ErrNoRows when no org has it active.
+func (s *Store) GetDomainRouting(ctx context.Context, domain string) (DomainRouting, error) {
+	return scanDomainRouting(s.q.QueryRowContext(ctx, `
+		SELECT `+domainRoutingColumns+`
+		FROM org_domains
+		WHERE lower(domain) = lower($1) AND status = 'active'
+		LIMIT 1
+	`, domain))
+}
+
+// GetDomainRoutingForOrg returns the routing of one of orgID's domains,
+// whatever its status.
+func (s *Store) GetDomainRoutingForOrg(ctx context.Context, orgID, domainID string) (DomainRouting, error) {
+	return scanDomainRouting(s.q.QueryRowContext(ctx, `
+		SELECT `+domainRoutingColumns+`
+		FROM org_domains
+		WHERE id = $1 AND org_id = $2
+	`, domainID, orgID))
+}
+
+// SetDomainRouting replaces the routing of one of orgID's domains. An empty
+// catchAllInboxID turns the catch-all off; callers check the inbox belongs
+// to the org. Returns sql.ErrNoRows if the domain is not orgID's.
+func (s *Store) SetDomainRouting(ctx context.Context, orgID, domainID string, plusAddressing bool, catchAllInboxID string) (DomainRouting, error) {
+	return scanDomainRouting(s.q.QueryRowContext(ctx, `
+		UPDATE org_domains
+		SET plus_addressing = $3, catch_all_inbox_id = $4, updated_at = now()
+		WHERE id = $1 AND org_id = $2
+		RETURNING `+domainRoutingColumns, domainID, orgID, plusAddressing, nullIfEmpty(catchAllInboxID)))
+}
+
+// RecordRoutingDecision stores d. The decision belongs to the org of the
+// inbox it routed to, or to d.OrgID for dropped mail on an org's domain;
+// mail for domains no org has is kept without one.
+func (s *Store) RecordRoutingDecision(ctx context.Context, d RoutingDecision) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO inbound_routing_decisions (org_id, provider, message_id, recipient, rule, inbox_id, matched_address)
+		VALUES (coalesce((SELECT org_id FROM inboxes WHERE id = $6), $1), $2, $3, $4, $5, $6, $7)
+	`, nullIfEmpty(d.OrgID), d.Provider, d.MessageID, strings.ToLower(d.Recipient), d.Rule, nullIfEmpty(d.InboxID), d.MatchedAddress)
+	return err
+}
+
+// ListRoutingDecisions returns orgID's most recent routing decisions, at
+// most limit, newest first. A non-empty recipient keeps only the decisions
+// for that address.
+func (s *Store) ListRoutingDecisions(ctx context.Context, orgID, recipient string, limit int) ([]RoutingDecision, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT id, org_id, provider, message_id, recipient, rule, coalesce(inbox_id::text, ''), matched_address, created_at
+		FROM inbound_routing_decisions
+		WHERE org_id = $1 AND ($2 = '' OR recipient = lower($2))
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, orgID, recipient, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []RoutingDecision
+	for rows.Next() {
+		var d RoutingDecision
+		if err := rows.Scan(&d.ID, &d.OrgID, &d.Provider, &d.MessageID, &d.Recipient, &d.Rule, &d.InboxID, &d.MatchedAddress, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// FoldPlusAddress strips the +tag from address's local part, so
+// user+tag@example.com becomes user@example.com. Addresses without a tag,
+// or with nothing before the +, come back unchanged.
+func FoldPlusAddress(address string) string {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return address
+	}
+	plus := strings.Index(address[:at], "+")
+	if plus <= 0 {
+		return address
+	}
+	return address[:plus] + address[at:]
+}
@@ -0,0 +1,29 @@
+package store
+
+import "context"
+
+// InboxEmbeddingDisabled reports whether an inbox opted out of embedding.
+// Returns sql.ErrNoRows for unknown inboxes.
+func (s *Store) InboxEmbeddingDisabled(ctx context.Context, inboxID string) (bool, error) {
+	var disabled bool
+	err := s.q.QueryRowContext(ctx, `SELECT embedding_disabled FROM inboxes WHERE id = $1`, inboxID).Scan(&disabled)
+	return disabled, err
+}
+
+// SetInboxEmbeddingDisabled toggles embedding for an inbox. An empty orgID
+// skips the org check for the self-hosted default inbox.
+func (s *Store) SetInboxEmbeddingDisabled(ctx context.Context, orgID string, inboxID string, disabled bool) (bool, error) {
+	result, err := s.q.ExecContext(ctx, `
+		UPDATE inboxes
+		SET embedding_disabled = $3
+		WHERE id = $1 AND ($2 = '' OR org_id::text = $2)
+	`, inboxID, orgID, disabled)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
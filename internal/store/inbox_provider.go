@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+)
+
+// Inbox sync providers accepted by the inboxes.provider column.
+const (
+	ProviderJMAP  = "jmap"
+	ProviderIMAP  = "imap"
+	ProviderGmail = "gmail"
+)
+
+func ValidInboxProvider(provider string) bool {
+	return provider == ProviderJMAP || provider == ProviderIMAP || provider == ProviderGmail
+}
+
+// GetInboxProvider returns the sync provider for an inbox, falling back to
+// JMAP for inboxes that predate the provider column.
+func (s *Store) GetInboxProvider(ctx context.Context, inboxID string) (string, error) {
+	var provider sql.NullString
+	row := s.q.QueryRowContext(ctx, `SELECT provider FROM inboxes WHERE id = $1`, inboxID)
+	if err := row.Scan(&provider); err != nil {
+		return "", err
+	}
+	if !provider.Valid || provider.String == "" {
+		return ProviderJMAP, nil
+	}
+	return provider.String, nil
+}
+
+// SetInboxProvider switches an inbox between sync providers. An empty orgID
+// skips the org check for the self-hosted default inbox.
+func (s *Store) SetInboxProvider(ctx context.Context, orgID string, inboxID string, provider string) (bool, error) {
+	if !ValidInboxProvider(provider) {
+		return false, errors.New("unsupported inbox provider")
+	}
+	result, err := s.q.ExecContext(ctx, `
+		UPDATE inboxes
+		SET provider = $3
+		WHERE id = $1 AND ($2 = '' OR org_id::text = $2)
+	`, inboxID, orgID, provider)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// ListActiveInboxIDsByProvider returns active inboxes synced by provider.
+func (s *Store) ListActiveInboxIDsByProvider(ctx context.Context, provider string) ([]string, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT id FROM inboxes
+		WHERE provider = $1 AND status = 'active'
+		ORDER BY created_at ASC
+	`, provider)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// UpdateIMAPCheckpoint records the IMAP sync position. last_state carries the
+// same position as "uidvalidity:uid" so the poll loop can treat every provider
+// uniformly.
+func (s *Store) UpdateIMAPCheckpoint(ctx context.Context, inboxID string, uidValidity uint32, lastUID uint32) error {
+	state := strconv.FormatUint(uint64(uidValidity), 10) + ":" + strconv.FormatUint(uint64(lastUID), 10)
+	_, err := s.q.ExecContext(ctx, `INSERT INTO inbox_checkpoints (inbox_id, provider, last_state, uid_validity, last_uid, updated_at)
+		VALUES ($1,$2,$3,$4,$5,now())
+		ON CONFLICT (inbox_id, provider) DO UPDATE SET last_state = EXCLUDED.last_state,
+			uid_validity = EXCLUDED.uid_validity, last_uid = EXCLUDED.last_uid, updated_at = now()`,
+		inboxID, ProviderIMAP, state, int64(uidValidity), int64(lastUID))
+	return err
+}
+
+// DeleteCheckpoint forgets an inbox's sync position for provider so the next
+// poll starts with an initial sync.
+func (s *Store) DeleteCheckpoint(ctx context.Context, inboxID string, provider string) error {
+	_, err := s.q.ExecContext(ctx, `DELETE FROM inbox_checkpoints WHERE inbox_id = $1 AND provider = $2`, inboxID, provider)
+	return err
+}
@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// InboxSyncStatus is where polling an inbox stands: its checkpoint with its
+// current provider, and how the last polls went.
+type InboxSyncStatus struct {
+	InboxID             string
+	Provider            string
+	Checkpoint          string
+	CheckpointUpdatedAt sql.NullTime
+	PolledBy            string
+	LastPollAt          sql.NullTime
+	LastSuccessAt       sql.NullTime
+	LastError           string
+	ConsecutiveFailures int
+}
+
+// GetInboxSyncStatus returns inboxID's sync status; the poll fields are
+// empty for an inbox that was never polled. Returns sql.ErrNoRows for an
+// unknown inbox.
+func (s *Store) GetInboxSyncStatus(ctx context.Context, inboxID string) (InboxSyncStatus, error) {
+	var st InboxSyncStatus
+	err := s.q.QueryRowContext(ctx, `
+		SELECT i.id, i.provider, coalesce(c.last_state, ''), c.updated_at,
+		       coalesce(ss.polled_by, ''), ss.last_poll_at, ss.last_success_at,
+		       coalesce(ss.last_error, ''), coalesce(ss.consecutive_failures, 0)
+		FROM inboxes i
+		LEFT JOIN inbox_checkpoints c ON c.inbox_id = i.id AND c.provider = i.provider
+		LEFT JOIN inbox_sync_status ss ON ss.inbox_id = i.id
+		WHERE i.id = $1
+	`, inboxID).Scan(&st.InboxID, &st.Provider, &st.Checkpoint, &st.CheckpointUpdatedAt,
+		&st.PolledBy, &st.LastPollAt, &st.LastSuccessAt, &st.LastError, &st.ConsecutiveFailures)
+	return st, err
+}
+
+// RecordInboxPoll records a poll of inboxID by holder; an empty pollErr is
+// a success and clears the failure count.
+func (s *Store) RecordInboxPoll(ctx context.Context, inboxID string, holder string, pollErr string) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO inbox_sync_status (inbox_id, org_id, polled_by, last_poll_at, last_success_at, last_error, consecutive_failures)
+		VALUES ($1, (SELECT org_id FROM inboxes WHERE id = $1), $2, now(),
+		        CASE WHEN $3 = '' THEN now() END, $3, CASE WHEN $3 = '' THEN 0 ELSE 1 END)
+		ON CONFLICT (inbox_id) DO UPDATE SET
+			polled_by = EXCLUDED.polled_by,
+			last_poll_at = EXCLUDED.last_poll_at,
+			last_success_at = coalesce(EXCLUDED.last_success_at, inbox_sync_status.last_success_at),
+			last_error = EXCLUDED.last_error,
+			consecutive_failures = CASE WHEN EXCLUDED.last_error = '' THEN 0 ELSE inbox_sync_status.consecutive_failures + 1 END
+	`, inboxID, holder, pollErr)
+	return err
+}
+
+// Backfill statuses.
+const (
+	BackfillPending = "pending"
+	BackfillRunning = "running"
+	BackfillDone    = "done"
+	BackfillFailed  = "failed"
+)
+
+// InboxBackfill is a request to ingest an inbox's mail received in
+// [Since, Until). Cursor is the provider's position within the range and
+// Fetched counts the messages read so far.
+type InboxBackfill struct {
+	ID          string
+	InboxID     string
+	Since       time.Time
+	Until       time.Time
+	Status      string
+	Cursor      string
+	Fetched     int64
+	Error       string
+	RequestedBy string
+	CreatedAt   time.Time
+	StartedAt   sql.NullTime
+	FinishedAt  sql.NullTime
+}
+
+const inboxBackfillColumns = `id, inbox_id, since, until, status, cursor, fetched, error, requested_by, created_at, started_at, finished_at`
+
+func scanInboxBackfill(row interface{ Scan(...any) error }) (InboxBackfill, error) {
+	var b InboxBackfill
+	err := row.Scan(&b.ID, &b.InboxID, &b.Since, &b.Until, &b.Status, &b.Cursor, &b.Fetched, &b.Error, &b.RequestedBy,
+		&b.CreatedAt, &b.StartedAt, &b.FinishedAt)
+	return b, err
+}
+
+// CreateInboxBackfill queues a backfill of inboxID's mail received in
+// [since, until) for the replica polling the inbox.
+func (s *Store) CreateInboxBackfill(ctx context.Context, inboxID string, since, until time.Time, requestedBy string) (InboxBackfill, error) {
+	row := s.q.QueryRowContext(ctx, `
+		INSERT INTO inbox_backfills (inbox_id, org_id, since, until, requested_by)
+		VALUES ($1, (SELECT org_id FROM inboxes WHERE id = $1), $2, $3, $4)
+		RETURNING `+inboxBackfillColumns, inboxID, since, until, requestedBy)
+	return scanInboxBackfill(row)
+}
+
+// ListInboxBackfills returns inboxID's latest backfills, newest first.
+func (s *Store) ListInboxBackfills(ctx context.Context, inboxID string, limit int) ([]InboxBackfill, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+inboxBackfillColumns+`
+		FROM inbox_backfills
+		WHERE inbox_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, inboxID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []InboxBackfill
+	for rows.Next() {
+		b, err := scanInboxBackfill(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// StartInboxBackfill marks inboxID's oldest unfinished backfill running and
+// returns it; one left running by a replica that stopped is resumed from its
+// cursor. Returns sql.ErrNoRows when there is none.
+func (s *Store) StartInboxBackfill(ctx context.Context, inboxID string) (InboxBackfill, error) {
+	row := s.q.QueryRowContext(ctx, `
+		UPDATE inbox_backfills
+		SET status = 'running', started_at = coalesce(started_at, now())
+		WHERE id = (
+			SELECT id FROM inbox_backfills
+			WHERE inbox_id = $1 AND status IN ('pending', 'running')
+			ORDER BY created_at
+			LIMIT 1
+		)
+		RETURNING `+inboxBackfillColumns, inboxID)
+	return scanInboxBackfill(row)
+}
+
+// AdvanceInboxBackfill records that a running backfill read fetched more
+// messages and continues from cursor.
+func (s *Store) AdvanceInboxBackfill(ctx context.Context, id string, cursor string, fetched int) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE inbox_backfills SET cursor = $2, fetched = fetched + $3 WHERE id = $1
+	`, id, cursor, fetched)
+	return err
+}
+
+// FinishInboxBackfill marks a backfill done, or failed with failure.
+func (s *Store) FinishInboxBackfill(ctx context.Context, id string, failure string) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE inbox_backfills
+		SET status = CASE WHEN $2 = '' THEN 'done' ELSE 'failed' END, error = $2, finished_at = now()
+		WHERE id = $1
+	`, id, failure)
+	return err
+}
@@ -14,17 +14,24 @@ type InboxRecord struct {
 	OrgDomainID sql.NullString
 	Address     string
 	Status      string
-	CreatedAt   time.Time
+	Provider    string
+	// Region is the residency region, inherited from the org; empty is the
+	// home deployment.
+	Region string
+	// EmbeddingDisabled keeps the inbox's mail away from the embedding
+	// provider; search uses full-text only.
+	EmbeddingDisabled bool
+	CreatedAt         time.Time
 }
 
 func (s *Store) GetInboxRecordByIDForOrg(ctx context.Context, orgID string, inboxID string) (InboxRecord, error) {
 	var rec InboxRecord
 	row := s.q.QueryRowContext(ctx, `
-		SELECT id, org_id, org_domain_id::text, address, status, created_at
+		SELECT id, org_id, org_domain_id::text, address, status, provider, coalesce(region, ''), embedding_disabled, created_at
 		FROM inboxes
 		WHERE id = $1 AND org_id = $2
 	`, inboxID, orgID)
-	if err := row.Scan(&rec.ID, &rec.OrgID, &rec.OrgDomainID, &rec.Address, &rec.Status, &rec.CreatedAt); err != nil {
+	if err := row.Scan(&rec.ID, &rec.OrgID, &rec.OrgDomainID, &rec.Address, &rec.Status, &rec.Provider, &rec.Region, &rec.EmbeddingDisabled, &rec.CreatedAt); err != nil {
 		return rec, err
 	}
 	return rec, nil
@@ -32,7 +39,7 @@ func (s *Store) GetInboxRecordByIDForOrg(ctx context.Context, orgID string, inbo
 
 func (s *Store) ListInboxRecordsByOrg(ctx context.Context, orgID string) ([]InboxRecord, error) {
 	rows, err := s.q.QueryContext(ctx, `
-		SELECT id, org_id, org_domain_id::text, address, status, created_at
+		SELECT id, org_id, org_domain_id::text, address, status, provider, coalesce(region, ''), embedding_disabled, created_at
 		FROM inboxes
 		WHERE org_id = $1
 		ORDER BY created_at DESC
@@ -45,7 +52,56 @@ func (s *Store) ListInboxRecordsByOrg(ctx context.Context, orgID string) ([]Inbo
 	var out []InboxRecord
 	for rows.Next() {
 		var rec InboxRecord
-		if err := rows.Scan(&rec.ID, &rec.OrgID, &rec.OrgDomainID, &rec.Address, &rec.Status, &rec.CreatedAt); err != nil {
+		if err := rows.Scan(&rec.ID, &rec.OrgID, &rec.OrgDomainID, &rec.Address, &rec.Status, &rec.Provider, &rec.Region, &rec.EmbeddingDisabled, &rec.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// ListInboxRecords returns every inbox regardless of org; it backs the
+// self-hosted control API.
+func (s *Store) ListInboxRecords(ctx context.Context) ([]InboxRecord, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT id, coalesce(org_id::text, ''), org_domain_id::text, address, status, provider, coalesce(region, ''), embedding_disabled, created_at
+		FROM inboxes
+		ORDER BY created_at ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []InboxRecord
+	for rows.Next() {
+		var rec InboxRecord
+		if err := rows.Scan(&rec.ID, &rec.OrgID, &rec.OrgDomainID, &rec.Address, &rec.Status, &rec.Provider, &rec.Region, &rec.EmbeddingDisabled, &rec.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// ListActiveInboxRecords returns every active inbox regardless of org, for
+// the serve loop to poll.
+func (s *Store) ListActiveInboxRecords(ctx context.Context) ([]InboxRecord, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT id, coalesce(org_id::text, ''), org_domain_id::text, address, status, provider, coalesce(region, ''), embedding_disabled, created_at
+		FROM inboxes
+		WHERE status = 'active'
+		ORDER BY created_at ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []InboxRecord
+	for rows.Next() {
+		var rec InboxRecord
+		if err := rows.Scan(&rec.ID, &rec.OrgID, &rec.OrgDomainID, &rec.Address, &rec.Status, &rec.Provider, &rec.Region, &rec.EmbeddingDisabled, &rec.CreatedAt); err != nil {
 			return nil, err
 		}
 		out = append(out, rec)
@@ -56,24 +112,28 @@ func (s *Store) ListInboxRecordsByOrg(ctx context.Context, orgID string) ([]Inbo
 func (s *Store) GetInboxByAddress(ctx context.Context, address string) (InboxRecord, error) {
 	var rec InboxRecord
 	row := s.q.QueryRowContext(ctx, `
-		SELECT id, org_id, org_domain_id::text, address, status, created_at
+		SELECT id, org_id, org_domain_id::text, address, status, provider, coalesce(region, ''), embedding_disabled, created_at
 		FROM inboxes
 		WHERE lower(address) = lower($1)
 		ORDER BY created_at DESC
 		LIMIT 1
 	`, address)
-	if err := row.Scan(&rec.ID, &rec.OrgID, &rec.OrgDomainID, &rec.Address, &rec.Status, &rec.CreatedAt); err != nil {
+	if err := row.Scan(&rec.ID, &rec.OrgID, &rec.OrgDomainID, &rec.Address, &rec.Status, &rec.Provider, &rec.Region, &rec.EmbeddingDisabled, &rec.CreatedAt); err != nil {
 		return rec, err
 	}
 	return rec, nil
 }
 
-func (s *Store) CreateInboxForOrg(ctx context.Context, orgID string, address string, orgDomainID string) (InboxRecord, error) {
+func (s *Store) CreateInboxForOrg(ctx context.Context, orgID string, address string, orgDomainID string, provider string) (InboxRecord, error) {
+	if provider == "" {
+		provider = ProviderJMAP
+	}
 	rec := InboxRecord{
-		ID:      uuid.NewString(),
-		OrgID:   orgID,
-		Address: address,
-		Status:  "active",
+		ID:       uuid.NewString(),
+		OrgID:    orgID,
+		Address:  address,
+		Status:   "active",
+		Provider: provider,
 	}
 
 	var domainRef any
@@ -85,11 +145,11 @@ func (s *Store) CreateInboxForOrg(ctx context.Context, orgID string, address str
 	}
 
 	row := s.q.QueryRowContext(ctx, `
-		INSERT INTO inboxes (id, org_id, org_domain_id, address, status)
-		VALUES ($1, $2, $3, $4, 'active')
-		RETURNING created_at
-	`, rec.ID, rec.OrgID, domainRef, rec.Address)
-	if err := row.Scan(&rec.CreatedAt); err != nil {
+		INSERT INTO inboxes (id, org_id, org_domain_id, address, status, provider, region)
+		VALUES ($1, $2, $3, $4, 'active', $5, (SELECT region FROM orgs WHERE id = $2))
+		RETURNING coalesce(region, ''), embedding_disabled, created_at
+	`, rec.ID, rec.OrgID, domainRef, rec.Address, rec.Provider)
+	if err := row.Scan(&rec.Region, &rec.EmbeddingDisabled, &rec.CreatedAt); err != nil {
 		return InboxRecord{}, err
 	}
 	return rec, nil
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// IngestFilter is an inbox's ingestion filter. Mail it matches is dropped
+// before it is stored or embedded and only counted; the zero value ingests
+// everything.
+type IngestFilter struct {
+	// SkipSenders are sender addresses, or domains that also match their
+	// subdomains.
+	SkipSenders []string
+	// SkipSubjects are RE2 patterns matched case-insensitively.
+	SkipSubjects []string
+	// SkipCalendarResponses drops accepted, declined and tentative replies
+	// to invitations.
+	SkipCalendarResponses bool
+	// MaxMessageBytes drops larger messages; 0 is no limit.
+	MaxMessageBytes int64
+	UpdatedAt       time.Time
+}
+
+// Reasons mail is skipped, one per kind of filter.
+const (
+	SkipReasonSender           = "sender"
+	SkipReasonSubject          = "subject"
+	SkipReasonCalendarResponse = "calendar_response"
+	SkipReasonSize             = "size"
+)
+
+// IngestSkipCount is how much of an inbox's mail one kind of filter dropped.
+type IngestSkipCount struct {
+	Reason        string
+	Skipped       int64
+	LastSkippedAt time.Time
+}
+
+// GetIngestFilter returns an inbox's filter, the zero value if it has none.
+func (s *Store) GetIngestFilter(ctx context.Context, inboxID string) (IngestFilter, error) {
+	var f IngestFilter
+	var sendersJSON, subjectsJSON []byte
+	err := s.q.QueryRowContext(ctx, `
+		SELECT to_jsonb(skip_senders), to_jsonb(skip_subjects), skip_calendar_responses, max_message_bytes, updated_at
+		FROM inbox_ingest_filters WHERE inbox_id = $1
+	`, inboxID).Scan(&sendersJSON, &subjectsJSON, &f.SkipCalendarResponses, &f.MaxMessageBytes, &f.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return IngestFilter{}, nil
+	}
+	if err != nil {
+		return f, err
+	}
+	_ = json.Unmarshal(sendersJSON, &f.SkipSenders)
+	_ = json.Unmarshal(subjectsJSON, &f.SkipSubjects)
+	return f, nil
+}
+
+// SetIngestFilter replaces an inbox's filter.
+func (s *Store) SetIngestFilter(ctx context.Context, inboxID string, f IngestFilter) (IngestFilter, error) {
+	if f.SkipSenders == nil {
+		f.SkipSenders = []string{}
+	}
+	if f.SkipSubjects == nil {
+		f.SkipSubjects = []string{}
+	}
+	err := s.q.QueryRowContext(ctx, `
+		INSERT INTO inbox_ingest_filters (inbox_id, org_id, skip_senders, skip_subjects, skip_calendar_responses, max_message_bytes)
+		VALUES ($1, (SELECT org_id FROM inboxes WHERE id = $1), $2, $3, $4, $5)
+		ON CONFLICT (inbox_id) DO UPDATE SET
+			skip_senders = EXCLUDED.skip_senders,
+			skip_subjects = EXCLUDED.skip_subjects,
+			skip_calendar_responses = EXCLUDED.skip_calendar_responses,
+			max_message_bytes = EXCLUDED.max_message_bytes,
+			updated_at = now()
+		RETURNING updated_at
+	`, inboxID, f.SkipSenders, f.SkipSubjects, f.SkipCalendarResponses, f.MaxMessageBytes).Scan(&f.UpdatedAt)
+	return f, err
+}
+
+// RecordIngestSkips adds skipped, counts by reason, to an inbox's totals.
+func (s *Store) RecordIngestSkips(ctx context.Context, inboxID string, skipped map[string]int) error {
+	for reason, n := range skipped {
+		if n <= 0 {
+			continue
+		}
+		if _, err := s.q.ExecContext(ctx, `
+			INSERT INTO inbox_ingest_skips (inbox_id, org_id, reason, skipped)
+			VALUES ($1, (SELECT org_id FROM inboxes WHERE id = $1), $2, $3)
+			ON CONFLICT (inbox_id, reason) DO UPDATE SET
+				skipped = inbox_ingest_skips.skipped + EXCLUDED.skipped,
+				last_skipped_at = now()
+		`, inboxID, reason, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListIngestSkips returns an inbox's skip totals by reason.
+func (s *Store) ListIngestSkips(ctx context.Context, inboxID string) ([]IngestSkipCount, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT reason, skipped, last_skipped_at FROM inbox_ingest_skips WHERE inbox_id = $1 ORDER BY reason
+	`, inboxID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []IngestSkipCount
+	for rows.Next() {
+		var c IngestSkipCount
+		if err := rows.Scan(&c.Reason, &c.Skipped, &c.LastSkippedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
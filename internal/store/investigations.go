@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// ToolUsage totals an org's usage events for one tool and meter.
+type ToolUsage struct {
+	ToolName  string
+	MeterName string
+	Calls     int64
+	Units     int64
+	Failed    int64
+	// Cached counts the calls answered from the model response cache.
+	Cached int64
+}
+
+// ListToolUsage totals an org's usage events in [from, to) by tool, busiest
+// first. Units only count successful calls, as billing does.
+func (s *Store) ListToolUsage(ctx context.Context, orgID string, from, to time.Time) ([]ToolUsage, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT tool_name, meter_name, count(*),
+		       coalesce(sum(quantity) FILTER (WHERE status = 'success'), 0),
+		       count(*) FILTER (WHERE status <> 'success'),
+		       count(*) FILTER (WHERE cached)
+		FROM usage_events
+		WHERE org_id = $1
+		  AND created_at >= $2
+		  AND created_at < $3
+		GROUP BY tool_name, meter_name
+		ORDER BY count(*) DESC, tool_name ASC
+	`, orgID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ToolUsage
+	for rows.Next() {
+		var item ToolUsage
+		if err := rows.Scan(&item.ToolName, &item.MeterName, &item.Calls, &item.Units, &item.Failed, &item.Cached); err != nil {
+			return nil, err
+		}
+		out = append(out, item)
+	}
+	return out, rows.Err()
+}
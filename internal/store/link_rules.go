@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type OrgLinkRule struct {
+	ID        string
+	OrgID     string
+	Domain    string
+	Action    string // "allow" or "deny"
+	CreatedAt time.Time
+}
+
+func (s *Store) ListOrgLinkRules(ctx context.Context, orgID string) ([]OrgLinkRule, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT id, org_id, domain, action, created_at
+		FROM org_link_rules
+		WHERE org_id = $1
+		ORDER BY domain ASC
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []OrgLinkRule
+	for rows.Next() {
+		var rule OrgLinkRule
+		if err := rows.Scan(&rule.ID, &rule.OrgID, &rule.Domain, &rule.Action, &rule.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, rule)
+	}
+	return out, rows.Err()
+}
+
+// UpsertOrgLinkRule records an allow or deny entry for a domain. Re-adding a
+// domain flips its action rather than creating a duplicate.
+func (s *Store) UpsertOrgLinkRule(ctx context.Context, orgID, domain, action string) (OrgLinkRule, error) {
+	var rule OrgLinkRule
+	row := s.q.QueryRowContext(ctx, `
+		INSERT INTO org_link_rules (id, org_id, domain, action)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (org_id, domain) DO UPDATE SET action = EXCLUDED.action
+		RETURNING id, org_id, domain, action, created_at
+	`, uuid.NewString(), orgID, strings.ToLower(domain), action)
+	err := row.Scan(&rule.ID, &rule.OrgID, &rule.Domain, &rule.Action, &rule.CreatedAt)
+	return rule, err
+}
+
+func (s *Store) DeleteOrgLinkRule(ctx context.Context, orgID, ruleID string) (bool, error) {
+	res, err := s.q.ExecContext(ctx, `DELETE FROM org_link_rules WHERE id = $1 AND org_id = $2`, ruleID, orgID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// LabelLoop marks a thread where automated mail is bouncing back and forth,
+// so a person looks at it before anything else is sent.
+const LabelLoop = "loop"
+
+// InboundRepeats counts a thread's inbound messages received shortly before
+// a message: Automated is those that look machine-sent, Identical those
+// from the same sender with the same text as it.
+type InboundRepeats struct {
+	Automated int
+	Identical int
+}
+
+// CountInboundRepeats counts the repeats of each of msgs, stored on their
+// threads, among what arrived within window before it.
+func (s *Store) CountInboundRepeats(ctx context.Context, msgs []Message, window time.Duration) ([]InboundRepeats, error) {
+	out := make([]InboundRepeats, len(msgs))
+	if len(msgs) == 0 {
+		return out, nil
+	}
+	threadIDs := make([]string, len(msgs))
+	senders := make([]string, len(msgs))
+	texts := make([]string, len(msgs))
+	since := make([]time.Time, len(msgs))
+	for i, msg := range msgs {
+		threadIDs[i], senders[i], texts[i], since[i] = msg.ThreadID, msg.From.Email, msg.Text, msg.CreatedAt.Add(-window)
+	}
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT i.n, r.automated, r.identical
+		FROM unnest($1::text[], $2::text[], $3::text[], $4::timestamptz[]) WITH ORDINALITY AS i(thread_id, sender, text, since, n)
+		CROSS JOIN LATERAL (
+			SELECT
+			  count(*) FILTER (WHERE auto_submitted <> '') AS automated,
+			  count(*) FILTER (WHERE lower(from_json->>'email') = lower(i.sender) AND coalesce(text, '') = i.text) AS identical
+			FROM messages
+			WHERE thread_id = i.thread_id::uuid AND direction = 'inbound' AND created_at >= i.since
+		) r
+	`, threadIDs, senders, texts, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var n int
+		var r InboundRepeats
+		if err := rows.Scan(&n, &r.Automated, &r.Identical); err != nil {
+			return nil, err
+		}
+		out[n-1] = r
+	}
+	return out, rows.Err()
+}
+
+// RecordSuppressedAutoReply counts a reply refused because the thread is
+// looping or its last message was automated.
+func (s *Store) RecordSuppressedAutoReply(ctx context.Context, threadID string) error {
+	_, err := s.q.ExecContext(ctx, `UPDATE threads SET suppressed_auto_replies = suppressed_auto_replies + 1 WHERE id = $1`, threadID)
+	return err
+}
+
+// MailLoopStats are the loop-prevention counters: automated inbound
+// messages received since a cutoff, threads flagged as looping, and replies
+// suppressed in all.
+type MailLoopStats struct {
+	AutomatedInbound  int64
+	LoopingThreads    int64
+	SuppressedReplies int64
+}
+
+func (s *Store) GetMailLoopStats(ctx context.Context, since time.Time) (MailLoopStats, error) {
+	var stats MailLoopStats
+	err := s.q.QueryRowContext(ctx, `
+		SELECT
+		  (SELECT count(*) FROM messages WHERE direction = 'inbound' AND auto_submitted <> '' AND created_at >= $1),
+		  (SELECT count(*) FROM threads WHERE labels @> ARRAY[$2]::text[]),
+		  (SELECT coalesce(sum(suppressed_auto_replies), 0) FROM threads)
+	`, since, LabelLoop).Scan(&stats.AutomatedInbound, &stats.LoopingThreads, &stats.SuppressedReplies)
+	return stats, err
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Reasons recorded in mcp_sessions.termination_reason.
+const (
+	SessionEndClientClosed = "client_closed"
+	SessionEndExpired      = "expired"
+	SessionEndAdmin        = "admin_terminated"
+)
+
+type MCPSession struct {
+	ID                string
+	OrgID             string
+	ActorID           string
+	TokenID           string
+	AuthMethod        string
+	ClientName        string
+	ClientVersion     string
+	ProtocolVersion   string
+	RemoteAddr        string
+	CreatedAt         time.Time
+	LastActivityAt    time.Time
+	ExpiresAt         time.Time
+	TerminatedAt      sql.NullTime
+	TerminationReason string
+	TerminatedBy      string
+}
+
+const mcpSessionColumns = `id, coalesce(org_id::text, ''), actor_id, token_id, auth_method, client_name, client_version,
+	protocol_version, remote_addr, created_at, last_activity_at, expires_at, terminated_at,
+	coalesce(termination_reason, ''), coalesce(terminated_by, '')`
+
+func scanMCPSession(row interface{ Scan(...any) error }) (MCPSession, error) {
+	var sess MCPSession
+	err := row.Scan(&sess.ID, &sess.OrgID, &sess.ActorID, &sess.TokenID, &sess.AuthMethod, &sess.ClientName, &sess.ClientVersion,
+		&sess.ProtocolVersion, &sess.RemoteAddr, &sess.CreatedAt, &sess.LastActivityAt, &sess.ExpiresAt, &sess.TerminatedAt,
+		&sess.TerminationReason, &sess.TerminatedBy)
+	return sess, err
+}
+
+// UpsertMCPSession records an initialize. Re-initializing an existing session
+// refreshes its client details and expiry but keeps its history.
+func (s *Store) UpsertMCPSession(ctx context.Context, sess MCPSession) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO mcp_sessions (id, org_id, actor_id, token_id, auth_method, client_name, client_version, protocol_version, remote_addr, expires_at)
+		VALUES ($1, nullif($2, '')::uuid, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (id) DO UPDATE
+		SET client_name = EXCLUDED.client_name,
+		    client_version = EXCLUDED.client_version,
+		    protocol_version = EXCLUDED.protocol_version,
+		    remote_addr = EXCLUDED.remote_addr,
+		    expires_at = EXCLUDED.expires_at,
+		    last_activity_at = now()
+	`, sess.ID, sess.OrgID, sess.ActorID, sess.TokenID, sess.AuthMethod, sess.ClientName, sess.ClientVersion, sess.ProtocolVersion, sess.RemoteAddr, sess.ExpiresAt)
+	return err
+}
+
+// TouchMCPSession bumps last_activity_at on a live session and slides its
+// expiry to expiresAt, then returns the row either way so callers can see a
+// termination. Sessions already past expires_at are not revived. Returns
+// sql.ErrNoRows for unknown sessions.
+func (s *Store) TouchMCPSession(ctx context.Context, id string, expiresAt time.Time) (MCPSession, error) {
+	row := s.q.QueryRowContext(ctx, `
+		UPDATE mcp_sessions
+		SET last_activity_at = CASE WHEN terminated_at IS NULL THEN now() ELSE last_activity_at END,
+		    expires_at = CASE WHEN terminated_at IS NULL AND expires_at > now() THEN $2 ELSE expires_at END
+		WHERE id = $1
+		RETURNING `+mcpSessionColumns, id, expiresAt)
+	return scanMCPSession(row)
+}
+
+// EndMCPSession terminates a live session. An empty orgID skips the org check
+// for the MCP server itself; already-ended sessions report false.
+func (s *Store) EndMCPSession(ctx context.Context, orgID string, id string, reason string, by string) (bool, error) {
+	result, err := s.q.ExecContext(ctx, `
+		UPDATE mcp_sessions
+		SET terminated_at = now(), termination_reason = $3, terminated_by = nullif($4, '')
+		WHERE id = $1 AND terminated_at IS NULL AND ($2 = '' OR org_id::text = $2)
+	`, id, orgID, reason, by)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+func (s *Store) GetMCPSessionForOrg(ctx context.Context, orgID string, id string) (MCPSession, error) {
+	row := s.q.QueryRowContext(ctx, `SELECT `+mcpSessionColumns+` FROM mcp_sessions WHERE id = $1 AND org_id::text = $2`, id, orgID)
+	return scanMCPSession(row)
+}
+
+// ListMCPSessionsByOrg returns an org's sessions, newest first. Unless
+// includeEnded is set, terminated and expired sessions are left out.
+func (s *Store) ListMCPSessionsByOrg(ctx context.Context, orgID string, includeEnded bool, limit int) ([]MCPSession, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+mcpSessionColumns+`
+		FROM mcp_sessions
+		WHERE org_id = $1 AND ($2 OR (terminated_at IS NULL AND expires_at > now()))
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, orgID, includeEnded, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []MCPSession
+	for rows.Next() {
+		sess, err := scanMCPSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sess)
+	}
+	return out, rows.Err()
+}
@@ -8,8 +8,37 @@ import (
 	"github.com/pressly/goose/v3"
 )
 
+// migrationsDir is where the migrations live, relative to the repository
+// root the binaries run from.
+var migrationsDir = filepath.Join("internal", "store", "migrations")
+
 func Migrate(ctx context.Context, db *sql.DB) error {
 	goose.SetDialect("postgres")
 	goose.SetTableName("schema_migrations")
-	return goose.UpContext(ctx, db, filepath.Join("internal", "store", "migrations"))
+	return goose.UpContext(ctx, db, migrationsDir)
+}
+
+// MigrationVersions returns the schema version db has been migrated to, 0
+// for a database never migrated, and the newest migration on disk. It does
+// not change the database.
+func MigrationVersions(ctx context.Context, db *sql.DB) (current int64, latest int64, err error) {
+	goose.SetDialect("postgres")
+	goose.SetTableName("schema_migrations")
+	migrations, err := goose.CollectMigrations(migrationsDir, 0, goose.MaxVersion)
+	if err != nil {
+		return 0, 0, err
+	}
+	if last, err := migrations.Last(); err == nil {
+		latest = last.Version
+	}
+
+	var exists bool
+	if err := db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return 0, latest, err
+	}
+	if !exists {
+		return 0, latest, nil
+	}
+	current, err = goose.GetDBVersionContext(ctx, db)
+	return current, latest, err
 }
@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
@@ -35,6 +36,94 @@ func TestCloudControlPlaneMigrationFromEmptyDatabase(t *testing.T) {
 		assertColumnNotNull(t, db, "threads", "org_id")
 		assertColumnNotNull(t, db, "messages", "org_id")
 		assertColumnExists(t, db, "orgs", "mcp_endpoint")
+		assertColumnExists(t, db, "orgs", "fts_config")
+		assertColumnExists(t, db, "messages", "search_tsv")
+		assertColumnNotNull(t, db, "inboxes", "provider")
+		assertColumnExists(t, db, "inbox_checkpoints", "uid_validity")
+		assertTableExists(t, db, "inbox_oauth_tokens")
+		assertTableExists(t, db, "oauth_connect_states")
+		assertColumnExists(t, db, "orgs", "region")
+		assertColumnExists(t, db, "inboxes", "region")
+		assertTableExists(t, db, "mcp_sessions")
+		assertColumnNotNull(t, db, "audit_log", "policy_rule_ids")
+		assertColumnNotNull(t, db, "inboxes", "embedding_disabled")
+		assertTableExists(t, db, "drafts")
+		assertTableExists(t, db, "draft_revisions")
+		assertColumnNotNull(t, db, "drafts", "status")
+		assertColumnExists(t, db, "drafts", "approved_revision")
+		assertTableExists(t, db, "inbox_aliases")
+		assertColumnNotNull(t, db, "messages", "alias_address")
+		assertColumnExists(t, db, "audit_log", "citation_coverage")
+		assertTableExists(t, db, "outbox")
+		assertColumnNotNull(t, db, "orgs", "search_rerank")
+		assertColumnNotNull(t, db, "outbox", "internet_message_id")
+		assertTableExists(t, db, "suppressions")
+		assertColumnNotNull(t, db, "messages", "auto_submitted")
+		assertColumnNotNull(t, db, "threads", "suppressed_auto_replies")
+		assertColumnNotNull(t, db, "messages", "raw_text")
+		assertTableExists(t, db, "org_branding")
+		assertColumnNotNull(t, db, "messages", "reference_ids")
+		assertColumnNotNull(t, db, "threads", "normalized_subject")
+		assertColumnNotNull(t, db, "inboxes", "auto_close_after_days")
+		assertTableExists(t, db, "thread_closures")
+		assertColumnNotNull(t, db, "plan_entitlements", "tool_weights")
+		assertColumnNotNull(t, db, "usage_events", "weight")
+		assertTableExists(t, db, "notification_preferences")
+		assertTableExists(t, db, "message_summaries")
+		assertColumnNotNull(t, db, "orgs", "llm_routes")
+		assertColumnNotNull(t, db, "tool_calls", "model_fallbacks")
+		assertTableExists(t, db, "billing_usage_reports")
+		assertColumnNotNull(t, db, "plan_entitlements", "stripe_lookup_key")
+		assertTableExists(t, db, "plan_addons")
+		assertTableExists(t, db, "org_addons")
+		assertColumnNotNull(t, db, "webhook_endpoints", "api_version")
+		assertColumnExists(t, db, "org_entitlements", "trial_ends_at")
+		assertColumnExists(t, db, "threads", "awaiting_reply")
+		assertTableExists(t, db, "inbox_ingest_filters")
+		assertTableExists(t, db, "inbox_ingest_skips")
+		assertColumnExists(t, db, "cloud_api_keys", "rotated_from_id")
+		assertColumnExists(t, db, "orgs", "sandbox")
+		assertColumnExists(t, db, "messages", "raw_object_key")
+		assertColumnExists(t, db, "cloud_api_keys", "inbox_ids")
+		assertColumnExists(t, db, "service_tokens", "inbox_ids")
+		assertColumnExists(t, db, "audit_log", "org_id")
+		assertColumnExists(t, db, "audit_log", "inbox_id")
+		assertColumnExists(t, db, "plan_entitlements", "audit_retention_days")
+		assertColumnExists(t, db, "orgs", "merged_into")
+		assertColumnExists(t, db, "org_merges", "report")
+		assertColumnExists(t, db, "audit_log", "inputs")
+		assertColumnExists(t, db, "audit_log", "redacted_at")
+		assertColumnExists(t, db, "plan_entitlements", "token_rpm")
+		assertColumnExists(t, db, "plan_entitlements", "ip_rpm")
+		assertColumnExists(t, db, "embedding_reindexes", "cursor_id")
+		assertColumnExists(t, db, "reconciliation_reports", "vector_orphans")
+		assertColumnExists(t, db, "prompt_templates", "activated_at")
+		assertColumnExists(t, db, "usage_events", "cached")
+		assertTableExists(t, db, "inbox_poll_leases")
+		assertTableExists(t, db, "inbox_sync_status")
+		assertColumnExists(t, db, "inbox_backfills", "cursor")
+		assertColumnExists(t, db, "org_domain_dkim_keys", "retire_at")
+		assertColumnExists(t, db, "org_domains", "catch_all_inbox_id")
+		assertTableExists(t, db, "inbound_routing_decisions")
+		assertColumnExists(t, db, "outbox", "provider_message_id")
+		assertColumnExists(t, db, "orgs", "outbound_transport")
+		assertColumnExists(t, db, "orgs", "send_limit_hourly_messages")
+		assertColumnExists(t, db, "org_domains", "warmup_started_at")
+		assertColumnExists(t, db, "tool_calls", "prompt_tokens")
+		assertColumnExists(t, db, "tool_calls", "completion_tokens")
+		assertColumnExists(t, db, "threads", "summary")
+		assertColumnExists(t, db, "threads", "summary_message_id")
+		assertColumnExists(t, db, "automation_rules", "conditions")
+		assertColumnExists(t, db, "automation_rule_runs", "dry_run")
+		assertColumnExists(t, db, "contacts", "emails")
+		assertColumnExists(t, db, "contact_threads", "last_seen_at")
+		assertColumnExists(t, db, "crm_connections", "support_intents")
+		assertColumnExists(t, db, "crm_links", "ticket_id")
+		assertColumnExists(t, db, "drafts", "source_chunk_ids")
+		assertColumnExists(t, db, "org_policy_versions", "rules")
+		assertColumnExists(t, db, "draft_revisions", "org_policy_version")
+		assertColumnExists(t, db, "messages", "pii_classes")
+		assertColumnExists(t, db, "org_deletions", "purge_after")
 	})
 }
 
@@ -455,6 +544,390 @@ func TestOrgDomainsStoreCreateAndGet(t *testing.T) {
 	})
 }
 
+func TestThreadAwaitingReplyFollowsNewestMessage(t *testing.T) {
+	withTempDatabase(t, func(ctx context.Context, db *sql.DB) {
+		migrateToLatest(t, ctx, db)
+
+		orgID := uuid.NewString()
+		if _, err := db.ExecContext(ctx, `INSERT INTO orgs (id, name) VALUES ($1, 'acme')`, orgID); err != nil {
+			t.Fatalf("insert org: %v", err)
+		}
+		st := &Store{db: db, q: db}
+		inbox, err := st.CreateInboxForOrg(ctx, orgID, "support@acme.test", "", ProviderJMAP)
+		if err != nil {
+			t.Fatalf("create inbox: %v", err)
+		}
+		customer := Participant{Email: "customer@example.com"}
+		threadID, err := st.EnsureThread(ctx, inbox.ID, "thread-1", "Refund", []Participant{customer})
+		if err != nil {
+			t.Fatalf("create thread: %v", err)
+		}
+		start := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+		insert := func(direction, autoSubmitted string, at time.Time) {
+			t.Helper()
+			if _, err := st.InsertMessage(ctx, Message{
+				InboxID: inbox.ID, ThreadID: threadID, Direction: direction, CreatedAt: at,
+				AutoSubmitted: autoSubmitted, From: customer,
+			}); err != nil {
+				t.Fatalf("insert message: %v", err)
+			}
+		}
+		awaiting := func(want string) {
+			t.Helper()
+			threads, err := st.ListThreads(ctx, inbox.ID, "", want, "", 10)
+			if err != nil {
+				t.Fatalf("list threads: %v", err)
+			}
+			if len(threads) != 1 || threads[0].AwaitingReply != want {
+				t.Fatalf("expected the thread to await %q, got %+v", want, threads)
+			}
+		}
+
+		insert("inbound", "", start)
+		awaiting(AwaitingUs)
+		insert("outbound", "", start.Add(time.Hour))
+		awaiting(AwaitingCustomer)
+		// An out-of-office reply and mail synced late leave it unchanged.
+		insert("inbound", "auto-replied", start.Add(2*time.Hour))
+		insert("inbound", "", start.Add(30*time.Minute))
+		awaiting(AwaitingCustomer)
+		insert("inbound", "", start.Add(3*time.Hour))
+		awaiting(AwaitingUs)
+
+		if threads, err := st.ListThreads(ctx, inbox.ID, "", AwaitingCustomer, "", 10); err != nil || len(threads) != 0 {
+			t.Fatalf("expected no thread awaiting the customer, got %v %v", threads, err)
+		}
+	})
+}
+
+func TestPollLeaseTakeoverAfterExpiry(t *testing.T) {
+	withTempDatabase(t, func(ctx context.Context, db *sql.DB) {
+		migrateToLatest(t, ctx, db)
+
+		orgID := uuid.NewString()
+		if _, err := db.ExecContext(ctx, `INSERT INTO orgs (id, name) VALUES ($1, 'acme')`, orgID); err != nil {
+			t.Fatalf("insert org: %v", err)
+		}
+		st := &Store{db: db, q: db}
+		inbox, err := st.CreateInboxForOrg(ctx, orgID, "support@acme.test", "", ProviderJMAP)
+		if err != nil {
+			t.Fatalf("create inbox: %v", err)
+		}
+
+		if ok, prev, err := st.AcquirePollLease(ctx, inbox.ID, "replica-a", time.Minute); err != nil || !ok || prev != "" {
+			t.Fatalf("expected replica-a to take the free lease, got %v %q %v", ok, prev, err)
+		}
+		if ok, _, err := st.AcquirePollLease(ctx, inbox.ID, "replica-b", time.Minute); err != nil || ok {
+			t.Fatalf("expected replica-b to be refused a live lease, got %v %v", ok, err)
+		}
+		if ok, prev, err := st.AcquirePollLease(ctx, inbox.ID, "replica-a", time.Minute); err != nil || !ok || prev != "replica-a" {
+			t.Fatalf("expected replica-a to renew its lease, got %v %q %v", ok, prev, err)
+		}
+
+		// replica-a stops renewing.
+		if _, err := db.ExecContext(ctx, `UPDATE inbox_poll_leases SET expires_at = now() - interval '1 second'`); err != nil {
+			t.Fatalf("expire lease: %v", err)
+		}
+		if ok, prev, err := st.AcquirePollLease(ctx, inbox.ID, "replica-b", time.Minute); err != nil || !ok || prev != "replica-a" {
+			t.Fatalf("expected replica-b to take over from replica-a, got %v %q %v", ok, prev, err)
+		}
+		if n, err := st.ReleasePollLeases(ctx, "replica-a"); err != nil || n != 0 {
+			t.Fatalf("expected replica-a to hold nothing, released %d %v", n, err)
+		}
+		leases, err := st.ListPollLeases(ctx)
+		if err != nil || len(leases) != 1 || leases[0].Holder != "replica-b" {
+			t.Fatalf("expected replica-b's lease, got %+v %v", leases, err)
+		}
+		if n, err := st.ReleasePollLeases(ctx, "replica-b"); err != nil || n != 1 {
+			t.Fatalf("expected replica-b to release one lease, released %d %v", n, err)
+		}
+	})
+}
+
+func TestDKIMKeyRotation(t *testing.T) {
+	withTempDatabase(t, func(ctx context.Context, db *sql.DB) {
+		migrateToLatest(t, ctx, db)
+
+		orgID := uuid.NewString()
+		if _, err := db.ExecContext(ctx, `INSERT INTO orgs (id, name) VALUES ($1, 'acme')`, orgID); err != nil {
+			t.Fatalf("insert org: %v", err)
+		}
+		st := &Store{db: db, q: db}
+		domainID, err := st.CreateOrgDomain(ctx, orgID, "acme.test", "tok", "nerve", "", "", "txt")
+		if err != nil {
+			t.Fatalf("create domain: %v", err)
+		}
+		if err := st.UpdateOrgDomainStatus(ctx, domainID, "active"); err != nil {
+			t.Fatalf("activate domain: %v", err)
+		}
+
+		if _, err := st.RotateDKIMKey(ctx, domainID, "nerve2", "enc2", "pub2", time.Hour); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected rotating a domain without a key to fail, got %v", err)
+		}
+		first, err := st.CreateDKIMKey(ctx, domainID, "nerve", "enc1", "pub1")
+		if err != nil || first.Status != DKIMKeyActive {
+			t.Fatalf("expected an active first key, got %+v %v", first, err)
+		}
+		if _, err := st.CreateDKIMKey(ctx, domainID, "nerve", "enc1", "pub1"); !errors.Is(err, ErrDKIMKeyExists) {
+			t.Fatalf("expected a second first key to be refused, got %v", err)
+		}
+		next, err := st.RotateDKIMKey(ctx, domainID, "nerve2", "enc2", "pub2", time.Hour)
+		if err != nil || next.Status != DKIMKeyPending || next.Overlap != time.Hour {
+			t.Fatalf("expected a pending key, got %+v %v", next, err)
+		}
+		if _, err := st.RotateDKIMKey(ctx, domainID, "nerve3", "enc3", "pub3", time.Hour); !errors.Is(err, ErrDKIMRotationPending) {
+			t.Fatalf("expected a second rotation to wait, got %v", err)
+		}
+		// The send path keeps the first key until the new one is activated.
+		if d, err := st.GetOrgDomainForSending(ctx, "acme.test"); err != nil || d.DKIMSelector != "nerve" || d.DKIMPrivateKeyEnc.String != "enc1" {
+			t.Fatalf("expected the first key to sign, got %+v %v", d, err)
+		}
+
+		if ok, err := st.ActivateDKIMKey(ctx, next.ID); err != nil || !ok {
+			t.Fatalf("activate: %v %v", ok, err)
+		}
+		if d, err := st.GetOrgDomainForSending(ctx, "acme.test"); err != nil || d.DKIMSelector != "nerve2" || d.DKIMPrivateKeyEnc.String != "enc2" {
+			t.Fatalf("expected the rotated key to sign, got %+v %v", d, err)
+		}
+		keys, err := st.ListDKIMKeys(ctx, domainID)
+		if err != nil || len(keys) != 2 || keys[0].Status != DKIMKeyActive || keys[1].Status != DKIMKeyRetiring || !keys[1].RetireAt.Valid {
+			t.Fatalf("expected the first key to be retiring, got %+v %v", keys, err)
+		}
+		if n, err := st.RetireDKIMKeys(ctx); err != nil || n != 0 {
+			t.Fatalf("expected the overlap to keep the first key, retired %d %v", n, err)
+		}
+		if _, err := db.ExecContext(ctx, `UPDATE org_domain_dkim_keys SET retire_at = now() - interval '1 second' WHERE id = $1`, first.ID); err != nil {
+			t.Fatalf("end overlap: %v", err)
+		}
+		if n, err := st.RetireDKIMKeys(ctx); err != nil || n != 1 {
+			t.Fatalf("expected the first key to retire, retired %d %v", n, err)
+		}
+	})
+}
+
+func TestInboundRoutingDecisions(t *testing.T) {
+	withTempDatabase(t, func(ctx context.Context, db *sql.DB) {
+		migrateToLatest(t, ctx, db)
+
+		orgID, inboxID := uuid.NewString(), uuid.NewString()
+		if _, err := db.ExecContext(ctx, `INSERT INTO orgs (id, name) VALUES ($1, 'acme')`, orgID); err != nil {
+			t.Fatalf("insert org: %v", err)
+		}
+		if _, err := db.ExecContext(ctx, `INSERT INTO inboxes (id, org_id, address, status) VALUES ($1, $2, 'support@acme.test', 'active')`, inboxID, orgID); err != nil {
+			t.Fatalf("insert inbox: %v", err)
+		}
+		st := &Store{db: db, q: db}
+		domainID, err := st.CreateOrgDomain(ctx, orgID, "acme.test", "tok", "nerve", "", "", "txt")
+		if err != nil {
+			t.Fatalf("create domain: %v", err)
+		}
+		if _, err := st.GetDomainRouting(ctx, "acme.test"); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected a pending domain not to route, got %v", err)
+		}
+		routing, err := st.SetDomainRouting(ctx, orgID, domainID, false, inboxID)
+		if err != nil || routing.PlusAddressing || routing.CatchAllInboxID.String != inboxID {
+			t.Fatalf("set routing: %+v %v", routing, err)
+		}
+		if _, err := st.SetDomainRouting(ctx, uuid.NewString(), domainID, true, ""); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected another org's update to miss, got %v", err)
+		}
+		if err := st.UpdateOrgDomainStatus(ctx, domainID, "active"); err != nil {
+			t.Fatalf("activate domain: %v", err)
+		}
+		if got, err := st.GetDomainRouting(ctx, "ACME.test"); err != nil || got.DomainID != domainID || got.OrgID != orgID {
+			t.Fatalf("expected the active domain's routing, got %+v %v", got, err)
+		}
+
+		for _, d := range []RoutingDecision{
+			{Provider: "ses", MessageID: "m1", Recipient: "Nobody@acme.test", Rule: RouteCatchAll, InboxID: inboxID},
+			{Provider: "ses", MessageID: "m2", Recipient: "ops+x@acme.test", Rule: RouteDropped, OrgID: orgID},
+			{Provider: "ses", MessageID: "m3", Recipient: "someone@elsewhere.test", Rule: RouteDropped},
+		} {
+			if err := st.RecordRoutingDecision(ctx, d); err != nil {
+				t.Fatalf("record %s: %v", d.MessageID, err)
+			}
+		}
+		decisions, err := st.ListRoutingDecisions(ctx, orgID, "", 10)
+		if err != nil || len(decisions) != 2 {
+			t.Fatalf("expected the org's two decisions, got %+v %v", decisions, err)
+		}
+		decisions, err = st.ListRoutingDecisions(ctx, orgID, "nobody@ACME.test", 10)
+		if err != nil || len(decisions) != 1 || decisions[0].InboxID != inboxID || decisions[0].Rule != RouteCatchAll {
+			t.Fatalf("expected the catch-all decision, got %+v %v", decisions, err)
+		}
+	})
+}
+
+func TestOutboxProviderDeliveryTracking(t *testing.T) {
+	withTempDatabase(t, func(ctx context.Context, db *sql.DB) {
+		migrateToLatest(t, ctx, db)
+
+		orgID, inboxID, threadID, messageID := uuid.NewString(), uuid.NewString(), uuid.NewString(), uuid.NewString()
+		if _, err := db.ExecContext(ctx, `INSERT INTO orgs (id, name) VALUES ($1, 'acme')`, orgID); err != nil {
+			t.Fatalf("insert org: %v", err)
+		}
+		if _, err := db.ExecContext(ctx, `INSERT INTO inboxes (id, org_id, address, status) VALUES ($1, $2, 'support@acme.test', 'active')`, inboxID, orgID); err != nil {
+			t.Fatalf("insert inbox: %v", err)
+		}
+		if _, err := db.ExecContext(ctx, `INSERT INTO threads (id, org_id, inbox_id, subject, status, participants, updated_at) VALUES ($1, $2, $3, 'Order 42', 'open', '[]'::jsonb, now())`, threadID, orgID, inboxID); err != nil {
+			t.Fatalf("insert thread: %v", err)
+		}
+		if _, err := db.ExecContext(ctx, `INSERT INTO messages (id, org_id, inbox_id, thread_id, direction, text) VALUES ($1, $2, $3, $4, 'outbound', 'It shipped.')`, messageID, orgID, inboxID, threadID); err != nil {
+			t.Fatalf("insert message: %v", err)
+		}
+		st := &Store{db: db, q: db}
+
+		domainID, err := st.CreateOrgDomain(ctx, orgID, "acme.test", "tok", "nerve", "", "", "txt")
+		if err != nil {
+			t.Fatalf("create domain: %v", err)
+		}
+		if err := st.SetOrgOutboundTransport(ctx, orgID, "sendgrid"); err != nil {
+			t.Fatalf("set org transport: %v", err)
+		}
+		if err := st.SetDomainOutboundTransport(ctx, orgID, domainID, "postmark"); err != nil {
+			t.Fatalf("set domain transport: %v", err)
+		}
+		if got, err := st.OutboundTransport(ctx, orgID, "acme.test"); err != nil || got != "sendgrid" {
+			t.Fatalf("expected a pending domain to fall back to the org's transport, got %q %v", got, err)
+		}
+		if err := st.UpdateOrgDomainStatus(ctx, domainID, "active"); err != nil {
+			t.Fatalf("activate domain: %v", err)
+		}
+		if got, err := st.OutboundTransport(ctx, orgID, "ACME.test"); err != nil || got != "postmark" {
+			t.Fatalf("expected the domain's transport, got %q %v", got, err)
+		}
+		if got, err := st.OutboundTransport(ctx, "", "acme.test"); err != nil || got != "" {
+			t.Fatalf("expected the default transport without an org, got %q %v", got, err)
+		}
+
+		id, err := st.EnqueueOutbox(ctx, messageID, "support@acme.test", "ann@example.com", "Order 42", "It shipped.")
+		if err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+		if err := st.MarkOutboxSent(ctx, id, "postmark", "pm-1"); err != nil {
+			t.Fatalf("mark sent: %v", err)
+		}
+		if _, err := st.GetOutboxByProviderMessageID(ctx, "sendgrid", "pm-1"); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected another transport's id not to match, got %v", err)
+		}
+		if err := st.MarkOutboxDelivered(ctx, id); err != nil {
+			t.Fatalf("mark delivered: %v", err)
+		}
+		got, err := st.GetOutboxByProviderMessageID(ctx, "postmark", "pm-1")
+		if err != nil || got.ID != id || got.Status != DeliveryDelivered || !got.DeliveredAt.Valid {
+			t.Fatalf("expected the delivered entry, got %+v %v", got, err)
+		}
+	})
+}
+
+func TestSendLimitsAndOutboundVolume(t *testing.T) {
+	withTempDatabase(t, func(ctx context.Context, db *sql.DB) {
+		migrateToLatest(t, ctx, db)
+
+		orgID, inboxID, threadID := uuid.NewString(), uuid.NewString(), uuid.NewString()
+		if _, err := db.ExecContext(ctx, `INSERT INTO orgs (id, name) VALUES ($1, 'acme')`, orgID); err != nil {
+			t.Fatalf("insert org: %v", err)
+		}
+		if _, err := db.ExecContext(ctx, `INSERT INTO inboxes (id, org_id, address, status) VALUES ($1, $2, 'support@acme.test', 'active')`, inboxID, orgID); err != nil {
+			t.Fatalf("insert inbox: %v", err)
+		}
+		if _, err := db.ExecContext(ctx, `INSERT INTO threads (id, org_id, inbox_id, subject, status, participants, updated_at) VALUES ($1, $2, $3, 'Order 42', 'open', '[]'::jsonb, now())`, threadID, orgID, inboxID); err != nil {
+			t.Fatalf("insert thread: %v", err)
+		}
+		st := &Store{db: db, q: db}
+
+		domainID, err := st.CreateOrgDomain(ctx, orgID, "acme.test", "tok", "nerve", "", "", "txt")
+		if err != nil {
+			t.Fatalf("create domain: %v", err)
+		}
+		if _, err := st.ActiveDomainSendLimits(ctx, orgID, "acme.test"); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected a pending domain to have no limits in force, got %v", err)
+		}
+		if err := st.UpdateOrgDomainStatus(ctx, domainID, "active"); err != nil {
+			t.Fatalf("activate domain: %v", err)
+		}
+		limits := SendLimits{DailyRecipients: sql.NullInt64{Int64: 500, Valid: true}}
+		if err := st.SetDomainSendLimits(ctx, orgID, domainID, limits); err != nil {
+			t.Fatalf("set domain limits: %v", err)
+		}
+		d, err := st.ActiveDomainSendLimits(ctx, orgID, "ACME.test")
+		if err != nil || d.DomainID != domainID || d.HourlyMessages.Valid || d.DailyRecipients.Int64 != 500 || !d.WarmupStartedAt.Valid {
+			t.Fatalf("expected the active domain's limits and warm-up start, got %+v %v", d, err)
+		}
+		if err := st.SetOrgSendLimits(ctx, uuid.NewString(), limits); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected an unknown org to miss, got %v", err)
+		}
+
+		for i, from := range []string{"support@acme.test", "support@acme.test", "support@other.test"} {
+			messageID := uuid.NewString()
+			if _, err := db.ExecContext(ctx, `INSERT INTO messages (id, org_id, inbox_id, thread_id, direction, text) VALUES ($1, $2, $3, $4, 'outbound', 'hi')`, messageID, orgID, inboxID, threadID); err != nil {
+				t.Fatalf("insert message %d: %v", i, err)
+			}
+			if _, err := st.EnqueueOutbox(ctx, messageID, from, "ann@example.com", "hi", "hi"); err != nil {
+				t.Fatalf("enqueue %d: %v", i, err)
+			}
+		}
+		if _, err := db.ExecContext(ctx, `UPDATE outbox SET created_at = now() - interval '3 hours' WHERE from_address = 'support@other.test'`); err != nil {
+			t.Fatalf("age entry: %v", err)
+		}
+		v, err := st.OutboundVolume(ctx, orgID, "")
+		if err != nil || v.HourlyMessages != 2 || v.DailyRecipients != 3 || v.HourlyResetSeconds > 3600 || v.DailyResetSeconds > 21*3600 {
+			t.Fatalf("unexpected org volume: %+v %v", v, err)
+		}
+		if v, err := st.OutboundVolume(ctx, orgID, "acme.test"); err != nil || v.HourlyMessages != 2 || v.DailyRecipients != 2 {
+			t.Fatalf("unexpected domain volume: %+v %v", v, err)
+		}
+	})
+}
+
+func TestListOrgsSkipsMergedOrgs(t *testing.T) {
+	withTempDatabase(t, func(ctx context.Context, db *sql.DB) {
+		migrateToLatest(t, ctx, db)
+		st := &Store{db: db, q: db}
+
+		acme, err := st.CreateOrg(ctx, "acme")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+		merged, err := st.CreateOrg(ctx, "acme-old")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+		if _, err := db.ExecContext(ctx, `UPDATE orgs SET merged_into = $1 WHERE id = $2`, acme, merged); err != nil {
+			t.Fatalf("mark merged: %v", err)
+		}
+		now := time.Now().UTC()
+		if err := st.UpsertOrgEntitlement(ctx, OrgEntitlement{
+			OrgID: acme, PlanCode: "pro", SubscriptionStatus: "active", MCPRPM: 60, MonthlyUnits: 1000,
+			UsagePeriodStart: now, UsagePeriodEnd: now.Add(24 * time.Hour),
+		}); err != nil {
+			t.Fatalf("upsert entitlement: %v", err)
+		}
+		bare, err := st.CreateOrg(ctx, "bare")
+		if err != nil {
+			t.Fatalf("create org: %v", err)
+		}
+
+		orgs, err := st.ListOrgs(ctx)
+		if err != nil {
+			t.Fatalf("list orgs: %v", err)
+		}
+		byID := map[string]OrgSummary{}
+		for _, o := range orgs {
+			byID[o.ID] = o
+		}
+		if _, ok := byID[merged]; ok || len(orgs) != 2 {
+			t.Fatalf("expected the merged org to be left out, got %+v", orgs)
+		}
+		if o := byID[acme]; o.PlanCode != "pro" || o.SubscriptionStatus != "active" || o.Name != "acme" {
+			t.Fatalf("expected acme's plan, got %+v", o)
+		}
+		if o := byID[bare]; o.PlanCode != "" || o.SubscriptionStatus != "" {
+			t.Fatalf("expected no plan for an org without entitlements, got %+v", o)
+		}
+	})
+}
+
 func assertColumnExists(t *testing.T, db *sql.DB, table, column string) {
 	t.Helper()
 	var colName string
@@ -469,7 +942,7 @@ func assertColumnExists(t *testing.T, db *sql.DB, table, column string) {
 	}
 }
 
-func migrateToLatest(t *testing.T, ctx context.Context, db *sql.DB) {
+func migrateToLatest(t testing.TB, ctx context.Context, db *sql.DB) {
 	t.Helper()
 	goose.SetDialect("postgres")
 	goose.SetTableName("schema_migrations")
@@ -515,7 +988,7 @@ func assertColumnNotNull(t *testing.T, db *sql.DB, table, column string) {
 	}
 }
 
-func withTempDatabase(t *testing.T, run func(ctx context.Context, db *sql.DB)) {
+func withTempDatabase(t testing.TB, run func(ctx context.Context, db *sql.DB)) {
 	t.Helper()
 
 	baseDSN := os.Getenv("NM_TEST_DB_DSN")
@@ -580,7 +1053,7 @@ func dsnWithCredentials(rawDSN, user, password string) (string, error) {
 	return parsed.String(), nil
 }
 
-func migrationDir(t *testing.T) string {
+func migrationDir(t testing.TB) string {
 	t.Helper()
 	_, currentFile, _, ok := runtime.Caller(0)
 	if !ok {
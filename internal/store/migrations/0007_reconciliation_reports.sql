@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS reconciliation_reports (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  started_at timestamptz NOT NULL,
+  finished_at timestamptz NOT NULL,
+  counters_checked int NOT NULL DEFAULT 0,
+  counters_repaired int NOT NULL DEFAULT 0,
+  periods_rolled int NOT NULL DEFAULT 0,
+  discrepancy_count int NOT NULL DEFAULT 0,
+  discrepancies jsonb NOT NULL DEFAULT '[]',
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_reconciliation_reports_created ON reconciliation_reports(created_at DESC);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_reconciliation_reports_created;
+DROP TABLE IF EXISTS reconciliation_reports;
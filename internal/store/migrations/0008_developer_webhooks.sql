@@ -0,0 +1,67 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  org_id uuid NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  url text NOT NULL,
+  signing_secret text NOT NULL,
+  description text NOT NULL DEFAULT '',
+  status text NOT NULL DEFAULT 'active',
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT webhook_endpoints_url_scheme_check CHECK (url ~* '^https?://')
+);
+
+-- One row per delivery attempt. Redeliveries reuse event_id and bump attempt,
+-- so the history for an event reads in attempt order.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  endpoint_id uuid NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+  org_id uuid NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  event_id text NOT NULL,
+  event_type text NOT NULL,
+  payload jsonb NOT NULL,
+  attempt int NOT NULL DEFAULT 1,
+  response_code int,
+  response_body text,
+  error_message text,
+  duration_ms int NOT NULL DEFAULT 0,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_endpoints_org ON webhook_endpoints(org_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint_created ON webhook_deliveries(endpoint_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_event ON webhook_deliveries(endpoint_id, event_id, attempt);
+
+ALTER TABLE webhook_endpoints ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhook_endpoints FORCE ROW LEVEL SECURITY;
+ALTER TABLE webhook_deliveries ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhook_deliveries FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_webhook_endpoints ON webhook_endpoints
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+CREATE POLICY tenant_isolation_webhook_deliveries ON webhook_deliveries
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_webhook_deliveries ON webhook_deliveries;
+DROP POLICY IF EXISTS tenant_isolation_webhook_endpoints ON webhook_endpoints;
+DROP INDEX IF EXISTS idx_webhook_deliveries_event;
+DROP INDEX IF EXISTS idx_webhook_deliveries_endpoint_created;
+DROP INDEX IF EXISTS idx_webhook_endpoints_org;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_endpoints;
@@ -0,0 +1,30 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS message_translations (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  message_id uuid NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+  org_id uuid REFERENCES orgs(id) ON DELETE CASCADE,
+  target_language text NOT NULL,
+  source_language text NOT NULL DEFAULT '',
+  provider text NOT NULL,
+  model text NOT NULL,
+  text text NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  UNIQUE(message_id, target_language, provider, model)
+);
+
+ALTER TABLE message_translations ENABLE ROW LEVEL SECURITY;
+ALTER TABLE message_translations FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_message_translations ON message_translations
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_message_translations ON message_translations;
+DROP TABLE IF EXISTS message_translations;
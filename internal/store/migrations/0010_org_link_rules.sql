@@ -0,0 +1,28 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS org_link_rules (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  org_id uuid NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  domain text NOT NULL,
+  action text NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT org_link_rules_action_check CHECK (action IN ('allow', 'deny')),
+  CONSTRAINT org_link_rules_domain_canonical CHECK (domain = lower(domain)),
+  UNIQUE(org_id, domain)
+);
+
+ALTER TABLE org_link_rules ENABLE ROW LEVEL SECURITY;
+ALTER TABLE org_link_rules FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_org_link_rules ON org_link_rules
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_org_link_rules ON org_link_rules;
+DROP TABLE IF EXISTS org_link_rules;
@@ -0,0 +1,26 @@
+-- +goose Up
+-- Text search configuration is resolved per inbox (falling back to the org)
+-- and copied onto each message so the stored tsvector can be generated.
+ALTER TABLE orgs
+  ADD COLUMN IF NOT EXISTS fts_config regconfig NOT NULL DEFAULT 'simple';
+
+ALTER TABLE inboxes
+  ADD COLUMN IF NOT EXISTS fts_config regconfig;
+
+ALTER TABLE messages
+  ADD COLUMN IF NOT EXISTS fts_config regconfig NOT NULL DEFAULT 'simple';
+
+ALTER TABLE messages
+  ADD COLUMN IF NOT EXISTS search_tsv tsvector
+  GENERATED ALWAYS AS (to_tsvector(fts_config, coalesce(text, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_messages_search_tsv ON messages USING GIN (search_tsv);
+DROP INDEX IF EXISTS idx_messages_text_fts;
+
+-- +goose Down
+CREATE INDEX IF NOT EXISTS idx_messages_text_fts ON messages USING GIN (to_tsvector('simple', coalesce(text,'')));
+DROP INDEX IF EXISTS idx_messages_search_tsv;
+ALTER TABLE messages DROP COLUMN IF EXISTS search_tsv;
+ALTER TABLE messages DROP COLUMN IF EXISTS fts_config;
+ALTER TABLE inboxes DROP COLUMN IF EXISTS fts_config;
+ALTER TABLE orgs DROP COLUMN IF EXISTS fts_config;
@@ -0,0 +1,55 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS org_feature_flags (
+  org_id uuid NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  flag text NOT NULL,
+  enabled boolean NOT NULL,
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (org_id, flag)
+);
+
+CREATE TABLE IF NOT EXISTS canary_tool_metrics (
+  id bigserial PRIMARY KEY,
+  org_id uuid REFERENCES orgs(id) ON DELETE CASCADE,
+  tool_name text NOT NULL,
+  variant text NOT NULL,
+  latency_ms integer NOT NULL,
+  success boolean NOT NULL,
+  policy_blocked boolean NOT NULL DEFAULT false,
+  needs_approval boolean NOT NULL DEFAULT false,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT canary_tool_metrics_variant_check CHECK (variant IN ('stable', 'canary'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_canary_tool_metrics_tool_created
+  ON canary_tool_metrics(tool_name, created_at DESC);
+
+ALTER TABLE org_feature_flags ENABLE ROW LEVEL SECURITY;
+ALTER TABLE org_feature_flags FORCE ROW LEVEL SECURITY;
+ALTER TABLE canary_tool_metrics ENABLE ROW LEVEL SECURITY;
+ALTER TABLE canary_tool_metrics FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_org_feature_flags ON org_feature_flags
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+CREATE POLICY tenant_isolation_canary_tool_metrics ON canary_tool_metrics
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_canary_tool_metrics ON canary_tool_metrics;
+DROP POLICY IF EXISTS tenant_isolation_org_feature_flags ON org_feature_flags;
+DROP TABLE IF EXISTS canary_tool_metrics;
+DROP TABLE IF EXISTS org_feature_flags;
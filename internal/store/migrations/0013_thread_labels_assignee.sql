@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE threads
+  ADD COLUMN IF NOT EXISTS labels text[] NOT NULL DEFAULT '{}',
+  ADD COLUMN IF NOT EXISTS assignee text;
+
+CREATE INDEX IF NOT EXISTS idx_threads_labels ON threads USING GIN (labels);
+CREATE INDEX IF NOT EXISTS idx_threads_inbox_status_updated ON threads(inbox_id, status, updated_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_threads_inbox_status_updated;
+DROP INDEX IF EXISTS idx_threads_labels;
+ALTER TABLE threads
+  DROP COLUMN IF EXISTS assignee,
+  DROP COLUMN IF EXISTS labels;
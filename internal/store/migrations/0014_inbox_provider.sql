@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE inboxes
+  ADD COLUMN IF NOT EXISTS provider text NOT NULL DEFAULT 'jmap';
+
+ALTER TABLE inboxes
+  DROP CONSTRAINT IF EXISTS inboxes_provider_check;
+ALTER TABLE inboxes
+  ADD CONSTRAINT inboxes_provider_check CHECK (provider IN ('jmap', 'imap'));
+
+ALTER TABLE inbox_checkpoints
+  ADD COLUMN IF NOT EXISTS uid_validity bigint,
+  ADD COLUMN IF NOT EXISTS last_uid bigint;
+
+-- +goose Down
+ALTER TABLE inbox_checkpoints
+  DROP COLUMN IF EXISTS last_uid,
+  DROP COLUMN IF EXISTS uid_validity;
+ALTER TABLE inboxes
+  DROP CONSTRAINT IF EXISTS inboxes_provider_check;
+ALTER TABLE inboxes
+  DROP COLUMN IF EXISTS provider;
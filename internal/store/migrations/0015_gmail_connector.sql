@@ -0,0 +1,71 @@
+-- +goose Up
+ALTER TABLE inboxes
+  DROP CONSTRAINT IF EXISTS inboxes_provider_check;
+ALTER TABLE inboxes
+  ADD CONSTRAINT inboxes_provider_check CHECK (provider IN ('jmap', 'imap', 'gmail'));
+
+-- One OAuth grant per inbox. The access token is a cache; the refresh token
+-- is the durable credential.
+CREATE TABLE IF NOT EXISTS inbox_oauth_tokens (
+  inbox_id uuid PRIMARY KEY REFERENCES inboxes(id) ON DELETE CASCADE,
+  org_id uuid NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  provider text NOT NULL,
+  account_email text NOT NULL DEFAULT '',
+  refresh_token text NOT NULL,
+  access_token text NOT NULL DEFAULT '',
+  access_token_expires_at timestamptz,
+  scopes text[] NOT NULL DEFAULT '{}',
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- Pending consent requests, keyed by the OAuth state parameter.
+CREATE TABLE IF NOT EXISTS oauth_connect_states (
+  state text PRIMARY KEY,
+  org_id uuid NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  inbox_id uuid NOT NULL REFERENCES inboxes(id) ON DELETE CASCADE,
+  provider text NOT NULL,
+  expires_at timestamptz NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_inbox_oauth_tokens_org ON inbox_oauth_tokens(org_id);
+CREATE INDEX IF NOT EXISTS idx_oauth_connect_states_expires ON oauth_connect_states(expires_at);
+
+ALTER TABLE inbox_oauth_tokens ENABLE ROW LEVEL SECURITY;
+ALTER TABLE inbox_oauth_tokens FORCE ROW LEVEL SECURITY;
+ALTER TABLE oauth_connect_states ENABLE ROW LEVEL SECURITY;
+ALTER TABLE oauth_connect_states FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_inbox_oauth_tokens ON inbox_oauth_tokens
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+CREATE POLICY tenant_isolation_oauth_connect_states ON oauth_connect_states
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_oauth_connect_states ON oauth_connect_states;
+DROP POLICY IF EXISTS tenant_isolation_inbox_oauth_tokens ON inbox_oauth_tokens;
+DROP INDEX IF EXISTS idx_oauth_connect_states_expires;
+DROP INDEX IF EXISTS idx_inbox_oauth_tokens_org;
+DROP TABLE IF EXISTS oauth_connect_states;
+DROP TABLE IF EXISTS inbox_oauth_tokens;
+UPDATE inboxes SET provider = 'jmap' WHERE provider = 'gmail';
+ALTER TABLE inboxes
+  DROP CONSTRAINT IF EXISTS inboxes_provider_check;
+ALTER TABLE inboxes
+  ADD CONSTRAINT inboxes_provider_check CHECK (provider IN ('jmap', 'imap'));
@@ -0,0 +1,25 @@
+-- +goose Up
+-- NULL region means the home deployment (database.dsn / qdrant.url).
+ALTER TABLE orgs
+  ADD COLUMN IF NOT EXISTS region text;
+ALTER TABLE orgs
+  DROP CONSTRAINT IF EXISTS orgs_region_check;
+ALTER TABLE orgs
+  ADD CONSTRAINT orgs_region_check CHECK (region IS NULL OR region ~ '^[a-z][a-z0-9-]*$');
+
+-- Denormalised from orgs so ingest can route an inbox without a join.
+ALTER TABLE inboxes
+  ADD COLUMN IF NOT EXISTS region text;
+
+UPDATE inboxes i
+SET region = o.region
+FROM orgs o
+WHERE i.org_id = o.id AND i.region IS DISTINCT FROM o.region;
+
+-- +goose Down
+ALTER TABLE inboxes
+  DROP COLUMN IF EXISTS region;
+ALTER TABLE orgs
+  DROP CONSTRAINT IF EXISTS orgs_region_check;
+ALTER TABLE orgs
+  DROP COLUMN IF EXISTS region;
@@ -0,0 +1,40 @@
+-- +goose Up
+-- One row per MCP session, from initialize to termination. org_id is NULL for
+-- self-hosted sessions without a cloud principal.
+CREATE TABLE IF NOT EXISTS mcp_sessions (
+  id text PRIMARY KEY,
+  org_id uuid REFERENCES orgs(id) ON DELETE CASCADE,
+  actor_id text NOT NULL DEFAULT '',
+  token_id text NOT NULL DEFAULT '',
+  auth_method text NOT NULL DEFAULT '',
+  client_name text NOT NULL DEFAULT '',
+  client_version text NOT NULL DEFAULT '',
+  protocol_version text NOT NULL DEFAULT '',
+  remote_addr text NOT NULL DEFAULT '',
+  created_at timestamptz NOT NULL DEFAULT now(),
+  last_activity_at timestamptz NOT NULL DEFAULT now(),
+  expires_at timestamptz NOT NULL,
+  terminated_at timestamptz,
+  termination_reason text,
+  terminated_by text
+);
+
+CREATE INDEX IF NOT EXISTS idx_mcp_sessions_org_created ON mcp_sessions(org_id, created_at DESC);
+
+ALTER TABLE mcp_sessions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE mcp_sessions FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_mcp_sessions ON mcp_sessions
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_mcp_sessions ON mcp_sessions;
+DROP INDEX IF EXISTS idx_mcp_sessions_org_created;
+DROP TABLE IF EXISTS mcp_sessions;
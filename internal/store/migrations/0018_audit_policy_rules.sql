@@ -0,0 +1,6 @@
+-- +goose Up
+ALTER TABLE audit_log
+  ADD COLUMN IF NOT EXISTS policy_rule_ids text[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE audit_log DROP COLUMN IF EXISTS policy_rule_ids;
@@ -0,0 +1,6 @@
+-- +goose Up
+ALTER TABLE inboxes
+  ADD COLUMN IF NOT EXISTS embedding_disabled boolean NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE inboxes DROP COLUMN IF EXISTS embedding_disabled;
@@ -0,0 +1,60 @@
+-- +goose Up
+-- A draft is one reply being worked on for a thread; each draft_reply_with_policy
+-- or update_draft call appends a revision with its policy outcome.
+CREATE TABLE IF NOT EXISTS drafts (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  org_id uuid REFERENCES orgs(id) ON DELETE CASCADE,
+  thread_id uuid NOT NULL REFERENCES threads(id) ON DELETE CASCADE,
+  goal text NOT NULL DEFAULT '',
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS draft_revisions (
+  draft_id uuid NOT NULL REFERENCES drafts(id) ON DELETE CASCADE,
+  revision integer NOT NULL,
+  org_id uuid REFERENCES orgs(id) ON DELETE CASCADE,
+  body text NOT NULL,
+  policy_id text NOT NULL DEFAULT '',
+  policy_blocked boolean NOT NULL DEFAULT false,
+  needs_human_approval boolean NOT NULL DEFAULT false,
+  reason text NOT NULL DEFAULT '',
+  risk_flags text[] NOT NULL DEFAULT '{}',
+  policy_rule_ids text[] NOT NULL DEFAULT '{}',
+  created_at timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (draft_id, revision)
+);
+
+CREATE INDEX IF NOT EXISTS idx_drafts_thread ON drafts(thread_id, created_at DESC);
+
+ALTER TABLE drafts ENABLE ROW LEVEL SECURITY;
+ALTER TABLE drafts FORCE ROW LEVEL SECURITY;
+ALTER TABLE draft_revisions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE draft_revisions FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_drafts ON drafts
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+CREATE POLICY tenant_isolation_draft_revisions ON draft_revisions
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_draft_revisions ON draft_revisions;
+DROP POLICY IF EXISTS tenant_isolation_drafts ON drafts;
+DROP TABLE IF EXISTS draft_revisions;
+DROP INDEX IF EXISTS idx_drafts_thread;
+DROP TABLE IF EXISTS drafts;
@@ -0,0 +1,28 @@
+-- +goose Up
+-- Drafts carry a review status so policy-blocked or flagged replies wait for a
+-- human instead of disappearing. send_reply only sends approved drafts.
+ALTER TABLE drafts ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'pending_approval'
+  CHECK (status IN ('pending_approval', 'approved', 'rejected', 'sent'));
+ALTER TABLE drafts ADD COLUMN IF NOT EXISTS reviewed_by text NOT NULL DEFAULT '';
+ALTER TABLE drafts ADD COLUMN IF NOT EXISTS reviewed_at timestamptz;
+ALTER TABLE drafts ADD COLUMN IF NOT EXISTS review_note text NOT NULL DEFAULT '';
+ALTER TABLE drafts ADD COLUMN IF NOT EXISTS approved_revision integer;
+ALTER TABLE drafts ADD COLUMN IF NOT EXISTS sent_message_id uuid;
+
+-- Existing drafts whose latest revision needed no approval count as approved.
+UPDATE drafts d SET status = 'approved', approved_revision = r.revision
+FROM draft_revisions r
+WHERE r.draft_id = d.id
+  AND r.revision = (SELECT max(revision) FROM draft_revisions WHERE draft_id = d.id)
+  AND NOT r.needs_human_approval;
+
+CREATE INDEX IF NOT EXISTS idx_drafts_org_status ON drafts(org_id, status, updated_at DESC);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_drafts_org_status;
+ALTER TABLE drafts DROP COLUMN IF EXISTS sent_message_id;
+ALTER TABLE drafts DROP COLUMN IF EXISTS approved_revision;
+ALTER TABLE drafts DROP COLUMN IF EXISTS review_note;
+ALTER TABLE drafts DROP COLUMN IF EXISTS reviewed_at;
+ALTER TABLE drafts DROP COLUMN IF EXISTS reviewed_by;
+ALTER TABLE drafts DROP COLUMN IF EXISTS status;
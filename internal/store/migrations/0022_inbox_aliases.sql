@@ -0,0 +1,36 @@
+-- +goose Up
+-- Alias addresses deliver into a primary inbox (e.g. billing@ and sales@ into
+-- support@). Each inbound message records which alias it was sent to.
+CREATE TABLE IF NOT EXISTS inbox_aliases (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  org_id uuid REFERENCES orgs(id) ON DELETE CASCADE,
+  inbox_id uuid NOT NULL REFERENCES inboxes(id) ON DELETE CASCADE,
+  address text NOT NULL,
+  route text NOT NULL DEFAULT '',
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_inbox_aliases_address ON inbox_aliases(lower(address));
+CREATE INDEX IF NOT EXISTS idx_inbox_aliases_inbox ON inbox_aliases(inbox_id);
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS alias_address text NOT NULL DEFAULT '';
+
+ALTER TABLE inbox_aliases ENABLE ROW LEVEL SECURITY;
+ALTER TABLE inbox_aliases FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_inbox_aliases ON inbox_aliases
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_inbox_aliases ON inbox_aliases;
+ALTER TABLE messages DROP COLUMN IF EXISTS alias_address;
+DROP INDEX IF EXISTS idx_inbox_aliases_inbox;
+DROP INDEX IF EXISTS idx_inbox_aliases_address;
+DROP TABLE IF EXISTS inbox_aliases;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Operators page through audit_log by time and join it to usage_events by
+-- tool call to find an org's calls.
+CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at);
+CREATE INDEX IF NOT EXISTS idx_usage_events_audit ON usage_events(audit_id) WHERE audit_id IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_usage_events_audit;
+DROP INDEX IF EXISTS idx_audit_log_created;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Share of the thread's messages a draft cited; NULL for calls that are not
+-- drafts.
+ALTER TABLE audit_log
+  ADD COLUMN IF NOT EXISTS citation_coverage double precision;
+
+-- +goose Down
+ALTER TABLE audit_log DROP COLUMN IF EXISTS citation_coverage;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- Orgs opt in to re-ranking search_inbox hits; a NULL budget uses the
+-- server's rerank.latency_budget.
+ALTER TABLE orgs
+  ADD COLUMN IF NOT EXISTS search_rerank boolean NOT NULL DEFAULT false,
+  ADD COLUMN IF NOT EXISTS search_rerank_budget_ms integer;
+
+-- +goose Down
+ALTER TABLE orgs
+  DROP COLUMN IF EXISTS search_rerank_budget_ms,
+  DROP COLUMN IF EXISTS search_rerank;
@@ -0,0 +1,46 @@
+-- +goose Up
+-- Outbound mail carries its Message-ID in the outbox so bounces and
+-- complaints that quote it can be matched to the delivery.
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS internet_message_id text NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_outbox_internet_message ON outbox(internet_message_id) WHERE internet_message_id <> '';
+
+ALTER TABLE outbox DROP CONSTRAINT IF EXISTS outbox_status_check;
+ALTER TABLE outbox ADD CONSTRAINT outbox_status_check
+  CHECK (status IN ('queued', 'sent', 'bounced', 'failed', 'complained'));
+
+-- Addresses that hard-bounced or complained; sends to them are refused.
+CREATE TABLE IF NOT EXISTS suppressions (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  org_id uuid REFERENCES orgs(id) ON DELETE CASCADE,
+  address text NOT NULL,
+  reason text NOT NULL CHECK (reason IN ('hard_bounce', 'complaint')),
+  source_message_id uuid REFERENCES messages(id) ON DELETE SET NULL,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_suppressions_org_address ON suppressions(coalesce(org_id::text, ''), address);
+
+ALTER TABLE suppressions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE suppressions FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_suppressions ON suppressions
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_suppressions ON suppressions;
+DROP INDEX IF EXISTS idx_suppressions_org_address;
+DROP TABLE IF EXISTS suppressions;
+
+UPDATE outbox SET status = 'sent' WHERE status = 'complained';
+ALTER TABLE outbox DROP CONSTRAINT IF EXISTS outbox_status_check;
+ALTER TABLE outbox ADD CONSTRAINT outbox_status_check
+  CHECK (status IN ('queued', 'sent', 'bounced', 'failed'));
+DROP INDEX IF EXISTS idx_outbox_internet_message;
+ALTER TABLE outbox DROP COLUMN IF EXISTS internet_message_id;
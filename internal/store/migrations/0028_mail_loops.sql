@@ -0,0 +1,10 @@
+-- +goose Up
+-- auto_submitted records why an inbound message looks machine-sent (its
+-- Auto-Submitted or Precedence header); empty for mail from people.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS auto_submitted text NOT NULL DEFAULT '';
+-- Replies the agent tried to send into a looping or automated thread.
+ALTER TABLE threads ADD COLUMN IF NOT EXISTS suppressed_auto_replies int NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE threads DROP COLUMN IF EXISTS suppressed_auto_replies;
+ALTER TABLE messages DROP COLUMN IF EXISTS auto_submitted;
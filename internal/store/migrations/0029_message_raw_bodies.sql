@@ -0,0 +1,10 @@
+-- +goose Up
+-- text and html hold the cleaned body the tools, FTS and embeddings see
+-- (quoted history and signature stripped, HTML sanitized); raw_text and
+-- raw_html keep the body as the provider delivered it.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS raw_text text NOT NULL DEFAULT '';
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS raw_html text NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE messages DROP COLUMN IF EXISTS raw_html;
+ALTER TABLE messages DROP COLUMN IF EXISTS raw_text;
@@ -0,0 +1,30 @@
+-- +goose Up
+-- Branding applied to the mail the system sends on an org's behalf (digests,
+-- approval notifications, verification mail). physical_address is the postal
+-- address CAN-SPAM requires in commercial mail.
+CREATE TABLE IF NOT EXISTS org_branding (
+  org_id uuid PRIMARY KEY REFERENCES orgs(id) ON DELETE CASCADE,
+  logo_url text NOT NULL DEFAULT '',
+  primary_color text NOT NULL DEFAULT '',
+  accent_color text NOT NULL DEFAULT '',
+  footer_text text NOT NULL DEFAULT '',
+  physical_address text NOT NULL DEFAULT '',
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+ALTER TABLE org_branding ENABLE ROW LEVEL SECURITY;
+ALTER TABLE org_branding FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_org_branding ON org_branding
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_org_branding ON org_branding;
+DROP TABLE IF EXISTS org_branding;
@@ -0,0 +1,28 @@
+-- +goose Up
+-- in_reply_to and reference_ids keep a message's In-Reply-To and References
+-- headers (reference_ids space-separated, as in the header) so replies can
+-- be threaded onto the message they answer when the provider has no thread.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS in_reply_to text NOT NULL DEFAULT '';
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS reference_ids text NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_messages_inbox_internet_message ON messages(inbox_id, internet_message_id);
+
+-- The outbox carries them too so the sender can emit the headers.
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS in_reply_to text NOT NULL DEFAULT '';
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS reference_ids text NOT NULL DEFAULT '';
+
+-- normalized_subject is the subject without reply and forward prefixes,
+-- lowercased; the last resort for matching a reply to its thread.
+ALTER TABLE threads ADD COLUMN IF NOT EXISTS normalized_subject text NOT NULL DEFAULT '';
+UPDATE threads
+SET normalized_subject = lower(btrim(regexp_replace(subject, '^(\s*(re|fwd?|aw|sv|antw)(\[\d+\])?\s*:\s*)+', '', 'i')))
+WHERE normalized_subject = '';
+CREATE INDEX IF NOT EXISTS idx_threads_inbox_normalized_subject ON threads(inbox_id, normalized_subject, updated_at DESC);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_threads_inbox_normalized_subject;
+ALTER TABLE threads DROP COLUMN IF EXISTS normalized_subject;
+ALTER TABLE outbox DROP COLUMN IF EXISTS reference_ids;
+ALTER TABLE outbox DROP COLUMN IF EXISTS in_reply_to;
+DROP INDEX IF EXISTS idx_messages_inbox_internet_message;
+ALTER TABLE messages DROP COLUMN IF EXISTS reference_ids;
+ALTER TABLE messages DROP COLUMN IF EXISTS in_reply_to;
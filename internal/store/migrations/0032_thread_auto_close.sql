@@ -0,0 +1,46 @@
+-- +goose Up
+-- Threads with no message for auto_close_after_days are closed by the
+-- worker; 0 leaves them open. With auto_close_nudge the customer is first
+-- asked whether they need anything else.
+ALTER TABLE inboxes ADD COLUMN IF NOT EXISTS auto_close_after_days int NOT NULL DEFAULT 0
+  CHECK (auto_close_after_days >= 0);
+ALTER TABLE inboxes ADD COLUMN IF NOT EXISTS auto_close_nudge boolean NOT NULL DEFAULT false;
+-- nudged_at is when the last nudge went out.
+ALTER TABLE threads ADD COLUMN IF NOT EXISTS nudged_at timestamptz;
+
+-- One row per time a thread was closed; reopened_at is set when new mail
+-- reopens it, which gives the reopened-after-close rate.
+CREATE TABLE IF NOT EXISTS thread_closures (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  org_id uuid REFERENCES orgs(id) ON DELETE CASCADE,
+  inbox_id uuid NOT NULL REFERENCES inboxes(id) ON DELETE CASCADE,
+  thread_id uuid NOT NULL REFERENCES threads(id) ON DELETE CASCADE,
+  auto boolean NOT NULL DEFAULT false,
+  closed_at timestamptz NOT NULL DEFAULT now(),
+  reopened_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_thread_closures_thread_open ON thread_closures(thread_id) WHERE reopened_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_thread_closures_inbox_closed ON thread_closures(inbox_id, closed_at);
+
+ALTER TABLE thread_closures ENABLE ROW LEVEL SECURITY;
+ALTER TABLE thread_closures FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_thread_closures ON thread_closures
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_thread_closures ON thread_closures;
+DROP INDEX IF EXISTS idx_thread_closures_inbox_closed;
+DROP INDEX IF EXISTS idx_thread_closures_thread_open;
+DROP TABLE IF EXISTS thread_closures;
+ALTER TABLE threads DROP COLUMN IF EXISTS nudged_at;
+ALTER TABLE inboxes DROP COLUMN IF EXISTS auto_close_nudge;
+ALTER TABLE inboxes DROP COLUMN IF EXISTS auto_close_after_days;
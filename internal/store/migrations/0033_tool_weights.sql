@@ -0,0 +1,12 @@
+-- +goose Up
+-- tool_weights overrides the configured per-tool mcp_units weights for a
+-- plan, as {"tool_name": units}; tools not listed use the config.
+ALTER TABLE plan_entitlements ADD COLUMN IF NOT EXISTS tool_weights jsonb NOT NULL DEFAULT '{}';
+-- weight is the tool's base weight at call time; quantity adds any extra
+-- work the call reported, such as search re-ranking.
+ALTER TABLE usage_events ADD COLUMN IF NOT EXISTS weight bigint NOT NULL DEFAULT 0;
+UPDATE usage_events SET weight = quantity WHERE weight = 0;
+
+-- +goose Down
+ALTER TABLE usage_events DROP COLUMN IF EXISTS weight;
+ALTER TABLE plan_entitlements DROP COLUMN IF EXISTS tool_weights;
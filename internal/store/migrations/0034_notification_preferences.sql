@@ -0,0 +1,30 @@
+-- +goose Up
+-- Which events reach which notification channels, and how often. A row with
+-- user_id '' is the org's default; a user's own row overrides it. event_type
+-- '*' covers every event on the channel.
+CREATE TABLE IF NOT EXISTS notification_preferences (
+  org_id uuid NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  user_id text NOT NULL DEFAULT '',
+  event_type text NOT NULL,
+  channel text NOT NULL CHECK (channel IN ('email', 'slack', 'webhook', 'sse')),
+  frequency text NOT NULL CHECK (frequency IN ('immediate', 'hourly', 'daily', 'off')),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (org_id, user_id, event_type, channel)
+);
+
+ALTER TABLE notification_preferences ENABLE ROW LEVEL SECURITY;
+ALTER TABLE notification_preferences FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_notification_preferences ON notification_preferences
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_notification_preferences ON notification_preferences;
+DROP TABLE IF EXISTS notification_preferences;
@@ -0,0 +1,31 @@
+-- +goose Up
+-- Short summaries of older messages, used when a long thread is packed into
+-- a draft's context. Keyed by provider and model like message_translations.
+CREATE TABLE IF NOT EXISTS message_summaries (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  message_id uuid NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+  org_id uuid REFERENCES orgs(id) ON DELETE CASCADE,
+  provider text NOT NULL,
+  model text NOT NULL,
+  summary text NOT NULL,
+  tokens int NOT NULL DEFAULT 0,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  UNIQUE(message_id, provider, model)
+);
+
+ALTER TABLE message_summaries ENABLE ROW LEVEL SECURITY;
+ALTER TABLE message_summaries FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_message_summaries ON message_summaries
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_message_summaries ON message_summaries;
+DROP TABLE IF EXISTS message_summaries;
@@ -0,0 +1,27 @@
+-- +goose Up
+-- Task -> ["provider:model", ...] routes, in fallback order. An org's routes
+-- override its plan's for the same task; both override the deployment's.
+ALTER TABLE orgs ADD COLUMN IF NOT EXISTS llm_routes jsonb NOT NULL DEFAULT '{}'::jsonb;
+ALTER TABLE plan_entitlements ADD COLUMN IF NOT EXISTS llm_routes jsonb NOT NULL DEFAULT '{}'::jsonb;
+
+-- Which model served a tool call and what it cost. model_name keeps the
+-- serving model; model_task is the task it served (the last one, when a
+-- tool ran several). Tokens and cost are estimates.
+ALTER TABLE tool_calls ADD COLUMN IF NOT EXISTS model_task text NOT NULL DEFAULT '';
+ALTER TABLE tool_calls ADD COLUMN IF NOT EXISTS model_calls int NOT NULL DEFAULT 0;
+ALTER TABLE tool_calls ADD COLUMN IF NOT EXISTS model_fallbacks int NOT NULL DEFAULT 0;
+ALTER TABLE tool_calls ADD COLUMN IF NOT EXISTS model_errors int NOT NULL DEFAULT 0;
+ALTER TABLE tool_calls ADD COLUMN IF NOT EXISTS model_tokens int NOT NULL DEFAULT 0;
+ALTER TABLE tool_calls ADD COLUMN IF NOT EXISTS model_cost_usd double precision NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_tool_calls_created ON tool_calls(created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_tool_calls_created;
+ALTER TABLE tool_calls DROP COLUMN IF EXISTS model_cost_usd;
+ALTER TABLE tool_calls DROP COLUMN IF EXISTS model_tokens;
+ALTER TABLE tool_calls DROP COLUMN IF EXISTS model_errors;
+ALTER TABLE tool_calls DROP COLUMN IF EXISTS model_fallbacks;
+ALTER TABLE tool_calls DROP COLUMN IF EXISTS model_calls;
+ALTER TABLE tool_calls DROP COLUMN IF EXISTS model_task;
+ALTER TABLE plan_entitlements DROP COLUMN IF EXISTS llm_routes;
+ALTER TABLE orgs DROP COLUMN IF EXISTS llm_routes;
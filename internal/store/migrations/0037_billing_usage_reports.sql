@@ -0,0 +1,28 @@
+-- +goose Up
+-- Usage pushed to Stripe as metered usage records. Each row is one period
+-- total for a meter; Stripe sets the period's usage to quantity, so a row is
+-- only added when the total changes, and its idempotency_key makes retries
+-- of the same total safe.
+CREATE TABLE IF NOT EXISTS billing_usage_reports (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  org_id uuid NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  meter_name text NOT NULL,
+  period_start timestamptz NOT NULL,
+  period_end timestamptz NOT NULL,
+  quantity bigint NOT NULL,
+  idempotency_key text NOT NULL UNIQUE,
+  subscription_item_id text NOT NULL DEFAULT '',
+  usage_record_id text NOT NULL DEFAULT '',
+  status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'reported', 'failed')),
+  attempts int NOT NULL DEFAULT 0,
+  last_error text NOT NULL DEFAULT '',
+  next_attempt_at timestamptz NOT NULL DEFAULT now(),
+  reported_at timestamptz,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_billing_usage_reports_period ON billing_usage_reports(org_id, meter_name, period_start, created_at DESC);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_billing_usage_reports_period;
+DROP TABLE IF EXISTS billing_usage_reports;
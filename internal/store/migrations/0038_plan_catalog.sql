@@ -0,0 +1,48 @@
+-- +goose Up
+-- Catalog fields for plans. A plan is sold through the Stripe price with
+-- stripe_lookup_key (the plan code when empty; a price_ ID is used as is);
+-- overage_lookup_key names its metered price for mcp_units beyond
+-- monthly_units. Prices are for display, Stripe's are what is charged.
+-- Unlisted plans are kept off /v1/plans.
+ALTER TABLE plan_entitlements ADD COLUMN IF NOT EXISTS display_name text NOT NULL DEFAULT '';
+ALTER TABLE plan_entitlements ADD COLUMN IF NOT EXISTS stripe_lookup_key text NOT NULL DEFAULT '';
+ALTER TABLE plan_entitlements ADD COLUMN IF NOT EXISTS monthly_price_cents bigint NOT NULL DEFAULT 0;
+ALTER TABLE plan_entitlements ADD COLUMN IF NOT EXISTS overage_lookup_key text NOT NULL DEFAULT '';
+ALTER TABLE plan_entitlements ADD COLUMN IF NOT EXISTS overage_cents_per_1000_units bigint NOT NULL DEFAULT 0;
+ALTER TABLE plan_entitlements ADD COLUMN IF NOT EXISTS listed boolean NOT NULL DEFAULT true;
+
+-- Pro was sold through a fixed price before the catalog; keep selling it there.
+UPDATE plan_entitlements SET stripe_lookup_key = 'price_1SzW5LDPvkk7SvtZKJImtxzx'
+WHERE plan_code = 'pro' AND stripe_lookup_key = '';
+
+-- Add-ons are bought alongside a plan and stack on its limits, per unit of
+-- quantity.
+CREATE TABLE IF NOT EXISTS plan_addons (
+  code text PRIMARY KEY,
+  display_name text NOT NULL DEFAULT '',
+  stripe_lookup_key text NOT NULL UNIQUE,
+  monthly_price_cents bigint NOT NULL DEFAULT 0,
+  extra_inboxes int NOT NULL DEFAULT 0,
+  extra_domains int NOT NULL DEFAULT 0,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- The add-ons on an org's subscription, as of its last Stripe event.
+CREATE TABLE IF NOT EXISTS org_addons (
+  org_id uuid NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  addon_code text NOT NULL REFERENCES plan_addons(code) ON DELETE CASCADE,
+  quantity int NOT NULL CHECK (quantity > 0),
+  external_subscription_id text NOT NULL DEFAULT '',
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (org_id, addon_code)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS org_addons;
+DROP TABLE IF EXISTS plan_addons;
+ALTER TABLE plan_entitlements DROP COLUMN IF EXISTS listed;
+ALTER TABLE plan_entitlements DROP COLUMN IF EXISTS overage_cents_per_1000_units;
+ALTER TABLE plan_entitlements DROP COLUMN IF EXISTS overage_lookup_key;
+ALTER TABLE plan_entitlements DROP COLUMN IF EXISTS monthly_price_cents;
+ALTER TABLE plan_entitlements DROP COLUMN IF EXISTS stripe_lookup_key;
+ALTER TABLE plan_entitlements DROP COLUMN IF EXISTS display_name;
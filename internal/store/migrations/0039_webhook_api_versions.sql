@@ -0,0 +1,7 @@
+-- +goose Up
+-- The payload version each endpoint is pinned to. Endpoints created before
+-- versioning get the first version, which matches what they were sent.
+ALTER TABLE webhook_endpoints ADD COLUMN IF NOT EXISTS api_version text NOT NULL DEFAULT '2026-10-01';
+
+-- +goose Down
+ALTER TABLE webhook_endpoints DROP COLUMN IF EXISTS api_version;
@@ -0,0 +1,24 @@
+-- +goose Up
+-- Orgs start on the unlisted 'trial' plan with subscription_status
+-- 'trialing' until trial_ends_at, when reconciliation moves them to
+-- 'trial_expired'. A paid subscription replaces the row and clears it.
+ALTER TABLE org_entitlements ADD COLUMN IF NOT EXISTS trial_ends_at timestamptz;
+
+CREATE INDEX IF NOT EXISTS idx_org_entitlements_trial_ends
+  ON org_entitlements(trial_ends_at)
+  WHERE subscription_status = 'trialing' AND trial_ends_at IS NOT NULL;
+
+ALTER TABLE reconciliation_reports ADD COLUMN IF NOT EXISTS trials_expired int NOT NULL DEFAULT 0;
+
+-- Operators can tune the trial's limits; this only seeds them.
+INSERT INTO plan_entitlements (plan_code, mcp_rpm, monthly_units, max_inboxes, max_domains, display_name, listed)
+VALUES ('trial', 60, 1000, 1, 1, 'Trial', false)
+ON CONFLICT (plan_code) DO NOTHING;
+
+-- +goose Down
+DELETE FROM plan_entitlements
+WHERE plan_code = 'trial'
+  AND NOT EXISTS (SELECT 1 FROM org_entitlements WHERE plan_code = 'trial');
+ALTER TABLE reconciliation_reports DROP COLUMN IF EXISTS trials_expired;
+DROP INDEX IF EXISTS idx_org_entitlements_trial_ends;
+ALTER TABLE org_entitlements DROP COLUMN IF EXISTS trial_ends_at;
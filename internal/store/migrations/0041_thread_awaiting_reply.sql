@@ -0,0 +1,29 @@
+-- +goose Up
+-- awaiting_reply says who owes the thread's next message: 'us' after the
+-- customer wrote, 'customer' after we did, '' before any message.
+-- awaiting_reply_since is when the message that set it was created, so mail
+-- ingested out of order cannot roll it back. Auto-replies and bulk mail do
+-- not count as the customer writing.
+ALTER TABLE threads
+  ADD COLUMN IF NOT EXISTS awaiting_reply text NOT NULL DEFAULT ''
+    CHECK (awaiting_reply IN ('', 'us', 'customer')),
+  ADD COLUMN IF NOT EXISTS awaiting_reply_since timestamptz;
+
+UPDATE threads t
+SET awaiting_reply = CASE m.direction WHEN 'inbound' THEN 'us' ELSE 'customer' END,
+    awaiting_reply_since = m.created_at
+FROM (
+  SELECT DISTINCT ON (thread_id) thread_id, direction, created_at
+  FROM messages
+  WHERE direction = 'outbound' OR (direction = 'inbound' AND auto_submitted = '')
+  ORDER BY thread_id, created_at DESC
+) m
+WHERE t.id = m.thread_id;
+
+CREATE INDEX IF NOT EXISTS idx_threads_inbox_awaiting_updated ON threads(inbox_id, awaiting_reply, updated_at DESC);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_threads_inbox_awaiting_updated;
+ALTER TABLE threads
+  DROP COLUMN IF EXISTS awaiting_reply_since,
+  DROP COLUMN IF EXISTS awaiting_reply;
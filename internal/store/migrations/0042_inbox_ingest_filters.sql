@@ -0,0 +1,57 @@
+-- +goose Up
+-- Ingestion filters drop noise before it is stored or embedded. An inbox
+-- without a row ingests everything.
+CREATE TABLE IF NOT EXISTS inbox_ingest_filters (
+  inbox_id uuid PRIMARY KEY REFERENCES inboxes(id) ON DELETE CASCADE,
+  org_id uuid REFERENCES orgs(id) ON DELETE CASCADE,
+  -- Addresses, or domains matching themselves and their subdomains.
+  skip_senders text[] NOT NULL DEFAULT '{}',
+  -- RE2 patterns matched case-insensitively against the subject.
+  skip_subjects text[] NOT NULL DEFAULT '{}',
+  -- Calendar replies: accepted, declined and tentative notices.
+  skip_calendar_responses boolean NOT NULL DEFAULT false,
+  -- 0 is no limit.
+  max_message_bytes bigint NOT NULL DEFAULT 0 CHECK (max_message_bytes >= 0),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- Running totals of mail each inbox skipped, by the filter that matched.
+CREATE TABLE IF NOT EXISTS inbox_ingest_skips (
+  inbox_id uuid NOT NULL REFERENCES inboxes(id) ON DELETE CASCADE,
+  org_id uuid REFERENCES orgs(id) ON DELETE CASCADE,
+  reason text NOT NULL CHECK (reason IN ('sender', 'subject', 'calendar_response', 'size')),
+  skipped bigint NOT NULL DEFAULT 0,
+  last_skipped_at timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (inbox_id, reason)
+);
+
+ALTER TABLE inbox_ingest_filters ENABLE ROW LEVEL SECURITY;
+ALTER TABLE inbox_ingest_filters FORCE ROW LEVEL SECURITY;
+ALTER TABLE inbox_ingest_skips ENABLE ROW LEVEL SECURITY;
+ALTER TABLE inbox_ingest_skips FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_inbox_ingest_filters ON inbox_ingest_filters
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+CREATE POLICY tenant_isolation_inbox_ingest_skips ON inbox_ingest_skips
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_inbox_ingest_skips ON inbox_ingest_skips;
+DROP POLICY IF EXISTS tenant_isolation_inbox_ingest_filters ON inbox_ingest_filters;
+DROP TABLE IF EXISTS inbox_ingest_skips;
+DROP TABLE IF EXISTS inbox_ingest_filters;
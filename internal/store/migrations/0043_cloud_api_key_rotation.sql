@@ -0,0 +1,13 @@
+-- +goose Up
+-- A rotated key keeps working until expires_at; its replacement records
+-- which key it replaced.
+ALTER TABLE cloud_api_keys ADD COLUMN IF NOT EXISTS expires_at timestamptz;
+ALTER TABLE cloud_api_keys ADD COLUMN IF NOT EXISTS rotated_from_id uuid REFERENCES cloud_api_keys(id) ON DELETE SET NULL;
+
+-- A key is replaced at most once.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cloud_api_keys_rotated_from ON cloud_api_keys(rotated_from_id) WHERE rotated_from_id IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_cloud_api_keys_rotated_from;
+ALTER TABLE cloud_api_keys DROP COLUMN IF EXISTS rotated_from_id;
+ALTER TABLE cloud_api_keys DROP COLUMN IF EXISTS expires_at;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- Sandbox orgs hold only seeded demo data; the MCP playground serves nothing
+-- else.
+ALTER TABLE orgs ADD COLUMN IF NOT EXISTS sandbox boolean NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE orgs DROP COLUMN IF EXISTS sandbox;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- An oversized message is stored with truncated bodies; raw_object_key names
+-- the object holding it in full, empty when no object store is configured.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS oversized boolean NOT NULL DEFAULT false;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS raw_object_key text NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE messages DROP COLUMN IF EXISTS raw_object_key;
+ALTER TABLE messages DROP COLUMN IF EXISTS oversized;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- A key or service token with inbox_ids may only touch those inboxes of its
+-- org; an empty list allows all of them.
+ALTER TABLE cloud_api_keys ADD COLUMN IF NOT EXISTS inbox_ids text[] NOT NULL DEFAULT '{}';
+ALTER TABLE service_tokens ADD COLUMN IF NOT EXISTS inbox_ids text[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE service_tokens DROP COLUMN IF EXISTS inbox_ids;
+ALTER TABLE cloud_api_keys DROP COLUMN IF EXISTS inbox_ids;
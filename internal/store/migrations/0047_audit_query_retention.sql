@@ -0,0 +1,22 @@
+-- +goose Up
+-- audit_log rows carry the org and inbox they concern so the log can be
+-- filtered without going through usage_events, which only metered calls
+-- have. Older rows get their org from their usage event, where there is one.
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS org_id uuid;
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS inbox_id text NOT NULL DEFAULT '';
+UPDATE audit_log a SET org_id = ue.org_id
+FROM usage_events ue
+WHERE ue.audit_id = a.tool_call_id AND a.org_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_audit_log_org_created ON audit_log(org_id, created_at, id);
+
+-- Reconciliation deletes an org's audit entries older than its plan's
+-- audit_retention_days; 0 keeps them forever.
+ALTER TABLE plan_entitlements ADD COLUMN IF NOT EXISTS audit_retention_days int NOT NULL DEFAULT 0;
+ALTER TABLE reconciliation_reports ADD COLUMN IF NOT EXISTS audit_pruned bigint NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE reconciliation_reports DROP COLUMN IF EXISTS audit_pruned;
+ALTER TABLE plan_entitlements DROP COLUMN IF EXISTS audit_retention_days;
+DROP INDEX IF EXISTS idx_audit_log_org_created;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS inbox_id;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS org_id;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- A merged org is kept, emptied, as a pointer to the org it was merged
+-- into, so Stripe events still naming it reach the right org.
+ALTER TABLE orgs ADD COLUMN IF NOT EXISTS merged_into uuid REFERENCES orgs(id);
+ALTER TABLE orgs ADD COLUMN IF NOT EXISTS merged_at timestamptz;
+
+CREATE TABLE IF NOT EXISTS org_merges (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  source_org_id uuid NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  target_org_id uuid NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  actor text NOT NULL DEFAULT '',
+  report jsonb NOT NULL DEFAULT '{}',
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS org_merges;
+ALTER TABLE orgs DROP COLUMN IF EXISTS merged_at;
+ALTER TABLE orgs DROP COLUMN IF EXISTS merged_into;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- The arguments and result of an MCP tool call, kept so the call can be
+-- replayed. redacted_at is set once they have been wiped.
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS inputs jsonb;
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS outputs jsonb;
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS redacted_at timestamptz;
+CREATE INDEX IF NOT EXISTS idx_audit_log_replay ON audit_log(replay_id) WHERE replay_id IS NOT NULL AND replay_id <> '';
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_audit_log_replay;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS redacted_at;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS outputs;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS inputs;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Second-tier MCP rate limits, per credential and per client IP, under the
+-- org-wide mcp_rpm. 0 leaves the dimension unlimited.
+ALTER TABLE plan_entitlements ADD COLUMN IF NOT EXISTS token_rpm int NOT NULL DEFAULT 0;
+ALTER TABLE plan_entitlements ADD COLUMN IF NOT EXISTS ip_rpm int NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE plan_entitlements DROP COLUMN IF EXISTS ip_rpm;
+ALTER TABLE plan_entitlements DROP COLUMN IF EXISTS token_rpm;
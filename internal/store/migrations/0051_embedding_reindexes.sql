@@ -0,0 +1,25 @@
+-- +goose Up
+-- One row per re-index of a region's messages into a fresh Qdrant
+-- collection. The cursor is the last message embedded, so an interrupted run
+-- resumes where it stopped; at most one run per region and alias is open.
+CREATE TABLE IF NOT EXISTS embedding_reindexes (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  region text NOT NULL,
+  alias text NOT NULL,
+  collection text NOT NULL,
+  model text NOT NULL,
+  dim int NOT NULL,
+  cursor_created_at timestamptz,
+  cursor_id uuid,
+  embedded bigint NOT NULL DEFAULT 0,
+  skipped bigint NOT NULL DEFAULT 0,
+  started_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  swapped_at timestamptz,
+  abandoned_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_embedding_reindexes_open
+  ON embedding_reindexes(region, alias) WHERE swapped_at IS NULL AND abandoned_at IS NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS embedding_reindexes;
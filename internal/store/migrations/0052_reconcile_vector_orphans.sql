@@ -0,0 +1,7 @@
+-- +goose Up
+-- Reconciliation deletes vector points whose thread no longer exists and
+-- records how many it found.
+ALTER TABLE reconciliation_reports ADD COLUMN IF NOT EXISTS vector_orphans bigint NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE reconciliation_reports DROP COLUMN IF EXISTS vector_orphans;
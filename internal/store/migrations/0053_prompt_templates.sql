@@ -0,0 +1,36 @@
+-- +goose Up
+-- Versioned system prompts an org sets for its tools. A tool without an
+-- active version uses the built-in prompt; versions are never edited, so a
+-- tool call's recorded prompt_version names the exact text it ran with.
+CREATE TABLE IF NOT EXISTS prompt_templates (
+  id uuid PRIMARY KEY,
+  org_id uuid NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  tool_name text NOT NULL,
+  version int NOT NULL CHECK (version > 0),
+  body text NOT NULL,
+  note text NOT NULL DEFAULT '',
+  created_by text NOT NULL DEFAULT '',
+  active boolean NOT NULL DEFAULT false,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  activated_at timestamptz,
+  UNIQUE (org_id, tool_name, version)
+);
+
+CREATE INDEX IF NOT EXISTS prompt_templates_active_idx ON prompt_templates (org_id, tool_name) WHERE active;
+
+ALTER TABLE prompt_templates ENABLE ROW LEVEL SECURITY;
+ALTER TABLE prompt_templates FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_prompt_templates ON prompt_templates
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_prompt_templates ON prompt_templates;
+DROP TABLE IF EXISTS prompt_templates;
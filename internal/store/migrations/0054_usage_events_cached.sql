@@ -0,0 +1,7 @@
+-- +goose Up
+-- Tool calls answered from the model response cache, charged the cached unit
+-- cost instead of the tool's weight.
+ALTER TABLE usage_events ADD COLUMN IF NOT EXISTS cached boolean NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE usage_events DROP COLUMN IF EXISTS cached;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- model_tokens split into the prompt and completion tokens behind it, which
+-- providers bill at different rates.
+ALTER TABLE tool_calls ADD COLUMN IF NOT EXISTS prompt_tokens int NOT NULL DEFAULT 0;
+ALTER TABLE tool_calls ADD COLUMN IF NOT EXISTS completion_tokens int NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE tool_calls DROP COLUMN IF EXISTS completion_tokens;
+ALTER TABLE tool_calls DROP COLUMN IF EXISTS prompt_tokens;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- summarize_thread keeps its latest summary on the thread, with the message
+-- it had read up to so a later call can tell whether it is stale.
+ALTER TABLE threads ADD COLUMN IF NOT EXISTS summary jsonb;
+ALTER TABLE threads ADD COLUMN IF NOT EXISTS summary_model text NOT NULL DEFAULT '';
+ALTER TABLE threads ADD COLUMN IF NOT EXISTS summary_message_id uuid;
+ALTER TABLE threads ADD COLUMN IF NOT EXISTS summary_message_count int NOT NULL DEFAULT 0;
+ALTER TABLE threads ADD COLUMN IF NOT EXISTS summarized_at timestamptz;
+
+-- +goose Down
+ALTER TABLE threads DROP COLUMN IF EXISTS summarized_at;
+ALTER TABLE threads DROP COLUMN IF EXISTS summary_message_count;
+ALTER TABLE threads DROP COLUMN IF EXISTS summary_message_id;
+ALTER TABLE threads DROP COLUMN IF EXISTS summary_model;
+ALTER TABLE threads DROP COLUMN IF EXISTS summary;
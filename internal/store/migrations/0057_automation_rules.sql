@@ -0,0 +1,67 @@
+-- +goose Up
+-- Org-defined automation rules, run on each new inbound message: filters on
+-- the message, conditions on its triage, then actions on its thread. A dry
+-- run rule only records what it would have done.
+CREATE TABLE IF NOT EXISTS automation_rules (
+  id uuid PRIMARY KEY,
+  org_id uuid NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  inbox_id uuid REFERENCES inboxes(id) ON DELETE CASCADE,
+  name text NOT NULL,
+  position int NOT NULL DEFAULT 0,
+  enabled boolean NOT NULL DEFAULT true,
+  dry_run boolean NOT NULL DEFAULT false,
+  filters jsonb NOT NULL DEFAULT '{}'::jsonb,
+  conditions jsonb NOT NULL DEFAULT '{}'::jsonb,
+  actions jsonb NOT NULL DEFAULT '[]'::jsonb,
+  created_by text NOT NULL DEFAULT '',
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS automation_rules_org_idx ON automation_rules (org_id, position);
+
+-- One row per rule that matched a message, with what each action did.
+CREATE TABLE IF NOT EXISTS automation_rule_runs (
+  id uuid PRIMARY KEY,
+  org_id uuid NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  rule_id uuid NOT NULL REFERENCES automation_rules(id) ON DELETE CASCADE,
+  message_id uuid NOT NULL,
+  thread_id uuid NOT NULL,
+  dry_run boolean NOT NULL,
+  actions jsonb NOT NULL DEFAULT '[]'::jsonb,
+  error text NOT NULL DEFAULT '',
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS automation_rule_runs_rule_idx ON automation_rule_runs (rule_id, created_at DESC);
+
+ALTER TABLE automation_rules ENABLE ROW LEVEL SECURITY;
+ALTER TABLE automation_rules FORCE ROW LEVEL SECURITY;
+ALTER TABLE automation_rule_runs ENABLE ROW LEVEL SECURITY;
+ALTER TABLE automation_rule_runs FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_automation_rules ON automation_rules
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+CREATE POLICY tenant_isolation_automation_rule_runs ON automation_rule_runs
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_automation_rule_runs ON automation_rule_runs;
+DROP POLICY IF EXISTS tenant_isolation_automation_rules ON automation_rules;
+DROP TABLE IF EXISTS automation_rule_runs;
+DROP TABLE IF EXISTS automation_rules;
@@ -0,0 +1,82 @@
+-- +goose Up
+-- The people who write to an org, built up from inbound mail as it is
+-- ingested. contact_key is the lowercased address without a +tag, so
+-- ana+orders@ and ana@ are one contact with both addresses in emails.
+CREATE TABLE IF NOT EXISTS contacts (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  org_id uuid NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  contact_key text NOT NULL,
+  name text NOT NULL DEFAULT '',
+  emails text[] NOT NULL DEFAULT '{}',
+  first_seen_at timestamptz NOT NULL,
+  last_seen_at timestamptz NOT NULL,
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  UNIQUE (org_id, contact_key)
+);
+
+-- The threads each contact has written on.
+CREATE TABLE IF NOT EXISTS contact_threads (
+  contact_id uuid NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+  thread_id uuid NOT NULL REFERENCES threads(id) ON DELETE CASCADE,
+  org_id uuid NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  first_seen_at timestamptz NOT NULL,
+  last_seen_at timestamptz NOT NULL,
+  PRIMARY KEY (contact_id, thread_id)
+);
+
+CREATE INDEX IF NOT EXISTS contact_threads_thread_idx ON contact_threads (thread_id);
+
+-- Contacts for the mail already stored.
+INSERT INTO contacts (org_id, contact_key, name, emails, first_seen_at, last_seen_at)
+SELECT org_id, contact_key,
+       coalesce((array_agg(name ORDER BY created_at DESC) FILTER (WHERE name <> ''))[1], ''),
+       array_agg(DISTINCT email), min(created_at), max(created_at)
+FROM (
+  SELECT org_id, lower(from_json->>'email') AS email,
+         regexp_replace(lower(from_json->>'email'), '\+[^@]*@', '@') AS contact_key,
+         coalesce(from_json->>'name', '') AS name, created_at
+  FROM messages
+  WHERE direction = 'inbound' AND coalesce(from_json->>'email', '') <> '' AND coalesce(auto_submitted, '') = ''
+) m
+GROUP BY org_id, contact_key
+ON CONFLICT (org_id, contact_key) DO NOTHING;
+
+INSERT INTO contact_threads (contact_id, thread_id, org_id, first_seen_at, last_seen_at)
+SELECT c.id, m.thread_id, m.org_id, min(m.created_at), max(m.created_at)
+FROM messages m
+JOIN contacts c ON c.org_id = m.org_id
+  AND c.contact_key = regexp_replace(lower(m.from_json->>'email'), '\+[^@]*@', '@')
+WHERE m.direction = 'inbound' AND coalesce(m.auto_submitted, '') = ''
+GROUP BY c.id, m.thread_id, m.org_id
+ON CONFLICT (contact_id, thread_id) DO NOTHING;
+
+ALTER TABLE contacts ENABLE ROW LEVEL SECURITY;
+ALTER TABLE contacts FORCE ROW LEVEL SECURITY;
+ALTER TABLE contact_threads ENABLE ROW LEVEL SECURITY;
+ALTER TABLE contact_threads FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_contacts ON contacts
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+CREATE POLICY tenant_isolation_contact_threads ON contact_threads
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_contact_threads ON contact_threads;
+DROP POLICY IF EXISTS tenant_isolation_contacts ON contacts;
+DROP TABLE IF EXISTS contact_threads;
+DROP TABLE IF EXISTS contacts;
@@ -0,0 +1,63 @@
+-- +goose Up
+-- One CRM account per org. Triaged threads whose intent is one of the case
+-- intents are filed in it; empty intent lists use the built-in defaults.
+CREATE TABLE IF NOT EXISTS crm_connections (
+  org_id uuid PRIMARY KEY REFERENCES orgs(id) ON DELETE CASCADE,
+  provider text NOT NULL CHECK (provider IN ('hubspot')),
+  access_token text NOT NULL,
+  sales_intents text[] NOT NULL DEFAULT '{}',
+  support_intents text[] NOT NULL DEFAULT '{}',
+  ticket_pipeline text NOT NULL DEFAULT '',
+  ticket_stage text NOT NULL DEFAULT '',
+  created_by text NOT NULL DEFAULT '',
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- The CRM contact and ticket a thread is filed as, by triage or by hand.
+CREATE TABLE IF NOT EXISTS crm_links (
+  thread_id uuid PRIMARY KEY REFERENCES threads(id) ON DELETE CASCADE,
+  org_id uuid NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  provider text NOT NULL,
+  kind text NOT NULL,
+  contact_id text NOT NULL DEFAULT '',
+  ticket_id text NOT NULL,
+  priority text NOT NULL DEFAULT '',
+  linked_by text NOT NULL DEFAULT '',
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS crm_links_ticket_idx ON crm_links (org_id, ticket_id);
+
+ALTER TABLE crm_connections ENABLE ROW LEVEL SECURITY;
+ALTER TABLE crm_connections FORCE ROW LEVEL SECURITY;
+ALTER TABLE crm_links ENABLE ROW LEVEL SECURITY;
+ALTER TABLE crm_links FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_crm_connections ON crm_connections
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+CREATE POLICY tenant_isolation_crm_links ON crm_links
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_crm_links ON crm_links;
+DROP POLICY IF EXISTS tenant_isolation_crm_connections ON crm_connections;
+DROP INDEX IF EXISTS crm_links_ticket_idx;
+DROP TABLE IF EXISTS crm_links;
+DROP TABLE IF EXISTS crm_connections;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- The knowledge base chunks a draft was written from, so revisions can
+-- cite them as well as the thread's messages.
+ALTER TABLE drafts
+  ADD COLUMN IF NOT EXISTS source_chunk_ids text[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE drafts
+  DROP COLUMN IF EXISTS source_chunk_ids;
@@ -0,0 +1,34 @@
+-- +goose Up
+-- Each org's own policy rules, one row per saved version. The highest
+-- version is the one in force; older ones stay as history.
+CREATE TABLE IF NOT EXISTS org_policy_versions (
+  org_id uuid NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  version int NOT NULL,
+  rules jsonb NOT NULL DEFAULT '[]',
+  note text NOT NULL DEFAULT '',
+  created_by text NOT NULL DEFAULT '',
+  created_at timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (org_id, version)
+);
+
+-- The org policy version each draft revision was checked against.
+ALTER TABLE draft_revisions
+  ADD COLUMN IF NOT EXISTS org_policy_version int NOT NULL DEFAULT 0;
+
+ALTER TABLE org_policy_versions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE org_policy_versions FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_org_policy_versions ON org_policy_versions
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_org_policy_versions ON org_policy_versions;
+ALTER TABLE draft_revisions DROP COLUMN IF EXISTS org_policy_version;
+DROP TABLE IF EXISTS org_policy_versions;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- The classes of personal data found in each message's subject and text
+-- when it was stored (see internal/pii). Messages stored before this
+-- migration are not scanned and keep an empty list.
+ALTER TABLE messages
+  ADD COLUMN IF NOT EXISTS pii_classes text[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE messages
+  DROP COLUMN IF EXISTS pii_classes;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- Requested org deletions. The org is purged once purge_after passes unless
+-- the request is canceled first. The row has no foreign key so it outlives
+-- the org as the record of when and at whose request it was purged.
+CREATE TABLE IF NOT EXISTS org_deletions (
+  org_id uuid PRIMARY KEY,
+  requested_by text NOT NULL DEFAULT '',
+  requested_at timestamptz NOT NULL DEFAULT now(),
+  purge_after timestamptz NOT NULL,
+  canceled_at timestamptz,
+  purged_at timestamptz,
+  receipt jsonb
+);
+
+CREATE INDEX IF NOT EXISTS idx_org_deletions_due ON org_deletions(purge_after)
+  WHERE canceled_at IS NULL AND purged_at IS NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS org_deletions;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Keyset pages of an inbox's threads walk (updated_at, id) newest first,
+-- and pages of a thread's messages walk (created_at, id) oldest first.
+CREATE INDEX IF NOT EXISTS idx_threads_inbox_updated_id ON threads(inbox_id, updated_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_messages_thread_created_id ON messages(thread_id, created_at, id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_messages_thread_created_id;
+DROP INDEX IF EXISTS idx_threads_inbox_updated_id;
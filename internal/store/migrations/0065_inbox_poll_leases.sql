@@ -0,0 +1,13 @@
+-- +goose Up
+-- One serve replica at a time polls an inbox: the holder renews its lease
+-- each tick, and any replica may take over once expires_at has passed.
+CREATE TABLE IF NOT EXISTS inbox_poll_leases (
+  inbox_id uuid PRIMARY KEY REFERENCES inboxes(id) ON DELETE CASCADE,
+  holder text NOT NULL,
+  acquired_at timestamptz NOT NULL DEFAULT now(),
+  renewed_at timestamptz NOT NULL DEFAULT now(),
+  expires_at timestamptz NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS inbox_poll_leases;
@@ -0,0 +1,65 @@
+-- +goose Up
+-- How polling each inbox is going, as the replica polling it last recorded.
+CREATE TABLE IF NOT EXISTS inbox_sync_status (
+  inbox_id uuid PRIMARY KEY REFERENCES inboxes(id) ON DELETE CASCADE,
+  org_id uuid REFERENCES orgs(id) ON DELETE CASCADE,
+  polled_by text NOT NULL DEFAULT '',
+  last_poll_at timestamptz,
+  last_success_at timestamptz,
+  last_error text NOT NULL DEFAULT '',
+  -- Polls failed since the last success.
+  consecutive_failures integer NOT NULL DEFAULT 0
+);
+
+-- Requests to ingest an inbox's mail received between since and until. The
+-- replica polling the inbox runs them; cursor is the provider's position
+-- within the range, so an interrupted backfill resumes where it stopped.
+CREATE TABLE IF NOT EXISTS inbox_backfills (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  inbox_id uuid NOT NULL REFERENCES inboxes(id) ON DELETE CASCADE,
+  org_id uuid REFERENCES orgs(id) ON DELETE CASCADE,
+  since timestamptz NOT NULL,
+  until timestamptz NOT NULL,
+  status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'done', 'failed')),
+  cursor text NOT NULL DEFAULT '',
+  fetched bigint NOT NULL DEFAULT 0,
+  error text NOT NULL DEFAULT '',
+  requested_by text NOT NULL DEFAULT '',
+  created_at timestamptz NOT NULL DEFAULT now(),
+  started_at timestamptz,
+  finished_at timestamptz,
+  CHECK (since < until)
+);
+
+CREATE INDEX IF NOT EXISTS inbox_backfills_inbox_idx ON inbox_backfills (inbox_id, created_at DESC);
+
+ALTER TABLE inbox_sync_status ENABLE ROW LEVEL SECURITY;
+ALTER TABLE inbox_sync_status FORCE ROW LEVEL SECURITY;
+ALTER TABLE inbox_backfills ENABLE ROW LEVEL SECURITY;
+ALTER TABLE inbox_backfills FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_inbox_sync_status ON inbox_sync_status
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+CREATE POLICY tenant_isolation_inbox_backfills ON inbox_backfills
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_inbox_backfills ON inbox_backfills;
+DROP POLICY IF EXISTS tenant_isolation_inbox_sync_status ON inbox_sync_status;
+DROP TABLE IF EXISTS inbox_backfills;
+DROP TABLE IF EXISTS inbox_sync_status;
@@ -0,0 +1,49 @@
+-- +goose Up
+-- DKIM signing keys of org domains. A domain has at most one active key,
+-- which org_domains.dkim_* mirror for the send path, and at most one pending
+-- key, waiting for its DNS record before it takes over. A replaced key is
+-- retiring until retire_at, so mail signed with it still verifies, then
+-- retired.
+CREATE TABLE IF NOT EXISTS org_domain_dkim_keys (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  domain_id uuid NOT NULL REFERENCES org_domains(id) ON DELETE CASCADE,
+  org_id uuid REFERENCES orgs(id) ON DELETE CASCADE,
+  selector text NOT NULL,
+  private_key_enc text NOT NULL,
+  public_key text NOT NULL,
+  status text NOT NULL CHECK (status IN ('pending', 'active', 'retiring', 'retired')),
+  -- How long the key it replaces keeps retiring once this one is active.
+  overlap_seconds bigint NOT NULL DEFAULT 0,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  activated_at timestamptz,
+  retire_at timestamptz,
+  retired_at timestamptz,
+  UNIQUE (domain_id, selector)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS org_domain_dkim_keys_pending_idx
+  ON org_domain_dkim_keys (domain_id) WHERE status = 'pending';
+
+-- Keys generated before this table keep signing.
+INSERT INTO org_domain_dkim_keys (domain_id, org_id, selector, private_key_enc, public_key, status, activated_at)
+SELECT id, org_id, dkim_selector, dkim_private_key_enc, coalesce(dkim_public_key, ''), 'active', coalesce(verified_at, created_at)
+FROM org_domains
+WHERE dkim_private_key_enc IS NOT NULL
+ON CONFLICT (domain_id, selector) DO NOTHING;
+
+ALTER TABLE org_domain_dkim_keys ENABLE ROW LEVEL SECURITY;
+ALTER TABLE org_domain_dkim_keys FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_org_domain_dkim_keys ON org_domain_dkim_keys
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_org_domain_dkim_keys ON org_domain_dkim_keys;
+DROP TABLE IF EXISTS org_domain_dkim_keys;
@@ -0,0 +1,37 @@
+-- +goose Up
+ALTER TABLE org_domains ADD COLUMN IF NOT EXISTS plus_addressing boolean NOT NULL DEFAULT true;
+ALTER TABLE org_domains ADD COLUMN IF NOT EXISTS catch_all_inbox_id uuid REFERENCES inboxes(id) ON DELETE SET NULL;
+
+CREATE TABLE IF NOT EXISTS inbound_routing_decisions (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  org_id uuid REFERENCES orgs(id) ON DELETE CASCADE,
+  provider text NOT NULL,
+  message_id text NOT NULL DEFAULT '',
+  recipient text NOT NULL,
+  rule text NOT NULL CHECK (rule IN ('exact', 'alias', 'plus', 'catch_all', 'dropped')),
+  inbox_id uuid REFERENCES inboxes(id) ON DELETE SET NULL,
+  matched_address text NOT NULL DEFAULT '',
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS inbound_routing_decisions_org_created_idx
+  ON inbound_routing_decisions (org_id, created_at DESC);
+
+ALTER TABLE inbound_routing_decisions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE inbound_routing_decisions FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation_inbound_routing_decisions ON inbound_routing_decisions
+  USING (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  )
+  WITH CHECK (
+    coalesce(current_setting('app.cloud_mode', true), 'false') <> 'true'
+    OR org_id = nullif(current_setting('app.current_org_id', true), '')::uuid
+  );
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation_inbound_routing_decisions ON inbound_routing_decisions;
+DROP TABLE IF EXISTS inbound_routing_decisions;
+ALTER TABLE org_domains DROP COLUMN IF EXISTS catch_all_inbox_id;
+ALTER TABLE org_domains DROP COLUMN IF EXISTS plus_addressing;
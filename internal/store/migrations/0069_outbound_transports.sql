@@ -0,0 +1,29 @@
+-- +goose Up
+-- Outbound mail can leave through a provider API rather than the SMTP relay.
+-- An org picks one for all its mail and a domain for its own; empty falls
+-- back to the next level, then to outbound.transport.
+ALTER TABLE orgs ADD COLUMN IF NOT EXISTS outbound_transport text NOT NULL DEFAULT '';
+ALTER TABLE org_domains ADD COLUMN IF NOT EXISTS outbound_transport text NOT NULL DEFAULT '';
+
+-- Each delivery keeps the transport it went out through and the ID the
+-- provider gave it, which the provider's delivery events quote.
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS transport text NOT NULL DEFAULT '';
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS provider_message_id text NOT NULL DEFAULT '';
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS delivered_at timestamptz;
+CREATE INDEX IF NOT EXISTS idx_outbox_provider_message ON outbox(transport, provider_message_id) WHERE provider_message_id <> '';
+
+ALTER TABLE outbox DROP CONSTRAINT IF EXISTS outbox_status_check;
+ALTER TABLE outbox ADD CONSTRAINT outbox_status_check
+  CHECK (status IN ('queued', 'sent', 'delivered', 'bounced', 'failed', 'complained'));
+
+-- +goose Down
+UPDATE outbox SET status = 'sent' WHERE status = 'delivered';
+ALTER TABLE outbox DROP CONSTRAINT IF EXISTS outbox_status_check;
+ALTER TABLE outbox ADD CONSTRAINT outbox_status_check
+  CHECK (status IN ('queued', 'sent', 'bounced', 'failed', 'complained'));
+DROP INDEX IF EXISTS idx_outbox_provider_message;
+ALTER TABLE outbox DROP COLUMN IF EXISTS delivered_at;
+ALTER TABLE outbox DROP COLUMN IF EXISTS provider_message_id;
+ALTER TABLE outbox DROP COLUMN IF EXISTS transport;
+ALTER TABLE org_domains DROP COLUMN IF EXISTS outbound_transport;
+ALTER TABLE orgs DROP COLUMN IF EXISTS outbound_transport;
@@ -0,0 +1,24 @@
+-- +goose Up
+-- Sending limits: an org's own messages per hour and recipients per day,
+-- null for outbound defaults; a domain's, null for none beyond the org's.
+-- 0 is unlimited.
+ALTER TABLE orgs ADD COLUMN IF NOT EXISTS send_limit_hourly_messages int CHECK (send_limit_hourly_messages >= 0);
+ALTER TABLE orgs ADD COLUMN IF NOT EXISTS send_limit_daily_recipients int CHECK (send_limit_daily_recipients >= 0);
+ALTER TABLE org_domains ADD COLUMN IF NOT EXISTS send_limit_hourly_messages int CHECK (send_limit_hourly_messages >= 0);
+ALTER TABLE org_domains ADD COLUMN IF NOT EXISTS send_limit_daily_recipients int CHECK (send_limit_daily_recipients >= 0);
+
+-- A domain's warm-up runs from when it first went active. Domains already
+-- active count from their registration, so ones that have been sending are
+-- not ramped again.
+ALTER TABLE org_domains ADD COLUMN IF NOT EXISTS warmup_started_at timestamptz;
+UPDATE org_domains SET warmup_started_at = created_at WHERE status = 'active' AND warmup_started_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_outbox_org_created ON outbox(org_id, created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_outbox_org_created;
+ALTER TABLE org_domains DROP COLUMN IF EXISTS warmup_started_at;
+ALTER TABLE org_domains DROP COLUMN IF EXISTS send_limit_daily_recipients;
+ALTER TABLE org_domains DROP COLUMN IF EXISTS send_limit_hourly_messages;
+ALTER TABLE orgs DROP COLUMN IF EXISTS send_limit_daily_recipients;
+ALTER TABLE orgs DROP COLUMN IF EXISTS send_limit_hourly_messages;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- Gmail grants are stored encrypted with security.token_encryption_key.
+-- Grants stored before hold plaintext and are marked unsealed; the Gmail
+-- client seals them the next time it refreshes the access token, which the
+-- cleared cache below forces on the next poll.
+ALTER TABLE inbox_oauth_tokens ADD COLUMN IF NOT EXISTS sealed boolean NOT NULL DEFAULT false;
+UPDATE inbox_oauth_tokens SET access_token = '', access_token_expires_at = NULL WHERE NOT sealed;
+
+-- +goose Down
+-- Code before this migration reads tokens as plaintext; sealed grants have
+-- to be connected again.
+DELETE FROM inbox_oauth_tokens WHERE sealed;
+ALTER TABLE inbox_oauth_tokens DROP COLUMN IF EXISTS sealed;
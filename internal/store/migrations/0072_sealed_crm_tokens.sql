@@ -0,0 +1,11 @@
+-- +goose Up
+-- CRM access tokens are stored encrypted with security.token_encryption_key.
+-- Tokens stored before hold plaintext and are marked unsealed; the CRM
+-- bridge seals them the next time it uses them.
+ALTER TABLE crm_connections ADD COLUMN IF NOT EXISTS sealed boolean NOT NULL DEFAULT false;
+
+-- +goose Down
+-- Code before this migration reads tokens as plaintext; sealed connections
+-- have to be connected again.
+DELETE FROM crm_connections WHERE sealed;
+ALTER TABLE crm_connections DROP COLUMN IF EXISTS sealed;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- A consent callback only carries the state, which whoever started the flow
+-- can hand to someone else. The grant it returns waits on the state row,
+-- sealed, until the org that started the flow confirms the account.
+ALTER TABLE oauth_connect_states
+  ADD COLUMN IF NOT EXISTS account_email text,
+  ADD COLUMN IF NOT EXISTS refresh_token text,
+  ADD COLUMN IF NOT EXISTS access_token text,
+  ADD COLUMN IF NOT EXISTS access_token_expires_at timestamptz,
+  ADD COLUMN IF NOT EXISTS scopes text[],
+  ADD COLUMN IF NOT EXISTS consented_at timestamptz;
+
+-- +goose Down
+ALTER TABLE oauth_connect_states
+  DROP COLUMN IF EXISTS consented_at,
+  DROP COLUMN IF EXISTS scopes,
+  DROP COLUMN IF EXISTS access_token_expires_at,
+  DROP COLUMN IF EXISTS access_token,
+  DROP COLUMN IF EXISTS refresh_token,
+  DROP COLUMN IF EXISTS account_email;
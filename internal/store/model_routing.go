@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// LLMRoutes are the model routes, task to "provider:model" refs in fallback
+// order, that an org set and that its plan carries.
+type LLMRoutes struct {
+	Org  map[string][]string
+	Plan map[string][]string
+}
+
+// Merged returns the routes in effect: the org's for each task it set, the
+// plan's for the rest.
+func (r LLMRoutes) Merged() map[string][]string {
+	out := map[string][]string{}
+	for task, refs := range r.Plan {
+		out[task] = refs
+	}
+	for task, refs := range r.Org {
+		out[task] = refs
+	}
+	return out
+}
+
+// GetOrgLLMRoutes returns an org's routes and its plan's, or sql.ErrNoRows
+// for an unknown org. An org without an entitlement has no plan routes.
+func (s *Store) GetOrgLLMRoutes(ctx context.Context, orgID string) (LLMRoutes, error) {
+	var orgRaw, planRaw []byte
+	err := s.q.QueryRowContext(ctx, `
+		SELECT o.llm_routes, coalesce(p.llm_routes, '{}'::jsonb)
+		FROM orgs o
+		LEFT JOIN org_entitlements e ON e.org_id = o.id
+		LEFT JOIN plan_entitlements p ON p.plan_code = e.plan_code
+		WHERE o.id = $1
+	`, orgID).Scan(&orgRaw, &planRaw)
+	if err != nil {
+		return LLMRoutes{}, err
+	}
+	routes := LLMRoutes{Org: map[string][]string{}, Plan: map[string][]string{}}
+	if err := json.Unmarshal(orgRaw, &routes.Org); err != nil {
+		return LLMRoutes{}, fmt.Errorf("org %s llm_routes: %w", orgID, err)
+	}
+	if err := json.Unmarshal(planRaw, &routes.Plan); err != nil {
+		return LLMRoutes{}, fmt.Errorf("org %s plan llm_routes: %w", orgID, err)
+	}
+	return routes, nil
+}
+
+// SetOrgLLMRoutes replaces an org's own routes; unknown orgs return
+// sql.ErrNoRows.
+func (s *Store) SetOrgLLMRoutes(ctx context.Context, orgID string, routes map[string][]string) error {
+	if routes == nil {
+		routes = map[string][]string{}
+	}
+	raw, err := json.Marshal(routes)
+	if err != nil {
+		return err
+	}
+	var id string
+	return s.q.QueryRowContext(ctx, `
+		UPDATE orgs SET llm_routes = $2::jsonb, updated_at = now() WHERE id = $1 RETURNING id
+	`, orgID, string(raw)).Scan(&id)
+}
+
+// ToolCallModels is what the models behind one tool call did. Tokens is
+// the sum of PromptTokens and CompletionTokens.
+type ToolCallModels struct {
+	Model     string
+	Task      string
+	Calls     int
+	Fallbacks int
+	Errors    int
+	Tokens    int
+	CostUSD   float64
+
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// RecordToolCallModels attaches model metrics to a recorded tool call.
+func (s *Store) RecordToolCallModels(ctx context.Context, toolCallID string, m ToolCallModels) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE tool_calls
+		SET model_name = $2, model_task = $3, model_calls = $4, model_fallbacks = $5,
+		    model_errors = $6, model_tokens = $7, model_cost_usd = $8,
+		    prompt_tokens = $9, completion_tokens = $10
+		WHERE id = $1
+	`, toolCallID, m.Model, m.Task, m.Calls, m.Fallbacks, m.Errors, m.Tokens, m.CostUSD, m.PromptTokens, m.CompletionTokens)
+	return err
+}
+
+// ModelStats sums the tool calls a model served for one task. Citation
+// coverage, a draft quality signal, averages over the calls that report it.
+type ModelStats struct {
+	Model            string
+	Task             string
+	ToolCalls        int64
+	ModelCalls       int64
+	Fallbacks        int64
+	Errors           int64
+	Tokens           int64
+	CostUSD          float64
+	AvgLatencyMS     float64
+	CitationCoverage *float64
+}
+
+// ListModelStats groups tool calls made since the cutoff that used a model
+// by model and task, costliest first.
+func (s *Store) ListModelStats(ctx context.Context, since time.Time) ([]ModelStats, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT t.model_name, t.model_task, count(*),
+		       coalesce(sum(t.model_calls), 0), coalesce(sum(t.model_fallbacks), 0),
+		       coalesce(sum(t.model_errors), 0), coalesce(sum(t.model_tokens), 0),
+		       coalesce(sum(t.model_cost_usd), 0), coalesce(avg(t.latency_ms), 0),
+		       avg(a.citation_coverage)
+		FROM tool_calls t
+		LEFT JOIN audit_log a ON a.tool_call_id = t.id
+		WHERE t.created_at >= $1 AND t.model_calls > 0
+		GROUP BY t.model_name, t.model_task
+		ORDER BY sum(t.model_cost_usd) DESC, count(*) DESC
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ModelStats
+	for rows.Next() {
+		var m ModelStats
+		if err := rows.Scan(&m.Model, &m.Task, &m.ToolCalls, &m.ModelCalls, &m.Fallbacks, &m.Errors,
+			&m.Tokens, &m.CostUSD, &m.AvgLatencyMS, &m.CitationCoverage); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// NotificationPreference says how often events of EventType ("*" for all)
+// reach a channel. UserID "" marks the org's default.
+type NotificationPreference struct {
+	OrgID     string
+	UserID    string
+	EventType string
+	Channel   string
+	Frequency string
+	UpdatedAt time.Time
+}
+
+// ListNotificationPreferences returns the org's defaults and, for a non-empty
+// userID, that user's own preferences, org defaults first.
+func (s *Store) ListNotificationPreferences(ctx context.Context, orgID string, userID string) ([]NotificationPreference, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT org_id, user_id, event_type, channel, frequency, updated_at
+		FROM notification_preferences
+		WHERE org_id = $1 AND user_id IN ('', $2)
+		ORDER BY user_id, event_type, channel
+	`, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []NotificationPreference
+	for rows.Next() {
+		var p NotificationPreference
+		if err := rows.Scan(&p.OrgID, &p.UserID, &p.EventType, &p.Channel, &p.Frequency, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// SetNotificationPreference creates or replaces one preference.
+func (s *Store) SetNotificationPreference(ctx context.Context, p NotificationPreference) (NotificationPreference, error) {
+	err := s.q.QueryRowContext(ctx, `
+		INSERT INTO notification_preferences (org_id, user_id, event_type, channel, frequency)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (org_id, user_id, event_type, channel) DO UPDATE SET
+			frequency = EXCLUDED.frequency,
+			updated_at = now()
+		RETURNING updated_at
+	`, p.OrgID, p.UserID, p.EventType, p.Channel, p.Frequency).Scan(&p.UpdatedAt)
+	return p, err
+}
+
+// DeleteNotificationPreference removes one preference so the next broader
+// one applies again. It reports false if there was none.
+func (s *Store) DeleteNotificationPreference(ctx context.Context, orgID string, userID string, eventType string, channel string) (bool, error) {
+	res, err := s.q.ExecContext(ctx, `
+		DELETE FROM notification_preferences
+		WHERE org_id = $1 AND user_id = $2 AND event_type = $3 AND channel = $4
+	`, orgID, userID, eventType, channel)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
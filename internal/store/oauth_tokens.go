@@ -0,0 +1,209 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// InboxOAuthToken is an inbox's OAuth grant. The tokens are stored as the
+// connector sealed them (see gmailapi) and only it opens them; Sealed is
+// false for a grant stored in plaintext before grants were encrypted.
+type InboxOAuthToken struct {
+	InboxID         string
+	OrgID           string
+	Provider        string
+	AccountEmail    string
+	RefreshToken    string
+	AccessToken     string
+	AccessExpiresAt time.Time
+	Scopes          []string
+	Sealed          bool
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+type OAuthConnectState struct {
+	State     string
+	OrgID     string
+	InboxID   string
+	Provider  string
+	ExpiresAt time.Time
+}
+
+// UpsertInboxOAuthToken stores a fresh grant, replacing any earlier one for
+// the inbox (e.g. after the user reconnects a different account).
+func (s *Store) UpsertInboxOAuthToken(ctx context.Context, tok InboxOAuthToken) error {
+	var expiresAt any
+	if !tok.AccessExpiresAt.IsZero() {
+		expiresAt = tok.AccessExpiresAt
+	}
+	scopes := tok.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO inbox_oauth_tokens (inbox_id, org_id, provider, account_email, refresh_token, access_token, access_token_expires_at, scopes, sealed)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (inbox_id) DO UPDATE SET
+			org_id = EXCLUDED.org_id,
+			provider = EXCLUDED.provider,
+			account_email = EXCLUDED.account_email,
+			refresh_token = EXCLUDED.refresh_token,
+			access_token = EXCLUDED.access_token,
+			access_token_expires_at = EXCLUDED.access_token_expires_at,
+			scopes = EXCLUDED.scopes,
+			sealed = EXCLUDED.sealed,
+			updated_at = now()
+	`, tok.InboxID, tok.OrgID, tok.Provider, tok.AccountEmail, tok.RefreshToken, tok.AccessToken, expiresAt, scopes, tok.Sealed)
+	return err
+}
+
+func (s *Store) GetInboxOAuthToken(ctx context.Context, inboxID string) (InboxOAuthToken, error) {
+	var tok InboxOAuthToken
+	var expiresAt sql.NullTime
+	var scopesJSON []byte
+	row := s.q.QueryRowContext(ctx, `
+		SELECT inbox_id, org_id, provider, account_email, refresh_token, access_token,
+		       access_token_expires_at, to_jsonb(scopes), sealed, created_at, updated_at
+		FROM inbox_oauth_tokens
+		WHERE inbox_id = $1
+	`, inboxID)
+	if err := row.Scan(&tok.InboxID, &tok.OrgID, &tok.Provider, &tok.AccountEmail, &tok.RefreshToken, &tok.AccessToken,
+		&expiresAt, &scopesJSON, &tok.Sealed, &tok.CreatedAt, &tok.UpdatedAt); err != nil {
+		return tok, err
+	}
+	if expiresAt.Valid {
+		tok.AccessExpiresAt = expiresAt.Time
+	}
+	if len(scopesJSON) > 0 {
+		if err := json.Unmarshal(scopesJSON, &tok.Scopes); err != nil {
+			return tok, err
+		}
+	}
+	return tok, nil
+}
+
+// UpdateInboxAccessToken caches a refreshed access token, sealed. Google may
+// rotate the refresh token too; an empty refreshToken keeps the stored one,
+// which must then be sealed already, as the grant is marked sealed.
+func (s *Store) UpdateInboxAccessToken(ctx context.Context, inboxID string, accessToken string, expiresAt time.Time, refreshToken string) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE inbox_oauth_tokens
+		SET access_token = $2,
+		    access_token_expires_at = $3,
+		    refresh_token = coalesce(nullif($4, ''), refresh_token),
+		    sealed = true,
+		    updated_at = now()
+		WHERE inbox_id = $1
+	`, inboxID, accessToken, expiresAt, refreshToken)
+	return err
+}
+
+func (s *Store) DeleteInboxOAuthToken(ctx context.Context, orgID string, inboxID string) (bool, error) {
+	result, err := s.q.ExecContext(ctx, `DELETE FROM inbox_oauth_tokens WHERE inbox_id = $1 AND org_id = $2`, inboxID, orgID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// CreateOAuthConnectState records a pending consent request and sweeps
+// expired ones.
+func (s *Store) CreateOAuthConnectState(ctx context.Context, st OAuthConnectState) error {
+	if _, err := s.q.ExecContext(ctx, `DELETE FROM oauth_connect_states WHERE expires_at < now()`); err != nil {
+		return err
+	}
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO oauth_connect_states (state, org_id, inbox_id, provider, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, st.State, st.OrgID, st.InboxID, st.Provider, st.ExpiresAt)
+	return err
+}
+
+// GetOAuthConnectState returns an unexpired state that no consent has been
+// recorded against yet. Unknown, expired or used states return
+// sql.ErrNoRows.
+func (s *Store) GetOAuthConnectState(ctx context.Context, state string) (OAuthConnectState, error) {
+	var out OAuthConnectState
+	row := s.q.QueryRowContext(ctx, `
+		SELECT state, org_id, inbox_id, provider, expires_at
+		FROM oauth_connect_states
+		WHERE state = $1 AND expires_at > now() AND consented_at IS NULL
+	`, state)
+	if err := row.Scan(&out.State, &out.OrgID, &out.InboxID, &out.Provider, &out.ExpiresAt); err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// RecordOAuthConsent parks the grant a consent callback returned on its
+// state until the org confirms it, and gives the org until expiresAt to do
+// so. Each state takes one consent; a second returns sql.ErrNoRows.
+func (s *Store) RecordOAuthConsent(ctx context.Context, state string, grant InboxOAuthToken, expiresAt time.Time) error {
+	var accessExpiresAt any
+	if !grant.AccessExpiresAt.IsZero() {
+		accessExpiresAt = grant.AccessExpiresAt
+	}
+	scopes := grant.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	result, err := s.q.ExecContext(ctx, `
+		UPDATE oauth_connect_states
+		SET account_email = $2,
+		    refresh_token = $3,
+		    access_token = $4,
+		    access_token_expires_at = $5,
+		    scopes = $6,
+		    consented_at = now(),
+		    expires_at = $7
+		WHERE state = $1 AND expires_at > now() AND consented_at IS NULL
+	`, state, grant.AccountEmail, grant.RefreshToken, grant.AccessToken, accessExpiresAt, scopes, expiresAt)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ConsumeOAuthPendingGrant deletes a consented state of the org's inbox and
+// returns its sealed grant, so each grant is confirmed at most once.
+// States without a consent, expired or of another inbox return
+// sql.ErrNoRows.
+func (s *Store) ConsumeOAuthPendingGrant(ctx context.Context, orgID string, inboxID string, state string) (InboxOAuthToken, error) {
+	tok := InboxOAuthToken{Sealed: true}
+	var expiresAt sql.NullTime
+	var scopesJSON []byte
+	row := s.q.QueryRowContext(ctx, `
+		DELETE FROM oauth_connect_states
+		WHERE state = $1 AND org_id = $2 AND inbox_id = $3
+		  AND consented_at IS NOT NULL AND expires_at > now()
+		RETURNING inbox_id, org_id, provider, account_email, refresh_token, access_token,
+		          access_token_expires_at, to_jsonb(scopes)
+	`, state, orgID, inboxID)
+	if err := row.Scan(&tok.InboxID, &tok.OrgID, &tok.Provider, &tok.AccountEmail, &tok.RefreshToken, &tok.AccessToken,
+		&expiresAt, &scopesJSON); err != nil {
+		return tok, err
+	}
+	if expiresAt.Valid {
+		tok.AccessExpiresAt = expiresAt.Time
+	}
+	if len(scopesJSON) > 0 {
+		if err := json.Unmarshal(scopesJSON, &tok.Scopes); err != nil {
+			return tok, err
+		}
+	}
+	return tok, nil
+}
@@ -0,0 +1,275 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Tool names of the audit_log receipts an org deletion leaves. Purging the
+// org's audit log keeps them, so the deletion can be shown to have happened.
+const (
+	AuditOrgDeletionRequested = "request_org_deletion"
+	AuditOrgDeletionCanceled  = "cancel_org_deletion"
+	AuditOrgPurged            = "purge_org"
+)
+
+// OrgDeletion is a request to delete an org. The org is purged once
+// PurgeAfter passes, unless the request is canceled first; Receipt is what
+// the purge removed.
+type OrgDeletion struct {
+	OrgID       string
+	RequestedBy string
+	RequestedAt time.Time
+	PurgeAfter  time.Time
+	CanceledAt  sql.NullTime
+	PurgedAt    sql.NullTime
+	Receipt     json.RawMessage
+}
+
+// Pending reports whether the org is still waiting to be purged.
+func (d OrgDeletion) Pending() bool {
+	return !d.CanceledAt.Valid && !d.PurgedAt.Valid
+}
+
+const orgDeletionColumns = `org_id::text, requested_by, requested_at, purge_after, canceled_at, purged_at, receipt`
+
+func scanOrgDeletion(row interface{ Scan(...any) error }) (OrgDeletion, error) {
+	var d OrgDeletion
+	var receipt []byte
+	err := row.Scan(&d.OrgID, &d.RequestedBy, &d.RequestedAt, &d.PurgeAfter, &d.CanceledAt, &d.PurgedAt, &receipt)
+	d.Receipt = receipt
+	return d, err
+}
+
+// RequestOrgDeletion schedules the org to be purged after purgeAfter,
+// reviving a canceled request. It reports false, with the request as it
+// stands, when one was already pending or the org was already purged.
+func (s *Store) RequestOrgDeletion(ctx context.Context, orgID string, requestedBy string, purgeAfter time.Time) (OrgDeletion, bool, error) {
+	d, err := scanOrgDeletion(s.q.QueryRowContext(ctx, `
+		INSERT INTO org_deletions (org_id, requested_by, purge_after)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (org_id) DO UPDATE
+		SET requested_by = EXCLUDED.requested_by, requested_at = now(),
+		    purge_after = EXCLUDED.purge_after, canceled_at = NULL
+		WHERE org_deletions.canceled_at IS NOT NULL AND org_deletions.purged_at IS NULL
+		RETURNING `+orgDeletionColumns+`
+	`, orgID, requestedBy, purgeAfter))
+	if errors.Is(err, sql.ErrNoRows) {
+		d, err = s.GetOrgDeletion(ctx, orgID)
+		return d, false, err
+	}
+	return d, err == nil, err
+}
+
+// OrgExists reports whether orgID is an org in this store.
+func (s *Store) OrgExists(ctx context.Context, orgID string) (bool, error) {
+	var exists bool
+	err := s.q.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM orgs WHERE id = $1)`, orgID).Scan(&exists)
+	return exists, err
+}
+
+// GetOrgDeletion returns the org's deletion request, or sql.ErrNoRows.
+func (s *Store) GetOrgDeletion(ctx context.Context, orgID string) (OrgDeletion, error) {
+	return scanOrgDeletion(s.q.QueryRowContext(ctx, `
+		SELECT `+orgDeletionColumns+` FROM org_deletions WHERE org_id = $1
+	`, orgID))
+}
+
+// CancelOrgDeletion cancels the org's pending deletion, reporting false if
+// there was none.
+func (s *Store) CancelOrgDeletion(ctx context.Context, orgID string) (bool, error) {
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE org_deletions SET canceled_at = now()
+		WHERE org_id = $1 AND canceled_at IS NULL AND purged_at IS NULL
+	`, orgID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ListDueOrgDeletions returns up to limit pending deletions whose grace
+// period ended before now, oldest first.
+func (s *Store) ListDueOrgDeletions(ctx context.Context, now time.Time, limit int) ([]OrgDeletion, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+orgDeletionColumns+`
+		FROM org_deletions
+		WHERE canceled_at IS NULL AND purged_at IS NULL AND purge_after <= $1
+		ORDER BY purge_after
+		LIMIT $2
+	`, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []OrgDeletion
+	for rows.Next() {
+		d, err := scanOrgDeletion(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// OrgPurgeTargets returns what an org keeps outside Postgres: its inboxes,
+// whose vector points carry their ids, and the object-store keys of its
+// oversized messages' raw copies.
+func (s *Store) OrgPurgeTargets(ctx context.Context, orgID string) ([]string, []string, error) {
+	inboxIDs, err := s.orgStrings(ctx, `SELECT id::text FROM inboxes WHERE org_id = $1`, orgID)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys, err := s.orgStrings(ctx, `SELECT raw_object_key FROM messages WHERE org_id = $1 AND raw_object_key <> ''`, orgID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return inboxIDs, keys, nil
+}
+
+func (s *Store) orgStrings(ctx context.Context, query string, orgID string) ([]string, error) {
+	rows, err := s.q.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// orgPurgeCounted are the tables whose rows a purge counts in its receipt.
+var orgPurgeCounted = []string{"inboxes", "threads", "messages", "drafts", "usage_events"}
+
+// OrgPurgeReceipt records what purging an org removed. Rows counts the
+// Postgres rows by table; VectorInboxes and Objects are the inboxes whose
+// vector points and the raw message objects removed before it.
+type OrgPurgeReceipt struct {
+	OrgID         string           `json:"org_id"`
+	RequestedBy   string           `json:"requested_by"`
+	RequestedAt   time.Time        `json:"requested_at"`
+	PurgedAt      time.Time        `json:"purged_at"`
+	Rows          map[string]int64 `json:"rows"`
+	VectorInboxes int              `json:"vector_inboxes"`
+	Objects       int              `json:"objects"`
+}
+
+// PurgeOrg deletes receipt.OrgID and everything it owns from Postgres in
+// one transaction: the org row, through the foreign keys its inboxes,
+// mail, drafts and usage, and its audit log bar the deletion receipts. The
+// same transaction marks the deletion request purged and writes the
+// receipt, with its row counts filled in, to the request and to audit_log.
+// The org's vector points and objects are the caller's to remove first.
+func (s *Store) PurgeOrg(ctx context.Context, receipt OrgPurgeReceipt) (OrgPurgeReceipt, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return receipt, err
+	}
+	defer tx.Rollback()
+	scoped := &Store{db: s.db, q: tx}
+
+	orgID := receipt.OrgID
+	receipt.Rows = map[string]int64{}
+	for _, table := range orgPurgeCounted {
+		var n int64
+		if err := tx.QueryRowContext(ctx, `SELECT count(*) FROM `+table+` WHERE org_id = $1`, orgID).Scan(&n); err != nil {
+			return receipt, fmt.Errorf("count %s: %w", table, err)
+		}
+		receipt.Rows[table] = n
+	}
+	res, err := tx.ExecContext(ctx, `
+		DELETE FROM audit_log a
+		WHERE a.org_id = $1
+		  AND NOT EXISTS (
+		    SELECT 1 FROM tool_calls c
+		    WHERE c.id = a.tool_call_id AND c.tool_name = ANY($2::text[])
+		  )
+	`, orgID, []string{AuditOrgDeletionRequested, AuditOrgDeletionCanceled, AuditOrgPurged})
+	if err != nil {
+		return receipt, fmt.Errorf("purge audit_log: %w", err)
+	}
+	if receipt.Rows["audit_log"], err = res.RowsAffected(); err != nil {
+		return receipt, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM orgs WHERE id = $1`, orgID); err != nil {
+		return receipt, fmt.Errorf("delete org: %w", err)
+	}
+
+	raw, err := json.Marshal(receipt)
+	if err != nil {
+		return receipt, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE org_deletions SET purged_at = $2, receipt = $3::jsonb WHERE org_id = $1
+	`, orgID, receipt.PurgedAt, string(raw)); err != nil {
+		return receipt, err
+	}
+	toolCallID, err := scoped.RecordToolCall(ctx, AuditOrgPurged, orgID, "", "control-plane", 0)
+	if err != nil {
+		return receipt, err
+	}
+	sum := sha256.Sum256(raw)
+	if err := scoped.RecordAudit(ctx, AuditRecord{
+		ToolCallID:  toolCallID,
+		OrgID:       orgID,
+		Actor:       "worker",
+		OutputsHash: hex.EncodeToString(sum[:]),
+		Outputs:     raw,
+	}); err != nil {
+		return receipt, err
+	}
+	return receipt, tx.Commit()
+}
+
+// orgExportSections maps each section of an org export to the table it
+// holds the org's rows of and the column they are ordered by.
+var orgExportSections = map[string][2]string{
+	"threads":  {"threads", "id"},
+	"messages": {"messages", "created_at, t.id"},
+	"audit":    {"audit_log", "created_at, t.id"},
+	"usage":    {"usage_events", "created_at, t.id"},
+}
+
+// OrgExportSections are the sections of an org export, in the order they
+// are written.
+var OrgExportSections = []string{"threads", "messages", "audit", "usage"}
+
+// ExportOrgRows calls fn with each of the org's rows in section, as a JSON
+// object of its columns, stopping at the first error fn returns.
+func (s *Store) ExportOrgRows(ctx context.Context, orgID string, section string, fn func(row json.RawMessage) error) error {
+	spec, ok := orgExportSections[section]
+	if !ok {
+		return fmt.Errorf("unknown export section %q", section)
+	}
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT to_jsonb(t) - 'search_tsv' FROM `+spec[0]+` t WHERE t.org_id = $1 ORDER BY t.`+spec[1], orgID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return err
+		}
+		if err := fn(raw); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -138,16 +138,68 @@ func (s *Store) UpdateOrgDomainVerification(ctx context.Context, id string, mx,
 		SET mx_verified = $2, spf_verified = $3, dkim_verified = $4, dmarc_verified = $5,
 		    status = $6, last_check_at = now(),
 		    verified_at = CASE WHEN $6 IN ('verified_dns', 'active') THEN now() ELSE verified_at END,
+		    warmup_started_at = CASE WHEN $6 = 'active' THEN coalesce(warmup_started_at, now()) ELSE warmup_started_at END,
 		    updated_at = now()
 		WHERE id = $1
 	`, id, mx, spf, dkim, dmarc, status)
 	return err
 }
 
-// UpdateOrgDomainStatus transitions domain to a new status.
+// ListOrgDomainsToRecheck returns the domains the worker's verifier
+// re-checks: unexpired pending claims and active and failed domains, least
+// recently checked first.
+func (s *Store) ListOrgDomainsToRecheck(ctx context.Context) ([]OrgDomain, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT id, org_id, domain, status, verification_token,
+		       mx_verified, spf_verified, dkim_verified, dmarc_verified,
+		       inbound_enabled, dkim_selector, dkim_private_key_enc, dkim_public_key,
+		       dkim_method, last_check_at, verified_at, expires_at, created_at, updated_at
+		FROM org_domains
+		WHERE status IN ('active', 'failed')
+		   OR (status = 'pending' AND (expires_at IS NULL OR expires_at > now()))
+		ORDER BY last_check_at NULLS FIRST
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var domains []OrgDomain
+	for rows.Next() {
+		var d OrgDomain
+		if err := scanOrgDomain(rows, &d); err != nil {
+			return nil, err
+		}
+		domains = append(domains, d)
+	}
+	return domains, rows.Err()
+}
+
+// RecordOrgDomainCheck stores the outcome of a background DNS check. Unlike
+// UpdateOrgDomainVerification, verified_at only moves when ownership was
+// confirmed, so for an active domain it tells since when its ownership
+// record has been missing.
+func (s *Store) RecordOrgDomainCheck(ctx context.Context, id string, mx, spf, dkim, dmarc, verified bool, status string) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE org_domains
+		SET mx_verified = $2, spf_verified = $3, dkim_verified = $4, dmarc_verified = $5,
+		    status = $7, last_check_at = now(),
+		    verified_at = CASE WHEN $6 THEN now() ELSE verified_at END,
+		    warmup_started_at = CASE WHEN $7 = 'active' THEN coalesce(warmup_started_at, now()) ELSE warmup_started_at END,
+		    updated_at = now()
+		WHERE id = $1
+	`, id, mx, spf, dkim, dmarc, verified, status)
+	return err
+}
+
+// UpdateOrgDomainStatus transitions domain to a new status. The first time
+// a domain goes active starts its sending warm-up.
 func (s *Store) UpdateOrgDomainStatus(ctx context.Context, id string, status string) error {
 	q := `UPDATE org_domains SET status = $2, updated_at = now() WHERE id = $1`
-	if status == "active" || status == "verified_dns" {
+	switch status {
+	case "active":
+		q = `UPDATE org_domains SET status = $2, verified_at = now(), warmup_started_at = coalesce(warmup_started_at, now()), updated_at = now() WHERE id = $1`
+	case "verified_dns":
 		q = `UPDATE org_domains SET status = $2, verified_at = now(), updated_at = now() WHERE id = $1`
 	}
 	_, err := s.q.ExecContext(ctx, q, id, status)
@@ -222,7 +274,7 @@ func (s *Store) ExpirePendingDomains(ctx context.Context) (int, error) {
 	return int(n), nil
 }
 
-func scanOrgDomain(row *sql.Row, d *OrgDomain) error {
+func scanOrgDomain(row interface{ Scan(...any) error }, d *OrgDomain) error {
 	return row.Scan(
 		&d.ID, &d.OrgID, &d.Domain, &d.Status, &d.VerificationToken,
 		&d.MXVerified, &d.SPFVerified, &d.DKIMVerified, &d.DMARCVerified,
@@ -0,0 +1,316 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrOrgMergeConflict is returned by MergeOrgs when the report lists
+// conflicts; nothing was changed.
+var ErrOrgMergeConflict = errors.New("orgs cannot be merged")
+
+// orgMergeTables are the tables whose rows move wholesale from the source
+// org to the target. Settings the target already has (branding, feature
+// flags, region and the like) stay as they are.
+var orgMergeTables = []string{
+	"users", "api_keys", "inboxes", "threads", "contact_threads", "messages", "contacts", "org_domains",
+	"inbox_aliases", "inbox_oauth_tokens", "inbox_ingest_filters", "inbox_ingest_skips",
+	"inbox_sync_status", "inbox_backfills", "org_domain_dkim_keys", "inbound_routing_decisions",
+	"drafts", "draft_revisions", "outbox", "suppressions", "thread_closures",
+	"message_translations", "message_summaries", "org_link_rules", "notification_preferences",
+	"webhook_endpoints", "webhook_deliveries", "mcp_sessions", "canary_tool_metrics",
+	"automation_rules", "automation_rule_runs", "crm_connections", "crm_links", "cloud_api_keys", "usage_events", "audit_log",
+}
+
+// orgMergeDuplicates are the source rows dropped in favour of the target's
+// own, by the columns that must be unique within an org.
+var orgMergeDuplicates = map[string]string{
+	"org_link_rules":           "t.domain = s.domain",
+	"suppressions":             "t.address = s.address",
+	"notification_preferences": "t.user_id = s.user_id AND t.event_type = s.event_type AND t.channel = s.channel",
+	// An org has one CRM connection; the target keeps its own.
+	"crm_connections": "true",
+	// Their threads are folded into the target's contact first; see
+	// foldOrgMergeContacts.
+	"contacts": "t.contact_key = s.contact_key",
+}
+
+// OrgMergeReport is what MergeOrgs did, or would do on a dry run.
+type OrgMergeReport struct {
+	SourceOrgID string `json:"source_org_id"`
+	TargetOrgID string `json:"target_org_id"`
+	DryRun      bool   `json:"dry_run"`
+	// Conflicts are the reasons the orgs cannot be merged; a merge with
+	// any fails with ErrOrgMergeConflict.
+	Conflicts []string `json:"conflicts"`
+	// Moved counts the rows moved to the target, by table; Dropped the
+	// source rows the target already had an equivalent of.
+	Moved   map[string]int64 `json:"moved"`
+	Dropped map[string]int64 `json:"dropped"`
+	// ServiceTokensRevoked counts the source's live service tokens, whose
+	// org claim cannot be re-scoped; cloud API keys move instead.
+	ServiceTokensRevoked int64 `json:"service_tokens_revoked"`
+	// SubscriptionMoved is set when the target takes over the source's
+	// subscription, add-ons and plan.
+	SubscriptionMoved bool `json:"subscription_moved"`
+	// Warnings are limits the merged org ends up over.
+	Warnings []string `json:"warnings"`
+}
+
+type orgMergeSide struct {
+	exists          bool
+	sandbox         bool
+	merged          bool
+	hasSubscription bool
+}
+
+// MergeOrgs moves sourceOrgID's inboxes, mail, keys, usage and
+// subscription into targetOrgID in one transaction and leaves the source
+// empty, marked merged_into the target. On a dry run the same statements
+// run and are rolled back, so the report's counts are exact. actor is
+// recorded with the merge in org_merges.
+func (s *Store) MergeOrgs(ctx context.Context, sourceOrgID, targetOrgID, actor string, dryRun bool) (OrgMergeReport, error) {
+	report := OrgMergeReport{
+		SourceOrgID: sourceOrgID,
+		TargetOrgID: targetOrgID,
+		DryRun:      dryRun,
+		Conflicts:   []string{},
+		Moved:       map[string]int64{},
+		Dropped:     map[string]int64{},
+		Warnings:    []string{},
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+
+	source, err := lockOrgForMerge(ctx, tx, sourceOrgID)
+	if err != nil {
+		return report, err
+	}
+	target, err := lockOrgForMerge(ctx, tx, targetOrgID)
+	if err != nil {
+		return report, err
+	}
+	switch {
+	case sourceOrgID == targetOrgID:
+		report.Conflicts = append(report.Conflicts, "source and target are the same org")
+	case !source.exists:
+		report.Conflicts = append(report.Conflicts, "source org not found")
+	case !target.exists:
+		report.Conflicts = append(report.Conflicts, "target org not found")
+	}
+	if source.merged || target.merged {
+		report.Conflicts = append(report.Conflicts, "an org that was already merged cannot be merged again")
+	}
+	if source.sandbox || target.sandbox {
+		report.Conflicts = append(report.Conflicts, "sandbox orgs cannot be merged")
+	}
+	if source.hasSubscription && target.hasSubscription {
+		report.Conflicts = append(report.Conflicts, "both orgs have a subscription; cancel one first")
+	}
+	if len(report.Conflicts) > 0 {
+		if dryRun {
+			return report, nil
+		}
+		return report, ErrOrgMergeConflict
+	}
+
+	exec := func(query string, args ...any) (int64, error) {
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected()
+	}
+	if err := foldOrgMergeContacts(ctx, tx, sourceOrgID, targetOrgID); err != nil {
+		return report, fmt.Errorf("fold contacts: %w", err)
+	}
+	for table, same := range orgMergeDuplicates {
+		n, err := exec(`DELETE FROM `+table+` s WHERE s.org_id = $1
+			AND EXISTS (SELECT 1 FROM `+table+` t WHERE t.org_id = $2 AND `+same+`)`, sourceOrgID, targetOrgID)
+		if err != nil {
+			return report, fmt.Errorf("drop duplicate %s: %w", table, err)
+		}
+		if n > 0 {
+			report.Dropped[table] = n
+		}
+	}
+	for _, table := range orgMergeTables {
+		n, err := exec(`UPDATE `+table+` SET org_id = $2 WHERE org_id = $1`, sourceOrgID, targetOrgID)
+		if err != nil {
+			return report, fmt.Errorf("move %s: %w", table, err)
+		}
+		if n > 0 {
+			report.Moved[table] = n
+		}
+	}
+	if report.ServiceTokensRevoked, err = exec(`
+		UPDATE service_tokens SET revoked_at = now()
+		WHERE org_id = $1 AND revoked_at IS NULL AND expires_at > now()
+	`, sourceOrgID); err != nil {
+		return report, err
+	}
+
+	if source.hasSubscription {
+		if err := moveOrgSubscription(ctx, tx, sourceOrgID, targetOrgID); err != nil {
+			return report, err
+		}
+		report.SubscriptionMoved = true
+	}
+	if _, err := exec(`UPDATE org_entitlements SET subscription_status = 'merged', updated_at = now() WHERE org_id = $1`, sourceOrgID); err != nil {
+		return report, err
+	}
+	// The moved usage events now count towards the target's periods;
+	// counters are recomputed from them as reconciliation would.
+	if _, err := exec(`DELETE FROM org_usage_counters WHERE org_id = $1`, sourceOrgID); err != nil {
+		return report, err
+	}
+	if _, err := exec(`
+		UPDATE org_usage_counters c SET used = (
+			SELECT coalesce(sum(quantity), 0) FROM usage_events
+			WHERE org_id = c.org_id AND meter_name = c.meter_name AND status = 'success'
+			  AND created_at >= c.period_start AND created_at < c.period_end
+		), updated_at = now()
+		WHERE c.org_id = $1
+	`, targetOrgID); err != nil {
+		return report, err
+	}
+	if _, err := exec(`UPDATE orgs SET merged_into = $2, merged_at = now() WHERE id = $1`, sourceOrgID, targetOrgID); err != nil {
+		return report, err
+	}
+
+	var inboxes, maxInboxes, domains, maxDomains int
+	if err := tx.QueryRowContext(ctx, `
+		SELECT (SELECT count(*) FROM inboxes WHERE org_id = $1),
+		       (SELECT count(*) FROM org_domains WHERE org_id = $1),
+		       coalesce(e.max_inboxes, 0), coalesce(e.max_domains, 0)
+		FROM (SELECT 1) one
+		LEFT JOIN org_entitlements e ON e.org_id = $1
+	`, targetOrgID).Scan(&inboxes, &domains, &maxInboxes, &maxDomains); err != nil {
+		return report, err
+	}
+	if maxInboxes > 0 && inboxes > maxInboxes {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("target has %d inboxes, over its plan's max_inboxes of %d", inboxes, maxInboxes))
+	}
+	if maxDomains > 0 && domains > maxDomains {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("target has %d domains, over its plan's max_domains of %d", domains, maxDomains))
+	}
+
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return report, err
+	}
+	if _, err := exec(`
+		INSERT INTO org_merges (source_org_id, target_org_id, actor, report) VALUES ($1, $2, $3, $4)
+	`, sourceOrgID, targetOrgID, actor, payload); err != nil {
+		return report, err
+	}
+	if dryRun {
+		return report, nil
+	}
+	return report, tx.Commit()
+}
+
+// lockOrgForMerge locks an org's row for the rest of the merge and reads
+// what decides whether it can take part in one.
+func lockOrgForMerge(ctx context.Context, tx *sql.Tx, orgID string) (orgMergeSide, error) {
+	side := orgMergeSide{exists: true}
+	err := tx.QueryRowContext(ctx, `
+		SELECT o.sandbox, o.merged_into IS NOT NULL,
+		       EXISTS (SELECT 1 FROM subscriptions WHERE org_id = o.id)
+		FROM orgs o
+		WHERE o.id = $1
+		FOR UPDATE
+	`, orgID).Scan(&side.sandbox, &side.merged, &side.hasSubscription)
+	if errors.Is(err, sql.ErrNoRows) {
+		return orgMergeSide{}, nil
+	}
+	return side, err
+}
+
+// foldOrgMergeContacts merges each source contact the target also has,
+// by contact key, into the target's: its addresses and the threads it
+// wrote on are added and the seen times widened. The source contact itself
+// is then dropped as a duplicate.
+func foldOrgMergeContacts(ctx context.Context, tx *sql.Tx, sourceOrgID, targetOrgID string) error {
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE contacts t SET
+			name = CASE WHEN s.name <> '' AND (t.name = '' OR s.last_seen_at > t.last_seen_at) THEN s.name ELSE t.name END,
+			emails = ARRAY(SELECT DISTINCT e FROM unnest(t.emails || s.emails) e ORDER BY e),
+			first_seen_at = least(t.first_seen_at, s.first_seen_at),
+			last_seen_at = greatest(t.last_seen_at, s.last_seen_at),
+			updated_at = now()
+		FROM contacts s
+		WHERE s.org_id = $1 AND t.org_id = $2 AND t.contact_key = s.contact_key
+	`, sourceOrgID, targetOrgID); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO contact_threads (contact_id, thread_id, org_id, first_seen_at, last_seen_at)
+		SELECT t.id, ct.thread_id, $2, ct.first_seen_at, ct.last_seen_at
+		FROM contact_threads ct
+		JOIN contacts s ON s.id = ct.contact_id
+		JOIN contacts t ON t.org_id = $2 AND t.contact_key = s.contact_key
+		WHERE s.org_id = $1
+		ON CONFLICT (contact_id, thread_id) DO NOTHING
+	`, sourceOrgID, targetOrgID)
+	return err
+}
+
+// moveOrgSubscription hands the source's subscription, add-ons and plan
+// to a target that has no subscription of its own.
+func moveOrgSubscription(ctx context.Context, tx *sql.Tx, sourceOrgID, targetOrgID string) error {
+	if _, err := tx.ExecContext(ctx, `UPDATE subscriptions SET org_id = $2, updated_at = now() WHERE org_id = $1`, sourceOrgID, targetOrgID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM org_addons WHERE org_id = $1`, targetOrgID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE org_addons SET org_id = $2 WHERE org_id = $1`, sourceOrgID, targetOrgID); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO org_entitlements (
+			org_id, plan_code, subscription_status, mcp_rpm, monthly_units, max_inboxes, max_domains,
+			usage_period_start, usage_period_end, grace_until, trial_ends_at, updated_at
+		)
+		SELECT $2, plan_code, subscription_status, mcp_rpm, monthly_units, max_inboxes, max_domains,
+		       usage_period_start, usage_period_end, grace_until, trial_ends_at, now()
+		FROM org_entitlements
+		WHERE org_id = $1
+		ON CONFLICT (org_id) DO UPDATE SET
+			plan_code = EXCLUDED.plan_code,
+			subscription_status = EXCLUDED.subscription_status,
+			mcp_rpm = EXCLUDED.mcp_rpm,
+			monthly_units = EXCLUDED.monthly_units,
+			max_inboxes = EXCLUDED.max_inboxes,
+			max_domains = EXCLUDED.max_domains,
+			usage_period_start = EXCLUDED.usage_period_start,
+			usage_period_end = EXCLUDED.usage_period_end,
+			grace_until = EXCLUDED.grace_until,
+			trial_ends_at = EXCLUDED.trial_ends_at,
+			updated_at = now()
+	`, sourceOrgID, targetOrgID)
+	return err
+}
+
+// MergedOrgID follows orgID to the org it was merged into, if it was, and
+// otherwise returns it unchanged.
+func (s *Store) MergedOrgID(ctx context.Context, orgID string) (string, error) {
+	var mergedInto sql.NullString
+	err := s.q.QueryRowContext(ctx, `SELECT merged_into::text FROM orgs WHERE id = $1`, orgID).Scan(&mergedInto)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return orgID, nil
+	case err != nil:
+		return "", err
+	case mergedInto.Valid:
+		return mergedInto.String, nil
+	}
+	return orgID, nil
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// OrgPolicyVersion is one saved version of an org's policy rules. Rules is
+// the JSON list of policy.CustomRule.
+type OrgPolicyVersion struct {
+	OrgID     string
+	Version   int
+	Rules     json.RawMessage
+	Note      string
+	CreatedBy string
+	CreatedAt time.Time
+}
+
+const orgPolicyColumns = `org_id, version, rules, note, created_by, created_at`
+
+func scanOrgPolicyVersion(row interface{ Scan(...any) error }) (OrgPolicyVersion, error) {
+	var v OrgPolicyVersion
+	var rules []byte
+	err := row.Scan(&v.OrgID, &v.Version, &rules, &v.Note, &v.CreatedBy, &v.CreatedAt)
+	v.Rules = rules
+	return v, err
+}
+
+// GetOrgPolicy returns the org's policy version in force, or sql.ErrNoRows
+// when it never saved one.
+func (s *Store) GetOrgPolicy(ctx context.Context, orgID string) (OrgPolicyVersion, error) {
+	return scanOrgPolicyVersion(s.q.QueryRowContext(ctx, `
+		SELECT `+orgPolicyColumns+`
+		FROM org_policy_versions
+		WHERE org_id = $1
+		ORDER BY version DESC
+		LIMIT 1
+	`, orgID))
+}
+
+// GetOrgPolicyVersion returns one version of the org's policy, or
+// sql.ErrNoRows.
+func (s *Store) GetOrgPolicyVersion(ctx context.Context, orgID string, version int) (OrgPolicyVersion, error) {
+	return scanOrgPolicyVersion(s.q.QueryRowContext(ctx, `
+		SELECT `+orgPolicyColumns+` FROM org_policy_versions WHERE org_id = $1 AND version = $2
+	`, orgID, version))
+}
+
+// ListOrgPolicyVersions returns up to limit of the org's policy versions,
+// newest first.
+func (s *Store) ListOrgPolicyVersions(ctx context.Context, orgID string, limit int) ([]OrgPolicyVersion, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+orgPolicyColumns+`
+		FROM org_policy_versions
+		WHERE org_id = $1
+		ORDER BY version DESC
+		LIMIT $2
+	`, orgID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []OrgPolicyVersion
+	for rows.Next() {
+		v, err := scanOrgPolicyVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// AddOrgPolicyVersion saves rules as the org's next policy version, which
+// takes effect at once. Concurrent saves for one org conflict on the
+// version rather than overwrite each other.
+func (s *Store) AddOrgPolicyVersion(ctx context.Context, orgID string, rules json.RawMessage, note string, createdBy string) (OrgPolicyVersion, error) {
+	return scanOrgPolicyVersion(s.q.QueryRowContext(ctx, `
+		INSERT INTO org_policy_versions (org_id, version, rules, note, created_by)
+		SELECT $1::uuid, coalesce(max(version), 0) + 1, $2::jsonb, $3, $4
+		FROM org_policy_versions
+		WHERE org_id = $1
+		RETURNING `+orgPolicyColumns+`
+	`, orgID, string(rules), note, createdBy))
+}
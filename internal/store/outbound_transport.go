@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+)
+
+// OutboundTransport returns the transport orgID's mail from domain leaves
+// through: the active domain's choice, else the org's, else "" for the
+// configured default.
+func (s *Store) OutboundTransport(ctx context.Context, orgID string, domain string) (string, error) {
+	var transport string
+	err := s.q.QueryRowContext(ctx, `
+		SELECT coalesce(
+			nullif((SELECT outbound_transport FROM org_domains
+			        WHERE org_id = nullif($1, '')::uuid AND lower(domain) = lower($2) AND status = 'active'
+			        LIMIT 1), ''),
+			(SELECT outbound_transport FROM orgs WHERE id = nullif($1, '')::uuid),
+			''
+		)
+	`, orgID, domain).Scan(&transport)
+	return transport, err
+}
+
+func (s *Store) GetOrgOutboundTransport(ctx context.Context, orgID string) (string, error) {
+	var transport string
+	err := s.q.QueryRowContext(ctx, `SELECT outbound_transport FROM orgs WHERE id = $1`, orgID).Scan(&transport)
+	return transport, err
+}
+
+// SetOrgOutboundTransport stores the transport an org's mail uses, "" for
+// the configured default; unknown orgs return sql.ErrNoRows.
+func (s *Store) SetOrgOutboundTransport(ctx context.Context, orgID string, transport string) error {
+	var id string
+	return s.q.QueryRowContext(ctx, `
+		UPDATE orgs SET outbound_transport = $2, updated_at = now()
+		WHERE id = $1
+		RETURNING id
+	`, orgID, transport).Scan(&id)
+}
+
+func (s *Store) GetDomainOutboundTransport(ctx context.Context, orgID string, domainID string) (string, error) {
+	var transport string
+	err := s.q.QueryRowContext(ctx, `
+		SELECT outbound_transport FROM org_domains WHERE id = $1 AND org_id = $2
+	`, domainID, orgID).Scan(&transport)
+	return transport, err
+}
+
+// SetDomainOutboundTransport stores the transport mail from one of orgID's
+// domains uses, "" for the org's; returns sql.ErrNoRows if the domain is
+// not orgID's.
+func (s *Store) SetDomainOutboundTransport(ctx context.Context, orgID string, domainID string, transport string) error {
+	var id string
+	return s.q.QueryRowContext(ctx, `
+		UPDATE org_domains SET outbound_transport = $3, updated_at = now()
+		WHERE id = $1 AND org_id = $2
+		RETURNING id
+	`, domainID, orgID, transport).Scan(&id)
+}
@@ -0,0 +1,190 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Delivery statuses of an outbox entry. Entries start queued; the worker
+// moves them to sent, to bounced when the relay rejects the recipient
+// permanently, or to failed once retries run out. A sent entry becomes
+// delivered when its provider reports it accepted by the recipient's
+// server, and bounced or complained when a bounce or complaint about it
+// comes back.
+const (
+	DeliveryQueued     = "queued"
+	DeliverySent       = "sent"
+	DeliveryDelivered  = "delivered"
+	DeliveryBounced    = "bounced"
+	DeliveryFailed     = "failed"
+	DeliveryComplained = "complained"
+)
+
+// OutboxMessage is an outbound message waiting for, or done with, delivery.
+// Transport and ProviderMessageID are set once it is sent.
+type OutboxMessage struct {
+	ID                string
+	OrgID             string
+	MessageID         string
+	InternetMessageID string
+	InReplyTo         string
+	References        string
+	From              string
+	To                string
+	Subject           string
+	Body              string
+	Status            string
+	Attempts          int
+	LastError         string
+	NextAttemptAt     time.Time
+	SentAt            sql.NullTime
+	Transport         string
+	ProviderMessageID string
+	DeliveredAt       sql.NullTime
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+const outboxColumns = `id, coalesce(org_id::text, ''), message_id, internet_message_id, in_reply_to, reference_ids, from_address, to_address, subject, body,
+	status, attempts, last_error, next_attempt_at, sent_at, transport, provider_message_id, delivered_at, created_at, updated_at`
+
+func scanOutboxMessage(row interface{ Scan(...any) error }) (OutboxMessage, error) {
+	var m OutboxMessage
+	err := row.Scan(&m.ID, &m.OrgID, &m.MessageID, &m.InternetMessageID, &m.InReplyTo, &m.References, &m.From, &m.To, &m.Subject, &m.Body,
+		&m.Status, &m.Attempts, &m.LastError, &m.NextAttemptAt, &m.SentAt,
+		&m.Transport, &m.ProviderMessageID, &m.DeliveredAt, &m.CreatedAt, &m.UpdatedAt)
+	return m, err
+}
+
+// EnqueueOutbox queues a stored outbound message for delivery. The worker
+// picks it up on its next pass. The message's Message-ID is sent with it so
+// bounces and complaints can be traced back, along with its threading
+// headers.
+func (s *Store) EnqueueOutbox(ctx context.Context, messageID string, from string, to string, subject string, body string) (string, error) {
+	var id string
+	err := s.q.QueryRowContext(ctx, `
+		INSERT INTO outbox (org_id, message_id, internet_message_id, in_reply_to, reference_ids, from_address, to_address, subject, body)
+		SELECT org_id, id, coalesce(internet_message_id, ''), in_reply_to, reference_ids, $2, $3, $4, $5
+		FROM messages WHERE id = $1
+		RETURNING id
+	`, messageID, from, to, subject, body).Scan(&id)
+	return id, err
+}
+
+// ClaimDueOutbox takes up to limit queued entries whose next attempt is due
+// and counts the attempt. Claimed entries are leased for lease, so another
+// worker only retries them if this one dies before recording the outcome.
+func (s *Store) ClaimDueOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		UPDATE outbox
+		SET attempts = attempts + 1,
+		    next_attempt_at = now() + make_interval(secs => $2),
+		    updated_at = now()
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE status = 'queued' AND next_attempt_at <= now()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+outboxColumns, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var claimed []OutboxMessage
+	for rows.Next() {
+		m, err := scanOutboxMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, m)
+	}
+	return claimed, rows.Err()
+}
+
+// MarkOutboxSent records a successful hand-off to transport, which gave the
+// message providerMessageID; empty when the transport gives none.
+func (s *Store) MarkOutboxSent(ctx context.Context, id string, transport string, providerMessageID string) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE outbox
+		SET status = 'sent', last_error = '', sent_at = now(), transport = $2, provider_message_id = $3, updated_at = now()
+		WHERE id = $1
+	`, id, transport, providerMessageID)
+	return err
+}
+
+// MarkOutboxDelivered records that a sent entry reached the recipient's
+// server. Entries a bounce or complaint already settled keep their status.
+func (s *Store) MarkOutboxDelivered(ctx context.Context, id string) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE outbox
+		SET status = 'delivered', delivered_at = now(), updated_at = now()
+		WHERE id = $1 AND status = 'sent'
+	`, id)
+	return err
+}
+
+// NoteOutboxError records a provider's report of a temporary problem with a
+// sent entry, such as a deferral, without changing its status.
+func (s *Store) NoteOutboxError(ctx context.Context, id string, lastError string) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE outbox SET last_error = $2, updated_at = now() WHERE id = $1
+	`, id, lastError)
+	return err
+}
+
+// RetryOutbox records a failed attempt and schedules the next one.
+func (s *Store) RetryOutbox(ctx context.Context, id string, nextAttemptAt time.Time, lastError string) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE outbox
+		SET last_error = $2, next_attempt_at = $3, updated_at = now()
+		WHERE id = $1 AND status = 'queued'
+	`, id, lastError, nextAttemptAt)
+	return err
+}
+
+// FailOutbox gives up on an entry with a final status, bounced or failed.
+func (s *Store) FailOutbox(ctx context.Context, id string, status string, lastError string) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE outbox
+		SET status = $2, last_error = $3, updated_at = now()
+		WHERE id = $1
+	`, id, status, lastError)
+	return err
+}
+
+// GetOutboxByMessage returns the delivery of an outbound message, or
+// sql.ErrNoRows if it never went through the outbox.
+func (s *Store) GetOutboxByMessage(ctx context.Context, messageID string) (OutboxMessage, error) {
+	return scanOutboxMessage(s.q.QueryRowContext(ctx, `
+		SELECT `+outboxColumns+`
+		FROM outbox
+		WHERE message_id = $1
+	`, messageID))
+}
+
+// GetOutboxByInternetMessageID returns the delivery sent with the given
+// Message-ID by the org that owns inboxID, or sql.ErrNoRows.
+func (s *Store) GetOutboxByInternetMessageID(ctx context.Context, inboxID string, internetMessageID string) (OutboxMessage, error) {
+	return scanOutboxMessage(s.q.QueryRowContext(ctx, `
+		SELECT `+outboxColumns+`
+		FROM outbox
+		WHERE internet_message_id = $2
+		  AND org_id IS NOT DISTINCT FROM (SELECT org_id FROM inboxes WHERE id = $1)
+		LIMIT 1
+	`, inboxID, internetMessageID))
+}
+
+// GetOutboxByProviderMessageID returns the delivery transport sent with
+// providerMessageID, or sql.ErrNoRows.
+func (s *Store) GetOutboxByProviderMessageID(ctx context.Context, transport string, providerMessageID string) (OutboxMessage, error) {
+	return scanOutboxMessage(s.q.QueryRowContext(ctx, `
+		SELECT `+outboxColumns+`
+		FROM outbox
+		WHERE transport = $1 AND provider_message_id = $2 AND provider_message_id <> ''
+		LIMIT 1
+	`, transport, providerMessageID))
+}
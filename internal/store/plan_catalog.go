@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const planEntitlementColumns = `
+	plan_code, mcp_rpm, monthly_units, max_inboxes, max_domains,
+	display_name, stripe_lookup_key, monthly_price_cents, overage_lookup_key,
+	overage_cents_per_1000_units, listed, audit_retention_days, token_rpm, ip_rpm`
+
+func scanPlanEntitlement(row interface{ Scan(...any) error }) (PlanEntitlement, error) {
+	var plan PlanEntitlement
+	err := row.Scan(&plan.PlanCode, &plan.MCPRPM, &plan.MonthlyUnits, &plan.MaxInboxes, &plan.MaxDomains,
+		&plan.DisplayName, &plan.StripeLookupKey, &plan.MonthlyPriceCents, &plan.OverageLookupKey,
+		&plan.OverageCentsPer1000Units, &plan.Listed, &plan.AuditRetentionDays, &plan.TokenRPM, &plan.IPRPM)
+	return plan, err
+}
+
+// PlanAddOn is an add-on sold alongside any plan. Each unit bought raises
+// the org's limits by ExtraInboxes and ExtraDomains.
+type PlanAddOn struct {
+	Code              string
+	DisplayName       string
+	StripeLookupKey   string
+	MonthlyPriceCents int64
+	ExtraInboxes      int
+	ExtraDomains      int
+}
+
+// ListPlanAddOns returns the add-on catalog ordered by code.
+func (s *Store) ListPlanAddOns(ctx context.Context) ([]PlanAddOn, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT code, display_name, stripe_lookup_key, monthly_price_cents, extra_inboxes, extra_domains
+		FROM plan_addons
+		ORDER BY code
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []PlanAddOn
+	for rows.Next() {
+		var a PlanAddOn
+		if err := rows.Scan(&a.Code, &a.DisplayName, &a.StripeLookupKey, &a.MonthlyPriceCents, &a.ExtraInboxes, &a.ExtraDomains); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// OrgAddOn is a quantity of an add-on on an org's subscription.
+type OrgAddOn struct {
+	Code                   string
+	Quantity               int
+	ExternalSubscriptionID string
+	UpdatedAt              time.Time
+}
+
+func (s *Store) ListOrgAddOns(ctx context.Context, orgID string) ([]OrgAddOn, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT addon_code, quantity, external_subscription_id, updated_at
+		FROM org_addons
+		WHERE org_id = $1
+		ORDER BY addon_code
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []OrgAddOn
+	for rows.Next() {
+		var a OrgAddOn
+		if err := rows.Scan(&a.Code, &a.Quantity, &a.ExternalSubscriptionID, &a.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// ReplaceOrgAddOns sets an org's add-ons to quantities, by add-on code, as
+// carried by the subscription; add-ons left out are removed.
+func (s *Store) ReplaceOrgAddOns(ctx context.Context, orgID string, subscriptionID string, quantities map[string]int) error {
+	wanted := map[string]int{}
+	for code, quantity := range quantities {
+		if quantity > 0 {
+			wanted[code] = quantity
+		}
+	}
+	raw, err := json.Marshal(wanted)
+	if err != nil {
+		return err
+	}
+	_, err = s.q.ExecContext(ctx, `
+		WITH wanted AS (
+			SELECT key AS code, value::int AS quantity FROM jsonb_each_text($2::jsonb)
+		), removed AS (
+			DELETE FROM org_addons WHERE org_id = $1 AND addon_code NOT IN (SELECT code FROM wanted)
+		)
+		INSERT INTO org_addons (org_id, addon_code, quantity, external_subscription_id)
+		SELECT $1, code, quantity, $3 FROM wanted
+		ON CONFLICT (org_id, addon_code) DO UPDATE SET
+			quantity = EXCLUDED.quantity,
+			external_subscription_id = EXCLUDED.external_subscription_id,
+			updated_at = now()
+	`, orgID, string(raw), subscriptionID)
+	return err
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// PollLease is a serve replica's claim on polling one inbox.
+type PollLease struct {
+	InboxID    string
+	Holder     string
+	AcquiredAt time.Time
+	RenewedAt  time.Time
+	ExpiresAt  time.Time
+}
+
+// AcquirePollLease takes or renews holder's lease on polling inboxID for
+// ttl. It fails to, without an error, while another holder's lease is live;
+// an expired lease is taken over. previous is the holder before the call,
+// empty for an inbox nobody had polled.
+func (s *Store) AcquirePollLease(ctx context.Context, inboxID string, holder string, ttl time.Duration) (acquired bool, previous string, err error) {
+	rows, err := s.q.QueryContext(ctx, `
+		WITH prev AS (
+			SELECT holder FROM inbox_poll_leases WHERE inbox_id = $1
+		)
+		INSERT INTO inbox_poll_leases (inbox_id, holder, expires_at)
+		VALUES ($1, $2, now() + make_interval(secs => $3))
+		ON CONFLICT (inbox_id) DO UPDATE
+		SET holder = EXCLUDED.holder,
+		    acquired_at = CASE WHEN inbox_poll_leases.holder = EXCLUDED.holder THEN inbox_poll_leases.acquired_at ELSE now() END,
+		    renewed_at = now(),
+		    expires_at = EXCLUDED.expires_at
+		WHERE inbox_poll_leases.holder = EXCLUDED.holder OR inbox_poll_leases.expires_at < now()
+		RETURNING coalesce((SELECT holder FROM prev), '')
+	`, inboxID, holder, ttl.Seconds())
+	if err != nil {
+		return false, "", err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		acquired = true
+		if err := rows.Scan(&previous); err != nil {
+			return false, "", err
+		}
+	}
+	return acquired, previous, rows.Err()
+}
+
+// ReleasePollLeases drops holder's leases so other replicas pick its inboxes
+// up on their next tick rather than after the leases expire.
+func (s *Store) ReleasePollLeases(ctx context.Context, holder string) (int64, error) {
+	result, err := s.q.ExecContext(ctx, `DELETE FROM inbox_poll_leases WHERE holder = $1`, holder)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ListPollLeases returns every inbox's poll lease, expired ones included,
+// by inbox.
+func (s *Store) ListPollLeases(ctx context.Context) ([]PollLease, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT inbox_id, holder, acquired_at, renewed_at, expires_at
+		FROM inbox_poll_leases
+		ORDER BY inbox_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []PollLease
+	for rows.Next() {
+		var l PollLease
+		if err := rows.Scan(&l.InboxID, &l.Holder, &l.AcquiredAt, &l.RenewedAt, &l.ExpiresAt); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
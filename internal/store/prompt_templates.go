@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PromptTemplate is one version of the system prompt an org set for a tool.
+type PromptTemplate struct {
+	ID          string
+	OrgID       string
+	ToolName    string
+	Version     int
+	Body        string
+	Note        string
+	CreatedBy   string
+	Active      bool
+	CreatedAt   time.Time
+	ActivatedAt *time.Time
+}
+
+// Ref names the template as tool calls record it, e.g.
+// "draft_reply_with_policy@v3".
+func (p PromptTemplate) Ref() string {
+	return fmt.Sprintf("%s@v%d", p.ToolName, p.Version)
+}
+
+const promptTemplateColumns = `id, org_id, tool_name, version, body, note, created_by, active, created_at, activated_at`
+
+func scanPromptTemplate(row interface{ Scan(...any) error }) (PromptTemplate, error) {
+	var p PromptTemplate
+	var activatedAt sql.NullTime
+	err := row.Scan(&p.ID, &p.OrgID, &p.ToolName, &p.Version, &p.Body, &p.Note, &p.CreatedBy, &p.Active, &p.CreatedAt, &activatedAt)
+	if activatedAt.Valid {
+		p.ActivatedAt = &activatedAt.Time
+	}
+	return p, err
+}
+
+// CreatePromptTemplate adds the next version of an org's prompt for tool.
+// The new version is inactive until ActivatePromptTemplate.
+func (s *Store) CreatePromptTemplate(ctx context.Context, orgID, tool, body, note, createdBy string) (PromptTemplate, error) {
+	row := s.q.QueryRowContext(ctx, `
+		INSERT INTO prompt_templates (id, org_id, tool_name, version, body, note, created_by)
+		SELECT $1, $2, $3, coalesce(max(version), 0) + 1, $4, $5, $6
+		FROM prompt_templates
+		WHERE org_id = $2 AND tool_name = $3
+		RETURNING `+promptTemplateColumns,
+		uuid.NewString(), orgID, tool, body, note, createdBy)
+	return scanPromptTemplate(row)
+}
+
+// ListPromptTemplates returns an org's prompt versions, newest first, for one
+// tool or, with tool empty, for all of them.
+func (s *Store) ListPromptTemplates(ctx context.Context, orgID, tool string) ([]PromptTemplate, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+promptTemplateColumns+`
+		FROM prompt_templates
+		WHERE org_id = $1 AND ($2 = '' OR tool_name = $2)
+		ORDER BY tool_name, version DESC
+	`, orgID, tool)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []PromptTemplate
+	for rows.Next() {
+		p, err := scanPromptTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// GetActivePromptTemplate returns the version of an org's prompt for tool
+// that is in use, or sql.ErrNoRows when the tool uses the built-in prompt.
+func (s *Store) GetActivePromptTemplate(ctx context.Context, orgID, tool string) (PromptTemplate, error) {
+	row := s.q.QueryRowContext(ctx, `
+		SELECT `+promptTemplateColumns+`
+		FROM prompt_templates
+		WHERE org_id = $1 AND tool_name = $2 AND active
+		LIMIT 1
+	`, orgID, tool)
+	return scanPromptTemplate(row)
+}
+
+// ActivatePromptTemplate puts a version in use for its tool, retiring the
+// one in use before it. Unknown IDs return sql.ErrNoRows.
+func (s *Store) ActivatePromptTemplate(ctx context.Context, orgID, id string) (PromptTemplate, error) {
+	// One statement flips both rows, so no reader sees two active versions.
+	row := s.q.QueryRowContext(ctx, `
+		WITH target AS (
+			SELECT tool_name FROM prompt_templates WHERE id = $2 AND org_id = $1
+		), updated AS (
+			UPDATE prompt_templates p
+			SET active = (p.id = $2),
+			    activated_at = CASE WHEN p.id = $2 THEN now() ELSE p.activated_at END
+			FROM target
+			WHERE p.org_id = $1 AND p.tool_name = target.tool_name
+			RETURNING p.*
+		)
+		SELECT `+promptTemplateColumns+` FROM updated WHERE id = $2
+	`, orgID, id)
+	return scanPromptTemplate(row)
+}
+
+// DeactivatePromptTemplate takes a version out of use, so its tool goes back
+// to the built-in prompt. Unknown IDs return sql.ErrNoRows.
+func (s *Store) DeactivatePromptTemplate(ctx context.Context, orgID, id string) (PromptTemplate, error) {
+	row := s.q.QueryRowContext(ctx, `
+		UPDATE prompt_templates SET active = false
+		WHERE id = $2 AND org_id = $1
+		RETURNING `+promptTemplateColumns,
+		orgID, id)
+	return scanPromptTemplate(row)
+}
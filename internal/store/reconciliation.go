@@ -0,0 +1,180 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UsageDiscrepancy describes a single billing integrity finding. Kind is one of
+// "counter_drift", "duplicate_replay_id" or "missing_audit".
+type UsageDiscrepancy struct {
+	Kind         string     `json:"kind"`
+	OrgID        string     `json:"org_id,omitempty"`
+	MeterName    string     `json:"meter_name,omitempty"`
+	PeriodStart  *time.Time `json:"period_start,omitempty"`
+	Expected     int64      `json:"expected,omitempty"`
+	Actual       int64      `json:"actual,omitempty"`
+	ReplayID     string     `json:"replay_id,omitempty"`
+	UsageEventID string     `json:"usage_event_id,omitempty"`
+	Occurrences  int64      `json:"occurrences,omitempty"`
+}
+
+type ReconciliationReport struct {
+	ID               string
+	StartedAt        time.Time
+	FinishedAt       time.Time
+	CountersChecked  int
+	CountersRepaired int
+	PeriodsRolled    int
+	TrialsExpired    int
+	AuditPruned      int64
+	VectorOrphans    int64
+	Discrepancies    []UsageDiscrepancy
+	CreatedAt        time.Time
+}
+
+// ListDuplicateUsageReplayIDs returns replay IDs recorded on more than one usage
+// event. The partial unique index should make this impossible; the check exists
+// to catch rows written before the index or by manual repair.
+func (s *Store) ListDuplicateUsageReplayIDs(ctx context.Context) ([]UsageDiscrepancy, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT replay_id, min(org_id::text), count(*)
+		FROM usage_events
+		WHERE replay_id IS NOT NULL AND replay_id <> ''
+		GROUP BY replay_id
+		HAVING count(*) > 1
+		ORDER BY replay_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []UsageDiscrepancy
+	for rows.Next() {
+		item := UsageDiscrepancy{Kind: "duplicate_replay_id"}
+		if err := rows.Scan(&item.ReplayID, &item.OrgID, &item.Occurrences); err != nil {
+			return nil, err
+		}
+		out = append(out, item)
+	}
+	return out, rows.Err()
+}
+
+// ListUsageEventsMissingAudit returns successful usage events whose tool call
+// has no audit_log row. usage_events.audit_id carries the tool call id written
+// by the MCP server, so a finalized reservation must resolve through it.
+// Events old enough for their org's audit retention to have pruned the row
+// are skipped.
+func (s *Store) ListUsageEventsMissingAudit(ctx context.Context, limit int) ([]UsageDiscrepancy, error) {
+	if limit <= 0 {
+		limit = 500
+	}
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT ue.id, ue.org_id, ue.meter_name, coalesce(ue.replay_id, '')
+		FROM usage_events ue
+		WHERE ue.status = 'success'
+		  AND NOT EXISTS (
+		    SELECT 1 FROM audit_log al
+		    WHERE ue.audit_id IS NOT NULL AND al.tool_call_id = ue.audit_id
+		  )
+		  AND NOT EXISTS (
+		    SELECT 1 FROM org_entitlements e
+		    JOIN plan_entitlements p ON p.plan_code = e.plan_code
+		    WHERE e.org_id = ue.org_id
+		      AND p.audit_retention_days > 0
+		      AND ue.created_at < now() - make_interval(days => p.audit_retention_days)
+		  )
+		ORDER BY ue.created_at ASC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []UsageDiscrepancy
+	for rows.Next() {
+		item := UsageDiscrepancy{Kind: "missing_audit"}
+		if err := rows.Scan(&item.UsageEventID, &item.OrgID, &item.MeterName, &item.ReplayID); err != nil {
+			return nil, err
+		}
+		out = append(out, item)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) InsertReconciliationReport(ctx context.Context, report ReconciliationReport) (string, error) {
+	discrepancies := report.Discrepancies
+	if discrepancies == nil {
+		discrepancies = []UsageDiscrepancy{}
+	}
+	payload, err := json.Marshal(discrepancies)
+	if err != nil {
+		return "", err
+	}
+	id := uuid.NewString()
+	_, err = s.q.ExecContext(ctx, `
+		INSERT INTO reconciliation_reports (
+			id, started_at, finished_at, counters_checked, counters_repaired,
+			periods_rolled, trials_expired, audit_pruned, vector_orphans, discrepancy_count, discrepancies
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, id, report.StartedAt, report.FinishedAt, report.CountersChecked, report.CountersRepaired,
+		report.PeriodsRolled, report.TrialsExpired, report.AuditPruned, report.VectorOrphans, len(discrepancies), payload)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// GetLatestReconciliationReport returns sql.ErrNoRows when no job has run yet.
+func (s *Store) GetLatestReconciliationReport(ctx context.Context) (ReconciliationReport, error) {
+	var report ReconciliationReport
+	var payload []byte
+	row := s.q.QueryRowContext(ctx, `
+		SELECT id, started_at, finished_at, counters_checked, counters_repaired,
+		       periods_rolled, trials_expired, audit_pruned, vector_orphans, discrepancies, created_at
+		FROM reconciliation_reports
+		ORDER BY created_at DESC
+		LIMIT 1
+	`)
+	if err := row.Scan(&report.ID, &report.StartedAt, &report.FinishedAt, &report.CountersChecked,
+		&report.CountersRepaired, &report.PeriodsRolled, &report.TrialsExpired, &report.AuditPruned, &report.VectorOrphans,
+		&payload, &report.CreatedAt); err != nil {
+		return report, err
+	}
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &report.Discrepancies); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+type PlatformStats struct {
+	Orgs              int64
+	Inboxes           int64
+	UsageEvents24h    int64
+	FailedUsage24h    int64
+	WebhooksFailed24h int64
+}
+
+func (s *Store) GetPlatformStats(ctx context.Context, now time.Time) (PlatformStats, error) {
+	var stats PlatformStats
+	since := now.Add(-24 * time.Hour)
+	row := s.q.QueryRowContext(ctx, `
+		SELECT
+		  (SELECT count(*) FROM orgs),
+		  (SELECT count(*) FROM inboxes),
+		  (SELECT count(*) FROM usage_events WHERE created_at >= $1),
+		  (SELECT count(*) FROM usage_events WHERE created_at >= $1 AND status <> 'success'),
+		  (SELECT count(*) FROM webhook_events WHERE processed_at >= $1 AND status = 'failed')
+	`, since)
+	if err := row.Scan(&stats.Orgs, &stats.Inboxes, &stats.UsageEvents24h, &stats.FailedUsage24h, &stats.WebhooksFailed24h); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// EmbeddingReindex is the checkpoint of a re-index of one region's
+// messages into Collection, which becomes Alias's target when done.
+type EmbeddingReindex struct {
+	ID         string
+	Region     string
+	Alias      string
+	Collection string
+	Model      string
+	Dim        int
+	// CursorCreatedAt and CursorID are the last message embedded; zero
+	// before the first batch.
+	CursorCreatedAt time.Time
+	CursorID        string
+	Embedded        int64
+	Skipped         int64
+	StartedAt       time.Time
+}
+
+// OpenEmbeddingReindex returns the open re-index of want.Region and
+// want.Alias if it is for the same model and dimension, with resumed set.
+// Otherwise it abandons any open one and starts want.
+func (s *Store) OpenEmbeddingReindex(ctx context.Context, want EmbeddingReindex) (EmbeddingReindex, bool, error) {
+	var open EmbeddingReindex
+	var cursorAt sql.NullTime
+	var cursorID sql.NullString
+	err := s.q.QueryRowContext(ctx, `
+		SELECT id::text, region, alias, collection, model, dim, cursor_created_at, cursor_id::text,
+		       embedded, skipped, started_at
+		FROM embedding_reindexes
+		WHERE region = $1 AND alias = $2 AND swapped_at IS NULL AND abandoned_at IS NULL
+	`, want.Region, want.Alias).Scan(&open.ID, &open.Region, &open.Alias, &open.Collection, &open.Model, &open.Dim,
+		&cursorAt, &cursorID, &open.Embedded, &open.Skipped, &open.StartedAt)
+	switch {
+	case err == nil && open.Model == want.Model && open.Dim == want.Dim:
+		open.CursorCreatedAt, open.CursorID = cursorAt.Time, cursorID.String
+		return open, true, nil
+	case err == nil:
+		if _, err := s.q.ExecContext(ctx, `UPDATE embedding_reindexes SET abandoned_at = now() WHERE id = $1`, open.ID); err != nil {
+			return EmbeddingReindex{}, false, err
+		}
+	case !errors.Is(err, sql.ErrNoRows):
+		return EmbeddingReindex{}, false, err
+	}
+	started := want
+	err = s.q.QueryRowContext(ctx, `
+		INSERT INTO embedding_reindexes (region, alias, collection, model, dim)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id::text, started_at
+	`, want.Region, want.Alias, want.Collection, want.Model, want.Dim).Scan(&started.ID, &started.StartedAt)
+	return started, false, err
+}
+
+// AdvanceEmbeddingReindex records progress after a batch: the last message
+// it covered and the running totals.
+func (s *Store) AdvanceEmbeddingReindex(ctx context.Context, r EmbeddingReindex) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE embedding_reindexes
+		SET cursor_created_at = $2, cursor_id = $3::uuid, embedded = $4, skipped = $5, updated_at = now()
+		WHERE id = $1
+	`, r.ID, r.CursorCreatedAt, r.CursorID, r.Embedded, r.Skipped)
+	return err
+}
+
+// FinishEmbeddingReindex closes a re-index whose collection is now live.
+func (s *Store) FinishEmbeddingReindex(ctx context.Context, id string) error {
+	_, err := s.q.ExecContext(ctx, `UPDATE embedding_reindexes SET swapped_at = now(), updated_at = now() WHERE id = $1`, id)
+	return err
+}
+
+// ReindexMessage is a message with what the embedding index needs of it.
+type ReindexMessage struct {
+	ID        string
+	ThreadID  string
+	InboxID   string
+	Direction string
+	Text      string
+	Oversized bool
+	CreatedAt time.Time
+}
+
+// ListMessagesAfter returns up to limit messages in (created_at, id) order
+// following the cursor; an empty afterID starts from the first message.
+func (s *Store) ListMessagesAfter(ctx context.Context, afterCreatedAt time.Time, afterID string, limit int) ([]ReindexMessage, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT m.id::text, m.thread_id::text, coalesce(t.inbox_id::text, ''), m.direction,
+		       coalesce(m.text, ''), m.oversized, m.created_at
+		FROM messages m
+		JOIN threads t ON t.id = m.thread_id
+		WHERE $2 = '' OR (m.created_at, m.id) > ($1, nullif($2, '')::uuid)
+		ORDER BY m.created_at, m.id
+		LIMIT $3
+	`, afterCreatedAt, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []ReindexMessage
+	for rows.Next() {
+		var m ReindexMessage
+		if err := rows.Scan(&m.ID, &m.ThreadID, &m.InboxID, &m.Direction, &m.Text, &m.Oversized, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
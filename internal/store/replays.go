@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// ToolCallReplay is what an audit entry kept of an MCP tool call for
+// replaying it. Inputs and Outputs are nil when the call's payloads were not
+// stored or have been redacted.
+type ToolCallReplay struct {
+	ReplayID   string
+	ToolName   string
+	OrgID      string
+	InboxID    string
+	Actor      string
+	Inputs     json.RawMessage
+	Outputs    json.RawMessage
+	RedactedAt sql.NullTime
+	CreatedAt  time.Time
+}
+
+// GetToolCallReplay returns the tool call audited under replayID, or
+// sql.ErrNoRows.
+func (s *Store) GetToolCallReplay(ctx context.Context, replayID string) (ToolCallReplay, error) {
+	var r ToolCallReplay
+	var inputs, outputs []byte
+	err := s.q.QueryRowContext(ctx, `
+		SELECT a.replay_id, coalesce(t.tool_name, ''), coalesce(a.org_id::text, ''), a.inbox_id, coalesce(a.actor, ''),
+		       a.inputs, a.outputs, a.redacted_at, a.created_at
+		FROM audit_log a
+		LEFT JOIN tool_calls t ON t.id = a.tool_call_id
+		WHERE a.replay_id = $1
+		ORDER BY a.created_at DESC
+		LIMIT 1
+	`, replayID).Scan(&r.ReplayID, &r.ToolName, &r.OrgID, &r.InboxID, &r.Actor, &inputs, &outputs, &r.RedactedAt, &r.CreatedAt)
+	if err != nil {
+		return r, err
+	}
+	if len(inputs) > 0 {
+		r.Inputs = inputs
+	}
+	if len(outputs) > 0 {
+		r.Outputs = outputs
+	}
+	return r, nil
+}
+
+// RedactToolCallReplay wipes the stored arguments and result of the tool
+// call audited under replayID in orgID; the hashes stay. It returns
+// sql.ErrNoRows when there is no such call.
+func (s *Store) RedactToolCallReplay(ctx context.Context, orgID string, replayID string) error {
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE audit_log
+		SET inputs = NULL, outputs = NULL, redacted_at = coalesce(redacted_at, now())
+		WHERE replay_id = $1 AND ($2::text = '' OR org_id = nullif($2::text, '')::uuid)
+	`, replayID, orgID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// nullJSON stores an empty payload as NULL.
+func nullJSON(raw json.RawMessage) sql.NullString {
+	return sql.NullString{String: string(raw), Valid: len(raw) > 0}
+}
@@ -0,0 +1,254 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// replicaLagCheckInterval is how long a measured replica lag is trusted.
+	replicaLagCheckInterval = time.Second
+	// replicaRetryAfter is how long reads stay on the primary after the
+	// replica failed one.
+	replicaRetryAfter = 10 * time.Second
+	// maxTrackedWrites bounds the recent writes a replica remembers before
+	// the expired ones are dropped.
+	maxTrackedWrites = 4096
+)
+
+// replica is a read-only standby serving the store's heaviest reads, so
+// that listing and searching do not compete with ingest for the primary.
+// Reads stay on the primary while the standby lags by more than maxLag,
+// and for maxLag after a write to what they read.
+type replica struct {
+	db     *sql.DB
+	maxLag time.Duration
+
+	mu        sync.Mutex
+	writes    map[string]time.Time
+	lag       time.Duration
+	checkedAt time.Time
+	downUntil time.Time
+}
+
+// UseReplica sends ListThreads, GetThread, SearchInboxFTS and
+// ListAuditEntries to the standby at dsn whenever it is within maxLag of
+// the primary, falling back to the primary when it is not or a query on it
+// fails.
+func (s *Store) UseReplica(dsn string, maxLag time.Duration) error {
+	db, err := openPool(dsn)
+	if err != nil {
+		return err
+	}
+	s.replica = &replica{db: db, maxLag: maxLag, writes: map[string]time.Time{}}
+	return nil
+}
+
+// noteWrite records a write to keys, which reads of them must see.
+func (r *replica) noteWrite(keys ...string) {
+	if r == nil {
+		return
+	}
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.writes) >= maxTrackedWrites {
+		for key, at := range r.writes {
+			if now.Sub(at) > r.maxLag {
+				delete(r.writes, key)
+			}
+		}
+	}
+	for _, key := range keys {
+		r.writes[key] = now
+	}
+}
+
+// usable reports whether a read of keys can go to the replica: it is up,
+// caught up, and none of keys was written within maxLag.
+func (r *replica) usable(ctx context.Context, keys []string) bool {
+	now := time.Now()
+	r.mu.Lock()
+	if now.Before(r.downUntil) {
+		r.mu.Unlock()
+		return false
+	}
+	for _, key := range keys {
+		if now.Sub(r.writes[key]) <= r.maxLag {
+			r.mu.Unlock()
+			return false
+		}
+	}
+	stale := now.Sub(r.checkedAt) > replicaLagCheckInterval
+	if stale {
+		// Readers arriving while this one measures use the last value.
+		r.checkedAt = now
+	}
+	lag := r.lag
+	r.mu.Unlock()
+
+	if stale {
+		measured, err := r.measureLag(ctx)
+		if err != nil {
+			r.fail(ctx, err)
+			return false
+		}
+		r.mu.Lock()
+		r.lag = measured
+		r.mu.Unlock()
+		lag = measured
+	}
+	return lag <= r.maxLag
+}
+
+// measureLag is how far the standby's replay trails the primary: zero when
+// it has replayed everything it received, else the age of the last
+// transaction it replayed.
+func (r *replica) measureLag(ctx context.Context) (time.Duration, error) {
+	var seconds float64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT CASE
+			WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			ELSE coalesce(extract(epoch FROM now() - pg_last_xact_replay_timestamp()), 0)
+		END
+	`).Scan(&seconds)
+	return time.Duration(seconds * float64(time.Second)), err
+}
+
+// fail keeps reads on the primary for a while after the replica failed.
+func (r *replica) fail(ctx context.Context, err error) {
+	slog.WarnContext(ctx, "read replica unavailable, reading from primary", "err", err)
+	r.mu.Lock()
+	r.downUntil = time.Now().Add(replicaRetryAfter)
+	r.mu.Unlock()
+}
+
+// orgScope is the state a RunAsOrg store keeps about its transaction: the
+// org it is confined to, whether it has written, and the read-only
+// transaction it reads the replica through.
+type orgScope struct {
+	orgID     string
+	wrote     bool
+	replicaTx *sql.Tx
+}
+
+// scopedTx is a RunAsOrg transaction that notes when it writes: reads
+// after that must see the write, so they stay on it.
+type scopedTx struct {
+	*sql.Tx
+	scope *orgScope
+}
+
+func (t scopedTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	t.scope.wrote = true
+	return t.Tx.ExecContext(ctx, query, args...)
+}
+
+func (t scopedTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	t.scope.noteQuery(query)
+	return t.Tx.QueryContext(ctx, query, args...)
+}
+
+func (t scopedTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	t.scope.noteQuery(query)
+	return t.Tx.QueryRowContext(ctx, query, args...)
+}
+
+// noteQuery counts any statement but a plain SELECT as a write.
+func (sc *orgScope) noteQuery(query string) {
+	fields := strings.Fields(query)
+	if len(fields) == 0 || !strings.EqualFold(fields[0], "SELECT") {
+		sc.wrote = true
+	}
+}
+
+// replicaQueryer opens the scope's read-only replica transaction, confined
+// to its org like the primary one, on first use.
+func (sc *orgScope) replicaQueryer(ctx context.Context, r *replica) (queryer, error) {
+	if sc.replicaTx != nil {
+		return sc.replicaTx, nil
+	}
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT set_config('app.cloud_mode', 'true', true), set_config('app.current_org_id', $1, true)`, sc.orgID); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	sc.replicaTx = tx
+	return tx, nil
+}
+
+// close ends the scope's replica transaction, if it opened one.
+func (sc *orgScope) close() {
+	if sc.replicaTx != nil {
+		_ = sc.replicaTx.Rollback()
+		sc.replicaTx = nil
+	}
+}
+
+// reader returns where a read of the rows keys name runs: the replica when
+// it is usable for them, otherwise the store's own connection or
+// transaction. A RunAsOrg store reads the replica through its own org-
+// scoped transaction, and stops once it has written.
+func (s *Store) reader(ctx context.Context, keys ...string) queryer {
+	r := s.replica
+	if r == nil || (s.scope != nil && s.scope.wrote) || !r.usable(ctx, keys) {
+		return s.q
+	}
+	if s.scope == nil {
+		return r.db
+	}
+	q, err := s.scope.replicaQueryer(ctx, r)
+	if err != nil {
+		r.fail(ctx, err)
+		return s.q
+	}
+	return q
+}
+
+// readQuery runs a reader query, retrying it on the primary if the replica
+// fails it.
+func (s *Store) readQuery(ctx context.Context, keys []string, query string, args ...any) (*sql.Rows, error) {
+	q := s.reader(ctx, keys...)
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil && q != s.q && ctx.Err() == nil {
+		s.replica.fail(ctx, err)
+		if s.scope != nil {
+			// The failed query aborted the replica transaction.
+			s.scope.close()
+		}
+		return s.q.QueryContext(ctx, query, args...)
+	}
+	return rows, err
+}
+
+// readRow is readQuery for a single row, which scan reads; it returns
+// sql.ErrNoRows when there is none.
+func (s *Store) readRow(ctx context.Context, keys []string, scan func(row interface{ Scan(...any) error }) error, query string, args ...any) error {
+	rows, err := s.readQuery(ctx, keys, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	if err := scan(rows); err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// Keys of the reads a recent write must reach, for noteWrite.
+func inboxReadKey(inboxID string) string   { return "inbox:" + inboxID }
+func threadReadKey(threadID string) string { return "thread:" + threadID }
+func auditReadKey(orgID string) string     { return "audit:" + orgID }
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReplicaUsable(t *testing.T) {
+	ctx := context.Background()
+	// A lag measured just now is trusted, so no query is made.
+	r := &replica{maxLag: time.Minute, writes: map[string]time.Time{}, checkedAt: time.Now()}
+	inbox := []string{inboxReadKey("inbox-1")}
+
+	if !r.usable(ctx, inbox) {
+		t.Fatalf("expected a caught-up replica to be usable")
+	}
+	r.noteWrite(inboxReadKey("inbox-1"), threadReadKey("thread-1"))
+	if r.usable(ctx, inbox) || r.usable(ctx, []string{threadReadKey("thread-1")}) {
+		t.Fatalf("expected reads after a recent write to stay on the primary")
+	}
+	if !r.usable(ctx, []string{inboxReadKey("inbox-2")}) {
+		t.Fatalf("expected other inboxes to read from the replica")
+	}
+
+	r.lag = 2 * time.Minute
+	if r.usable(ctx, []string{inboxReadKey("inbox-2")}) {
+		t.Fatalf("expected a lagging replica to be skipped")
+	}
+	r.lag = 0
+	r.downUntil = time.Now().Add(time.Minute)
+	if r.usable(ctx, []string{inboxReadKey("inbox-2")}) {
+		t.Fatalf("expected a failed replica to be skipped")
+	}
+}
+
+func TestOrgScopeCountsWrites(t *testing.T) {
+	cases := map[string]bool{
+		"SELECT id FROM threads":              false,
+		"\n\t\tselect 1":                      false,
+		"INSERT INTO drafts (id) VALUES ($1)": true,
+		"UPDATE threads SET status = $2":      true,
+		"WITH m AS (INSERT INTO messages (id) VALUES ($1) RETURNING id) SELECT id FROM m": true,
+	}
+	for query, wrote := range cases {
+		sc := &orgScope{}
+		sc.noteQuery(query)
+		if sc.wrote != wrote {
+			t.Errorf("%q: wrote = %v, want %v", query, sc.wrote, wrote)
+		}
+	}
+}
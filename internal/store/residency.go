@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrRegionHasData is returned when an org with inboxes is moved to another
+// region; its threads and vectors already live in the old region's storage.
+var ErrRegionHasData = errors.New("org already has inboxes in its current region")
+
+// GetOrgRegion returns the org's residency region, or "" for the home
+// deployment.
+func (s *Store) GetOrgRegion(ctx context.Context, orgID string) (string, error) {
+	var region string
+	row := s.q.QueryRowContext(ctx, `SELECT coalesce(region, '') FROM orgs WHERE id = $1`, orgID)
+	if err := row.Scan(&region); err != nil {
+		return "", err
+	}
+	return region, nil
+}
+
+// GetInboxRegion returns the inbox's residency region, or "" for the home
+// deployment.
+func (s *Store) GetInboxRegion(ctx context.Context, inboxID string) (string, error) {
+	var region string
+	row := s.q.QueryRowContext(ctx, `SELECT coalesce(region, '') FROM inboxes WHERE id = $1`, inboxID)
+	if err := row.Scan(&region); err != nil {
+		return "", err
+	}
+	return region, nil
+}
+
+// SetOrgRegion tags an org with a residency region. The region can only
+// change while the org has no inboxes; setting the current region again is a
+// no-op. Returns sql.ErrNoRows for an unknown org.
+func (s *Store) SetOrgRegion(ctx context.Context, orgID string, region string) error {
+	var current string
+	var inboxes int
+	row := s.q.QueryRowContext(ctx, `
+		SELECT coalesce(o.region, ''), (SELECT count(*) FROM inboxes i WHERE i.org_id = o.id)
+		FROM orgs o
+		WHERE o.id = $1
+	`, orgID)
+	if err := row.Scan(&current, &inboxes); err != nil {
+		return err
+	}
+	if current == region {
+		return nil
+	}
+	if inboxes > 0 {
+		return ErrRegionHasData
+	}
+	_, err := s.q.ExecContext(ctx, `UPDATE orgs SET region = nullif($2, '') WHERE id = $1`, orgID, region)
+	return err
+}
+
+// InboxReplica is the slice of the directory a regional database needs so
+// that threads and messages written there satisfy the org and inbox foreign
+// keys.
+type InboxReplica struct {
+	OrgID    string
+	OrgName  string
+	InboxID  string
+	Address  string
+	Status   string
+	Provider string
+	Region   string
+}
+
+func (s *Store) GetInboxReplica(ctx context.Context, inboxID string) (InboxReplica, error) {
+	var rep InboxReplica
+	row := s.q.QueryRowContext(ctx, `
+		SELECT o.id, o.name, i.id, i.address, i.status, i.provider, coalesce(i.region, '')
+		FROM inboxes i
+		JOIN orgs o ON o.id = i.org_id
+		WHERE i.id = $1
+	`, inboxID)
+	if err := row.Scan(&rep.OrgID, &rep.OrgName, &rep.InboxID, &rep.Address, &rep.Status, &rep.Provider, &rep.Region); err != nil {
+		return rep, err
+	}
+	return rep, nil
+}
+
+// UpsertInboxReplica writes a directory replica into a regional database.
+func (s *Store) UpsertInboxReplica(ctx context.Context, rep InboxReplica) error {
+	if _, err := s.q.ExecContext(ctx, `
+		INSERT INTO orgs (id, name, region)
+		VALUES ($1, $2, nullif($3, ''))
+		ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, region = EXCLUDED.region
+	`, rep.OrgID, rep.OrgName, rep.Region); err != nil {
+		return err
+	}
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO inboxes (id, org_id, address, status, provider, region)
+		VALUES ($1, $2, $3, $4, $5, nullif($6, ''))
+		ON CONFLICT (id) DO UPDATE
+		SET address = EXCLUDED.address, status = EXCLUDED.status, provider = EXCLUDED.provider, region = EXCLUDED.region
+	`, rep.InboxID, rep.OrgID, rep.Address, rep.Status, rep.Provider, rep.Region)
+	return err
+}
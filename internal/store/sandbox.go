@@ -0,0 +1,42 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ErrNotSandbox is returned when a sandbox inbox's address already belongs
+// to an org that is not a sandbox.
+var ErrNotSandbox = errors.New("inbox belongs to an org that is not a sandbox")
+
+// EnsureSandboxInbox returns the inbox at address and its sandbox org,
+// creating both, the org named orgName, if the address is free.
+func (s *Store) EnsureSandboxInbox(ctx context.Context, orgName string, address string) (orgID string, inboxID string, err error) {
+	var sandbox bool
+	err = s.q.QueryRowContext(ctx, `
+		SELECT o.id, i.id, o.sandbox
+		FROM inboxes i JOIN orgs o ON o.id = i.org_id
+		WHERE lower(i.address) = lower($1)
+	`, address).Scan(&orgID, &inboxID, &sandbox)
+	switch {
+	case err == nil && !sandbox:
+		return "", "", ErrNotSandbox
+	case err == nil:
+		return orgID, inboxID, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return "", "", err
+	}
+
+	orgID = uuid.NewString()
+	if _, err := s.q.ExecContext(ctx, `INSERT INTO orgs (id, name, sandbox) VALUES ($1, $2, true)`, orgID, orgName); err != nil {
+		return "", "", err
+	}
+	inbox, err := s.CreateInboxForOrg(ctx, orgID, address, "", ProviderJMAP)
+	if err != nil {
+		return "", "", err
+	}
+	return orgID, inbox.ID, nil
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SearchRerank is an org's search re-ranking setting. A zero LatencyBudget
+// means the server default.
+type SearchRerank struct {
+	Enabled       bool
+	LatencyBudget time.Duration
+}
+
+func (s *Store) GetOrgSearchRerank(ctx context.Context, orgID string) (SearchRerank, error) {
+	var setting SearchRerank
+	var budgetMS sql.NullInt64
+	err := s.q.QueryRowContext(ctx, `
+		SELECT search_rerank, search_rerank_budget_ms FROM orgs WHERE id = $1
+	`, orgID).Scan(&setting.Enabled, &budgetMS)
+	if budgetMS.Valid {
+		setting.LatencyBudget = time.Duration(budgetMS.Int64) * time.Millisecond
+	}
+	return setting, err
+}
+
+// SetOrgSearchRerank stores an org's setting; unknown orgs return
+// sql.ErrNoRows.
+func (s *Store) SetOrgSearchRerank(ctx context.Context, orgID string, setting SearchRerank) error {
+	var budgetMS sql.NullInt64
+	if setting.LatencyBudget > 0 {
+		budgetMS = sql.NullInt64{Int64: setting.LatencyBudget.Milliseconds(), Valid: true}
+	}
+	row := s.q.QueryRowContext(ctx, `
+		UPDATE orgs SET search_rerank = $2, search_rerank_budget_ms = $3, updated_at = now()
+		WHERE id = $1
+		RETURNING id
+	`, orgID, setting.Enabled, budgetMS)
+	var id string
+	return row.Scan(&id)
+}
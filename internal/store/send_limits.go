@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// SendLimits are an org's or a domain's own sending limits. A null field
+// is unset: an org then uses the outbound defaults, a domain nothing beyond
+// its org's. 0 is unlimited.
+type SendLimits struct {
+	HourlyMessages  sql.NullInt64
+	DailyRecipients sql.NullInt64
+}
+
+// DomainSendLimits are a domain's sending limits and the start of its
+// warm-up, null until it first goes active.
+type DomainSendLimits struct {
+	DomainID string
+	Domain   string
+	SendLimits
+	WarmupStartedAt sql.NullTime
+}
+
+// OutboundVolume is what an org, or one of its domains, has queued for
+// sending in the trailing hour and day, and in how many seconds the oldest
+// message of each window ages out of it.
+type OutboundVolume struct {
+	HourlyMessages     int
+	DailyRecipients    int
+	HourlyResetSeconds int
+	DailyResetSeconds  int
+}
+
+func (s *Store) GetOrgSendLimits(ctx context.Context, orgID string) (SendLimits, error) {
+	var l SendLimits
+	err := s.q.QueryRowContext(ctx, `
+		SELECT send_limit_hourly_messages, send_limit_daily_recipients FROM orgs WHERE id = $1
+	`, orgID).Scan(&l.HourlyMessages, &l.DailyRecipients)
+	return l, err
+}
+
+// SetOrgSendLimits replaces an org's sending limits; unknown orgs return
+// sql.ErrNoRows.
+func (s *Store) SetOrgSendLimits(ctx context.Context, orgID string, l SendLimits) error {
+	var id string
+	return s.q.QueryRowContext(ctx, `
+		UPDATE orgs
+		SET send_limit_hourly_messages = $2, send_limit_daily_recipients = $3, updated_at = now()
+		WHERE id = $1
+		RETURNING id
+	`, orgID, l.HourlyMessages, l.DailyRecipients).Scan(&id)
+}
+
+func (s *Store) GetDomainSendLimits(ctx context.Context, orgID string, domainID string) (DomainSendLimits, error) {
+	return scanDomainSendLimits(s.q.QueryRowContext(ctx, `
+		SELECT id, domain, send_limit_hourly_messages, send_limit_daily_recipients, warmup_started_at
+		FROM org_domains
+		WHERE id = $1 AND org_id = $2
+	`, domainID, orgID))
+}
+
+// ActiveDomainSendLimits returns the limits of orgID's active domain named
+// domain, or sql.ErrNoRows if it has none by that name.
+func (s *Store) ActiveDomainSendLimits(ctx context.Context, orgID string, domain string) (DomainSendLimits, error) {
+	return scanDomainSendLimits(s.q.QueryRowContext(ctx, `
+		SELECT id, domain, send_limit_hourly_messages, send_limit_daily_recipients, warmup_started_at
+		FROM org_domains
+		WHERE org_id = nullif($1, '')::uuid AND lower(domain) = lower($2) AND status = 'active'
+		LIMIT 1
+	`, orgID, domain))
+}
+
+// SetDomainSendLimits replaces the sending limits of one of orgID's
+// domains; returns sql.ErrNoRows if the domain is not orgID's.
+func (s *Store) SetDomainSendLimits(ctx context.Context, orgID string, domainID string, l SendLimits) error {
+	var id string
+	return s.q.QueryRowContext(ctx, `
+		UPDATE org_domains
+		SET send_limit_hourly_messages = $3, send_limit_daily_recipients = $4, updated_at = now()
+		WHERE id = $1 AND org_id = $2
+		RETURNING id
+	`, domainID, orgID, l.HourlyMessages, l.DailyRecipients).Scan(&id)
+}
+
+func scanDomainSendLimits(row interface{ Scan(...any) error }) (DomainSendLimits, error) {
+	var d DomainSendLimits
+	err := row.Scan(&d.DomainID, &d.Domain, &d.HourlyMessages, &d.DailyRecipients, &d.WarmupStartedAt)
+	return d, err
+}
+
+// OutboundVolume counts the outbound messages orgID queued in the last hour
+// and the recipients in the last day, only those sent from domain unless it
+// is empty. Every queued delivery counts, whatever became of it, since a
+// bounce costs a domain's reputation as much as a delivery.
+func (s *Store) OutboundVolume(ctx context.Context, orgID string, domain string) (OutboundVolume, error) {
+	var v OutboundVolume
+	err := s.q.QueryRowContext(ctx, `
+		SELECT count(DISTINCT message_id) FILTER (WHERE created_at > now() - interval '1 hour'),
+		       count(*),
+		       ceil(extract(epoch FROM coalesce(min(created_at) FILTER (WHERE created_at > now() - interval '1 hour'), now()) + interval '1 hour' - now()))::int,
+		       ceil(extract(epoch FROM coalesce(min(created_at), now()) + interval '1 day' - now()))::int
+		FROM outbox
+		WHERE org_id IS NOT DISTINCT FROM nullif($1, '')::uuid
+		  AND created_at > now() - interval '1 day'
+		  AND ($2 = '' OR lower(split_part(from_address, '@', 2)) = lower($2))
+	`, orgID, domain).Scan(&v.HourlyMessages, &v.DailyRecipients, &v.HourlyResetSeconds, &v.DailyResetSeconds)
+	return v, err
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,11 +12,21 @@ import (
 
 	"github.com/google/uuid"
 	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"neuralmail/internal/pii"
 )
 
 type Store struct {
 	db *sql.DB
 	q  queryer
+	// cleanups receives the vector cleanups of deletes; pendingCleanups
+	// holds them inside RunAsOrg until the transaction commits.
+	cleanups        VectorCleanupQueue
+	pendingCleanups *[]VectorCleanup
+	// replica, when set, serves the read-heavy queries; scope is set on
+	// RunAsOrg stores.
+	replica *replica
+	scope   *orgScope
 }
 
 type queryer interface {
@@ -32,6 +43,30 @@ type CloudAPIKey struct {
 	Scopes    []string
 	CreatedAt time.Time
 	RevokedAt sql.NullTime
+	// ExpiresAt is set once the key has been rotated: it keeps working
+	// until then beside the key that replaced it.
+	ExpiresAt sql.NullTime
+	// RotatedFromID is the key this one replaced, empty for a new key.
+	RotatedFromID string
+	// InboxIDs limits the key to these inboxes; empty allows all of the
+	// org's inboxes.
+	InboxIDs []string
+}
+
+// ErrKeyRotated is returned when rotating a key that was already replaced.
+var ErrKeyRotated = errors.New("cloud api key already rotated")
+
+const cloudAPIKeyColumns = `id, org_id, key_prefix, coalesce(label, ''), scopes::text, created_at, revoked_at, expires_at, coalesce(rotated_from_id::text, ''), inbox_ids::text`
+
+func scanCloudAPIKey(row interface{ Scan(...any) error }) (CloudAPIKey, error) {
+	var key CloudAPIKey
+	var scopesText, inboxIDsText string
+	if err := row.Scan(&key.ID, &key.OrgID, &key.KeyPrefix, &key.Label, &scopesText, &key.CreatedAt, &key.RevokedAt, &key.ExpiresAt, &key.RotatedFromID, &inboxIDsText); err != nil {
+		return key, err
+	}
+	key.Scopes = parseScopes(scopesText)
+	key.InboxIDs = parseScopes(inboxIDsText)
+	return key, nil
 }
 
 type ServiceToken struct {
@@ -41,6 +76,8 @@ type ServiceToken struct {
 	Scopes    []string
 	ExpiresAt time.Time
 	RevokedAt sql.NullTime
+	// InboxIDs limits the token like CloudAPIKey.InboxIDs.
+	InboxIDs []string
 }
 
 type OrgEntitlement struct {
@@ -54,7 +91,20 @@ type OrgEntitlement struct {
 	UsagePeriodStart   time.Time
 	UsagePeriodEnd     time.Time
 	GraceUntil         sql.NullTime
-	UpdatedAt          time.Time
+	// TrialEndsAt is set while the org is on a trial.
+	TrialEndsAt sql.NullTime
+	UpdatedAt   time.Time
+}
+
+const orgEntitlementColumns = `
+	org_id, plan_code, subscription_status, mcp_rpm, monthly_units, max_inboxes, max_domains,
+	usage_period_start, usage_period_end, grace_until, trial_ends_at, updated_at`
+
+func scanOrgEntitlement(row interface{ Scan(...any) error }) (OrgEntitlement, error) {
+	var ent OrgEntitlement
+	err := row.Scan(&ent.OrgID, &ent.PlanCode, &ent.SubscriptionStatus, &ent.MCPRPM, &ent.MonthlyUnits, &ent.MaxInboxes, &ent.MaxDomains,
+		&ent.UsagePeriodStart, &ent.UsagePeriodEnd, &ent.GraceUntil, &ent.TrialEndsAt, &ent.UpdatedAt)
+	return ent, err
 }
 
 type PlanEntitlement struct {
@@ -63,6 +113,29 @@ type PlanEntitlement struct {
 	MonthlyUnits int64
 	MaxInboxes   int
 	MaxDomains   int
+	// AuditRetentionDays is how long reconciliation keeps an org's audit
+	// entries; 0 keeps them forever.
+	AuditRetentionDays int
+	// TokenRPM and IPRPM cap MCP calls per credential and per client IP
+	// within the org's MCPRPM; 0 is unlimited.
+	TokenRPM int
+	IPRPM    int
+
+	// Catalog fields; see LookupKey.
+	DisplayName              string
+	StripeLookupKey          string
+	MonthlyPriceCents        int64
+	OverageLookupKey         string
+	OverageCentsPer1000Units int64
+	Listed                   bool
+}
+
+// LookupKey is the Stripe price lookup key the plan is sold under.
+func (p PlanEntitlement) LookupKey() string {
+	if p.StripeLookupKey != "" {
+		return p.StripeLookupKey
+	}
+	return p.PlanCode
 }
 
 type SubscriptionRecord struct {
@@ -97,6 +170,14 @@ type UsageCounter struct {
 }
 
 func Open(dsn string) (*Store, error) {
+	db, err := openPool(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db, q: db}, nil
+}
+
+func openPool(dsn string) (*sql.DB, error) {
 	if dsn == "" {
 		return nil, errors.New("missing database dsn")
 	}
@@ -107,7 +188,7 @@ func Open(dsn string) (*Store, error) {
 	db.SetMaxOpenConns(10)
 	db.SetMaxIdleConns(5)
 	db.SetConnMaxLifetime(30 * time.Minute)
-	return &Store{db: db, q: db}, nil
+	return db, nil
 }
 
 func (s *Store) DB() *sql.DB {
@@ -118,6 +199,9 @@ func (s *Store) Close() error {
 	if s.db == nil {
 		return nil
 	}
+	if s.replica != nil {
+		_ = s.replica.db.Close()
+	}
 	return s.db.Close()
 }
 
@@ -148,11 +232,43 @@ func (s *Store) RunAsOrg(ctx context.Context, orgID string, fn func(scoped *Stor
 		return err
 	}
 
-	scoped := &Store{db: s.db, q: tx}
+	var pending []VectorCleanup
+	scope := &orgScope{orgID: orgID}
+	defer scope.close()
+	scoped := &Store{db: s.db, q: scopedTx{Tx: tx, scope: scope}, cleanups: s.cleanups, pendingCleanups: &pending, replica: s.replica, scope: scope}
 	if err := fn(scoped); err != nil {
 		return err
 	}
-	return tx.Commit()
+	if IsDryRun(ctx) {
+		return nil
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, c := range pending {
+		s.queueVectorCleanup(ctx, c)
+	}
+	return nil
+}
+
+// InTransaction reports whether s is the store RunAsOrg hands its callback,
+// whose writes commit or roll back together.
+func (s *Store) InTransaction() bool {
+	return s.scope != nil
+}
+
+type dryRunContextKey struct{}
+
+// WithDryRun marks ctx so RunAsOrg rolls its transaction back instead of
+// committing it: a tool call run under it leaves no writes behind.
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunContextKey{}, true)
+}
+
+// IsDryRun reports whether ctx was marked by WithDryRun.
+func IsDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(dryRunContextKey{}).(bool)
+	return dryRun
 }
 
 type Thread struct {
@@ -165,7 +281,22 @@ type Thread struct {
 	SentimentScore   *float64
 	PriorityLevel    *string
 	ProviderThreadID string
-}
+	Labels           []string
+	Assignee         string
+	// AwaitingReply is who owes the next message: AwaitingUs or
+	// AwaitingCustomer, empty for a thread without messages yet.
+	// AwaitingReplySince is when the message that set it was sent.
+	AwaitingReply      string
+	AwaitingReplySince *time.Time
+}
+
+// Values of Thread.AwaitingReply. Inserting a message keeps them current:
+// an inbound one from a person leaves the thread awaiting us, an outbound
+// one awaiting the customer. Auto-replies and bulk mail change nothing.
+const (
+	AwaitingUs       = "us"
+	AwaitingCustomer = "customer"
+)
 
 type Message struct {
 	ID                string
@@ -179,9 +310,32 @@ type Message struct {
 	ProviderMessageID string
 	ProviderThreadID  string
 	InternetMessageID string
-	From              Participant
-	To                []Participant
-	CC                []Participant
+	// AliasAddress is the inbox alias an inbound message was sent to, empty
+	// when it was sent to the inbox's own address.
+	AliasAddress string
+	// AutoSubmitted is why an inbound message looks machine-sent, such as
+	// auto-replied or bulk; empty for mail from people.
+	AutoSubmitted string
+	// InReplyTo and References are the message's threading headers, as
+	// bracketed Message-IDs; References runs from the root to the parent.
+	InReplyTo  string
+	References []string
+	// RawText and RawHTML are the body as received; Text and HTML are the
+	// cleaned versions. Only set on insert.
+	RawText string
+	RawHTML string
+	// Oversized is set when the bodies were truncated on ingest because the
+	// message exceeded the configured size limits. RawObjectKey then names
+	// the object-store copy of the full message, if one was kept.
+	Oversized    bool
+	RawObjectKey string
+	// PIIClasses are the classes of personal data in the subject and text
+	// (see pii.Kinds). InsertMessage detects them when the caller leaves
+	// them nil.
+	PIIClasses []string
+	From       Participant
+	To         []Participant
+	CC         []Participant
 }
 
 type Participant struct {
@@ -190,29 +344,87 @@ type Participant struct {
 }
 
 type SearchResult struct {
-	MessageID string
-	ThreadID  string
-	Score     float64
-	Snippet   string
+	MessageID string  `json:"message_id"`
+	ThreadID  string  `json:"thread_id"`
+	Score     float64 `json:"score"`
+	Snippet   string  `json:"snippet"`
+	// SourceScores is the hit's score from each retrieval mode that found
+	// it, keyed vector or fts.
+	SourceScores map[string]float64 `json:"source_scores,omitempty"`
 }
 
 var ErrOwnershipMismatch = errors.New("resource does not belong to org")
 
-func (s *Store) ListThreads(ctx context.Context, inboxID string, status string, limit int) ([]Thread, error) {
+// ErrInvalidCursor is returned for a page cursor that Thread.Cursor or
+// Message.Cursor did not produce.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the ListThreads cursor that resumes a listing after t.
+func (t Thread) Cursor() string {
+	return encodeCursor(t.UpdatedAt, t.ID)
+}
+
+// Cursor is the GetThreadPage cursor that resumes a thread's messages
+// after m.
+func (m Message) Cursor() string {
+	return encodeCursor(m.CreatedAt, m.ID)
+}
+
+// encodeCursor packs the keyset position (at, id) into an opaque token.
+func encodeCursor(at time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(at.UTC().Format(time.RFC3339Nano) + "," + id))
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	rawAt, id, ok := strings.Cut(string(raw), ",")
+	if !ok {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	at, err := time.Parse(time.RFC3339Nano, rawAt)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return at, id, nil
+}
+
+// ListThreads returns an inbox's threads, most recently updated first. A
+// non-empty status or awaiting keeps only threads in that status or
+// awaiting a reply from that side. cursor, the Cursor of the last thread of
+// the previous page, resumes the listing after it; threads updated at the
+// same instant are ordered by id, so pages neither skip nor repeat them.
+func (s *Store) ListThreads(ctx context.Context, inboxID string, status string, awaiting string, cursor string, limit int) ([]Thread, error) {
 	if limit <= 0 {
 		limit = 50
 	}
-	query := `SELECT id, inbox_id, subject, status, participants, updated_at, sentiment_score, priority_level, provider_thread_id
-		FROM threads WHERE inbox_id = $1`
+	query := `SELECT ` + threadColumns + ` FROM threads WHERE inbox_id = $1`
 	args := []any{inboxID}
 	if status != "" {
-		query += " AND status = $2"
 		args = append(args, status)
+		query += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	if awaiting != "" {
+		args = append(args, awaiting)
+		query += fmt.Sprintf(" AND awaiting_reply = $%d", len(args))
+	}
+	if cursor != "" {
+		updatedAt, id, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, updatedAt, id)
+		query += fmt.Sprintf(" AND (updated_at, id) < ($%d, $%d::uuid)", len(args)-1, len(args))
 	}
-	query += fmt.Sprintf(" ORDER BY updated_at DESC LIMIT $%d", len(args)+1)
+	query += fmt.Sprintf(" ORDER BY updated_at DESC, id DESC LIMIT $%d", len(args)+1)
 	args = append(args, limit)
 
-	rows, err := s.q.QueryContext(ctx, query, args...)
+	rows, err := s.readQuery(ctx, []string{inboxReadKey(inboxID)}, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -220,27 +432,65 @@ func (s *Store) ListThreads(ctx context.Context, inboxID string, status string,
 
 	var threads []Thread
 	for rows.Next() {
-		var t Thread
-		var participantsJSON []byte
-		if err := rows.Scan(&t.ID, &t.InboxID, &t.Subject, &t.Status, &participantsJSON, &t.UpdatedAt, &t.SentimentScore, &t.PriorityLevel, &t.ProviderThreadID); err != nil {
+		t, err := scanThread(rows)
+		if err != nil {
 			return nil, err
 		}
-		_ = json.Unmarshal(participantsJSON, &t.Participants)
 		threads = append(threads, t)
 	}
 	return threads, rows.Err()
 }
 
+const threadColumns = `id, inbox_id, subject, status, participants, updated_at, sentiment_score, priority_level, provider_thread_id,
+	to_jsonb(labels), coalesce(assignee, ''), awaiting_reply, awaiting_reply_since`
+
+func scanThread(row interface{ Scan(...any) error }) (Thread, error) {
+	var t Thread
+	var participantsJSON, labelsJSON []byte
+	if err := row.Scan(&t.ID, &t.InboxID, &t.Subject, &t.Status, &participantsJSON, &t.UpdatedAt, &t.SentimentScore, &t.PriorityLevel, &t.ProviderThreadID, &labelsJSON, &t.Assignee, &t.AwaitingReply, &t.AwaitingReplySince); err != nil {
+		return t, err
+	}
+	_ = json.Unmarshal(participantsJSON, &t.Participants)
+	_ = json.Unmarshal(labelsJSON, &t.Labels)
+	return t, nil
+}
+
+// GetThread returns a thread with all of its messages, oldest first.
 func (s *Store) GetThread(ctx context.Context, threadID string) (Thread, []Message, error) {
+	return s.GetThreadPage(ctx, threadID, "", 0)
+}
+
+// GetThreadPage returns a thread with up to limit of its messages, oldest
+// first, resuming after the message cursor came from when it is set. A
+// limit of 0 returns every message.
+func (s *Store) GetThreadPage(ctx context.Context, threadID string, cursor string, limit int) (Thread, []Message, error) {
+	keys := []string{threadReadKey(threadID)}
 	var t Thread
-	var participantsJSON []byte
-	row := s.q.QueryRowContext(ctx, `SELECT id, inbox_id, subject, status, participants, updated_at, sentiment_score, priority_level, provider_thread_id FROM threads WHERE id = $1`, threadID)
-	if err := row.Scan(&t.ID, &t.InboxID, &t.Subject, &t.Status, &participantsJSON, &t.UpdatedAt, &t.SentimentScore, &t.PriorityLevel, &t.ProviderThreadID); err != nil {
+	err := s.readRow(ctx, keys, func(row interface{ Scan(...any) error }) error {
+		var err error
+		t, err = scanThread(row)
+		return err
+	}, `SELECT `+threadColumns+` FROM threads WHERE id = $1`, threadID)
+	if err != nil {
 		return t, nil, err
 	}
-	_ = json.Unmarshal(participantsJSON, &t.Participants)
 
-	rows, err := s.q.QueryContext(ctx, `SELECT id, inbox_id, thread_id, direction, subject, text, html, created_at, provider_message_id, internet_message_id, from_json, to_json, cc_json FROM messages WHERE thread_id = $1 ORDER BY created_at ASC`, threadID)
+	query := `SELECT id, inbox_id, thread_id, direction, subject, text, html, created_at, provider_message_id, internet_message_id, in_reply_to, reference_ids, alias_address, auto_submitted, oversized, raw_object_key, to_jsonb(pii_classes), from_json, to_json, cc_json FROM messages WHERE thread_id = $1`
+	args := []any{threadID}
+	if cursor != "" {
+		createdAt, id, err := decodeCursor(cursor)
+		if err != nil {
+			return t, nil, err
+		}
+		args = append(args, createdAt, id)
+		query += ` AND (created_at, id) > ($2, $3::uuid)`
+	}
+	query += ` ORDER BY created_at ASC, id ASC`
+	if limit > 0 {
+		args = append(args, limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	rows, err := s.readQuery(ctx, keys, query, args...)
 	if err != nil {
 		return t, nil, err
 	}
@@ -249,13 +499,16 @@ func (s *Store) GetThread(ctx context.Context, threadID string) (Thread, []Messa
 	var messages []Message
 	for rows.Next() {
 		var m Message
-		var fromJSON, toJSON, ccJSON []byte
-		if err := rows.Scan(&m.ID, &m.InboxID, &m.ThreadID, &m.Direction, &m.Subject, &m.Text, &m.HTML, &m.CreatedAt, &m.ProviderMessageID, &m.InternetMessageID, &fromJSON, &toJSON, &ccJSON); err != nil {
+		var fromJSON, toJSON, ccJSON, piiJSON []byte
+		var references string
+		if err := rows.Scan(&m.ID, &m.InboxID, &m.ThreadID, &m.Direction, &m.Subject, &m.Text, &m.HTML, &m.CreatedAt, &m.ProviderMessageID, &m.InternetMessageID, &m.InReplyTo, &references, &m.AliasAddress, &m.AutoSubmitted, &m.Oversized, &m.RawObjectKey, &piiJSON, &fromJSON, &toJSON, &ccJSON); err != nil {
 			return t, nil, err
 		}
 		_ = json.Unmarshal(fromJSON, &m.From)
 		_ = json.Unmarshal(toJSON, &m.To)
 		_ = json.Unmarshal(ccJSON, &m.CC)
+		_ = json.Unmarshal(piiJSON, &m.PIIClasses)
+		m.References = strings.Fields(references)
 		messages = append(messages, m)
 	}
 	return t, messages, rows.Err()
@@ -272,28 +525,37 @@ func (s *Store) GetThreadInboxID(ctx context.Context, threadID string) (string,
 
 func (s *Store) GetMessage(ctx context.Context, messageID string) (Message, error) {
 	var m Message
-	var fromJSON, toJSON, ccJSON []byte
-	row := s.q.QueryRowContext(ctx, `SELECT id, inbox_id, thread_id, direction, subject, text, html, created_at, provider_message_id, internet_message_id, from_json, to_json, cc_json FROM messages WHERE id = $1`, messageID)
-	if err := row.Scan(&m.ID, &m.InboxID, &m.ThreadID, &m.Direction, &m.Subject, &m.Text, &m.HTML, &m.CreatedAt, &m.ProviderMessageID, &m.InternetMessageID, &fromJSON, &toJSON, &ccJSON); err != nil {
+	var fromJSON, toJSON, ccJSON, piiJSON []byte
+	var references string
+	row := s.q.QueryRowContext(ctx, `SELECT id, inbox_id, thread_id, direction, subject, text, html, created_at, provider_message_id, internet_message_id, in_reply_to, reference_ids, alias_address, auto_submitted, oversized, raw_object_key, to_jsonb(pii_classes), from_json, to_json, cc_json FROM messages WHERE id = $1`, messageID)
+	if err := row.Scan(&m.ID, &m.InboxID, &m.ThreadID, &m.Direction, &m.Subject, &m.Text, &m.HTML, &m.CreatedAt, &m.ProviderMessageID, &m.InternetMessageID, &m.InReplyTo, &references, &m.AliasAddress, &m.AutoSubmitted, &m.Oversized, &m.RawObjectKey, &piiJSON, &fromJSON, &toJSON, &ccJSON); err != nil {
 		return m, err
 	}
 	_ = json.Unmarshal(fromJSON, &m.From)
 	_ = json.Unmarshal(toJSON, &m.To)
 	_ = json.Unmarshal(ccJSON, &m.CC)
+	_ = json.Unmarshal(piiJSON, &m.PIIClasses)
+	m.References = strings.Fields(references)
 	return m, nil
 }
 
-func (s *Store) SearchInboxFTS(ctx context.Context, inboxID string, query string, limit int) ([]SearchResult, error) {
+// SearchInboxFTS ranks an inbox's messages against query. A non-empty
+// direction keeps only inbound or outbound messages.
+func (s *Store) SearchInboxFTS(ctx context.Context, inboxID string, query string, limit int, direction string) ([]SearchResult, error) {
 	if limit <= 0 {
 		limit = 10
 	}
-	rows, err := s.q.QueryContext(ctx, `SELECT m.id, m.thread_id, ts_rank_cd(to_tsvector('simple', coalesce(m.text,'')), plainto_tsquery('simple', $2)) AS score,
+	rows, err := s.readQuery(ctx, []string{inboxReadKey(inboxID)}, `WITH q AS (
+			SELECT plainto_tsquery(`+inboxFTSConfigExpr("$1")+`, $2) AS tsq
+		)
+		SELECT m.id, m.thread_id, ts_rank_cd(m.search_tsv, q.tsq) AS score,
 		substring(m.text from 1 for 200) AS snippet
 		FROM messages m
 		JOIN threads t ON t.id = m.thread_id
-		WHERE t.inbox_id = $1 AND to_tsvector('simple', coalesce(m.text,'')) @@ plainto_tsquery('simple', $2)
+		CROSS JOIN q
+		WHERE t.inbox_id = $1 AND m.search_tsv @@ q.tsq AND ($4 = '' OR m.direction = $4)
 		ORDER BY score DESC
-		LIMIT $3`, inboxID, query, limit)
+		LIMIT $3`, inboxID, query, limit, direction)
 	if err != nil {
 		return nil, err
 	}
@@ -315,18 +577,19 @@ func (s *Store) UpsertThread(ctx context.Context, thread Thread) (string, error)
 		thread.ID = uuid.NewString()
 	}
 	participantsJSON, _ := json.Marshal(thread.Participants)
-	_, err := s.q.ExecContext(ctx, `INSERT INTO threads (id, inbox_id, org_id, subject, status, participants, updated_at, sentiment_score, priority_level, provider_thread_id)
-		VALUES ($1,$2,(SELECT org_id FROM inboxes WHERE id = $2),$3,$4,$5,$6,$7,$8,$9)
+	_, err := s.q.ExecContext(ctx, `INSERT INTO threads (id, inbox_id, org_id, subject, status, participants, updated_at, sentiment_score, priority_level, provider_thread_id, normalized_subject)
+		VALUES ($1,$2,(SELECT org_id FROM inboxes WHERE id = $2),$3,$4,$5,$6,$7,$8,$9,$10)
 		ON CONFLICT (id) DO UPDATE SET
 			org_id = EXCLUDED.org_id,
 			subject = EXCLUDED.subject,
+			normalized_subject = EXCLUDED.normalized_subject,
 			status = EXCLUDED.status,
 			participants = EXCLUDED.participants,
 			updated_at = EXCLUDED.updated_at,
 			sentiment_score = EXCLUDED.sentiment_score,
 			priority_level = EXCLUDED.priority_level,
 			provider_thread_id = EXCLUDED.provider_thread_id`,
-		thread.ID, thread.InboxID, thread.Subject, thread.Status, participantsJSON, thread.UpdatedAt, thread.SentimentScore, thread.PriorityLevel, thread.ProviderThreadID)
+		thread.ID, thread.InboxID, thread.Subject, thread.Status, participantsJSON, thread.UpdatedAt, thread.SentimentScore, thread.PriorityLevel, thread.ProviderThreadID, NormalizeSubject(thread.Subject))
 	if err != nil {
 		return "", err
 	}
@@ -340,21 +603,45 @@ func (s *Store) InsertMessage(ctx context.Context, msg Message) (string, error)
 	if msg.ProviderMessageID == "" {
 		msg.ProviderMessageID = msg.ID
 	}
+	if msg.PIIClasses == nil {
+		msg.PIIClasses = pii.Kinds(msg.Subject + "\n" + msg.Text)
+	}
 	fromJSON, _ := json.Marshal(msg.From)
 	toJSON, _ := json.Marshal(msg.To)
 	ccJSON, _ := json.Marshal(msg.CC)
-	row := s.q.QueryRowContext(ctx, `INSERT INTO messages (id, inbox_id, org_id, thread_id, direction, subject, text, html, created_at, provider_message_id, internet_message_id, from_json, to_json, cc_json)
-		VALUES ($1,$2,(SELECT org_id FROM inboxes WHERE id = $2),$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)
-		ON CONFLICT (inbox_id, provider_message_id) DO UPDATE SET thread_id = EXCLUDED.thread_id
-		RETURNING id`,
-		msg.ID, msg.InboxID, msg.ThreadID, msg.Direction, msg.Subject, msg.Text, msg.HTML, msg.CreatedAt, msg.ProviderMessageID, msg.InternetMessageID, fromJSON, toJSON, ccJSON)
+	// The thread's awaiting_reply follows its newest message; see AwaitingUs.
+	row := s.q.QueryRowContext(ctx, `WITH m AS (
+			INSERT INTO messages (id, inbox_id, org_id, thread_id, direction, subject, text, html, created_at, provider_message_id, internet_message_id, from_json, to_json, cc_json, fts_config, alias_address, auto_submitted, raw_text, raw_html, in_reply_to, reference_ids, oversized, raw_object_key, pii_classes)
+			VALUES ($1,$2,(SELECT org_id FROM inboxes WHERE id = $2),$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,`+inboxFTSConfigExpr("$2")+`,$14,$15,$16,$17,$18,$19,$20,$21,coalesce($22::text[], '{}'))
+			ON CONFLICT (inbox_id, provider_message_id) DO UPDATE SET thread_id = EXCLUDED.thread_id
+			RETURNING id, thread_id, direction, created_at, auto_submitted
+		), awaiting AS (
+			UPDATE threads t
+			SET awaiting_reply = CASE m.direction WHEN 'inbound' THEN 'us' ELSE 'customer' END,
+			    awaiting_reply_since = m.created_at
+			FROM m
+			WHERE t.id = m.thread_id
+			  AND (m.direction = 'outbound' OR (m.direction = 'inbound' AND m.auto_submitted = ''))
+			  AND (t.awaiting_reply_since IS NULL OR t.awaiting_reply_since <= m.created_at)
+		)
+		SELECT id FROM m`,
+		msg.ID, msg.InboxID, msg.ThreadID, msg.Direction, msg.Subject, msg.Text, msg.HTML, msg.CreatedAt, msg.ProviderMessageID, msg.InternetMessageID, fromJSON, toJSON, ccJSON, msg.AliasAddress, msg.AutoSubmitted, msg.RawText, msg.RawHTML, msg.InReplyTo, strings.Join(msg.References, " "), msg.Oversized, msg.RawObjectKey, msg.PIIClasses)
 	var id string
 	if err := row.Scan(&id); err != nil {
 		return "", err
 	}
+	s.replica.noteWrite(inboxReadKey(msg.InboxID), threadReadKey(msg.ThreadID))
 	return id, nil
 }
 
+// HasInternetMessageID reports whether any inbox already holds a message with
+// the given Message-ID header.
+func (s *Store) HasInternetMessageID(ctx context.Context, internetMessageID string) (bool, error) {
+	var exists bool
+	err := s.q.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM messages WHERE internet_message_id = $1)`, internetMessageID).Scan(&exists)
+	return exists, err
+}
+
 func (s *Store) RecordToolCall(ctx context.Context, toolName string, idempotencyKey string, modelName string, promptVersion string, latencyMS int) (string, error) {
 	id := uuid.NewString()
 	_, err := s.q.ExecContext(ctx, `INSERT INTO tool_calls (id, tool_name, idempotency_key, model_name, prompt_version, latency_ms) VALUES ($1,$2,$3,$4,$5,$6)`,
@@ -365,12 +652,6 @@ func (s *Store) RecordToolCall(ctx context.Context, toolName string, idempotency
 	return id, nil
 }
 
-func (s *Store) RecordAudit(ctx context.Context, toolCallID string, actor string, inputsHash string, outputsHash string, replayID string) error {
-	_, err := s.q.ExecContext(ctx, `INSERT INTO audit_log (tool_call_id, actor, inputs_hash, outputs_hash, replay_id) VALUES ($1,$2,$3,$4,$5)`,
-		toolCallID, actor, inputsHash, outputsHash, replayID)
-	return err
-}
-
 func (s *Store) EnsureInbox(ctx context.Context, address string) (string, error) {
 	orgID, err := s.EnsureDefaultOrg(ctx)
 	if err != nil {
@@ -395,7 +676,7 @@ func (s *Store) ListAudit(ctx context.Context, limit int) ([]map[string]any, err
 	if limit <= 0 {
 		limit = 20
 	}
-	rows, err := s.q.QueryContext(ctx, `SELECT a.id, a.replay_id, a.created_at, t.tool_name, t.latency_ms
+	rows, err := s.q.QueryContext(ctx, `SELECT a.id, a.replay_id, a.created_at, t.tool_name, t.latency_ms, to_jsonb(a.policy_rule_ids)
 		FROM audit_log a
 		LEFT JOIN tool_calls t ON t.id = a.tool_call_id
 		ORDER BY a.created_at DESC
@@ -410,15 +691,23 @@ func (s *Store) ListAudit(ctx context.Context, limit int) ([]map[string]any, err
 		var id, replayID, toolName sql.NullString
 		var createdAt time.Time
 		var latency sql.NullInt64
-		if err := rows.Scan(&id, &replayID, &createdAt, &toolName, &latency); err != nil {
+		var ruleIDsJSON []byte
+		if err := rows.Scan(&id, &replayID, &createdAt, &toolName, &latency, &ruleIDsJSON); err != nil {
 			return nil, err
 		}
+		var ruleIDs []string
+		if len(ruleIDsJSON) > 0 {
+			if err := json.Unmarshal(ruleIDsJSON, &ruleIDs); err != nil {
+				return nil, err
+			}
+		}
 		out = append(out, map[string]any{
-			"id":         id.String,
-			"replay_id":  replayID.String,
-			"created_at": createdAt,
-			"tool_name":  toolName.String,
-			"latency_ms": latency.Int64,
+			"id":              id.String,
+			"replay_id":       replayID.String,
+			"created_at":      createdAt,
+			"tool_name":       toolName.String,
+			"latency_ms":      latency.Int64,
+			"policy_rule_ids": ruleIDs,
 		})
 	}
 	return out, rows.Err()
@@ -556,11 +845,11 @@ func (s *Store) EnsureThread(ctx context.Context, inboxID string, providerThread
 		ProviderThreadID: providerThreadID,
 	}
 	participantsJSON, _ := json.Marshal(thread.Participants)
-	row := s.q.QueryRowContext(ctx, `INSERT INTO threads (id, inbox_id, org_id, subject, status, participants, updated_at, provider_thread_id)
-		VALUES ($1,$2,(SELECT org_id FROM inboxes WHERE id = $2),$3,$4,$5,$6,$7)
-		ON CONFLICT (inbox_id, provider_thread_id) DO UPDATE SET subject = EXCLUDED.subject, updated_at = EXCLUDED.updated_at
+	row := s.q.QueryRowContext(ctx, `INSERT INTO threads (id, inbox_id, org_id, subject, status, participants, updated_at, provider_thread_id, normalized_subject)
+		VALUES ($1,$2,(SELECT org_id FROM inboxes WHERE id = $2),$3,$4,$5,$6,$7,$8)
+		ON CONFLICT (inbox_id, provider_thread_id) DO UPDATE SET subject = EXCLUDED.subject, normalized_subject = EXCLUDED.normalized_subject, updated_at = EXCLUDED.updated_at
 		RETURNING id`,
-		thread.ID, thread.InboxID, thread.Subject, thread.Status, participantsJSON, thread.UpdatedAt, thread.ProviderThreadID)
+		thread.ID, thread.InboxID, thread.Subject, thread.Status, participantsJSON, thread.UpdatedAt, thread.ProviderThreadID, NormalizeSubject(thread.Subject))
 	var id string
 	if err := row.Scan(&id); err != nil {
 		return "", err
@@ -573,8 +862,27 @@ func (s *Store) UpdateThreadSignals(ctx context.Context, threadID string, sentim
 	return err
 }
 
+// SetThreadPriority sets the priority triage would, leaving the sentiment.
+func (s *Store) SetThreadPriority(ctx context.Context, threadID string, priority string) error {
+	_, err := s.q.ExecContext(ctx, `UPDATE threads SET priority_level = $2 WHERE id = $1`, threadID, priority)
+	return err
+}
+
+// ThreadForMessage returns the thread msg belongs in, starting one when
+// ResolveThread finds none.
+func (s *Store) ThreadForMessage(ctx context.Context, inboxID string, providerThreadID string, msg Message) (string, error) {
+	msg.ProviderThreadID = providerThreadID
+	threadIDs, err := s.ThreadsForMessages(ctx, inboxID, []Message{msg})
+	if err != nil {
+		return "", err
+	}
+	return threadIDs[0], nil
+}
+
+// InsertMessageWithThread stores msg on the thread it belongs to, creating
+// the thread if needed. See ResolveThread for how an existing thread is found.
 func (s *Store) InsertMessageWithThread(ctx context.Context, inboxID string, providerThreadID string, msg Message) (string, string, error) {
-	threadID, err := s.EnsureThread(ctx, inboxID, providerThreadID, msg.Subject, append([]Participant{msg.From}, msg.To...))
+	threadID, err := s.ThreadForMessage(ctx, inboxID, providerThreadID, msg)
 	if err != nil {
 		return "", "", err
 	}
@@ -601,17 +909,10 @@ func (s *Store) EnsureDefaults(ctx context.Context, inboxAddress string) (string
 }
 
 func (s *Store) LookupCloudAPIKey(ctx context.Context, keyHash string) (CloudAPIKey, error) {
-	var key CloudAPIKey
 	if keyHash == "" {
-		return key, sql.ErrNoRows
+		return CloudAPIKey{}, sql.ErrNoRows
 	}
-	var scopesText string
-	row := s.q.QueryRowContext(ctx, `SELECT id, org_id, scopes::text, revoked_at FROM cloud_api_keys WHERE key_hash = $1`, keyHash)
-	if err := row.Scan(&key.ID, &key.OrgID, &scopesText, &key.RevokedAt); err != nil {
-		return key, err
-	}
-	key.Scopes = parseScopes(scopesText)
-	return key, nil
+	return scanCloudAPIKey(s.q.QueryRowContext(ctx, `SELECT `+cloudAPIKeyColumns+` FROM cloud_api_keys WHERE key_hash = $1`, keyHash))
 }
 
 func (s *Store) EnsureInboxBelongsToOrg(ctx context.Context, inboxID string, orgID string) error {
@@ -650,29 +951,11 @@ func (s *Store) CountInboxesByOrg(ctx context.Context, orgID string) (int, error
 }
 
 func (s *Store) GetOrgEntitlement(ctx context.Context, orgID string) (OrgEntitlement, error) {
-	var ent OrgEntitlement
-	row := s.q.QueryRowContext(ctx, `
-		SELECT org_id, plan_code, subscription_status, mcp_rpm, monthly_units, max_inboxes, max_domains,
-		       usage_period_start, usage_period_end, grace_until, updated_at
+	return scanOrgEntitlement(s.q.QueryRowContext(ctx, `
+		SELECT `+orgEntitlementColumns+`
 		FROM org_entitlements
 		WHERE org_id = $1
-	`, orgID)
-	if err := row.Scan(
-		&ent.OrgID,
-		&ent.PlanCode,
-		&ent.SubscriptionStatus,
-		&ent.MCPRPM,
-		&ent.MonthlyUnits,
-		&ent.MaxInboxes,
-		&ent.MaxDomains,
-		&ent.UsagePeriodStart,
-		&ent.UsagePeriodEnd,
-		&ent.GraceUntil,
-		&ent.UpdatedAt,
-	); err != nil {
-		return ent, err
-	}
-	return ent, nil
+	`, orgID))
 }
 
 func (s *Store) UpdateOrgEntitlementUsagePeriod(ctx context.Context, orgID string, usagePeriodStart, usagePeriodEnd time.Time) error {
@@ -714,6 +997,19 @@ func (s *Store) ReserveOrgUsageUnits(ctx context.Context, orgID string, meterNam
 	return true, used, nil
 }
 
+// AddOrgUsageUnits charges units after the fact, without the monthly cap
+// ReserveOrgUsageUnits enforces.
+func (s *Store) AddOrgUsageUnits(ctx context.Context, orgID string, meterName string, periodStart time.Time, quantity int64) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE org_usage_counters
+		SET used = used + $4, updated_at = now()
+		WHERE org_id = $1
+		  AND meter_name = $2
+		  AND period_start = $3
+	`, orgID, meterName, periodStart, quantity)
+	return err
+}
+
 func (s *Store) ReleaseOrgUsageUnits(ctx context.Context, orgID string, meterName string, periodStart time.Time, quantity int64) error {
 	_, err := s.q.ExecContext(ctx, `
 		UPDATE org_usage_counters
@@ -789,8 +1085,7 @@ func (s *Store) SetOrgUsageCounterUsed(ctx context.Context, orgID string, meterN
 
 func (s *Store) ListExpiredOrgEntitlements(ctx context.Context, now time.Time) ([]OrgEntitlement, error) {
 	rows, err := s.q.QueryContext(ctx, `
-		SELECT org_id, plan_code, subscription_status, mcp_rpm, monthly_units, max_inboxes, max_domains,
-		       usage_period_start, usage_period_end, grace_until, updated_at
+		SELECT `+orgEntitlementColumns+`
 		FROM org_entitlements
 		WHERE usage_period_end < $1
 	`, now)
@@ -801,20 +1096,8 @@ func (s *Store) ListExpiredOrgEntitlements(ctx context.Context, now time.Time) (
 
 	var items []OrgEntitlement
 	for rows.Next() {
-		var ent OrgEntitlement
-		if err := rows.Scan(
-			&ent.OrgID,
-			&ent.PlanCode,
-			&ent.SubscriptionStatus,
-			&ent.MCPRPM,
-			&ent.MonthlyUnits,
-			&ent.MaxInboxes,
-			&ent.MaxDomains,
-			&ent.UsagePeriodStart,
-			&ent.UsagePeriodEnd,
-			&ent.GraceUntil,
-			&ent.UpdatedAt,
-		); err != nil {
+		ent, err := scanOrgEntitlement(rows)
+		if err != nil {
 			return nil, err
 		}
 		items = append(items, ent)
@@ -822,29 +1105,72 @@ func (s *Store) ListExpiredOrgEntitlements(ctx context.Context, now time.Time) (
 	return items, rows.Err()
 }
 
-func (s *Store) RecordUsageEvent(ctx context.Context, orgID string, meterName string, quantity int64, toolName string, replayID string, auditID string, status string) error {
+// ExpireTrials moves every trial that ended at or before now to
+// 'trial_expired' and returns the orgs it moved.
+func (s *Store) ExpireTrials(ctx context.Context, now time.Time) ([]string, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		UPDATE org_entitlements
+		SET subscription_status = 'trial_expired', updated_at = now()
+		WHERE subscription_status = 'trialing' AND trial_ends_at <= $1
+		RETURNING org_id
+	`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgIDs []string
+	for rows.Next() {
+		var orgID string
+		if err := rows.Scan(&orgID); err != nil {
+			return nil, err
+		}
+		orgIDs = append(orgIDs, orgID)
+	}
+	return orgIDs, rows.Err()
+}
+
+// RecordUsageEvent records a metered call: weight is the tool's base weight,
+// quantity what was charged in all.
+// RecordUsageEvent notes a metered tool call; cached marks one answered from
+// the model response cache.
+func (s *Store) RecordUsageEvent(ctx context.Context, orgID string, meterName string, quantity int64, weight int64, toolName string, replayID string, auditID string, status string, cached bool) error {
 	var audit sql.NullString
 	if auditID != "" {
 		audit = sql.NullString{String: auditID, Valid: true}
 	}
 	_, err := s.q.ExecContext(ctx, `
-		INSERT INTO usage_events (id, org_id, meter_name, quantity, tool_name, replay_id, audit_id, status)
-		VALUES ($1, $2, $3, $4, $5, $6, nullif($7, '')::uuid, $8)
-	`, uuid.NewString(), orgID, meterName, quantity, toolName, replayID, audit.String, status)
+		INSERT INTO usage_events (id, org_id, meter_name, quantity, weight, tool_name, replay_id, audit_id, status, cached)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, nullif($8, '')::uuid, $9, $10)
+	`, uuid.NewString(), orgID, meterName, quantity, weight, toolName, replayID, audit.String, status, cached)
 	return err
 }
 
 func (s *Store) GetPlanEntitlement(ctx context.Context, planCode string) (PlanEntitlement, error) {
-	var plan PlanEntitlement
 	row := s.q.QueryRowContext(ctx, `
-		SELECT plan_code, mcp_rpm, monthly_units, max_inboxes, max_domains
+		SELECT `+planEntitlementColumns+`
 		FROM plan_entitlements
 		WHERE plan_code = $1
 	`, planCode)
-	if err := row.Scan(&plan.PlanCode, &plan.MCPRPM, &plan.MonthlyUnits, &plan.MaxInboxes, &plan.MaxDomains); err != nil {
-		return plan, err
+	return scanPlanEntitlement(row)
+}
+
+// GetPlanToolWeights returns a plan's per-tool weight overrides, empty when
+// the plan has none or does not exist.
+func (s *Store) GetPlanToolWeights(ctx context.Context, planCode string) (map[string]int64, error) {
+	var raw []byte
+	err := s.q.QueryRowContext(ctx, `SELECT tool_weights FROM plan_entitlements WHERE plan_code = $1`, planCode).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return map[string]int64{}, nil
+	}
+	if err != nil {
+		return nil, err
 	}
-	return plan, nil
+	weights := map[string]int64{}
+	if err := json.Unmarshal(raw, &weights); err != nil {
+		return nil, fmt.Errorf("plan %s tool_weights: %w", planCode, err)
+	}
+	return weights, nil
 }
 
 func (s *Store) UpsertSubscription(ctx context.Context, sub SubscriptionRecord) error {
@@ -930,15 +1256,18 @@ func (s *Store) FindStripeCustomerByOrg(ctx context.Context, orgID string) (stri
 }
 
 func (s *Store) UpsertOrgEntitlement(ctx context.Context, ent OrgEntitlement) error {
-	var grace any
+	var grace, trialEnds any
 	if ent.GraceUntil.Valid {
 		grace = ent.GraceUntil.Time
 	}
+	if ent.TrialEndsAt.Valid {
+		trialEnds = ent.TrialEndsAt.Time
+	}
 	_, err := s.q.ExecContext(ctx, `
 		INSERT INTO org_entitlements (
 			org_id, plan_code, subscription_status, mcp_rpm, monthly_units, max_inboxes, max_domains,
-			usage_period_start, usage_period_end, grace_until
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			usage_period_start, usage_period_end, grace_until, trial_ends_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 		ON CONFLICT (org_id) DO UPDATE SET
 			plan_code = EXCLUDED.plan_code,
 			subscription_status = EXCLUDED.subscription_status,
@@ -949,8 +1278,9 @@ func (s *Store) UpsertOrgEntitlement(ctx context.Context, ent OrgEntitlement) er
 			usage_period_start = EXCLUDED.usage_period_start,
 			usage_period_end = EXCLUDED.usage_period_end,
 			grace_until = EXCLUDED.grace_until,
+			trial_ends_at = EXCLUDED.trial_ends_at,
 			updated_at = now()
-	`, ent.OrgID, ent.PlanCode, ent.SubscriptionStatus, ent.MCPRPM, ent.MonthlyUnits, ent.MaxInboxes, ent.MaxDomains, ent.UsagePeriodStart, ent.UsagePeriodEnd, grace)
+	`, ent.OrgID, ent.PlanCode, ent.SubscriptionStatus, ent.MCPRPM, ent.MonthlyUnits, ent.MaxInboxes, ent.MaxDomains, ent.UsagePeriodStart, ent.UsagePeriodEnd, grace, trialEnds)
 	return err
 }
 
@@ -1007,6 +1337,77 @@ func (s *Store) CreateOrg(ctx context.Context, name string) (string, error) {
 	return id, nil
 }
 
+// OrgSummary is one org as ListOrgs reports it. PlanCode and
+// SubscriptionStatus are empty for an org without entitlements.
+type OrgSummary struct {
+	ID                 string
+	Name               string
+	Region             string
+	Sandbox            bool
+	PlanCode           string
+	SubscriptionStatus string
+	CreatedAt          time.Time
+}
+
+// ListOrgs returns every org not merged into another, newest first.
+func (s *Store) ListOrgs(ctx context.Context) ([]OrgSummary, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT o.id, o.name, coalesce(o.region, ''), o.sandbox,
+		       coalesce(e.plan_code, ''), coalesce(e.subscription_status, ''), o.created_at
+		FROM orgs o
+		LEFT JOIN org_entitlements e ON e.org_id = o.id
+		WHERE o.merged_into IS NULL
+		ORDER BY o.created_at DESC, o.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []OrgSummary
+	for rows.Next() {
+		var o OrgSummary
+		if err := rows.Scan(&o.ID, &o.Name, &o.Region, &o.Sandbox, &o.PlanCode, &o.SubscriptionStatus, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
+
+// DeleteOrg deletes an org and, through the foreign keys, everything it
+// owns, and queues the removal of its inboxes' vector points. It reports
+// false if there was no such org.
+func (s *Store) DeleteOrg(ctx context.Context, orgID string) (bool, error) {
+	rows, err := s.q.QueryContext(ctx, `SELECT id::text FROM inboxes WHERE org_id = $1`, orgID)
+	if err != nil {
+		return false, err
+	}
+	var inboxIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return false, err
+		}
+		inboxIDs = append(inboxIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	res, err := s.q.ExecContext(ctx, `DELETE FROM orgs WHERE id = $1`, orgID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	s.queueVectorCleanup(ctx, VectorCleanup{InboxIDs: inboxIDs})
+	return true, nil
+}
+
 func (s *Store) GetOrgMCPEndpoint(ctx context.Context, orgID string) (string, error) {
 	row := s.q.QueryRowContext(ctx, `
 		SELECT coalesce(mcp_endpoint, '')
@@ -1070,14 +1471,14 @@ func (s *Store) GetSubscriptionSummaryByOrg(ctx context.Context, orgID string) (
 	return summary, nil
 }
 
-func (s *Store) CreateServiceToken(ctx context.Context, tokenID string, orgID string, actor string, scopes []string, expiresAt time.Time) error {
+func (s *Store) CreateServiceToken(ctx context.Context, tokenID string, orgID string, actor string, scopes []string, inboxIDs []string, expiresAt time.Time) error {
 	if tokenID == "" {
 		tokenID = uuid.NewString()
 	}
 	_, err := s.q.ExecContext(ctx, `
-		INSERT INTO service_tokens (id, org_id, actor, scopes, expires_at)
-		VALUES ($1, $2, $3, $4, $5)
-	`, tokenID, orgID, actor, scopes, expiresAt)
+		INSERT INTO service_tokens (id, org_id, actor, scopes, expires_at, inbox_ids)
+		VALUES ($1, $2, $3, $4, $5, coalesce($6::text[], '{}'))
+	`, tokenID, orgID, actor, scopes, expiresAt, inboxIDs)
 	return err
 }
 
@@ -1097,37 +1498,64 @@ func (s *Store) GetServiceToken(ctx context.Context, tokenID string) (ServiceTok
 	if tokenID == "" {
 		return token, sql.ErrNoRows
 	}
-	var scopesText string
+	var scopesText, inboxIDsText string
 	row := s.q.QueryRowContext(ctx, `
-		SELECT id, org_id, actor, scopes::text, expires_at, revoked_at
+		SELECT id, org_id, actor, scopes::text, expires_at, revoked_at, inbox_ids::text
 		FROM service_tokens
 		WHERE id = $1
 	`, tokenID)
-	if err := row.Scan(&token.ID, &token.OrgID, &token.Actor, &scopesText, &token.ExpiresAt, &token.RevokedAt); err != nil {
+	if err := row.Scan(&token.ID, &token.OrgID, &token.Actor, &scopesText, &token.ExpiresAt, &token.RevokedAt, &inboxIDsText); err != nil {
 		return token, err
 	}
 	token.Scopes = parseScopes(scopesText)
+	token.InboxIDs = parseScopes(inboxIDsText)
 	return token, nil
 }
 
-func (s *Store) CreateCloudAPIKey(ctx context.Context, orgID string, keyPrefix string, keyHash string, label string, scopes []string) (CloudAPIKey, error) {
-	var key CloudAPIKey
-	var scopesText string
-	row := s.q.QueryRowContext(ctx, `
-		INSERT INTO cloud_api_keys (org_id, key_prefix, key_hash, label, scopes)
-		VALUES ($1, $2, $3, nullif($4, ''), $5)
-		RETURNING id, org_id, key_prefix, coalesce(label, ''), scopes::text, created_at, revoked_at
-	`, orgID, keyPrefix, keyHash, label, scopes)
-	if err := row.Scan(&key.ID, &key.OrgID, &key.KeyPrefix, &key.Label, &scopesText, &key.CreatedAt, &key.RevokedAt); err != nil {
+func (s *Store) CreateCloudAPIKey(ctx context.Context, orgID string, keyPrefix string, keyHash string, label string, scopes []string, inboxIDs []string) (CloudAPIKey, error) {
+	return scanCloudAPIKey(s.q.QueryRowContext(ctx, `
+		INSERT INTO cloud_api_keys (org_id, key_prefix, key_hash, label, scopes, inbox_ids)
+		VALUES ($1, $2, $3, nullif($4, ''), $5, coalesce($6::text[], '{}'))
+		RETURNING `+cloudAPIKeyColumns, orgID, keyPrefix, keyHash, label, scopes, inboxIDs))
+}
+
+// RotateCloudAPIKey replaces one of orgID's working keys with a new key with
+// the same label, scopes and inbox allowlist, and lets the old key expire at oldExpiresAt
+// (or its earlier expiry). A key that is unknown, revoked or expired returns
+// sql.ErrNoRows; one already replaced returns ErrKeyRotated.
+func (s *Store) RotateCloudAPIKey(ctx context.Context, orgID string, keyID string, keyPrefix string, keyHash string, oldExpiresAt time.Time) (CloudAPIKey, error) {
+	key, err := scanCloudAPIKey(s.q.QueryRowContext(ctx, `
+		WITH old AS (
+			UPDATE cloud_api_keys
+			SET expires_at = least(expires_at, $5)
+			WHERE id = $1
+			  AND org_id = $2
+			  AND revoked_at IS NULL
+			  AND (expires_at IS NULL OR expires_at > now())
+			  AND NOT EXISTS (SELECT 1 FROM cloud_api_keys r WHERE r.rotated_from_id = $1)
+			RETURNING id, org_id, label, scopes, inbox_ids
+		)
+		INSERT INTO cloud_api_keys (org_id, key_prefix, key_hash, label, scopes, inbox_ids, rotated_from_id)
+		SELECT org_id, $3, $4, label, scopes, inbox_ids, id FROM old
+		RETURNING `+cloudAPIKeyColumns, keyID, orgID, keyPrefix, keyHash, oldExpiresAt))
+	if !errors.Is(err, sql.ErrNoRows) {
 		return key, err
 	}
-	key.Scopes = parseScopes(scopesText)
-	return key, nil
+	var rotated bool
+	if err := s.q.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM cloud_api_keys WHERE rotated_from_id = $1 AND org_id = $2)
+	`, keyID, orgID).Scan(&rotated); err != nil {
+		return CloudAPIKey{}, err
+	}
+	if rotated {
+		return CloudAPIKey{}, ErrKeyRotated
+	}
+	return CloudAPIKey{}, sql.ErrNoRows
 }
 
 func (s *Store) ListCloudAPIKeys(ctx context.Context, orgID string) ([]CloudAPIKey, error) {
 	rows, err := s.q.QueryContext(ctx, `
-		SELECT id, org_id, key_prefix, coalesce(label, ''), scopes::text, created_at, revoked_at
+		SELECT `+cloudAPIKeyColumns+`
 		FROM cloud_api_keys
 		WHERE org_id = $1
 		ORDER BY created_at DESC
@@ -1139,12 +1567,10 @@ func (s *Store) ListCloudAPIKeys(ctx context.Context, orgID string) ([]CloudAPIK
 
 	keys := make([]CloudAPIKey, 0)
 	for rows.Next() {
-		var key CloudAPIKey
-		var scopesText string
-		if err := rows.Scan(&key.ID, &key.OrgID, &key.KeyPrefix, &key.Label, &scopesText, &key.CreatedAt, &key.RevokedAt); err != nil {
+		key, err := scanCloudAPIKey(rows)
+		if err != nil {
 			return nil, err
 		}
-		key.Scopes = parseScopes(scopesText)
 		keys = append(keys, key)
 	}
 	return keys, rows.Err()
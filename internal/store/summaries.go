@@ -0,0 +1,37 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+type MessageSummary struct {
+	MessageID string
+	Provider  string
+	Model     string
+	Summary   string
+	Tokens    int
+	CreatedAt time.Time
+}
+
+// GetMessageSummary looks up a cached summary, or returns sql.ErrNoRows.
+// Like translations, summaries are keyed by provider and model.
+func (s *Store) GetMessageSummary(ctx context.Context, messageID, provider, model string) (MessageSummary, error) {
+	var m MessageSummary
+	err := s.q.QueryRowContext(ctx, `
+		SELECT message_id, provider, model, summary, tokens, created_at
+		FROM message_summaries
+		WHERE message_id = $1 AND provider = $2 AND model = $3
+	`, messageID, provider, model).Scan(&m.MessageID, &m.Provider, &m.Model, &m.Summary, &m.Tokens, &m.CreatedAt)
+	return m, err
+}
+
+func (s *Store) UpsertMessageSummary(ctx context.Context, m MessageSummary) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO message_summaries (message_id, org_id, provider, model, summary, tokens)
+		VALUES ($1, (SELECT org_id FROM messages WHERE id = $1), $2, $3, $4, $5)
+		ON CONFLICT (message_id, provider, model)
+		DO UPDATE SET summary = EXCLUDED.summary, tokens = EXCLUDED.tokens, created_at = now()
+	`, m.MessageID, m.Provider, m.Model, m.Summary, m.Tokens)
+	return err
+}
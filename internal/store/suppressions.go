@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+	"strings"
+)
+
+// Reasons an address is on an org's suppression list.
+const (
+	SuppressHardBounce = "hard_bounce"
+	SuppressComplaint  = "complaint"
+)
+
+// AddSuppression stops further sends to address from the org that owns
+// inboxID. sourceMessageID is the bounce or complaint that caused it. An
+// address already on the list keeps its first entry.
+func (s *Store) AddSuppression(ctx context.Context, inboxID string, address string, reason string, sourceMessageID string) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO suppressions (org_id, address, reason, source_message_id)
+		VALUES ((SELECT org_id FROM inboxes WHERE id = $1), $2, $3, nullif($4, '')::uuid)
+		ON CONFLICT DO NOTHING
+	`, inboxID, normalizeSuppressed(address), reason, sourceMessageID)
+	return err
+}
+
+// AddOrgSuppression is AddSuppression for a send known by its org rather
+// than its inbox, as a provider's delivery event is; orgID is empty for
+// mail sent without one.
+func (s *Store) AddOrgSuppression(ctx context.Context, orgID string, address string, reason string) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO suppressions (org_id, address, reason)
+		VALUES (nullif($1, '')::uuid, $2, $3)
+		ON CONFLICT DO NOTHING
+	`, orgID, normalizeSuppressed(address), reason)
+	return err
+}
+
+// IsSuppressed reports whether the org that owns inboxID must not send to
+// address.
+func (s *Store) IsSuppressed(ctx context.Context, inboxID string, address string) (bool, error) {
+	var suppressed bool
+	err := s.q.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM suppressions
+			WHERE address = $2
+			  AND org_id IS NOT DISTINCT FROM (SELECT org_id FROM inboxes WHERE id = $1)
+		)
+	`, inboxID, normalizeSuppressed(address)).Scan(&suppressed)
+	return suppressed, err
+}
+
+func normalizeSuppressed(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// ThreadSummary is the summary summarize_thread last stored on a thread.
+// MessageID and MessageCount are the newest message it read and how many it
+// read; a thread that has moved past either is stale.
+type ThreadSummary struct {
+	ThreadID     string
+	Summary      json.RawMessage
+	Model        string
+	MessageID    string
+	MessageCount int
+	SummarizedAt time.Time
+}
+
+// Stale reports whether messages, the thread's messages oldest first, hold
+// any the summary did not read.
+func (t ThreadSummary) Stale(messages []Message) bool {
+	if len(messages) != t.MessageCount {
+		return true
+	}
+	return len(messages) > 0 && messages[len(messages)-1].ID != t.MessageID
+}
+
+// GetThreadSummary returns the thread's stored summary, or sql.ErrNoRows if
+// it has never been summarized.
+func (s *Store) GetThreadSummary(ctx context.Context, threadID string) (ThreadSummary, error) {
+	t := ThreadSummary{ThreadID: threadID}
+	var summary []byte
+	var messageID sql.NullString
+	var summarizedAt sql.NullTime
+	err := s.q.QueryRowContext(ctx, `
+		SELECT summary, summary_model, summary_message_id, summary_message_count, summarized_at
+		FROM threads
+		WHERE id = $1
+	`, threadID).Scan(&summary, &t.Model, &messageID, &t.MessageCount, &summarizedAt)
+	if err != nil {
+		return t, err
+	}
+	if summary == nil || !summarizedAt.Valid {
+		return t, sql.ErrNoRows
+	}
+	t.Summary = summary
+	t.MessageID = messageID.String
+	t.SummarizedAt = summarizedAt.Time
+	return t, nil
+}
+
+// SetThreadSummary stores t on its thread in place of any earlier summary,
+// and returns when it was stored.
+func (s *Store) SetThreadSummary(ctx context.Context, t ThreadSummary) (time.Time, error) {
+	var summarizedAt time.Time
+	err := s.q.QueryRowContext(ctx, `
+		UPDATE threads
+		SET summary = $2::jsonb, summary_model = $3, summary_message_id = nullif($4::text, '')::uuid,
+		    summary_message_count = $5, summarized_at = now()
+		WHERE id = $1
+		RETURNING summarized_at
+	`, t.ThreadID, string(t.Summary), t.Model, t.MessageID, t.MessageCount).Scan(&summarizedAt)
+	return summarizedAt, err
+}
+
+// SummarizedThread names a thread that holds a summary, with its org.
+type SummarizedThread struct {
+	ThreadID string
+	OrgID    string
+}
+
+// SummarizedThreads returns the threads of messageIDs that hold a summary,
+// which those messages have made stale.
+func (s *Store) SummarizedThreads(ctx context.Context, messageIDs []string) ([]SummarizedThread, error) {
+	if len(messageIDs) == 0 {
+		return nil, nil
+	}
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT DISTINCT t.id::text, coalesce(t.org_id::text, '')
+		FROM threads t
+		JOIN messages m ON m.thread_id = t.id
+		WHERE m.id = ANY($1::uuid[]) AND t.summary IS NOT NULL
+	`, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var threads []SummarizedThread
+	for rows.Next() {
+		var t SummarizedThread
+		if err := rows.Scan(&t.ThreadID, &t.OrgID); err != nil {
+			return nil, err
+		}
+		threads = append(threads, t)
+	}
+	return threads, rows.Err()
+}
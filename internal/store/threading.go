@@ -0,0 +1,289 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxThreadReferences bounds how many Message-IDs from a message's headers
+// are looked up; long References chains are trimmed from the root end.
+const maxThreadReferences = 20
+
+// subjectThreadWindow is how recently a thread must have been active for an
+// inbound reply to join it by subject alone.
+const subjectThreadWindow = 30 * 24 * time.Hour
+
+var replyPrefixRE = regexp.MustCompile(`(?i)^\s*(re|fwd?|aw|sv|antw)(\[\d+\])?\s*:\s*`)
+
+// NormalizeSubject strips reply and forward prefixes ("Re:", "Fwd:", "AW:",
+// "RE[2]:" and the like) and lowercases what is left, so a reply's subject
+// compares equal to the one it answers.
+func NormalizeSubject(subject string) string {
+	for {
+		loc := replyPrefixRE.FindStringIndex(subject)
+		if loc == nil {
+			break
+		}
+		subject = subject[loc[1]:]
+	}
+	return strings.ToLower(strings.Join(strings.Fields(subject), " "))
+}
+
+// ResolveThread finds the existing thread msg belongs to, or returns "" if it
+// starts a new one. In order it tries the provider's thread, the nearest
+// message msg names in In-Reply-To or References, and, for inbound replies
+// whose parent we never saw, a recently active thread with the same
+// normalized subject that the sender is already part of.
+func (s *Store) ResolveThread(ctx context.Context, inboxID string, providerThreadID string, msg Message) (string, error) {
+	var threadID string
+	if providerThreadID != "" {
+		err := s.q.QueryRowContext(ctx, `SELECT id FROM threads WHERE inbox_id = $1 AND provider_thread_id = $2`, inboxID, providerThreadID).Scan(&threadID)
+		if err == nil {
+			return threadID, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", err
+		}
+	}
+
+	for _, ref := range threadReferences(msg) {
+		err := s.q.QueryRowContext(ctx, `
+			SELECT thread_id FROM messages
+			WHERE inbox_id = $1 AND internet_message_id = $2
+			ORDER BY created_at
+			LIMIT 1
+		`, inboxID, ref).Scan(&threadID)
+		if err == nil {
+			return threadID, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", err
+		}
+	}
+
+	if !joinsBySubject(msg) {
+		return "", nil
+	}
+	return s.subjectThread(ctx, inboxID, msg)
+}
+
+// joinsBySubject reports whether msg is an inbound reply that may join a
+// thread by its subject alone.
+func joinsBySubject(msg Message) bool {
+	isReply := msg.InReplyTo != "" || len(msg.References) > 0 || replyPrefixRE.MatchString(msg.Subject)
+	return msg.Direction == "inbound" && isReply && NormalizeSubject(msg.Subject) != "" && msg.From.Email != ""
+}
+
+// subjectThread finds the recently active thread with msg's normalized
+// subject that msg's sender is part of, or returns "".
+func (s *Store) subjectThread(ctx context.Context, inboxID string, msg Message) (string, error) {
+	var threadID string
+	err := s.q.QueryRowContext(ctx, `
+		SELECT id FROM threads
+		WHERE inbox_id = $1 AND normalized_subject = $2 AND updated_at >= $3
+		  AND EXISTS (SELECT 1 FROM jsonb_array_elements(participants) p WHERE lower(p->>'email') = lower($4))
+		ORDER BY updated_at DESC
+		LIMIT 1
+	`, inboxID, NormalizeSubject(msg.Subject), time.Now().UTC().Add(-subjectThreadWindow), msg.From.Email).Scan(&threadID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return threadID, err
+}
+
+// ThreadsForMessages returns the thread each of msgs, about to be stored
+// together in inboxID, belongs in, as ThreadForMessage would for each in
+// turn: a message joins the thread an earlier one in msgs started or was
+// resolved to. The provider threads and the messages the batch refers to
+// are looked up in one query each and the new threads started in one
+// statement; only replies matched by subject are looked up one by one.
+func (s *Store) ThreadsForMessages(ctx context.Context, inboxID string, msgs []Message) ([]string, error) {
+	var providerIDs, refs []string
+	for _, msg := range msgs {
+		if msg.ProviderThreadID != "" {
+			providerIDs = append(providerIDs, msg.ProviderThreadID)
+		}
+		refs = append(refs, threadReferences(msg)...)
+	}
+	byProvider, err := s.lookupPairs(ctx, `
+		SELECT provider_thread_id, id::text FROM threads
+		WHERE inbox_id = $1 AND provider_thread_id = ANY($2::text[])
+	`, inboxID, providerIDs)
+	if err != nil {
+		return nil, err
+	}
+	byMessageID, err := s.lookupPairs(ctx, `
+		SELECT DISTINCT ON (internet_message_id) internet_message_id, thread_id::text FROM messages
+		WHERE inbox_id = $1 AND internet_message_id = ANY($2::text[])
+		ORDER BY internet_message_id, created_at
+	`, inboxID, refs)
+	if err != nil {
+		return nil, err
+	}
+
+	threadIDs := make([]string, len(msgs))
+	var started []Thread
+	startedFor := map[string]string{}
+	now := time.Now().UTC()
+	for i, msg := range msgs {
+		threadID := ""
+		if msg.ProviderThreadID != "" {
+			threadID = byProvider[msg.ProviderThreadID]
+		}
+		for _, ref := range threadReferences(msg) {
+			if threadID != "" {
+				break
+			}
+			threadID = byMessageID[ref]
+		}
+		if threadID == "" && joinsBySubject(msg) {
+			threadID = startedBySubject(started, msg)
+			if threadID == "" {
+				if threadID, err = s.subjectThread(ctx, inboxID, msg); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if threadID == "" {
+			threadID = startedFor[msg.ProviderThreadID]
+		}
+		if threadID == "" {
+			thread := Thread{
+				ID:               uuid.NewString(),
+				InboxID:          inboxID,
+				Subject:          msg.Subject,
+				Status:           "open",
+				UpdatedAt:        now,
+				Participants:     append([]Participant{msg.From}, msg.To...),
+				ProviderThreadID: msg.ProviderThreadID,
+			}
+			started = append(started, thread)
+			startedFor[msg.ProviderThreadID] = thread.ID
+			if msg.ProviderThreadID != "" {
+				byProvider[msg.ProviderThreadID] = thread.ID
+			}
+			threadID = thread.ID
+		}
+		if _, ok := byMessageID[msg.InternetMessageID]; !ok && msg.InternetMessageID != "" {
+			byMessageID[msg.InternetMessageID] = threadID
+		}
+		threadIDs[i] = threadID
+	}
+
+	stored, err := s.startThreads(ctx, inboxID, started)
+	if err != nil {
+		return nil, err
+	}
+	for i, id := range threadIDs {
+		if storedID, ok := stored[id]; ok {
+			threadIDs[i] = storedID
+		}
+	}
+	return threadIDs, nil
+}
+
+// startedBySubject is subjectThread for the threads a batch has started,
+// newest first.
+func startedBySubject(started []Thread, msg Message) string {
+	normalized := NormalizeSubject(msg.Subject)
+	for i := len(started) - 1; i >= 0; i-- {
+		if NormalizeSubject(started[i].Subject) != normalized {
+			continue
+		}
+		for _, p := range started[i].Participants {
+			if strings.EqualFold(p.Email, msg.From.Email) {
+				return started[i].ID
+			}
+		}
+	}
+	return ""
+}
+
+// startThreads stores threads, new threads of inboxID, as EnsureThread
+// would each: one whose provider thread is already stored is that thread.
+// It returns the stored id of each thread by the id it was given.
+func (s *Store) startThreads(ctx context.Context, inboxID string, threads []Thread) (map[string]string, error) {
+	stored := map[string]string{}
+	if len(threads) == 0 {
+		return stored, nil
+	}
+	ids := make([]string, len(threads))
+	subjects := make([]string, len(threads))
+	participants := make([]string, len(threads))
+	providerIDs := make([]string, len(threads))
+	normalized := make([]string, len(threads))
+	given := map[string]string{}
+	for i, t := range threads {
+		participantsJSON, _ := json.Marshal(t.Participants)
+		ids[i], subjects[i], participants[i], providerIDs[i] = t.ID, t.Subject, string(participantsJSON), t.ProviderThreadID
+		normalized[i] = NormalizeSubject(t.Subject)
+		given[t.ProviderThreadID] = t.ID
+	}
+	rows, err := s.q.QueryContext(ctx, `
+		INSERT INTO threads (id, inbox_id, org_id, subject, status, participants, updated_at, provider_thread_id, normalized_subject)
+		SELECT t.id::uuid, $1, (SELECT org_id FROM inboxes WHERE id = $1), t.subject, 'open', t.participants::jsonb, $2, t.provider_thread_id, t.normalized_subject
+		FROM unnest($3::text[], $4::text[], $5::text[], $6::text[], $7::text[]) AS t(id, subject, participants, provider_thread_id, normalized_subject)
+		ON CONFLICT (inbox_id, provider_thread_id) DO UPDATE SET subject = EXCLUDED.subject, normalized_subject = EXCLUDED.normalized_subject, updated_at = EXCLUDED.updated_at
+		RETURNING id::text, provider_thread_id
+	`, inboxID, threads[0].UpdatedAt, ids, subjects, participants, providerIDs, normalized)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, providerID string
+		if err := rows.Scan(&id, &providerID); err != nil {
+			return nil, err
+		}
+		stored[given[providerID]] = id
+	}
+	return stored, rows.Err()
+}
+
+// lookupPairs runs query, which selects two text columns, with inboxID and
+// values and returns the second column by the first. It skips the query
+// when values is empty.
+func (s *Store) lookupPairs(ctx context.Context, query string, inboxID string, values []string) (map[string]string, error) {
+	out := map[string]string{}
+	if len(values) == 0 {
+		return out, nil
+	}
+	rows, err := s.q.QueryContext(ctx, query, inboxID, values)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		out[key] = value
+	}
+	return out, rows.Err()
+}
+
+// threadReferences lists the Message-IDs msg refers to, nearest ancestor
+// first: In-Reply-To, then References from the parent back to the root.
+func threadReferences(msg Message) []string {
+	refs := make([]string, 0, len(msg.References)+1)
+	seen := map[string]bool{msg.InternetMessageID: true, "": true}
+	add := func(id string) {
+		if !seen[id] && len(refs) < maxThreadReferences {
+			seen[id] = true
+			refs = append(refs, id)
+		}
+	}
+	add(msg.InReplyTo)
+	for i := len(msg.References) - 1; i >= 0; i-- {
+		add(msg.References[i])
+	}
+	return refs
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNormalizeSubject(t *testing.T) {
+	cases := map[string]string{
+		"Refund request":              "refund request",
+		"Re: Refund request":          "refund request",
+		"RE: Fwd:  Refund   request ": "refund request",
+		"AW: re[2]: Refund request":   "refund request",
+		"Re:":                         "",
+		"Regarding refund":            "regarding refund",
+	}
+	for input, want := range cases {
+		if got := NormalizeSubject(input); got != want {
+			t.Fatalf("NormalizeSubject(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestThreadReferencesNearestFirst(t *testing.T) {
+	msg := Message{
+		InternetMessageID: "<c@x>",
+		InReplyTo:         "<b@x>",
+		References:        []string{"<root@x>", "<a@x>", "<b@x>", "<c@x>"},
+	}
+	if got := threadReferences(msg); !slices.Equal(got, []string{"<b@x>", "<a@x>", "<root@x>"}) {
+		t.Fatalf("unexpected references: %v", got)
+	}
+}
+
+func TestPageCursorRoundTrip(t *testing.T) {
+	at := time.Date(2026, 3, 1, 9, 30, 0, 123456000, time.UTC)
+	id := "3f0c6a4e-8a51-4f0e-9d55-1a2b3c4d5e6f"
+	for _, cursor := range []string{Thread{ID: id, UpdatedAt: at}.Cursor(), Message{ID: id, CreatedAt: at}.Cursor()} {
+		gotAt, gotID, err := decodeCursor(cursor)
+		if err != nil {
+			t.Fatalf("decode cursor: %v", err)
+		}
+		if !gotAt.Equal(at) || gotID != id {
+			t.Fatalf("expected to resume after %s at %s, got %s at %s", id, at, gotID, gotAt)
+		}
+	}
+	// The id is cast to uuid in the query, so a cursor that is not one is
+	// rejected here rather than by Postgres.
+	for _, bad := range []string{"not base64!", "bm8tY29tbWE", encodeCursor(at, "thread-1")} {
+		if _, _, err := decodeCursor(bad); !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("expected %q to be rejected, got %v", bad, err)
+		}
+	}
+}
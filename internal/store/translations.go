@@ -0,0 +1,57 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type MessageTranslation struct {
+	MessageID      string    `json:"message_id"`
+	TargetLanguage string    `json:"target_language"`
+	SourceLanguage string    `json:"source_language"`
+	Provider       string    `json:"provider"`
+	Model          string    `json:"model"`
+	Text           string    `json:"text"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// GetMessageTranslation looks up a cached translation. Entries are keyed by
+// provider and model so switching LLMs does not serve stale output.
+func (s *Store) GetMessageTranslation(ctx context.Context, messageID, targetLanguage, provider, model string) (MessageTranslation, error) {
+	var t MessageTranslation
+	row := s.q.QueryRowContext(ctx, `
+		SELECT message_id, target_language, source_language, provider, model, text, created_at
+		FROM message_translations
+		WHERE message_id = $1 AND target_language = $2 AND provider = $3 AND model = $4
+	`, messageID, targetLanguage, provider, model)
+	err := row.Scan(&t.MessageID, &t.TargetLanguage, &t.SourceLanguage, &t.Provider, &t.Model, &t.Text, &t.CreatedAt)
+	return t, err
+}
+
+// GetMessageSourceLanguage returns the language a model last detected in the
+// message while translating it, or "" when no translation determined one.
+func (s *Store) GetMessageSourceLanguage(ctx context.Context, messageID string) (string, error) {
+	var language string
+	err := s.q.QueryRowContext(ctx, `
+		SELECT source_language FROM message_translations
+		WHERE message_id = $1 AND source_language NOT IN ('', 'und')
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, messageID).Scan(&language)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return language, err
+}
+
+func (s *Store) UpsertMessageTranslation(ctx context.Context, t MessageTranslation) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO message_translations (message_id, org_id, target_language, source_language, provider, model, text)
+		VALUES ($1, (SELECT org_id FROM messages WHERE id = $1), $2, $3, $4, $5, $6)
+		ON CONFLICT (message_id, target_language, provider, model)
+		DO UPDATE SET source_language = EXCLUDED.source_language, text = EXCLUDED.text, created_at = now()
+	`, t.MessageID, t.TargetLanguage, t.SourceLanguage, t.Provider, t.Model, t.Text)
+	return err
+}
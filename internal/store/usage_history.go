@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// DailyUsage is one UTC day of successful metered tool calls.
+type DailyUsage struct {
+	Day   time.Time
+	Units int64
+	Calls int64
+}
+
+// ListDailyUsage buckets successful usage events since the given time by UTC
+// day, oldest first. Days without usage are omitted.
+func (s *Store) ListDailyUsage(ctx context.Context, orgID string, meterName string, since time.Time) ([]DailyUsage, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT date_trunc('day', created_at AT TIME ZONE 'UTC') AS day,
+		       coalesce(sum(quantity), 0),
+		       count(*)
+		FROM usage_events
+		WHERE org_id = $1
+		  AND meter_name = $2
+		  AND status = 'success'
+		  AND created_at >= $3
+		GROUP BY day
+		ORDER BY day ASC
+	`, orgID, meterName, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []DailyUsage
+	for rows.Next() {
+		var item DailyUsage
+		if err := rows.Scan(&item.Day, &item.Units, &item.Calls); err != nil {
+			return nil, err
+		}
+		item.Day = time.Date(item.Day.Year(), item.Day.Month(), item.Day.Day(), 0, 0, 0, 0, time.UTC)
+		out = append(out, item)
+	}
+	return out, rows.Err()
+}
+
+// ListPlanEntitlements returns every plan ordered by monthly units, smallest
+// first.
+func (s *Store) ListPlanEntitlements(ctx context.Context) ([]PlanEntitlement, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+planEntitlementColumns+`
+		FROM plan_entitlements
+		ORDER BY monthly_units ASC, plan_code ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var plans []PlanEntitlement
+	for rows.Next() {
+		plan, err := scanPlanEntitlement(rows)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
+	return plans, rows.Err()
+}
+
+// MeterUsage totals an org's usage events for one meter.
+type MeterUsage struct {
+	MeterName string
+	Calls     int64
+	Units     int64
+	Failed    int64
+}
+
+// ListMeterUsage totals an org's usage events in [from, to) by meter. As in
+// ListToolUsage, units only count successful calls.
+func (s *Store) ListMeterUsage(ctx context.Context, orgID string, from, to time.Time) ([]MeterUsage, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT meter_name, count(*),
+		       coalesce(sum(quantity) FILTER (WHERE status = 'success'), 0),
+		       count(*) FILTER (WHERE status <> 'success')
+		FROM usage_events
+		WHERE org_id = $1
+		  AND created_at >= $2
+		  AND created_at < $3
+		GROUP BY meter_name
+		ORDER BY meter_name ASC
+	`, orgID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []MeterUsage
+	for rows.Next() {
+		var item MeterUsage
+		if err := rows.Scan(&item.MeterName, &item.Calls, &item.Units, &item.Failed); err != nil {
+			return nil, err
+		}
+		out = append(out, item)
+	}
+	return out, rows.Err()
+}
+
+// UsageBreakdown totals an org's usage events for one UTC day, meter and,
+// unless the breakdown is by meter only, tool.
+type UsageBreakdown struct {
+	Day       time.Time
+	MeterName string
+	ToolName  string
+	Calls     int64
+	Units     int64
+	Failed    int64
+}
+
+// ListUsageByDay totals an org's usage events in [from, to) by UTC day and
+// meter, and also by tool when byTool is set, oldest day first. Days without
+// usage are omitted.
+func (s *Store) ListUsageByDay(ctx context.Context, orgID string, from, to time.Time, byTool bool) ([]UsageBreakdown, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT date_trunc('day', created_at AT TIME ZONE 'UTC') AS day,
+		       meter_name,
+		       CASE WHEN $4::boolean THEN tool_name ELSE '' END AS tool,
+		       count(*),
+		       coalesce(sum(quantity) FILTER (WHERE status = 'success'), 0),
+		       count(*) FILTER (WHERE status <> 'success')
+		FROM usage_events
+		WHERE org_id = $1
+		  AND created_at >= $2
+		  AND created_at < $3
+		GROUP BY day, meter_name, tool
+		ORDER BY day ASC, meter_name ASC, tool ASC
+	`, orgID, from, to, byTool)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []UsageBreakdown
+	for rows.Next() {
+		var item UsageBreakdown
+		if err := rows.Scan(&item.Day, &item.MeterName, &item.ToolName, &item.Calls, &item.Units, &item.Failed); err != nil {
+			return nil, err
+		}
+		item.Day = time.Date(item.Day.Year(), item.Day.Month(), item.Day.Day(), 0, 0, 0, 0, time.UTC)
+		out = append(out, item)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+)
+
+// VectorCleanup names the index points a delete left behind: all of the
+// listed inboxes' and the listed threads'.
+type VectorCleanup struct {
+	InboxIDs  []string
+	ThreadIDs []string
+}
+
+// VectorCleanupQueue accepts cleanups for the worker to apply to the vector
+// index; *queue.Queue implements it.
+type VectorCleanupQueue interface {
+	PushVectorCleanup(ctx context.Context, cleanup VectorCleanup) error
+}
+
+// SetVectorCleanups makes the store's deletes of threads and orgs queue the
+// removal of their vector points. Without it the points stay until the
+// reconciliation sweep finds them.
+func (s *Store) SetVectorCleanups(q VectorCleanupQueue) {
+	s.cleanups = q
+}
+
+// queueVectorCleanup hands c to the cleanup queue; inside RunAsOrg it waits
+// for the commit, so rolled-back and dry-run deletes leave the index alone.
+// A push that fails is logged and left to reconciliation.
+func (s *Store) queueVectorCleanup(ctx context.Context, c VectorCleanup) {
+	if s.cleanups == nil || (len(c.InboxIDs) == 0 && len(c.ThreadIDs) == 0) {
+		return
+	}
+	if s.pendingCleanups != nil {
+		*s.pendingCleanups = append(*s.pendingCleanups, c)
+		return
+	}
+	if err := s.cleanups.PushVectorCleanup(ctx, c); err != nil {
+		slog.WarnContext(ctx, "vector cleanup not queued", "inboxes", len(c.InboxIDs), "threads", len(c.ThreadIDs), "err", err)
+	}
+}
+
+// ExistingThreadIDs returns which of ids are threads in this store.
+func (s *Store) ExistingThreadIDs(ctx context.Context, ids []string) (map[string]bool, error) {
+	found := map[string]bool{}
+	if len(ids) == 0 {
+		return found, nil
+	}
+	rows, err := s.q.QueryContext(ctx, `SELECT id::text FROM threads WHERE id = ANY($1::uuid[])`, uuidArrayLiteral(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		found[id] = true
+	}
+	return found, rows.Err()
+}
@@ -0,0 +1,177 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WebhookEndpoint struct {
+	ID            string
+	OrgID         string
+	URL           string
+	SigningSecret string
+	Description   string
+	Status        string
+	// APIVersion is the payload version the endpoint is pinned to.
+	APIVersion string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+const webhookEndpointColumns = `id, org_id, url, signing_secret, description, status, api_version, created_at, updated_at`
+
+func scanWebhookEndpoint(row interface{ Scan(...any) error }) (WebhookEndpoint, error) {
+	var ep WebhookEndpoint
+	err := row.Scan(&ep.ID, &ep.OrgID, &ep.URL, &ep.SigningSecret, &ep.Description, &ep.Status, &ep.APIVersion, &ep.CreatedAt, &ep.UpdatedAt)
+	return ep, err
+}
+
+type WebhookDelivery struct {
+	ID           string
+	EndpointID   string
+	OrgID        string
+	EventID      string
+	EventType    string
+	Payload      json.RawMessage
+	Attempt      int
+	ResponseCode sql.NullInt64
+	ResponseBody string
+	ErrorMessage string
+	DurationMS   int
+	CreatedAt    time.Time
+}
+
+func (s *Store) CreateWebhookEndpoint(ctx context.Context, orgID, url, signingSecret, description, apiVersion string) (WebhookEndpoint, error) {
+	return scanWebhookEndpoint(s.q.QueryRowContext(ctx, `
+		INSERT INTO webhook_endpoints (id, org_id, url, signing_secret, description, api_version)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+webhookEndpointColumns,
+		uuid.NewString(), orgID, url, signingSecret, description, apiVersion))
+}
+
+func (s *Store) ListWebhookEndpoints(ctx context.Context, orgID string) ([]WebhookEndpoint, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+webhookEndpointColumns+`
+		FROM webhook_endpoints
+		WHERE org_id = $1
+		ORDER BY created_at ASC
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []WebhookEndpoint
+	for rows.Next() {
+		ep, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ep)
+	}
+	return out, rows.Err()
+}
+
+// GetWebhookEndpointForOrg returns sql.ErrNoRows when the endpoint does not
+// exist or belongs to another org.
+func (s *Store) GetWebhookEndpointForOrg(ctx context.Context, orgID, endpointID string) (WebhookEndpoint, error) {
+	return scanWebhookEndpoint(s.q.QueryRowContext(ctx, `
+		SELECT `+webhookEndpointColumns+`
+		FROM webhook_endpoints
+		WHERE id = $1 AND org_id = $2
+	`, endpointID, orgID))
+}
+
+// SetWebhookEndpointVersion moves an endpoint's pin to apiVersion. Like
+// GetWebhookEndpointForOrg it returns sql.ErrNoRows for another org's
+// endpoint.
+func (s *Store) SetWebhookEndpointVersion(ctx context.Context, orgID, endpointID, apiVersion string) (WebhookEndpoint, error) {
+	return scanWebhookEndpoint(s.q.QueryRowContext(ctx, `
+		UPDATE webhook_endpoints SET api_version = $3, updated_at = now()
+		WHERE id = $1 AND org_id = $2
+		RETURNING `+webhookEndpointColumns,
+		endpointID, orgID, apiVersion))
+}
+
+func (s *Store) DeleteWebhookEndpointForOrg(ctx context.Context, orgID, endpointID string) (bool, error) {
+	res, err := s.q.ExecContext(ctx, `DELETE FROM webhook_endpoints WHERE id = $1 AND org_id = $2`, endpointID, orgID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (s *Store) RecordWebhookDelivery(ctx context.Context, d WebhookDelivery) (WebhookDelivery, error) {
+	if d.ID == "" {
+		d.ID = uuid.NewString()
+	}
+	row := s.q.QueryRowContext(ctx, `
+		INSERT INTO webhook_deliveries (
+			id, endpoint_id, org_id, event_id, event_type, payload, attempt,
+			response_code, response_body, error_message, duration_ms
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, nullif($9, ''), nullif($10, ''), $11)
+		RETURNING created_at
+	`, d.ID, d.EndpointID, d.OrgID, d.EventID, d.EventType, []byte(d.Payload), d.Attempt,
+		d.ResponseCode, d.ResponseBody, d.ErrorMessage, d.DurationMS)
+	err := row.Scan(&d.CreatedAt)
+	return d, err
+}
+
+func (s *Store) ListWebhookDeliveries(ctx context.Context, orgID, endpointID string, limit int) ([]WebhookDelivery, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT id, endpoint_id, org_id, event_id, event_type, payload, attempt,
+		       response_code, coalesce(response_body, ''), coalesce(error_message, ''), duration_ms, created_at
+		FROM webhook_deliveries
+		WHERE org_id = $1 AND endpoint_id = $2
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, orgID, endpointID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []WebhookDelivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// GetLatestWebhookDelivery returns the most recent attempt for an event so a
+// redelivery can reuse its payload and continue the attempt sequence.
+func (s *Store) GetLatestWebhookDelivery(ctx context.Context, orgID, endpointID, eventID string) (WebhookDelivery, error) {
+	row := s.q.QueryRowContext(ctx, `
+		SELECT id, endpoint_id, org_id, event_id, event_type, payload, attempt,
+		       response_code, coalesce(response_body, ''), coalesce(error_message, ''), duration_ms, created_at
+		FROM webhook_deliveries
+		WHERE org_id = $1 AND endpoint_id = $2 AND event_id = $3
+		ORDER BY attempt DESC
+		LIMIT 1
+	`, orgID, endpointID, eventID)
+	return scanWebhookDelivery(row)
+}
+
+func scanWebhookDelivery(row interface{ Scan(...any) error }) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	var payload []byte
+	err := row.Scan(&d.ID, &d.EndpointID, &d.OrgID, &d.EventID, &d.EventType, &payload, &d.Attempt,
+		&d.ResponseCode, &d.ResponseBody, &d.ErrorMessage, &d.DurationMS, &d.CreatedAt)
+	d.Payload = payload
+	return d, err
+}
@@ -0,0 +1,117 @@
+// Package sysmail renders the mail the system sends on an org's behalf, such
+// as digests, approval notifications and verification mail, in the org's
+// branding. Every such message goes through Render so the footer and postal
+// address are never left out.
+package sysmail
+
+import (
+	"bytes"
+	"html/template"
+	"regexp"
+	"strings"
+
+	"neuralmail/internal/store"
+)
+
+// Defaults used where an org has not set its own branding.
+const (
+	DefaultPrimaryColor = "#111827"
+	DefaultAccentColor  = "#2563eb"
+	DefaultFooterText   = "Sent by Nerve (nerve.email)."
+)
+
+var colorRE = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// ValidColor reports whether c is a #rrggbb color.
+func ValidColor(c string) bool {
+	return colorRE.MatchString(c)
+}
+
+// Message is the content of one system email.
+type Message struct {
+	Subject     string
+	Heading     string
+	Paragraphs  []string
+	ActionLabel string
+	ActionURL   string
+}
+
+// Rendered is a branded email ready to queue.
+type Rendered struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type view struct {
+	Message
+	LogoURL         string
+	PrimaryColor    string
+	AccentColor     string
+	FooterText      string
+	PhysicalAddress string
+}
+
+var htmlTemplate = template.Must(template.New("sysmail").Parse(`<!doctype html>
+<html><body style="margin:0;padding:24px;background:#f9fafb;font-family:Helvetica,Arial,sans-serif;color:{{.PrimaryColor}}">
+<table role="presentation" width="100%" style="max-width:600px;margin:0 auto;background:#ffffff;border-radius:8px;padding:24px">
+{{if .LogoURL}}<tr><td><img src="{{.LogoURL}}" alt="" height="40"></td></tr>{{end}}
+{{if .Heading}}<tr><td><h1 style="font-size:20px;color:{{.PrimaryColor}}">{{.Heading}}</h1></td></tr>{{end}}
+{{range .Paragraphs}}<tr><td><p style="font-size:15px;line-height:1.5">{{.}}</p></td></tr>
+{{end}}{{if .ActionURL}}<tr><td><a href="{{.ActionURL}}" style="display:inline-block;padding:10px 18px;border-radius:6px;background:{{.AccentColor}};color:#ffffff;text-decoration:none">{{.ActionLabel}}</a></td></tr>{{end}}
+<tr><td style="padding-top:24px;font-size:12px;color:#6b7280">{{.FooterText}}{{if .PhysicalAddress}}<br>{{.PhysicalAddress}}{{end}}</td></tr>
+</table>
+</body></html>
+`))
+
+// Render lays msg out in the org's branding, as plain text and HTML.
+func Render(branding store.OrgBranding, msg Message) (Rendered, error) {
+	v := view{
+		Message:         msg,
+		LogoURL:         branding.LogoURL,
+		PrimaryColor:    pick(branding.PrimaryColor, DefaultPrimaryColor),
+		AccentColor:     pick(branding.AccentColor, DefaultAccentColor),
+		FooterText:      pick(branding.FooterText, DefaultFooterText),
+		PhysicalAddress: branding.PhysicalAddress,
+	}
+	if v.ActionLabel == "" {
+		v.ActionLabel = "Open"
+	}
+	// Colors land in style attributes, where html/template only checks for
+	// unsafe CSS; anything but #rrggbb falls back to the default.
+	if !ValidColor(v.PrimaryColor) {
+		v.PrimaryColor = DefaultPrimaryColor
+	}
+	if !ValidColor(v.AccentColor) {
+		v.AccentColor = DefaultAccentColor
+	}
+
+	var html bytes.Buffer
+	if err := htmlTemplate.Execute(&html, v); err != nil {
+		return Rendered{}, err
+	}
+	return Rendered{Subject: msg.Subject, Text: renderText(v), HTML: html.String()}, nil
+}
+
+func renderText(v view) string {
+	var parts []string
+	if v.Heading != "" {
+		parts = append(parts, v.Heading)
+	}
+	parts = append(parts, v.Paragraphs...)
+	if v.ActionURL != "" {
+		parts = append(parts, v.ActionLabel+": "+v.ActionURL)
+	}
+	footer := "-- \n" + v.FooterText
+	if v.PhysicalAddress != "" {
+		footer += "\n" + v.PhysicalAddress
+	}
+	return strings.Join(append(parts, footer), "\n\n") + "\n"
+}
+
+func pick(value, fallback string) string {
+	if strings.TrimSpace(value) == "" {
+		return fallback
+	}
+	return value
+}
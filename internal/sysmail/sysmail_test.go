@@ -0,0 +1,50 @@
+package sysmail
+
+import (
+	"strings"
+	"testing"
+
+	"neuralmail/internal/store"
+)
+
+func TestRenderAppliesBranding(t *testing.T) {
+	branding := store.OrgBranding{
+		LogoURL:         "https://acme.test/logo.png",
+		PrimaryColor:    "#102030",
+		AccentColor:     "red; background:url(x)",
+		FooterText:      "Acme Support",
+		PhysicalAddress: "1 Main St, Springfield",
+	}
+	out, err := Render(branding, Message{
+		Subject:     "Draft awaiting approval",
+		Heading:     "A draft needs review",
+		Paragraphs:  []string{"Reply to <Bob> is waiting."},
+		ActionLabel: "Review",
+		ActionURL:   "https://app.nerve.email/drafts/1",
+	})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	for _, want := range []string{`src="https://acme.test/logo.png"`, "color:#102030", "background:" + DefaultAccentColor, "Reply to &lt;Bob&gt; is waiting.", "1 Main St, Springfield"} {
+		if !strings.Contains(out.HTML, want) {
+			t.Fatalf("html missing %q:\n%s", want, out.HTML)
+		}
+	}
+	want := "A draft needs review\n\nReply to <Bob> is waiting.\n\nReview: https://app.nerve.email/drafts/1\n\n-- \nAcme Support\n1 Main St, Springfield\n"
+	if out.Text != want {
+		t.Fatalf("unexpected text:\n%q", out.Text)
+	}
+}
+
+func TestRenderDefaults(t *testing.T) {
+	out, err := Render(store.OrgBranding{}, Message{Subject: "Verify your domain", Paragraphs: []string{"Add the TXT record."}})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if strings.Contains(out.HTML, "<img") || !strings.Contains(out.HTML, DefaultFooterText) {
+		t.Fatalf("expected default branding, got:\n%s", out.HTML)
+	}
+	if out.Subject != "Verify your domain" || !strings.HasSuffix(out.Text, DefaultFooterText+"\n") {
+		t.Fatalf("unexpected rendering %+v", out)
+	}
+}
@@ -0,0 +1,318 @@
+// Package tenancy checks tenant isolation on a running deployment. It seeds
+// two throwaway orgs, talks to the live MCP endpoint with each org's own
+// service token and fails if either can see anything of the other's, the
+// same assertions the cloud e2e tests make against a test server.
+package tenancy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"neuralmail/internal/store"
+)
+
+// Scopes are the scopes each org's token is issued with: enough to read,
+// list and search, nothing that sends mail or spends model calls.
+var Scopes = []string{"nerve:email.read", "nerve:email.search", "nerve:email.search.org"}
+
+// Verifier runs the check. Issue mints a service token for an org, as the
+// control plane does; APIKey is sent for deployments that require one from
+// callers without an Origin.
+type Verifier struct {
+	Store  *store.Store
+	MCPURL string
+	APIKey string
+	Issue  func(ctx context.Context, orgID string, scopes []string) (string, error)
+	Client *http.Client
+	Now    func() time.Time
+}
+
+func NewVerifier(st *store.Store, mcpURL string, apiKey string, issue func(ctx context.Context, orgID string, scopes []string) (string, error)) *Verifier {
+	return &Verifier{
+		Store:  st,
+		MCPURL: mcpURL,
+		APIKey: apiKey,
+		Issue:  issue,
+		Client: &http.Client{Timeout: 30 * time.Second},
+		Now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Check is one assertion made as one tenant.
+type Check struct {
+	Tenant string
+	Name   string
+	Err    error
+}
+
+func (c Check) Passed() bool { return c.Err == nil }
+
+// Report lists every check made, in order.
+type Report struct {
+	Checks []Check
+}
+
+// Failed returns the checks that did not pass.
+func (r Report) Failed() []Check {
+	var out []Check
+	for _, c := range r.Checks {
+		if !c.Passed() {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// tenant is one seeded org and what it owns.
+type tenant struct {
+	name      string
+	orgID     string
+	inboxID   string
+	threadID  string
+	messageID string
+	token     string
+	session   string
+}
+
+// ids are the identifiers no other tenant may ever see.
+func (t *tenant) ids() []string {
+	return []string{t.orgID, t.inboxID, t.threadID, t.messageID}
+}
+
+// Run seeds the two orgs, checks each against the other and deletes them
+// again, also when ctx is cancelled part way. The error is for a run that
+// could not be made; failed checks are in the report.
+func (v *Verifier) Run(ctx context.Context) (report Report, err error) {
+	// Both orgs' mail carries the same marker, so a search that crosses
+	// tenants finds the other's message.
+	marker := "tenancycheck" + strings.ReplaceAll(uuid.NewString(), "-", "")[:12]
+	tenants := []*tenant{{name: "a"}, {name: "b"}}
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		for _, t := range tenants {
+			if t.orgID == "" {
+				continue
+			}
+			if _, delErr := v.Store.DeleteOrg(cleanupCtx, t.orgID); delErr != nil && err == nil {
+				err = fmt.Errorf("delete org %s: %w", t.orgID, delErr)
+			}
+		}
+	}()
+
+	for _, t := range tenants {
+		if err := v.seed(ctx, t, marker); err != nil {
+			return report, fmt.Errorf("seed tenant %s: %w", t.name, err)
+		}
+		if t.token, err = v.Issue(ctx, t.orgID, Scopes); err != nil {
+			return report, fmt.Errorf("issue token for tenant %s: %w", t.name, err)
+		}
+		if t.session, err = v.initialize(ctx, t.token); err != nil {
+			return report, fmt.Errorf("initialize session for tenant %s: %w", t.name, err)
+		}
+	}
+
+	self, other := tenants[0], tenants[1]
+	for range 2 {
+		report.Checks = append(report.Checks, v.checkTenant(ctx, self, other, marker)...)
+		self, other = other, self
+	}
+	return report, nil
+}
+
+func (v *Verifier) seed(ctx context.Context, t *tenant, marker string) error {
+	orgID, err := v.Store.CreateOrg(ctx, "verify-tenancy-"+t.name+"-"+marker)
+	if err != nil {
+		return err
+	}
+	t.orgID = orgID
+
+	periodStart := v.Now().Add(-time.Minute).Truncate(time.Second)
+	periodEnd := periodStart.Add(24 * time.Hour)
+	if err := v.Store.UpsertOrgEntitlement(ctx, store.OrgEntitlement{
+		OrgID:              orgID,
+		PlanCode:           "verify-tenancy",
+		SubscriptionStatus: "active",
+		MCPRPM:             1000,
+		MonthlyUnits:       1000,
+		MaxInboxes:         1,
+		UsagePeriodStart:   periodStart,
+		UsagePeriodEnd:     periodEnd,
+	}); err != nil {
+		return err
+	}
+	if err := v.Store.EnsureOrgUsageCounter(ctx, orgID, "mcp_units", periodStart, periodEnd); err != nil {
+		return err
+	}
+
+	inbox, err := v.Store.CreateInboxForOrg(ctx, orgID, marker+"-"+t.name+"@verify-tenancy.invalid", "", store.ProviderJMAP)
+	if err != nil {
+		return err
+	}
+	t.inboxID = inbox.ID
+	customer := store.Participant{Name: "Tenancy Check", Email: "customer@verify-tenancy.invalid"}
+	subject := "Tenancy check " + marker
+	if t.threadID, err = v.Store.EnsureThread(ctx, inbox.ID, "verify-tenancy-"+uuid.NewString(), subject, []store.Participant{customer}); err != nil {
+		return err
+	}
+	t.messageID, err = v.Store.InsertMessage(ctx, store.Message{
+		InboxID:           inbox.ID,
+		ThreadID:          t.threadID,
+		Direction:         "inbound",
+		Subject:           subject,
+		Text:              "Tenant " + t.name + " owns this message. " + marker,
+		CreatedAt:         v.Now(),
+		ProviderMessageID: "verify-tenancy-" + uuid.NewString(),
+		From:              customer,
+		To:                []store.Participant{{Email: inbox.Address}},
+	})
+	return err
+}
+
+// checkTenant makes every check as self. Calls on self's own data must work,
+// which also shows that a denial of other's data is isolation rather than a
+// broken token; no successful response may mention any of other's IDs.
+func (v *Verifier) checkTenant(ctx context.Context, self, other *tenant, marker string) []Check {
+	var checks []Check
+	check := func(name string, err error) {
+		checks = append(checks, Check{Tenant: self.name, Name: name, Err: err})
+	}
+	sees := func(method string, params map[string]any, own string) error {
+		raw, err := v.call(ctx, self, method, params)
+		if err != nil {
+			return err
+		}
+		if own != "" && !bytes.Contains(raw, []byte(own)) {
+			return fmt.Errorf("own %s missing from the response", own)
+		}
+		return leaked(raw, other)
+	}
+	denied := func(method string, params map[string]any) error {
+		raw, err := v.call(ctx, self, method, params)
+		if err != nil {
+			return nil
+		}
+		return fmt.Errorf("allowed, returned %s", truncate(raw))
+	}
+	tool := func(name string, args map[string]any) map[string]any {
+		return map[string]any{"name": name, "arguments": args}
+	}
+	resource := func(uri string) map[string]any {
+		return map[string]any{"uri": uri}
+	}
+
+	check("list inboxes", sees("resources/read", resource("email://inboxes"), self.inboxID))
+	check("list own threads", sees("tools/call", tool("list_threads", map[string]any{"inbox_id": self.inboxID}), self.threadID))
+	check("get own thread", sees("tools/call", tool("get_thread", map[string]any{"thread_id": self.threadID}), self.messageID))
+	check("search own inbox", sees("tools/call", tool("search_inbox", map[string]any{"inbox_id": self.inboxID, "query": marker, "top_k": 20}), ""))
+	check("search org", sees("tools/call", tool("search_org", map[string]any{"query": marker, "top_k": 100}), ""))
+	check("list other's threads", denied("tools/call", tool("list_threads", map[string]any{"inbox_id": other.inboxID})))
+	check("get other's thread", denied("tools/call", tool("get_thread", map[string]any{"thread_id": other.threadID})))
+	check("search other's inbox", denied("tools/call", tool("search_inbox", map[string]any{"inbox_id": other.inboxID, "query": marker})))
+	check("search org in other's inbox", denied("tools/call", tool("search_org", map[string]any{"query": marker, "inbox_ids": []string{other.inboxID}})))
+	check("read other's thread", denied("resources/read", resource("email://threads/"+other.threadID)))
+	check("read other's message", denied("resources/read", resource("email://messages/"+other.messageID)))
+	return checks
+}
+
+func leaked(raw []byte, other *tenant) error {
+	for _, id := range other.ids() {
+		if bytes.Contains(raw, []byte(id)) {
+			return fmt.Errorf("response contains the other tenant's %s", id)
+		}
+	}
+	return nil
+}
+
+func truncate(raw []byte) string {
+	if len(raw) > 200 {
+		return string(raw[:200]) + "..."
+	}
+	return string(raw)
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+func (v *Verifier) initialize(ctx context.Context, token string) (string, error) {
+	resp, session, err := v.post(ctx, token, "", "initialize", map[string]any{})
+	if err != nil {
+		return "", err
+	}
+	if resp.Error != nil {
+		return "", errors.New(resp.Error.Message)
+	}
+	if session == "" {
+		return "", errors.New("no MCP-Session-Id in the initialize response")
+	}
+	return session, nil
+}
+
+// call makes one MCP request as t and returns its result. A refusal, by
+// HTTP status or JSON-RPC error, is an error.
+func (v *Verifier) call(ctx context.Context, t *tenant, method string, params map[string]any) (json.RawMessage, error) {
+	resp, _, err := v.post(ctx, t.token, t.session, method, params)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("rpc error %d: %s", resp.Error.Code, resp.Error.Message)
+	}
+	return resp.Result, nil
+}
+
+func (v *Verifier) post(ctx context.Context, token, session, method string, params map[string]any) (rpcResponse, string, error) {
+	var out rpcResponse
+	body, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	if err != nil {
+		return out, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.MCPURL, bytes.NewReader(body))
+	if err != nil {
+		return out, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if v.APIKey != "" {
+		req.Header.Set("X-API-Key", v.APIKey)
+	}
+	if session != "" {
+		req.Header.Set("MCP-Session-Id", session)
+	}
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return out, "", err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return out, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return out, "", fmt.Errorf("%s: %s %s", method, resp.Status, strings.TrimSpace(truncate(raw)))
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return out, "", fmt.Errorf("%s: decode response: %w", method, err)
+	}
+	return out, resp.Header.Get("MCP-Session-Id"), nil
+}
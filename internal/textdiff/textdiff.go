@@ -0,0 +1,97 @@
+// Package textdiff computes line diffs between draft revisions for approval
+// UIs. Drafts are short, so a plain LCS table is fast enough.
+package textdiff
+
+import "strings"
+
+// Op kinds.
+const (
+	Equal  = "equal"
+	Insert = "insert"
+	Delete = "delete"
+)
+
+// Op is one run of lines; Text keeps the lines joined with newlines.
+type Op struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Diff is the change from one text to another.
+type Diff struct {
+	Ops     []Op `json:"ops"`
+	Added   int  `json:"lines_added"`
+	Removed int  `json:"lines_removed"`
+}
+
+// Lines diffs a and b line by line. Adjacent lines of the same kind are
+// merged into one Op.
+func Lines(a, b string) Diff {
+	left, right := splitLines(a), splitLines(b)
+
+	// lcs[i][j] is the LCS length of left[i:] and right[j:].
+	lcs := make([][]int, len(left)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(right)+1)
+	}
+	for i := len(left) - 1; i >= 0; i-- {
+		for j := len(right) - 1; j >= 0; j-- {
+			if left[i] == right[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	diff := Diff{Ops: []Op{}}
+	var lines []string
+	kind := ""
+	emit := func(k string, line string) {
+		if k != kind && len(lines) > 0 {
+			diff.Ops = append(diff.Ops, Op{Op: kind, Text: strings.Join(lines, "\n")})
+			lines = nil
+		}
+		kind = k
+		lines = append(lines, line)
+		switch k {
+		case Insert:
+			diff.Added++
+		case Delete:
+			diff.Removed++
+		}
+	}
+	i, j := 0, 0
+	for i < len(left) && j < len(right) {
+		switch {
+		case left[i] == right[j]:
+			emit(Equal, left[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			emit(Delete, left[i])
+			i++
+		default:
+			emit(Insert, right[j])
+			j++
+		}
+	}
+	for ; i < len(left); i++ {
+		emit(Delete, left[i])
+	}
+	for ; j < len(right); j++ {
+		emit(Insert, right[j])
+	}
+	if len(lines) > 0 {
+		diff.Ops = append(diff.Ops, Op{Op: kind, Text: strings.Join(lines, "\n")})
+	}
+	return diff
+}
+
+func splitLines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
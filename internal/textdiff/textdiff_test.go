@@ -0,0 +1,39 @@
+package textdiff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLinesReplacesChangedLine(t *testing.T) {
+	diff := Lines("Hi Ana,\nWe guarantee a refund.\nThanks", "Hi Ana,\nWe will review your refund.\nThanks")
+	want := []Op{
+		{Op: Equal, Text: "Hi Ana,"},
+		{Op: Delete, Text: "We guarantee a refund."},
+		{Op: Insert, Text: "We will review your refund."},
+		{Op: Equal, Text: "Thanks"},
+	}
+	if !reflect.DeepEqual(diff.Ops, want) {
+		t.Fatalf("unexpected ops %+v", diff.Ops)
+	}
+	if diff.Added != 1 || diff.Removed != 1 {
+		t.Fatalf("expected one line added and removed, got %+v", diff)
+	}
+}
+
+func TestLinesMergesRuns(t *testing.T) {
+	diff := Lines("", "one\ntwo\n")
+	if len(diff.Ops) != 1 || diff.Ops[0] != (Op{Op: Insert, Text: "one\ntwo"}) || diff.Added != 2 {
+		t.Fatalf("unexpected diff %+v", diff)
+	}
+}
+
+func TestLinesIdentical(t *testing.T) {
+	diff := Lines("same\r\ntext", "same\ntext")
+	if len(diff.Ops) != 1 || diff.Ops[0].Op != Equal || diff.Added != 0 || diff.Removed != 0 {
+		t.Fatalf("unexpected diff %+v", diff)
+	}
+	if empty := Lines("", ""); len(empty.Ops) != 0 {
+		t.Fatalf("expected no ops for empty texts, got %+v", empty)
+	}
+}
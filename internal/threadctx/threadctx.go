@@ -0,0 +1,210 @@
+// Package threadctx packs a thread into the context a reply is drafted from.
+// Long threads do not fit a model's context window, so only the latest
+// messages go in verbatim; older ones are summarized (once per message and
+// model, then cached) and the oldest dropped if even that does not fit.
+package threadctx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/llm"
+	"neuralmail/internal/store"
+)
+
+// replyReserve is the part of the window left for the drafting prompt, the
+// policy hints and the reply itself.
+const replyReserve = 4096
+
+// minBudget keeps a usable budget for models with tiny or unknown windows.
+const minBudget = 1024
+
+// summaryTokens is how long a summary of one older message may be.
+const summaryTokens = 80
+
+// omittedNoteTokens is set aside for the note saying messages were dropped.
+const omittedNoteTokens = 16
+
+// Cache stores message summaries; *store.Store implements it.
+type Cache interface {
+	GetMessageSummary(ctx context.Context, messageID, provider, model string) (store.MessageSummary, error)
+	UpsertMessageSummary(ctx context.Context, m store.MessageSummary) error
+}
+
+// Packer builds thread context within Budget tokens, keeping up to Recent of
+// the newest messages verbatim.
+type Packer struct {
+	Provider llm.Provider
+	Budget   int
+	Recent   int
+}
+
+// New sizes a Packer for the model provider drafts with, or for
+// cfg.LLM.ContextTokens when that is set.
+func New(ctx context.Context, cfg config.Config, provider llm.Provider) *Packer {
+	window := cfg.LLM.ContextTokens
+	if window <= 0 {
+		_, model := llm.TaskModel(ctx, provider, llm.TaskDraft)
+		window = llm.ContextWindow(model)
+	}
+	return &Packer{
+		Provider: provider,
+		Budget:   max(window-replyReserve, minBudget),
+		Recent:   max(cfg.LLM.RecentMessages, 1),
+	}
+}
+
+// Packed is a thread's context and how it was put together. MessageIDs
+// are the messages it holds, in full or summarized, oldest first.
+type Packed struct {
+	Text       string
+	Tokens     int
+	Budget     int
+	Verbatim   int
+	Summarized int
+	Omitted    int
+	MessageIDs []string
+}
+
+// Pack lays out thread: its subject and triage signals, then older messages
+// as summaries and the newest ones in full, oldest first. Messages are
+// chosen newest first, so when the budget runs out it is the oldest that are
+// summarized and then omitted. The newest message is always included, cut
+// short if it alone is over budget.
+func (p *Packer) Pack(ctx context.Context, cache Cache, thread store.Thread, messages []store.Message) (Packed, error) {
+	header := "Thread: " + thread.Subject + "\n"
+	if signals := threadSignals(thread); signals != "" {
+		header += "Signals: " + signals + "\n"
+	}
+	packed := Packed{Budget: p.Budget}
+	remaining := p.Budget - llm.CountTokens(header) - omittedNoteTokens
+
+	var verbatim []string
+	i := len(messages) - 1
+	for ; i >= 0 && i >= len(messages)-p.Recent; i-- {
+		msg := messages[i]
+		line := messageLine(msg, "", msg.Text)
+		cost := llm.CountTokens(line)
+		if cost > remaining {
+			if i < len(messages)-1 {
+				break
+			}
+			lead := messageLine(msg, "", "")
+			line = messageLine(msg, "", llm.ExtractiveSummary(msg.Text, max(remaining-llm.CountTokens(lead), 0)))
+			cost = llm.CountTokens(line)
+		}
+		verbatim = append(verbatim, line)
+		remaining -= cost
+	}
+
+	var summarized []string
+	for ; i >= 0; i-- {
+		msg := messages[i]
+		summary, err := p.summary(ctx, cache, msg)
+		if err != nil {
+			return Packed{}, err
+		}
+		line := messageLine(msg, "summary", summary)
+		cost := llm.CountTokens(line)
+		if cost > remaining {
+			break
+		}
+		summarized = append(summarized, line)
+		remaining -= cost
+	}
+
+	var b strings.Builder
+	b.WriteString(header)
+	if i >= 0 {
+		packed.Omitted = i + 1
+		fmt.Fprintf(&b, "[%d earlier messages omitted]\n", packed.Omitted)
+	}
+	for j := len(summarized) - 1; j >= 0; j-- {
+		b.WriteString(summarized[j])
+	}
+	for j := len(verbatim) - 1; j >= 0; j-- {
+		b.WriteString(verbatim[j])
+	}
+	packed.Text = b.String()
+	packed.Tokens = llm.CountTokens(packed.Text)
+	for _, msg := range messages[i+1:] {
+		packed.MessageIDs = append(packed.MessageIDs, msg.ID)
+	}
+	packed.Verbatim = len(verbatim)
+	packed.Summarized = len(summarized)
+	return packed, nil
+}
+
+// summary returns msg condensed to about summaryTokens. Short messages stand
+// for themselves; others come from the cache, or from the provider (or an
+// extractive summary if it has none), and are cached best effort.
+func (p *Packer) summary(ctx context.Context, cache Cache, msg store.Message) (string, error) {
+	text := strings.Join(strings.Fields(msg.Text), " ")
+	if llm.CountTokens(text) <= summaryTokens {
+		return text, nil
+	}
+	provider, model := llm.TaskModel(ctx, p.Provider, llm.TaskSummarize)
+	cached, err := cache.GetMessageSummary(ctx, msg.ID, provider, model)
+	if err == nil {
+		return cached.Summary, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	summary := ""
+	if summarizer, ok := p.Provider.(llm.Summarizer); ok {
+		summary, err = summarizer.Summarize(ctx, text, summaryTokens)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		summary = llm.ExtractiveSummary(text, summaryTokens)
+	}
+	_ = cache.UpsertMessageSummary(ctx, store.MessageSummary{
+		MessageID: msg.ID,
+		Provider:  provider,
+		Model:     model,
+		Summary:   summary,
+		Tokens:    llm.CountTokens(summary),
+	})
+	return summary, nil
+}
+
+// messageLine labels a message with what a draft needs to cite and weigh
+// it: direction, ID, sender and date.
+func messageLine(msg store.Message, kind string, text string) string {
+	label := msg.Direction + " " + msg.ID
+	if msg.From.Email != "" {
+		label += " from " + msg.From.Email
+	}
+	if !msg.CreatedAt.IsZero() {
+		label += " at " + msg.CreatedAt.UTC().Format("2006-01-02 15:04")
+	}
+	if kind != "" {
+		label += ", " + kind
+	}
+	return "[" + label + "] " + text + "\n"
+}
+
+// threadSignals describes what triage recorded on the thread.
+func threadSignals(thread store.Thread) string {
+	var parts []string
+	if thread.Status != "" {
+		parts = append(parts, "status="+thread.Status)
+	}
+	if thread.PriorityLevel != nil && *thread.PriorityLevel != "" {
+		parts = append(parts, "urgency="+*thread.PriorityLevel)
+	}
+	if thread.SentimentScore != nil {
+		parts = append(parts, fmt.Sprintf("sentiment=%.2f", *thread.SentimentScore))
+	}
+	if len(thread.Labels) > 0 {
+		parts = append(parts, "labels="+strings.Join(thread.Labels, ","))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,109 @@
+package threadctx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/llm"
+	"neuralmail/internal/store"
+)
+
+type memCache struct {
+	summaries map[string]store.MessageSummary
+	writes    int
+}
+
+func (c *memCache) GetMessageSummary(_ context.Context, messageID, _, _ string) (store.MessageSummary, error) {
+	m, ok := c.summaries[messageID]
+	if !ok {
+		return store.MessageSummary{}, sql.ErrNoRows
+	}
+	return m, nil
+}
+
+func (c *memCache) UpsertMessageSummary(_ context.Context, m store.MessageSummary) error {
+	c.summaries[m.MessageID] = m
+	c.writes++
+	return nil
+}
+
+func longThread(n int) []store.Message {
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	messages := make([]store.Message, n)
+	for i := range messages {
+		messages[i] = store.Message{
+			ID:        fmt.Sprintf("m%02d", i),
+			Direction: "inbound",
+			Text:      fmt.Sprintf("Message %d. ", i) + strings.Repeat("The shipment is still missing and I need an update. ", 30),
+			CreatedAt: start.Add(time.Duration(i) * time.Hour),
+		}
+	}
+	return messages
+}
+
+func TestPackKeepsRecentVerbatimAndSummarizesOlder(t *testing.T) {
+	cfg := config.Default()
+	cfg.LLM.ContextTokens = 8192
+	cfg.LLM.RecentMessages = 3
+	packer := New(context.Background(), cfg, llm.NewNoop())
+	cache := &memCache{summaries: map[string]store.MessageSummary{}}
+	urgency := "high"
+	thread := store.Thread{Subject: "Missing shipment", Status: "open", PriorityLevel: &urgency}
+
+	packed, err := packer.Pack(context.Background(), cache, thread, longThread(20))
+	if err != nil {
+		t.Fatalf("pack: %v", err)
+	}
+	if packed.Verbatim != 3 || packed.Summarized != 17 || packed.Omitted != 0 {
+		t.Fatalf("unexpected layout: %+v", packed)
+	}
+	if len(packed.MessageIDs) != 20 || packed.MessageIDs[0] != "m00" {
+		t.Fatalf("expected every packed message id, got %v", packed.MessageIDs)
+	}
+	if packed.Tokens > packed.Budget {
+		t.Fatalf("context of %d tokens exceeds budget %d", packed.Tokens, packed.Budget)
+	}
+	if !strings.Contains(packed.Text, "urgency=high") {
+		t.Fatalf("expected triage signals in context:\n%s", packed.Text)
+	}
+	if strings.Index(packed.Text, "[inbound m00") > strings.Index(packed.Text, "[inbound m19") {
+		t.Fatalf("expected messages oldest first")
+	}
+	if cache.writes != 17 {
+		t.Fatalf("expected 17 summaries cached, got %d", cache.writes)
+	}
+
+	if _, err := packer.Pack(context.Background(), cache, thread, longThread(20)); err != nil {
+		t.Fatalf("repack: %v", err)
+	}
+	if cache.writes != 17 {
+		t.Fatalf("expected cached summaries reused, got %d writes", cache.writes)
+	}
+}
+
+func TestPackOmitsOldestPastBudget(t *testing.T) {
+	packer := &Packer{Provider: llm.NewNoop(), Budget: 1500, Recent: 2}
+	cache := &memCache{summaries: map[string]store.MessageSummary{}}
+
+	packed, err := packer.Pack(context.Background(), cache, store.Thread{Subject: "Missing shipment"}, longThread(60))
+	if err != nil {
+		t.Fatalf("pack: %v", err)
+	}
+	if packed.Tokens > packed.Budget {
+		t.Fatalf("context of %d tokens exceeds budget %d", packed.Tokens, packed.Budget)
+	}
+	if packed.Omitted == 0 || packed.Verbatim+packed.Summarized+packed.Omitted != 60 {
+		t.Fatalf("unexpected layout: %+v", packed)
+	}
+	if !strings.Contains(packed.Text, fmt.Sprintf("[%d earlier messages omitted]", packed.Omitted)) {
+		t.Fatalf("expected omission note:\n%s", packed.Text)
+	}
+	if !strings.Contains(packed.Text, "[inbound m59") {
+		t.Fatalf("expected newest message kept")
+	}
+}
@@ -0,0 +1,192 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/store"
+)
+
+const (
+	bulkBatchSize    = 500
+	bulkDefaultLimit = 10000
+	bulkMaxLimit     = 50000
+	bulkSampleSize   = 20
+)
+
+type BulkThreadFilter struct {
+	Status    string `json:"status"`
+	Label     string `json:"label"`
+	OlderThan string `json:"older_than" description:"Minimum age as a Go duration or in days or weeks, e.g. 720h, 30d or 2w"`
+}
+
+// BulkThreadRequest is also the bulk_update_threads tool input; the enum,
+// required and description tags feed its MCP input schema.
+type BulkThreadRequest struct {
+	InboxID  string           `json:"inbox_id" required:"true"`
+	Filter   BulkThreadFilter `json:"filter"`
+	Action   string           `json:"action" required:"true" enum:"close|label|assign|delete"`
+	Label    string           `json:"label" description:"Label to add; required for the label action"`
+	Assignee string           `json:"assignee" description:"Assignee for the assign action; empty unassigns"`
+	DryRun   bool             `json:"dry_run"`
+	Limit    int              `json:"limit" description:"Maximum threads to process (default 10000, max 50000)"`
+}
+
+// BulkUpdateThreads applies one action to every thread matching the filter,
+// batchSize threads per statement. Dry runs report the match count and a
+// sample of ids without changing anything.
+func (s *Service) BulkUpdateThreads(ctx context.Context, req BulkThreadRequest) (any, error) {
+	action := strings.ToLower(strings.TrimSpace(req.Action))
+	apply, err := bulkAction(action, req)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := bulkFilter(req, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	if action == "delete" && filter.Status == "" && filter.Label == "" && filter.OlderThan.IsZero() {
+		return nil, errors.New("delete requires at least one filter")
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = bulkDefaultLimit
+	}
+	if limit > bulkMaxLimit {
+		limit = bulkMaxLimit
+	}
+
+	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
+		if principal.OrgID != "" {
+			if err := s.ensureInboxBelongsToOrg(scopedCtx, st, principal, filter.InboxID); err != nil {
+				return nil, err
+			}
+		}
+		matched, err := st.CountThreadsMatching(scopedCtx, filter)
+		if err != nil {
+			return nil, err
+		}
+		summary := map[string]any{
+			"inbox_id": filter.InboxID,
+			"action":   action,
+			"dry_run":  req.DryRun,
+			"matched":  matched,
+		}
+		if req.DryRun {
+			sample, err := st.ListThreadIDsMatching(scopedCtx, filter, "", bulkSampleSize)
+			if err != nil {
+				return nil, err
+			}
+			summary["would_process"] = min(matched, int64(limit))
+			summary["sample_thread_ids"] = sample
+			return summary, nil
+		}
+
+		var processed, updated int64
+		batches := 0
+		after := ""
+		for processed < int64(limit) {
+			size := min(bulkBatchSize, limit-int(processed))
+			ids, err := st.ListThreadIDsMatching(scopedCtx, filter, after, size)
+			if err != nil {
+				return nil, err
+			}
+			if len(ids) == 0 {
+				break
+			}
+			n, err := apply(scopedCtx, st, ids)
+			if err != nil {
+				// A scoped call runs in one transaction, which the error
+				// rolls back with the batches before it.
+				if st.InTransaction() {
+					return nil, fmt.Errorf("bulk %s failed and no threads were changed: %w", action, err)
+				}
+				return nil, fmt.Errorf("bulk %s failed after %d threads: %w", action, processed, err)
+			}
+			processed += int64(len(ids))
+			updated += n
+			batches++
+			after = ids[len(ids)-1]
+		}
+		summary["processed"] = processed
+		summary["updated"] = updated
+		summary["batches"] = batches
+		summary["remaining"] = max(matched-processed, 0)
+		return summary, nil
+	})
+}
+
+func bulkAction(action string, req BulkThreadRequest) (func(context.Context, *store.Store, []string) (int64, error), error) {
+	switch action {
+	case "close":
+		return func(ctx context.Context, st *store.Store, ids []string) (int64, error) {
+			return st.CloseThreads(ctx, ids)
+		}, nil
+	case "label":
+		label := strings.TrimSpace(req.Label)
+		if label == "" {
+			return nil, errors.New("label action requires label")
+		}
+		return func(ctx context.Context, st *store.Store, ids []string) (int64, error) {
+			return st.LabelThreads(ctx, ids, label)
+		}, nil
+	case "assign":
+		assignee := strings.TrimSpace(req.Assignee)
+		return func(ctx context.Context, st *store.Store, ids []string) (int64, error) {
+			return st.AssignThreads(ctx, ids, assignee)
+		}, nil
+	case "delete":
+		return func(ctx context.Context, st *store.Store, ids []string) (int64, error) {
+			return st.DeleteThreads(ctx, ids)
+		}, nil
+	default:
+		return nil, errors.New("action must be one of close, label, assign, delete")
+	}
+}
+
+func bulkFilter(req BulkThreadRequest, now time.Time) (store.ThreadFilter, error) {
+	filter := store.ThreadFilter{
+		InboxID: strings.TrimSpace(req.InboxID),
+		Status:  strings.TrimSpace(req.Filter.Status),
+		Label:   strings.TrimSpace(req.Filter.Label),
+	}
+	if filter.InboxID == "" {
+		return filter, errors.New("missing inbox_id")
+	}
+	if raw := strings.TrimSpace(req.Filter.OlderThan); raw != "" {
+		age, err := parseAge(raw)
+		if err != nil {
+			return filter, err
+		}
+		filter.OlderThan = now.Add(-age)
+	}
+	return filter, nil
+}
+
+// parseAge accepts Go durations plus day and week suffixes ("30d", "2w").
+func parseAge(raw string) (time.Duration, error) {
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(raw, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(raw, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	if unit > 0 {
+		n, err := strconv.Atoi(strings.TrimSpace(raw[:len(raw)-1]))
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid older_than %q", raw)
+		}
+		return time.Duration(n) * unit, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid older_than %q", raw)
+	}
+	return d, nil
+}
@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/llm"
+)
+
+// ResponseCache stores model responses by key; *queue.Queue implements it
+// in Redis, so every replica shares the entries.
+type ResponseCache interface {
+	GetCachedResponse(ctx context.Context, key string) ([]byte, bool, error)
+	PutCachedResponse(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// cacheKey names a tool's model response by the tool, the model its task
+// goes to first, the prompt version and a hash of the org and the tool's
+// inputs, so switching models or prompts misses the old entries.
+func (s *Service) cacheKey(ctx context.Context, tool, task string, inputs any) (string, error) {
+	raw, err := json.Marshal(inputs)
+	if err != nil {
+		return "", err
+	}
+	principal, _ := auth.PrincipalFromContext(ctx)
+	inputsHash := sha256.Sum256(append([]byte(principal.OrgID+"\x00"), raw...))
+	name, model := llm.TaskModel(ctx, s.LLM, task)
+	key := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s:%s\x00%s\x00%x", tool, name, model, s.promptVersion(ctx), inputsHash)))
+	return fmt.Sprintf("%s:%x", tool, key), nil
+}
+
+// cachedModelCall fills out with the response cached for tool's inputs or,
+// on a miss, runs call and caches what it put in out if call reports it
+// worth keeping. bypass skips the lookup but still refreshes the entry. hit
+// reports that out came from the cache. A cache that cannot be reached is
+// logged and the model is called.
+func (s *Service) cachedModelCall(ctx context.Context, tool, task string, inputs any, bypass bool, out any, call func() (bool, error)) (hit bool, err error) {
+	if s.Cache == nil || s.Config.LLM.Cache.TTL <= 0 {
+		_, err := call()
+		return false, err
+	}
+	key, err := s.cacheKey(ctx, tool, task, inputs)
+	if err != nil {
+		_, err := call()
+		return false, err
+	}
+	if !bypass {
+		raw, ok, err := s.Cache.GetCachedResponse(ctx, key)
+		if err != nil {
+			slog.WarnContext(ctx, "llm cache unavailable", "tool", tool, "err", err)
+		} else if ok && json.Unmarshal(raw, out) == nil {
+			return true, nil
+		}
+	}
+	keep, err := call()
+	if err != nil || !keep {
+		return false, err
+	}
+	raw, err := json.Marshal(out)
+	if err != nil {
+		return false, nil
+	}
+	if err := s.Cache.PutCachedResponse(ctx, key, raw, s.Config.LLM.Cache.TTL); err != nil {
+		slog.WarnContext(ctx, "llm cache unavailable", "tool", tool, "err", err)
+	}
+	return false, nil
+}
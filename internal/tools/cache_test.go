@@ -0,0 +1,61 @@
+package tools
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"neuralmail/internal/llm"
+)
+
+type fakeCache map[string][]byte
+
+func (c fakeCache) GetCachedResponse(_ context.Context, key string) ([]byte, bool, error) {
+	raw, ok := c[key]
+	return raw, ok, nil
+}
+
+func (c fakeCache) PutCachedResponse(_ context.Context, key string, value []byte, _ time.Duration) error {
+	c[key] = value
+	return nil
+}
+
+func TestCachedModelCallServesRepeatsFromCache(t *testing.T) {
+	cache := fakeCache{}
+	svc := &Service{LLM: llm.NewNoop(), Cache: cache}
+	svc.Config.LLM.Cache.TTL = time.Hour
+	svc.Config.LLM.PromptPath = "configs/prompts/v1"
+
+	calls := 0
+	classify := func(ctx context.Context, bypass bool) (llm.Classification, bool) {
+		var out llm.Classification
+		hit, err := svc.cachedModelCall(ctx, "triage_message", llm.TaskClassify, "m1", bypass, &out, func() (bool, error) {
+			calls++
+			out = llm.Classification{Intent: "billing", Confidence: 0.8}
+			return true, nil
+		})
+		if err != nil {
+			t.Fatalf("cached call: %v", err)
+		}
+		return out, hit
+	}
+
+	ctx := context.Background()
+	if _, hit := classify(ctx, false); hit || calls != 1 {
+		t.Fatalf("expected the first call to reach the model, hit=%v calls=%d", hit, calls)
+	}
+	got, hit := classify(ctx, false)
+	if !hit || calls != 1 || got.Intent != "billing" {
+		t.Fatalf("expected a cached classification, hit=%v calls=%d got=%+v", hit, calls, got)
+	}
+	if _, hit := classify(ctx, true); hit || calls != 2 {
+		t.Fatalf("expected bypass_cache to reach the model, hit=%v calls=%d", hit, calls)
+	}
+	templated := context.WithValue(ctx, promptRefKey{}, "triage_message@v2")
+	if _, hit := classify(templated, false); hit || calls != 3 {
+		t.Fatalf("expected a new prompt version to miss, hit=%v calls=%d", hit, calls)
+	}
+	if len(cache) != 2 {
+		t.Fatalf("expected one entry per prompt version, got %d", len(cache))
+	}
+}
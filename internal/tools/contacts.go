@@ -0,0 +1,126 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/store"
+)
+
+// contactThreadLimit bounds the threads a contact profile lists and takes
+// the sentiment trend from.
+const contactThreadLimit = 20
+
+// sentimentShift is how far the average sentiment of a contact's recent
+// threads must move from their earlier ones to count as a trend.
+const sentimentShift = 0.2
+
+var errContactNotFound = errors.New("contact not found")
+
+// GetContactProfile describes a contact, found by email or contactID, for an
+// agent about to reply to them: their names and addresses, how long and how
+// much they have written, their recent threads and whether their sentiment
+// is improving or declining.
+func (s *Service) GetContactProfile(ctx context.Context, email string, contactID string) (any, error) {
+	email, contactID = strings.TrimSpace(email), strings.TrimSpace(contactID)
+	if email == "" && contactID == "" {
+		return nil, errors.New("missing email or contact_id")
+	}
+	if contactID != "" {
+		if _, err := uuid.Parse(contactID); err != nil {
+			return nil, errContactNotFound
+		}
+	}
+	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
+		var contact store.Contact
+		var err error
+		if contactID != "" {
+			contact, err = st.GetContact(scopedCtx, principal.OrgID, contactID)
+		} else {
+			contact, err = st.GetContactByEmail(scopedCtx, principal.OrgID, email)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errContactNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		threads, err := st.ListContactThreads(scopedCtx, contact.ID, contactThreadLimit)
+		if err != nil {
+			return nil, err
+		}
+		threads = slices.DeleteFunc(threads, func(t store.ContactThread) bool { return !principal.CanAccessInbox(t.InboxID) })
+
+		recent := make([]map[string]any, 0, len(threads))
+		for _, t := range threads {
+			recent = append(recent, map[string]any{
+				"thread_id":       t.ThreadID,
+				"subject":         t.Subject,
+				"status":          t.Status,
+				"sentiment_score": t.SentimentScore,
+				"last_seen_at":    t.LastSeenAt,
+			})
+		}
+		return map[string]any{
+			"contact_id":     contact.ID,
+			"name":           contact.Name,
+			"emails":         contact.Emails,
+			"first_seen_at":  contact.FirstSeenAt,
+			"last_seen_at":   contact.LastSeenAt,
+			"message_count":  contact.MessageCount,
+			"thread_count":   contact.ThreadCount,
+			"sentiment":      sentimentTrend(threads),
+			"recent_threads": recent,
+		}, nil
+	})
+}
+
+// sentimentTrend summarizes the triage sentiment of a contact's threads,
+// given latest first: the scores oldest first, their average, and a trend
+// comparing the newer half with the older one. Fewer than two scored
+// threads make no trend.
+func sentimentTrend(threads []store.ContactThread) map[string]any {
+	type point struct {
+		ThreadID string    `json:"thread_id"`
+		Score    float64   `json:"score"`
+		At       time.Time `json:"at"`
+	}
+	points := []point{}
+	for i := len(threads) - 1; i >= 0; i-- {
+		if t := threads[i]; t.SentimentScore != nil {
+			points = append(points, point{ThreadID: t.ThreadID, Score: *t.SentimentScore, At: t.LastSeenAt})
+		}
+	}
+	mean := func(ps []point) float64 {
+		sum := 0.0
+		for _, p := range ps {
+			sum += p.Score
+		}
+		return sum / float64(len(ps))
+	}
+	out := map[string]any{"trend": "unknown", "points": points}
+	if len(points) == 0 {
+		return out
+	}
+	out["average"] = mean(points)
+	if len(points) < 2 {
+		return out
+	}
+	half := len(points) / 2
+	switch shift := mean(points[len(points)-half:]) - mean(points[:len(points)-half]); {
+	case shift >= sentimentShift:
+		out["trend"] = "improving"
+	case shift <= -sentimentShift:
+		out["trend"] = "declining"
+	default:
+		out["trend"] = "stable"
+	}
+	return out
+}
@@ -0,0 +1,45 @@
+package tools
+
+import (
+	"testing"
+
+	"neuralmail/internal/store"
+)
+
+func TestSentimentTrend(t *testing.T) {
+	score := func(v float64) *float64 { return &v }
+	// Threads are given latest first, as ListContactThreads returns them.
+	threads := func(scores ...*float64) []store.ContactThread {
+		out := make([]store.ContactThread, len(scores))
+		for i, s := range scores {
+			out[len(scores)-1-i] = store.ContactThread{ThreadID: string(rune('a' + i)), SentimentScore: s}
+		}
+		return out
+	}
+	cases := []struct {
+		name    string
+		threads []store.ContactThread
+		want    string
+	}{
+		{"none", nil, "unknown"},
+		{"one", threads(score(0.5)), "unknown"},
+		{"unscored", threads(nil, nil), "unknown"},
+		{"improving", threads(score(-0.5), score(-0.5), score(0), score(0.5)), "improving"},
+		{"declining", threads(score(0.5), score(0), score(-0.5)), "declining"},
+		{"stable", threads(score(0), nil, score(0.1)), "stable"},
+	}
+	for _, tc := range cases {
+		got := sentimentTrend(tc.threads)
+		if got["trend"] != tc.want {
+			t.Errorf("%s: trend = %v, want %s", tc.name, got["trend"], tc.want)
+		}
+	}
+
+	got := sentimentTrend(threads(score(-0.5), nil, score(0.5)))
+	if got["average"] != 0.0 {
+		t.Fatalf("average = %v, want 0", got["average"])
+	}
+	if _, ok := sentimentTrend(nil)["average"]; ok {
+		t.Fatal("no scores should have no average")
+	}
+}
@@ -0,0 +1,144 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/integrations"
+	"neuralmail/internal/store"
+)
+
+var errCRMNotConfigured = errors.New("crm integration not configured")
+
+// LinkThreadToCRM links threadID to ticketID in the org's CRM or, without
+// one, files the thread as a new kind case (sales or support, support by
+// default) from its latest inbound message.
+func (s *Service) LinkThreadToCRM(ctx context.Context, threadID string, ticketID string, kind string) (any, error) {
+	if s.CRM == nil {
+		return nil, errCRMNotConfigured
+	}
+	ticketID, kind = strings.TrimSpace(ticketID), strings.ToLower(strings.TrimSpace(kind))
+	if kind != "" && kind != integrations.KindSales && kind != integrations.KindSupport {
+		return nil, errors.New("kind must be sales or support")
+	}
+	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
+		if principal.OrgID != "" {
+			if err := s.ensureThreadBelongsToOrg(scopedCtx, st, principal, threadID); err != nil {
+				return nil, err
+			}
+		}
+		thread, messages, err := st.GetThread(scopedCtx, threadID)
+		if err != nil {
+			return nil, err
+		}
+		msg := latestInbound(messages)
+		msg.ThreadID = thread.ID
+		if msg.Subject == "" {
+			msg.Subject = thread.Subject
+		}
+		link, err := s.CRM.LinkThread(scopedCtx, st, msg, ticketID, kind, principal.ActorID)
+		if err != nil {
+			return nil, err
+		}
+		return crmLinkResult(link), nil
+	})
+}
+
+// GetCRMContext returns what the org's CRM knows about email or, given a
+// thread, about its latest inbound sender, with the ticket the thread is
+// linked to.
+func (s *Service) GetCRMContext(ctx context.Context, threadID string, email string) (any, error) {
+	if s.CRM == nil {
+		return nil, errCRMNotConfigured
+	}
+	threadID, email = strings.TrimSpace(threadID), strings.ToLower(strings.TrimSpace(email))
+	if threadID == "" && email == "" {
+		return nil, errors.New("missing thread_id or email")
+	}
+	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
+		var link *store.CRMLink
+		if threadID != "" {
+			if principal.OrgID != "" {
+				if err := s.ensureThreadBelongsToOrg(scopedCtx, st, principal, threadID); err != nil {
+					return nil, err
+				}
+			}
+			_, messages, err := st.GetThread(scopedCtx, threadID)
+			if err != nil {
+				return nil, err
+			}
+			if email == "" {
+				email = strings.ToLower(latestInbound(messages).From.Email)
+			}
+			l, err := st.GetCRMLink(scopedCtx, threadID)
+			switch {
+			case err == nil:
+				link = &l
+			case !errors.Is(err, sql.ErrNoRows):
+				return nil, err
+			}
+		}
+		var ticketID string
+		if link != nil {
+			ticketID = link.TicketID
+		}
+		provider, crm, err := s.CRM.Context(scopedCtx, st, principal.OrgID, email, ticketID)
+		if err != nil {
+			return nil, err
+		}
+		out := map[string]any{
+			"provider": provider,
+			"email":    email,
+			"contact":  crm.Contact,
+			"tickets":  crm.Tickets,
+			"deals":    crm.Deals,
+			"link":     nil,
+		}
+		if link != nil {
+			out["link"] = crmLinkResult(*link)
+		}
+		return out, nil
+	})
+}
+
+// syncCRMCase files a triaged message's thread in the org's CRM. The CRM
+// being down must not fail triage, so errors are only logged.
+func (s *Service) syncCRMCase(ctx context.Context, st *store.Store, msg store.Message, intent string, urgency string) string {
+	if s.CRM == nil {
+		return ""
+	}
+	link, err := s.CRM.SyncCase(ctx, st, msg, intent, urgency)
+	if err != nil {
+		slog.WarnContext(ctx, "crm sync failed", "thread", msg.ThreadID, "err", err)
+		return ""
+	}
+	return link.TicketID
+}
+
+func crmLinkResult(link store.CRMLink) map[string]any {
+	return map[string]any{
+		"thread_id":  link.ThreadID,
+		"provider":   link.Provider,
+		"kind":       link.Kind,
+		"contact_id": link.ContactID,
+		"ticket_id":  link.TicketID,
+		"priority":   link.Priority,
+		"linked_by":  link.LinkedBy,
+		"updated_at": link.UpdatedAt,
+	}
+}
+
+// latestInbound is the newest inbound message of a thread, oldest first,
+// or the zero message when there is none.
+func latestInbound(messages []store.Message) store.Message {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Direction == "inbound" {
+			return messages[i]
+		}
+	}
+	return store.Message{}
+}
@@ -0,0 +1,84 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/store"
+)
+
+// GetDeliveryStatus reports how far delivery of an outbound message has
+// got: queued (possibly retrying), sent, delivered once its provider reports
+// the recipient's server took it, bounced, failed, or complained when the
+// recipient reported it as abuse.
+func (s *Service) GetDeliveryStatus(ctx context.Context, messageID string) (any, error) {
+	if messageID == "" {
+		return nil, errors.New("missing message_id")
+	}
+	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
+		delivery, err := st.GetOutboxByMessage(scopedCtx, messageID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && principal.OrgID != "" && delivery.OrgID != principal.OrgID) {
+			return nil, errors.New("no delivery for message")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if principal.OrgID != "" {
+			if err := s.ensureMessageBelongsToOrg(scopedCtx, st, principal, delivery.MessageID); err != nil {
+				return nil, err
+			}
+		}
+		result := map[string]any{
+			"message_id": delivery.MessageID,
+			"status":     delivery.Status,
+			"to":         delivery.To,
+			"attempts":   delivery.Attempts,
+			"last_error": delivery.LastError,
+			"queued_at":  delivery.CreatedAt,
+			"updated_at": delivery.UpdatedAt,
+		}
+		if delivery.Status == store.DeliveryQueued {
+			result["next_attempt_at"] = delivery.NextAttemptAt
+		}
+		if delivery.SentAt.Valid {
+			result["sent_at"] = delivery.SentAt.Time
+			result["transport"] = delivery.Transport
+		}
+		if delivery.ProviderMessageID != "" {
+			result["provider_message_id"] = delivery.ProviderMessageID
+		}
+		if delivery.DeliveredAt.Valid {
+			result["delivered_at"] = delivery.DeliveredAt.Time
+		}
+		return result, nil
+	})
+}
+
+// checkSuppressed refuses a send to an address that hard-bounced or
+// complained about the org's mail before.
+func checkSuppressed(ctx context.Context, st *store.Store, inboxID string, to string) error {
+	suppressed, err := st.IsSuppressed(ctx, inboxID, to)
+	if err != nil {
+		return err
+	}
+	if suppressed {
+		return errors.New("send blocked: recipient is suppressed")
+	}
+	return nil
+}
+
+// autoReplyBlock says why an unreviewed reply must not go to a thread: it is
+// flagged as a mail loop, or its last message came from an auto-responder,
+// which would likely answer back. Approved drafts are sent regardless.
+func autoReplyBlock(thread store.Thread, messages []store.Message) string {
+	if slices.Contains(thread.Labels, store.LabelLoop) {
+		return "thread is flagged as a mail loop"
+	}
+	if last := messages[len(messages)-1]; last.Direction == "inbound" && last.AutoSubmitted != "" {
+		return "last message is automated (" + last.AutoSubmitted + ")"
+	}
+	return ""
+}
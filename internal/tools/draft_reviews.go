@@ -0,0 +1,148 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/store"
+)
+
+const pendingDraftsDefaultLimit = 50
+
+// PendingDraft is a draft waiting for review, with the revision to decide on.
+type PendingDraft struct {
+	DraftID            string    `json:"draft_id"`
+	ThreadID           string    `json:"thread_id"`
+	Goal               string    `json:"goal"`
+	Revision           int       `json:"revision"`
+	Body               string    `json:"body"`
+	PolicyID           string    `json:"policy_id"`
+	PolicyBlocked      bool      `json:"policy_blocked"`
+	Reason             string    `json:"reason"`
+	RiskFlags          []string  `json:"risk_flags"`
+	PolicyRuleIDs      []string  `json:"policy_rule_ids"`
+	SubmittedAt        time.Time `json:"submitted_at"`
+	NeedsHumanApproval bool      `json:"needs_human_approval"`
+}
+
+// ListPendingDrafts returns the org's drafts awaiting approval, oldest first.
+func (s *Service) ListPendingDrafts(ctx context.Context, limit int) (any, error) {
+	if limit <= 0 {
+		limit = pendingDraftsDefaultLimit
+	}
+	limit = min(limit, 200)
+	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
+		drafts, err := st.ListDrafts(scopedCtx, principal.OrgID, store.DraftPendingApproval, limit)
+		if err != nil {
+			return nil, err
+		}
+		items := make([]PendingDraft, 0, len(drafts))
+		for _, d := range drafts {
+			if len(principal.InboxIDs) > 0 {
+				inboxID, err := st.GetThreadInboxID(scopedCtx, d.ThreadID)
+				if err != nil {
+					return nil, err
+				}
+				if !principal.CanAccessInbox(inboxID) {
+					continue
+				}
+			}
+			items = append(items, PendingDraft{
+				DraftID:            d.ID,
+				ThreadID:           d.ThreadID,
+				Goal:               d.Goal,
+				Revision:           d.Latest.Revision,
+				Body:               d.Latest.Body,
+				PolicyID:           d.Latest.PolicyID,
+				PolicyBlocked:      d.Latest.PolicyBlocked,
+				Reason:             d.Latest.Reason,
+				RiskFlags:          d.Latest.RiskFlags,
+				PolicyRuleIDs:      d.Latest.PolicyRuleIDs,
+				SubmittedAt:        d.Latest.CreatedAt,
+				NeedsHumanApproval: d.Latest.NeedsApproval,
+			})
+		}
+		return map[string]any{"drafts": items}, nil
+	})
+}
+
+// ApproveDraft approves a draft's latest revision so send_reply will send it.
+// When revision is set it must still be the latest one.
+func (s *Service) ApproveDraft(ctx context.Context, draftID string, revision int, note string) (any, error) {
+	return s.reviewDraft(ctx, draftID, store.DraftApproved, revision, note)
+}
+
+// RejectDraft turns a draft down. The agent can resubmit with update_draft,
+// which puts the draft back in review.
+func (s *Service) RejectDraft(ctx context.Context, draftID string, reason string) (any, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, errors.New("missing reason")
+	}
+	return s.reviewDraft(ctx, draftID, store.DraftRejected, 0, reason)
+}
+
+func (s *Service) reviewDraft(ctx context.Context, draftID string, status string, revision int, note string) (any, error) {
+	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
+		draft, err := s.loadDraft(scopedCtx, st, principal, draftID)
+		if err != nil {
+			return nil, err
+		}
+		if draft.Status == store.DraftSent {
+			return nil, errors.New("draft already sent")
+		}
+		reviewer := principal.ActorID
+		if reviewer == "" {
+			reviewer = "mcp"
+		}
+		ok, err := st.ReviewDraft(scopedCtx, principal.OrgID, draft.ID, status, reviewer, note, revision)
+		if err != nil {
+			return nil, err
+		}
+		if !ok && revision > 0 {
+			return nil, fmt.Errorf("revision %d is no longer the latest revision of the draft", revision)
+		}
+		if !ok {
+			return nil, errors.New("draft already sent")
+		}
+		reviewed, err := st.GetDraft(scopedCtx, draft.ID)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			"draft_id":          reviewed.ID,
+			"status":            reviewed.Status,
+			"approved_revision": reviewed.ApprovedRevision,
+			"reviewed_by":       reviewed.ReviewedBy,
+		}, nil
+	})
+}
+
+// approvedDraftBody returns the text send_reply may send for a draft: the
+// approved revision, as long as the draft is still approved and belongs to
+// threadID.
+func (s *Service) approvedDraftBody(ctx context.Context, st *store.Store, principal auth.Principal, draftID string, threadID string) (string, error) {
+	draft, err := s.loadDraft(ctx, st, principal, draftID)
+	if err != nil {
+		return "", err
+	}
+	if draft.ThreadID != threadID {
+		return "", errors.New("draft belongs to a different thread")
+	}
+	if draft.Status != store.DraftApproved {
+		return "", fmt.Errorf("send blocked: draft is %s", draft.Status)
+	}
+	revisions, err := st.ListDraftRevisions(ctx, draft.ID)
+	if err != nil {
+		return "", err
+	}
+	for _, rev := range revisions {
+		if rev.Revision == draft.ApprovedRevision {
+			return rev.Body, nil
+		}
+	}
+	return "", errors.New("approved revision not found")
+}
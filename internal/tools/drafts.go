@@ -0,0 +1,336 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/llm"
+	"neuralmail/internal/policy"
+	"neuralmail/internal/store"
+	"neuralmail/internal/textdiff"
+)
+
+// Knowledge limits for DraftReplyWithKnowledge.
+const (
+	maxKnowledgeChunks    = 20
+	maxKnowledgeChunkSize = 4000
+)
+
+var knowledgeChunkIDRE = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// KnowledgeChunk is a knowledge base passage the caller retrieved for a
+// draft. Drafts cite it as [kb:<ID>].
+type KnowledgeChunk struct {
+	ID   string
+	Text string
+}
+
+// draftSources is the retrieved content a draft may cite: the messages in
+// its thread context and the knowledge base chunks it was given.
+type draftSources struct {
+	MessageIDs []string
+	ChunkIDs   []string
+}
+
+// evaluateDraft runs policy over a draft and returns the tool result
+// together with the revision to store. The draft's inline citation markers
+// are stripped from the body and reported per sentence, resolved against
+// sources. cited are the messages the draft as a whole cites. A blocked
+// result hides the text, but the revision keeps it so reviewers can
+// compare it with the resubmission. recipients are who the reply goes to.
+func evaluateDraft(text string, activePolicy policy.Policy, llmApproval bool, cited []string, sources draftSources, recipients []string) (map[string]any, store.DraftRevision) {
+	body, sentences := policy.ParseCitations(text)
+	adjusted, eval := policy.EvaluateFor(body, activePolicy, recipients)
+	sentences = policy.RedactSentences(policy.ResolveCitations(sentences, sources.MessageIDs, sources.ChunkIDs), activePolicy)
+	var citedChunks []string
+	for _, sentence := range sentences {
+		for _, id := range sentence.CitedMessageIDs {
+			if !slices.Contains(cited, id) {
+				cited = append(cited, id)
+			}
+		}
+		for _, id := range sentence.CitedChunkIDs {
+			if !slices.Contains(citedChunks, id) {
+				citedChunks = append(citedChunks, id)
+			}
+		}
+	}
+	policy.CheckCitations(&eval, activePolicy, len(cited)+len(citedChunks))
+	policy.CheckClaims(&eval, activePolicy, sentences)
+	rev := store.DraftRevision{
+		Body:             adjusted,
+		PolicyID:         activePolicy.ID,
+		OrgPolicyVersion: activePolicy.OrgVersion,
+		NeedsApproval:    eval.NeedsApproval || llmApproval,
+		Reason:           eval.Reason,
+		RiskFlags:        eval.RiskFlags,
+		PolicyRuleIDs:    make([]string, 0, len(eval.MatchedRules)),
+	}
+	for _, match := range eval.MatchedRules {
+		rev.PolicyRuleIDs = append(rev.PolicyRuleIDs, match.RuleID)
+	}
+	if !eval.Allowed && eval.ViolationLevel == "critical" {
+		rev.PolicyBlocked = true
+		rev.NeedsApproval = true
+		return map[string]any{
+			"draft":                "",
+			"risk_flags":           eval.RiskFlags,
+			"link_findings":        eval.LinkFindings,
+			"cited_message_ids":    nil,
+			"cited_chunk_ids":      nil,
+			"sentences":            nil,
+			"needs_human_approval": true,
+			"policy_blocked":       true,
+			"reason":               eval.Reason,
+			"policy_id":            activePolicy.ID,
+			"org_policy_version":   activePolicy.OrgVersion,
+			"policy_rules":         eval.MatchedRules,
+		}, rev
+	}
+	return map[string]any{
+		"draft":                adjusted,
+		"risk_flags":           eval.RiskFlags,
+		"link_findings":        eval.LinkFindings,
+		"cited_message_ids":    cited,
+		"cited_chunk_ids":      citedChunks,
+		"sentences":            sentences,
+		"needs_human_approval": rev.NeedsApproval,
+		"policy_id":            activePolicy.ID,
+		"org_policy_version":   activePolicy.OrgVersion,
+		"policy_rules":         eval.MatchedRules,
+	}, rev
+}
+
+// draftWithCitations asks the LLM for a draft and keeps the citations that
+// name source messages. When the draft falls short of the policy, citing
+// nothing where citations are required or leaving claims without a source
+// that resolves, it re-prompts once; retried reports whether it did.
+func (s *Service) draftWithCitations(ctx context.Context, contextText string, goal string, sources draftSources, activePolicy policy.Policy) (draft llm.Draft, cited []string, retried bool, err error) {
+	hints := map[string]any{
+		llm.PolicyRequireCitations: activePolicy.Citations.Required || activePolicy.ChecksClaims(),
+		llm.PolicySourceMessageIDs: sources.MessageIDs,
+	}
+	if len(sources.ChunkIDs) > 0 {
+		hints[llm.PolicySourceChunkIDs] = sources.ChunkIDs
+	}
+	draft, err = s.LLM.Draft(ctx, contextText, hints, goal)
+	if err != nil {
+		return llm.Draft{}, nil, false, err
+	}
+	feedback := citationFeedback(draft, sources, activePolicy)
+	if feedback == "" {
+		return draft, sourceCitations(draft.Citations, sources.MessageIDs), false, nil
+	}
+	hints[llm.PolicyCitationFeedback] = feedback
+	draft, err = s.LLM.Draft(ctx, contextText, hints, goal)
+	if err != nil {
+		return llm.Draft{}, nil, true, err
+	}
+	return draft, sourceCitations(draft.Citations, sources.MessageIDs), true, nil
+}
+
+// citationFeedback says what a draft's citations lack under the policy, or
+// is empty when nothing does.
+func citationFeedback(draft llm.Draft, sources draftSources, activePolicy policy.Policy) string {
+	_, sentences := policy.ParseCitations(draft.Text)
+	sentences = policy.ResolveCitations(sentences, sources.MessageIDs, sources.ChunkIDs)
+	if activePolicy.ChecksClaims() {
+		if uncited, unresolved := policy.ClaimGaps(sentences); uncited+unresolved > 0 {
+			return "Some statements in the previous draft cited no source, or cited a source that is not in the context. Follow each statement with the [msg:<id>] or [kb:<id>] markers of the sources behind it, and drop statements no source supports."
+		}
+	}
+	if !activePolicy.Citations.Required || len(sourceCitations(draft.Citations, sources.MessageIDs)) > 0 {
+		return ""
+	}
+	for _, sentence := range sentences {
+		if len(sentence.CitedMessageIDs)+len(sentence.CitedChunkIDs) > 0 {
+			return ""
+		}
+	}
+	return "The previous draft cited no source message. Cite at least one of the source message IDs the reply relies on."
+}
+
+// replyRecipients is who a reply on the thread goes to: the sender of its
+// latest inbound message.
+func replyRecipients(messages []store.Message) []string {
+	if from := latestInbound(messages).From.Email; from != "" {
+		return []string{from}
+	}
+	return nil
+}
+
+// sourceCitations returns the distinct citations that are source message IDs,
+// dropping anything the model made up.
+func sourceCitations(citations []string, sources []string) []string {
+	var out []string
+	for _, id := range citations {
+		if slices.Contains(sources, id) && !slices.Contains(out, id) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// knowledgeContext validates the knowledge given with a draft and renders
+// it for the model's context, returning the chunk IDs.
+func knowledgeContext(knowledge []KnowledgeChunk) (string, []string, error) {
+	if len(knowledge) > maxKnowledgeChunks {
+		return "", nil, fmt.Errorf("at most %d knowledge chunks", maxKnowledgeChunks)
+	}
+	var b strings.Builder
+	ids := make([]string, 0, len(knowledge))
+	for _, chunk := range knowledge {
+		id, text := strings.TrimSpace(chunk.ID), strings.TrimSpace(chunk.Text)
+		if !knowledgeChunkIDRE.MatchString(id) {
+			return "", nil, fmt.Errorf("invalid knowledge chunk id %q", chunk.ID)
+		}
+		if text == "" || len(text) > maxKnowledgeChunkSize {
+			return "", nil, fmt.Errorf("knowledge chunk %s must have 1 to %d bytes of text", id, maxKnowledgeChunkSize)
+		}
+		if slices.Contains(ids, id) {
+			return "", nil, fmt.Errorf("duplicate knowledge chunk id %s", id)
+		}
+		ids = append(ids, id)
+		fmt.Fprintf(&b, "\n[kb:%s] %s", id, text)
+	}
+	if len(ids) == 0 {
+		return "", nil, nil
+	}
+	return "\n\nKnowledge base:" + b.String(), ids, nil
+}
+
+// draftReview describes the last human decision on a draft, or nil if no
+// reviewer has looked at its current revision.
+func draftReview(draft store.Draft) map[string]any {
+	if !draft.ReviewedAt.Valid {
+		return nil
+	}
+	return map[string]any{
+		"reviewed_by":       draft.ReviewedBy,
+		"reviewed_at":       draft.ReviewedAt.Time,
+		"note":              draft.ReviewNote,
+		"approved_revision": draft.ApprovedRevision,
+	}
+}
+
+// loadDraft fetches a draft and checks that principal may reach its thread.
+func (s *Service) loadDraft(ctx context.Context, st *store.Store, principal auth.Principal, draftID string) (store.Draft, error) {
+	draft, err := st.GetDraft(ctx, draftID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.Draft{}, errors.New("draft not found")
+	}
+	if err != nil {
+		return store.Draft{}, err
+	}
+	if principal.OrgID != "" {
+		if err := s.ensureThreadBelongsToOrg(ctx, st, principal, draft.ThreadID); err != nil {
+			return store.Draft{}, err
+		}
+	}
+	return draft, nil
+}
+
+// UpdateDraft resubmits a revised body for an existing draft. The body goes
+// through the same policy checks as a fresh draft and is stored as the next
+// revision.
+func (s *Service) UpdateDraft(ctx context.Context, draftID string, body string) (any, error) {
+	if strings.TrimSpace(body) == "" {
+		return nil, errors.New("missing body")
+	}
+	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
+		draft, err := s.loadDraft(scopedCtx, st, principal, draftID)
+		if err != nil {
+			return nil, err
+		}
+		if draft.Status == store.DraftSent {
+			return nil, errors.New("draft already sent")
+		}
+		_, messages, err := st.GetThread(scopedCtx, draft.ThreadID)
+		if err != nil {
+			return nil, err
+		}
+		activePolicy, err := s.policyForOrg(scopedCtx, st, principal.OrgID)
+		if err != nil {
+			return nil, err
+		}
+		chunkIDs, err := st.GetDraftSourceChunkIDs(scopedCtx, draft.ID)
+		if err != nil {
+			return nil, err
+		}
+		sources := draftSources{MessageIDs: make([]string, 0, len(messages)), ChunkIDs: chunkIDs}
+		for _, msg := range messages {
+			sources.MessageIDs = append(sources.MessageIDs, msg.ID)
+		}
+		result, rev := evaluateDraft(body, activePolicy, false, []string{lastMessageID(messages)}, sources, replyRecipients(messages))
+		revision, err := st.AddDraftRevision(scopedCtx, draft.ID, rev)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("draft already sent")
+		}
+		if err != nil {
+			return nil, err
+		}
+		result["draft_id"] = draft.ID
+		result["revision"] = revision
+		result["status"] = store.DraftStatusFor(rev)
+		return result, nil
+	})
+}
+
+// GetDraftHistory lists a draft's revisions with their policy outcomes and
+// a line diff between each revision and the one before it.
+func (s *Service) GetDraftHistory(ctx context.Context, draftID string) (any, error) {
+	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
+		draft, err := s.loadDraft(scopedCtx, st, principal, draftID)
+		if err != nil {
+			return nil, err
+		}
+		revisions, err := st.ListDraftRevisions(scopedCtx, draft.ID)
+		if err != nil {
+			return nil, err
+		}
+		items := make([]map[string]any, 0, len(revisions))
+		diffs := make([]map[string]any, 0, max(len(revisions)-1, 0))
+		for i, rev := range revisions {
+			items = append(items, map[string]any{
+				"revision":             rev.Revision,
+				"created_at":           rev.CreatedAt,
+				"body":                 rev.Body,
+				"policy_id":            rev.PolicyID,
+				"org_policy_version":   rev.OrgPolicyVersion,
+				"policy_blocked":       rev.PolicyBlocked,
+				"needs_human_approval": rev.NeedsApproval,
+				"reason":               rev.Reason,
+				"risk_flags":           rev.RiskFlags,
+				"policy_rule_ids":      rev.PolicyRuleIDs,
+			})
+			if i == 0 {
+				continue
+			}
+			diff := textdiff.Lines(revisions[i-1].Body, rev.Body)
+			diffs = append(diffs, map[string]any{
+				"from_revision": revisions[i-1].Revision,
+				"to_revision":   rev.Revision,
+				"ops":           diff.Ops,
+				"lines_added":   diff.Added,
+				"lines_removed": diff.Removed,
+			})
+		}
+		return map[string]any{
+			"draft_id":   draft.ID,
+			"thread_id":  draft.ThreadID,
+			"goal":       draft.Goal,
+			"status":     draft.Status,
+			"review":     draftReview(draft),
+			"created_at": draft.CreatedAt,
+			"updated_at": draft.UpdatedAt,
+			"revisions":  items,
+			"diffs":      diffs,
+		}, nil
+	})
+}
@@ -0,0 +1,39 @@
+package tools
+
+import (
+	"testing"
+
+	"neuralmail/internal/policy"
+)
+
+func TestEvaluateDraftCitesPerSentence(t *testing.T) {
+	p := policy.Policy{ID: "p1"}
+	p.Citations.Claims = policy.ClaimsDowngrade
+	sources := draftSources{MessageIDs: []string{"m1", "m2"}, ChunkIDs: []string{"kb1"}}
+
+	result, rev := evaluateDraft("Your order shipped on Monday. [msg:m2] Refunds take five business days. [kb:kb1]", p, false, nil, sources, nil)
+	if rev.NeedsApproval || result["draft"] != "Your order shipped on Monday. Refunds take five business days." {
+		t.Fatalf("expected a fully cited draft to pass with markers stripped, got %+v", result)
+	}
+	if cited := result["cited_message_ids"].([]string); len(cited) != 1 || cited[0] != "m2" {
+		t.Fatalf("expected the cited message rather than the last one, got %v", cited)
+	}
+	if chunks := result["cited_chunk_ids"].([]string); len(chunks) != 1 || chunks[0] != "kb1" {
+		t.Fatalf("expected the cited chunk, got %v", chunks)
+	}
+
+	_, rev = evaluateDraft("Your order shipped on Monday. [msg:m9]", p, false, nil, sources, nil)
+	if !rev.NeedsApproval || len(rev.RiskFlags) != 2 {
+		t.Fatalf("expected an unresolved citation to downgrade the draft, got %+v", rev)
+	}
+}
+
+func TestKnowledgeContextValidatesChunks(t *testing.T) {
+	text, ids, err := knowledgeContext([]KnowledgeChunk{{ID: "refunds-1", Text: "Refunds take five business days."}})
+	if err != nil || len(ids) != 1 || text != "\n\nKnowledge base:\n[kb:refunds-1] Refunds take five business days." {
+		t.Fatalf("unexpected knowledge context %q %v %v", text, ids, err)
+	}
+	if _, _, err := knowledgeContext([]KnowledgeChunk{{ID: "bad id]", Text: "x"}}); err == nil {
+		t.Fatalf("expected an invalid chunk id to be rejected")
+	}
+}
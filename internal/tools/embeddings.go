@@ -0,0 +1,75 @@
+package tools
+
+import (
+	"context"
+	"log/slog"
+
+	"neuralmail/internal/queue"
+	"neuralmail/internal/store"
+)
+
+// Message directions, as stored on messages and tagged on vector points.
+const (
+	DirectionInbound  = "inbound"
+	DirectionOutbound = "outbound"
+)
+
+// Retrieval modes reported by search_inbox. Callers may also ask for one
+// with its mode argument, or for RetrievalAuto, the default.
+const (
+	RetrievalAuto   = "auto"
+	RetrievalVector = "vector"
+	RetrievalFTS    = "fts"
+	RetrievalHybrid = "hybrid"
+)
+
+// EmbeddingQueue accepts message IDs for the embedding worker; *queue.Queue
+// satisfies it.
+type EmbeddingQueue interface {
+	PushEmbeddingJob(ctx context.Context, job queue.Job) error
+}
+
+// enqueueEmbedding queues the message a send tool stored, so past replies are
+// retrievable like inbound mail. It runs after the org transaction commits;
+// queued earlier, the worker could pop the job before the row is visible.
+// Dry runs commit nothing, so there is nothing to queue.
+func (s *Service) enqueueEmbedding(ctx context.Context, result any) {
+	if s.Embeddings == nil || store.IsDryRun(ctx) {
+		return
+	}
+	data, ok := result.(map[string]any)
+	if !ok {
+		return
+	}
+	messageID, _ := data["message_id"].(string)
+	if messageID == "" {
+		return
+	}
+	job := queue.NewJob(messageID, queue.OriginSend)
+	if err := s.Embeddings.PushEmbeddingJob(ctx, job); err != nil {
+		slog.ErrorContext(ctx, "embedding enqueue failed", "trace_id", job.TraceID, "message", messageID, "err", err)
+	}
+}
+
+// withDirection narrows a vector search filter to one direction. Points
+// embedded before direction was tagged are all inbound, so inbound matches
+// anything not tagged outbound.
+func withDirection(filter map[string]any, direction string) {
+	outbound := map[string]any{"key": "direction", "match": map[string]any{"value": DirectionOutbound}}
+	switch direction {
+	case DirectionOutbound:
+		must, _ := filter["must"].([]map[string]any)
+		filter["must"] = append(must, outbound)
+	case DirectionInbound:
+		filter["must_not"] = []map[string]any{outbound}
+	}
+}
+
+// embeddingDisabled reports the inbox's embedding switch. With residency the
+// home directory holds inbox settings; regional replicas may be stale.
+func (s *Service) embeddingDisabled(ctx context.Context, st *store.Store, inboxID string) (bool, error) {
+	if s.Residency != nil {
+		return s.Residency.EmbeddingDisabled(ctx, inboxID)
+	}
+	return st.InboxEmbeddingDisabled(ctx, inboxID)
+}
@@ -0,0 +1,114 @@
+package tools
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"neuralmail/internal/embed"
+	"neuralmail/internal/queue"
+	"neuralmail/internal/store"
+	"neuralmail/internal/vector"
+)
+
+// fakeVector holds points in memory and applies the must and must_not
+// conditions of a search filter as Qdrant would.
+type fakeVector struct {
+	points []vector.SearchHit
+}
+
+func (f *fakeVector) Upsert(ctx context.Context, points []vector.Point) error { return nil }
+
+func (f *fakeVector) Search(ctx context.Context, v []float32, limit int, filter map[string]any) ([]vector.SearchHit, error) {
+	must, _ := filter["must"].([]map[string]any)
+	mustNot, _ := filter["must_not"].([]map[string]any)
+	var hits []vector.SearchHit
+	for _, point := range f.points {
+		if !slices.ContainsFunc(must, func(c map[string]any) bool { return !matches(point, c) }) &&
+			!slices.ContainsFunc(mustNot, func(c map[string]any) bool { return matches(point, c) }) {
+			hits = append(hits, point)
+		}
+	}
+	return hits, nil
+}
+
+func matches(point vector.SearchHit, condition map[string]any) bool {
+	key, _ := condition["key"].(string)
+	match, _ := condition["match"].(map[string]any)
+	return point.Payload[key] == match["value"]
+}
+
+func (f *fakeVector) EnsureCollection(ctx context.Context, dim int) error { return nil }
+
+func (f *fakeVector) Delete(ctx context.Context, filter map[string]any) error { return nil }
+
+func (f *fakeVector) Scroll(ctx context.Context, offset string, limit int) ([]vector.SearchHit, string, error) {
+	return nil, "", nil
+}
+
+func (f *fakeVector) Name() string { return "fake" }
+
+func TestSearchVectorFiltersByDirection(t *testing.T) {
+	point := func(messageID, inboxID, direction string) vector.SearchHit {
+		payload := map[string]any{"message_id": messageID, "inbox_id": inboxID}
+		if direction != "" {
+			payload["direction"] = direction
+		}
+		return vector.SearchHit{ID: messageID, Payload: payload}
+	}
+	svc := &Service{
+		Embedder: embed.NewNoop(8),
+		Vector: &fakeVector{points: []vector.SearchHit{
+			point("in-1", "inbox-1", DirectionInbound),
+			point("out-1", "inbox-1", DirectionOutbound),
+			// Embedded before direction was tagged.
+			point("legacy-1", "inbox-1", ""),
+			point("other-1", "inbox-2", DirectionInbound),
+		}},
+	}
+	cases := map[string][]string{
+		"":                {"in-1", "out-1", "legacy-1"},
+		DirectionInbound:  {"in-1", "legacy-1"},
+		DirectionOutbound: {"out-1"},
+	}
+	for direction, want := range cases {
+		results, err := svc.searchVector(context.Background(), "inbox-1", "refund", 10, direction)
+		if err != nil {
+			t.Fatalf("search %q: %v", direction, err)
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, r.MessageID)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("direction %q: got %v, want %v", direction, got, want)
+		}
+	}
+}
+
+type fakeEmbeddingQueue struct {
+	jobs []queue.Job
+}
+
+func (f *fakeEmbeddingQueue) PushEmbeddingJob(ctx context.Context, job queue.Job) error {
+	f.jobs = append(f.jobs, job)
+	return nil
+}
+
+func TestEnqueueEmbeddingQueuesStoredSends(t *testing.T) {
+	q := &fakeEmbeddingQueue{}
+	svc := &Service{Embeddings: q}
+	ctx := context.Background()
+
+	svc.enqueueEmbedding(ctx, map[string]any{"message_id": "msg-1", "status": "sent"})
+	svc.enqueueEmbedding(store.WithDryRun(ctx), map[string]any{"message_id": "msg-2"})
+	svc.enqueueEmbedding(ctx, map[string]any{"status": "queued"})
+	svc.enqueueEmbedding(ctx, "msg-3")
+
+	if len(q.jobs) != 1 {
+		t.Fatalf("expected only the stored send queued, got %+v", q.jobs)
+	}
+	if job := q.jobs[0]; job.MessageID != "msg-1" || job.Origin != queue.OriginSend || job.TraceID == "" {
+		t.Fatalf("unexpected job %+v", job)
+	}
+}
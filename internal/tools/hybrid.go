@@ -0,0 +1,68 @@
+package tools
+
+import (
+	"context"
+	"sort"
+
+	"neuralmail/internal/store"
+)
+
+// rrfK damps reciprocal rank fusion so a hit both modes agree on outranks
+// one that only tops a single list; 60 is the usual choice.
+const rrfK = 60
+
+// searchHybrid runs vector and full-text search for up to topK hits each
+// and fuses them by reciprocal rank. Score is the fused score; each hit's
+// SourceScores keep what the modes that found it scored it.
+func (s *Service) searchHybrid(ctx context.Context, st *store.Store, inboxID, query string, topK int, direction string) ([]store.SearchResult, error) {
+	vectorHits, err := s.searchVector(ctx, inboxID, query, topK, direction)
+	if err != nil {
+		return nil, err
+	}
+	ftsHits, err := st.SearchInboxFTS(ctx, inboxID, query, topK, direction)
+	if err != nil {
+		return nil, err
+	}
+	return fuseRanks(topK, withSourceScores(vectorHits, RetrievalVector), withSourceScores(ftsHits, RetrievalFTS)), nil
+}
+
+// fuseRanks merges ranked hit lists by message, scoring each message
+// 1/(rrfK+rank) for every list it appears in, and keeps the best topK.
+func fuseRanks(topK int, lists ...[]store.SearchResult) []store.SearchResult {
+	fused := map[string]*store.SearchResult{}
+	var order []string
+	for _, hits := range lists {
+		for rank, hit := range hits {
+			merged, ok := fused[hit.MessageID]
+			if !ok {
+				merged = &store.SearchResult{MessageID: hit.MessageID, ThreadID: hit.ThreadID, Snippet: hit.Snippet, SourceScores: map[string]float64{}}
+				fused[hit.MessageID] = merged
+				order = append(order, hit.MessageID)
+			}
+			if merged.Snippet == "" {
+				merged.Snippet = hit.Snippet
+			}
+			for source, score := range hit.SourceScores {
+				if _, seen := merged.SourceScores[source]; seen {
+					continue
+				}
+				merged.SourceScores[source] = score
+				merged.Score += 1 / float64(rrfK+rank+1)
+			}
+		}
+	}
+	out := make([]store.SearchResult, 0, len(order))
+	for _, id := range order {
+		out = append(out, *fused[id])
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	return out[:min(topK, len(out))]
+}
+
+// withSourceScores records each hit's own score as the named mode's.
+func withSourceScores(hits []store.SearchResult, source string) []store.SearchResult {
+	for i := range hits {
+		hits[i].SourceScores = map[string]float64{source: hits[i].Score}
+	}
+	return hits
+}
@@ -0,0 +1,53 @@
+package tools
+
+import (
+	"testing"
+
+	"neuralmail/internal/store"
+	"neuralmail/internal/vector"
+)
+
+func TestFuseRanksPrefersHitsBothModesFound(t *testing.T) {
+	vector := withSourceScores([]store.SearchResult{
+		{MessageID: "m1", Score: 0.91},
+		{MessageID: "m2", Score: 0.85},
+		{MessageID: "m3", Score: 0.60},
+	}, RetrievalVector)
+	fts := withSourceScores([]store.SearchResult{
+		{MessageID: "m3", Score: 0.4, Snippet: "refund <b>policy</b>"},
+		{MessageID: "m4", Score: 0.2},
+	}, RetrievalFTS)
+
+	got := fuseRanks(3, vector, fts)
+	if len(got) != 3 {
+		t.Fatalf("expected top 3, got %d", len(got))
+	}
+	if got[0].MessageID != "m3" {
+		t.Fatalf("expected m3, found by both, first; got %+v", got)
+	}
+	if got[0].SourceScores[RetrievalVector] != 0.60 || got[0].SourceScores[RetrievalFTS] != 0.4 {
+		t.Fatalf("expected both source scores on m3, got %v", got[0].SourceScores)
+	}
+	if got[1].MessageID != "m1" || len(got[1].SourceScores) != 1 {
+		t.Fatalf("expected vector-only m1 second, got %+v", got[1])
+	}
+	if got[0].Score <= got[1].Score {
+		t.Fatalf("expected fused scores to be ordered, got %v then %v", got[0].Score, got[1].Score)
+	}
+}
+
+func TestMergeChunkHitsKeepsBestChunkPerMessage(t *testing.T) {
+	hits := []vector.SearchHit{
+		{Score: 0.9, Payload: map[string]any{"message_id": "m1", "thread_id": "t1", "snippet": "the refund clause"}},
+		{Score: 0.8, Payload: map[string]any{"message_id": "m2", "thread_id": "t2", "snippet": "shipping"}},
+		{Score: 0.7, Payload: map[string]any{"message_id": "m1", "thread_id": "t1", "snippet": "greeting"}},
+		{Score: 0.6, Payload: map[string]any{"message_id": "m3", "thread_id": "t3", "snippet": "invoice"}},
+	}
+	got := mergeChunkHits(hits, 2)
+	if len(got) != 2 || got[0].MessageID != "m1" || got[1].MessageID != "m2" {
+		t.Fatalf("expected m1 and m2 once each, got %+v", got)
+	}
+	if got[0].Snippet != "the refund clause" || got[0].Score != 0.9 {
+		t.Fatalf("expected m1's best chunk, got %+v", got[0])
+	}
+}
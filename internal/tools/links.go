@@ -0,0 +1,74 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"neuralmail/internal/policy"
+	"neuralmail/internal/store"
+)
+
+// policyForOrg is the deployment policy with the org's rules on top.
+// Self-hosted calls without an org use the file policy.
+func (s *Service) policyForOrg(ctx context.Context, st *store.Store, orgID string) (policy.Policy, error) {
+	return OrgPolicy(ctx, st, s.Current().Policy, orgID)
+}
+
+// OrgPolicy layers the org's link allow/deny rules and its own policy rules
+// on top of base. Without an org it returns base.
+func OrgPolicy(ctx context.Context, st *store.Store, base policy.Policy, orgID string) (policy.Policy, error) {
+	if orgID == "" {
+		return base, nil
+	}
+	p := base
+	rules, err := st.ListOrgLinkRules(ctx, orgID)
+	if err != nil {
+		return base, err
+	}
+	if len(rules) > 0 {
+		var allow, deny []string
+		for _, rule := range rules {
+			if rule.Action == "deny" {
+				deny = append(deny, rule.Domain)
+			} else {
+				allow = append(allow, rule.Domain)
+			}
+		}
+		p = p.WithOrgLinkRules(allow, deny)
+	}
+	orgPolicy, err := st.GetOrgPolicy(ctx, orgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, nil
+	}
+	if err != nil {
+		return base, err
+	}
+	var custom []policy.CustomRule
+	if err := json.Unmarshal(orgPolicy.Rules, &custom); err != nil {
+		return base, err
+	}
+	return p.WithOrgRules(orgPolicy.Version, custom), nil
+}
+
+// checkOutboundLinks re-validates URLs at send time, since the body passed to
+// send_reply or compose_email need not come from a policy-checked draft.
+func (s *Service) checkOutboundLinks(ctx context.Context, st *store.Store, orgID string, body string) error {
+	p, err := s.policyForOrg(ctx, st, orgID)
+	if err != nil {
+		return err
+	}
+	findings := policy.CheckLinks(body, p.Links)
+	if len(findings) == 0 {
+		return nil
+	}
+	if strings.EqualFold(p.Links.Mode, policy.LinkModeBlock) {
+		return errors.New("send blocked: disallowed link " + findings[0].URL + " (" + findings[0].Flag + ")")
+	}
+	if !s.Config.Security.AllowSendWithWarnings {
+		return errors.New("send blocked: needs human approval for link " + findings[0].URL + " (" + findings[0].Flag + ")")
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/llm"
+	"neuralmail/internal/store"
+)
+
+// PromptTasks maps each tool whose system prompt an org can replace with a
+// prompt template to the model task that prompt drives.
+var PromptTasks = map[string]string{
+	"triage_message":          llm.TaskClassify,
+	"extract_to_schema":       llm.TaskExtract,
+	"draft_reply_with_policy": llm.TaskDraft,
+	"translate_message":       llm.TaskTranslate,
+	"translate_thread":        llm.TaskTranslate,
+	"summarize_thread":        llm.TaskSummarize,
+}
+
+// WithPromptTemplate returns a context whose model calls for tool use the
+// caller's org's active prompt template, and that template's ref for the
+// tool call record. Tools without one keep ctx and the built-in prompt and
+// return an empty ref; a failed lookup does the same rather than fail the
+// call.
+func (s *Service) WithPromptTemplate(ctx context.Context, tool string) (context.Context, string) {
+	task, ok := PromptTasks[tool]
+	if s == nil || s.Store == nil || !ok {
+		return ctx, ""
+	}
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok || principal.OrgID == "" {
+		return ctx, ""
+	}
+	var tmpl store.PromptTemplate
+	err := s.inDirectory(ctx, nil, principal.OrgID, func(dir *store.Store) error {
+		var err error
+		tmpl, err = dir.GetActivePromptTemplate(ctx, principal.OrgID, tool)
+		return err
+	})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "prompt template lookup failed", "tool", tool, "err", err)
+		}
+		return ctx, ""
+	}
+	ctx = context.WithValue(ctx, promptRefKey{}, tmpl.Ref())
+	return llm.WithPrompt(ctx, task, tmpl.Body), tmpl.Ref()
+}
+
+type promptRefKey struct{}
+
+// promptVersion names the prompt model calls under ctx run with: the org's
+// template, or the deployment's prompt path.
+func (s *Service) promptVersion(ctx context.Context) string {
+	if ref, ok := ctx.Value(promptRefKey{}).(string); ok {
+		return ref
+	}
+	return s.Current().PromptPath
+}
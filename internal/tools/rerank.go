@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"neuralmail/internal/rerank"
+	"neuralmail/internal/store"
+)
+
+const searchDefaultTopK = 10
+
+// rerankSetting reports whether an org's searches are re-ranked and within
+// what latency budget. Org settings live in the directory store.
+func (s *Service) rerankSetting(ctx context.Context, orgID string) (bool, time.Duration, error) {
+	if s.Reranker == nil {
+		return false, 0, nil
+	}
+	budget := s.Config.Rerank.LatencyBudget
+	if orgID == "" {
+		return s.Config.Rerank.DefaultEnabled, budget, nil
+	}
+	setting, err := s.Store.GetOrgSearchRerank(ctx, orgID)
+	if err != nil {
+		return false, 0, err
+	}
+	if setting.LatencyBudget > 0 {
+		budget = setting.LatencyBudget
+	}
+	return setting.Enabled, budget, nil
+}
+
+// rerankHits re-scores candidate hits against the query and keeps the best
+// topK, with the re-ranker's score in place of the retrieval score. If
+// scoring fails or runs past budget the hits keep their retrieval order. The
+// returned summary goes out with the results; its units are metered on top
+// of the tool's cost.
+func (s *Service) rerankHits(ctx context.Context, query string, hits []store.SearchResult, topK int, budget time.Duration) ([]store.SearchResult, map[string]any) {
+	summary := map[string]any{
+		"applied":    false,
+		"provider":   s.Reranker.Name(),
+		"candidates": len(hits),
+	}
+	if len(hits) == 0 {
+		return hits, summary
+	}
+	docs := make([]string, len(hits))
+	for i, hit := range hits {
+		docs[i] = hit.Snippet
+	}
+
+	scoreCtx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+	start := time.Now()
+	scores, err := s.Reranker.Score(scoreCtx, query, docs)
+	summary["latency_ms"] = time.Since(start).Milliseconds()
+	if err != nil {
+		if errors.Is(scoreCtx.Err(), context.DeadlineExceeded) {
+			summary["skipped_reason"] = "latency_budget_exceeded"
+		} else {
+			slog.WarnContext(ctx, "search rerank failed", "provider", s.Reranker.Name(), "err", err)
+			summary["skipped_reason"] = "rerank_error"
+		}
+		return hits[:min(topK, len(hits))], summary
+	}
+
+	order := rerank.Order(scores)
+	out := make([]store.SearchResult, 0, min(topK, len(hits)))
+	for _, i := range order[:min(topK, len(order))] {
+		hit := hits[i]
+		hit.Score = scores[i]
+		out = append(out, hit)
+	}
+	summary["applied"] = true
+	summary["units"] = s.Config.Rerank.UnitCost
+	return out, summary
+}
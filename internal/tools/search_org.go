@@ -0,0 +1,134 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/store"
+)
+
+const (
+	orgSearchDefaultTopK = 10
+	orgSearchMaxTopK     = 100
+)
+
+// How merged org-wide results were ordered.
+const (
+	RankingScore = "score"
+	RankingRank  = "rank"
+)
+
+// OrgSearchHit is one search_org result, attributed to its inbox.
+type OrgSearchHit struct {
+	InboxID       string  `json:"inbox_id"`
+	InboxAddress  string  `json:"inbox_address"`
+	MessageID     string  `json:"message_id"`
+	ThreadID      string  `json:"thread_id"`
+	Score         float64 `json:"score"`
+	Snippet       string  `json:"snippet"`
+	RetrievalMode string  `json:"retrieval_mode"`
+	rank          int
+}
+
+// SearchOrg runs the search_inbox query over every active inbox of the
+// caller's org, or the subset in inboxIDs, and returns the best topK hits
+// overall. Each inbox is searched the way search_inbox would, so inboxes with
+// embedding disabled answer from full-text search.
+func (s *Service) SearchOrg(ctx context.Context, query string, topK int, direction string, inboxIDs []string) (any, error) {
+	if direction != "" && direction != DirectionInbound && direction != DirectionOutbound {
+		return nil, errors.New("direction must be inbound or outbound")
+	}
+	if topK <= 0 {
+		topK = orgSearchDefaultTopK
+	}
+	topK = min(topK, orgSearchMaxTopK)
+	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
+		inboxes, err := s.searchableInboxes(scopedCtx, st, principal, inboxIDs)
+		if err != nil {
+			return nil, err
+		}
+		var hits []OrgSearchHit
+		modes := map[string]bool{}
+		for _, inbox := range inboxes {
+			results, mode, err := s.searchInbox(scopedCtx, st, inbox.ID, query, topK, direction, RetrievalAuto)
+			if err != nil {
+				return nil, err
+			}
+			modes[mode] = true
+			for i, r := range results {
+				hits = append(hits, OrgSearchHit{
+					InboxID:       inbox.ID,
+					InboxAddress:  inbox.Address,
+					MessageID:     r.MessageID,
+					ThreadID:      r.ThreadID,
+					Score:         r.Score,
+					Snippet:       r.Snippet,
+					RetrievalMode: mode,
+					rank:          i + 1,
+				})
+			}
+		}
+		ranking := mergeOrgHits(hits, len(modes) > 1)
+		if len(hits) > topK {
+			hits = hits[:topK]
+		}
+		if hits == nil {
+			hits = []OrgSearchHit{}
+		}
+		return map[string]any{
+			"results":          hits,
+			"ranking":          ranking,
+			"inboxes_searched": len(inboxes),
+		}, nil
+	})
+}
+
+// searchableInboxes lists the org's active inboxes the principal may reach,
+// narrowed to inboxIDs when given. Asking for an inbox outside the org or
+// the principal's allowlist is an error, not a silent skip.
+func (s *Service) searchableInboxes(ctx context.Context, st *store.Store, principal auth.Principal, inboxIDs []string) ([]store.InboxRecord, error) {
+	var all []store.InboxRecord
+	var err error
+	if principal.OrgID == "" {
+		all, err = st.ListInboxRecords(ctx)
+	} else {
+		all, err = st.ListInboxRecordsByOrg(ctx, principal.OrgID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range inboxIDs {
+		if !slices.ContainsFunc(all, func(rec store.InboxRecord) bool { return rec.ID == id }) {
+			return nil, errors.New("inbox does not belong to org")
+		}
+		if !principal.CanAccessInbox(id) {
+			return nil, errInboxNotAllowed
+		}
+	}
+	inboxes := make([]store.InboxRecord, 0, len(all))
+	for _, rec := range all {
+		if rec.Status != "active" || !principal.CanAccessInbox(rec.ID) {
+			continue
+		}
+		if len(inboxIDs) > 0 && !slices.Contains(inboxIDs, rec.ID) {
+			continue
+		}
+		inboxes = append(inboxes, rec)
+	}
+	return inboxes, nil
+}
+
+// mergeOrgHits orders hits best first. Scores from one retrieval mode are
+// comparable across inboxes; vector and full-text scores are not, so a mixed
+// set interleaves the inboxes by their own ranking instead.
+func mergeOrgHits(hits []OrgSearchHit, mixed bool) string {
+	if !mixed {
+		sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+		return RankingScore
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].rank < hits[j].rank })
+	return RankingRank
+}
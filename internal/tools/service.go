@@ -6,21 +6,28 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net"
-	"net/smtp"
+	"log/slog"
 	"os"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/santhosh-tekuri/jsonschema/v5"
 
 	"neuralmail/internal/auth"
 	"neuralmail/internal/config"
 	"neuralmail/internal/embed"
+	"neuralmail/internal/integrations"
 	"neuralmail/internal/llm"
 	"neuralmail/internal/observability"
+	"neuralmail/internal/outbox"
 	"neuralmail/internal/policy"
+	"neuralmail/internal/rerank"
+	"neuralmail/internal/residency"
 	"neuralmail/internal/store"
+	"neuralmail/internal/threadctx"
 	"neuralmail/internal/vector"
 )
 
@@ -31,6 +38,31 @@ type Service struct {
 	Vector   vector.Store
 	Policy   policy.Policy
 	Embedder embed.Provider
+	// Residency, when set, sends each org's reads to its region's storage.
+	Residency *residency.Router
+	// Embeddings, when set, queues sent messages for embedding.
+	Embeddings EmbeddingQueue
+	// Reranker, when set, re-orders search_inbox hits for orgs that opt in.
+	Reranker rerank.Reranker
+	// Cache, when set, keeps triage and extraction responses for
+	// llm.cache.ttl.
+	Cache ResponseCache
+	// TokenLedger counts each org's model tokens for llm.budget.daily_tokens.
+	TokenLedger llm.TokenLedger
+	// CRM, when set, files triaged sales and support threads in the org's
+	// CRM and serves link_thread_to_crm and get_crm_context.
+	CRM *integrations.Bridge
+
+	reloaded atomic.Pointer[Reloadable]
+}
+
+// Reloadable are the settings a serving Service takes from Reload: the
+// policy drafts are checked against, the prompt version tool calls are
+// recorded with and the outbound domain allowlist.
+type Reloadable struct {
+	Policy                  policy.Policy
+	PromptPath              string
+	OutboundDomainAllowlist []string
 }
 
 type ToolContext struct {
@@ -42,16 +74,64 @@ func NewService(cfg config.Config, store *store.Store, llmProvider llm.Provider,
 	return &Service{Config: cfg, Store: store, LLM: llmProvider, Vector: vectorStore, Policy: policyObj, Embedder: embedder}
 }
 
+// Reload swaps in r for the settings the Service was built with; calls
+// already running finish with the old ones.
+func (s *Service) Reload(r Reloadable) {
+	s.reloaded.Store(&r)
+}
+
+// Current returns the reloadable settings in force.
+func (s *Service) Current() Reloadable {
+	if r := s.reloaded.Load(); r != nil {
+		return *r
+	}
+	return Reloadable{Policy: s.Policy, PromptPath: s.Config.LLM.PromptPath, OutboundDomainAllowlist: s.Config.Security.OutboundDomainAllowlist}
+}
+
+// config returns s.Config with the reloaded settings applied.
+func (s *Service) config() config.Config {
+	cfg := s.Config
+	if r := s.reloaded.Load(); r != nil {
+		cfg.LLM.PromptPath = r.PromptPath
+		cfg.Security.OutboundDomainAllowlist = r.OutboundDomainAllowlist
+	}
+	return cfg
+}
+
+// withScopedStore runs fn against the caller's org's store. Callers with a
+// principal get a store confined to their org by row-level security, in a
+// transaction that ends with fn, so a tool that skips an ownership check
+// still cannot read or write another org's rows.
 func (s *Service) withScopedStore(ctx context.Context, fn func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error)) (any, error) {
-	if !s.Config.Cloud.Mode {
+	// Outside cloud mode only playground sessions carry a principal; they
+	// are confined to their sandbox org like a cloud tenant.
+	principal, ok := auth.PrincipalFromContext(ctx)
+	ctx = s.withTokenBudget(ctx, principal.OrgID)
+	if !s.Config.Cloud.Mode && !ok {
 		return fn(ctx, s.Store, auth.Principal{})
 	}
-	principal, ok := auth.PrincipalFromContext(ctx)
 	if !ok {
 		return nil, errors.New("missing cloud principal")
 	}
+	st := s.Store
+	if s.Residency != nil {
+		backend, err := s.Residency.ForOrg(ctx, principal.OrgID)
+		if err != nil {
+			return nil, err
+		}
+		st = backend.Store
+	}
+	// The org's model routes are only looked up if the tool calls a model.
+	ctx = llm.WithRoutes(ctx, func() map[string][]string {
+		routes, err := s.Store.GetOrgLLMRoutes(ctx, principal.OrgID)
+		if err != nil {
+			slog.ErrorContext(ctx, "llm routes lookup failed", "err", err)
+			return nil
+		}
+		return routes.Merged()
+	})
 	var out any
-	err := s.Store.RunAsOrg(ctx, principal.OrgID, func(scoped *store.Store) error {
+	err := st.RunAsOrg(ctx, principal.OrgID, func(scoped *store.Store) error {
 		result, callErr := fn(ctx, scoped, principal)
 		out = result
 		return callErr
@@ -62,85 +142,269 @@ func (s *Service) withScopedStore(ctx context.Context, fn func(scopedCtx context
 	return out, nil
 }
 
-func (s *Service) ensureInboxBelongsToOrg(ctx context.Context, st *store.Store, orgID string, inboxID string) error {
-	if err := st.EnsureInboxBelongsToOrg(ctx, inboxID, orgID); err != nil {
+// inDirectory runs fn against the directory store, which holds org
+// settings and inbox aliases, confined to orgID like withScopedStore's
+// store. st, the tool's scoped store if it has one, is reused when there
+// is no separate directory.
+func (s *Service) inDirectory(ctx context.Context, st *store.Store, orgID string, fn func(dir *store.Store) error) error {
+	if s.Residency == nil && st != nil {
+		return fn(st)
+	}
+	if orgID == "" {
+		return fn(s.Store)
+	}
+	return s.Store.RunAsOrg(ctx, orgID, fn)
+}
+
+// withTokenBudget holds model calls under ctx to llm.budget, counting the
+// daily budget per org; calls without an org share one count.
+func (s *Service) withTokenBudget(ctx context.Context, orgID string) context.Context {
+	// A budget the caller set, such as the playground's shared one, stands.
+	if _, ok := llm.BudgetFrom(ctx); ok {
+		return ctx
+	}
+	limits := s.Config.LLM.Budget
+	if limits.PerCallTokens <= 0 && limits.DailyTokens <= 0 {
+		return ctx
+	}
+	if orgID == "" {
+		orgID = "local"
+	}
+	return llm.WithBudget(ctx, llm.Budget{
+		PerCall: limits.PerCallTokens,
+		Daily:   limits.DailyTokens,
+		Key:     orgID,
+		Ledger:  s.TokenLedger,
+	})
+}
+
+// errInboxNotAllowed is returned when a credential restricted to some of
+// the org's inboxes reaches for another.
+var errInboxNotAllowed = errors.New("inbox is not allowed for this credential")
+
+func (s *Service) ensureInboxBelongsToOrg(ctx context.Context, st *store.Store, principal auth.Principal, inboxID string) error {
+	if err := st.EnsureInboxBelongsToOrg(ctx, inboxID, principal.OrgID); err != nil {
 		if errors.Is(err, store.ErrOwnershipMismatch) {
 			return errors.New("inbox does not belong to org")
 		}
 		return err
 	}
+	if !principal.CanAccessInbox(inboxID) {
+		return errInboxNotAllowed
+	}
 	return nil
 }
 
-func (s *Service) ensureThreadBelongsToOrg(ctx context.Context, st *store.Store, orgID string, threadID string) error {
-	if err := st.EnsureThreadBelongsToOrg(ctx, threadID, orgID); err != nil {
+func (s *Service) ensureThreadBelongsToOrg(ctx context.Context, st *store.Store, principal auth.Principal, threadID string) error {
+	if err := st.EnsureThreadBelongsToOrg(ctx, threadID, principal.OrgID); err != nil {
 		if errors.Is(err, store.ErrOwnershipMismatch) {
 			return errors.New("thread does not belong to org")
 		}
 		return err
 	}
+	if len(principal.InboxIDs) == 0 {
+		return nil
+	}
+	inboxID, err := st.GetThreadInboxID(ctx, threadID)
+	if err != nil {
+		return err
+	}
+	if !principal.CanAccessInbox(inboxID) {
+		return errInboxNotAllowed
+	}
 	return nil
 }
 
-func (s *Service) ensureMessageBelongsToOrg(ctx context.Context, st *store.Store, orgID string, messageID string) error {
-	if err := st.EnsureMessageBelongsToOrg(ctx, messageID, orgID); err != nil {
+func (s *Service) ensureMessageBelongsToOrg(ctx context.Context, st *store.Store, principal auth.Principal, messageID string) error {
+	if err := st.EnsureMessageBelongsToOrg(ctx, messageID, principal.OrgID); err != nil {
 		if errors.Is(err, store.ErrOwnershipMismatch) {
 			return errors.New("message does not belong to org")
 		}
 		return err
 	}
+	if len(principal.InboxIDs) == 0 {
+		return nil
+	}
+	msg, err := st.GetMessage(ctx, messageID)
+	if err != nil {
+		return err
+	}
+	if !principal.CanAccessInbox(msg.InboxID) {
+		return errInboxNotAllowed
+	}
 	return nil
 }
 
-func (s *Service) ListThreads(ctx context.Context, inboxID string, status string, limit int) (any, error) {
+// Page sizes of list_threads and of get_thread's messages. A thread's
+// messages come a page at a time so that very long threads stay within a
+// response.
+const (
+	defaultThreadPageSize  = 50
+	defaultMessagePageSize = 100
+	maxMessagePageSize     = 500
+)
+
+// ListThreads lists a page of an inbox's threads, most recently updated
+// first. awaiting ("us" or "customer"), if set, keeps only threads waiting
+// on a reply from that side. A full page carries next_cursor, which cursor
+// takes to resume after it.
+func (s *Service) ListThreads(ctx context.Context, inboxID string, status string, awaiting string, cursor string, limit int) (any, error) {
+	if awaiting != "" && awaiting != store.AwaitingUs && awaiting != store.AwaitingCustomer {
+		return nil, errors.New("awaiting_reply must be us or customer")
+	}
+	if limit <= 0 {
+		limit = defaultThreadPageSize
+	}
 	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
 		if principal.OrgID != "" {
-			if err := s.ensureInboxBelongsToOrg(scopedCtx, st, principal.OrgID, inboxID); err != nil {
+			if err := s.ensureInboxBelongsToOrg(scopedCtx, st, principal, inboxID); err != nil {
 				return nil, err
 			}
 		}
-		threads, err := st.ListThreads(scopedCtx, inboxID, status, limit)
+		threads, err := st.ListThreads(scopedCtx, inboxID, status, awaiting, cursor, limit)
 		if err != nil {
 			return nil, err
 		}
-		return map[string]any{"threads": threads}, nil
+		result := map[string]any{"threads": threads}
+		if len(threads) == limit {
+			result["next_cursor"] = threads[len(threads)-1].Cursor()
+		}
+		return result, nil
 	})
 }
 
-func (s *Service) GetThread(ctx context.Context, threadID string) (any, error) {
+// GetThread returns a thread with a page of its messages, oldest first. A
+// full page carries next_cursor, which cursor takes to resume after it.
+func (s *Service) GetThread(ctx context.Context, threadID string, cursor string, limit int) (any, error) {
+	if limit <= 0 {
+		limit = defaultMessagePageSize
+	}
+	limit = min(limit, maxMessagePageSize)
 	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
 		if principal.OrgID != "" {
-			if err := s.ensureThreadBelongsToOrg(scopedCtx, st, principal.OrgID, threadID); err != nil {
+			if err := s.ensureThreadBelongsToOrg(scopedCtx, st, principal, threadID); err != nil {
 				return nil, err
 			}
 		}
-		thread, messages, err := st.GetThread(scopedCtx, threadID)
+		thread, messages, err := st.GetThreadPage(scopedCtx, threadID, cursor, limit)
 		if err != nil {
 			return nil, err
 		}
-		return map[string]any{"thread": thread, "messages": messages}, nil
+		result := map[string]any{"thread": thread, "messages": messages}
+		if len(messages) == limit {
+			result["next_cursor"] = messages[len(messages)-1].Cursor()
+		}
+		return result, nil
 	})
 }
 
-func (s *Service) SearchInbox(ctx context.Context, inboxID string, query string, topK int) (any, error) {
+// ListInboxIDs lists the inboxes the caller can reach: its org's, narrowed
+// to those its credential allows.
+func (s *Service) ListInboxIDs(ctx context.Context) (any, error) {
 	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
+		var (
+			ids []string
+			err error
+		)
 		if principal.OrgID != "" {
-			if err := s.ensureInboxBelongsToOrg(scopedCtx, st, principal.OrgID, inboxID); err != nil {
+			ids, err = st.ListInboxesByOrg(scopedCtx, principal.OrgID)
+		} else {
+			ids, err = st.ListInboxes(scopedCtx)
+		}
+		if err != nil {
+			return nil, err
+		}
+		ids = slices.DeleteFunc(ids, func(id string) bool { return !principal.CanAccessInbox(id) })
+		return map[string]any{"inbox_ids": ids}, nil
+	})
+}
+
+// GetMessage returns one message.
+func (s *Service) GetMessage(ctx context.Context, messageID string) (any, error) {
+	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
+		if principal.OrgID != "" {
+			if err := s.ensureMessageBelongsToOrg(scopedCtx, st, principal, messageID); err != nil {
+				return nil, err
+			}
+		}
+		msg, err := st.GetMessage(scopedCtx, messageID)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"message": msg}, nil
+	})
+}
+
+// SearchInbox searches an inbox's messages. direction ("inbound" or
+// "outbound") restricts results, e.g. to find how earlier questions were
+// answered; empty searches both.
+func (s *Service) SearchInbox(ctx context.Context, inboxID string, query string, topK int, direction string, mode string) (any, error) {
+	if direction != "" && direction != DirectionInbound && direction != DirectionOutbound {
+		return nil, errors.New("direction must be inbound or outbound")
+	}
+	switch mode {
+	case "", RetrievalAuto, RetrievalVector, RetrievalFTS, RetrievalHybrid:
+	default:
+		return nil, errors.New("mode must be auto, vector, fts or hybrid")
+	}
+	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
+		if principal.OrgID != "" {
+			if err := s.ensureInboxBelongsToOrg(scopedCtx, st, principal, inboxID); err != nil {
 				return nil, err
 			}
 		}
-		if s.Vector != nil && s.Embedder != nil {
-			return s.searchVector(scopedCtx, inboxID, query, topK)
+		if topK <= 0 {
+			topK = searchDefaultTopK
 		}
-		results, err := st.SearchInboxFTS(scopedCtx, inboxID, query, topK)
+		reranked, budget, err := s.rerankSetting(scopedCtx, principal.OrgID)
 		if err != nil {
 			return nil, err
 		}
-		return map[string]any{"results": results}, nil
+		candidates := topK
+		if reranked {
+			candidates = max(topK, s.Config.Rerank.Candidates)
+		}
+		results, answered, err := s.searchInbox(scopedCtx, st, inboxID, query, candidates, direction, mode)
+		if err != nil {
+			return nil, err
+		}
+		out := map[string]any{"retrieval_mode": answered}
+		if reranked {
+			results, out["rerank"] = s.rerankHits(scopedCtx, query, results, topK, budget)
+		}
+		out["results"] = results
+		return out, nil
 	})
 }
 
-func (s *Service) searchVector(ctx context.Context, inboxID, query string, topK int) (any, error) {
+// searchInbox answers in the requested retrieval mode and reports which one
+// answered. Auto uses the vector index unless the inbox has embedding
+// disabled or no vector store is configured; hybrid falls back to full-text
+// search in the same cases, while vector fails.
+func (s *Service) searchInbox(ctx context.Context, st *store.Store, inboxID, query string, topK int, direction string, mode string) ([]store.SearchResult, string, error) {
+	vectorAvailable := false
+	if mode != RetrievalFTS && s.Vector != nil && s.Embedder != nil {
+		disabled, err := s.embeddingDisabled(ctx, st, inboxID)
+		if err != nil {
+			return nil, "", err
+		}
+		vectorAvailable = !disabled
+	}
+	switch {
+	case mode == RetrievalVector && !vectorAvailable:
+		return nil, "", errors.New("vector search is not available for this inbox")
+	case mode == RetrievalHybrid && vectorAvailable:
+		results, err := s.searchHybrid(ctx, st, inboxID, query, topK, direction)
+		return results, RetrievalHybrid, err
+	case mode != RetrievalFTS && vectorAvailable:
+		results, err := s.searchVector(ctx, inboxID, query, topK, direction)
+		return results, RetrievalVector, err
+	}
+	results, err := st.SearchInboxFTS(ctx, inboxID, query, topK, direction)
+	return withSourceScores(results, RetrievalFTS), RetrievalFTS, err
+}
+
+func (s *Service) searchVector(ctx context.Context, inboxID, query string, topK int, direction string) ([]store.SearchResult, error) {
 	if s.Embedder == nil {
 		return nil, errors.New("embedding provider not configured")
 	}
@@ -154,26 +418,53 @@ func (s *Service) searchVector(ctx context.Context, inboxID, query string, topK
 			"match": map[string]any{"value": inboxID},
 		}},
 	}
-	hits, err := s.Vector.Search(ctx, vectors[0], topK, filter)
+	withDirection(filter, direction)
+	vectorStore := s.Vector
+	if s.Residency != nil {
+		backend, err := s.Residency.ForInbox(ctx, inboxID)
+		if err != nil {
+			return nil, err
+		}
+		vectorStore = backend.Vector
+	}
+	hits, err := vectorStore.Search(ctx, vectors[0], topK*chunkFanout, filter)
 	if err != nil {
 		return nil, err
 	}
-	results := make([]map[string]any, 0, len(hits))
+	return withSourceScores(mergeChunkHits(hits, topK), RetrievalVector), nil
+}
+
+// chunkFanout is how many chunk hits searchVector asks for per result, so
+// that topK messages remain after a long message's chunks are merged.
+const chunkFanout = 3
+
+// mergeChunkHits folds chunk hits, best first, into one result per message
+// with the score and text of its best-matching chunk.
+func mergeChunkHits(hits []vector.SearchHit, topK int) []store.SearchResult {
+	results := make([]store.SearchResult, 0, min(topK, len(hits)))
+	seen := map[string]bool{}
 	for _, hit := range hits {
-		results = append(results, map[string]any{
-			"message_id": hit.Payload["message_id"],
-			"thread_id":  hit.Payload["thread_id"],
-			"score":      hit.Score,
-			"snippet":    hit.Payload["snippet"],
-		})
+		messageID, _ := hit.Payload["message_id"].(string)
+		if seen[messageID] {
+			continue
+		}
+		if len(results) == topK {
+			break
+		}
+		seen[messageID] = true
+		threadID, _ := hit.Payload["thread_id"].(string)
+		snippet, _ := hit.Payload["snippet"].(string)
+		results = append(results, store.SearchResult{MessageID: messageID, ThreadID: threadID, Score: hit.Score, Snippet: snippet})
 	}
-	return map[string]any{"results": results}, nil
+	return results
 }
 
-func (s *Service) TriageMessage(ctx context.Context, messageID string) (any, error) {
+// TriageMessage classifies a message. The classification is cached per
+// message, model and prompt version; bypassCache asks the model again.
+func (s *Service) TriageMessage(ctx context.Context, messageID string, bypassCache bool) (any, error) {
 	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
 		if principal.OrgID != "" {
-			if err := s.ensureMessageBelongsToOrg(scopedCtx, st, principal.OrgID, messageID); err != nil {
+			if err := s.ensureMessageBelongsToOrg(scopedCtx, st, principal, messageID); err != nil {
 				return nil, err
 			}
 		}
@@ -181,25 +472,56 @@ func (s *Service) TriageMessage(ctx context.Context, messageID string) (any, err
 		if err != nil {
 			return nil, err
 		}
-		classification, err := s.LLM.Classify(scopedCtx, msg.Text, nil)
+		var classification llm.Classification
+		cached, err := s.cachedModelCall(scopedCtx, "triage_message", llm.TaskClassify, messageID, bypassCache, &classification, func() (bool, error) {
+			var err error
+			classification, err = s.LLM.Classify(scopedCtx, msg.Text, nil)
+			return true, err
+		})
 		if err != nil {
 			return nil, err
 		}
 		_ = st.UpdateThreadSignals(scopedCtx, msg.ThreadID, ptrFloat(classificationConfidenceToSentiment(classification.Sentiment)), classification.Urgency)
-		return map[string]any{
+		route := "support"
+		if msg.AliasAddress != "" {
+			// Aliases live in the directory, not the org's regional store.
+			var aliasRoute string
+			err := s.inDirectory(ctx, st, principal.OrgID, func(dir *store.Store) error {
+				var err error
+				aliasRoute, err = dir.InboxAliasRoute(ctx, msg.InboxID, msg.AliasAddress)
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+			if aliasRoute != "" {
+				route = aliasRoute
+			}
+		}
+		out := map[string]any{
 			"intent":          classification.Intent,
 			"urgency":         classification.Urgency,
 			"sentiment":       classification.Sentiment,
 			"confidence":      classification.Confidence,
-			"suggested_route": "support",
-		}, nil
+			"suggested_route": route,
+			"alias_address":   msg.AliasAddress,
+		}
+		if cached {
+			out["cached"] = true
+		}
+		if ticketID := s.syncCRMCase(scopedCtx, st, msg, classification.Intent, classification.Urgency); ticketID != "" {
+			out["crm_ticket_id"] = ticketID
+		}
+		return out, nil
 	})
 }
 
-func (s *Service) ExtractToSchema(ctx context.Context, messageID string, schemaID string) (any, error) {
+// ExtractToSchema extracts schemaID's fields from a message. Results that
+// pass the schema are cached like TriageMessage's.
+func (s *Service) ExtractToSchema(ctx context.Context, messageID string, schemaID string, bypassCache bool) (any, error) {
 	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
 		if principal.OrgID != "" {
-			if err := s.ensureMessageBelongsToOrg(scopedCtx, st, principal.OrgID, messageID); err != nil {
+			if err := s.ensureMessageBelongsToOrg(scopedCtx, st, principal, messageID); err != nil {
 				return nil, err
 			}
 		}
@@ -211,37 +533,62 @@ func (s *Service) ExtractToSchema(ctx context.Context, messageID string, schemaI
 		if err != nil {
 			return nil, err
 		}
-		result, err := s.LLM.Extract(scopedCtx, msg.Text, schema, nil)
-		if err != nil {
-			return nil, err
-		}
-		validated, validationErrors := validateJSON(schema, result.Data)
-		if !validated {
-			result.ValidationErrors = validationErrors
-			// One repair attempt
-			repair, err := s.LLM.Extract(scopedCtx, msg.Text, schema, nil)
-			if err == nil {
-				result = repair
-				validated, validationErrors = validateJSON(schema, result.Data)
-				if !validated {
-					result.ValidationErrors = validationErrors
-					result.Confidence = 0
+		var result llm.Extraction
+		inputs := []string{messageID, schemaID}
+		cached, err := s.cachedModelCall(scopedCtx, "extract_to_schema", llm.TaskExtract, inputs, bypassCache, &result, func() (bool, error) {
+			var err error
+			result, err = s.LLM.Extract(scopedCtx, msg.Text, schema, nil)
+			if err != nil {
+				return false, err
+			}
+			validated, validationErrors := validateJSON(schema, result.Data)
+			if !validated {
+				result.ValidationErrors = validationErrors
+				// One repair attempt
+				repair, err := s.LLM.Extract(scopedCtx, msg.Text, schema, nil)
+				if err == nil {
+					result = repair
+					validated, validationErrors = validateJSON(schema, result.Data)
+					if !validated {
+						result.ValidationErrors = validationErrors
+						result.Confidence = 0
+					}
 				}
 			}
+			// An invalid result is worth another try next time.
+			return validated, nil
+		})
+		if err != nil {
+			return nil, err
 		}
-		return map[string]any{
+		out := map[string]any{
 			"data":              result.Data,
 			"confidence":        result.Confidence,
 			"missing_fields":    result.MissingFields,
 			"validation_errors": result.ValidationErrors,
-		}, nil
+		}
+		if cached {
+			out["cached"] = true
+		}
+		return out, nil
 	})
 }
 
 func (s *Service) DraftReply(ctx context.Context, threadID string, goal string) (any, error) {
+	return s.DraftReplyWithKnowledge(ctx, threadID, goal, nil)
+}
+
+// DraftReplyWithKnowledge drafts a reply from the thread and the knowledge
+// base chunks the caller retrieved for it, which the draft may cite along
+// with the thread's messages.
+func (s *Service) DraftReplyWithKnowledge(ctx context.Context, threadID string, goal string, knowledge []KnowledgeChunk) (any, error) {
+	knowledgeText, chunkIDs, err := knowledgeContext(knowledge)
+	if err != nil {
+		return nil, err
+	}
 	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
 		if principal.OrgID != "" {
-			if err := s.ensureThreadBelongsToOrg(scopedCtx, st, principal.OrgID, threadID); err != nil {
+			if err := s.ensureThreadBelongsToOrg(scopedCtx, st, principal, threadID); err != nil {
 				return nil, err
 			}
 		}
@@ -249,41 +596,75 @@ func (s *Service) DraftReply(ctx context.Context, threadID string, goal string)
 		if err != nil {
 			return nil, err
 		}
-		contextText := buildThreadContext(thread, messages)
-		draft, err := s.LLM.Draft(scopedCtx, contextText, nil, goal)
+		activePolicy, err := s.policyForOrg(scopedCtx, st, principal.OrgID)
 		if err != nil {
 			return nil, err
 		}
-		adjusted, eval := policy.Evaluate(draft.Text, s.Policy)
-		if !eval.Allowed && eval.ViolationLevel == "critical" {
-			return map[string]any{
-				"draft":                "",
-				"risk_flags":           eval.RiskFlags,
-				"cited_message_ids":    nil,
-				"needs_human_approval": true,
-				"policy_blocked":       true,
-				"reason":               eval.Reason,
-			}, nil
+		packed, err := threadctx.New(scopedCtx, s.Config, s.LLM).Pack(scopedCtx, st, thread, messages)
+		if err != nil {
+			return nil, err
 		}
-		return map[string]any{
-			"draft":                adjusted,
-			"risk_flags":           eval.RiskFlags,
-			"cited_message_ids":    []string{lastMessageID(messages)},
-			"needs_human_approval": eval.NeedsApproval || draft.NeedsApproval,
-		}, nil
+		sources := draftSources{MessageIDs: packed.MessageIDs, ChunkIDs: chunkIDs}
+		draft, cited, retried, err := s.draftWithCitations(scopedCtx, packed.Text+knowledgeText, goal, sources, activePolicy)
+		if err != nil {
+			return nil, err
+		}
+		result, rev := evaluateDraft(draft.Text, activePolicy, draft.NeedsApproval, cited, sources, replyRecipients(messages))
+		coverage := 0.0
+		if cited, _ := result["cited_message_ids"].([]string); len(messages) > 0 {
+			coverage = float64(len(cited)) / float64(len(messages))
+		}
+		result["citation_coverage"] = coverage
+		result["citation_retried"] = retried
+		result["context"] = map[string]any{
+			"tokens":     packed.Tokens,
+			"budget":     packed.Budget,
+			"verbatim":   packed.Verbatim,
+			"summarized": packed.Summarized,
+			"omitted":    packed.Omitted,
+		}
+		draftID, err := st.CreateDraft(scopedCtx, threadID, goal, rev)
+		if err != nil {
+			return nil, err
+		}
+		if len(chunkIDs) > 0 {
+			if err := st.SetDraftSourceChunkIDs(scopedCtx, draftID, chunkIDs); err != nil {
+				return nil, err
+			}
+		}
+		result["draft_id"] = draftID
+		result["revision"] = 1
+		result["status"] = store.DraftStatusFor(rev)
+		return result, nil
 	})
 }
 
-func (s *Service) SendReply(ctx context.Context, threadID string, body string, needsApproval bool) (any, error) {
-	if needsApproval && !s.Config.Security.AllowSendWithWarnings {
+// SendReply replies on a thread. bodyOrDraftID is either the reply text or
+// the ID of a draft; a draft is only sent once approved, and then its approved
+// revision is what goes out.
+func (s *Service) SendReply(ctx context.Context, threadID string, bodyOrDraftID string, needsApproval bool) (any, error) {
+	draftID := ""
+	if _, err := uuid.Parse(strings.TrimSpace(bodyOrDraftID)); err == nil {
+		draftID = strings.TrimSpace(bodyOrDraftID)
+	}
+	if draftID == "" && needsApproval && !s.Config.Security.AllowSendWithWarnings {
 		return nil, errors.New("send blocked: needs human approval")
 	}
-	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
+	blocked := ""
+	out, err := s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
 		if principal.OrgID != "" {
-			if err := s.ensureThreadBelongsToOrg(scopedCtx, st, principal.OrgID, threadID); err != nil {
+			if err := s.ensureThreadBelongsToOrg(scopedCtx, st, principal, threadID); err != nil {
 				return nil, err
 			}
 		}
+		body := bodyOrDraftID
+		if draftID != "" {
+			approved, err := s.approvedDraftBody(scopedCtx, st, principal, draftID, threadID)
+			if err != nil {
+				return nil, err
+			}
+			body = approved
+		}
 		thread, messages, err := st.GetThread(scopedCtx, threadID)
 		if err != nil {
 			return nil, err
@@ -292,43 +673,75 @@ func (s *Service) SendReply(ctx context.Context, threadID string, body string, n
 		if len(messages) == 0 {
 			return nil, errors.New("no messages in thread")
 		}
-		from := s.Config.SMTP.From
-		if from == "" {
-			from = "dev@local.neuralmail"
+		if draftID == "" {
+			if blocked = autoReplyBlock(thread, messages); blocked != "" {
+				// Return without error so the counter is committed.
+				return nil, st.RecordSuppressedAutoReply(scopedCtx, thread.ID)
+			}
 		}
+		from := outbox.FromAddress(s.Config)
 		to := messages[len(messages)-1].From.Email
 		if to == "" {
 			return nil, errors.New("missing recipient")
 		}
-		if !s.Config.Security.AllowOutbound && !strings.HasSuffix(to, "@local.neuralmail") {
-			return nil, errors.New("outbound disabled for non-local domains")
+		if err := outbox.CheckRecipient(s.config(), to); err != nil {
+			return nil, err
+		}
+		if err := s.checkOutboundLinks(scopedCtx, st, principal.OrgID, body); err != nil {
+			return nil, err
 		}
-		if len(s.Config.Security.OutboundDomainAllowlist) > 0 && !domainAllowed(to, s.Config.Security.OutboundDomainAllowlist) {
-			return nil, errors.New("recipient domain not allowlisted")
+		if err := checkSuppressed(scopedCtx, st, inboxID, to); err != nil {
+			return nil, err
+		}
+		if err := outbox.CheckSendLimits(scopedCtx, s.Config, s.Store, st, principal.OrgID, from, 1); err != nil {
+			return nil, err
 		}
 		subject := "Re: " + thread.Subject
 		if subject == "Re: " {
 			subject = "Reply"
 		}
 		msg := store.Message{
-			InboxID:   inboxID,
-			Direction: "outbound",
-			Subject:   subject,
-			Text:      body,
-			CreatedAt: time.Now().UTC(),
-			From:      store.Participant{Email: from},
-			To:        []store.Participant{{Email: to}},
-		}
+			InboxID:           inboxID,
+			Direction:         "outbound",
+			Subject:           subject,
+			Text:              body,
+			CreatedAt:         time.Now().UTC(),
+			InternetMessageID: outbox.NewMessageID(from),
+			From:              store.Participant{Email: from},
+			To:                []store.Participant{{Email: to}},
+		}
+		msg.InReplyTo, msg.References = outbox.ReplyHeaders(messages[len(messages)-1])
 		msg.ThreadID = thread.ID
 		msgID, err := st.InsertMessage(scopedCtx, msg)
 		if err != nil {
 			return nil, err
 		}
-		if err := s.sendSMTP(from, to, subject, body); err != nil {
+		if draftID != "" {
+			sent, err := st.MarkDraftSent(scopedCtx, draftID, msgID)
+			if err != nil {
+				return nil, err
+			}
+			if !sent {
+				return nil, errors.New("send blocked: draft is no longer approved")
+			}
+		}
+		if _, err := st.EnqueueOutbox(scopedCtx, msgID, from, to, subject, body); err != nil {
 			return nil, err
 		}
-		return map[string]any{"message_id": msgID, "status": "queued"}, nil
+		result := map[string]any{"message_id": msgID, "status": store.DeliveryQueued}
+		if draftID != "" {
+			result["draft_id"] = draftID
+		}
+		return result, nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	if blocked != "" {
+		return nil, errors.New("send blocked: " + blocked)
+	}
+	s.enqueueEmbedding(ctx, out)
+	return out, nil
 }
 
 func (s *Service) ComposeEmail(ctx context.Context, inboxID, toAddress, subject, body string) (any, error) {
@@ -345,32 +758,36 @@ func (s *Service) ComposeEmail(ctx context.Context, inboxID, toAddress, subject,
 		return nil, errors.New("missing inbox_id")
 	}
 
-	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
+	out, err := s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
 		if principal.OrgID != "" {
-			if err := s.ensureInboxBelongsToOrg(scopedCtx, st, principal.OrgID, inboxID); err != nil {
+			if err := s.ensureInboxBelongsToOrg(scopedCtx, st, principal, inboxID); err != nil {
 				return nil, err
 			}
 		}
 
-		from := s.Config.SMTP.From
-		if from == "" {
-			from = "dev@local.neuralmail"
-		}
+		from := outbox.FromAddress(s.Config)
 
-		if !s.Config.Security.AllowOutbound && !strings.HasSuffix(toAddress, "@local.neuralmail") {
-			return nil, errors.New("outbound disabled for non-local domains")
+		if err := outbox.CheckRecipient(s.config(), toAddress); err != nil {
+			return nil, err
+		}
+		if err := s.checkOutboundLinks(scopedCtx, st, principal.OrgID, body); err != nil {
+			return nil, err
 		}
-		if len(s.Config.Security.OutboundDomainAllowlist) > 0 && !domainAllowed(toAddress, s.Config.Security.OutboundDomainAllowlist) {
-			return nil, errors.New("recipient domain not allowlisted")
+		if err := checkSuppressed(scopedCtx, st, inboxID, toAddress); err != nil {
+			return nil, err
+		}
+		if err := outbox.CheckSendLimits(scopedCtx, s.Config, s.Store, st, principal.OrgID, from, 1); err != nil {
+			return nil, err
 		}
 
 		msg := store.Message{
-			Direction: "outbound",
-			Subject:   subject,
-			Text:      body,
-			CreatedAt: time.Now().UTC(),
-			From:      store.Participant{Email: from},
-			To:        []store.Participant{{Email: toAddress}},
+			Direction:         "outbound",
+			Subject:           subject,
+			Text:              body,
+			CreatedAt:         time.Now().UTC(),
+			InternetMessageID: outbox.NewMessageID(from),
+			From:              store.Participant{Email: from},
+			To:                []store.Participant{{Email: toAddress}},
 		}
 
 		providerThreadID := fmt.Sprintf("compose-%d", time.Now().UnixNano())
@@ -379,99 +796,20 @@ func (s *Service) ComposeEmail(ctx context.Context, inboxID, toAddress, subject,
 			return nil, err
 		}
 
-		smtpErr := s.sendSMTP(from, toAddress, subject, body)
-		status := "sent"
-		result := map[string]any{
+		if _, err := st.EnqueueOutbox(scopedCtx, msgID, from, toAddress, subject, body); err != nil {
+			return nil, err
+		}
+		return map[string]any{
 			"thread_id":  threadID,
 			"message_id": msgID,
-		}
-		if smtpErr != nil {
-			status = "queued"
-			result["smtp_error"] = smtpErr.Error()
-		}
-		result["status"] = status
-		return result, nil
+			"status":     store.DeliveryQueued,
+		}, nil
 	})
-}
-
-func domainAllowed(addr string, allowlist []string) bool {
-	parts := strings.Split(addr, "@")
-	if len(parts) != 2 {
-		return false
-	}
-	domain := strings.ToLower(parts[1])
-	for _, allowed := range allowlist {
-		if strings.ToLower(strings.TrimSpace(allowed)) == domain {
-			return true
-		}
-	}
-	return false
-}
-
-func (s *Service) sendSMTP(from, to, subject, body string) error {
-	host := s.Config.SMTP.Host
-	if host == "" {
-		host = "localhost"
-	}
-	addr := fmt.Sprintf("%s:%d", host, s.Config.SMTP.Port)
-	msg := strings.Join([]string{
-		"From: " + from,
-		"To: " + to,
-		"Subject: " + subject,
-		"",
-		body,
-	}, "\r\n")
-	helo := smtpHeloDomain(from)
-	conn, err := net.Dial("tcp", addr)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-	client, err := smtp.NewClient(conn, host)
 	if err != nil {
-		return err
-	}
-	defer client.Quit()
-	if err := client.Hello(helo); err != nil {
-		return err
-	}
-	if (s.Config.SMTP.Username != "" || s.Config.SMTP.Password != "") && supportsAuth(client) {
-		auth := smtp.PlainAuth("", s.Config.SMTP.Username, s.Config.SMTP.Password, host)
-		if err := client.Auth(auth); err != nil {
-			return err
-		}
-	}
-	if err := client.Mail(from); err != nil {
-		return err
-	}
-	if err := client.Rcpt(to); err != nil {
-		return err
-	}
-	writer, err := client.Data()
-	if err != nil {
-		return err
-	}
-	if _, err := writer.Write([]byte(msg)); err != nil {
-		_ = writer.Close()
-		return err
-	}
-	if err := writer.Close(); err != nil {
-		return err
-	}
-	return client.Quit()
-}
-
-func smtpHeloDomain(addr string) string {
-	parts := strings.Split(addr, "@")
-	if len(parts) == 2 && parts[1] != "" {
-		return parts[1]
+		return nil, err
 	}
-	return "local.neuralmail"
-}
-
-func supportsAuth(client *smtp.Client) bool {
-	ok, _ := client.Extension("AUTH")
-	return ok
+	s.enqueueEmbedding(ctx, out)
+	return out, nil
 }
 
 func LoadSchema(schemaID string) (map[string]any, error) {
@@ -509,14 +847,6 @@ func validateJSON(schema map[string]any, data map[string]any) (bool, []string) {
 	return true, nil
 }
 
-func buildThreadContext(thread store.Thread, messages []store.Message) string {
-	contextText := fmt.Sprintf("Thread: %s\n", thread.Subject)
-	for _, msg := range messages {
-		contextText += fmt.Sprintf("[%s] %s\n", msg.Direction, msg.Text)
-	}
-	return contextText
-}
-
 func lastMessageID(messages []store.Message) string {
 	if len(messages) == 0 {
 		return ""
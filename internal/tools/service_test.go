@@ -0,0 +1,67 @@
+package tools
+
+import (
+	"context"
+	"testing"
+
+	"neuralmail/internal/config"
+	"neuralmail/internal/llm"
+	"neuralmail/internal/outbox"
+	"neuralmail/internal/policy"
+)
+
+// In cloud mode a call without a principal never reaches the store, which
+// is nil here.
+func TestCloudModeToolsRequirePrincipal(t *testing.T) {
+	cfg := config.Default()
+	cfg.Cloud.Mode = true
+	svc := &Service{Config: cfg}
+	ctx := context.Background()
+
+	calls := map[string]func() (any, error){
+		"ListInboxIDs": func() (any, error) { return svc.ListInboxIDs(ctx) },
+		"GetMessage":   func() (any, error) { return svc.GetMessage(ctx, "msg-1") },
+		"GetThread":    func() (any, error) { return svc.GetThread(ctx, "thread-1", "", 0) },
+	}
+	for name, call := range calls {
+		if _, err := call(); err == nil || err.Error() != "missing cloud principal" {
+			t.Errorf("%s: err = %v, want missing cloud principal", name, err)
+		}
+	}
+}
+
+func TestReloadSwapsPolicyAndAllowlist(t *testing.T) {
+	cfg := config.Default()
+	cfg.Security.AllowOutbound = true
+	cfg.Security.OutboundDomainAllowlist = []string{"example.com"}
+	svc := NewService(cfg, nil, nil, nil, policy.Policy{ID: "v1"}, nil)
+	ctx := context.Background()
+
+	if got, _ := svc.policyForOrg(ctx, nil, ""); got.ID != "v1" || svc.promptVersion(ctx) != cfg.LLM.PromptPath {
+		t.Fatalf("expected the built settings before a reload, got %q", got.ID)
+	}
+	svc.Reload(Reloadable{Policy: policy.Policy{ID: "v2"}, PromptPath: "configs/prompts/v2", OutboundDomainAllowlist: []string{"example.org"}})
+	if got, _ := svc.policyForOrg(ctx, nil, ""); got.ID != "v2" || svc.promptVersion(ctx) != "configs/prompts/v2" {
+		t.Fatalf("expected the reloaded policy and prompt path, got %q", got.ID)
+	}
+	if err := outbox.CheckRecipient(svc.config(), "ann@example.com"); err == nil {
+		t.Fatalf("expected the old allowlist to be replaced")
+	}
+	if err := outbox.CheckRecipient(svc.config(), "ann@example.org"); err != nil {
+		t.Fatalf("expected the reloaded allowlist to admit example.org: %v", err)
+	}
+}
+
+func TestTokenBudgetKeepsOneTheCallerSet(t *testing.T) {
+	cfg := config.Default()
+	cfg.LLM.Budget.DailyTokens = 1000
+	svc := &Service{Config: cfg}
+
+	if b, ok := llm.BudgetFrom(svc.withTokenBudget(context.Background(), "org-1")); !ok || b.Key != "org-1" || b.Daily != 1000 {
+		t.Fatalf("expected the org's budget, got %+v", b)
+	}
+	shared := llm.WithBudget(context.Background(), llm.Budget{Daily: 50, Key: "playground:org-sandbox"})
+	if b, _ := llm.BudgetFrom(svc.withTokenBudget(shared, "org-sandbox")); b.Key != "playground:org-sandbox" || b.Daily != 50 {
+		t.Fatalf("expected the playground's budget kept, got %+v", b)
+	}
+}
@@ -0,0 +1,123 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/llm"
+	"neuralmail/internal/store"
+	"neuralmail/internal/threadctx"
+)
+
+// SummarizeThread returns the thread's participants, ask, commitments, open
+// questions and next action. The summary is kept on the thread and served
+// from there until a message arrives after it; refresh summarizes anyway.
+func (s *Service) SummarizeThread(ctx context.Context, threadID string, refresh bool) (any, error) {
+	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
+		if principal.OrgID != "" {
+			if err := s.ensureThreadBelongsToOrg(scopedCtx, st, principal, threadID); err != nil {
+				return nil, err
+			}
+		}
+		thread, messages, err := st.GetThread(scopedCtx, threadID)
+		if err != nil {
+			return nil, err
+		}
+		if !refresh {
+			stored, err := st.GetThreadSummary(scopedCtx, thread.ID)
+			switch {
+			case err == nil && !stored.Stale(messages):
+				var summary llm.ThreadSummary
+				if err := json.Unmarshal(stored.Summary, &summary); err == nil {
+					return threadSummaryResult(stored, summary, true), nil
+				}
+			case err != nil && !errors.Is(err, sql.ErrNoRows):
+				return nil, err
+			}
+		}
+
+		if s.LLM == nil {
+			return nil, errors.New("llm provider not configured")
+		}
+		packed, err := threadctx.New(scopedCtx, s.Config, s.LLM).Pack(scopedCtx, st, thread, messages)
+		if err != nil {
+			return nil, err
+		}
+		var summary llm.ThreadSummary
+		if summarizer, ok := s.LLM.(llm.ThreadSummarizer); ok {
+			summary, err = summarizer.SummarizeThread(scopedCtx, packed.Text)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			summary = llm.HeuristicThreadSummary(packed.Text)
+		}
+		if len(summary.Participants) == 0 {
+			summary.Participants = threadParticipants(thread, messages)
+		}
+
+		raw, err := json.Marshal(summary)
+		if err != nil {
+			return nil, err
+		}
+		provider, model := llm.TaskModel(scopedCtx, s.LLM, llm.TaskSummarize)
+		stored := store.ThreadSummary{
+			ThreadID:     thread.ID,
+			Summary:      raw,
+			Model:        provider + ":" + model,
+			MessageID:    lastMessageID(messages),
+			MessageCount: len(messages),
+		}
+		stored.SummarizedAt, err = st.SetThreadSummary(scopedCtx, stored)
+		if err != nil {
+			slog.WarnContext(scopedCtx, "thread summary not stored", "thread_id", thread.ID, "err", err)
+		}
+		return threadSummaryResult(stored, summary, false), nil
+	})
+}
+
+// threadParticipants lists the thread's addresses in the order they first
+// appear, for summaries whose model named none.
+func threadParticipants(thread store.Thread, messages []store.Message) []string {
+	var out []string
+	seen := map[string]bool{}
+	add := func(email string) {
+		if email != "" && !seen[email] {
+			seen[email] = true
+			out = append(out, email)
+		}
+	}
+	for _, msg := range messages {
+		add(msg.From.Email)
+	}
+	for _, p := range thread.Participants {
+		add(p.Email)
+	}
+	return out
+}
+
+func threadSummaryResult(stored store.ThreadSummary, summary llm.ThreadSummary, cached bool) map[string]any {
+	return map[string]any{
+		"thread_id":      stored.ThreadID,
+		"participants":   nonNil(summary.Participants),
+		"ask":            summary.Ask,
+		"commitments":    nonNil(summary.Commitments),
+		"open_questions": nonNil(summary.OpenQuestions),
+		"next_action":    summary.NextAction,
+		"model":          stored.Model,
+		"message_count":  stored.MessageCount,
+		"summarized_at":  stored.SummarizedAt,
+		"cached":         cached,
+	}
+}
+
+func nonNil(items []string) []string {
+	if items == nil {
+		return []string{}
+	}
+	return items
+}
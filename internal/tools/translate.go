@@ -0,0 +1,147 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/llm"
+	"neuralmail/internal/store"
+)
+
+var languageTagPattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+func (s *Service) TranslateMessage(ctx context.Context, messageID string, targetLanguage string) (any, error) {
+	target, err := normalizeLanguageTag(targetLanguage)
+	if err != nil {
+		return nil, err
+	}
+	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
+		if principal.OrgID != "" {
+			if err := s.ensureMessageBelongsToOrg(scopedCtx, st, principal, messageID); err != nil {
+				return nil, err
+			}
+		}
+		msg, err := st.GetMessage(scopedCtx, messageID)
+		if err != nil {
+			return nil, err
+		}
+		return s.translateMessage(scopedCtx, st, msg, target)
+	})
+}
+
+func (s *Service) TranslateThread(ctx context.Context, threadID string, targetLanguage string) (any, error) {
+	target, err := normalizeLanguageTag(targetLanguage)
+	if err != nil {
+		return nil, err
+	}
+	return s.withScopedStore(ctx, func(scopedCtx context.Context, st *store.Store, principal auth.Principal) (any, error) {
+		if principal.OrgID != "" {
+			if err := s.ensureThreadBelongsToOrg(scopedCtx, st, principal, threadID); err != nil {
+				return nil, err
+			}
+		}
+		thread, messages, err := st.GetThread(scopedCtx, threadID)
+		if err != nil {
+			return nil, err
+		}
+		translated := make([]map[string]any, 0, len(messages))
+		cacheHits := 0
+		for _, msg := range messages {
+			item, err := s.translateMessage(scopedCtx, st, msg, target)
+			if err != nil {
+				return nil, err
+			}
+			if item["cached"] == true {
+				cacheHits++
+			}
+			translated = append(translated, item)
+		}
+		return map[string]any{
+			"thread_id":       thread.ID,
+			"subject":         thread.Subject,
+			"target_language": target,
+			"messages":        translated,
+			"cache_hits":      cacheHits,
+		}, nil
+	})
+}
+
+// translateMessage serves from message_translations when possible and only
+// calls the LLM on a miss. A message an earlier translation found to be in
+// the target language already is returned as it is, without a model call.
+// Cache writes are best effort.
+func (s *Service) translateMessage(ctx context.Context, st *store.Store, msg store.Message, target string) (map[string]any, error) {
+	if s.LLM == nil {
+		return nil, errors.New("llm provider not configured")
+	}
+	provider, model := llm.TaskModel(ctx, s.LLM, llm.TaskTranslate)
+
+	cached, err := st.GetMessageTranslation(ctx, msg.ID, target, provider, model)
+	switch {
+	case err == nil:
+		return translationResult(msg, cached, true), nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+	source, err := st.GetMessageSourceLanguage(ctx, msg.ID)
+	if err != nil {
+		return nil, err
+	}
+	if sameLanguage(source, target) {
+		result := translationResult(msg, store.MessageTranslation{TargetLanguage: target, SourceLanguage: source, Text: msg.Text}, false)
+		result["skipped"] = true
+		return result, nil
+	}
+
+	translation, err := s.LLM.Translate(ctx, msg.Text, target)
+	if err != nil {
+		return nil, err
+	}
+	record := store.MessageTranslation{
+		MessageID:      msg.ID,
+		TargetLanguage: target,
+		SourceLanguage: translation.SourceLanguage,
+		Provider:       provider,
+		Model:          model,
+		Text:           translation.Text,
+	}
+	_ = st.UpsertMessageTranslation(ctx, record)
+	return translationResult(msg, record, false), nil
+}
+
+func translationResult(msg store.Message, t store.MessageTranslation, cached bool) map[string]any {
+	return map[string]any{
+		"message_id":      msg.ID,
+		"thread_id":       msg.ThreadID,
+		"direction":       msg.Direction,
+		"source_language": t.SourceLanguage,
+		"target_language": t.TargetLanguage,
+		"translated_text": t.Text,
+		"cached":          cached,
+	}
+}
+
+// sameLanguage compares two language tags by their primary subtag, so "en"
+// and "en-gb" match.
+func sameLanguage(a, b string) bool {
+	primary := func(tag string) string {
+		tag, _, _ = strings.Cut(strings.ToLower(strings.ReplaceAll(tag, "_", "-")), "-")
+		return tag
+	}
+	return a != "" && primary(a) == primary(b)
+}
+
+func normalizeLanguageTag(raw string) (string, error) {
+	tag := strings.ToLower(strings.TrimSpace(strings.ReplaceAll(raw, "_", "-")))
+	if tag == "" {
+		return "", errors.New("missing target_language")
+	}
+	if !languageTagPattern.MatchString(tag) {
+		return "", errors.New("invalid target_language")
+	}
+	return tag, nil
+}
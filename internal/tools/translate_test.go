@@ -0,0 +1,124 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"neuralmail/internal/auth"
+	"neuralmail/internal/config"
+	"neuralmail/internal/llm"
+	"neuralmail/internal/store"
+)
+
+// countingTranslator detects Spanish by its greeting and counts the
+// translations it is asked for.
+type countingTranslator struct {
+	*llm.Noop
+	calls int
+}
+
+func (c *countingTranslator) Translate(_ context.Context, text string, target string) (llm.Translation, error) {
+	c.calls++
+	source := "en"
+	if strings.HasPrefix(text, "Hola") {
+		source = "es"
+	}
+	return llm.Translation{Text: "[" + target + "] " + text, SourceLanguage: source, TargetLanguage: target}, nil
+}
+
+func seedTranslatableThread(t *testing.T, ctx context.Context, st *store.Store, inboxID string) (string, []string) {
+	t.Helper()
+	threadID, err := st.EnsureThread(ctx, inboxID, "thread-1", "Pedido", nil)
+	if err != nil {
+		t.Fatalf("create thread: %v", err)
+	}
+	var ids []string
+	for i, text := range []string{"Hola, ¿dónde está mi pedido?", "Hola de nuevo, sigo esperando."} {
+		id, err := st.InsertMessage(ctx, store.Message{InboxID: inboxID, ThreadID: threadID, Direction: "inbound", ProviderMessageID: fmt.Sprintf("m-%d", i+1), Text: text})
+		if err != nil {
+			t.Fatalf("insert message: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	return threadID, ids
+}
+
+func TestTranslateMessageCachesAndSkipsTheTargetLanguage(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		_, inboxID := seedToolsInbox(t, ctx, st, "acme")
+		_, ids := seedTranslatableThread(t, ctx, st, inboxID)
+		model := &countingTranslator{Noop: llm.NewNoop()}
+		svc := &Service{Config: config.Default(), Store: st, LLM: model}
+
+		translate := func(target string) map[string]any {
+			t.Helper()
+			out, err := svc.TranslateMessage(ctx, ids[0], target)
+			if err != nil {
+				t.Fatalf("translate to %s: %v", target, err)
+			}
+			return out.(map[string]any)
+		}
+
+		if got := translate("EN"); got["cached"] != false || got["translated_text"] != "[en] Hola, ¿dónde está mi pedido?" || got["source_language"] != "es" || model.calls != 1 {
+			t.Fatalf("expected the model to translate, got %v after %d calls", got, model.calls)
+		}
+		if got := translate("en"); got["cached"] != true || got["translated_text"] != "[en] Hola, ¿dónde está mi pedido?" || model.calls != 1 {
+			t.Fatalf("expected a cache hit, got %v after %d calls", got, model.calls)
+		}
+		// The first translation found the message to be Spanish.
+		for _, target := range []string{"es", "es-MX"} {
+			if got := translate(target); got["skipped"] != true || got["translated_text"] != "Hola, ¿dónde está mi pedido?" || model.calls != 1 {
+				t.Fatalf("expected %s to be skipped, got %v after %d calls", target, got, model.calls)
+			}
+		}
+		// Nothing is known of the second message's language yet.
+		if _, err := svc.TranslateMessage(ctx, ids[1], "es"); err != nil || model.calls != 2 {
+			t.Fatalf("expected the model to be asked, got %v after %d calls", err, model.calls)
+		}
+	})
+}
+
+func TestTranslateThreadCountsCacheHits(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		_, inboxID := seedToolsInbox(t, ctx, st, "acme")
+		threadID, _ := seedTranslatableThread(t, ctx, st, inboxID)
+		model := &countingTranslator{Noop: llm.NewNoop()}
+		svc := &Service{Config: config.Default(), Store: st, LLM: model}
+
+		for i, wantHits := range []int{0, 2} {
+			out, err := svc.TranslateThread(ctx, threadID, "en")
+			if err != nil {
+				t.Fatalf("translate thread: %v", err)
+			}
+			got := out.(map[string]any)
+			if got["cache_hits"] != wantHits || len(got["messages"].([]map[string]any)) != 2 || model.calls != 2 {
+				t.Fatalf("pass %d: expected %d cache hits, got %v after %d calls", i+1, wantHits, got["cache_hits"], model.calls)
+			}
+		}
+	})
+}
+
+func TestTranslateToolsAreScopedToTheOrg(t *testing.T) {
+	withTempStore(t, func(ctx context.Context, st *store.Store) {
+		orgID, _ := seedToolsInbox(t, ctx, st, "acme")
+		_, otherInbox := seedToolsInbox(t, ctx, st, "globex")
+		threadID, ids := seedTranslatableThread(t, ctx, st, otherInbox)
+		cfg := config.Default()
+		cfg.Cloud.Mode = true
+		model := &countingTranslator{Noop: llm.NewNoop()}
+		svc := &Service{Config: cfg, Store: st, LLM: model}
+		principalCtx := auth.WithPrincipal(ctx, auth.Principal{OrgID: orgID})
+
+		if _, err := svc.TranslateMessage(principalCtx, ids[0], "en"); err == nil || err.Error() != "message does not belong to org" {
+			t.Fatalf("expected another org's message to be refused, got %v", err)
+		}
+		if _, err := svc.TranslateThread(principalCtx, threadID, "en"); err == nil || err.Error() != "thread does not belong to org" {
+			t.Fatalf("expected another org's thread to be refused, got %v", err)
+		}
+		if model.calls != 0 {
+			t.Fatalf("expected no model calls, got %d", model.calls)
+		}
+	})
+}
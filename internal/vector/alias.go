@@ -0,0 +1,162 @@
+package vector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// WithCollection returns a client for another collection on the same
+// server.
+func (q *Qdrant) WithCollection(name string) *Qdrant {
+	return &Qdrant{BaseURL: q.BaseURL, Collection: name, Client: q.Client}
+}
+
+// CollectionExists reports whether the client's collection, or an alias of
+// that name, exists.
+func (q *Qdrant) CollectionExists(ctx context.Context) (bool, error) {
+	resp, err := q.do(ctx, http.MethodGet, "/collections/"+q.Collection, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return true, nil
+	}
+	return false, fmt.Errorf("qdrant collection lookup failed: %s", resp.Status)
+}
+
+// ErrNoCollection is returned for a collection that does not exist.
+var ErrNoCollection = errors.New("qdrant collection not found")
+
+// VectorSize returns the dimension of the client's collection's vectors.
+func (q *Qdrant) VectorSize(ctx context.Context) (int, error) {
+	resp, err := q.do(ctx, http.MethodGet, "/collections/"+q.Collection, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return 0, ErrNoCollection
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return 0, fmt.Errorf("qdrant collection lookup failed: %s", resp.Status)
+	}
+	var body struct {
+		Result struct {
+			Config struct {
+				Params struct {
+					Vectors struct {
+						Size int `json:"size"`
+					} `json:"vectors"`
+				} `json:"params"`
+			} `json:"config"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, err
+	}
+	if body.Result.Config.Params.Vectors.Size == 0 {
+		return 0, errors.New("qdrant collection has no unnamed vector")
+	}
+	return body.Result.Config.Params.Vectors.Size, nil
+}
+
+// AliasTarget returns the collection alias points at; ok is false when
+// there is no such alias.
+func (q *Qdrant) AliasTarget(ctx context.Context, alias string) (string, bool, error) {
+	resp, err := q.do(ctx, http.MethodGet, "/aliases", nil)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", false, fmt.Errorf("qdrant alias lookup failed: %s", resp.Status)
+	}
+	var decoded struct {
+		Result struct {
+			Aliases []struct {
+				AliasName      string `json:"alias_name"`
+				CollectionName string `json:"collection_name"`
+			} `json:"aliases"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return "", false, err
+	}
+	for _, a := range decoded.Result.Aliases {
+		if a.AliasName == alias {
+			return a.CollectionName, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// PointAlias makes the client's collection name an alias of collection,
+// moving it from wherever it pointed in one step. A real collection still
+// holding the name, as before the first re-index, is dropped first, so
+// searches miss until the alias exists.
+func (q *Qdrant) PointAlias(ctx context.Context, collection string) error {
+	_, aliased, err := q.AliasTarget(ctx, q.Collection)
+	if err != nil {
+		return err
+	}
+	var actions []map[string]any
+	if aliased {
+		actions = append(actions, map[string]any{"delete_alias": map[string]any{"alias_name": q.Collection}})
+	} else if exists, err := q.CollectionExists(ctx); err != nil {
+		return err
+	} else if exists {
+		if err := q.DeleteCollection(ctx); err != nil {
+			return err
+		}
+	}
+	actions = append(actions, map[string]any{"create_alias": map[string]any{
+		"collection_name": collection,
+		"alias_name":      q.Collection,
+	}})
+	resp, err := q.do(ctx, http.MethodPost, "/collections/aliases", map[string]any{"actions": actions})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("qdrant alias update failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// DeleteCollection drops the client's collection.
+func (q *Qdrant) DeleteCollection(ctx context.Context) error {
+	resp, err := q.do(ctx, http.MethodDelete, "/collections/"+q.Collection, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("qdrant collection delete failed: %s", resp.Status)
+	}
+	return nil
+}
+
+func (q *Qdrant) do(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	if q.BaseURL == "" {
+		return nil, errors.New("qdrant url not configured")
+	}
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, q.BaseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return q.Client.Do(req)
+}
@@ -0,0 +1,95 @@
+package vector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPointAliasReplacesTheOriginalCollection(t *testing.T) {
+	var calls []string
+	var actions []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		switch r.Method + " " + r.URL.Path {
+		case "GET /aliases":
+			_, _ = w.Write([]byte(`{"result":{"aliases":[]}}`))
+		case "GET /collections/messages":
+			_, _ = w.Write([]byte(`{"result":{}}`))
+		case "DELETE /collections/messages":
+			_, _ = w.Write([]byte(`{"result":true}`))
+		case "POST /collections/aliases":
+			var body struct {
+				Actions []map[string]any `json:"actions"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			actions = body.Actions
+			_, _ = w.Write([]byte(`{"result":true}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	q := NewQdrant(srv.URL, "messages")
+	if err := q.PointAlias(context.Background(), "messages_20261015120000"); err != nil {
+		t.Fatalf("point alias: %v", err)
+	}
+	if len(calls) != 4 || calls[2] != "DELETE /collections/messages" {
+		t.Fatalf("expected the original collection to be dropped before aliasing, got %v", calls)
+	}
+	if len(actions) != 1 || actions[0]["create_alias"] == nil {
+		t.Fatalf("expected a single create_alias action, got %v", actions)
+	}
+}
+
+func TestPointAliasMovesAnExistingAlias(t *testing.T) {
+	var actions []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /aliases":
+			_, _ = w.Write([]byte(`{"result":{"aliases":[{"alias_name":"messages","collection_name":"messages_old"}]}}`))
+		case "POST /collections/aliases":
+			var body struct {
+				Actions []map[string]any `json:"actions"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			actions = body.Actions
+			_, _ = w.Write([]byte(`{"result":true}`))
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	if err := NewQdrant(srv.URL, "messages").PointAlias(context.Background(), "messages_new"); err != nil {
+		t.Fatalf("point alias: %v", err)
+	}
+	if len(actions) != 2 || actions[0]["delete_alias"] == nil || actions[1]["create_alias"] == nil {
+		t.Fatalf("expected delete then create in one request, got %v", actions)
+	}
+}
+
+func TestVectorSizeReadsTheCollectionConfig(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/collections/messages":
+			_, _ = w.Write([]byte(`{"result":{"status":"green","config":{"params":{"vectors":{"size":768,"distance":"Cosine"}}}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	if size, err := NewQdrant(srv.URL, "messages").VectorSize(ctx); err != nil || size != 768 {
+		t.Fatalf("expected 768, got %d %v", size, err)
+	}
+	if _, err := NewQdrant(srv.URL, "missing").VectorSize(ctx); !errors.Is(err, ErrNoCollection) {
+		t.Fatalf("expected ErrNoCollection, got %v", err)
+	}
+}
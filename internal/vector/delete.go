@@ -0,0 +1,67 @@
+package vector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// MatchAny is a filter for points whose payload key holds one of values.
+func MatchAny(key string, values []string) map[string]any {
+	return map[string]any{
+		"must": []map[string]any{{"key": key, "match": map[string]any{"any": values}}},
+	}
+}
+
+// Delete removes the points matching filter and waits until they are gone.
+func (q *Qdrant) Delete(ctx context.Context, filter map[string]any) error {
+	resp, err := q.do(ctx, http.MethodPost, "/collections/"+q.Collection+"/points/delete?wait=true", map[string]any{"filter": filter})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("qdrant delete failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// Scroll pages through the collection's points in ID order without their
+// vectors, starting at offset (empty for the first page). It returns the
+// offset of the next page, empty after the last.
+func (q *Qdrant) Scroll(ctx context.Context, offset string, limit int) ([]SearchHit, string, error) {
+	body := map[string]any{"limit": limit, "with_payload": true, "with_vector": false}
+	if offset != "" {
+		body["offset"] = offset
+	}
+	resp, err := q.do(ctx, http.MethodPost, "/collections/"+q.Collection+"/points/scroll", body)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, "", fmt.Errorf("qdrant scroll failed: %s", resp.Status)
+	}
+	var decoded struct {
+		Result struct {
+			Points []struct {
+				ID      any            `json:"id"`
+				Payload map[string]any `json:"payload"`
+			} `json:"points"`
+			NextPageOffset any `json:"next_page_offset"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return nil, "", err
+	}
+	out := make([]SearchHit, 0, len(decoded.Result.Points))
+	for _, p := range decoded.Result.Points {
+		out = append(out, SearchHit{ID: fmt.Sprintf("%v", p.ID), Payload: p.Payload})
+	}
+	next := ""
+	if decoded.Result.NextPageOffset != nil {
+		next = fmt.Sprintf("%v", decoded.Result.NextPageOffset)
+	}
+	return out, next, nil
+}
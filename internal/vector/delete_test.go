@@ -0,0 +1,70 @@
+package vector
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDeleteSendsPayloadFilter(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/collections/messages/points/delete" || r.URL.Query().Get("wait") != "true" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_, _ = w.Write([]byte(`{"result":{"status":"completed"}}`))
+	}))
+	defer srv.Close()
+
+	q := NewQdrant(srv.URL, "messages")
+	if err := q.Delete(context.Background(), MatchAny("thread_id", []string{"t1", "t2"})); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	raw, _ := json.Marshal(body)
+	want := `{"filter":{"must":[{"key":"thread_id","match":{"any":["t1","t2"]}}]}}`
+	if string(raw) != want {
+		t.Fatalf("delete body = %s, want %s", raw, want)
+	}
+}
+
+func TestScrollPagesUntilNoOffset(t *testing.T) {
+	var offsets []any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		offsets = append(offsets, body["offset"])
+		if body["offset"] == nil {
+			_, _ = w.Write([]byte(`{"result":{"points":[{"id":"m1","payload":{"thread_id":"t1"}}],"next_page_offset":"m2"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"result":{"points":[{"id":"m2","payload":{"thread_id":"t2"}}],"next_page_offset":null}}`))
+	}))
+	defer srv.Close()
+
+	q := NewQdrant(srv.URL, "messages")
+	var ids []string
+	offset := ""
+	for {
+		points, next, err := q.Scroll(context.Background(), offset, 1)
+		if err != nil {
+			t.Fatalf("scroll: %v", err)
+		}
+		for _, p := range points {
+			ids = append(ids, p.ID)
+		}
+		if next == "" {
+			break
+		}
+		offset = next
+	}
+	if len(ids) != 2 || ids[0] != "m1" || ids[1] != "m2" {
+		t.Fatalf("expected both pages, got %v", ids)
+	}
+	if len(offsets) != 2 || offsets[1] != "m2" {
+		t.Fatalf("expected the second request to start at m2, got %v", offsets)
+	}
+}
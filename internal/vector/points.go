@@ -0,0 +1,43 @@
+package vector
+
+import (
+	"strconv"
+
+	"github.com/google/uuid"
+
+	"neuralmail/internal/embed"
+)
+
+// MessagePoints are the points a message is indexed as, one per chunk, with
+// the payload search filters and answers from. The first chunk is keyed by
+// the message ID, so it replaces the point of a message embedded before
+// chunking; later ones by an ID derived from it.
+func MessagePoints(messageID, threadID, inboxID, direction string, chunks []embed.Chunk, vecs [][]float32) []Point {
+	points := make([]Point, len(chunks))
+	for i, chunk := range chunks {
+		points[i] = Point{
+			ID:     chunkPointID(messageID, i),
+			Vector: vecs[i],
+			Payload: map[string]any{
+				"message_id":  messageID,
+				"thread_id":   threadID,
+				"inbox_id":    inboxID,
+				"direction":   direction,
+				"chunk_index": i,
+				"chunk_start": chunk.Start,
+				"chunk_end":   chunk.End,
+				"snippet":     chunk.Text,
+			},
+		}
+	}
+	return points
+}
+
+// chunkPointID keys chunk i of a message. Qdrant only takes UUIDs and
+// integers as IDs, so later chunks get a name-based UUID.
+func chunkPointID(messageID string, i int) string {
+	if i == 0 {
+		return messageID
+	}
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(messageID+"#"+strconv.Itoa(i))).String()
+}
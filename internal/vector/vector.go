@@ -14,6 +14,8 @@ type Store interface {
 	Upsert(ctx context.Context, points []Point) error
 	Search(ctx context.Context, vector []float32, limit int, filter map[string]any) ([]SearchHit, error)
 	EnsureCollection(ctx context.Context, dim int) error
+	Delete(ctx context.Context, filter map[string]any) error
+	Scroll(ctx context.Context, offset string, limit int) ([]SearchHit, string, error)
 	Name() string
 }
 
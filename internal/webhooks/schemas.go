@@ -0,0 +1,337 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Versions lists the payload versions, oldest first. Each endpoint is pinned
+// to one and keeps receiving payloads in that version's shape after newer
+// ones ship, until its owner moves the pin.
+var Versions = []string{"2026-10-01"}
+
+// CurrentVersion is the newest version, the one new endpoints are pinned to.
+var CurrentVersion = Versions[len(Versions)-1]
+
+// Revision is the shape of an event type's data object as of a version.
+type Revision struct {
+	Version string
+	// Schema is the JSON Schema of the data object. Payloads are checked
+	// against it before they are sent and trimmed to the properties it lists.
+	Schema map[string]any
+	// Breaking marks a revision receivers of the previous one cannot read,
+	// such as a renamed or retyped field. It needs Downgrade, which rewrites
+	// its data into the previous revision's shape for endpoints pinned
+	// before it. Additions need neither: older pins just don't see them.
+	Breaking  bool
+	Downgrade func(data map[string]any) map[string]any
+}
+
+var threadEventData = map[string]any{
+	"type":     "object",
+	"required": []any{"thread_id", "inbox_id", "last_message_at", "after_days"},
+	"properties": map[string]any{
+		"thread_id":       map[string]any{"type": "string"},
+		"inbox_id":        map[string]any{"type": "string"},
+		"last_message_at": map[string]any{"type": "string", "format": "date-time"},
+		"after_days":      map[string]any{"type": "integer"},
+	},
+}
+
+var domainEventData = map[string]any{
+	"type":     "object",
+	"required": []any{"domain_id", "domain", "status", "previous_status"},
+	"properties": map[string]any{
+		"domain_id":       map[string]any{"type": "string"},
+		"domain":          map[string]any{"type": "string"},
+		"status":          map[string]any{"type": "string"},
+		"previous_status": map[string]any{"type": "string"},
+		"mx_verified":     map[string]any{"type": "boolean"},
+		"spf_verified":    map[string]any{"type": "boolean"},
+		"dkim_verified":   map[string]any{"type": "boolean"},
+		"dmarc_verified":  map[string]any{"type": "boolean"},
+		"details":         map[string]any{"type": "string"},
+	},
+}
+
+// registry holds every event type's revisions, oldest first. Evolve a
+// payload by appending a revision under a new version; Check, run by the
+// tests, rejects revisions that break receivers without saying so.
+var registry = map[string][]Revision{
+	"webhook.test": {{
+		Version: "2026-10-01",
+		Schema: map[string]any{
+			"type":     "object",
+			"required": []any{"endpoint_id", "message"},
+			"properties": map[string]any{
+				"endpoint_id": map[string]any{"type": "string"},
+				"message":     map[string]any{"type": "string"},
+			},
+		},
+	}},
+	"thread.nudged":      {{Version: "2026-10-01", Schema: threadEventData}},
+	"thread.auto_closed": {{Version: "2026-10-01", Schema: threadEventData}},
+	"domain.verified":    {{Version: "2026-10-01", Schema: domainEventData}},
+	"domain.failed":      {{Version: "2026-10-01", Schema: domainEventData}},
+	"rule.matched": {{
+		Version: "2026-10-01",
+		Schema: map[string]any{
+			"type":     "object",
+			"required": []any{"rule_id", "rule_name", "message_id", "thread_id", "inbox_id"},
+			"properties": map[string]any{
+				"rule_id":    map[string]any{"type": "string"},
+				"rule_name":  map[string]any{"type": "string"},
+				"message_id": map[string]any{"type": "string"},
+				"thread_id":  map[string]any{"type": "string"},
+				"inbox_id":   map[string]any{"type": "string"},
+				"subject":    map[string]any{"type": "string"},
+				"from":       map[string]any{"type": "string"},
+			},
+		},
+	}},
+}
+
+// EventTypes returns the registered event types, sorted.
+func EventTypes() []string {
+	return slices.Sorted(maps.Keys(registry))
+}
+
+// ValidVersion reports whether v is a known payload version.
+func ValidVersion(v string) bool {
+	return slices.Contains(Versions, v)
+}
+
+// revisionAt returns the index of eventType's revision in effect at
+// version: the latest not newer than it, or the first for an event that
+// did not exist yet at version.
+func revisionAt(eventType, version string) ([]Revision, int, error) {
+	revisions, ok := registry[eventType]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown event type %q", eventType)
+	}
+	if !ValidVersion(version) {
+		return nil, 0, fmt.Errorf("unknown webhook version %q", version)
+	}
+	at := 0
+	for i, rev := range revisions {
+		if rev.Version <= version {
+			at = i
+		}
+	}
+	return revisions, at, nil
+}
+
+// Schema returns the JSON Schema of a whole eventType event, envelope
+// included, as sent to endpoints pinned to version.
+func Schema(eventType, version string) (map[string]any, error) {
+	revisions, at, err := revisionAt(eventType, version)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"$schema":  "https://json-schema.org/draft/2020-12/schema",
+		"title":    eventType,
+		"type":     "object",
+		"required": []any{"id", "type", "api_version", "created", "data"},
+		"properties": map[string]any{
+			"id":          map[string]any{"type": "string"},
+			"type":        map[string]any{"type": "string", "const": eventType},
+			"api_version": map[string]any{"type": "string", "const": version},
+			"created":     map[string]any{"type": "integer"},
+			"data":        revisions[at].Schema,
+		},
+	}, nil
+}
+
+// Render shapes data, given in the newest revision's shape, for endpoints
+// pinned to version: breaking revisions after the pin are downgraded, then
+// the result is checked against the pinned schema and trimmed to it.
+func Render(eventType, version string, data any) (json.RawMessage, error) {
+	revisions, at, err := revisionAt(eventType, version)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var value map[string]any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, fmt.Errorf("%s data: %w", eventType, err)
+	}
+	for i := len(revisions) - 1; i > at; i-- {
+		if revisions[i].Downgrade != nil {
+			value = revisions[i].Downgrade(value)
+		}
+	}
+	shaped, err := conform(revisions[at].Schema, value, "data")
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", eventType, revisions[at].Version, err)
+	}
+	return json.Marshal(shaped)
+}
+
+// conform checks v against the subset of JSON Schema the registry uses
+// (type, required, properties, items, enum and the date-time format) and
+// drops object properties the schema does not list.
+func conform(schema map[string]any, v any, path string) (any, error) {
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, v) {
+		return nil, fmt.Errorf("%s: %v is not one of %v", path, v, enum)
+	}
+	switch schema["type"] {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: want an object", path)
+		}
+		for _, name := range schemaRequired(schema) {
+			if _, ok := obj[name]; !ok {
+				return nil, fmt.Errorf("%s: missing %s", path, name)
+			}
+		}
+		props, _ := schema["properties"].(map[string]any)
+		out := make(map[string]any, len(props))
+		for name, val := range obj {
+			prop, ok := props[name].(map[string]any)
+			if !ok {
+				continue
+			}
+			shaped, err := conform(prop, val, path+"."+name)
+			if err != nil {
+				return nil, err
+			}
+			out[name] = shaped
+		}
+		return out, nil
+	case "array":
+		list, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: want an array", path)
+		}
+		items, _ := schema["items"].(map[string]any)
+		out := make([]any, len(list))
+		for i, item := range list {
+			shaped, err := conform(items, item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = shaped
+		}
+		return out, nil
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: want a string", path)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return nil, fmt.Errorf("%s: want an RFC 3339 time", path)
+			}
+		}
+	case "integer":
+		n, ok := v.(float64)
+		if !ok || n != math.Trunc(n) {
+			return nil, fmt.Errorf("%s: want an integer", path)
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return nil, fmt.Errorf("%s: want a number", path)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return nil, fmt.Errorf("%s: want a boolean", path)
+		}
+	}
+	return v, nil
+}
+
+func schemaRequired(schema map[string]any) []string {
+	required, _ := schema["required"].([]any)
+	names := make([]string, 0, len(required))
+	for _, name := range required {
+		names = append(names, name.(string))
+	}
+	return names
+}
+
+// Incompatible lists what a receiver written against old would trip over in
+// payloads shaped by next: a field removed or no longer always sent, or a
+// field whose type changed. Added fields are compatible.
+func Incompatible(old, next map[string]any) []string {
+	return incompatible(old, next, "data")
+}
+
+func incompatible(old, next map[string]any, path string) []string {
+	if old["type"] != next["type"] {
+		return []string{fmt.Sprintf("%s: type changed from %v to %v", path, old["type"], next["type"])}
+	}
+	var problems []string
+	switch old["type"] {
+	case "object":
+		required := schemaRequired(next)
+		for _, name := range schemaRequired(old) {
+			if !slices.Contains(required, name) {
+				problems = append(problems, fmt.Sprintf("%s.%s: no longer required", path, name))
+			}
+		}
+		oldProps, _ := old["properties"].(map[string]any)
+		nextProps, _ := next["properties"].(map[string]any)
+		for _, name := range slices.Sorted(maps.Keys(oldProps)) {
+			nextProp, ok := nextProps[name].(map[string]any)
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s: removed", path, name))
+				continue
+			}
+			problems = append(problems, incompatible(oldProps[name].(map[string]any), nextProp, path+"."+name)...)
+		}
+	case "array":
+		oldItems, _ := old["items"].(map[string]any)
+		nextItems, _ := next["items"].(map[string]any)
+		problems = append(problems, incompatible(oldItems, nextItems, path+"[]")...)
+	}
+	return problems
+}
+
+// Check validates the registry: revisions are on known versions in order,
+// and each one is compatible with the one before it unless it is marked
+// Breaking and says how to downgrade.
+func Check() error {
+	return checkRegistry(registry)
+}
+
+func checkRegistry(reg map[string][]Revision) error {
+	var problems []string
+	for _, eventType := range slices.Sorted(maps.Keys(reg)) {
+		revisions := reg[eventType]
+		for i, rev := range revisions {
+			if !ValidVersion(rev.Version) {
+				problems = append(problems, fmt.Sprintf("%s: unknown version %q", eventType, rev.Version))
+				continue
+			}
+			if i == 0 {
+				continue
+			}
+			prev := revisions[i-1]
+			if rev.Version <= prev.Version {
+				problems = append(problems, fmt.Sprintf("%s: version %s does not follow %s", eventType, rev.Version, prev.Version))
+				continue
+			}
+			breaks := Incompatible(prev.Schema, rev.Schema)
+			switch {
+			case len(breaks) > 0 && !rev.Breaking:
+				problems = append(problems, fmt.Sprintf("%s %s breaks %s without being marked Breaking: %s", eventType, rev.Version, prev.Version, strings.Join(breaks, "; ")))
+			case rev.Breaking && rev.Downgrade == nil:
+				problems = append(problems, fmt.Sprintf("%s %s is Breaking but has no Downgrade", eventType, rev.Version))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("webhook schemas: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
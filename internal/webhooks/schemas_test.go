@@ -0,0 +1,152 @@
+package webhooks
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistryIsCompatible(t *testing.T) {
+	if err := Check(); err != nil {
+		t.Fatal(err)
+	}
+	for _, eventType := range EventTypes() {
+		for _, version := range Versions {
+			if _, err := Schema(eventType, version); err != nil {
+				t.Fatalf("%s %s: %v", eventType, version, err)
+			}
+		}
+	}
+}
+
+func TestRenderChecksAndTrimsData(t *testing.T) {
+	data := map[string]any{
+		"thread_id":       "t1",
+		"inbox_id":        "i1",
+		"last_message_at": time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC),
+		"after_days":      7,
+		"internal_note":   "not part of the schema",
+	}
+	raw, err := Render("thread.auto_closed", CurrentVersion, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "internal_note") {
+		t.Fatalf("unlisted field sent: %s", raw)
+	}
+
+	delete(data, "inbox_id")
+	if _, err := Render("thread.auto_closed", CurrentVersion, data); err == nil {
+		t.Fatal("expected a payload missing a required field to fail")
+	}
+	data["inbox_id"], data["after_days"] = "i1", "seven"
+	if _, err := Render("thread.auto_closed", CurrentVersion, data); err == nil {
+		t.Fatal("expected a mistyped field to fail")
+	}
+	if _, err := Render("thread.unknown", CurrentVersion, data); err == nil {
+		t.Fatal("expected an unknown event type to fail")
+	}
+}
+
+func TestPinnedVersionsKeepTheirShape(t *testing.T) {
+	v1 := map[string]any{
+		"type":     "object",
+		"required": []any{"id", "size"},
+		"properties": map[string]any{
+			"id":   map[string]any{"type": "string"},
+			"size": map[string]any{"type": "integer"},
+		},
+	}
+	v2 := map[string]any{
+		"type":     "object",
+		"required": []any{"id", "size"},
+		"properties": map[string]any{
+			"id":    map[string]any{"type": "string"},
+			"size":  map[string]any{"type": "integer"},
+			"label": map[string]any{"type": "string"},
+		},
+	}
+	v3 := map[string]any{
+		"type":     "object",
+		"required": []any{"id", "size_bytes", "label"},
+		"properties": map[string]any{
+			"id":         map[string]any{"type": "string"},
+			"size_bytes": map[string]any{"type": "integer"},
+			"label":      map[string]any{"type": "string"},
+		},
+	}
+	rename := func(data map[string]any) map[string]any {
+		data["size"] = data["size_bytes"]
+		delete(data, "size_bytes")
+		return data
+	}
+
+	savedVersions, savedRegistry := Versions, registry
+	t.Cleanup(func() { Versions, registry = savedVersions, savedRegistry })
+	Versions = []string{"2026-01-01", "2026-02-01", "2026-03-01"}
+	registry = map[string][]Revision{"file.stored": {
+		{Version: "2026-01-01", Schema: v1},
+		{Version: "2026-02-01", Schema: v2},
+		{Version: "2026-03-01", Schema: v3, Breaking: true, Downgrade: rename},
+	}}
+	if err := Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	latest := func() map[string]any {
+		return map[string]any{"id": "f1", "size_bytes": 42, "label": "invoice"}
+	}
+	want := map[string]string{
+		"2026-01-01": `{"id":"f1","size":42}`,
+		"2026-02-01": `{"id":"f1","label":"invoice","size":42}`,
+		"2026-03-01": `{"id":"f1","label":"invoice","size_bytes":42}`,
+	}
+	for version, payload := range want {
+		event, err := NewEvent("evt_1", "file.stored", version, time.Unix(0, 0), latest())
+		if err != nil {
+			t.Fatalf("%s: %v", version, err)
+		}
+		if event.APIVersion != version || string(event.Data) != payload {
+			t.Fatalf("%s: data = %s, want %s", version, event.Data, payload)
+		}
+	}
+
+	registry["file.stored"][2].Breaking = false
+	if err := Check(); err == nil || !strings.Contains(err.Error(), "size: removed") {
+		t.Fatalf("expected the rename to be caught, got %v", err)
+	}
+	registry["file.stored"][2].Breaking, registry["file.stored"][2].Downgrade = true, nil
+	if err := Check(); err == nil {
+		t.Fatal("expected a breaking revision without a downgrade to fail")
+	}
+}
+
+func TestIncompatibleAllowsAdditions(t *testing.T) {
+	old := map[string]any{
+		"type":       "object",
+		"required":   []any{"id"},
+		"properties": map[string]any{"id": map[string]any{"type": "string"}},
+	}
+	next := map[string]any{
+		"type":     "object",
+		"required": []any{"id"},
+		"properties": map[string]any{
+			"id":   map[string]any{"type": "string"},
+			"tags": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		},
+	}
+	if problems := Incompatible(old, next); len(problems) != 0 {
+		t.Fatalf("addition flagged: %v", problems)
+	}
+	if problems := Incompatible(next, old); len(problems) != 1 {
+		t.Fatalf("removal not flagged once: %v", problems)
+	}
+	retyped := map[string]any{
+		"type":       "object",
+		"required":   []any{},
+		"properties": map[string]any{"id": map[string]any{"type": "integer"}},
+	}
+	if problems := Incompatible(old, retyped); len(problems) != 2 {
+		t.Fatalf("expected optional and retyped id, got %v", problems)
+	}
+}
@@ -0,0 +1,184 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SignatureHeader carries "t=<unix>,v1=<hex hmac>" computed over
+// "<unix>.<body>", the same scheme Stripe uses for its own webhooks.
+const SignatureHeader = "Nerve-Signature"
+
+// maxResponseBody bounds how much of a receiver's reply is kept in history.
+const maxResponseBody = 2048
+
+// Event is the envelope every payload is sent in. APIVersion is the version
+// of the endpoint it was rendered for; see Render.
+type Event struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	APIVersion string          `json:"api_version"`
+	CreatedAt  int64           `json:"created"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// NewEvent builds an event whose data is rendered for version.
+func NewEvent(id, eventType, version string, created time.Time, data any) (Event, error) {
+	raw, err := Render(eventType, version, data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{ID: id, Type: eventType, APIVersion: version, CreatedAt: created.Unix(), Data: raw}, nil
+}
+
+type Result struct {
+	StatusCode   int
+	ResponseBody string
+	Err          error
+	Duration     time.Duration
+}
+
+// Delivered reports whether the receiver acknowledged the event with a 2xx.
+func (r Result) Delivered() bool {
+	return r.Err == nil && r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+type Sender struct {
+	Client *http.Client
+	Now    func() time.Time
+}
+
+// NewSender returns a sender whose client refuses to connect to internal
+// addresses; see publicAddr. The check runs on the address being dialed,
+// redirects included, so a hostname that resolves somewhere public when
+// the endpoint is registered and somewhere internal later is still
+// refused. Proxies from the environment are not used, as they would dial
+// on the sender's behalf unchecked.
+func NewSender() *Sender {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: refuseInternal}
+	return &Sender{
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: 5 * time.Second,
+				MaxIdleConnsPerHost: 2,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+		Now: func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// ErrInternalAddress is returned, wrapped, for a webhook URL that leads to
+// an address NewSender's client refuses to dial.
+var ErrInternalAddress = errors.New("webhook address is not publicly routable")
+
+// reserved lists the ranges publicAddr refuses beyond what netip classifies:
+// "this network", the RFC 6598 shared space carriers and some clouds use
+// internally (Alibaba's metadata endpoint among them), IETF protocol
+// assignments and the benchmarking range.
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+// publicAddr reports whether webhooks may be delivered to addr: a global
+// unicast address that is not private or reserved. Loopback, link-local
+// (which holds the 169.254.169.254 cloud metadata endpoint), multicast and
+// unspecified addresses are not global unicast.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, p := range reserved {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+func refuseInternal(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !publicAddr(addr) {
+		return fmt.Errorf("%w: %s", ErrInternalAddress, addr)
+	}
+	return nil
+}
+
+// NewTestEvent builds the sample payload sent by the test-delivery endpoint,
+// in the endpoint's version.
+func NewTestEvent(now time.Time, endpointID, version string) (Event, error) {
+	return NewEvent("evt_test_"+uuid.NewString(), "webhook.test", version, now, map[string]any{
+		"endpoint_id": endpointID,
+		"message":     "This is a test event from Nerve.",
+	})
+}
+
+func Sign(secret string, timestamp int64, payload []byte) string {
+	ts := strconv.FormatInt(timestamp, 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "." + string(payload)))
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send posts a signed payload to url. Transport failures are returned in
+// Result.Err rather than as an error so callers can record the attempt.
+func (s *Sender) Send(ctx context.Context, url, secret, eventID, eventType string, payload []byte) Result {
+	if s == nil {
+		return Result{Err: errors.New("webhook sender not configured")}
+	}
+	now := s.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return Result{Err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Nerve-Webhooks/1.0")
+	req.Header.Set("Nerve-Event-Id", eventID)
+	req.Header.Set("Nerve-Event-Type", eventType)
+	req.Header.Set(SignatureHeader, Sign(secret, now.Unix(), payload))
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return Result{Err: err, Duration: time.Since(start)}
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	return Result{
+		StatusCode:   resp.StatusCode,
+		ResponseBody: string(body),
+		Duration:     time.Since(start),
+	}
+}
@@ -0,0 +1,108 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSendSignsPayload(t *testing.T) {
+	now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+	var gotHeader, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Get(SignatureHeader)
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	sender := NewSender()
+	sender.Client = srv.Client()
+	sender.Now = func() time.Time { return now }
+	result := sender.Send(context.Background(), srv.URL, "whsec_test", "evt_1", "webhook.test", []byte(`{"id":"evt_1"}`))
+	if !result.Delivered() {
+		t.Fatalf("expected delivery, got %+v", result)
+	}
+	if result.StatusCode != http.StatusAccepted || result.ResponseBody != "ok" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	mac := hmac.New(sha256.New, []byte("whsec_test"))
+	mac.Write([]byte("1770465600." + gotBody))
+	want := "t=1770465600,v1=" + hex.EncodeToString(mac.Sum(nil))
+	if gotHeader != want {
+		t.Fatalf("expected signature %q, got %q", want, gotHeader)
+	}
+}
+
+func TestSendRecordsNon2xxAsUndelivered(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, strings.Repeat("x", 4096), http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	sender := NewSender()
+	sender.Client = srv.Client()
+	result := sender.Send(context.Background(), srv.URL, "secret", "evt_2", "webhook.test", []byte(`{}`))
+	if result.Delivered() {
+		t.Fatalf("expected 500 to be undelivered")
+	}
+	if len(result.ResponseBody) != maxResponseBody {
+		t.Fatalf("expected truncated response body, got %d bytes", len(result.ResponseBody))
+	}
+}
+
+func TestSendRefusesInternalAddresses(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer srv.Close()
+
+	result := NewSender().Send(context.Background(), srv.URL, "secret", "evt_3", "webhook.test", []byte(`{}`))
+	if !errors.Is(result.Err, ErrInternalAddress) {
+		t.Fatalf("expected a loopback receiver to be refused, got %+v", result)
+	}
+	if hits.Load() != 0 {
+		t.Fatalf("expected no request to reach the receiver")
+	}
+}
+
+func TestPublicAddr(t *testing.T) {
+	cases := map[string]bool{
+		"93.184.215.14":        true,
+		"2606:4700::1111":      true,
+		"127.0.0.1":            false,
+		"::1":                  false,
+		"10.1.2.3":             false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"169.254.169.254":      false,
+		"fe80::1":              false,
+		"fd00:ec2::254":        false,
+		"100.100.100.200":      false,
+		"0.0.0.0":              false,
+		"::":                   false,
+		"::ffff:127.0.0.1":     false,
+		"::ffff:93.184.215.14": true,
+		"224.0.0.1":            false,
+		"255.255.255.255":      false,
+	}
+	for raw, want := range cases {
+		if got := publicAddr(netip.MustParseAddr(raw)); got != want {
+			t.Errorf("publicAddr(%s) = %v, want %v", raw, got, want)
+		}
+	}
+}
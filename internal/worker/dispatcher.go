@@ -0,0 +1,192 @@
+// Package worker runs queued jobs by type: each type has a handler and a
+// number of goroutines taking jobs from its queue, and periodic types are
+// queued on a schedule all workers share.
+package worker
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"neuralmail/internal/queue"
+)
+
+// Queue is where the dispatcher takes jobs from; *queue.Queue implements
+// it.
+type Queue interface {
+	Pop(ctx context.Context, name string, timeout time.Duration) (queue.Job, error)
+	Ack(ctx context.Context, name string, job queue.Job) error
+	Fail(ctx context.Context, name string, job queue.Job, cause error) (bool, error)
+	RecordResult(ctx context.Context, name string, job queue.Job, age time.Duration, failed bool) error
+	Schedule(ctx context.Context, name string, interval time.Duration) (bool, error)
+	Maintenance(ctx context.Context) (bool, error)
+}
+
+// Handler runs one job. An error fails the attempt, which is retried with
+// backoff until the job is dead-lettered.
+type Handler func(ctx context.Context, job queue.Job) error
+
+// ErrSkip, wrapped in a handler's error, marks a job dropped on purpose: it
+// is acked without counting as processed or failed.
+var ErrSkip = errors.New("job skipped")
+
+// Dispatcher runs the handlers registered for each job type.
+type Dispatcher struct {
+	Queue Queue
+	// Concurrency is how many jobs of a type run at once, by type. A type
+	// not listed runs one at a time; 0 leaves it to other workers.
+	Concurrency map[string]int
+	// PollTimeout bounds each wait for a job, and is how long a consumer
+	// sleeps while maintenance mode is on or the queue is unreachable.
+	PollTimeout time.Duration
+
+	handlers  map[string]Handler
+	schedules map[string]time.Duration
+}
+
+func New(q Queue, concurrency map[string]int) *Dispatcher {
+	return &Dispatcher{
+		Queue:       q,
+		Concurrency: concurrency,
+		PollTimeout: 5 * time.Second,
+		handlers:    map[string]Handler{},
+		schedules:   map[string]time.Duration{},
+	}
+}
+
+// Handle registers h for jobType's jobs.
+func (d *Dispatcher) Handle(jobType string, h Handler) {
+	d.handlers[jobType] = h
+}
+
+// Every queues a jobType job once per interval across all workers; a
+// non-positive interval never does.
+func (d *Dispatcher) Every(jobType string, interval time.Duration) {
+	if interval > 0 {
+		d.schedules[jobType] = interval
+	}
+}
+
+func (d *Dispatcher) limit(jobType string) int {
+	if n, ok := d.Concurrency[jobType]; ok {
+		return max(n, 0)
+	}
+	return 1
+}
+
+// Run consumes and schedules jobs until ctx is done and the jobs in
+// progress have finished.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	running := map[string]int{}
+	for jobType, h := range d.handlers {
+		for range d.limit(jobType) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.consume(ctx, jobType, h)
+			}()
+		}
+		running[jobType] = d.limit(jobType)
+	}
+	for jobType, interval := range d.schedules {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.schedule(ctx, jobType, interval)
+		}()
+	}
+	types := make([]string, 0, len(running))
+	for jobType := range running {
+		types = append(types, jobType)
+	}
+	sort.Strings(types)
+	args := make([]any, 0, len(types)*2)
+	for _, jobType := range types {
+		args = append(args, jobType, running[jobType])
+	}
+	slog.Info("worker started", args...)
+	wg.Wait()
+}
+
+func (d *Dispatcher) consume(ctx context.Context, jobType string, h Handler) {
+	name := queue.QueueName(jobType)
+	for ctx.Err() == nil {
+		if on, _ := d.Queue.Maintenance(ctx); on {
+			sleep(ctx, d.PollTimeout)
+			continue
+		}
+		job, err := d.Queue.Pop(ctx, name, d.PollTimeout)
+		if errors.Is(err, queue.ErrNoJob) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			// Redis stayed unavailable past the failover window; back off
+			// rather than spin on a dead connection.
+			slog.Error("job queue unavailable", "type", jobType, "err", err)
+			sleep(ctx, d.PollTimeout)
+			continue
+		}
+		d.run(ctx, jobType, h, job)
+	}
+}
+
+// run handles one job and acks or fails it.
+func (d *Dispatcher) run(ctx context.Context, jobType string, h Handler, job queue.Job) {
+	name := queue.QueueName(jobType)
+	age := job.Age(time.Now())
+	attrs := []any{"type", jobType, "trace_id", job.TraceID, "origin", job.Origin, "attempts", job.Attempts, "age", age.Round(time.Millisecond)}
+	if job.MessageID != "" {
+		attrs = append(attrs, "message", job.MessageID)
+	}
+	err := h(ctx, job)
+	if errors.Is(err, ErrSkip) {
+		slog.Info("skipped job", append(attrs, "err", err)...)
+		if err := d.Queue.Ack(ctx, name, job); err != nil {
+			slog.Warn("job ack failed", append(attrs, "err", err)...)
+		}
+		return
+	}
+	if statsErr := d.Queue.RecordResult(ctx, name, job, age, err != nil); statsErr != nil {
+		slog.Warn("queue stats update failed", append(attrs, "err", statsErr)...)
+	}
+	if err != nil {
+		dead, failErr := d.Queue.Fail(ctx, name, job, err)
+		slog.Error("job failed", append(attrs, "dead_lettered", dead, "err", errors.Join(err, failErr))...)
+		return
+	}
+	if err := d.Queue.Ack(ctx, name, job); err != nil {
+		slog.Warn("job ack failed", append(attrs, "err", err)...)
+	}
+	slog.Info("processed job", attrs...)
+}
+
+// schedule offers a jobType job every interval; the queue keeps it to one
+// per interval across workers.
+func (d *Dispatcher) schedule(ctx context.Context, jobType string, interval time.Duration) {
+	for {
+		if _, err := d.Queue.Schedule(ctx, queue.QueueName(jobType), interval); err != nil && ctx.Err() == nil {
+			slog.Error("job schedule failed", "type", jobType, "err", err)
+		}
+		if !sleep(ctx, interval) {
+			return
+		}
+	}
+}
+
+// sleep waits for d or until ctx is done, reporting whether ctx is still
+// live.
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
@@ -0,0 +1,144 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"neuralmail/internal/queue"
+)
+
+// fakeQueue hands out the jobs queued on it and records what became of
+// them.
+type fakeQueue struct {
+	mu     sync.Mutex
+	jobs   map[string][]queue.Job
+	acked  []string
+	failed []string
+	ticks  map[string]int
+}
+
+func newFakeQueue() *fakeQueue {
+	return &fakeQueue{jobs: map[string][]queue.Job{}, ticks: map[string]int{}}
+}
+
+func (f *fakeQueue) Pop(ctx context.Context, name string, timeout time.Duration) (queue.Job, error) {
+	f.mu.Lock()
+	if jobs := f.jobs[name]; len(jobs) > 0 {
+		f.jobs[name] = jobs[1:]
+		f.mu.Unlock()
+		job := jobs[0]
+		job.Attempts++
+		return job, nil
+	}
+	f.mu.Unlock()
+	sleep(ctx, time.Millisecond)
+	return queue.Job{}, queue.ErrNoJob
+}
+
+func (f *fakeQueue) Ack(_ context.Context, _ string, job queue.Job) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.acked = append(f.acked, job.TraceID)
+	return nil
+}
+
+func (f *fakeQueue) Fail(_ context.Context, _ string, job queue.Job, _ error) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failed = append(f.failed, job.TraceID)
+	return false, nil
+}
+
+func (f *fakeQueue) RecordResult(context.Context, string, queue.Job, time.Duration, bool) error {
+	return nil
+}
+
+func (f *fakeQueue) Schedule(_ context.Context, name string, _ time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ticks[name]++
+	return true, nil
+}
+
+func (f *fakeQueue) Maintenance(context.Context) (bool, error) {
+	return false, nil
+}
+
+func TestDispatcherAcksFailsAndSkips(t *testing.T) {
+	q := newFakeQueue()
+	name := queue.QueueName(queue.TypeWebhookDelivery)
+	q.jobs[name] = []queue.Job{{TraceID: "ok"}, {TraceID: "broken"}, {TraceID: "skip"}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := New(q, nil)
+	d.PollTimeout = time.Millisecond
+	var handled atomic.Int32
+	d.Handle(queue.TypeWebhookDelivery, func(ctx context.Context, job queue.Job) error {
+		defer func() {
+			if handled.Add(1) == 3 {
+				cancel()
+			}
+		}()
+		switch job.TraceID {
+		case "broken":
+			return errors.New("receiver down")
+		case "skip":
+			return fmt.Errorf("endpoint removed: %w", ErrSkip)
+		}
+		return nil
+	})
+	d.Run(ctx)
+
+	if len(q.acked) != 2 || q.acked[0] != "ok" || q.acked[1] != "skip" {
+		t.Fatalf("expected ok and skip acked, got %v", q.acked)
+	}
+	if len(q.failed) != 1 || q.failed[0] != "broken" {
+		t.Fatalf("expected broken failed, got %v", q.failed)
+	}
+}
+
+func TestDispatcherLimitsConcurrencyPerType(t *testing.T) {
+	q := newFakeQueue()
+	for i := range 12 {
+		q.jobs[queue.QueueName(queue.TypeEmbedding)] = append(q.jobs[queue.QueueName(queue.TypeEmbedding)], queue.Job{TraceID: fmt.Sprint(i)})
+	}
+	q.jobs[queue.QueueName(queue.TypeSummarization)] = []queue.Job{{TraceID: "left for another worker"}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := New(q, map[string]int{queue.TypeEmbedding: 3, queue.TypeSummarization: 0})
+	d.PollTimeout = time.Millisecond
+	var inFlight, peak, done atomic.Int32
+	d.Handle(queue.TypeEmbedding, func(ctx context.Context, job queue.Job) error {
+		n := inFlight.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		inFlight.Add(-1)
+		if done.Add(1) == 12 {
+			cancel()
+		}
+		return nil
+	})
+	d.Handle(queue.TypeSummarization, func(context.Context, queue.Job) error {
+		t.Error("summarization has concurrency 0 and must not run here")
+		return nil
+	})
+	d.Every(queue.TypeRetentionSweep, time.Hour)
+	d.Run(ctx)
+
+	if got := peak.Load(); got != 3 {
+		t.Fatalf("expected 3 embedding jobs at once, peaked at %d", got)
+	}
+	if q.ticks[queue.QueueName(queue.TypeRetentionSweep)] != 1 {
+		t.Fatalf("expected one retention sweep scheduled, got %v", q.ticks)
+	}
+}